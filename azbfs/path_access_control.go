@@ -0,0 +1,67 @@
+package azbfs
+
+import (
+	"context"
+)
+
+// AccessControl represents the owner, owning group, permission bits and access control list of a file or directory.
+// These are only available when Hierarchical Namespace is enabled for the account.
+type AccessControl struct {
+	Owner string
+	Group string
+	// Permissions are symbolic, e.g. rwxr-x---, with a trailing + if there is an extended ACL, and t or T for the sticky bit
+	Permissions string
+	// ACL is the POSIX access control list, e.g. user::rwx,user:<object id>:r-x,group::r-x,mask::r-x,other::---
+	ACL string
+}
+
+func getAccessControl(ctx context.Context, client pathClient, filesystem string, path string) (AccessControl, error) {
+	resp, err := client.GetProperties(ctx, filesystem, path, PathGetPropertiesActionGetAccessControl, nil,
+		nil, nil, nil,
+		nil, nil, nil, nil, nil)
+	if err != nil {
+		return AccessControl{}, err
+	}
+	return AccessControl{Owner: resp.XMsOwner(), Group: resp.XMsGroup(), Permissions: resp.XMsPermissions(), ACL: resp.XMsACL()}, nil
+}
+
+// setAccessControl sets whichever of the fields of ac are not empty. The service takes either permissions or an ACL,
+// so the permissions are only sent when there is no ACL
+func setAccessControl(ctx context.Context, client pathClient, filesystem string, path string, ac AccessControl) (*PathUpdateResponse, error) {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	var permissions *string
+	if ac.ACL == "" {
+		permissions = optional(ac.Permissions)
+	}
+
+	overrideHttpVerb := "PATCH" // see AppendData
+	return client.Update(ctx, PathUpdateActionSetAccessControl, filesystem, path, nil,
+		nil, nil, nil, nil, nil, nil,
+		nil, nil, nil, nil, nil, optional(ac.Owner), optional(ac.Group),
+		permissions, optional(ac.ACL), nil, nil, nil, nil, &overrideHttpVerb, nil, nil, nil, nil)
+}
+
+// GetAccessControl returns the owner, group, permissions and ACL of the file.
+func (f FileURL) GetAccessControl(ctx context.Context) (AccessControl, error) {
+	return getAccessControl(ctx, f.fileClient, f.fileSystemName, f.path)
+}
+
+// SetAccessControl sets the owner, group, and either the ACL or the permissions of the file, leaving out any that are empty.
+func (f FileURL) SetAccessControl(ctx context.Context, ac AccessControl) (*PathUpdateResponse, error) {
+	return setAccessControl(ctx, f.fileClient, f.fileSystemName, f.path, ac)
+}
+
+// GetAccessControl returns the owner, group, permissions and ACL of the directory.
+func (d DirectoryURL) GetAccessControl(ctx context.Context) (AccessControl, error) {
+	return getAccessControl(ctx, d.directoryClient, d.filesystem, d.pathParameter)
+}
+
+// SetAccessControl sets the owner, group, and either the ACL or the permissions of the directory, leaving out any that are empty.
+func (d DirectoryURL) SetAccessControl(ctx context.Context, ac AccessControl) (*PathUpdateResponse, error) {
+	return setAccessControl(ctx, d.directoryClient, d.filesystem, d.pathParameter, ac)
+}
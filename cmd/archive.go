@@ -0,0 +1,357 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// archiveStats counts what went into, or came out of, an archive
+type archiveStats struct {
+	Files       uint64
+	Directories uint64
+	Bytes       uint64
+	Skipped     []string // entries that aren't regular files or directories, or files that already existed
+}
+
+// cookArchive validates the archive flag. An archive is streamed to or from a single blob, outside of a job,
+// so it can't be combined with the flags that choose which files a job transfers
+func (raw rawCopyCmdArgs) cookArchive(fromTo common.FromTo) (common.Archive, error) {
+	archive := common.EArchive.None()
+	if raw.archive == "" {
+		return archive, nil
+	}
+	if err := archive.Parse(raw.archive); err != nil {
+		return archive, fmt.Errorf("invalid archive value '%s'. Options are none, tar and tar.gz", raw.archive)
+	}
+	if archive == common.EArchive.None() {
+		return archive, nil
+	}
+
+	switch fromTo {
+	case common.EFromTo.LocalBlob():
+		if info, err := os.Stat(raw.src); err != nil || !info.IsDir() {
+			return archive, errors.New("archive uploads a local directory, so the source must be a directory that exists")
+		}
+	case common.EFromTo.BlobLocal():
+	default:
+		return archive, errors.New("archive can only upload a local directory to a blob, or download a blob to a local directory")
+	}
+	if raw.urlList != "" || raw.listOfFilesToCopy != "" || raw.inventoryReport != "" || raw.includePath != "" || raw.excludePath != "" ||
+		raw.include != "" || raw.exclude != "" || raw.idempotencyKey != "" {
+		return archive, errors.New("cannot combine archive with url-list, list-of-files, from-inventory, include or exclude flags, or idempotency-key")
+	}
+	return archive, nil
+}
+
+// processArchiveCopy uploads the source directory as one tar blob, or extracts the source blob into the destination directory
+func (cca *cookedCopyCmdArgs) processArchiveCopy() error {
+	var stats archiveStats
+	var err error
+	if cca.fromTo == common.EFromTo.LocalBlob() {
+		stats, err = cca.processArchiveUpload()
+	} else {
+		stats, err = cca.processArchiveDownload()
+	}
+	if err != nil {
+		return err
+	}
+
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			jsonOutput, err := json.Marshal(stats)
+			common.PanicIfErr(err)
+			return string(jsonOutput)
+		}
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Files: %d\nDirectories: %d\nBytes: %d\n", stats.Files, stats.Directories, stats.Bytes))
+		for _, s := range stats.Skipped {
+			sb.WriteString("Skipped: " + s + "\n")
+		}
+		return sb.String()
+	}, common.EExitCode.Success())
+	return nil
+}
+
+func (cca *cookedCopyCmdArgs) processArchiveUpload() (archiveStats, error) {
+	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
+	blockSize := cca.blockSize
+	if blockSize == 0 {
+		blockSize = pipingDefaultBlockSize
+	}
+
+	p, err := createBlobPipeline(ctx, common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()})
+	if err != nil {
+		return archiveStats{}, err
+	}
+	u, err := url.Parse(cca.destination)
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("fatal: cannot parse destination blob URL due to error: %s", err.Error())
+	}
+	metadata, err := common.UnMarshalToCommonMetadata(cca.metadata)
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("fatal: cannot parse metadata due to error: %s", err.Error())
+	}
+	contentType := cca.contentType
+	if contentType == "" {
+		contentType = archiveContentType(cca.archive)
+	}
+
+	// the archive is written into a pipe as the directory is walked, and uploaded in blocks as it comes out of the other end,
+	// so neither the whole archive nor its size ever needs to be known. If the upload fails, closing the pipe stops the walk,
+	// and if the walk fails, the upload fails, without committing the block list
+	reader, writer := io.Pipe()
+	statsCh := make(chan archiveStats, 1)
+	go func() {
+		stats, err := writeArchive(writer, cca.source, cca.archive)
+		statsCh <- stats
+		_ = writer.CloseWithError(err)
+	}()
+
+	stream := &pipeSizeLimitReader{reader: reader, remaining: int64(blockSize) * common.MaxNumberOfBlocksPerBlob, blockSize: blockSize}
+	_, err = azblob.UploadStreamToBlockBlob(ctx, stream, azblob.NewBlockBlobURL(*u, p), azblob.UploadStreamToBlockBlobOptions{
+		BufferSize: int(blockSize),
+		MaxBuffers: pipingUploadParallelism,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType:        contentType,
+			ContentEncoding:    cca.contentEncoding,
+			ContentLanguage:    cca.contentLanguage,
+			ContentDisposition: cca.contentDisposition,
+			CacheControl:       cca.cacheControl,
+		},
+		Metadata: metadata.ToAzBlobMetadata(),
+	})
+	_ = reader.CloseWithError(errors.New("the upload of the archive has stopped"))
+	stats := <-statsCh
+	if err != nil {
+		return stats, fmt.Errorf("fatal: cannot upload the archive due to error: %s", err.Error())
+	}
+	return stats, nil
+}
+
+func (cca *cookedCopyCmdArgs) processArchiveDownload() (archiveStats, error) {
+	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	blockSize := cca.blockSize
+	if blockSize == 0 {
+		blockSize = pipingDefaultBlockSize
+	}
+
+	p, err := createBlobPipeline(ctx, common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()})
+	if err != nil {
+		return archiveStats{}, err
+	}
+	u, err := url.Parse(cca.source)
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("fatal: cannot parse source blob URL due to error: %s", err.Error())
+	}
+	blobURL := azblob.NewBlobURL(*u, p)
+	props, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("fatal: cannot get the properties of the blob due to error: %s", err.Error())
+	}
+	ac := azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: props.ETag()}}
+
+	// the blob is read in ranges, in order, into a pipe, and the files are extracted as they come out of the other end
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := copyRangesInOrder(ctx, writer, props.ContentLength(), int64(blockSize), pipingDownloadParallelism, blobRangeReader(blobURL, ac))
+		_ = writer.CloseWithError(err)
+	}()
+
+	stats, err := extractArchive(reader, cca.destination, cca.archive, cca.forceWrite != common.EOverwriteOption.False())
+	cancel() // the end of the archive may be followed by padding, which there's no need to read
+	_ = reader.Close()
+	<-done
+	if err != nil {
+		return stats, fmt.Errorf("fatal: cannot extract the archive due to error: %s", err.Error())
+	}
+	return stats, nil
+}
+
+func archiveContentType(archive common.Archive) string {
+	if archive == common.EArchive.TarGz() {
+		return "application/gzip"
+	}
+	return "application/x-tar"
+}
+
+// writeArchive writes the files and directories under root to w, as a tar (compressed, for tar.gz) with paths relative to root.
+// Only regular files and directories are archived; anything else (e.g. a symlink) is skipped
+func writeArchive(w io.Writer, root string, archive common.Archive) (archiveStats, error) {
+	stats := archiveStats{Skipped: make([]string, 0)}
+	var gz *gzip.Writer
+	if archive == common.EArchive.TarGz() {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			stats.Skipped = append(stats.Skipped, name)
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			stats.Directories++
+			return nil
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		n, err := io.CopyN(tw, file, header.Size) // a file that shrank since the walk found it fails here; one that grew fails when the next header is written
+		stats.Bytes += uint64(n)
+		if err != nil {
+			return fmt.Errorf("cannot archive %s: %v", name, err)
+		}
+		stats.Files++
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err = tw.Close(); err != nil {
+		return stats, err
+	}
+	if gz != nil {
+		err = gz.Close()
+	}
+	return stats, err
+}
+
+// extractArchive extracts the regular files and directories in the tar (compressed, for tar.gz) that r reads into dir.
+// Files that already exist are skipped unless overwrite is set. Entries of other types are skipped, while an entry whose path
+// would take it outside dir fails the whole extraction, since only a malicious archive has one
+func extractArchive(r io.Reader, dir string, archive common.Archive, overwrite bool) (archiveStats, error) {
+	stats := archiveStats{Skipped: make([]string, 0)}
+	if archive == common.EArchive.TarGz() {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return stats, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return stats, err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+
+		name := path.Clean(strings.Replace(header.Name, "\\", "/", -1))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || filepath.VolumeName(name) != "" {
+			return stats, fmt.Errorf("the archive has an entry outside of the destination directory: %s", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, os.ModePerm); err != nil {
+				return stats, err
+			}
+			stats.Directories++
+		case tar.TypeReg, tar.TypeRegA:
+			if _, err = os.Stat(target); err == nil && !overwrite {
+				stats.Skipped = append(stats.Skipped, name)
+				continue
+			}
+			n, err := extractArchiveFile(tr, target, header)
+			stats.Bytes += uint64(n)
+			if err != nil {
+				return stats, fmt.Errorf("cannot extract %s: %v", name, err)
+			}
+			stats.Files++
+		default:
+			stats.Skipped = append(stats.Skipped, name)
+		}
+	}
+}
+
+func extractArchiveFile(r io.Reader, target string, header *tar.Header) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm()|0200)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, r)
+	closeErr := file.Close()
+	if err != nil {
+		return n, err
+	} else if closeErr != nil {
+		return n, closeErr
+	}
+	return n, os.Chtimes(target, header.ModTime, header.ModTime)
+}
@@ -54,7 +54,7 @@ type rawBenchmarkCmdArgs struct {
 const (
 	maxBytesPerFile = 4.75 * 1024 * 1024 * 1024 * 1024
 
-	sizeStringDescription = "a number immediately followed by K, M or G. E.g. 12k or 200G"
+	sizeStringDescription = "a number immediately followed by K, M, G or T (optionally followed by B). E.g. 12k, 200G or 1TB"
 )
 
 func parseSizeString(s string, name string) (int64, error) {
@@ -64,6 +64,9 @@ func parseSizeString(s string, name string) (int64, error) {
 	if strings.Contains(s, " ") {
 		return 0, errors.New(message)
 	}
+	if len(s) > 2 && strings.ToLower(s[len(s)-1:]) == "b" {
+		s = s[:len(s)-1] // e.g. 1TB
+	}
 	if len(s) < 2 {
 		return 0, errors.New(message)
 	}
@@ -81,6 +84,8 @@ func parseSizeString(s string, name string) (int64, error) {
 		bytes = int64(n) * 1024 * 1024
 	case "g":
 		bytes = int64(n) * 1024 * 1024 * 1024
+	case "t":
+		bytes = int64(n) * 1024 * 1024 * 1024 * 1024
 	default:
 		return 0, errors.New(message)
 	}
@@ -121,7 +126,7 @@ func (raw rawBenchmarkCmdArgs) cook() (cookedCopyCmdArgs, error) {
 	c.setMandatoryDefaults()
 
 	// src must be string, but needs to indicate that its for benchmark and encode what we want
-	c.src = benchmarkSourceHelper{}.ToUrl(raw.fileCount, bytesPerFile)
+	c.src = benchmarkSourceHelper{}.ToUrl(syntheticDataSpec{fileCount: raw.fileCount, bytesPerFile: bytesPerFile})
 
 	c.dst, err = raw.appendVirtualDir(raw.dst, virtualDir)
 	if err != nil {
@@ -235,35 +240,98 @@ type benchmarkSourceHelper struct{}
 // you want a URL that can't possibly be a real one, so we'll use that
 const benchmarkSourceHost = "benchmark.invalid"
 
-func (h benchmarkSourceHelper) ToUrl(fileCount uint, bytesPerFile int64) string {
-	return fmt.Sprintf("https://%s?fc=%d&bpf=%d", benchmarkSourceHost, fileCount, bytesPerFile)
+// syntheticDataSpec describes the auto-generated data of the bench and generate commands
+type syntheticDataSpec struct {
+	fileCount         uint
+	bytesPerFile      int64          // the size of every file, unless there is a sizeDistribution
+	sizeDistribution  []weightedSize // when not empty, the size of each file is chosen from these
+	filesPerDirectory uint           // when non-zero, the files are put in numbered directories of this many files each
+	compressible      bool           // the data compresses like text, rather than being random
 }
 
-func (h benchmarkSourceHelper) FromUrl(s string) (fileCount uint, bytesPerFile int64, err error) {
-	// TODO: consider replace with regex?
+// weightedSize is a file size of a size distribution, with how often it's chosen relative to the others
+type weightedSize struct {
+	bytes  int64
+	weight uint
+}
 
-	expectedPrefix := "https://" + benchmarkSourceHost + "?"
-	if !strings.HasPrefix(s, expectedPrefix) {
-		return 0, 0, errors.New("invalid benchmark source string")
+func (h benchmarkSourceHelper) ToUrl(spec syntheticDataSpec) string {
+	host := benchmarkSourceHost
+	if spec.compressible {
+		host = common.CompressibleBenchmarkSourceHost
+	}
+	u := fmt.Sprintf("https://%s?fc=%d&bpf=%d", host, spec.fileCount, spec.bytesPerFile)
+
+	if len(spec.sizeDistribution) > 0 {
+		sizes := make([]string, len(spec.sizeDistribution))
+		for i, s := range spec.sizeDistribution {
+			sizes[i] = fmt.Sprintf("%d:%d", s.bytes, s.weight)
+		}
+		u += "&dist=" + strings.Join(sizes, ",")
 	}
-	s = strings.TrimPrefix(s, expectedPrefix)
+	if spec.filesPerDirectory > 0 {
+		u += fmt.Sprintf("&fpd=%d", spec.filesPerDirectory)
+	}
+	return u
+}
+
+func (h benchmarkSourceHelper) FromUrl(s string) (spec syntheticDataSpec, err error) {
+	invalid := errors.New("invalid benchmark source string")
+
+	switch {
+	case strings.HasPrefix(s, "https://"+benchmarkSourceHost+"?"):
+		s = strings.TrimPrefix(s, "https://"+benchmarkSourceHost+"?")
+	case strings.HasPrefix(s, "https://"+common.CompressibleBenchmarkSourceHost+"?"):
+		s = strings.TrimPrefix(s, "https://"+common.CompressibleBenchmarkSourceHost+"?")
+		spec.compressible = true
+	default:
+		return spec, invalid
+	}
+
 	pieces := strings.Split(s, "&")
-	if len(pieces) != 2 ||
+	if len(pieces) < 2 ||
 		!strings.HasPrefix(pieces[0], "fc=") ||
 		!strings.HasPrefix(pieces[1], "bpf=") {
-		return 0, 0, errors.New("invalid benchmark source string")
+		return spec, invalid
 	}
-	pieces[0] = strings.Split(pieces[0], "=")[1]
-	pieces[1] = strings.Split(pieces[1], "=")[1]
-	fc, err := strconv.ParseUint(pieces[0], 10, 64)
+	fc, err := strconv.ParseUint(strings.TrimPrefix(pieces[0], "fc="), 10, 64)
 	if err != nil {
-		return 0, 0, err
+		return spec, err
 	}
-	bpf, err := strconv.ParseInt(pieces[1], 10, 64)
-	if err != nil {
-		return 0, 0, err
+	spec.fileCount = uint(fc)
+	if spec.bytesPerFile, err = strconv.ParseInt(strings.TrimPrefix(pieces[1], "bpf="), 10, 64); err != nil {
+		return spec, err
+	}
+
+	for _, piece := range pieces[2:] {
+		switch {
+		case strings.HasPrefix(piece, "dist="):
+			for _, size := range strings.Split(strings.TrimPrefix(piece, "dist="), ",") {
+				parts := strings.Split(size, ":")
+				if len(parts) != 2 {
+					return spec, invalid
+				}
+				bytes, err := strconv.ParseInt(parts[0], 10, 64)
+				if err != nil {
+					return spec, err
+				}
+				weight, err := strconv.ParseUint(parts[1], 10, 64)
+				if err != nil {
+					return spec, err
+				}
+				spec.sizeDistribution = append(spec.sizeDistribution, weightedSize{bytes: bytes, weight: uint(weight)})
+			}
+		case strings.HasPrefix(piece, "fpd="):
+			fpd, err := strconv.ParseUint(strings.TrimPrefix(piece, "fpd="), 10, 64)
+			if err != nil {
+				return spec, err
+			}
+			spec.filesPerDirectory = uint(fpd)
+		default:
+			return spec, invalid
+		}
 	}
-	return uint(fc), bpf, nil
+	return spec, nil
 }
 
 var benchCmd *cobra.Command
@@ -314,7 +382,7 @@ func init() {
 	benchCmd.PersistentFlags().UintVar(&raw.fileCount, common.FileCountParam, common.FileCountDefault, "number of auto-generated data files to use")
 	benchCmd.PersistentFlags().BoolVar(&raw.deleteTestData, "delete-test-data", true, "if true, the benchmark data will be deleted at the end of the benchmark run.  Set it to false if you want to keep the data at the destination - e.g. to use it for manual tests outside benchmark mode")
 
-	benchCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "use this block size (specified in MiB). Default is automatically calculated based on file size. Decimal fractions are allowed - e.g. 0.25. Identical to the same-named parameter in the copy command")
+	benchCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "use this block size (specified in MiB). Default is automatically calculated for each file, based on its size and on the measured latency and throughput. Decimal fractions are allowed - e.g. 0.25. Identical to the same-named parameter in the copy command")
 	benchCmd.PersistentFlags().StringVar(&raw.blobType, "blob-type", "Detect", "defines the type of blob at the destination. Used to allow benchmarking different blob types. Identical to the same-named parameter in the copy command")
 	benchCmd.PersistentFlags().BoolVar(&raw.putMd5, "put-md5", false, "create an MD5 hash of each file, and save the hash as the Content-MD5 property of the destination blob/file. (By default the hash is NOT created.) Identical to the same-named parameter in the copy command")
 	// TODO use constant for default value or, better, move loglevel param to root cmd?
@@ -30,10 +30,13 @@ import (
 	"math"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
 
@@ -45,6 +48,7 @@ import (
 )
 
 const pipingUploadParallelism = 5
+const pipingDownloadParallelism = 5
 const pipingDefaultBlockSize = 8 * 1024 * 1024
 
 // For networking throughput in Mbps, (and only for networking), we divide by 1000*1000 (not 1024 * 1024) because
@@ -58,6 +62,9 @@ const base10Mega = 1000 * 1000
 
 const pipeLocation = "~pipe~"
 
+// where, under the destination, files that violate the content policy go when they are quarantined
+const defaultQuarantineFolder = "quarantine"
+
 // represents the raw copy command input from the user
 type rawCopyCmdArgs struct {
 	// from arguments
@@ -74,12 +81,38 @@ type rawCopyCmdArgs struct {
 	excludePath           string
 	includeFileAttributes string
 	excludeFileAttributes string
+	excludeHidden         bool
+	excludePatternsFile   string
 	legacyInclude         string // used only for warnings
 	legacyExclude         string // used only for warnings
 
+	// labels and description of the job, for finding it later with jobs list
+	labels      []string
+	description string
+
+	// the job that must complete successfully before this one starts
+	afterJob string
+
+	// resubmitting the same command with the same key resumes the job it started
+	idempotencyKey string
+
+	// clouds of the source and destination, when they are not in the Azure public cloud
+	sourceCloud      string
+	destinationCloud string
+
 	// filters from flags
 	listOfFilesToCopy string
+	inventoryReport   string
+	urlList           string
+	fromPipe          bool
+	toPipe            bool
+	archive           string
+	dryRun            bool
 	recursive         bool
+	maxDepth          int
+	sample            string
+	sampleSeed        string
+	sampleMaxBytes    string
 	followSymlinks    bool
 	autoDecompress    bool
 	// forceWrite flag is used to define the User behavior
@@ -97,9 +130,46 @@ type rawCopyCmdArgs struct {
 	noGuessMimeType          bool
 	preserveLastModifiedTime bool
 	putMd5                   bool
+	convertToVHD             bool
 	md5ValidationOption      string
+	md5ValidationOptionIsSet bool // whether check-md5 was given, rather than defaulted
 	CheckLength              bool
 	deleteSnapshotsOption    string
+	allowSecondaryRead       bool
+	sourceChangePolicy       string
+	pinSourceVersions        bool
+	preservePermissions      bool
+	nfs                      bool
+	maxWriteLatencyMs        uint32
+	continueOnListFailure    bool
+	fileTimeBudgetPerGB      uint32
+	reportSlowestFiles       uint32
+	deleteSourceAfter        string
+	assertSourceUnchanged    string
+	maxAccountFraction       float64
+	dailyCapGB               float64
+	autoPartitionSize        string
+	enumerateFirst           bool
+	expectFiles              string
+	expectBytes              string
+	expectedTotalsFile       string
+	propertiesOnly           bool
+	journal                  bool
+	folderCreation           string
+	ifNoneMatch              string
+	maxFileSize              string
+	allowedExtensions        string
+	blockedExtensions        string
+	blockedSignatures        string
+	policyViolationAction    string
+	quarantineFolder         string
+	scanCommand              string
+	infectedAction           string
+	manifest                 string
+	manifestSigningKey       string
+	propertyMapping          string
+	partitionBy              string
+	successMarker            bool
 	// defines the type of the blob at the destination in case of upload / account to account copy
 	blobType      string
 	blockBlobTier string
@@ -108,6 +178,9 @@ type rawCopyCmdArgs struct {
 	logVerbosity  string
 	// list of blobTypes to exclude while enumerating the transfer
 	excludeBlobType string
+	// list of blobTypes and content types to include while enumerating the transfer
+	includeBlobType    string
+	includeContentType string
 	// whether user wants to preserve full properties during service to service copy, the default value is true.
 	// For S3 and Azure File non-single file source, as list operation doesn't return full properties of objects/files,
 	// to preserve full properties AzCopy needs to send one additional request per object/file.
@@ -229,7 +302,13 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		jobID: jobId,
 	}
 
-	fromTo, err := validateFromTo(raw.src, raw.dst, raw.fromTo) // TODO: src/dst
+	var fromTo common.FromTo
+	var err error
+	if raw.urlList != "" {
+		fromTo, err = validateURLListFromTo(raw.src, raw.dst, raw.fromTo)
+	} else {
+		fromTo, err = validateFromTo(raw.src, raw.dst, raw.fromTo) // TODO: src/dst
+	}
 	if err != nil {
 		return cooked, err
 	}
@@ -242,6 +321,29 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 
 	cooked.fromTo = fromTo
 
+	if raw.fromPipe {
+		if fromTo != common.EFromTo.PipeBlob() {
+			return cooked, errors.New("from-pipe can only upload to a block blob, so the destination must be the URL of a blob")
+		}
+		if raw.urlList != "" || raw.listOfFilesToCopy != "" || raw.inventoryReport != "" {
+			return cooked, errors.New("cannot combine from-pipe with url-list, list-of-files or from-inventory")
+		}
+	}
+	if raw.toPipe && fromTo != common.EFromTo.BlobPipe() {
+		return cooked, errors.New("to-pipe can only download a blob, so the source must be the URL of a blob")
+	}
+	if cooked.archive, err = raw.cookArchive(fromTo); err != nil {
+		return cooked, err
+	}
+	if cooked.dryRun = raw.dryRun; raw.dryRun {
+		if fromTo == common.EFromTo.PipeBlob() || fromTo == common.EFromTo.BlobPipe() || cooked.archive != common.EArchive.None() {
+			return cooked, errors.New("dry-run needs a source that can be listed, so it cannot be combined with pipes or archive")
+		}
+		if fromTo == common.EFromTo.BlobFSTrash() {
+			return cooked, errors.New("dry-run is not supported when removing from ADLS Gen2, since the service deletes directories without listing them")
+		}
+	}
+
 	// Check if source has a trailing wildcard on a URL
 	if fromTo.From().IsRemote() {
 		cooked.source, cooked.stripTopDir, err = raw.stripTrailingWildcardOnRemoteSource(fromTo.From())
@@ -258,6 +360,26 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	cooked.recursive = raw.recursive
 	cooked.followSymlinks = raw.followSymlinks
 
+	if raw.maxDepth < 0 {
+		return cooked, errors.New("max-depth cannot be negative")
+	}
+	cooked.maxDepth = raw.maxDepth
+
+	if raw.sample != "" {
+		if cooked.sampleFraction, err = parseSamplePercentage(raw.sample); err != nil {
+			return cooked, err
+		}
+	}
+	if raw.sampleMaxBytes != "" {
+		if cooked.sampleMaxBytes, err = parseSizeString(raw.sampleMaxBytes, "sample-max-bytes"); err != nil {
+			return cooked, err
+		}
+	}
+	if raw.sampleSeed != "" && raw.sample == "" {
+		return cooked, errors.New("sample-seed can only be used with sample")
+	}
+	cooked.sampleSeed = raw.sampleSeed
+
 	// copy&transform flags to type-safety
 	err = cooked.forceWrite.Parse(raw.forceWrite)
 	if err != nil {
@@ -280,6 +402,12 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	if err != nil {
 		return cooked, err
 	}
+	// a block must fit in the RAM allowed for the chunks in flight, or the transfer would wait forever for room for it
+	if maxBlockSize := ste.MaxBlockSize(); int64(cooked.blockSize) > maxBlockSize {
+		return cooked, fmt.Errorf("block-size-mb cannot be more than %.2f, which is all that fits in the memory allowed for data in flight. "+
+			"Use a smaller block size, or raise %s (or %s)", float64(maxBlockSize)/(1024*1024),
+			common.EEnvironmentVariable.MaxMemoryGB().Name, common.EEnvironmentVariable.BufferGB().Name)
+	}
 
 	// parse the given blob type.
 	err = cooked.blobType.Parse(raw.blobType)
@@ -404,6 +532,24 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		cooked.listOfFilesChannel = listChan
 	}
 
+	if raw.inventoryReport != "" {
+		if fromTo.From() != common.ELocation.Blob() {
+			return cooked, errors.New("from-inventory is only supported when the source is Azure Blob Storage")
+		}
+		if cooked.listOfFilesChannel != nil {
+			return cooked, errors.New("cannot combine from-inventory with list-of-files or include-path")
+		}
+		cooked.inventoryReport = raw.inventoryReport
+	}
+
+	if raw.urlList != "" {
+		if cooked.listOfFilesChannel != nil || raw.inventoryReport != "" {
+			return cooked, errors.New("cannot combine url-list with list-of-files, include-path or from-inventory")
+		}
+		cooked.urlList = raw.urlList
+		cooked.stripTopDir = true // the files are named by the list, relative to the destination
+	}
+
 	cooked.metadata = raw.metadata
 	cooked.contentType = raw.contentType
 	cooked.contentEncoding = raw.contentEncoding
@@ -424,10 +570,20 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	}
 
 	cooked.putMd5 = raw.putMd5
+	cooked.convertToVHD = raw.convertToVHD
+
+	// the data from a pipe is staged in blocks of exactly this size, and its total size isn't known up front,
+	// so unlike for files the block size can't be raised automatically when there would be too many blocks
+	if cooked.fromTo == common.EFromTo.PipeBlob() && cooked.blockSize > common.MaxBlockBlobBlockSize {
+		return cooked, fmt.Errorf("block size cannot be greater than %d MiB when uploading from a pipe", common.MaxBlockBlobBlockSize/1024/1024)
+	}
 	err = cooked.md5ValidationOption.Parse(raw.md5ValidationOption)
 	if err != nil {
 		return cooked, err
 	}
+	if err = common.ValidateHashOptionsForFIPS(cooked.putMd5, cooked.md5ValidationOption); err != nil {
+		return cooked, err
+	}
 	globalBlobFSMd5ValidationOption = cooked.md5ValidationOption // workaround, to avoid having to pass this all the way through the chain of methods in enumeration, just for one weird and (presumably) temporary workaround
 
 	cooked.CheckLength = raw.CheckLength
@@ -436,6 +592,161 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		cooked.CheckLength = false
 	}
 
+	if raw.allowSecondaryRead {
+		if cooked.fromTo != common.EFromTo.BlobLocal() {
+			return cooked, errors.New("allow-secondary-read is only supported when downloading from Blob storage")
+		}
+		sourceURL, err := url.Parse(cooked.source)
+		if err != nil {
+			return cooked, err
+		}
+		if _, err = ste.GetSecondaryReadHost(sourceURL.Host); err != nil {
+			return cooked, err
+		}
+	}
+	cooked.allowSecondaryRead = raw.allowSecondaryRead
+
+	err = cooked.sourceChangePolicy.Parse(raw.sourceChangePolicy)
+	if err != nil {
+		return cooked, err
+	}
+	// restarting with the latest version is only safe where we can re-stat the source ourselves, i.e. local files.
+	// For remote sources, properties captured at enumeration (e.g. MD5 and metadata) would no longer match the content
+	if cooked.sourceChangePolicy == common.ESourceChangePolicy.RescheduleLatest() && !cooked.fromTo.IsUpload() {
+		return cooked, errors.New("source-change-policy reschedule-latest is only supported when uploading from the local file system")
+	}
+
+	if raw.pinSourceVersions && cooked.fromTo != common.EFromTo.BlobLocal() && cooked.fromTo != common.EFromTo.BlobBlob() {
+		return cooked, errors.New("pin-source-versions is only supported when downloading or copying from Blob storage to Blob storage")
+	}
+	cooked.pinSourceVersions = raw.pinSourceVersions
+
+	if raw.preservePermissions && cooked.fromTo != common.EFromTo.BlobBlob() {
+		return cooked, errors.New("preserve-permissions is only supported when copying from Blob storage to Blob storage, between accounts with hierarchical namespaces")
+	}
+	cooked.preservePermissions = raw.preservePermissions
+
+	if raw.nfs {
+		switch cooked.fromTo {
+		case common.EFromTo.LocalFile(), common.EFromTo.FileLocal(), common.EFromTo.FileFile():
+		default:
+			return cooked, errors.New("nfs is only supported when uploading to, downloading from, or copying between Azure Files shares")
+		}
+		if (cooked.fromTo.From().IsLocal() || cooked.fromTo.To().IsLocal()) && runtime.GOOS == "windows" {
+			return cooked, errors.New("nfs is not supported on Windows, where local files have no owner, group and mode to preserve")
+		}
+	}
+	cooked.preservePosixProperties = raw.nfs
+
+	if raw.maxWriteLatencyMs > 0 && !cooked.fromTo.To().IsRemote() {
+		return cooked, errors.New("max-write-latency-ms is only supported when the destination is Azure Storage")
+	}
+	cooked.maxWriteLatencyMs = raw.maxWriteLatencyMs
+	cooked.continueOnListFailure = raw.continueOnListFailure
+
+	if raw.reportSlowestFiles > ste.MaxSlowestTransfersTracked {
+		return cooked, fmt.Errorf("report-slowest-files cannot be more than %d", ste.MaxSlowestTransfersTracked)
+	}
+	cooked.fileTimeBudgetPerGB = raw.fileTimeBudgetPerGB
+	cooked.reportSlowestFiles = raw.reportSlowestFiles
+
+	err = cooked.deleteSourceAfter.Parse(raw.deleteSourceAfter)
+	if err != nil {
+		return cooked, err
+	}
+	if cooked.deleteSourceAfter == common.EDeleteSourceAfter.Verified() {
+		if err = validateDeleteSourceAfterVerified(cooked.fromTo, raw.CheckLength, cooked.md5ValidationOption, raw.pinSourceVersions); err != nil {
+			return cooked, err
+		}
+	}
+
+	err = cooked.assertSourceUnchanged.Parse(raw.assertSourceUnchanged)
+	if err != nil {
+		return cooked, err
+	}
+	// ETags are recorded by the blob traverser only
+	if cooked.assertSourceUnchanged != common.EAssertSourceUnchanged.None() && cooked.fromTo.From() != common.ELocation.Blob() {
+		return cooked, errors.New("assert-source-unchanged is only supported when the source is Blob storage")
+	}
+
+	if raw.maxAccountFraction < 0 || raw.maxAccountFraction > 1 {
+		return cooked, errors.New("max-account-throughput-fraction must be between 0 and 1")
+	}
+	cooked.maxAccountFraction = float32(raw.maxAccountFraction)
+
+	if raw.dailyCapGB < 0 {
+		return cooked, errors.New("daily-cap-gb cannot be negative")
+	}
+	cooked.dailyCapBytes = uint64(raw.dailyCapGB * 1024 * 1024 * 1024)
+
+	cooked.journal = raw.journal
+
+	if cooked.folderCreation, err = cookFolderCreation(raw.folderCreation, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+
+	if cooked.manifest, cooked.manifestSigningKey, err = cookManifestOptions(raw.manifest, raw.manifestSigningKey); err != nil {
+		return cooked, err
+	}
+
+	if cooked.propertyMapping, err = cookPropertyMapping(raw.propertyMapping, cooked.fromTo, raw.s2sPreserveProperties); err != nil {
+		return cooked, err
+	}
+
+	cooked.propertiesOnly = raw.propertiesOnly
+	if err = validatePropertiesOnly(cooked.propertiesOnly, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+	// no data is copied, so there would be nothing to have moved
+	if cooked.propertiesOnly && cooked.deleteSourceAfter != common.EDeleteSourceAfter.Never() {
+		return cooked, errors.New("properties-only cannot be used with delete-source-after")
+	}
+
+	if cooked.writeOnce, err = cookIfNoneMatch(raw.ifNoneMatch, cooked.fromTo, cooked.forceWrite, cooked.propertiesOnly); err != nil {
+		return cooked, err
+	}
+
+	if cooked.contentPolicy, err = raw.cookContentPolicy(cooked.fromTo); err != nil {
+		return cooked, err
+	}
+
+	if raw.autoPartitionSize != "" {
+		if cooked.autoPartitionSize, err = parseSizeString(raw.autoPartitionSize, "auto-partition-size"); err != nil {
+			return cooked, err
+		}
+		cooked.subJobDone = make(chan common.JobStatus, 1)
+	}
+	cooked.enumerateFirst = raw.enumerateFirst
+	if cooked.enumerateFirst && cooked.autoPartitionSize > 0 {
+		return cooked, errors.New("enumerate-first cannot be combined with auto-partition-size, since each sub-job is transferred before the rest of the source is scanned")
+	}
+
+	if cooked.expectedTotals, err = newExpectedTotals(raw.expectFiles, raw.expectBytes); err != nil {
+		return cooked, err
+	}
+	if raw.expectedTotalsFile != "" {
+		if cooked.dryRun {
+			// the dry run is the estimate, so it saves the totals rather than expecting them
+			cooked.expectedTotalsFile = raw.expectedTotalsFile
+		} else if cooked.expectedTotals.isSet() {
+			return cooked, errors.New("expected-totals-file cannot be combined with expect-files or expect-bytes")
+		} else if cooked.expectedTotals, err = loadExpectedTotals(raw.expectedTotalsFile); err != nil {
+			return cooked, err
+		}
+	}
+	if err = cooked.expectedTotals.validate(cooked.autoPartitionSize); err != nil {
+		return cooked, err
+	}
+
+	// the placeholders are filled in once, so that the files of a job all land in the same partition, even if it's resumed
+	if cooked.partitionPrefix, err = cookPartitionTemplate(raw.partitionBy, time.Now()); err != nil {
+		return cooked, err
+	}
+	cooked.successMarker = raw.successMarker
+	if err = validateAnalyticsLayout(cooked.partitionPrefix, cooked.successMarker, cooked.fromTo, cooked.autoPartitionSize); err != nil {
+		return cooked, err
+	}
+
 	// if redirection is triggered, avoid printing any output
 	if cooked.isRedirection() {
 		glcm.SetOutputFormat(common.EOutputFormat.None())
@@ -468,7 +779,7 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		if cooked.s2sSourceChangeValidation {
 			return cooked, fmt.Errorf("s2s-detect-source-changed is not supported while uploading")
 		}
-	case common.EFromTo.LocalBlob():
+	case common.EFromTo.LocalBlob(), common.EFromTo.HttpBlob(), common.EFromTo.SftpBlob():
 		if cooked.preserveLastModifiedTime {
 			return cooked, fmt.Errorf("preserve-last-modified-time is not supported while uploading")
 		}
@@ -508,6 +819,7 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 			return cooked, fmt.Errorf("blob-type is not supported on Azure File")
 		}
 	case common.EFromTo.BlobLocal(),
+		common.EFromTo.BlobSftp(),
 		common.EFromTo.FileLocal(),
 		common.EFromTo.BlobFSLocal():
 		if cooked.followSymlinks {
@@ -535,6 +847,35 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		if cooked.s2sSourceChangeValidation {
 			return cooked, fmt.Errorf("s2s-detect-source-changed is not supported while downloading")
 		}
+	case common.EFromTo.LocalLocal():
+		if cooked.blockBlobTier != common.EBlockBlobTier.None() ||
+			cooked.pageBlobTier != common.EPageBlobTier.None() {
+			return cooked, fmt.Errorf("blob-tier is not supported while copying between local paths")
+		}
+		if cooked.blobType != common.EBlobType.Detect() {
+			return cooked, fmt.Errorf("blob-type is not supported while copying between local paths")
+		}
+		if cooked.noGuessMimeType {
+			return cooked, fmt.Errorf("no-guess-mime-type is not supported while copying between local paths")
+		}
+		if len(cooked.contentType) > 0 || len(cooked.contentEncoding) > 0 || len(cooked.contentLanguage) > 0 || len(cooked.contentDisposition) > 0 || len(cooked.cacheControl) > 0 || len(cooked.metadata) > 0 {
+			return cooked, fmt.Errorf("content-type, content-encoding, content-language, content-disposition, cache-control, or metadata is not supported while copying between local paths")
+		}
+		if cooked.s2sPreserveProperties {
+			return cooked, fmt.Errorf("s2s-preserve-properties is not supported while copying between local paths")
+		}
+		if cooked.s2sPreserveAccessTier {
+			return cooked, fmt.Errorf("s2s-preserve-access-tier is not supported while copying between local paths")
+		}
+		if cooked.s2sInvalidMetadataHandleOption != common.DefaultInvalidMetadataHandleOption {
+			return cooked, fmt.Errorf("s2s-handle-invalid-metadata is not supported while copying between local paths")
+		}
+		if cooked.s2sSourceChangeValidation {
+			return cooked, fmt.Errorf("s2s-detect-source-changed is not supported while copying between local paths")
+		}
+		if err = validateLocalPathsDontOverlap(cooked.source, cooked.destination); err != nil {
+			return cooked, err
+		}
 	case common.EFromTo.BlobBlob(),
 		common.EFromTo.FileBlob(),
 		common.EFromTo.FileFile(),
@@ -569,6 +910,16 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	if err = validateMd5Option(cooked.md5ValidationOption, cooked.fromTo); err != nil {
 		return cooked, err
 	}
+	if cooked.fromTo == common.EFromTo.LocalLocal() {
+		// local files have no stored hash to check against
+		if raw.md5ValidationOptionIsSet {
+			return cooked, fmt.Errorf("check-md5 is not supported while copying between local paths, since local files have no stored hash to check against")
+		}
+		cooked.md5ValidationOption = common.EHashValidationOption.NoCheck()
+	}
+	if err = validateConvertToVHD(cooked.convertToVHD, cooked.fromTo, cooked.blobType); err != nil {
+		return cooked, err
+	}
 
 	// If the user has provided some input with excludeBlobType flag, parse the input.
 	if len(raw.excludeBlobType) > 0 {
@@ -584,6 +935,22 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		}
 	}
 
+	// include-blob-type and include-content-type rely on properties returned by the blob listing
+	if (len(raw.includeBlobType) > 0 || len(raw.includeContentType) > 0) && cooked.fromTo.From() != common.ELocation.Blob() {
+		return cooked, fmt.Errorf("include-blob-type and include-content-type are only supported when the source is Azure Blob Storage")
+	}
+	if len(raw.includeBlobType) > 0 {
+		for _, blobType := range raw.parsePatterns(raw.includeBlobType) {
+			var eBlobType common.BlobType
+			err := eBlobType.Parse(blobType)
+			if err != nil {
+				return cooked, fmt.Errorf("error parsing the include-blob-type %s provided with include-blob-type flag ", blobType)
+			}
+			cooked.includeBlobType = append(cooked.includeBlobType, eBlobType.ToAzBlobType())
+		}
+	}
+	cooked.includeContentTypes = raw.parsePatterns(raw.includeContentType)
+
 	cooked.s2sPreserveProperties = raw.s2sPreserveProperties
 	cooked.s2sGetPropertiesInBackend = raw.s2sGetPropertiesInBackend
 	cooked.s2sPreserveAccessTier = raw.s2sPreserveAccessTier
@@ -605,6 +972,50 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	cooked.includeFileAttributes = raw.parsePatterns(raw.includeFileAttributes)
 	cooked.excludeFileAttributes = raw.parsePatterns(raw.excludeFileAttributes)
 
+	cooked.labels, err = cookJobLabels(raw.labels, raw.description)
+	if err != nil {
+		return cooked, err
+	}
+	cooked.description = raw.description
+
+	cooked.afterJobID, err = cookAfterJobID(raw.afterJob)
+	if err != nil {
+		return cooked, err
+	}
+
+	if err = cooked.cookIdempotencyKey(raw.idempotencyKey, raw.jobDefiningSettings()); err != nil {
+		return cooked, err
+	}
+
+	if raw.sourceCloud != "" {
+		if cooked.sourceCloud, err = common.ParseAzureCloud(raw.sourceCloud); err != nil {
+			return cooked, err
+		}
+		if err = validateResourceCloud(raw.src, fromTo.From(), cooked.sourceCloud, "source-cloud"); err != nil {
+			return cooked, err
+		}
+	}
+	if raw.destinationCloud != "" {
+		if cooked.destinationCloud, err = common.ParseAzureCloud(raw.destinationCloud); err != nil {
+			return cooked, err
+		}
+		if err = validateResourceCloud(raw.dst, fromTo.To(), cooked.destinationCloud, "destination-cloud"); err != nil {
+			return cooked, err
+		}
+	}
+
+	cooked.excludeHidden = raw.excludeHidden
+	if raw.excludePatternsFile != "" {
+		localSourceDir := ""
+		if fromTo.From() == common.ELocation.Local() {
+			localSourceDir = raw.src
+		}
+		cooked.ignoreMatcher, err = loadIgnoreMatcher(raw.excludePatternsFile, localSourceDir)
+		if err != nil {
+			return cooked, err
+		}
+	}
+
 	return cooked, nil
 }
 
@@ -627,9 +1038,13 @@ func (raw *rawCopyCmdArgs) setMandatoryDefaults() {
 	raw.blobType = common.EBlobType.Detect().String()
 	raw.blockBlobTier = common.EBlockBlobTier.None().String()
 	raw.pageBlobTier = common.EPageBlobTier.None().String()
-	raw.md5ValidationOption = common.DefaultHashValidationOption.String()
+	raw.md5ValidationOption = common.DefaultHashValidationOptionForMode().String()
 	raw.s2sInvalidMetadataHandleOption = common.DefaultInvalidMetadataHandleOption.String()
 	raw.forceWrite = common.EOverwriteOption.True().String()
+	raw.sourceChangePolicy = common.ESourceChangePolicy.Fail().String()
+	raw.deleteSourceAfter = common.EDeleteSourceAfter.Never().String()
+	raw.assertSourceUnchanged = common.EAssertSourceUnchanged.None().String()
+	raw.folderCreation = common.EFolderCreationPolicy.Lazy().String()
 }
 
 func validatePutMd5(putMd5 bool, fromTo common.FromTo) error {
@@ -639,14 +1054,255 @@ func validatePutMd5(putMd5 bool, fromTo common.FromTo) error {
 	return nil
 }
 
+// only page blobs can hold a disk, so that is what we require, rather than inferring it from the (.vhdx or .qcow2) file name
+func validateConvertToVHD(convertToVHD bool, fromTo common.FromTo, blobType common.BlobType) error {
+	if convertToVHD && (fromTo != common.EFromTo.LocalBlob() || blobType != common.EBlobType.PageBlob()) {
+		return fmt.Errorf("convert-to-vhd is only available when uploading to page blobs (or managed disks), with blob-type set to PageBlob")
+	}
+	return nil
+}
+
+// the manifest is written by the transfer engine when the job completes, which may be in a later run from another directory,
+// so local paths are made absolute here
+func cookManifestOptions(manifest, signingKey string) (cookedManifest, cookedSigningKey string, err error) {
+	if manifest == "" {
+		if signingKey != "" {
+			return "", "", errors.New("manifest-signing-key needs manifest to be set too")
+		}
+		return "", "", nil
+	}
+
+	if cookedManifest, err = filepath.Abs(manifest); err != nil {
+		return "", "", err
+	}
+	cookedSigningKey = signingKey
+	if signingKey != "" && !strings.HasPrefix(strings.ToLower(signingKey), "https://") {
+		if cookedSigningKey, err = filepath.Abs(signingKey); err != nil {
+			return "", "", err
+		}
+		if _, err = os.Stat(cookedSigningKey); err != nil {
+			return "", "", fmt.Errorf("cannot read the manifest signing key: %s", err)
+		}
+	}
+	if len(cookedManifest) > ste.ManifestPathMaxBytes || len(cookedSigningKey) > ste.ManifestPathMaxBytes {
+		return "", "", fmt.Errorf("the manifest path and its signing key must be at most %d bytes long", ste.ManifestPathMaxBytes)
+	}
+	return cookedManifest, cookedSigningKey, nil
+}
+
+// cookPropertyMapping validates the property mapping rules, and returns them in the form stored in the job plan
+func cookPropertyMapping(raw string, fromTo common.FromTo, preserveProperties bool) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if fromTo != common.EFromTo.FileBlob() && fromTo != common.EFromTo.BlobFile() {
+		return "", errors.New("property-mapping is only supported when copying from Azure Files to Blob storage, or from Blob storage to Azure Files")
+	}
+	if !preserveProperties {
+		return "", errors.New("property-mapping needs the properties of the source, so it can't be used with s2s-preserve-properties=false")
+	}
+
+	mapping, err := common.ParsePropertyMapping(raw)
+	if err != nil {
+		return "", err
+	}
+	if mapping.UsesSMBProperties() && fromTo.From() != common.ELocation.File() {
+		return "", errors.New("the smb: properties in property-mapping are only available when the source is Azure Files")
+	}
+	cooked := mapping.String()
+	if len(cooked) > ste.PropertyMappingMaxBytes {
+		return "", fmt.Errorf("property-mapping must be at most %d bytes long", ste.PropertyMappingMaxBytes)
+	}
+	return cooked, nil
+}
+
+// only blobs have their properties updated in place, and since nothing else of the transfer happens,
+// the properties must come from a source that has them (or, for local files, from the command line)
+func validatePropertiesOnly(propertiesOnly bool, fromTo common.FromTo) error {
+	if propertiesOnly && fromTo.To() != common.ELocation.Blob() {
+		return fmt.Errorf("properties-only is set but the destination is not Blob storage")
+	}
+	return nil
+}
+
+// cookIfNoneMatch parses the if-none-match flag, which makes the job write-once when it is *.
+// Only Blob storage can make the creation of a destination conditional on it not existing yet
+func cookIfNoneMatch(raw string, fromTo common.FromTo, overwrite common.OverwriteOption, propertiesOnly bool) (bool, error) {
+	switch {
+	case raw == "":
+		return false, nil
+	case raw != "*":
+		return false, fmt.Errorf("invalid if-none-match %q. The only supported value is *", raw)
+	case fromTo.To() != common.ELocation.Blob():
+		return false, errors.New("if-none-match is only supported when the destination is Blob storage")
+	case overwrite == common.EOverwriteOption.Prompt():
+		return false, errors.New("if-none-match=* never overwrites, so it cannot be used with overwrite=prompt")
+	case propertiesOnly:
+		return false, errors.New("if-none-match=* never modifies existing blobs, so it cannot be used with properties-only")
+	}
+	return true, nil
+}
+
+// cookContentPolicy validates the rules that each file must follow to be transferred as usual, and what happens to files that break them
+func (raw rawCopyCmdArgs) cookContentPolicy(fromTo common.FromTo) (common.ContentPolicy, error) {
+	policy := common.ContentPolicy{
+		AllowedExtensions: common.NormalizeExtensions(raw.allowedExtensions),
+		BlockedExtensions: common.NormalizeExtensions(raw.blockedExtensions),
+	}
+
+	var err error
+	if raw.maxFileSize != "" {
+		if policy.MaxFileSize, err = parseSizeString(raw.maxFileSize, "max-file-size"); err != nil {
+			return policy, err
+		}
+	}
+	if policy.BlockedSignatures, err = common.ParseContentSignatures(raw.blockedSignatures); err != nil {
+		return policy, err
+	}
+	if len(policy.BlockedSignatures) > 0 && fromTo.From() != common.ELocation.Local() {
+		return policy, errors.New("blocked-signatures is only supported when uploading local files")
+	}
+
+	if raw.scanCommand != "" {
+		if fromTo.From() != common.ELocation.Local() {
+			return policy, errors.New("scan-command is only supported when uploading local files")
+		}
+		if policy.ScanCommand, err = splitCommandLine(raw.scanCommand); err != nil {
+			return policy, fmt.Errorf("invalid scan-command: %v", err)
+		}
+	}
+
+	// reject is the default, including when other commands cook copy arguments without setting the flags
+	if raw.policyViolationAction != "" {
+		if err = policy.Action.Parse(raw.policyViolationAction); err != nil {
+			return policy, fmt.Errorf("invalid policy-violation-action %q. Use reject or quarantine", raw.policyViolationAction)
+		}
+	}
+	if raw.infectedAction != "" {
+		if err = policy.InfectedAction.Parse(raw.infectedAction); err != nil {
+			return policy, fmt.Errorf("invalid infected-action %q. Use reject or quarantine", raw.infectedAction)
+		}
+	}
+	if len(policy.ScanCommand) == 0 && policy.InfectedAction != common.EContentPolicyAction.Reject() {
+		return policy, errors.New("infected-action needs scan-command")
+	}
+	if policy.IsEmpty() {
+		if policy.Action != common.EContentPolicyAction.Reject() || raw.quarantineFolder != "" {
+			return policy, errors.New("policy-violation-action and quarantine-folder need a content policy, " +
+				"i.e. at least one of max-file-size, allowed-extensions, blocked-extensions, blocked-signatures and scan-command")
+		}
+		return policy, nil
+	}
+
+	if policy.Action == common.EContentPolicyAction.Quarantine() || policy.InfectedAction == common.EContentPolicyAction.Quarantine() {
+		policy.QuarantineFolder = strings.Trim(raw.quarantineFolder, `/\`)
+		if policy.QuarantineFolder == "" {
+			policy.QuarantineFolder = defaultQuarantineFolder
+		}
+	} else if raw.quarantineFolder != "" {
+		return policy, errors.New("quarantine-folder can only be used with policy-violation-action=quarantine or infected-action=quarantine")
+	}
+
+	if cooked, _ := json.Marshal(policy); len(cooked) > ste.ContentPolicyMaxBytes {
+		return policy, fmt.Errorf("the content policy must be at most %d bytes long", ste.ContentPolicyMaxBytes)
+	}
+	return policy, nil
+}
+
+// splitCommandLine splits a command line into the command and its arguments, at spaces, as a shell would.
+// Single quotes keep what's in them as it is, and so do double quotes, except that \" and \\ in them stand for " and \.
+// Backslashes are kept elsewhere, so that Windows paths can be given without quotes when they have no spaces
+func splitCommandLine(commandLine string) ([]string, error) {
+	args := make([]string, 0)
+	var arg strings.Builder
+	inArg := false // so that "" is an empty argument, rather than none
+	var quote rune
+	runes := []rune(commandLine)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				arg.WriteRune(runes[i])
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("the %c quote is not closed", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// cookFolderCreation parses the folder-creation flag. Creating folders eagerly only makes sense for destinations with real directories
+func cookFolderCreation(raw string, fromTo common.FromTo) (common.FolderCreationPolicy, error) {
+	var policy common.FolderCreationPolicy
+	if err := policy.Parse(raw); err != nil {
+		return policy, fmt.Errorf("invalid folder-creation %q. Use lazy or eager", raw)
+	}
+	if policy == common.EFolderCreationPolicy.Eager() && fromTo.To() != common.ELocation.Local() && fromTo.To() != common.ELocation.File() {
+		return policy, errors.New("folder-creation eager is only supported when the destination is local or Azure Files")
+	}
+	return policy, nil
+}
+
 func validateMd5Option(option common.HashValidationOption, fromTo common.FromTo) error {
-	hasMd5Validation := option != common.DefaultHashValidationOption
+	hasMd5Validation := option != common.DefaultHashValidationOptionForMode()
 	if hasMd5Validation && !fromTo.IsDownload() {
 		return fmt.Errorf("check-md5 is set but the job is not a download")
 	}
 	return nil
 }
 
+// deleting the source only makes sense if the content of the destination really is compared with it, and only where we know how to delete the source.
+// That's only so for downloads, since they compare the MD5 hash of what they wrote with the one stored for the source; uploads and
+// copies between accounts have no hash to compare with (and each transfer that ends up not compared keeps its source anyway)
+func validateDeleteSourceAfterVerified(fromTo common.FromTo, checkLength bool, md5Option common.HashValidationOption, pinSourceVersions bool) error {
+	switch fromTo {
+	case common.EFromTo.BlobLocal(), common.EFromTo.FileLocal():
+	default:
+		return fmt.Errorf("delete-source-after=verified is not supported when transferring %v, since only downloads compare the hash of the content with that of the source", fromTo)
+	}
+	if !checkLength {
+		return errors.New("delete-source-after=verified requires check-length, so that each destination is verified before its source is deleted")
+	}
+	if common.FIPSModeEnabled() {
+		return fmt.Errorf("delete-source-after=verified cannot be used in FIPS mode, since the downloaded files can only be verified with MD5: %v", common.ErrMD5NotAllowedInFIPSMode)
+	}
+	if md5Option != common.EHashValidationOption.FailIfDifferent() && md5Option != common.EHashValidationOption.FailIfDifferentOrMissing() {
+		return errors.New("delete-source-after=verified requires check-md5 FailIfDifferent or FailIfDifferentOrMissing, since the downloaded files would not be verified otherwise")
+	}
+	if pinSourceVersions {
+		return errors.New("delete-source-after cannot be used with pin-source-versions")
+	}
+	return nil
+}
+
 // represents the processed copy command input from the user
 type cookedCopyCmdArgs struct {
 	// from arguments
@@ -656,6 +1312,12 @@ type cookedCopyCmdArgs struct {
 	destinationSAS string
 	fromTo         common.FromTo
 
+	// a local directory is uploaded as a single tar blob, or a tar blob is extracted, rather than the files being transferred by a job
+	archive common.Archive
+
+	// the transfers are enumerated and filtered as usual, but only reported rather than scheduled
+	dryRun bool
+
 	// new include/exclude only apply to file names
 	// implemented for remove (and sync) only
 	// includePathPatterns are handled like a list-of-files. Do not panic. This is not a bug that it is not present here.
@@ -664,10 +1326,29 @@ type cookedCopyCmdArgs struct {
 	excludePathPatterns   []string
 	includeFileAttributes []string
 	excludeFileAttributes []string
+	excludeHidden         bool
+	ignoreMatcher         *ignoreMatcher // rules from exclude-patterns-file, nil if none were given
+
+	labels      string // JSON, as stored in the job plan
+	description string
+	afterJobID  common.JobID
+
+	// if given, the job ID is derived from it, and an existing job with that ID is resumed
+	idempotencyKey string
+
+	// the clouds of the source and destination, empty unless given by the user
+	sourceCloud      common.AzureCloud
+	destinationCloud common.AzureCloud
 
 	// filters from flags
 	listOfFilesChannel chan string // Channels are nullable.
+	inventoryReport    string      // when set, the source is enumerated from this blob inventory report rather than by listing
+	urlList            string      // when set, the sources are the URLs in this file, rather than a single source
 	recursive          bool
+	maxDepth           int     // when non-zero, only objects this many levels or fewer below the source are processed
+	sampleFraction     float64 // when non-zero, only this fraction of the objects, chosen by hashing their paths with sampleSeed, is processed
+	sampleSeed         string
+	sampleMaxBytes     int64 // when non-zero, objects are processed only until they add up to this many bytes
 	stripTopDir        bool
 	followSymlinks     bool
 	forceWrite         common.OverwriteOption
@@ -676,7 +1357,10 @@ type cookedCopyCmdArgs struct {
 	// options from flags
 	blockSize uint32
 	// list of blobTypes to exclude while enumerating the transfer
-	excludeBlobType          []azblob.BlobType
+	excludeBlobType []azblob.BlobType
+	// list of blobTypes and content type patterns to include while enumerating the transfer
+	includeBlobType          []azblob.BlobType
+	includeContentTypes      []string
 	blobType                 common.BlobType
 	blockBlobTier            common.BlockBlobTier
 	pageBlobTier             common.PageBlobTier
@@ -690,8 +1374,32 @@ type cookedCopyCmdArgs struct {
 	preserveLastModifiedTime bool
 	deleteSnapshotsOption    common.DeleteSnapshotsOption
 	putMd5                   bool
+	convertToVHD             bool
 	md5ValidationOption      common.HashValidationOption
 	CheckLength              bool
+	allowSecondaryRead       bool
+	sourceChangePolicy       common.SourceChangePolicy
+	pinSourceVersions        bool
+	preservePermissions      bool
+	preservePosixProperties  bool
+	maxWriteLatencyMs        uint32
+	continueOnListFailure    bool
+	fileTimeBudgetPerGB      uint32
+	reportSlowestFiles       uint32
+	deleteSourceAfter        common.DeleteSourceAfter
+	assertSourceUnchanged    common.AssertSourceUnchanged
+	maxAccountFraction       float32
+	dailyCapBytes            uint64
+	propertiesOnly           bool
+	journal                  bool
+	folderCreation           common.FolderCreationPolicy
+	writeOnce                bool
+	contentPolicy            common.ContentPolicy
+	manifest                 string
+	manifestSigningKey       string
+	propertyMapping          string
+	partitionPrefix          string // the partition directories that the files are put under, with the placeholders filled in
+	successMarker            bool
 	logVerbosity             common.LogLevel
 	// commandString hold the user given command which is logged to the Job log file
 	commandString string
@@ -716,6 +1424,29 @@ type cookedCopyCmdArgs struct {
 	// it is useful to indicate whether we are simply waiting for the purpose of cancelling
 	isEnumerationComplete bool
 
+	// jobs with more bytes than this are broken up into sequential sub-jobs, each with its own job ID, plan files and summary
+	autoPartitionSize int64
+	// the number of the current sub-job (from 1), and how many bytes have been scheduled in it so far
+	subJobNumber int
+	subJobBytes  int64
+	// set while a sub-job that is not the last one completes. The progress reporting sends the final status of the sub-job
+	// to subJobDone once its summary is out. atomicScanCutShort is set if that status stopped the scan
+	atomicSubJobPending int32
+	subJobDone          chan common.JobStatus
+	atomicScanCutShort  int32
+
+	// the whole source is scanned before any of the job is transferred, so that its totals are known from the start.
+	// Until then, the parts of the job are held in heldParts, rather than being ordered as each fills up
+	enumerateFirst bool
+	heldParts      []common.CopyJobPartOrderRequest
+
+	// the totals that the job must end with, for it to succeed, and, in a dry run, the file to save the totals to
+	expectedTotals     expectedTotals
+	expectedTotalsFile string
+
+	// the files of a URL list that couldn't be read when it was scanned, which count as failed transfers of the job
+	unreadableSources *unreadableSources
+
 	// whether user wants to preserve full properties during service to service copy, the default value is true.
 	// For S3 and Azure File non-single file source, as list operation doesn't return full properties of objects/files,
 	// to preserve full properties AzCopy needs to send one additional request per object/file.
@@ -753,6 +1484,21 @@ func (cca *cookedCopyCmdArgs) isRedirection() bool {
 }
 
 func (cca *cookedCopyCmdArgs) process() error {
+	// a dry run neither waits for the job it would follow, nor resumes the job it would be
+	if !cca.dryRun {
+		if err := waitForJob(cca.afterJobID); err != nil {
+			return err
+		}
+
+		if err := cca.resumeExistingIdempotentJob(); err != nil {
+			return err
+		}
+	}
+
+	if cca.archive != common.EArchive.None() {
+		return cca.processArchiveCopy()
+	}
+
 	if cca.isRedirection() {
 		err := cca.processRedirectionCopy()
 
@@ -771,15 +1517,20 @@ func (cca *cookedCopyCmdArgs) processRedirectionCopy() error {
 	if cca.fromTo == common.EFromTo.PipeBlob() {
 		return cca.processRedirectionUpload(cca.destination, cca.blockSize)
 	} else if cca.fromTo == common.EFromTo.BlobPipe() {
-		return cca.processRedirectionDownload(cca.source)
+		return cca.processRedirectionDownload(cca.source, cca.blockSize)
 	}
 
 	return fmt.Errorf("unsupported redirection type: %s", cca.fromTo)
 }
 
-func (cca *cookedCopyCmdArgs) processRedirectionDownload(blobUrl string) error {
+func (cca *cookedCopyCmdArgs) processRedirectionDownload(blobUrl string, blockSize uint32) error {
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 
+	// if no block size is set, then use default value
+	if blockSize == 0 {
+		blockSize = pipingDefaultBlockSize
+	}
+
 	// step 0: check the Stdout before uploading
 	_, err := os.Stdout.Stat()
 	if err != nil {
@@ -798,18 +1549,16 @@ func (cca *cookedCopyCmdArgs) processRedirectionDownload(blobUrl string) error {
 		return fmt.Errorf("fatal: cannot parse source blob URL due to error: %s", err.Error())
 	}
 
-	// step 3: start download
+	// step 3: find the size of the blob, and pin the version that we read, so that all the ranges come from the same one
 	blobURL := azblob.NewBlobURL(*u, p)
-	blobStream, err := blobURL.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	props, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
 	if err != nil {
-		return fmt.Errorf("fatal: cannot download blob due to error: %s", err.Error())
+		return fmt.Errorf("fatal: cannot get the properties of the blob due to error: %s", err.Error())
 	}
+	ac := azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: props.ETag()}}
 
-	blobBody := blobStream.Body(azblob.RetryReaderOptions{MaxRetryRequests: ste.MaxRetryPerDownloadBody})
-	defer blobBody.Close()
-
-	// step 4: pipe everything into Stdout
-	_, err = io.Copy(os.Stdout, blobBody)
+	// step 4: read the blob in ranges, several at once, and pipe them into Stdout in order
+	err = copyRangesInOrder(ctx, os.Stdout, props.ContentLength(), int64(blockSize), pipingDownloadParallelism, blobRangeReader(blobURL, ac))
 	if err != nil {
 		return fmt.Errorf("fatal: cannot download blob to Stdout due to error: %s", err.Error())
 	}
@@ -817,6 +1566,70 @@ func (cca *cookedCopyCmdArgs) processRedirectionDownload(blobUrl string) error {
 	return nil
 }
 
+// blobRangeReader reads ranges of the blob, for copyRangesInOrder
+func blobRangeReader(blobURL azblob.BlobURL, ac azblob.BlobAccessConditions) func(ctx context.Context, offset int64, count int64) ([]byte, error) {
+	return func(ctx context.Context, offset int64, count int64) ([]byte, error) {
+		blobStream, err := blobURL.Download(ctx, offset, count, ac, false)
+		if err != nil {
+			return nil, err
+		}
+		blobBody := blobStream.Body(azblob.RetryReaderOptions{MaxRetryRequests: ste.MaxRetryPerDownloadBody})
+		defer blobBody.Close()
+
+		data := make([]byte, count)
+		_, err = io.ReadFull(blobBody, data)
+		return data, err
+	}
+}
+
+// copyRangesInOrder reads a source of the given size in ranges, with up to parallelism reads at once, and writes the ranges to w
+// in order. Ranges that arrive early wait for the ones before them, so at most parallelism ranges, plus the one being written,
+// are held in memory at any time.
+func copyRangesInOrder(ctx context.Context, w io.Writer, size int64, rangeSize int64, parallelism int,
+	readRange func(ctx context.Context, offset int64, count int64) ([]byte, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the reads that are still going when a read or a write fails
+
+	type rangeResult struct {
+		data []byte
+		err  error
+	}
+
+	// each range has a channel for its result, and the channels are queued in the order of the ranges,
+	// so that the capacity of the queue limits how far ahead the reads can get
+	pending := make(chan chan rangeResult, parallelism)
+	go func() {
+		defer close(pending)
+		for offset := int64(0); offset < size; offset += rangeSize {
+			count := rangeSize
+			if size-offset < count {
+				count = size - offset
+			}
+			result := make(chan rangeResult, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func(offset int64, count int64) {
+				data, err := readRange(ctx, offset, count)
+				result <- rangeResult{data, err}
+			}(offset, count)
+		}
+	}()
+
+	for result := range pending {
+		r := <-result
+		if r.err != nil {
+			return r.err
+		}
+		if _, err := w.Write(r.data); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
 func (cca *cookedCopyCmdArgs) processRedirectionUpload(blobUrl string, blockSize uint32) error {
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 
@@ -837,21 +1650,61 @@ func (cca *cookedCopyCmdArgs) processRedirectionUpload(blobUrl string, blockSize
 		return fmt.Errorf("fatal: cannot parse destination blob URL due to error: %s", err.Error())
 	}
 
-	// step 2: leverage high-level call in Blob SDK to upload stdin in parallel
+	metadata, err := common.UnMarshalToCommonMetadata(cca.metadata)
+	if err != nil {
+		return fmt.Errorf("fatal: cannot parse metadata due to error: %s", err.Error())
+	}
+
+	// step 2: leverage high-level call in Blob SDK to upload stdin in parallel.
+	// It stages the data in blocks as it arrives, holding at most MaxBuffers blocks in memory,
+	// and commits the block list once stdin is closed, so the total size never needs to be known
 	blockBlobUrl := azblob.NewBlockBlobURL(*u, p)
-	_, err = azblob.UploadStreamToBlockBlob(ctx, os.Stdin, blockBlobUrl, azblob.UploadStreamToBlockBlobOptions{
+	stdin := &pipeSizeLimitReader{reader: os.Stdin, remaining: int64(blockSize) * common.MaxNumberOfBlocksPerBlob, blockSize: blockSize}
+	_, err = azblob.UploadStreamToBlockBlob(ctx, stdin, blockBlobUrl, azblob.UploadStreamToBlockBlobOptions{
 		BufferSize: int(blockSize),
 		MaxBuffers: pipingUploadParallelism,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType:        cca.contentType,
+			ContentEncoding:    cca.contentEncoding,
+			ContentLanguage:    cca.contentLanguage,
+			ContentDisposition: cca.contentDisposition,
+			CacheControl:       cca.cacheControl,
+		},
+		Metadata: metadata.ToAzBlobMetadata(),
 	})
 
 	return err
 }
 
+// pipeSizeLimitReader fails the read that takes the data from the pipe beyond what fits in the blob's blocks,
+// so that the upload stops there, rather than after staging all the blocks, when the block list is rejected
+type pipeSizeLimitReader struct {
+	reader    io.Reader
+	remaining int64
+	blockSize uint32
+}
+
+func (r *pipeSizeLimitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1] // one byte beyond the limit is enough to tell that there's too much
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return 0, fmt.Errorf("the data from the pipe doesn't fit in %d blocks of %d bytes. Use a larger block-size-mb", common.MaxNumberOfBlocksPerBlob, r.blockSize)
+	}
+	return n, err
+}
+
 // handles the copy command
 // dispatches the job order (in parts) to the storage engine
 func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 
+	if notice := common.FIPSModeValidationNotice(cca.CheckLength); notice != "" {
+		glcm.Info(notice)
+	}
+
 	// Note: credential info here is only used by remove at the moment.
 	// TODO: Get the entirety of remove into the new copyEnumeratorInit script so we can remove this
 	//       and stop having two places in copy that we get credential info
@@ -883,6 +1736,15 @@ func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 		} else {
 			cca.credentialInfo.OAuthTokenInfo = *tokenInfo
 		}
+
+		// the credential is for the destination, except when only the source is remote (downloads and deletions)
+		cloud := cca.destinationCloud
+		if !cca.fromTo.To().IsRemote() {
+			cloud = cca.sourceCloud
+		}
+		if err = switchCredentialToCloud(&cca.credentialInfo, cloud); err != nil {
+			return err
+		}
 	}
 
 	// initialize the fields that are constant across all job part orders
@@ -908,6 +1770,7 @@ func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 			NoGuessMimeType:          cca.noGuessMimeType,
 			PreserveLastModifiedTime: cca.preserveLastModifiedTime,
 			PutMd5:                   cca.putMd5,
+			ConvertToVHD:             cca.convertToVHD,
 			MD5ValidationOption:      cca.md5ValidationOption,
 			DeleteSnapshotsOption:    cca.deleteSnapshotsOption,
 		},
@@ -918,6 +1781,9 @@ func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 		DestinationSAS: cca.destinationSAS,
 		CommandString:  cca.commandString,
 		CredentialInfo: cca.credentialInfo,
+		Labels:         cca.labels,
+		Description:    cca.description,
+		AfterJobID:     cca.afterJobID,
 	}
 
 	from := cca.fromTo.From()
@@ -965,22 +1831,45 @@ func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 		common.EFromTo.BlobLocal(),
 		common.EFromTo.FileLocal(),
 		common.EFromTo.BlobFSLocal(),
+		common.EFromTo.LocalLocal(),
 		common.EFromTo.BlobBlob(),
 		common.EFromTo.FileBlob(),
 		common.EFromTo.FileFile(),
 		common.EFromTo.BlobFile(),
 		common.EFromTo.S3Blob(),
+		common.EFromTo.HttpBlob(),
+		common.EFromTo.SftpBlob(),
+		common.EFromTo.BlobSftp(),
 		common.EFromTo.BenchmarkBlob(),
 		common.EFromTo.BenchmarkBlobFS(),
 		common.EFromTo.BenchmarkFile():
 
+		var quarantine *prefixQuarantine
+		if cca.continueOnListFailure {
+			quarantine = newPrefixQuarantine()
+			ctx = withPrefixQuarantine(ctx, quarantine)
+		}
+
 		var e *copyEnumerator
 		e, err = cca.initEnumerator(jobPartOrder, ctx)
 		if err != nil {
 			return err
 		}
 
+		if cca.enumerateFirst {
+			glcm.Info("Scanning the whole source before transferring anything, since enumerate-first is set.")
+		}
 		err = e.enumerate()
+
+		// the job goes ahead without the prefixes that couldn't be listed, so make sure the user knows about them
+		if quarantine != nil {
+			if report := quarantine.report(); report != "" {
+				glcm.Info(report)
+				if ste.JobsAdmin != nil {
+					ste.JobsAdmin.LogToJobLog(report)
+				}
+			}
+		}
 	case common.EFromTo.BlobTrash(), common.EFromTo.FileTrash():
 		e, createErr := newRemoveEnumerator(cca)
 		if createErr != nil {
@@ -1043,8 +1932,7 @@ func (cca *cookedCopyCmdArgs) waitUntilJobCompletion(blocking bool) {
 func (cca *cookedCopyCmdArgs) Cancel(lcm common.LifecycleMgr) {
 	// prompt for confirmation, except when enumeration is complete
 	if !cca.isEnumerationComplete {
-		answer := lcm.Prompt("The source enumeration is not complete, "+
-			"cancelling the job at this point means it cannot be resumed.",
+		answer := lcm.Prompt(common.UserMessages().Text(common.MsgCancelCopyPrompt),
 			common.PromptDetails{
 				PromptType: common.EPromptType.Cancel(),
 				ResponseOptions: []common.ResponseOption{
@@ -1097,18 +1985,31 @@ func (cca *cookedCopyCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) {
 	var summary common.ListJobSummaryResponse
 	Rpc(common.ERpcCmd.ListJobSummary(), &cca.jobID, &summary)
 	summary.IsCleanupJob = cca.isCleanupJob // only FE knows this, so we can only set it here
+	if len(summary.SlowestTransfers) > int(cca.reportSlowestFiles) {
+		summary.SlowestTransfers = summary.SlowestTransfers[:cca.reportSlowestFiles]
+	}
 	cleanupStatusString := fmt.Sprintf("Cleanup %v/%v", summary.TransfersCompleted, summary.TotalTransfers)
 
-	jobDone := summary.JobStatus.IsJobDone()
+	// a job that was paused (e.g. because the account is failing over) won't make any more progress in this run
+	jobDone := summary.JobStatus.IsJobDone() || summary.JobStatus == common.EJobStatus.Paused()
 
 	// if json is not desired, and job is done, then we generate a special end message to conclude the job
 	duration := time.Now().Sub(cca.jobStartTime) // report the total run time of the job
 
+	if jobDone && cca.unreadableSources != nil {
+		cca.unreadableSources.addTo(&summary)
+	}
+
 	if jobDone {
 		exitCode := cca.getSuccessExitCode()
 		if summary.TransfersFailed > 0 {
 			exitCode = common.EExitCode.Error()
 		}
+		mismatches, reconciliationReport := cca.expectedTotals.reconcile(summary)
+		if len(mismatches) > 0 {
+			summary.ReconciliationMismatches = mismatches
+			exitCode = common.EExitCode.Error()
+		}
 
 		builder := func(format common.OutputFormat) string {
 			if format == common.EOutputFormat.Json() {
@@ -1116,20 +2017,9 @@ func (cca *cookedCopyCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) {
 				common.PanicIfErr(err)
 				return string(jsonOutput)
 			} else {
-				screenStats, logStats := formatExtraStats(cca.fromTo, summary.AverageIOPS, summary.AverageE2EMilliseconds, summary.NetworkErrorPercentage, summary.ServerBusyPercentage)
-
-				output := fmt.Sprintf(
-					`
-
-Job %s summary
-Elapsed Time (Minutes): %v
-Total Number Of Transfers: %v
-Number of Transfers Completed: %v
-Number of Transfers Failed: %v
-Number of Transfers Skipped: %v
-TotalBytesTransferred: %v
-Final Job Status: %v%s%s
-`,
+				screenStats, logStats := formatExtraStats(cca.fromTo, summary)
+
+				summaryArgs := []interface{}{
 					summary.JobID.String(),
 					ste.ToFixed(duration.Minutes(), 4),
 					summary.TotalTransfers,
@@ -1139,22 +2029,42 @@ Final Job Status: %v%s%s
 					summary.TotalBytesTransferred,
 					summary.JobStatus,
 					screenStats,
-					formatPerfAdvice(summary.PerformanceAdvice))
+					formatContentPolicyReport(summary),
+					formatManifestReport(summary),
+					cca.formatSourceDeletionReport(summary),
+					reconciliationReport,
+					formatScanOverlap(summary.ScanOverlap),
+					formatSlowestTransfers(summary.SlowestTransfers),
+					formatPerfAdvice(summary.PerformanceAdvice)}
+				output := common.UserMessages().Sprintf(common.MsgCopyJobSummary, summaryArgs...)
+				logOutput := common.LogMessages().Sprintf(common.MsgCopyJobSummary, summaryArgs...)
 
 				// abbreviated output for cleanup jobs
 				if cca.isCleanupJob {
 					output = fmt.Sprintf("%s: %s)", cleanupStatusString, summary.JobStatus)
+					logOutput = output
 				}
 
 				// log to job log
 				jobMan, exists := ste.JobsAdmin.JobMgr(summary.JobID)
 				if exists {
-					jobMan.Log(pipeline.LogInfo, logStats+"\n"+output)
+					jobMan.Log(pipeline.LogInfo, logStats+"\n"+logOutput)
 				}
 				return output
 			}
 		}
 
+		if atomic.LoadInt32(&cca.atomicSubJobPending) == 1 {
+			if subJobLetsScanContinue(summary.JobStatus) {
+				lcm.Exit(builder, common.EExitCode.NoExit()) // leave the app running, so that the scan carries on into the next sub-job
+				cca.priorJobExitCode = &exitCode
+				cca.subJobDone <- summary.JobStatus
+				lcm.SurrenderControl() // the next sub-job will have its own progress reporting
+			}
+			cca.subJobDone <- summary.JobStatus // which stops the scan, while this exits
+			lcm.Info(fmt.Sprintf("The rest of the source was not scanned, because job %s ended with status %v.", summary.JobID, summary.JobStatus))
+		}
+
 		if cca.hasFollowup() {
 			lcm.Exit(builder, common.EExitCode.NoExit()) // leave the app running to process the followup
 			cca.launchFollowup(exitCode)
@@ -1205,7 +2115,7 @@ Final Job Status: %v%s%s
 			isBenchmark := cca.fromTo.From() == common.ELocation.Benchmark()
 			perfString, diskString := getPerfDisplayText(summary.PerfStrings, summary.PerfConstraint, duration, isBenchmark)
 
-			return fmt.Sprintf("%.1f %%, %v Done, %v Failed, %v Pending, %v Skipped, %v Total%s, %s%s%s",
+			return common.UserMessages().Sprintf(common.MsgCopyProgress,
 				summary.PercentComplete,
 				summary.TransfersCompleted,
 				summary.TransfersFailed,
@@ -1215,6 +2125,92 @@ Final Job Status: %v%s%s
 	})
 }
 
+// reconciles the sources that were deleted after being transferred and verified with the ones that were kept
+func (cca *cookedCopyCmdArgs) formatSourceDeletionReport(summary common.ListJobSummaryResponse) string {
+	if cca.deleteSourceAfter != common.EDeleteSourceAfter.Verified() {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("Sources deleted after verified transfer: %v\n", summary.SourcesDeleted))
+	b.WriteString(fmt.Sprintf("Sources kept (transfer failed, skipped or not done, or source could not be deleted): %v\n",
+		summary.TotalTransfers-summary.SourcesDeleted))
+	if len(summary.SourceDeletionFailures) > 0 {
+		b.WriteString("Sources that were transferred but could not be deleted:\n")
+		for _, f := range summary.SourceDeletionFailures {
+			b.WriteString(fmt.Sprintf("  %s: %s\n", f.Src, f.ErrorMsg))
+		}
+	}
+	return b.String()
+}
+
+// formatContentPolicyReport lists the files that violated the content policy, or were found infected, separately from the failures
+func formatContentPolicyReport(summary common.ListJobSummaryResponse) string {
+	if summary.TransfersRejectedByPolicy == 0 && summary.TransfersSkippedInfected == 0 && len(summary.PolicyViolations) == 0 {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("Files rejected by the content policy: %v\n", summary.TransfersRejectedByPolicy))
+	b.WriteString(fmt.Sprintf("Files skipped as infected: %v\n", summary.TransfersSkippedInfected))
+	// the violations are only known to the process that ran the job
+	if len(summary.PolicyViolations) > 0 {
+		b.WriteString(fmt.Sprintf("Files quarantined by the content policy: %v\n", summary.TransfersQuarantined))
+		b.WriteString("Content policy violations:\n")
+		for _, v := range summary.PolicyViolations {
+			if v.Infected && !v.Quarantined {
+				b.WriteString(fmt.Sprintf("  %s: %s (skipped)\n", v.Src, v.Rule))
+			} else if v.Quarantined {
+				b.WriteString(fmt.Sprintf("  %s: %s (quarantined to %s)\n", v.Src, v.Rule, v.Dst))
+			} else {
+				b.WriteString(fmt.Sprintf("  %s: %s (rejected)\n", v.Src, v.Rule))
+			}
+		}
+	}
+	return b.String()
+}
+
+// formatScanOverlap says how much of the job was transferred while the source was still being scanned.
+// There's nothing to say about a job that was ordered in one part, or that was held back until the scan was complete
+func formatScanOverlap(overlap *common.ScanOverlap) string {
+	if overlap == nil || overlap.PartsOrderedWhileScanning == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nTransferring overlapped with scanning for %v seconds. %v part(s) of the job were ordered before the scan was complete, "+
+		"and by then %v transfers were done, and %s had been transferred.",
+		ste.ToFixed(overlap.OverlapSeconds, 1), overlap.PartsOrderedWhileScanning, overlap.TransfersDoneWhileScanning,
+		byteSizeToString(int64(overlap.BytesTransferredWhileScanning)))
+}
+
+func formatManifestReport(summary common.ListJobSummaryResponse) string {
+	switch {
+	case summary.ManifestPath == "":
+		return ""
+	case summary.ManifestError != "":
+		return fmt.Sprintf("\n\nThe manifest %s could not be written: %s", summary.ManifestPath, summary.ManifestError)
+	default:
+		return fmt.Sprintf("\n\nManifest of the transferred files: %s", summary.ManifestPath)
+	}
+}
+
+func formatSlowestTransfers(slowest []common.SlowTransferDetail) string {
+	if len(slowest) == 0 {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteString("\n\n")
+	b.WriteString("Slowest transfers (seconds, bytes, status, source):\n")
+	for _, t := range slowest {
+		requeued := ""
+		if t.Requeued {
+			requeued = " (requeued after running over its time budget)"
+		}
+		b.WriteString(fmt.Sprintf("  %v  %d  %v  %s%s\n",
+			ste.ToFixed(float64(t.ElapsedMilliseconds)/1000, 1), t.SourceSize, t.TransferStatus, t.Src, requeued))
+	}
+	return b.String()
+}
+
 func formatPerfAdvice(advice []common.PerformanceAdvice) string {
 	if len(advice) == 0 {
 		return ""
@@ -1244,7 +2240,7 @@ func formatPerfAdvice(advice []common.PerformanceAdvice) string {
 
 // format extra stats to include in the log.  If benchmarking, also output them on screen (but not to screen in normal
 // usage because too cluttered)
-func formatExtraStats(fromTo common.FromTo, avgIOPS int, avgE2EMilliseconds int, networkErrorPercent float32, serverBusyPercent float32) (screenStats, logStats string) {
+func formatExtraStats(fromTo common.FromTo, summary common.ListJobSummaryResponse) (screenStats, logStats string) {
 	logStats = fmt.Sprintf(
 		`
 
@@ -1252,8 +2248,11 @@ Diagnostic stats:
 IOPS: %v
 End-to-end ms per request: %v
 Network Errors: %.2f%%
-Server Busy: %.2f%%`,
-		avgIOPS, avgE2EMilliseconds, networkErrorPercent, serverBusyPercent)
+Server Busy: %.2f%%
+Connection Reuse: %.2f%%
+Dropped Idle Connections: %v`,
+		summary.AverageIOPS, summary.AverageE2EMilliseconds, summary.NetworkErrorPercentage, summary.ServerBusyPercentage,
+		summary.ConnectionReusePercentage, summary.DroppedIdleConnections)
 
 	if fromTo.From() == common.ELocation.Benchmark() {
 		screenStats = logStats
@@ -1310,7 +2309,24 @@ func init() {
 		Long:       copyCmdLongDescription,
 		Example:    copyCmdExample,
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 1 { // redirection
+			if len(args) == 1 && raw.fromPipe { // redirection, even when stdin isn't a named pipe, e.g. when it's a file or a socket
+				raw.src = pipeLocation
+				raw.dst = args[0]
+			} else if raw.fromPipe {
+				return errors.New("from-pipe takes only the destination blob URL as an argument")
+			} else if len(args) == 1 && raw.toPipe { // redirection, whatever stdin is
+				raw.src = args[0]
+				raw.dst = pipeLocation
+			} else if raw.toPipe {
+				return errors.New("to-pipe takes only the source blob URL as an argument")
+			} else if len(args) == 1 && raw.urlList != "" { // the sources are in the list, so the only argument is the destination
+				raw.dst = args[0]
+
+				glcm.EnableInputWatcher()
+				if cancelFromStdin {
+					glcm.EnableCancelFromStdIn()
+				}
+			} else if len(args) == 1 { // redirection
 				if stdinPipeIn, err := isStdinPipeIn(); stdinPipeIn == true {
 					raw.src = pipeLocation
 					raw.dst = args[0]
@@ -1337,17 +2353,18 @@ func init() {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			raw.md5ValidationOptionIsSet = cmd.Flags().Changed("check-md5")
 			cooked, err := raw.cook()
 			if err != nil {
-				glcm.Error("failed to parse user input due to error: " + err.Error())
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
 			}
 
 			glcm.Info("Scanning...")
 
 			cooked.commandString = copyHandlerUtil{}.ConstructCommandStringFromArgs()
 			err = cooked.process()
-			if err != nil {
-				glcm.Error("failed to perform copy command due to error: " + err.Error())
+			if err != nil && atomic.LoadInt32(&cooked.atomicScanCutShort) == 0 { // the summary of the last sub-job already said why the scan stopped
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToPerformCommand, "copy", err.Error()))
 			}
 
 			glcm.SurrenderControl()
@@ -1365,15 +2382,57 @@ func init() {
 		"This option does not support wildcard characters (*). Checks relative path prefix(For example: myFolder;myFolder/subDirName/file.pdf). When used in combination with account traversal, paths do not include the container name.")
 	// This flag is implemented only for Storage Explorer.
 	cpCmd.PersistentFlags().StringVar(&raw.listOfFilesToCopy, "list-of-files", "", "Defines the location of text file which has the list of only files to be copied.")
+	cpCmd.PersistentFlags().StringVar(&raw.inventoryReport, "from-inventory", "", "Enumerate the Blob source from this blob inventory report (CSV or Parquet), given as a local path or a URL, instead of listing the container. "+
+		"The report must include the Name column. Blobs without a Content-Length in the report have their properties read from the service.")
+	cpCmd.PersistentFlags().BoolVar(&raw.fromPipe, "from-pipe", false, "Upload the data read from stdin to the block blob at the destination URL, which is then the only argument. "+
+		"The data is staged in blocks of block-size-mb (default 8 MiB) as it arrives, so its size doesn't need to be known in advance, but it can't be more than 50,000 blocks. "+
+		"Without this flag, stdin is only read when it's a named pipe.")
+	cpCmd.PersistentFlags().BoolVar(&raw.toPipe, "to-pipe", false, "Download the blob at the source URL, which is then the only argument, to stdout. "+
+		"Ranges of block-size-mb (default 8 MiB) are read several at a time, and written out in order. "+
+		"Without this flag, a single argument is only taken as a blob to download when stdin isn't a named pipe.")
+	cpCmd.PersistentFlags().StringVar(&raw.archive, "archive", "", "Upload the local source directory as a single block blob holding a tar of its files, rather than as a blob for each file, "+
+		"or extract the files in the tar at the source blob URL into the local destination directory. Available options: none, tar, tar.gz. "+
+		"The tar is streamed in blocks of block-size-mb as the directory is read, so it's never written to disk. Only regular files and directories are included. "+
+		"The blob URL must be authorized with a SAS, or be public.")
+	cpCmd.PersistentFlags().BoolVar(&raw.dryRun, "dry-run", false, "List the files that would be copied, with their destinations and sizes, followed by the totals, but don't copy anything or create any containers. "+
+		"The source is enumerated and filtered exactly as it would be for the copy, so this is a way to check include and exclude patterns before a large job.")
+	cpCmd.PersistentFlags().StringVar(&raw.urlList, "url-list", "", "Fetch the files at the HTTP(S) URLs listed in this local file into the destination container or directory, which is then the only argument. "+
+		"Each line is a URL, optionally followed, after a tab, by the name to give the file at the destination, and then by tab-separated headers to set on it, "+
+		"e.g. Content-Type: text/csv or x-ms-meta-source: web. Those headers take precedence over the ones given for the whole job, e.g. with content-type or metadata, "+
+		"which take precedence over the ones the server gives. Blank lines and lines starting with # are ignored. "+
+		"Files that can't be read when the list is scanned are reported as failed transfers. "+
+		"Note that the URLs, including any signatures in them, are kept in the job's plan files.")
 	cpCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "", "Exclude these files when copying. This option supports wildcard characters (*)")
+	cpCmd.PersistentFlags().BoolVar(&raw.excludeHidden, "exclude-hidden", false, "Exclude hidden, system and temporary files by convention: names starting with a dot (and everything inside such directories), "+
+		"Thumbs.db, desktop.ini, Office lock files (~$*), and temporary files such as *~, *.tmp and *.swp.")
+	cpCmd.PersistentFlags().StringVar(&raw.excludePatternsFile, "exclude-patterns-file", "", "Exclude the files matched by the rules in this file, which uses the .gitignore syntax (including ! negation and rules ending with / for directories). "+
+		"A relative path that does not exist is also looked for in the local source directory. Without a value, "+defaultIgnoreFileName+" is used.")
+	cpCmd.PersistentFlags().Lookup("exclude-patterns-file").NoOptDefVal = defaultIgnoreFileName
+	cpCmd.PersistentFlags().StringArrayVar(&raw.labels, "label", nil, "Attach a label to the job, as key=value, so that it can be found later with 'jobs list --label'. Can be given more than once.")
+	cpCmd.PersistentFlags().StringVar(&raw.description, "description", "", "Attach a description to the job, which is displayed by 'jobs list'.")
+	cpCmd.PersistentFlags().StringVar(&raw.afterJob, "after-job", "", afterJobFlagUsage)
+	cpCmd.PersistentFlags().StringVar(&raw.idempotencyKey, "idempotency-key", "", idempotencyKeyFlagUsage)
+	cpCmd.PersistentFlags().StringVar(&raw.sourceCloud, "source-cloud", "", "The Azure cloud of the source: AzurePublic, AzureChina, AzureUSGov, AzureGermany, or a custom cloud given as "+
+		"'authority=<Azure AD authority URL>;suffix=<storage DNS suffix>', optionally followed by ';arm=<Azure Resource Manager URL>'. With OAuth, the token is acquired from the authority of this cloud.")
+	cpCmd.PersistentFlags().StringVar(&raw.destinationCloud, "destination-cloud", "", "The Azure cloud of the destination, given like source-cloud. "+
+		"With OAuth, the token is acquired from the authority of this cloud, so a copy can bridge clouds.")
 	cpCmd.PersistentFlags().StringVar(&raw.forceWrite, "overwrite", "true", "Overwrite the conflicting files and blobs at the destination if this flag is set to true. (default 'true') Possible values include 'true', 'false', and 'prompt'.")
 	cpCmd.PersistentFlags().BoolVar(&raw.autoDecompress, "decompress", false, "Automatically decompress files when downloading, if their content-encoding indicates that they are compressed. The supported content-encoding values are 'gzip' and 'deflate'. File extensions of '.gz'/'.gzip' or '.zz' aren't necessary, but will be removed if present.")
 	cpCmd.PersistentFlags().BoolVar(&raw.recursive, "recursive", false, "Look into sub-directories recursively when uploading from local file system.")
+	cpCmd.PersistentFlags().IntVar(&raw.maxDepth, "max-depth", 0, "With recursive, only process files this many levels or fewer below the source. 1 means only the files directly inside the source directory. (default 0, meaning no limit)")
+	cpCmd.PersistentFlags().StringVar(&raw.sample, "sample", "", "Only copy this percentage of the files of the source, e.g. 1% or 0.5%, keeping their paths, so that a realistic test dataset can be made without copying all of the source. "+
+		"The files are chosen by hashing their paths with sample-seed, so the same seed always chooses the same files.")
+	cpCmd.PersistentFlags().StringVar(&raw.sampleSeed, "sample-seed", "", "Choose a different sample of the files for the sample flag. (default '', which always chooses the same sample of a given source)")
+	cpCmd.PersistentFlags().StringVar(&raw.sampleMaxBytes, "sample-max-bytes", "", "Stop choosing files to copy once they add up to this many bytes. Files that would go over it are skipped. Must be "+sizeStringDescription+". "+
+		"Which files fill it depends on the order of the scan, which can vary when directories are scanned concurrently (set concurrent-scan to 1 to avoid this).")
 	cpCmd.PersistentFlags().StringVar(&raw.fromTo, "from-to", "", "Optionally specifies the source destination combination. For Example: LocalBlob, BlobLocal, LocalBlobFS.")
 	cpCmd.PersistentFlags().StringVar(&raw.excludeBlobType, "exclude-blob-type", "", "Optionally specifies the type of blob (BlockBlob/ PageBlob/ AppendBlob) to exclude when copying blobs from the container "+
 		"or the account. Use of this flag is not applicable for copying data from non azure-service to service. More than one blob should be separated by ';'. ")
+	cpCmd.PersistentFlags().StringVar(&raw.includeBlobType, "include-blob-type", "", "Optionally specifies the type of blob (BlockBlob/ PageBlob/ AppendBlob) to include when copying blobs from the container "+
+		"or the account. Blobs of other types are skipped. More than one blob type should be separated by ';'. ")
+	cpCmd.PersistentFlags().StringVar(&raw.includeContentType, "include-content-type", "", "Include only blobs whose content type matches the pattern list. Parameters such as charset are ignored. For example: video/*;application/pdf")
 	// options change how the transfers are performed
-	cpCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "Use this block size (specified in MiB) when uploading to Azure Storage, and downloading from Azure Storage. The default value is automatically calculated based on file size. Decimal fractions are allowed (For example: 0.25).")
+	cpCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "Use this block size (specified in MiB) when uploading to Azure Storage, and downloading from Azure Storage. The default value is automatically calculated for each file, based on its size and on the latency and throughput measured so far. Decimal fractions are allowed (For example: 0.25).")
 	cpCmd.PersistentFlags().StringVar(&raw.logVerbosity, "log-level", "INFO", "Define the log verbosity for the log file, available levels: INFO(all requests/responses), WARNING(slow responses), ERROR(only failed requests), and NONE(no output logs). (default 'INFO').")
 	cpCmd.PersistentFlags().StringVar(&raw.blobType, "blob-type", "Detect", "Defines the type of blob at the destination. This is used for uploading blobs and when copying between accounts (default 'Detect'). Valid values include 'Detect', 'BlockBlob', 'PageBlob', and 'AppendBlob'. "+
 		"When copying between accounts, a value of 'Detect' causes AzCopy to use the type of source blob to determine the type of the destination blob. When uploading a file, 'Detect' determines if the file is a VHD or a VHDX file based on the file extension. If the file is ether a VHD or VHDX file, AzCopy treats the file as a page blob.")
@@ -1388,9 +2447,95 @@ func init() {
 	cpCmd.PersistentFlags().BoolVar(&raw.noGuessMimeType, "no-guess-mime-type", false, "Prevents AzCopy from detecting the content-type based on the extension or content of the file.")
 	cpCmd.PersistentFlags().BoolVar(&raw.preserveLastModifiedTime, "preserve-last-modified-time", false, "Only available when destination is file system.")
 	cpCmd.PersistentFlags().BoolVar(&raw.putMd5, "put-md5", false, "Create an MD5 hash of each file, and save the hash as the Content-MD5 property of the destination blob or file. (By default the hash is NOT created.) Only available when uploading.")
-	cpCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOption.String(), "Specifies how strictly MD5 hashes should be validated when downloading. Only available when downloading. Available options: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. (default 'FailIfDifferent')")
+	cpCmd.PersistentFlags().BoolVar(&raw.convertToVHD, "convert-to-vhd", false, "Upload dynamic VHDX and qcow2 disk images as fixed VHDs, converting them as they are read, so that no local copy of the converted disk is needed. "+
+		"Other files are uploaded as they are. Only available when uploading with blob-type set to PageBlob.")
+	cpCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOptionForMode().String(), "Specifies how strictly MD5 hashes should be validated when downloading. Only available when downloading. Available options: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. (default 'FailIfDifferent', or 'NoCheck' in FIPS mode)")
 	cpCmd.PersistentFlags().StringVar(&raw.includeFileAttributes, "include-attributes", "", "(Windows only) Include files whose attributes match the attribute list. For example: A;S;R")
 	cpCmd.PersistentFlags().StringVar(&raw.excludeFileAttributes, "exclude-attributes", "", "(Windows only) Exclude files whose attributes match the attribute list. For example: A;S;R")
+	cpCmd.PersistentFlags().BoolVar(&raw.allowSecondaryRead, "allow-secondary-read", false, "When downloading from an RA-GRS account, retry reads against the secondary endpoint (<account>-secondary) "+
+		"if the primary is failing or throttling. Once the secondary has served a read, it is used first for a few minutes. The secondary may be slightly behind the primary.")
+	cpCmd.PersistentFlags().StringVar(&raw.sourceChangePolicy, "source-change-policy", "fail", "Specifies what to do with a file whose source has changed (size or last modified time) since the transfer was scheduled. "+
+		"Available options: fail, skip, reschedule-latest. With reschedule-latest (uploads only), a file that changed before any data was sent is restarted using the latest version, "+
+		"and a file that changed while being sent is failed, and the latest version is transferred when the job is resumed.")
+	cpCmd.PersistentFlags().BoolVar(&raw.pinSourceVersions, "pin-source-versions", false, "Pin each blob to the version that is current when it is enumerated, so that the job copies a consistent point-in-time view of the source "+
+		"even if the blobs are modified during the job. Requires blob versioning to be enabled on the source account, and costs one extra request per blob.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preservePermissions, "preserve-permissions", false, "When copying between ADLS Gen 2 accounts (with hierarchical namespaces), also copy the owner, group, permissions and ACL "+
+		"of each file, and of the directories it's in (where the paths of the source and destination line up), through the dfs endpoints of the accounts. "+
+		"The destination must be authorized to change ownership and permissions, e.g. with the Storage Blob Data Owner role, or a SAS that allows it. "+
+		"A file whose permissions can't be copied is failed.")
+	cpCmd.PersistentFlags().BoolVar(&raw.nfs, "nfs", false, "The Azure Files shares are NFS shares, or the local files are on an NFS mount: keep the owner (uid), group (gid) and mode bits of each file, "+
+		"rather than the SMB properties. Downloads also keep those of the directories that they create, and must run as root to set the owner of the files. "+
+		"Files that are decompressed keep the defaults. A file whose owner, group and mode (or those of its directories) can't be preserved is failed.")
+	cpCmd.PersistentFlags().Uint32Var(&raw.maxWriteLatencyMs, "max-write-latency-ms", 0, "When the 99th percentile latency of writes to a destination account goes over this many milliseconds, "+
+		"reduce the number of write requests in flight to that account until latency recovers. Useful when copying into an account shared with production workloads. (default 0, meaning off)")
+	cpCmd.PersistentFlags().BoolVar(&raw.continueOnListFailure, "continue-on-list-failure", false, "If a directory or prefix of the source still can't be listed after retrying, carry on scanning the rest of the source "+
+		"and report the failed prefixes at the end of the scan, instead of failing the job. Scanning still stops if many prefixes fail in a row. "+
+		"The retries of listing can be tuned with AZCOPY_LIST_MAX_TRIES, AZCOPY_LIST_TRY_TIMEOUT and AZCOPY_LIST_MAX_RETRY_DELAY.")
+	cpCmd.PersistentFlags().Uint32Var(&raw.fileTimeBudgetPerGB, "file-time-budget-seconds-per-gb", 0, "Fail any file that is still being transferred after this many seconds per GB of its size (and at least one minute), "+
+		"and try it once more at the back of the queue. Useful for keeping a few pathological files from holding up a giant job. (default 0, meaning no time budget)")
+	cpCmd.PersistentFlags().StringVar(&raw.deleteSourceAfter, "delete-source-after", "never", "Specifies whether to delete each source file or blob once it has been transferred, for moving rather than copying data. "+
+		"Available options: never, verified. Verified is only supported when downloading, and a source is deleted only after its transfer succeeded and both the length and the MD5 hash of the destination were checked against it, "+
+		"and only if it has not been modified since. Sources without a stored MD5 hash are kept. A reconciliation of the deleted and kept sources is reported at the end of the job.")
+	cpCmd.PersistentFlags().StringVar(&raw.assertSourceUnchanged, "assert-source-unchanged", "none", "Record the ETag of each source blob when it is scanned, and check it again once the blob has been transferred, "+
+		"to prove that the source was static during the copy. Available options: none, file, job. With file, a blob that changed fails its own transfer; with job (the default when the flag is given without a value), the whole job is cancelled too.")
+	cpCmd.PersistentFlags().Lookup("assert-source-unchanged").NoOptDefVal = "job"
+	cpCmd.PersistentFlags().Float64Var(&raw.maxAccountFraction, "max-account-throughput-fraction", 0, "Keep the throughput of the job under this fraction (e.g. 0.5) of the ingress or egress limit of the storage account, "+
+		"so that AzCopy can run continuously next to production traffic. The limit is learnt from the responses that say the account is over its limit, "+
+		"or can be given with AZCOPY_ACCOUNT_THROUGHPUT_LIMIT_MBPS. (default 0, meaning off)")
+	cpCmd.PersistentFlags().Float64Var(&raw.dailyCapGB, "daily-cap-gb", 0, "Stop scheduling new chunks once this many gigabytes have been sent and received on this machine in the calendar day, "+
+		"by this and any other job, and carry on when the next day starts. For metered links. The usage is shown by 'azcopy stats --bandwidth'. (default 0, meaning no cap)")
+	cpCmd.PersistentFlags().StringVar(&raw.autoPartitionSize, "auto-partition-size", "", "Break up a job that has more than this many bytes into sequential sub-jobs, "+
+		"each with its own job ID, plan files and summary, so that failures, resumes and reporting deal with manageable units. Must be "+sizeStringDescription+". "+
+		"Each sub-job runs to completion before the scan carries on into the next one.")
+	cpCmd.PersistentFlags().BoolVar(&raw.enumerateFirst, "enumerate-first", false, "Scan the whole source before transferring anything, so that the totals of the job are accurate from the start. "+
+		"By default, the transfers start as soon as the scan has found the first few thousand files, and the totals grow as the scan goes on. "+
+		"The list of transfers is held in memory until the scan is complete.")
+	cpCmd.PersistentFlags().StringVar(&raw.expectFiles, "expect-files", "", "Fail the job, with a reconciliation report in its summary, unless exactly this many files are found at the source, "+
+		"and all of them are transferred. Skipped files, e.g. ones already at the destination, are reported as not reconciled. Catches sources that were silently only partly listed.")
+	cpCmd.PersistentFlags().StringVar(&raw.expectBytes, "expect-bytes", "", "Fail the job, with a reconciliation report in its summary, unless the files found at the source add up to exactly this many bytes.")
+	cpCmd.PersistentFlags().StringVar(&raw.expectedTotalsFile, "expected-totals-file", "", "With dry-run, save the number of files and bytes that would be copied to this file. "+
+		"Without dry-run, read them back from it and expect them, as with expect-files and expect-bytes, so that a job can be checked against an estimate made before it.")
+	cpCmd.PersistentFlags().BoolVar(&raw.propertiesOnly, "properties-only", false, "Only update the properties (HTTP headers, metadata, access tier and, from blob sources, index tags) of destination blobs, without copying any data. "+
+		"With preserve-permissions, the ACLs are updated too. Each destination must already exist with the same content as its source, otherwise its transfer fails: "+
+		"the sizes must match and then the MD5 hashes, or, when either side has no hash, the source must not have been modified after the destination. "+
+		"Useful for fixing up properties after a big migration. Only available when the destination is Blob storage.")
+	cpCmd.PersistentFlags().BoolVar(&raw.journal, "journal", false, "Record each state change of each transfer, with its time and the ID of the latest request for it, in an append-only journal next to the log of the job. "+
+		"Meant for audits that need evidence of exactly when each object was copied and verified. Use 'azcopy jobs journal' to see or export it.")
+	cpCmd.PersistentFlags().StringVar(&raw.folderCreation, "folder-creation", "lazy", "When to create the directories of the destination (local or Azure Files only). With lazy, each directory is created when the first file in it is transferred, "+
+		"so heavily filtered jobs don't create directories they don't need. With eager, all the directories of each part of the job are created, in parallel, before its files are transferred, "+
+		"so that the files can then be written at full parallelism.")
+	cpCmd.PersistentFlags().StringVar(&raw.ifNoneMatch, "if-none-match", "", "Set to * to make the job write-once: every blob is created on condition that it doesn't already exist, "+
+		"so AzCopy can never overwrite data, e.g. in append-only archive containers, even if a blob appears while the job runs. Blobs that already exist are left as they are, and their transfers fail. "+
+		"When the job is resumed, a page or append blob that an earlier run completed is only recognized as such if it has the length and MD5 hash of the source "+
+		"(so uploads need put-md5). Only available when the destination is Blob storage.")
+	cpCmd.PersistentFlags().StringVar(&raw.maxFileSize, "max-file-size", "", "Content policy: files larger than this violate the policy. Must be "+sizeStringDescription+".")
+	cpCmd.PersistentFlags().StringVar(&raw.allowedExtensions, "allowed-extensions", "", "Content policy: files whose extensions aren't in this list, separated by semicolons, violate the policy, e.g. 'csv;parquet'.")
+	cpCmd.PersistentFlags().StringVar(&raw.blockedExtensions, "blocked-extensions", "", "Content policy: files with these extensions, separated by semicolons, violate the policy, e.g. 'exe;dll;bat'.")
+	cpCmd.PersistentFlags().StringVar(&raw.blockedSignatures, "blocked-signatures", "", "Content policy: files whose content starts with one of these signatures, given in hex and separated by semicolons, violate the policy, "+
+		"e.g. '4D5A;7F454C46' for Windows and Linux executables. Only available when uploading local files.")
+	cpCmd.PersistentFlags().StringVar(&raw.policyViolationAction, "policy-violation-action", "reject", "What happens to files that violate the content policy: with reject, they are not transferred, and are reported as rejected by the policy; "+
+		"with quarantine, they are transferred to the quarantine folder under the destination instead. Either way, the violations are listed separately from errors in the summary of the job.")
+	cpCmd.PersistentFlags().StringVar(&raw.quarantineFolder, "quarantine-folder", "", "The folder, relative to the destination, that policy-violation-action=quarantine and infected-action=quarantine put files in. (default \""+defaultQuarantineFolder+"\")")
+	cpCmd.PersistentFlags().StringVar(&raw.scanCommand, "scan-command", "", "Scan each file for malware before it's uploaded, by streaming it to the standard input of this command, whose arguments are separated by spaces, "+
+		"e.g. 'clamdscan --no-summary -'. Arguments with spaces in them can be quoted as in a shell, e.g. '\"C:\\Program Files\\ClamAV\\clamdscan.exe\" -'. The command must exit with 0 if the file is clean, and with 1 if it's infected, as ClamAV does; anything else fails the transfer. "+
+		"Only files that pass the rest of the content policy are scanned. Only available when uploading local files.")
+	cpCmd.PersistentFlags().StringVar(&raw.infectedAction, "infected-action", "reject", "What happens to files that scan-command finds infected: with reject, they are not transferred, and are reported as skipped because they're infected; "+
+		"with quarantine, they are transferred to the quarantine folder under the destination instead. Either way, they are listed in the summary of the job.")
+	cpCmd.PersistentFlags().StringVar(&raw.manifest, "manifest", "", "When the job completes, write a manifest of the transferred files (path, size and Content-MD5 hash, when known), "+
+		"with the details of the job, to this local JSON file. Recipients of the dataset can use it to check that it's complete and intact, without AzCopy. "+
+		"Files that failed to transfer are listed apart, and the manifest is then marked as incomplete. Each hash says whether it was verified against the data that landed.")
+	cpCmd.PersistentFlags().StringVar(&raw.manifestSigningKey, "manifest-signing-key", "", "Sign the manifest with this key, and write the signature to the manifest path followed by .sig. "+
+		"Either a local PEM file holding an unencrypted RSA or ECDSA private key, or the URL of a Key Vault key (RSA or P-256 EC), which needs the job to be authenticated with azcopy login. "+
+		"The signature (RS256 or ES256, over the SHA-256 of the manifest) can be checked with e.g. openssl dgst -sha256 -verify.")
+	cpCmd.PersistentFlags().StringVar(&raw.partitionBy, "partition-by", "", "Put the files under these partition directories of the destination, in the name=value form that partition discovery "+
+		"in Spark and Synapse expects, e.g. 'year={yyyy}/month={MM}/day={dd}'. The placeholders {yyyy}, {MM}, {dd}, {HH} and {mm} are filled in with the start time of the job, in UTC.")
+	cpCmd.PersistentFlags().BoolVar(&raw.successMarker, "success-marker", false, "When the job completes without any failed transfers, create an empty _SUCCESS file at the root of the destination "+
+		"(under the partition directories, if partition-by is given), so that Spark and Synapse jobs waiting for the output can start reading it.")
+	cpCmd.PersistentFlags().StringVar(&raw.propertyMapping, "property-mapping", "", "When copying between Azure Files and Blob storage, copy properties of the source to other properties of the destination. "+
+		"Rules are source=destination, separated by semicolons, where each property is an HTTP header (content-type, content-encoding, content-disposition, content-language or cache-control) "+
+		"or metadata:<key>. File sources also have smb:creation-time, smb:last-write-time and smb:attributes. "+
+		"E.g. 'smb:last-write-time=metadata:mtime;metadata:mime=content-type'.")
+	cpCmd.PersistentFlags().Uint32Var(&raw.reportSlowestFiles, "report-slowest-files", 0, fmt.Sprintf("List this many of the slowest files, with how long each took, in the summary at the end of the job. At most %d. (default 0)", ste.MaxSlowestTransfersTracked))
 	cpCmd.PersistentFlags().BoolVar(&raw.CheckLength, "check-length", true, "Check the length of a file on the destination after the transfer. If there is a mismatch between source and destination, the transfer is marked as failed.")
 	cpCmd.PersistentFlags().BoolVar(&raw.s2sPreserveProperties, "s2s-preserve-properties", true, "Preserve full properties during service to service copy. "+
 		"For AWS S3 and Azure File non-single file source, the list operation doesn't return full properties of objects and files. To preserve full properties, AzCopy needs to send one additional request per object or file.")
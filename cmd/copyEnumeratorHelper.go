@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/azbfs"
 	"github.com/Azure/azure-storage-azcopy/common"
@@ -20,21 +24,23 @@ func addTransfer(e *common.CopyJobPartOrderRequest, transfer common.CopyTransfer
 	transfer.Source = strings.TrimPrefix(transfer.Source, e.SourceRoot)
 	transfer.Destination = strings.TrimPrefix(transfer.Destination, e.DestinationRoot)
 
+	// once the current sub-job has as many bytes as the user wants in each, it is finished off, and the scan carries on in a new one
+	if cca.autoPartitionSize > 0 && len(e.Transfers) > 0 && cca.subJobBytes+transfer.SourceSize > cca.autoPartitionSize {
+		if err := startNextSubJob(e, cca); err != nil {
+			return err
+		}
+	}
+	cca.subJobBytes += transfer.SourceSize
+
 	// dispatch the transfers once the number reaches NumOfFilesPerDispatchJobPart
 	// we do this so that in the case of large transfer, the transfer engine can get started
 	// while the frontend is still gathering more transfers
 	if len(e.Transfers) == NumOfFilesPerDispatchJobPart {
-		shuffleTransfers(e.Transfers)
-		resp := common.CopyJobPartOrderResponse{}
-
-		Rpc(common.ERpcCmd.CopyJobPartOrder(), (*common.CopyJobPartOrderRequest)(e), &resp)
-
-		if !resp.JobStarted {
-			return fmt.Errorf("copy job part order with JobId %s and part number %d failed because %s", e.JobID, e.PartNum, resp.ErrorMsg)
-		}
-		// if the current part order sent to engine is 0, then start fetching the Job Progress summary.
-		if e.PartNum == 0 {
-			cca.waitUntilJobCompletion(false)
+		if cca.enumerateFirst {
+			// the part is dispatched along with the final one, once the scan is complete
+			cca.heldParts = append(cca.heldParts, *e)
+		} else if err := dispatchPart(e, cca); err != nil {
+			return err
 		}
 		e.Transfers = []common.CopyTransfer{}
 		e.PartNum++
@@ -54,9 +60,36 @@ func shuffleTransfers(transfers []common.CopyTransfer) {
 	rand.Shuffle(len(transfers), func(i, j int) { transfers[i], transfers[j] = transfers[j], transfers[i] })
 }
 
+// dispatchPart sends a part, that is not the final one, to the transfer engine
+func dispatchPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs) error {
+	shuffleTransfers(e.Transfers)
+	resp := common.CopyJobPartOrderResponse{}
+
+	Rpc(common.ERpcCmd.CopyJobPartOrder(), (*common.CopyJobPartOrderRequest)(e), &resp)
+
+	if !resp.JobStarted {
+		return fmt.Errorf("copy job part order with JobId %s and part number %d failed because %s", e.JobID, e.PartNum, resp.ErrorMsg)
+	}
+	// if the current part order sent to engine is 0, then start fetching the Job Progress summary.
+	if e.PartNum == 0 {
+		cca.waitUntilJobCompletion(false)
+	}
+	return nil
+}
+
 // we need to send a last part with isFinalPart set to true, along with whatever transfers that still haven't been sent
 // dispatchFinalPart sends a last part with isFinalPart set to true, along with whatever transfers that still haven't been sent.
 func dispatchFinalPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs) error {
+	// with enumerate-first, the parts that filled up during the scan go first
+	for i := range cca.heldParts {
+		cca.heldParts[i].ScanComplete = true
+		if err := dispatchPart(&cca.heldParts[i], cca); err != nil {
+			return err
+		}
+		cca.heldParts[i].Transfers = nil // they're in the plan files now
+	}
+	cca.heldParts = nil
+
 	shuffleTransfers(e.Transfers)
 	e.IsFinalPart = true
 	var resp common.CopyJobPartOrderResponse
@@ -73,8 +106,10 @@ func dispatchFinalPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs
 		return fmt.Errorf("copy job part order with JobId %s and part number %d failed because %s", e.JobID, e.PartNum, resp.ErrorMsg)
 	}
 
-	// set the flag on cca, to indicate the enumeration is done
-	cca.isEnumerationComplete = true
+	// set the flag on cca, to indicate the enumeration is done (unless this only finishes off one of its sub-jobs)
+	if atomic.LoadInt32(&cca.atomicSubJobPending) == 0 {
+		cca.isEnumerationComplete = true
+	}
 
 	// if the current part order sent to engine is 0, then start fetching the Job Progress summary.
 	if e.PartNum == 0 {
@@ -83,12 +118,60 @@ func dispatchFinalPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs
 	return nil
 }
 
+// errScanCutShort stops the scan when a sub-job doesn't complete, since the rest of the source shouldn't be transferred after it
+var errScanCutShort = errors.New("the scan was stopped, because a sub-job did not complete")
+
+// subJobLetsScanContinue says whether a sub-job that ended with the given status lets the scan carry on into the next one.
+// One that failed, was cancelled or was paused ends the wait for it too, but stops the scan
+func subJobLetsScanContinue(status common.JobStatus) bool {
+	return status.IsJobDone() && status != common.EJobStatus.Cancelled() && status != common.EJobStatus.Failed()
+}
+
+// startNextSubJob dispatches the final part of the current sub-job, and waits until that sub-job has ended and
+// its summary has been output. If it completed, it then sets up the order for the first part of the next sub-job,
+// which gets a new job ID. Otherwise it returns errScanCutShort
+func startNextSubJob(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs) error {
+	if cca.subJobNumber == 0 {
+		cca.subJobNumber = 1
+	}
+	atomic.StoreInt32(&cca.atomicSubJobPending, 1)
+	if err := dispatchFinalPart(e, cca); err != nil {
+		return err
+	}
+	status := <-cca.subJobDone
+	atomic.StoreInt32(&cca.atomicSubJobPending, 0)
+	if !subJobLetsScanContinue(status) {
+		atomic.StoreInt32(&cca.atomicScanCutShort, 1)
+		return errScanCutShort
+	}
+
+	cca.jobID = common.NewJobID()
+	cca.subJobNumber++
+	cca.subJobBytes = 0
+	e.JobID = cca.jobID
+	e.PartNum = 0
+	e.IsFinalPart = false
+	e.Transfers = []common.CopyTransfer{}
+	glcm.AllowReinitiateProgressReporting()
+	glcm.Info(fmt.Sprintf("Starting sub-job %d with job ID %s, since the previous one reached the auto-partition-size.", cca.subJobNumber, cca.jobID))
+	return nil
+}
+
 var handleSingleFileValidationErrStr = "source is not validated as a single file: %v"
 var infoCopyFromContainerDirectoryListOfFiles = "trying to copy the source as container/directory/list of files"
 var infoCopyFromBucketDirectoryListOfFiles = "trying to copy the source as bucket/folder/list of files"
 var infoCopyFromDirectoryListOfFiles = "trying to copy the source as directory/list of files"
 var infoCopyFromAccount = "trying to copy the source account"
 
+// withClockSkewHint adds an explanation to an authentication failure if the local clock is far enough
+// from the one of the service to be the likely cause
+func withClockSkewHint(errRootCause string, resp *http.Response) string {
+	if hint := common.ClockSkewHint(resp, time.Now()); hint != "" {
+		return errRootCause + ". " + hint
+	}
+	return errRootCause
+}
+
 func handleSingleFileValidationErrorForBlob(err error) (stop bool) {
 	errRootCause := err.Error()
 	stgErr, isStgErr := err.(azblob.StorageError)
@@ -98,6 +181,7 @@ func handleSingleFileValidationErrorForBlob(err error) (stop bool) {
 			stop = true
 		} else if stgErr.ServiceCode() == azblob.ServiceCodeAuthenticationFailed {
 			errRootCause = fmt.Sprintf("%s, please check if SAS or OAuth is used properly, or source is a public blob", stgErr.ServiceCode())
+			errRootCause = withClockSkewHint(errRootCause, stgErr.Response())
 			stop = true
 		} else {
 			errRootCause = string(stgErr.ServiceCode())
@@ -121,6 +205,7 @@ func handleSingleFileValidationErrorForAzureFile(err error) (stop bool) {
 			stop = true
 		} else if stgErr.ServiceCode() == azfile.ServiceCodeAuthenticationFailed {
 			errRootCause = fmt.Sprintf("%s, please check if SAS is set properly", stgErr.ServiceCode())
+			errRootCause = withClockSkewHint(errRootCause, stgErr.Response())
 			stop = true
 		} else {
 			errRootCause = string(stgErr.ServiceCode())
@@ -144,6 +229,7 @@ func handleSingleFileValidationErrorForADLSGen2(err error) (stop bool) {
 			stop = true
 		} else if stgErr.ServiceCode() == azbfs.ServiceCodeAuthenticationFailed {
 			errRootCause = fmt.Sprintf("%s, please check if AccessKey or OAuth is used properly", stgErr.ServiceCode())
+			errRootCause = withClockSkewHint(errRootCause, stgErr.Response())
 			stop = true
 		} else {
 			errRootCause = string(stgErr.ServiceCode())
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/azure-storage-file-go/azfile"
 
@@ -42,12 +44,27 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 
 	if srcCredInfo, isPublic, err = getCredentialInfoForLocation(ctx, cca.fromTo.From(), cca.source, cca.sourceSAS, true); err != nil {
 		return nil, err
+	} else if err = switchCredentialToCloud(&srcCredInfo, cca.sourceCloud); err != nil {
+		return nil, err
+		// If S2S from blob and the source takes OAuthToken as its cred type, the service can't use our token to read the source,
+		// so authorize it with a user delegation SAS instead
+	} else if cca.fromTo.From() == common.ELocation.Blob() && cca.fromTo.To().IsRemote() &&
+		srcCredInfo.CredentialType == common.ECredentialType.OAuthToken() && cca.sourceSAS == "" {
+		if cca.sourceSAS, err = getUserDelegationSAS(ctx, cca.source, srcCredInfo); err != nil {
+			return nil, err
+		}
+		glcm.Info("The source is authorized with a user delegation SAS generated from the current login. It is valid for 7 days, and a new one is generated if the job is resumed.")
+		jobPartOrder.SourceSAS = cca.sourceSAS
+		jobPartOrder.SourceSASFromLogin = true
+		srcCredInfo = common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}
+		if src, err = appendSASIfNecessary(cca.source, cca.sourceSAS); err != nil {
+			return nil, err
+		}
 		// If S2S and source takes OAuthToken as its cred type (OR) source takes anonymous as its cred type, but it's not public and there's no SAS
 	} else if cca.fromTo.From().IsRemote() && cca.fromTo.To().IsRemote() &&
 		(srcCredInfo.CredentialType == common.ECredentialType.OAuthToken() ||
 			(srcCredInfo.CredentialType == common.ECredentialType.Anonymous() && !isPublic && cca.sourceSAS == "")) {
-		// TODO: Generate a SAS token if it's blob -> *
-		return nil, errors.New("a SAS token (or S3 access key) is required as a part of the source in S2S transfers, unless the source is a public resource")
+		return nil, errors.New("a SAS token (or S3 access key) is required as a part of the source in S2S transfers, unless the source is a public blob resource or you are logged in to the blob source")
 	}
 
 	// Infer on download so that we get LMT and MD5 on files download
@@ -60,14 +77,80 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	jobPartOrder.S2SGetPropertiesInBackend = cca.s2sPreserveProperties && !getRemoteProperties && cca.s2sGetPropertiesInBackend // Infer GetProperties if GetPropertiesInBackend is enabled.
 	jobPartOrder.S2SSourceChangeValidation = cca.s2sSourceChangeValidation
 	jobPartOrder.DestLengthValidation = cca.CheckLength
+	jobPartOrder.AllowSecondaryRead = cca.allowSecondaryRead
+	jobPartOrder.SourceChangePolicy = cca.sourceChangePolicy
+	jobPartOrder.MaxWriteLatencyMilliseconds = cca.maxWriteLatencyMs
+	jobPartOrder.FileTimeBudgetSecondsPerGB = cca.fileTimeBudgetPerGB
+	jobPartOrder.DeleteSourceAfter = cca.deleteSourceAfter
+	jobPartOrder.AssertSourceUnchanged = cca.assertSourceUnchanged
+	jobPartOrder.MaxAccountThroughputFraction = cca.maxAccountFraction
+	jobPartOrder.DailyCapBytes = cca.dailyCapBytes
+	jobPartOrder.PropertiesOnly = cca.propertiesOnly
+	jobPartOrder.JournalTransitions = cca.journal
+	jobPartOrder.FolderCreation = cca.folderCreation
+	jobPartOrder.WriteOnce = cca.writeOnce
+	jobPartOrder.PreservePermissions = cca.preservePermissions
+	jobPartOrder.PreservePosixProperties = cca.preservePosixProperties
+	jobPartOrder.ContentPolicy = cca.contentPolicy
+	jobPartOrder.ManifestPath = cca.manifest
+	jobPartOrder.ManifestSigningKey = cca.manifestSigningKey
+	jobPartOrder.PropertyMapping = cca.propertyMapping
+	if cca.successMarker {
+		jobPartOrder.SuccessMarker = cca.escapedLayoutPath(path.Join(cca.partitionPrefix, successMarkerName))
+	}
 	jobPartOrder.S2SInvalidMetadataHandleOption = cca.s2sInvalidMetadataHandleOption
 
-	traverser, err = initResourceTraverser(src, cca.fromTo.From(), &ctx, &srcCredInfo, &cca.followSymlinks, cca.listOfFilesChannel, cca.recursive, getRemoteProperties, func() {})
+	if cca.inventoryReport != "" {
+		var srcURL *url.URL
+		if srcURL, err = url.Parse(src); err != nil {
+			return nil, err
+		}
+		var p pipeline.Pipeline
+		if p, err = initListingPipeline(ctx, common.ELocation.Blob(), srcCredInfo); err != nil {
+			return nil, err
+		}
+		traverser = newBlobInventoryTraverser(srcURL, p, ctx, cca.inventoryReport, cca.recursive, func() {})
+	} else if cca.urlList != "" {
+		var p pipeline.Pipeline
+		if p, err = initListingPipeline(ctx, common.ELocation.Http(), common.CredentialInfo{}); err != nil {
+			return nil, err
+		}
+		jobHeaders := common.ResourceHTTPHeaders{ContentType: cca.contentType, ContentEncoding: cca.contentEncoding, ContentLanguage: cca.contentLanguage,
+			ContentDisposition: cca.contentDisposition, CacheControl: cca.cacheControl}
+		// the traverser settles the headers and metadata of each file, since those on its line of the list take precedence over the job's
+		jobPartOrder.BlobAttributes.ContentType = ""
+		jobPartOrder.BlobAttributes.ContentEncoding = ""
+		jobPartOrder.BlobAttributes.ContentLanguage = ""
+		jobPartOrder.BlobAttributes.ContentDisposition = ""
+		jobPartOrder.BlobAttributes.CacheControl = ""
+		jobPartOrder.BlobAttributes.Metadata = ""
+
+		cca.unreadableSources = &unreadableSources{}
+		traverser = newURLListTraverser(cca.urlList, p, ctx, jobHeaders, parseJobMetadata(cca.metadata), func() {}, func(entry urlListEntry, err error) {
+			source := common.URLStringExtension(entry.source.String()).RedactSecretQueryParamForLogging()
+			cca.unreadableSources.add(source, common.GenerateFullPath(jobPartOrder.DestinationRoot, entry.name))
+			if ste.JobsAdmin != nil {
+				ste.JobsAdmin.LogToJobLog(fmt.Sprintf("Cannot copy %s, on line %d of the URL list, since it couldn't be read: %v", source, entry.lineNumber, err))
+			}
+		})
+	} else {
+		traverser, err = initResourceTraverser(src, cca.fromTo.From(), &ctx, &srcCredInfo, &cca.followSymlinks, cca.listOfFilesChannel, cca.recursive, getRemoteProperties, func() {})
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	limitTraverserDepth(traverser, cca.maxDepth)
+
+	if cca.pinSourceVersions {
+		blobTraverser, ok := traverser.(*blobTraverser)
+		if !ok {
+			return nil, errors.New("pin-source-versions is only supported when the source is a container, a virtual directory or a blob")
+		}
+		blobTraverser.pinVersions = true
+	}
+
 	// Ensure we're only copying from a directory with a trailing wildcard or recursive.
 	isSourceDir := traverser.isDirectory(true)
 	if isSourceDir && !cca.recursive && !cca.stripTopDir {
@@ -196,6 +279,13 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	}
 
 	filters := cca.initModularFilters()
+
+	var dryRun *dryRunRecorder
+	if cca.dryRun {
+		dryRun = newDryRunRecorder("copy", cca.fromTo, azcopyOutputFormat)
+		dryRun.totalsFile = cca.expectedTotalsFile
+	}
+
 	processor := func(object storedObject) error {
 		// Start by resolving the name and creating the container
 		if object.containerName != "" {
@@ -228,7 +318,30 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 		}
 
 		srcRelPath := cca.makeEscapedRelativePath(true, isDestDir, object)
+		if object.sourceURL != "" {
+			srcRelPath = object.sourceURL // the source root is empty, since the sources don't share one
+		}
 		dstRelPath := cca.makeEscapedRelativePath(false, isDestDir, object)
+		if cca.partitionPrefix != "" || cca.successMarker {
+			// the layout is made of directories of the destination, so a destination that is a single file can't have one
+			if dstRelPath == "" {
+				return errors.New("partition-by and success-marker need the destination to be a container or a directory")
+			}
+			if cca.partitionPrefix != "" {
+				dstRelPath = cca.escapedLayoutPath(cca.partitionPrefix) + dstRelPath
+			}
+		}
+
+		if cca.convertToVHD {
+			// the destination receives the fixed VHD, so that is the size that the engine must expect
+			size, converted, err := ste.ConvertedVHDSize(common.GenerateFullPath(jobPartOrder.SourceRoot, srcRelPath))
+			if err != nil {
+				return err
+			}
+			if converted {
+				object.size = size
+			}
+		}
 
 		transfer := common.NewCopyTransfer(
 			cca.autoDecompress && cca.fromTo.IsDownload(),
@@ -244,10 +357,19 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 		if cca.s2sPreserveAccessTier {
 			transfer.BlobTier = object.blobAccessTier
 		}
+		transfer.VersionID = object.versionID
+		transfer.ETag = string(object.eTag) // only blob sources have one
 
+		if dryRun != nil {
+			return dryRun.record(common.GenerateFullPath(jobPartOrder.SourceRoot, srcRelPath),
+				common.GenerateFullPath(jobPartOrder.DestinationRoot, dstRelPath), transfer.SourceSize)
+		}
 		return addTransfer(&jobPartOrder, transfer, cca)
 	}
 	finalizer := func() error {
+		if dryRun != nil {
+			return dryRun.finish()
+		}
 		return dispatchFinalPart(&jobPartOrder, cca)
 	}
 
@@ -267,6 +389,9 @@ func (cca *cookedCopyCmdArgs) isDestDirectory(dst string, ctx *context.Context)
 	if dstCredInfo, _, err = getCredentialInfoForLocation(*ctx, cca.fromTo.To(), cca.destination, cca.destinationSAS, true); err != nil {
 		return false
 	}
+	if err = switchCredentialToCloud(&dstCredInfo, cca.destinationCloud); err != nil {
+		return false
+	}
 
 	rt, err := initResourceTraverser(dst, cca.fromTo.To(), ctx, &dstCredInfo, nil, nil, false, false, func() {})
 
@@ -310,6 +435,10 @@ func (cca *cookedCopyCmdArgs) initModularFilters() []objectFilter {
 		filters = append(filters, &excludeBlobTypeFilter{blobTypes: excludeSet})
 	}
 
+	filters = append(filters, buildIncludeBlobPropertyFilters(cca.includeBlobType, cca.includeContentTypes)...)
+	filters = append(filters, buildMaxDepthFilters(cca.maxDepth)...)
+	filters = append(filters, buildConventionalExcludeFilters(cca.excludeHidden, cca.ignoreMatcher)...)
+
 	if len(cca.includeFileAttributes) != 0 {
 		filters = append(filters, buildAttrFilters(cca.includeFileAttributes, cca.source, true)...)
 	}
@@ -318,12 +447,15 @@ func (cca *cookedCopyCmdArgs) initModularFilters() []objectFilter {
 		filters = append(filters, buildAttrFilters(cca.excludeFileAttributes, cca.source, false)...)
 	}
 
+	// last, so that the cap of the sample only counts objects that pass all the other filters
+	filters = append(filters, buildSampleFilters(cca.sampleFraction, cca.sampleSeed, cca.sampleMaxBytes)...)
+
 	return filters
 }
 
 func (cca *cookedCopyCmdArgs) createDstContainer(containerName, dstWithSAS string, ctx context.Context, existingContainers map[string]bool) (err error) {
-	if _, ok := existingContainers[containerName]; ok {
-		return
+	if _, ok := existingContainers[containerName]; ok || cca.dryRun {
+		return // a dry run makes no changes, so any missing container would only be created by the real copy
 	}
 	existingContainers[containerName] = true
 
@@ -332,6 +464,9 @@ func (cca *cookedCopyCmdArgs) createDstContainer(containerName, dstWithSAS strin
 	if dstCredInfo, _, err = getCredentialInfoForLocation(ctx, cca.fromTo.To(), cca.destination, cca.destinationSAS, false); err != nil {
 		return err
 	}
+	if err = switchCredentialToCloud(&dstCredInfo, cca.destinationCloud); err != nil {
+		return err
+	}
 
 	dstPipeline, err := initPipeline(ctx, cca.fromTo.To(), dstCredInfo)
 	if err != nil {
@@ -446,7 +581,8 @@ func (cca *cookedCopyCmdArgs) makeEscapedRelativePath(source bool, dstIsDir bool
 			}
 		}
 
-		if loc.IsRemote() {
+		// files on web and SFTP servers are given by URL too, so their paths are escaped like those of the remote locations
+		if loc.IsRemote() || loc == common.ELocation.Http() || loc == common.ELocation.Sftp() {
 			for k, p := range pathParts {
 				pathParts[k] = url.PathEscape(p)
 			}
@@ -490,7 +626,7 @@ func (cca *cookedCopyCmdArgs) makeEscapedRelativePath(source bool, dstIsDir bool
 		// Save to a directory
 		rootDir := filepath.Base(cca.source)
 
-		if cca.fromTo.From().IsRemote() {
+		if cca.fromTo.From().IsRemote() || cca.fromTo.From() == common.ELocation.Http() || cca.fromTo.From() == common.ELocation.Sftp() {
 			ueRootDir, err := url.PathUnescape(rootDir)
 
 			// Realistically, err should never not be nil here.
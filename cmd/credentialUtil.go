@@ -28,8 +28,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
@@ -262,7 +264,7 @@ func getCredentialInfoForLocation(ctx context.Context, location common.Location,
 		credInfo.CredentialType = common.ECredentialType.Anonymous()
 	} else if credInfo.CredentialType = GetCredTypeFromEnvVar(); credInfo.CredentialType == common.ECredentialType.Unknown() {
 		switch location {
-		case common.ELocation.Local(), common.ELocation.Benchmark():
+		case common.ELocation.Local(), common.ELocation.Benchmark(), common.ELocation.Http(), common.ELocation.Sftp():
 			credInfo.CredentialType = common.ECredentialType.Anonymous()
 		case common.ELocation.Blob():
 			if credInfo.CredentialType, isPublic, err = getBlobCredentialType(ctx, resource, isSource, resourceSAS != ""); err != nil {
@@ -277,12 +279,12 @@ func getCredentialInfoForLocation(ctx context.Context, location common.Location,
 				return common.CredentialInfo{}, false, err
 			}
 		case common.ELocation.S3():
-			accessKeyID := glcm.GetEnvironmentVariable(common.EEnvironmentVariable.AWSAccessKeyID())
-			secretAccessKey := glcm.GetEnvironmentVariable(common.EEnvironmentVariable.AWSSecretAccessKey())
-			if accessKeyID == "" || secretAccessKey == "" {
-				return common.CredentialInfo{}, false, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must be set before creating the S3 AccessKey credential")
-			}
+			// the access key (with a session token, for temporary keys) or else the role of the ECS task or EC2 instance profile,
+			// checked now so that missing credentials are reported before anything is scanned
 			credInfo.CredentialType = common.ECredentialType.S3AccessKey()
+			if _, err = common.CreateS3Credential(ctx, credInfo, common.CredentialOpOptions{}); err != nil {
+				return common.CredentialInfo{}, false, err
+			}
 		}
 	}
 
@@ -299,6 +301,122 @@ func getCredentialInfoForLocation(ctx context.Context, location common.Location,
 	return
 }
 
+// switchCredentialToCloud re-acquires the OAuth token for the Azure AD authority of the given cloud (if one was given),
+// so that each side of a copy can be in a different cloud
+func switchCredentialToCloud(credInfo *common.CredentialInfo, cloud common.AzureCloud) error {
+	if credInfo.CredentialType != common.ECredentialType.OAuthToken() || cloud.IsEmpty() || cloud.ActiveDirectoryEndpoint == "" {
+		return nil
+	}
+
+	tokenInfo, err := credInfo.OAuthTokenInfo.ForAuthority(cloud.ActiveDirectoryEndpoint)
+	if err != nil {
+		return err
+	}
+	credInfo.OAuthTokenInfo = *tokenInfo
+	return nil
+}
+
+// a user delegation key can't be valid for longer than 7 days
+const userDelegationSASValidity = 7 * 24 * time.Hour
+
+// getUserDelegationSAS mints a read and list SAS for the container of a blob source, signed with a user delegation key
+// obtained with the OAuth credential. This lets S2S copies read from sources where only OAuth is allowed,
+// since the service reads the source with the SAS rather than with our token.
+func getUserDelegationSAS(ctx context.Context, blobResource string, credInfo common.CredentialInfo) (string, error) {
+	resourceURL, err := url.Parse(blobResource)
+	if err != nil {
+		return "", err
+	}
+	blobURLParts := azblob.NewBlobURLParts(*resourceURL)
+	if blobURLParts.ContainerName == "" {
+		return "", errors.New("a SAS for the source can only be generated from an OAuth login when the source is a container, directory or blob, not a whole account")
+	}
+
+	p, err := createBlobPipeline(ctx, credInfo)
+	if err != nil {
+		return "", err
+	}
+	serviceURL := azblob.NewServiceURL(url.URL{Scheme: resourceURL.Scheme, Host: resourceURL.Host}, p)
+
+	// start a little in the past, in case the clock of the service is behind ours.
+	// If asked to, allow for a bigger difference, by measuring it first
+	start := time.Now().UTC().Add(-5 * time.Minute)
+	if tolerate, _ := strconv.ParseBool(glcm.GetEnvironmentVariable(common.EEnvironmentVariable.TolerateClockSkew())); tolerate {
+		skew := measureClockSkew(ctx, serviceURL.NewContainerURL(blobURLParts.ContainerName))
+		if common.IsSignificantClockSkew(skew) {
+			glcm.Info(fmt.Sprintf("The local clock is %s the clock of the storage service. The times of the SAS for the source have been adjusted for that.", common.DescribeClockSkew(skew)))
+		}
+		start = start.Add(-skew)
+	}
+	expiry := start.Add(userDelegationSASValidity)
+	udc, err := serviceURL.GetUserDelegationCredential(ctx, azblob.NewKeyInfo(start, expiry), nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot get a user delegation key to authorize the source: %s", err.Error())
+	}
+
+	sasQueryParams, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPS,
+		StartTime:     start,
+		ExpiryTime:    expiry,
+		ContainerName: blobURLParts.ContainerName,
+		Permissions:   azblob.ContainerSASPermissions{Read: true, List: true}.String(),
+	}.NewSASQueryParameters(udc)
+	if err != nil {
+		return "", err
+	}
+	return sasQueryParams.Encode(), nil
+}
+
+// measureClockSkew returns how far the local clock is ahead of the clock of the service, judging by the Date header
+// of a request to the container. Any response will do for that, even a failed one, so errors are ignored
+func measureClockSkew(ctx context.Context, containerURL azblob.ContainerURL) time.Duration {
+	var resp *http.Response
+	props, err := containerURL.GetProperties(ctx, azblob.LeaseAccessConditions{})
+	if err == nil {
+		resp = props.Response()
+	} else if stgErr, ok := err.(azblob.StorageError); ok {
+		resp = stgErr.Response()
+	}
+
+	skew, ok := common.ClockSkew(resp, time.Now())
+	if !ok {
+		return 0
+	}
+	return skew
+}
+
+// getUserDelegationSASFromLogin mints a user delegation SAS for a blob source with the current OAuth login, such as
+// when resuming a job whose source was authorized that way, since the SAS itself is never saved
+func getUserDelegationSASFromLogin(ctx context.Context, blobResource string) (string, error) {
+	tokenInfo, err := GetUserOAuthTokenManagerInstance().GetTokenInfo(ctx)
+	if err != nil {
+		return "", fmt.Errorf("the source is authorized with a SAS generated from an OAuth login, so you must be logged in, or give the source SAS: %v", err)
+	}
+	return getUserDelegationSAS(ctx, blobResource, common.CredentialInfo{CredentialType: common.ECredentialType.OAuthToken(), OAuthTokenInfo: *tokenInfo})
+}
+
+// validateResourceCloud checks that a remote resource is in the cloud the user said it is in
+func validateResourceCloud(resource string, location common.Location, cloud common.AzureCloud, flagName string) error {
+	if cloud.IsEmpty() {
+		return nil
+	}
+
+	switch location {
+	case common.ELocation.Blob(), common.ELocation.File(), common.ELocation.BlobFS():
+		resourceURL, err := url.Parse(resource)
+		if err != nil {
+			return err
+		}
+		if !cloud.HostBelongs(resourceURL.Host) {
+			return fmt.Errorf("%s is %s, but %s is not an endpoint of that cloud (expected a host ending with %s)",
+				flagName, cloud.Name, resourceURL.Host, cloud.StorageSuffix)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s can only be used with Azure Storage resources", flagName)
+	}
+}
+
 // getCredentialType checks user provided info, and gets the proper credential type
 // for current command.
 // kept around for legacy compatibility at the moment
@@ -315,7 +433,7 @@ func getCredentialType(ctx context.Context, raw rawFromToInfo) (credentialType c
 		// For blob/file to blob copy, calculate credential type for destination (currently only support StageBlockFromURL)
 		// If the traditional approach(download+upload) need be supported, credential type should be calculated for both src and dest.
 		fallthrough
-	case common.EFromTo.LocalBlob(), common.EFromTo.PipeBlob(), common.EFromTo.BenchmarkBlob():
+	case common.EFromTo.LocalBlob(), common.EFromTo.PipeBlob(), common.EFromTo.BenchmarkBlob(), common.EFromTo.HttpBlob(), common.EFromTo.SftpBlob():
 		if credentialType, _, err = getBlobCredentialType(ctx, raw.destination, false, raw.destinationSAS != ""); err != nil {
 			return common.ECredentialType.Unknown(), err
 		}
@@ -328,7 +446,7 @@ func getCredentialType(ctx context.Context, raw rawFromToInfo) (credentialType c
 		if credentialType, err = getBlobFSCredentialType(ctx, raw.source, raw.sourceSAS != ""); err != nil {
 			return common.ECredentialType.Unknown(), err
 		}
-	case common.EFromTo.BlobLocal(), common.EFromTo.BlobPipe():
+	case common.EFromTo.BlobLocal(), common.EFromTo.BlobPipe(), common.EFromTo.BlobSftp():
 		if credentialType, _, err = getBlobCredentialType(ctx, raw.source, true, raw.sourceSAS != ""); err != nil {
 			return common.ECredentialType.Unknown(), err
 		}
@@ -345,6 +463,9 @@ func getCredentialType(ctx context.Context, raw rawFromToInfo) (credentialType c
 		if credentialType, err = getAzureFileCredentialType(); err != nil {
 			return common.ECredentialType.Unknown(), err
 		}
+	case common.EFromTo.LocalLocal():
+		// no service is involved, so there is nothing to authenticate to
+		credentialType = common.ECredentialType.Anonymous()
 	default:
 		credentialType = common.ECredentialType.Anonymous()
 		// Log the FromTo types which getCredentialType hasn't solved, in case of miss-use.
@@ -357,7 +478,58 @@ func getCredentialType(ctx context.Context, raw rawFromToInfo) (credentialType c
 // ==============================================================================================
 // pipeline factory methods
 // ==============================================================================================
+
+// frontEndRetryOptions returns the retry settings of the front end pipelines, which are the same as those of transfers
+func frontEndRetryOptions() ste.XferRetryOptions {
+	return ste.XferRetryOptions{
+		Policy:        0,
+		MaxTries:      ste.UploadMaxTries,
+		TryTimeout:    ste.UploadTryTimeout,
+		RetryDelay:    ste.UploadRetryDelay,
+		MaxRetryDelay: ste.UploadMaxRetryDelay,
+	}
+}
+
+// getListingRetryOptions returns the retry settings of the pipelines that list the source and the destination.
+// They default to those of the other front end pipelines, but can be set separately (with AZCOPY_LIST_*), so that one flaky listing
+// doesn't have to stall the scan for as long as a transfer would wait. The other requests, such as deletes, keep the usual retries.
+func getListingRetryOptions() (ste.XferRetryOptions, error) {
+	options := frontEndRetryOptions()
+
+	if raw := glcm.GetEnvironmentVariable(common.EEnvironmentVariable.ListMaxTries()); raw != "" {
+		maxTries, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || maxTries <= 0 {
+			return options, fmt.Errorf("invalid %s: %s", common.EEnvironmentVariable.ListMaxTries().Name, raw)
+		}
+		options.MaxTries = int32(maxTries)
+	}
+	for _, setting := range []struct {
+		env   common.EnvironmentVariable
+		value *time.Duration
+	}{
+		{common.EEnvironmentVariable.ListTryTimeout(), &options.TryTimeout},
+		{common.EEnvironmentVariable.ListMaxRetryDelay(), &options.MaxRetryDelay},
+	} {
+		if raw := glcm.GetEnvironmentVariable(setting.env); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return options, fmt.Errorf("invalid %s: %s", setting.env.Name, raw)
+			}
+			*setting.value = d
+		}
+	}
+	if options.RetryDelay > options.MaxRetryDelay {
+		options.RetryDelay = options.MaxRetryDelay
+	}
+
+	return options, nil
+}
+
 func createBlobPipeline(ctx context.Context, credInfo common.CredentialInfo) (pipeline.Pipeline, error) {
+	return createBlobPipelineWithRetries(ctx, credInfo, frontEndRetryOptions())
+}
+
+func createBlobPipelineWithRetries(ctx context.Context, credInfo common.CredentialInfo, retryOptions ste.XferRetryOptions) (pipeline.Pipeline, error) {
 	credential := common.CreateBlobCredential(ctx, credInfo, common.CredentialOpOptions{
 		//LogInfo:  glcm.Info, //Comment out for debugging
 		LogError: glcm.Info,
@@ -370,13 +542,7 @@ func createBlobPipeline(ctx context.Context, credInfo common.CredentialInfo) (pi
 				Value: common.UserAgent,
 			},
 		},
-		ste.XferRetryOptions{
-			Policy:        0,
-			MaxTries:      ste.UploadMaxTries,
-			TryTimeout:    ste.UploadTryTimeout,
-			RetryDelay:    ste.UploadRetryDelay,
-			MaxRetryDelay: ste.UploadMaxRetryDelay,
-		},
+		retryOptions,
 		nil,
 		ste.NewAzcopyHTTPClient(frontEndMaxIdleConnectionsPerHost),
 		nil, // we don't gather network stats on the credential pipeline
@@ -385,7 +551,26 @@ func createBlobPipeline(ctx context.Context, credInfo common.CredentialInfo) (pi
 
 const frontEndMaxIdleConnectionsPerHost = http.DefaultMaxIdleConnsPerHost
 
+// createHTTPSourcePipeline creates the pipeline to read the properties of a file on any HTTP(S) server.
+// It needs no credential, since any credential the server needs must already be in the URL
+func createHTTPSourcePipeline(retryOptions ste.XferRetryOptions) (pipeline.Pipeline, error) {
+	return ste.NewHTTPSourcePipeline(
+		azblob.PipelineOptions{
+			Telemetry: azblob.TelemetryOptions{
+				Value: common.UserAgent,
+			},
+		},
+		retryOptions,
+		ste.NewAzcopyHTTPClient(frontEndMaxIdleConnectionsPerHost),
+		nil, // we don't gather network stats on the front end
+	), nil
+}
+
 func createBlobFSPipeline(ctx context.Context, credInfo common.CredentialInfo) (pipeline.Pipeline, error) {
+	return createBlobFSPipelineWithRetries(ctx, credInfo, frontEndRetryOptions())
+}
+
+func createBlobFSPipelineWithRetries(ctx context.Context, credInfo common.CredentialInfo, retryOptions ste.XferRetryOptions) (pipeline.Pipeline, error) {
 	credential := common.CreateBlobFSCredential(ctx, credInfo, common.CredentialOpOptions{
 		//LogInfo:  glcm.Info, //Comment out for debugging
 		LogError: glcm.Info,
@@ -396,10 +581,10 @@ func createBlobFSPipeline(ctx context.Context, credInfo common.CredentialInfo) (
 		azbfs.PipelineOptions{
 			Retry: azbfs.RetryOptions{
 				Policy:        azbfs.RetryPolicyExponential,
-				MaxTries:      ste.UploadMaxTries,
-				TryTimeout:    ste.UploadTryTimeout,
-				RetryDelay:    ste.UploadRetryDelay,
-				MaxRetryDelay: ste.UploadMaxRetryDelay,
+				MaxTries:      retryOptions.MaxTries,
+				TryTimeout:    retryOptions.TryTimeout,
+				RetryDelay:    retryOptions.RetryDelay,
+				MaxRetryDelay: retryOptions.MaxRetryDelay,
 			},
 			Telemetry: azbfs.TelemetryOptions{
 				Value: common.UserAgent,
@@ -409,15 +594,19 @@ func createBlobFSPipeline(ctx context.Context, credInfo common.CredentialInfo) (
 
 // TODO note: ctx and credInfo are ignored at the moment because we only support SAS for Azure File
 func createFilePipeline(ctx context.Context, credInfo common.CredentialInfo) (pipeline.Pipeline, error) {
+	return createFilePipelineWithRetries(ctx, credInfo, frontEndRetryOptions())
+}
+
+func createFilePipelineWithRetries(ctx context.Context, credInfo common.CredentialInfo, retryOptions ste.XferRetryOptions) (pipeline.Pipeline, error) {
 	return azfile.NewPipeline(
 		azfile.NewAnonymousCredential(),
 		azfile.PipelineOptions{
 			Retry: azfile.RetryOptions{
 				Policy:        azfile.RetryPolicyExponential,
-				MaxTries:      ste.UploadMaxTries,
-				TryTimeout:    ste.UploadTryTimeout,
-				RetryDelay:    ste.UploadRetryDelay,
-				MaxRetryDelay: ste.UploadMaxRetryDelay,
+				MaxTries:      retryOptions.MaxTries,
+				TryTimeout:    retryOptions.TryTimeout,
+				RetryDelay:    retryOptions.RetryDelay,
+				MaxRetryDelay: retryOptions.MaxRetryDelay,
 			},
 			Telemetry: azfile.TelemetryOptions{
 				Value: common.UserAgent,
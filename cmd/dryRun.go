@@ -0,0 +1,108 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// dryRunTransfer is a transfer that a dry run found it would schedule
+type dryRunTransfer struct {
+	Source      string
+	Destination string `json:",omitempty"`
+	Size        int64
+}
+
+// dryRunRecorder takes the place of the transfer processor in a dry run of copy or remove, so that the enumeration
+// and filtering are exactly those of the real command, but nothing is sent to the transfer engine.
+// With text output, each transfer is printed as it is found, since listings of millions of files are too big to hold;
+// with JSON output, they are collected and output together with the totals at the end
+type dryRunRecorder struct {
+	Operation      string
+	FromTo         string
+	Transfers      []dryRunTransfer `json:",omitempty"`
+	TotalTransfers uint64
+	TotalBytes     uint64
+
+	lock    sync.Mutex
+	collect bool
+	// where to save the totals, for a later run to expect them
+	totalsFile string
+}
+
+func newDryRunRecorder(operation string, fromTo common.FromTo, format common.OutputFormat) *dryRunRecorder {
+	return &dryRunRecorder{
+		Operation: operation,
+		FromTo:    fromTo.String(),
+		collect:   format == common.EOutputFormat.Json(),
+	}
+}
+
+// record notes a transfer from source to destination, which is empty for removals
+func (r *dryRunRecorder) record(source, destination string, size int64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.TotalTransfers++
+	r.TotalBytes += uint64(size)
+	if r.collect {
+		r.Transfers = append(r.Transfers, dryRunTransfer{Source: source, Destination: destination, Size: size})
+		return nil
+	}
+
+	if destination == "" {
+		glcm.Info(fmt.Sprintf("Would %s %s (%s)", r.Operation, source, byteSizeToString(size)))
+	} else {
+		glcm.Info(fmt.Sprintf("Would %s %s to %s (%s)", r.Operation, source, destination, byteSizeToString(size)))
+	}
+	return nil
+}
+
+// finish outputs the totals, and exits
+func (r *dryRunRecorder) finish() error {
+	if r.totalsFile != "" {
+		if err := saveExpectedTotals(r.totalsFile, r.TotalTransfers, r.TotalBytes); err != nil {
+			return err
+		}
+	}
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			jsonOutput, err := json.Marshal(r)
+			common.PanicIfErr(err)
+			return string(jsonOutput)
+		}
+		return r.summary()
+	}, common.EExitCode.Success())
+	return nil
+}
+
+func (r *dryRunRecorder) summary() string {
+	if r.Operation == "remove" {
+		return fmt.Sprintf("Dry run: %d files (%s) would be removed. Nothing was deleted.",
+			r.TotalTransfers, byteSizeToString(int64(r.TotalBytes)))
+	}
+	return fmt.Sprintf("Dry run: %d files (%s) would be copied. Nothing was transferred.",
+		r.TotalTransfers, byteSizeToString(int64(r.TotalBytes)))
+}
@@ -0,0 +1,188 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const defaultGeneratedFileSize = "1M"
+
+// represents the raw generate command input from the user
+type rawGenerateCmdArgs struct {
+	// no src, since it's implicitly the auto-data-generator that's also used for benchmarking
+	dst string
+
+	// parameters controlling the auto-generated data
+	fileCount         uint
+	sizePerFile       string
+	sizeDistribution  string
+	filesPerDirectory uint
+	content           string
+
+	// options from flags
+	blockSizeMB  float64
+	putMd5       bool
+	blobType     string
+	logVerbosity string
+}
+
+// raw generate args cook into copyArgs, because the actual work of generating data is doing a copy,
+// from the same source as the bench command
+func (raw rawGenerateCmdArgs) cook() (cookedCopyCmdArgs, error) {
+	dummyCooked := cookedCopyCmdArgs{}
+
+	if raw.fileCount <= 0 {
+		return dummyCooked, errors.New(common.FileCountParam + " must be greater than zero")
+	}
+
+	spec := syntheticDataSpec{fileCount: raw.fileCount, filesPerDirectory: raw.filesPerDirectory}
+	var err error
+	if raw.sizeDistribution != "" {
+		if raw.sizePerFile != "" {
+			return dummyCooked, errors.New(common.SizePerFileParam + " and size-distribution cannot both be given")
+		}
+		if spec.sizeDistribution, err = parseSizeDistribution(raw.sizeDistribution); err != nil {
+			return dummyCooked, err
+		}
+	} else {
+		sizePerFile := raw.sizePerFile
+		if sizePerFile == "" {
+			sizePerFile = defaultGeneratedFileSize
+		}
+		if spec.bytesPerFile, err = parseSizeString(sizePerFile, common.SizePerFileParam); err != nil {
+			return dummyCooked, err
+		}
+		if spec.bytesPerFile > maxBytesPerFile {
+			return dummyCooked, errors.New("file size too big")
+		}
+	}
+
+	switch strings.ToLower(raw.content) {
+	case "random":
+	case "compressible":
+		spec.compressible = true
+	default:
+		return dummyCooked, fmt.Errorf("invalid content %q. Use random or compressible", raw.content)
+	}
+
+	if inferArgumentLocation(raw.dst) != common.ELocation.Blob() {
+		return dummyCooked, errors.New("the current version of the generate command only supports Blob Storage. Support for other destinations may follow in a future release")
+	}
+
+	// transcribe everything to copy args
+	c := rawCopyCmdArgs{}
+	c.setMandatoryDefaults()
+
+	c.src = benchmarkSourceHelper{}.ToUrl(spec)
+	c.dst = raw.dst
+	c.recursive = true                   // because source is directory-like, in which case recursive is required
+	c.internalOverrideStripTopDir = true // we don't want to append an extra strange name filled with meta characters at the destination
+
+	c.blockSizeMB = raw.blockSizeMB
+	c.putMd5 = raw.putMd5
+	c.blobType = raw.blobType
+	c.logVerbosity = raw.logVerbosity
+
+	return c.cook()
+}
+
+// parseSizeDistribution parses sizes with weights, e.g. 4K:70,1M:25,100M:5
+func parseSizeDistribution(raw string) ([]weightedSize, error) {
+	message := fmt.Sprintf("invalid size-distribution %q. It must be sizes with weights, separated by commas, e.g. 4K:70,1M:25,100M:5, "+
+		"where each size is "+sizeStringDescription, raw)
+
+	sizes := make([]weightedSize, 0)
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, errors.New(message)
+		}
+		bytes, err := parseSizeString(parts[0], "each size of size-distribution")
+		if err != nil {
+			return nil, err
+		}
+		if bytes > maxBytesPerFile {
+			return nil, errors.New("file size too big")
+		}
+		weight, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil || weight == 0 {
+			return nil, errors.New(message)
+		}
+		sizes = append(sizes, weightedSize{bytes: bytes, weight: uint(weight)})
+	}
+	return sizes, nil
+}
+
+func init() {
+	raw := rawGenerateCmdArgs{}
+
+	generateCmd := &cobra.Command{
+		Use:     "generate [destination]",
+		Aliases: []string{"gen"},
+		Short:   generateCmdShortDescription,
+		Long:    generateCmdLongDescription,
+		Example: generateCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("wrong number of arguments, please refer to the help page on usage of this command")
+			}
+			raw.dst = args[0]
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cooked, err := raw.cook() // generate args cook into copy args
+			if err != nil {
+				glcm.Error("failed to parse user input due to error: " + err.Error())
+			}
+
+			glcm.Info("Scanning...")
+
+			cooked.commandString = copyHandlerUtil{}.ConstructCommandStringFromArgs()
+			err = cooked.process()
+			if err != nil {
+				glcm.Error("failed to perform generate command due to error: " + err.Error())
+			}
+
+			glcm.SurrenderControl()
+		},
+	}
+	rootCmd.AddCommand(generateCmd)
+
+	generateCmd.PersistentFlags().UintVar(&raw.fileCount, common.FileCountParam, common.FileCountDefault, "number of files to generate")
+	generateCmd.PersistentFlags().StringVar(&raw.sizePerFile, common.SizePerFileParam, "", "size of each generated file. Must be "+sizeStringDescription+" (default "+defaultGeneratedFileSize+")")
+	generateCmd.PersistentFlags().StringVar(&raw.sizeDistribution, "size-distribution", "", "choose the size of each file from these sizes, each with a weight that says how often it's chosen relative to the others, "+
+		"e.g. 4K:70,1M:25,100M:5. Cannot be used with "+common.SizePerFileParam)
+	generateCmd.PersistentFlags().UintVar(&raw.filesPerDirectory, "files-per-directory", 0, "put the files in numbered directories of this many files each. (default 0, meaning all the files are in the destination directory)")
+	generateCmd.PersistentFlags().StringVar(&raw.content, "content", "random", "the content of the files: random, which doesn't compress, or compressible, which compresses like text")
+
+	generateCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "use this block size (specified in MiB). Default is automatically calculated for each file, based on its size and on the measured latency and throughput. Decimal fractions are allowed - e.g. 0.25. Identical to the same-named parameter in the copy command")
+	generateCmd.PersistentFlags().StringVar(&raw.blobType, "blob-type", "Detect", "defines the type of blob at the destination. Identical to the same-named parameter in the copy command")
+	generateCmd.PersistentFlags().BoolVar(&raw.putMd5, "put-md5", false, "create an MD5 hash of each file, and save the hash as the Content-MD5 property of the destination blob. Identical to the same-named parameter in the copy command")
+	generateCmd.PersistentFlags().StringVar(&raw.logVerbosity, "log-level", "INFO", "define the log verbosity for the log file, available levels: INFO(all requests/responses), WARNING(slow responses), ERROR(only failed requests), and NONE(no output logs).")
+}
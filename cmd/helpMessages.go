@@ -23,11 +23,14 @@ Copies source data to a destination location. The supported directions are:
   - local <-> Azure Blob (SAS or OAuth authentication)
   - local <-> Azure Files (Share/directory SAS authentication)
   - local <-> ADLS Gen 2 (SAS, OAuth, or SharedKey authentication)
-  - Azure Blob (SAS or public) -> Azure Blob (SAS or OAuth authentication)
+  - Azure Blob (SAS, public, or OAuth by way of a user delegation SAS) -> Azure Blob (SAS or OAuth authentication)
   - Azure Blob (SAS or public) -> Azure Files (SAS)
   - Azure Files (SAS) -> Azure Files (SAS)
   - Azure Files (SAS) -> Azure Blob (SAS or OAuth authentication)
-  - AWS S3 (Access Key) -> Azure Block Blob (SAS or OAuth authentication)
+  - AWS S3 (Access Key, optionally with a session token, or the role of an ECS task or EC2 instance profile) -> Azure Block Blob (SAS or OAuth authentication)
+  - Any HTTP(S) server (public or presigned URLs) -> Azure Blob (SAS or OAuth authentication)
+  - SFTP server (key authentication) <-> Azure Blob (SAS or OAuth authentication)
+  - local -> local (e.g. between local disks and NAS mounts)
 
 Please refer to the examples for more information.
 
@@ -61,6 +64,14 @@ Upload a single file by using a SAS token and piping (block blobs only):
   
   - cat "/path/to/file.txt" | azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob]?[SAS]"
 
+Stream a backup into a block blob without writing it to disk first, in blocks of 64 MiB, so that it can be up to about 3 TiB:
+
+  - tar -cz . | azcopy cp --from-pipe "https://[account].blob.core.windows.net/[container]/[path/to/backup.tgz]?[SAS]" --block-size-mb=64 --content-type=application/gzip
+
+Upload a directory with millions of small files as a single compressed tar blob, which is built as it's uploaded:
+
+  - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/backup.tar.gz]?[SAS]" --archive=tar.gz
+
 Upload an entire directory by using a SAS token:
   
   - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true
@@ -75,6 +86,19 @@ Upload files and directories by using a SAS token and wildcard (*) characters:
 
   - azcopy cp "/path/*foo/*bar*" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true
 
+List the files that an upload would transfer with a set of include and exclude patterns, and their total size, without transferring anything:
+
+  - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --include-pattern="*.parquet" --exclude-path="staging" --dry-run
+
+Estimate an upload with a dry run, and then fail the upload unless it transfers exactly the files and bytes that the dry run found:
+
+  - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --dry-run --expected-totals-file=totals.json
+  - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --expected-totals-file=totals.json
+
+Upload a directory with millions of files, scanning all of it first so that the progress and the estimated time remaining are accurate from the start:
+
+  - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --enumerate-first
+
 Download a single file by using OAuth authentication. If you have not yet logged into AzCopy, please run the azcopy login command before you run the following command.
 
   - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob]" "/path/to/file.txt"
@@ -87,6 +111,14 @@ Download a single file by using a SAS token and then piping the output to a file
   
   - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob]?[SAS]" > "/path/to/file.txt"
 
+Stream a backup out of a block blob and unpack it, without writing it to disk first. Several ranges of the blob are read at once, and written out in order:
+
+  - azcopy cp --to-pipe "https://[account].blob.core.windows.net/[container]/[path/to/backup.tgz]?[SAS]" | tar -xz
+
+Extract the files in a compressed tar blob into a local directory, as the blob is downloaded:
+
+  - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/backup.tar.gz]?[SAS]" "/path/to/dir" --archive=tar.gz
+
 Download an entire directory by using a SAS token:
   
   - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" "/path/to/dir" --recursive=true
@@ -109,6 +141,10 @@ Download a subset of containers within a storage account by using a wildcard sym
 
   - azcopy cp "https://[srcaccount].blob.core.windows.net/[container*name]" "/path/to/dir" --recursive
 
+Copy a directory between two local disks or NAS mounts, with the same parallelism, filters and logging as a transfer to or from Azure:
+
+  - azcopy cp "/path/to/dir" "/mnt/nas/path/to/dir" --recursive
+
 Copy a single blob to another blob by using a SAS token.
 
   - azcopy cp "https://[srcaccount].blob.core.windows.net/[container]/[path/to/blob]?[SAS]" "https://[destaccount].blob.core.windows.net/[container]/[path/to/blob]?[SAS]"
@@ -125,10 +161,22 @@ Copy all blob containers, directories, and blobs from storage account to another
 
   - azcopy cp "https://[srcaccount].blob.core.windows.net?[SAS]" "https://[destaccount].blob.core.windows.net?[SAS]" --recursive=true
 
+Copy a directory between two accounts with hierarchical namespaces (ADLS Gen2), keeping the owner, group, permissions, and ACLs of each file and of the directories above it. The identity used at the destination must be allowed to change owners, e.g. it must be a superuser or have the Storage Blob Data Owner role:
+
+  - azcopy cp "https://[srcaccount].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" "https://[destaccount].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --preserve-permissions=true
+
 Copy a single object to Blob Storage from Amazon Web Services (AWS) S3 by using an access key and a SAS token. First, set the environment variable AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY for AWS S3 source.
   
   - azcopy cp "https://s3.amazonaws.com/[bucket]/[object]" "https://[destaccount].blob.core.windows.net/[container]/[path/to/blob]?[SAS]"
 
+Copy a single object to Blob Storage from AWS S3 by using temporary credentials, e.g. from AWS STS, and a SAS token. Set AWS_SESSION_TOKEN as well as AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+
+  - azcopy cp "https://s3.amazonaws.com/[bucket]/[object]" "https://[destaccount].blob.core.windows.net/[container]/[path/to/blob]?[SAS]"
+
+Copy objects to Blob Storage from AWS S3 by using the role of the ECS task or EC2 instance profile AzCopy runs as (IMDSv2 and IMDSv1 both work), and a SAS token. Leave AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY unset. The objects' metadata is copied to the blobs' metadata.
+
+  - azcopy cp "https://[bucket].s3.amazonaws.com/[prefix]*" "https://[destaccount].blob.core.windows.net/[container]?[SAS]"
+
 Copy an entire directory to Blob Storage from AWS S3 by using an access key and a SAS token. First, set the environment variable AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY for AWS S3 source.
  
   - azcopy cp "https://s3.amazonaws.com/[bucket]/[folder]" "https://[destaccount].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true
@@ -146,6 +194,26 @@ Copy all buckets to Blob Storage from an Amazon Web Services (AWS) region by usi
 Copy a subset of buckets by using a wildcard symbol (*) in the bucket name. Like the previous examples, you'll need an access key and a SAS token. Make sure to set the environment variable AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY for AWS S3 source.
 
   - azcopy cp "https://s3.amazonaws.com/[bucket*name]/" "https://[destaccount].blob.core.windows.net?[SAS]" --recursive=true
+
+Copy a file from any web server to Blob Storage. AzCopy reads the file with several range requests at once, if the server supports them. The query of the URL, e.g. the signature of a presigned URL, is kept. If the server gives the MD5 hash of the file, in Content-MD5 or x-goog-hash, the content is verified against it, and the blob isn't created if it doesn't match. Interrupted jobs can be resumed like any other.
+
+  - azcopy cp "https://[server]/[path/to/file]" "https://[destaccount].blob.core.windows.net/[container]/[path/to/blob]?[SAS]"
+
+Copy several files from a web server to Blob Storage, by listing their paths relative to a base URL in a file, one per line.
+
+  - azcopy cp "https://[server]/[path/to/directory]" "https://[destaccount].blob.core.windows.net/[container]?[SAS]" --list-of-files=[path/to/list]
+
+Fetch files from any number of web servers into a container. Each line of the list is a URL, optionally followed by a tab and the name of the blob to create, and then by tab-separated headers to set on it, such as Content-Type: text/csv or x-ms-meta-[name]: [value]. Files that can't be read when the list is scanned are skipped with a warning; the rest are retried and reported like any other transfer.
+
+  - azcopy cp "https://[destaccount].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --url-list=[path/to/list]
+
+Copy a directory from an SFTP server to Blob Storage. AzCopy logs in with the key in AZCOPY_SFTP_KEY_PATH (by default, your key in ~/.ssh), and only connects to servers whose keys are in AZCOPY_SFTP_KNOWN_HOSTS (by default, ~/.ssh/known_hosts). The path is absolute, unless it starts with /~/, for a path in your home directory on the server.
+
+  - azcopy cp "sftp://[user]@[server]/[path/to/directory]" "https://[destaccount].blob.core.windows.net/[container]?[SAS]" --recursive=true
+
+Copy a blob to an SFTP server.
+
+  - azcopy cp "https://[srcaccount].blob.core.windows.net/[container]/[path/to/blob]?[SAS]" "sftp://[user]@[server]/~/[path/to/directory]/"
 `
 
 // ===================================== ENV COMMAND ===================================== //
@@ -188,19 +256,116 @@ Note that you can customize the location where log and plan files are saved. See
 
 const removeJobsCmdExample = "  azcopy jobs rm e52247de-0323-b14d-4cc8-76e0be2e2d44"
 
+const journalJobsCmdShortDescription = "Show or export the journal of the given job ID"
+
+const journalJobsCmdLongDescription = `
+Show or export the journal of a job that was run with --journal. The journal records each state change of each transfer,
+with its time and the ID of the latest request made for the transfer, as evidence of exactly when each object was copied and verified.
+
+The journal is kept next to the log of the job, and is not removed by the jobs rm and jobs clean commands.`
+
+const journalJobsCmdExample = `  azcopy jobs journal e52247de-0323-b14d-4cc8-76e0be2e2d44
+
+Export the journal as a JSON array:
+
+  - azcopy jobs journal e52247de-0323-b14d-4cc8-76e0be2e2d44 --export=journal.json`
+
+const logsJobsCmdShortDescription = "Show the log of the given job ID"
+
+const logsJobsCmdLongDescription = `
+Show the log of a job, so that it doesn't have to be looked for in the log folder. The files of a rotated log are shown
+oldest first, and compressed files are read as they are.
+
+With --follow, the log is shown as the job writes it, until the job is done. With --level, only the entries of
+that level of severity or higher are shown. Text logs only mark the level of some messages, such as those about
+transfers, and their other messages are taken to be at the INFO level.`
+
+const logsJobsCmdExample = `  azcopy jobs logs e52247de-0323-b14d-4cc8-76e0be2e2d44
+
+Show the warnings and errors of a running job as they are logged:
+
+  - azcopy jobs logs e52247de-0323-b14d-4cc8-76e0be2e2d44 --follow --level=WARNING`
+
+const verifyJobsCmdShortDescription = "Check that the destinations of a finished job still match what was transferred"
+
+const verifyJobsCmdLongDescription = `
+Check the destination of each successful transfer of a finished job: that it exists, that it has the size of the source,
+and that its MD5 hash matches the source's, when both have one. This can be done long after the job ran, for instance
+before the sources are deleted.
+
+A destination that doesn't match is marked as failed in the job, so that 'azcopy jobs resume' transfers it again.
+The results are written to a checkpoint as the verification goes, so if it is interrupted, running it again carries on
+from where it got to. When every destination has been checked, a report is written next to the log of the job.
+
+As with resume, the SAS tokens of the source and destination must be given again if they were used by the job.`
+
+const verifyJobsCmdExample = `  azcopy jobs verify e52247de-0323-b14d-4cc8-76e0be2e2d44 --destination-sas="<SAS>"`
+
+const inspectJobsCmdShortDescription = "Show what is in a plan file, which may come from another machine or version of AzCopy"
+
+const inspectJobsCmdLongDescription = `
+Read a single plan file, which need not be in the plan folder of this machine, and show what it says about its job:
+the command, the source and destination, the status, and how many transfers are in each status. Nothing is changed,
+and the job doesn't need to be known to this machine, so this can be used on plan files collected from another machine
+when diagnosing a job offline.
+
+Plan files of older versions of AzCopy are read as if they had been upgraded to this version (the file isn't changed).
+Plan files of newer versions, and plan files that are truncated or that were written on a machine with a different
+architecture, are read as far as possible, and the output says what couldn't be read.`
+
+const inspectJobsCmdExample = `  azcopy jobs inspect --plan-file ./e52247de-0323-b14d-4cc8-76e0be2e2d44--00000.steV11
+
+List each transfer, with its status:
+
+  - azcopy jobs inspect --plan-file ./e52247de-0323-b14d-4cc8-76e0be2e2d44--00000.steV11 --list-transfers`
+
+const setCapJobsCmdShortDescription = "Change the bandwidth cap of a running job"
+
+const setCapJobsCmdLongDescription = `
+Change the cap (in megabits per second) of a job that is running in another AzCopy process, without cancelling and
+resuming it. The new cap takes effect within a few seconds, and is written to the log of the job. A cap of 0 removes
+the cap, even if the job was started with --cap-mbps.
+
+The new cap lasts for as long as the job runs. If the job is later resumed, give its cap with --cap-mbps again.`
+
+const setCapJobsCmdExample = `  azcopy jobs set-cap e52247de-0323-b14d-4cc8-76e0be2e2d44 --cap-mbps 200
+
+Remove the cap, e.g. outside business hours:
+
+  - azcopy jobs set-cap e52247de-0323-b14d-4cc8-76e0be2e2d44 --cap-mbps 0`
+
 const cleanJobsCmdShortDescription = "Remove all log and plan files for all jobs"
 
 const cleanJobsCmdLongDescription = `
-Note that you can customize the location where log and plan files are saved. See the env command to learn more.`
+Note that you can customize the location where log and plan files are saved. See the env command to learn more.
+
+Old jobs that completed can also be removed automatically whenever a new job starts, by setting AZCOPY_JOB_RETENTION (for example to 30d)
+and/or AZCOPY_JOB_STORE_MAX_SIZE_MB. Jobs that could still be resumed are only removed by this command.`
+
+const cleanJobsCmdExample = `  azcopy jobs clean --with-status=completed
+
+Remove the jobs that started more than 30 days ago, except those that failed:
 
-const cleanJobsCmdExample = "  azcopy jobs clean --with-status=completed"
+  - azcopy jobs clean --older-than 30d --keep-failed`
 
 // ===================================== LIST COMMAND ===================================== //
 const listCmdShortDescription = "List the entities in a given resource"
 
 const listCmdLongDescription = `List the entities in a given resource. In the current release, only Blob containers are supported.`
 
-const listCmdExample = "azcopy list [containerURL]"
+const listCmdExample = `
+List the blobs in a container:
+
+  - azcopy list [containerURL]
+
+Save the listing as a Parquet file, for analysis in tools such as Synapse or DuckDB (use a .csv extension for CSV):
+
+  - azcopy list [containerURL] --output-file listing.parquet
+
+Find block blobs that could be moved to a cooler tier, and save the recommended changes:
+
+  - azcopy list [containerURL] --cold-data-report --cool-after-days 60 --archive-after-days 365 --tier-manifest tiers.csv
+`
 
 // ===================================== LOGIN COMMAND ===================================== //
 const loginCmdShortDescription = "Log in to Azure Active Directory (AD) to access Azure Storage resources."
@@ -252,6 +417,13 @@ Set the environment variable AZCOPY_SPA_CERT_PASSWORD to the certificate's passw
    --certificate-path is mandatory when doing cert-based service principal auth.
 `
 
+const loginStatusCmdShortDescription = "Show whether you are logged in, and with which identity."
+
+const loginStatusCmdLongDescription = `Show the kind of the cached login, the tenant and, for a managed identity, which identity of the VM is used.
+With --verbose, also show the resource and expiry of the token, the claims identifying who it was issued to,
+and whether a token for Azure Resource Manager can be acquired with the same login. That is the Resource Manager of the
+cloud of the login, or of the cloud given with --cloud.`
+
 // ===================================== LOGOUT COMMAND ===================================== //
 const logoutCmdShortDescription = "Log out to terminate access to Azure Storage resources."
 
@@ -292,6 +464,10 @@ Remove an entire virtual directory but exclude certain blobs from the scope (For
 
    - azcopy rm "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --exclude="foo*;*bar"
 
+List the blobs that the command above would remove, and their total size, without removing anything:
+
+   - azcopy rm "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true --exclude="foo*;*bar" --dry-run
+
 Remove specific blobs and virtual directories by putting their relative paths (NOT URL-encoded) in a file:
 
    - azcopy rm "https://[account].blob.core.windows.net/[container]/[path/to/parent/dir]" --recursive=true --list-of-files=/usr/bar/list.txt
@@ -318,6 +494,7 @@ The last modified times are used for comparison. The file is skipped if the last
   - local <-> Azure Blob (either SAS or OAuth authentication can be used)
   - Azure Blob <-> Azure Blob (Source must include a SAS or is publicly accessible; either SAS or OAuth authentication can be used for destination)
   - Azure File <-> Azure File (Source must include a SAS or is publicly accessible; SAS authentication should be used for destination)
+  - local -> local
 
 The sync command differs from the copy command in several ways:
 
@@ -381,6 +558,22 @@ Sync an Azure File directory (same syntax as Blob):
 
    - azcopy sync "https://[account].file.core.windows.net/[share]/[path/to/dir]?[SAS]" "https://[account].file.core.windows.net/[share]/[path/to/dir]" --recursive=true
 
+Sync a directory restored from a backup, whose files all have new last modified times, by only uploading the files whose content differs:
+
+   - azcopy sync "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/virtual/dir]?[SAS]" --recursive=true --compare=hash
+
+See which destination files would be deleted if 10% of the source listing went missing, without transferring or deleting anything:
+
+   - azcopy sync "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/virtual/dir]?[SAS]" --recursive=true --delete-destination=true --simulate-failures-of-source=10%
+
+Mirror a directory to a container, deleting the extra blobs only if soft delete is enabled on the account, so that they can be recovered if the sync was pointed at the wrong place:
+
+   - azcopy sync "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/virtual/dir]?[account SAS]" --recursive=true --delete-destination=true --require-soft-delete
+
+Compare all of the source with the destination before transferring anything, so that the progress is accurate from the start:
+
+   - azcopy sync "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/virtual/dir]?[SAS]" --recursive=true --enumerate-first
+
 Note: if include and exclude flags are used together, only files matching the include patterns are used, but those matching the exclude patterns are ignored.
 `
 
@@ -436,3 +629,161 @@ selected file count and size:
 
    - azcopy bench "https://[account].blob.core.windows.net/[container]?<SAS>" --file-count 50000 --size-per-file 8M --put-md5
 `
+
+// ===================================== GENERATE COMMAND ===================================== //
+const generateCmdShortDescription = "Writes auto-generated test data to a destination"
+
+const generateCmdLongDescription = `
+Writes auto-generated data to a destination, to validate a new storage account or network path, or to stand up test data for load tests.
+Like the bench command, the data is generated in memory, so disk is not used, but the data is kept at the destination and
+concurrency is not auto-tuned.
+
+The number of files and their sizes are described by command line parameters. The sizes can follow a distribution, given as
+sizes with weights, e.g. 4K:70,1M:25,100M:5 for mostly small files and a few big ones. The same parameters always generate the same
+files, with the same sizes. The data is random (so it doesn't compress) unless --content compressible is given, in which case it compresses like text.
+
+In the current release, the destination must be a blob container, or a virtual directory in one.
+`
+
+const generateCmdExample = `Write 1000 files of 1 MiB each:
+
+   - azcopy generate "https://[account].blob.core.windows.net/[container]/[path/to/directory]?<SAS>" --file-count 1000 --size-per-file 1M
+
+Write 100,000 files of mixed sizes, in directories of 1000 files each, with data that compresses like text:
+
+   - azcopy generate "https://[account].blob.core.windows.net/[container]?<SAS>" --file-count 100000 --size-distribution 4K:70,1M:25,100M:5 --files-per-directory 1000 --content compressible
+`
+
+// ===================================== STATS COMMAND ===================================== //
+const statsCmdShortDescription = "Show the statistics of the jobs that have run on this machine"
+
+const statsCmdLongDescription = `
+Each time a job finishes, or is cancelled or paused, AzCopy records how much data it transferred, how long it took,
+and between which endpoints (the host of a remote source or destination, or local for the local file system).
+A job that is resumed has a record for each run. The records are kept in the plan folder, and are not removed
+with the plans of the jobs, so they can be used for capacity planning, or to find out how fast a link usually is.
+
+By default, the runs are summed up by source and destination endpoint. The average throughput is the total data over the
+total time, while the median is of the throughputs of the individual runs, so a single unusual run doesn't skew it.
+
+With --bandwidth, the bytes that the jobs sent and received over the network (including retries) are shown instead,
+for each calendar day and each job. Running jobs add to them every minute. That's what counts against --daily-cap-gb.
+`
+
+const statsCmdExample = `
+Sum up all the jobs that have run on this machine:
+
+  - azcopy stats
+
+Show how fast transfers to or from one account have been in the last 30 days:
+
+  - azcopy stats --endpoint myaccount.blob.core.windows.net --since 30d
+
+List each run of each job, in JSON:
+
+  - azcopy stats --list --output-type json
+
+Show the bandwidth used by the jobs in each of the last 7 days:
+
+  - azcopy stats --bandwidth --since 7d
+`
+
+// ===================================== WORKER COMMAND ===================================== //
+const workerCmdShortDescription = "Run AzCopy as a transfer worker, driven by messages in an Azure Storage queue"
+
+const workerCmdLongDescription = `
+Polls an Azure Storage queue for transfer requests, runs each one, and (optionally) posts the outcome to a results queue.
+This turns AzCopy into a simple transfer worker for event-driven architectures.
+
+Each queue message must be a JSON document (plain, or Base64-encoded as the Storage SDKs do by default) of the form:
+
+  {"command": "copy", "source": "<source>", "destination": "<destination>", "options": {"recursive": "true"}}
+
+"command" may be copy, sync or remove, and defaults to copy. Remove requests only need a source. Each entry in "options"
+is passed to the command as --<name>=<value>, so any flag of that command can be used.
+
+A message is deleted from the queue once its request has run, whether or not the request succeeded. A message that keeps
+reappearing (for example because the worker was stopped while running it) is abandoned after --max-dequeue-count attempts.
+While a request runs, its message is kept hidden from other workers by renewing its --visibility-timeout.
+
+The queue URLs must include a SAS token with read, add, update and process permissions as appropriate.
+Credentials for the transfers themselves are found in the usual way (e.g. SAS tokens in the URLs, or a prior azcopy login).
+`
+
+const workerCmdExample = `
+Process requests until stopped, reporting results to a second queue:
+
+  - azcopy worker --queue-url "https://[account].queue.core.windows.net/[requests]?[SAS]" --results-queue-url "https://[account].queue.core.windows.net/[results]?[SAS]"
+
+Process whatever requests are currently queued, then exit:
+
+  - azcopy worker --queue-url "https://[account].queue.core.windows.net/[requests]?[SAS]" --exit-when-empty
+`
+
+// ===================================== TABLE COMMANDS ===================================== //
+const exportTableCmdShortDescription = "Export the entities of an Azure Storage table to a local NDJSON or CSV file"
+
+const exportTableCmdLongDescription = `
+Writes every entity of a table to a local file, in the order of their keys.
+
+In NDJSON (the default), each line is an entity in the JSON form that the Table service uses, with the types
+that JSON can't show in <property>@odata.type properties, as in {"PartitionKey":"p","RowKey":"r","Count":"42","Count@odata.type":"Edm.Int64"}.
+
+In CSV, each property of each type has a column of its own, headed by the property name and type, as in Count:Edm.Int64.
+String properties are headed by their name alone. An empty cell means that the entity doesn't have the property,
+so empty strings are not kept in CSV files.
+
+The table URL must include a SAS token with read and list permissions.
+`
+
+const exportTableCmdExample = `
+  - azcopy export-table "https://[account].table.core.windows.net/[table]?[SAS]" "/path/to/entities.ndjson"
+
+  - azcopy export-table "https://[account].table.core.windows.net/[table]?[SAS]" "/path/to/entities.csv"
+`
+
+const importTableCmdShortDescription = "Import the entities in a local NDJSON or CSV file into an Azure Storage table"
+
+const importTableCmdLongDescription = `
+Inserts the entities in a local file, in the formats that export-table writes, into a table. Entities that are already
+in the table are replaced, so an import that failed part way through can simply be run again.
+
+Consecutive entities with the same PartitionKey are inserted in batches (entity group transactions) of up to --batch-size.
+Timestamps in the file are ignored, since the service sets its own. In CSV files, columns without a type are strings.
+
+The table must exist, and its URL must include a SAS token with add and update permissions.
+`
+
+const importTableCmdExample = `
+  - azcopy import-table "/path/to/entities.ndjson" "https://[account].table.core.windows.net/[table]?[SAS]"
+`
+
+// ===================================== QUEUE COMMANDS ===================================== //
+const drainQueueCmdShortDescription = "Move the messages of an Azure Storage queue to a local file"
+
+const drainQueueCmdLongDescription = `
+Receives the messages of a queue, appends them to a local file (one JSON object per line), and deletes them from the queue,
+until the queue is empty or --max-messages have been moved.
+
+Messages are saved before they are deleted, so if the command fails, a message may be both in the file and, once it
+becomes visible again, in the queue, but is never lost.
+
+The queue URL must include a SAS token with process permission.
+`
+
+const drainQueueCmdExample = `
+  - azcopy drain-queue "https://[account].queue.core.windows.net/[queue]?[SAS]" "/path/to/messages.ndjson"
+`
+
+const loadQueueCmdShortDescription = "Add the messages in a local file to an Azure Storage queue"
+
+const loadQueueCmdLongDescription = `
+Adds the messages in a file written by drain-queue to a queue, in the order they are in the file. Only the text of the
+messages is kept: they get new IDs and insertion times, and expire after --message-ttl.
+
+The queue must exist, and its URL must include a SAS token with add permission.
+`
+
+const loadQueueCmdExample = `
+  - azcopy load-queue "/path/to/messages.ndjson" "https://[account].queue.core.windows.net/[queue]?[SAS]"
+`
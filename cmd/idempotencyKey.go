@@ -0,0 +1,145 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const idempotencyKeyFlagUsage = "Identify the job with this key, e.g. the ID of a CI pipeline run, so that running the same command again with the same key " +
+	"resumes the job that it started, instead of starting a new job that copies everything again. The key is combined with the source, destination, direction, " +
+	"filters and the other options that change what is copied or how, so the same key can be used for different copies. A job that completed is not run again, " +
+	"and one whose scan of the source was interrupted is started again from scratch."
+
+// idempotentJobID derives the ID of the job from the idempotency key, so that the same command with the same key always gives the same job.
+// The SAS tokens aren't part of it, since a retry may well have fresh ones, but the settings that define the job are,
+// so that changing a filter or an option gives a new job rather than resuming one that copies something else.
+func idempotentJobID(key string, fromTo common.FromTo, source string, destination string, settings string) (common.JobID, error) {
+	hash := sha256.Sum256([]byte(strings.Join([]string{key, fromTo.String(),
+		stripQueryOfRemote(source, fromTo.From()), stripQueryOfRemote(destination, fromTo.To()), settings}, "\x00")))
+
+	// lay it out like a name based (version 5) UUID, although the hash is SHA-256
+	b := hash[:16]
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return common.ParseJobID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+func stripQueryOfRemote(resource string, location common.Location) string {
+	if location.IsRemote() {
+		return strings.SplitN(resource, "?", 2)[0]
+	}
+	return resource
+}
+
+// jobDefiningSettings lists the flags that change which files the job copies, or what it writes for them.
+// Flags that only change how fast or how verbosely it runs are left out, so that they can be changed on a retry.
+func (raw rawCopyCmdArgs) jobDefiningSettings() string {
+	settings := []interface{}{
+		// what is copied
+		raw.include, raw.exclude, raw.includePath, raw.excludePath, raw.includeFileAttributes, raw.excludeFileAttributes,
+		raw.excludeHidden, raw.excludePatternsFile, raw.listOfFilesToCopy, raw.inventoryReport, raw.urlList, raw.archive,
+		raw.recursive, raw.maxDepth, raw.sample, raw.sampleSeed, raw.sampleMaxBytes, raw.followSymlinks,
+		raw.includeBlobType, raw.excludeBlobType, raw.includeContentType, raw.maxFileSize, raw.allowedExtensions,
+		raw.blockedExtensions, raw.blockedSignatures, raw.policyViolationAction, raw.quarantineFolder, raw.partitionBy,
+		raw.internalOverrideStripTopDir,
+		// what is written
+		raw.forceWrite, raw.ifNoneMatch, raw.autoDecompress, raw.blobType, raw.blockBlobTier, raw.pageBlobTier,
+		raw.metadata, raw.contentType, raw.contentEncoding, raw.contentDisposition, raw.contentLanguage, raw.cacheControl,
+		raw.noGuessMimeType, raw.preserveLastModifiedTime, raw.putMd5, raw.convertToVHD, raw.md5ValidationOption,
+		raw.deleteSnapshotsOption, raw.pinSourceVersions, raw.preservePermissions, raw.nfs, raw.deleteSourceAfter,
+		raw.propertiesOnly, raw.propertyMapping, raw.s2sPreserveProperties, raw.s2sPreserveAccessTier,
+		raw.s2sInvalidMetadataHandleOption,
+	}
+	values := make([]string, len(settings))
+	for i, setting := range settings {
+		values[i] = fmt.Sprintf("%q", fmt.Sprint(setting))
+	}
+	return strings.Join(values, ",")
+}
+
+// cookIdempotencyKey validates the idempotency key, and gives the job the ID that goes with it
+func (cooked *cookedCopyCmdArgs) cookIdempotencyKey(key string, settings string) error {
+	if key == "" {
+		return nil
+	}
+	if strings.TrimSpace(key) == "" {
+		return errors.New("the idempotency key cannot be blank")
+	}
+	if cooked.isRedirection() || cooked.fromTo.From() == common.ELocation.Benchmark() {
+		return fmt.Errorf("idempotency-key is not supported for %v, since such jobs cannot be resumed", cooked.fromTo)
+	}
+
+	jobID, err := idempotentJobID(key, cooked.fromTo, cooked.source, cooked.destination, settings)
+	if err != nil {
+		return err
+	}
+	cooked.jobID = jobID
+	cooked.idempotencyKey = key
+	return nil
+}
+
+// resumeExistingIdempotentJob resumes the job that was started with the same idempotency key, if there is one,
+// in which case it doesn't return, since it waits for the job to complete
+func (cca *cookedCopyCmdArgs) resumeExistingIdempotentJob() error {
+	if cca.idempotencyKey == "" {
+		return nil
+	}
+
+	var status common.GetJobStatusResponse
+	Rpc(common.ERpcCmd.GetJobStatus(), &common.GetJobStatusRequest{JobID: cca.jobID}, &status)
+	if status.NotFound {
+		// there's no such job yet, so it is started as usual
+		return nil
+	}
+	if status.ErrorMsg != "" {
+		// starting it again could copy everything a second time, which is what the key is meant to prevent
+		return fmt.Errorf("cannot tell whether job %v was already started with this idempotency key: %v", cca.jobID, status.ErrorMsg)
+	}
+	if !status.CompletelyOrdered {
+		// the scan of the source was interrupted, and resuming would only copy what it had found, so the job is started again.
+		// Whatever was already copied is copied again, or skipped, according to --overwrite.
+		glcm.Info(fmt.Sprintf("Job %v was already started with this idempotency key, but its scan of the source did not complete, so it is started again.", cca.jobID))
+		if _, err := removeFilesWithPredicate(azcopyJobPlanFolder, func(s string) bool {
+			return strings.Contains(s, cca.jobID.String()) && strings.Contains(s, ".steV")
+		}); err != nil {
+			return fmt.Errorf("cannot remove the plan files of the incomplete job %v: %v", cca.jobID, err)
+		}
+		return nil
+	}
+
+	glcm.Info(fmt.Sprintf("Job %v was already started with this idempotency key, and its status is %v, so it is resumed rather than started again.", cca.jobID, status.JobStatus))
+
+	_, sourceSAS, err := SplitAuthTokenFromResource(cca.source, cca.fromTo.From())
+	if err != nil {
+		return err
+	}
+	_, destinationSAS, err := SplitAuthTokenFromResource(cca.destination, cca.fromTo.To())
+	if err != nil {
+		return err
+	}
+	return resumeCmdArgs{jobID: cca.jobID.String(), SourceSAS: sourceSAS, DestinationSAS: destinationSAS}.process()
+}
@@ -0,0 +1,91 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const afterJobFlagUsage = "Start the job only when the job with this ID has completed successfully, so that jobs such as copy, verify and delete-source can be chained. " +
+	"AzCopy waits for that job, which may be running in another AzCopy process, and fails without doing anything if it ends with failures or is cancelled."
+
+// how often the status of the job that a new job is waiting for is checked
+var afterJobPollInterval = 15 * time.Second
+
+// cookAfterJobID parses the ID of the job that a new job must wait for, which is empty if it need not wait
+func cookAfterJobID(raw string) (common.JobID, error) {
+	if raw == "" {
+		return common.JobID{}, nil
+	}
+	jobID, err := common.ParseJobID(raw)
+	if err != nil {
+		return common.JobID{}, fmt.Errorf("invalid job ID %q given for after-job: %v", raw, err)
+	}
+	return jobID, nil
+}
+
+// waitForJob returns when the given job has completed successfully, and so the job that is waiting for it can start.
+// It returns an error, so that the waiting job doesn't run at all, if that job doesn't exist or ends in any other way.
+func waitForJob(jobID common.JobID) error {
+	if jobID.IsEmpty() {
+		return nil
+	}
+
+	lastStatus := common.EJobStatus.All()
+	for {
+		var resp common.GetJobStatusResponse
+		Rpc(common.ERpcCmd.GetJobStatus(), &common.GetJobStatusRequest{JobID: jobID}, &resp)
+		if resp.ErrorMsg != "" {
+			return fmt.Errorf("cannot wait for job %v: %s", jobID, resp.ErrorMsg)
+		}
+
+		switch resp.JobStatus {
+		case common.EJobStatus.Completed(), common.EJobStatus.CompletedWithSkipped():
+			glcm.Info(fmt.Sprintf("Job %v has completed, so this job is starting.", jobID))
+			return nil
+		case common.EJobStatus.CompletedWithErrors(),
+			common.EJobStatus.CompletedWithErrorsAndSkipped(),
+			common.EJobStatus.Failed(),
+			common.EJobStatus.Cancelled():
+			return fmt.Errorf("this job was to start after job %v, which ended with status %v, so it was not run", jobID, resp.JobStatus)
+		}
+
+		// the job is still in progress, or is paused or being cancelled
+		if resp.JobStatus != lastStatus {
+			glcm.Info(fmt.Sprintf("Waiting for job %v to complete before starting this job. Its status is %v.", jobID, resp.JobStatus))
+			lastStatus = resp.JobStatus
+		}
+		time.Sleep(afterJobPollInterval)
+	}
+}
+
+// describeAfterJob describes the job that another job waited for, with its status if it is among the listed jobs
+func describeAfterJob(afterJobID common.JobID, jobs []common.JobIDDetails) string {
+	for _, job := range jobs {
+		if job.JobId == afterJobID {
+			return fmt.Sprintf("%v (%v)", afterJobID, job.JobStatus)
+		}
+	}
+	return afterJobID.String()
+}
@@ -0,0 +1,94 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// parseJobLabels parses labels given as key=value. In filters, a label may also be given as just a key.
+func parseJobLabels(rawLabels []string, allowKeyOnly bool) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, rawLabel := range rawLabels {
+		keyAndValue := strings.SplitN(rawLabel, "=", 2)
+		key := strings.TrimSpace(keyAndValue[0])
+		if key == "" || (len(keyAndValue) == 1 && !allowKeyOnly) {
+			return nil, fmt.Errorf("invalid label %q, labels must be given as key=value", rawLabel)
+		}
+
+		if len(keyAndValue) == 2 {
+			labels[key] = strings.TrimSpace(keyAndValue[1])
+		} else {
+			labels[key] = ""
+		}
+	}
+	return labels, nil
+}
+
+// cookJobLabels validates the labels and description given for a new job, and returns the labels in the form stored in the job plan
+func cookJobLabels(rawLabels []string, description string) (string, error) {
+	if len(description) > ste.JobDescriptionMaxBytes {
+		return "", fmt.Errorf("the description cannot be longer than %d bytes", ste.JobDescriptionMaxBytes)
+	}
+
+	if len(rawLabels) == 0 {
+		return "", nil
+	}
+	labels, err := parseJobLabels(rawLabels, false)
+	if err != nil {
+		return "", err
+	}
+
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+	if len(labelsJSON) > ste.JobLabelsMaxBytes {
+		return "", fmt.Errorf("the labels cannot be longer than %d bytes in total", ste.JobLabelsMaxBytes)
+	}
+	return string(labelsJSON), nil
+}
+
+// jobHasLabels returns true if the job has all the wanted labels. A wanted label with an empty value only requires the key to be present.
+func jobHasLabels(jobLabels map[string]string, wanted map[string]string) bool {
+	for key, value := range wanted {
+		jobValue, ok := jobLabels[key]
+		if !ok || (value != "" && jobValue != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatJobLabels formats labels as key=value pairs, in the order of their keys
+func formatJobLabels(jobLabels map[string]string) string {
+	labels := make([]string, 0, len(jobLabels))
+	for key, value := range jobLabels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ", ")
+}
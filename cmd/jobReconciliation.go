@@ -0,0 +1,138 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// expectedTotals are the totals that the user asserts a job will have, so that a job that silently missed part of its
+// source, e.g. because a listing was cut short, fails instead of looking successful. -1 means that a total isn't asserted
+type expectedTotals struct {
+	files int64
+	bytes int64
+}
+
+func newExpectedTotals(rawFiles string, rawBytes string) (expectedTotals, error) {
+	e := expectedTotals{files: -1, bytes: -1}
+	var err error
+	if rawFiles != "" {
+		if e.files, err = strconv.ParseInt(rawFiles, 10, 64); err != nil || e.files < 0 {
+			return e, fmt.Errorf("invalid expect-files %q. It must be a whole number of files", rawFiles)
+		}
+	}
+	if rawBytes != "" {
+		if e.bytes, err = strconv.ParseInt(rawBytes, 10, 64); err != nil || e.bytes < 0 {
+			return e, fmt.Errorf("invalid expect-bytes %q. It must be a whole number of bytes", rawBytes)
+		}
+	}
+	return e, nil
+}
+
+// savedTotals are the totals that a dry run saves, with expected-totals-file, for the real run to expect
+type savedTotals struct {
+	Files uint64
+	Bytes uint64
+}
+
+func saveExpectedTotals(path string, files uint64, bytes uint64) error {
+	data, err := json.Marshal(savedTotals{Files: files, Bytes: bytes})
+	common.PanicIfErr(err)
+	if err = ioutil.WriteFile(path, data, common.DEFAULT_FILE_PERM); err != nil {
+		return fmt.Errorf("cannot save the totals to expected-totals-file: %v", err)
+	}
+	return nil
+}
+
+func loadExpectedTotals(path string) (expectedTotals, error) {
+	e := expectedTotals{files: -1, bytes: -1}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return e, fmt.Errorf("cannot read expected-totals-file: %v", err)
+	}
+	var saved savedTotals
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return e, fmt.Errorf("invalid expected-totals-file %q. It must be one saved by a dry run: %v", path, err)
+	}
+	return expectedTotals{files: int64(saved.Files), bytes: int64(saved.Bytes)}, nil
+}
+
+func (e expectedTotals) isSet() bool {
+	return e.files >= 0 || e.bytes >= 0
+}
+
+// validate checks that the totals can be compared with those of the job, which they can't when the job is broken up
+func (e expectedTotals) validate(autoPartitionSize int64) error {
+	if e.isSet() && autoPartitionSize > 0 {
+		return errors.New("expect-files and expect-bytes cannot be used with auto-partition-size, since each sub-job has its own totals")
+	}
+	return nil
+}
+
+// reconcile compares the totals of a finished job with the expected ones. It returns the mismatches, if any,
+// and a report for the job summary, which is empty when nothing was expected.
+// Files must all have been found at the source, and then transferred, so that a job that was cancelled, had failures,
+// or skipped files (e.g. because they were already at the destination, had changed at the source, or were infected) doesn't reconcile either
+func (e expectedTotals) reconcile(summary common.ListJobSummaryResponse) (mismatches []string, report string) {
+	if !e.isSet() {
+		return nil, ""
+	}
+	mismatches = make([]string, 0)
+	b := strings.Builder{}
+	b.WriteString("\n\nReconciliation against expected totals:\n")
+
+	if e.files >= 0 {
+		found := int64(summary.TotalTransfers)
+		done := int64(summary.TransfersCompleted)
+		b.WriteString(fmt.Sprintf("Files: expected %v, found at source %v, transferred %v, skipped %v (infected %v), failed %v\n",
+			e.files, found, done, summary.TransfersSkipped, summary.TransfersSkippedInfected, summary.TransfersFailed))
+		if found != e.files {
+			mismatches = append(mismatches, fmt.Sprintf("expected %v files, but found %v at the source", e.files, found))
+		}
+		if done != e.files {
+			mismatches = append(mismatches, fmt.Sprintf("expected %v files, but %v were transferred", e.files, done))
+		}
+		if summary.TransfersSkipped > 0 {
+			mismatches = append(mismatches, fmt.Sprintf("%v files were skipped, so they are not reconciled", summary.TransfersSkipped))
+		}
+	}
+	if e.bytes >= 0 {
+		found := int64(summary.TotalBytesEnumerated)
+		b.WriteString(fmt.Sprintf("Bytes: expected %v, found at source %v\n", e.bytes, found))
+		if found != e.bytes {
+			mismatches = append(mismatches, fmt.Sprintf("expected %v bytes, but found %v at the source", e.bytes, found))
+		}
+	}
+
+	if len(mismatches) == 0 {
+		b.WriteString("Result: totals match")
+	} else {
+		b.WriteString("Result: MISMATCH - " + strings.Join(mismatches, "; "))
+	}
+	return mismatches, b.String()
+}
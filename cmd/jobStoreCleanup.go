@@ -0,0 +1,187 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// jobs whose files changed more recently than this are never removed by the size limit, since they may belong
+// to a job that another AzCopy process is running right now
+const jobStoreCleanupGracePeriod = time.Hour
+
+// jobFiles are the plan and log files of one job
+type jobFiles struct {
+	paths        []string
+	size         int64
+	lastModified time.Time
+	part0Plan    string // the path of the plan file of part 0, if there is one
+}
+
+// collectJobFiles groups the plan files and logs by the job they belong to
+func collectJobFiles(planFolder string, logFolder string) (map[common.JobID]*jobFiles, error) {
+	jobs := make(map[common.JobID]*jobFiles)
+
+	collect := func(folder string, isJobFile func(name string) bool) error {
+		files, err := ioutil.ReadDir(folder)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			// the file names start with the job ID
+			if file.IsDir() || !isJobFile(file.Name()) || len(file.Name()) < len(common.JobID{}.String()) {
+				continue
+			}
+			jobID, err := common.ParseJobID(file.Name()[:len(common.JobID{}.String())])
+			if err != nil {
+				continue
+			}
+
+			job, ok := jobs[jobID]
+			if !ok {
+				job = &jobFiles{}
+				jobs[jobID] = job
+			}
+			job.paths = append(job.paths, filepath.Join(folder, file.Name()))
+			if strings.Contains(file.Name(), "--00000.steV") {
+				job.part0Plan = filepath.Join(folder, file.Name())
+			}
+			job.size += file.Size()
+			if file.ModTime().After(job.lastModified) {
+				job.lastModified = file.ModTime()
+			}
+		}
+		return nil
+	}
+
+	if err := collect(planFolder, func(name string) bool { return strings.Contains(name, ".steV") }); err != nil {
+		return nil, err
+	}
+	if err := collect(logFolder, common.IsLogFileName); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// selectJobsToCleanup applies the retention and size policies, and returns the jobs to remove, least recently active first.
+// A zero retention or maxSize disables that policy. Only the jobs for which canRemove says so are removed
+func selectJobsToCleanup(jobs map[common.JobID]*jobFiles, now time.Time, retention time.Duration, maxSize int64, canRemove func(job *jobFiles) bool) []common.JobID {
+	jobIDs := make([]common.JobID, 0, len(jobs))
+	totalSize := int64(0)
+	for jobID, job := range jobs {
+		jobIDs = append(jobIDs, jobID)
+		totalSize += job.size
+	}
+	sort.Slice(jobIDs, func(i, j int) bool {
+		return jobs[jobIDs[i]].lastModified.Before(jobs[jobIDs[j]].lastModified)
+	})
+
+	selected := make([]common.JobID, 0)
+	for _, jobID := range jobIDs {
+		job := jobs[jobID]
+		tooOld := retention > 0 && now.Sub(job.lastModified) > retention
+		tooBig := maxSize > 0 && totalSize > maxSize && now.Sub(job.lastModified) > jobStoreCleanupGracePeriod
+
+		if (tooOld || tooBig) && canRemove(job) {
+			selected = append(selected, jobID)
+			totalSize -= job.size
+		}
+	}
+	return selected
+}
+
+// jobCanBeCleanedUp says whether a job is one that the policies may remove, which is one that completed (perhaps with skipped
+// transfers). Any other job could still be resumed, or its failures looked into, so it is only removed by "jobs clean".
+// Logs of jobs whose plan files have gone can't be resumed, so they can be removed too
+func jobCanBeCleanedUp(job *jobFiles) bool {
+	if job.part0Plan == "" {
+		return true
+	}
+	inspection, err := ste.InspectPlanFile(job.part0Plan)
+	if err != nil || inspection.JobStatus == nil {
+		return false // if the status can't be read, leave the files as they are, for the jobs commands to report
+	}
+	return *inspection.JobStatus == common.EJobStatus.Completed() || *inspection.JobStatus == common.EJobStatus.CompletedWithSkipped()
+}
+
+// cleanupJobStoreByPolicy removes the files of old, completed jobs according to AZCOPY_JOB_RETENTION and AZCOPY_JOB_STORE_MAX_SIZE_MB,
+// so that the plan and log folders do not grow without bound on busy hosts. It does nothing if neither is set.
+func cleanupJobStoreByPolicy() error {
+	lcm := common.GetLifecycleMgr()
+	retention, err := parseAge(lcm.GetEnvironmentVariable(common.EEnvironmentVariable.JobRetention()))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", common.EEnvironmentVariable.JobRetention().Name, err.Error())
+	}
+
+	maxSize := int64(0)
+	if rawMaxSize := lcm.GetEnvironmentVariable(common.EEnvironmentVariable.JobStoreMaxSizeMB()); rawMaxSize != "" {
+		maxSizeMB, err := strconv.ParseInt(rawMaxSize, 10, 64)
+		if err != nil || maxSizeMB <= 0 {
+			return fmt.Errorf("invalid %s: %s", common.EEnvironmentVariable.JobStoreMaxSizeMB().Name, rawMaxSize)
+		}
+		maxSize = maxSizeMB * 1024 * 1024
+	}
+
+	if retention == 0 && maxSize == 0 {
+		return nil
+	}
+
+	jobs, err := collectJobFiles(azcopyJobPlanFolder, azcopyLogPathFolder)
+	if err != nil {
+		return err
+	}
+
+	toRemove := selectJobsToCleanup(jobs, time.Now(), retention, maxSize, jobCanBeCleanedUp)
+	freed := int64(0)
+	for _, jobID := range toRemove {
+		for _, path := range jobs[jobID].paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		freed += jobs[jobID].size
+	}
+
+	if len(toRemove) > 0 {
+		glcm.Info(fmt.Sprintf("Removed the plan and log files of %d old jobs (%s).", len(toRemove), byteSizeToString(freed)))
+	}
+	return nil
+}
+
+// compressFinishedJobPlans compresses the plan files of the jobs that finished a while ago, which take up most of the
+// plan folder on busy hosts. It's done quietly, since the jobs commands read compressed plan files just like the others,
+// and a failure is only worth a warning, since nothing is lost by leaving the plan files as they are
+func compressFinishedJobPlans() {
+	if _, _, err := ste.CompressFinishedPlanFiles(azcopyJobPlanFolder, jobStoreCleanupGracePeriod); err != nil {
+		glcm.Info("Cannot compress the plan files of finished jobs: " + err.Error())
+	}
+}
@@ -23,7 +23,9 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 	"github.com/spf13/cobra"
@@ -32,6 +34,8 @@ import (
 func init() {
 	type JobsCleanReq struct {
 		withStatus string
+		olderThan  string
+		keepFailed bool
 	}
 
 	commandLineInput := JobsCleanReq{}
@@ -56,9 +60,18 @@ func init() {
 				glcm.Error(fmt.Sprintf("Failed to parse --with-status due to error: %s.", err))
 			}
 
-			err = handleCleanJobsCommand(withStatus)
+			olderThan, err := parseAge(commandLineInput.olderThan)
+			if err != nil {
+				glcm.Error(fmt.Sprintf("Failed to parse --older-than due to error: %s.", err))
+			}
+
+			err = handleCleanJobsCommand(withStatus, olderThan, commandLineInput.keepFailed)
 			if err == nil {
-				if withStatus == common.EJobStatus.All() {
+				if olderThan > 0 {
+					glcm.Exit(func(format common.OutputFormat) string {
+						return fmt.Sprintf("Successfully removed jobs with status %s started more than %s ago.", withStatus, commandLineInput.olderThan)
+					}, common.EExitCode.Success())
+				} else if withStatus == common.EJobStatus.All() {
 					glcm.Exit(func(format common.OutputFormat) string {
 						return fmt.Sprintf("Successfully removed all jobs.")
 					}, common.EExitCode.Success())
@@ -78,10 +91,47 @@ func init() {
 	// NOTE: we have way more job status than we normally need, only show the most common ones
 	jobsCleanCmd.PersistentFlags().StringVar(&commandLineInput.withStatus, "with-status", "All",
 		"only remove the jobs with this status, available values: Cancelled, Completed, Failed, InProgress, All")
+	jobsCleanCmd.PersistentFlags().StringVar(&commandLineInput.olderThan, "older-than", "",
+		"only remove the jobs that started longer ago than this, for example 30d or 12h")
+	jobsCleanCmd.PersistentFlags().BoolVar(&commandLineInput.keepFailed, "keep-failed", false,
+		"do not remove the jobs that failed or completed with errors, so that they can still be investigated")
+}
+
+// parseAge parses an age such as 30d, 12h or 90m. An empty string means no age was given.
+func parseAge(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	var age time.Duration
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(raw, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", raw)
+		}
+		age = time.Duration(days * float64(24*time.Hour))
+	} else {
+		var err error
+		if age, err = time.ParseDuration(raw); err != nil {
+			return 0, fmt.Errorf("invalid age %q", raw)
+		}
+	}
+
+	if age <= 0 {
+		return 0, fmt.Errorf("the age %q must be positive", raw)
+	}
+	return age, nil
 }
 
-func handleCleanJobsCommand(givenStatus common.JobStatus) error {
-	if givenStatus == common.EJobStatus.All() {
+// isFailedJobStatus returns true for the jobs that did not transfer everything they were asked to
+func isFailedJobStatus(status common.JobStatus) bool {
+	return status == common.EJobStatus.Failed() ||
+		status == common.EJobStatus.CompletedWithErrors() ||
+		status == common.EJobStatus.CompletedWithErrorsAndSkipped()
+}
+
+func handleCleanJobsCommand(givenStatus common.JobStatus, olderThan time.Duration, keepFailed bool) error {
+	if givenStatus == common.EJobStatus.All() && olderThan == 0 && !keepFailed {
 		numFilesDeleted, err := blindDeleteAllJobFiles()
 		glcm.Info(fmt.Sprintf("Removed %v files.", numFilesDeleted))
 		return err
@@ -96,8 +146,10 @@ func handleCleanJobsCommand(givenStatus common.JobStatus) error {
 	}
 
 	for _, job := range resp.JobIDDetails {
-		// delete all jobs matching the givenStatus
-		if job.JobStatus == givenStatus {
+		// delete all jobs matching the givenStatus, the age and keep-failed
+		if (givenStatus == common.EJobStatus.All() || job.JobStatus == givenStatus) &&
+			(olderThan == 0 || time.Since(time.Unix(0, job.StartTime)) > olderThan) &&
+			!(keepFailed && isFailedJobStatus(job.JobStatus)) {
 			glcm.Info(fmt.Sprintf("Removing files for job %s", job.JobId))
 			err := handleRemoveSingleJob(job.JobId)
 			if err != nil {
@@ -121,9 +173,14 @@ func blindDeleteAllJobFiles() (int, error) {
 		return numPlanFilesRemoved, err
 	}
 
+	// and the caps that were set for jobs while they ran
+	_, _ = removeFilesWithPredicate(azcopyJobPlanFolder, func(s string) bool {
+		return strings.HasSuffix(s, ".cap")
+	})
+
 	// get rid of the logs
 	numLogFilesRemoved, err := removeFilesWithPredicate(azcopyLogPathFolder, func(s string) bool {
-		if strings.HasSuffix(s, ".log") {
+		if common.IsLogFileName(s) {
 			return true
 		}
 		return false
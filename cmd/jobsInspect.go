@@ -0,0 +1,149 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	planFile := ""
+	listTransfers := false
+
+	// jobsInspectCmd reports on a plan file, without needing the rest of the job, e.g. one copied from a customer's machine
+	jobsInspectCmd := &cobra.Command{
+		Use:     "inspect",
+		Short:   inspectJobsCmdShortDescription,
+		Long:    inspectJobsCmdLongDescription,
+		Example: inspectJobsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("inspect job command takes no arguments. Give the plan file with --plan-file")
+			}
+			if planFile == "" {
+				return errors.New("the plan file to inspect must be given with --plan-file")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			inspection, err := ste.InspectPlanFile(planFile)
+			if err != nil {
+				glcm.Error(fmt.Sprintf("Failed to inspect plan file %s due to error: %s.", planFile, err))
+			}
+			if !listTransfers {
+				inspection.Transfers = nil
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				if format == common.EOutputFormat.Json() {
+					jsonOutput, err := json.Marshal(inspection)
+					common.PanicIfErr(err)
+					return string(jsonOutput)
+				}
+				return formatPlanFileInspection(inspection)
+			}, common.EExitCode.Success())
+		},
+	}
+
+	jobsCmd.AddCommand(jobsInspectCmd)
+
+	jobsInspectCmd.PersistentFlags().StringVar(&planFile, "plan-file", "", "Path of the plan file to inspect. It does not need to be in the plan folder of this machine.")
+	jobsInspectCmd.PersistentFlags().BoolVar(&listTransfers, "list-transfers", false, "List each transfer in the plan, with its status, as well as the number of transfers in each status.")
+}
+
+func formatPlanFileInspection(i ste.PlanFileInspection) string {
+	var sb strings.Builder
+	line := func(format string, a ...interface{}) {
+		sb.WriteString(fmt.Sprintf(format, a...))
+		sb.WriteString("\n")
+	}
+
+	line("Plan File: %s", i.Path)
+	if i.MigratedFrom != 0 {
+		line("Plan Version: %d (read as version %d)", i.MigratedFrom, ste.DataSchemaVersion)
+	} else {
+		line("Plan Version: %d", i.Version)
+	}
+	line("JobId: %s", i.JobID)
+	if i.IsFinalPart {
+		line("Part Number: %d (final part)", i.PartNum)
+	} else {
+		line("Part Number: %d", i.PartNum)
+	}
+	line("Start Time: %s", i.StartTime.Format(time.RFC3339))
+	if i.FromTo != common.EFromTo.Unknown() {
+		line("From/To: %s", i.FromTo)
+		line("Source: %s", i.SourceRoot)
+		line("Destination: %s", i.DestinationRoot)
+		line("Log Level: %s", i.LogLevel)
+	}
+	if i.CommandString != "" {
+		line("Command: %s", i.CommandString)
+	}
+	if i.Description != "" {
+		line("Description: %s", i.Description)
+	}
+	if len(i.Labels) > 0 {
+		line("Labels: %s", formatJobLabels(i.Labels))
+	}
+	if i.JobStatus != nil {
+		line("Job Status (as of the last update of this part): %s", *i.JobStatus)
+	}
+	line("Number of Transfers: %d", i.NumTransfers)
+
+	statuses := make([]string, 0, len(i.TransferStatusCounts))
+	for status := range i.TransferStatusCounts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		line("  %s: %d", status, i.TransferStatusCounts[status])
+	}
+
+	if len(i.Notes) > 0 {
+		line("")
+		line("Could not read everything:")
+		for _, n := range i.Notes {
+			line("  - %s", n)
+		}
+	}
+
+	if len(i.Transfers) > 0 {
+		line("")
+		for _, t := range i.Transfers {
+			if t.ErrorCode != 0 {
+				line("%-24s %s -> %s (%d bytes, error code %d)", t.Status, t.Source, t.Destination, t.SourceSize, t.ErrorCode)
+			} else {
+				line("%-24s %s -> %s (%d bytes)", t.Status, t.Source, t.Destination, t.SourceSize)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,134 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var jobID common.JobID
+	exportPath := ""
+
+	// jobsJournalCmd shows or exports the journal of a job that was run with --journal
+	jobsJournalCmd := &cobra.Command{
+		Use:     "journal [jobID]",
+		Short:   journalJobsCmdShortDescription,
+		Long:    journalJobsCmdLongDescription,
+		Example: journalJobsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("journal job command requires only the JobID")
+			}
+			// Parse the JobId
+			id, err := common.ParseJobID(args[0])
+			if err != nil {
+				return errors.New("invalid jobId given " + args[0])
+			}
+			jobID = id
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := readTransferJournal(common.TransferJournalFilePath(azcopyLogPathFolder, jobID))
+			if err != nil {
+				glcm.Error(fmt.Sprintf("Failed to read the journal of job %s due to error: %s.", jobID, err))
+			}
+
+			if exportPath != "" {
+				if err = exportTransferJournal(entries, exportPath); err != nil {
+					glcm.Error(fmt.Sprintf("Failed to export the journal of job %s due to error: %s.", jobID, err))
+				}
+				glcm.Exit(func(format common.OutputFormat) string {
+					return fmt.Sprintf("Exported %d journal entries of job %s to %s.", len(entries), jobID, exportPath)
+				}, common.EExitCode.Success())
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				if format == common.EOutputFormat.Json() {
+					jsonOutput, err := json.Marshal(entries)
+					common.PanicIfErr(err)
+					return string(jsonOutput)
+				}
+				return formatTransferJournal(entries)
+			}, common.EExitCode.Success())
+		},
+	}
+
+	jobsCmd.AddCommand(jobsJournalCmd)
+
+	jobsJournalCmd.PersistentFlags().StringVar(&exportPath, "export", "", "Write the journal to this file, as a JSON array of entries, instead of displaying it.")
+}
+
+// readTransferJournal reads every entry of a journal. It is an error for any line not to be a complete entry,
+// since the journal may be the evidence for an audit
+func readTransferJournal(journalPath string) ([]common.TransferJournalEntry, error) {
+	f, err := os.Open(journalPath)
+	if os.IsNotExist(err) {
+		return nil, errors.New("the job has no journal. Only jobs run with --journal have one")
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := make([]common.TransferJournalEntry, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // the paths in an entry can be long
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var entry common.TransferJournalEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d of the journal is not a valid entry: %s", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func exportTransferJournal(entries []common.TransferJournalEntry, exportPath string) error {
+	jsonOutput, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(exportPath, jsonOutput, 0644)
+}
+
+func formatTransferJournal(entries []common.TransferJournalEntry) string {
+	var sb strings.Builder
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("%s %-13s %-24s %s -> %s", e.Time, e.Event, e.Status, e.Source, e.Destination))
+		if e.Detail != "" {
+			sb.WriteString(" (" + e.Detail + ")")
+		}
+		if e.RequestID != "" {
+			sb.WriteString(" X-Ms-Request-Id:" + e.RequestID)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -35,7 +35,17 @@ type ListResponse struct {
 	ErrorMsg string
 }
 
+// jobsListFilters narrows down the jobs shown by jobs list
+type jobsListFilters struct {
+	state  string
+	since  string
+	search string
+	labels []string
+}
+
 func init() {
+	filters := jobsListFilters{}
+
 	// lsCmd represents the listJob command
 	lsCmd := &cobra.Command{
 		Use:     "list",
@@ -52,7 +62,7 @@ func init() {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			err := HandleListJobsCommand()
+			err := HandleListJobsCommand(filters)
 			if err == nil {
 				glcm.Exit(nil, common.EExitCode.Success())
 			} else {
@@ -62,16 +72,78 @@ func init() {
 	}
 
 	jobsCmd.AddCommand(lsCmd)
+
+	lsCmd.PersistentFlags().StringVar(&filters.state, "state", "", "Only list the jobs with this status, for example: Failed, Completed, InProgress, Cancelled.")
+	lsCmd.PersistentFlags().StringVar(&filters.since, "since", "", "Only list the jobs that started within this period, for example 7d or 12h.")
+	lsCmd.PersistentFlags().StringVar(&filters.search, "search", "", "Only list the jobs whose command, source, destination or description contains this text (case insensitive).")
+	lsCmd.PersistentFlags().StringArrayVar(&filters.labels, "label", nil, "Only list the jobs with this label, given as key=value (or just key, for any value). Can be given more than once.")
 }
 
 // HandleListJobsCommand sends the ListJobs request to transfer engine
 // Print the Jobs in the history of Azcopy
-func HandleListJobsCommand() error {
+func HandleListJobsCommand(filters jobsListFilters) error {
+	// validate the filters before the (potentially slow) query
+	keep, err := filters.predicate(time.Now())
+	if err != nil {
+		return err
+	}
+
 	resp := common.ListJobsResponse{}
 	Rpc(common.ERpcCmd.ListJobs(), nil, &resp)
+
+	matching := make([]common.JobIDDetails, 0, len(resp.JobIDDetails))
+	for _, job := range resp.JobIDDetails {
+		if keep(job) {
+			matching = append(matching, job)
+		}
+	}
+	resp.JobIDDetails = matching
+
 	return PrintExistingJobIds(resp)
 }
 
+// predicate parses the filters, and returns a function which decides whether a job should be listed
+func (f jobsListFilters) predicate(now time.Time) (func(job common.JobIDDetails) bool, error) {
+	var state common.JobStatus
+	if f.state != "" {
+		if err := state.Parse(f.state); err != nil {
+			return nil, fmt.Errorf("invalid state %q", f.state)
+		}
+	}
+
+	since, err := parseAge(f.since)
+	if err != nil {
+		return nil, err
+	}
+
+	search := strings.ToLower(f.search)
+
+	labels, err := parseJobLabels(f.labels, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(job common.JobIDDetails) bool {
+		if f.state != "" && job.JobStatus != state {
+			return false
+		}
+		if since > 0 && now.Sub(time.Unix(0, job.StartTime)) > since {
+			return false
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(job.CommandString), search) &&
+			!strings.Contains(strings.ToLower(job.Source), search) &&
+			!strings.Contains(strings.ToLower(job.Destination), search) &&
+			!strings.Contains(strings.ToLower(job.Description), search) {
+			return false
+		}
+		if !jobHasLabels(job.Labels, labels) {
+			return false
+		}
+		return true
+	}, nil
+}
+
 // PrintExistingJobIds prints the response of listOrder command when listOrder command requested the list of existing jobs
 func PrintExistingJobIds(listJobResponse common.ListJobsResponse) error {
 	if listJobResponse.ErrorMessage != "" {
@@ -92,10 +164,25 @@ func PrintExistingJobIds(listJobResponse common.ListJobsResponse) error {
 		sb.WriteString("Existing Jobs \n")
 		for index := 0; index < len(listJobResponse.JobIDDetails); index++ {
 			jobDetail := listJobResponse.JobIDDetails[index]
-			sb.WriteString(fmt.Sprintf("JobId: %s\nStart Time: %s\nStatus: %s\nCommand: %s\n\n",
-				jobDetail.JobId.String(),
-				time.Unix(0, jobDetail.StartTime).Format(time.RFC850),
+			startTime := time.Unix(0, jobDetail.StartTime)
+			sb.WriteString(fmt.Sprintf("JobId: %s\n", jobDetail.JobId.String()))
+			if jobDetail.Description != "" {
+				sb.WriteString(fmt.Sprintf("Description: %s\n", jobDetail.Description))
+			}
+			if len(jobDetail.Labels) > 0 {
+				sb.WriteString(fmt.Sprintf("Labels: %s\n", formatJobLabels(jobDetail.Labels)))
+			}
+			if !jobDetail.AfterJobID.IsEmpty() {
+				sb.WriteString(fmt.Sprintf("After Job: %s\n", describeAfterJob(jobDetail.AfterJobID, listJobResponse.JobIDDetails)))
+			}
+			sb.WriteString(fmt.Sprintf("Start Time: %s (%s ago)\nStatus: %s\nSource: %s\nDestination: %s\nBytes Transferred: %s of %s\nCommand: %s\n\n",
+				startTime.Format(time.RFC850),
+				time.Since(startTime).Round(time.Minute),
 				jobDetail.JobStatus,
+				jobDetail.Source,
+				jobDetail.Destination,
+				byteSizeToString(int64(jobDetail.BytesTransferred)),
+				byteSizeToString(int64(jobDetail.TotalBytes)),
 				jobDetail.CommandString))
 		}
 		return sb.String()
@@ -0,0 +1,293 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var jobID common.JobID
+	follow := false
+	rawLevel := ""
+
+	// jobsLogsCmd shows the log of a job, optionally following it as it is written
+	jobsLogsCmd := &cobra.Command{
+		Use:     "logs [jobID]",
+		Short:   logsJobsCmdShortDescription,
+		Long:    logsJobsCmdLongDescription,
+		Example: logsJobsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("logs job command requires only the JobID")
+			}
+			// Parse the JobId
+			id, err := common.ParseJobID(args[0])
+			if err != nil {
+				return errors.New("invalid jobId given " + args[0])
+			}
+			jobID = id
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			filter, err := newLogLevelFilter(rawLevel)
+			if err != nil {
+				glcm.Error(err.Error())
+			}
+
+			err = showJobLog(azcopyLogPathFolder, jobID, filter, follow, func() bool { return isJobDone(jobID) }, glcm.Info)
+			if err != nil {
+				glcm.Error(fmt.Sprintf("Failed to show the log of job %s due to error: %s.", jobID, err))
+			}
+			glcm.Exit(nil, common.EExitCode.Success())
+		},
+	}
+
+	jobsCmd.AddCommand(jobsLogsCmd)
+
+	jobsLogsCmd.PersistentFlags().BoolVarP(&follow, "follow", "f", false, "Keep showing the log as the job writes it, until the job is done.")
+	jobsLogsCmd.PersistentFlags().StringVar(&rawLevel, "level", "", "Show only the entries of this level or a more severe one: ERROR, WARNING, INFO or DEBUG. By default, all entries are shown.")
+}
+
+// how often a followed log is checked for new lines
+var followLogPollInterval = time.Second
+
+var textLogEntryStart = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+var textLogLevelPrefix = regexp.MustCompile(`^([A-Z]+): `)
+
+// the levels, as they are written in the logs
+var logLevelNames = map[string]common.LogLevel{
+	"ERROR": common.ELogLevel.Error(), // a few messages spell it out
+}
+
+func init() {
+	for _, level := range []common.LogLevel{common.ELogLevel.Fatal(), common.ELogLevel.Panic(), common.ELogLevel.Error(),
+		common.ELogLevel.Warning(), common.ELogLevel.Info(), common.ELogLevel.Debug()} {
+		logLevelNames[level.String()] = level
+	}
+}
+
+// logLevelFilter passes the lines of the log entries of a level of severity or higher. An entry of a text log that spans
+// several lines, such as a request with its headers, is passed or dropped as a whole.
+type logLevelFilter struct {
+	maxLevel     common.LogLevel
+	passingEntry bool
+}
+
+func newLogLevelFilter(rawLevel string) (*logLevelFilter, error) {
+	filter := &logLevelFilter{maxLevel: common.ELogLevel.Debug(), passingEntry: true}
+	if rawLevel == "" {
+		return filter, nil
+	}
+	if err := filter.maxLevel.Parse(rawLevel); err != nil || filter.maxLevel == common.ELogLevel.None() {
+		return nil, fmt.Errorf("invalid log level '%s'. Valid values are ERROR, WARNING, INFO and DEBUG", rawLevel)
+	}
+	return filter, nil
+}
+
+func (f *logLevelFilter) passes(line string) bool {
+	if _, level, ok := parseLogEntry(line); ok {
+		f.passingEntry = level <= f.maxLevel
+	}
+	return f.passingEntry
+}
+
+// parseLogEntry returns the message and level of the log entry that the line starts.
+// It returns false for the lines after the first of an entry of a text log.
+func parseLogEntry(line string) (message string, level common.LogLevel, ok bool) {
+	if strings.HasPrefix(line, "{") {
+		var entry struct{ Level, Message string }
+		if json.Unmarshal([]byte(line), &entry) == nil {
+			level, found := logLevelNames[entry.Level]
+			if !found {
+				level = common.ELogLevel.Info()
+			}
+			return entry.Message, level, true
+		}
+	}
+
+	start := textLogEntryStart.FindStringIndex(line)
+	if start == nil {
+		return "", common.ELogLevel.None(), false
+	}
+	message = line[start[1]:]
+	level = common.ELogLevel.Info() // text logs only mark the level of some messages
+	if prefix := textLogLevelPrefix.FindStringSubmatch(message); prefix != nil {
+		if l, found := logLevelNames[prefix[1]]; found {
+			level = l
+		}
+	}
+	return message, level, true
+}
+
+// isJobDone says, from the plan files of the job, whether it has finished, or been paused, so that its log won't grow any more
+func isJobDone(jobID common.JobID) bool {
+	var status common.GetJobStatusResponse
+	Rpc(common.ERpcCmd.GetJobStatus(), &common.GetJobStatusRequest{JobID: jobID}, &status)
+	if status.ErrorMsg != "" {
+		return false // it may not have been ordered yet
+	}
+	return status.JobStatus.IsJobDone() || status.JobStatus == common.EJobStatus.Paused()
+}
+
+// showJobLog outputs the lines of the job's log that pass the filter. When following, the current file of the log is
+// read as it is written, until the job is done.
+func showJobLog(logFolder string, jobID common.JobID, filter *logLevelFilter, follow bool, jobDone func() bool, output func(string)) error {
+	files, err := common.JobLogFiles(logFolder, jobID)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && !follow {
+		return fmt.Errorf("the job has no log in %s", logFolder)
+	}
+
+	currentPath := filepath.Join(logFolder, jobID.String()+".log")
+	for _, path := range files {
+		if follow && path == currentPath {
+			break // the job may be writing to it
+		}
+		if err = showLogFile(path, filter, output); err != nil {
+			return err
+		}
+	}
+
+	if follow {
+		return followLogFile(currentPath, filter, jobDone, output)
+	}
+	return nil
+}
+
+func showLogFile(path string, filter *logLevelFilter, output func(string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	rest, err := showLogLines(bufio.NewReader(r), "", filter, output)
+	if err != nil {
+		return err
+	}
+	if rest != "" && filter.passes(rest) {
+		output(rest) // the file is complete, so a last line without a line ending is still a line
+	}
+	return nil
+}
+
+// showLogLines outputs the lines that the reader has, and returns what's left after the last line ending,
+// which is the start of a line that's still being written, when following a log
+func showLogLines(r *bufio.Reader, partialLine string, filter *logLevelFilter, output func(string)) (rest string, err error) {
+	for {
+		chunk, err := r.ReadString('\n')
+		if err == io.EOF {
+			return partialLine + chunk, nil
+		} else if err != nil {
+			return partialLine, err
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(partialLine+chunk, "\n"), "\r")
+		partialLine = ""
+
+		if filter.passes(line) {
+			output(line)
+		}
+	}
+}
+
+// followLogFile outputs the lines of the log as they are written, until the job is done.
+// When the log is rotated, the rest of the old file is read before moving on to the new one.
+func followLogFile(path string, filter *logLevelFilter, jobDone func() bool, output func(string)) error {
+	var file *os.File
+	var reader *bufio.Reader
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	partialLine := ""
+	for {
+		// checked before reading, so that the last lines, which are written before the job is marked done, are read
+		done := jobDone()
+
+		if file == nil {
+			f, err := os.Open(path)
+			if os.IsNotExist(err) {
+				if _, err := os.Stat(path + ".gz"); err == nil {
+					return nil // the log was closed and compressed, so has already been shown
+				}
+				if done {
+					return nil // the job never wrote a log, e.g. because its log level is NONE
+				}
+				time.Sleep(followLogPollInterval) // the job hasn't started logging yet
+				continue
+			} else if err != nil {
+				return err
+			}
+			file = f
+			reader = bufio.NewReader(file)
+		}
+
+		// see whether the log was rotated before reading, so that nothing written to the old file is missed
+		followedInfo, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		currentInfo, err := os.Stat(path)
+		rotated := err != nil || !os.SameFile(followedInfo, currentInfo)
+
+		if partialLine, err = showLogLines(reader, partialLine, filter, output); err != nil {
+			return err
+		}
+
+		if rotated {
+			file.Close()
+			file = nil
+			continue
+		}
+		if done {
+			return nil
+		}
+		time.Sleep(followLogPollInterval)
+	}
+}
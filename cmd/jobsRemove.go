@@ -29,6 +29,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
 	"github.com/spf13/cobra"
 )
 
@@ -85,11 +86,14 @@ func handleRemoveSingleJob(jobID common.JobID) error {
 		return err
 	}
 
+	// and of any cap that was set for it while it ran
+	_ = os.Remove(ste.JobCapFilePath(azcopyJobPlanFolder, jobID))
+
 	// get rid of the logs
 	// even though we only have 1 file right now, still scan the directory since we may change the
 	// way we name the logs in the future (with suffix or whatnot)
 	numLogFileRemoved, err := removeFilesWithPredicate(azcopyLogPathFolder, func(s string) bool {
-		if strings.Contains(s, jobID.String()) && strings.HasSuffix(s, ".log") {
+		if strings.Contains(s, jobID.String()) && common.IsLogFileName(s) {
 			return true
 		}
 		return false
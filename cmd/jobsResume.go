@@ -85,7 +85,8 @@ func (cca *resumeJobController) ReportProgressOrExit(lcm common.LifecycleMgr) {
 	// fetch a job status
 	var summary common.ListJobSummaryResponse
 	Rpc(common.ERpcCmd.ListJobSummary(), &cca.jobID, &summary)
-	jobDone := summary.JobStatus.IsJobDone()
+	// a job that was paused (e.g. because the account is failing over) won't make any more progress in this run
+	jobDone := summary.JobStatus.IsJobDone() || summary.JobStatus == common.EJobStatus.Paused()
 
 	// if json is not desired, and job is done, then we generate a special end message to conclude the job
 	duration := time.Now().Sub(cca.jobStartTime) // report the total run time of the job
@@ -111,7 +112,7 @@ func (cca *resumeJobController) ReportProgressOrExit(lcm common.LifecycleMgr) {
 					summary.TransfersFailed,
 					summary.TransfersSkipped,
 					summary.TotalBytesTransferred,
-					summary.JobStatus)
+					summary.JobStatus) + formatContentPolicyReport(summary)
 			}
 		}, exitCode)
 	}
@@ -151,7 +152,7 @@ func (cca *resumeJobController) ReportProgressOrExit(lcm common.LifecycleMgr) {
 			// indicate whether constrained by disk or not
 			perfString, diskString := getPerfDisplayText(summary.PerfStrings, summary.PerfConstraint, duration, false)
 
-			return fmt.Sprintf("%.1f %%, %v Done, %v Failed, %v Pending, %v Skipped, %v Total%s, %s%s%s",
+			return common.UserMessages().Sprintf(common.MsgCopyProgress,
 				summary.PercentComplete,
 				summary.TransfersCompleted,
 				summary.TransfersFailed,
@@ -184,7 +185,7 @@ func init() {
 		Run: func(cmd *cobra.Command, args []string) {
 			err := resumeCmdArgs.process()
 			if err != nil {
-				glcm.Error(fmt.Sprintf("failed to perform resume command due to error: %s", err.Error()))
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToPerformCommand, "resume", err.Error()))
 			}
 			glcm.Exit(nil, common.EExitCode.Success())
 		},
@@ -200,6 +201,37 @@ func init() {
 	resumeCmd.PersistentFlags().StringVar(&resumeCmdArgs.DestinationSAS, "destination-sas", "", "destination SAS token of the destination for a given Job ID.")
 }
 
+// getJobCredentialInfo works out the credential to use for an existing job, as when it was started
+func getJobCredentialInfo(fromToInfo common.GetJobFromToResponse, sourceSAS, destinationSAS, commandName string) (common.CredentialInfo, error) {
+	ctx := context.TODO()
+	// Initialize credential info.
+	credentialInfo := common.CredentialInfo{}
+	var err error
+	// TODO: Replace context with root context
+	if credentialInfo.CredentialType, err = getCredentialType(ctx, rawFromToInfo{
+		fromTo:         fromToInfo.FromTo,
+		source:         fromToInfo.Source,
+		destination:    fromToInfo.Destination,
+		sourceSAS:      sourceSAS,
+		destinationSAS: destinationSAS,
+	}); err != nil {
+		return credentialInfo, err
+	} else if credentialInfo.CredentialType == common.ECredentialType.OAuthToken() {
+		// Message user that they are using Oauth token for authentication,
+		// in case of silently using cached token without consciousness。
+		glcm.Info(commandName + " is using OAuth token for authentication.")
+
+		uotm := GetUserOAuthTokenManagerInstance()
+		// Get token from env var or cache.
+		if tokenInfo, err := uotm.GetTokenInfo(ctx); err != nil {
+			return credentialInfo, err
+		} else {
+			credentialInfo.OAuthTokenInfo = *tokenInfo
+		}
+	}
+	return credentialInfo, nil
+}
+
 type resumeCmdArgs struct {
 	jobID           string
 	includeTransfer string
@@ -267,30 +299,18 @@ func (rca resumeCmdArgs) process() error {
 		return errors.New("resuming benchmark jobs is not supported")
 	}
 
-	ctx := context.TODO()
-	// Initialize credential info.
-	credentialInfo := common.CredentialInfo{}
-	// TODO: Replace context with root context
-	if credentialInfo.CredentialType, err = getCredentialType(ctx, rawFromToInfo{
-		fromTo:         getJobFromToResponse.FromTo,
-		source:         getJobFromToResponse.Source,
-		destination:    getJobFromToResponse.Destination,
-		sourceSAS:      rca.SourceSAS,
-		destinationSAS: rca.DestinationSAS,
-	}); err != nil {
-		return err
-	} else if credentialInfo.CredentialType == common.ECredentialType.OAuthToken() {
-		// Message user that they are using Oauth token for authentication,
-		// in case of silently using cached token without consciousness。
-		glcm.Info("Resume is using OAuth token for authentication.")
-
-		uotm := GetUserOAuthTokenManagerInstance()
-		// Get token from env var or cache.
-		if tokenInfo, err := uotm.GetTokenInfo(ctx); err != nil {
+	// the source was read with a user delegation SAS that was minted from the login. It isn't kept anywhere, so a new one is minted,
+	// unless the user gave a SAS of their own
+	if getJobFromToResponse.SourceSASFromLogin && rca.SourceSAS == "" {
+		if rca.SourceSAS, err = getUserDelegationSASFromLogin(context.TODO(), getJobFromToResponse.Source); err != nil {
 			return err
-		} else {
-			credentialInfo.OAuthTokenInfo = *tokenInfo
 		}
+		glcm.Info("The source is authorized with a new user delegation SAS generated from the current login. It is valid for 7 days.")
+	}
+
+	credentialInfo, err := getJobCredentialInfo(getJobFromToResponse, rca.SourceSAS, rca.DestinationSAS, "Resume")
+	if err != nil {
+		return err
 	}
 
 	// Send resume job request.
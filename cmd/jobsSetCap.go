@@ -0,0 +1,81 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var jobID common.JobID
+
+	// jobsSetCapCmd changes the cap of a running job, without having to cancel and resume it
+	jobsSetCapCmd := &cobra.Command{
+		Use:     "set-cap [jobID]",
+		Short:   setCapJobsCmdShortDescription,
+		Long:    setCapJobsCmdLongDescription,
+		Example: setCapJobsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("set-cap job command requires only the JobID")
+			}
+			// Parse the JobId
+			id, err := common.ParseJobID(args[0])
+			if err != nil {
+				return errors.New("invalid jobId given " + args[0])
+			}
+			jobID = id
+
+			// the cap is given with the usual cap-mbps flag, but here it must be given, since zero removes the cap
+			if !cmd.Flags().Changed("cap-mbps") {
+				return errors.New("the new cap must be given with --cap-mbps (0 removes the cap)")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := setJobCap(jobID, cmdLineCapMegaBitsPerSecond); err != nil {
+				glcm.Error(fmt.Sprintf("Failed to change the cap of job %s due to error: %s.", jobID, err))
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				if cmdLineCapMegaBitsPerSecond == 0 {
+					return fmt.Sprintf("The cap of job %s will be removed within a few seconds.", jobID)
+				}
+				return fmt.Sprintf("The cap of job %s will be changed to %d Mbps within a few seconds.", jobID, cmdLineCapMegaBitsPerSecond)
+			}, common.EExitCode.Success())
+		},
+	}
+
+	jobsCmd.AddCommand(jobsSetCapCmd)
+}
+
+func setJobCap(jobID common.JobID, capMbps uint32) error {
+	var resp common.SetJobCapResponse
+	Rpc(common.ERpcCmd.SetJobCap(), &common.SetJobCapRequest{JobID: jobID, CapMbps: capMbps}, &resp)
+	if resp.ErrorMsg != "" {
+		return errors.New(resp.ErrorMsg)
+	}
+	return nil
+}
@@ -151,6 +151,24 @@ func PrintJobProgressSummary(summary common.ListJobSummaryResponse) {
 			summary.TransfersSkipped,
 			summary.PercentComplete, // noted as approx in the format string because won't include in-flight files if this Show command is run from a different process
 			summary.JobStatus,
-		)
+		) + formatContentPolicyReport(summary) + formatConcurrencySettings(summary.Concurrency)
 	}, common.EExitCode.Success())
 }
+
+// formatConcurrencySettings lists the concurrency settings that the job ran with, or nothing if they weren't recorded
+func formatConcurrencySettings(settings []common.ConcurrencySetting) string {
+	if len(settings) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\nConcurrency (of the latest run)\n")
+	for _, setting := range settings {
+		sb.WriteString(setting.Name + ": " + setting.Value)
+		if setting.Source != "" {
+			sb.WriteString(" (" + setting.Source + ")")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var jobID common.JobID
+	sourceSAS, destinationSAS := "", ""
+
+	// jobsVerifyCmd checks the destinations of a finished job, and requeues the ones that don't match
+	jobsVerifyCmd := &cobra.Command{
+		Use:     "verify [jobID]",
+		Short:   verifyJobsCmdShortDescription,
+		Long:    verifyJobsCmdLongDescription,
+		Example: verifyJobsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("verify job command requires only the JobID")
+			}
+			// Parse the JobId
+			id, err := common.ParseJobID(args[0])
+			if err != nil {
+				return errors.New("invalid jobId given " + args[0])
+			}
+			jobID = id
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			report, err := verifyJob(jobID, sourceSAS, destinationSAS)
+			if err != nil {
+				glcm.Error(fmt.Sprintf("Failed to verify job %s due to error: %s.", jobID, err))
+			}
+
+			exitCode := common.EExitCode.Success()
+			if len(report.Discrepancies) > 0 || len(report.NotChecked) > 0 {
+				exitCode = common.EExitCode.Error()
+			}
+			glcm.Exit(func(format common.OutputFormat) string {
+				if format == common.EOutputFormat.Json() {
+					jsonOutput, err := json.Marshal(report)
+					common.PanicIfErr(err)
+					return string(jsonOutput)
+				}
+				return formatVerificationReport(jobID, report)
+			}, exitCode)
+		},
+	}
+
+	jobsCmd.AddCommand(jobsVerifyCmd)
+
+	jobsVerifyCmd.PersistentFlags().StringVar(&sourceSAS, "source-sas", "", "SAS token of the source of the job, needed to read the hashes of the sources of downloads.")
+	jobsVerifyCmd.PersistentFlags().StringVar(&destinationSAS, "destination-sas", "", "SAS token of the destination of the job.")
+}
+
+func verifyJob(jobID common.JobID, sourceSAS, destinationSAS string) (common.VerifyJobResponse, error) {
+	// Get fromTo info, so we can decide what's the proper credential type to use.
+	var getJobFromToResponse common.GetJobFromToResponse
+	Rpc(common.ERpcCmd.GetJobFromTo(),
+		&common.GetJobFromToRequest{JobID: jobID},
+		&getJobFromToResponse)
+	if getJobFromToResponse.ErrorMsg != "" {
+		return common.VerifyJobResponse{}, errors.New(getJobFromToResponse.ErrorMsg)
+	}
+
+	credentialInfo, err := getJobCredentialInfo(getJobFromToResponse, sourceSAS, destinationSAS, "Verify")
+	if err != nil {
+		return common.VerifyJobResponse{}, err
+	}
+
+	glcm.Info(fmt.Sprintf("Verifying the destinations of job %s...", jobID))
+	var report common.VerifyJobResponse
+	Rpc(common.ERpcCmd.VerifyJob(),
+		&common.VerifyJobRequest{
+			JobID:          jobID,
+			SourceSAS:      sourceSAS,
+			DestinationSAS: destinationSAS,
+			CredentialInfo: credentialInfo,
+		},
+		&report)
+	if report.ErrorMsg != "" {
+		return report, errors.New(report.ErrorMsg)
+	}
+	return report, nil
+}
+
+func formatVerificationReport(jobID common.JobID, report common.VerifyJobResponse) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\nJob %s verification\nTransfers Verified: %d\nHashes Not Checked: %d\nDiscrepancies: %d\nNot Checked: %d\nReport: %s\n",
+		jobID, report.TransfersVerified, report.HashesNotChecked, len(report.Discrepancies), len(report.NotChecked), report.ReportPath))
+
+	for _, d := range report.Discrepancies {
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", d.Dst, d.Problem))
+	}
+	if len(report.Discrepancies) > 0 {
+		sb.WriteString("The transfers with discrepancies are marked as failed. Run 'azcopy jobs resume " + jobID.String() + "' to transfer them again.\n")
+	}
+
+	for _, d := range report.NotChecked {
+		sb.WriteString(fmt.Sprintf("  %s could not be checked: %s\n", d.Dst, d.Problem))
+	}
+	if len(report.NotChecked) > 0 {
+		sb.WriteString("Run the verification again to check the destinations that could not be checked.\n")
+	}
+	return sb.String()
+}
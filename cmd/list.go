@@ -22,11 +22,17 @@ package cmd
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 	"github.com/Azure/azure-storage-azcopy/ste"
@@ -76,14 +82,36 @@ func init() {
 	listContainerCmd.PersistentFlags().BoolVar(&parameters.MachineReadable, "machine-readable", false, "Lists file sizes in bytes.")
 	listContainerCmd.PersistentFlags().BoolVar(&parameters.RunningTally, "running-tally", false, "Counts the total number of files and their sizes.")
 	listContainerCmd.PersistentFlags().BoolVar(&parameters.MegaUnits, "mega-units", false, "Displays units in orders of 1000, not 1024.")
+	listContainerCmd.PersistentFlags().IntVar(&parameters.MaxDepth, "max-depth", 0, "Only list blobs this many levels or fewer below the container or virtual directory. 1 means only the blobs directly inside it. (default 0, meaning no limit)")
+	listContainerCmd.PersistentFlags().StringVar(&parameters.OutputFile, "output-file", "", "Write the listing to this file, one row per blob, instead of displaying it.")
+	listContainerCmd.PersistentFlags().StringVar(&parameters.OutputFileFormat, "output-file-format", "", "Format of the file given by output-file: csv or parquet. By default it is inferred from the file extension.")
+	listContainerCmd.PersistentFlags().BoolVar(&parameters.ColdDataReport, "cold-data-report", false, "Instead of listing the blobs, report which block blobs have not been modified recently and could be moved to the Cool or Archive tier, with an estimate of the saving.")
+	listContainerCmd.PersistentFlags().IntVar(&parameters.CoolAfterDays, "cool-after-days", 30, "With cold-data-report, recommend Hot blobs not modified for this many days for the Cool tier. Zero disables the recommendation.")
+	listContainerCmd.PersistentFlags().IntVar(&parameters.ArchiveAfterDays, "archive-after-days", 180, "With cold-data-report, recommend blobs not modified for this many days for the Archive tier. Zero disables the recommendation.")
+	listContainerCmd.PersistentFlags().StringVar(&parameters.TierManifest, "tier-manifest", "", "With cold-data-report, write the recommended tier changes to this CSV file (columns Name, CurrentTier, RecommendedTier).")
+	listContainerCmd.PersistentFlags().Float64Var(&parameters.HotPricePerGB, "price-per-gb-hot", defaultHotPricePerGB, "With cold-data-report, the monthly price per GB of the Hot tier, used to estimate savings.")
+	listContainerCmd.PersistentFlags().Float64Var(&parameters.CoolPricePerGB, "price-per-gb-cool", defaultCoolPricePerGB, "With cold-data-report, the monthly price per GB of the Cool tier, used to estimate savings.")
+	listContainerCmd.PersistentFlags().Float64Var(&parameters.ArchivePricePerGB, "price-per-gb-archive", defaultArchivePricePerGB, "With cold-data-report, the monthly price per GB of the Archive tier, used to estimate savings.")
 
 	rootCmd.AddCommand(listContainerCmd)
 }
 
 type ListParameters struct {
-	MachineReadable bool
-	RunningTally    bool
-	MegaUnits       bool
+	MachineReadable  bool
+	RunningTally     bool
+	MegaUnits        bool
+	MaxDepth         int
+	OutputFile       string
+	OutputFileFormat string
+
+	// cold data analysis
+	ColdDataReport    bool
+	CoolAfterDays     int
+	ArchiveAfterDays  int
+	TierManifest      string
+	HotPricePerGB     float64
+	CoolPricePerGB    float64
+	ArchivePricePerGB float64
 }
 
 var parameters = ListParameters{}
@@ -111,7 +139,7 @@ func HandleListContainerCommand(source string) (err error) {
 	}
 
 	// Create Pipeline which will be used further in the blob operations.
-	p, err := createBlobPipeline(ctx, credentialInfo)
+	p, err := initListingPipeline(ctx, common.ELocation.Blob(), credentialInfo)
 	if err != nil {
 		return err
 	}
@@ -140,58 +168,264 @@ func HandleListContainerCommand(source string) (err error) {
 		}
 	}
 
+	if parameters.MaxDepth < 0 {
+		return errors.New("max-depth cannot be negative")
+	}
+
 	summary := common.ListContainerResponse{}
 
+	var rowWriter listRowWriter
+	if parameters.OutputFile != "" {
+		if rowWriter, err = newListRowWriter(parameters.OutputFile, parameters.OutputFileFormat); err != nil {
+			return err
+		}
+	}
+
+	var analyzer *coldDataAnalyzer
+	if parameters.ColdDataReport {
+		if parameters.CoolAfterDays < 0 || parameters.ArchiveAfterDays < 0 {
+			return errors.New("cool-after-days and archive-after-days cannot be negative")
+		}
+		var manifest *os.File
+		if parameters.TierManifest != "" {
+			if manifest, err = os.Create(parameters.TierManifest); err != nil {
+				return fmt.Errorf("cannot create the tier manifest: %s", err.Error())
+			}
+			defer manifest.Close()
+		}
+		analyzer = newColdDataAnalyzer(time.Now(), parameters.CoolAfterDays, parameters.ArchiveAfterDays,
+			parameters.HotPricePerGB, parameters.CoolPricePerGB, parameters.ArchivePricePerGB, manifest)
+	} else if parameters.TierManifest != "" {
+		return errors.New("tier-manifest can only be used with cold-data-report")
+	}
+
 	fileCount := 0
 	sizeCount := 0
 
-	// perform a list blob
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		// look for all blobs that start with the prefix
-		listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker,
-			azblob.ListBlobsSegmentOptions{Prefix: searchPrefix})
-		if err != nil {
-			return fmt.Errorf("cannot list blobs for download. Failed with error %s", err.Error())
+	// perform a list blob. With max-depth, the virtual directories are listed one at a time instead of all at once,
+	// so that those whose blobs are too deep are never listed
+	prefixes := []string{searchPrefix}
+	listSegment := func(prefix string, marker azblob.Marker) ([]azblob.BlobItem, azblob.Marker, error) {
+		if parameters.MaxDepth <= 0 {
+			listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: prefix})
+			if err != nil {
+				return nil, marker, err
+			}
+			return listBlob.Segment.BlobItems, listBlob.NextMarker, nil
 		}
 
-		// Process the blobs returned in this result segment (if the segment is empty, the loop body won't execute)
-		for _, blobInfo := range listBlob.Segment.BlobItems {
-			blobName := blobInfo.Name + "; Content Size: "
+		listBlob, err := containerURL.ListBlobsHierarchySegment(ctx, marker, "/", azblob.ListBlobsSegmentOptions{Prefix: prefix})
+		if err != nil {
+			return nil, marker, err
+		}
+		for _, virtualDir := range listBlob.Segment.BlobPrefixes {
+			if relativePathDepth(strings.TrimPrefix(virtualDir.Name, searchPrefix)) < parameters.MaxDepth {
+				prefixes = append(prefixes, virtualDir.Name)
+			}
+		}
+		return listBlob.Segment.BlobItems, listBlob.NextMarker, nil
+	}
 
-			if parameters.MachineReadable {
-				blobName += strconv.Itoa(int(*blobInfo.Properties.ContentLength))
-			} else {
-				blobName += byteSizeToString(*blobInfo.Properties.ContentLength)
+	for len(prefixes) > 0 {
+		prefix := prefixes[0]
+		prefixes = prefixes[1:]
+		for marker := (azblob.Marker{}); marker.NotDone(); {
+			// look for all blobs that start with the prefix
+			blobItems, nextMarker, err := listSegment(prefix, marker)
+			if err != nil {
+				return fmt.Errorf("cannot list blobs for download. Failed with error %s", err.Error())
 			}
 
-			if parameters.RunningTally {
-				fileCount++
-				sizeCount += int(*blobInfo.Properties.ContentLength)
+			// Process the blobs returned in this result segment (if the segment is empty, the loop body won't execute)
+			for _, blobInfo := range blobItems {
+
+				if analyzer != nil {
+					err = analyzer.observe(blobInfo.Name, *blobInfo.Properties.ContentLength, blobInfo.Properties.LastModified,
+						blobInfo.Properties.BlobType, blobInfo.Properties.AccessTier)
+					if err != nil {
+						return fmt.Errorf("cannot write to the tier manifest: %s", err.Error())
+					}
+				}
+
+				if rowWriter != nil {
+					fileCount++
+					sizeCount += int(*blobInfo.Properties.ContentLength)
+					if err = rowWriter.WriteBlob(blobInfo); err != nil {
+						rowWriter.Close()
+						return fmt.Errorf("cannot write to %s: %s", parameters.OutputFile, err.Error())
+					}
+					continue
+				}
+
+				if analyzer != nil {
+					continue // the report replaces the normal listing
+				}
+
+				blobName := blobInfo.Name + "; Content Size: "
+
+				if parameters.MachineReadable {
+					blobName += strconv.Itoa(int(*blobInfo.Properties.ContentLength))
+				} else {
+					blobName += byteSizeToString(*blobInfo.Properties.ContentLength)
+				}
+
+				if parameters.RunningTally {
+					fileCount++
+					sizeCount += int(*blobInfo.Properties.ContentLength)
+				}
+
+				if len(searchPrefix) > 0 {
+					// strip away search prefix from the blob name.
+					blobName = strings.Replace(blobName, searchPrefix, "", 1)
+				}
+				summary.Blobs = append(summary.Blobs, blobName)
 			}
+			marker = nextMarker
+			printListContainerResponse(&summary)
 
-			if len(searchPrefix) > 0 {
-				// strip away search prefix from the blob name.
-				blobName = strings.Replace(blobName, searchPrefix, "", 1)
+			if parameters.RunningTally {
+				glcm.Info("")
+				glcm.Info("File count: " + strconv.Itoa(fileCount))
+
+				if parameters.MachineReadable {
+					glcm.Info("Total file size: " + strconv.Itoa(sizeCount))
+				} else {
+					glcm.Info("Total file size: " + byteSizeToString(int64(sizeCount)))
+				}
 			}
-			summary.Blobs = append(summary.Blobs, blobName)
 		}
-		marker = listBlob.NextMarker
-		printListContainerResponse(&summary)
+	}
 
-		if parameters.RunningTally {
-			glcm.Info("")
-			glcm.Info("File count: " + strconv.Itoa(fileCount))
+	if rowWriter != nil {
+		if err = rowWriter.Close(); err != nil {
+			return fmt.Errorf("cannot write to %s: %s", parameters.OutputFile, err.Error())
+		}
+		glcm.Info(fmt.Sprintf("Wrote %d blobs (%s) to %s", fileCount, byteSizeToString(int64(sizeCount)), parameters.OutputFile))
+	}
 
-			if parameters.MachineReadable {
-				glcm.Info("Total file size: " + strconv.Itoa(sizeCount))
-			} else {
-				glcm.Info("Total file size: " + byteSizeToString(int64(sizeCount)))
-			}
+	if analyzer != nil {
+		if err = analyzer.flush(); err != nil {
+			return fmt.Errorf("cannot write to the tier manifest: %s", err.Error())
+		}
+		for _, line := range analyzer.report() {
+			glcm.Info(line)
 		}
 	}
 	return nil
 }
 
+// listRowWriter writes the listing to a file in a format suitable for loading into analytics tools,
+// which is far more convenient than post-processing the displayed output when there are millions of blobs
+type listRowWriter interface {
+	WriteBlob(blobInfo azblob.BlobItem) error
+	Close() error
+}
+
+// the columns written by listRowWriter. They are named as in blob inventory reports.
+var listOutputColumns = []common.ParquetColumn{
+	{Name: "Name", Type: common.EParquetColumnType.String()},
+	{Name: "Content-Length", Type: common.EParquetColumnType.Int64()},
+	{Name: "Last-Modified", Type: common.EParquetColumnType.Timestamp()},
+	{Name: "BlobType", Type: common.EParquetColumnType.String()},
+	{Name: "AccessTier", Type: common.EParquetColumnType.String()},
+	{Name: "Content-Type", Type: common.EParquetColumnType.String()},
+	{Name: "Content-MD5", Type: common.EParquetColumnType.String()},
+}
+
+func listOutputValues(blobInfo azblob.BlobItem) []interface{} {
+	return []interface{}{
+		blobInfo.Name,
+		*blobInfo.Properties.ContentLength,
+		blobInfo.Properties.LastModified,
+		string(blobInfo.Properties.BlobType),
+		string(blobInfo.Properties.AccessTier),
+		common.IffStringNotNil(blobInfo.Properties.ContentType, ""),
+		base64.StdEncoding.EncodeToString(blobInfo.Properties.ContentMD5),
+	}
+}
+
+func newListRowWriter(path string, format string) (listRowWriter, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	switch strings.ToLower(format) {
+	case "csv":
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w := &csvListRowWriter{file: f, w: csv.NewWriter(f)}
+		header := make([]string, len(listOutputColumns))
+		for i, c := range listOutputColumns {
+			header[i] = c.Name
+		}
+		if err = w.w.Write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return w, nil
+	case "parquet":
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		pw, err := common.NewParquetWriter(f, listOutputColumns)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &parquetListRowWriter{file: f, w: pw}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output file format '%s'. Use csv or parquet", format)
+	}
+}
+
+type csvListRowWriter struct {
+	file io.WriteCloser
+	w    *csv.Writer
+}
+
+func (c *csvListRowWriter) WriteBlob(blobInfo azblob.BlobItem) error {
+	values := listOutputValues(blobInfo)
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch typed := v.(type) {
+		case time.Time:
+			record[i] = typed.UTC().Format(time.RFC3339)
+		default:
+			record[i] = fmt.Sprint(typed)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvListRowWriter) Close() error {
+	c.w.Flush()
+	err := c.w.Error()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type parquetListRowWriter struct {
+	file io.WriteCloser
+	w    *common.ParquetWriter
+}
+
+func (p *parquetListRowWriter) WriteBlob(blobInfo azblob.BlobItem) error {
+	return p.w.WriteRow(listOutputValues(blobInfo)...)
+}
+
+func (p *parquetListRowWriter) Close() error {
+	err := p.w.Close()
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 // printListContainerResponse prints the list container response
 func printListContainerResponse(lsResponse *common.ListContainerResponse) {
 	if len(lsResponse.Blobs) == 0 {
@@ -0,0 +1,172 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// Indicative pay-as-you-go storage prices, in USD per GB per month, used to estimate savings from re-tiering.
+// Actual prices vary by region and redundancy, so they can be overridden on the command line.
+const (
+	defaultHotPricePerGB     = 0.0184
+	defaultCoolPricePerGB    = 0.01
+	defaultArchivePricePerGB = 0.00099
+)
+
+// coldDataAgeBucket groups blobs by how long ago they were last modified
+type coldDataAgeBucket struct {
+	label   string
+	maxDays int // upper bound (exclusive), or 0 for the last, unbounded, bucket
+	count   int64
+	bytes   int64
+}
+
+// coldDataAnalyzer looks at the last modified time of each block blob, and recommends moving blobs that have not been
+// modified for a long time to a cooler tier. It builds the age distribution, estimates the monthly saving, and can write a
+// manifest of the recommended tier changes.
+type coldDataAnalyzer struct {
+	now          time.Time
+	coolAfter    time.Duration
+	archiveAfter time.Duration
+	prices       map[azblob.AccessTierType]float64
+
+	buckets []coldDataAgeBucket
+
+	// totals of the blobs that are recommended for each tier
+	candidates      map[azblob.AccessTierType]int64
+	candidateBytes  map[azblob.AccessTierType]int64
+	monthlySavings  float64
+	manifest        *csv.Writer
+	manifestWritten bool
+}
+
+func newColdDataAnalyzer(now time.Time, coolAfterDays, archiveAfterDays int, hotPrice, coolPrice, archivePrice float64, manifest io.Writer) *coldDataAnalyzer {
+	a := &coldDataAnalyzer{
+		now:          now,
+		coolAfter:    time.Duration(coolAfterDays) * 24 * time.Hour,
+		archiveAfter: time.Duration(archiveAfterDays) * 24 * time.Hour,
+		prices: map[azblob.AccessTierType]float64{
+			azblob.AccessTierHot:     hotPrice,
+			azblob.AccessTierCool:    coolPrice,
+			azblob.AccessTierArchive: archivePrice,
+		},
+		buckets: []coldDataAgeBucket{
+			{label: "under 30 days", maxDays: 30},
+			{label: "30 to 90 days", maxDays: 90},
+			{label: "90 to 180 days", maxDays: 180},
+			{label: "180 to 365 days", maxDays: 365},
+			{label: "over 365 days"},
+		},
+		candidates:     make(map[azblob.AccessTierType]int64),
+		candidateBytes: make(map[azblob.AccessTierType]int64),
+	}
+	if manifest != nil {
+		a.manifest = csv.NewWriter(manifest)
+	}
+	return a
+}
+
+// recommendTier returns the tier that the blob should be moved to, or AccessTierNone if it should stay where it is.
+// Blobs are only ever moved to a cooler tier.
+func (a *coldDataAnalyzer) recommendTier(lastModified time.Time, currentTier azblob.AccessTierType) azblob.AccessTierType {
+	if currentTier == azblob.AccessTierNone {
+		currentTier = azblob.AccessTierHot // the account default, which applies when the tier is inferred
+	}
+
+	age := a.now.Sub(lastModified)
+	switch {
+	case a.archiveAfter > 0 && age >= a.archiveAfter && currentTier != azblob.AccessTierArchive:
+		return azblob.AccessTierArchive
+	case a.coolAfter > 0 && age >= a.coolAfter && currentTier == azblob.AccessTierHot:
+		return azblob.AccessTierCool
+	default:
+		return azblob.AccessTierNone
+	}
+}
+
+func (a *coldDataAnalyzer) observe(name string, size int64, lastModified time.Time, blobType azblob.BlobType, currentTier azblob.AccessTierType) error {
+	// only block blobs can be tiered
+	if blobType != azblob.BlobBlockBlob {
+		return nil
+	}
+
+	ageDays := int(a.now.Sub(lastModified).Hours() / 24)
+	for i := range a.buckets {
+		if a.buckets[i].maxDays == 0 || ageDays < a.buckets[i].maxDays {
+			a.buckets[i].count++
+			a.buckets[i].bytes += size
+			break
+		}
+	}
+
+	target := a.recommendTier(lastModified, currentTier)
+	if target == azblob.AccessTierNone {
+		return nil
+	}
+	if currentTier == azblob.AccessTierNone {
+		currentTier = azblob.AccessTierHot
+	}
+
+	a.candidates[target]++
+	a.candidateBytes[target] += size
+	a.monthlySavings += float64(size) / (1024 * 1024 * 1024) * (a.prices[currentTier] - a.prices[target])
+
+	if a.manifest != nil {
+		if !a.manifestWritten {
+			if err := a.manifest.Write([]string{"Name", "CurrentTier", "RecommendedTier"}); err != nil {
+				return err
+			}
+			a.manifestWritten = true
+		}
+		return a.manifest.Write([]string{name, string(currentTier), string(target)})
+	}
+	return nil
+}
+
+// flush completes the manifest, if any
+func (a *coldDataAnalyzer) flush() error {
+	if a.manifest == nil {
+		return nil
+	}
+	a.manifest.Flush()
+	return a.manifest.Error()
+}
+
+// report returns the lines of the human-readable report
+func (a *coldDataAnalyzer) report() []string {
+	lines := []string{"", "Block blobs by time since last modification:"}
+	for _, b := range a.buckets {
+		lines = append(lines, fmt.Sprintf("  %-16s %10d blobs %12s", b.label, b.count, byteSizeToString(b.bytes)))
+	}
+
+	lines = append(lines, "", "Tiering candidates:")
+	for _, tier := range []azblob.AccessTierType{azblob.AccessTierCool, azblob.AccessTierArchive} {
+		lines = append(lines, fmt.Sprintf("  move to %-8s %10d blobs %12s", tier, a.candidates[tier], byteSizeToString(a.candidateBytes[tier])))
+	}
+	lines = append(lines, fmt.Sprintf("Estimated storage saving: %.2f USD per month (excluding transaction, early deletion and rehydration charges)", a.monthlySavings))
+	return lines
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type coldDataAnalyzerTestSuite struct{}
+
+var _ = chk.Suite(&coldDataAnalyzerTestSuite{})
+
+func (s *coldDataAnalyzerTestSuite) TestColdDataRecommendations(c *chk.C) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(d int) time.Time { return now.Add(-time.Duration(d) * 24 * time.Hour) }
+	const gb = 1024 * 1024 * 1024
+
+	var manifest bytes.Buffer
+	a := newColdDataAnalyzer(now, 30, 180, 0.02, 0.01, 0.001, &manifest)
+
+	c.Assert(a.observe("recent", gb, daysAgo(1), azblob.BlobBlockBlob, azblob.AccessTierHot), chk.IsNil)
+	c.Assert(a.observe("inferredHot", gb, daysAgo(45), azblob.BlobBlockBlob, azblob.AccessTierNone), chk.IsNil)
+	c.Assert(a.observe("alreadyCool", gb, daysAgo(45), azblob.BlobBlockBlob, azblob.AccessTierCool), chk.IsNil)
+	c.Assert(a.observe("oldCool", 2*gb, daysAgo(400), azblob.BlobBlockBlob, azblob.AccessTierCool), chk.IsNil)
+	c.Assert(a.observe("oldArchive", gb, daysAgo(400), azblob.BlobBlockBlob, azblob.AccessTierArchive), chk.IsNil)
+	c.Assert(a.observe("oldPage", gb, daysAgo(400), azblob.BlobPageBlob, azblob.AccessTierNone), chk.IsNil)
+	c.Assert(a.flush(), chk.IsNil)
+
+	c.Assert(a.candidates[azblob.AccessTierCool], chk.Equals, int64(1))
+	c.Assert(a.candidates[azblob.AccessTierArchive], chk.Equals, int64(1))
+	c.Assert(a.candidateBytes[azblob.AccessTierArchive], chk.Equals, int64(2*gb))
+	// 1 GB from hot to cool, plus 2 GB from cool to archive
+	c.Assert(a.monthlySavings > 0.0279 && a.monthlySavings < 0.0281, chk.Equals, true)
+
+	// page blobs are not counted, since they cannot be tiered
+	c.Assert(a.buckets[0].count+a.buckets[1].count+a.buckets[4].count, chk.Equals, int64(5))
+
+	c.Assert(manifest.String(), chk.Equals, "Name,CurrentTier,RecommendedTier\ninferredHot,Hot,Cool\noldCool,Cool,Archive\n")
+	c.Assert(strings.Join(a.report(), "\n"), chk.Matches, "(?s).*Estimated storage saving: 0.03 USD.*")
+}
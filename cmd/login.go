@@ -61,6 +61,7 @@ func init() {
 	}
 
 	rootCmd.AddCommand(lgCmd)
+	lgCmd.AddCommand(loginStatusCmd())
 
 	lgCmd.PersistentFlags().StringVar(&loginCmdArgs.tenantID, "tenant-id", "", "The Azure Active Directory tenant ID to use for OAuth device interactive login.")
 	lgCmd.PersistentFlags().StringVar(&loginCmdArgs.aadEndpoint, "aad-endpoint", "", "The Azure Active Directory endpoint to use for OAuth user interactive login.")
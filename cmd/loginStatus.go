@@ -0,0 +1,234 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// loginStatusCmd reports on the cached login, it's added to the login command in login.go
+func loginStatusCmd() *cobra.Command {
+	verbose := false
+	rawCloud := ""
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: loginStatusCmdShortDescription,
+		Long:  loginStatusCmdLongDescription,
+		Args: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var cloud common.AzureCloud
+			if rawCloud != "" {
+				var err error
+				if cloud, err = common.ParseAzureCloud(rawCloud); err != nil {
+					glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
+				}
+			}
+			status, err := getLoginStatus(context.TODO(), verbose, cloud)
+			if err != nil {
+				glcm.Error("Failed to get the login status: " + err.Error())
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				if format == common.EOutputFormat.Json() {
+					jsonOutput, err := json.Marshal(status)
+					common.PanicIfErr(err)
+					return string(jsonOutput)
+				}
+				return status.String()
+			}, common.EExitCode.Success())
+		},
+	}
+
+	statusCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show details of how the token was acquired: the identity the token was issued to, the resource and expiry, "+
+		"and whether a token for Azure Resource Manager can be acquired with the same login.")
+	statusCmd.PersistentFlags().StringVar(&rawCloud, "cloud", "", "With --verbose, the Azure cloud whose Resource Manager to acquire a token for, given like the source-cloud of copy. "+
+		"By default, it's the well known cloud of the Azure AD endpoint that the login used, or else the public cloud.")
+	return statusCmd
+}
+
+// loginStatus describes the cached login, without any secrets
+type loginStatus struct {
+	LoggedIn                bool
+	LoginType               string `json:",omitempty"`
+	Tenant                  string `json:",omitempty"`
+	ActiveDirectoryEndpoint string `json:",omitempty"`
+	ManagedIdentity         string `json:",omitempty"` // which of the managed identities of the VM is used
+	ApplicationID           string `json:",omitempty"`
+
+	// only filled in with --verbose
+	Resource        string            `json:",omitempty"`
+	ExpiresOn       *time.Time        `json:",omitempty"`
+	TokenClaims     map[string]string `json:",omitempty"`
+	ARMResource     string            `json:",omitempty"`
+	ARMTokenExpires *time.Time        `json:",omitempty"`
+	ARMTokenError   string            `json:",omitempty"`
+}
+
+// the claims of the access token which identify who it was issued to
+var identifyingTokenClaims = []string{"tid", "oid", "appid", "upn", "xms_mirid"}
+
+// getLoginStatus describes the cached login. The Resource Manager checked with verbose is that of the cloud, if it's given,
+// or else that of the cloud of the login
+func getLoginStatus(ctx context.Context, verbose bool, cloud common.AzureCloud) (loginStatus, error) {
+	uotm := GetUserOAuthTokenManagerInstance()
+	if hasToken, err := uotm.HasCachedToken(); err != nil || !hasToken {
+		// not being logged in isn't a failure of this command
+		return loginStatus{LoggedIn: false}, nil
+	}
+
+	tokenInfo, err := uotm.GetTokenInfo(ctx)
+	if err != nil {
+		return loginStatus{}, err
+	}
+
+	status := loginStatus{
+		LoggedIn:                true,
+		Tenant:                  tokenInfo.Tenant,
+		ActiveDirectoryEndpoint: tokenInfo.ActiveDirectoryEndpoint,
+		ApplicationID:           tokenInfo.ApplicationID,
+	}
+	switch {
+	case tokenInfo.Identity:
+		status.LoginType = "managed identity"
+		status.ManagedIdentity = describeManagedIdentity(tokenInfo.IdentityInfo)
+	case tokenInfo.ServicePrincipalName && tokenInfo.SPNInfo.CertPath != "":
+		status.LoginType = "service principal (certificate)"
+	case tokenInfo.ServicePrincipalName:
+		status.LoginType = "service principal (secret)"
+	default:
+		status.LoginType = "user"
+	}
+
+	if !verbose {
+		return status, nil
+	}
+
+	status.Resource = common.IffString(tokenInfo.Token.Resource != "", tokenInfo.Token.Resource, common.Resource)
+	expiresOn := tokenInfo.Token.Expires()
+	status.ExpiresOn = &expiresOn
+	status.TokenClaims = getTokenClaims(tokenInfo.AccessToken, identifyingTokenClaims)
+
+	// features such as quota checks need to call ARM with the same identity, so check up front whether that's possible
+	if cloud.IsEmpty() {
+		cloud = common.AzureCloudOfAuthority(tokenInfo.ActiveDirectoryEndpoint)
+	}
+	status.ARMResource = cloud.ResourceManagerEndpoint
+	if status.ARMResource == "" {
+		status.ARMTokenError = fmt.Sprintf("the Resource Manager endpoint of cloud %s is not known, it can be given with arm=<URL>", cloud.Name)
+	} else if armToken, err := tokenInfo.GetTokenForResource(ctx, status.ARMResource); err != nil {
+		status.ARMTokenError = err.Error()
+	} else {
+		armTokenExpires := armToken.Expires()
+		status.ARMTokenExpires = &armTokenExpires
+	}
+
+	return status, nil
+}
+
+func describeManagedIdentity(identityInfo common.IdentityInfo) string {
+	switch {
+	case identityInfo.ClientID != "":
+		return "user-assigned, client ID " + identityInfo.ClientID
+	case identityInfo.ObjectID != "":
+		return "user-assigned, object ID " + identityInfo.ObjectID
+	case identityInfo.MSIResID != "":
+		return "user-assigned, resource ID " + identityInfo.MSIResID
+	default:
+		return "system-assigned"
+	}
+}
+
+// getTokenClaims decodes the payload of a JWT access token and returns the wanted claims, which are strings.
+// The signature isn't verified, as the claims are only displayed.
+func getTokenClaims(accessToken string, wanted []string) map[string]string {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+
+	result := make(map[string]string)
+	for _, name := range wanted {
+		if value, ok := claims[name].(string); ok {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+func (s loginStatus) String() string {
+	if !s.LoggedIn {
+		return "You are not logged in. Run 'azcopy login' to log in."
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Logged in as a %s\n", s.LoginType))
+	if s.ManagedIdentity != "" {
+		sb.WriteString(fmt.Sprintf("Identity: %s\n", s.ManagedIdentity))
+	}
+	if s.ApplicationID != "" {
+		sb.WriteString(fmt.Sprintf("Application ID: %s\n", s.ApplicationID))
+	}
+	if s.Tenant != "" {
+		sb.WriteString(fmt.Sprintf("Tenant: %s\n", s.Tenant))
+	}
+	if s.ActiveDirectoryEndpoint != "" {
+		sb.WriteString(fmt.Sprintf("Azure AD endpoint: %s\n", s.ActiveDirectoryEndpoint))
+	}
+
+	if s.Resource != "" {
+		sb.WriteString(fmt.Sprintf("Token resource: %s\n", s.Resource))
+		sb.WriteString(fmt.Sprintf("Token expires: %s\n", s.ExpiresOn.Local().Format(time.RFC1123)))
+		for _, name := range identifyingTokenClaims {
+			if value, ok := s.TokenClaims[name]; ok {
+				sb.WriteString(fmt.Sprintf("Token claim %s: %s\n", name, value))
+			}
+		}
+		armResource := common.IffString(s.ARMResource != "", " for "+s.ARMResource, "")
+		if s.ARMTokenError != "" {
+			sb.WriteString(fmt.Sprintf("Azure Resource Manager token%s: cannot be acquired, %s\n", armResource, s.ARMTokenError))
+		} else {
+			sb.WriteString(fmt.Sprintf("Azure Resource Manager token%s: acquired, expires %s\n", armResource, s.ARMTokenExpires.Local().Format(time.RFC1123)))
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// successMarkerName is the name that Spark (and the Hadoop output committers) give the marker of a complete output
+const successMarkerName = "_SUCCESS"
+
+// the placeholders of partition templates, and the layouts of time.Format that they are filled in with
+var partitionPlaceholders = []struct{ placeholder, layout string }{
+	{"{yyyy}", "2006"},
+	{"{MM}", "01"},
+	{"{dd}", "02"},
+	{"{HH}", "15"},
+	{"{mm}", "04"},
+}
+
+// cookPartitionTemplate checks that each directory of the template is a name=value pair, which is what partition discovery
+// in Spark and Synapse expects, and fills in the placeholders of the values with the given time (the start of the job, in UTC).
+// E.g. year={yyyy}/month={MM} gives year=2020/month=06
+func cookPartitionTemplate(template string, start time.Time) (string, error) {
+	template = strings.Trim(template, "/")
+	if template == "" {
+		return "", nil
+	}
+
+	start = start.UTC()
+	dirs := strings.Split(template, "/")
+	for i, dir := range dirs {
+		equals := strings.Index(dir, "=")
+		if equals <= 0 || equals == len(dir)-1 {
+			return "", fmt.Errorf("each directory of partition-by must be in the form name=value, which %q is not", dir)
+		}
+		name, value := dir[:equals], dir[equals+1:]
+		// Spark skips the directories whose names start with these, as hidden
+		if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			return "", fmt.Errorf("the partition name %q cannot start with _ or .", name)
+		}
+		if strings.ContainsAny(name, "{}") {
+			return "", fmt.Errorf("the partition name %q cannot hold a placeholder", name)
+		}
+		for _, p := range partitionPlaceholders {
+			value = strings.Replace(value, p.placeholder, start.Format(p.layout), -1)
+		}
+		if strings.ContainsAny(value, "{}") {
+			return "", fmt.Errorf("the partition value %q holds an unknown placeholder. Available placeholders: {yyyy}, {MM}, {dd}, {HH}, {mm}", dir[equals+1:])
+		}
+		dirs[i] = name + "=" + value
+	}
+	return strings.Join(dirs, "/"), nil
+}
+
+// validateAnalyticsLayout checks that the destination of the job can take a partition layout and a success marker
+func validateAnalyticsLayout(partitionPrefix string, successMarker bool, fromTo common.FromTo, autoPartitionSize int64) error {
+	if partitionPrefix == "" && !successMarker {
+		return nil
+	}
+	switch fromTo.To() {
+	case common.ELocation.Blob(), common.ELocation.BlobFS(), common.ELocation.Local():
+	default:
+		return errors.New("partition-by and success-marker are only available when the destination is Blob storage, ADLS Gen2 or local")
+	}
+	// each sub-job completes on its own, so the first one would create the marker long before the output is complete
+	if successMarker && autoPartitionSize > 0 {
+		return errors.New("success-marker cannot be used with auto-partition-size")
+	}
+	return nil
+}
+
+// escapedLayoutPath turns a path of the layout of the destination (made of partition directories and the success marker)
+// into a relative path of the destination, in the same form as the ones made by makeEscapedRelativePath
+func (cca *cookedCopyCmdArgs) escapedLayoutPath(layoutPath string) string {
+	dirs := strings.Split(layoutPath, "/")
+	if cca.fromTo.To().IsRemote() {
+		for i, d := range dirs {
+			dirs[i] = url.PathEscape(d)
+		}
+	}
+	return "/" + strings.Join(dirs, "/")
+}
@@ -57,6 +57,16 @@ func determineLocationLevel(location string, locationType common.Location, sourc
 	case common.ELocation.Benchmark():
 		return ELocationLevel.Object(), nil // we always benchmark to a subfolder, not the container root
 
+	case common.ELocation.Http():
+		return ELocationLevel.Object(), nil // web servers can't be listed, so we can only copy files from them
+
+	case common.ELocation.Sftp():
+		// as for local, directories are treated as containers. Whether a source is one is found by its traverser
+		if strings.Contains(location, "*") || strings.HasSuffix(location, "/") {
+			return ELocationLevel.Container(), nil
+		}
+		return ELocationLevel.Object(), nil
+
 	case common.ELocation.Blob(),
 		common.ELocation.File(),
 		common.ELocation.BlobFS():
@@ -123,7 +133,9 @@ func GetResourceRoot(resource string, location common.Location) (resourceBase st
 	// todo: reduce code-duplicateyness, maybe?
 	switch location {
 	case common.ELocation.Unknown(),
-		common.ELocation.Benchmark(): // do nothing
+		common.ELocation.Benchmark(),
+		common.ELocation.Http(),
+		common.ELocation.Sftp(): // do nothing
 		return resource, nil
 	case common.ELocation.Local():
 		return cleanLocalPath(getPathBeforeFirstWildcard(resource)), nil
@@ -214,9 +226,23 @@ func SplitAuthTokenFromResource(resource string, location common.Location) (reso
 		*baseURL = common.URLExtension{URL: *baseURL}.URLWithPlusDecodedInPath()
 		return baseURL.String(), "", nil
 	case common.ELocation.Benchmark(), // cover for benchmark as we generate data for that
+		common.ELocation.Sftp(),    // SFTP logs in with a key, never a token
 		common.ELocation.Unknown(): // cover for unknown as we treat that as garbage
 		// Local and S3 don't feature URL-embedded tokens
 		return resource, "", nil
+	case common.ELocation.Http():
+		// the query of a URL on a web server, e.g. the signature of a presigned URL, is treated like a SAS,
+		// so that it's kept out of the plan files, and is added back to each file read under the URL
+		var baseURL *url.URL
+		baseURL, err = url.Parse(resource)
+
+		if err != nil {
+			return resource, "", err
+		}
+
+		resourceToken = baseURL.RawQuery
+		baseURL.RawQuery = ""
+		return baseURL.String(), resourceToken, nil
 
 	// Use resource-specific APIs that all mostly do the same thing, just on the off-chance they end up doing something slightly different in the future.
 	// TODO: make GetAccountRoot and GetContainerName use their own specific APIs as well. It's _unlikely_ at best that the URL format will change drastically.
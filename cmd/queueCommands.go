@@ -0,0 +1,217 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+const (
+	maxQueueMessagesPerReceive = 32
+
+	// how long the messages being drained are hidden from other receivers. Long enough to save and delete them
+	drainVisibilityTimeout = 5 * time.Minute
+)
+
+// drainedQueueMessage is one line of the file that drain-queue writes, and load-queue reads.
+// Only the text is needed to load the message again; the rest is there for the record.
+type drainedQueueMessage struct {
+	MessageID      string  `json:"messageId,omitempty"`
+	InsertionTime  string  `json:"insertionTime,omitempty"`
+	ExpirationTime string  `json:"expirationTime,omitempty"`
+	DequeueCount   int     `json:"dequeueCount,omitempty"`
+	MessageText    *string `json:"messageText"`
+}
+
+type rawQueueMessagesCmdArgs struct {
+	src               string
+	dst               string
+	maxMessages       uint32
+	timeToLiveSeconds int64
+}
+
+// drain moves messages from the queue to the end of the local file, until the queue is empty or maxMessages
+// have been moved. Each batch is saved to the file before it is deleted from the queue, so a failure can leave
+// a message in both places, but never in neither.
+func drainQueue(ctx context.Context, queue *storageQueue, localPath string, maxMessages int) (int, error) {
+	file, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, common.DEFAULT_FILE_PERM)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	for maxMessages == 0 || count < maxMessages {
+		toReceive := maxQueueMessagesPerReceive
+		if maxMessages > 0 && maxMessages-count < toReceive {
+			toReceive = maxMessages - count
+		}
+		messages, err := queue.receiveMany(ctx, toReceive, drainVisibilityTimeout)
+		if err != nil {
+			return count, err
+		}
+		if len(messages) == 0 {
+			return count, nil
+		}
+
+		lines := &bytes.Buffer{}
+		enc := json.NewEncoder(lines)
+		enc.SetEscapeHTML(false) // messages are often XML or HTML, which is easier to read with its <, > and & intact
+		for i := range messages {
+			m := messages[i]
+			err := enc.Encode(drainedQueueMessage{
+				MessageID:      m.MessageID,
+				InsertionTime:  m.InsertionTime,
+				ExpirationTime: m.ExpirationTime,
+				DequeueCount:   m.DequeueCount,
+				MessageText:    &m.MessageText,
+			})
+			if err != nil {
+				return count, err
+			}
+		}
+		if _, err = file.Write(lines.Bytes()); err != nil {
+			return count, err
+		}
+		if err = file.Sync(); err != nil {
+			return count, err
+		}
+
+		for i := range messages {
+			if err := queue.delete(ctx, &messages[i]); err != nil {
+				return count, fmt.Errorf("message %s was saved, but could not be deleted from the queue: %v", messages[i].MessageID, err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// loadQueue adds the messages in the local file to the queue, in the order they are in the file
+func loadQueue(ctx context.Context, queue *storageQueue, localPath string, timeToLive time.Duration) (int, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return loadQueueMessages(ctx, queue, file, timeToLive)
+}
+
+func loadQueueMessages(ctx context.Context, queue *storageQueue, r io.Reader, timeToLive time.Duration) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // messages are at most 64 KiB, but may have been escaped
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var m drainedQueueMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil || m.MessageText == nil {
+			return count, fmt.Errorf("line %d is not a JSON object with a messageText", line)
+		}
+		if err := queue.putWithTimeToLive(ctx, *m.MessageText, timeToLive); err != nil {
+			return count, fmt.Errorf("line %d: %v", line, err)
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+func init() {
+	drainRaw := rawQueueMessagesCmdArgs{}
+	drainQueueCmd := &cobra.Command{
+		Use:     "drain-queue [queue URL] [local file]",
+		Short:   drainQueueCmdShortDescription,
+		Long:    drainQueueCmdLongDescription,
+		Example: drainQueueCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("please provide the URL of the queue, and the local file to save its messages to")
+			}
+			drainRaw.src, drainRaw.dst = args[0], args[1]
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			queue, err := newStorageQueue(drainRaw.src)
+			if err != nil {
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
+			}
+
+			count, err := drainQueue(context.Background(), queue, drainRaw.dst, int(drainRaw.maxMessages))
+			if err != nil {
+				glcm.Error(fmt.Sprintf("failed to drain the queue after %d messages: %s", count, err.Error()))
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				return fmt.Sprintf("Moved %d messages from the queue to %s.", count, drainRaw.dst)
+			}, common.EExitCode.Success())
+		},
+	}
+	rootCmd.AddCommand(drainQueueCmd)
+	drainQueueCmd.PersistentFlags().Uint32Var(&drainRaw.maxMessages, "max-messages", 0, "Stop after this many messages. By default, the queue is drained until it is empty.")
+
+	loadRaw := rawQueueMessagesCmdArgs{}
+	loadQueueCmd := &cobra.Command{
+		Use:     "load-queue [local file] [queue URL]",
+		Short:   loadQueueCmdShortDescription,
+		Long:    loadQueueCmdLongDescription,
+		Example: loadQueueCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("please provide the local file of messages, and the URL of the queue to add them to")
+			}
+			loadRaw.src, loadRaw.dst = args[0], args[1]
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			queue, err := newStorageQueue(loadRaw.dst)
+			if err != nil {
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
+			}
+			if loadRaw.timeToLiveSeconds < -1 {
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, "--message-ttl must be -1 (never expire), 0 (the service default), or a number of seconds"))
+			}
+
+			count, err := loadQueue(context.Background(), queue, loadRaw.src, time.Duration(loadRaw.timeToLiveSeconds)*time.Second)
+			if err != nil {
+				glcm.Error(fmt.Sprintf("failed to load the queue after %d messages: %s", count, err.Error()))
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				return fmt.Sprintf("Added %d messages from %s to the queue.", count, loadRaw.src)
+			}, common.EExitCode.Success())
+		},
+	}
+	rootCmd.AddCommand(loadQueueCmd)
+	loadQueueCmd.PersistentFlags().Int64Var(&loadRaw.timeToLiveSeconds, "message-ttl", 0, "How many seconds the added messages live for. -1 means they never expire. By default, the service's default of 7 days applies.")
+}
@@ -69,12 +69,12 @@ func init() {
 
 			cooked, err := raw.cook()
 			if err != nil {
-				glcm.Error("failed to parse user input due to error: " + err.Error())
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
 			}
 			cooked.commandString = copyHandlerUtil{}.ConstructCommandStringFromArgs()
 			err = cooked.process()
 			if err != nil {
-				glcm.Error("failed to perform remove command due to error: " + err.Error())
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToPerformCommand, "remove", err.Error()))
 			}
 
 			glcm.SurrenderControl()
@@ -83,6 +83,7 @@ func init() {
 	rootCmd.AddCommand(deleteCmd)
 
 	deleteCmd.PersistentFlags().BoolVar(&raw.recursive, "recursive", false, "Look into sub-directories recursively when syncing between directories.")
+	deleteCmd.PersistentFlags().IntVar(&raw.maxDepth, "max-depth", 0, "With recursive, only remove files this many levels or fewer below the given path. 1 means only the files directly inside it. (default 0, meaning no limit)")
 	deleteCmd.PersistentFlags().StringVar(&raw.logVerbosity, "log-level", "INFO", "Define the log verbosity for the log file. Available levels include: INFO(all requests/responses), WARNING(slow responses), ERROR(only failed requests), and NONE(no output logs). (default 'INFO')")
 	deleteCmd.PersistentFlags().StringVar(&raw.include, "include-pattern", "", "Include only files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName")
 	deleteCmd.PersistentFlags().StringVar(&raw.includePath, "include-path", "", "Include only these paths when removing. "+
@@ -91,5 +92,12 @@ func init() {
 	deleteCmd.PersistentFlags().StringVar(&raw.excludePath, "exclude-path", "", "Exclude these paths when removing. "+
 		"This option does not support wildcard characters (*). Checks relative path prefix. For example: myFolder;myFolder/subDirName/file.pdf")
 	deleteCmd.PersistentFlags().StringVar(&raw.listOfFilesToCopy, "list-of-files", "", "Defines the location of a file which contains the list of files and directories to be deleted. The relative paths should be delimited by line breaks, and the paths should NOT be URL-encoded.")
+	deleteCmd.PersistentFlags().StringVar(&raw.includeBlobType, "include-blob-type", "", "Remove only blobs of these types (BlockBlob/ PageBlob/ AppendBlob). More than one blob type should be separated by ';'.")
+	deleteCmd.PersistentFlags().StringVar(&raw.includeContentType, "include-content-type", "", "Remove only blobs whose content type matches the pattern list. Parameters such as charset are ignored. For example: video/*;application/pdf")
+	deleteCmd.PersistentFlags().StringArrayVar(&raw.labels, "label", nil, "Attach a label to the job, as key=value, so that it can be found later with 'jobs list --label'. Can be given more than once.")
+	deleteCmd.PersistentFlags().StringVar(&raw.description, "description", "", "Attach a description to the job, which is displayed by 'jobs list'.")
+	deleteCmd.PersistentFlags().StringVar(&raw.afterJob, "after-job", "", afterJobFlagUsage)
+	deleteCmd.PersistentFlags().BoolVar(&raw.dryRun, "dry-run", false, "List the files and blobs that would be removed, with their sizes, followed by the totals, but don't remove anything. "+
+		"The source is enumerated and filtered exactly as it would be for the removal, so this is a way to check include and exclude patterns first.")
 	deleteCmd.PersistentFlags().StringVar(&raw.deleteSnapshotsOption, "delete-snapshots", "", "By default, the delete operation fails if a blob has snapshots. Specify 'include' to remove the root blob and all its snapshots; alternatively specify 'only' to remove only the snapshots but keep the root blob.")
 }
@@ -63,6 +63,7 @@ func newRemoveEnumerator(cca *cookedCopyCmdArgs) (enumerator *copyEnumerator, er
 	if err != nil {
 		return nil, err
 	}
+	limitTraverserDepth(sourceTraverser, cca.maxDepth)
 
 	transferScheduler := newRemoveTransferProcessor(cca, NumOfFilesPerDispatchJobPart)
 	includeFilters := buildIncludeFilters(cca.includePatterns)
@@ -72,6 +73,16 @@ func newRemoveEnumerator(cca *cookedCopyCmdArgs) (enumerator *copyEnumerator, er
 	// set up the filters in the right order
 	filters := append(includeFilters, excludeFilters...)
 	filters = append(filters, excludePathFilters...)
+	filters = append(filters, buildIncludeBlobPropertyFilters(cca.includeBlobType, cca.includeContentTypes)...)
+	filters = append(filters, buildMaxDepthFilters(cca.maxDepth)...)
+
+	if cca.dryRun {
+		dryRun := newDryRunRecorder("remove", cca.fromTo, azcopyOutputFormat)
+		record := func(object storedObject) error {
+			return dryRun.record(common.GenerateFullPath(cca.source, object.relativePath), "", object.size)
+		}
+		return newCopyEnumerator(sourceTraverser, filters, record, dryRun.finish), nil
+	}
 
 	finalize := func() error {
 		jobInitiated, err := transferScheduler.dispatchFinalPart()
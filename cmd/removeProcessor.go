@@ -39,6 +39,9 @@ func newRemoveTransferProcessor(cca *cookedCopyCmdArgs, numOfTransfersPerPart in
 		// flags
 		LogLevel:       cca.logVerbosity,
 		BlobAttributes: common.BlobTransferAttributes{DeleteSnapshotsOption: cca.deleteSnapshotsOption},
+		Labels:         cca.labels,
+		Description:    cca.description,
+		AfterJobID:     cca.afterJobID,
 	}
 
 	reportFirstPart := func(jobStarted bool) {
@@ -23,6 +23,8 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
 	"runtime"
@@ -38,8 +40,23 @@ import (
 var azcopyAppPathFolder string
 var azcopyLogPathFolder string
 var azcopyJobPlanFolder string
+var logDirRaw string
+var planDirRaw string
 var azcopyMaxFileAndSocketHandles int
+
+// how many directories the traversers may list at once. Until the STE has been started (e.g. in tests),
+// directories are listed one at a time
+var azcopyEnumerationParallelism = 1
+
+// the config file of the tunables, and the values of the tunables given on the command line, by environment variable name
+var tunablesConfigFile string
+var tunableFlagsRaw = map[string]*string{}
 var outputFormatRaw string
+var outputIntervalSeconds uint32
+var ipPreferenceRaw string
+var logFormatRaw string
+var logCategoryLevelsRaw string
+var perRequestTimeoutSeconds uint32
 var cancelFromStdin bool
 var azcopyOutputFormat common.OutputFormat
 var cmdLineCapMegaBitsPerSecond uint32
@@ -57,6 +74,10 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if outputIntervalSeconds == 0 {
+			return errors.New("output-interval must be at least 1 second")
+		}
+		glcm.SetOutputInterval(time.Duration(outputIntervalSeconds) * time.Second)
 
 		// warn Windows users re quoting (since our docs all use single quotes, but CMD needs double)
 		// Single ones just come through as part of the args, in CMD.
@@ -74,12 +95,75 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
+		// FIPS mode must be settled before any connection is made
+		if err = common.ValidateFIPSMode(); err != nil {
+			return err
+		}
+		common.ApplyFIPSModeToDefaultTransports()
+		if err = common.ValidateTempDir(); err != nil {
+			return err
+		}
+		var ipPreference common.IPPreference
+		if err = ipPreference.Parse(ipPreferenceRaw); err != nil {
+			return fmt.Errorf("invalid ip-preference '%s': %v", ipPreferenceRaw, err)
+		}
+		ste.SetIPPreference(ipPreference)
+		ste.SetPerRequestTimeout(time.Duration(perRequestTimeoutSeconds) * time.Second)
+		faultInjectionVar := common.EEnvironmentVariable.FaultInjection()
+		if err = ste.SetFaultInjection(glcm.GetEnvironmentVariable(faultInjectionVar)); err != nil {
+			return fmt.Errorf("invalid %s: %v", faultInjectionVar.Name, err)
+		}
+		if ste.FaultInjectionEnabled() {
+			glcm.Info("*** Faults are being injected into the requests of the transfers, as " + faultInjectionVar.Name + " is set. Don't use this for production runs. ***")
+		}
+		logFormat, err := common.ResolveJobLogFormat(logFormatRaw)
+		if err != nil {
+			return err
+		}
+		common.SetJobLogFormat(logFormat)
+		logCategoryLevels, err := common.ResolveJobLogCategoryLevels(logCategoryLevelsRaw)
+		if err != nil {
+			return fmt.Errorf("invalid log-category-levels: %v", err)
+		}
+		common.SetJobLogCategoryLevels(logCategoryLevels)
+		logRotation, err := common.LogRotationOptionsFromEnvironment()
+		if err != nil {
+			return err
+		}
+		common.SetJobLogRotation(logRotation)
+		if err = common.SetupSystemLogSink(); err != nil {
+			return err
+		}
+
+		// the command line takes precedence over AZCOPY_LOG_LOCATION and AZCOPY_JOB_PLAN_LOCATION
+		if err = applyWorkingDirectoryFlags(); err != nil {
+			return err
+		}
+		if commandsThatStartJobs[cmd.Name()] {
+			// resume must not clean up the job it is about to resume
+			if cmd.Name() != "resume" {
+				if err = cleanupJobStoreByPolicy(); err != nil {
+					return err
+				}
+				compressFinishedJobPlans()
+			}
+			if err = verifyWorkingDirectoriesHaveSpace(); err != nil {
+				return err
+			}
+		}
+
 		// currently, we only automatically do auto-tuning when benchmarking
 		preferToAutoTuneGRs := cmd == benchCmd // TODO: do we have a better way to do this than making benchCmd global?
 		providePerformanceAdvice := cmd == benchCmd
 
+		// the tunables must be settled before the concurrency settings are worked out from them
+		if err = setTunables(cmd); err != nil {
+			return err
+		}
+
 		// startup of the STE happens here, so that the startup can access the values of command line parameters that are defined for "root" command
 		concurrencySettings := ste.NewConcurrencySettings(azcopyMaxFileAndSocketHandles, preferToAutoTuneGRs)
+		azcopyEnumerationParallelism = concurrencySettings.EnumerationPoolSize.Value
 		err = ste.MainSTE(concurrencySettings, int64(cmdLineCapMegaBitsPerSecond), azcopyJobPlanFolder, azcopyLogPathFolder, providePerformanceAdvice)
 		if err != nil {
 			return err
@@ -127,7 +211,28 @@ func init() {
 	rootCmd.SetUsageTemplate(strings.Replace((&cobra.Command{}).UsageTemplate(), "Global Flags", "Flags Applying to All Commands", -1))
 
 	rootCmd.PersistentFlags().Uint32Var(&cmdLineCapMegaBitsPerSecond, "cap-mbps", 0, "Caps the transfer rate, in megabits per second. Moment-by-moment throughput might vary slightly from the cap. If this option is set to zero, or it is omitted, the throughput isn't capped.")
-	rootCmd.PersistentFlags().StringVar(&outputFormatRaw, "output-type", "text", "Format of the command's output. The choices include: text, json. The default value is 'text'.")
+	rootCmd.PersistentFlags().StringVar(&outputFormatRaw, "output-type", "text", "Format of the command's output. The choices include: text, json, plain-interval. The default value is 'text'. "+
+		"plain-interval prints a complete progress line every output-interval seconds, instead of updating a single line in place, which suits screen readers and CI logs.")
+	rootCmd.PersistentFlags().StringVar(&ipPreferenceRaw, "ip-preference", common.EIPPreference.Any().String(), "Which IP address families are used to connect to the service: Any, PreferIPv4, PreferIPv6, IPv4Only or IPv6Only. "+
+		"With Any (the default) or a preference, the other family is also tried, shortly after the first, so a network with a broken IPv6 (or IPv4) path only causes delays. With IPv4Only or IPv6Only, the other family is never used.")
+	rootCmd.PersistentFlags().Uint32Var(&perRequestTimeoutSeconds, "per-request-timeout", uint32(ste.DefaultPerRequestTimeout.Seconds()), "How many seconds a try of a request that carries no data may take against Blob Storage or Data Lake Storage, before it is retried. "+
+		"Requests that carry data get this plus time for their data, so small calls fail fast while big blocks have enough time on slow links. 0 gives every try the full try timeout of 15 minutes, as older versions did.")
+	rootCmd.PersistentFlags().Uint32Var(&outputIntervalSeconds, "output-interval", 10, "How often, in seconds, the progress is printed when output-type is plain-interval.")
+
+	rootCmd.PersistentFlags().StringVar(&logFormatRaw, "log-format", "", "Format of the job log files: text or json. json writes one JSON object per line, with the time, level, job ID, transfer and message in fields of their own. "+
+		"Overrides AZCOPY_LOG_FORMAT. The default is text.")
+	rootCmd.PersistentFlags().StringVar(&logCategoryLevelsRaw, "log-category-levels", "", "Log some categories of messages at a level of their own, instead of the log level of the job, "+
+		"e.g. 'retry=WARNING;enumeration=INFO' to keep the progress of scanning without the messages about each request. "+
+		"The categories are general, retry (requests and their retries), enumeration, chunk (scheduling of transfers and chunks) and auth. Overrides AZCOPY_LOG_CATEGORY_LEVELS.")
+	rootCmd.PersistentFlags().StringVar(&logDirRaw, "log-dir", "", "Put the log files in this directory, instead of the location given by AZCOPY_LOG_LOCATION (or the default location).")
+	rootCmd.PersistentFlags().StringVar(&planDirRaw, "plan-dir", "", "Put the job plan files in this directory, instead of the location given by AZCOPY_JOB_PLAN_LOCATION (or the default location). "+
+		"It may be on a different volume than the logs. Resuming or managing a job requires the same plan-dir.")
+
+	rootCmd.PersistentFlags().StringVar(&tunablesConfigFile, "config-file", "", "A YAML or JSON file of settings for the concurrency and memory tunables (such as concurrency-value and buffer-gb), keyed by the names of their flags, e.g. concurrency-value: 64. "+
+		"Command-line flags take precedence over environment variables, which take precedence over this file. Overrides AZCOPY_CONFIG_FILE.")
+	for _, envVar := range ste.Tunables {
+		tunableFlagsRaw[envVar.Name] = rootCmd.PersistentFlags().String(ste.TunableName(envVar), "", envVar.Description+" Overrides "+envVar.Name+".")
+	}
 
 	// Note: this is due to Windows not supporting signals properly
 	rootCmd.PersistentFlags().BoolVar(&cancelFromStdin, "cancel-from-stdin", false, "Used by partner teams to send in `cancel` through stdin to stop a job.")
@@ -136,6 +241,22 @@ func init() {
 	rootCmd.PersistentFlags().MarkHidden("cancel-from-stdin")
 }
 
+// setTunables passes the tunables that were set on the command line, and the config file, to the STE
+func setTunables(cmd *cobra.Command) error {
+	flagValues := make(map[string]string)
+	for envVarName, value := range tunableFlagsRaw {
+		if cmd.Flags().Changed(ste.TunableName(common.EnvironmentVariable{Name: envVarName})) {
+			flagValues[envVarName] = *value
+		}
+	}
+
+	configFile := tunablesConfigFile
+	if configFile == "" {
+		configFile = glcm.GetEnvironmentVariable(common.EEnvironmentVariable.ConfigFile())
+	}
+	return ste.SetTunables(configFile, flagValues)
+}
+
 // always spins up a new goroutine, because sometimes the aka.ms URL can't be reached (e.g. a constrained environment where
 // aka.ms is not resolvable to a reachable IP address). In such cases, this routine will run for ever, and the caller should
 // just give up on it.
@@ -64,6 +64,15 @@ func inprocSend(rpcCmd common.RpcCmd, requestData interface{}, responseData inte
 	case common.ERpcCmd.GetJobFromTo():
 		*(responseData.(*common.GetJobFromToResponse)) = ste.GetJobFromTo(*requestData.(*common.GetJobFromToRequest))
 
+	case common.ERpcCmd.GetJobStatus():
+		*(responseData.(*common.GetJobStatusResponse)) = ste.GetJobStatus(*requestData.(*common.GetJobStatusRequest))
+
+	case common.ERpcCmd.VerifyJob():
+		*(responseData.(*common.VerifyJobResponse)) = ste.VerifyJob(*requestData.(*common.VerifyJobRequest))
+
+	case common.ERpcCmd.SetJobCap():
+		*(responseData.(*common.SetJobCapResponse)) = ste.SetJobCap(*requestData.(*common.SetJobCapRequest))
+
 	default:
 		panic(fmt.Errorf("Unrecognized RpcCmd: %q", rpcCmd.String()))
 	}
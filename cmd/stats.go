@@ -0,0 +1,306 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// jobStatsSummary sums up the runs of the jobs from one endpoint to another
+type jobStatsSummary struct {
+	SourceEndpoint      string
+	DestinationEndpoint string
+	Runs                int
+	TransfersCompleted  uint64
+	TransfersFailed     uint64
+	BytesTransferred    uint64
+	TotalSeconds        float64
+
+	// the total bytes over the total time, which is dominated by the biggest runs
+	AverageThroughputMbps float64
+	// the throughput of the typical run, which a single unusual run can't skew. Only runs that transferred data count
+	MedianThroughputMbps float64
+	LastRun              time.Time
+}
+
+// bandwidthUsageDay is the bandwidth used in one calendar day, in total and by each job
+type bandwidthUsageDay struct {
+	Date          string
+	BytesSent     uint64
+	BytesReceived uint64
+	Jobs          []common.BandwidthUsageRecord // the biggest users first
+}
+
+func init() {
+	endpoint := ""
+	since := ""
+	listRuns := false
+	bandwidth := false
+
+	// statsCmd queries the statistics kept of the jobs that have run on this machine
+	statsCmd := &cobra.Command{
+		Use:     "stats",
+		Short:   statsCmdShortDescription,
+		Long:    statsCmdLongDescription,
+		Example: statsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("stats command does not require any argument")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			sinceTime := time.Time{}
+			age, err := parseAge(since)
+			if err != nil {
+				glcm.Error(err.Error())
+			} else if age != 0 {
+				sinceTime = time.Now().Add(-age)
+			}
+
+			if bandwidth {
+				if endpoint != "" || listRuns {
+					glcm.Error("bandwidth cannot be combined with endpoint or list, as the bandwidth is only kept per job and per day")
+				}
+				showBandwidthUsage(sinceTime)
+				return
+			}
+
+			records, err := ste.ReadJobStats(azcopyJobPlanFolder)
+			if err != nil {
+				glcm.Error(fmt.Sprintf("Failed to read the statistics of the jobs due to error: %s.", err))
+			}
+			records = filterJobStats(records, endpoint, sinceTime)
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				var output interface{}
+				if listRuns {
+					output = records
+				} else {
+					output = summarizeJobStats(records)
+				}
+				if format == common.EOutputFormat.Json() {
+					jsonOutput, err := json.Marshal(output)
+					common.PanicIfErr(err)
+					return string(jsonOutput)
+				}
+
+				if len(records) == 0 {
+					return "No runs of jobs match."
+				} else if listRuns {
+					return formatJobStatsRecords(records)
+				}
+				return formatJobStatsSummaries(output.([]jobStatsSummary))
+			}, common.EExitCode.Success())
+		},
+	}
+
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.PersistentFlags().StringVar(&endpoint, "endpoint", "", "Only include jobs whose source or destination endpoint (e.g. myaccount.blob.core.windows.net, or local) contains this text.")
+	statsCmd.PersistentFlags().StringVar(&since, "since", "", "Only include runs that ended in this period before now, e.g. 30d or 12h.")
+	statsCmd.PersistentFlags().BoolVar(&listRuns, "list", false, "List each run of each job, rather than summing up the runs by endpoint.")
+	statsCmd.PersistentFlags().BoolVar(&bandwidth, "bandwidth", false, "Show the bytes sent and received over the network on each day, in total and by each job, rather than the runs of the jobs.")
+}
+
+func showBandwidthUsage(since time.Time) {
+	records, err := ste.ReadBandwidthUsage(azcopyJobPlanFolder)
+	if err != nil {
+		glcm.Error(fmt.Sprintf("Failed to read the bandwidth used by the jobs due to error: %s.", err))
+	}
+	days := summarizeBandwidthUsage(records, since)
+
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			jsonOutput, err := json.Marshal(days)
+			common.PanicIfErr(err)
+			return string(jsonOutput)
+		}
+		if len(days) == 0 {
+			return "No bandwidth usage has been recorded."
+		}
+		return formatBandwidthUsage(days)
+	}, common.EExitCode.Success())
+}
+
+// summarizeBandwidthUsage adds up the records by day (oldest first), and by job within each day. Days before since (if it's not zero) are left out
+func summarizeBandwidthUsage(records []common.BandwidthUsageRecord, since time.Time) []bandwidthUsageDay {
+	sinceDate := ""
+	if !since.IsZero() {
+		sinceDate = common.BandwidthUsageDate(since)
+	}
+
+	byDate := make(map[string]map[common.JobID]*common.BandwidthUsageRecord)
+	for _, r := range records {
+		if r.Date < sinceDate { // the dates sort in the order of the days
+			continue
+		}
+		jobs, ok := byDate[r.Date]
+		if !ok {
+			jobs = make(map[common.JobID]*common.BandwidthUsageRecord)
+			byDate[r.Date] = jobs
+		}
+		if j, ok := jobs[r.JobID]; ok {
+			j.BytesSent += r.BytesSent
+			j.BytesReceived += r.BytesReceived
+		} else {
+			r := r
+			jobs[r.JobID] = &r
+		}
+	}
+
+	result := make([]bandwidthUsageDay, 0, len(byDate))
+	for date, jobs := range byDate {
+		day := bandwidthUsageDay{Date: date, Jobs: make([]common.BandwidthUsageRecord, 0, len(jobs))}
+		for _, j := range jobs {
+			day.BytesSent += j.BytesSent
+			day.BytesReceived += j.BytesReceived
+			day.Jobs = append(day.Jobs, *j)
+		}
+		sort.Slice(day.Jobs, func(i, k int) bool {
+			if day.Jobs[i].Total() != day.Jobs[k].Total() {
+				return day.Jobs[i].Total() > day.Jobs[k].Total()
+			}
+			return day.Jobs[i].JobID.String() < day.Jobs[k].JobID.String()
+		})
+		result = append(result, day)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+	return result
+}
+
+func formatBandwidthUsage(days []bandwidthUsageDay) string {
+	var sb strings.Builder
+	for _, d := range days {
+		sb.WriteString(fmt.Sprintf("%s: %s sent, %s received\n", d.Date, byteSizeToString(int64(d.BytesSent)), byteSizeToString(int64(d.BytesReceived))))
+		for _, j := range d.Jobs {
+			sb.WriteString(fmt.Sprintf("  JobId %s: %s sent, %s received\n", j.JobID, byteSizeToString(int64(j.BytesSent)), byteSizeToString(int64(j.BytesReceived))))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// filterJobStats keeps the runs that involve the endpoint (if one is given), and ended at or after since (if it's not zero)
+func filterJobStats(records []common.JobStatsRecord, endpoint string, since time.Time) []common.JobStatsRecord {
+	endpoint = strings.ToLower(endpoint)
+	result := make([]common.JobStatsRecord, 0, len(records))
+	for _, r := range records {
+		if endpoint != "" && !strings.Contains(r.SourceEndpoint, endpoint) && !strings.Contains(r.DestinationEndpoint, endpoint) {
+			continue
+		}
+		if r.EndTime.Before(since) {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// summarizeJobStats sums up the runs by source and destination endpoint, with the endpoints that moved the most data first
+func summarizeJobStats(records []common.JobStatsRecord) []jobStatsSummary {
+	type endpoints struct{ src, dst string }
+	summaries := make(map[endpoints]*jobStatsSummary)
+	throughputs := make(map[endpoints][]float64)
+
+	for _, r := range records {
+		key := endpoints{r.SourceEndpoint, r.DestinationEndpoint}
+		s, ok := summaries[key]
+		if !ok {
+			s = &jobStatsSummary{SourceEndpoint: r.SourceEndpoint, DestinationEndpoint: r.DestinationEndpoint}
+			summaries[key] = s
+		}
+		s.Runs++
+		s.TransfersCompleted += uint64(r.TransfersCompleted)
+		s.TransfersFailed += uint64(r.TransfersFailed)
+		s.BytesTransferred += r.BytesTransferred
+		s.TotalSeconds += r.Duration().Seconds()
+		if r.EndTime.After(s.LastRun) {
+			s.LastRun = r.EndTime
+		}
+		if r.BytesTransferred > 0 {
+			throughputs[key] = append(throughputs[key], r.ThroughputMbps())
+		}
+	}
+
+	result := make([]jobStatsSummary, 0, len(summaries))
+	for key, s := range summaries {
+		if s.TotalSeconds > 0 {
+			s.AverageThroughputMbps = float64(s.BytesTransferred) * 8 / (1000 * 1000) / s.TotalSeconds
+		}
+		if t := throughputs[key]; len(t) > 0 {
+			sort.Float64s(t)
+			if len(t)%2 == 1 {
+				s.MedianThroughputMbps = t[len(t)/2]
+			} else {
+				s.MedianThroughputMbps = (t[len(t)/2-1] + t[len(t)/2]) / 2
+			}
+		}
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].BytesTransferred != result[j].BytesTransferred {
+			return result[i].BytesTransferred > result[j].BytesTransferred
+		}
+		return result[i].SourceEndpoint+result[i].DestinationEndpoint < result[j].SourceEndpoint+result[j].DestinationEndpoint
+	})
+	return result
+}
+
+func formatJobStatsSummaries(summaries []jobStatsSummary) string {
+	var sb strings.Builder
+	for _, s := range summaries {
+		sb.WriteString(fmt.Sprintf("%s -> %s\n", s.SourceEndpoint, s.DestinationEndpoint))
+		sb.WriteString(fmt.Sprintf("  Runs: %d (last ended %s)\n", s.Runs, s.LastRun.Local().Format(time.RFC850)))
+		sb.WriteString(fmt.Sprintf("  Transfers: %d completed, %d failed\n", s.TransfersCompleted, s.TransfersFailed))
+		sb.WriteString(fmt.Sprintf("  Data transferred: %s in %s\n",
+			byteSizeToString(int64(s.BytesTransferred)), (time.Duration(s.TotalSeconds) * time.Second).Round(time.Second)))
+		sb.WriteString(fmt.Sprintf("  Throughput: %.2f Mbps on average, %.2f Mbps for the median run\n\n",
+			s.AverageThroughputMbps, s.MedianThroughputMbps))
+	}
+	return sb.String()
+}
+
+func formatJobStatsRecords(records []common.JobStatsRecord) string {
+	var sb strings.Builder
+	for _, r := range records {
+		sb.WriteString(fmt.Sprintf("JobId: %s\nEnded: %s\nFrom: %s\nTo: %s\nStatus: %s\nTransfers: %d completed, %d failed, %d skipped\nData transferred: %s in %s (%.2f Mbps)\n\n",
+			r.JobID,
+			r.EndTime.Local().Format(time.RFC850),
+			r.SourceEndpoint,
+			r.DestinationEndpoint,
+			r.JobStatus,
+			r.TransfersCompleted, r.TransfersFailed, r.TransfersSkipped,
+			byteSizeToString(int64(r.BytesTransferred)),
+			r.Duration().Round(time.Second),
+			r.ThroughputMbps()))
+	}
+	return sb.String()
+}
@@ -40,6 +40,7 @@ type rawSyncCmdArgs struct {
 	src       string
 	dst       string
 	recursive bool
+	maxDepth  int
 	// options from flags
 	blockSizeMB           float64
 	logVerbosity          string
@@ -47,16 +48,31 @@ type rawSyncCmdArgs struct {
 	exclude               string
 	includeFileAttributes string
 	excludeFileAttributes string
+	excludeHidden         bool
+	excludePatternsFile   string
+	labels                []string
+	description           string
+	afterJob              string
 	legacyInclude         string // for warning messages only
 	legacyExclude         string // for warning messages only
 
-	followSymlinks      bool
-	putMd5              bool
-	md5ValidationOption string
+	followSymlinks           bool
+	putMd5                   bool
+	md5ValidationOption      string
+	md5ValidationOptionIsSet bool // whether check-md5 was given, rather than defaulted
+	propertiesOnly           bool
+	compare                  string
+	enumerateFirst           bool
+	journal                  bool
+	folderCreation           string
 	// this flag indicates the user agreement with respect to deleting the extra files at the destination
 	// which do not exists at source. With this flag turned on/off, users will not be asked for permission.
 	// otherwise the user is prompted to make a decision
 	deleteDestination string
+	requireSoftDelete bool
+
+	// a dry run that shows what would be deleted if this percentage of the source were missing from its listing
+	simulateSourceFailures string
 }
 
 func (raw *rawSyncCmdArgs) parsePatterns(pattern string) (cookedPatterns []string) {
@@ -108,6 +124,8 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 		common.PanicIfErr(err)
 		cooked.source, cooked.sourceSAS, err = SplitAuthTokenFromResource(raw.src, cooked.fromTo.From())
 		common.PanicIfErr(err)
+	} else if cooked.fromTo == common.EFromTo.LocalLocal() {
+		// neither side has an auth token to split off
 	} else {
 		return cooked, fmt.Errorf("source '%s' / destination '%s' combination '%s' not supported for sync command ", raw.src, raw.dst, cooked.fromTo)
 	}
@@ -116,7 +134,8 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	if cooked.fromTo.From() == common.ELocation.Local() {
 		cooked.source = cleanLocalPath(raw.src)
 		cooked.source = common.ToExtendedPath(cooked.source)
-	} else if cooked.fromTo.To() == common.ELocation.Local() {
+	}
+	if cooked.fromTo.To() == common.ELocation.Local() {
 		cooked.destination = cleanLocalPath(raw.dst)
 		cooked.destination = common.ToExtendedPath(cooked.destination)
 	}
@@ -148,11 +167,50 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	cooked.followSymlinks = raw.followSymlinks
 	cooked.recursive = raw.recursive
 
+	if raw.maxDepth < 0 {
+		return cooked, fmt.Errorf("max-depth cannot be negative")
+	}
+	cooked.maxDepth = raw.maxDepth
+
 	// determine whether we should prompt the user to delete extra files
 	err = cooked.deleteDestination.Parse(raw.deleteDestination)
 	if err != nil {
 		return cooked, err
 	}
+	cooked.requireSoftDelete = raw.requireSoftDelete
+	if cooked.requireSoftDelete && (cooked.deleteDestination == common.EDeleteDestination.False() || cooked.fromTo.To() != common.ELocation.Blob()) {
+		return cooked, fmt.Errorf("require-soft-delete only applies when delete-destination removes blobs from a Blob storage destination")
+	}
+	if cooked.simulatedSourceFailureRate, err = cookSimulatedSourceFailures(raw.simulateSourceFailures); err != nil {
+		return cooked, err
+	}
+
+	cooked.journal = raw.journal
+
+	if cooked.folderCreation, err = cookFolderCreation(raw.folderCreation, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+
+	cooked.propertiesOnly = raw.propertiesOnly
+	if err = validatePropertiesOnly(cooked.propertiesOnly, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+	if cooked.propertiesOnly && cooked.deleteDestination != common.EDeleteDestination.False() {
+		return cooked, fmt.Errorf("properties-only cannot be used with delete-destination, since it only updates objects that exist at both the source and the destination")
+	}
+
+	if raw.compare != "" {
+		if err = cooked.compare.Parse(raw.compare); err != nil {
+			return cooked, fmt.Errorf("invalid compare '%s'. Available options: LastModifiedTime, Hash", raw.compare)
+		}
+	}
+	if cooked.compare == common.ESyncCompare.Hash() {
+		if common.FIPSModeEnabled() {
+			return cooked, fmt.Errorf("compare=hash cannot be used, since %s", common.ErrMD5NotAllowedInFIPSMode.Error())
+		}
+	}
+
+	cooked.enumerateFirst = raw.enumerateFirst
 
 	// warn on legacy filters
 	if raw.legacyInclude != "" || raw.legacyExclude != "" {
@@ -167,12 +225,36 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	cooked.includeFileAttributes = raw.parsePatterns(raw.includeFileAttributes)
 	cooked.excludeFileAttributes = raw.parsePatterns(raw.excludeFileAttributes)
 
+	cooked.labels, err = cookJobLabels(raw.labels, raw.description)
+	if err != nil {
+		return cooked, err
+	}
+	cooked.description = raw.description
+
+	cooked.afterJobID, err = cookAfterJobID(raw.afterJob)
+	if err != nil {
+		return cooked, err
+	}
+
+	cooked.excludeHidden = raw.excludeHidden
+	if raw.excludePatternsFile != "" {
+		localSourceDir := ""
+		if cooked.fromTo.From() == common.ELocation.Local() {
+			localSourceDir = raw.src
+		}
+		cooked.ignoreMatcher, err = loadIgnoreMatcher(raw.excludePatternsFile, localSourceDir)
+		if err != nil {
+			return cooked, err
+		}
+	}
+
 	err = cooked.logVerbosity.Parse(raw.logVerbosity)
 	if err != nil {
 		return cooked, err
 	}
 
-	cooked.putMd5 = raw.putMd5
+	// when comparing hashes, the uploaded blobs get one, so that they can be compared without being transferred next time
+	cooked.putMd5 = raw.putMd5 || (cooked.compare == common.ESyncCompare.Hash() && cooked.fromTo.IsUpload())
 	if err = validatePutMd5(cooked.putMd5, cooked.fromTo); err != nil {
 		return cooked, err
 	}
@@ -184,6 +266,19 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	if err = validateMd5Option(cooked.md5ValidationOption, cooked.fromTo); err != nil {
 		return cooked, err
 	}
+	if cooked.fromTo == common.EFromTo.LocalLocal() {
+		// local files have no stored hash to check against
+		if raw.md5ValidationOptionIsSet {
+			return cooked, fmt.Errorf("check-md5 is not supported while syncing between local paths, since local files have no stored hash to check against")
+		}
+		cooked.md5ValidationOption = common.EHashValidationOption.NoCheck()
+		if err = validateLocalPathsDontOverlap(cooked.source, cooked.destination); err != nil {
+			return cooked, err
+		}
+	}
+	if err = common.ValidateHashOptionsForFIPS(cooked.putMd5, cooked.md5ValidationOption); err != nil {
+		return cooked, err
+	}
 
 	return cooked, nil
 }
@@ -215,16 +310,29 @@ type cookedSyncCmdArgs struct {
 
 	// filters
 	recursive             bool
+	maxDepth              int
 	followSymlinks        bool
 	include               []string
 	exclude               []string
 	includeFileAttributes []string
 	excludeFileAttributes []string
+	excludeHidden         bool
+	ignoreMatcher         *ignoreMatcher
+
+	// labels (as JSON) and description of the job, and the job that must complete successfully before it starts
+	labels      string
+	description string
+	afterJobID  common.JobID
 
 	// options
 	putMd5              bool
 	md5ValidationOption common.HashValidationOption
 	blockSize           uint32
+	propertiesOnly      bool
+	compare             common.SyncCompare
+	enumerateFirst      bool // if set, nothing is transferred until both sides have been scanned completely
+	journal             bool
+	folderCreation      common.FolderCreationPolicy
 	logVerbosity        common.LogLevel
 
 	// commandString hold the user given command which is logged to the Job log file
@@ -252,6 +360,13 @@ type cookedSyncCmdArgs struct {
 	// which do not exists at source. With this flag turned on/off, users will not be asked for permission.
 	// otherwise the user is prompted to make a decision
 	deleteDestination common.DeleteDestination
+	// if set, the sync is refused unless the blobs it deletes can be recovered through soft delete
+	requireSoftDelete bool
+	// whether the blobs deleted from the destination can be recovered, and how many were. nil if no blobs are deleted
+	destinationSoftDelete *softDeleteTracker
+
+	// when non-zero, the sync is only simulated, with this fraction of the source objects missing from the source listing
+	simulatedSourceFailureRate float64
 }
 
 func (cca *cookedSyncCmdArgs) incrementDeletionCount() {
@@ -307,8 +422,7 @@ func (cca *cookedSyncCmdArgs) waitUntilJobCompletion(blocking bool) {
 func (cca *cookedSyncCmdArgs) Cancel(lcm common.LifecycleMgr) {
 	// prompt for confirmation, except when enumeration is complete
 	if !cca.isEnumerationComplete {
-		answer := lcm.Prompt("The enumeration (source/destination comparison) is not complete, "+
-			"cancelling the job at this point means it cannot be resumed.",
+		answer := lcm.Prompt(common.UserMessages().Text(common.MsgCancelSyncPrompt),
 			common.PromptDetails{
 				PromptType: common.EPromptType.Cancel(),
 				ResponseOptions: []common.ResponseOption{
@@ -364,6 +478,7 @@ func (cca *cookedSyncCmdArgs) getJsonOfSyncJobSummary(summary common.ListJobSumm
 	wrapped := common.ListSyncJobSummaryResponse{ListJobSummaryResponse: summary}
 	wrapped.DeleteTotalTransfers = cca.getDeletionCount()
 	wrapped.DeleteTransfersCompleted = cca.getDeletionCount()
+	wrapped.DeleteTransfersRecoverable = cca.destinationSoftDelete.recoverableCount()
 	jsonOutput, err := json.Marshal(wrapped)
 	common.PanicIfErr(err)
 	return string(jsonOutput)
@@ -378,7 +493,8 @@ func (cca *cookedSyncCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) {
 	// fetch a job status and compute throughput if the first part was dispatched
 	if cca.firstPartOrdered() {
 		Rpc(common.ERpcCmd.ListJobSummary(), &cca.jobID, &summary)
-		jobDone = summary.JobStatus.IsJobDone()
+		// a job that was paused (e.g. because the account is failing over) won't make any more progress in this run
+		jobDone = summary.JobStatus.IsJobDone() || summary.JobStatus == common.EJobStatus.Paused()
 
 		// compute the average throughput for the last time interval
 		bytesInMb := float64(float64(summary.BytesOverWire-cca.intervalBytesTransferred) * 8 / float64(base10Mega))
@@ -407,22 +523,9 @@ func (cca *cookedSyncCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) {
 			if format == common.EOutputFormat.Json() {
 				return cca.getJsonOfSyncJobSummary(summary)
 			}
-			screenStats, logStats := formatExtraStats(cca.fromTo, summary.AverageIOPS, summary.AverageE2EMilliseconds, summary.NetworkErrorPercentage, summary.ServerBusyPercentage)
-
-			output := fmt.Sprintf(
-				`
-Job %s Summary
-Files Scanned at Source: %v
-Files Scanned at Destination: %v
-Elapsed Time (Minutes): %v
-Total Number Of Copy Transfers: %v
-Number of Copy Transfers Completed: %v
-Number of Copy Transfers Failed: %v
-Number of Deletions at Destination: %v
-Total Number of Bytes Transferred: %v
-Total Number of Bytes Enumerated: %v
-Final Job Status: %v%s%s
-`,
+			screenStats, logStats := formatExtraStats(cca.fromTo, summary)
+
+			summaryArgs := []interface{}{
 				summary.JobID.String(),
 				atomic.LoadUint64(&cca.atomicSourceFilesScanned),
 				atomic.LoadUint64(&cca.atomicDestinationFilesScanned),
@@ -431,15 +534,18 @@ Final Job Status: %v%s%s
 				summary.TransfersCompleted,
 				summary.TransfersFailed,
 				cca.atomicDeletionCount,
+				formatRecoverableDeletions(cca.destinationSoftDelete, cca.getDeletionCount()),
 				summary.TotalBytesTransferred,
 				summary.TotalBytesEnumerated,
 				summary.JobStatus,
 				screenStats,
-				formatPerfAdvice(summary.PerformanceAdvice))
+				formatScanOverlap(summary.ScanOverlap),
+				formatPerfAdvice(summary.PerformanceAdvice)}
+			output := common.UserMessages().Sprintf(common.MsgSyncJobSummary, summaryArgs...)
 
 			jobMan, exists := ste.JobsAdmin.JobMgr(summary.JobID)
 			if exists {
-				jobMan.Log(pipeline.LogInfo, logStats+"\n"+output)
+				jobMan.Log(pipeline.LogInfo, logStats+"\n"+common.LogMessages().Sprintf(common.MsgSyncJobSummary, summaryArgs...))
 			}
 
 			return output
@@ -454,7 +560,7 @@ Final Job Status: %v%s%s
 		// indicate whether constrained by disk or not
 		perfString, diskString := getPerfDisplayText(summary.PerfStrings, summary.PerfConstraint, duration, false)
 
-		return fmt.Sprintf("%.1f %%, %v Done, %v Failed, %v Pending, %v Total%s, 2-sec Throughput (Mb/s): %v%s",
+		return common.UserMessages().Sprintf(common.MsgSyncProgress,
 			summary.PercentComplete,
 			summary.TransfersCompleted,
 			summary.TransfersFailed,
@@ -464,8 +570,17 @@ Final Job Status: %v%s%s
 }
 
 func (cca *cookedSyncCmdArgs) process() (err error) {
+	if err = waitForJob(cca.afterJobID); err != nil {
+		return err
+	}
+
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 
+	// sync always checks the length of what it transfers
+	if notice := common.FIPSModeValidationNotice(true); notice != "" {
+		glcm.Info(notice)
+	}
+
 	// verifies credential type and initializes credential info.
 	// For sync, only one side need credential.
 	cca.credentialInfo.CredentialType, err = getCredentialType(ctx, rawFromToInfo{
@@ -501,8 +616,10 @@ func (cca *cookedSyncCmdArgs) process() (err error) {
 		return err
 	}
 
-	// trigger the progress reporting
-	cca.waitUntilJobCompletion(false)
+	// trigger the progress reporting (a simulation has no job to report on)
+	if cca.simulatedSourceFailureRate == 0 {
+		cca.waitUntilJobCompletion(false)
+	}
 
 	// trigger the enumeration
 	err = enumerator.enumerate()
@@ -530,6 +647,7 @@ func init() {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			raw.md5ValidationOptionIsSet = cmd.Flags().Changed("check-md5")
 			glcm.EnableInputWatcher()
 			if cancelFromStdin {
 				glcm.EnableCancelFromStdIn()
@@ -537,12 +655,12 @@ func init() {
 
 			cooked, err := raw.cook()
 			if err != nil {
-				glcm.Error("error parsing the input given by the user. Failed with error " + err.Error())
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
 			}
 			cooked.commandString = copyHandlerUtil{}.ConstructCommandStringFromArgs()
 			err = cooked.process()
 			if err != nil {
-				glcm.Error("Cannot perform sync due to error: " + err.Error())
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToPerformCommand, "sync", err.Error()))
 			}
 
 			glcm.SurrenderControl()
@@ -551,16 +669,44 @@ func init() {
 
 	rootCmd.AddCommand(syncCmd)
 	syncCmd.PersistentFlags().BoolVar(&raw.recursive, "recursive", true, "True by default, look into sub-directories recursively when syncing between directories. (default true).")
-	syncCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "Use this block size (specified in MiB) when uploading to Azure Storage or downloading from Azure Storage. Default is automatically calculated based on file size. Decimal fractions are allowed (For example: 0.25).")
+	syncCmd.PersistentFlags().IntVar(&raw.maxDepth, "max-depth", 0, "Only sync files this many levels or fewer below the source and destination. 1 means only the files directly inside them. (default 0, meaning no limit)")
+	syncCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "Use this block size (specified in MiB) when uploading to Azure Storage or downloading from Azure Storage. Default is automatically calculated for each file, based on its size and on the latency and throughput measured so far. Decimal fractions are allowed (For example: 0.25).")
 	syncCmd.PersistentFlags().StringVar(&raw.include, "include-pattern", "", "Include only files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName")
 	syncCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "", "Exclude files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName")
+	syncCmd.PersistentFlags().BoolVar(&raw.excludeHidden, "exclude-hidden", false, "Exclude hidden, system and temporary files by convention: names starting with a dot (and everything inside such directories), "+
+		"Thumbs.db, desktop.ini, Office lock files (~$*), and temporary files such as *~, *.tmp and *.swp.")
+	syncCmd.PersistentFlags().StringVar(&raw.excludePatternsFile, "exclude-patterns-file", "", "Exclude the files matched by the rules in this file, which uses the .gitignore syntax (including ! negation and rules ending with / for directories). "+
+		"A relative path that does not exist is also looked for in the local source directory. Without a value, "+defaultIgnoreFileName+" is used.")
+	syncCmd.PersistentFlags().Lookup("exclude-patterns-file").NoOptDefVal = defaultIgnoreFileName
+	syncCmd.PersistentFlags().StringArrayVar(&raw.labels, "label", nil, "Attach a label to the job, as key=value, so that it can be found later with 'jobs list --label'. Can be given more than once.")
+	syncCmd.PersistentFlags().StringVar(&raw.description, "description", "", "Attach a description to the job, which is displayed by 'jobs list'.")
+	syncCmd.PersistentFlags().StringVar(&raw.afterJob, "after-job", "", afterJobFlagUsage)
 	syncCmd.PersistentFlags().StringVar(&raw.includeFileAttributes, "include-attributes", "", "(Windows only) Include only files whose attributes match the attribute list. For example: A;S;R")
 	syncCmd.PersistentFlags().StringVar(&raw.excludeFileAttributes, "exclude-attributes", "", "(Windows only) Exclude files whose attributes match the attribute list. For example: A;S;R")
 	syncCmd.PersistentFlags().StringVar(&raw.logVerbosity, "log-level", "INFO", "Define the log verbosity for the log file, available levels: INFO(all requests and responses), WARNING(slow responses), ERROR(only failed requests), and NONE(no output logs). (default INFO).")
 	syncCmd.PersistentFlags().StringVar(&raw.deleteDestination, "delete-destination", "false", "Defines whether to delete extra files from the destination that are not present at the source. Could be set to true, false, or prompt. "+
 		"If set to prompt, the user will be asked a question before scheduling files and blobs for deletion. (default 'false').")
+	syncCmd.PersistentFlags().BoolVar(&raw.requireSoftDelete, "require-soft-delete", false, "Refuse to sync, before anything is transferred or deleted, unless soft delete is enabled on the destination account, "+
+		"so that the blobs removed by delete-destination can be recovered. Reading the soft delete policy needs access to the account, e.g. an account SAS. "+
+		"Without this flag, the summary still reports how many deletions are recoverable, when the policy can be read.")
+	syncCmd.PersistentFlags().StringVar(&raw.simulateSourceFailures, "simulate-failures-of-source", "", "Don't sync, but show what would have been transferred and deleted if this percentage (e.g. 10%) of the source objects, "+
+		"picked at random, had silently been missing from the source listing. The deletions are split into those of objects that really are gone from the source, "+
+		"and those of objects that would be lost, to help choose a safe delete-destination policy.")
 	syncCmd.PersistentFlags().BoolVar(&raw.putMd5, "put-md5", false, "Create an MD5 hash of each file, and save the hash as the Content-MD5 property of the destination blob or file. (By default the hash is NOT created.) Only available when uploading.")
-	syncCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOption.String(), "Specifies how strictly MD5 hashes should be validated when downloading. This option is only available when downloading. Available values include: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. (default 'FailIfDifferent').")
+	syncCmd.PersistentFlags().BoolVar(&raw.propertiesOnly, "properties-only", false, "Only update the properties (HTTP headers, metadata, access tier and, from blob sources, index tags) of destination blobs that have the same content as their source, without copying any data. "+
+		"The content is the same if the sizes match and then the MD5 hashes (with compare=Hash, or when both sides have one), or else if the source was not modified after the destination. "+
+		"Objects that are missing at the destination or whose content differs are left alone. Only available when the destination is Blob storage.")
+	syncCmd.PersistentFlags().StringVar(&raw.compare, "compare", "LastModifiedTime", "How to decide whether a file that exists at both the source and the destination needs to be transferred. "+
+		"With LastModifiedTime, it is transferred if the source was modified more recently. With Hash, it is transferred if the sizes or the MD5 hashes differ, for when the timestamps can't be relied on, "+
+		"e.g. after a backup is restored. Remote hashes are the stored Content-MD5, so a blob or file without one is always transferred; uploads set it, as with put-md5. "+
+		"The hashes of local files are computed, and cached in the AzCopy folder until the files change. Not available in FIPS mode.")
+	syncCmd.PersistentFlags().BoolVar(&raw.enumerateFirst, "enumerate-first", false, "Finish comparing the source with the destination before transferring anything, so that the totals of the job are accurate from the start. "+
+		"By default, the transfers start as soon as the comparison has found the first few thousand files to transfer. The list of transfers is held in memory until the comparison is complete.")
+	syncCmd.PersistentFlags().BoolVar(&raw.journal, "journal", false, "Record each state change of each transfer, with its time and the ID of the latest request for it, in an append-only journal next to the log of the job. "+
+		"Use 'azcopy jobs journal' to see or export it.")
+	syncCmd.PersistentFlags().StringVar(&raw.folderCreation, "folder-creation", "lazy", "When to create the directories of the destination (local or Azure Files only). With lazy, each directory is created when the first file in it is transferred. "+
+		"With eager, all the directories of each part of the job are created, in parallel, before its files are transferred.")
+	syncCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOptionForMode().String(), "Specifies how strictly MD5 hashes should be validated when downloading. This option is only available when downloading. Available values include: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. (default 'FailIfDifferent', or 'NoCheck' in FIPS mode).")
 
 	// temp, to assist users with change in param names, by providing a clearer message when these obsolete ones are accidentally used
 	syncCmd.PersistentFlags().StringVar(&raw.legacyInclude, "include", "", "Legacy include param. DO NOT USE")
@@ -20,6 +20,8 @@
 
 package cmd
 
+import "bytes"
+
 // with the help of an objectIndexer containing the source objects
 // find out the destination objects that should be transferred
 // in other words, this should be used when destination is being enumerated secondly
@@ -32,10 +34,16 @@ type syncDestinationComparator struct {
 
 	// storing the source objects
 	sourceIndex *objectIndexer
+
+	// when only properties are synced, every object present at both sides with the same content is scheduled
+	propertiesOnly bool
+
+	// if not nil, objects are compared by their hashes rather than their last modified times
+	hashes *syncHashComparer
 }
 
-func newSyncDestinationComparator(i *objectIndexer, copyScheduler, cleaner objectProcessor) *syncDestinationComparator {
-	return &syncDestinationComparator{sourceIndex: i, copyTransferScheduler: copyScheduler, destinationCleaner: cleaner}
+func newSyncDestinationComparator(i *objectIndexer, copyScheduler, cleaner objectProcessor, propertiesOnly bool, hashes *syncHashComparer) *syncDestinationComparator {
+	return &syncDestinationComparator{sourceIndex: i, copyTransferScheduler: copyScheduler, destinationCleaner: cleaner, propertiesOnly: propertiesOnly, hashes: hashes}
 }
 
 // it will only schedule transfers for destination objects that are present in the indexer but stale compared to the entry in the map
@@ -50,7 +58,15 @@ func (f *syncDestinationComparator) processIfNecessary(destinationObject storedO
 	if present {
 		defer delete(f.sourceIndex.indexMap, destinationObject.relativePath)
 
-		if sourceObjectInMap.isMoreRecentThan(destinationObject) {
+		if f.propertiesOnly {
+			// an object whose content changed needs a normal copy
+			if contentUnchanged(destinationObject, sourceObjectInMap, f.hashes) {
+				return f.copyTransferScheduler(sourceObjectInMap)
+			}
+			return nil
+		}
+
+		if isStale(destinationObject, sourceObjectInMap, f.hashes) {
 			err := f.copyTransferScheduler(sourceObjectInMap)
 			if err != nil {
 				return err
@@ -74,15 +90,21 @@ type syncSourceComparator struct {
 
 	// storing the destination objects
 	destinationIndex *objectIndexer
+
+	// when only properties are synced, only objects present at both sides with the same content are scheduled
+	propertiesOnly bool
+
+	// if not nil, objects are compared by their hashes rather than their last modified times
+	hashes *syncHashComparer
 }
 
-func newSyncSourceComparator(i *objectIndexer, copyScheduler objectProcessor) *syncSourceComparator {
-	return &syncSourceComparator{destinationIndex: i, copyTransferScheduler: copyScheduler}
+func newSyncSourceComparator(i *objectIndexer, copyScheduler objectProcessor, propertiesOnly bool, hashes *syncHashComparer) *syncSourceComparator {
+	return &syncSourceComparator{destinationIndex: i, copyTransferScheduler: copyScheduler, propertiesOnly: propertiesOnly, hashes: hashes}
 }
 
 // it will only transfer source items that are:
 //	1. not present in the map
-//  2. present but is more recent than the entry in the map
+//  2. present but is more recent than (or, when comparing hashes, different from) the entry in the map
 // note: we remove the storedObject if it is present so that when we have finished
 // the index will contain all objects which exist at the destination but were NOT seen at the source
 func (f *syncSourceComparator) processIfNecessary(sourceObject storedObject) error {
@@ -91,8 +113,15 @@ func (f *syncSourceComparator) processIfNecessary(sourceObject storedObject) err
 	if present {
 		defer delete(f.destinationIndex.indexMap, sourceObject.relativePath)
 
+		if f.propertiesOnly {
+			if contentUnchanged(destinationObjectInMap, sourceObject, f.hashes) {
+				return f.copyTransferScheduler(sourceObject)
+			}
+			return nil
+		}
+
 		// if destination is stale, schedule source for transfer
-		if sourceObject.isMoreRecentThan(destinationObjectInMap) {
+		if isStale(destinationObjectInMap, sourceObject, f.hashes) {
 			return f.copyTransferScheduler(sourceObject)
 
 		} else {
@@ -101,6 +130,37 @@ func (f *syncSourceComparator) processIfNecessary(sourceObject storedObject) err
 		}
 	}
 
+	// there is nothing to update when only syncing properties
+	if f.propertiesOnly {
+		return nil
+	}
+
 	// if source does not exist at the destination, then schedule it for transfer
 	return f.copyTransferScheduler(sourceObject)
 }
+
+// isStale says whether the destination object needs to be replaced by the source one: by default, when the source
+// was modified more recently, or, when comparing hashes, when their contents differ
+func isStale(destinationObject, sourceObject storedObject, hashes *syncHashComparer) bool {
+	if hashes != nil {
+		return hashes.differ(sourceObject, destinationObject)
+	}
+	return sourceObject.isMoreRecentThan(destinationObject)
+}
+
+// contentUnchanged says whether the destination object has the same content as the source one, so that only its properties
+// need syncing. The sizes must be the same. Then the hashes are compared, if the sync compares hashes or both sides have one;
+// if not, the source must not have been modified after the destination was written, since a rewrite that kept the size
+// would otherwise go unnoticed
+func contentUnchanged(destinationObject, sourceObject storedObject, hashes *syncHashComparer) bool {
+	if sourceObject.size != destinationObject.size {
+		return false
+	}
+	if hashes != nil {
+		return !hashes.differ(sourceObject, destinationObject)
+	}
+	if len(sourceObject.md5) > 0 && len(destinationObject.md5) > 0 {
+		return bytes.Equal(sourceObject.md5, destinationObject.md5)
+	}
+	return !sourceObject.isMoreRecentThan(destinationObject)
+}
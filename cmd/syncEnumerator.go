@@ -65,6 +65,9 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		return nil, err
 	}
 
+	limitTraverserDepth(sourceTraverser, cca.maxDepth)
+	limitTraverserDepth(destinationTraverser, cca.maxDepth)
+
 	// verify that the traversers are targeting the same type of resources
 	if sourceTraverser.isDirectory(true) != destinationTraverser.isDirectory(true) {
 		return nil, errors.New("sync must happen between source and destination of the same type, e.g. either file <-> file, or directory/container <-> directory/container")
@@ -83,11 +86,27 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 	}
 
 	filters = append(filters, buildExcludeFilters(cca.exclude, false)...)
+	filters = append(filters, buildMaxDepthFilters(cca.maxDepth)...)
+	filters = append(filters, buildConventionalExcludeFilters(cca.excludeHidden, cca.ignoreMatcher)...)
 	if cca.fromTo.From() == common.ELocation.Local() {
 		excludeAttrFilters := buildAttrFilters(cca.excludeFileAttributes, src, false)
 		filters = append(filters, excludeAttrFilters...)
 	}
 
+	hashes, err := cca.initHashComparer()
+	if err != nil {
+		return nil, err
+	}
+
+	if cca.simulatedSourceFailureRate > 0 {
+		return cca.initFailureSimulation(sourceTraverser, destinationTraverser, filters, hashes), nil
+	}
+
+	// find out whether the blobs that get deleted can be recovered, before anything is transferred or deleted
+	if err = cca.initDestinationSoftDelete(); err != nil {
+		return nil, err
+	}
+
 	// set up the comparator so that the source/destination can be compared
 	indexer := newObjectIndexer()
 	var comparator objectProcessor
@@ -107,14 +126,19 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		// when uploading, we can delete remote objects immediately, because as we traverse the remote location
 		// we ALREADY have available a complete map of everything that exists locally
 		// so as soon as we see a remote destination object we can know whether it exists in the local source
-		comparator = newSyncDestinationComparator(indexer, transferScheduler.scheduleCopyTransfer, destinationCleaner.removeImmediately).processIfNecessary
+		comparator = newSyncDestinationComparator(indexer, transferScheduler.scheduleCopyTransfer, destinationCleaner.removeImmediately, cca.propertiesOnly, hashes).processIfNecessary
 		finalize = func() error {
 			// schedule every local file that doesn't exist at the destination
-			err = indexer.traverse(transferScheduler.scheduleCopyTransfer, filters)
-			if err != nil {
-				return err
+			// (unless only properties are synced, since such files have no properties to update)
+			if !cca.propertiesOnly {
+				err = indexer.traverse(transferScheduler.scheduleCopyTransfer, filters)
+				if err != nil {
+					return err
+				}
 			}
 
+			hashes.save()
+
 			jobInitiated, err := transferScheduler.dispatchFinalPart()
 			// sync cleanly exits if nothing is scheduled.
 			if err != nil && err != NothingScheduledError {
@@ -130,7 +154,7 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 	default:
 		// in all other cases (download and S2S), the destination is scanned/indexed first
 		// then the source is scanned and filtered based on what the destination contains
-		comparator = newSyncSourceComparator(indexer, transferScheduler.scheduleCopyTransfer).processIfNecessary
+		comparator = newSyncSourceComparator(indexer, transferScheduler.scheduleCopyTransfer, cca.propertiesOnly, hashes).processIfNecessary
 
 		finalize = func() error {
 			// remove the extra files at the destination that were not present at the source
@@ -155,6 +179,8 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 
 			// let the deletions happen first
 			// otherwise if the final part is executed too quickly, we might quit before deletions could finish
+			hashes.save()
+
 			jobInitiated, err := transferScheduler.dispatchFinalPart()
 			// sync cleanly exits if nothing is scheduled.
 			if err != nil && err != NothingScheduledError {
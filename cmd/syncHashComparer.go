@@ -0,0 +1,230 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// the file in the AzCopy folder in which the hashes of local files are kept between runs
+const localHashCacheFileName = "localHashes.jsonl"
+
+// syncHashComparer decides whether an object that exists at both sides of a sync needs to be transferred by comparing
+// the MD5 hashes of their contents, for when the last modified times can't be relied on, e.g. after a backup is restored.
+// The hash of a remote object is its stored Content-MD5; that of a local file is computed, and kept in a cache so that
+// unchanged files aren't read again in the next sync.
+// When a hash is unknown, e.g. a blob that was uploaded without put-md5, the object is transferred to be on the safe side
+type syncHashComparer struct {
+	// the local roots of the source and destination, or "" for a remote side, whose hashes are stored with the objects
+	sourceRoot      string
+	destinationRoot string
+
+	cache *localHashCache
+}
+
+func newSyncHashComparer(fromTo common.FromTo, source, destination string, cache *localHashCache) (*syncHashComparer, error) {
+	h := &syncHashComparer{cache: cache}
+	var err error
+	if fromTo.From() == common.ELocation.Local() {
+		if h.sourceRoot, err = filepath.Abs(source); err != nil {
+			return nil, err
+		}
+	}
+	if fromTo.To() == common.ELocation.Local() {
+		if h.destinationRoot, err = filepath.Abs(destination); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// initHashComparer returns the comparer of hashes if the sync compares them, or nil if it compares last modified times
+func (cca *cookedSyncCmdArgs) initHashComparer() (*syncHashComparer, error) {
+	if cca.compare != common.ESyncCompare.Hash() {
+		return nil, nil
+	}
+
+	cachePath := ""
+	if azcopyAppPathFolder != "" {
+		cachePath = filepath.Join(azcopyAppPathFolder, localHashCacheFileName)
+	}
+	return newSyncHashComparer(cca.fromTo, cca.source, cca.destination, newLocalHashCache(cachePath))
+}
+
+// save keeps the hashes computed during the sync for the next one. Failing to do so only makes the next sync slower,
+// so it isn't an error
+func (h *syncHashComparer) save() {
+	if h == nil {
+		return
+	}
+	if err := h.cache.save(); err != nil {
+		glcm.Info("Cannot save the hashes of the local files for the next sync: " + err.Error())
+	}
+}
+
+// differ says whether the contents of the source and destination objects are different, or might be
+func (h *syncHashComparer) differ(source, destination storedObject) bool {
+	if source.size != destination.size {
+		return true // no need to read anything
+	}
+
+	sourceHash := h.hashOf(source, h.sourceRoot)
+	destinationHash := h.hashOf(destination, h.destinationRoot)
+	return len(sourceHash) == 0 || len(destinationHash) == 0 || !bytes.Equal(sourceHash, destinationHash)
+}
+
+// hashOf returns the hash of the object, or nil if it isn't known.
+// A local file that can't be read has no hash, so that it is transferred, and the failure is reported by the job
+func (h *syncHashComparer) hashOf(object storedObject, localRoot string) []byte {
+	if localRoot == "" {
+		return object.md5
+	}
+
+	hash, err := h.cache.hash(common.GenerateFullPath(localRoot, object.relativePath), object.size, object.lastModifiedTime.UnixNano())
+	if err != nil {
+		return nil
+	}
+	return hash
+}
+
+// localHashCacheEntry is the hash of a local file, which is valid as long as its size and last modified time stay the same
+type localHashCacheEntry struct {
+	Path         string
+	Size         int64
+	LastModified int64 // in nanoseconds since the Unix epoch
+	MD5          []byte
+}
+
+// localHashCache holds the MD5 hashes of local files, so that they're only computed again when a file has changed.
+// A file whose content changed without its size or last modified time changing is not noticed, but this is unlikely
+// enough, since unreliable timestamps are usually reset, e.g. to the time of the restore, rather than kept
+type localHashCache struct {
+	path string // where the cache is kept, or "" if it isn't saved
+
+	lock    sync.Mutex
+	entries map[string]localHashCacheEntry
+	changed bool
+}
+
+// newLocalHashCache loads the cache at the given path. A cache that can't be read is started afresh, since it can always be rebuilt
+func newLocalHashCache(path string) *localHashCache {
+	c := &localHashCache{path: path, entries: make(map[string]localHashCacheEntry)}
+	if path == "" {
+		return c
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return c
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry localHashCacheEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Path != "" {
+			c.entries[entry.Path] = entry
+		}
+	}
+	return c
+}
+
+// hash returns the MD5 hash of the file, computing it if the cached one is missing or out of date
+func (c *localHashCache) hash(path string, size int64, lastModified int64) ([]byte, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[path]
+	c.lock.Unlock()
+	if ok && entry.Size == size && entry.LastModified == lastModified {
+		return entry.MD5, nil
+	}
+
+	hash, err := computeLocalMD5(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.entries[path] = localHashCacheEntry{Path: path, Size: size, LastModified: lastModified, MD5: hash}
+	c.changed = true
+	c.lock.Unlock()
+	return hash, nil
+}
+
+// save writes the cache out, if it has changed. The new file is renamed into place, so that a concurrent sync
+// never reads a partial cache
+func (c *localHashCache) save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.path == "" || !c.changed {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), localHashCacheFileName+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once the file has been renamed
+
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	for _, entry := range c.entries {
+		if err = encoder.Encode(entry); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+func computeLocalMD5(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
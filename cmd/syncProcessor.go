@@ -49,6 +49,11 @@ func newSyncTransferProcessor(cca *cookedSyncCmdArgs, numOfTransfersPerPart int)
 		SourceSAS:      cca.sourceSAS,
 		DestinationSAS: cca.destinationSAS,
 
+		// labels
+		Labels:      cca.labels,
+		Description: cca.description,
+		AfterJobID:  cca.afterJobID,
+
 		// flags
 		BlobAttributes: common.BlobTransferAttributes{
 			PreserveLastModifiedTime: true, // must be true for sync so that future syncs have this information available
@@ -61,6 +66,9 @@ func newSyncTransferProcessor(cca *cookedSyncCmdArgs, numOfTransfersPerPart int)
 		DestLengthValidation:           true,
 		S2SGetPropertiesInBackend:      true,
 		S2SInvalidMetadataHandleOption: common.EInvalidMetadataHandleOption.RenameIfInvalid(),
+		PropertiesOnly:                 cca.propertiesOnly,
+		JournalTransitions:             cca.journal,
+		FolderCreation:                 cca.folderCreation,
 	}
 
 	reportFirstPart := func(jobStarted bool) { cca.setFirstPartOrdered() } // for compatibility with the way sync has always worked, we don't check jobStarted here
@@ -71,8 +79,10 @@ func newSyncTransferProcessor(cca *cookedSyncCmdArgs, numOfTransfersPerPart int)
 
 	// note that the source and destination, along with the template are given to the generic processor's constructor
 	// this means that given an object with a relative path, this processor already knows how to schedule the right kind of transfers
-	return newCopyTransferProcessor(copyJobTemplate, numOfTransfersPerPart, cca.source, cca.destination,
+	processor := newCopyTransferProcessor(copyJobTemplate, numOfTransfersPerPart, cca.source, cca.destination,
 		shouldEncodeSource, shouldEncodeDestination, reportFirstPart, reportFinalPart)
+	processor.enumerateFirst = cca.enumerateFirst
+	return processor
 }
 
 // base for delete processors targeting different resources
@@ -119,8 +129,7 @@ func (d *interactiveDeleteProcessor) removeImmediately(object storedObject) (err
 }
 
 func (d *interactiveDeleteProcessor) promptForConfirmation(object storedObject) (shouldDelete bool, keepPrompting bool) {
-	answer := glcm.Prompt(fmt.Sprintf("The %s '%s' does not exist at the source. "+
-		"Do you wish to delete it from the destination(%s)?",
+	answer := glcm.Prompt(common.UserMessages().Sprintf(common.MsgDeleteAtDestinationPrompt,
 		d.objectTypeToDisplay, object.relativePath, d.objectLocationToDisplay),
 		common.PromptDetails{
 			PromptType:   common.EPromptType.DeleteDestination(),
@@ -194,7 +203,9 @@ func newSyncDeleteProcessor(cca *cookedSyncCmdArgs) (*interactiveDeleteProcessor
 		return nil, err
 	}
 
-	return newInteractiveDeleteProcessor(newRemoteResourceDeleter(rawURL, p, ctx, cca.fromTo.To()).delete,
+	deleter := newRemoteResourceDeleter(rawURL, p, ctx, cca.fromTo.To())
+	deleter.softDelete = cca.destinationSoftDelete
+	return newInteractiveDeleteProcessor(deleter.delete,
 		cca.deleteDestination, cca.fromTo.To().String(), cca.destination, cca.incrementDeletionCount), nil
 }
 
@@ -203,6 +214,9 @@ type remoteResourceDeleter struct {
 	p              pipeline.Pipeline
 	ctx            context.Context
 	targetLocation common.Location
+
+	// counts the deleted blobs that can be recovered, if the destination has been checked for soft delete
+	softDelete *softDeleteTracker
 }
 
 func newRemoteResourceDeleter(rawRootURL *url.URL, p pipeline.Pipeline, ctx context.Context, targetLocation common.Location) *remoteResourceDeleter {
@@ -222,6 +236,9 @@ func (b *remoteResourceDeleter) delete(object storedObject) error {
 		blobURLParts.BlobName = path.Join(blobURLParts.BlobName, object.relativePath)
 		blobURL := azblob.NewBlobURL(blobURLParts.URL(), b.p)
 		_, err := blobURL.Delete(b.ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+		if err == nil {
+			b.softDelete.recordDeleted()
+		}
 		return err
 	case common.ELocation.File():
 		fileURLParts := azfile.NewFileURLParts(*b.rootURL)
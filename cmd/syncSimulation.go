@@ -0,0 +1,224 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// the most paths of wrongly deleted objects that the report of a simulation lists
+const maxSimulatedDeletionExamples = 20
+
+// cookSimulatedSourceFailures parses simulate-failures-of-source, e.g. 10%, into the fraction of the source objects to drop
+func cookSimulatedSourceFailures(raw string) (float64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(raw), "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid simulate-failures-of-source '%s'. It must be a percentage greater than 0 and at most 100, e.g. 10%%", raw)
+	}
+	return percent / 100, nil
+}
+
+// syncFailureSimulation is a dry run of a sync, in which a fraction of the source objects are silently left out of the
+// source listing, as they would be if parts of the enumeration failed without an error. Nothing is transferred or deleted;
+// instead, the transfers and deletions that the sync would have done are counted, and the deletions are split into those
+// of objects that really are gone from the source, and those of objects that were only missing from the listing.
+// The latter are the data that a delete policy would lose, so the report shows how much is at stake
+type syncFailureSimulation struct {
+	failureRate       float64
+	deleteDestination common.DeleteDestination
+
+	lock    sync.Mutex
+	rand    *rand.Rand
+	dropped map[string]struct{} // the relative paths of the source objects left out of the listing
+
+	SourceObjects          uint64
+	DroppedSourceObjects   uint64
+	DestinationObjects     uint64
+	Transfers              uint64
+	Deletions              uint64 // that the delete-destination policy would do
+	DeletionsOfLostObjects uint64 // of those, the ones of objects that are still at the source
+	LostObjectExamples     []string
+}
+
+func newSyncFailureSimulation(failureRate float64, deleteDestination common.DeleteDestination, seed int64) *syncFailureSimulation {
+	return &syncFailureSimulation{
+		failureRate:        failureRate,
+		deleteDestination:  deleteDestination,
+		rand:               rand.New(rand.NewSource(seed)),
+		dropped:            make(map[string]struct{}),
+		LostObjectExamples: make([]string, 0),
+	}
+}
+
+// dropSourceObject decides whether the object is left out of the source listing
+func (s *syncFailureSimulation) dropSourceObject(object storedObject) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.SourceObjects++
+	if s.rand.Float64() >= s.failureRate {
+		return false
+	}
+	s.DroppedSourceObjects++
+	s.dropped[object.relativePath] = struct{}{}
+	return true
+}
+
+func (s *syncFailureSimulation) recordTransfer(storedObject) error {
+	atomic.AddUint64(&s.Transfers, 1)
+	return nil
+}
+
+func (s *syncFailureSimulation) recordDestinationObject(storedObject) error {
+	atomic.AddUint64(&s.DestinationObjects, 1)
+	return nil
+}
+
+// recordDeletion is given the destination objects that the sync would delete, because they weren't in the source listing
+func (s *syncFailureSimulation) recordDeletion(object storedObject) error {
+	if s.deleteDestination == common.EDeleteDestination.False() {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Deletions++
+	if _, ok := s.dropped[object.relativePath]; ok {
+		s.DeletionsOfLostObjects++
+		if len(s.LostObjectExamples) < maxSimulatedDeletionExamples {
+			s.LostObjectExamples = append(s.LostObjectExamples, object.relativePath)
+		}
+	}
+	return nil
+}
+
+// failingSourceTraverser leaves some of the objects of the source out of its listing, for a syncFailureSimulation
+type failingSourceTraverser struct {
+	resourceTraverser
+	simulation *syncFailureSimulation
+}
+
+func (t *failingSourceTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+	return t.resourceTraverser.traverse(preprocessor, func(object storedObject) error {
+		if t.simulation.dropSourceObject(object) {
+			return nil
+		}
+		return processor(object)
+	}, filters)
+}
+
+// countingTraverser counts the objects that pass the filters, before handing them on
+type countingTraverser struct {
+	resourceTraverser
+	count objectProcessor
+}
+
+func (t *countingTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+	return t.resourceTraverser.traverse(preprocessor, func(object storedObject) error {
+		_ = t.count(object)
+		return processor(object)
+	}, filters)
+}
+
+// initFailureSimulation sets up an enumerator that compares the source and destination the way the sync would,
+// but only records what would be transferred and deleted, and reports that at the end
+func (cca *cookedSyncCmdArgs) initFailureSimulation(sourceTraverser, destinationTraverser resourceTraverser, filters []objectFilter, hashes *syncHashComparer) *syncEnumerator {
+	simulation := newSyncFailureSimulation(cca.simulatedSourceFailureRate, cca.deleteDestination, time.Now().UnixNano())
+	source := &failingSourceTraverser{resourceTraverser: sourceTraverser, simulation: simulation}
+	destination := &countingTraverser{resourceTraverser: destinationTraverser, count: simulation.recordDestinationObject}
+	indexer := newObjectIndexer()
+
+	finalize := func() error {
+		hashes.save()
+		glcm.Exit(func(format common.OutputFormat) string {
+			if format == common.EOutputFormat.Json() {
+				jsonOutput, err := json.Marshal(simulation)
+				common.PanicIfErr(err)
+				return string(jsonOutput)
+			}
+			return simulation.report()
+		}, common.EExitCode.Success())
+		return nil
+	}
+
+	if cca.fromTo == common.EFromTo.LocalBlob() {
+		// as in a real upload, the source is indexed first, and destination objects that aren't in the index are deleted straight away
+		comparator := newSyncDestinationComparator(indexer, simulation.recordTransfer, simulation.recordDeletion, cca.propertiesOnly, hashes).processIfNecessary
+		return newSyncEnumerator(source, destination, indexer, filters, comparator, func() error {
+			if !cca.propertiesOnly {
+				if err := indexer.traverse(simulation.recordTransfer, filters); err != nil {
+					return err
+				}
+			}
+			return finalize()
+		})
+	}
+
+	// as in a real download or S2S sync, the destination is indexed first, and what's left in the index at the end is deleted
+	comparator := newSyncSourceComparator(indexer, simulation.recordTransfer, cca.propertiesOnly, hashes).processIfNecessary
+	return newSyncEnumerator(destination, source, indexer, filters, comparator, func() error {
+		if err := indexer.traverse(simulation.recordDeletion, nil); err != nil {
+			return err
+		}
+		return finalize()
+	})
+}
+
+func (s *syncFailureSimulation) report() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Simulated a sync in which %.4g%% of the source objects were silently missing from the source listing. Nothing was transferred or deleted.\n\n",
+		s.failureRate*100))
+	sb.WriteString(fmt.Sprintf("Source objects: %d, of which %d were left out of the listing\n", s.SourceObjects, s.DroppedSourceObjects))
+	sb.WriteString(fmt.Sprintf("Destination objects: %d\n", s.DestinationObjects))
+	sb.WriteString(fmt.Sprintf("Transfers that would have been scheduled: %d\n", s.Transfers))
+
+	if s.deleteDestination == common.EDeleteDestination.False() {
+		sb.WriteString("Deletions: none, as delete-destination is false, so objects missing from the listing can't cause any data loss\n")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Deletions with delete-destination=%s: %d\n", strings.ToLower(s.deleteDestination.String()), s.Deletions))
+	sb.WriteString(fmt.Sprintf("  Of objects that are gone from the source: %d\n", s.Deletions-s.DeletionsOfLostObjects))
+	lostPercent := 0.0
+	if s.DestinationObjects > 0 {
+		lostPercent = float64(s.DeletionsOfLostObjects) * 100 / float64(s.DestinationObjects)
+	}
+	sb.WriteString(fmt.Sprintf("  Of objects that are still at the source, and would be lost: %d (%.2f%% of the destination)\n", s.DeletionsOfLostObjects, lostPercent))
+	for _, path := range s.LostObjectExamples {
+		sb.WriteString("    " + path + "\n")
+	}
+	if s.DeletionsOfLostObjects > uint64(len(s.LostObjectExamples)) {
+		sb.WriteString(fmt.Sprintf("    and %d more\n", s.DeletionsOfLostObjects-uint64(len(s.LostObjectExamples))))
+	}
+	return sb.String()
+}
@@ -0,0 +1,136 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// softDeleteTracker records whether the blobs that sync deletes from the destination can be recovered through
+// the soft delete policy of the destination account, and counts the ones that can, for the summary of the job
+type softDeleteTracker struct {
+	// whether the soft delete policy could be read, which needs access to the account rather than just the container
+	known         bool
+	enabled       bool
+	retentionDays int32
+
+	atomicRecoverable uint32
+}
+
+// recordDeleted is called after each blob is deleted
+func (t *softDeleteTracker) recordDeleted() {
+	if t != nil && t.enabled {
+		atomic.AddUint32(&t.atomicRecoverable, 1)
+	}
+}
+
+func (t *softDeleteTracker) recoverableCount() uint32 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadUint32(&t.atomicRecoverable)
+}
+
+// initDestinationSoftDelete reads the soft delete policy of the destination account, if the sync may delete blobs from it.
+// The sync is refused if it requires soft delete, and soft delete can't be confirmed to be enabled
+func (cca *cookedSyncCmdArgs) initDestinationSoftDelete() error {
+	if cca.fromTo.To() != common.ELocation.Blob() || cca.deleteDestination == common.EDeleteDestination.False() {
+		return nil
+	}
+
+	cca.destinationSoftDelete = &softDeleteTracker{}
+	enabled, days, err := cca.getDestinationSoftDeletePolicy()
+	if err != nil {
+		if cca.requireSoftDelete {
+			return fmt.Errorf("require-soft-delete is set, but the soft delete policy of the destination account could not be read: %v", err)
+		}
+		return nil
+	}
+	*cca.destinationSoftDelete = softDeleteTracker{known: true, enabled: enabled, retentionDays: days}
+
+	switch {
+	case enabled:
+		glcm.Info(fmt.Sprintf("Blobs deleted from the destination can be recovered for %v days, through soft delete.", days))
+	case cca.requireSoftDelete:
+		return errors.New("require-soft-delete is set, but soft delete is not enabled on the destination account, so the blobs deleted by this sync could not be recovered")
+	default:
+		glcm.Info("Soft delete is not enabled on the destination account, so the blobs deleted by this sync cannot be recovered.")
+	}
+	return nil
+}
+
+func (cca *cookedSyncCmdArgs) getDestinationSoftDeletePolicy() (enabled bool, retentionDays int32, err error) {
+	rawURL, err := url.Parse(cca.destination)
+	if err != nil {
+		return false, 0, err
+	} else if cca.destinationSAS != "" {
+		copyHandlerUtil{}.appendQueryParamToUrl(rawURL, cca.destinationSAS)
+	}
+
+	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
+	p, err := initPipeline(ctx, common.ELocation.Blob(), cca.credentialInfo)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// the policy belongs to the account, so the service properties are read from its root
+	parts := azblob.NewBlobURLParts(*rawURL)
+	parts.ContainerName, parts.BlobName, parts.Snapshot = "", "", ""
+	props, err := azblob.NewServiceURL(parts.URL(), p).GetProperties(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	return softDeletePolicyOf(props)
+}
+
+func softDeletePolicyOf(props *azblob.StorageServiceProperties) (enabled bool, retentionDays int32, err error) {
+	policy := props.DeleteRetentionPolicy
+	if policy == nil || !policy.Enabled {
+		return false, 0, nil
+	}
+	if policy.Days == nil {
+		return false, 0, errors.New("soft delete is enabled, but its retention period is missing from the service properties")
+	}
+	return true, *policy.Days, nil
+}
+
+// formatRecoverableDeletions says how many of the blobs deleted from the destination can be recovered through soft delete
+func formatRecoverableDeletions(t *softDeleteTracker, deletions uint32) string {
+	if t == nil || deletions == 0 {
+		return ""
+	}
+	switch {
+	case !t.known:
+		return " (whether they can be recovered is unknown, since the soft delete policy of the destination account could not be read)"
+	case !t.enabled:
+		return " (none can be recovered, since soft delete is not enabled on the destination account)"
+	default:
+		return fmt.Sprintf(" (%v can be recovered for %v days, through soft delete)", t.recoverableCount(), t.retentionDays)
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// the version of the Table service REST API used by the table commands
+const tableServiceVersion = "2019-02-02"
+
+const (
+	// the service limits of entity group transactions
+	maxTableBatchSize      = 100
+	maxTableBatchBodyBytes = 4 * 1024 * 1024
+	tableEntitiesPerPage   = 1000
+)
+
+// tableEntity holds the properties of an entity as the table service encodes them in JSON, with the
+// types that can't be inferred from the JSON in <name>@odata.type properties. The raw values are kept
+// so that numbers keep their exact text.
+type tableEntity map[string]json.RawMessage
+
+const (
+	odataTypeSuffix = "@odata.type"
+
+	edmString   = "Edm.String"
+	edmInt32    = "Edm.Int32"
+	edmInt64    = "Edm.Int64"
+	edmDouble   = "Edm.Double"
+	edmBoolean  = "Edm.Boolean"
+	edmDateTime = "Edm.DateTime"
+	edmGuid     = "Edm.Guid"
+	edmBinary   = "Edm.Binary"
+)
+
+// propertyNames returns the names of the properties of the entity, without the type annotations and OData metadata
+func (e tableEntity) propertyNames() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		if !strings.HasSuffix(name, odataTypeSuffix) && !strings.HasPrefix(name, "odata.") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// propertyType returns the EDM type of a property
+func (e tableEntity) propertyType(name string) string {
+	if raw, ok := e[name+odataTypeSuffix]; ok {
+		var t string
+		if json.Unmarshal(raw, &t) == nil {
+			return t
+		}
+	}
+
+	value := bytes.TrimSpace(e[name])
+	switch {
+	case len(value) == 0:
+		return edmString
+	case value[0] == '"':
+		return edmString
+	case value[0] == 't' || value[0] == 'f':
+		return edmBoolean
+	case bytes.ContainsAny(value, ".eE"):
+		return edmDouble
+	default:
+		return edmInt32
+	}
+}
+
+// forExport drops the OData metadata, and spells out the type of doubles, which would otherwise be
+// read back as Int32 if they have no fractional part
+func (e tableEntity) forExport() tableEntity {
+	result := make(tableEntity, len(e))
+	for name, value := range e {
+		if !strings.HasPrefix(name, "odata.") {
+			result[name] = value
+		}
+	}
+	for _, name := range result.propertyNames() {
+		if result.propertyType(name) == edmDouble {
+			result[name+odataTypeSuffix] = json.RawMessage(`"` + edmDouble + `"`)
+		}
+	}
+	return result
+}
+
+// forImport drops the properties that the service sets itself, and checks that the keys are there
+func (e tableEntity) forImport() (tableEntity, error) {
+	result := make(tableEntity, len(e))
+	for name, value := range e {
+		if !strings.HasPrefix(name, "odata.") && name != "Timestamp" && name != "Timestamp"+odataTypeSuffix {
+			result[name] = value
+		}
+	}
+	if _, err := result.key("PartitionKey"); err != nil {
+		return nil, err
+	}
+	if _, err := result.key("RowKey"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e tableEntity) key(name string) (string, error) {
+	var value string
+	if raw, ok := e[name]; !ok || json.Unmarshal(raw, &value) != nil {
+		return "", fmt.Errorf("the entity has no %s, or it is not a string", name)
+	}
+	return value, nil
+}
+
+// storageTable is a minimal client for the Azure Storage Table REST API, authenticated by the SAS in its URL
+type storageTable struct {
+	serviceURL url.URL // the URL of the account (which has a path, for the emulator), with the SAS
+	tableName  string
+	p          pipeline.Pipeline
+}
+
+// newTablePipeline returns a pipeline with the retries, timeouts, logging and connections of the other front end pipelines.
+// There is no SDK for tables in this tree, and, as for HTTP sources, the only credential is what's in the URL, so the
+// pipeline of HTTP sources does the job; tableResponder tells it which responses are worth trying again
+func newTablePipeline(retryOptions ste.XferRetryOptions) pipeline.Pipeline {
+	return ste.NewHTTPSourcePipeline(
+		azblob.PipelineOptions{
+			Telemetry: azblob.TelemetryOptions{
+				Value: common.UserAgent,
+			},
+		},
+		retryOptions,
+		ste.NewAzcopyHTTPClient(frontEndMaxIdleConnectionsPerHost),
+		nil, // we don't gather network stats on the front end
+	)
+}
+
+func newStorageTable(rawURL string, p pipeline.Pipeline) (*storageTable, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, errors.New("the table must be given as an http or https URL")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 || path[i+1:] == "" {
+		return nil, errors.New("the URL must name a table, as in https://[account].table.core.windows.net/[table]?[SAS]")
+	}
+	tableName := path[i+1:]
+	u.Path = path[:i]
+	u.RawPath = ""
+	return &storageTable{serviceURL: *u, tableName: tableName, p: p}, nil
+}
+
+// OData spells out keys and function calls in paths, as in /mytable(PartitionKey='a',RowKey='b'), which the service
+// expects to see as they are, rather than percent-encoded as Go would otherwise do
+var odataPathUnescaper = strings.NewReplacer("%28", "(", "%29", ")", "%27", "'", "%2C", ",", "%3D", "=")
+
+func (t *storageTable) url(path string, query url.Values) url.URL {
+	u := t.serviceURL
+	u.RawPath = u.EscapedPath() + "/" + odataPathUnescaper.Replace(url.PathEscape(path))
+	u.Path += "/" + path
+	q := u.Query() // the SAS
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u
+}
+
+// do sends the request, retrying it if the service is busy or fails (every request of the table commands can safely be
+// sent again, since entities are only read or replaced). Responses that aren't worth retrying are returned for the caller to look at
+func (t *storageTable) do(ctx context.Context, method string, u url.URL, header http.Header, body []byte) (*http.Response, error) {
+	req, err := pipeline.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-version", tableServiceVersion)
+	req.Header.Set("DataServiceVersion", "3.0")
+	req.Header.Set("MaxDataServiceVersion", "3.0;NetFx")
+	resp, err := t.p.Do(ctx, tableResponder, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Response(), nil
+}
+
+// tableResponder turns throttling, timeouts and server errors into temporary errors, so that the retry policy tries again
+var tableResponder = pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+	return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+		response, err := next.Do(ctx, request)
+		if err != nil || response == nil || response.Response() == nil {
+			return response, err
+		}
+		resp := response.Response()
+		if resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+			return response, tableStatusError{tableResponseError("the request", resp)}
+		}
+		return response, nil
+	}
+})
+
+// tableStatusError is a response from the table service that's worth trying again. It's a net.Error, so that the
+// retry policy retries it, as it does network errors
+type tableStatusError struct {
+	error
+}
+
+func (e tableStatusError) Timeout() bool {
+	return false
+}
+
+func (e tableStatusError) Temporary() bool {
+	return true
+}
+
+// tableResponseError describes a failed request, using the error code the service returned, if there is one
+func tableResponseError(operation string, resp *http.Response) error {
+	if code := resp.Header.Get("x-ms-error-code"); code != "" {
+		return fmt.Errorf("%s failed: the table service returned %s (%s)", operation, resp.Status, code)
+	}
+	return fmt.Errorf("%s failed: the table service returned %s", operation, resp.Status)
+}
+
+// listEntities passes every entity of the table, in the order of their keys, to process
+func (t *storageTable) listEntities(ctx context.Context, process func(tableEntity) error) error {
+	nextPartitionKey, nextRowKey := "", ""
+	for {
+		query := url.Values{"$top": {fmt.Sprint(tableEntitiesPerPage)}}
+		if nextPartitionKey != "" {
+			query.Set("NextPartitionKey", nextPartitionKey)
+		}
+		if nextRowKey != "" {
+			query.Set("NextRowKey", nextRowKey)
+		}
+		resp, err := t.do(ctx, http.MethodGet, t.url(t.tableName+"()", query),
+			http.Header{"Accept": {"application/json;odata=minimalmetadata"}}, nil)
+		if err != nil {
+			return err
+		}
+
+		var page struct {
+			Value []tableEntity `json:"value"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = tableResponseError("querying the entities of "+t.tableName, resp)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		}
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, entity := range page.Value {
+			if err := process(entity); err != nil {
+				return err
+			}
+		}
+
+		nextPartitionKey = resp.Header.Get("x-ms-continuation-NextPartitionKey")
+		nextRowKey = resp.Header.Get("x-ms-continuation-NextRowKey")
+		if nextPartitionKey == "" && nextRowKey == "" {
+			return nil
+		}
+	}
+}
+
+// upsertBatch inserts, or replaces, the entities in one transaction. They must all have the same partition key.
+func (t *storageTable) upsertBatch(ctx context.Context, entities []tableEntity) error {
+	body, contentType, err := t.batchBody(entities)
+	if err != nil {
+		return err
+	}
+	resp, err := t.do(ctx, http.MethodPost, t.url("$batch", nil), http.Header{"Content-Type": {contentType}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	partitionKey, _ := entities[0].key("PartitionKey")
+	operation := fmt.Sprintf("inserting a batch of %d entities with PartitionKey '%s'", len(entities), partitionKey)
+	if resp.StatusCode != http.StatusAccepted {
+		return tableResponseError(operation, resp)
+	}
+	// the batch as a whole is accepted even when an operation in it fails, so look at their responses too
+	responses, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if failure := firstFailedBatchOperation(responses); failure != "" {
+		return fmt.Errorf("%s failed: %s", operation, failure)
+	}
+	return nil
+}
+
+// batchBody builds the multipart body of an entity group transaction that inserts or replaces the entities
+func (t *storageTable) batchBody(entities []tableEntity) (body []byte, contentType string, err error) {
+	batchBoundary := "batch_" + common.NewUUID().String()
+	changesetBoundary := "changeset_" + common.NewUUID().String()
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "--%s\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n", batchBoundary, changesetBoundary)
+	for i, entity := range entities {
+		partitionKey, _ := entity.key("PartitionKey")
+		rowKey, _ := entity.key("RowKey")
+		entityURL := t.url(fmt.Sprintf("%s(PartitionKey='%s',RowKey='%s')", t.tableName, odataKey(partitionKey), odataKey(rowKey)), nil)
+		entityURL.RawQuery = "" // the SAS of the batch covers its operations
+		entityJSON, err := json.Marshal(entity)
+		if err != nil {
+			return nil, "", err
+		}
+
+		fmt.Fprintf(b, "--%s\r\nContent-Type: application/http\r\nContent-Transfer-Encoding: binary\r\n\r\n", changesetBoundary)
+		// PUT without If-Match inserts the entity, or replaces it if it's there already
+		fmt.Fprintf(b, "PUT %s HTTP/1.1\r\nContent-Type: application/json\r\nAccept: application/json;odata=minimalmetadata\r\n", entityURL.String())
+		fmt.Fprintf(b, "Prefer: return-no-content\r\nDataServiceVersion: 3.0\r\nContent-ID: %d\r\n\r\n", i+1)
+		b.Write(entityJSON)
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(b, "--%s--\r\n--%s--\r\n", changesetBoundary, batchBoundary)
+	return b.Bytes(), "multipart/mixed; boundary=" + batchBoundary, nil
+}
+
+// odataKey quotes a key for use in the URL of an entity. The URL escapes it further
+func odataKey(key string) string {
+	return strings.Replace(key, "'", "''", -1)
+}
+
+// firstFailedBatchOperation returns the status, and the message if there is one, of the first operation in the
+// batch response that failed, or "" if they all succeeded
+func firstFailedBatchOperation(responses []byte) string {
+	lines := strings.Split(string(responses), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "HTTP/1.1 ") || strings.HasPrefix(line, "HTTP/1.1 2") {
+			continue
+		}
+
+		// the error is the JSON body of this operation's response
+		var odataError struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message struct {
+					Value string `json:"value"`
+				} `json:"message"`
+			} `json:"odata.error"`
+		}
+		for _, rest := range lines[i+1:] {
+			rest = strings.TrimSpace(rest)
+			if strings.HasPrefix(rest, "{") && json.Unmarshal([]byte(rest), &odataError) == nil && odataError.Error.Code != "" {
+				// the message starts with the index of the failed operation, as in "0:The specified resource does not exist."
+				return fmt.Sprintf("%s (%s: %s)", strings.TrimPrefix(line, "HTTP/1.1 "), odataError.Error.Code, odataError.Error.Message.Value)
+			}
+		}
+		return strings.TrimPrefix(line, "HTTP/1.1 ")
+	}
+	return ""
+}
@@ -0,0 +1,513 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+const (
+	tableFileFormatNDJSON = "ndjson"
+	tableFileFormatCSV    = "csv"
+
+	// an entity can hold up to 1 MiB, which takes more than that as JSON
+	maxTableEntityLineBytes = 4 * 1024 * 1024
+)
+
+type rawTableCmdArgs struct {
+	src       string
+	dst       string
+	format    string
+	batchSize uint32
+}
+
+type cookedTableCmdArgs struct {
+	table     *storageTable
+	localPath string
+	format    string
+	batchSize int
+}
+
+func (raw rawTableCmdArgs) cook(tableURL string, localPath string) (cookedTableCmdArgs, error) {
+	cooked := cookedTableCmdArgs{localPath: localPath, format: strings.ToLower(raw.format), batchSize: int(raw.batchSize)}
+
+	var err error
+	if cooked.table, err = newStorageTable(tableURL, newTablePipeline(frontEndRetryOptions())); err != nil {
+		return cooked, err
+	}
+
+	// unless told otherwise, go by the file's extension
+	if cooked.format == "" {
+		cooked.format = tableFileFormatNDJSON
+		if strings.EqualFold(filepath.Ext(localPath), ".csv") {
+			cooked.format = tableFileFormatCSV
+		}
+	}
+	if cooked.format != tableFileFormatNDJSON && cooked.format != tableFileFormatCSV {
+		return cooked, fmt.Errorf("invalid format '%s'. Valid values are ndjson and csv", raw.format)
+	}
+	if cooked.batchSize < 1 || cooked.batchSize > maxTableBatchSize {
+		return cooked, fmt.Errorf("--batch-size must be between 1 and %d", maxTableBatchSize)
+	}
+	return cooked, nil
+}
+
+// export writes every entity of the table to the local file, and returns how many there were
+func (cooked cookedTableCmdArgs) export(ctx context.Context) (int, error) {
+	file, err := os.Create(cooked.localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if cooked.format == tableFileFormatNDJSON {
+		w := bufio.NewWriter(file)
+		count := 0
+		err = cooked.table.listEntities(ctx, func(e tableEntity) error {
+			count++
+			return writeNDJSONEntity(w, e.forExport())
+		})
+		if err == nil {
+			err = w.Flush()
+		}
+		return count, err
+	}
+
+	// the columns of a CSV file have to be known before its first row is written, and entities of a table
+	// don't all have the same properties, so we stage them on disk while we find out what they are
+	temp, err := common.CreateTempFile("table-export-", 0)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	columns := newCSVColumnSet()
+	w := bufio.NewWriter(temp)
+	count := 0
+	err = cooked.table.listEntities(ctx, func(e tableEntity) error {
+		count++
+		e = e.forExport()
+		columns.add(e)
+		return writeNDJSONEntity(w, e)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return count, err
+	}
+
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return count, err
+	}
+	return count, writeEntitiesAsCSV(temp, columns.sorted(), file)
+}
+
+// importEntities inserts (or replaces) the entities of the local file into the table, and returns how many there were
+func (cooked cookedTableCmdArgs) importEntities(ctx context.Context) (int, error) {
+	file, err := os.Open(cooked.localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	batcher := &tableBatcher{table: cooked.table, batchSize: cooked.batchSize}
+	add := func(e tableEntity) error {
+		e, err := e.forImport()
+		if err != nil {
+			return err
+		}
+		return batcher.add(ctx, e)
+	}
+
+	if cooked.format == tableFileFormatNDJSON {
+		err = readNDJSONEntities(file, add)
+	} else {
+		err = readCSVEntities(file, add)
+	}
+	if err == nil {
+		err = batcher.flush(ctx)
+	}
+	return batcher.imported, err
+}
+
+// tableBatcher groups consecutive entities with the same partition key into entity group transactions
+type tableBatcher struct {
+	table     *storageTable
+	batchSize int
+
+	batch        []tableEntity
+	batchBytes   int
+	partitionKey string
+	imported     int
+}
+
+// each operation in a batch carries headers and a URL as well as its entity
+const tableBatchOperationOverhead = 1024
+
+func (b *tableBatcher) add(ctx context.Context, e tableEntity) error {
+	partitionKey, _ := e.key("PartitionKey")
+	entityJSON, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	size := len(entityJSON) + tableBatchOperationOverhead
+
+	if len(b.batch) > 0 && (partitionKey != b.partitionKey || len(b.batch) >= b.batchSize || b.batchBytes+size > maxTableBatchBodyBytes) {
+		if err := b.flush(ctx); err != nil {
+			return err
+		}
+	}
+	b.batch = append(b.batch, e)
+	b.batchBytes += size
+	b.partitionKey = partitionKey
+	return nil
+}
+
+func (b *tableBatcher) flush(ctx context.Context) error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+	if err := b.table.upsertBatch(ctx, b.batch); err != nil {
+		return err
+	}
+	b.imported += len(b.batch)
+	b.batch = nil
+	b.batchBytes = 0
+	return nil
+}
+
+func writeNDJSONEntity(w io.Writer, e tableEntity) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(e) // which ends the line
+}
+
+func readNDJSONEntities(r io.Reader, process func(tableEntity) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTableEntityLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e tableEntity
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d is not a JSON object: %v", line, err)
+		}
+		if err := process(e); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// A CSV column holds one property, of one type. Its header is the property name, followed by the type, as in
+// Count:Edm.Int64, except for strings, which have no type, so that a CSV file written by hand can just name its columns.
+// An empty cell means the entity doesn't have that property.
+type csvColumn struct {
+	name    string
+	edmType string
+}
+
+func parseCSVColumn(header string) csvColumn {
+	if i := strings.LastIndex(header, ":"); i >= 0 && strings.HasPrefix(header[i+1:], "Edm.") {
+		return csvColumn{name: header[:i], edmType: header[i+1:]}
+	}
+	return csvColumn{name: header, edmType: edmString}
+}
+
+func (c csvColumn) header() string {
+	if c.edmType == edmString {
+		return c.name
+	}
+	return c.name + ":" + c.edmType
+}
+
+type csvColumnSet map[csvColumn]bool
+
+func newCSVColumnSet() csvColumnSet {
+	return make(csvColumnSet)
+}
+
+func (s csvColumnSet) add(e tableEntity) {
+	for _, name := range e.propertyNames() {
+		s[csvColumn{name: name, edmType: e.propertyType(name)}] = true
+	}
+}
+
+// sorted returns the columns with the keys first, then the timestamp, then the others by name
+func (s csvColumnSet) sorted() []csvColumn {
+	rank := func(c csvColumn) int {
+		switch c.name {
+		case "PartitionKey":
+			return 0
+		case "RowKey":
+			return 1
+		case "Timestamp":
+			return 2
+		default:
+			return 3
+		}
+	}
+
+	columns := make([]csvColumn, 0, len(s))
+	for c := range s {
+		columns = append(columns, c)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if rank(columns[i]) != rank(columns[j]) {
+			return rank(columns[i]) < rank(columns[j])
+		}
+		return columns[i].header() < columns[j].header()
+	})
+	return columns
+}
+
+// writeEntitiesAsCSV converts a file of NDJSON entities to CSV
+func writeEntitiesAsCSV(ndjson io.Reader, columns []csvColumn, out io.Writer) error {
+	w := csv.NewWriter(out)
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = c.header()
+	}
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	err := readNDJSONEntities(ndjson, func(e tableEntity) error {
+		for i, c := range columns {
+			row[i] = ""
+			if _, ok := e[c.name]; ok && e.propertyType(c.name) == c.edmType {
+				row[i] = csvCell(e[c.name])
+			}
+		}
+		return w.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvCell returns the text of a JSON value: the string itself, if it is one, and otherwise the JSON
+func csvCell(value json.RawMessage) string {
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return s
+	}
+	return string(value)
+}
+
+func readCSVEntities(r io.Reader, process func(tableEntity) error) error {
+	reader := csv.NewReader(r)
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	columns := make([]csvColumn, len(headers))
+	for i, h := range headers {
+		columns[i] = parseCSVColumn(h)
+	}
+
+	for rowNumber := 1; ; rowNumber++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		e := make(tableEntity)
+		for i, cell := range row {
+			if cell == "" {
+				continue
+			}
+			if err := e.setProperty(columns[i].name, columns[i].edmType, cell); err != nil {
+				return fmt.Errorf("row %d: %v", rowNumber, err)
+			}
+		}
+		if err := process(e); err != nil {
+			return fmt.Errorf("row %d: %v", rowNumber, err)
+		}
+	}
+}
+
+// setProperty sets a property from its text in a CSV file
+func (e tableEntity) setProperty(name string, edmType string, text string) error {
+	quoted := func(s string) json.RawMessage {
+		b, _ := json.Marshal(s)
+		return b
+	}
+	invalid := fmt.Errorf("the value '%s' of %s is not a valid %s", text, name, edmType)
+
+	annotate := true
+	switch edmType {
+	case edmString:
+		e[name] = quoted(text)
+		annotate = false
+	case edmInt32:
+		if _, err := strconv.ParseInt(text, 10, 32); err != nil {
+			return invalid
+		}
+		e[name] = json.RawMessage(text)
+		annotate = false
+	case edmInt64:
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return invalid
+		}
+		e[name] = quoted(text) // as a string, since JSON numbers aren't exact beyond 2^53
+	case edmDouble:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return invalid
+		}
+		// the service spells these as strings
+		if math.IsNaN(f) {
+			e[name] = quoted("NaN")
+		} else if math.IsInf(f, 1) {
+			e[name] = quoted("Infinity")
+		} else if math.IsInf(f, -1) {
+			e[name] = quoted("-Infinity")
+		} else {
+			e[name] = json.RawMessage(text)
+		}
+	case edmBoolean:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return invalid
+		}
+		e[name] = json.RawMessage(strconv.FormatBool(b))
+		annotate = false
+	case edmDateTime:
+		if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+			return invalid
+		}
+		e[name] = quoted(text)
+	case edmGuid:
+		if _, err := common.ParseUUID(text); err != nil {
+			return invalid
+		}
+		e[name] = quoted(text)
+	case edmBinary:
+		if _, err := base64.StdEncoding.DecodeString(text); err != nil {
+			return invalid
+		}
+		e[name] = quoted(text)
+	default:
+		return fmt.Errorf("the type %s of %s is not supported", edmType, name)
+	}
+
+	if annotate {
+		e[name+odataTypeSuffix] = quoted(edmType)
+	}
+	return nil
+}
+
+func init() {
+	exportRaw := rawTableCmdArgs{batchSize: maxTableBatchSize} // export doesn't batch, but that's what cooking checks
+	exportTableCmd := &cobra.Command{
+		Use:     "export-table [table URL] [local file]",
+		Short:   exportTableCmdShortDescription,
+		Long:    exportTableCmdLongDescription,
+		Example: exportTableCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("please provide the URL of the table, and the local file to write its entities to")
+			}
+			exportRaw.src, exportRaw.dst = args[0], args[1]
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cooked, err := exportRaw.cook(exportRaw.src, exportRaw.dst)
+			if err != nil {
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
+			}
+
+			count, err := cooked.export(context.Background())
+			if err != nil {
+				glcm.Error(fmt.Sprintf("failed to export the table after %d entities: %s", count, err.Error()))
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				return fmt.Sprintf("Exported %d entities of table %s to %s.", count, cooked.table.tableName, cooked.localPath)
+			}, common.EExitCode.Success())
+		},
+	}
+	rootCmd.AddCommand(exportTableCmd)
+	exportTableCmd.PersistentFlags().StringVar(&exportRaw.format, "format", "", "The format of the local file: ndjson or csv. By default, files whose names end in .csv are CSV, and others NDJSON.")
+
+	importRaw := rawTableCmdArgs{}
+	importTableCmd := &cobra.Command{
+		Use:     "import-table [local file] [table URL]",
+		Short:   importTableCmdShortDescription,
+		Long:    importTableCmdLongDescription,
+		Example: importTableCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("please provide the local file of entities, and the URL of the table to import them into")
+			}
+			importRaw.src, importRaw.dst = args[0], args[1]
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cooked, err := importRaw.cook(importRaw.dst, importRaw.src)
+			if err != nil {
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
+			}
+
+			count, err := cooked.importEntities(context.Background())
+			if err != nil {
+				glcm.Error(fmt.Sprintf("failed to import the entities after %d of them: %s", count, err.Error()))
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				return fmt.Sprintf("Imported %d entities from %s into table %s.", count, cooked.localPath, cooked.table.tableName)
+			}, common.EExitCode.Success())
+		},
+	}
+	rootCmd.AddCommand(importTableCmd)
+	importTableCmd.PersistentFlags().StringVar(&importRaw.format, "format", "", "The format of the local file: ndjson or csv. By default, files whose names end in .csv are CSV, and others NDJSON.")
+	importTableCmd.PersistentFlags().Uint32Var(&importRaw.batchSize, "batch-size", maxTableBatchSize, "How many entities (with the same PartitionKey) to insert in each batch. At most 100.")
+}
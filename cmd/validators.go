@@ -24,6 +24,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/Azure/azure-storage-azcopy/common"
@@ -55,6 +57,23 @@ func validateFromTo(src, dst string, userSpecifiedFromTo string) (common.FromTo,
 	return common.EFromTo.Unknown(), errors.New("the specified --from-to switch is inconsistent with the specified source/destination combination")
 }
 
+// validateURLListFromTo validates the direction of a copy from a URL list, whose files are always read from web servers
+func validateURLListFromTo(src, dst string, userSpecifiedFromTo string) (common.FromTo, error) {
+	if src != "" {
+		return common.EFromTo.Unknown(), errors.New("a source cannot be given with url-list, since the sources are the URLs in the list")
+	}
+	if userSpecifiedFromTo != "" {
+		var userFromTo common.FromTo
+		if err := userFromTo.Parse(userSpecifiedFromTo); err != nil || userFromTo != common.EFromTo.HttpBlob() {
+			return common.EFromTo.Unknown(), fmt.Errorf("invalid --from-to value %q with url-list. Only HttpBlob is supported", userSpecifiedFromTo)
+		}
+	}
+	if inferArgumentLocation(dst) != common.ELocation.Blob() {
+		return common.EFromTo.Unknown(), errors.New("the destination of url-list must be Azure Blob Storage")
+	}
+	return common.EFromTo.HttpBlob(), nil
+}
+
 func inferFromTo(src, dst string) common.FromTo {
 	// Try to infer the 1st argument
 	srcLocation := inferArgumentLocation(src)
@@ -100,6 +119,14 @@ func inferFromTo(src, dst string) common.FromTo {
 		return common.EFromTo.FileFile()
 	case srcLocation == common.ELocation.S3() && dstLocation == common.ELocation.Blob():
 		return common.EFromTo.S3Blob()
+	case srcLocation == common.ELocation.Http() && dstLocation == common.ELocation.Blob():
+		return common.EFromTo.HttpBlob()
+	case srcLocation == common.ELocation.Sftp() && dstLocation == common.ELocation.Blob():
+		return common.EFromTo.SftpBlob()
+	case srcLocation == common.ELocation.Blob() && dstLocation == common.ELocation.Sftp():
+		return common.EFromTo.BlobSftp()
+	case srcLocation == common.ELocation.Local() && dstLocation == common.ELocation.Local():
+		return common.EFromTo.LocalLocal()
 	case srcLocation == common.ELocation.Benchmark() && dstLocation == common.ELocation.Blob():
 		return common.EFromTo.BenchmarkBlob()
 	case srcLocation == common.ELocation.Benchmark() && dstLocation == common.ELocation.File():
@@ -114,6 +141,9 @@ func inferArgumentLocation(arg string) common.Location {
 	if arg == pipeLocation {
 		return common.ELocation.Pipe()
 	}
+	if startsWith(arg, "sftp://") {
+		return common.ELocation.Sftp()
+	}
 	if startsWith(arg, "http") {
 		// Let's try to parse the argument as a URL
 		u, err := url.Parse(arg)
@@ -135,8 +165,71 @@ func inferArgumentLocation(arg string) common.Location {
 			if common.IsS3URL(*u) {
 				return common.ELocation.S3()
 			}
+
+			// any other web server, from which a file can be read, but to which nothing can be written
+			if scheme := strings.ToLower(u.Scheme); scheme == "http" || scheme == "https" {
+				return common.ELocation.Http()
+			}
 		}
 	}
 
 	return common.ELocation.Local()
 }
+
+// validateLocalPathsDontOverlap rejects a transfer between local paths where either one is inside the other,
+// once symlinks are resolved, since the transfer would then read what it has written, or overwrite what it has yet to read
+func validateLocalPathsDontOverlap(source, destination string) error {
+	// a wildcard source is the files of its directory
+	for strings.Contains(source, "*") {
+		source = filepath.Dir(source)
+	}
+
+	resolvedSource, err := resolveLocalPath(source)
+	if err != nil {
+		return err
+	}
+	resolvedDestination, err := resolveLocalPath(destination)
+	if err != nil {
+		return err
+	}
+
+	if localPathIsWithin(resolvedSource, resolvedDestination) {
+		return fmt.Errorf("the destination %s is inside the source %s", destination, source)
+	}
+	if localPathIsWithin(resolvedDestination, resolvedSource) {
+		return fmt.Errorf("the source %s is inside the destination %s", source, destination)
+	}
+	return nil
+}
+
+// resolveLocalPath makes a local path absolute, with its symlinks resolved. The path needn't exist, as a destination may not yet:
+// then the symlinks of its nearest parent that does exist are resolved
+func resolveLocalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := ""
+	for dir := abs; ; {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		missing = filepath.Join(filepath.Base(dir), missing)
+		dir = parent
+	}
+}
+
+// localPathIsWithin returns true if path is parent, or is inside it. Both must be absolute
+func localPathIsWithin(parent, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,474 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/spf13/cobra"
+)
+
+// the version of the Queue service REST API used by the worker
+const workerQueueServiceVersion = "2018-03-28"
+
+type rawWorkerCmdArgs struct {
+	queueURL                 string
+	resultsQueueURL          string
+	visibilityTimeoutSeconds uint32
+	pollIntervalSeconds      uint32
+	maxDequeueCount          uint32
+	exitWhenEmpty            bool
+}
+
+type cookedWorkerCmdArgs struct {
+	requests          *storageQueue
+	results           *storageQueue // nil if results are not being posted
+	visibilityTimeout time.Duration
+	pollInterval      time.Duration
+	maxDequeueCount   int
+	exitWhenEmpty     bool
+}
+
+func (raw rawWorkerCmdArgs) cook() (cookedWorkerCmdArgs, error) {
+	cooked := cookedWorkerCmdArgs{
+		visibilityTimeout: time.Duration(raw.visibilityTimeoutSeconds) * time.Second,
+		pollInterval:      time.Duration(raw.pollIntervalSeconds) * time.Second,
+		maxDequeueCount:   int(raw.maxDequeueCount),
+		exitWhenEmpty:     raw.exitWhenEmpty,
+	}
+
+	if raw.queueURL == "" {
+		return cooked, errors.New("the URL of the request queue must be specified with --queue-url")
+	}
+	if raw.visibilityTimeoutSeconds == 0 || raw.visibilityTimeoutSeconds > 7*24*60*60 {
+		return cooked, errors.New("--visibility-timeout must be between 1 second and 7 days")
+	}
+	if raw.maxDequeueCount == 0 {
+		return cooked, errors.New("--max-dequeue-count must be greater than zero")
+	}
+
+	var err error
+	if cooked.requests, err = newStorageQueue(raw.queueURL); err != nil {
+		return cooked, fmt.Errorf("invalid --queue-url: %s", err.Error())
+	}
+	if raw.resultsQueueURL != "" {
+		if cooked.results, err = newStorageQueue(raw.resultsQueueURL); err != nil {
+			return cooked, fmt.Errorf("invalid --results-queue-url: %s", err.Error())
+		}
+	}
+
+	return cooked, nil
+}
+
+// workerRequest is the JSON body of a message in the request queue
+type workerRequest struct {
+	Command     string            `json:"command"`
+	Source      string            `json:"source"`
+	Destination string            `json:"destination"`
+	Options     map[string]string `json:"options"`
+}
+
+// workerResult is the JSON body of a message posted to the results queue
+type workerResult struct {
+	MessageID   string
+	Command     string
+	Source      string
+	Destination string
+	Succeeded   bool
+	ExitCode    int
+	Error       string `json:",omitempty"`
+	FinalOutput string `json:",omitempty"`
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// parseWorkerRequest accepts both plain JSON and Base64-encoded JSON, since the latter is what the Storage SDKs send by default
+func parseWorkerRequest(messageText string) (workerRequest, error) {
+	req := workerRequest{}
+	body := []byte(messageText)
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(messageText)); err == nil {
+		body = decoded
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, fmt.Errorf("the message is not a valid transfer request: %s", err.Error())
+	}
+
+	if req.Command == "" {
+		req.Command = "copy"
+	}
+	switch req.Command {
+	case "copy", "sync":
+		if req.Source == "" || req.Destination == "" {
+			return req, fmt.Errorf("%s requests must have both a source and a destination", req.Command)
+		}
+	case "remove":
+		if req.Source == "" {
+			return req, errors.New("remove requests must have a source")
+		}
+	default:
+		return req, fmt.Errorf("unsupported command '%s'", req.Command)
+	}
+	return req, nil
+}
+
+// commandLine returns the arguments with which AzCopy must be run to carry out the request.
+// The options are sorted, so that the same request always results in the same command line.
+func (r workerRequest) commandLine() []string {
+	args := []string{r.Command, r.Source}
+	if r.Command != "remove" {
+		args = append(args, r.Destination)
+	}
+
+	names := make([]string, 0, len(r.Options))
+	for name := range r.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "output-type" {
+			continue // we control the output format, so that we can report the outcome
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", strings.TrimLeft(name, "-"), r.Options[name]))
+	}
+
+	return append(args, "--output-type=json")
+}
+
+func (cooked cookedWorkerCmdArgs) process() error {
+	ctx := context.Background()
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the AzCopy executable: %s", err.Error())
+	}
+
+	for {
+		msg, err := cooked.requests.receive(ctx, cooked.visibilityTimeout)
+		if err != nil {
+			// the queue may be briefly unavailable, so keep going rather than stopping the worker
+			glcm.Info("Failed to poll the request queue: " + err.Error())
+		}
+
+		if msg == nil {
+			if cooked.exitWhenEmpty && err == nil {
+				return nil
+			}
+			time.Sleep(cooked.pollInterval)
+			continue
+		}
+
+		stopHiding := cooked.keepHidden(ctx, msg)
+		result := cooked.runRequest(ctx, self, msg)
+		stopHiding()
+		if cooked.results != nil {
+			body, _ := json.Marshal(result)
+			if err := cooked.results.put(ctx, base64.StdEncoding.EncodeToString(body)); err != nil {
+				glcm.Info(fmt.Sprintf("Failed to post the result of message %s: %s", msg.MessageID, err.Error()))
+			}
+		}
+
+		if err := cooked.requests.delete(ctx, msg); err != nil {
+			glcm.Info(fmt.Sprintf("Failed to delete message %s, so it may be processed again: %s", msg.MessageID, err.Error()))
+		}
+	}
+}
+
+// keepHidden renews the visibility timeout of the message every half timeout while its request runs, so that a request that
+// takes longer than the timeout isn't received, and run again, by another worker. It stops when the returned func is called
+func (cooked cookedWorkerCmdArgs) keepHidden(ctx context.Context, msg *storageQueueMessage) (stop func()) {
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(cooked.visibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := cooked.requests.hide(ctx, msg, cooked.visibilityTimeout); err != nil {
+					glcm.Info(fmt.Sprintf("Failed to renew the visibility timeout of message %s, so another worker may run it too: %s", msg.MessageID, err.Error()))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-done
+	}
+}
+
+func (cooked cookedWorkerCmdArgs) runRequest(ctx context.Context, self string, msg *storageQueueMessage) workerResult {
+	result := workerResult{MessageID: msg.MessageID, StartTime: time.Now(), ExitCode: int(common.EExitCode.Error())}
+	defer func() { result.EndTime = time.Now() }()
+
+	req, err := parseWorkerRequest(msg.MessageText)
+	result.Command, result.Source, result.Destination = req.Command, req.Source, req.Destination
+	if err != nil {
+		result.Error = err.Error()
+		glcm.Info(fmt.Sprintf("Skipping message %s: %s", msg.MessageID, err.Error()))
+		return result
+	}
+
+	if msg.DequeueCount > cooked.maxDequeueCount {
+		result.Error = fmt.Sprintf("abandoned after being dequeued %d times", msg.DequeueCount)
+		glcm.Info(fmt.Sprintf("Abandoning message %s, since it has been dequeued %d times", msg.MessageID, msg.DequeueCount))
+		return result
+	}
+
+	glcm.Info(fmt.Sprintf("Running %s request from message %s", req.Command, msg.MessageID))
+
+	// Each request runs in its own AzCopy process, so that it has its own job and its own exit code,
+	// exactly as if the user had run it from the command line.
+	var stdout bytes.Buffer
+	child := exec.CommandContext(ctx, self, req.commandLine()...)
+	child.Stdout = &stdout
+	child.Stderr = os.Stderr
+	err = child.Run()
+
+	result.FinalOutput = lastNonEmptyLine(stdout.String())
+	result.EndTime = time.Now()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+		result.Error = exitErr.Error()
+	} else if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.ExitCode = int(common.EExitCode.Success())
+		result.Succeeded = true
+	}
+
+	glcm.Info(fmt.Sprintf("Finished message %s with exit code %d", msg.MessageID, result.ExitCode))
+	return result
+}
+
+func lastNonEmptyLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// storageQueue is a minimal client for the Azure Storage Queue REST API, authenticated by the SAS in its URL
+type storageQueue struct {
+	messagesURL url.URL
+	client      *http.Client
+}
+
+type storageQueueMessage struct {
+	MessageID      string `xml:"MessageId"`
+	InsertionTime  string `xml:"InsertionTime"`
+	ExpirationTime string `xml:"ExpirationTime"`
+	PopReceipt     string `xml:"PopReceipt"`
+	DequeueCount   int    `xml:"DequeueCount"`
+	MessageText    string `xml:"MessageText"`
+}
+
+type storageQueueMessagesList struct {
+	Messages []storageQueueMessage `xml:"QueueMessage"`
+}
+
+func newStorageQueue(rawURL string) (*storageQueue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, errors.New("the queue must be given as an http or https URL")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/messages"
+	return &storageQueue{messagesURL: *u, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (q *storageQueue) do(ctx context.Context, method string, u url.URL, body []byte) ([]byte, error) {
+	respBody, _, err := q.doWithHeaders(ctx, method, u, body)
+	return respBody, err
+}
+
+// doWithHeaders is do, for the operations whose results are in the headers of the response
+func (q *storageQueue) doWithHeaders(ctx context.Context, method string, u url.URL, body []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("x-ms-version", workerQueueServiceVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("the queue service returned %s", resp.Status)
+	}
+	return respBody, resp.Header, nil
+}
+
+// receive returns the next visible message, or nil if the queue is empty
+func (q *storageQueue) receive(ctx context.Context, visibilityTimeout time.Duration) (*storageQueueMessage, error) {
+	messages, err := q.receiveMany(ctx, 1, visibilityTimeout)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// receiveMany returns up to count (at most 32) of the visible messages, or none if the queue is empty
+func (q *storageQueue) receiveMany(ctx context.Context, count int, visibilityTimeout time.Duration) ([]storageQueueMessage, error) {
+	u := q.messagesURL
+	query := u.Query()
+	query.Set("numofmessages", fmt.Sprintf("%d", count))
+	query.Set("visibilitytimeout", fmt.Sprintf("%d", int(visibilityTimeout.Seconds())))
+	u.RawQuery = query.Encode()
+
+	body, err := q.do(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	list := storageQueueMessagesList{}
+	if err = xml.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	return list.Messages, nil
+}
+
+func (q *storageQueue) delete(ctx context.Context, msg *storageQueueMessage) error {
+	u := q.messagesURL
+	u.Path += "/" + msg.MessageID
+	query := u.Query()
+	query.Set("popreceipt", msg.PopReceipt)
+	u.RawQuery = query.Encode()
+
+	_, err := q.do(ctx, http.MethodDelete, u, nil)
+	return err
+}
+
+// hide keeps the message from other receivers for visibilityTimeout from now. The service gives the message a new pop receipt
+// each time, and only the latest can be used to delete or hide it, so the message is updated with it
+func (q *storageQueue) hide(ctx context.Context, msg *storageQueueMessage, visibilityTimeout time.Duration) error {
+	u := q.messagesURL
+	u.Path += "/" + msg.MessageID
+	query := u.Query()
+	query.Set("popreceipt", msg.PopReceipt)
+	query.Set("visibilitytimeout", fmt.Sprintf("%d", int(visibilityTimeout.Seconds())))
+	u.RawQuery = query.Encode()
+
+	_, header, err := q.doWithHeaders(ctx, http.MethodPut, u, nil)
+	if err != nil {
+		return err
+	}
+	if popReceipt := header.Get("x-ms-popreceipt"); popReceipt != "" {
+		msg.PopReceipt = popReceipt
+	}
+	return nil
+}
+
+func (q *storageQueue) put(ctx context.Context, messageText string) error {
+	return q.putWithTimeToLive(ctx, messageText, 0)
+}
+
+// putWithTimeToLive adds a message that expires after timeToLive. Zero means the service's default of 7 days,
+// and a negative value means that the message never expires.
+func (q *storageQueue) putWithTimeToLive(ctx context.Context, messageText string, timeToLive time.Duration) error {
+	body, err := xml.Marshal(struct {
+		XMLName     xml.Name `xml:"QueueMessage"`
+		MessageText string   `xml:"MessageText"`
+	}{MessageText: messageText})
+	if err != nil {
+		return err
+	}
+
+	u := q.messagesURL
+	if timeToLive != 0 {
+		query := u.Query()
+		if timeToLive < 0 {
+			query.Set("messagettl", "-1")
+		} else {
+			query.Set("messagettl", fmt.Sprintf("%d", int64(timeToLive.Seconds())))
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	_, err = q.do(ctx, http.MethodPost, u, body)
+	return err
+}
+
+func init() {
+	raw := rawWorkerCmdArgs{}
+
+	workerCmd := &cobra.Command{
+		Use:     "worker",
+		Short:   workerCmdShortDescription,
+		Long:    workerCmdLongDescription,
+		Example: workerCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("the worker command does not accept positional arguments")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cooked, err := raw.cook()
+			if err != nil {
+				glcm.Error(common.UserMessages().Sprintf(common.MsgFailedToParseInput, err.Error()))
+			}
+
+			if err = cooked.process(); err != nil {
+				glcm.Error("worker stopped due to error: " + err.Error())
+			}
+
+			glcm.Exit(func(format common.OutputFormat) string {
+				return "The request queue is empty. Worker is exiting."
+			}, common.EExitCode.Success())
+		},
+	}
+
+	rootCmd.AddCommand(workerCmd)
+	workerCmd.PersistentFlags().StringVar(&raw.queueURL, "queue-url", "", "URL, including SAS, of the Azure Storage queue from which to read transfer requests.")
+	workerCmd.PersistentFlags().StringVar(&raw.resultsQueueURL, "results-queue-url", "", "URL, including SAS, of an Azure Storage queue to which the outcome of each request is posted.")
+	workerCmd.PersistentFlags().Uint32Var(&raw.visibilityTimeoutSeconds, "visibility-timeout", 3600, "How many seconds a request is hidden from other workers after it is received. "+
+		"The timeout is renewed every half timeout while the request runs, so it only needs to be as long as other workers should wait to take over the requests of a worker that stopped.")
+	workerCmd.PersistentFlags().Uint32Var(&raw.pollIntervalSeconds, "poll-interval", 10, "How many seconds to wait before checking the queue again when it is empty.")
+	workerCmd.PersistentFlags().Uint32Var(&raw.maxDequeueCount, "max-dequeue-count", 5, "Abandon a request that has already been received more than this many times.")
+	workerCmd.PersistentFlags().BoolVar(&raw.exitWhenEmpty, "exit-when-empty", false, "Exit once the request queue is empty, rather than waiting for more requests.")
+}
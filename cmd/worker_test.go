@@ -0,0 +1,91 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http/httptest"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type workerTestSuite struct{}
+
+var _ = chk.Suite(&workerTestSuite{})
+
+func (s *workerTestSuite) TestParseWorkerRequest(c *chk.C) {
+	plain := `{"source": "/data", "destination": "https://acct.blob.core.windows.net/c?sas", "options": {"recursive": "true", "block-size-mb": "16"}}`
+
+	for _, text := range []string{plain, base64.StdEncoding.EncodeToString([]byte(plain))} {
+		req, err := parseWorkerRequest(text)
+		c.Assert(err, chk.IsNil)
+		c.Assert(req.Command, chk.Equals, "copy")
+		c.Assert(req.commandLine(), chk.DeepEquals, []string{"copy", "/data", "https://acct.blob.core.windows.net/c?sas",
+			"--block-size-mb=16", "--recursive=true", "--output-type=json"})
+	}
+
+	req, err := parseWorkerRequest(`{"command": "remove", "source": "https://acct.blob.core.windows.net/c/d", "options": {"output-type": "text"}}`)
+	c.Assert(err, chk.IsNil)
+	c.Assert(req.commandLine(), chk.DeepEquals, []string{"remove", "https://acct.blob.core.windows.net/c/d", "--output-type=json"})
+
+	_, err = parseWorkerRequest(`{"command": "sync", "source": "/data"}`)
+	c.Assert(err, chk.NotNil)
+
+	_, err = parseWorkerRequest(`{"command": "bench", "source": "/data", "destination": "/other"}`)
+	c.Assert(err, chk.NotNil)
+
+	_, err = parseWorkerRequest("not json")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *workerTestSuite) TestMessagesAreKeptHiddenWhileTheirRequestsRun(c *chk.C) {
+	service := &fakeQueueService{messages: []string{"request"}}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	queue, err := newStorageQueue(server.URL + "/account/q?sig=secret")
+	c.Assert(err, chk.IsNil)
+	cooked := cookedWorkerCmdArgs{requests: queue, visibilityTimeout: time.Second}
+
+	ctx := context.Background()
+	msg, err := queue.receive(ctx, cooked.visibilityTimeout)
+	c.Assert(err, chk.IsNil)
+	c.Assert(msg, chk.NotNil)
+
+	// a request that runs for longer than the timeout has it renewed every half timeout
+	stop := cooked.keepHidden(ctx, msg)
+	time.Sleep(1200 * time.Millisecond)
+	stop()
+	service.mu.Lock()
+	hides := append([]string{}, service.hides...)
+	service.mu.Unlock()
+	c.Assert(len(hides) >= 2, chk.Equals, true)
+	c.Assert(hides[0], chk.Equals, "1")
+
+	// and it can still be deleted, with the latest pop receipt, and isn't renewed once it has stopped
+	c.Assert(msg.PopReceipt, chk.Not(chk.Equals), "pop0")
+	c.Assert(queue.delete(ctx, msg), chk.IsNil)
+	time.Sleep(600 * time.Millisecond)
+	service.mu.Lock()
+	c.Assert(service.hides, chk.HasLen, len(hides))
+	service.mu.Unlock()
+}
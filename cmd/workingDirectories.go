@@ -0,0 +1,84 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// the minimum free space required on the volumes holding the plan files and the logs before a job is started.
+// Plan files take a few hundred bytes per transfer, and a log can grow to a few hundred bytes per request,
+// so running out of space in the middle of a large job is far worse than refusing to start it.
+const minimumPlanDirFreeSpace = 64 * 1024 * 1024
+const minimumLogDirFreeSpace = 64 * 1024 * 1024
+
+// the commands that create job plan files and logs, which need the free space check
+var commandsThatStartJobs = map[string]bool{
+	"copy":   true,
+	"sync":   true,
+	"remove": true,
+	"bench":  true,
+	"resume": true,
+}
+
+// applyWorkingDirectoryFlags overrides the log and plan folders with the ones given on the command line, if any
+func applyWorkingDirectoryFlags() error {
+	if logDirRaw != "" {
+		if err := os.MkdirAll(logDirRaw, os.ModeDir|os.ModePerm); err != nil {
+			return fmt.Errorf("cannot create the log directory %s: %s", logDirRaw, err.Error())
+		}
+		azcopyLogPathFolder = logDirRaw
+	}
+
+	if planDirRaw != "" {
+		if err := os.MkdirAll(planDirRaw, os.ModeDir|os.ModePerm); err != nil {
+			return fmt.Errorf("cannot create the plan directory %s: %s", planDirRaw, err.Error())
+		}
+		azcopyJobPlanFolder = planDirRaw
+	}
+
+	return nil
+}
+
+// verifyWorkingDirectoriesHaveSpace fails if the volume holding the plan files or the logs is almost full.
+// If the free space cannot be determined, the check is skipped.
+func verifyWorkingDirectoriesHaveSpace() error {
+	if err := verifyFreeSpace(azcopyJobPlanFolder, minimumPlanDirFreeSpace, "plan-dir (AZCOPY_JOB_PLAN_LOCATION)"); err != nil {
+		return err
+	}
+	return verifyFreeSpace(azcopyLogPathFolder, minimumLogDirFreeSpace, "log-dir (AZCOPY_LOG_LOCATION)")
+}
+
+func verifyFreeSpace(dir string, minimum uint64, setting string) error {
+	available, err := common.GetAvailableDiskSpace(dir)
+	if err != nil {
+		return nil
+	}
+
+	if available < minimum {
+		return fmt.Errorf("there is only %s free on the volume holding %s, and at least %s is required. Free some space, or use %s to choose another location",
+			byteSizeToString(int64(available)), dir, byteSizeToString(int64(minimum)), setting)
+	}
+	return nil
+}
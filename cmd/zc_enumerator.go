@@ -75,6 +75,13 @@ type storedObject struct {
 	blobAccessTier azblob.AccessTierType
 	// metadata, included in S2S transfers
 	Metadata common.Metadata
+	// version of the blob that the transfer is pinned to, only set by the blob traverser when pinning versions
+	versionID string
+	// ETag of the object when it was listed, only included by blob traverser.
+	eTag azblob.ETag
+	// full URL of the object, for sources whose objects don't share a root, e.g. a URL list.
+	// relativePath is then the path of the object at the destination
+	sourceURL string
 }
 
 const (
@@ -116,6 +123,20 @@ type resourceTraverser interface {
 	// Thus, we only check the directory syntax on blob destinations. On sources, we check both syntax and remote, if syntax isn't a directory.
 }
 
+// implemented by the traversers that can stop descending once they are deep enough for max-depth,
+// so that they don't have to list what the max-depth filter would throw away
+type depthLimitedTraverser interface {
+	setMaxDepth(maxDepth int)
+}
+
+// limitTraverserDepth passes max-depth to the traverser if it can make use of it. A max depth of 0 means there is no limit.
+// The max-depth filter is still needed, for the traversers that can't
+func limitTraverserDepth(traverser resourceTraverser, maxDepth int) {
+	if t, ok := traverser.(depthLimitedTraverser); ok && maxDepth > 0 {
+		t.setMaxDepth(maxDepth)
+	}
+}
+
 type accountTraverser interface {
 	resourceTraverser
 	listContainers() ([]string, error)
@@ -161,7 +182,7 @@ func initResourceTraverser(resource string, location common.Location, ctx *conte
 
 	// Initialize the pipeline if creds and ctx is provided
 	if ctx != nil && credential != nil {
-		tmppipe, err := initPipeline(*ctx, location, *credential)
+		tmppipe, err := initListingPipeline(*ctx, location, *credential)
 
 		if err != nil {
 			return nil, err
@@ -178,7 +199,7 @@ func initResourceTraverser(resource string, location common.Location, ctx *conte
 	// Feed list of files channel into new list traverser, separate SAS.
 	if listofFilesChannel != nil {
 		sas := ""
-		if location.IsRemote() {
+		if location.IsRemote() || location == common.ELocation.Http() {
 			var err error
 			resource, sas, err = SplitAuthTokenFromResource(resource, location)
 
@@ -231,6 +252,34 @@ func initResourceTraverser(resource string, location common.Location, ctx *conte
 			return nil, err
 		}
 		output = ben
+	case common.ELocation.Http():
+		resourceURL, err := url.Parse(resource)
+		if err != nil {
+			return nil, err
+		}
+
+		recommendHttpsIfNecessary(*resourceURL)
+
+		if ctx == nil || p == nil {
+			return nil, errors.New("a valid context must be supplied to create an HTTP traverser")
+		}
+
+		output = newHTTPTraverser(resourceURL, *p, *ctx, incrementEnumerationCounter)
+
+	case common.ELocation.Sftp():
+		resourceURL, err := url.Parse(resource)
+		if err != nil {
+			return nil, err
+		}
+
+		if ctx == nil {
+			return nil, errors.New("a valid context must be supplied to create an SFTP traverser")
+		}
+
+		output, err = newSftpTraverser(resourceURL, *ctx, recursive, incrementEnumerationCounter)
+		if err != nil {
+			return nil, err
+		}
 
 	case common.ELocation.Blob():
 		resourceURL, err := url.Parse(resource)
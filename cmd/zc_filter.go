@@ -52,6 +52,151 @@ func (f *excludeBlobTypeFilter) doesPass(object storedObject) bool {
 	return false
 }
 
+// includeBlobTypeFilter is the counterpart of excludeBlobTypeFilter: only objects of the listed blob types pass
+type includeBlobTypeFilter struct {
+	blobTypes map[azblob.BlobType]bool
+}
+
+func (f *includeBlobTypeFilter) doesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *includeBlobTypeFilter) doesPass(object storedObject) bool {
+	return f.blobTypes[object.blobType]
+}
+
+// includeContentTypeFilter passes objects whose content type matches any of the patterns, e.g. video/* or application/pdf.
+// Matching is case-insensitive, and ignores any parameters of the content type (such as charset).
+type includeContentTypeFilter struct {
+	patterns []string
+}
+
+func (f *includeContentTypeFilter) doesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *includeContentTypeFilter) doesPass(object storedObject) bool {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(object.contentType, ";")[0]))
+
+	for _, pattern := range f.patterns {
+		matched, err := path.Match(strings.ToLower(pattern), contentType)
+
+		// if the pattern failed to match with an error, then we assume the pattern is invalid
+		// and ignore it
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildIncludeBlobPropertyFilters returns the filters for include-blob-type and include-content-type, if specified
+func buildIncludeBlobPropertyFilters(blobTypes []azblob.BlobType, contentTypePatterns []string) []objectFilter {
+	filters := make([]objectFilter, 0)
+
+	if len(blobTypes) != 0 {
+		includeSet := map[azblob.BlobType]bool{}
+		for _, v := range blobTypes {
+			includeSet[v] = true
+		}
+		filters = append(filters, &includeBlobTypeFilter{blobTypes: includeSet})
+	}
+
+	if len(contentTypePatterns) != 0 {
+		filters = append(filters, &includeContentTypeFilter{patterns: contentTypePatterns})
+	}
+
+	return filters
+}
+
+// maxDepthFilter passes objects that are no more than maxDepth levels below the root of the enumeration
+type maxDepthFilter struct {
+	maxDepth int
+}
+
+func (f *maxDepthFilter) doesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *maxDepthFilter) doesPass(object storedObject) bool {
+	return relativePathDepth(object.relativePath) <= f.maxDepth
+}
+
+// relativePathDepth returns how many levels below the root the relative path is. A file directly in the root is at depth 1.
+func relativePathDepth(relativePath string) int {
+	relativePath = strings.Trim(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING)
+	if relativePath == "" {
+		return 0
+	}
+	return strings.Count(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING) + 1
+}
+
+// buildMaxDepthFilters returns the filter for max-depth. A max depth of 0 means there is no limit.
+func buildMaxDepthFilters(maxDepth int) []objectFilter {
+	if maxDepth <= 0 {
+		return []objectFilter{}
+	}
+	return []objectFilter{&maxDepthFilter{maxDepth: maxDepth}}
+}
+
+// excludeHiddenFilter excludes files that are hidden, system or temporary by convention:
+// anything whose name (or the name of a parent directory) starts with a dot, and the well known litter of editors and file browsers.
+// On Windows, files with the hidden or system attribute can also be excluded with exclude-attributes.
+type excludeHiddenFilter struct{}
+
+// names of files created by the operating system or applications, that users almost never intend to transfer
+var conventionalHiddenFileNames = map[string]bool{
+	"thumbs.db":   true,
+	"desktop.ini": true,
+	"ehthumbs.db": true,
+}
+
+// suffixes of temporary files left by editors and partially completed downloads
+var conventionalTemporaryFileSuffixes = []string{"~", ".tmp", ".swp", ".crdownload", ".partial"}
+
+func (f *excludeHiddenFilter) doesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *excludeHiddenFilter) doesPass(object storedObject) bool {
+	relativePath := object.relativePath
+	if relativePath == "" {
+		relativePath = object.name
+	}
+
+	segments := strings.Split(strings.Trim(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING), common.AZCOPY_PATH_SEPARATOR_STRING)
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+
+	name := strings.ToLower(segments[len(segments)-1])
+	if conventionalHiddenFileNames[name] || strings.HasPrefix(name, "~$") {
+		return false
+	}
+	for _, suffix := range conventionalTemporaryFileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// buildConventionalExcludeFilters returns the filters for exclude-hidden and exclude-patterns-file, if specified
+func buildConventionalExcludeFilters(excludeHidden bool, matcher *ignoreMatcher) []objectFilter {
+	filters := make([]objectFilter, 0)
+	if excludeHidden {
+		filters = append(filters, &excludeHiddenFilter{})
+	}
+	if matcher != nil {
+		filters = append(filters, &ignoreFileFilter{matcher: matcher})
+	}
+	return filters
+}
+
 type excludeFilter struct {
 	pattern     string
 	targetsPath bool // TODO: include targetsPath in sync
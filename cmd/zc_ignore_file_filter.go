@@ -0,0 +1,214 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// the conventional name of the file holding the exclusion rules of a source tree
+const defaultIgnoreFileName = ".azcopyignore"
+
+// ignoreRule is one line of an ignore file, with the same syntax as a .gitignore line
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool // the rule starts with ! and re-includes what an earlier rule excluded
+	dirOnly bool // the rule ends with / and only matches directories
+}
+
+// ignoreMatcher decides whether a relative path is excluded by the rules of an ignore file.
+// The rules follow .gitignore: the last matching rule wins, ! negates a rule, a trailing / only matches directories,
+// and a path is excluded if any of its parent directories is excluded (which cannot be undone by a negated rule).
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// loadIgnoreMatcher reads the ignore file at the given path.
+// When the path is relative and cannot be found, it is looked for inside the local source directory (if any),
+// so that the ignore file can be kept in the source tree.
+func loadIgnoreMatcher(path string, localSourceDir string) (*ignoreMatcher, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && localSourceDir != "" && !filepath.IsAbs(path) {
+		if fileInSource, errInSource := os.Open(filepath.Join(localSourceDir, path)); errInSource == nil {
+			file, err = fileInSource, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the exclude patterns file: %s", err.Error())
+	}
+	defer file.Close()
+
+	return newIgnoreMatcher(file)
+}
+
+func newIgnoreMatcher(reader io.Reader) (*ignoreMatcher, error) {
+	matcher := &ignoreMatcher{}
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		rule, ok, err := parseIgnoreRule(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern on line %d of the exclude patterns file: %s", lineNumber, err.Error())
+		}
+		if ok {
+			matcher.rules = append(matcher.rules, rule)
+		}
+	}
+
+	return matcher, scanner.Err()
+}
+
+// parseIgnoreRule parses a single line. ok is false for blank lines and comments.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool, err error) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// trailing spaces are ignored unless they are escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return rule, false, nil
+	}
+
+	// a pattern with a slash at the beginning or in the middle is relative to the root,
+	// otherwise it can match at any level
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expression := ignorePatternToRegexp(line)
+	if !anchored {
+		expression = "(?:.*/)?" + expression
+	}
+
+	rule.pattern, err = regexp.Compile("^" + expression + "$")
+	return rule, err == nil, err
+}
+
+// ignorePatternToRegexp translates the wildcards of an ignore pattern: * and ? do not match a slash,
+// while ** matches across directories
+func ignorePatternToRegexp(pattern string) string {
+	var builder strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			// zero or more directories
+			builder.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case c == '*':
+			builder.WriteString("[^/]*")
+		case c == '?':
+			builder.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			builder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + strings.ReplaceAll(class, "/", "") + "]")
+			i += end + 1
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return builder.String()
+}
+
+// isIgnored returns true if the file at the given relative path is excluded
+func (m *ignoreMatcher) isIgnored(relativePath string) bool {
+	relativePath = strings.Trim(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING)
+	segments := strings.Split(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING)
+
+	// a file inside an excluded directory is always excluded
+	for i := 1; i < len(segments); i++ {
+		if m.matches(strings.Join(segments[:i], common.AZCOPY_PATH_SEPARATOR_STRING), true) {
+			return true
+		}
+	}
+
+	return m.matches(relativePath, false)
+}
+
+// matches applies the rules in order, the last one that matches decides the outcome
+func (m *ignoreMatcher) matches(relativePath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(relativePath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreFileFilter excludes the objects matched by the rules of an ignore file
+type ignoreFileFilter struct {
+	matcher *ignoreMatcher
+}
+
+func (f *ignoreFileFilter) doesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *ignoreFileFilter) doesPass(object storedObject) bool {
+	return !f.matcher.isIgnored(object.relativePath)
+}
@@ -7,23 +7,39 @@ import (
 	"github.com/Azure/azure-pipeline-go/pipeline"
 
 	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
 )
 
 func initPipeline(ctx context.Context, location common.Location, credential common.CredentialInfo) (p pipeline.Pipeline, err error) {
+	return initPipelineWithRetries(ctx, location, credential, frontEndRetryOptions())
+}
+
+// initListingPipeline returns the pipeline to list the given location with, which retries as AZCOPY_LIST_* say
+func initListingPipeline(ctx context.Context, location common.Location, credential common.CredentialInfo) (p pipeline.Pipeline, err error) {
+	retryOptions, err := getListingRetryOptions()
+	if err != nil {
+		return nil, err
+	}
+	return initPipelineWithRetries(ctx, location, credential, retryOptions)
+}
+
+func initPipelineWithRetries(ctx context.Context, location common.Location, credential common.CredentialInfo, retryOptions ste.XferRetryOptions) (p pipeline.Pipeline, err error) {
 	switch location {
 	case common.ELocation.Local(),
 		common.ELocation.Benchmark():
 		// Gracefully return
 		return nil, nil
 	case common.ELocation.Blob():
-		p, err = createBlobPipeline(ctx, credential)
+		p, err = createBlobPipelineWithRetries(ctx, credential, retryOptions)
 	case common.ELocation.File():
-		p, err = createFilePipeline(ctx, credential)
+		p, err = createFilePipelineWithRetries(ctx, credential, retryOptions)
 	case common.ELocation.BlobFS():
-		p, err = createBlobFSPipeline(ctx, credential)
-	case common.ELocation.S3():
-		// Gracefully return because pipelines aren't used for S3
+		p, err = createBlobFSPipelineWithRetries(ctx, credential, retryOptions)
+	case common.ELocation.S3(), common.ELocation.Sftp():
+		// Gracefully return because pipelines aren't used for S3 or SFTP
 		return nil, nil
+	case common.ELocation.Http():
+		p, err = createHTTPSourcePipeline(retryOptions)
 	default:
 		err = fmt.Errorf("can't produce new pipeline for location %s", location)
 	}
@@ -42,6 +42,11 @@ type copyTransferProcessor struct {
 	// handles for progress tracking
 	reportFirstPartDispatched func(jobStarted bool)
 	reportFinalPartDispatched func()
+
+	// if set, the parts that fill up during the scan are held in heldParts, and only dispatched along with the final part,
+	// so that the whole job is known before any of it is transferred
+	enumerateFirst bool
+	heldParts      []common.CopyJobPartOrderRequest
 }
 
 func newCopyTransferProcessor(copyJobTemplate *common.CopyJobPartOrderRequest, numOfTransfersPerPart int,
@@ -61,11 +66,15 @@ func newCopyTransferProcessor(copyJobTemplate *common.CopyJobPartOrderRequest, n
 
 func (s *copyTransferProcessor) scheduleCopyTransfer(storedObject storedObject) (err error) {
 	if len(s.copyJobTemplate.Transfers) == s.numOfTransfersPerPart {
-		resp := s.sendPartToSte()
-
-		// TODO: If we ever do launch errors outside of the final "no transfers" error, make them output nicer things here.
-		if resp.ErrorMsg != "" {
-			return errors.New(string(resp.ErrorMsg))
+		if s.enumerateFirst {
+			s.heldParts = append(s.heldParts, *s.copyJobTemplate)
+		} else {
+			resp := s.sendPartToSte(s.copyJobTemplate)
+
+			// TODO: If we ever do launch errors outside of the final "no transfers" error, make them output nicer things here.
+			if resp.ErrorMsg != "" {
+				return errors.New(string(resp.ErrorMsg))
+			}
 		}
 
 		// reset the transfers buffer
@@ -83,6 +92,7 @@ func (s *copyTransferProcessor) scheduleCopyTransfer(storedObject storedObject)
 		ContentMD5:       storedObject.md5,
 		BlobType:         storedObject.blobType,
 		ContentEncoding:  storedObject.contentEncoding,
+		ETag:             string(storedObject.eTag),
 	})
 	return nil
 }
@@ -98,9 +108,18 @@ func (s *copyTransferProcessor) escapeIfNecessary(path string, shouldEscape bool
 var NothingScheduledError = errors.New("no transfers were scheduled because no files matched the specified criteria")
 
 func (s *copyTransferProcessor) dispatchFinalPart() (copyJobInitiated bool, err error) {
+	for i := range s.heldParts {
+		s.heldParts[i].ScanComplete = true
+		if resp := s.sendPartToSte(&s.heldParts[i]); resp.ErrorMsg != "" {
+			return false, errors.New(string(resp.ErrorMsg))
+		}
+		s.heldParts[i].Transfers = nil // they're in the plan files now
+	}
+	s.heldParts = nil
+
 	var resp common.CopyJobPartOrderResponse
 	s.copyJobTemplate.IsFinalPart = true
-	resp = s.sendPartToSte()
+	resp = s.sendPartToSte(s.copyJobTemplate)
 
 	if !resp.JobStarted {
 		if resp.ErrorMsg == common.ECopyJobPartOrderErrorType.NoTransfersScheduledErr() {
@@ -118,12 +137,12 @@ func (s *copyTransferProcessor) dispatchFinalPart() (copyJobInitiated bool, err
 }
 
 // only test the response on the final dispatch to help diagnose root cause of test failures from 0 transfers
-func (s *copyTransferProcessor) sendPartToSte() common.CopyJobPartOrderResponse {
+func (s *copyTransferProcessor) sendPartToSte(order *common.CopyJobPartOrderRequest) common.CopyJobPartOrderResponse {
 	var resp common.CopyJobPartOrderResponse
-	Rpc(common.ERpcCmd.CopyJobPartOrder(), s.copyJobTemplate, &resp)
+	Rpc(common.ERpcCmd.CopyJobPartOrder(), order, &resp)
 
 	// if the current part order sent to ste is 0, then alert the progress reporting routine
-	if s.copyJobTemplate.PartNum == 0 && s.reportFirstPartDispatched != nil {
+	if order.PartNum == 0 && s.reportFirstPartDispatched != nil {
 		s.reportFirstPartDispatched(resp.JobStarted)
 	}
 
@@ -0,0 +1,106 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// after this many prefixes fail in a row, the listing service is assumed to be down rather than one prefix being flaky,
+// so enumeration stops instead of quarantining everything that is left
+const maxConsecutiveQuarantinedPrefixes = 10
+
+type quarantinedPrefix struct {
+	prefix string
+	err    error
+}
+
+// prefixQuarantine lets enumeration carry on past prefixes (directories, or virtual directories) that cannot be listed,
+// even after the retries of the listing pipeline. The prefixes are set aside, and reported at the end of the scan,
+// so that the job transfers everything else, and the user can retry just the failed prefixes later.
+type prefixQuarantine struct {
+	lock                sync.Mutex
+	prefixes            []quarantinedPrefix
+	consecutiveFailures int
+}
+
+type prefixQuarantineKey struct{}
+
+func newPrefixQuarantine() *prefixQuarantine {
+	return &prefixQuarantine{}
+}
+
+// withPrefixQuarantine returns a context that tells the traversers to quarantine failed prefixes
+func withPrefixQuarantine(ctx context.Context, q *prefixQuarantine) context.Context {
+	return context.WithValue(ctx, prefixQuarantineKey{}, q)
+}
+
+// isQuarantiningPrefixes says whether failed prefixes are quarantined, rather than failing the enumeration
+func isQuarantiningPrefixes(ctx context.Context) bool {
+	q, ok := ctx.Value(prefixQuarantineKey{}).(*prefixQuarantine)
+	return ok && q != nil
+}
+
+// handleListingFailure is called by traversers when listing the given prefix has failed.
+// It returns nil if the traverser should skip the prefix and carry on, or the error to stop enumeration with.
+func handleListingFailure(ctx context.Context, prefix string, err error) error {
+	q, ok := ctx.Value(prefixQuarantineKey{}).(*prefixQuarantine)
+	if !ok || q == nil {
+		return err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prefixes = append(q.prefixes, quarantinedPrefix{prefix: prefix, err: err})
+	q.consecutiveFailures++
+	if q.consecutiveFailures >= maxConsecutiveQuarantinedPrefixes {
+		return fmt.Errorf("stopped scanning after %d prefixes in a row failed to be listed; the last one failed with: %s", q.consecutiveFailures, err)
+	}
+	return nil
+}
+
+// recordListingSuccess is called by traversers when a listing request has succeeded, to reset the circuit breaker
+func recordListingSuccess(ctx context.Context) {
+	if q, ok := ctx.Value(prefixQuarantineKey{}).(*prefixQuarantine); ok && q != nil {
+		q.lock.Lock()
+		q.consecutiveFailures = 0
+		q.lock.Unlock()
+	}
+}
+
+// report describes the quarantined prefixes, or returns an empty string if there are none
+func (q *prefixQuarantine) report() string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.prefixes) == 0 {
+		return ""
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%d prefix(es) could not be fully listed, so some or all of the files under them were not transferred:\n", len(q.prefixes)))
+	for _, p := range q.prefixes {
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", p.prefix, p.err))
+	}
+	return sb.String()
+}
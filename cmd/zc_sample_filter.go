@@ -0,0 +1,104 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Design explanation:
+/*
+The sample is chosen by hashing the seed with the path of each object, so that the same seed picks the same objects
+every time, without having to remember anything between runs. The paths of the objects are kept, so the sample has
+the same directory structure as the source. A cap on the bytes of the sample can't be deterministic in the same way,
+since it depends on which objects were seen first; with concurrent scanning, the order of the scan can vary.
+*/
+type sampleFilter struct {
+	fraction float64 // of the objects to pass, between 0 and 1
+	seed     string
+
+	maxBytes    int64 // 0 means no cap
+	bytesLock   sync.Mutex
+	bytesPassed int64
+}
+
+func (f *sampleFilter) doesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *sampleFilter) doesPass(object storedObject) bool {
+	if f.fraction < 1 && sampleScore(f.seed, object.containerName, object.relativePath) >= f.fraction {
+		return false
+	}
+
+	if f.maxBytes == 0 {
+		return true
+	}
+
+	// objects that would take the sample over the cap are skipped, but smaller ones that still fit can be taken later
+	f.bytesLock.Lock()
+	defer f.bytesLock.Unlock()
+	if f.bytesPassed+object.size > f.maxBytes {
+		return false
+	}
+	f.bytesPassed += object.size
+	return true
+}
+
+// sampleScore maps an object to a number in [0, 1), which is evenly distributed over the objects of the source,
+// and which is always the same for the same seed and object
+func sampleScore(seed string, containerName string, relativePath string) float64 {
+	hash := sha256.Sum256([]byte(seed + "\x00" + containerName + "\x00" + relativePath))
+	return float64(binary.BigEndian.Uint64(hash[:8])>>11) / (1 << 53)
+}
+
+// parseSamplePercentage parses the sample flag, e.g. 1% or 0.5%, into the fraction of objects to copy
+func parseSamplePercentage(raw string) (float64, error) {
+	message := fmt.Sprintf("invalid sample %q. It must be a percentage greater than 0 and at most 100, e.g. 1%% or 0.5%%", raw)
+
+	if !strings.HasSuffix(raw, "%") {
+		return 0, errors.New(message)
+	}
+	percentage, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(raw, "%")), 64)
+	if err != nil || math.IsNaN(percentage) || percentage <= 0 || percentage > 100 {
+		return 0, errors.New(message)
+	}
+	return percentage / 100, nil
+}
+
+// buildSampleFilters returns the filter for sample and sample-max-bytes, if either is specified.
+// It must come after all the other filters, so that only the objects that would otherwise be copied count towards the cap
+func buildSampleFilters(fraction float64, seed string, maxBytes int64) []objectFilter {
+	if fraction == 0 && maxBytes == 0 {
+		return []objectFilter{}
+	}
+	if fraction == 0 {
+		fraction = 1
+	}
+	return []objectFilter{&sampleFilter{fraction: fraction, seed: seed, maxBytes: maxBytes}}
+}
@@ -22,23 +22,23 @@ package cmd
 
 import (
 	"fmt"
+	"math/rand"
+
 	"github.com/Azure/azure-storage-azcopy/common"
 )
 
 type benchmarkTraverser struct {
-	fileCount                   uint
-	bytesPerFile                int64
+	spec                        syntheticDataSpec
 	incrementEnumerationCounter func()
 }
 
 func newBenchmarkTraverser(source string, incrementEnumerationCounter func()) (*benchmarkTraverser, error) {
-	fc, bpf, err := benchmarkSourceHelper{}.FromUrl(source)
+	spec, err := benchmarkSourceHelper{}.FromUrl(source)
 	if err != nil {
 		return nil, err
 	}
 	return &benchmarkTraverser{
-			fileCount:                   fc,
-			bytesPerFile:                bpf,
+			spec:                        spec,
 			incrementEnumerationCounter: incrementEnumerationCounter},
 		nil
 }
@@ -52,10 +52,32 @@ func (t *benchmarkTraverser) traverse(preprocessor objectMorpher, processor obje
 		panic("filters not expected or supported in benchmark traverser") // but we still call processIfPassedFilters below, for consistency with other traversers
 	}
 
-	for i := uint(1); i <= t.fileCount; i++ {
+	// the sizes are chosen the same way every time, so that generating the same data twice gives the same files
+	sizes := rand.New(rand.NewSource(1))
+	totalWeight := uint(0)
+	for _, s := range t.spec.sizeDistribution {
+		totalWeight += s.weight
+	}
+
+	for i := uint(1); i <= t.spec.fileCount; i++ {
 
 		name := fmt.Sprintf("%d", i)
 		relativePath := name
+		if t.spec.filesPerDirectory > 0 {
+			relativePath = fmt.Sprintf("%d%s%s", (i-1)/t.spec.filesPerDirectory+1, common.AZCOPY_PATH_SEPARATOR_STRING, name)
+		}
+
+		size := t.spec.bytesPerFile
+		if totalWeight > 0 {
+			choice := uint(sizes.Int63n(int64(totalWeight)))
+			for _, s := range t.spec.sizeDistribution {
+				if choice < s.weight {
+					size = s.bytes
+					break
+				}
+				choice -= s.weight
+			}
+		}
 
 		if t.incrementEnumerationCounter != nil {
 			t.incrementEnumerationCounter()
@@ -66,7 +88,7 @@ func (t *benchmarkTraverser) traverse(preprocessor objectMorpher, processor obje
 			name,
 			relativePath,
 			common.BenchmarkLmt,
-			t.bytesPerFile,
+			size,
 			nil,
 			blobTypeNA,
 			""), processor)
@@ -31,6 +31,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
 )
 
 // allow us to iterate through a path pointing to the blob endpoint
@@ -40,6 +41,12 @@ type blobTraverser struct {
 	ctx       context.Context
 	recursive bool
 
+	// whether to pin each blob to its current version, so that later changes to the blob are not transferred
+	pinVersions bool
+
+	// when non-zero, virtual directories are only listed if their blobs are no more than this many levels below the root
+	maxDepth int
+
 	// a generic function to notify that a new stored object has been enumerated
 	incrementEnumerationCounter func()
 }
@@ -67,7 +74,12 @@ func (t *blobTraverser) isDirectory(isSource bool) bool {
 
 func (t *blobTraverser) getPropertiesIfSingleBlob() (*azblob.BlobGetPropertiesResponse, bool, error) {
 	blobURL := azblob.NewBlobURL(*t.rawURL, t.p)
-	blobProps, blobPropertiesErr := blobURL.GetProperties(t.ctx, azblob.BlobAccessConditions{})
+	ctx := t.ctx
+	if t.pinVersions {
+		// so that the response includes the version ID of the blob
+		ctx = ste.WithBlobVersioningServiceVersion(ctx)
+	}
+	blobProps, blobPropertiesErr := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
 
 	// if there was no problem getting the properties, it means that we are looking at a single blob
 	if blobPropertiesErr == nil && !gCopyUtil.doesBlobRepresentAFolder(blobProps.NewMetadata()) {
@@ -79,7 +91,6 @@ func (t *blobTraverser) getPropertiesIfSingleBlob() (*azblob.BlobGetPropertiesRe
 
 func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) (err error) {
 	blobUrlParts := azblob.NewBlobURLParts(*t.rawURL)
-	util := copyHandlerUtil{}
 
 	// check if the url points to a single blob
 	blobProperties, isBlob, propErr := t.getPropertiesIfSingleBlob()
@@ -119,6 +130,13 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 		// .NewMetadata() seems odd to call, but it does actually retrieve the metadata from the blob properties.
 		storedObject.Metadata = common.FromAzBlobMetadataToCommonMetadata(blobProperties.NewMetadata())
 		storedObject.blobAccessTier = azblob.AccessTierType(blobProperties.AccessTier())
+		storedObject.eTag = blobProperties.ETag()
+
+		if t.pinVersions {
+			if storedObject.versionID = ste.GetBlobVersionID(blobProperties.Response()); storedObject.versionID == "" {
+				return errBlobVersioningNotEnabled
+			}
+		}
 
 		if t.incrementEnumerationCounter != nil {
 			t.incrementEnumerationCounter()
@@ -142,22 +160,30 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 		searchPrefix += common.AZCOPY_PATH_SEPARATOR_STRING
 	}
 
+	// a flat listing can't leave out the blobs that are too deep, so max-depth always lists one virtual directory at a time
+	if t.recursive && (azcopyEnumerationParallelism > 1 || t.maxDepth > 0) {
+		return t.parallelList(containerURL, blobUrlParts.ContainerName, searchPrefix, "", preprocessor, processor, filters)
+	}
+
+	lastListed := ""
 	for marker := (azblob.Marker{}); marker.NotDone(); {
 		// look for all blobs that start with the prefix
 		// TODO optimize for the case where recursive is off
 		listBlob, err := containerURL.ListBlobsFlatSegment(t.ctx, marker,
 			azblob.ListBlobsSegmentOptions{Prefix: searchPrefix, Details: azblob.BlobListingDetails{Metadata: true}})
 		if err != nil {
-			return fmt.Errorf("cannot list blobs. Failed with error %s", err.Error())
+			// the rest of the prefix can't be listed without the marker. Rather than quarantine all of it, carry on one virtual directory
+			// at a time from where the flat listing stopped, so that only the virtual directory that can't be listed is quarantined
+			if t.recursive && isQuarantiningPrefixes(t.ctx) {
+				return t.parallelList(containerURL, blobUrlParts.ContainerName, searchPrefix, lastListed, preprocessor, processor, filters)
+			}
+			return handleListingFailure(t.ctx, blobUrlParts.ContainerName+common.AZCOPY_PATH_SEPARATOR_STRING+searchPrefix,
+				fmt.Errorf("cannot list blobs. Failed with error %s", err.Error()))
 		}
+		recordListingSuccess(t.ctx)
 
 		// process the blobs returned in this result segment
 		for _, blobInfo := range listBlob.Segment.BlobItems {
-			// if the blob represents a hdi folder, then skip it
-			if util.doesBlobRepresentAFolder(blobInfo.Metadata) {
-				continue
-			}
-
 			relativePath := strings.TrimPrefix(blobInfo.Name, searchPrefix)
 
 			// if recursive
@@ -165,35 +191,11 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 				continue
 			}
 
-			storedObject := newStoredObject(
-				preprocessor,
-				getObjectNameOnly(blobInfo.Name),
-				relativePath,
-				blobInfo.Properties.LastModified,
-				*blobInfo.Properties.ContentLength,
-				blobInfo.Properties.ContentMD5,
-				blobInfo.Properties.BlobType,
-				blobUrlParts.ContainerName,
-			)
-
-			storedObject.contentDisposition = common.IffStringNotNil(blobInfo.Properties.ContentDisposition, "")
-			storedObject.cacheControl = common.IffStringNotNil(blobInfo.Properties.CacheControl, "")
-			storedObject.contentLanguage = common.IffStringNotNil(blobInfo.Properties.ContentLanguage, "")
-			storedObject.contentEncoding = common.IffStringNotNil(blobInfo.Properties.ContentEncoding, "")
-			storedObject.contentType = common.IffStringNotNil(blobInfo.Properties.ContentType, "")
-
-			storedObject.Metadata = common.FromAzBlobMetadataToCommonMetadata(blobInfo.Metadata)
-
-			storedObject.blobAccessTier = blobInfo.Properties.AccessTier
-
-			if t.incrementEnumerationCounter != nil {
-				t.incrementEnumerationCounter()
-			}
-
-			processErr := processIfPassedFilters(filters, storedObject, processor)
+			processErr := t.processBlobItem(containerURL, blobUrlParts.ContainerName, blobInfo, relativePath, preprocessor, processor, filters)
 			if processErr != nil {
 				return processErr
 			}
+			lastListed = blobInfo.Name
 		}
 
 		marker = listBlob.NextMarker
@@ -202,6 +204,146 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 	return
 }
 
+// parallelList lists the blobs below searchPrefix one virtual directory at a time, with several virtual directories
+// being listed at once, which is much faster than a flat listing for containers that hold many blobs in many
+// virtual directories. The blobs are still processed one at a time, on this goroutine.
+// Virtual directories that are too deep for maxDepth are never listed.
+// Blobs named up to listedUpTo have already been processed by a flat listing that failed part way, so they are left out,
+// and so are the virtual directories that only hold such blobs
+func (t *blobTraverser) parallelList(containerURL azblob.ContainerURL, containerName string, searchPrefix string, listedUpTo string,
+	preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+
+	// stop the listing if we return early
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	enumerateOneDir := func(dir interface{}, enqueueDir func(interface{}), enqueueOutput func(interface{}, error) error) error {
+		currentDirPath := dir.(string)
+		for marker := (azblob.Marker{}); marker.NotDone(); {
+			listBlob, err := containerURL.ListBlobsHierarchySegment(ctx, marker, common.AZCOPY_PATH_SEPARATOR_STRING,
+				azblob.ListBlobsSegmentOptions{Prefix: currentDirPath, Details: azblob.BlobListingDetails{Metadata: true}})
+			if err != nil {
+				// the rest of this virtual directory can't be listed without the marker, so it is either quarantined or fails the enumeration
+				return handleListingFailure(ctx, containerName+common.AZCOPY_PATH_SEPARATOR_STRING+currentDirPath,
+					fmt.Errorf("cannot list blobs. Failed with error %s", err.Error()))
+			}
+			recordListingSuccess(ctx)
+
+			for _, virtualDir := range listBlob.Segment.BlobPrefixes {
+				if t.maxDepth > 0 && relativePathDepth(strings.TrimPrefix(virtualDir.Name, searchPrefix)) >= t.maxDepth {
+					continue
+				}
+				if isVirtualDirListedUpTo(virtualDir.Name, listedUpTo) {
+					continue
+				}
+				enqueueDir(virtualDir.Name)
+			}
+
+			for _, blobInfo := range listBlob.Segment.BlobItems {
+				if blobInfo.Name <= listedUpTo {
+					continue
+				}
+				if err = enqueueOutput(blobInfo, nil); err != nil {
+					return err
+				}
+			}
+
+			marker = listBlob.NextMarker
+		}
+		return nil
+	}
+
+	for result := range common.Crawl(ctx, searchPrefix, enumerateOneDir, azcopyEnumerationParallelism) {
+		if result.Err != nil {
+			return result.Err
+		}
+
+		blobInfo := result.Item.(azblob.BlobItem)
+		processErr := t.processBlobItem(containerURL, containerName, blobInfo, strings.TrimPrefix(blobInfo.Name, searchPrefix), preprocessor, processor, filters)
+		if processErr != nil {
+			return processErr
+		}
+	}
+
+	// if our context was cancelled, the listing stopped before it was complete
+	return ctx.Err()
+}
+
+// isVirtualDirListedUpTo says whether all the blobs in the virtual directory are named up to listedUpTo.
+// Blobs are listed in name order, so that is the case when the directory comes first, and listedUpTo isn't in it
+func isVirtualDirListedUpTo(virtualDir string, listedUpTo string) bool {
+	return virtualDir < listedUpTo && !strings.HasPrefix(listedUpTo, virtualDir)
+}
+
+// processBlobItem sends one listed blob to the processor, if it passes the filters
+func (t *blobTraverser) processBlobItem(containerURL azblob.ContainerURL, containerName string, blobInfo azblob.BlobItem, relativePath string,
+	preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+
+	// if the blob represents a hdi folder, then skip it
+	if gCopyUtil.doesBlobRepresentAFolder(blobInfo.Metadata) {
+		return nil
+	}
+
+	storedObject := newStoredObject(
+		preprocessor,
+		getObjectNameOnly(blobInfo.Name),
+		relativePath,
+		blobInfo.Properties.LastModified,
+		*blobInfo.Properties.ContentLength,
+		blobInfo.Properties.ContentMD5,
+		blobInfo.Properties.BlobType,
+		containerName,
+	)
+
+	storedObject.contentDisposition = common.IffStringNotNil(blobInfo.Properties.ContentDisposition, "")
+	storedObject.cacheControl = common.IffStringNotNil(blobInfo.Properties.CacheControl, "")
+	storedObject.contentLanguage = common.IffStringNotNil(blobInfo.Properties.ContentLanguage, "")
+	storedObject.contentEncoding = common.IffStringNotNil(blobInfo.Properties.ContentEncoding, "")
+	storedObject.contentType = common.IffStringNotNil(blobInfo.Properties.ContentType, "")
+
+	storedObject.Metadata = common.FromAzBlobMetadataToCommonMetadata(blobInfo.Metadata)
+
+	storedObject.blobAccessTier = blobInfo.Properties.AccessTier
+	storedObject.eTag = blobInfo.Properties.Etag
+
+	if t.pinVersions {
+		if err := t.pinToCurrentVersion(containerURL.NewBlobURL(blobInfo.Name), &storedObject); err != nil {
+			return err
+		}
+	}
+
+	if t.incrementEnumerationCounter != nil {
+		t.incrementEnumerationCounter()
+	}
+
+	return processIfPassedFilters(filters, storedObject, processor)
+}
+
+var errBlobVersioningNotEnabled = errors.New("cannot pin the source to its current versions, because blob versioning is not enabled on the source account")
+
+// pinToCurrentVersion records the version ID of the blob, so that it is that version which gets transferred.
+// The blob may have changed since it was listed, so the properties that describe the content are refreshed too.
+func (t *blobTraverser) pinToCurrentVersion(blobURL azblob.BlobURL, storedObject *storedObject) error {
+	blobProperties, err := blobURL.GetProperties(ste.WithBlobVersioningServiceVersion(t.ctx), azblob.BlobAccessConditions{})
+	if err != nil {
+		return fmt.Errorf("cannot get the current version of blob %s. Failed with error %s", storedObject.relativePath, err.Error())
+	}
+
+	storedObject.versionID = ste.GetBlobVersionID(blobProperties.Response())
+	if storedObject.versionID == "" {
+		return errBlobVersioningNotEnabled
+	}
+	storedObject.lastModifiedTime = blobProperties.LastModified()
+	storedObject.size = blobProperties.ContentLength()
+	storedObject.md5 = blobProperties.ContentMD5()
+	storedObject.eTag = blobProperties.ETag()
+	return nil
+}
+
+func (t *blobTraverser) setMaxDepth(maxDepth int) {
+	t.maxDepth = maxDepth
+}
+
 func newBlobTraverser(rawURL *url.URL, p pipeline.Pipeline, ctx context.Context, recursive bool, incrementEnumerationCounter func()) (t *blobTraverser) {
 	t = &blobTraverser{rawURL: rawURL, p: p, ctx: ctx, recursive: recursive, incrementEnumerationCounter: incrementEnumerationCounter}
 	return
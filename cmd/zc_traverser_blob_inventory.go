@@ -0,0 +1,430 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// allow us to iterate through the rows of a blob inventory report, instead of listing the container.
+// For very large accounts, reading the (already generated) report is far cheaper and faster than a live listing.
+// Blob names in the report are prefixed by their container name, as in the reports produced by the inventory service.
+// Reports may be CSV or Parquet, the two formats the inventory service writes.
+type blobInventoryTraverser struct {
+	rawURL                      *url.URL
+	p                           pipeline.Pipeline // of the source, to read the properties that the report doesn't have
+	ctx                         context.Context
+	reportLocation              string
+	recursive                   bool
+	incrementEnumerationCounter func()
+}
+
+// the inventory is always enumerated as a collection of blobs, so the source is treated as a directory
+func (t *blobInventoryTraverser) isDirectory(bool) bool {
+	return true
+}
+
+// the columns of the inventory report that we make use of. Only Name is mandatory.
+// When Content-Length is missing, the properties of the blob are read from the service instead.
+const (
+	inventoryColumnName               = "Name"
+	inventoryColumnLastModified       = "Last-Modified"
+	inventoryColumnContentLength      = "Content-Length"
+	inventoryColumnContentMD5         = "Content-MD5"
+	inventoryColumnBlobType           = "BlobType"
+	inventoryColumnAccessTier         = "AccessTier"
+	inventoryColumnContentType        = "Content-Type"
+	inventoryColumnContentEncoding    = "Content-Encoding"
+	inventoryColumnContentLanguage    = "Content-Language"
+	inventoryColumnContentDisposition = "Content-Disposition"
+	inventoryColumnCacheControl       = "Cache-Control"
+	inventoryColumnSnapshot           = "Snapshot"
+	inventoryColumnIsCurrentVersion   = "IsCurrentVersion"
+	inventoryColumnDeleted            = "Deleted"
+)
+
+func (t *blobInventoryTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) (err error) {
+	blobUrlParts := azblob.NewBlobURLParts(*t.rawURL)
+
+	// only blobs under the given virtual directory are considered, just like when listing
+	searchPrefix := blobUrlParts.BlobName
+	if searchPrefix != "" && !strings.HasSuffix(searchPrefix, common.AZCOPY_PATH_SEPARATOR_STRING) {
+		searchPrefix += common.AZCOPY_PATH_SEPARATOR_STRING
+	}
+	containerPrefix := blobUrlParts.ContainerName + common.AZCOPY_PATH_SEPARATOR_STRING
+
+	report, err := t.openInventoryReport()
+	if err != nil {
+		return fmt.Errorf("cannot open the inventory report. Failed with error %s", err.Error())
+	}
+	defer report.Close()
+
+	rows, err := newInventoryRowReader(report)
+	if err != nil {
+		return fmt.Errorf("cannot read the header of the inventory report. Failed with error %s", err.Error())
+	}
+	defer rows.Close()
+	columns := make(map[string]int)
+	for i, name := range rows.header() {
+		columns[strings.TrimPrefix(name, "\xEF\xBB\xBF")] = i
+	}
+	if _, ok := columns[inventoryColumnName]; !ok {
+		return errors.New("the inventory report has no Name column")
+	}
+
+	for {
+		row, err := rows.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot read the inventory report. Failed with error %s", err.Error())
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		// snapshots, previous versions and soft-deleted blobs are not part of the live namespace, so are not transferred
+		if value(inventoryColumnSnapshot) != "" || strings.EqualFold(value(inventoryColumnIsCurrentVersion), "false") ||
+			strings.EqualFold(value(inventoryColumnDeleted), "true") {
+			continue
+		}
+
+		// rows for other containers are skipped, since one report may cover many containers
+		name := value(inventoryColumnName)
+		if !strings.HasPrefix(name, containerPrefix) {
+			continue
+		}
+		blobName := strings.TrimPrefix(name, containerPrefix)
+		if !strings.HasPrefix(blobName, searchPrefix) {
+			continue
+		}
+
+		relativePath := strings.TrimPrefix(blobName, searchPrefix)
+		if relativePath == "" || (!t.recursive && strings.Contains(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING)) {
+			continue
+		}
+
+		md5, _ := base64.StdEncoding.DecodeString(value(inventoryColumnContentMD5))
+		storedObject := newStoredObject(
+			preprocessor,
+			getObjectNameOnly(blobName),
+			relativePath,
+			parseInventoryTime(value(inventoryColumnLastModified)),
+			0,
+			md5,
+			azblob.BlobType(value(inventoryColumnBlobType)),
+			blobUrlParts.ContainerName,
+		)
+
+		storedObject.contentDisposition = value(inventoryColumnContentDisposition)
+		storedObject.cacheControl = value(inventoryColumnCacheControl)
+		storedObject.contentLanguage = value(inventoryColumnContentLanguage)
+		storedObject.contentEncoding = value(inventoryColumnContentEncoding)
+		storedObject.contentType = value(inventoryColumnContentType)
+		storedObject.blobAccessTier = azblob.AccessTierType(value(inventoryColumnAccessTier))
+
+		// reports that were configured without Content-Length don't tell us enough to transfer the blob,
+		// so its properties are read from the service, as the blob traverser would for a single blob
+		if size := value(inventoryColumnContentLength); size != "" {
+			if storedObject.size, err = strconv.ParseInt(size, 10, 64); err != nil {
+				return fmt.Errorf("invalid Content-Length for %s in the inventory report: %s", name, err.Error())
+			}
+		} else if err = t.readBlobProperties(blobUrlParts, blobName, &storedObject); err != nil {
+			return fmt.Errorf("cannot get the properties of %s, which has no Content-Length in the inventory report: %s", name, err.Error())
+		}
+
+		if t.incrementEnumerationCounter != nil {
+			t.incrementEnumerationCounter()
+		}
+
+		processErr := processIfPassedFilters(filters, storedObject, processor)
+		if processErr != nil {
+			return processErr
+		}
+	}
+}
+
+// readBlobProperties fills in what the report left out from the properties of the blob
+func (t *blobInventoryTraverser) readBlobProperties(parts azblob.BlobURLParts, blobName string, object *storedObject) error {
+	if t.p == nil {
+		return errors.New("no pipeline to the source")
+	}
+	parts.BlobName = blobName
+	parts.Snapshot = ""
+	props, err := azblob.NewBlobURL(parts.URL(), t.p).GetProperties(t.ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		return err
+	}
+
+	object.size = props.ContentLength()
+	object.lastModifiedTime = props.LastModified()
+	object.md5 = props.ContentMD5()
+	object.blobType = props.BlobType()
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&object.contentDisposition, props.ContentDisposition())
+	fill(&object.cacheControl, props.CacheControl())
+	fill(&object.contentLanguage, props.ContentLanguage())
+	fill(&object.contentEncoding, props.ContentEncoding())
+	fill(&object.contentType, props.ContentType())
+	if object.blobAccessTier == "" {
+		object.blobAccessTier = azblob.AccessTierType(props.AccessTier())
+	}
+	return nil
+}
+
+// inventoryReport is a report that can be read either from start to end, for CSV, or at any offset, for Parquet
+type inventoryReport interface {
+	io.ReaderAt
+	io.Closer
+	size() int64
+	stream() (io.ReadCloser, error)
+}
+
+// the report may be a local file, or a blob given by its URL (including a SAS if necessary)
+func (t *blobInventoryTraverser) openInventoryReport() (inventoryReport, error) {
+	if strings.HasPrefix(t.reportLocation, "https://") || strings.HasPrefix(t.reportLocation, "http://") {
+		u, err := url.Parse(t.reportLocation)
+		if err != nil {
+			return nil, err
+		}
+		ctx := t.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		p, err := createBlobPipeline(ctx, common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()})
+		if err != nil {
+			return nil, err
+		}
+
+		// the version that we read is pinned, so that all the ranges of a Parquet report come from the same one
+		blobURL := azblob.NewBlobURL(*u, p)
+		props, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+		if err != nil {
+			return nil, err
+		}
+		return &remoteInventoryReport{
+			ctx:     ctx,
+			blobURL: blobURL,
+			ac:      azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: props.ETag()}},
+			length:  props.ContentLength(),
+		}, nil
+	}
+
+	f, err := os.Open(t.reportLocation)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &localInventoryReport{File: f, length: info.Size()}, nil
+}
+
+type localInventoryReport struct {
+	*os.File
+	length int64
+}
+
+func (r *localInventoryReport) size() int64 {
+	return r.length
+}
+
+func (r *localInventoryReport) stream() (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.NewSectionReader(r.File, 0, r.length)), nil
+}
+
+// remoteInventoryReport reads the report through the azcopy pipeline, so reads time out and are retried
+type remoteInventoryReport struct {
+	ctx     context.Context
+	blobURL azblob.BlobURL
+	ac      azblob.BlobAccessConditions
+	length  int64
+}
+
+func (r *remoteInventoryReport) size() int64 {
+	return r.length
+}
+
+func (r *remoteInventoryReport) stream() (io.ReadCloser, error) {
+	get, err := r.blobURL.Download(r.ctx, 0, azblob.CountToEnd, r.ac, false)
+	if err != nil {
+		return nil, err
+	}
+	return get.Body(azblob.RetryReaderOptions{MaxRetryRequests: ste.MaxRetryPerDownloadBody}), nil
+}
+
+func (r *remoteInventoryReport) ReadAt(b []byte, offset int64) (int, error) {
+	if offset >= r.length {
+		return 0, io.EOF
+	}
+	count := int64(len(b))
+	if offset+count > r.length {
+		count = r.length - offset
+	}
+	data, err := blobRangeReader(r.blobURL, r.ac)(r.ctx, offset, count)
+	n := copy(b, data)
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *remoteInventoryReport) Close() error {
+	return nil
+}
+
+// inventoryRowReader reads the rows of a report as text, whatever its format
+type inventoryRowReader interface {
+	header() []string
+	read() ([]string, error)
+	io.Closer
+}
+
+// newInventoryRowReader tells the format of the report from its content, since reports aren't always named for it
+func newInventoryRowReader(report inventoryReport) (inventoryRowReader, error) {
+	magic := make([]byte, 4)
+	if n, _ := report.ReadAt(magic, 0); n == len(magic) && string(magic) == "PAR1" {
+		r, err := common.NewParquetReader(report, report.size())
+		if err != nil {
+			return nil, err
+		}
+		return &parquetInventoryRows{r: r, row: make([]string, len(r.Columns()))}, nil
+	}
+
+	body, err := report.stream()
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(body)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &csvInventoryRows{r: r, body: body, columns: append([]string(nil), header...)}, nil
+}
+
+type csvInventoryRows struct {
+	r       *csv.Reader
+	body    io.Closer
+	columns []string
+}
+
+func (c *csvInventoryRows) header() []string {
+	return c.columns
+}
+
+func (c *csvInventoryRows) read() ([]string, error) {
+	return c.r.Read()
+}
+
+func (c *csvInventoryRows) Close() error {
+	return c.body.Close()
+}
+
+type parquetInventoryRows struct {
+	r   *common.ParquetReader
+	row []string
+}
+
+func (p *parquetInventoryRows) header() []string {
+	return p.r.Columns()
+}
+
+// read renders each value as it would appear in a CSV report
+func (p *parquetInventoryRows) read() ([]string, error) {
+	values, err := p.r.Next()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			p.row[i] = ""
+		case string:
+			p.row[i] = v
+		case []byte:
+			p.row[i] = base64.StdEncoding.EncodeToString(v)
+		case bool:
+			p.row[i] = strconv.FormatBool(v)
+		case int64:
+			p.row[i] = strconv.FormatInt(v, 10)
+		case float64:
+			p.row[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case time.Time:
+			p.row[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			p.row[i] = fmt.Sprint(v)
+		}
+	}
+	return p.row, nil
+}
+
+func (p *parquetInventoryRows) Close() error {
+	return nil
+}
+
+func parseInventoryTime(s string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, time.RFC1123} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func newBlobInventoryTraverser(rawURL *url.URL, p pipeline.Pipeline, ctx context.Context, reportLocation string, recursive bool, incrementEnumerationCounter func()) (t *blobInventoryTraverser) {
+	return &blobInventoryTraverser{
+		rawURL:                      rawURL,
+		p:                           p,
+		ctx:                         ctx,
+		reportLocation:              reportLocation,
+		recursive:                   recursive,
+		incrementEnumerationCounter: incrementEnumerationCounter,
+	}
+}
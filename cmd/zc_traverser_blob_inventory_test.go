@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type blobInventoryTraverserTestSuite struct{}
+
+var _ = chk.Suite(&blobInventoryTraverserTestSuite{})
+
+const testInventoryReport = `Name,Creation-Time,Last-Modified,Content-Length,Content-MD5,BlobType,AccessTier,Snapshot,Content-Type
+mycontainer/top.txt,2020-01-01T00:00:00.0000000Z,2020-01-02T00:00:00.0000000Z,10,AQID,BlockBlob,Hot,,text/plain
+mycontainer/dir/a.txt,2020-01-01T00:00:00.0000000Z,2020-01-02T00:00:00.0000000Z,20,,BlockBlob,Cool,,
+mycontainer/dir/sub/b.vhd,2020-01-01T00:00:00.0000000Z,2020-01-02T00:00:00.0000000Z,512,,PageBlob,,,
+mycontainer/dir/a.txt,2020-01-01T00:00:00.0000000Z,2020-01-02T00:00:00.0000000Z,20,,BlockBlob,Cool,2020-01-03T00:00:00.0000000Z,
+othercontainer/dir/c.txt,2020-01-01T00:00:00.0000000Z,2020-01-02T00:00:00.0000000Z,30,,BlockBlob,Hot,,
+`
+
+func (s *blobInventoryTraverserTestSuite) enumerate(c *chk.C, source string, recursive bool) map[string]storedObject {
+	dir, err := ioutil.TempDir("", "inventory")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	reportPath := filepath.Join(dir, "report.csv")
+	c.Assert(ioutil.WriteFile(reportPath, []byte(testInventoryReport), 0644), chk.IsNil)
+
+	srcURL, err := url.Parse(source)
+	c.Assert(err, chk.IsNil)
+
+	found := make(map[string]storedObject)
+	traverser := newBlobInventoryTraverser(srcURL, nil, context.Background(), reportPath, recursive, nil)
+	err = traverser.traverse(noPreProccessor, func(object storedObject) error {
+		found[object.relativePath] = object
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	return found
+}
+
+func (s *blobInventoryTraverserTestSuite) TestInventoryTraverserWholeContainer(c *chk.C) {
+	found := s.enumerate(c, "https://acct.blob.core.windows.net/mycontainer?sig=xyz", true)
+
+	c.Assert(found, chk.HasLen, 3)
+	c.Assert(found["top.txt"].size, chk.Equals, int64(10))
+	c.Assert(found["top.txt"].md5, chk.DeepEquals, []byte{1, 2, 3})
+	c.Assert(found["top.txt"].contentType, chk.Equals, "text/plain")
+	c.Assert(found["dir/a.txt"].blobAccessTier, chk.Equals, azblob.AccessTierCool)
+	c.Assert(found["dir/sub/b.vhd"].blobType, chk.Equals, azblob.BlobPageBlob)
+	c.Assert(found["dir/sub/b.vhd"].name, chk.Equals, "b.vhd")
+	c.Assert(found["dir/sub/b.vhd"].lastModifiedTime.IsZero(), chk.Equals, false)
+}
+
+func (s *blobInventoryTraverserTestSuite) TestInventoryTraverserVirtualDirectory(c *chk.C) {
+	found := s.enumerate(c, "https://acct.blob.core.windows.net/mycontainer/dir", true)
+	c.Assert(found, chk.HasLen, 2)
+	_, ok := found["sub/b.vhd"]
+	c.Assert(ok, chk.Equals, true)
+
+	found = s.enumerate(c, "https://acct.blob.core.windows.net/mycontainer/dir/", false)
+	c.Assert(found, chk.HasLen, 1)
+	_, ok = found["a.txt"]
+	c.Assert(ok, chk.Equals, true)
+}
+
+func (s *blobInventoryTraverserTestSuite) TestInventoryTraverserParquet(c *chk.C) {
+	dir, err := ioutil.TempDir("", "inventory")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	// named without an extension, since the format is told from the content
+	reportPath := filepath.Join(dir, "report")
+	f, err := os.Create(reportPath)
+	c.Assert(err, chk.IsNil)
+	w, err := common.NewParquetWriter(f, []common.ParquetColumn{
+		{Name: "Name", Type: common.EParquetColumnType.String()},
+		{Name: "Content-Length", Type: common.EParquetColumnType.Int64()},
+		{Name: "Last-Modified", Type: common.EParquetColumnType.Timestamp()},
+		{Name: "Snapshot", Type: common.EParquetColumnType.String()},
+	})
+	c.Assert(err, chk.IsNil)
+	modified := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	c.Assert(w.WriteRow("mycontainer/dir/a.txt", int64(20), modified, ""), chk.IsNil)
+	c.Assert(w.WriteRow("mycontainer/dir/a.txt", int64(10), modified, "2020-01-01T00:00:00.0000000Z"), chk.IsNil)
+	c.Assert(w.WriteRow("othercontainer/b.txt", int64(30), modified, ""), chk.IsNil)
+	c.Assert(w.Close(), chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil)
+
+	srcURL, _ := url.Parse("https://acct.blob.core.windows.net/mycontainer")
+	found := make(map[string]storedObject)
+	traverser := newBlobInventoryTraverser(srcURL, nil, context.Background(), reportPath, true, nil)
+	c.Assert(traverser.traverse(noPreProccessor, func(object storedObject) error {
+		found[object.relativePath] = object
+		return nil
+	}, nil), chk.IsNil)
+
+	c.Assert(found, chk.HasLen, 1)
+	c.Assert(found["dir/a.txt"].size, chk.Equals, int64(20))
+	c.Assert(found["dir/a.txt"].lastModifiedTime.Equal(modified), chk.Equals, true)
+}
+
+// a report read from a URL, whose rows have no Content-Length, so the properties of each blob are read instead
+func (s *blobInventoryTraverserTestSuite) TestInventoryTraverserRemoteReportWithoutLength(c *chk.C) {
+	report := "Name,Content-Type\nmycontainer/a.txt,\nmycontainer/b.txt,text/csv\n"
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("ETag", `"1"`)
+		w.Header().Set("Last-Modified", "Thu, 02 Jan 2020 00:00:00 GMT")
+		switch r.URL.Path {
+		case "/acct/reports/report.csv":
+			c.Check(r.Method == http.MethodHead || r.Header.Get("If-Match") == `"1"`, chk.Equals, true)
+			w.Header().Set("Content-Length", strconv.Itoa(len(report)))
+			w.WriteHeader(http.StatusOK)
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(report))
+			}
+		case "/acct/mycontainer/a.txt", "/acct/mycontainer/b.txt":
+			c.Check(r.Method, chk.Equals, http.MethodHead)
+			w.Header().Set("Content-Length", "42")
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("x-ms-blob-type", "BlockBlob")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	srcURL, _ := url.Parse(server.URL + "/acct/mycontainer")
+	p, err := createBlobPipeline(context.Background(), common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()})
+	c.Assert(err, chk.IsNil)
+	found := make(map[string]storedObject)
+	traverser := newBlobInventoryTraverser(srcURL, p, context.Background(), server.URL+"/acct/reports/report.csv", true, nil)
+	c.Assert(traverser.traverse(noPreProccessor, func(object storedObject) error {
+		found[object.relativePath] = object
+		return nil
+	}, nil), chk.IsNil)
+
+	c.Assert(found, chk.HasLen, 2)
+	c.Assert(found["a.txt"].size, chk.Equals, int64(42))
+	c.Assert(found["a.txt"].blobType, chk.Equals, azblob.BlobBlockBlob)
+	c.Assert(found["a.txt"].contentType, chk.Equals, "text/plain")
+	c.Assert(found["b.txt"].contentType, chk.Equals, "text/csv") // the report wins where it has a value
+	c.Assert(found["b.txt"].lastModifiedTime.IsZero(), chk.Equals, false)
+	// the properties and the first bytes of the report, to tell its format, then the report, then a blob each
+	c.Assert(atomic.LoadInt32(&requests), chk.Equals, int32(5))
+}
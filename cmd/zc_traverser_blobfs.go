@@ -127,8 +127,11 @@ func (t *blobFSTraverser) traverse(preprocessor objectMorpher, processor objectP
 		dlr, err := dirUrl.ListDirectorySegment(t.ctx, &marker, t.recursive)
 
 		if err != nil {
-			return fmt.Errorf("could not list files. Failed with error %s", err.Error())
+			// the rest of the directory can't be listed without the marker, so it is either quarantined or fails the enumeration
+			return handleListingFailure(t.ctx, bfsURLParts.FileSystemName+common.AZCOPY_PATH_SEPARATOR_STRING+searchPrefix,
+				fmt.Errorf("could not list files. Failed with error %s", err.Error()))
 		}
+		recordListingSuccess(t.ctx)
 
 		for _, v := range dlr.Paths {
 			if v.IsDirectory == nil {
@@ -40,6 +40,9 @@ type fileTraverser struct {
 	recursive     bool
 	getProperties bool
 
+	// when non-zero, directories are only listed if their files are no more than this many levels below the root
+	maxDepth int
+
 	// a generic function to notify that a new stored object has been enumerated
 	incrementEnumerationCounter func()
 }
@@ -106,8 +109,15 @@ func (t *fileTraverser) traverse(preprocessor objectMorpher, processor objectPro
 		for marker := (azfile.Marker{}); marker.NotDone(); {
 			lResp, err := currentDirURL.ListFilesAndDirectoriesSegment(t.ctx, marker, azfile.ListFilesAndDirectoriesOptions{})
 			if err != nil {
-				return fmt.Errorf("cannot list files due to reason %s", err)
+				dirURLParts := azfile.NewFileURLParts(currentDirURL.URL())
+				if err = handleListingFailure(t.ctx, dirURLParts.ShareName+common.AZCOPY_PATH_SEPARATOR_STRING+dirURLParts.DirectoryOrFilePath,
+					fmt.Errorf("cannot list files due to reason %s", err)); err != nil {
+					return err
+				}
+				// quarantined, so move on to the next directory
+				break
 			}
+			recordListingSuccess(t.ctx)
 
 			// Process the files returned in this segment.
 			for _, fileInfo := range lResp.FileItems {
@@ -165,6 +175,12 @@ func (t *fileTraverser) traverse(preprocessor objectMorpher, processor objectPro
 			if t.recursive {
 				for _, dirInfo := range lResp.DirectoryItems {
 					d := currentDirURL.NewDirectoryURL(dirInfo.Name)
+					if t.maxDepth > 0 {
+						dirPath := strings.TrimPrefix(azfile.NewFileURLParts(d.URL()).DirectoryOrFilePath, targetURLParts.DirectoryOrFilePath)
+						if relativePathDepth(dirPath) >= t.maxDepth {
+							continue
+						}
+					}
 					dirStack.Push(d)
 				}
 			}
@@ -175,6 +191,10 @@ func (t *fileTraverser) traverse(preprocessor objectMorpher, processor objectPro
 	return
 }
 
+func (t *fileTraverser) setMaxDepth(maxDepth int) {
+	t.maxDepth = maxDepth
+}
+
 func newFileTraverser(rawURL *url.URL, p pipeline.Pipeline, ctx context.Context, recursive, getProperties bool, incrementEnumerationCounter func()) (t *fileTraverser) {
 	t = &fileTraverser{rawURL: rawURL, p: p, ctx: ctx, recursive: recursive, getProperties: getProperties, incrementEnumerationCounter: incrementEnumerationCounter}
 	return
@@ -0,0 +1,81 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// a traverser for a single file on any HTTP(S) server. Web servers can't be listed, so several files are copied
+// with list-of-files, naming each file relative to the URL given as the source
+type httpTraverser struct {
+	rawURL                      *url.URL
+	p                           pipeline.Pipeline
+	ctx                         context.Context
+	incrementEnumerationCounter func()
+}
+
+func newHTTPTraverser(rawURL *url.URL, p pipeline.Pipeline, ctx context.Context, incrementEnumerationCounter func()) *httpTraverser {
+	return &httpTraverser{rawURL: rawURL, p: p, ctx: ctx, incrementEnumerationCounter: incrementEnumerationCounter}
+}
+
+func (t *httpTraverser) isDirectory(bool) bool {
+	return false
+}
+
+func (t *httpTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+	name := path.Base(t.rawURL.Path)
+	if name == "/" || name == "." {
+		return errors.New("the URL of an HTTP source must name a file, e.g. https://example.com/data/file.csv")
+	}
+
+	props, err := ste.GetHTTPSourceProperties(t.ctx, t.p, *t.rawURL)
+	if err != nil {
+		return err
+	}
+
+	// without a last modified time from the server, changes to the file during the job can only be found by its size
+	lmt := props.LastModified
+	if lmt.IsZero() {
+		lmt = time.Unix(0, 0)
+	}
+
+	if t.incrementEnumerationCounter != nil {
+		t.incrementEnumerationCounter()
+	}
+
+	storedObject := newStoredObject(preprocessor, name, "", lmt, props.Size, props.ContentMD5, blobTypeNA, "")
+	storedObject.contentType = props.ContentType
+	storedObject.contentEncoding = props.ContentEncoding
+	storedObject.contentLanguage = props.ContentLanguage
+	storedObject.contentDisposition = props.Disposition
+	storedObject.cacheControl = props.CacheControl
+
+	return processIfPassedFilters(filters, storedObject, processor)
+}
@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -36,6 +37,9 @@ type localTraverser struct {
 	recursive      bool
 	followSymlinks bool
 
+	// when non-zero, directories are only walked if their files are no more than this many levels below the root
+	maxDepth int
+
 	// a generic function to notify that a new stored object has been enumerated
 	incrementEnumerationCounter func()
 }
@@ -72,6 +76,12 @@ func (t *localTraverser) getInfoIfSingleFile() (os.FileInfo, bool, error) {
 // 1) Cleaner code
 // 2) Easier to test individually than to test the entire traverser.
 func WalkWithSymlinks(fullPath string, walkFunc filepath.WalkFunc) (err error) {
+	return walkWithSymlinks(fullPath, 0, walkFunc)
+}
+
+// walkWithSymlinks is WalkWithSymlinks, except that it doesn't descend into directories whose files would be more
+// than maxDepth levels below fullPath. A maxDepth of 0 means there is no limit
+func walkWithSymlinks(fullPath string, maxDepth int, walkFunc filepath.WalkFunc) (err error) {
 	// We want to re-queue symlinks up in their evaluated form because filepath.Walk doesn't evaluate them for us.
 	// So, what is the plan of attack?
 	// Because we can't create endless channels, we create an array instead and use it as a queue.
@@ -146,6 +156,9 @@ func WalkWithSymlinks(fullPath string, walkFunc filepath.WalkFunc) (err error) {
 					// Add it to seen paths but ignore it otherwise.
 					// This prevents walking it again if we've already seen the directory.
 					seenPaths[result] = true
+					if maxDepth > 0 && relativePathDepth(filepath.ToSlash(computedRelativePath)) >= maxDepth {
+						return filepath.SkipDir
+					}
 					return nil
 				}
 
@@ -226,9 +239,9 @@ func (t *localTraverser) traverse(preprocessor objectMorpher, processor objectPr
 			}
 
 			if t.followSymlinks {
-				return WalkWithSymlinks(t.fullPath, processFile)
+				return walkWithSymlinks(t.fullPath, t.maxDepth, processFile)
 			} else {
-				return filepath.Walk(t.fullPath, processFile)
+				return parallelWalk(t.fullPath, azcopyEnumerationParallelism, t.maxDepth, processFile)
 			}
 		} else {
 			// if recursive is off, we only need to scan the files immediately under the fullPath
@@ -308,6 +321,84 @@ func consolidatePathSeparators(path string) string {
 	return strings.ReplaceAll(path, common.AZCOPY_PATH_SEPARATOR_STRING, pathSep)
 }
 
+type localWalkEntry struct {
+	fullPath string
+	info     os.FileInfo
+}
+
+// parallelWalk is like filepath.Walk, except that it lists up to parallelism directories at once, and so it calls
+// walkFn in no particular order. walkFn is only ever called from the calling goroutine, so it needn't be thread-safe.
+// Like filepath.Walk, it doesn't follow symlinks. Unlike filepath.Walk, it doesn't support filepath.SkipDir.
+// Directories are reported, but not listed, if their entries would be more than maxDepth levels below root.
+// A maxDepth of 0 means there is no limit
+func parallelWalk(root string, parallelism int, maxDepth int, walkFn filepath.WalkFunc) error {
+	tooDeep := func(dirPath string) bool {
+		if maxDepth <= 0 {
+			return false
+		}
+		rel, err := filepath.Rel(root, dirPath)
+		return err == nil && rel != "." && relativePathDepth(filepath.ToSlash(rel)) >= maxDepth
+	}
+
+	if parallelism <= 1 {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if walkErr := walkFn(path, info, err); walkErr != nil {
+				return walkErr
+			}
+			if err == nil && info.IsDir() && tooDeep(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+
+	rootInfo, err := os.Lstat(root)
+	if err != nil || !rootInfo.IsDir() {
+		// there's nothing to list, so just report the root
+		return walkFn(root, rootInfo, err)
+	}
+	if err = walkFn(root, rootInfo, nil); err != nil {
+		return err
+	}
+
+	// stop the listing if we return early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	enumerateOneDir := func(dir interface{}, enqueueDir func(interface{}), enqueueOutput func(interface{}, error) error) error {
+		dirPath := dir.(string)
+		entries, err := ioutil.ReadDir(dirPath)
+		if err != nil {
+			// report the directory, along with the reason that it couldn't be listed, just as filepath.Walk does
+			return enqueueOutput(localWalkEntry{fullPath: dirPath}, err)
+		}
+
+		for _, entry := range entries {
+			entryPath := filepath.Join(dirPath, entry.Name())
+			if entry.IsDir() && !tooDeep(entryPath) {
+				enqueueDir(entryPath)
+			}
+			if err = enqueueOutput(localWalkEntry{fullPath: entryPath, info: entry}, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for result := range common.Crawl(ctx, root, enumerateOneDir, parallelism) {
+		entry, _ := result.Item.(localWalkEntry)
+		if err = walkFn(entry.fullPath, entry.info, result.Err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *localTraverser) setMaxDepth(maxDepth int) {
+	t.maxDepth = maxDepth
+}
+
 func newLocalTraverser(fullPath string, recursive bool, followSymlinks bool, incrementEnumerationCounter func()) *localTraverser {
 	traverser := localTraverser{
 		fullPath:                    cleanLocalPath(fullPath),
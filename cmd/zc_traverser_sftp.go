@@ -0,0 +1,151 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// a traverser for a file or directory on an SFTP server
+type sftpTraverser struct {
+	parts     common.SftpURLParts
+	rawPath   string // as given in the URL, so that a trailing slash can still be seen
+	recursive bool
+	ctx       context.Context
+
+	// connects to the server, for each look at it
+	dial func() (*common.SftpClient, error)
+
+	// a generic function to notify that a new stored object has been enumerated
+	incrementEnumerationCounter func()
+}
+
+func newSftpTraverser(rawURL *url.URL, ctx context.Context, recursive bool, incrementEnumerationCounter func()) (*sftpTraverser, error) {
+	parts, err := common.NewSftpURLParts(*rawURL)
+	if err != nil {
+		return nil, err
+	}
+	t := &sftpTraverser{parts: parts, rawPath: rawURL.Path, recursive: recursive, ctx: ctx, incrementEnumerationCounter: incrementEnumerationCounter}
+	t.dial = func() (*common.SftpClient, error) {
+		return common.CreateSftpClient(t.ctx, t.parts)
+	}
+	return t, nil
+}
+
+func (t *sftpTraverser) isDirectory(bool) bool {
+	if strings.HasSuffix(t.rawPath, "/") {
+		return true
+	}
+
+	client, err := t.dial()
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	props, err := client.Stat(t.parts.Path)
+	if err != nil {
+		return false
+	}
+
+	return props.IsDir()
+}
+
+func (t *sftpTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) (err error) {
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	root := path.Clean(t.parts.Path)
+	rootInfo, err := client.Stat(root)
+	if err != nil {
+		return fmt.Errorf("cannot scan the path %s on %s: %v", root, t.parts.Server(), err)
+	}
+
+	// if the path is a single file, then pass it through the filters and send to processor
+	if !rootInfo.IsDir() {
+		if t.incrementEnumerationCounter != nil {
+			t.incrementEnumerationCounter()
+		}
+		return processIfPassedFilters(filters, t.newStoredObject(preprocessor, rootInfo, ""), processor)
+	}
+
+	walker := client.Walk(root)
+	for walker.Step() {
+		if walkErr := walker.Err(); walkErr != nil {
+			glcm.Info(fmt.Sprintf("Accessing %s failed with error: %s", walker.Path(), walkErr))
+			continue
+		}
+
+		fileInfo := walker.Stat()
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		if root == "." {
+			relativePath = walker.Path()
+		}
+		if relativePath == "" {
+			continue // the root itself
+		}
+
+		if fileInfo.IsDir() {
+			if !t.recursive {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if !fileInfo.Mode().IsRegular() {
+			// links are skipped, as they are for local files when --follow-symlinks is false
+			glcm.Info(fmt.Sprintf("Skipping over %s on %s because it isn't a regular file", walker.Path(), t.parts.Server()))
+			continue
+		}
+
+		if t.incrementEnumerationCounter != nil {
+			t.incrementEnumerationCounter()
+		}
+
+		err = processIfPassedFilters(filters, t.newStoredObject(preprocessor, fileInfo, relativePath), processor)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *sftpTraverser) newStoredObject(preprocessor objectMorpher, fileInfo os.FileInfo, relativePath string) storedObject {
+	return newStoredObject(
+		preprocessor,
+		fileInfo.Name(),
+		relativePath,
+		fileInfo.ModTime(),
+		fileInfo.Size(),
+		nil, // as for local files, the MD5 is taken in the STE
+		blobTypeNA,
+		"", // SFTP has no such thing as containers
+	)
+}
@@ -0,0 +1,374 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// Design explanation:
+/*
+A URL list names files on any number of web servers, each with the name it's to have at the destination, and optionally
+with the properties to give it there. The files don't share a root, so the source root of the job is empty, and the
+full URL of each file is its source. The names in the list are the relative paths at the destination.
+The properties of the files are read concurrently, since each needs a request of its own, but the objects are
+processed one at a time, in the order their reads finish. Files whose properties can't be read are left out of the job,
+so that a few broken links don't stop the rest of a big list, but they are reported as failed transfers, so that the
+job doesn't look like it succeeded.
+The headers and metadata of each file are settled here: those on its line of the list take precedence over those given
+for the job, which take precedence over those the server gave. So the job-wide ones aren't applied again when it runs.
+*/
+type urlListTraverser struct {
+	listFile                    string
+	p                           pipeline.Pipeline
+	ctx                         context.Context
+	parallelism                 int
+	jobHeaders                  common.ResourceHTTPHeaders // given with the flags of the job, for all its files
+	jobMetadata                 common.Metadata
+	incrementEnumerationCounter func()
+	reportUnreadable            func(entry urlListEntry, err error)
+}
+
+// urlListEntry is one line of a URL list
+type urlListEntry struct {
+	lineNumber int
+	source     *url.URL
+	name       string // the relative path at the destination
+
+	contentType        string
+	contentEncoding    string
+	contentLanguage    string
+	contentDisposition string
+	cacheControl       string
+	metadata           common.Metadata
+}
+
+const urlListMetadataHeaderPrefix = "x-ms-meta-"
+
+func newURLListTraverser(listFile string, p pipeline.Pipeline, ctx context.Context, jobHeaders common.ResourceHTTPHeaders, jobMetadata common.Metadata,
+	incrementEnumerationCounter func(), reportUnreadable func(entry urlListEntry, err error)) *urlListTraverser {
+	return &urlListTraverser{
+		listFile:                    listFile,
+		p:                           p,
+		ctx:                         ctx,
+		parallelism:                 azcopyEnumerationParallelism,
+		jobHeaders:                  jobHeaders,
+		jobMetadata:                 jobMetadata,
+		incrementEnumerationCounter: incrementEnumerationCounter,
+		reportUnreadable:            reportUnreadable,
+	}
+}
+
+func (t *urlListTraverser) isDirectory(bool) bool {
+	return true // like a directory, the list holds many files, which are named relative to the destination
+}
+
+func (t *urlListTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+	f, err := os.Open(t.listFile)
+	if err != nil {
+		return fmt.Errorf("cannot open the URL list %s: %v", t.listFile, err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	entries := make(chan urlListEntry)
+	parseErrCh := make(chan error, 1)
+	go func() {
+		defer close(entries)
+		parseErrCh <- readURLList(ctx, f, entries)
+	}()
+
+	type result struct {
+		entry urlListEntry
+		props ste.HTTPSourceProperties
+		err   error
+	}
+	results := make(chan result)
+	parallelism := t.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range entries {
+				props, err := ste.GetHTTPSourceProperties(ctx, t.p, *entry.source)
+				select {
+				case results <- result{entry, props, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	failed := 0
+	for r := range results {
+		if r.err != nil {
+			failed++
+			glcm.Info(fmt.Sprintf("Cannot copy %s on line %d of the URL list, since it couldn't be read: %v",
+				common.URLStringExtension(r.entry.source.String()).RedactSecretQueryParamForLogging(), r.entry.lineNumber, r.err))
+			if t.reportUnreadable != nil {
+				t.reportUnreadable(r.entry, r.err)
+			}
+			continue
+		}
+
+		if t.incrementEnumerationCounter != nil {
+			t.incrementEnumerationCounter()
+		}
+		err = processIfPassedFilters(filters, r.entry.toStoredObject(preprocessor, r.props, t.jobHeaders, t.jobMetadata), processor)
+		if err != nil {
+			return err // the deferred cancel stops the reads that are still going
+		}
+	}
+
+	if err = <-parseErrCh; err != nil {
+		return err
+	}
+	if failed > 0 {
+		glcm.Info(fmt.Sprintf("%d files of the URL list couldn't be read, so they are reported as failed", failed))
+	}
+	return nil
+}
+
+func (e urlListEntry) toStoredObject(preprocessor objectMorpher, props ste.HTTPSourceProperties, jobHeaders common.ResourceHTTPHeaders, jobMetadata common.Metadata) storedObject {
+	// without a last modified time from the server, changes to the file during the job can only be found by its size
+	lmt := props.LastModified
+	if lmt.IsZero() {
+		lmt = time.Unix(0, 0)
+	}
+
+	object := newStoredObject(preprocessor, path.Base(e.name), e.name, lmt, props.Size, props.ContentMD5, blobTypeNA, "")
+	object.sourceURL = e.source.String()
+	// the properties given in the list take the place of the ones given for the job, which take the place of the ones the server gave
+	object.contentType = firstNonEmpty(e.contentType, jobHeaders.ContentType, props.ContentType)
+	object.contentEncoding = firstNonEmpty(e.contentEncoding, jobHeaders.ContentEncoding, props.ContentEncoding)
+	object.contentLanguage = firstNonEmpty(e.contentLanguage, jobHeaders.ContentLanguage, props.ContentLanguage)
+	object.contentDisposition = firstNonEmpty(e.contentDisposition, jobHeaders.ContentDisposition, props.Disposition)
+	object.cacheControl = firstNonEmpty(e.cacheControl, jobHeaders.CacheControl, props.CacheControl)
+	if len(jobMetadata)+len(e.metadata) > 0 {
+		object.Metadata = common.Metadata{}
+		for k, v := range jobMetadata {
+			object.Metadata[k] = v
+		}
+		for k, v := range e.metadata {
+			object.Metadata[k] = v
+		}
+	}
+	return object
+}
+
+// parseJobMetadata reads the metadata given for the job, as key=value pairs separated by semicolons, the way the job does
+func parseJobMetadata(metadata string) common.Metadata {
+	if metadata == "" {
+		return nil
+	}
+	result := common.Metadata{}
+	for _, keyAndValue := range strings.Split(metadata, ";") {
+		kv := strings.SplitN(keyAndValue, "=", 2)
+		if len(kv) == 2 {
+			result[kv[0]] = kv[1]
+		}
+	}
+	return result
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// unreadableSources are the files that couldn't be read when the source was scanned, so they couldn't be put in the job.
+// They are reported with its failed transfers
+type unreadableSources struct {
+	mu        sync.Mutex
+	transfers []common.TransferDetail
+}
+
+func (u *unreadableSources) add(source string, destination string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.transfers = append(u.transfers, common.TransferDetail{Src: source, Dst: destination, TransferStatus: common.ETransferStatus.Failed()})
+}
+
+// addTo counts the files as failed transfers of the job whose summary this is
+func (u *unreadableSources) addTo(summary *common.ListJobSummaryResponse) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.transfers) == 0 {
+		return
+	}
+	summary.FailedTransfers = append(summary.FailedTransfers, u.transfers...)
+	summary.TotalTransfers += uint32(len(u.transfers))
+	summary.TransfersFailed += uint32(len(u.transfers))
+	switch summary.JobStatus {
+	case common.EJobStatus.Completed():
+		summary.JobStatus = common.EJobStatus.CompletedWithErrors()
+	case common.EJobStatus.CompletedWithSkipped():
+		summary.JobStatus = common.EJobStatus.CompletedWithErrorsAndSkipped()
+	}
+}
+
+// readURLList sends the entries of the list, in order, failing on the first line that can't be understood
+func readURLList(ctx context.Context, r io.Reader, entries chan<- urlListEntry) error {
+	utf8BOM := string([]byte{0xEF, 0xBB, 0xBF})
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // presigned URLs can be long
+	names := make(map[string]int)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseURLListLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d of the URL list: %v", lineNumber, err)
+		}
+		entry.lineNumber = lineNumber
+
+		if firstLine, seen := names[entry.name]; seen {
+			glcm.Info(fmt.Sprintf("Skipping line %d of the URL list, since line %d already has the name %s", lineNumber, firstLine, entry.name))
+			continue
+		}
+		names[entry.name] = lineNumber
+
+		select {
+		case entries <- entry:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// parseURLListLine parses a line of a URL list: a URL, and optionally, after tabs, the name of the file at the destination,
+// and the headers to set on it, such as Content-Type: text/csv. If the name is missing or empty, it's the last part of the URL's path
+func parseURLListLine(line string) (urlListEntry, error) {
+	fields := strings.Split(line, "\t")
+
+	source, err := url.Parse(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return urlListEntry{}, err
+	}
+	if scheme := strings.ToLower(source.Scheme); (scheme != "http" && scheme != "https") || source.Host == "" {
+		return urlListEntry{}, fmt.Errorf("%s is not an HTTP(S) URL", common.URLStringExtension(fields[0]).RedactSecretQueryParamForLogging())
+	}
+	entry := urlListEntry{source: source}
+
+	if len(fields) > 1 {
+		entry.name = strings.TrimSpace(fields[1])
+	}
+	if entry.name == "" {
+		entry.name = path.Base(source.Path) // the path of a URL is already unescaped
+		if entry.name == "/" || entry.name == "." {
+			return urlListEntry{}, errors.New("the URL doesn't end with a file name, so the file must be given a name after it")
+		}
+	}
+	if entry.name, err = cleanURLListName(entry.name); err != nil {
+		return urlListEntry{}, err
+	}
+
+	var headers []string
+	if len(fields) > 2 {
+		headers = fields[2:]
+	}
+	for _, header := range headers {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		colon := strings.Index(header, ":")
+		if colon <= 0 {
+			return urlListEntry{}, fmt.Errorf("invalid header %q. Headers must be given as Name: value", header)
+		}
+		name, value := strings.ToLower(strings.TrimSpace(header[:colon])), strings.TrimSpace(header[colon+1:])
+		switch {
+		case name == "content-type":
+			entry.contentType = value
+		case name == "content-encoding":
+			entry.contentEncoding = value
+		case name == "content-language":
+			entry.contentLanguage = value
+		case name == "content-disposition":
+			entry.contentDisposition = value
+		case name == "cache-control":
+			entry.cacheControl = value
+		case strings.HasPrefix(name, urlListMetadataHeaderPrefix) && len(name) > len(urlListMetadataHeaderPrefix):
+			if entry.metadata == nil {
+				entry.metadata = common.Metadata{}
+			}
+			entry.metadata[strings.TrimSpace(header[len(urlListMetadataHeaderPrefix):colon])] = value // keeping the case of the name
+		default:
+			return urlListEntry{}, fmt.Errorf("unsupported header %q. Only Content-Type, Content-Encoding, Content-Language, Content-Disposition, Cache-Control "+
+				"and metadata, as %s<name>, can be set", header[:colon], urlListMetadataHeaderPrefix)
+		}
+	}
+
+	return entry, nil
+}
+
+// cleanURLListName checks that a name from a URL list stays inside the destination
+func cleanURLListName(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if cleaned == "" || strings.HasSuffix(name, "/") {
+		return "", fmt.Errorf("invalid name %q. It must name a file", name)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid name %q. It must not refer to a parent directory", name)
+		}
+	}
+	return cleaned, nil
+}
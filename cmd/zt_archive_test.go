@@ -0,0 +1,120 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type archiveSuite struct{}
+
+var _ = chk.Suite(&archiveSuite{})
+
+func (s *archiveSuite) TestCookArchive(c *chk.C) {
+	dir := c.MkDir()
+	raw := getDefaultCopyRawInput(dir, "https://account.blob.core.windows.net/container/backup.tar.gz?sig=a")
+	raw.archive = "tar.gz"
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.archive, chk.Equals, common.EArchive.TarGz())
+
+	raw.archive = "zip"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	// the files to archive can't be chosen
+	raw.archive = "tar"
+	raw.include = "*.txt"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	// only a directory can be archived
+	file := filepath.Join(dir, "file.txt")
+	c.Assert(ioutil.WriteFile(file, []byte("x"), 0644), chk.IsNil)
+	raw = getDefaultCopyRawInput(file, "https://account.blob.core.windows.net/container/backup.tar?sig=a")
+	raw.archive = "tar"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *archiveSuite) TestArchiveRoundTrip(c *chk.C) {
+	for _, archive := range []common.Archive{common.EArchive.Tar(), common.EArchive.TarGz()} {
+		src := c.MkDir()
+		c.Assert(os.MkdirAll(filepath.Join(src, "sub", "empty"), 0755), chk.IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644), chk.IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("world!"), 0600), chk.IsNil)
+		c.Assert(os.Symlink(filepath.Join(src, "a.txt"), filepath.Join(src, "link")), chk.IsNil)
+
+		var buf bytes.Buffer
+		stats, err := writeArchive(&buf, src, archive)
+		c.Assert(err, chk.IsNil)
+		c.Assert(stats.Files, chk.Equals, uint64(2))
+		c.Assert(stats.Directories, chk.Equals, uint64(2))
+		c.Assert(stats.Bytes, chk.Equals, uint64(11))
+		c.Assert(stats.Skipped, chk.DeepEquals, []string{"link"})
+
+		dst := filepath.Join(c.MkDir(), "restored")
+		stats, err = extractArchive(bytes.NewReader(buf.Bytes()), dst, archive, true)
+		c.Assert(err, chk.IsNil)
+		c.Assert(stats.Files, chk.Equals, uint64(2))
+		c.Assert(stats.Directories, chk.Equals, uint64(2))
+		data, err := ioutil.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+		c.Assert(err, chk.IsNil)
+		c.Assert(string(data), chk.Equals, "world!")
+		info, err := os.Stat(filepath.Join(dst, "sub", "empty"))
+		c.Assert(err, chk.IsNil)
+		c.Assert(info.IsDir(), chk.Equals, true)
+
+		// files that exist are kept, unless they may be overwritten
+		c.Assert(ioutil.WriteFile(filepath.Join(dst, "a.txt"), []byte("changed"), 0644), chk.IsNil)
+		stats, err = extractArchive(bytes.NewReader(buf.Bytes()), dst, archive, false)
+		c.Assert(err, chk.IsNil)
+		c.Assert(stats.Skipped, chk.DeepEquals, []string{"a.txt", "sub/b.txt"})
+		data, err = ioutil.ReadFile(filepath.Join(dst, "a.txt"))
+		c.Assert(err, chk.IsNil)
+		c.Assert(string(data), chk.Equals, "changed")
+	}
+}
+
+func (s *archiveSuite) TestEntriesOutsideTheDestinationAreRejected(c *chk.C) {
+	for _, name := range []string{"../evil.txt", "/etc/evil.txt", "sub/../../evil.txt"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		c.Assert(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 4}), chk.IsNil)
+		_, err := tw.Write([]byte("evil"))
+		c.Assert(err, chk.IsNil)
+		c.Assert(tw.Close(), chk.IsNil)
+
+		parent := c.MkDir()
+		_, err = extractArchive(&buf, filepath.Join(parent, "dst"), common.EArchive.Tar(), true)
+		c.Assert(err, chk.NotNil)
+		_, err = os.Stat(filepath.Join(parent, "evil.txt"))
+		c.Assert(os.IsNotExist(err), chk.Equals, true)
+	}
+}
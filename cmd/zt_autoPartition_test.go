@@ -0,0 +1,106 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"sync/atomic"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type autoPartitionSuite struct{}
+
+var _ = chk.Suite(&autoPartitionSuite{})
+
+type dispatchedPart struct {
+	jobID       common.JobID
+	partNum     common.PartNumber
+	isFinalPart bool
+	transfers   int
+}
+
+func (s *autoPartitionSuite) TestJobIsBrokenUpIntoSubJobs(c *chk.C) {
+	var parts []dispatchedPart
+	mockedRPC := interceptor{}
+	mockedRPC.init()
+	Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+		order := request.(*common.CopyJobPartOrderRequest)
+		parts = append(parts, dispatchedPart{order.JobID, order.PartNum, order.IsFinalPart, len(order.Transfers)})
+		*(response.(*common.CopyJobPartOrderResponse)) = common.CopyJobPartOrderResponse{JobStarted: true}
+	}
+	defer func() { Rpc = mockedRPC.intercept }()
+
+	cca := &cookedCopyCmdArgs{jobID: common.NewJobID(), autoPartitionSize: 100, subJobDone: make(chan common.JobStatus, 10)}
+	for i := 0; i < cap(cca.subJobDone); i++ {
+		cca.subJobDone <- common.EJobStatus.Completed() // as if the progress reporting had seen each sub-job complete
+	}
+	order := common.CopyJobPartOrderRequest{JobID: cca.jobID}
+
+	for i := 0; i < 5; i++ {
+		c.Assert(addTransfer(&order, common.CopyTransfer{Source: "file", Destination: "file", SourceSize: 40}, cca), chk.IsNil)
+	}
+	c.Assert(dispatchFinalPart(&order, cca), chk.IsNil)
+
+	// two transfers fit in each sub-job, and each sub-job gets its own job ID
+	c.Assert(parts, chk.HasLen, 3)
+	for i, part := range parts {
+		c.Assert(part.partNum, chk.Equals, common.PartNumber(0))
+		c.Assert(part.isFinalPart, chk.Equals, true)
+		c.Assert(part.transfers, chk.Equals, []int{2, 2, 1}[i])
+		if i > 0 {
+			c.Assert(part.jobID, chk.Not(chk.Equals), parts[i-1].jobID)
+		}
+	}
+	c.Assert(cca.jobID, chk.Equals, parts[2].jobID)
+	c.Assert(cca.subJobNumber, chk.Equals, 3)
+	c.Assert(cca.isEnumerationComplete, chk.Equals, true)
+}
+
+func (s *autoPartitionSuite) TestScanStopsWhenASubJobDoesNotComplete(c *chk.C) {
+	for _, status := range []common.JobStatus{common.EJobStatus.Failed(), common.EJobStatus.Cancelled(), common.EJobStatus.Paused()} {
+		var parts []dispatchedPart
+		mockedRPC := interceptor{}
+		mockedRPC.init()
+		Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+			order := request.(*common.CopyJobPartOrderRequest)
+			parts = append(parts, dispatchedPart{order.JobID, order.PartNum, order.IsFinalPart, len(order.Transfers)})
+			*(response.(*common.CopyJobPartOrderResponse)) = common.CopyJobPartOrderResponse{JobStarted: true}
+		}
+
+		cca := &cookedCopyCmdArgs{jobID: common.NewJobID(), autoPartitionSize: 100, subJobDone: make(chan common.JobStatus, 1)}
+		cca.subJobDone <- status
+		order := common.CopyJobPartOrderRequest{JobID: cca.jobID}
+
+		var err error
+		for i := 0; i < 5 && err == nil; i++ {
+			err = addTransfer(&order, common.CopyTransfer{Source: "file", Destination: "file", SourceSize: 40}, cca)
+		}
+		Rpc = mockedRPC.intercept
+
+		// the wait ends, and nothing more is dispatched
+		c.Assert(err, chk.Equals, errScanCutShort)
+		c.Assert(atomic.LoadInt32(&cca.atomicScanCutShort), chk.Equals, int32(1))
+		c.Assert(parts, chk.HasLen, 1)
+		c.Assert(cca.isEnumerationComplete, chk.Equals, false)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type contentPolicySuite struct{}
+
+var _ = chk.Suite(&contentPolicySuite{})
+
+func (s *contentPolicySuite) TestCookContentPolicy(c *chk.C) {
+	policy, err := rawCopyCmdArgs{}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.IsEmpty(), chk.Equals, true)
+
+	raw := rawCopyCmdArgs{maxFileSize: "1K", blockedExtensions: "exe;.DLL", blockedSignatures: "4D5A", policyViolationAction: "reject"}
+	policy, err = raw.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy, chk.DeepEquals, common.ContentPolicy{MaxFileSize: 1024, AllowedExtensions: []string{}, BlockedExtensions: []string{"exe", "dll"},
+		BlockedSignatures: []string{"4d5a"}, Action: common.EContentPolicyAction.Reject()})
+
+	// quarantined files go to the default folder, unless another is given
+	raw = rawCopyCmdArgs{allowedExtensions: "csv", policyViolationAction: "quarantine"}
+	policy, err = raw.cookContentPolicy(common.EFromTo.BlobBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.QuarantineFolder, chk.Equals, defaultQuarantineFolder)
+	raw.quarantineFolder = "/held/back/"
+	policy, err = raw.cookContentPolicy(common.EFromTo.BlobBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.QuarantineFolder, chk.Equals, "held/back")
+}
+
+func (s *contentPolicySuite) TestCookContentPolicyErrors(c *chk.C) {
+	_, err := rawCopyCmdArgs{blockedSignatures: "4D5A"}.cookContentPolicy(common.EFromTo.BlobLocal())
+	c.Assert(err, chk.ErrorMatches, "blocked-signatures is only supported when uploading local files")
+
+	_, err = rawCopyCmdArgs{blockedExtensions: "exe", policyViolationAction: "delete"}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.ErrorMatches, "invalid policy-violation-action.*")
+
+	_, err = rawCopyCmdArgs{policyViolationAction: "quarantine"}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.ErrorMatches, ".*need a content policy.*")
+
+	_, err = rawCopyCmdArgs{blockedExtensions: "exe", quarantineFolder: "q"}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.ErrorMatches, "quarantine-folder can only be used with policy-violation-action=quarantine.*")
+
+	_, err = rawCopyCmdArgs{maxFileSize: "big"}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.NotNil)
+
+	_, err = rawCopyCmdArgs{scanCommand: "clamdscan -"}.cookContentPolicy(common.EFromTo.BlobBlob())
+	c.Assert(err, chk.ErrorMatches, "scan-command is only supported when uploading local files")
+
+	_, err = rawCopyCmdArgs{infectedAction: "quarantine"}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.ErrorMatches, "infected-action needs scan-command")
+}
+
+func (s *contentPolicySuite) TestCookMalwareScan(c *chk.C) {
+	// the scan alone is a content policy, and infected files can be quarantined while other violations are rejected
+	raw := rawCopyCmdArgs{scanCommand: " clamdscan  --no-summary - ", infectedAction: "quarantine", blockedExtensions: "exe"}
+	policy, err := raw.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.ScanCommand, chk.DeepEquals, []string{"clamdscan", "--no-summary", "-"})
+	c.Assert(policy.Action, chk.Equals, common.EContentPolicyAction.Reject())
+	c.Assert(policy.InfectedAction, chk.Equals, common.EContentPolicyAction.Quarantine())
+	c.Assert(policy.QuarantineFolder, chk.Equals, defaultQuarantineFolder)
+
+	policy, err = rawCopyCmdArgs{scanCommand: "clamdscan -"}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.IsEmpty(), chk.Equals, false)
+	c.Assert(policy.QuarantineFolder, chk.Equals, "")
+}
+
+func (s *contentPolicySuite) TestScanCommandArgumentsCanBeQuoted(c *chk.C) {
+	policy, err := rawCopyCmdArgs{scanCommand: `"C:\Program Files\ClamAV\clamdscan.exe" --no-summary -`}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.ScanCommand, chk.DeepEquals, []string{`C:\Program Files\ClamAV\clamdscan.exe`, "--no-summary", "-"})
+
+	policy, err = rawCopyCmdArgs{scanCommand: `C:\ClamAV\clamdscan.exe '--config-file=/etc/my clam.conf' "say \"hi\"" ""`}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy.ScanCommand, chk.DeepEquals, []string{`C:\ClamAV\clamdscan.exe`, "--config-file=/etc/my clam.conf", `say "hi"`, ""})
+
+	_, err = rawCopyCmdArgs{scanCommand: `"C:\Program Files\ClamAV\clamdscan.exe -`}.cookContentPolicy(common.EFromTo.LocalBlob())
+	c.Assert(err, chk.ErrorMatches, "invalid scan-command: .*quote is not closed")
+}
+
+func (s *contentPolicySuite) TestInfectedFilesAreReported(c *chk.C) {
+	summary := common.ListJobSummaryResponse{
+		TransfersSkippedInfected: 1,
+		TransfersQuarantined:     1,
+		PolicyViolations: []common.PolicyViolation{
+			{Src: "/in/a.doc", Rule: "infected: stream: Eicar-Signature FOUND", Infected: true},
+			{Src: "/in/b.doc", Dst: "/quarantine/b.doc", Rule: "infected: stream: Eicar-Signature FOUND", Infected: true, Quarantined: true},
+		},
+	}
+	report := formatContentPolicyReport(summary)
+	c.Assert(report, chk.Matches, "(?s).*Files skipped as infected: 1\n.*")
+	c.Assert(report, chk.Matches, "(?s).*/in/a.doc: infected: stream: Eicar-Signature FOUND \\(skipped\\).*")
+	c.Assert(report, chk.Matches, "(?s).*/in/b.doc: .* \\(quarantined to /quarantine/b.doc\\).*")
+}
@@ -0,0 +1,108 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type copyLocalLocalSuite struct{}
+
+var _ = chk.Suite(&copyLocalLocalSuite{})
+
+func (s *copyLocalLocalSuite) TestCookLocalToLocal(c *chk.C) {
+	src, dst := c.MkDir(), c.MkDir()
+	c.Assert(inferFromTo(src, dst), chk.Equals, common.EFromTo.LocalLocal())
+
+	raw := getDefaultCopyRawInput(src, dst)
+	raw.recursive = true
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.fromTo, chk.Equals, common.EFromTo.LocalLocal())
+	c.Assert(cooked.md5ValidationOption, chk.Equals, common.EHashValidationOption.NoCheck())
+
+	// options for the service don't apply
+	raw.blockBlobTier = common.EBlockBlobTier.Hot().String()
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	raw.blockBlobTier = common.EBlockBlobTier.None().String()
+	raw.contentType = "text/plain"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *copyLocalLocalSuite) TestCookSyncLocalToLocal(c *chk.C) {
+	src, dst := c.MkDir(), c.MkDir()
+	raw := getDefaultSyncRawInput(src, dst)
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.fromTo, chk.Equals, common.EFromTo.LocalLocal())
+	c.Assert(cooked.source, chk.Equals, common.ToExtendedPath(cleanLocalPath(src)))
+	c.Assert(cooked.destination, chk.Equals, common.ToExtendedPath(cleanLocalPath(dst)))
+}
+
+func (s *copyLocalLocalSuite) TestCookRejectsOverlappingLocalPaths(c *chk.C) {
+	root := c.MkDir()
+	src := filepath.Join(root, "src")
+	c.Assert(os.Mkdir(src, 0755), chk.IsNil)
+
+	// the destination needn't exist yet
+	raw := getDefaultCopyRawInput(src, filepath.Join(src, "backup", "new"))
+	raw.recursive = true
+	_, err := raw.cook()
+	c.Assert(err, chk.ErrorMatches, "the destination .* is inside the source .*")
+
+	rawSync := getDefaultSyncRawInput(src, filepath.Join(src, ".."))
+	_, err = rawSync.cook()
+	c.Assert(err, chk.ErrorMatches, "the source .* is inside the destination .*")
+
+	// nor does a symlink hide it
+	link := filepath.Join(c.MkDir(), "link")
+	c.Assert(os.Symlink(src, link), chk.IsNil)
+	raw = getDefaultCopyRawInput(filepath.Join(link, "*"), filepath.Join(src, "sub"))
+	_, err = raw.cook()
+	c.Assert(err, chk.ErrorMatches, "the destination .* is inside the source .*")
+
+	rawSync = getDefaultSyncRawInput(src, link)
+	_, err = rawSync.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *copyLocalLocalSuite) TestCookRejectsCheckMd5BetweenLocalPaths(c *chk.C) {
+	src, dst := c.MkDir(), c.MkDir()
+
+	raw := getDefaultCopyRawInput(src, dst)
+	raw.recursive = true
+	raw.md5ValidationOptionIsSet = true
+	_, err := raw.cook()
+	c.Assert(err, chk.ErrorMatches, "check-md5 is not supported while copying between local paths.*")
+
+	rawSync := getDefaultSyncRawInput(src, dst)
+	rawSync.md5ValidationOptionIsSet = true
+	_, err = rawSync.cook()
+	c.Assert(err, chk.ErrorMatches, "check-md5 is not supported while syncing between local paths.*")
+}
@@ -0,0 +1,141 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type copyPipeSuite struct{}
+
+var _ = chk.Suite(&copyPipeSuite{})
+
+func (s *copyPipeSuite) TestCookFromPipe(c *chk.C) {
+	raw := getDefaultCopyRawInput(pipeLocation, "https://account.blob.core.windows.net/container/backup.tgz")
+	raw.fromPipe = true
+	raw.blockSizeMB = 64
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.fromTo, chk.Equals, common.EFromTo.PipeBlob())
+	c.Assert(cooked.blockSize, chk.Equals, uint32(64*1024*1024))
+
+	// blocks can't be bigger than the service allows
+	raw.blockSizeMB = 101
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	// only block blobs can be the destination
+	raw.blockSizeMB = 0
+	raw.dst = "/local/backup.tgz"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	raw.dst = "https://account.blob.core.windows.net/container/backup.tgz"
+	raw.urlList = "list.txt"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *copyPipeSuite) TestPipeSizeLimit(c *chk.C) {
+	// data that exactly fills the blocks is read in full
+	r := &pipeSizeLimitReader{reader: strings.NewReader("0123456789"), remaining: 10, blockSize: 5}
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(data), chk.Equals, "0123456789")
+
+	// and a single byte more fails the read
+	r = &pipeSizeLimitReader{reader: bytes.NewReader(make([]byte, 11)), remaining: 10, blockSize: 5}
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, chk.NotNil)
+	c.Assert(err.Error(), chk.Equals, "the data from the pipe doesn't fit in 50000 blocks of 5 bytes. Use a larger block-size-mb")
+}
+
+func (s *copyPipeSuite) TestCookToPipe(c *chk.C) {
+	raw := getDefaultCopyRawInput("https://account.blob.core.windows.net/container/backup.tgz", pipeLocation)
+	raw.toPipe = true
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.fromTo, chk.Equals, common.EFromTo.BlobPipe())
+
+	// only blobs can be the source
+	raw.src = "/local/backup.tgz"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *copyPipeSuite) TestCopyRangesInOrder(c *chk.C) {
+	source := make([]byte, 1000)
+	rand.Read(source)
+
+	inFlight, maxInFlight := int32(0), int32(0)
+	readRange := func(ctx context.Context, offset int64, count int64) ([]byte, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond) // so that the ranges finish out of order
+		return source[offset : offset+count], nil
+	}
+
+	// the last range is a short one
+	var out bytes.Buffer
+	err := copyRangesInOrder(context.Background(), &out, int64(len(source)), 30, 4, readRange)
+	c.Assert(err, chk.IsNil)
+	c.Assert(out.Bytes(), chk.DeepEquals, source)
+	c.Assert(maxInFlight > 1, chk.Equals, true)
+	c.Assert(maxInFlight <= 5, chk.Equals, true) // the queued ranges, and the one that waits to be queued
+
+	// nothing to read, nothing written
+	out.Reset()
+	c.Assert(copyRangesInOrder(context.Background(), &out, 0, 30, 4, readRange), chk.IsNil)
+	c.Assert(out.Len(), chk.Equals, 0)
+}
+
+func (s *copyPipeSuite) TestCopyRangesInOrderStopsAtFailure(c *chk.C) {
+	failure := errors.New("range failed")
+	readRange := func(ctx context.Context, offset int64, count int64) ([]byte, error) {
+		if offset == 20 {
+			return nil, failure
+		}
+		return bytes.Repeat([]byte{'x'}, int(count)), nil
+	}
+
+	// the ranges before the failed one are written, and none after it
+	var out bytes.Buffer
+	err := copyRangesInOrder(context.Background(), &out, 100, 10, 3, readRange)
+	c.Assert(err, chk.Equals, failure)
+	c.Assert(out.Len(), chk.Equals, 20)
+}
@@ -83,6 +83,9 @@ func getDefaultRawCopyInput(src, dst string) rawCopyCmdArgs {
 		s2sSourceChangeValidation:      defaultS2SSourceChangeValidation,
 		s2sInvalidMetadataHandleOption: defaultS2SInvalideMetadataHandleOption.String(),
 		forceWrite:                     common.EOverwriteOption.True().String(),
+		sourceChangePolicy:             common.ESourceChangePolicy.Fail().String(),
+		deleteSourceAfter:              common.EDeleteSourceAfter.Never().String(),
+		assertSourceUnchanged:          common.EAssertSourceUnchanged.None().String(),
 	}
 }
 
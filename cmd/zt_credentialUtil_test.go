@@ -0,0 +1,50 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type credentialUtilSuite struct{}
+
+var _ = chk.Suite(&credentialUtilSuite{})
+
+func (s *credentialUtilSuite) TestUserDelegationSASNeedsContainer(c *chk.C) {
+	credInfo := common.CredentialInfo{CredentialType: common.ECredentialType.OAuthToken()}
+
+	_, err := getUserDelegationSAS(context.Background(), "https://account.blob.core.windows.net/", credInfo)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *credentialUtilSuite) TestValidateResourceCloud(c *chk.C) {
+	china, err := common.ParseAzureCloud("AzureChina")
+	c.Assert(err, chk.IsNil)
+
+	c.Assert(validateResourceCloud("https://account.blob.core.chinacloudapi.cn/c", common.ELocation.Blob(), china, "source-cloud"), chk.IsNil)
+	c.Assert(validateResourceCloud("https://account.blob.core.windows.net/c", common.ELocation.Blob(), china, "source-cloud"), chk.NotNil)
+	c.Assert(validateResourceCloud("/tmp/dir", common.ELocation.Local(), china, "source-cloud"), chk.NotNil)
+	c.Assert(validateResourceCloud("/tmp/dir", common.ELocation.Local(), common.AzureCloud{}, "source-cloud"), chk.IsNil)
+}
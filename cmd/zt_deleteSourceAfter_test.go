@@ -0,0 +1,47 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type deleteSourceAfterSuite struct{}
+
+var _ = chk.Suite(&deleteSourceAfterSuite{})
+
+func (s *deleteSourceAfterSuite) TestSourcesAreOnlyDeletedAfterAHashCheck(c *chk.C) {
+	failIfDifferent := common.EHashValidationOption.FailIfDifferent()
+	c.Assert(validateDeleteSourceAfterVerified(common.EFromTo.BlobLocal(), true, failIfDifferent, false), chk.IsNil)
+	c.Assert(validateDeleteSourceAfterVerified(common.EFromTo.FileLocal(), true, common.EHashValidationOption.FailIfDifferentOrMissing(), false), chk.IsNil)
+
+	// uploads and copies between accounts have no hash to compare with
+	for _, fromTo := range []common.FromTo{common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.BlobBlob(), common.EFromTo.FileBlob()} {
+		c.Assert(validateDeleteSourceAfterVerified(fromTo, true, failIfDifferent, false), chk.ErrorMatches, ".*only downloads compare the hash.*")
+	}
+
+	// and downloads must actually compare it
+	for _, option := range []common.HashValidationOption{common.EHashValidationOption.NoCheck(), common.EHashValidationOption.LogOnly()} {
+		c.Assert(validateDeleteSourceAfterVerified(common.EFromTo.BlobLocal(), true, option, false), chk.ErrorMatches, ".*requires check-md5.*")
+	}
+	c.Assert(validateDeleteSourceAfterVerified(common.EFromTo.BlobLocal(), false, failIfDifferent, false), chk.ErrorMatches, ".*requires check-length.*")
+}
@@ -0,0 +1,108 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type dryRunSuite struct{}
+
+var _ = chk.Suite(&dryRunSuite{})
+
+func (s *dryRunSuite) TestCookDryRun(c *chk.C) {
+	raw := getDefaultCopyRawInput(c.MkDir(), "https://account.blob.core.windows.net/container/backup.tar?sig=a")
+	raw.dryRun = true
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.dryRun, chk.Equals, true)
+
+	// an archive isn't enumerated, so there is nothing to report
+	raw.archive = "tar"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	// ADLS Gen2 directories are removed by the service, without being listed
+	raw = getDefaultRemoveRawInput("https://account.dfs.core.windows.net/filesystem/dir")
+	raw.dryRun = true
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *dryRunSuite) TestDryRunCopySchedulesNothing(c *chk.C) {
+	srcDir := c.MkDir()
+	dstDir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(srcDir, "sub"), 0755), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("abc"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("abcdef"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(srcDir, "c.log"), []byte("x"), 0644), chk.IsNil)
+
+	mockedRPC := interceptor{}
+	Rpc = mockedRPC.intercept
+	mockedRPC.init()
+
+	raw := getDefaultCopyRawInput(srcDir, dstDir)
+	raw.recursive = true
+	raw.include = "*.txt"
+	raw.dryRun = true
+
+	runCopyAndVerify(c, raw, func(err error) {
+		c.Assert(err, chk.IsNil)
+
+		// nothing reaches the transfer engine, and the destination is untouched
+		c.Assert(mockedRPC.transfers, chk.HasLen, 0)
+		entries, err := ioutil.ReadDir(dstDir)
+		c.Assert(err, chk.IsNil)
+		c.Assert(entries, chk.HasLen, 0)
+
+		c.Assert(glcm.(*mockedLifecycleManager).logContainsText(filepath.Join("sub", "b.txt"), time.Second), chk.Equals, true)
+	})
+}
+
+func (s *dryRunSuite) TestDryRunRecorderTotals(c *chk.C) {
+	mockedRPC := interceptor{}
+	mockedRPC.init()
+
+	recorder := newDryRunRecorder("remove", common.EFromTo.BlobTrash(), common.EOutputFormat.Json())
+	c.Assert(recorder.record("https://account.blob.core.windows.net/container/a", "", 10), chk.IsNil)
+	c.Assert(recorder.record("https://account.blob.core.windows.net/container/b", "", 1024), chk.IsNil)
+
+	c.Assert(recorder.TotalTransfers, chk.Equals, uint64(2))
+	c.Assert(recorder.TotalBytes, chk.Equals, uint64(1034))
+	c.Assert(recorder.summary(), chk.Equals, "Dry run: 2 files (1.01 KiB) would be removed. Nothing was deleted.")
+
+	// with JSON output, the transfers are listed in the final message
+	output, err := json.Marshal(recorder)
+	c.Assert(err, chk.IsNil)
+	var decoded dryRunRecorder
+	c.Assert(json.Unmarshal(output, &decoded), chk.IsNil)
+	c.Assert(decoded.Transfers, chk.HasLen, 2)
+	c.Assert(decoded.Transfers[1].Size, chk.Equals, int64(1024))
+	c.Assert(decoded.Operation, chk.Equals, "remove")
+}
@@ -0,0 +1,121 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type enumerateFirstSuite struct{}
+
+var _ = chk.Suite(&enumerateFirstSuite{})
+
+type orderedPart struct {
+	partNum      common.PartNumber
+	isFinalPart  bool
+	scanComplete bool
+	transfers    int
+}
+
+// recordOrderedParts replaces the RPC to the transfer engine with one that records the parts that are ordered
+func recordOrderedParts(parts *[]orderedPart) (restore func()) {
+	mockedRPC := interceptor{}
+	mockedRPC.init()
+	Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+		order := request.(*common.CopyJobPartOrderRequest)
+		*parts = append(*parts, orderedPart{order.PartNum, order.IsFinalPart, order.ScanComplete, len(order.Transfers)})
+		*(response.(*common.CopyJobPartOrderResponse)) = common.CopyJobPartOrderResponse{JobStarted: true}
+	}
+	return func() { Rpc = mockedRPC.intercept }
+}
+
+func (s *enumerateFirstSuite) TestCopyHoldsPartsUntilTheScanIsComplete(c *chk.C) {
+	var parts []orderedPart
+	defer recordOrderedParts(&parts)()
+
+	cca := &cookedCopyCmdArgs{jobID: common.NewJobID(), enumerateFirst: true}
+	order := common.CopyJobPartOrderRequest{JobID: cca.jobID}
+	for i := 0; i < 2*NumOfFilesPerDispatchJobPart+1; i++ {
+		c.Assert(addTransfer(&order, common.CopyTransfer{Source: "file", Destination: "file"}, cca), chk.IsNil)
+	}
+
+	// two parts have filled up, but nothing is ordered until the final part is
+	c.Assert(parts, chk.HasLen, 0)
+	c.Assert(cca.heldParts, chk.HasLen, 2)
+
+	c.Assert(dispatchFinalPart(&order, cca), chk.IsNil)
+	c.Assert(cca.heldParts, chk.HasLen, 0)
+	c.Assert(parts, chk.DeepEquals, []orderedPart{
+		{0, false, true, NumOfFilesPerDispatchJobPart},
+		{1, false, true, NumOfFilesPerDispatchJobPart},
+		{2, true, false, 1},
+	})
+}
+
+func (s *enumerateFirstSuite) TestSyncHoldsPartsUntilTheScanIsComplete(c *chk.C) {
+	var parts []orderedPart
+	defer recordOrderedParts(&parts)()
+
+	copyProcessor := newCopyTransferProcessor(processorTestSuiteHelper{}.getCopyJobTemplate(), 2,
+		"https://fakeaccount.blob.core.windows.net/container", c.MkDir(), false, false, nil, nil)
+	copyProcessor.enumerateFirst = true
+	sampleObjects := processorTestSuiteHelper{}.getSampleObjectList()
+	for _, storedObject := range sampleObjects {
+		c.Assert(copyProcessor.scheduleCopyTransfer(storedObject), chk.IsNil)
+	}
+
+	c.Assert(parts, chk.HasLen, 0)
+	c.Assert(copyProcessor.heldParts, chk.HasLen, 2)
+
+	jobInitiated, err := copyProcessor.dispatchFinalPart()
+	c.Assert(err, chk.IsNil)
+	c.Assert(jobInitiated, chk.Equals, true)
+	c.Assert(parts, chk.DeepEquals, []orderedPart{
+		{0, false, true, 2},
+		{1, false, true, 2},
+		{2, true, false, 2},
+	})
+}
+
+func (s *enumerateFirstSuite) TestCookEnumerateFirst(c *chk.C) {
+	raw := getDefaultCopyRawInput(c.MkDir(), c.MkDir())
+	raw.recursive = true
+	raw.enumerateFirst = true
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.enumerateFirst, chk.Equals, true)
+
+	// sub-jobs are transferred one at a time as the scan goes on, so they can't wait for it
+	raw.autoPartitionSize = "1G"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *enumerateFirstSuite) TestFormatScanOverlap(c *chk.C) {
+	c.Assert(formatScanOverlap(nil), chk.Equals, "")
+	c.Assert(formatScanOverlap(&common.ScanOverlap{}), chk.Equals, "")
+
+	text := formatScanOverlap(&common.ScanOverlap{PartsOrderedWhileScanning: 3, OverlapSeconds: 12.34,
+		TransfersDoneWhileScanning: 20000, BytesTransferredWhileScanning: 3 * 1024 * 1024})
+	c.Assert(text, chk.Matches, "(?s).*12.3 seconds. 3 part.*20000 transfers.*")
+}
@@ -0,0 +1,44 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type fipsModeCmdSuite struct{}
+
+var _ = chk.Suite(&fipsModeCmdSuite{})
+
+func (s *fipsModeCmdSuite) TestHashValidationInFIPSMode(c *chk.C) {
+	os.Setenv(common.EEnvironmentVariable.FIPSMode().Name, "true")
+	defer os.Unsetenv(common.EEnvironmentVariable.FIPSMode().Name)
+
+	// NoCheck is the default in FIPS mode, so it's fine for uploads
+	c.Assert(validateMd5Option(common.EHashValidationOption.NoCheck(), common.EFromTo.LocalBlob()), chk.IsNil)
+
+	// downloads can't be verified without MD5, so their sources must not be deleted
+	err := validateDeleteSourceAfterVerified(common.EFromTo.BlobLocal(), true, common.EHashValidationOption.FailIfDifferentOrMissing(), false)
+	c.Assert(err, chk.ErrorMatches, ".*FIPS mode.*")
+}
@@ -0,0 +1,51 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type folderCreationSuite struct{}
+
+var _ = chk.Suite(&folderCreationSuite{})
+
+func (s *folderCreationSuite) TestCookFolderCreation(c *chk.C) {
+	policy, err := cookFolderCreation("lazy", common.EFromTo.LocalBlob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy, chk.Equals, common.EFolderCreationPolicy.Lazy())
+
+	policy, err = cookFolderCreation("Eager", common.EFromTo.BlobLocal())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy, chk.Equals, common.EFolderCreationPolicy.Eager())
+
+	policy, err = cookFolderCreation("eager", common.EFromTo.LocalFile())
+	c.Assert(err, chk.IsNil)
+	c.Assert(policy, chk.Equals, common.EFolderCreationPolicy.Eager())
+
+	// blob storage has no real directories to create
+	_, err = cookFolderCreation("eager", common.EFromTo.LocalBlob())
+	c.Assert(err, chk.ErrorMatches, ".*only supported when the destination is local or Azure Files")
+
+	_, err = cookFolderCreation("sometimes", common.EFromTo.LocalFile())
+	c.Assert(err, chk.ErrorMatches, "invalid folder-creation.*")
+}
@@ -0,0 +1,95 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type generateSuite struct{}
+
+var _ = chk.Suite(&generateSuite{})
+
+func (s *generateSuite) TestSyntheticDataSpecRoundTrips(c *chk.C) {
+	specs := []syntheticDataSpec{
+		{fileCount: 100, bytesPerFile: 250 * 1024 * 1024},
+		{fileCount: 7, sizeDistribution: []weightedSize{{4096, 70}, {1024 * 1024, 30}}, filesPerDirectory: 3, compressible: true},
+	}
+	for _, spec := range specs {
+		u := benchmarkSourceHelper{}.ToUrl(spec)
+		c.Assert(inferArgumentLocation(u), chk.Equals, common.ELocation.Benchmark())
+
+		parsed, err := benchmarkSourceHelper{}.FromUrl(u)
+		c.Assert(err, chk.IsNil)
+		c.Assert(parsed, chk.DeepEquals, spec)
+	}
+
+	// what the bench command has always used
+	c.Assert(benchmarkSourceHelper{}.ToUrl(specs[0]), chk.Equals, "https://benchmark.invalid?fc=100&bpf=262144000")
+
+	_, err := benchmarkSourceHelper{}.FromUrl("https://benchmark.invalid?fc=1&bpf=2&what=3")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *generateSuite) TestParseSizeDistribution(c *chk.C) {
+	sizes, err := parseSizeDistribution("4K:70, 1M:25,100M:5")
+	c.Assert(err, chk.IsNil)
+	c.Assert(sizes, chk.DeepEquals, []weightedSize{{4096, 70}, {1024 * 1024, 25}, {100 * 1024 * 1024, 5}})
+
+	for _, bad := range []string{"4K", "4K:0", "4K:x", "4Q:10", "4K:70,"} {
+		_, err = parseSizeDistribution(bad)
+		c.Assert(err, chk.NotNil)
+	}
+}
+
+func (s *generateSuite) TestGeneratedFilesAreTheSameEveryTime(c *chk.C) {
+	spec := syntheticDataSpec{fileCount: 1000, sizeDistribution: []weightedSize{{10, 3}, {20, 1}}, filesPerDirectory: 100}
+
+	traverse := func() []storedObject {
+		t, err := newBenchmarkTraverser(benchmarkSourceHelper{}.ToUrl(spec), nil)
+		c.Assert(err, chk.IsNil)
+		objects := make([]storedObject, 0)
+		c.Assert(t.traverse(noPreProccessor, func(o storedObject) error {
+			objects = append(objects, o)
+			return nil
+		}, nil), chk.IsNil)
+		return objects
+	}
+
+	first := traverse()
+	c.Assert(first, chk.HasLen, 1000)
+	c.Assert(traverse(), chk.DeepEquals, first)
+
+	c.Assert(first[0].relativePath, chk.Equals, "1/1")
+	c.Assert(first[999].relativePath, chk.Equals, "10/1000")
+
+	// the sizes roughly follow their weights
+	small := 0
+	for _, o := range first {
+		c.Assert(o.size == 10 || o.size == 20, chk.Equals, true)
+		if o.size == 10 {
+			small++
+		}
+	}
+	c.Assert(small > 650 && small < 850, chk.Equals, true)
+}
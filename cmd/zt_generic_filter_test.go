@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"github.com/Azure/azure-storage-blob-go/azblob"
 	chk "gopkg.in/check.v1"
 )
 
@@ -73,3 +74,62 @@ func (s *genericFilterSuite) TestExcludeFilter(c *chk.C) {
 		c.Assert(len(dummyProcessor.record), chk.Equals, 0)
 	}
 }
+
+func (s *genericFilterSuite) TestIncludeBlobPropertyFilters(c *chk.C) {
+	// set up the filters
+	raw := rawCopyCmdArgs{}
+	contentTypePatterns := raw.parsePatterns("video/*;application/pdf")
+	filters := buildIncludeBlobPropertyFilters([]azblob.BlobType{azblob.BlobBlockBlob}, contentTypePatterns)
+	c.Assert(len(filters), chk.Equals, 2)
+
+	// test the positive cases
+	objectsToPass := []storedObject{
+		{name: "a", blobType: azblob.BlobBlockBlob, contentType: "video/mp4"},
+		{name: "b", blobType: azblob.BlobBlockBlob, contentType: "Application/PDF; charset=utf-8"},
+	}
+	for _, object := range objectsToPass {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, object, dummyProcessor.process)
+		c.Assert(err, chk.IsNil)
+		c.Assert(len(dummyProcessor.record), chk.Equals, 1)
+	}
+
+	// test the negative cases
+	objectsToNotPass := []storedObject{
+		{name: "c", blobType: azblob.BlobPageBlob, contentType: "video/mp4"},
+		{name: "d", blobType: azblob.BlobBlockBlob, contentType: "image/png"},
+		{name: "e", blobType: azblob.BlobBlockBlob, contentType: ""},
+	}
+	for _, object := range objectsToNotPass {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, object, dummyProcessor.process)
+		c.Assert(err, chk.IsNil)
+		c.Assert(len(dummyProcessor.record), chk.Equals, 0)
+	}
+
+	// no filters are created when the flags are not specified
+	c.Assert(len(buildIncludeBlobPropertyFilters(nil, nil)), chk.Equals, 0)
+}
+
+func (s *genericFilterSuite) TestMaxDepthFilter(c *chk.C) {
+	// set up the filters
+	filters := buildMaxDepthFilters(2)
+	c.Assert(len(filters), chk.Equals, 1)
+
+	// test the positive cases
+	pathsToPass := []string{"file.txt", "dir/file.txt", "/dir/file.txt"}
+	for _, relativePath := range pathsToPass {
+		passed := filters[0].doesPass(storedObject{name: "file.txt", relativePath: relativePath})
+		c.Assert(passed, chk.Equals, true)
+	}
+
+	// test the negative cases
+	pathsToNotPass := []string{"dir/sub/file.txt", "a/b/c/d/file.txt"}
+	for _, relativePath := range pathsToNotPass {
+		passed := filters[0].doesPass(storedObject{name: "file.txt", relativePath: relativePath})
+		c.Assert(passed, chk.Equals, false)
+	}
+
+	// no filter is created when there is no limit
+	c.Assert(len(buildMaxDepthFilters(0)), chk.Equals, 0)
+}
@@ -0,0 +1,85 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type httpTraverserSuite struct{}
+
+var _ = chk.Suite(&httpTraverserSuite{})
+
+func (s *httpTraverserSuite) TestInferHTTPSource(c *chk.C) {
+	c.Assert(inferArgumentLocation("https://example.com/data/file.csv"), chk.Equals, common.ELocation.Http())
+	c.Assert(inferArgumentLocation("http://example.com/file.csv?sig=abc"), chk.Equals, common.ELocation.Http())
+	c.Assert(inferArgumentLocation("https://account.blob.core.windows.net/container/blob"), chk.Equals, common.ELocation.Blob())
+	c.Assert(inferFromTo("https://example.com/file.csv", "https://account.blob.core.windows.net/container"), chk.Equals, common.EFromTo.HttpBlob())
+
+	// the query is kept apart, like a SAS, so that it stays out of the plan files
+	base, query, err := SplitAuthTokenFromResource("https://example.com/data/file.csv?X-Amz-Signature=abc&X-Amz-Expires=60", common.ELocation.Http())
+	c.Assert(err, chk.IsNil)
+	c.Assert(base, chk.Equals, "https://example.com/data/file.csv")
+	c.Assert(query, chk.Equals, "X-Amz-Signature=abc&X-Amz-Expires=60")
+}
+
+func (s *httpTraverserSuite) TestTraverseHTTPFile(c *chk.C) {
+	lmt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	contentMD5 := md5.Sum([]byte("a,b,c\n1,2,3\n"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(contentMD5[:]))
+		http.ServeContent(w, r, "file.csv", lmt, strings.NewReader("a,b,c\n1,2,3\n"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	traverser, err := initResourceTraverser(server.URL+"/data/my%20file.csv", common.ELocation.Http(), &ctx,
+		&common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}, nil, nil, false, false, func() {})
+	c.Assert(err, chk.IsNil)
+	c.Assert(traverser.isDirectory(true), chk.Equals, false)
+
+	objects := make([]storedObject, 0)
+	err = traverser.traverse(noPreProccessor, func(object storedObject) error {
+		objects = append(objects, object)
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(objects, chk.HasLen, 1)
+	c.Assert(objects[0].name, chk.Equals, "my file.csv")
+	c.Assert(objects[0].relativePath, chk.Equals, "")
+	c.Assert(objects[0].size, chk.Equals, int64(12))
+	c.Assert(objects[0].lastModifiedTime.Equal(lmt), chk.Equals, true)
+	c.Assert(objects[0].contentType, chk.Equals, "text/csv")
+	c.Assert(objects[0].cacheControl, chk.Equals, "max-age=60")
+	c.Assert(objects[0].md5, chk.DeepEquals, contentMD5[:]) // so that the content can be verified as it's copied
+}
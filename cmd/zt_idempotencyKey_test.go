@@ -0,0 +1,85 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type idempotencyKeySuite struct{}
+
+var _ = chk.Suite(&idempotencyKeySuite{})
+
+func (s *idempotencyKeySuite) TestSameCommandAndKeyGiveSameJob(c *chk.C) {
+	src := c.MkDir()
+	cook := func(key string, dst string) cookedCopyCmdArgs {
+		raw := getDefaultCopyRawInput(src, dst)
+		raw.recursive = true
+		raw.idempotencyKey = key
+		cooked, err := raw.cook()
+		c.Assert(err, chk.IsNil)
+		return cooked
+	}
+
+	first := cook("run-42", "https://account.blob.core.windows.net/container/dir?se=2020-01-01&sig=a")
+	c.Assert(first.idempotencyKey, chk.Equals, "run-42")
+
+	// a retry may have a fresh SAS
+	retried := cook("run-42", "https://account.blob.core.windows.net/container/dir?se=2020-01-02&sig=b")
+	c.Assert(retried.jobID, chk.Equals, first.jobID)
+
+	c.Assert(cook("run-43", "https://account.blob.core.windows.net/container/dir?sig=a").jobID, chk.Not(chk.Equals), first.jobID)
+	c.Assert(cook("run-42", "https://account.blob.core.windows.net/container/other?sig=a").jobID, chk.Not(chk.Equals), first.jobID)
+
+	// without a key, every job is new
+	c.Assert(cook("", "https://account.blob.core.windows.net/container/dir?sig=a").jobID, chk.Not(chk.Equals), cook("", "https://account.blob.core.windows.net/container/dir?sig=a").jobID)
+}
+
+func (s *idempotencyKeySuite) TestBlankKeyIsRejected(c *chk.C) {
+	raw := getDefaultCopyRawInput(c.MkDir(), "https://account.blob.core.windows.net/container/dir?sig=a")
+	raw.recursive = true
+	raw.idempotencyKey = "  "
+	_, err := raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *idempotencyKeySuite) TestFiltersAndOptionsArePartOfTheKey(c *chk.C) {
+	src := c.MkDir()
+	dst := "https://account.blob.core.windows.net/container/dir?sig=a"
+	cook := func(change func(raw *rawCopyCmdArgs)) common.JobID {
+		raw := getDefaultCopyRawInput(src, dst)
+		raw.recursive = true
+		raw.idempotencyKey = "run-42"
+		change(&raw)
+		cooked, err := raw.cook()
+		c.Assert(err, chk.IsNil)
+		return cooked.jobID
+	}
+
+	first := cook(func(raw *rawCopyCmdArgs) {})
+	c.Assert(cook(func(raw *rawCopyCmdArgs) { raw.include = "*.txt" }), chk.Not(chk.Equals), first)
+	c.Assert(cook(func(raw *rawCopyCmdArgs) { raw.forceWrite = "false" }), chk.Not(chk.Equals), first)
+	c.Assert(cook(func(raw *rawCopyCmdArgs) { raw.recursive = false }), chk.Not(chk.Equals), first)
+
+	// how fast it runs is not part of it
+	c.Assert(cook(func(raw *rawCopyCmdArgs) { raw.blockSizeMB = 16 }), chk.Equals, first)
+}
@@ -0,0 +1,57 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type ifNoneMatchSuite struct{}
+
+var _ = chk.Suite(&ifNoneMatchSuite{})
+
+func (s *ifNoneMatchSuite) TestCookIfNoneMatch(c *chk.C) {
+	writeOnce, err := cookIfNoneMatch("", common.EFromTo.LocalFile(), common.EOverwriteOption.Prompt(), false)
+	c.Assert(err, chk.IsNil)
+	c.Assert(writeOnce, chk.Equals, false)
+
+	writeOnce, err = cookIfNoneMatch("*", common.EFromTo.LocalBlob(), common.EOverwriteOption.True(), false)
+	c.Assert(err, chk.IsNil)
+	c.Assert(writeOnce, chk.Equals, true)
+
+	writeOnce, err = cookIfNoneMatch("*", common.EFromTo.BlobBlob(), common.EOverwriteOption.False(), false)
+	c.Assert(err, chk.IsNil)
+	c.Assert(writeOnce, chk.Equals, true)
+
+	// ETags of individual blobs mean nothing job-wide
+	_, err = cookIfNoneMatch("0x8D7F6E0E5A4C1B2", common.EFromTo.LocalBlob(), common.EOverwriteOption.True(), false)
+	c.Assert(err, chk.ErrorMatches, "invalid if-none-match.*")
+
+	_, err = cookIfNoneMatch("*", common.EFromTo.LocalFile(), common.EOverwriteOption.True(), false)
+	c.Assert(err, chk.ErrorMatches, ".*only supported when the destination is Blob storage")
+
+	_, err = cookIfNoneMatch("*", common.EFromTo.LocalBlob(), common.EOverwriteOption.Prompt(), false)
+	c.Assert(err, chk.ErrorMatches, ".*cannot be used with overwrite=prompt")
+
+	_, err = cookIfNoneMatch("*", common.EFromTo.BlobBlob(), common.EOverwriteOption.True(), true)
+	c.Assert(err, chk.ErrorMatches, ".*cannot be used with properties-only")
+}
@@ -0,0 +1,142 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	chk "gopkg.in/check.v1"
+)
+
+type ignoreFileFilterSuite struct{}
+
+var _ = chk.Suite(&ignoreFileFilterSuite{})
+
+func (s *ignoreFileFilterSuite) newMatcher(c *chk.C, rules ...string) *ignoreMatcher {
+	matcher, err := newIgnoreMatcher(strings.NewReader(strings.Join(rules, "\n")))
+	c.Assert(err, chk.IsNil)
+	return matcher
+}
+
+func (s *ignoreFileFilterSuite) TestUnanchoredPatterns(c *chk.C) {
+	matcher := s.newMatcher(c, "# comment", "", "*.log", "build")
+
+	c.Assert(matcher.isIgnored("app.log"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("sub/dir/app.log"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("build"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("src/build/output.bin"), chk.Equals, true)
+
+	c.Assert(matcher.isIgnored("app.log.txt"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("builder/main.go"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("# comment"), chk.Equals, false)
+}
+
+func (s *ignoreFileFilterSuite) TestAnchoredPatterns(c *chk.C) {
+	matcher := s.newMatcher(c, "/todo.txt", "docs/*.pdf", "data/**/raw", "**/cache/*.bin")
+
+	c.Assert(matcher.isIgnored("todo.txt"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("sub/todo.txt"), chk.Equals, false)
+
+	c.Assert(matcher.isIgnored("docs/manual.pdf"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("docs/old/manual.pdf"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("other/docs/manual.pdf"), chk.Equals, false)
+
+	c.Assert(matcher.isIgnored("data/raw"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("data/2020/01/raw"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("data/2020/01/raw/file.csv"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("data/processed"), chk.Equals, false)
+
+	c.Assert(matcher.isIgnored("cache/a.bin"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("x/y/cache/a.bin"), chk.Equals, true)
+}
+
+func (s *ignoreFileFilterSuite) TestDirectoryRules(c *chk.C) {
+	matcher := s.newMatcher(c, "node_modules/", "logs/")
+
+	// a directory rule matches everything inside the directory, but not a file of the same name
+	c.Assert(matcher.isIgnored("node_modules/lib/index.js"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("web/node_modules/index.js"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("logs"), chk.Equals, false)
+}
+
+func (s *ignoreFileFilterSuite) TestNegation(c *chk.C) {
+	matcher := s.newMatcher(c, "*.log", "!important.log", "tmp/", "!tmp/keep.txt", "\\!literal")
+
+	// the last matching rule wins
+	c.Assert(matcher.isIgnored("debug.log"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("important.log"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("sub/important.log"), chk.Equals, false)
+
+	// files inside an excluded directory cannot be re-included
+	c.Assert(matcher.isIgnored("tmp/keep.txt"), chk.Equals, true)
+
+	// an escaped ! is literal
+	c.Assert(matcher.isIgnored("!literal"), chk.Equals, true)
+}
+
+func (s *ignoreFileFilterSuite) TestWildcards(c *chk.C) {
+	matcher := s.newMatcher(c, "file?.txt", "img[0-9].png", "doc[!a].md", "trailing\\ ")
+
+	c.Assert(matcher.isIgnored("file1.txt"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("file10.txt"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("img7.png"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("imgx.png"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("docb.md"), chk.Equals, true)
+	c.Assert(matcher.isIgnored("doca.md"), chk.Equals, false)
+	c.Assert(matcher.isIgnored("trailing "), chk.Equals, true)
+}
+
+func (s *ignoreFileFilterSuite) TestLoadFromSourceDirectory(c *chk.C) {
+	sourceDir, err := ioutil.TempDir("", "ignorefile")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(sourceDir)
+
+	err = ioutil.WriteFile(filepath.Join(sourceDir, defaultIgnoreFileName), []byte("*.bak\n"), 0644)
+	c.Assert(err, chk.IsNil)
+
+	// the relative path is not found in the working directory, so it is looked for in the source
+	matcher, err := loadIgnoreMatcher(defaultIgnoreFileName, sourceDir)
+	c.Assert(err, chk.IsNil)
+
+	filter := &ignoreFileFilter{matcher: matcher}
+	c.Assert(filter.doesPass(storedObject{name: "a.bak", relativePath: "dir/a.bak"}), chk.Equals, false)
+	c.Assert(filter.doesPass(storedObject{name: "a.txt", relativePath: "dir/a.txt"}), chk.Equals, true)
+
+	_, err = loadIgnoreMatcher("does-not-exist", sourceDir)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *ignoreFileFilterSuite) TestExcludeHiddenFilter(c *chk.C) {
+	filter := &excludeHiddenFilter{}
+
+	pathsToPass := []string{"report.pdf", "dir/photo.jpg", "a.b/c.txt"}
+	for _, relativePath := range pathsToPass {
+		c.Assert(filter.doesPass(storedObject{relativePath: relativePath}), chk.Equals, true)
+	}
+
+	pathsToNotPass := []string{".bashrc", ".git/config", "dir/.DS_Store", "Thumbs.db", "docs/~$report.docx", "notes.txt~", "dir/data.TMP", ".vim.swp"}
+	for _, relativePath := range pathsToNotPass {
+		c.Assert(filter.doesPass(storedObject{relativePath: relativePath}), chk.Equals, false)
+	}
+}
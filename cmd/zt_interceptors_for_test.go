@@ -123,6 +123,7 @@ func (*mockedLifecycleManager) GetEnvironmentVariable(env common.EnvironmentVari
 	return value
 }
 func (*mockedLifecycleManager) SetOutputFormat(common.OutputFormat) {}
+func (*mockedLifecycleManager) SetOutputInterval(time.Duration)     {}
 func (*mockedLifecycleManager) EnableInputWatcher()                 {}
 func (*mockedLifecycleManager) EnableCancelFromStdIn()              {}
 
@@ -0,0 +1,100 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type jobChainSuite struct{}
+
+var _ = chk.Suite(&jobChainSuite{})
+
+// mockJobStatuses makes the job that is waited for go through the given statuses, one per check
+func mockJobStatuses(statuses ...common.JobStatus) (checks *int, restore func()) {
+	checks = new(int)
+	originalRpc, originalInterval := Rpc, afterJobPollInterval
+	Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+		status := statuses[len(statuses)-1]
+		if *checks < len(statuses) {
+			status = statuses[*checks]
+		}
+		*checks++
+		*(response.(*common.GetJobStatusResponse)) = common.GetJobStatusResponse{JobStatus: status}
+	}
+	afterJobPollInterval = time.Millisecond
+	return checks, func() { Rpc, afterJobPollInterval = originalRpc, originalInterval }
+}
+
+func (s *jobChainSuite) TestWaitForJobUntilItCompletes(c *chk.C) {
+	checks, restore := mockJobStatuses(common.EJobStatus.InProgress(), common.EJobStatus.Paused(), common.EJobStatus.InProgress(),
+		common.EJobStatus.CompletedWithSkipped())
+	defer restore()
+
+	c.Assert(waitForJob(common.NewJobID()), chk.IsNil)
+	c.Assert(*checks, chk.Equals, 4)
+}
+
+func (s *jobChainSuite) TestWaitForJobThatFails(c *chk.C) {
+	for _, status := range []common.JobStatus{common.EJobStatus.CompletedWithErrors(), common.EJobStatus.Failed(), common.EJobStatus.Cancelled()} {
+		checks, restore := mockJobStatuses(common.EJobStatus.Cancelling(), status)
+
+		err := waitForJob(common.NewJobID())
+		restore()
+		c.Assert(err, chk.ErrorMatches, ".*ended with status "+status.String()+".*")
+		c.Assert(*checks, chk.Equals, 2)
+	}
+}
+
+func (s *jobChainSuite) TestNoWaitWithoutAfterJob(c *chk.C) {
+	checks, restore := mockJobStatuses(common.EJobStatus.InProgress())
+	defer restore()
+
+	afterJobID, err := cookAfterJobID("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(waitForJob(afterJobID), chk.IsNil)
+	c.Assert(*checks, chk.Equals, 0)
+
+	_, err = cookAfterJobID("not-a-job")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *jobChainSuite) TestWaitForMissingJob(c *chk.C) {
+	originalRpc := Rpc
+	defer func() { Rpc = originalRpc }()
+	Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+		*(response.(*common.GetJobStatusResponse)) = common.GetJobStatusResponse{ErrorMsg: "no job with JobID exists"}
+	}
+
+	c.Assert(waitForJob(common.NewJobID()), chk.ErrorMatches, "cannot wait for job .*: no job with JobID exists")
+}
+
+func (s *jobChainSuite) TestDescribeAfterJob(c *chk.C) {
+	first, second := common.NewJobID(), common.NewJobID()
+	jobs := []common.JobIDDetails{{JobId: first, JobStatus: common.EJobStatus.Completed()}}
+
+	c.Assert(describeAfterJob(first, jobs), chk.Equals, first.String()+" (Completed)")
+	c.Assert(describeAfterJob(second, jobs), chk.Equals, second.String())
+}
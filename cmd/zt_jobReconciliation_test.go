@@ -0,0 +1,136 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type jobReconciliationSuite struct{}
+
+var _ = chk.Suite(&jobReconciliationSuite{})
+
+func (s *jobReconciliationSuite) TestParseExpectedTotals(c *chk.C) {
+	e, err := newExpectedTotals("", "")
+	c.Assert(err, chk.IsNil)
+	c.Assert(e.isSet(), chk.Equals, false)
+
+	e, err = newExpectedTotals("10", "0")
+	c.Assert(err, chk.IsNil)
+	c.Assert(e, chk.Equals, expectedTotals{files: 10, bytes: 0})
+
+	for _, bad := range [][2]string{{"-1", ""}, {"ten", ""}, {"", "1G"}, {"", "-5"}} {
+		_, err = newExpectedTotals(bad[0], bad[1])
+		c.Assert(err, chk.NotNil)
+	}
+
+	// sub-jobs have their own totals
+	c.Assert(expectedTotals{files: 10, bytes: -1}.validate(1024), chk.NotNil)
+	c.Assert(expectedTotals{files: -1, bytes: -1}.validate(1024), chk.IsNil)
+}
+
+func (s *jobReconciliationSuite) TestReconcile(c *chk.C) {
+	summary := common.ListJobSummaryResponse{TotalTransfers: 10, TransfersCompleted: 10, TotalBytesEnumerated: 1000}
+
+	mismatches, report := expectedTotals{files: -1, bytes: -1}.reconcile(summary)
+	c.Assert(mismatches, chk.HasLen, 0)
+	c.Assert(report, chk.Equals, "")
+
+	mismatches, report = expectedTotals{files: 10, bytes: 1000}.reconcile(summary)
+	c.Assert(mismatches, chk.HasLen, 0)
+	c.Assert(strings.HasSuffix(report, "Result: totals match"), chk.Equals, true)
+
+	// fewer files found than expected
+	mismatches, _ = expectedTotals{files: 12, bytes: -1}.reconcile(summary)
+	c.Assert(mismatches, chk.DeepEquals, []string{
+		"expected 12 files, but found 10 at the source",
+		"expected 12 files, but 10 were transferred"})
+
+	// all found, but one failed, and two were skipped, one of them because it was infected
+	summary.TransfersCompleted = 7
+	summary.TransfersFailed = 1
+	summary.TransfersSkipped = 2
+	summary.TransfersSkippedInfected = 1
+	mismatches, report = expectedTotals{files: 10, bytes: 1000}.reconcile(summary)
+	c.Assert(mismatches, chk.DeepEquals, []string{
+		"expected 10 files, but 7 were transferred",
+		"2 files were skipped, so they are not reconciled"})
+	c.Assert(strings.Contains(report, "Files: expected 10, found at source 10, transferred 7, skipped 2 (infected 1), failed 1"), chk.Equals, true)
+
+	mismatches, _ = expectedTotals{files: -1, bytes: 999}.reconcile(summary)
+	c.Assert(mismatches, chk.DeepEquals, []string{"expected 999 bytes, but found 1000 at the source"})
+}
+
+func (s *jobReconciliationSuite) TestCookExpectedTotals(c *chk.C) {
+	raw := getDefaultCopyRawInput("/local/dir", "https://account.blob.core.windows.net/container/dir")
+	raw.recursive = true
+	raw.expectFiles = "100"
+	raw.expectBytes = "2048"
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.expectedTotals, chk.Equals, expectedTotals{files: 100, bytes: 2048})
+
+	raw.autoPartitionSize = "1G"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *jobReconciliationSuite) TestTotalsOfADryRunAreExpectedByTheRealRun(c *chk.C) {
+	dir := c.MkDir()
+	totalsFile := filepath.Join(dir, "totals.json")
+
+	// the dry run saves what it found
+	raw := getDefaultCopyRawInput("/local/dir", "https://account.blob.core.windows.net/container/dir")
+	raw.recursive = true
+	raw.dryRun = true
+	raw.expectedTotalsFile = totalsFile
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.expectedTotals.isSet(), chk.Equals, false)
+	c.Assert(cooked.expectedTotalsFile, chk.Equals, totalsFile)
+
+	recorder := newDryRunRecorder("copy", cooked.fromTo, common.EOutputFormat.Text())
+	recorder.totalsFile = cooked.expectedTotalsFile
+	c.Assert(recorder.record("/local/dir/a", "https://account.blob.core.windows.net/container/dir/a", 100), chk.IsNil)
+	c.Assert(recorder.record("/local/dir/b", "https://account.blob.core.windows.net/container/dir/b", 23), chk.IsNil)
+	c.Assert(saveExpectedTotals(recorder.totalsFile, recorder.TotalTransfers, recorder.TotalBytes), chk.IsNil)
+
+	// and the real run expects it
+	raw.dryRun = false
+	cooked, err = raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.expectedTotals, chk.Equals, expectedTotals{files: 2, bytes: 123})
+
+	raw.expectFiles = "2"
+	_, err = raw.cook()
+	c.Assert(err, chk.ErrorMatches, "expected-totals-file cannot be combined with expect-files or expect-bytes")
+
+	raw.expectFiles = ""
+	c.Assert(ioutil.WriteFile(totalsFile, []byte("2 files"), 0644), chk.IsNil)
+	_, err = raw.cook()
+	c.Assert(err, chk.ErrorMatches, "invalid expected-totals-file .*")
+}
@@ -0,0 +1,122 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type jobStoreCleanupSuite struct{}
+
+var _ = chk.Suite(&jobStoreCleanupSuite{})
+
+func (s *jobStoreCleanupSuite) TestParseAge(c *chk.C) {
+	age, err := parseAge("30d")
+	c.Assert(err, chk.IsNil)
+	c.Assert(age, chk.Equals, 30*24*time.Hour)
+
+	age, err = parseAge("12h")
+	c.Assert(err, chk.IsNil)
+	c.Assert(age, chk.Equals, 12*time.Hour)
+
+	age, err = parseAge("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(age, chk.Equals, time.Duration(0))
+
+	for _, invalid := range []string{"d", "abc", "-1d", "0h"} {
+		_, err = parseAge(invalid)
+		c.Assert(err, chk.NotNil)
+	}
+}
+
+func (s *jobStoreCleanupSuite) TestSelectJobsToCleanup(c *chk.C) {
+	now := time.Now()
+	oldJob, middleJob, recentJob := common.NewJobID(), common.NewJobID(), common.NewJobID()
+	jobs := map[common.JobID]*jobFiles{
+		oldJob:    {size: 100, lastModified: now.Add(-40 * 24 * time.Hour)},
+		middleJob: {size: 100, lastModified: now.Add(-10 * 24 * time.Hour)},
+		recentJob: {size: 100, lastModified: now.Add(-time.Minute)},
+	}
+
+	all := func(*jobFiles) bool { return true }
+
+	// retention only
+	c.Assert(selectJobsToCleanup(jobs, now, 30*24*time.Hour, 0, all), chk.DeepEquals, []common.JobID{oldJob})
+
+	// size only: the least recently active jobs are removed first
+	c.Assert(selectJobsToCleanup(jobs, now, 0, 200, all), chk.DeepEquals, []common.JobID{oldJob})
+	c.Assert(selectJobsToCleanup(jobs, now, 0, 100, all), chk.DeepEquals, []common.JobID{oldJob, middleJob})
+
+	// a job that is possibly still running is never removed by the size limit
+	c.Assert(selectJobsToCleanup(jobs, now, 0, 1, all), chk.DeepEquals, []common.JobID{oldJob, middleJob})
+
+	// nor is one that can't be removed, e.g. since it could still be resumed
+	c.Assert(selectJobsToCleanup(jobs, now, 0, 100, func(job *jobFiles) bool { return job != jobs[oldJob] }), chk.DeepEquals, []common.JobID{middleJob})
+
+	// no policy
+	c.Assert(selectJobsToCleanup(jobs, now, 0, 0, all), chk.HasLen, 0)
+}
+
+func (s *jobStoreCleanupSuite) TestCollectJobFiles(c *chk.C) {
+	tempDir, err := ioutil.TempDir("", "jobstore")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(tempDir)
+
+	jobID := common.NewJobID()
+	files := map[string]int{
+		jobID.String() + "--00000.steV15": 10,
+		jobID.String() + "--00001.steV15": 20,
+		jobID.String() + ".log":           5,
+		jobID.String() + "-chunks.log":    5,
+		"azcopy.cfg":                      100,
+		"not-a-job.log":                   100,
+	}
+	for name, size := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(tempDir, name), make([]byte, size), 0644), chk.IsNil)
+	}
+
+	jobs, err := collectJobFiles(tempDir, tempDir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(jobs, chk.HasLen, 1)
+	c.Assert(jobs[jobID].paths, chk.HasLen, 4)
+	c.Assert(jobs[jobID].size, chk.Equals, int64(40))
+	c.Assert(jobs[jobID].part0Plan, chk.Equals, filepath.Join(tempDir, jobID.String()+"--00000.steV15"))
+}
+
+func (s *jobStoreCleanupSuite) TestOnlyJobsThatCannotBeResumedAreCleanedUp(c *chk.C) {
+	tempDir, err := ioutil.TempDir("", "jobstore")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(tempDir)
+
+	// the logs of a job whose plan files have gone
+	c.Assert(jobCanBeCleanedUp(&jobFiles{}), chk.Equals, true)
+
+	// a job whose status can't be read is kept
+	part0 := filepath.Join(tempDir, common.NewJobID().String()+"--00000.steV11")
+	c.Assert(ioutil.WriteFile(part0, make([]byte, 10), 0644), chk.IsNil)
+	c.Assert(jobCanBeCleanedUp(&jobFiles{part0Plan: part0}), chk.Equals, false)
+}
@@ -0,0 +1,73 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type jobsJournalSuite struct{}
+
+var _ = chk.Suite(&jobsJournalSuite{})
+
+func (s *jobsJournalSuite) TestReadAndExportJournal(c *chk.C) {
+	dir, err := ioutil.TempDir("", "journal")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	jobID := common.NewJobID()
+	journalPath := common.TransferJournalFilePath(dir, jobID)
+
+	// a job run without --journal has none
+	_, err = readTransferJournal(journalPath)
+	c.Assert(err, chk.NotNil)
+
+	lines := `{"time":"2020-06-01T10:00:00Z","jobId":"` + jobID.String() + `","partNumber":0,"transferIndex":0,"source":"/data/a.txt","destination":"https://account.blob.core.windows.net/c/a.txt","event":"Scheduled","status":"Started"}
+{"time":"2020-06-01T10:00:01Z","jobId":"` + jobID.String() + `","partNumber":0,"transferIndex":0,"source":"/data/a.txt","destination":"https://account.blob.core.windows.net/c/a.txt","event":"Verified","status":"Started","detail":"Length","requestId":"1234"}
+`
+	c.Assert(ioutil.WriteFile(journalPath, []byte(lines), 0644), chk.IsNil)
+
+	entries, err := readTransferJournal(journalPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(entries, chk.HasLen, 2)
+	c.Assert(entries[1].JobID, chk.Equals, jobID)
+	c.Assert(entries[1].Event, chk.Equals, common.TransferJournalVerified)
+	c.Assert(entries[1].Detail, chk.Equals, "Length")
+	c.Assert(strings.Contains(formatTransferJournal(entries), "X-Ms-Request-Id:1234"), chk.Equals, true)
+
+	// the export is a JSON array that reads back to the same entries
+	exportPath := filepath.Join(dir, "journal.json")
+	c.Assert(exportTransferJournal(entries, exportPath), chk.IsNil)
+	exported, err := ioutil.ReadFile(exportPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.HasPrefix(string(exported), "["), chk.Equals, true)
+
+	// an entry that was cut short makes the journal unreliable, so it is reported
+	c.Assert(ioutil.WriteFile(journalPath, []byte(lines+`{"time":"2020-06-01T10:00:02Z","jobId`), 0644), chk.IsNil)
+	_, err = readTransferJournal(journalPath)
+	c.Assert(err, chk.ErrorMatches, "line 3 .*")
+}
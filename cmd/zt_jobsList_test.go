@@ -0,0 +1,102 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+	chk "gopkg.in/check.v1"
+)
+
+type jobsListSuite struct{}
+
+var _ = chk.Suite(&jobsListSuite{})
+
+func (s *jobsListSuite) TestJobsListFilters(c *chk.C) {
+	now := time.Now()
+	failedYesterday := common.JobIDDetails{
+		JobId:       common.NewJobID(),
+		StartTime:   now.Add(-24 * time.Hour).UnixNano(),
+		JobStatus:   common.EJobStatus.Failed(),
+		Source:      "/data/photos",
+		Destination: "https://account.blob.core.windows.net/backup",
+	}
+	completedLastMonth := common.JobIDDetails{
+		JobId:         common.NewJobID(),
+		StartTime:     now.Add(-30 * 24 * time.Hour).UnixNano(),
+		JobStatus:     common.EJobStatus.Completed(),
+		CommandString: "copy /data/videos https://account.blob.core.windows.net/archive",
+	}
+
+	matching := func(filters jobsListFilters) []common.JobID {
+		keep, err := filters.predicate(now)
+		c.Assert(err, chk.IsNil)
+		result := make([]common.JobID, 0)
+		for _, job := range []common.JobIDDetails{failedYesterday, completedLastMonth} {
+			if keep(job) {
+				result = append(result, job.JobId)
+			}
+		}
+		return result
+	}
+
+	c.Assert(matching(jobsListFilters{}), chk.HasLen, 2)
+	c.Assert(matching(jobsListFilters{state: "failed"}), chk.DeepEquals, []common.JobID{failedYesterday.JobId})
+	c.Assert(matching(jobsListFilters{since: "7d"}), chk.DeepEquals, []common.JobID{failedYesterday.JobId})
+	c.Assert(matching(jobsListFilters{search: "ARCHIVE"}), chk.DeepEquals, []common.JobID{completedLastMonth.JobId})
+	c.Assert(matching(jobsListFilters{search: "photos"}), chk.DeepEquals, []common.JobID{failedYesterday.JobId})
+	c.Assert(matching(jobsListFilters{state: "completed", since: "7d"}), chk.HasLen, 0)
+
+	// invalid filters are reported
+	_, err := jobsListFilters{state: "unknown"}.predicate(now)
+	c.Assert(err, chk.NotNil)
+	_, err = jobsListFilters{since: "a week"}.predicate(now)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *jobsListSuite) TestJobLabels(c *chk.C) {
+	labels, err := cookJobLabels([]string{"team=payments", "quarter = Q3"}, "Q3 archive migration")
+	c.Assert(err, chk.IsNil)
+	c.Assert(labels, chk.Equals, `{"quarter":"Q3","team":"payments"}`)
+
+	// labels must have a value when the job is created, but not when filtering
+	_, err = cookJobLabels([]string{"team"}, "")
+	c.Assert(err, chk.NotNil)
+	_, err = cookJobLabels([]string{"=payments"}, "")
+	c.Assert(err, chk.NotNil)
+	_, err = cookJobLabels(nil, strings.Repeat("a", ste.JobDescriptionMaxBytes+1))
+	c.Assert(err, chk.NotNil)
+
+	job := common.JobIDDetails{JobId: common.NewJobID(), Labels: map[string]string{"team": "payments", "quarter": "Q3"}}
+	for _, wanted := range [][]string{{"team=payments"}, {"team"}, {"team=payments", "quarter=Q3"}} {
+		keep, err := jobsListFilters{labels: wanted}.predicate(time.Now())
+		c.Assert(err, chk.IsNil)
+		c.Assert(keep(job), chk.Equals, true)
+	}
+	for _, wanted := range [][]string{{"team=billing"}, {"owner"}, {"team=payments", "quarter=Q4"}} {
+		keep, err := jobsListFilters{labels: wanted}.predicate(time.Now())
+		c.Assert(err, chk.IsNil)
+		c.Assert(keep(job), chk.Equals, false)
+	}
+}
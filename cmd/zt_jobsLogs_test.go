@@ -0,0 +1,149 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type jobsLogsSuite struct{}
+
+var _ = chk.Suite(&jobsLogsSuite{})
+
+func (s *jobsLogsSuite) writeGzip(c *chk.C, path string, content string) {
+	file, err := os.Create(path)
+	c.Assert(err, chk.IsNil)
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write([]byte(content))
+	c.Assert(err, chk.IsNil)
+	c.Assert(gz.Close(), chk.IsNil)
+}
+
+func (s *jobsLogsSuite) TestShowsRotatedAndCompressedFilesWithLevelFilter(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobsLogsSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	jobID := common.NewJobID()
+	s.writeGzip(c, filepath.Join(dir, jobID.String()+".1.log.gz"),
+		"2020/05/01 10:00:00 AzcopyVersion  10.4.3\n"+
+			"2020/05/01 10:00:01 ERR: [P#0-T#0] failed to copy\n"+
+			"   X-Ms-Request-Id: [123]\n")
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, jobID.String()+".log"), []byte(
+		"2020/05/01 10:00:02 ==> REQUEST/RESPONSE (Try=1)\n"+
+			"   Content-Length: [0]\r\n"+
+			"2020/05/01 10:00:03 WARN: [P#0-T#1] slow\n"+
+			"2020/05/01 10:00:04 Closing Log\n"), 0644), chk.IsNil)
+
+	var lines []string
+	output := func(line string) { lines = append(lines, line) }
+
+	filter, err := newLogLevelFilter("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(showJobLog(dir, jobID, filter, false, nil, output), chk.IsNil)
+	c.Assert(lines, chk.HasLen, 7)
+	c.Assert(lines[4], chk.Equals, "   Content-Length: [0]")
+
+	lines = nil
+	filter, err = newLogLevelFilter("WARNING")
+	c.Assert(err, chk.IsNil)
+	c.Assert(showJobLog(dir, jobID, filter, false, nil, output), chk.IsNil)
+	c.Assert(lines, chk.DeepEquals, []string{
+		"2020/05/01 10:00:01 ERR: [P#0-T#0] failed to copy",
+		"   X-Ms-Request-Id: [123]",
+		"2020/05/01 10:00:03 WARN: [P#0-T#1] slow"})
+
+	c.Assert(showJobLog(dir, common.NewJobID(), filter, false, nil, output), chk.NotNil)
+	_, err = newLogLevelFilter("loud")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *jobsLogsSuite) TestFiltersJSONLogs(c *chk.C) {
+	filter, err := newLogLevelFilter("error")
+	c.Assert(err, chk.IsNil)
+
+	c.Assert(filter.passes(`{"time":"2020-05-01T10:00:00Z","level":"INFO","jobId":"x","message":"Closing Log"}`), chk.Equals, false)
+	c.Assert(filter.passes(`{"time":"2020-05-01T10:00:00Z","level":"ERR","jobId":"x","partNum":0,"transferIndex":3,"message":"failed"}`), chk.Equals, true)
+
+	message, _, ok := parseLogEntry(`{"level":"INFO","message":"Closing Log"}`)
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(message, chk.Equals, "Closing Log")
+}
+
+func (s *jobsLogsSuite) TestFollowsLogThroughRotationUntilJobIsDone(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobsLogsSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	originalInterval := followLogPollInterval
+	followLogPollInterval = time.Millisecond
+	defer func() { followLogPollInterval = originalInterval }()
+
+	jobID := common.NewJobID()
+	logPath := filepath.Join(dir, jobID.String()+".log")
+	appendLine := func(path string, line string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		c.Assert(err, chk.IsNil)
+		_, err = f.WriteString(line)
+		c.Assert(err, chk.IsNil)
+		c.Assert(f.Close(), chk.IsNil)
+	}
+
+	lines := make(chan string, 10)
+	done := make(chan error, 1)
+	filter, _ := newLogLevelFilter("")
+	var jobDone int32
+	go func() {
+		done <- showJobLog(dir, jobID, filter, true, func() bool { return atomic.LoadInt32(&jobDone) == 1 }, func(line string) { lines <- line })
+	}()
+
+	// the log doesn't exist until the job starts
+	time.Sleep(10 * time.Millisecond)
+	appendLine(logPath, "2020/05/01 10:00:00 one\n2020/05/01 10:00:01 tw")
+	c.Assert(<-lines, chk.Equals, "2020/05/01 10:00:00 one")
+	appendLine(logPath, "o\n")
+	c.Assert(<-lines, chk.Equals, "2020/05/01 10:00:01 two")
+
+	// rotation
+	appendLine(logPath, "2020/05/01 10:00:02 three\n")
+	c.Assert(os.Rename(logPath, filepath.Join(dir, jobID.String()+".1.log")), chk.IsNil)
+	appendLine(logPath, "2020/05/01 10:00:03 four\n")
+
+	c.Assert(<-lines, chk.Equals, "2020/05/01 10:00:02 three")
+	c.Assert(<-lines, chk.Equals, "2020/05/01 10:00:03 four")
+
+	// a line that looks like the end of the log doesn't stop it, but the job being done does, once the last lines are shown
+	appendLine(logPath, "2020/05/01 10:00:04 Closing Log\n")
+	c.Assert(<-lines, chk.Equals, "2020/05/01 10:00:04 Closing Log")
+	appendLine(logPath, "2020/05/01 10:00:05 summary\n")
+	atomic.StoreInt32(&jobDone, 1)
+	c.Assert(<-done, chk.IsNil)
+	c.Assert(<-lines, chk.Equals, "2020/05/01 10:00:05 summary")
+}
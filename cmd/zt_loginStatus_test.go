@@ -0,0 +1,61 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type loginStatusSuite struct{}
+
+var _ = chk.Suite(&loginStatusSuite{})
+
+func (s *loginStatusSuite) TestGetTokenClaims(c *chk.C) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"tid":"tenant","oid":"object","exp":1600000000,"xms_mirid":"/subscriptions/s/id"}`))
+	claims := getTokenClaims("header."+payload+".signature", identifyingTokenClaims)
+
+	c.Assert(claims, chk.DeepEquals, map[string]string{"tid": "tenant", "oid": "object", "xms_mirid": "/subscriptions/s/id"})
+	c.Assert(getTokenClaims("not a jwt", identifyingTokenClaims), chk.IsNil)
+}
+
+func (s *loginStatusSuite) TestDescribeManagedIdentity(c *chk.C) {
+	c.Assert(describeManagedIdentity(common.IdentityInfo{}), chk.Equals, "system-assigned")
+	c.Assert(describeManagedIdentity(common.IdentityInfo{ClientID: "abc"}), chk.Equals, "user-assigned, client ID abc")
+}
+
+func (s *loginStatusSuite) TestLoginStatusString(c *chk.C) {
+	c.Assert(loginStatus{}.String(), chk.Equals, "You are not logged in. Run 'azcopy login' to log in.")
+
+	status := loginStatus{LoggedIn: true, LoginType: "managed identity", ManagedIdentity: "system-assigned"}
+	c.Assert(status.String(), chk.Equals, "Logged in as a managed identity\nIdentity: system-assigned")
+
+	// the Resource Manager is that of the cloud
+	expires := time.Now()
+	status = loginStatus{LoggedIn: true, LoginType: "user", Resource: common.Resource, ExpiresOn: &expires,
+		ARMResource: "https://management.chinacloudapi.cn/", ARMTokenError: "AADSTS500011"}
+	c.Assert(strings.HasSuffix(status.String(), "Azure Resource Manager token for https://management.chinacloudapi.cn/: cannot be acquired, AADSTS500011"), chk.Equals, true)
+}
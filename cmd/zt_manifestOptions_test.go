@@ -0,0 +1,64 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+)
+
+type manifestOptionsSuite struct{}
+
+var _ = chk.Suite(&manifestOptionsSuite{})
+
+func (s *manifestOptionsSuite) TestCookManifestOptions(c *chk.C) {
+	dir, err := ioutil.TempDir("", "manifestOptions")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key.pem")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("key"), 0600), chk.IsNil)
+
+	manifest, key, err := cookManifestOptions("", "")
+	c.Assert(err, chk.IsNil)
+	c.Assert(manifest, chk.Equals, "")
+	c.Assert(key, chk.Equals, "")
+
+	// relative paths are made absolute, since the manifest may be written by a later run of the job
+	manifest, key, err = cookManifestOptions("manifest.json", keyFile)
+	c.Assert(err, chk.IsNil)
+	c.Assert(filepath.IsAbs(manifest), chk.Equals, true)
+	c.Assert(filepath.Base(manifest), chk.Equals, "manifest.json")
+	c.Assert(key, chk.Equals, keyFile)
+
+	// Key Vault keys are kept as they are
+	_, key, err = cookManifestOptions("manifest.json", "https://myvault.vault.azure.net/keys/manifest")
+	c.Assert(err, chk.IsNil)
+	c.Assert(key, chk.Equals, "https://myvault.vault.azure.net/keys/manifest")
+
+	// a key without a manifest, or a key file that doesn't exist, are errors
+	_, _, err = cookManifestOptions("", keyFile)
+	c.Assert(err, chk.NotNil)
+	_, _, err = cookManifestOptions("manifest.json", filepath.Join(dir, "missing.pem"))
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,112 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	chk "gopkg.in/check.v1"
+)
+
+type parallelWalkSuite struct{}
+
+var _ = chk.Suite(&parallelWalkSuite{})
+
+func (s *parallelWalkSuite) TestParallelWalkFindsSameEntriesAsWalk(c *chk.C) {
+	dirPath := scenarioHelper{}.generateLocalDirectory(c)
+	defer os.RemoveAll(dirPath)
+	scenarioHelper{}.generateCommonRemoteScenarioForLocal(c, dirPath, "")
+
+	collect := func(walk func(filepath.WalkFunc) error) map[string]bool {
+		found := make(map[string]bool)
+		err := walk(func(path string, info os.FileInfo, err error) error {
+			c.Assert(err, chk.IsNil)
+			c.Assert(found[path], chk.Equals, false) // each entry is reported only once
+			found[path] = info.IsDir()
+			return nil
+		})
+		c.Assert(err, chk.IsNil)
+		return found
+	}
+
+	expected := collect(func(f filepath.WalkFunc) error { return filepath.Walk(dirPath, f) })
+	actual := collect(func(f filepath.WalkFunc) error { return parallelWalk(dirPath, 8, 0, f) })
+
+	c.Assert(len(expected) > 50, chk.Equals, true)
+	c.Assert(actual, chk.DeepEquals, expected)
+}
+
+func (s *parallelWalkSuite) TestParallelWalkStopsOnError(c *chk.C) {
+	dirPath := scenarioHelper{}.generateLocalDirectory(c)
+	defer os.RemoveAll(dirPath)
+	scenarioHelper{}.generateCommonRemoteScenarioForLocal(c, dirPath, "")
+
+	stop := errors.New("stop")
+	calls := 0
+	err := parallelWalk(dirPath, 8, 0, func(path string, info os.FileInfo, err error) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	})
+
+	c.Assert(err, chk.Equals, stop)
+	c.Assert(calls, chk.Equals, 3)
+}
+
+func (s *parallelWalkSuite) TestWalksStopAtMaxDepth(c *chk.C) {
+	dirPath := scenarioHelper{}.generateLocalDirectory(c)
+	defer os.RemoveAll(dirPath)
+	for _, dir := range []string{"a/b/c", "d"} {
+		c.Assert(os.MkdirAll(filepath.Join(dirPath, dir), 0755), chk.IsNil)
+	}
+	for _, file := range []string{"top.txt", "a/one.txt", "a/b/two.txt", "a/b/c/three.txt", "d/one.txt"} {
+		f, err := os.Create(filepath.Join(dirPath, file))
+		c.Assert(err, chk.IsNil)
+		f.Close()
+	}
+
+	expected := map[string]bool{"": true, "a": true, "d": true, "top.txt": true, "a/one.txt": true, "d/one.txt": true, "a/b": true}
+	for _, parallelism := range []int{1, 8} {
+		found := make(map[string]bool)
+		err := parallelWalk(dirPath, parallelism, 2, func(path string, info os.FileInfo, err error) error {
+			c.Assert(err, chk.IsNil)
+			rel, _ := filepath.Rel(dirPath, path)
+			found[strings.TrimPrefix(filepath.ToSlash(rel), ".")] = true
+			return nil
+		})
+		c.Assert(err, chk.IsNil)
+		c.Assert(found, chk.DeepEquals, expected)
+	}
+
+	// walkWithSymlinks only reports files
+	found := make(map[string]bool)
+	c.Assert(walkWithSymlinks(dirPath, 2, func(path string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(dirPath, path)
+		found[filepath.ToSlash(rel)] = true
+		return nil
+	}), chk.IsNil)
+	c.Assert(found, chk.DeepEquals, map[string]bool{"top.txt": true, "a/one.txt": true, "d/one.txt": true})
+}
@@ -38,7 +38,13 @@ func (s *parseSizeSuite) TestParseSize(c *chk.C) {
 	b, _ = parseSizeString("789G", "x")
 	c.Assert(b, chk.Equals, int64(789*1024*1024*1024))
 
-	expectedError := "foo-bar must be a number immediately followed by K, M or G. E.g. 12k or 200G"
+	b, _ = parseSizeString("123KB", "x")
+	c.Assert(b, chk.Equals, int64(123*1024))
+
+	b, _ = parseSizeString("1TB", "x")
+	c.Assert(b, chk.Equals, int64(1024*1024*1024*1024))
+
+	expectedError := "foo-bar must be a number immediately followed by K, M, G or T (optionally followed by B). E.g. 12k, 200G or 1TB"
 
 	_, err := parseSizeString("123", "foo-bar")
 	c.Assert(err.Error(), chk.Equals, expectedError)
@@ -46,10 +52,10 @@ func (s *parseSizeSuite) TestParseSize(c *chk.C) {
 	_, err = parseSizeString("123 K", "foo-bar")
 	c.Assert(err.Error(), chk.Equals, expectedError)
 
-	_, err = parseSizeString("123KB", "foo-bar")
+	_, err = parseSizeString("123P", "foo-bar") // we don't support petabytes
 	c.Assert(err.Error(), chk.Equals, expectedError)
 
-	_, err = parseSizeString("123T", "foo-bar") // we don't support terabytes
+	_, err = parseSizeString("123B", "foo-bar")
 	c.Assert(err.Error(), chk.Equals, expectedError)
 
 	_, err = parseSizeString("abcK", "foo-bar")
@@ -0,0 +1,73 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type partitionLayoutSuite struct{}
+
+var _ = chk.Suite(&partitionLayoutSuite{})
+
+func (s *partitionLayoutSuite) TestCookPartitionTemplate(c *chk.C) {
+	// the placeholders are filled in with the time in UTC
+	start := time.Date(2020, 6, 9, 23, 5, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+
+	prefix, err := cookPartitionTemplate("", start)
+	c.Assert(err, chk.IsNil)
+	c.Assert(prefix, chk.Equals, "")
+
+	prefix, err = cookPartitionTemplate("/year={yyyy}/month={MM}/day={dd}/", start)
+	c.Assert(err, chk.IsNil)
+	c.Assert(prefix, chk.Equals, "year=2020/month=06/day=10")
+
+	prefix, err = cookPartitionTemplate("source=crm/ingested={yyyy}-{MM}-{dd}T{HH}{mm}", start)
+	c.Assert(err, chk.IsNil)
+	c.Assert(prefix, chk.Equals, "source=crm/ingested=2020-06-10T0105")
+
+	for _, bad := range []string{"{yyyy}", "year=", "=2020", "year={yyyy}//day={dd}", "_year={yyyy}", ".year={yyyy}", "{yyyy}=x", "week={ww}"} {
+		_, err = cookPartitionTemplate(bad, start)
+		c.Assert(err, chk.NotNil, chk.Commentf(bad))
+	}
+}
+
+func (s *partitionLayoutSuite) TestValidateAnalyticsLayout(c *chk.C) {
+	c.Assert(validateAnalyticsLayout("", false, common.EFromTo.LocalFile(), 0), chk.IsNil)
+	c.Assert(validateAnalyticsLayout("year=2020", true, common.EFromTo.LocalBlobFS(), 0), chk.IsNil)
+	c.Assert(validateAnalyticsLayout("", true, common.EFromTo.BlobLocal(), 0), chk.IsNil)
+
+	c.Assert(validateAnalyticsLayout("year=2020", false, common.EFromTo.LocalFile(), 0), chk.NotNil)
+	// each sub-job would create the marker when it completes
+	c.Assert(validateAnalyticsLayout("", true, common.EFromTo.LocalBlob(), 1024), chk.NotNil)
+	c.Assert(validateAnalyticsLayout("year=2020", false, common.EFromTo.LocalBlob(), 1024), chk.IsNil)
+}
+
+func (s *partitionLayoutSuite) TestEscapedLayoutPath(c *chk.C) {
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.LocalBlobFS()}
+	c.Assert(cca.escapedLayoutPath("region=north america/_SUCCESS"), chk.Equals, "/region=north%20america/_SUCCESS")
+
+	cca = &cookedCopyCmdArgs{fromTo: common.EFromTo.BlobLocal()}
+	c.Assert(cca.escapedLayoutPath("region=north america/_SUCCESS"), chk.Equals, "/region=north america/_SUCCESS")
+}
@@ -0,0 +1,45 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	chk "gopkg.in/check.v1"
+)
+
+type preservePermissionsSuite struct{}
+
+var _ = chk.Suite(&preservePermissionsSuite{})
+
+func (s *preservePermissionsSuite) TestCookPreservePermissions(c *chk.C) {
+	raw := getDefaultCopyRawInput("https://src.blob.core.windows.net/container/dir?sig=a", "https://dst.blob.core.windows.net/container/dir?sig=b")
+	raw.recursive = true
+	raw.preservePermissions = true
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.preservePermissions, chk.Equals, true)
+
+	// only accounts with hierarchical namespaces have permissions to preserve
+	raw = getDefaultCopyRawInput(c.MkDir(), "https://dst.blob.core.windows.net/container/dir?sig=b")
+	raw.recursive = true
+	raw.preservePermissions = true
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,113 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+type prefixQuarantineSuite struct{}
+
+var _ = chk.Suite(&prefixQuarantineSuite{})
+
+func (s *prefixQuarantineSuite) TestListingFailureWithoutQuarantine(c *chk.C) {
+	listErr := errors.New("cannot list")
+	c.Assert(handleListingFailure(context.Background(), "container/prefix/", listErr), chk.Equals, listErr)
+}
+
+func (s *prefixQuarantineSuite) TestListingFailureIsQuarantined(c *chk.C) {
+	q := newPrefixQuarantine()
+	ctx := withPrefixQuarantine(context.Background(), q)
+	c.Assert(q.report(), chk.Equals, "")
+
+	c.Assert(handleListingFailure(ctx, "container/a/", errors.New("timeout")), chk.IsNil)
+	recordListingSuccess(ctx)
+	c.Assert(handleListingFailure(ctx, "container/b/", errors.New("500")), chk.IsNil)
+
+	c.Assert(q.report(), chk.Equals, "2 prefix(es) could not be fully listed, so some or all of the files under them were not transferred:\n"+
+		"  container/a/: timeout\n"+
+		"  container/b/: 500\n")
+}
+
+func (s *prefixQuarantineSuite) TestCircuitBreakerStopsEnumeration(c *chk.C) {
+	ctx := withPrefixQuarantine(context.Background(), newPrefixQuarantine())
+
+	for i := 1; i < maxConsecutiveQuarantinedPrefixes; i++ {
+		c.Assert(handleListingFailure(ctx, "container/prefix/", errors.New("503")), chk.IsNil)
+	}
+	c.Assert(handleListingFailure(ctx, "container/prefix/", errors.New("503")), chk.NotNil)
+}
+
+func (s *prefixQuarantineSuite) TestListingRetryOptions(c *chk.C) {
+	envs := []common.EnvironmentVariable{common.EEnvironmentVariable.ListMaxTries(),
+		common.EEnvironmentVariable.ListTryTimeout(), common.EEnvironmentVariable.ListMaxRetryDelay()}
+	defer func() {
+		for _, env := range envs {
+			os.Unsetenv(env.Name)
+		}
+	}()
+
+	options, err := getListingRetryOptions()
+	c.Assert(err, chk.IsNil)
+	c.Assert(options.MaxTries, chk.Equals, int32(ste.UploadMaxTries))
+	c.Assert(options.TryTimeout, chk.Equals, ste.UploadTryTimeout)
+
+	os.Setenv(envs[0].Name, "5")
+	os.Setenv(envs[1].Name, "30s")
+	os.Setenv(envs[2].Name, "500ms")
+	options, err = getListingRetryOptions()
+	c.Assert(err, chk.IsNil)
+	c.Assert(options.MaxTries, chk.Equals, int32(5))
+	c.Assert(options.TryTimeout, chk.Equals, 30*time.Second)
+	c.Assert(options.MaxRetryDelay, chk.Equals, 500*time.Millisecond)
+	c.Assert(options.RetryDelay, chk.Equals, 500*time.Millisecond) // never more than the max
+
+	// the other front end requests keep the usual retries
+	c.Assert(frontEndRetryOptions().MaxTries, chk.Equals, int32(ste.UploadMaxTries))
+	c.Assert(frontEndRetryOptions().TryTimeout, chk.Equals, ste.UploadTryTimeout)
+
+	os.Setenv(envs[1].Name, "soon")
+	_, err = getListingRetryOptions()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *prefixQuarantineSuite) TestListingCarriesOnAfterTheLastListedBlob(c *chk.C) {
+	c.Assert(isQuarantiningPrefixes(context.Background()), chk.Equals, false)
+	c.Assert(isQuarantiningPrefixes(withPrefixQuarantine(context.Background(), newPrefixQuarantine())), chk.Equals, true)
+
+	// nothing was listed before the flat listing failed
+	c.Assert(isVirtualDirListedUpTo("a/", ""), chk.Equals, false)
+
+	// the flat listing got as far as a/b/c.txt
+	c.Assert(isVirtualDirListedUpTo("a/", "a/b/c.txt"), chk.Equals, false)
+	c.Assert(isVirtualDirListedUpTo("a/b/", "a/b/c.txt"), chk.Equals, false)
+	c.Assert(isVirtualDirListedUpTo("a/a/", "a/b/c.txt"), chk.Equals, true)
+	c.Assert(isVirtualDirListedUpTo("a/c/", "a/b/c.txt"), chk.Equals, false)
+	c.Assert(isVirtualDirListedUpTo("0/", "a/b/c.txt"), chk.Equals, true)
+}
@@ -0,0 +1,156 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type queueCommandsTestSuite struct{}
+
+var _ = chk.Suite(&queueCommandsTestSuite{})
+
+// fakeQueueService holds messages in memory. Received messages stay in the queue until they are deleted,
+// but aren't received again
+type fakeQueueService struct {
+	mu       sync.Mutex
+	messages []string
+	received int
+	deleted  int
+	ttls     []string
+
+	// the current pop receipt of each received message, which changes each time it's hidden again
+	popReceipts map[string]string
+	hides       []string // the visibility timeout of each
+}
+
+func (f *fakeQueueService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/account/q/messages":
+		var count int
+		fmt.Sscan(r.URL.Query().Get("numofmessages"), &count)
+		body := "<QueueMessagesList>"
+		if f.popReceipts == nil {
+			f.popReceipts = make(map[string]string)
+		}
+		for ; count > 0 && f.received < len(f.messages); count-- {
+			f.popReceipts[fmt.Sprintf("id%d", f.received)] = fmt.Sprintf("pop%d", f.received)
+			body += fmt.Sprintf("<QueueMessage><MessageId>id%d</MessageId><InsertionTime>Mon, 01 Jan 2020 00:00:00 GMT</InsertionTime>"+
+				"<PopReceipt>pop%d</PopReceipt><DequeueCount>1</DequeueCount><MessageText>%s</MessageText></QueueMessage>",
+				f.received, f.received, f.messages[f.received])
+			f.received++
+		}
+		fmt.Fprint(w, body+"</QueueMessagesList>")
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/account/q/messages/id"):
+		if f.popReceipts[strings.TrimPrefix(r.URL.Path, "/account/q/messages/")] != r.URL.Query().Get("popreceipt") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.deleted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/account/q/messages/id"):
+		id := strings.TrimPrefix(r.URL.Path, "/account/q/messages/")
+		if f.popReceipts[id] != r.URL.Query().Get("popreceipt") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.hides = append(f.hides, r.URL.Query().Get("visibilitytimeout"))
+		f.popReceipts[id] = fmt.Sprintf("%s-%d", f.popReceipts[id], len(f.hides))
+		w.Header().Set("x-ms-popreceipt", f.popReceipts[id])
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && r.URL.Path == "/account/q/messages":
+		var m struct {
+			MessageText string `xml:"MessageText"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if xml.Unmarshal(body, &m) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.messages = append(f.messages, m.MessageText)
+		f.ttls = append(f.ttls, r.URL.Query().Get("messagettl"))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *queueCommandsTestSuite) TestDrainAndLoad(c *chk.C) {
+	source := &fakeQueueService{}
+	for i := 0; i < 40; i++ {
+		source.messages = append(source.messages, fmt.Sprintf("message %d &amp; more", i))
+	}
+	sourceServer := httptest.NewServer(source)
+	defer sourceServer.Close()
+	dir, err := ioutil.TempDir("", "queueCommands")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "messages.ndjson")
+
+	queue, err := newStorageQueue(sourceServer.URL + "/account/q?sig=secret")
+	c.Assert(err, chk.IsNil)
+
+	// stopping early, then carrying on, appends to the file
+	count, err := drainQueue(context.Background(), queue, path, 5)
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 5)
+	count, err = drainQueue(context.Background(), queue, path, 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 35)
+	c.Assert(source.deleted, chk.Equals, 40)
+
+	saved, err := ioutil.ReadFile(path)
+	c.Assert(err, chk.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(saved)), "\n")
+	c.Assert(lines, chk.HasLen, 40)
+	c.Assert(lines[39], chk.Equals, `{"messageId":"id39","insertionTime":"Mon, 01 Jan 2020 00:00:00 GMT","dequeueCount":1,"messageText":"message 39 & more"}`)
+
+	destination := &fakeQueueService{}
+	destinationServer := httptest.NewServer(destination)
+	defer destinationServer.Close()
+	queue, err = newStorageQueue(destinationServer.URL + "/account/q?sig=secret")
+	c.Assert(err, chk.IsNil)
+
+	count, err = loadQueue(context.Background(), queue, path, -time.Second)
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 40)
+	c.Assert(destination.messages[0], chk.Equals, "message 0 & more")
+	c.Assert(destination.messages[39], chk.Equals, "message 39 & more")
+	c.Assert(destination.ttls[0], chk.Equals, "-1")
+
+	_, err = loadQueueMessages(context.Background(), queue, strings.NewReader(`{"messageId":"x"}`), 0)
+	c.Assert(err, chk.ErrorMatches, "line 1 is not a JSON object with a messageText")
+}
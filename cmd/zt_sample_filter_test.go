@@ -0,0 +1,81 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	chk "gopkg.in/check.v1"
+)
+
+type sampleFilterSuite struct{}
+
+var _ = chk.Suite(&sampleFilterSuite{})
+
+func (s *sampleFilterSuite) passingPaths(filter objectFilter, count int) []string {
+	passed := make([]string, 0)
+	for i := 0; i < count; i++ {
+		relativePath := fmt.Sprintf("dir%d/file%d.txt", i%10, i)
+		if filter.doesPass(storedObject{name: fmt.Sprintf("file%d.txt", i), relativePath: relativePath, size: 100}) {
+			passed = append(passed, relativePath)
+		}
+	}
+	return passed
+}
+
+func (s *sampleFilterSuite) TestParseSamplePercentage(c *chk.C) {
+	fraction, err := parseSamplePercentage("1%")
+	c.Assert(err, chk.IsNil)
+	c.Assert(fraction, chk.Equals, 0.01)
+
+	fraction, err = parseSamplePercentage("100%")
+	c.Assert(err, chk.IsNil)
+	c.Assert(fraction, chk.Equals, 1.0)
+
+	for _, bad := range []string{"1", "0%", "-5%", "101%", "abc%", "%"} {
+		_, err = parseSamplePercentage(bad)
+		c.Assert(err, chk.NotNil)
+	}
+}
+
+func (s *sampleFilterSuite) TestSampleIsDeterministicAndSeedable(c *chk.C) {
+	first := s.passingPaths(buildSampleFilters(0.1, "", 0)[0], 10000)
+	second := s.passingPaths(buildSampleFilters(0.1, "", 0)[0], 10000)
+	reseeded := s.passingPaths(buildSampleFilters(0.1, "other", 0)[0], 10000)
+
+	// about a tenth of the files, the same ones each time for the same seed
+	c.Assert(len(first) > 900 && len(first) < 1100, chk.Equals, true)
+	c.Assert(second, chk.DeepEquals, first)
+	c.Assert(reseeded, chk.Not(chk.DeepEquals), first)
+}
+
+func (s *sampleFilterSuite) TestSampleMaxBytes(c *chk.C) {
+	filter := buildSampleFilters(0, "", 1050)[0]
+
+	// files of 100 bytes, so 10 fit, and then a smaller file that still fits is taken
+	c.Assert(s.passingPaths(filter, 50), chk.HasLen, 10)
+	c.Assert(filter.doesPass(storedObject{relativePath: "small.txt", size: 50}), chk.Equals, true)
+	c.Assert(filter.doesPass(storedObject{relativePath: "tiny.txt", size: 1}), chk.Equals, false)
+}
+
+func (s *sampleFilterSuite) TestNoSampleMeansNoFilter(c *chk.C) {
+	c.Assert(buildSampleFilters(0, "", 0), chk.HasLen, 0)
+}
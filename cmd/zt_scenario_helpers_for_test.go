@@ -676,6 +676,8 @@ func getDefaultSyncRawInput(src, dst string) rawSyncCmdArgs {
 		logVerbosity:        defaultLogVerbosityForSync,
 		deleteDestination:   deleteDestination.String(),
 		md5ValidationOption: common.DefaultHashValidationOption.String(),
+		compare:             common.ESyncCompare.LastModifiedTime().String(),
+		folderCreation:      common.EFolderCreationPolicy.Lazy().String(),
 	}
 }
 
@@ -690,6 +692,10 @@ func getDefaultCopyRawInput(src string, dst string) rawCopyCmdArgs {
 		md5ValidationOption:            common.DefaultHashValidationOption.String(),
 		s2sInvalidMetadataHandleOption: defaultS2SInvalideMetadataHandleOption.String(),
 		forceWrite:                     common.EOverwriteOption.True().String(),
+		sourceChangePolicy:             common.ESourceChangePolicy.Fail().String(),
+		deleteSourceAfter:              common.EDeleteSourceAfter.Never().String(),
+		assertSourceUnchanged:          common.EAssertSourceUnchanged.None().String(),
+		folderCreation:                 common.EFolderCreationPolicy.Lazy().String(),
 	}
 }
 
@@ -713,5 +719,8 @@ func getDefaultRemoveRawInput(src string) rawCopyCmdArgs {
 		md5ValidationOption:            common.DefaultHashValidationOption.String(),
 		s2sInvalidMetadataHandleOption: defaultS2SInvalideMetadataHandleOption.String(),
 		forceWrite:                     common.EOverwriteOption.True().String(),
+		sourceChangePolicy:             common.ESourceChangePolicy.Fail().String(),
+		deleteSourceAfter:              common.EDeleteSourceAfter.Never().String(),
+		assertSourceUnchanged:          common.EAssertSourceUnchanged.None().String(),
 	}
 }
@@ -0,0 +1,121 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/sftp"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type sftpTraverserSuite struct{}
+
+var _ = chk.Suite(&sftpTraverserSuite{})
+
+// connects to an SFTP server, running in this process, that serves the local file system
+func newInProcessSftpClient() (*common.SftpClient, error) {
+	toServerReader, toServerWriter := io.Pipe()
+	toClientReader, toClientWriter := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{toServerReader, toClientWriter})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = server.Serve()
+		_ = toClientWriter.Close()
+	}()
+
+	client, err := sftp.NewClientPipe(toClientReader, toServerWriter)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewSftpClientOnConnection(client, nil), nil
+}
+
+func (s *sftpTraverserSuite) TestInferSftp(c *chk.C) {
+	c.Assert(inferArgumentLocation("sftp://user@host/data/file.csv"), chk.Equals, common.ELocation.Sftp())
+	c.Assert(inferFromTo("sftp://user@host/data", "https://account.blob.core.windows.net/container"), chk.Equals, common.EFromTo.SftpBlob())
+	c.Assert(inferFromTo("https://account.blob.core.windows.net/container/blob", "sftp://user@host/data/"), chk.Equals, common.EFromTo.BlobSftp())
+
+	// there's no token, since SFTP logs in with a key
+	base, token, err := SplitAuthTokenFromResource("sftp://user@host/data", common.ELocation.Sftp())
+	c.Assert(err, chk.IsNil)
+	c.Assert(base, chk.Equals, "sftp://user@host/data")
+	c.Assert(token, chk.Equals, "")
+}
+
+func (s *sftpTraverserSuite) traverse(c *chk.C, dir string, recursive bool) []storedObject {
+	u, err := url.Parse("sftp://user@host" + filepath.ToSlash(dir))
+	c.Assert(err, chk.IsNil)
+	traverser, err := newSftpTraverser(u, context.Background(), recursive, nil)
+	c.Assert(err, chk.IsNil)
+	traverser.dial = newInProcessSftpClient
+
+	objects := make([]storedObject, 0)
+	err = traverser.traverse(noPreProccessor, func(object storedObject) error {
+		objects = append(objects, object)
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	sort.Slice(objects, func(i, j int) bool { return objects[i].relativePath < objects[j].relativePath })
+	return objects
+}
+
+func (s *sftpTraverserSuite) TestTraverseSftpDirectory(c *chk.C) {
+	dir, err := ioutil.TempDir("", "sftpTraverser")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	c.Assert(os.MkdirAll(filepath.Join(dir, "sub"), os.ModePerm), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "top.txt"), []byte("12345"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "sub", "nested.txt"), []byte("123"), 0644), chk.IsNil)
+
+	objects := s.traverse(c, dir, true)
+	c.Assert(objects, chk.HasLen, 2)
+	c.Assert(objects[0].relativePath, chk.Equals, "sub/nested.txt")
+	c.Assert(objects[0].name, chk.Equals, "nested.txt")
+	c.Assert(objects[0].size, chk.Equals, int64(3))
+	c.Assert(objects[1].relativePath, chk.Equals, "top.txt")
+
+	// without recursion, only the files right under the directory
+	objects = s.traverse(c, dir, false)
+	c.Assert(objects, chk.HasLen, 1)
+	c.Assert(objects[0].relativePath, chk.Equals, "top.txt")
+
+	// a single file has no relative path
+	objects = s.traverse(c, filepath.Join(dir, "top.txt"), false)
+	c.Assert(objects, chk.HasLen, 1)
+	c.Assert(objects[0].relativePath, chk.Equals, "")
+	c.Assert(objects[0].name, chk.Equals, "top.txt")
+	c.Assert(objects[0].size, chk.Equals, int64(5))
+}
@@ -0,0 +1,116 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type statsSuite struct{}
+
+var _ = chk.Suite(&statsSuite{})
+
+func statsRecord(src, dst string, end time.Time, duration time.Duration, bytes uint64) common.JobStatsRecord {
+	return common.JobStatsRecord{JobID: common.NewJobID(), SourceEndpoint: src, DestinationEndpoint: dst,
+		StartTime: end.Add(-duration), EndTime: end, TransfersCompleted: 1, BytesTransferred: bytes}
+}
+
+func (s *statsSuite) TestFilterJobStats(c *chk.C) {
+	now := time.Now()
+	records := []common.JobStatsRecord{
+		statsRecord("local", "one.blob.core.windows.net", now.Add(-48*time.Hour), time.Minute, 1),
+		statsRecord("two.blob.core.windows.net", "local", now.Add(-time.Hour), time.Minute, 1),
+		statsRecord("local", "two.blob.core.windows.net", now, time.Minute, 1),
+	}
+
+	c.Assert(filterJobStats(records, "", time.Time{}), chk.HasLen, 3)
+	c.Assert(filterJobStats(records, "TWO.blob", time.Time{}), chk.HasLen, 2)
+	c.Assert(filterJobStats(records, "", now.Add(-24*time.Hour)), chk.HasLen, 2)
+	c.Assert(filterJobStats(records, "one", now.Add(-24*time.Hour)), chk.HasLen, 0)
+}
+
+func (s *statsSuite) TestSummarizeJobStats(c *chk.C) {
+	end := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	records := []common.JobStatsRecord{
+		// 8, 80 and 16 Mbps, so the median is 16 Mbps, while the average is dominated by the big run
+		statsRecord("local", "a.blob.core.windows.net", end, 10*time.Second, 10*1000*1000),
+		statsRecord("local", "a.blob.core.windows.net", end.Add(time.Hour), 100*time.Second, 1000*1000*1000),
+		statsRecord("local", "a.blob.core.windows.net", end.Add(-time.Hour), 10*time.Second, 20*1000*1000),
+		// a run that transferred nothing counts as a run, but not for the median
+		statsRecord("local", "a.blob.core.windows.net", end, 10*time.Second, 0),
+		statsRecord("b.blob.core.windows.net", "local", end, 10*time.Second, 1000),
+	}
+
+	summaries := summarizeJobStats(records)
+	c.Assert(summaries, chk.HasLen, 2)
+
+	a := summaries[0] // the most data first
+	c.Assert(a.DestinationEndpoint, chk.Equals, "a.blob.core.windows.net")
+	c.Assert(a.Runs, chk.Equals, 4)
+	c.Assert(a.TransfersCompleted, chk.Equals, uint64(4))
+	c.Assert(a.BytesTransferred, chk.Equals, uint64(1030*1000*1000))
+	c.Assert(a.TotalSeconds, chk.Equals, float64(130))
+	c.Assert(a.AverageThroughputMbps > 63 && a.AverageThroughputMbps < 64, chk.Equals, true)
+	c.Assert(a.MedianThroughputMbps, chk.Equals, float64(16))
+	c.Assert(a.LastRun.Equal(end.Add(time.Hour)), chk.Equals, true)
+
+	c.Assert(summaries[1].SourceEndpoint, chk.Equals, "b.blob.core.windows.net")
+	c.Assert(summaries[1].Runs, chk.Equals, 1)
+}
+
+func (s *statsSuite) TestSummarizeBandwidthUsage(c *chk.C) {
+	first, second := common.NewJobID(), common.NewJobID()
+	records := []common.BandwidthUsageRecord{
+		{Date: "2021-03-09", JobID: first, BytesSent: 1},
+		{Date: "2021-03-10", JobID: first, BytesSent: 10, BytesReceived: 5},
+		{Date: "2021-03-10", JobID: second, BytesSent: 100},
+		{Date: "2021-03-10", JobID: first, BytesSent: 10},
+	}
+
+	days := summarizeBandwidthUsage(records, time.Time{})
+	c.Assert(days, chk.DeepEquals, []bandwidthUsageDay{
+		{Date: "2021-03-09", BytesSent: 1, Jobs: []common.BandwidthUsageRecord{{Date: "2021-03-09", JobID: first, BytesSent: 1}}},
+		{Date: "2021-03-10", BytesSent: 120, BytesReceived: 5, Jobs: []common.BandwidthUsageRecord{
+			{Date: "2021-03-10", JobID: second, BytesSent: 100},
+			{Date: "2021-03-10", JobID: first, BytesSent: 20, BytesReceived: 5},
+		}},
+	})
+
+	days = summarizeBandwidthUsage(records, time.Date(2021, 3, 10, 12, 0, 0, 0, time.Local))
+	c.Assert(days, chk.HasLen, 1)
+	c.Assert(days[0].Date, chk.Equals, "2021-03-10")
+}
+
+func (s *statsSuite) TestCookDailyCap(c *chk.C) {
+	raw := getDefaultCopyRawInput(c.MkDir(), "https://account.blob.core.windows.net/container/dir?sig=a")
+	raw.recursive = true
+	raw.dailyCapGB = 1.5
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.dailyCapBytes, chk.Equals, uint64(1536*1024*1024))
+
+	raw.dailyCapGB = -1
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,125 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/md5"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type syncHashComparerSuite struct{}
+
+var _ = chk.Suite(&syncHashComparerSuite{})
+
+func (s *syncHashComparerSuite) TestCookCompare(c *chk.C) {
+	raw := getDefaultSyncRawInput(c.MkDir(), "https://account.blob.core.windows.net/container/dir?sig=a")
+	raw.compare = "hash"
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.compare, chk.Equals, common.ESyncCompare.Hash())
+
+	// uploaded blobs get a hash, so that they can be compared next time
+	c.Assert(cooked.putMd5, chk.Equals, true)
+
+	raw.compare = "checksum"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	// properties are only synced for objects whose hashes match
+	raw.compare = "hash"
+	raw.propertiesOnly = true
+	raw.deleteDestination = common.EDeleteDestination.False().String()
+	_, err = raw.cook()
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *syncHashComparerSuite) TestLocalFilesAreComparedByContent(c *chk.C) {
+	srcDir := c.MkDir()
+	dstDir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("same"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dstDir, "same.txt"), []byte("same"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(srcDir, "changed.txt"), []byte("new!"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dstDir, "changed.txt"), []byte("old!"), 0644), chk.IsNil)
+
+	hashes, err := newSyncHashComparer(common.EFromTo.LocalLocal(), srcDir, dstDir, newLocalHashCache(""))
+	c.Assert(err, chk.IsNil)
+
+	// the source looks newer, as it would after being restored from a backup, but its content is the same
+	restored := time.Now()
+	old := restored.Add(-time.Hour)
+	c.Assert(isStale(storedObject{relativePath: "same.txt", size: 4, lastModifiedTime: old},
+		storedObject{relativePath: "same.txt", size: 4, lastModifiedTime: restored}, hashes), chk.Equals, false)
+
+	// the content changed, even though the size and the order of the timestamps didn't
+	c.Assert(isStale(storedObject{relativePath: "changed.txt", size: 4, lastModifiedTime: restored},
+		storedObject{relativePath: "changed.txt", size: 4, lastModifiedTime: old}, hashes), chk.Equals, true)
+
+	// without the hashes, the timestamps decide
+	c.Assert(isStale(storedObject{relativePath: "same.txt", size: 4, lastModifiedTime: old},
+		storedObject{relativePath: "same.txt", size: 4, lastModifiedTime: restored}, nil), chk.Equals, true)
+}
+
+func (s *syncHashComparerSuite) TestRemoteHashesAreStoredOnes(c *chk.C) {
+	dstDir := c.MkDir()
+	content := []byte("downloaded")
+	c.Assert(ioutil.WriteFile(filepath.Join(dstDir, "blob"), content, 0644), chk.IsNil)
+	hash := md5.Sum(content)
+
+	hashes, err := newSyncHashComparer(common.EFromTo.BlobLocal(), "https://account.blob.core.windows.net/container", dstDir, newLocalHashCache(""))
+	c.Assert(err, chk.IsNil)
+
+	local := storedObject{relativePath: "blob", size: int64(len(content))}
+	c.Assert(hashes.differ(storedObject{relativePath: "blob", size: int64(len(content)), md5: hash[:]}, local), chk.Equals, false)
+
+	// a blob without a Content-MD5 can't be compared, so it is transferred
+	c.Assert(hashes.differ(storedObject{relativePath: "blob", size: int64(len(content))}, local), chk.Equals, true)
+}
+
+func (s *syncHashComparerSuite) TestLocalHashCacheIsKept(c *chk.C) {
+	dir := c.MkDir()
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("first"), 0644), chk.IsNil)
+	cachePath := filepath.Join(dir, localHashCacheFileName)
+
+	cache := newLocalHashCache(cachePath)
+	first, err := cache.hash(file, 5, 100)
+	c.Assert(err, chk.IsNil)
+	c.Assert(cache.save(), chk.IsNil)
+
+	// the file isn't read again while its size and last modified time are the same
+	c.Assert(ioutil.WriteFile(file, []byte("other"), 0644), chk.IsNil)
+	cache = newLocalHashCache(cachePath)
+	cached, err := cache.hash(file, 5, 100)
+	c.Assert(err, chk.IsNil)
+	c.Assert(cached, chk.DeepEquals, first)
+
+	// but it is once either changes
+	updated, err := cache.hash(file, 5, 200)
+	c.Assert(err, chk.IsNil)
+	expected := md5.Sum([]byte("other"))
+	c.Assert(updated, chk.DeepEquals, expected[:])
+}
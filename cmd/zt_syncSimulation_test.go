@@ -0,0 +1,122 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type syncSimulationSuite struct{}
+
+var _ = chk.Suite(&syncSimulationSuite{})
+
+// simulationTestTraverser lists a fixed set of objects
+type simulationTestTraverser struct {
+	objects []storedObject
+}
+
+func (t *simulationTestTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+	for _, o := range t.objects {
+		if err := processIfPassedFilters(filters, o, processor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *simulationTestTraverser) isDirectory(bool) bool { return true }
+
+func simulationTestObjects(paths ...string) *simulationTestTraverser {
+	t := &simulationTestTraverser{}
+	for _, p := range paths {
+		t.objects = append(t.objects, storedObject{name: p, relativePath: p, lastModifiedTime: time.Unix(1000, 0)})
+	}
+	return t
+}
+
+func (s *syncSimulationSuite) TestCookSimulatedSourceFailures(c *chk.C) {
+	rate, err := cookSimulatedSourceFailures("10%")
+	c.Assert(err, chk.IsNil)
+	c.Assert(rate, chk.Equals, 0.1)
+	rate, err = cookSimulatedSourceFailures("2.5")
+	c.Assert(err, chk.IsNil)
+	c.Assert(rate, chk.Equals, 0.025)
+	rate, err = cookSimulatedSourceFailures("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(rate, chk.Equals, 0.0)
+
+	for _, bad := range []string{"0%", "101%", "lots", "-5"} {
+		_, err = cookSimulatedSourceFailures(bad)
+		c.Assert(err, chk.NotNil, chk.Commentf(bad))
+	}
+}
+
+func (s *syncSimulationSuite) TestSimulatedDeletions(c *chk.C) {
+	mockedRPC := interceptor{}
+	mockedRPC.init()
+
+	for _, fromTo := range []common.FromTo{common.EFromTo.LocalBlob(), common.EFromTo.BlobLocal()} {
+		// every source object is missing from the listing, so every destination object that's still at the source would be lost
+		cca := &cookedSyncCmdArgs{fromTo: fromTo, deleteDestination: common.EDeleteDestination.True(), simulatedSourceFailureRate: 1}
+		source := simulationTestObjects("a", "b", "c")
+		destination := simulationTestObjects("a", "b", "gone")
+		enumerator := cca.initFailureSimulation(source, destination, nil, nil)
+		c.Assert(enumerator.enumerate(), chk.IsNil)
+
+		// the source is listed first for uploads, and second otherwise
+		failing, ok := enumerator.primaryTraverser.(*failingSourceTraverser)
+		if !ok {
+			failing = enumerator.secondaryTraverser.(*failingSourceTraverser)
+		}
+		sim := failing.simulation
+		c.Assert(sim.SourceObjects, chk.Equals, uint64(3), chk.Commentf(fromTo.String()))
+		c.Assert(sim.DroppedSourceObjects, chk.Equals, uint64(3))
+		c.Assert(sim.DestinationObjects, chk.Equals, uint64(3))
+		c.Assert(sim.Transfers, chk.Equals, uint64(0))
+		c.Assert(sim.Deletions, chk.Equals, uint64(3))
+		c.Assert(sim.DeletionsOfLostObjects, chk.Equals, uint64(2))
+		c.Assert(sim.report(), chk.Matches, "(?s).*would be lost: 2 \\(66.67% of the destination\\).*")
+	}
+}
+
+func (s *syncSimulationSuite) TestNoDeletionsWithoutDeleteDestination(c *chk.C) {
+	sim := newSyncFailureSimulation(0.5, common.EDeleteDestination.False(), 1)
+	c.Assert(sim.recordDeletion(storedObject{relativePath: "a"}), chk.IsNil)
+	c.Assert(sim.Deletions, chk.Equals, uint64(0))
+
+	// about half of the objects are dropped, and the same ones for the same seed
+	dropped := 0
+	for i := 0; i < 1000; i++ {
+		if sim.dropSourceObject(storedObject{relativePath: time.Duration(i).String()}) {
+			dropped++
+		}
+	}
+	c.Assert(dropped > 400 && dropped < 600, chk.Equals, true)
+	again := newSyncFailureSimulation(0.5, common.EDeleteDestination.False(), 1)
+	for i := 0; i < 1000; i++ {
+		again.dropSourceObject(storedObject{relativePath: time.Duration(i).String()})
+	}
+	c.Assert(again.DroppedSourceObjects, chk.Equals, uint64(dropped))
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type syncSoftDeleteSuite struct{}
+
+var _ = chk.Suite(&syncSoftDeleteSuite{})
+
+func (s *syncSoftDeleteSuite) TestCookRequireSoftDelete(c *chk.C) {
+	raw := getDefaultSyncRawInput(c.MkDir(), "https://fakeaccount.blob.core.windows.net/container")
+	raw.requireSoftDelete = true
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.requireSoftDelete, chk.Equals, true)
+
+	// nothing is deleted from the destination
+	raw.deleteDestination = common.EDeleteDestination.False().String()
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	// the destination isn't Blob storage
+	raw = getDefaultSyncRawInput("https://fakeaccount.blob.core.windows.net/container", c.MkDir())
+	raw.requireSoftDelete = true
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *syncSoftDeleteSuite) TestSoftDeletePolicy(c *chk.C) {
+	days := int32(7)
+	for _, t := range []struct {
+		policy  *azblob.RetentionPolicy
+		enabled bool
+		days    int32
+		isErr   bool
+	}{
+		{nil, false, 0, false},
+		{&azblob.RetentionPolicy{Enabled: false, Days: &days}, false, 0, false},
+		{&azblob.RetentionPolicy{Enabled: true, Days: &days}, true, 7, false},
+		{&azblob.RetentionPolicy{Enabled: true}, false, 0, true},
+	} {
+		enabled, retentionDays, err := softDeletePolicyOf(&azblob.StorageServiceProperties{DeleteRetentionPolicy: t.policy})
+		c.Assert(enabled, chk.Equals, t.enabled)
+		c.Assert(retentionDays, chk.Equals, t.days)
+		c.Assert(err != nil, chk.Equals, t.isErr)
+	}
+}
+
+func (s *syncSoftDeleteSuite) TestRecoverableDeletionsAreReported(c *chk.C) {
+	// nothing to say if no blobs are deleted
+	c.Assert(formatRecoverableDeletions(nil, 0), chk.Equals, "")
+	c.Assert(formatRecoverableDeletions(&softDeleteTracker{known: true, enabled: true, retentionDays: 7}, 0), chk.Equals, "")
+
+	enabled := &softDeleteTracker{known: true, enabled: true, retentionDays: 7}
+	enabled.recordDeleted()
+	enabled.recordDeleted()
+	c.Assert(enabled.recoverableCount(), chk.Equals, uint32(2))
+	c.Assert(formatRecoverableDeletions(enabled, 3), chk.Equals, " (2 can be recovered for 7 days, through soft delete)")
+
+	disabled := &softDeleteTracker{known: true}
+	disabled.recordDeleted()
+	c.Assert(disabled.recoverableCount(), chk.Equals, uint32(0))
+	c.Assert(formatRecoverableDeletions(disabled, 1), chk.Matches, " \\(none can be recovered.*")
+
+	unknown := &softDeleteTracker{}
+	unknown.recordDeleted()
+	c.Assert(formatRecoverableDeletions(unknown, 1), chk.Matches, " \\(whether they can be recovered is unknown.*")
+
+	// a destination that isn't checked has no tracker
+	var none *softDeleteTracker
+	none.recordDeleted()
+	c.Assert(none.recoverableCount(), chk.Equals, uint32(0))
+}
+
+func (s *syncSoftDeleteSuite) TestNothingIsCheckedUnlessBlobsAreDeleted(c *chk.C) {
+	cca := &cookedSyncCmdArgs{fromTo: common.EFromTo.LocalBlob(), deleteDestination: common.EDeleteDestination.False()}
+	c.Assert(cca.initDestinationSoftDelete(), chk.IsNil)
+	c.Assert(cca.destinationSoftDelete, chk.IsNil)
+
+	cca = &cookedSyncCmdArgs{fromTo: common.EFromTo.BlobLocal(), deleteDestination: common.EDeleteDestination.True()}
+	c.Assert(cca.initDestinationSoftDelete(), chk.IsNil)
+	c.Assert(cca.destinationSoftDelete, chk.IsNil)
+}
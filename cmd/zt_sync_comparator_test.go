@@ -36,7 +36,7 @@ func (s *syncComparatorSuite) TestSyncSourceComparator(c *chk.C) {
 
 	// set up the indexer as well as the source comparator
 	indexer := newObjectIndexer()
-	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process)
+	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, false, nil)
 
 	// create a sample destination object
 	sampleDestinationObject := storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), md5: destMD5}
@@ -89,7 +89,7 @@ func (s *syncComparatorSuite) TestSyncDestinationComparator(c *chk.C) {
 
 	// set up the indexer as well as the destination comparator
 	indexer := newObjectIndexer()
-	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process)
+	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, false, nil)
 
 	// create a sample source object
 	sampleSourceObject := storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), md5: srcMD5}
@@ -137,3 +137,104 @@ func (s *syncComparatorSuite) TestSyncDestinationComparator(c *chk.C) {
 	c.Assert(dummyCopyScheduler.record[0].md5, chk.DeepEquals, srcMD5)
 	c.Assert(len(dummyCleaner.record), chk.Equals, 0)
 }
+
+func (s *syncComparatorSuite) TestSyncSourceComparatorPropertiesOnly(c *chk.C) {
+	dummyCopyScheduler := dummyProcessor{}
+
+	// set up the indexer as well as the source comparator, in properties-only mode
+	indexer := newObjectIndexer()
+	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, true, nil)
+
+	// a source object that is not at the destination has no properties to update, so it is not scheduled
+	compareErr := sourceComparator.processIfNecessary(storedObject{name: "only_at_source", relativePath: "only_at_source", lastModifiedTime: time.Now(), size: 10})
+	c.Assert(compareErr, chk.Equals, nil)
+	c.Assert(len(dummyCopyScheduler.record), chk.Equals, 0)
+
+	// a source object of the same size is scheduled, even though it is older than the destination
+	err := indexer.store(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), size: 10})
+	c.Assert(err, chk.IsNil)
+	compareErr = sourceComparator.processIfNecessary(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now().Add(-time.Hour), size: 10})
+	c.Assert(compareErr, chk.Equals, nil)
+	c.Assert(len(dummyCopyScheduler.record), chk.Equals, 1)
+	c.Assert(len(indexer.indexMap), chk.Equals, 0)
+
+	// reset the processor so that it's empty
+	dummyCopyScheduler = dummyProcessor{}
+
+	// a source object of a different size needs a normal copy, so it is not scheduled, even though it is more recent
+	err = indexer.store(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), size: 10})
+	c.Assert(err, chk.IsNil)
+	compareErr = sourceComparator.processIfNecessary(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now().Add(time.Hour), size: 20})
+	c.Assert(compareErr, chk.Equals, nil)
+	c.Assert(len(dummyCopyScheduler.record), chk.Equals, 0)
+	c.Assert(len(indexer.indexMap), chk.Equals, 0)
+}
+
+func (s *syncComparatorSuite) TestSyncDestinationComparatorPropertiesOnly(c *chk.C) {
+	dummyCopyScheduler := dummyProcessor{}
+	dummyCleaner := dummyProcessor{}
+	srcMD5 := []byte{'s'}
+
+	// set up the indexer as well as the destination comparator, in properties-only mode
+	indexer := newObjectIndexer()
+	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, true, nil)
+
+	// the source object of the same size is scheduled, even though the destination is more recent
+	err := indexer.store(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), size: 10, md5: srcMD5})
+	c.Assert(err, chk.IsNil)
+	compareErr := destinationComparator.processIfNecessary(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now().Add(time.Hour), size: 10})
+	c.Assert(compareErr, chk.Equals, nil)
+	c.Assert(len(dummyCopyScheduler.record), chk.Equals, 1)
+	c.Assert(dummyCopyScheduler.record[0].md5, chk.DeepEquals, srcMD5)
+	c.Assert(len(dummyCleaner.record), chk.Equals, 0)
+
+	// reset dummy processors
+	dummyCopyScheduler = dummyProcessor{}
+
+	// the source object of a different size is not scheduled, even though the destination is stale
+	err = indexer.store(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), size: 10, md5: srcMD5})
+	c.Assert(err, chk.IsNil)
+	compareErr = destinationComparator.processIfNecessary(storedObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now().Add(-time.Hour), size: 20})
+	c.Assert(compareErr, chk.Equals, nil)
+	c.Assert(len(dummyCopyScheduler.record), chk.Equals, 0)
+	c.Assert(len(dummyCleaner.record), chk.Equals, 0)
+	c.Assert(len(indexer.indexMap), chk.Equals, 0)
+}
+
+func (s *syncComparatorSuite) TestSyncPropertiesOnlyComparesContentNotJustSize(c *chk.C) {
+	now := time.Now()
+	older, newer := now.Add(-time.Hour), now.Add(time.Hour)
+	hashA, hashB := []byte{'a'}, []byte{'b'}
+
+	cases := []struct {
+		source, destination storedObject
+		scheduled           bool
+	}{
+		// without hashes, a source modified after the destination may have been rewritten with the same size
+		{storedObject{size: 10, lastModifiedTime: newer}, storedObject{size: 10, lastModifiedTime: now}, false},
+		{storedObject{size: 10, lastModifiedTime: older}, storedObject{size: 10, lastModifiedTime: now}, true},
+		{storedObject{size: 10, lastModifiedTime: newer, md5: hashA}, storedObject{size: 10, lastModifiedTime: now}, false},
+
+		// when both sides have hashes, they decide, whatever the last modified times
+		{storedObject{size: 10, lastModifiedTime: newer, md5: hashA}, storedObject{size: 10, lastModifiedTime: now, md5: hashA}, true},
+		{storedObject{size: 10, lastModifiedTime: older, md5: hashA}, storedObject{size: 10, lastModifiedTime: now, md5: hashB}, false},
+	}
+
+	for i, x := range cases {
+		x.source.name, x.source.relativePath = "test", "/usr/test"
+		x.destination.name, x.destination.relativePath = "test", "/usr/test"
+
+		dummyCopyScheduler := dummyProcessor{}
+		indexer := newObjectIndexer()
+		c.Assert(indexer.store(x.destination), chk.IsNil)
+		c.Assert(newSyncSourceComparator(indexer, dummyCopyScheduler.process, true, nil).processIfNecessary(x.source), chk.IsNil)
+		c.Assert(len(dummyCopyScheduler.record) == 1, chk.Equals, x.scheduled, chk.Commentf("case %d, source first", i))
+
+		dummyCopyScheduler = dummyProcessor{}
+		dummyCleaner := dummyProcessor{}
+		indexer = newObjectIndexer()
+		c.Assert(indexer.store(x.source), chk.IsNil)
+		c.Assert(newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, true, nil).processIfNecessary(x.destination), chk.IsNil)
+		c.Assert(len(dummyCopyScheduler.record) == 1, chk.Equals, x.scheduled, chk.Commentf("case %d, destination first", i))
+	}
+}
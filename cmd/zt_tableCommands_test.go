@@ -0,0 +1,246 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+
+	chk "gopkg.in/check.v1"
+)
+
+type tableCommandsTestSuite struct{}
+
+var _ = chk.Suite(&tableCommandsTestSuite{})
+
+// fakeTableService serves two pages of entities, and records the batches it receives
+type fakeTableService struct {
+	mu       sync.Mutex
+	batches  [][]string // the entity JSON of each batch
+	failWith string     // if set, the status line of the failing operation in every batch
+	busyFor  int        // how many of the next requests are turned away as if the service were busy
+	requests int
+}
+
+func (f *fakeTableService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+	busy := f.busyFor > 0
+	if busy {
+		f.busyFor--
+	}
+	f.mu.Unlock()
+	if busy {
+		w.Header().Set("x-ms-error-code", "ServerBusy")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/devstoreaccount1/mytable()":
+		if r.URL.Query().Get("sig") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("NextPartitionKey") == "" {
+			w.Header().Set("x-ms-continuation-NextPartitionKey", "p2")
+			w.Header().Set("x-ms-continuation-NextRowKey", "r1")
+			fmt.Fprint(w, `{"odata.metadata":"m","value":[`+
+				`{"odata.etag":"e1","PartitionKey":"p1","RowKey":"r1","Timestamp":"2020-01-01T00:00:00Z","Timestamp@odata.type":"Edm.DateTime","Name":"one","Count":1},`+
+				`{"odata.etag":"e2","PartitionKey":"p1","RowKey":"r2","Timestamp":"2020-01-01T00:00:00Z","Timestamp@odata.type":"Edm.DateTime","Big":"9007199254740993","Big@odata.type":"Edm.Int64","Ratio":0.5}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"value":[{"PartitionKey":"p2","RowKey":"r1","Timestamp":"2020-01-01T00:00:00Z","Timestamp@odata.type":"Edm.DateTime","Name":"three, with a comma","Flag":true}]}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/devstoreaccount1/$batch":
+		body, _ := ioutil.ReadAll(r.Body)
+		var entities []string
+		for _, line := range strings.Split(string(body), "\r\n") {
+			if strings.HasPrefix(line, "{") {
+				entities = append(entities, line)
+			}
+		}
+		f.mu.Lock()
+		f.batches = append(f.batches, entities)
+		f.mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+		if f.failWith != "" {
+			fmt.Fprint(w, "--batchresponse\r\nContent-Type: application/http\r\n\r\n"+f.failWith+"\r\nContent-Type: application/json\r\n\r\n"+
+				`{"odata.error":{"code":"InvalidInput","message":{"lang":"en-US","value":"0:Bad value."}}}`+"\r\n--batchresponse--")
+			return
+		}
+		fmt.Fprint(w, "--batchresponse\r\nContent-Type: application/http\r\n\r\nHTTP/1.1 204 No Content\r\n\r\n--batchresponse--")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *tableCommandsTestSuite) cook(c *chk.C, server *httptest.Server, localPath string) cookedTableCmdArgs {
+	cooked, err := rawTableCmdArgs{batchSize: maxTableBatchSize}.cook(server.URL+"/devstoreaccount1/mytable?sig=secret", localPath)
+	c.Assert(err, chk.IsNil)
+	return cooked
+}
+
+func (s *tableCommandsTestSuite) TestExportAndImportNDJSON(c *chk.C) {
+	service := &fakeTableService{}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "tableCommands")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entities.ndjson")
+
+	count, err := s.cook(c, server, path).export(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 3)
+	exported, err := ioutil.ReadFile(path)
+	c.Assert(err, chk.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(exported)), "\n")
+	c.Assert(lines, chk.HasLen, 3)
+	// the metadata is dropped, and doubles are marked as such
+	c.Assert(lines[1], chk.Equals, `{"Big":"9007199254740993","Big@odata.type":"Edm.Int64","PartitionKey":"p1","Ratio":0.5,"Ratio@odata.type":"Edm.Double",`+
+		`"RowKey":"r2","Timestamp":"2020-01-01T00:00:00Z","Timestamp@odata.type":"Edm.DateTime"}`)
+
+	// entities are batched by partition key, without their timestamps
+	count, err = s.cook(c, server, path).importEntities(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 3)
+	c.Assert(service.batches, chk.HasLen, 2)
+	c.Assert(service.batches[0], chk.HasLen, 2)
+	c.Assert(service.batches[1], chk.DeepEquals, []string{`{"Flag":true,"Name":"three, with a comma","PartitionKey":"p2","RowKey":"r1"}`})
+}
+
+func (s *tableCommandsTestSuite) TestExportAndImportCSV(c *chk.C) {
+	service := &fakeTableService{}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "tableCommands")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entities.csv")
+
+	count, err := s.cook(c, server, path).export(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 3)
+	exported, err := ioutil.ReadFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(exported), chk.Equals, "PartitionKey,RowKey,Timestamp:Edm.DateTime,Big:Edm.Int64,Count:Edm.Int32,Flag:Edm.Boolean,Name,Ratio:Edm.Double\n"+
+		"p1,r1,2020-01-01T00:00:00Z,,1,,one,\n"+
+		"p1,r2,2020-01-01T00:00:00Z,9007199254740993,,,,0.5\n"+
+		"p2,r1,2020-01-01T00:00:00Z,,,true,\"three, with a comma\",\n")
+
+	// the entities were staged in the temp folder of the process, not next to the output, and were cleaned up
+	siblings, err := ioutil.ReadDir(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(siblings, chk.HasLen, 1)
+	tempDir, err := common.ProcessTempDir()
+	c.Assert(err, chk.IsNil)
+	defer common.CleanupTempDir()
+	staged, err := filepath.Glob(filepath.Join(tempDir, "table-export-*"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(staged, chk.HasLen, 0)
+
+	// the import sends what the NDJSON import would have
+	count, err = s.cook(c, server, path).importEntities(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 3)
+	c.Assert(service.batches, chk.HasLen, 2)
+	c.Assert(service.batches[0][1], chk.Equals, `{"Big":"9007199254740993","Big@odata.type":"Edm.Int64","PartitionKey":"p1","Ratio":0.5,"Ratio@odata.type":"Edm.Double","RowKey":"r2"}`)
+
+	// invalid values are reported, with their row
+	c.Assert(ioutil.WriteFile(path, []byte("PartitionKey,RowKey,Count:Edm.Int32\np,r,many\n"), 0644), chk.IsNil)
+	_, err = s.cook(c, server, path).importEntities(context.Background())
+	c.Assert(err, chk.ErrorMatches, "row 1: .*not a valid Edm.Int32")
+}
+
+func (s *tableCommandsTestSuite) TestImportReportsFailedOperations(c *chk.C) {
+	service := &fakeTableService{failWith: "HTTP/1.1 400 Bad Request"}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "tableCommands")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entities.ndjson")
+	c.Assert(ioutil.WriteFile(path, []byte(`{"PartitionKey":"p","RowKey":"r"}`+"\n"), 0644), chk.IsNil)
+
+	count, err := s.cook(c, server, path).importEntities(context.Background())
+	c.Assert(count, chk.Equals, 0)
+	c.Assert(err, chk.ErrorMatches, ".*400 Bad Request \\(InvalidInput: 0:Bad value.\\)")
+
+	// entities need their keys
+	c.Assert(ioutil.WriteFile(path, []byte(`{"PartitionKey":"p"}`+"\n"), 0644), chk.IsNil)
+	_, err = s.cook(c, server, path).importEntities(context.Background())
+	c.Assert(err, chk.ErrorMatches, "line 1: the entity has no RowKey.*")
+}
+
+func (s *tableCommandsTestSuite) TestBatchBody(c *chk.C) {
+	table, err := newStorageTable("https://account.table.core.windows.net/mytable?sig=secret", nil)
+	c.Assert(err, chk.IsNil)
+	body, contentType, err := table.batchBody([]tableEntity{{"PartitionKey": json.RawMessage(`"it's"`), "RowKey": json.RawMessage(`"a b"`)}})
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.HasPrefix(contentType, "multipart/mixed; boundary=batch_"), chk.Equals, true)
+	// the keys are quoted and escaped, and the SAS is only on the batch itself
+	c.Assert(strings.Contains(string(body), "PUT https://account.table.core.windows.net/mytable(PartitionKey='it''s',RowKey='a%20b') HTTP/1.1\r\n"), chk.Equals, true)
+	c.Assert(strings.Contains(string(body), "secret"), chk.Equals, false)
+}
+
+func (s *tableCommandsTestSuite) TestBusyServiceIsRetried(c *chk.C) {
+	service := &fakeTableService{}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "tableCommands")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entities.ndjson")
+
+	cooked := s.cook(c, server, path)
+	cooked.table.p = newTablePipeline(ste.XferRetryOptions{MaxTries: 3, TryTimeout: time.Minute, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond})
+
+	// each page is read, and each batch sent, as many times as it takes
+	service.busyFor = 2
+	count, err := cooked.export(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 3)
+	c.Assert(service.requests, chk.Equals, 4)
+
+	service.busyFor = 1
+	count, err = cooked.importEntities(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(count, chk.Equals, 3)
+	c.Assert(service.batches, chk.HasLen, 2)
+
+	// but not forever
+	service.busyFor = 3
+	_, err = cooked.importEntities(context.Background())
+	c.Assert(err, chk.ErrorMatches, ".*503 Service Unavailable \\(ServerBusy\\).*")
+}
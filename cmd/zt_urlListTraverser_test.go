@@ -0,0 +1,201 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type urlListTraverserSuite struct{}
+
+var _ = chk.Suite(&urlListTraverserSuite{})
+
+func (s *urlListTraverserSuite) TestParseURLListLine(c *chk.C) {
+	entry, err := parseURLListLine("https://example.com/data/my%20file.csv?sig=abc")
+	c.Assert(err, chk.IsNil)
+	c.Assert(entry.name, chk.Equals, "my file.csv")
+	c.Assert(entry.source.String(), chk.Equals, "https://example.com/data/my%20file.csv?sig=abc")
+
+	entry, err = parseURLListLine("http://example.com/download?id=7\tdatasets/2021/train.csv\tContent-Type: text/csv\t x-ms-meta-Origin: web \tCache-Control: no-cache")
+	c.Assert(err, chk.IsNil)
+	c.Assert(entry.name, chk.Equals, "datasets/2021/train.csv")
+	c.Assert(entry.contentType, chk.Equals, "text/csv")
+	c.Assert(entry.cacheControl, chk.Equals, "no-cache")
+	c.Assert(entry.metadata, chk.DeepEquals, common.Metadata{"Origin": "web"})
+
+	// an empty name means the name from the URL
+	entry, err = parseURLListLine("https://example.com/a/b.bin\t\tContent-Language: en")
+	c.Assert(err, chk.IsNil)
+	c.Assert(entry.name, chk.Equals, "b.bin")
+	c.Assert(entry.contentLanguage, chk.Equals, "en")
+
+	for _, bad := range []string{
+		"ftp://example.com/file.bin",
+		"example.com/file.bin",
+		"https://example.com/",
+		"https://example.com/file.bin\t../outside.bin",
+		"https://example.com/file.bin\tdir/",
+		"https://example.com/file.bin\tname.bin\tAuthorization: secret",
+		"https://example.com/file.bin\tname.bin\tno colon",
+	} {
+		_, err = parseURLListLine(bad)
+		c.Assert(err, chk.NotNil, chk.Commentf(bad))
+	}
+}
+
+func (s *urlListTraverserSuite) TestCleanURLListName(c *chk.C) {
+	name, err := cleanURLListName(`/dir\sub//file.txt`)
+	c.Assert(err, chk.IsNil)
+	c.Assert(name, chk.Equals, "dir/sub/file.txt")
+
+	_, err = cleanURLListName("a/../../b")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *urlListTraverserSuite) TestCookURLList(c *chk.C) {
+	raw := getDefaultCopyRawInput("", "https://account.blob.core.windows.net/container/dir")
+	raw.urlList = "list.txt"
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.fromTo, chk.Equals, common.EFromTo.HttpBlob())
+	c.Assert(cooked.urlList, chk.Equals, "list.txt")
+	c.Assert(cooked.stripTopDir, chk.Equals, true)
+
+	// the sources are in the list, and the files can only go to Blob Storage
+	raw.src = "https://example.com/file.bin"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	raw.src = ""
+	raw.dst = "/local/dir"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+
+	raw.dst = "https://account.blob.core.windows.net/container/dir"
+	raw.listOfFilesToCopy = "other.txt"
+	_, err = raw.cook()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *urlListTraverserSuite) TestTraverseURLList(c *chk.C) {
+	lmt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.bin" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", lmt, strings.NewReader(r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "urllist")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	listFile := filepath.Join(dir, "list.txt")
+	list := "\xEF\xBB\xBF# datasets to fetch\n" +
+		server.URL + "/one.bin\n" +
+		"\n" +
+		server.URL + "/two.bin?token=abc\tnamed/second.bin\tContent-Type: text/plain\tx-ms-meta-origin: test\r\n" +
+		server.URL + "/missing.bin\n" +
+		server.URL + "/other/one.bin\n" // the same name as the first line, so it's skipped
+	c.Assert(ioutil.WriteFile(listFile, []byte(list), 0644), chk.IsNil)
+
+	p, err := createHTTPSourcePipeline(frontEndRetryOptions())
+	c.Assert(err, chk.IsNil)
+	counted := 0
+	unreadable := make([]int, 0)
+	traverser := newURLListTraverser(listFile, p, context.Background(), common.ResourceHTTPHeaders{CacheControl: "max-age=60", ContentType: "application/json"},
+		common.Metadata{"origin": "job", "team": "data"}, func() { counted++ }, func(entry urlListEntry, err error) { unreadable = append(unreadable, entry.lineNumber) })
+	c.Assert(traverser.isDirectory(true), chk.Equals, true)
+
+	objects := make([]storedObject, 0)
+	err = traverser.traverse(noPreProccessor, func(object storedObject) error {
+		objects = append(objects, object)
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(counted, chk.Equals, 2)
+	c.Assert(unreadable, chk.DeepEquals, []int{5}) // the missing file is a failure of the job, not a silent skip
+	c.Assert(objects, chk.HasLen, 2)
+	sort.Slice(objects, func(i, j int) bool { return objects[i].relativePath < objects[j].relativePath })
+
+	c.Assert(objects[0].relativePath, chk.Equals, "named/second.bin")
+	c.Assert(objects[0].name, chk.Equals, "second.bin")
+	c.Assert(objects[0].sourceURL, chk.Equals, server.URL+"/two.bin?token=abc")
+	c.Assert(objects[0].size, chk.Equals, int64(len("/two.bin")))
+	// what's on the line of the list takes precedence over what's given for the job, which takes precedence over what the server says
+	c.Assert(objects[0].contentType, chk.Equals, "text/plain")
+	c.Assert(objects[0].cacheControl, chk.Equals, "max-age=60")
+	c.Assert(objects[0].Metadata, chk.DeepEquals, common.Metadata{"origin": "test", "team": "data"})
+
+	c.Assert(objects[1].relativePath, chk.Equals, "one.bin")
+	c.Assert(objects[1].sourceURL, chk.Equals, server.URL+"/one.bin")
+	c.Assert(objects[1].contentType, chk.Equals, "application/json")
+	c.Assert(objects[1].Metadata, chk.DeepEquals, common.Metadata{"origin": "job", "team": "data"})
+	c.Assert(objects[1].lastModifiedTime.Equal(lmt), chk.Equals, true)
+}
+
+func (s *urlListTraverserSuite) TestTraverseURLListFailsOnBadLine(c *chk.C) {
+	dir, err := ioutil.TempDir("", "urllist")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	listFile := filepath.Join(dir, "list.txt")
+	c.Assert(ioutil.WriteFile(listFile, []byte("not a url\n"), 0644), chk.IsNil)
+
+	p, err := createHTTPSourcePipeline(frontEndRetryOptions())
+	c.Assert(err, chk.IsNil)
+	err = newURLListTraverser(listFile, p, context.Background(), common.ResourceHTTPHeaders{}, nil, nil, nil).traverse(noPreProccessor, func(storedObject) error { return nil }, nil)
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "line 1"), chk.Equals, true)
+}
+
+func (s *urlListTraverserSuite) TestUnreadableSourcesAreFailedTransfers(c *chk.C) {
+	u := &unreadableSources{}
+	summary := common.ListJobSummaryResponse{JobStatus: common.EJobStatus.Completed(), TotalTransfers: 2, TransfersCompleted: 2}
+	u.addTo(&summary)
+	c.Assert(summary.JobStatus, chk.Equals, common.EJobStatus.Completed())
+
+	u.add("https://example.com/missing.bin", "https://account.blob.core.windows.net/container/missing.bin")
+	u.addTo(&summary)
+	c.Assert(summary.JobStatus, chk.Equals, common.EJobStatus.CompletedWithErrors())
+	c.Assert(summary.TotalTransfers, chk.Equals, uint32(3))
+	c.Assert(summary.TransfersFailed, chk.Equals, uint32(1))
+	c.Assert(summary.FailedTransfers, chk.HasLen, 1)
+	c.Assert(summary.FailedTransfers[0].Src, chk.Equals, "https://example.com/missing.bin")
+}
+
+func (s *urlListTraverserSuite) TestParseJobMetadata(c *chk.C) {
+	c.Assert(parseJobMetadata(""), chk.IsNil)
+	c.Assert(parseJobMetadata("origin=web;team=a=b"), chk.DeepEquals, common.Metadata{"origin": "web", "team": "a=b"})
+}
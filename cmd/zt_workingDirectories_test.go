@@ -0,0 +1,68 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+)
+
+type workingDirectoriesSuite struct{}
+
+var _ = chk.Suite(&workingDirectoriesSuite{})
+
+func (s *workingDirectoriesSuite) TestApplyWorkingDirectoryFlags(c *chk.C) {
+	tempDir, err := ioutil.TempDir("", "workingdirs")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(tempDir)
+
+	// restore the global state afterwards
+	oldLogFolder, oldPlanFolder := azcopyLogPathFolder, azcopyJobPlanFolder
+	defer func() {
+		azcopyLogPathFolder, azcopyJobPlanFolder = oldLogFolder, oldPlanFolder
+		logDirRaw, planDirRaw = "", ""
+	}()
+
+	logDirRaw = filepath.Join(tempDir, "logs")
+	planDirRaw = filepath.Join(tempDir, "volume2", "plans")
+	c.Assert(applyWorkingDirectoryFlags(), chk.IsNil)
+
+	c.Assert(azcopyLogPathFolder, chk.Equals, logDirRaw)
+	c.Assert(azcopyJobPlanFolder, chk.Equals, planDirRaw)
+	for _, dir := range []string{logDirRaw, planDirRaw} {
+		info, err := os.Stat(dir)
+		c.Assert(err, chk.IsNil)
+		c.Assert(info.IsDir(), chk.Equals, true)
+	}
+}
+
+func (s *workingDirectoriesSuite) TestVerifyFreeSpace(c *chk.C) {
+	tempDir, err := ioutil.TempDir("", "workingdirs")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(tempDir)
+
+	c.Assert(verifyFreeSpace(tempDir, 1, "plan-dir"), chk.IsNil)
+	c.Assert(verifyFreeSpace(tempDir, math.MaxInt64, "plan-dir"), chk.NotNil)
+}
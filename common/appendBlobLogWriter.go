@@ -0,0 +1,192 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// Job logs can also be streamed to an append blob, so that they outlive the machine that ran the job.
+// That matters in containers and other ephemeral environments, where the local log folder is lost when the job finishes.
+
+// how often buffered log lines are sent. Each send is one append block, and an append blob can hold 50,000 of them,
+// which at this interval is enough for more than 2 days of continuous logging
+const remoteLogFlushInterval = 5 * time.Second
+
+// the container (or virtual directory) URL that job logs are streamed to. Empty if logs are only kept locally
+var jobLogRemoteLocation string
+
+// IsRemoteLogLocation says whether the log location is a blob container URL, rather than a local folder
+func IsRemoteLogLocation(location string) bool {
+	lower := strings.ToLower(location)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// SetJobLogRemoteLocation makes the job logs created from now on also stream to append blobs in the given container,
+// which must be a URL with a SAS that allows create, write and add
+func SetJobLogRemoteLocation(containerURL string) error {
+	if containerURL != "" {
+		u, err := url.Parse(containerURL)
+		if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return errors.New("the remote log location must be the URL of a blob container, with a SAS")
+		}
+	}
+	jobLogRemoteLocation = containerURL
+	return nil
+}
+
+// remoteLogBlobURL returns the URL of the append blob for the log of the job, in the container (or virtual directory) given
+func remoteLogBlobURL(location string, jobID JobID) (url.URL, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return url.URL{}, err
+	}
+	u.Path = path.Join(u.Path, jobID.String()+".log")
+	return *u, nil
+}
+
+// appendBlobLogWriter buffers what is written to it, and appends it to an append blob every few seconds.
+// Logging must never fail the job, so if the blob can't be written the writer reports that once, on the console,
+// and then discards everything else.
+type appendBlobLogWriter struct {
+	blobURL azblob.AppendBlobURL
+
+	lock    sync.Mutex
+	pending bytes.Buffer
+	failed  bool
+
+	sendLock sync.Mutex // keeps the blocks in order
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  sync.WaitGroup
+}
+
+func newAppendBlobLogWriter(blobURL url.URL) *appendBlobLogWriter {
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{
+		Retry: azblob.RetryOptions{MaxTries: 5, TryTimeout: time.Minute},
+	})
+	w := &appendBlobLogWriter{
+		blobURL: azblob.NewAppendBlobURL(blobURL, p),
+		stop:    make(chan struct{}),
+	}
+
+	// a resumed job appends to the blob that it started
+	_, err := w.blobURL.Create(context.Background(), azblob.BlobHTTPHeaders{ContentType: "text/plain; charset=utf-8"}, azblob.Metadata{},
+		azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny}})
+	if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobAlreadyExists {
+		err = nil
+	}
+	if err != nil {
+		w.fail(err)
+	}
+
+	w.stopped.Add(1)
+	go w.flushPeriodically()
+	return w
+}
+
+func (w *appendBlobLogWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.failed {
+		w.pending.Write(p)
+	}
+	return len(p), nil
+}
+
+func (w *appendBlobLogWriter) flushPeriodically() {
+	defer w.stopped.Done()
+	ticker := time.NewTicker(remoteLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// flush sends everything written so far, in blocks no bigger than the service allows
+func (w *appendBlobLogWriter) flush() {
+	w.sendLock.Lock()
+	defer w.sendLock.Unlock()
+
+	w.lock.Lock()
+	data := make([]byte, w.pending.Len())
+	copy(data, w.pending.Bytes())
+	w.pending.Reset()
+	w.lock.Unlock()
+
+	for len(data) > 0 {
+		block := data
+		if len(block) > azblob.AppendBlobMaxAppendBlockBytes {
+			block = block[:azblob.AppendBlobMaxAppendBlockBytes]
+		}
+		_, err := w.blobURL.AppendBlock(context.Background(), bytes.NewReader(block), azblob.AppendBlobAccessConditions{}, nil)
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		data = data[len(block):]
+	}
+}
+
+func (w *appendBlobLogWriter) fail(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.failed {
+		return
+	}
+	w.failed = true
+	w.pending.Reset()
+	fmt.Fprintf(os.Stderr, "Failed to stream the job log to %s, so the log is only kept locally: %v\n",
+		w.location(), NewAzCopyLogSanitizer().SanitizeLogMessage(err.Error()))
+}
+
+// location is the URL of the blob without its SAS, for display
+func (w *appendBlobLogWriter) location() string {
+	u := w.blobURL.URL()
+	u.RawQuery = ""
+	return u.String()
+}
+
+// Close stops the periodic sends, and sends whatever is still buffered. The local log is unaffected by anything that goes wrong here.
+// What is written after that is buffered until Close is called again, so a job can close the writer when it completes,
+// and still have the lines that are logged after that sent when the process exits
+func (w *appendBlobLogWriter) Close() error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	w.stopped.Wait()
+	w.flush()
+	return nil
+}
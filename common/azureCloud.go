@@ -0,0 +1,114 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AzureCloud identifies the Azure AD authority and the storage DNS suffix of an Azure cloud,
+// so that the source and destination of a copy can be in different clouds
+type AzureCloud struct {
+	Name                    string
+	ActiveDirectoryEndpoint string
+	StorageSuffix           string // e.g. core.windows.net, as in account.blob.core.windows.net
+	ResourceManagerEndpoint string // empty if it isn't known, which it may not be for a custom cloud
+}
+
+// the well known clouds, by the names accepted on the command line
+var knownAzureClouds = []AzureCloud{
+	{Name: "AzurePublic", ActiveDirectoryEndpoint: DefaultActiveDirectoryEndpoint, StorageSuffix: "core.windows.net", ResourceManagerEndpoint: ARMResource},
+	{Name: "AzureChina", ActiveDirectoryEndpoint: "https://login.chinacloudapi.cn", StorageSuffix: "core.chinacloudapi.cn", ResourceManagerEndpoint: "https://management.chinacloudapi.cn/"},
+	{Name: "AzureUSGov", ActiveDirectoryEndpoint: "https://login.microsoftonline.us", StorageSuffix: "core.usgovcloudapi.net", ResourceManagerEndpoint: "https://management.usgovcloudapi.net/"},
+	{Name: "AzureGermany", ActiveDirectoryEndpoint: "https://login.microsoftonline.de", StorageSuffix: "core.cloudapi.de", ResourceManagerEndpoint: "https://management.microsoftazure.de/"},
+}
+
+// AzureCloudOfAuthority returns the well known cloud whose Azure AD authority is the given one, or the public cloud if none is
+func AzureCloudOfAuthority(activeDirectoryEndpoint string) AzureCloud {
+	authority := strings.TrimSuffix(strings.ToLower(activeDirectoryEndpoint), "/")
+	for _, cloud := range knownAzureClouds {
+		if strings.ToLower(cloud.ActiveDirectoryEndpoint) == authority {
+			return cloud
+		}
+	}
+	return knownAzureClouds[0]
+}
+
+// ParseAzureCloud parses either the name of a well known cloud (AzurePublic, AzureChina, AzureUSGov or AzureGermany),
+// or a custom cloud given as authority=<AAD authority URL>;suffix=<storage DNS suffix>, optionally followed by
+// ;arm=<Azure Resource Manager URL>
+func ParseAzureCloud(raw string) (AzureCloud, error) {
+	for _, cloud := range knownAzureClouds {
+		if strings.EqualFold(cloud.Name, raw) {
+			return cloud, nil
+		}
+	}
+
+	cloud := AzureCloud{Name: raw}
+	for _, part := range strings.Split(raw, ";") {
+		keyAndValue := strings.SplitN(part, "=", 2)
+		if len(keyAndValue) != 2 {
+			return AzureCloud{}, invalidAzureCloudError(raw)
+		}
+		switch strings.ToLower(strings.TrimSpace(keyAndValue[0])) {
+		case "authority":
+			cloud.ActiveDirectoryEndpoint = strings.TrimSpace(keyAndValue[1])
+		case "suffix":
+			cloud.StorageSuffix = strings.Trim(strings.TrimSpace(keyAndValue[1]), ".")
+		case "arm":
+			cloud.ResourceManagerEndpoint = strings.TrimSpace(keyAndValue[1])
+		default:
+			return AzureCloud{}, invalidAzureCloudError(raw)
+		}
+	}
+
+	if cloud.StorageSuffix == "" {
+		return AzureCloud{}, invalidAzureCloudError(raw)
+	}
+	if cloud.ActiveDirectoryEndpoint != "" {
+		if u, err := url.Parse(cloud.ActiveDirectoryEndpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return AzureCloud{}, fmt.Errorf("the authority of cloud %q must be an https URL", raw)
+		}
+	}
+	if cloud.ResourceManagerEndpoint != "" {
+		if u, err := url.Parse(cloud.ResourceManagerEndpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return AzureCloud{}, fmt.Errorf("the Azure Resource Manager endpoint of cloud %q must be an https URL", raw)
+		}
+	}
+	return cloud, nil
+}
+
+func invalidAzureCloudError(raw string) error {
+	return fmt.Errorf("invalid cloud %q, expected AzurePublic, AzureChina, AzureUSGov, AzureGermany or authority=<URL>;suffix=<storage DNS suffix>[;arm=<URL>]", raw)
+}
+
+// IsEmpty returns true when no cloud was specified
+func (c AzureCloud) IsEmpty() bool {
+	return c.StorageSuffix == ""
+}
+
+// HostBelongs returns true if the host name (e.g. account.blob.core.chinacloudapi.cn) is a storage endpoint of this cloud
+func (c AzureCloud) HostBelongs(host string) bool {
+	host = strings.ToLower(strings.Split(host, ":")[0])
+	return strings.HasSuffix(host, "."+strings.ToLower(c.StorageSuffix))
+}
@@ -0,0 +1,59 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"path"
+	"time"
+)
+
+// BandwidthUsageRecord is a count of the bytes that one job sent and received, over the network, during part of a calendar day.
+// A job that runs for a while has many records, which are added up to give the usage of each job and of each day.
+// That's what is needed on metered links, where what matters is how much went over the link, including retries,
+// rather than the size of the files that were transferred
+type BandwidthUsageRecord struct {
+	Date          string `json:"date"` // the local calendar day, as formatted by BandwidthUsageDate
+	JobID         JobID  `json:"jobId"`
+	BytesSent     uint64 `json:"bytesSent"`
+	BytesReceived uint64 `json:"bytesReceived"`
+}
+
+// Total is the bytes sent and received
+func (r BandwidthUsageRecord) Total() uint64 {
+	return r.BytesSent + r.BytesReceived
+}
+
+// BandwidthUsageDate is the calendar day, in local time, that bandwidth used at the given time counts against
+func BandwidthUsageDate(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// NextBandwidthUsageDay is when the calendar day after the given time starts, in local time
+func NextBandwidthUsageDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.Local)
+}
+
+// BandwidthUsageFilePath is where the bandwidth used by the jobs is kept. Like the statistics of the jobs,
+// it's in the plan folder, but isn't removed with the plans of the jobs
+func BandwidthUsageFilePath(planFolder string) string {
+	return path.Join(planFolder, "bandwidthUsage.jsonl")
+}
@@ -0,0 +1,90 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// skew smaller than this isn't worth mentioning. The Date header only has a resolution of a second,
+// and the service allows a little leeway for the times in signatures anyway
+const minReportedClockSkew = time.Minute
+
+// ClockSkew returns how far the local clock is ahead of the clock of the service that sent the response
+// (negative if it's behind), judging by the Date header of the response.
+// Returns false if the response doesn't have a usable Date header
+func ClockSkew(resp *http.Response, localTime time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return 0, false
+	}
+	serviceTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, false
+	}
+	return localTime.Sub(serviceTime), true
+}
+
+// IsSignificantClockSkew tells whether the skew is big enough to be the cause of a failure, and to be worth mentioning
+func IsSignificantClockSkew(skew time.Duration) bool {
+	return skew >= minReportedClockSkew || skew <= -minReportedClockSkew
+}
+
+// ClockSkewHint explains an authentication failure by the local clock being wrong, when the clock
+// is far enough from the one of the service for that to be the likely cause, e.g. because the start time
+// of the SAS is still in the future for the service. Returns "" otherwise
+func ClockSkewHint(resp *http.Response, localTime time.Time) string {
+	skew, ok := ClockSkew(resp, localTime)
+	if !ok || !IsSignificantClockSkew(skew) {
+		return ""
+	}
+	return fmt.Sprintf("The local clock is %s the clock of the storage service, so the service may judge the SAS not to be valid yet, or to have expired. "+
+		"Correct the local clock (e.g. by syncing it with a time server), or generate a SAS with a start time that allows for the difference",
+		DescribeClockSkew(skew))
+}
+
+// DescribeClockSkew gives e.g. "7m ahead of" or "1h5m behind", for a skew from ClockSkew
+func DescribeClockSkew(skew time.Duration) string {
+	if skew < 0 {
+		return formatClockSkew(-skew) + " behind"
+	}
+	return formatClockSkew(skew) + " ahead of"
+}
+
+// formatClockSkew rounds to the minute, and shows e.g. 7m or 1h5m rather than 7m0s
+func formatClockSkew(skew time.Duration) string {
+	skew = skew.Round(time.Minute)
+	hours := skew / time.Hour
+	minutes := (skew % time.Hour) / time.Minute
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// compressibleTextLength is the length of the text that compressible data repeats. It's much longer than the window
+// of common compressors (e.g. 32 KB for gzip), so that they see text-like data, rather than an obvious repetition
+const compressibleTextLength = 4 * 1024 * 1024
+
+// the words that compressible data is made of. Generated text with a small vocabulary compresses to roughly a third of its size,
+// like natural language and log files
+var compressibleWords = []string{"the", "of", "and", "to", "in", "is", "that", "for", "it", "as", "was", "with", "be", "by", "on",
+	"not", "he", "this", "are", "or", "his", "from", "at", "which", "but", "have", "an", "had", "they", "you", "were", "their",
+	"storage", "account", "container", "request", "response", "INFO:", "ERROR:", "2020-01-01T00:00:00Z", "200", "404", "503", "\n"}
+
+var compressibleText []byte
+var compressibleTextOnce sync.Once
+
+// NewCompressibleDataGenerator returns data of the given length that compresses like text. Unlike random data, it's the
+// same every time, which doesn't matter for validating storage and networks, where only its compressibility does
+func NewCompressibleDataGenerator(length int64) CloseableReaderAt {
+	compressibleTextOnce.Do(func() {
+		r := rand.New(rand.NewSource(1)) // always the same text
+		text := make([]byte, 0, compressibleTextLength+32)
+		for len(text) < compressibleTextLength {
+			text = append(text, compressibleWords[r.Intn(len(compressibleWords))]...)
+			text = append(text, ' ')
+		}
+		compressibleText = text[:compressibleTextLength]
+	})
+	return &compressibleDataGenerator{length: length}
+}
+
+type compressibleDataGenerator struct {
+	length int64
+}
+
+func (c *compressibleDataGenerator) Close() error {
+	return nil
+}
+
+func (c *compressibleDataGenerator) ReadAt(p []byte, off int64) (n int, err error) {
+	if off+int64(len(p)) > c.length {
+		return 0, errors.New("would read past end")
+	}
+
+	for n < len(p) {
+		n += copy(p[n:], compressibleText[(off+int64(n))%compressibleTextLength:])
+	}
+	return n, nil
+}
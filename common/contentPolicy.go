@@ -0,0 +1,138 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ContentPolicy holds the rules that each file must follow to be transferred as usual, for teams that must prevent
+// accidental upload of disallowed content. A file that breaks a rule is rejected, or transferred to a quarantine
+// folder under the destination, depending on the Action. Violations are reported separately from errors.
+// Files that pass the rules can also be scanned for malware, by streaming them to the ScanCommand, and infected
+// files are then rejected or quarantined depending on the InfectedAction.
+type ContentPolicy struct {
+	MaxFileSize       int64    `json:",omitempty"` // 0 means no limit
+	AllowedExtensions []string `json:",omitempty"` // if any, only files with these extensions pass. Lowercase, without the dot
+	BlockedExtensions []string `json:",omitempty"` // lowercase, without the dot
+	BlockedSignatures []string `json:",omitempty"` // hex of the leading bytes of disallowed content, e.g. 4d5a for Windows executables
+	Action            ContentPolicyAction
+	QuarantineFolder  string              `json:",omitempty"`
+	ScanCommand       []string            `json:",omitempty"` // the program and its arguments. Each file is streamed to its standard input
+	InfectedAction    ContentPolicyAction `json:",omitempty"`
+}
+
+// NormalizeExtensions parses extensions separated by semicolons, with or without their dot, e.g. exe;.dll
+func NormalizeExtensions(s string) []string {
+	extensions := make([]string, 0)
+	for _, ext := range strings.Split(s, ";") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// ParseContentSignatures parses the hex of the leading bytes of disallowed content, separated by semicolons, e.g. 4D5A;7F454C46
+func ParseContentSignatures(s string) ([]string, error) {
+	signatures := make([]string, 0)
+	for _, raw := range strings.Split(s, ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(raw); err != nil {
+			return nil, fmt.Errorf("content signature '%s' must be the leading bytes of the content, in hex", raw)
+		}
+		signatures = append(signatures, strings.ToLower(raw))
+	}
+	return signatures, nil
+}
+
+// IsEmpty says whether the policy has no rules, in which case every file passes
+func (p ContentPolicy) IsEmpty() bool {
+	return p.MaxFileSize == 0 && len(p.AllowedExtensions) == 0 && len(p.BlockedExtensions) == 0 && len(p.BlockedSignatures) == 0 &&
+		len(p.ScanCommand) == 0
+}
+
+// CheckFile checks the name and size of a file against the policy. It returns the rule that the file breaks, or "" if it breaks none
+func (p ContentPolicy) CheckFile(path string, size int64) string {
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return fmt.Sprintf("larger than the max file size of %d bytes", p.MaxFileSize)
+	}
+
+	ext := fileExtension(path)
+	if len(p.AllowedExtensions) > 0 && !containsString(p.AllowedExtensions, ext) {
+		return fmt.Sprintf("extension '%s' is not allowed", ext)
+	}
+	if containsString(p.BlockedExtensions, ext) {
+		return fmt.Sprintf("extension '%s' is blocked", ext)
+	}
+	return ""
+}
+
+// SignatureLength is how many leading bytes of a file must be read to check it against the blocked signatures
+func (p ContentPolicy) SignatureLength() int {
+	length := 0
+	for _, s := range p.BlockedSignatures {
+		if len(s)/2 > length {
+			length = len(s) / 2
+		}
+	}
+	return length
+}
+
+// CheckContent checks the leading bytes of a file against the blocked signatures. It returns the rule that the file breaks, or "" if it breaks none
+func (p ContentPolicy) CheckContent(leading []byte) string {
+	for _, s := range p.BlockedSignatures {
+		signature, _ := hex.DecodeString(s) // validated by ParseContentSignatures
+		if bytes.HasPrefix(leading, signature) {
+			return fmt.Sprintf("content matches the blocked signature %s", s)
+		}
+	}
+	return ""
+}
+
+// fileExtension returns the lowercase extension, without the dot, of the last segment of a local path or URL
+func fileExtension(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 && strings.Contains(path, "://") {
+		path = path[:i]
+	}
+	name := path[strings.LastIndexAny(path, `/\`)+1:]
+	i := strings.LastIndex(name, ".")
+	if i <= 0 {
+		return "" // no extension, or a name like .bashrc, which is all extension
+	}
+	return strings.ToLower(name[i+1:])
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
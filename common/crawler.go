@@ -0,0 +1,145 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// CrawlResult is one item found by Crawl, or an error that was encountered while listing a directory
+type CrawlResult struct {
+	Item interface{}
+	Err  error
+}
+
+// EnumerateOneDirFunc lists the immediate contents of one directory. It passes each subdirectory to enqueueDir,
+// so that it will be listed too (perhaps concurrently), and each item that it finds to enqueueOutput.
+// It's up to the caller of Crawl to decide what a directory and an item are, e.g. a local path, or a blob prefix.
+// enqueueOutput returns an error if the crawl has been cancelled, in which case listing should stop
+type EnumerateOneDirFunc func(dir interface{}, enqueueDir func(interface{}), enqueueOutput func(interface{}, error) error) error
+
+// Crawl walks the tree of directories below root, listing up to parallelism directories at a time.
+// Everything that is found is sent to the returned channel, which is closed when the whole tree has been listed
+// or ctx has been cancelled. The order of the results is not defined.
+// Results are funnelled through the channel, rather than processed by the workers, so that the (generally
+// non-thread-safe) processing of the results can happen on one goroutine.
+func Crawl(ctx context.Context, root interface{}, worker EnumerateOneDirFunc, parallelism int) <-chan CrawlResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	c := &crawler{
+		ctx:       ctx,
+		output:    make(chan CrawlResult, 1000),
+		unstarted: []interface{}{root},
+		worker:    worker,
+	}
+	c.cond = sync.NewCond(&c.lock)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.workerLoop()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(c.output)
+	}()
+
+	return c.output
+}
+
+type crawler struct {
+	ctx    context.Context
+	output chan CrawlResult
+	worker EnumerateOneDirFunc
+
+	lock sync.Mutex
+	cond *sync.Cond
+
+	// directories that have been found but not yet listed. Used as a stack, so that we go deep before we go wide,
+	// which keeps this list from growing too long in big trees
+	unstarted []interface{}
+
+	// the number of directories being listed right now, each of which may yet add more to unstarted
+	dirInProgressCount int
+}
+
+func (c *crawler) workerLoop() {
+	for {
+		dir, ok := c.nextDir()
+		if !ok {
+			return
+		}
+
+		err := c.worker(dir, c.enqueueDir, c.enqueueOutput)
+		if err != nil {
+			_ = c.enqueueOutput(nil, err)
+		}
+
+		c.lock.Lock()
+		c.dirInProgressCount--
+		c.lock.Unlock()
+		c.cond.Broadcast() // so that waiting workers can see if there's more to do, or whether we are finished
+	}
+}
+
+// nextDir waits until there's a directory to list, or there's no chance of there ever being one
+func (c *crawler) nextDir() (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for len(c.unstarted) == 0 && c.dirInProgressCount > 0 && c.ctx.Err() == nil {
+		c.cond.Wait()
+	}
+
+	if len(c.unstarted) == 0 || c.ctx.Err() != nil {
+		return nil, false
+	}
+
+	last := len(c.unstarted) - 1
+	dir := c.unstarted[last]
+	c.unstarted[last] = nil
+	c.unstarted = c.unstarted[:last]
+	c.dirInProgressCount++
+	return dir, true
+}
+
+func (c *crawler) enqueueDir(dir interface{}) {
+	c.lock.Lock()
+	c.unstarted = append(c.unstarted, dir)
+	c.lock.Unlock()
+	c.cond.Signal()
+}
+
+func (c *crawler) enqueueOutput(item interface{}, err error) error {
+	select {
+	case c.output <- CrawlResult{Item: item, Err: err}:
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -203,11 +204,15 @@ func CreateS3Credential(ctx context.Context, credInfo CredentialInfo, options Cr
 		secretAccessKey := glcm.GetEnvironmentVariable(EEnvironmentVariable.AWSSecretAccessKey())
 		sessionToken := glcm.GetEnvironmentVariable(EEnvironmentVariable.AwsSessionToken())
 
+		if accessKeyID == "" && secretAccessKey == "" {
+			// no keys were given, so fall back to the role of the EC2 instance profile or ECS task we're running in
+			return createS3InstanceProfileCredential()
+		}
 		if accessKeyID == "" || secretAccessKey == "" {
-			return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must be set before creating the S3 AccessKey credential")
+			return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must both be set before creating the S3 AccessKey credential")
 		}
 
-		// create and return s3 credential
+		// create and return s3 credential, the session token is only present for temporary credentials
 		return credentials.NewStaticV4(accessKeyID, secretAccessKey, sessionToken), nil // S3 uses V4 signature
 	default:
 		options.panicError(fmt.Errorf("invalid state, credential type %v is not supported", credInfo.CredentialType))
@@ -215,6 +220,23 @@ func CreateS3Credential(ctx context.Context, credInfo CredentialInfo, options Cr
 	panic("work around the compiling, logic wouldn't reach here")
 }
 
+// s3InstanceProfileTimeout bounds each request to the instance metadata service (or ECS container agent), so that we
+// fail quickly when we're not running in EC2 or ECS, and the service isn't there at all
+const s3InstanceProfileTimeout = 5 * time.Second
+
+// createS3InstanceProfileCredential gets the temporary credentials of the role of the ECS task or EC2 instance profile
+// we're running as (see s3InstanceCredentialsProvider). They are fetched again shortly before they expire, so long jobs keep working.
+func createS3InstanceProfileCredential() (*credentials.Credentials, error) {
+	credential := credentials.New(newS3InstanceCredentialsProvider(&http.Client{Timeout: s3InstanceProfileTimeout}))
+
+	// get them now, so that the lack of any credentials is reported before the job starts
+	if _, err := credential.Get(); err != nil {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables are not set, "+
+			"and no credentials could be obtained for the role of the ECS task or EC2 instance profile (%v)", err)
+	}
+	return credential, nil
+}
+
 func refreshBlobFSToken(ctx context.Context, tokenInfo OAuthTokenInfo, tokenCredential azbfs.TokenCredential, options CredentialOpOptions) time.Duration {
 	newToken, err := tokenInfo.Refresh(ctx)
 	if err != nil {
@@ -240,7 +262,6 @@ func refreshBlobFSToken(ctx context.Context, tokenInfo OAuthTokenInfo, tokenCred
 // S3 credential related factory methods
 // ==============================================================================================
 func CreateS3Client(ctx context.Context, credInfo CredentialInfo, option CredentialOpOptions) (*minio.Client, error) {
-	// Currently only support access key
 	credential, err := CreateS3Credential(ctx, credInfo, option)
 	if err != nil {
 		return nil, err
@@ -64,3 +64,7 @@ func (cr *emptyChunkReader) Length() int64 {
 func (cr *emptyChunkReader) WriteBufferTo(h hash.Hash) {
 	return // no content to write
 }
+
+func (cr *emptyChunkReader) ReleaseBuffer() {
+	return // there is no buffer
+}
@@ -34,18 +34,57 @@ type EnvironmentVariable struct {
 // This array needs to be updated when a new public environment variable is added
 var VisibleEnvironmentVariables = []EnvironmentVariable{
 	EEnvironmentVariable.ConcurrencyValue(),
+	EEnvironmentVariable.ConcurrencyPerAccount(),
+	EEnvironmentVariable.ConcurrencySlowStart(),
 	EEnvironmentVariable.TransferInitiationPoolSize(),
+	EEnvironmentVariable.EnumerationPoolSize(),
+	EEnvironmentVariable.MaxIdleConnections(),
+	EEnvironmentVariable.IdleConnectionTimeout(),
+	EEnvironmentVariable.MaxConnectionsPerHost(),
+	EEnvironmentVariable.ExpectContinue(),
+	EEnvironmentVariable.ConfigFile(),
 	EEnvironmentVariable.LogLocation(),
 	EEnvironmentVariable.JobPlanLocation(),
+	EEnvironmentVariable.JobRetention(),
+	EEnvironmentVariable.JobStoreMaxSizeMB(),
 	EEnvironmentVariable.BufferGB(),
+	EEnvironmentVariable.MaxMemoryGB(),
+	EEnvironmentVariable.DiskCapMBPerSecond(),
+	EEnvironmentVariable.DiskCapIOPS(),
 	EEnvironmentVariable.AWSAccessKeyID(),
 	EEnvironmentVariable.AWSSecretAccessKey(),
+	EEnvironmentVariable.SftpKeyPath(),
+	EEnvironmentVariable.SftpKnownHosts(),
+	EEnvironmentVariable.SftpConnections(),
 	EEnvironmentVariable.ShowPerfStates(),
 	EEnvironmentVariable.PacePageBlobs(),
 	EEnvironmentVariable.DefaultServiceApiVersion(),
 	EEnvironmentVariable.ClientSecret(),
 	EEnvironmentVariable.CertificatePassword(),
 	EEnvironmentVariable.AutoTuneToCpu(),
+	EEnvironmentVariable.EventGridTopicEndpoint(),
+	EEnvironmentVariable.EventGridTopicKey(),
+	EEnvironmentVariable.EventGridBatchSize(),
+	EEnvironmentVariable.ListMaxTries(),
+	EEnvironmentVariable.ListTryTimeout(),
+	EEnvironmentVariable.ListMaxRetryDelay(),
+	EEnvironmentVariable.AccountThroughputLimitMbps(),
+	EEnvironmentVariable.FIPSMode(),
+	EEnvironmentVariable.Language(),
+	EEnvironmentVariable.LogLanguage(),
+	EEnvironmentVariable.TempDir(),
+	EEnvironmentVariable.LogFormat(),
+	EEnvironmentVariable.LogCategoryLevels(),
+	EEnvironmentVariable.LogMaxSizeMB(),
+	EEnvironmentVariable.LogMaxFiles(),
+	EEnvironmentVariable.LogRotateInterval(),
+	EEnvironmentVariable.LogCompress(),
+	EEnvironmentVariable.SystemLog(),
+	EEnvironmentVariable.TraceEndpoint(),
+	EEnvironmentVariable.TraceHeaders(),
+	EEnvironmentVariable.TolerateClockSkew(),
+	EEnvironmentVariable.DownloadCacheDir(),
+	EEnvironmentVariable.DownloadCacheMaxGB(),
 }
 
 var EEnvironmentVariable = EnvironmentVariable{}
@@ -75,8 +114,33 @@ func (EnvironmentVariable) CertificatePassword() EnvironmentVariable {
 
 func (EnvironmentVariable) ConcurrencyValue() EnvironmentVariable {
 	return EnvironmentVariable{
-		Name:        "AZCOPY_CONCURRENCY_VALUE",
-		Description: "Overrides how many HTTP connections work on transfers. By default, this number is determined based on the number of logical cores on the machine.",
+		Name: "AZCOPY_CONCURRENCY_VALUE",
+		Description: "Overrides how many HTTP connections work on transfers. By default, this number is determined based on the number of logical cores on the machine. " +
+			"Set to ADAPTIVE to keep adjusting the number while transfers run, based on the observed throughput and on server busy (503) responses.",
+	}
+}
+
+func (EnvironmentVariable) ConcurrencyPerAccount() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_CONCURRENCY_PER_ACCOUNT",
+		Description: "Limits how many HTTP connections may work on any one storage account at a time, for jobs that involve several accounts. " +
+			"Work for an account that is at its limit waits, leaving the other connections free for the other accounts. By default, there's no such limit.",
+	}
+}
+
+func (EnvironmentVariable) ConcurrencySlowStart() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_CONCURRENCY_SLOW_START",
+		Description: "Set to false to open all of AzCopy's HTTP connections as soon as transfers start. By default, AzCopy starts with a few connections, " +
+			"and doubles them every second or two while there are no server busy (503) responses, so as not to trip firewalls and proxies, or swamp slow links.",
+	}
+}
+
+func (EnvironmentVariable) EnumerationPoolSize() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_CONCURRENT_SCAN",
+		Description: "Controls how many directories (or, for Blob Storage, virtual directories) are listed at once when scanning the source or destination. " +
+			"Set to 1 to scan one directory at a time. Symbolic links, when followed, are always scanned one at a time.",
 	}
 }
 
@@ -95,6 +159,44 @@ func (EnvironmentVariable) TransferInitiationPoolSize() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) IdleConnectionTimeout() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_IDLE_CONNECTION_TIMEOUT_SECONDS",
+		Description: "Overrides how long, in seconds, an idle HTTP connection is kept open for reuse. The default is 180. " +
+			"Lower it if a firewall, proxy or NAT gateway silently drops connections that are idle for less time than that.",
+	}
+}
+
+func (EnvironmentVariable) MaxConnectionsPerHost() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_MAX_CONNECTIONS_PER_HOST",
+		Description: "Limits how many HTTP connections, active or idle, AzCopy opens to any one host. By default there is no limit, other than the number of concurrent operations.",
+	}
+}
+
+func (EnvironmentVariable) ExpectContinue() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_EXPECT_CONTINUE",
+		Description: "Set to true to send Expect: 100-continue with requests that have bodies, so that a request the service is going to refuse doesn't send its body first. " +
+			"The default is false, since it costs a round trip per request, and some proxies don't support it.",
+	}
+}
+
+func (EnvironmentVariable) MaxIdleConnections() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_MAX_IDLE_CONNECTIONS",
+		Description: "Overrides how many idle HTTP connections are kept open for reuse. By default, it's the max number of connections that work on transfers.",
+	}
+}
+
+func (EnvironmentVariable) ConfigFile() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_CONFIG_FILE",
+		Description: "A YAML or JSON file of settings for the concurrency and memory tunables, e.g. concurrency-value: 64. " +
+			"Command-line flags take precedence over environment variables, which take precedence over this file. The --config-file flag takes precedence over this variable.",
+	}
+}
+
 func (EnvironmentVariable) OptimizeSparsePageBlobTransfers() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:         "AZCOPY_OPTIMIZE_SPARSE_PAGE_BLOB",
@@ -106,7 +208,7 @@ func (EnvironmentVariable) OptimizeSparsePageBlobTransfers() EnvironmentVariable
 func (EnvironmentVariable) LogLocation() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:        "AZCOPY_LOG_LOCATION",
-		Description: "Overrides where the log files are stored, to avoid filling up a disk.",
+		Description: "Overrides where the log files are stored, to avoid filling up a disk. If this is the URL (with SAS) of a blob container, each job log is also streamed to an append blob in it, named after the job ID, and the local copy is kept in the default location.",
 	}
 }
 
@@ -117,6 +219,20 @@ func (EnvironmentVariable) JobPlanLocation() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) JobRetention() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_JOB_RETENTION",
+		Description: "If set (for example to 30d or 72h), the plan and log files of completed jobs that have not been active for this long are removed when a new job starts. Jobs that could still be resumed are kept.",
+	}
+}
+
+func (EnvironmentVariable) JobStoreMaxSizeMB() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_JOB_STORE_MAX_SIZE_MB",
+		Description: "If set, the plan and log files of the least recently active completed jobs are removed when a new job starts, until they use no more than this many MB in total. Jobs that could still be resumed are kept, even if that leaves more.",
+	}
+}
+
 func (EnvironmentVariable) BufferGB() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:        "AZCOPY_BUFFER_GB",
@@ -124,6 +240,30 @@ func (EnvironmentVariable) BufferGB() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) MaxMemoryGB() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_MAX_MEMORY_GB",
+		Description: "A budget for the number of GB of RAM that AzCopy uses for transferring data, for machines that are shared with other work. May include decimal point, e.g. 1.5. " +
+			"When AzCopy starts, the buffers between network and disk, the buffers kept for reuse, and the number of concurrent network operations are all sized to fit within it. " +
+			"The memory actually in use isn't watched, and the limits don't change with the memory that's free, so the process as a whole may use somewhat more. By default, there's no such budget.",
+	}
+}
+
+func (EnvironmentVariable) DiskCapMBPerSecond() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_DISK_CAP_MB_PER_SEC",
+		Description: "Caps the rate at which AzCopy reads local files when uploading, and writes them when downloading, in MB per second. May include decimal point, e.g. 0.5. " +
+			"This is separate from cap-mbps, which caps the network traffic. By default, disk I/O is not capped.",
+	}
+}
+
+func (EnvironmentVariable) DiskCapIOPS() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_DISK_CAP_IOPS",
+		Description: "Caps the number of reads and writes of local files that AzCopy does per second. Each read or write is of at most 1 MB. By default, disk I/O is not capped.",
+	}
+}
+
 func (EnvironmentVariable) AccountName() EnvironmentVariable {
 	return EnvironmentVariable{Name: "ACCOUNT_NAME"}
 }
@@ -172,9 +312,44 @@ func (EnvironmentVariable) AWSSecretAccessKey() EnvironmentVariable {
 	}
 }
 
-// AwsSessionToken is temporaily internally reserved, and not exposed to users.
+func (EnvironmentVariable) SftpKeyPath() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_SFTP_KEY_PATH",
+		Description: "The private key that AzCopy authenticates to SFTP servers with. " +
+			"By default, the first of id_ed25519, id_ecdsa and id_rsa that exists in the .ssh directory of the user's home directory.",
+	}
+}
+
+func (EnvironmentVariable) SftpKeyPassphrase() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_SFTP_KEY_PASSPHRASE",
+		Description: "The passphrase of the private key for SFTP servers, if it has one.",
+		Hidden:      true,
+	}
+}
+
+func (EnvironmentVariable) SftpKnownHosts() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_SFTP_KNOWN_HOSTS",
+		Description: "The known_hosts file with the host keys of SFTP servers. AzCopy only connects to servers whose keys are in it. " +
+			"By default, known_hosts in the .ssh directory of the user's home directory.",
+	}
+}
+
+func (EnvironmentVariable) SftpConnections() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_SFTP_CONNECTIONS",
+		Description: "Limits how many connections AzCopy opens to each SFTP server. " +
+			"By default, it's the number of concurrent network operations, up to 10, since that's how many unauthenticated connections OpenSSH allows by default.",
+	}
+}
+
 func (EnvironmentVariable) AwsSessionToken() EnvironmentVariable {
-	return EnvironmentVariable{Name: "AWS_SESSION_TOKEN"}
+	return EnvironmentVariable{
+		Name:        "AWS_SESSION_TOKEN",
+		Description: "The AWS session token for S3 source used in service to service copy. Only needed with temporary credentials, e.g. from AWS STS.",
+		Hidden:      true,
+	}
 }
 
 // OAuthTokenInfo is only used for internal integration.
@@ -194,3 +369,181 @@ func (EnvironmentVariable) DefaultServiceApiVersion() EnvironmentVariable {
 		Description:  "Overrides the service API version so that AzCopy could accommodate custom environments such as Azure Stack.",
 	}
 }
+
+func (EnvironmentVariable) EventGridTopicEndpoint() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_EVENT_GRID_TOPIC_ENDPOINT",
+		Description: "If set, AzCopy publishes an event to this Event Grid custom topic endpoint as each object is successfully transferred. " +
+			"The event has the job ID, the source, the destination, the size, and the MD5 hash stored for the source, if it has one.",
+	}
+}
+
+func (EnvironmentVariable) EventGridTopicKey() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_EVENT_GRID_TOPIC_KEY",
+		Description: "The access key of the Event Grid custom topic given in AZCOPY_EVENT_GRID_TOPIC_ENDPOINT.",
+		Hidden:      true,
+	}
+}
+
+func (EnvironmentVariable) EventGridBatchSize() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:         "AZCOPY_EVENT_GRID_BATCH_SIZE",
+		DefaultValue: "1",
+		Description:  "How many completion events AzCopy groups into each request to the Event Grid topic. The default of 1 publishes each object as soon as it lands.",
+	}
+}
+
+func (EnvironmentVariable) ListMaxTries() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LIST_MAX_TRIES",
+		Description: "Overrides how many times each request that lists the source or the destination is tried, independently of the retries of transfers and of other requests.",
+	}
+}
+
+func (EnvironmentVariable) ListTryTimeout() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LIST_TRY_TIMEOUT",
+		Description: "Overrides how long each try of a listing request may take, e.g. 30s or 2m, so that a stalled listing is retried sooner.",
+	}
+}
+
+func (EnvironmentVariable) ListMaxRetryDelay() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LIST_MAX_RETRY_DELAY",
+		Description: "Overrides the longest back-off between tries of a listing request, e.g. 10s.",
+	}
+}
+
+func (EnvironmentVariable) AccountThroughputLimitMbps() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_ACCOUNT_THROUGHPUT_LIMIT_MBPS",
+		Description: "The ingress or egress limit of the storage account, in megabits per second, for use with max-account-throughput-fraction. If not set, the limit is learnt from the responses that say the account is over its limit.",
+	}
+}
+
+func (EnvironmentVariable) FIPSMode() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_FIPS_MODE",
+		Description: "Set to true to only use FIPS-approved cryptography. MD5 hashes are then never computed, so put-md5 and check-md5 are unavailable, and TLS is restricted to approved versions and cipher suites.",
+	}
+}
+
+func (EnvironmentVariable) Language() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LANGUAGE",
+		Description: "The language of the messages shown on the console, e.g. de or pt-BR. By default, it's taken from LC_ALL, LC_MESSAGES or LANG. Messages that have not been translated are shown in English.",
+	}
+}
+
+func (EnvironmentVariable) LogLanguage() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LOG_LANGUAGE",
+		Description: "The language of the messages in log files. By default, logs are in English, whatever the language of the console.",
+	}
+}
+
+func (EnvironmentVariable) LogFormat() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:         "AZCOPY_LOG_FORMAT",
+		DefaultValue: "text",
+		Description:  "The format of the job log files: text (the default), or json, which writes one JSON object per line, with the time, level, job ID, transfer and message in fields of their own.",
+	}
+}
+
+func (EnvironmentVariable) LogCategoryLevels() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_LOG_CATEGORY_LEVELS",
+		Description: "Log some categories of messages of the job logs at a level of their own, instead of the log level of the job. " +
+			"In the form category=level, separated by semicolons, e.g. retry=WARNING;enumeration=INFO. The categories are general, retry, enumeration, chunk and auth.",
+	}
+}
+
+func (EnvironmentVariable) LogMaxSizeMB() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LOG_MAX_SIZE_MB",
+		Description: "If set, a job log that reaches this many MB is renamed to <job ID>.<n>.log, and a new one started. By default, each job has a single log file, however big it gets.",
+	}
+}
+
+func (EnvironmentVariable) LogMaxFiles() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LOG_MAX_FILES",
+		Description: "If set, only this many of the renamed log files of a job are kept (besides the current one), and older ones are deleted. By default, all of them are kept.",
+	}
+}
+
+func (EnvironmentVariable) LogRotateInterval() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LOG_ROTATE_INTERVAL",
+		Description: "If set (for example to 1h or 24h), a new job log file is started when the current one is this old.",
+	}
+}
+
+func (EnvironmentVariable) LogCompress() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LOG_COMPRESS",
+		Description: "If set to true, the job log files are compressed to <job ID>.<n>.log.gz as they are rotated, and to <job ID>.log.gz when AzCopy exits.",
+	}
+}
+
+func (EnvironmentVariable) SystemLog() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_SYSTEM_LOG",
+		Description: "If set to true, the warnings and errors of jobs are also written to syslog (on Linux and macOS) or the Windows Event Log, so failures of scheduled runs show up in the system log.",
+	}
+}
+
+func (EnvironmentVariable) TraceEndpoint() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_TRACE_ENDPOINT",
+		Description: "If set, AzCopy sends a trace of each job (a span for the job, a span for each transfer, and an event for each retry) to this OTLP/HTTP endpoint, e.g. http://localhost:4318/v1/traces of an OpenTelemetry collector.",
+	}
+}
+
+func (EnvironmentVariable) TraceHeaders() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_TRACE_HEADERS",
+		Description: "Headers to send with the traces, as comma-separated key=value pairs, e.g. for the API key of the collector.",
+	}
+}
+
+func (EnvironmentVariable) TempDir() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_TMP_DIR",
+		Description: "Overrides where AzCopy stages data on disk while it works (by default, the system temp directory, which is often on a small volume). AzCopy uses a folder of its own in there, and deletes it on exit.",
+	}
+}
+
+func (EnvironmentVariable) TolerateClockSkew() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_TOLERATE_CLOCK_SKEW",
+		Description: "If set to true, and a SAS that AzCopy generates itself (e.g. for the source of a copy authorized with OAuth) is rejected because the local clock is wrong, " +
+			"AzCopy measures the difference from the clock of the storage service and generates the SAS again with its times moved by that difference.",
+	}
+}
+
+func (EnvironmentVariable) DownloadCacheDir() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_DOWNLOAD_CACHE_DIR",
+		Description: "A folder in which to keep a copy of each blob that is downloaded, so that later downloads of the same content, in any job, are read from there instead. " +
+			"Useful on build machines that download the same large artifacts again and again. Content read from the cache is checked like a download is.",
+	}
+}
+
+func (EnvironmentVariable) DownloadCacheMaxGB() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_DOWNLOAD_CACHE_MAX_GB",
+		Description: "The most data to keep in the download cache, in GB. When it's over this, the entries that were used longest ago are removed. If not set, the cache isn't limited.",
+	}
+}
+
+func (EnvironmentVariable) FaultInjection() EnvironmentVariable {
+	// Only used for testing, so not listed in the environment variables.
+	return EnvironmentVariable{
+		Name: "AZCOPY_FAULT_INJECTION",
+		Description: "Faults to inject into the requests of the transfer engine, to validate how retries and resumes behave before production runs. " +
+			"A comma-separated list of kind=rate, where the kinds are 503, slow, truncate and skew, and the rates are fractions of the requests, " +
+			"optionally with slow-delay=<duration>, skew-offset=<duration> and seed=<integer>. E.g. 503=0.05,truncate=0.01",
+	}
+}
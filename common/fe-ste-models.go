@@ -228,6 +228,196 @@ func (o OverwriteOption) String() string {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+var ESourceChangePolicy = SourceChangePolicy(0)
+
+// SourceChangePolicy says what happens to a transfer when its source has changed since it was scheduled
+type SourceChangePolicy uint8
+
+func (SourceChangePolicy) Fail() SourceChangePolicy             { return SourceChangePolicy(0) }
+func (SourceChangePolicy) RescheduleLatest() SourceChangePolicy { return SourceChangePolicy(1) }
+func (SourceChangePolicy) Skip() SourceChangePolicy             { return SourceChangePolicy(2) }
+
+func (p *SourceChangePolicy) Parse(s string) error {
+	// accept the hyphenated form used on the command line, e.g. reschedule-latest
+	val, err := enum.Parse(reflect.TypeOf(p), strings.Replace(s, "-", "", -1), true)
+	if err == nil {
+		*p = val.(SourceChangePolicy)
+	}
+	return err
+}
+
+func (p SourceChangePolicy) String() string {
+	return enum.StringInt(p, reflect.TypeOf(p))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var EDeleteSourceAfter = DeleteSourceAfter(0)
+
+// DeleteSourceAfter says when the source of a transfer is deleted, which gives move rather than copy semantics
+type DeleteSourceAfter uint8
+
+func (DeleteSourceAfter) Never() DeleteSourceAfter    { return DeleteSourceAfter(0) }
+func (DeleteSourceAfter) Verified() DeleteSourceAfter { return DeleteSourceAfter(1) }
+
+func (d *DeleteSourceAfter) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(d), s, true)
+	if err == nil {
+		*d = val.(DeleteSourceAfter)
+	}
+	return err
+}
+
+func (d DeleteSourceAfter) String() string {
+	return enum.StringInt(d, reflect.TypeOf(d))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var EContentPolicyAction = ContentPolicyAction(0)
+
+// ContentPolicyAction says what happens to a file that violates the content policy of the job
+type ContentPolicyAction uint8
+
+func (ContentPolicyAction) Reject() ContentPolicyAction     { return ContentPolicyAction(0) }
+func (ContentPolicyAction) Quarantine() ContentPolicyAction { return ContentPolicyAction(1) }
+
+func (a *ContentPolicyAction) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(a), s, true)
+	if err == nil {
+		*a = val.(ContentPolicyAction)
+	}
+	return err
+}
+
+func (a ContentPolicyAction) String() string {
+	return enum.StringInt(a, reflect.TypeOf(a))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var EFolderCreationPolicy = FolderCreationPolicy(0)
+
+// FolderCreationPolicy says when the directories of the destination are created: as the first file in each is
+// transferred, or all of them before any files are
+type FolderCreationPolicy uint8
+
+func (FolderCreationPolicy) Lazy() FolderCreationPolicy  { return FolderCreationPolicy(0) }
+func (FolderCreationPolicy) Eager() FolderCreationPolicy { return FolderCreationPolicy(1) }
+
+func (p *FolderCreationPolicy) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(p), s, true)
+	if err == nil {
+		*p = val.(FolderCreationPolicy)
+	}
+	return err
+}
+
+func (p FolderCreationPolicy) String() string {
+	return enum.StringInt(p, reflect.TypeOf(p))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var EIPPreference = IPPreference(0)
+
+// IPPreference says which address families are used to connect, for networks where one of them is broken
+type IPPreference uint8
+
+func (IPPreference) Any() IPPreference        { return IPPreference(0) } // in the order given by the resolver
+func (IPPreference) PreferIPv4() IPPreference { return IPPreference(1) }
+func (IPPreference) PreferIPv6() IPPreference { return IPPreference(2) }
+func (IPPreference) IPv4Only() IPPreference   { return IPPreference(3) }
+func (IPPreference) IPv6Only() IPPreference   { return IPPreference(4) }
+
+func (p *IPPreference) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(p), s, true)
+	if err == nil {
+		*p = val.(IPPreference)
+	}
+	return err
+}
+
+func (p IPPreference) String() string {
+	return enum.StringInt(p, reflect.TypeOf(p))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var EAssertSourceUnchanged = AssertSourceUnchanged(0)
+
+// AssertSourceUnchanged says what fails when a source has changed between the scan and the end of its transfer:
+// nothing (beyond the usual checks), just that file, or the whole job
+type AssertSourceUnchanged uint8
+
+func (AssertSourceUnchanged) None() AssertSourceUnchanged { return AssertSourceUnchanged(0) }
+func (AssertSourceUnchanged) File() AssertSourceUnchanged { return AssertSourceUnchanged(1) }
+func (AssertSourceUnchanged) Job() AssertSourceUnchanged  { return AssertSourceUnchanged(2) }
+
+func (a *AssertSourceUnchanged) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(a), s, true)
+	if err == nil {
+		*a = val.(AssertSourceUnchanged)
+	}
+	return err
+}
+
+func (a AssertSourceUnchanged) String() string {
+	return enum.StringInt(a, reflect.TypeOf(a))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var EArchive = Archive(0)
+
+// Archive says whether a local directory is uploaded as a single tar blob (or a tar blob is extracted into a local directory),
+// and whether the tar is compressed
+type Archive uint8
+
+func (Archive) None() Archive  { return Archive(0) }
+func (Archive) Tar() Archive   { return Archive(1) }
+func (Archive) TarGz() Archive { return Archive(2) }
+
+func (a *Archive) Parse(s string) error {
+	// allow the usual spellings of the file extension, e.g. tar.gz
+	if strings.EqualFold(s, "tgz") {
+		s = "targz"
+	}
+	val, err := enum.Parse(reflect.TypeOf(a), strings.Replace(s, ".", "", -1), true)
+	if err == nil {
+		*a = val.(Archive)
+	}
+	return err
+}
+
+func (a Archive) String() string {
+	return enum.StringInt(a, reflect.TypeOf(a))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var ESyncCompare = SyncCompare(0)
+
+// SyncCompare is how sync decides whether an object that exists at both the source and the destination needs to be transferred
+type SyncCompare uint8
+
+func (SyncCompare) LastModifiedTime() SyncCompare { return SyncCompare(0) }
+func (SyncCompare) Hash() SyncCompare             { return SyncCompare(1) }
+
+func (c *SyncCompare) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(c), s, true)
+	if err == nil {
+		*c = val.(SyncCompare)
+	}
+	return err
+}
+
+func (c SyncCompare) String() string {
+	return enum.StringInt(c, reflect.TypeOf(c))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
 type OutputFormat uint32
 
 var EOutputFormat = OutputFormat(0)
@@ -236,8 +426,12 @@ func (OutputFormat) None() OutputFormat { return OutputFormat(0) }
 func (OutputFormat) Text() OutputFormat { return OutputFormat(1) }
 func (OutputFormat) Json() OutputFormat { return OutputFormat(2) }
 
+// PlainInterval prints a complete status line every so often, without carriage returns, for screen readers and CI logs
+func (OutputFormat) PlainInterval() OutputFormat { return OutputFormat(3) }
+
 func (of *OutputFormat) Parse(s string) error {
-	val, err := enum.Parse(reflect.TypeOf(of), s, true)
+	// allow the hyphenated spelling used on the command line, e.g. plain-interval
+	val, err := enum.Parse(reflect.TypeOf(of), strings.Replace(s, "-", "", -1), true)
 	if err == nil {
 		*of = val.(OutputFormat)
 	}
@@ -248,6 +442,62 @@ func (of OutputFormat) String() string {
 	return enum.StringInt(of, reflect.TypeOf(of))
 }
 
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+var ELogFormat = LogFormat(0)
+
+// LogFormat is the format of the job log file (not of the console output, which is OutputFormat)
+type LogFormat uint8
+
+func (LogFormat) Text() LogFormat { return LogFormat(0) }
+
+// Json writes one JSON object per line, for log collectors that would otherwise have to parse free-form text
+func (LogFormat) Json() LogFormat { return LogFormat(1) }
+
+func (lf *LogFormat) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(lf), s, true)
+	if err == nil {
+		*lf = val.(LogFormat)
+	}
+	return err
+}
+
+func (lf LogFormat) String() string {
+	return enum.StringInt(lf, reflect.TypeOf(lf))
+}
+
+var ELogCategory = LogCategory(0)
+
+// LogCategory is the kind of a message in a job log, so that each kind can be logged at a level of its own
+type LogCategory uint8
+
+// General is every message that doesn't belong to one of the other categories
+func (LogCategory) General() LogCategory { return LogCategory(0) }
+
+// Retry is the requests to the service (with their Try= numbers) and the retries of reading the bodies of responses
+func (LogCategory) Retry() LogCategory { return LogCategory(1) }
+
+// Enumeration is the messages of the scanning of the source
+func (LogCategory) Enumeration() LogCategory { return LogCategory(2) }
+
+// Chunk is the scheduling of transfers and the lifecycle of their chunks
+func (LogCategory) Chunk() LogCategory { return LogCategory(3) }
+
+// Auth is the choice of credentials and the refreshing of OAuth tokens
+func (LogCategory) Auth() LogCategory { return LogCategory(4) }
+
+func (lc *LogCategory) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(lc), s, true)
+	if err == nil {
+		*lc = val.(LogCategory)
+	}
+	return err
+}
+
+func (lc LogCategory) String() string {
+	return enum.StringInt(lc, reflect.TypeOf(lc))
+}
+
 var EExitCode = ExitCode(0)
 
 type ExitCode uint32
@@ -406,6 +656,8 @@ func (Location) File() Location      { return Location(4) }
 func (Location) BlobFS() Location    { return Location(5) }
 func (Location) S3() Location        { return Location(6) }
 func (Location) Benchmark() Location { return Location(7) }
+func (Location) Http() Location      { return Location(8) } // a file on any HTTP(S) server, read through AzCopy rather than by the service
+func (Location) Sftp() Location      { return Location(9) } // a file on an SFTP server, which AzCopy reads and writes itself, like a local file
 
 func (l Location) String() string {
 	return enum.StringInt(uint32(l), reflect.TypeOf(l))
@@ -422,7 +674,7 @@ func (l Location) IsRemote() bool {
 	switch l {
 	case ELocation.BlobFS(), ELocation.Blob(), ELocation.File(), ELocation.S3():
 		return true
-	case ELocation.Local(), ELocation.Benchmark(), ELocation.Pipe(), ELocation.Unknown():
+	case ELocation.Local(), ELocation.Benchmark(), ELocation.Pipe(), ELocation.Http(), ELocation.Sftp(), ELocation.Unknown():
 		return false
 	default:
 		panic("unexpected location, please specify if it is remote")
@@ -467,6 +719,10 @@ func (FromTo) FileBlob() FromTo    { return FromTo(fromToValue(ELocation.File(),
 func (FromTo) BlobFile() FromTo    { return FromTo(fromToValue(ELocation.Blob(), ELocation.File())) }
 func (FromTo) FileFile() FromTo    { return FromTo(fromToValue(ELocation.File(), ELocation.File())) }
 func (FromTo) S3Blob() FromTo      { return FromTo(fromToValue(ELocation.S3(), ELocation.Blob())) }
+func (FromTo) HttpBlob() FromTo    { return FromTo(fromToValue(ELocation.Http(), ELocation.Blob())) }
+func (FromTo) SftpBlob() FromTo    { return FromTo(fromToValue(ELocation.Sftp(), ELocation.Blob())) }
+func (FromTo) BlobSftp() FromTo    { return FromTo(fromToValue(ELocation.Blob(), ELocation.Sftp())) }
+func (FromTo) LocalLocal() FromTo  { return FromTo(fromToValue(ELocation.Local(), ELocation.Local())) }
 
 // todo: to we really want these?  Starts to look like a bit of a combinatorial explosion
 func (FromTo) BenchmarkBlob() FromTo {
@@ -527,6 +783,10 @@ func (ft *FromTo) IsUpload() bool {
 
 var BenchmarkLmt = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
 
+// CompressibleBenchmarkSourceHost is the host of the auto-generated source of data that compresses like text, rather than random data.
+// Like the host of the random data source, it's under .invalid, which is reserved for URLs that can't possibly be real
+const CompressibleBenchmarkSourceHost = "compressible.benchmark.invalid"
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Enumerates the values for blob type.
 type BlobType uint8
@@ -596,6 +856,15 @@ func (TransferStatus) SkippedFileAlreadyExists() TransferStatus { return Transfe
 
 func (TransferStatus) SkippedBlobHasSnapshots() TransferStatus { return TransferStatus(-4) }
 
+// Transfer was skipped because its source changed after it was scheduled, and the source change policy is Skip
+func (TransferStatus) SkippedSourceChanged() TransferStatus { return TransferStatus(-5) }
+
+// Transfer was skipped because the file violates the content policy of the job, and the policy action is Reject
+func (TransferStatus) SkippedContentPolicy() TransferStatus { return TransferStatus(-6) }
+
+// Transfer was skipped because the malware scan found the file infected, and the infected action is Reject
+func (TransferStatus) SkippedInfected() TransferStatus { return TransferStatus(-7) }
+
 func (ts TransferStatus) ShouldTransfer() bool {
 	return ts == ETransferStatus.NotStarted() || ts == ETransferStatus.Started()
 }
@@ -869,6 +1138,13 @@ type CopyTransfer struct {
 	// Properties for S2S blob copy
 	BlobType azblob.BlobType
 	BlobTier azblob.AccessTierType
+
+	// VersionID pins the transfer to one version of a blob source, when the source account has versioning enabled
+	VersionID string
+
+	// ETag of the source when it was scanned, recorded for blob sources, so that the job can check that they are unchanged
+	// when it asserts so, or when it is resumed after an account failover
+	ETag string
 }
 
 func NewCopyTransfer(
@@ -173,3 +173,15 @@ func (s *feSteModelsTestSuite) TestMetadataResolveInvalidKeyNegative(c *chk.C) {
 	_, err = mNegative3.ResolveInvalidKey()
 	c.Assert(err, chk.NotNil)
 }
+
+func (s *feSteModelsTestSuite) TestParseOutputFormat(c *chk.C) {
+	var format common.OutputFormat
+
+	c.Assert(format.Parse("plain-interval"), chk.IsNil)
+	c.Assert(format, chk.Equals, common.EOutputFormat.PlainInterval())
+	c.Assert(format.Parse("PlainInterval"), chk.IsNil)
+	c.Assert(format, chk.Equals, common.EOutputFormat.PlainInterval())
+	c.Assert(format.Parse("json"), chk.IsNil)
+	c.Assert(format, chk.Equals, common.EOutputFormat.Json())
+	c.Assert(format.Parse("plain"), chk.NotNil)
+}
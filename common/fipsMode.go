@@ -0,0 +1,138 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/minio/minio-go"
+)
+
+// In FIPS mode AzCopy only uses FIPS-approved cryptography, for customers (typically government ones) who are not
+// allowed to rely on anything else. Since MD5 is not approved, no MD5 hash is ever computed: put-md5 and check-md5
+// are rejected up front, and check-length is the remaining integrity check. TLS is restricted to version 1.2 with
+// AES-GCM cipher suites over the NIST curves, because those are the only settings that can be pinned down in
+// crypto/tls (the TLS 1.3 suites are not configurable, and include ChaCha20-Poly1305).
+// FIPS mode is turned on by AZCOPY_FIPS_MODE, or unconditionally in binaries built with the "fips" tag, which
+// is how builds that link against a validated crypto module should be produced.
+
+var ErrMD5NotAllowedInFIPSMode = errors.New("MD5 is not a FIPS-approved algorithm, so it cannot be used in FIPS mode")
+
+// FIPSModeEnabled reports whether AzCopy is running in FIPS mode. An invalid AZCOPY_FIPS_MODE is rejected by
+// ValidateFIPSMode when AzCopy starts, so here it is simply treated as not set.
+func FIPSModeEnabled() bool {
+	if fipsBuild {
+		return true
+	}
+	enabled, err := strconv.ParseBool(GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.FIPSMode()))
+	return err == nil && enabled
+}
+
+// ValidateFIPSMode is called at startup, so that a mistyped AZCOPY_FIPS_MODE fails loudly, instead of quietly
+// running without the restrictions the user asked for
+func ValidateFIPSMode() error {
+	raw := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.FIPSMode())
+	if raw == "" {
+		return nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("invalid value '%s' for %s. Use true or false", raw, EEnvironmentVariable.FIPSMode().Name)
+	}
+	if fipsBuild && !enabled {
+		return fmt.Errorf("this build of AzCopy always runs in FIPS mode, so %s cannot be set to false", EEnvironmentVariable.FIPSMode().Name)
+	}
+	return nil
+}
+
+// FIPSTLSConfig returns the TLS settings used for all connections in FIPS mode
+func FIPSTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		CurvePreferences: []tls.CurveID{tls.CurveP384, tls.CurveP256},
+	}
+}
+
+// TLSConfigForMode returns the TLS settings for a new HTTP transport. Nil means the Go defaults.
+func TLSConfigForMode() *tls.Config {
+	if FIPSModeEnabled() {
+		return FIPSTLSConfig()
+	}
+	return nil
+}
+
+// ApplyFIPSModeToDefaultTransports restricts the TLS settings of the shared transports that are used by HTTP clients
+// AzCopy does not build itself (e.g. the S3 client). It must be called at startup, before any request is made.
+func ApplyFIPSModeToDefaultTransports() {
+	if !FIPSModeEnabled() {
+		return
+	}
+	for _, rt := range []http.RoundTripper{http.DefaultTransport, minio.DefaultTransport} {
+		if t, ok := rt.(*http.Transport); ok {
+			t.TLSClientConfig = FIPSTLSConfig()
+		}
+	}
+}
+
+// ValidateHashOptionsForFIPS returns a clear error when the requested hash options need MD5 but FIPS mode is on
+func ValidateHashOptionsForFIPS(putMd5 bool, md5Option HashValidationOption) error {
+	if !FIPSModeEnabled() {
+		return nil
+	}
+	if putMd5 {
+		return fmt.Errorf("put-md5 cannot be used: %v. Use check-length to verify the transfers instead", ErrMD5NotAllowedInFIPSMode)
+	}
+	if md5Option != EHashValidationOption.NoCheck() {
+		return fmt.Errorf("check-md5 %s cannot be used: %v. Use check-md5 NoCheck, and check-length to verify the transfers instead", md5Option, ErrMD5NotAllowedInFIPSMode)
+	}
+	return nil
+}
+
+// FIPSModeValidationNotice tells the user, when a job starts in FIPS mode, how its transfers will be validated, since
+// without MD5 there is no hash to compare. It returns an empty string when FIPS mode is off
+func FIPSModeValidationNotice(checkLength bool) string {
+	if !FIPSModeEnabled() {
+		return ""
+	}
+	if !checkLength {
+		return "FIPS mode is on, so no MD5 hash is computed or compared, and check-length is off: the transferred files will not be validated at all."
+	}
+	return "FIPS mode is on, so no MD5 hash is computed or compared: the transferred files will only be validated by their length."
+}
+
+// DefaultHashValidationOptionForMode is the default of check-md5, which must not need MD5 in FIPS mode
+func DefaultHashValidationOptionForMode() HashValidationOption {
+	if FIPSModeEnabled() {
+		return EHashValidationOption.NoCheck()
+	}
+	return DefaultHashValidationOption
+}
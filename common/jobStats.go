@@ -0,0 +1,81 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// JobStatsRecord is the outcome of one run of a job (a job that is resumed has a record for each run), as kept in
+// the statistics of the jobs that have run on this machine. The records outlive the jobs, so that they can be used for
+// capacity planning, and to answer questions like how fast a link usually is
+type JobStatsRecord struct {
+	JobID               JobID     `json:"jobId"`
+	FromTo              string    `json:"fromTo"`
+	SourceEndpoint      string    `json:"sourceEndpoint"`
+	DestinationEndpoint string    `json:"destinationEndpoint"`
+	StartTime           time.Time `json:"startTime"`
+	EndTime             time.Time `json:"endTime"`
+	JobStatus           string    `json:"jobStatus"`
+	TransfersCompleted  uint32    `json:"transfersCompleted"`
+	TransfersFailed     uint32    `json:"transfersFailed"`
+	TransfersSkipped    uint32    `json:"transfersSkipped"`
+	BytesTransferred    uint64    `json:"bytesTransferred"` // of the transfers that completed in this run
+}
+
+// Duration is how long the run took
+func (r JobStatsRecord) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// ThroughputMbps is the average rate at which the run transferred data, in megabits per second
+func (r JobStatsRecord) ThroughputMbps() float64 {
+	seconds := r.Duration().Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(r.BytesTransferred) * 8 / (1000 * 1000) / seconds
+}
+
+// JobStatsFilePath is where the statistics of the jobs are kept. They are in the plan folder, but aren't removed with the plans of the jobs
+func JobStatsFilePath(planFolder string) string {
+	return path.Join(planFolder, "jobStats.jsonl")
+}
+
+// JobStatsEndpoint is what the statistics call the source or destination of a job: the host, for remote resources
+// (so that jobs between the same accounts can be compared), and just "local" for the local file system
+func JobStatsEndpoint(location Location, resource string) string {
+	switch location {
+	case ELocation.Local():
+		return "local"
+	case ELocation.Pipe():
+		return "pipe"
+	case ELocation.Benchmark():
+		return "benchmark"
+	}
+	if u, err := url.Parse(resource); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return "unknown"
+}
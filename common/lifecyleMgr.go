@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -54,6 +55,7 @@ type LifecycleMgr interface {
 	GetEnvironmentVariable(EnvironmentVariable) string           // get the environment variable or its default value
 	ClearEnvironmentVariable(EnvironmentVariable)                // clears the environment variable
 	SetOutputFormat(OutputFormat)                                // change the output format of the entire application
+	SetOutputInterval(time.Duration)                             // how often the plain-interval output format prints the progress
 	EnableInputWatcher()                                         // depending on the command, we may allow user to give input through Stdin
 	EnableCancelFromStdIn()                                      // allow user to send in `cancel` to stop the job
 }
@@ -69,6 +71,8 @@ type lifecycleMgr struct {
 	cancelChannel        chan os.Signal
 	waitEverCalled       int32
 	outputFormat         OutputFormat
+	outputInterval       time.Duration // used by the plain-interval output format
+	lastProgressPrinted  time.Time     // used by the plain-interval output format
 	logSanitizer         pipeline.LogSanitizer
 	inputQueue           chan userInput // msgs from the user
 	allowWatchInput      bool           // accept user inputs and place then in the inputQueue
@@ -140,6 +144,10 @@ func (lcm *lifecycleMgr) SetOutputFormat(format OutputFormat) {
 	lcm.outputFormat = format
 }
 
+func (lcm *lifecycleMgr) SetOutputInterval(interval time.Duration) {
+	lcm.outputInterval = interval
+}
+
 func (lcm *lifecycleMgr) checkAndStartCPUProfiling() {
 	// CPU Profiling add-on. Set AZCOPY_PROFILE_CPU to enable CPU profiling,
 	// the value AZCOPY_PROFILE_CPU indicates the path to save CPU profiling data.
@@ -233,7 +241,8 @@ func (lcm *lifecycleMgr) Prompt(message string, details PromptDetails) ResponseO
 		// in case the user misunderstood and typed full response type instead, we still tolerate it
 		// e.g. instead of "y", user typed "Yes"
 		if strings.EqualFold(option.ResponseString, rawResponse) ||
-			strings.EqualFold(option.UserFriendlyResponseType, rawResponse) {
+			strings.EqualFold(option.UserFriendlyResponseType, rawResponse) ||
+			strings.EqualFold(UserMessages().ResponseOptionText(option), rawResponse) {
 			return option
 		}
 	}
@@ -307,6 +316,8 @@ func (lcm *lifecycleMgr) processOutputMessage() {
 			lcm.processJSONOutput(msgToPrint)
 		case EOutputFormat.Text():
 			lcm.processTextOutput(msgToPrint)
+		case EOutputFormat.PlainInterval():
+			lcm.processPlainIntervalOutput(msgToPrint)
 		case EOutputFormat.None():
 			lcm.processNoneOutput(msgToPrint)
 		default:
@@ -315,11 +326,42 @@ func (lcm *lifecycleMgr) processOutputMessage() {
 	}
 }
 
+// exitProcess is the only way the lifecycle manager ends the process, so that whatever was staged on disk is cleaned up
+func exitProcess(code ExitCode) {
+	runExitHooks()
+	CleanupTempDir()
+	os.Exit(int(code))
+}
+
+var exitHooks struct {
+	lock  sync.Mutex
+	hooks []func()
+}
+
+// AtExit registers a function to run when the lifecycle manager ends the process, such as one that finishes writing a log.
+// The functions run in the order they were registered
+func AtExit(hook func()) {
+	exitHooks.lock.Lock()
+	defer exitHooks.lock.Unlock()
+	exitHooks.hooks = append(exitHooks.hooks, hook)
+}
+
+func runExitHooks() {
+	exitHooks.lock.Lock()
+	hooks := exitHooks.hooks
+	exitHooks.hooks = nil
+	exitHooks.lock.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
 func (lcm *lifecycleMgr) processNoneOutput(msgToOutput outputMessage) {
 	if msgToOutput.msgType == eOutputMessageType.Error() {
-		os.Exit(int(EExitCode.Error()))
+		exitProcess(EExitCode.Error())
 	} else if msgToOutput.shouldExitProcess() {
-		os.Exit(int(msgToOutput.exitCode))
+		exitProcess(msgToOutput.exitCode)
 	}
 
 	// ignore all other outputs
@@ -337,7 +379,7 @@ func (lcm *lifecycleMgr) processJSONOutput(msgToOutput outputMessage) {
 
 	// exit if needed
 	if msgToOutput.shouldExitProcess() {
-		os.Exit(int(msgToOutput.exitCode))
+		exitProcess(msgToOutput.exitCode)
 	} else if msgType == eOutputMessageType.Prompt() {
 		// read the response to the prompt and send it back through the channel
 		msgToOutput.inputChannel <- lcm.getInputAfterTime(questionTime)
@@ -363,7 +405,7 @@ func (lcm *lifecycleMgr) processTextOutput(msgToOutput outputMessage) {
 			fmt.Println("\n" + msgToOutput.msgContent)
 		}
 		if msgToOutput.shouldExitProcess() {
-			os.Exit(int(msgToOutput.exitCode))
+			exitProcess(msgToOutput.exitCode)
 		}
 
 	case eOutputMessageType.Progress():
@@ -409,10 +451,46 @@ func (lcm *lifecycleMgr) processTextOutput(msgToOutput outputMessage) {
 		}
 
 		// example output: Please confirm with: [Y] Yes  [N] No  [A] Yes for all  [L] No for all
-		fmt.Print(" Please confirm with:")
+		fmt.Print(UserMessages().Text(MsgPleaseConfirmWith))
+		for _, option := range msgToOutput.promptDetails.ResponseOptions {
+			fmt.Printf(" [%s] %s ", strings.ToUpper(option.ResponseString), UserMessages().ResponseOptionText(option))
+		}
+
+		// read the response to the prompt and send it back through the channel
+		msgToOutput.inputChannel <- lcm.getInputAfterTime(questionTime)
+	}
+}
+
+// processPlainIntervalOutput never rewrites the current line (i.e. no carriage returns or escape sequences), so that
+// screen readers and simple consoles can follow along. Instead, each progress update is a complete line of its own,
+// and at most one is printed per interval.
+func (lcm *lifecycleMgr) processPlainIntervalOutput(msgToOutput outputMessage) {
+	switch msgToOutput.msgType {
+	case eOutputMessageType.Error(), eOutputMessageType.EndOfJob():
+		if msgToOutput.msgContent != "" {
+			fmt.Println(msgToOutput.msgContent)
+		}
+		if msgToOutput.shouldExitProcess() {
+			exitProcess(msgToOutput.exitCode)
+		}
+
+	case eOutputMessageType.Progress():
+		if time.Since(lcm.lastProgressPrinted) >= lcm.outputInterval {
+			fmt.Println(msgToOutput.msgContent)
+			lcm.lastProgressPrinted = time.Now()
+		}
+
+	case eOutputMessageType.Init(), eOutputMessageType.Info():
+		fmt.Println(msgToOutput.msgContent)
+
+	case eOutputMessageType.Prompt():
+		questionTime := time.Now()
+		fmt.Println(msgToOutput.msgContent)
+		fmt.Print(strings.TrimSpace(UserMessages().Text(MsgPleaseConfirmWith)))
 		for _, option := range msgToOutput.promptDetails.ResponseOptions {
-			fmt.Printf(" [%s] %s ", strings.ToUpper(option.ResponseString), option.UserFriendlyResponseType)
+			fmt.Printf(" [%s] %s", strings.ToUpper(option.ResponseString), UserMessages().ResponseOptionText(option))
 		}
+		fmt.Println()
 
 		// read the response to the prompt and send it back through the channel
 		msgToOutput.inputChannel <- lcm.getInputAfterTime(questionTime)
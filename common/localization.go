@@ -0,0 +1,257 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// User-facing text (progress, prompts, errors and job summaries) is looked up by key in a message catalog, so that it
+// can be shown in the user's language. Log files are read by support engineers, so they are kept in English by
+// default, using a separate localizer that only follows AZCOPY_LOG_LANGUAGE.
+// JSON output is for other programs, and is never localized.
+//
+// To add a translation, create a file such as localization_de.go that calls RegisterTranslation from its init function.
+// Any key that a translation leaves out is shown in English.
+
+type MessageKey string
+
+type MessageCatalog map[MessageKey]string
+
+const (
+	MsgCopyProgress              MessageKey = "CopyProgress"
+	MsgSyncProgress              MessageKey = "SyncProgress"
+	MsgCopyJobSummary            MessageKey = "CopyJobSummary"
+	MsgSyncJobSummary            MessageKey = "SyncJobSummary"
+	MsgPleaseConfirmWith         MessageKey = "PleaseConfirmWith"
+	MsgResponseYes               MessageKey = "ResponseYes"
+	MsgResponseNo                MessageKey = "ResponseNo"
+	MsgResponseYesForAll         MessageKey = "ResponseYesForAll"
+	MsgResponseNoForAll          MessageKey = "ResponseNoForAll"
+	MsgOverwritePrompt           MessageKey = "OverwritePrompt"
+	MsgOverwriteConfirmed        MessageKey = "OverwriteConfirmed"
+	MsgOverwriteAllConfirmed     MessageKey = "OverwriteAllConfirmed"
+	MsgOverwriteDeclined         MessageKey = "OverwriteDeclined"
+	MsgOverwriteAllDeclined      MessageKey = "OverwriteAllDeclined"
+	MsgOverwriteUnrecognized     MessageKey = "OverwriteUnrecognized"
+	MsgDeleteAtDestinationPrompt MessageKey = "DeleteAtDestinationPrompt"
+	MsgCancelCopyPrompt          MessageKey = "CancelCopyPrompt"
+	MsgCancelSyncPrompt          MessageKey = "CancelSyncPrompt"
+	MsgFailedToParseInput        MessageKey = "FailedToParseInput"
+	MsgFailedToPerformCommand    MessageKey = "FailedToPerformCommand"
+)
+
+// englishMessages is the reference catalog. Every key must be here, and every translation must use the same
+// formatting verbs, in the same order, as the English text.
+var englishMessages = MessageCatalog{
+	MsgCopyProgress: "%.1f %%, %v Done, %v Failed, %v Pending, %v Skipped, %v Total%s, %s%s%s",
+	MsgSyncProgress: "%.1f %%, %v Done, %v Failed, %v Pending, %v Total%s, 2-sec Throughput (Mb/s): %v%s",
+	MsgCopyJobSummary: `
+
+Job %s summary
+Elapsed Time (Minutes): %v
+Total Number Of Transfers: %v
+Number of Transfers Completed: %v
+Number of Transfers Failed: %v
+Number of Transfers Skipped: %v
+TotalBytesTransferred: %v
+Final Job Status: %v%s%s%s%s%s%s%s%s
+`,
+	MsgSyncJobSummary: `
+Job %s Summary
+Files Scanned at Source: %v
+Files Scanned at Destination: %v
+Elapsed Time (Minutes): %v
+Total Number Of Copy Transfers: %v
+Number of Copy Transfers Completed: %v
+Number of Copy Transfers Failed: %v
+Number of Deletions at Destination: %v%s
+Total Number of Bytes Transferred: %v
+Total Number of Bytes Enumerated: %v
+Final Job Status: %v%s%s%s
+`,
+	MsgPleaseConfirmWith:         " Please confirm with:",
+	MsgResponseYes:               "Yes",
+	MsgResponseNo:                "No",
+	MsgResponseYesForAll:         "Yes for all",
+	MsgResponseNoForAll:          "No for all",
+	MsgOverwritePrompt:           "%s already exists at the destination. Do you wish to overwrite?",
+	MsgOverwriteConfirmed:        "Confirmed. %s will be overwritten.",
+	MsgOverwriteAllConfirmed:     "Confirmed. All future conflicts will be overwritten.",
+	MsgOverwriteDeclined:         "%s will be skipped",
+	MsgOverwriteAllDeclined:      "No overwriting will happen from now onwards.",
+	MsgOverwriteUnrecognized:     "Unrecognizable answer, skipping %s.",
+	MsgDeleteAtDestinationPrompt: "The %s '%s' does not exist at the source. Do you wish to delete it from the destination(%s)?",
+	MsgCancelCopyPrompt:          "The source enumeration is not complete, cancelling the job at this point means it cannot be resumed.",
+	MsgCancelSyncPrompt:          "The enumeration (source/destination comparison) is not complete, cancelling the job at this point means it cannot be resumed.",
+	MsgFailedToParseInput:        "failed to parse user input due to error: %s",
+	MsgFailedToPerformCommand:    "failed to perform %s command due to error: %s",
+}
+
+const englishLocale = "en"
+
+var translationsLock sync.RWMutex
+var translations = map[string]MessageCatalog{englishLocale: englishMessages}
+
+var formatVerbRegex = regexp.MustCompile(`%[-+# 0-9.*\[\]]*[a-zA-Z%]`)
+
+// RegisterTranslation adds the messages of a locale, e.g. "de" or "pt-BR". Messages with unknown keys, or whose
+// formatting verbs don't match the English text, are left out (so the English text is shown instead), and returned
+// as an error so that tests of the translation can catch them.
+func RegisterTranslation(locale string, catalog MessageCatalog) error {
+	locale = NormalizeLocale(locale)
+	accepted := MessageCatalog{}
+	var rejected []string
+	for key, text := range catalog {
+		english, ok := englishMessages[key]
+		if !ok || strings.Join(formatVerbRegex.FindAllString(text, -1), "") != strings.Join(formatVerbRegex.FindAllString(english, -1), "") {
+			rejected = append(rejected, string(key))
+			continue
+		}
+		accepted[key] = text
+	}
+
+	translationsLock.Lock()
+	defer translationsLock.Unlock()
+	if existing, ok := translations[locale]; ok {
+		for key, text := range accepted {
+			existing[key] = text
+		}
+	} else {
+		translations[locale] = accepted
+	}
+
+	if len(rejected) > 0 {
+		return fmt.Errorf("the %s translation of these messages is not valid, so they will be shown in English: %s", locale, strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// NormalizeLocale turns POSIX locale names such as de_DE.UTF-8@euro into the form used by the catalogs, e.g. de-DE.
+// The C and POSIX locales mean English.
+func NormalizeLocale(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	locale = strings.Replace(strings.TrimSpace(locale), "_", "-", -1)
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return englishLocale
+	}
+
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i])
+	}
+	return strings.Join(parts, "-")
+}
+
+// DetectLocale works out the user's language: AZCOPY_LANGUAGE wins, and otherwise the usual POSIX variables are
+// consulted in their standard order of precedence. Without any of them, English is used.
+func DetectLocale() string {
+	// os.Getenv is used rather than the lifecycle manager, since the lifecycle manager needs the localizers itself
+	for _, name := range []string{EEnvironmentVariable.Language().Name, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return NormalizeLocale(value)
+		}
+	}
+	return englishLocale
+}
+
+// Localizer formats messages in one locale, falling back to the language without its region (e.g. from pt-BR to pt),
+// and then to English
+type Localizer struct {
+	locale string
+}
+
+func NewLocalizer(locale string) Localizer {
+	return Localizer{locale: NormalizeLocale(locale)}
+}
+
+func (l Localizer) Locale() string {
+	return l.locale
+}
+
+func (l Localizer) Text(key MessageKey) string {
+	translationsLock.RLock()
+	defer translationsLock.RUnlock()
+
+	candidates := []string{l.locale}
+	if i := strings.Index(l.locale, "-"); i > 0 {
+		candidates = append(candidates, l.locale[:i])
+	}
+	for _, locale := range candidates {
+		if text, ok := translations[locale][key]; ok {
+			return text
+		}
+	}
+	if text, ok := englishMessages[key]; ok {
+		return text
+	}
+	return string(key) // a missing key is a bug, but showing the key is more helpful than showing nothing
+}
+
+func (l Localizer) Sprintf(key MessageKey, a ...interface{}) string {
+	return fmt.Sprintf(l.Text(key), a...)
+}
+
+var userLocalizer, logLocalizer Localizer
+var localizersOnce sync.Once
+
+func initLocalizers() {
+	localizersOnce.Do(func() {
+		userLocalizer = NewLocalizer(DetectLocale())
+		logLocalizer = NewLocalizer(os.Getenv(EEnvironmentVariable.LogLanguage().Name))
+	})
+}
+
+// UserMessages is the localizer for everything shown on the console
+func UserMessages() Localizer {
+	initLocalizers()
+	return userLocalizer
+}
+
+// LogMessages is the localizer for text written to log files, which is English unless AZCOPY_LOG_LANGUAGE says otherwise
+func LogMessages() Localizer {
+	initLocalizers()
+	return logLocalizer
+}
+
+// ResponseOptionText is the text shown for a prompt option. The options themselves are not localized, since their
+// values are compared, and are part of the JSON output.
+func (l Localizer) ResponseOptionText(option ResponseOption) string {
+	switch option {
+	case EResponseOption.Yes():
+		return l.Text(MsgResponseYes)
+	case EResponseOption.No():
+		return l.Text(MsgResponseNo)
+	case EResponseOption.YesForAll():
+		return l.Text(MsgResponseYesForAll)
+	case EResponseOption.NoForAll():
+		return l.Text(MsgResponseNoForAll)
+	default:
+		return option.UserFriendlyResponseType
+	}
+}
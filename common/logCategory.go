@@ -0,0 +1,88 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+// LogCategoryLevels holds the levels of the categories that aren't logged at the level of the job,
+// e.g. so that retries are only logged when they fail, while the progress of scanning is still logged
+type LogCategoryLevels map[LogCategory]pipeline.LogLevel
+
+// ParseLogCategoryLevels parses levels in the form category=level, separated by semicolons, e.g. retry=WARNING;enumeration=INFO
+func ParseLogCategoryLevels(s string) (LogCategoryLevels, error) {
+	levels := LogCategoryLevels{}
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		equals := strings.Index(pair, "=")
+		if equals < 0 {
+			return nil, fmt.Errorf("'%s' is not in the form category=level", pair)
+		}
+		var category LogCategory
+		if err := category.Parse(strings.TrimSpace(pair[:equals])); err != nil {
+			return nil, fmt.Errorf("unknown log category '%s'. Valid values are general, retry, enumeration, chunk and auth", pair[:equals])
+		}
+		var level LogLevel
+		if err := level.Parse(strings.TrimSpace(pair[equals+1:])); err != nil {
+			return nil, fmt.Errorf("invalid log level '%s' for the %s category", pair[equals+1:], category)
+		}
+		levels[category] = level.ToPipelineLogLevel()
+	}
+	return levels, nil
+}
+
+// the levels of the categories of the job logs created from now on. Set from the command line, or AZCOPY_LOG_CATEGORY_LEVELS
+var jobLogCategoryLevels = LogCategoryLevels{}
+
+func SetJobLogCategoryLevels(levels LogCategoryLevels) {
+	jobLogCategoryLevels = levels
+}
+
+// ResolveJobLogCategoryLevels returns the levels given on the command line, or, if there were none, in AZCOPY_LOG_CATEGORY_LEVELS
+func ResolveJobLogCategoryLevels(cmdLineValue string) (LogCategoryLevels, error) {
+	raw := cmdLineValue
+	if raw == "" {
+		raw = GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.LogCategoryLevels())
+	}
+	return ParseLogCategoryLevels(raw)
+}
+
+// ICategoryLogger logs messages of a category at the level of that category
+type ICategoryLogger interface {
+	ShouldLogCategory(category LogCategory, level pipeline.LogLevel) bool
+	LogWithCategory(category LogCategory, level pipeline.LogLevel, msg string)
+}
+
+// LogWithCategory logs the message in the category if the logger has categories, and as a general message if it hasn't
+func LogWithCategory(logger ILogger, category LogCategory, level pipeline.LogLevel, msg string) {
+	if cl, ok := logger.(ICategoryLogger); ok {
+		cl.LogWithCategory(category, level, msg)
+		return
+	}
+	logger.Log(level, msg)
+}
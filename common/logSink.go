@@ -0,0 +1,80 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+// LogSink receives a copy of the job log entries that are warnings or worse, so that they can be seen somewhere
+// other than the job's own log file, such as the system log
+type LogSink interface {
+	LogEntry(level pipeline.LogLevel, jobID JobID, msg string)
+}
+
+// the sinks given to the job loggers created from now on
+var jobLogSinks = make([]LogSink, 0)
+var jobLogSinksLock sync.Mutex
+
+// RegisterJobLogSink adds a sink to all job logs created from now on
+func RegisterJobLogSink(sink LogSink) {
+	jobLogSinksLock.Lock()
+	defer jobLogSinksLock.Unlock()
+	jobLogSinks = append(jobLogSinks, sink)
+}
+
+func registeredJobLogSinks() []LogSink {
+	jobLogSinksLock.Lock()
+	defer jobLogSinksLock.Unlock()
+	return append([]LogSink{}, jobLogSinks...)
+}
+
+// shouldMirrorToSinks says whether a log entry of the level is copied to the sinks
+func shouldMirrorToSinks(level pipeline.LogLevel) bool {
+	return level != pipeline.LogNone && level <= pipeline.LogWarning
+}
+
+// SetupSystemLogSink mirrors the warnings and errors of jobs to syslog (on Linux and macOS), or the Windows Event Log,
+// if AZCOPY_SYSTEM_LOG says so
+func SetupSystemLogSink() error {
+	raw := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.SystemLog())
+	if raw == "" {
+		return nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s '%s'. It must be true or false", EEnvironmentVariable.SystemLog().Name, raw)
+	}
+	if !enabled {
+		return nil
+	}
+
+	sink, err := newSystemLogSink()
+	if err != nil {
+		return fmt.Errorf("cannot write to the system log, as %s asks: %v", EEnvironmentVariable.SystemLog().Name, err)
+	}
+	RegisterJobLogSink(sink)
+	return nil
+}
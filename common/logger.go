@@ -21,11 +21,13 @@
 package common
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
-	"path"
 	"runtime"
 	"strings"
 	"time"
@@ -48,6 +50,16 @@ type ILoggerResetable interface {
 	OpenLog()
 	MinimumLogLevel() pipeline.LogLevel
 	ILoggerCloser
+	ITransferLogger
+	ICategoryLogger
+	LogTransferWithCategory(category LogCategory, level pipeline.LogLevel, partNum PartNumber, transferIndex uint32, msg string)
+	AddSink(sink LogSink)
+	CloseRemoteLog()
+}
+
+// ITransferLogger logs messages that are about one transfer, so that the logger can record which transfer it was
+type ITransferLogger interface {
+	LogTransfer(level pipeline.LogLevel, partNum PartNumber, transferIndex uint32, msg string)
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -107,11 +119,47 @@ type jobLogger struct {
 	// any message with severity higher than this will be ignored.
 	jobID             JobID
 	minimumLevelToLog pipeline.LogLevel // The maximum customer-desired log level for this job
-	file              *os.File          // The job's log file
+	categoryLevels    LogCategoryLevels // The levels of the categories that aren't logged at minimumLevelToLog
+	file              *rotatingLogFile  // The job's log file
 	logFileFolder     string            // The log file's parent folder, needed for opening the file at the right place
 	logger            *log.Logger       // The Job's logger
 	appLogger         ILogger
 	sanitizer         pipeline.LogSanitizer
+	format            LogFormat
+	rotation          LogRotationOptions
+	sinks             []LogSink // also get the warnings and errors
+	remoteLocation    string    // container that the log is also streamed to, if any
+	remote            *appendBlobLogWriter
+}
+
+// the format of the job logs created from now on. Set from the command line, or AZCOPY_LOG_FORMAT
+var jobLogFormat = ELogFormat.Text()
+
+func SetJobLogFormat(format LogFormat) {
+	jobLogFormat = format
+}
+
+// ResolveJobLogFormat returns the log format named on the command line, or, if there was none, in AZCOPY_LOG_FORMAT
+func ResolveJobLogFormat(cmdLineValue string) (LogFormat, error) {
+	raw := cmdLineValue
+	if raw == "" {
+		raw = GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.LogFormat())
+	}
+	var format LogFormat
+	if err := format.Parse(raw); err != nil {
+		return format, fmt.Errorf("invalid log format '%s'. Valid values are text and json", raw)
+	}
+	return format, nil
+}
+
+// jsonLogEntry is one line of a job log in the JSON format
+type jsonLogEntry struct {
+	Time          string      `json:"time"`
+	Level         string      `json:"level"`
+	JobID         string      `json:"jobId"`
+	PartNum       *PartNumber `json:"partNum,omitempty"`
+	TransferIndex *uint32     `json:"transferIndex,omitempty"`
+	Message       string      `json:"message"`
 }
 
 func NewJobLogger(jobID JobID, minimumLevelToLog LogLevel, appLogger ILogger, logFileFolder string) ILoggerResetable {
@@ -123,71 +171,196 @@ func NewJobLogger(jobID JobID, minimumLevelToLog LogLevel, appLogger ILogger, lo
 		jobID:             jobID,
 		appLogger:         appLogger, // Panics are recorded in the job log AND in the app log
 		minimumLevelToLog: minimumLevelToLog.ToPipelineLogLevel(),
+		categoryLevels:    jobLogCategoryLevels,
 		logFileFolder:     logFileFolder,
 		sanitizer:         NewAzCopyLogSanitizer(),
+		format:            jobLogFormat,
+		rotation:          jobLogRotation,
+		sinks:             registeredJobLogSinks(),
+		remoteLocation:    jobLogRemoteLocation,
 	}
 }
 
 func (jl *jobLogger) OpenLog() {
-	if jl.minimumLevelToLog == pipeline.LogNone {
+	if jl.MinimumLogLevel() == pipeline.LogNone {
 		return
 	}
 
-	file, err := os.OpenFile(path.Join(jl.logFileFolder, jl.jobID.String()+".log"),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND, DEFAULT_FILE_PERM)
+	file, err := openRotatingLogFile(jl.logFileFolder, jl.jobID.String(), jl.rotation)
 	PanicIfErr(err)
 
 	jl.file = file
+	// nothing else closes the log of a job, and closing it is what compresses it (if the log is to be compressed)
+	AtExit(func() { _ = jl.closeLog() })
 
 	flags := log.LstdFlags | log.LUTC
+	if jl.format == ELogFormat.Json() {
+		// each entry carries its own timestamp
+		flags = 0
+	}
 	utcMessage := fmt.Sprintf("Log times are in UTC. Local time is " + time.Now().Format("2 Jan 2006 15:04:05"))
 
-	jl.logger = log.New(jl.file, "", flags)
+	var out io.Writer = jl.file
+	if jl.remoteLocation != "" {
+		blobURL, err := remoteLogBlobURL(jl.remoteLocation, jl.jobID)
+		PanicIfErr(err) // the location was checked when it was set
+		jl.remote = newAppendBlobLogWriter(blobURL)
+		out = io.MultiWriter(jl.file, jl.remote)
+	}
+
+	jl.logger = log.New(out, "", flags)
 	// Log the Azcopy Version
-	jl.logger.Println("AzcopyVersion ", AzcopyVersion)
+	jl.println(pipeline.LogInfo, fmt.Sprintln("AzcopyVersion ", AzcopyVersion))
 	// Log the OS Environment and OS Architecture
-	jl.logger.Println("OS-Environment ", runtime.GOOS)
-	jl.logger.Println("OS-Architecture ", runtime.GOARCH)
-	jl.logger.Println(utcMessage)
+	jl.println(pipeline.LogInfo, fmt.Sprintln("OS-Environment ", runtime.GOOS))
+	jl.println(pipeline.LogInfo, fmt.Sprintln("OS-Architecture ", runtime.GOARCH))
+	if FIPSModeEnabled() {
+		jl.println(pipeline.LogInfo, "FIPS mode is on: MD5 is not used, so transfers are only validated by their length, and TLS is restricted to FIPS-approved settings")
+	}
+	jl.println(pipeline.LogInfo, utcMessage)
+	if jl.remote != nil {
+		jl.println(pipeline.LogInfo, "This log is also streamed to "+jl.remote.location())
+	}
 }
 
+// AddSink mirrors the warnings and errors of this job to the sink. It must be called before the job logs anything
+func (jl *jobLogger) AddSink(sink LogSink) {
+	jl.sinks = append(jl.sinks, sink)
+}
+
+// MinimumLogLevel returns the most verbose level that any category is logged at
 func (jl *jobLogger) MinimumLogLevel() pipeline.LogLevel {
-	return jl.minimumLevelToLog
+	level := jl.minimumLevelToLog
+	for _, l := range jl.categoryLevels {
+		if l > level {
+			level = l
+		}
+	}
+	return level
 }
 
+// ShouldLog is true if a message of the level would be logged in any category, since the callers use it
+// to skip building messages that won't be logged at all
 func (jl *jobLogger) ShouldLog(level pipeline.LogLevel) bool {
 	if level == pipeline.LogNone {
 		return false
 	}
-	return level <= jl.minimumLevelToLog
+	return level <= jl.MinimumLogLevel()
+}
+
+func (jl *jobLogger) ShouldLogCategory(category LogCategory, level pipeline.LogLevel) bool {
+	if level == pipeline.LogNone {
+		return false
+	}
+	minimumLevel, ok := jl.categoryLevels[category]
+	if !ok {
+		minimumLevel = jl.minimumLevelToLog
+	}
+	return level <= minimumLevel
 }
 
 func (jl *jobLogger) CloseLog() {
-	jl.logger.Println("Closing Log")
-	err := jl.file.Close()
-	PanicIfErr(err)
+	PanicIfErr(jl.closeLog())
+}
+
+// CloseRemoteLog sends what's buffered for the remote copy of the log, if there is one, and stops sending it in the background.
+// It's called when the job completes. Anything logged after that is sent when the log is closed
+func (jl *jobLogger) CloseRemoteLog() {
+	if jl.remote != nil {
+		_ = jl.remote.Close()
+	}
+}
+
+// closeLog closes the log, if it's open. Closing it again does nothing
+func (jl *jobLogger) closeLog() error {
+	if jl.file == nil || jl.file.isClosed() {
+		return nil
+	}
+	jl.println(pipeline.LogInfo, "Closing Log")
+	if jl.remote != nil {
+		_ = jl.remote.Close()
+	}
+	return jl.file.Close()
 }
 
 func (jl jobLogger) Log(loglevel pipeline.LogLevel, msg string) {
+	jl.logEntry(ELogCategory.General(), loglevel, nil, nil, msg)
+}
+
+func (jl jobLogger) LogWithCategory(category LogCategory, loglevel pipeline.LogLevel, msg string) {
+	jl.logEntry(category, loglevel, nil, nil, msg)
+}
+
+// LogTransfer logs a message about one transfer. Text logs show the part and transfer in a prefix,
+// JSON logs in fields of their own.
+func (jl jobLogger) LogTransfer(loglevel pipeline.LogLevel, partNum PartNumber, transferIndex uint32, msg string) {
+	jl.LogTransferWithCategory(ELogCategory.General(), loglevel, partNum, transferIndex, msg)
+}
+
+func (jl jobLogger) LogTransferWithCategory(category LogCategory, loglevel pipeline.LogLevel, partNum PartNumber, transferIndex uint32, msg string) {
+	if jl.format == ELogFormat.Json() {
+		jl.logEntry(category, loglevel, &partNum, &transferIndex, msg)
+		return
+	}
+	jl.logEntry(category, loglevel, nil, nil, fmt.Sprintf("%s: [P#%d-T#%d] ", LogLevel(loglevel), partNum, transferIndex)+msg)
+}
+
+func (jl jobLogger) logEntry(category LogCategory, loglevel pipeline.LogLevel, partNum *PartNumber, transferIndex *uint32, msg string) {
 	// If the logger for Job is not initialized i.e file is not open
 	// or logger instance is not initialized, then initialize it
 
 	// ensure all secrets are redacted
 	msg = jl.sanitizer.SanitizeLogMessage(msg)
 
-	// Go, and therefore the sdk, defaults to \n for line endings, so if the platform has a different line ending,
-	// we should replace them to ensure readability on the given platform.
-	if lineEnding != "\n" {
-		msg = strings.Replace(msg, "\n", lineEnding, -1)
+	if jl.ShouldLogCategory(category, loglevel) {
+		jl.write(loglevel, partNum, transferIndex, msg)
+		if shouldMirrorToSinks(loglevel) {
+			for _, sink := range jl.sinks {
+				sink.LogEntry(loglevel, jl.jobID, msg)
+			}
+		}
+	}
+}
+
+// println writes the line whatever the log level, as the header and footer of the log do
+func (jl jobLogger) println(loglevel pipeline.LogLevel, msg string) {
+	jl.write(loglevel, nil, nil, strings.TrimSuffix(msg, "\n"))
+}
+
+func (jl jobLogger) write(loglevel pipeline.LogLevel, partNum *PartNumber, transferIndex *uint32, msg string) {
+	if jl.format != ELogFormat.Json() {
+		// Go, and therefore the sdk, defaults to \n for line endings, so if the platform has a different line ending,
+		// we should replace them to ensure readability on the given platform.
+		if lineEnding != "\n" {
+			msg = strings.Replace(msg, "\n", lineEnding, -1)
+		}
+		jl.logger.Println(msg)
+		return
 	}
-	if jl.ShouldLog(loglevel) {
+
+	// JSON escapes the line endings within the message, so each entry stays on one line
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false) // URLs in messages are easier to read with their & intact
+	err := enc.Encode(jsonLogEntry{
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+		Level:         LogLevel(loglevel).String(),
+		JobID:         jl.jobID.String(),
+		PartNum:       partNum,
+		TransferIndex: transferIndex,
+		Message:       msg,
+	})
+	if err != nil {
+		// there's nothing in the entry that can fail to encode, but don't lose the message if somehow it does
 		jl.logger.Println(msg)
+		return
 	}
+	jl.logger.Print(buf.String()) // Print does not add a second line ending, since the encoder's is there
 }
 
 func (jl jobLogger) Panic(err error) {
-	jl.logger.Println(err)  // We do NOT panic here as the app would terminate; we just log it
-	jl.appLogger.Panic(err) // We panic here that it logs and the app terminates
+	jl.println(pipeline.LogPanic, fmt.Sprint(err)) // We do NOT panic here as the app would terminate; we just log it
+	jl.appLogger.Panic(err)                        // We panic here that it logs and the app terminates
 	// We should never reach this line of code!
 }
 
@@ -201,7 +374,7 @@ func NewReadLogFunc(logger ILogger, fullUrl *url.URL) func(int, error, int64, in
 		if !willRetry {
 			retryMessage = "Will NOT retry"
 		}
-		logger.Log(pipeline.LogInfo, fmt.Sprintf(
+		LogWithCategory(logger, ELogCategory.Retry(), pipeline.LogInfo, fmt.Sprintf(
 			"Error reading body of reply. Next try (if any) will be %s%d. %s. Error: %s. Offset: %d  Count: %d URL: %s",
 			TryEquals, // so that retry wording for body-read retries is similar to that for URL-hitting retries
 
@@ -35,6 +35,8 @@ type MMF struct {
 	slice []byte
 	// defines whether source has been mapped or not
 	isMapped bool
+	// defines whether the slice is ordinary memory rather than a mapping of a file (see NewMemoryMMF)
+	inMemory bool
 	// This lock exists to fix a bug in Go's Http Client. Because the http
 	// client executes some operations asynchronously (via goroutines), it
 	// sometimes attempts to read from the http request stream AFTER the MMF
@@ -65,6 +67,12 @@ func NewMMF(file *os.File, writable bool, offset int64, length int64) (*MMF, err
 // the MMF is unusable.
 func (m *MMF) Unmap() {
 	m.lock.Lock()
+	if m.inMemory {
+		m.slice = nil
+		m.isMapped = false
+		m.lock.Unlock()
+		return
+	}
 	err := syscall.Munmap(m.slice)
 	m.slice = nil
 	PanicIfErr(err)
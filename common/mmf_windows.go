@@ -37,6 +37,8 @@ type MMF struct {
 	length int64
 	// defines whether source has been mapped or not
 	isMapped bool
+	// defines whether the slice is ordinary memory rather than a mapping of a file (see NewMemoryMMF)
+	inMemory bool
 	// This lock exists to fix a bug in Go's Http Client. Because the http
 	// client executes some operations asynchronously (via goroutines), it
 	// sometimes attempts to read from the http request stream AFTER the MMF
@@ -65,7 +67,7 @@ func NewMMF(file *os.File, writable bool, offset int64, length int64) (*MMF, err
 
 	if !writable {
 		// pre-fetch the memory mapped file so that performance is better when it is read
-		err := prefetchVirtualMemory(&memoryRangeEntry{VirtualAddress: addr, NumberOfBytes: int(length)})
+		err := prefetchVirtualMemory(&memoryRangeEntry{VirtualAddress: addr, NumberOfBytes: uintptr(length)})
 		if err != nil {
 			panic(err)
 		}
@@ -84,6 +86,12 @@ func NewMMF(file *os.File, writable bool, offset int64, length int64) (*MMF, err
 // the MMF is unusable.
 func (m *MMF) Unmap() {
 	m.lock.Lock()
+	if m.inMemory {
+		m.slice = nil
+		m.isMapped = false
+		m.lock.Unlock()
+		return
+	}
 	addr := uintptr(unsafe.Pointer(&(([]byte)(m.slice)[0])))
 	m.slice = []byte{}
 	// Modified pages in the unmapped view are not written to disk until their share count
@@ -120,7 +128,7 @@ func (m *MMF) Slice() []byte {
 
 type memoryRangeEntry struct {
 	VirtualAddress uintptr
-	NumberOfBytes  int
+	NumberOfBytes  uintptr // a SIZE_T, i.e. pointer-sized on every architecture, including arm64
 }
 
 var procPrefetchVirtualMemory *syscall.Proc
@@ -22,6 +22,7 @@ package common
 
 import (
 	"math/bits"
+	"sync/atomic"
 )
 
 // A pool of byte slices
@@ -62,12 +63,14 @@ func (p *simpleSlicePool) Get() []byte {
 	}
 }
 
-func (p *simpleSlicePool) Put(b []byte) {
+// Put returns false if b was thrown away, rather than pooled
+func (p *simpleSlicePool) Put(b []byte) bool {
 	select {
 	case p.c <- b:
-		return
+		return true
 	default:
 		// just throw b away and let it get GC'd if p.c is full
+		return false
 	}
 }
 
@@ -77,6 +80,11 @@ func (p *simpleSlicePool) Put(b []byte) {
 // (E.g. if only had one pool, holding really big slices, it would be wasteful when
 // we only need to put put small amounts of data into them).
 type multiSizeSlicePool struct {
+	// the total capacity of the slices that are sitting in the pool, waiting to be reused. Only tracked if there's a limit on it
+	// (kept first in the struct, so that it's 64-bit aligned on 32-bit platforms)
+	atomicPooledBytes int64
+	maxPooledBytes    int64
+
 	// It is safe for multiple readers to read this, once we have populated it
 	// See https://groups.google.com/forum/#!topic/golang-nuts/nL8z96SXcDs
 	poolsBySize []*simpleSlicePool
@@ -84,13 +92,19 @@ type multiSizeSlicePool struct {
 
 // Create new slice pool capable of pooling slices up to maxSliceLength in size
 func NewMultiSizeSlicePool(maxSliceLength uint32) ByteSlicePooler {
+	return NewMultiSizeSlicePoolWithLimit(maxSliceLength, 0)
+}
+
+// NewMultiSizeSlicePoolWithLimit creates a slice pool that never holds more than maxPooledBytes of unused slices in total.
+// Slices that are returned when it's already holding that much are thrown away. Zero means no limit
+func NewMultiSizeSlicePoolWithLimit(maxSliceLength uint32, maxPooledBytes int64) ByteSlicePooler {
 	maxSlotIndex, _ := getSlotInfo(maxSliceLength)
 	poolsBySize := make([]*simpleSlicePool, maxSlotIndex+1)
 	for i := 0; i <= maxSlotIndex; i++ {
 		maxCount := getMaxSliceCountInPool(i)
 		poolsBySize[i] = newSimpleSlicePool(maxCount)
 	}
-	return &multiSizeSlicePool{poolsBySize: poolsBySize}
+	return &multiSizeSlicePool{poolsBySize: poolsBySize, maxPooledBytes: maxPooledBytes}
 }
 
 var indexOf32KSlot, _ = getSlotInfo(32 * 1024)
@@ -156,7 +170,7 @@ func (mp *multiSizeSlicePool) RentSlice(desiredSize uint32) []byte {
 	pool := mp.poolsBySize[slotIndex]
 
 	// try to get a pooled slice
-	if typedSlice := pool.Get(); typedSlice != nil {
+	if typedSlice := mp.getFromPool(pool); typedSlice != nil {
 		// clear out the entire slice up to the capacity
 		// a zero-ing-out loop written in the right form in Go, will be automatically turned into a call to memclr,
 		// which is an optimized Go runtime routine written in assembler
@@ -182,8 +196,24 @@ func (mp *multiSizeSlicePool) ReturnSlice(slice []byte) {
 	// get the pool that most closely corresponds to the desired size
 	pool := mp.poolsBySize[slotIndex]
 
-	// put the slice back into the pool
-	pool.Put(slice)
+	// put the slice back into the pool, if that won't take the pool over its limit
+	if mp.maxPooledBytes == 0 {
+		pool.Put(slice)
+		return
+	}
+	size := int64(cap(slice))
+	if atomic.AddInt64(&mp.atomicPooledBytes, size) > mp.maxPooledBytes || !pool.Put(slice) {
+		atomic.AddInt64(&mp.atomicPooledBytes, -size)
+	}
+}
+
+// getFromPool takes a slice out of one of our pools, keeping count of how much is left in them
+func (mp *multiSizeSlicePool) getFromPool(pool *simpleSlicePool) []byte {
+	slice := pool.Get()
+	if slice != nil && mp.maxPooledBytes != 0 {
+		atomic.AddInt64(&mp.atomicPooledBytes, -int64(cap(slice)))
+	}
+	return slice
 }
 
 // Prune inactive stuff in all the big slots if due (don't worry about the little ones, they don't eat much RAM)
@@ -202,7 +232,7 @@ func (mp *multiSizeSlicePool) Prune() {
 			// With repeated calls of Prune, this will gradually drain idle pools.
 			// But, since Prune is not called very often,
 			// it won't have much adverse impact on active pools.
-			_ = mp.poolsBySize[index].Get()
+			_ = mp.getFromPool(mp.poolsBySize[index])
 		}
 	}
 }
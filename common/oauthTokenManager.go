@@ -52,6 +52,10 @@ const ApplicationID = "579a7132-0e58-4d80-b1e1-7a1e2d337859"
 
 // Resource used in azure storage OAuth authentication
 const Resource = "https://storage.azure.com"
+
+// ARMResource is used when a feature needs to call Azure Resource Manager of the public cloud with the same identity.
+// Other clouds have their own, see AzureCloud
+const ARMResource = "https://management.azure.com/"
 const DefaultTenantID = "common"
 const DefaultActiveDirectoryEndpoint = "https://login.microsoftonline.com"
 const IMDSAPIVersion = "2018-02-01"
@@ -90,6 +94,7 @@ func newAzcopyHTTPClient() *http.Client {
 			MaxIdleConnsPerHost:    1000,
 			IdleConnTimeout:        180 * time.Second,
 			TLSHandshakeTimeout:    10 * time.Second,
+			TLSClientConfig:        TLSConfigForMode(),
 			ExpectContinueTimeout:  1 * time.Second,
 			DisableKeepAlives:      false,
 			DisableCompression:     true,
@@ -160,7 +165,7 @@ func (uotm *UserOAuthTokenManager) MSILogin(ctx context.Context, identityInfo Id
 }
 
 // secretLoginNoUOTM non-interactively logs in with a client secret.
-func secretLoginNoUOTM(tenantID, activeDirectoryEndpoint, secret, applicationID string) (*OAuthTokenInfo, error) {
+func secretLoginNoUOTM(tenantID, activeDirectoryEndpoint, secret, applicationID, resource string) (*OAuthTokenInfo, error) {
 	if tenantID == "" {
 		tenantID = DefaultTenantID
 	}
@@ -187,7 +192,7 @@ func secretLoginNoUOTM(tenantID, activeDirectoryEndpoint, secret, applicationID
 		*oauthConfig,
 		applicationID,
 		secret,
-		Resource,
+		resource,
 	)
 	if err != nil {
 		return nil, err
@@ -213,7 +218,7 @@ func secretLoginNoUOTM(tenantID, activeDirectoryEndpoint, secret, applicationID
 
 // SecretLogin is a UOTM shell for secretLoginNoUOTM.
 func (uotm *UserOAuthTokenManager) SecretLogin(tenantID, activeDirectoryEndpoint, secret, applicationID string, persist bool) (*OAuthTokenInfo, error) {
-	oAuthTokenInfo, err := secretLoginNoUOTM(tenantID, activeDirectoryEndpoint, secret, applicationID)
+	oAuthTokenInfo, err := secretLoginNoUOTM(tenantID, activeDirectoryEndpoint, secret, applicationID, Resource)
 
 	if err != nil {
 		return nil, err
@@ -231,7 +236,7 @@ func (uotm *UserOAuthTokenManager) SecretLogin(tenantID, activeDirectoryEndpoint
 
 // GetNewTokenFromSecret is a refresh shell for secretLoginNoUOTM
 func (credInfo *OAuthTokenInfo) GetNewTokenFromSecret(ctx context.Context) (*adal.Token, error) {
-	tokeninfo, err := secretLoginNoUOTM(credInfo.Tenant, credInfo.ActiveDirectoryEndpoint, credInfo.SPNInfo.Secret, credInfo.ApplicationID)
+	tokeninfo, err := secretLoginNoUOTM(credInfo.Tenant, credInfo.ActiveDirectoryEndpoint, credInfo.SPNInfo.Secret, credInfo.ApplicationID, Resource)
 
 	if err != nil {
 		return nil, err
@@ -265,7 +270,7 @@ func readPKCSBlock(block *pem.Block, secret []byte, parseFunc func([]byte) (inte
 	return pk, err
 }
 
-func certLoginNoUOTM(tenantID, activeDirectoryEndpoint, certPath, certPass, applicationID string) (*OAuthTokenInfo, error) {
+func certLoginNoUOTM(tenantID, activeDirectoryEndpoint, certPath, certPass, applicationID, resource string) (*OAuthTokenInfo, error) {
 	if tenantID == "" {
 		tenantID = DefaultTenantID
 	}
@@ -368,7 +373,7 @@ func certLoginNoUOTM(tenantID, activeDirectoryEndpoint, certPath, certPass, appl
 		applicationID,
 		cert,
 		p,
-		Resource,
+		resource,
 	)
 	if err != nil {
 		return nil, err
@@ -397,7 +402,7 @@ func certLoginNoUOTM(tenantID, activeDirectoryEndpoint, certPath, certPass, appl
 func (uotm *UserOAuthTokenManager) CertLogin(tenantID, activeDirectoryEndpoint, certPath, certPass, applicationID string, persist bool) (*OAuthTokenInfo, error) {
 	// TODO: Global default cert flag for true non interactive login?
 	// (Also could be useful if the user has multiple certificates they want to switch between in the same file.)
-	oAuthTokenInfo, err := certLoginNoUOTM(tenantID, activeDirectoryEndpoint, certPath, certPass, applicationID)
+	oAuthTokenInfo, err := certLoginNoUOTM(tenantID, activeDirectoryEndpoint, certPath, certPass, applicationID, Resource)
 
 	if persist && err == nil {
 		err = uotm.credCache.SaveToken(*oAuthTokenInfo)
@@ -411,7 +416,7 @@ func (uotm *UserOAuthTokenManager) CertLogin(tenantID, activeDirectoryEndpoint,
 
 //GetNewTokenFromCert refreshes a token manually from a certificate.
 func (credInfo *OAuthTokenInfo) GetNewTokenFromCert(ctx context.Context) (*adal.Token, error) {
-	tokeninfo, err := certLoginNoUOTM(credInfo.Tenant, credInfo.ActiveDirectoryEndpoint, credInfo.SPNInfo.CertPath, credInfo.SPNInfo.Secret, credInfo.ApplicationID)
+	tokeninfo, err := certLoginNoUOTM(credInfo.Tenant, credInfo.ActiveDirectoryEndpoint, credInfo.SPNInfo.CertPath, credInfo.SPNInfo.Secret, credInfo.ApplicationID, Resource)
 
 	if err != nil {
 		return nil, err
@@ -662,6 +667,54 @@ func (credInfo *OAuthTokenInfo) Refresh(ctx context.Context) (*adal.Token, error
 	return credInfo.RefreshTokenWithUserCredential(ctx)
 }
 
+// ForAuthority returns token info for the given Azure AD authority, so that a resource in another cloud can be accessed
+// with the same identity. A service principal can log in to any authority, but a user login and a managed identity are
+// bound to the cloud they were obtained from.
+func (credInfo OAuthTokenInfo) ForAuthority(activeDirectoryEndpoint string) (*OAuthTokenInfo, error) {
+	current := credInfo.ActiveDirectoryEndpoint
+	if current == "" {
+		current = DefaultActiveDirectoryEndpoint
+	}
+	if activeDirectoryEndpoint == "" || strings.EqualFold(strings.TrimSuffix(current, "/"), strings.TrimSuffix(activeDirectoryEndpoint, "/")) {
+		return &credInfo, nil
+	}
+
+	if credInfo.ServicePrincipalName {
+		if credInfo.SPNInfo.CertPath != "" {
+			return certLoginNoUOTM(credInfo.Tenant, activeDirectoryEndpoint, credInfo.SPNInfo.CertPath, credInfo.SPNInfo.Secret, credInfo.ApplicationID, Resource)
+		}
+		return secretLoginNoUOTM(credInfo.Tenant, activeDirectoryEndpoint, credInfo.SPNInfo.Secret, credInfo.ApplicationID, Resource)
+	}
+
+	return nil, fmt.Errorf("the current login is for the authority %s and cannot be used for %s. Log in with a service principal, "+
+		"or use a SAS for the resource in the other cloud", current, activeDirectoryEndpoint)
+}
+
+// GetTokenForResource gets a token for another resource than storage (e.g. ARMResource), with the same identity as the login.
+// The token is not cached, as it's only needed by the few features which call other services.
+func (credInfo *OAuthTokenInfo) GetTokenForResource(ctx context.Context, resource string) (*adal.Token, error) {
+	switch {
+	case credInfo.TokenRefreshSource == TokenRefreshSourceTokenStore:
+		return nil, errors.New("tokens for other resources cannot be acquired in token store mode")
+	case credInfo.Identity:
+		return credInfo.getNewTokenFromMSIForResource(ctx, resource)
+	case credInfo.ServicePrincipalName:
+		var tokenInfo *OAuthTokenInfo
+		var err error
+		if credInfo.SPNInfo.CertPath != "" {
+			tokenInfo, err = certLoginNoUOTM(credInfo.Tenant, credInfo.ActiveDirectoryEndpoint, credInfo.SPNInfo.CertPath, credInfo.SPNInfo.Secret, credInfo.ApplicationID, resource)
+		} else {
+			tokenInfo, err = secretLoginNoUOTM(credInfo.Tenant, credInfo.ActiveDirectoryEndpoint, credInfo.SPNInfo.Secret, credInfo.ApplicationID, resource)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &tokenInfo.Token, nil
+	default:
+		return credInfo.refreshTokenWithUserCredentialForResource(ctx, resource)
+	}
+}
+
 var msiTokenHTTPClient = newAzcopyHTTPClient()
 
 // Single instance token store credential cache shared by entire azcopy process.
@@ -690,13 +743,17 @@ func (credInfo *OAuthTokenInfo) GetNewTokenFromTokenStore(ctx context.Context) (
 // GetNewTokenFromMSI gets token from Azure Instance Metadata Service identity endpoint.
 // For details, please refer to https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/overview
 func (credInfo *OAuthTokenInfo) GetNewTokenFromMSI(ctx context.Context) (*adal.Token, error) {
+	return credInfo.getNewTokenFromMSIForResource(ctx, Resource)
+}
+
+func (credInfo *OAuthTokenInfo) getNewTokenFromMSIForResource(ctx context.Context, resource string) (*adal.Token, error) {
 	// Prepare request to get token from Azure Instance Metadata Service identity endpoint.
 	req, err := http.NewRequest("GET", MSIEndpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request, %v", err)
 	}
 	params := req.URL.Query()
-	params.Set("resource", Resource)
+	params.Set("resource", resource)
 	params.Set("api-version", IMDSAPIVersion)
 	if credInfo.IdentityInfo.ClientID != "" {
 		params.Set("client_id", credInfo.IdentityInfo.ClientID)
@@ -748,6 +805,10 @@ func (credInfo *OAuthTokenInfo) GetNewTokenFromMSI(ctx context.Context) (*adal.T
 
 // RefreshTokenWithUserCredential gets new token with user credential through refresh.
 func (credInfo *OAuthTokenInfo) RefreshTokenWithUserCredential(ctx context.Context) (*adal.Token, error) {
+	return credInfo.refreshTokenWithUserCredentialForResource(ctx, Resource)
+}
+
+func (credInfo *OAuthTokenInfo) refreshTokenWithUserCredentialForResource(ctx context.Context, resource string) (*adal.Token, error) {
 	oauthConfig, err := adal.NewOAuthConfig(credInfo.ActiveDirectoryEndpoint, credInfo.Tenant)
 	if err != nil {
 		return nil, err
@@ -758,7 +819,7 @@ func (credInfo *OAuthTokenInfo) RefreshTokenWithUserCredential(ctx context.Conte
 	spt, err := adal.NewServicePrincipalTokenFromManualToken(
 		*oauthConfig,
 		IffString(credInfo.ClientID != "", credInfo.ClientID, ApplicationID),
-		Resource,
+		resource,
 		credInfo.Token)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,1075 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// ParquetReader reads the rows of a Parquet file with a flat schema, such as a blob inventory report.
+// It supports what's commonly written for such files: required and optional columns, PLAIN and dictionary encodings,
+// version 1 and 2 data pages, and no compression, Snappy or gzip.
+// Each row group is decoded as a whole when its first row is read.
+//
+// The values of a row are nil (for nulls), string (for byte arrays annotated as strings), []byte (for other byte arrays),
+// bool, int64 (for INT32 and INT64), float64, or time.Time (for timestamps).
+type ParquetReader struct {
+	r         io.ReaderAt
+	size      int64
+	columns   []parquetSchemaColumn
+	rowGroups []parquetRowGroupMeta
+
+	nextGroup int
+	values    [][]interface{} // of the current row group, by column
+	groupRows int
+	row       int
+	current   []interface{}
+}
+
+type parquetSchemaColumn struct {
+	name          string
+	physicalType  int32
+	typeLength    int32
+	optional      bool
+	isString      bool
+	timestampUnit time.Duration // non-zero for timestamps stored as INT64
+}
+
+type parquetRowGroupMeta struct {
+	numRows int64
+	chunks  []parquetChunkMeta
+}
+
+type parquetChunkMeta struct {
+	codec  int32
+	offset int64 // of the first page, which is the dictionary page if there is one
+	size   int64
+}
+
+// values of the enums in the Parquet format definition (parquet.thrift), in addition to those used by the writer
+const (
+	parquetTypeBoolean           = 0
+	parquetTypeInt32             = 1
+	parquetTypeInt96             = 3
+	parquetTypeFloat             = 4
+	parquetTypeDouble            = 5
+	parquetTypeFixedLenByteArray = 7
+
+	parquetRepetitionOptional = 1
+
+	parquetConvertedTypeEnum            = 4
+	parquetConvertedTypeTimestampMicros = 10
+	parquetConvertedTypeJSON            = 19
+
+	parquetEncodingPlainDictionary = 2
+	parquetEncodingRLEDictionary   = 8
+
+	parquetPageTypeDictionary = 2
+	parquetPageTypeDataV2     = 3
+
+	parquetCodecSnappy = 1
+	parquetCodecGzip   = 2
+)
+
+// The most that the metadata and the page headers of a file may ask the reader to allocate. The file may come from anywhere
+// (such as an inventory report given by URL), so these keep a corrupt or hostile one from running AzCopy out of memory.
+// Files written for inventory reports, and by the list command, are far within them
+const (
+	parquetMaxMetadataLength = 64 * 1024 * 1024
+	parquetMaxChunkSize      = 1024 * 1024 * 1024
+	parquetMaxPageSize       = 256 * 1024 * 1024
+	parquetMaxRowGroupValues = 64 * 1024 * 1024 // the number of rows times the number of columns
+)
+
+// NewParquetReader reads the metadata of the Parquet file of the given size
+func NewParquetReader(r io.ReaderAt, size int64) (*ParquetReader, error) {
+	if size < int64(2*len(parquetMagic)+4) {
+		return nil, errors.New("the file is too small to be a parquet file")
+	}
+	tail := make([]byte, 8)
+	if err := readFullAt(r, tail, size-8); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != parquetMagic {
+		return nil, errors.New("the file is not a parquet file")
+	}
+	metaLength := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if metaLength > size-int64(2*len(parquetMagic)+4) || metaLength > parquetMaxMetadataLength {
+		return nil, errors.New("the length of the parquet metadata is invalid")
+	}
+	meta := make([]byte, metaLength)
+	if err := readFullAt(r, meta, size-8-metaLength); err != nil {
+		return nil, err
+	}
+
+	pr := &ParquetReader{r: r, size: size}
+	if err := pr.readFileMetaData(&thriftCompactReader{buf: meta}); err != nil {
+		return nil, fmt.Errorf("invalid parquet metadata: %v", err)
+	}
+	pr.current = make([]interface{}, len(pr.columns))
+	return pr, nil
+}
+
+// Columns returns the names of the columns, in the order of the values of each row
+func (pr *ParquetReader) Columns() []string {
+	names := make([]string, len(pr.columns))
+	for i, col := range pr.columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// Next returns the values of the next row, or io.EOF after the last one. The slice is reused by the next call
+func (pr *ParquetReader) Next() ([]interface{}, error) {
+	for pr.row >= pr.groupRows {
+		if pr.nextGroup >= len(pr.rowGroups) {
+			return nil, io.EOF
+		}
+		if err := pr.readRowGroup(pr.rowGroups[pr.nextGroup]); err != nil {
+			return nil, err
+		}
+		pr.nextGroup++
+	}
+
+	for i := range pr.columns {
+		pr.current[i] = pr.values[i][pr.row]
+	}
+	pr.row++
+	return pr.current, nil
+}
+
+func (pr *ParquetReader) readRowGroup(group parquetRowGroupMeta) error {
+	pr.values = make([][]interface{}, len(pr.columns))
+	for i, col := range pr.columns {
+		values, err := pr.readColumnChunk(col, group.chunks[i], int(group.numRows))
+		if err != nil {
+			return fmt.Errorf("cannot read column %s: %v", col.name, err)
+		}
+		pr.values[i] = values
+	}
+	pr.groupRows = int(group.numRows)
+	pr.row = 0
+	return nil
+}
+
+func readFullAt(r io.ReaderAt, p []byte, offset int64) error {
+	n, err := r.ReadAt(p, offset)
+	if n == len(p) {
+		return nil
+	} else if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Metadata
+
+func (pr *ParquetReader) readFileMetaData(t *thriftCompactReader) error {
+	var schema []parquetSchemaElement
+	err := t.readStruct(func(id int16, typ byte) error {
+		switch id {
+		case 2:
+			return t.readList(func() error {
+				var e parquetSchemaElement
+				if err := e.read(t); err != nil {
+					return err
+				}
+				schema = append(schema, e)
+				return nil
+			})
+		case 4:
+			return t.readList(func() error {
+				group, err := readRowGroupMeta(t)
+				if err != nil {
+					return err
+				}
+				pr.rowGroups = append(pr.rowGroups, group)
+				return nil
+			})
+		default:
+			return t.skip(typ)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// the root of the schema must hold all the columns directly
+	if len(schema) == 0 || int(schema[0].numChildren) != len(schema)-1 {
+		return errors.New("only flat schemas are supported")
+	}
+	for _, e := range schema[1:] {
+		if e.numChildren > 0 || e.repetition > parquetRepetitionOptional {
+			return fmt.Errorf("column %s is nested or repeated, and only flat schemas are supported", e.name)
+		}
+		pr.columns = append(pr.columns, e.toColumn())
+	}
+	for _, group := range pr.rowGroups {
+		if len(group.chunks) != len(pr.columns) {
+			return errors.New("a row group doesn't have a chunk for each column")
+		}
+		if group.numRows < 0 || group.numRows > parquetMaxRowGroupValues || group.numRows*int64(len(pr.columns)) > parquetMaxRowGroupValues {
+			return fmt.Errorf("a row group has %d rows, which is more than can be read", group.numRows)
+		}
+		for _, chunk := range group.chunks {
+			if chunk.size < 0 || chunk.size > parquetMaxChunkSize || chunk.offset < 0 || chunk.offset > pr.size-chunk.size {
+				return errors.New("a column chunk is outside the file, or too large to read")
+			}
+		}
+	}
+	return nil
+}
+
+type parquetSchemaElement struct {
+	physicalType  int32
+	typeLength    int32
+	repetition    int32
+	name          string
+	numChildren   int32
+	convertedType int32
+	isString      bool          // from the logical type
+	timestampUnit time.Duration // from the logical type
+}
+
+func (e *parquetSchemaElement) read(t *thriftCompactReader) (err error) {
+	e.convertedType = -1
+	return t.readStruct(func(id int16, typ byte) error {
+		switch id {
+		case 1:
+			e.physicalType, err = t.readI32()
+		case 2:
+			e.typeLength, err = t.readI32()
+		case 3:
+			e.repetition, err = t.readI32()
+		case 4:
+			e.name, err = t.readString()
+		case 5:
+			e.numChildren, err = t.readI32()
+		case 6:
+			e.convertedType, err = t.readI32()
+		case 10:
+			err = e.readLogicalType(t)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+}
+
+// readLogicalType reads the union that newer writers use to annotate columns, in place of (or as well as) the converted type
+func (e *parquetSchemaElement) readLogicalType(t *thriftCompactReader) error {
+	return t.readStruct(func(id int16, typ byte) error {
+		switch id {
+		case 1, 4, 12: // STRING, ENUM, JSON
+			e.isString = true
+			return t.skip(typ)
+		case 8: // TIMESTAMP
+			return t.readStruct(func(id int16, typ byte) error {
+				if id != 2 {
+					return t.skip(typ)
+				}
+				return t.readStruct(func(id int16, typ byte) error {
+					switch id {
+					case 1:
+						e.timestampUnit = time.Millisecond
+					case 2:
+						e.timestampUnit = time.Microsecond
+					case 3:
+						e.timestampUnit = time.Nanosecond
+					}
+					return t.skip(typ)
+				})
+			})
+		default:
+			return t.skip(typ)
+		}
+	})
+}
+
+func (e parquetSchemaElement) toColumn() parquetSchemaColumn {
+	col := parquetSchemaColumn{
+		name:          e.name,
+		physicalType:  e.physicalType,
+		typeLength:    e.typeLength,
+		optional:      e.repetition == parquetRepetitionOptional,
+		isString:      e.isString,
+		timestampUnit: e.timestampUnit,
+	}
+	switch e.convertedType {
+	case parquetConvertedTypeUTF8, parquetConvertedTypeEnum, parquetConvertedTypeJSON:
+		col.isString = true
+	case parquetConvertedTypeTimestampMs:
+		col.timestampUnit = time.Millisecond
+	case parquetConvertedTypeTimestampMicros:
+		col.timestampUnit = time.Microsecond
+	}
+	if col.physicalType != parquetTypeInt64 {
+		col.timestampUnit = 0
+	}
+	return col
+}
+
+func readRowGroupMeta(t *thriftCompactReader) (group parquetRowGroupMeta, err error) {
+	err = t.readStruct(func(id int16, typ byte) error {
+		switch id {
+		case 1:
+			return t.readList(func() error {
+				chunk, err := readColumnChunkMeta(t)
+				group.chunks = append(group.chunks, chunk)
+				return err
+			})
+		case 3:
+			group.numRows, err = t.readI64()
+			return err
+		default:
+			return t.skip(typ)
+		}
+	})
+	return group, err
+}
+
+func readColumnChunkMeta(t *thriftCompactReader) (chunk parquetChunkMeta, err error) {
+	var dataPageOffset, dictionaryPageOffset int64
+	err = t.readStruct(func(id int16, typ byte) error {
+		switch id {
+		case 1:
+			return errors.New("column chunks in other files are not supported")
+		case 3:
+			return t.readStruct(func(id int16, typ byte) (err error) {
+				switch id {
+				case 4:
+					chunk.codec, err = t.readI32()
+				case 7:
+					chunk.size, err = t.readI64()
+				case 9:
+					dataPageOffset, err = t.readI64()
+				case 11:
+					dictionaryPageOffset, err = t.readI64()
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		default:
+			return t.skip(typ)
+		}
+	})
+
+	chunk.offset = dataPageOffset
+	if dictionaryPageOffset > 0 && dictionaryPageOffset < dataPageOffset {
+		chunk.offset = dictionaryPageOffset
+	}
+	return chunk, err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Pages
+
+type parquetPageHeader struct {
+	pageType         int32
+	uncompressedSize int32
+	compressedSize   int32
+
+	numValues int32
+	encoding  int32
+
+	// version 2 data pages only
+	defLevelsLength int32
+	repLevelsLength int32
+	isCompressed    bool
+}
+
+func (h *parquetPageHeader) read(t *thriftCompactReader) error {
+	h.isCompressed = true
+	return t.readStruct(func(id int16, typ byte) (err error) {
+		switch id {
+		case 1:
+			h.pageType, err = t.readI32()
+		case 2:
+			h.uncompressedSize, err = t.readI32()
+		case 3:
+			h.compressedSize, err = t.readI32()
+		case 5, 7: // the data page header, and the dictionary page header, start with the same fields
+			err = t.readStruct(func(id int16, typ byte) (err error) {
+				switch id {
+				case 1:
+					h.numValues, err = t.readI32()
+				case 2:
+					h.encoding, err = t.readI32()
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		case 8:
+			err = t.readStruct(func(id int16, typ byte) (err error) {
+				switch id {
+				case 1:
+					h.numValues, err = t.readI32()
+				case 4:
+					h.encoding, err = t.readI32()
+				case 5:
+					h.defLevelsLength, err = t.readI32()
+				case 6:
+					h.repLevelsLength, err = t.readI32()
+				case 7:
+					h.isCompressed = typ == thriftTypeBoolTrue
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+}
+
+func (pr *ParquetReader) readColumnChunk(col parquetSchemaColumn, chunk parquetChunkMeta, numRows int) ([]interface{}, error) {
+	// the size and the number of rows were checked against the limits when the metadata was read
+	data := make([]byte, chunk.size)
+	if err := readFullAt(pr.r, data, chunk.offset); err != nil {
+		return nil, err
+	}
+
+	var dictionary []interface{}
+	values := make([]interface{}, 0, numRows)
+	for len(data) > 0 && len(values) < numRows {
+		t := &thriftCompactReader{buf: data}
+		var h parquetPageHeader
+		if err := h.read(t); err != nil {
+			return nil, fmt.Errorf("invalid page header: %v", err)
+		}
+		data = data[t.pos:]
+		if h.compressedSize < 0 || int(h.compressedSize) > len(data) || h.uncompressedSize < 0 || h.uncompressedSize > parquetMaxPageSize || h.numValues < 0 {
+			return nil, errors.New("invalid page size")
+		}
+		if h.pageType != parquetPageTypeDictionary && int(h.numValues) > numRows-len(values) {
+			return nil, errors.New("a data page has more values than are left in the row group")
+		}
+		page := data[:h.compressedSize]
+		data = data[h.compressedSize:]
+
+		switch h.pageType {
+		case parquetPageTypeDictionary:
+			raw, err := decompressParquetPage(chunk.codec, page, int(h.uncompressedSize))
+			if err != nil {
+				return nil, err
+			}
+			if dictionary, _, err = decodeParquetPlain(col, raw, int(h.numValues)); err != nil {
+				return nil, err
+			}
+		case parquetPageTypeData:
+			raw, err := decompressParquetPage(chunk.codec, page, int(h.uncompressedSize))
+			if err != nil {
+				return nil, err
+			}
+			var present []bool
+			if col.optional {
+				// the definition levels are prefixed with their length
+				if len(raw) < 4 {
+					return nil, errors.New("truncated definition levels")
+				}
+				length := int(binary.LittleEndian.Uint32(raw))
+				if length > len(raw)-4 {
+					return nil, errors.New("truncated definition levels")
+				}
+				if present, err = decodeParquetDefinitionLevels(raw[4:4+length], int(h.numValues)); err != nil {
+					return nil, err
+				}
+				raw = raw[4+length:]
+			}
+			if values, err = appendParquetValues(values, col, raw, h, present, dictionary); err != nil {
+				return nil, err
+			}
+		case parquetPageTypeDataV2:
+			levelsLength := int(h.repLevelsLength) + int(h.defLevelsLength)
+			if h.repLevelsLength != 0 || h.defLevelsLength < 0 || levelsLength > len(page) {
+				return nil, errors.New("invalid levels in data page")
+			}
+			var present []bool
+			var err error
+			if col.optional {
+				if present, err = decodeParquetDefinitionLevels(page[:levelsLength], int(h.numValues)); err != nil {
+					return nil, err
+				}
+			}
+			raw := page[levelsLength:]
+			if h.isCompressed {
+				if raw, err = decompressParquetPage(chunk.codec, raw, int(h.uncompressedSize)-levelsLength); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = appendParquetValues(values, col, raw, h, present, dictionary); err != nil {
+				return nil, err
+			}
+		default:
+			// index pages carry nothing we need
+		}
+	}
+
+	if len(values) != numRows {
+		return nil, fmt.Errorf("expected %d values but found %d", numRows, len(values))
+	}
+	return values, nil
+}
+
+// decodeParquetDefinitionLevels says which values of an optional column are present. Since the schema is flat,
+// the levels are 0 for null or 1 for present, so are one bit wide
+func decodeParquetDefinitionLevels(data []byte, count int) ([]bool, error) {
+	levels, err := decodeRLEBitPackedHybrid(data, 1, count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid definition levels: %v", err)
+	}
+	present := make([]bool, count)
+	for i, level := range levels {
+		present[i] = level == 1
+	}
+	return present, nil
+}
+
+// appendParquetValues decodes the values of a data page, and appends them, with nils for the values that aren't present
+func appendParquetValues(values []interface{}, col parquetSchemaColumn, data []byte, h parquetPageHeader, present []bool, dictionary []interface{}) ([]interface{}, error) {
+	count := int(h.numValues)
+	if present != nil {
+		count = 0
+		for _, p := range present {
+			if p {
+				count++
+			}
+		}
+	}
+
+	var decoded []interface{}
+	var err error
+	switch {
+	case h.encoding == parquetEncodingPlain:
+		decoded, _, err = decodeParquetPlain(col, data, count)
+	case h.encoding == parquetEncodingPlainDictionary || h.encoding == parquetEncodingRLEDictionary:
+		decoded, err = decodeParquetDictionaryIndices(data, count, dictionary)
+	case h.encoding == parquetEncodingRLE && col.physicalType == parquetTypeBoolean:
+		decoded, err = decodeParquetRLEBooleans(data, count)
+	default:
+		err = fmt.Errorf("encoding %d is not supported", h.encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if present == nil {
+		return append(values, decoded...), nil
+	}
+	next := 0
+	for _, p := range present {
+		if p {
+			values = append(values, decoded[next])
+			next++
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values, nil
+}
+
+func decodeParquetDictionaryIndices(data []byte, count int, dictionary []interface{}) ([]interface{}, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	if dictionary == nil {
+		return nil, errors.New("dictionary-encoded values without a dictionary")
+	}
+	if len(data) < 1 || data[0] > 32 {
+		return nil, errors.New("invalid dictionary indices")
+	}
+	indices, err := decodeRLEBitPackedHybrid(data[1:], int(data[0]), count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dictionary indices: %v", err)
+	}
+	values := make([]interface{}, count)
+	for i, index := range indices {
+		if int(index) >= len(dictionary) {
+			return nil, errors.New("dictionary index out of range")
+		}
+		values[i] = dictionary[index]
+	}
+	return values, nil
+}
+
+func decodeParquetRLEBooleans(data []byte, count int) ([]interface{}, error) {
+	if len(data) < 4 || int(binary.LittleEndian.Uint32(data)) > len(data)-4 {
+		return nil, errors.New("truncated booleans")
+	}
+	bits, err := decodeRLEBitPackedHybrid(data[4:4+binary.LittleEndian.Uint32(data)], 1, count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid booleans: %v", err)
+	}
+	values := make([]interface{}, count)
+	for i, bit := range bits {
+		values[i] = bit == 1
+	}
+	return values, nil
+}
+
+// decodeParquetPlain decodes count values in the PLAIN encoding, and returns how many bytes they took up
+func decodeParquetPlain(col parquetSchemaColumn, data []byte, count int) ([]interface{}, int, error) {
+	// each value takes at least a byte (a bit for booleans), so there can't be more of them than that
+	if count < 0 || count > 8*len(data) || (col.physicalType != parquetTypeBoolean && count > len(data)) {
+		return nil, 0, errors.New("truncated values")
+	}
+	values := make([]interface{}, count)
+	pos := 0
+	need := func(n int) error {
+		if n < 0 || pos+n > len(data) {
+			return errors.New("truncated values")
+		}
+		return nil
+	}
+
+	for i := 0; i < count; i++ {
+		switch col.physicalType {
+		case parquetTypeBoolean:
+			// booleans are packed 8 to a byte, from the least significant bit
+			if i/8 >= len(data) {
+				return nil, 0, errors.New("truncated values")
+			}
+			values[i] = data[i/8]>>(uint(i)%8)&1 == 1
+			pos = i/8 + 1
+		case parquetTypeInt32:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			values[i] = int64(int32(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		case parquetTypeInt64:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			v := int64(binary.LittleEndian.Uint64(data[pos:]))
+			if col.timestampUnit != 0 {
+				values[i] = time.Unix(0, 0).UTC().Add(time.Duration(v) * col.timestampUnit)
+			} else {
+				values[i] = v
+			}
+			pos += 8
+		case parquetTypeInt96:
+			// nanoseconds within the day, then the Julian day
+			if err := need(12); err != nil {
+				return nil, 0, err
+			}
+			nanos := int64(binary.LittleEndian.Uint64(data[pos:]))
+			day := int64(binary.LittleEndian.Uint32(data[pos+8:]))
+			const julianDayOfUnixEpoch = 2440588
+			values[i] = time.Unix((day-julianDayOfUnixEpoch)*24*60*60, nanos).UTC()
+			pos += 12
+		case parquetTypeFloat:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		case parquetTypeDouble:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+		case parquetTypeByteArray, parquetTypeFixedLenByteArray:
+			length := int(col.typeLength)
+			if col.physicalType == parquetTypeByteArray {
+				if err := need(4); err != nil {
+					return nil, 0, err
+				}
+				length = int(binary.LittleEndian.Uint32(data[pos:]))
+				pos += 4
+			}
+			if err := need(length); err != nil {
+				return nil, 0, err
+			}
+			if col.isString {
+				values[i] = string(data[pos : pos+length])
+			} else {
+				values[i] = append([]byte(nil), data[pos:pos+length]...)
+			}
+			pos += length
+		default:
+			return nil, 0, fmt.Errorf("physical type %d is not supported", col.physicalType)
+		}
+	}
+	return values, pos, nil
+}
+
+// decodeRLEBitPackedHybrid decodes count values of the given bit width, which are stored as a mix of runs of repeated values,
+// and groups of 8 values packed into bitWidth bytes
+func decodeRLEBitPackedHybrid(data []byte, bitWidth int, count int) ([]uint32, error) {
+	values := make([]uint32, 0, count)
+	pos := 0
+	for len(values) < count {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, errors.New("truncated run")
+		}
+		pos += n
+
+		if header&1 == 0 {
+			// a run of the same value, which is stored in as few bytes as will hold it
+			runLength := int(header >> 1)
+			width := (bitWidth + 7) / 8
+			if runLength == 0 || pos+width > len(data) {
+				return nil, errors.New("invalid run")
+			}
+			var v uint32
+			for i := 0; i < width; i++ {
+				v |= uint32(data[pos+i]) << (8 * uint(i))
+			}
+			pos += width
+			for i := 0; i < runLength && len(values) < count; i++ {
+				values = append(values, v)
+			}
+		} else {
+			// groups of 8 values, packed from the least significant bit of each byte
+			groups := int(header >> 1)
+			length := groups * bitWidth
+			if groups == 0 || pos+length > len(data) {
+				return nil, errors.New("invalid bit-packed run")
+			}
+			packed := data[pos : pos+length]
+			for i := 0; i < groups*8 && len(values) < count; i++ {
+				var v uint32
+				for b := 0; b < bitWidth; b++ {
+					bit := i*bitWidth + b
+					v |= uint32(packed[bit/8]>>(uint(bit)%8)&1) << uint(b)
+				}
+				values = append(values, v)
+			}
+			pos += length
+		}
+	}
+	return values, nil
+}
+
+func decompressParquetPage(codec int32, data []byte, uncompressedSize int) ([]byte, error) {
+	if uncompressedSize < 0 || uncompressedSize > parquetMaxPageSize {
+		return nil, errors.New("invalid page size")
+	}
+	switch codec {
+	case parquetCodecUncompressed:
+		return data, nil
+	case parquetCodecSnappy:
+		return decodeSnappyBlock(data, uncompressedSize)
+	case parquetCodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		// don't inflate more than the page says it holds
+		raw, err := ioutil.ReadAll(io.LimitReader(r, int64(uncompressedSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) != uncompressedSize {
+			return nil, errors.New("gzip data doesn't match the size of the page")
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("compression codec %d is not supported. Only uncompressed, Snappy and gzip parquet files can be read", codec)
+	}
+}
+
+// decodeSnappyBlock decodes data in the Snappy block format: the length of the decoded data, then a series of literals
+// and of copies of earlier decoded data
+func decodeSnappyBlock(src []byte, expectedLength int) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length != uint64(expectedLength) {
+		return nil, errors.New("invalid snappy length")
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+
+	for len(src) > 0 {
+		tag := src[0]
+		var copyLength, offset int
+		switch tag & 3 {
+		case 0:
+			literalLength := int(tag >> 2)
+			src = src[1:]
+			if literalLength >= 60 {
+				// the length is in the next 1 to 4 bytes
+				lengthBytes := literalLength - 59
+				if len(src) < lengthBytes {
+					return nil, errors.New("truncated snappy literal")
+				}
+				literalLength = 0
+				for i := 0; i < lengthBytes; i++ {
+					literalLength |= int(src[i]) << (8 * uint(i))
+				}
+				src = src[lengthBytes:]
+			}
+			literalLength++
+			if literalLength <= 0 || literalLength > len(src) || len(dst)+literalLength > int(length) {
+				return nil, errors.New("invalid snappy literal")
+			}
+			dst = append(dst, src[:literalLength]...)
+			src = src[literalLength:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errors.New("truncated snappy copy")
+			}
+			copyLength = 4 + int(tag>>2&7)
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errors.New("truncated snappy copy")
+			}
+			copyLength = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errors.New("truncated snappy copy")
+			}
+			copyLength = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+copyLength > int(length) {
+			return nil, errors.New("invalid snappy copy")
+		}
+		// the copy may overlap what it produces, so it's done a byte at a time
+		for i := 0; i < copyLength; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+
+	if len(dst) != int(length) {
+		return nil, errors.New("snappy data is shorter than its length")
+	}
+	return dst, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// thriftCompactReader decodes the subset of the Thrift compact protocol needed for Parquet metadata.
+// Fields that aren't needed are skipped, whatever their type
+type thriftCompactReader struct {
+	buf []byte
+	pos int
+}
+
+const (
+	thriftTypeBoolTrue  = 1
+	thriftTypeBoolFalse = 2
+	thriftTypeByte      = 3
+	thriftTypeI16       = 4
+	thriftTypeDouble    = 7
+	thriftTypeSet       = 10
+	thriftTypeMap       = 11
+)
+
+// the depth of nesting that's allowed, so that corrupt metadata can't exhaust the stack
+const thriftMaxDepth = 64
+
+var errThriftTruncated = errors.New("truncated metadata")
+
+func (t *thriftCompactReader) readByte() (byte, error) {
+	if t.pos >= len(t.buf) {
+		return 0, errThriftTruncated
+	}
+	b := t.buf[t.pos]
+	t.pos++
+	return b, nil
+}
+
+func (t *thriftCompactReader) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(t.buf[t.pos:])
+	if n <= 0 {
+		return 0, errThriftTruncated
+	}
+	t.pos += n
+	return v, nil
+}
+
+func (t *thriftCompactReader) readZigzagVarint() (int64, error) {
+	v, err := t.readVarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (t *thriftCompactReader) readI32() (int32, error) {
+	v, err := t.readZigzagVarint()
+	return int32(v), err
+}
+
+func (t *thriftCompactReader) readI64() (int64, error) {
+	return t.readZigzagVarint()
+}
+
+func (t *thriftCompactReader) readBinary() ([]byte, error) {
+	length, err := t.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(t.buf)-t.pos) {
+		return nil, errThriftTruncated
+	}
+	b := t.buf[t.pos : t.pos+int(length)]
+	t.pos += int(length)
+	return b, nil
+}
+
+func (t *thriftCompactReader) readString() (string, error) {
+	b, err := t.readBinary()
+	return string(b), err
+}
+
+// readStruct calls field for each field of the struct, which must read or skip its value
+func (t *thriftCompactReader) readStruct(field func(id int16, typ byte) error) error {
+	var lastID int16
+	for {
+		header, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		if header == 0 {
+			return nil
+		}
+		typ := header & 0x0F
+		if delta := int16(header >> 4); delta != 0 {
+			lastID += delta
+		} else {
+			id, err := t.readZigzagVarint()
+			if err != nil {
+				return err
+			}
+			lastID = int16(id)
+		}
+		if err = field(lastID, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// readList calls element for each element of the list, which must read its value
+func (t *thriftCompactReader) readList(element func() error) error {
+	size, _, err := t.readListHeader()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < size; i++ {
+		if err = element(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *thriftCompactReader) readListHeader() (size int, elementType byte, err error) {
+	header, err := t.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size = int(header >> 4)
+	if size == 15 {
+		v, err := t.readVarint()
+		if err != nil {
+			return 0, 0, err
+		}
+		// every element takes at least a byte
+		if v > uint64(len(t.buf)-t.pos) {
+			return 0, 0, errThriftTruncated
+		}
+		size = int(v)
+	}
+	return size, header & 0x0F, nil
+}
+
+func (t *thriftCompactReader) skip(typ byte) error {
+	return t.skipAtDepth(typ, 0)
+}
+
+func (t *thriftCompactReader) skipAtDepth(typ byte, depth int) error {
+	if depth > thriftMaxDepth {
+		return errors.New("metadata is nested too deeply")
+	}
+	var err error
+	switch typ {
+	case thriftTypeBoolTrue, thriftTypeBoolFalse:
+		// a boolean field holds its value in its type
+	case thriftTypeByte:
+		_, err = t.readByte()
+	case thriftTypeI16, thriftTypeI32, thriftTypeI64:
+		_, err = t.readVarint()
+	case thriftTypeDouble:
+		if t.pos+8 > len(t.buf) {
+			return errThriftTruncated
+		}
+		t.pos += 8
+	case thriftTypeBinary:
+		_, err = t.readBinary()
+	case thriftTypeList, thriftTypeSet:
+		size, elementType, err := t.readListHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size && err == nil; i++ {
+			err = t.skipElement(elementType, depth+1)
+		}
+		return err
+	case thriftTypeMap:
+		size, err := t.readVarint()
+		if err != nil || size == 0 {
+			return err
+		}
+		types, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size && err == nil; i++ {
+			if err = t.skipElement(types>>4, depth+1); err == nil {
+				err = t.skipElement(types&0x0F, depth+1)
+			}
+		}
+	case thriftTypeStruct:
+		err = t.readStruct(func(id int16, typ byte) error { return t.skipAtDepth(typ, depth+1) })
+	default:
+		err = fmt.Errorf("unknown type %d in metadata", typ)
+	}
+	return err
+}
+
+// skipElement skips an element of a list, set or map. Unlike a boolean field, a boolean element takes a byte
+func (t *thriftCompactReader) skipElement(typ byte, depth int) error {
+	if typ == thriftTypeBoolTrue || typ == thriftTypeBoolFalse {
+		_, err := t.readByte()
+		return err
+	}
+	return t.skipAtDepth(typ, depth)
+}
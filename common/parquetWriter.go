@@ -0,0 +1,370 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ParquetWriter writes rows to a Parquet file with a flat schema, so that large listings can be loaded directly
+// into analytics engines (such as Synapse, Spark or DuckDB).
+// Only what we need is supported: required (non-null) columns, PLAIN encoding and no compression.
+// Rows are buffered in memory and written out as a row group whenever rowGroupSize rows have accumulated.
+type ParquetWriter struct {
+	w            *countingWriter
+	columns      []ParquetColumn
+	rowGroupSize int
+
+	buffers     []bytes.Buffer
+	bufferedRow int
+	rowGroups   []parquetRowGroup
+	totalRows   int64
+}
+
+var EParquetColumnType = ParquetColumnType(0)
+
+type ParquetColumnType uint8
+
+func (ParquetColumnType) String() ParquetColumnType    { return ParquetColumnType(0) } // UTF8 byte array
+func (ParquetColumnType) Int64() ParquetColumnType     { return ParquetColumnType(1) }
+func (ParquetColumnType) Timestamp() ParquetColumnType { return ParquetColumnType(2) } // milliseconds since the Unix epoch
+
+type ParquetColumn struct {
+	Name string
+	Type ParquetColumnType
+}
+
+type parquetRowGroup struct {
+	chunks    []parquetColumnChunk
+	numRows   int64
+	totalSize int64
+}
+
+type parquetColumnChunk struct {
+	dataPageOffset int64
+	size           int64
+	numValues      int64
+}
+
+const parquetMagic = "PAR1"
+const defaultParquetRowGroupSize = 100000
+
+// values of the enums in the Parquet format definition (parquet.thrift)
+const (
+	parquetTypeInt64                = 2
+	parquetTypeByteArray            = 6
+	parquetRepetitionRequired       = 0
+	parquetConvertedTypeUTF8        = 0
+	parquetConvertedTypeTimestampMs = 9
+	parquetEncodingPlain            = 0
+	parquetEncodingRLE              = 3
+	parquetPageTypeData             = 0
+	parquetCodecUncompressed        = 0
+)
+
+func NewParquetWriter(w io.Writer, columns []ParquetColumn) (*ParquetWriter, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("a parquet file must have at least one column")
+	}
+	pw := &ParquetWriter{
+		w:            &countingWriter{w: w},
+		columns:      columns,
+		rowGroupSize: defaultParquetRowGroupSize,
+		buffers:      make([]bytes.Buffer, len(columns)),
+	}
+	if _, err := pw.w.Write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteRow adds one row. There must be one value per column, of type string, int64 or time.Time
+// as appropriate to the column's type.
+func (pw *ParquetWriter) WriteRow(values ...interface{}) error {
+	if len(values) != len(pw.columns) {
+		return fmt.Errorf("expected %d values but got %d", len(pw.columns), len(values))
+	}
+
+	for i, col := range pw.columns {
+		buf := &pw.buffers[i]
+		switch col.Type {
+		case EParquetColumnType.String():
+			s, ok := values[i].(string)
+			if !ok {
+				return fmt.Errorf("column %s requires a string value", col.Name)
+			}
+			_ = binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+			buf.WriteString(s)
+		case EParquetColumnType.Int64():
+			v, ok := values[i].(int64)
+			if !ok {
+				return fmt.Errorf("column %s requires an int64 value", col.Name)
+			}
+			_ = binary.Write(buf, binary.LittleEndian, v)
+		case EParquetColumnType.Timestamp():
+			t, ok := values[i].(time.Time)
+			if !ok {
+				return fmt.Errorf("column %s requires a time.Time value", col.Name)
+			}
+			_ = binary.Write(buf, binary.LittleEndian, t.UnixNano()/int64(time.Millisecond))
+		}
+	}
+
+	pw.bufferedRow++
+	if pw.bufferedRow >= pw.rowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *ParquetWriter) flushRowGroup() error {
+	if pw.bufferedRow == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{numRows: int64(pw.bufferedRow)}
+	for i := range pw.columns {
+		data := pw.buffers[i].Bytes()
+
+		// each column chunk consists of a single data page. Since all columns are required,
+		// there are no definition or repetition levels to write before the values
+		header := thriftCompactWriter{}
+		header.structBegin()
+		header.fieldI32(1, parquetPageTypeData)
+		header.fieldI32(2, int32(len(data)))
+		header.fieldI32(3, int32(len(data)))
+		header.fieldStructBegin(5)
+		header.fieldI32(1, int32(pw.bufferedRow))
+		header.fieldI32(2, parquetEncodingPlain)
+		header.fieldI32(3, parquetEncodingRLE)
+		header.fieldI32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunk := parquetColumnChunk{dataPageOffset: pw.w.count, numValues: int64(pw.bufferedRow)}
+		if _, err := pw.w.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := pw.w.Write(data); err != nil {
+			return err
+		}
+		chunk.size = pw.w.count - chunk.dataPageOffset
+		group.totalSize += chunk.size
+		group.chunks = append(group.chunks, chunk)
+
+		pw.buffers[i].Reset()
+	}
+
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.totalRows += group.numRows
+	pw.bufferedRow = 0
+	return nil
+}
+
+// Close writes any buffered rows and the file footer. It does not close the underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+
+	meta := thriftCompactWriter{}
+	meta.structBegin()
+	meta.fieldI32(1, 1) // version
+
+	meta.fieldListBegin(2, thriftTypeStruct, len(pw.columns)+1)
+	// the root of the schema is a group holding all the columns
+	meta.structBegin()
+	meta.fieldString(4, "schema")
+	meta.fieldI32(5, int32(len(pw.columns)))
+	meta.structEnd()
+	for _, col := range pw.columns {
+		meta.structBegin()
+		meta.fieldI32(1, col.physicalType())
+		meta.fieldI32(3, parquetRepetitionRequired)
+		meta.fieldString(4, col.Name)
+		if ct, ok := col.convertedType(); ok {
+			meta.fieldI32(6, ct)
+		}
+		meta.structEnd()
+	}
+
+	meta.fieldI64(3, pw.totalRows)
+
+	meta.fieldListBegin(4, thriftTypeStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		meta.structBegin()
+		meta.fieldListBegin(1, thriftTypeStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			col := pw.columns[i]
+			meta.structBegin()
+			meta.fieldI64(2, chunk.dataPageOffset)
+			meta.fieldStructBegin(3)
+			meta.fieldI32(1, col.physicalType())
+			meta.fieldListBegin(2, thriftTypeI32, 2)
+			meta.writeZigzagVarint(parquetEncodingPlain)
+			meta.writeZigzagVarint(parquetEncodingRLE)
+			meta.fieldListBegin(3, thriftTypeBinary, 1)
+			meta.writeBinary(col.Name)
+			meta.fieldI32(4, parquetCodecUncompressed)
+			meta.fieldI64(5, chunk.numValues)
+			meta.fieldI64(6, chunk.size)
+			meta.fieldI64(7, chunk.size)
+			meta.fieldI64(9, chunk.dataPageOffset)
+			meta.structEnd() // ColumnMetaData
+			meta.structEnd() // ColumnChunk
+		}
+		meta.fieldI64(2, group.totalSize)
+		meta.fieldI64(3, group.numRows)
+		meta.structEnd() // RowGroup
+	}
+
+	meta.fieldString(6, "AzCopy "+AzcopyVersion)
+	meta.structEnd()
+
+	if _, err := pw.w.Write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(pw.w, binary.LittleEndian, uint32(meta.buf.Len())); err != nil {
+		return err
+	}
+	_, err := pw.w.Write([]byte(parquetMagic))
+	return err
+}
+
+func (c ParquetColumn) physicalType() int32 {
+	if c.Type == EParquetColumnType.String() {
+		return parquetTypeByteArray
+	}
+	return parquetTypeInt64
+}
+
+func (c ParquetColumn) convertedType() (int32, bool) {
+	switch c.Type {
+	case EParquetColumnType.String():
+		return parquetConvertedTypeUTF8, true
+	case EParquetColumnType.Timestamp():
+		return parquetConvertedTypeTimestampMs, true
+	default:
+		return 0, false
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// thriftCompactWriter encodes the subset of the Thrift compact protocol needed for Parquet metadata.
+// Field ids must be written in increasing order within each struct.
+type thriftCompactWriter struct {
+	buf         bytes.Buffer
+	lastFieldID []int16 // one entry per open struct
+}
+
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+func (t *thriftCompactWriter) fieldHeader(id int16, typ byte) {
+	last := &t.lastFieldID[len(t.lastFieldID)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.writeZigzagVarint(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftCompactWriter) writeVarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	t.buf.Write(tmp[:n])
+}
+
+func (t *thriftCompactWriter) writeZigzagVarint(v int64) {
+	t.writeVarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftCompactWriter) writeBinary(s string) {
+	t.writeVarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftCompactWriter) fieldI32(id int16, v int32) {
+	t.fieldHeader(id, thriftTypeI32)
+	t.writeZigzagVarint(int64(v))
+}
+
+func (t *thriftCompactWriter) fieldI64(id int16, v int64) {
+	t.fieldHeader(id, thriftTypeI64)
+	t.writeZigzagVarint(v)
+}
+
+func (t *thriftCompactWriter) fieldString(id int16, s string) {
+	t.fieldHeader(id, thriftTypeBinary)
+	t.writeBinary(s)
+}
+
+// structBegin starts a struct that is not the value of a field, i.e. the outermost struct, or an element of a list.
+// Its fields follow, then structEnd
+func (t *thriftCompactWriter) structBegin() {
+	t.lastFieldID = append(t.lastFieldID, 0)
+}
+
+// fieldStructBegin starts a struct-valued field. Its fields follow, then structEnd
+func (t *thriftCompactWriter) fieldStructBegin(id int16) {
+	t.fieldHeader(id, thriftTypeStruct)
+	t.structBegin()
+}
+
+func (t *thriftCompactWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.lastFieldID = t.lastFieldID[:len(t.lastFieldID)-1]
+}
+
+// fieldListBegin starts a list-valued field. The elements follow, with no terminator after the last one
+func (t *thriftCompactWriter) fieldListBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftTypeList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xF0 | elemType)
+		t.writeVarint(uint64(size))
+	}
+}
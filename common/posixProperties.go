@@ -0,0 +1,56 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PosixProperties are the owner, group and mode of a file, in the form that the File service uses for NFS shares:
+// the owner and group are numeric IDs, and the mode is four octal digits, e.g. 0644, including the setuid, setgid and sticky bits
+type PosixProperties struct {
+	Owner string
+	Group string
+	Mode  string
+}
+
+// NewPosixProperties formats the owner, group and mode of a file
+func NewPosixProperties(uid uint32, gid uint32, mode uint32) PosixProperties {
+	return PosixProperties{Owner: strconv.FormatUint(uint64(uid), 10), Group: strconv.FormatUint(uint64(gid), 10), Mode: fmt.Sprintf("%04o", mode&07777)}
+}
+
+// Parse returns the owner, group and mode as numbers
+func (p PosixProperties) Parse() (uid uint32, gid uint32, mode uint32, err error) {
+	owner, err := strconv.ParseUint(p.Owner, 10, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid owner %q", p.Owner)
+	}
+	group, err := strconv.ParseUint(p.Group, 10, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid group %q", p.Group)
+	}
+	m, err := strconv.ParseUint(p.Mode, 8, 32)
+	if err != nil || m > 07777 {
+		return 0, 0, 0, fmt.Errorf("invalid mode %q", p.Mode)
+	}
+	return uint32(owner), uint32(group), uint32(m), nil
+}
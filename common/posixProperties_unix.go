@@ -0,0 +1,57 @@
+//go:build linux || darwin
+// +build linux darwin
+
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// GetPosixProperties returns the owner, group and mode of a local file
+func GetPosixProperties(path string) (PosixProperties, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return PosixProperties{}, err
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return PosixProperties{}, fmt.Errorf("the owner and group of %s are not available", path)
+	}
+	return NewPosixProperties(stat.Uid, stat.Gid, uint32(stat.Mode)), nil
+}
+
+// SetPosixProperties sets the owner, group and mode of a local file.
+// The owner is set first, since changing it can clear the setuid and setgid bits.
+func SetPosixProperties(path string, p PosixProperties) error {
+	uid, gid, mode, err := p.Parse()
+	if err != nil {
+		return err
+	}
+	if err = os.Lchown(path, int(uid), int(gid)); err != nil {
+		return err
+	}
+	// the bits of os.FileMode aren't those of the mode, for setuid, setgid and sticky
+	return syscall.Chmod(path, mode)
+}
@@ -0,0 +1,179 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PropertyMappingRule copies the value of a property of the source to a property of the destination, in a service to
+// service copy between Azure Files and Blob Storage. E.g. smb:last-write-time=metadata:original_mtime keeps the
+// last write time of a file, which a blob has no property for, in the metadata of the blob.
+type PropertyMappingRule struct {
+	Source      string
+	Destination string
+}
+
+// PropertyMapping is a list of rules, applied together, so that the value of every rule is read before any is written
+type PropertyMapping []PropertyMappingRule
+
+const (
+	propertyMetadataPrefix = "metadata:"
+	propertySMBPrefix      = "smb:"
+
+	PropertySMBCreationTime  = "smb:creation-time"
+	PropertySMBLastWriteTime = "smb:last-write-time"
+	PropertySMBAttributes    = "smb:attributes"
+)
+
+// the HTTP headers that can be mapped, which both blobs and files have
+var mappableHTTPHeaders = map[string]func(h *ResourceHTTPHeaders) *string{
+	"content-type":        func(h *ResourceHTTPHeaders) *string { return &h.ContentType },
+	"content-encoding":    func(h *ResourceHTTPHeaders) *string { return &h.ContentEncoding },
+	"content-disposition": func(h *ResourceHTTPHeaders) *string { return &h.ContentDisposition },
+	"content-language":    func(h *ResourceHTTPHeaders) *string { return &h.ContentLanguage },
+	"cache-control":       func(h *ResourceHTTPHeaders) *string { return &h.CacheControl },
+}
+
+var smbProperties = map[string]bool{
+	PropertySMBCreationTime:  true,
+	PropertySMBLastWriteTime: true,
+	PropertySMBAttributes:    true,
+}
+
+// ParsePropertyMapping parses rules in the form source=destination, separated by semicolons.
+// The properties are HTTP headers (e.g. content-type), metadata:<key>, and, as sources only, the SMB properties
+// of files (smb:creation-time, smb:last-write-time and smb:attributes)
+func ParsePropertyMapping(s string) (PropertyMapping, error) {
+	mapping := make(PropertyMapping, 0)
+	for _, raw := range strings.Split(s, ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		parts := strings.Split(raw, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("property mapping rule '%s' must be in the form source=destination", raw)
+		}
+		rule := PropertyMappingRule{Source: normalizePropertyName(parts[0]), Destination: normalizePropertyName(parts[1])}
+
+		if !smbProperties[rule.Source] && !isMappableProperty(rule.Source) {
+			return nil, fmt.Errorf("unknown source property '%s' in property mapping rule '%s'", parts[0], raw)
+		}
+		if !isMappableProperty(rule.Destination) {
+			if smbProperties[rule.Destination] {
+				return nil, fmt.Errorf("SMB properties can't be set by a property mapping rule ('%s')", raw)
+			}
+			return nil, fmt.Errorf("unknown destination property '%s' in property mapping rule '%s'", parts[1], raw)
+		}
+		mapping = append(mapping, rule)
+	}
+	return mapping, nil
+}
+
+// normalizePropertyName lowercases everything but the key of metadata, which keeps the case the user gave it
+func normalizePropertyName(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(strings.ToLower(name), propertyMetadataPrefix) {
+		return propertyMetadataPrefix + name[len(propertyMetadataPrefix):]
+	}
+	return strings.ToLower(name)
+}
+
+func isMappableProperty(name string) bool {
+	if strings.HasPrefix(name, propertyMetadataPrefix) {
+		return len(name) > len(propertyMetadataPrefix)
+	}
+	_, ok := mappableHTTPHeaders[name]
+	return ok
+}
+
+// String returns the rules in the form that ParsePropertyMapping reads
+func (m PropertyMapping) String() string {
+	rules := make([]string, len(m))
+	for i, rule := range m {
+		rules[i] = rule.Source + "=" + rule.Destination
+	}
+	return strings.Join(rules, ";")
+}
+
+// UsesSMBProperties says whether any rule reads an SMB property, which only files have
+func (m PropertyMapping) UsesSMBProperties() bool {
+	for _, rule := range m {
+		if smbProperties[rule.Source] {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply sets the destination properties of the rules on the headers and metadata. It returns the metadata, as a new map
+// if it was changed, since the given one may be shared. Rules whose source property has no value change nothing.
+func (m PropertyMapping) Apply(headers *ResourceHTTPHeaders, metadata Metadata, smb map[string]string) Metadata {
+	if len(m) == 0 {
+		return metadata
+	}
+
+	values := make([]string, len(m))
+	for i, rule := range m {
+		switch {
+		case smbProperties[rule.Source]:
+			values[i] = smb[rule.Source]
+		case strings.HasPrefix(rule.Source, propertyMetadataPrefix):
+			values[i] = metadata.lookup(rule.Source[len(propertyMetadataPrefix):])
+		default:
+			values[i] = *mappableHTTPHeaders[rule.Source](headers)
+		}
+	}
+
+	mapped := make(Metadata, len(metadata))
+	for k, v := range metadata {
+		mapped[k] = v
+	}
+	for i, rule := range m {
+		if values[i] == "" {
+			continue
+		}
+		if strings.HasPrefix(rule.Destination, propertyMetadataPrefix) {
+			key := rule.Destination[len(propertyMetadataPrefix):]
+			for k := range mapped {
+				if strings.EqualFold(k, key) {
+					delete(mapped, k) // replaced, whatever case it had
+				}
+			}
+			mapped[key] = values[i]
+		} else {
+			*mappableHTTPHeaders[rule.Destination](headers) = values[i]
+		}
+	}
+	return mapped
+}
+
+// lookup returns the value of a metadata key, ignoring case as the services do
+func (m Metadata) lookup(key string) string {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,357 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRotationOptions bound the size of a job's log. Zero values mean no limit, and the log is a single file,
+// which is how it has always been.
+type LogRotationOptions struct {
+	MaxFileSize    int64         // start a new file before this many bytes are in the current one
+	MaxFiles       int           // keep at most this many rotated files, besides the current one
+	RotateInterval time.Duration // start a new file when the current one is this old
+	Compress       bool          // gzip each file once it's rotated, and the current one when the log is closed
+}
+
+// compressed log files are named <name>.log.gz, or <name>.<n>.log.gz
+const compressedLogSuffix = ".gz"
+
+// IsLogFileName says whether the file is a log, compressed or not
+func IsLogFileName(name string) bool {
+	return strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log"+compressedLogSuffix)
+}
+
+// the log rotation of the job logs created from now on. Set from AZCOPY_LOG_MAX_SIZE_MB, AZCOPY_LOG_MAX_FILES,
+// AZCOPY_LOG_ROTATE_INTERVAL and AZCOPY_LOG_COMPRESS
+var jobLogRotation = LogRotationOptions{}
+
+func SetJobLogRotation(options LogRotationOptions) {
+	jobLogRotation = options
+}
+
+// LogRotationOptionsFromEnvironment reads the log rotation environment variables
+func LogRotationOptionsFromEnvironment() (LogRotationOptions, error) {
+	lcm := GetLifecycleMgr()
+	options := LogRotationOptions{}
+
+	if raw := lcm.GetEnvironmentVariable(EEnvironmentVariable.LogMaxSizeMB()); raw != "" {
+		mb, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || mb < 0 {
+			return options, fmt.Errorf("invalid %s '%s'. It must be a whole number of MB", EEnvironmentVariable.LogMaxSizeMB().Name, raw)
+		}
+		options.MaxFileSize = mb * 1024 * 1024
+	}
+
+	if raw := lcm.GetEnvironmentVariable(EEnvironmentVariable.LogMaxFiles()); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return options, fmt.Errorf("invalid %s '%s'. It must be a whole number", EEnvironmentVariable.LogMaxFiles().Name, raw)
+		}
+		options.MaxFiles = n
+	}
+
+	if raw := lcm.GetEnvironmentVariable(EEnvironmentVariable.LogRotateInterval()); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return options, fmt.Errorf("invalid %s '%s'. It must be a duration, such as 1h or 24h", EEnvironmentVariable.LogRotateInterval().Name, raw)
+		}
+		options.RotateInterval = d
+	}
+
+	if raw := lcm.GetEnvironmentVariable(EEnvironmentVariable.LogCompress()); raw != "" {
+		compress, err := strconv.ParseBool(raw)
+		if err != nil {
+			return options, fmt.Errorf("invalid %s '%s'. It must be true or false", EEnvironmentVariable.LogCompress().Name, raw)
+		}
+		options.Compress = compress
+	}
+
+	return options, nil
+}
+
+// rotatingLogFile writes to <name>.log, and when that gets too big or too old, renames it to <name>.<n>.log,
+// with n counting up, and starts a new one. The rotated names still start with the job ID and end in .log,
+// so removing and cleaning up jobs finds them as it does the current file.
+type rotatingLogFile struct {
+	mu       sync.Mutex
+	folder   string
+	name     string // the file name, without .log
+	options  LogRotationOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	rotated  []int // the numbers of the rotated files, oldest first
+	closed   bool
+}
+
+func openRotatingLogFile(folder string, name string, options LogRotationOptions) (*rotatingLogFile, error) {
+	f := &rotatingLogFile{folder: folder, name: name, options: options}
+
+	// a resumed job carries on from the files that are already there
+	if options.MaxFileSize > 0 || options.RotateInterval > 0 {
+		entries, err := ioutil.ReadDir(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if n, ok := f.rotatedNumber(e.Name()); ok {
+				f.rotated = append(f.rotated, n)
+			}
+		}
+		sort.Ints(f.rotated)
+		f.rotated = uniqueInts(f.rotated) // a resumed job can have both <name>.<n>.log and <name>.<n>.log.gz
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingLogFile) currentPath() string {
+	return filepath.Join(f.folder, f.name+".log")
+}
+
+func (f *rotatingLogFile) rotatedPath(n int) string {
+	return filepath.Join(f.folder, f.name+"."+strconv.Itoa(n)+".log")
+}
+
+func (f *rotatingLogFile) rotatedNumber(fileName string) (int, bool) {
+	fileName = strings.TrimSuffix(fileName, compressedLogSuffix)
+	if !strings.HasPrefix(fileName, f.name+".") || !strings.HasSuffix(fileName, ".log") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(fileName, f.name+"."), ".log"))
+	return n, err == nil && n > 0
+}
+
+func (f *rotatingLogFile) open() error {
+	file, err := os.OpenFile(f.currentPath(), os.O_RDWR|os.O_CREATE|os.O_APPEND, DEFAULT_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+func (f *rotatingLogFile) shouldRotate(nextWriteSize int) bool {
+	if f.size == 0 {
+		// never leave an empty file behind, and let a line that is bigger than the limit have a file of its own
+		return false
+	}
+	if f.options.MaxFileSize > 0 && f.size+int64(nextWriteSize) > f.options.MaxFileSize {
+		return true
+	}
+	return f.options.RotateInterval > 0 && time.Since(f.openedAt) >= f.options.RotateInterval
+}
+
+func (f *rotatingLogFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	next := 1
+	if len(f.rotated) > 0 {
+		next = f.rotated[len(f.rotated)-1] + 1
+	}
+	if err := os.Rename(f.currentPath(), f.rotatedPath(next)); err != nil {
+		// carry on in the same file, rather than lose the log
+		return f.open()
+	}
+	f.rotated = append(f.rotated, next)
+	if f.options.Compress {
+		// nothing more is written to it, so it's compressed now, rather than waiting for the log to be closed
+		_ = gzipLogFile(f.rotatedPath(next))
+	}
+
+	if f.options.MaxFiles > 0 {
+		for len(f.rotated) > f.options.MaxFiles {
+			_ = os.Remove(f.rotatedPath(f.rotated[0]))
+			_ = os.Remove(f.rotatedPath(f.rotated[0]) + compressedLogSuffix)
+			f.rotated = f.rotated[1:]
+		}
+	}
+
+	return f.open()
+}
+
+func (f *rotatingLogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingLogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.options.Compress {
+		f.compress()
+	}
+	return nil
+}
+
+func (f *rotatingLogFile) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// compress gzips the files of the log, now that nothing more will be written to them.
+// A file that can't be compressed is left as it is, since it's still a perfectly good log.
+func (f *rotatingLogFile) compress() {
+	paths := []string{f.currentPath()}
+	for _, n := range f.rotated {
+		paths = append(paths, f.rotatedPath(n))
+	}
+	for _, path := range paths {
+		_ = gzipLogFile(path)
+	}
+}
+
+// gzipLogFile compresses the file to <path>.gz, and deletes it. If there's a .gz file already, because a resumed job
+// is closing its log again, the new lines are appended to it as another gzip member, which gunzip and zcat read
+// as if the whole file had been compressed in one go.
+func gzipLogFile(path string) error {
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil // already compressed, when an earlier run of the job closed the log
+	} else if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+compressedLogSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, DEFAULT_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	info, err := dst.Stat()
+	if err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		// don't leave a half written member behind, since it would make the lines before it unreadable too
+		_ = dst.Truncate(info.Size())
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	_ = src.Close() // Windows can't delete open files
+	return os.Remove(path)
+}
+
+// JobLogFiles returns the files of the log of a job, oldest first: the rotated files, then the current one.
+// Files that were compressed come before any uncompressed file of the same name, since a resumed job adds to the
+// plain file after the compressed one was written.
+func JobLogFiles(folder string, jobID JobID) ([]string, error) {
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &rotatingLogFile{folder: folder, name: jobID.String()}
+	existing := make(map[string]bool)
+	var rotated []int
+	for _, e := range entries {
+		existing[filepath.Join(folder, e.Name())] = true
+		if n, ok := f.rotatedNumber(e.Name()); ok {
+			rotated = append(rotated, n)
+		}
+	}
+	sort.Ints(rotated)
+	rotated = uniqueInts(rotated)
+
+	candidates := make([]string, 0, len(rotated)+1)
+	for _, n := range rotated {
+		candidates = append(candidates, f.rotatedPath(n))
+	}
+	candidates = append(candidates, f.currentPath())
+
+	paths := make([]string, 0)
+	for _, path := range candidates {
+		if existing[path+compressedLogSuffix] {
+			paths = append(paths, path+compressedLogSuffix)
+		}
+		if existing[path] {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func uniqueInts(sorted []int) []int {
+	result := sorted[:0]
+	for i, n := range sorted {
+		if i == 0 || n != sorted[i-1] {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -23,6 +23,9 @@ func (RpcCmd) CancelJob() RpcCmd          { return RpcCmd("Cancel") }
 func (RpcCmd) PauseJob() RpcCmd           { return RpcCmd("PauseJob") }
 func (RpcCmd) ResumeJob() RpcCmd          { return RpcCmd("ResumeJob") }
 func (RpcCmd) GetJobFromTo() RpcCmd       { return RpcCmd("GetJobFromTo") }
+func (RpcCmd) GetJobStatus() RpcCmd       { return RpcCmd("GetJobStatus") }
+func (RpcCmd) VerifyJob() RpcCmd          { return RpcCmd("VerifyJob") }
+func (RpcCmd) SetJobCap() RpcCmd          { return RpcCmd("SetJobCap") }
 
 func (c RpcCmd) String() string {
 	return enum.String(c, reflect.TypeOf(c))
@@ -45,6 +48,7 @@ type CopyJobPartOrderRequest struct {
 	JobID          JobID           // Guid - job identifier
 	PartNum        PartNumber      // part number of the job
 	IsFinalPart    bool            // to determine the final part for a specific job
+	ScanComplete   bool            // set on parts that were held back until the scan of the source was complete, e.g. with enumerate-first
 	ForceWrite     OverwriteOption // to determine if the existing needs to be overwritten or not. If set to true, existing blobs are overwritten
 	AutoDecompress bool            // if true, source data with encodings that represent compression are automatically decompressed when downloading
 	Priority       JobPriority     // priority of the task
@@ -61,11 +65,39 @@ type CopyJobPartOrderRequest struct {
 	// commandString hold the user given command which is logged to the Job log file
 	CommandString  string
 	CredentialInfo CredentialInfo
+	// labels (JSON of key value pairs) and description given by the user, to correlate the job with business activities
+	Labels      string
+	Description string
+	// where the manifest of the transferred files is written when the job completes, and the key it is signed with
+	ManifestPath       string
+	ManifestSigningKey string
+	// rules that copy properties of the source to other properties of the destination, in the form of PropertyMapping.String
+	PropertyMapping string
+	// where an empty marker is created, relative to the destination root, when the job completes without failures
+	SuccessMarker string
+	// the job that this job waited for, because it was to start only when that job completed successfully
+	AfterJobID JobID
 
 	S2SGetPropertiesInBackend      bool
 	S2SSourceChangeValidation      bool
 	DestLengthValidation           bool
 	S2SInvalidMetadataHandleOption InvalidMetadataHandleOption
+	AllowSecondaryRead             bool // for downloads from RA-GRS accounts
+	SourceChangePolicy             SourceChangePolicy
+	MaxWriteLatencyMilliseconds    uint32 // zero means writes are not held back when the destination is slow
+	FileTimeBudgetSecondsPerGB     uint32 // zero means transfers have no time budget
+	DeleteSourceAfter              DeleteSourceAfter
+	AssertSourceUnchanged          AssertSourceUnchanged
+	MaxAccountThroughputFraction   float32 // zero means the job is not held to a fraction of the account limit
+	PropertiesOnly                 bool    // update the properties of existing destinations, without copying any data
+	JournalTransitions             bool    // record each state transition of each transfer in the journal of the job
+	FolderCreation                 FolderCreationPolicy
+	WriteOnce                      bool          // uploads fail with a conflict, rather than overwriting, if the destination exists (If-None-Match: *)
+	ContentPolicy                  ContentPolicy // files that break its rules are rejected or quarantined, rather than transferred as usual
+	PreservePermissions            bool          // copy the owner, group, permissions and ACL of each file and its directories, between accounts with hierarchical namespaces
+	PreservePosixProperties        bool          // keep the owner, group and mode of each file, for Azure Files NFS shares and the local file systems they're copied to and from
+	DailyCapBytes                  uint64        // zero means the bytes sent and received in a day aren't capped
+	SourceSASFromLogin             bool          // the SourceSAS is a user delegation SAS minted from the login, so resuming the job mints a new one
 }
 
 // CredentialInfo contains essential credential info which need be transited between modules,
@@ -119,6 +151,7 @@ type BlobTransferAttributes struct {
 	MD5ValidationOption      HashValidationOption  // when downloading, how strictly should we validate MD5 hashes?
 	BlockSizeInBytes         uint32                // when uploading/downloading/copying, specify the size of each chunk
 	DeleteSnapshotsOption    DeleteSnapshotsOption // when deleting, specify what to do with the snapshots
+	ConvertToVHD             bool                  // when uploading, present VHDX and qcow2 images as fixed VHDs
 }
 
 type JobIDDetails struct {
@@ -126,6 +159,20 @@ type JobIDDetails struct {
 	CommandString string
 	StartTime     int64
 	JobStatus     JobStatus
+
+	// the roots of the source and destination, without any query string (so without SAS)
+	Source      string
+	Destination string
+
+	// sum of the sizes of all the transfers in the job, and of the ones that succeeded
+	TotalBytes       uint64
+	BytesTransferred uint64
+
+	Labels      map[string]string
+	Description string
+
+	// the job that this job waited for before it started, if any
+	AfterJobID JobID
 }
 
 // ListJobsResponse represent the Job with JobId and
@@ -174,14 +221,72 @@ type ListJobSummaryResponse struct {
 	AverageE2EMilliseconds int
 	ServerBusyPercentage   float32
 	NetworkErrorPercentage float32
+	// the share of requests sent on connections that had been used before, and how many idle connections were found to have been dropped
+	ConnectionReusePercentage float32
+	DroppedIdleConnections    int64
 
 	FailedTransfers  []TransferDetail
 	SkippedTransfers []TransferDetail
+	// the slowest transfers of the job, slowest first.
+	// Will be empty if read outside the process running the job (e.g. with 'jobs show' command)
+	SlowestTransfers []SlowTransferDetail
 	PerfConstraint   PerfConstraint
 	PerfStrings      []string `json:"-"`
 
+	// for jobs that delete each source after it has been transferred and verified.
+	// Will be zero/empty if read outside the process running the job (e.g. with 'jobs show' command)
+	SourcesDeleted         uint32
+	SourceDeletionFailures []SourceDeletionFailure
+
+	// for jobs that write a manifest of the dataset when they complete.
+	// Will be empty if read outside the process running the job (e.g. with 'jobs show' command)
+	ManifestPath  string
+	ManifestError string
+
+	// for jobs with a content policy. The files rejected by the policy are also counted in TransfersSkipped.
+	// The violations (and so the quarantined count) will be empty if read outside the process running the job (e.g. with 'jobs show' command)
+	TransfersRejectedByPolicy uint32
+	TransfersQuarantined      uint32
+	PolicyViolations          []PolicyViolation
+
+	// for jobs with a malware scan. The infected files that were skipped are also counted in TransfersSkipped,
+	// and both the skipped and the quarantined ones are among the PolicyViolations
+	TransfersSkippedInfected uint32
+
 	PerformanceAdvice []PerformanceAdvice
 	IsCleanupJob      bool
+
+	// the ways in which the totals of the job differ from those that the user said to expect.
+	// Only the command that ran the job knows what to expect, so only it sets this
+	ReconciliationMismatches []string `json:",omitempty"`
+
+	// the concurrency settings that the job was started (or last resumed) with, as recorded in its plan file.
+	// Will be empty for jobs whose plan file was written by an older version
+	Concurrency []ConcurrencySetting
+
+	// how much of the job was transferred while its source was still being scanned.
+	// Will be nil until the scan is complete, and if read outside the process that ran the scan (e.g. with 'jobs show' command)
+	ScanOverlap *ScanOverlap `json:",omitempty"`
+}
+
+// ScanOverlap describes how a job overlapped transferring with the scan of its source. Each part of the job starts
+// transferring as soon as the scan has found enough transfers to fill it, unless the job was told to scan everything first
+type ScanOverlap struct {
+	// how many parts of the job were ordered before the scan was complete
+	PartsOrderedWhileScanning uint32
+	// the time from the first part being ordered until the scan was complete, during which the job was transferring while the scan went on
+	OverlapSeconds float64
+	// how many transfers had finished (successfully or not), and how many bytes had been transferred by those that succeeded,
+	// by the time the scan was complete
+	TransfersDoneWhileScanning    uint32
+	BytesTransferredWhileScanning uint64
+}
+
+// ConcurrencySetting is one of the concurrency settings that a job ran with, and why it had that value
+type ConcurrencySetting struct {
+	Name   string
+	Value  string
+	Source string
 }
 
 // wraps the standard ListJobSummaryResponse with sync-specific stats
@@ -189,6 +294,8 @@ type ListSyncJobSummaryResponse struct {
 	ListJobSummaryResponse
 	DeleteTotalTransfers     uint32
 	DeleteTransfersCompleted uint32
+	// how many of the deleted blobs can be recovered through the soft delete policy of the destination account
+	DeleteTransfersRecoverable uint32
 }
 
 type ListJobTransfersRequest struct {
@@ -213,6 +320,31 @@ type TransferDetail struct {
 	ErrorCode      int32
 }
 
+// represents how long a single transfer took, for reporting the slowest transfers of a job
+type SlowTransferDetail struct {
+	Src                 string
+	Dst                 string
+	SourceSize          int64
+	ElapsedMilliseconds int64
+	TransferStatus      TransferStatus
+	Requeued            bool // true if the transfer ran over its time budget, and was tried again
+}
+
+// represents a source that was transferred and verified, but could not be deleted afterwards
+type SourceDeletionFailure struct {
+	Src      string
+	ErrorMsg string
+}
+
+// represents a file that broke a rule of the content policy of the job
+type PolicyViolation struct {
+	Src         string
+	Dst         string // for quarantined files, where in the quarantine folder the file went
+	Rule        string
+	Quarantined bool
+	Infected    bool // found by the malware scan, rather than by a rule
+}
+
 type CancelPauseResumeResponse struct {
 	ErrorMsg              string
 	CancelledPauseResumed bool
@@ -230,10 +362,71 @@ type GetJobFromToRequest struct {
 	JobID JobID
 }
 
+// GetJobStatusRequest indicates request to get the status of a job, which may be running in another AzCopy process
+type GetJobStatusRequest struct {
+	JobID JobID
+}
+
+// GetJobStatusResponse indicates response to get the status of a job.
+type GetJobStatusResponse struct {
+	ErrorMsg  string
+	JobStatus JobStatus
+	// NotFound is true when there are no plan files for the job, as opposed to an error reading them
+	NotFound bool
+	// CompletelyOrdered is true when the final part of the job was ordered, i.e. its enumeration was not interrupted
+	CompletelyOrdered bool
+}
+
+// SetJobCapRequest indicates request to change the cap of a running job, which is usually running in another AzCopy process
+type SetJobCapRequest struct {
+	JobID   JobID
+	CapMbps uint32 // zero removes the cap
+}
+
+// SetJobCapResponse indicates response to change the cap of a job
+type SetJobCapResponse struct {
+	ErrorMsg string
+}
+
+// VerifyJobRequest indicates request to check the destinations of the transfers of a completed job
+type VerifyJobRequest struct {
+	JobID          JobID
+	SourceSAS      string
+	DestinationSAS string
+	CredentialInfo CredentialInfo
+}
+
+// VerificationDiscrepancy is a transfer whose destination no longer matches what was transferred
+type VerificationDiscrepancy struct {
+	Src     string
+	Dst     string
+	Problem string
+}
+
+// VerifyJobResponse is the report of the verification of a job
+type VerifyJobResponse struct {
+	ErrorMsg string
+
+	// the successful transfers whose destinations were checked, including any checked by an earlier, interrupted, verification
+	TransfersVerified uint32
+	// the transfers whose destinations had the right size, but whose hash could not be compared, since the source
+	// or the destination had none
+	HashesNotChecked uint32
+	// the transfers whose destinations were missing or different. They are marked as failed, so that resuming the job transfers them again
+	Discrepancies []VerificationDiscrepancy
+	// the transfers whose destinations could not be checked, because of network errors for instance.
+	// They are checked when the verification is run again
+	NotChecked []VerificationDiscrepancy
+
+	// where the full report is written
+	ReportPath string
+}
+
 // GetJobFromToResponse indicates response to get job's FromTo info.
 type GetJobFromToResponse struct {
-	ErrorMsg    string
-	FromTo      FromTo
-	Source      string
-	Destination string
+	ErrorMsg           string
+	FromTo             FromTo
+	Source             string
+	Destination        string
+	SourceSASFromLogin bool
 }
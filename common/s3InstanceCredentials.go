@@ -0,0 +1,191 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/pkg/credentials"
+)
+
+// Where AWS makes the temporary credentials of the role AzCopy runs as available, in the order the AWS SDKs look for them.
+// In an ECS task (or anything else that emulates it, such as EKS pod identity), the container agent serves them from the URL
+// in AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI. On an EC2 instance, the instance metadata
+// service serves those of the instance profile, and must be asked with a session token (IMDSv2) where IMDSv1 is turned off
+const (
+	ecsCredentialsEndpoint        = "http://169.254.170.2"
+	ec2InstanceMetadataEndpoint   = "http://169.254.169.254"
+	ec2InstanceMetadataTokenPath  = "/latest/api/token"
+	ec2InstanceMetadataCredsPath  = "/latest/meta-data/iam/security-credentials/"
+	ec2InstanceMetadataTokenTTL   = "21600" // seconds. Only the one retrieval uses each token, so the length hardly matters
+	s3InstanceCredentialsExpiryIn = time.Minute
+)
+
+// s3InstanceCredentialsProvider gets the temporary credentials of the ECS task or EC2 instance profile that AzCopy runs as.
+// They are fetched again shortly before they expire, so long jobs keep working
+type s3InstanceCredentialsProvider struct {
+	credentials.Expiry
+	client *http.Client
+
+	// where to find the credentials. Set from the environment, and overridden by tests
+	ecsEndpoint      string
+	ecsRelativeURI   string
+	ecsFullURI       string
+	ecsAuthToken     string
+	instanceMetadata string
+}
+
+func newS3InstanceCredentialsProvider(client *http.Client) *s3InstanceCredentialsProvider {
+	return &s3InstanceCredentialsProvider{
+		client:           client,
+		ecsEndpoint:      ecsCredentialsEndpoint,
+		ecsRelativeURI:   os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"),
+		ecsFullURI:       os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"),
+		ecsAuthToken:     os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"),
+		instanceMetadata: ec2InstanceMetadataEndpoint,
+	}
+}
+
+// the credentials as both the ECS container agent and the instance metadata service return them
+type s3InstanceCredentialsResponse struct {
+	Code            string // only set by the instance metadata service
+	Message         string
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (p *s3InstanceCredentialsProvider) Retrieve() (credentials.Value, error) {
+	var creds s3InstanceCredentialsResponse
+	var err error
+	switch {
+	case p.ecsRelativeURI != "":
+		creds, err = p.getECSCredentials(p.ecsEndpoint + p.ecsRelativeURI)
+	case p.ecsFullURI != "":
+		creds, err = p.getECSCredentials(p.ecsFullURI)
+	default:
+		creds, err = p.getEC2Credentials()
+	}
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return credentials.Value{}, errors.New("the credentials that were returned have no access key")
+	}
+
+	p.SetExpiration(creds.Expiration, s3InstanceCredentialsExpiryIn)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func (p *s3InstanceCredentialsProvider) getECSCredentials(url string) (s3InstanceCredentialsResponse, error) {
+	header := http.Header{}
+	if p.ecsAuthToken != "" {
+		header.Set("Authorization", p.ecsAuthToken)
+	}
+	body, err := p.get(http.MethodGet, url, header)
+	if err != nil {
+		return s3InstanceCredentialsResponse{}, fmt.Errorf("getting the credentials of the ECS task: %v", err)
+	}
+	defer body.Close()
+
+	var creds s3InstanceCredentialsResponse
+	err = json.NewDecoder(body).Decode(&creds)
+	return creds, err
+}
+
+func (p *s3InstanceCredentialsProvider) getEC2Credentials() (s3InstanceCredentialsResponse, error) {
+	header := http.Header{}
+	// IMDSv2 wants a session token. As in the AWS SDKs, we do without if it can't be had, e.g. from an instance that only
+	// has IMDSv1, or from a container whose responses to PUTs can't make it back through the number of hops allowed
+	if token, err := p.get(http.MethodPut, p.instanceMetadata+ec2InstanceMetadataTokenPath,
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {ec2InstanceMetadataTokenTTL}}); err == nil {
+		value, readErr := ioutil.ReadAll(token)
+		_ = token.Close()
+		if readErr == nil {
+			header.Set("X-Aws-Ec2-Metadata-Token", strings.TrimSpace(string(value)))
+		}
+	}
+
+	// an instance profile has one role
+	roles, err := p.get(http.MethodGet, p.instanceMetadata+ec2InstanceMetadataCredsPath, header)
+	if err != nil {
+		return s3InstanceCredentialsResponse{}, fmt.Errorf("getting the role of the instance profile: %v", err)
+	}
+	scanner := bufio.NewScanner(roles)
+	role := ""
+	if scanner.Scan() {
+		role = strings.TrimSpace(scanner.Text())
+	}
+	_ = roles.Close()
+	if role == "" {
+		return s3InstanceCredentialsResponse{}, errors.New("the EC2 instance has no instance profile role")
+	}
+
+	body, err := p.get(http.MethodGet, p.instanceMetadata+ec2InstanceMetadataCredsPath+role, header)
+	if err != nil {
+		return s3InstanceCredentialsResponse{}, fmt.Errorf("getting the credentials of the instance profile role %s: %v", role, err)
+	}
+	defer body.Close()
+
+	var creds s3InstanceCredentialsResponse
+	if err = json.NewDecoder(body).Decode(&creds); err != nil {
+		return creds, err
+	}
+	if creds.Code != "" && creds.Code != "Success" {
+		return creds, fmt.Errorf("getting the credentials of the instance profile role %s: %s %s", role, creds.Code, creds.Message)
+	}
+	return creds, nil
+}
+
+// get sends the request, and returns the body of its response, if it's a success
+func (p *s3InstanceCredentialsProvider) get(method string, url string, header http.Header) (io.ReadCloser, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("the service returned %s", resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,229 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sftpDefaultPort = "22"
+
+// SftpURLParts represents the components of an SFTP URL, e.g. sftp://user@host:2222/data/file.txt
+// As in the draft standard for SFTP URLs, the path is absolute, unless it starts with /~/, in which case it's relative to the user's home directory
+type SftpURLParts struct {
+	User string // Ex: "user"
+	Host string // Ex: "host:2222", with the default port if the URL doesn't give one
+	Path string // Ex: "/data/file.txt", or "data/file.txt" for sftp://user@host/~/data/file.txt
+}
+
+// IsSftpURL verifies if a given URL points to an SFTP server
+func IsSftpURL(u url.URL) bool {
+	return strings.EqualFold(u.Scheme, "sftp")
+}
+
+// NewSftpURLParts parses an SFTP URL into its parts
+func NewSftpURLParts(u url.URL) (SftpURLParts, error) {
+	if !IsSftpURL(u) {
+		return SftpURLParts{}, fmt.Errorf("%s is not an SFTP URL", u.String())
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return SftpURLParts{}, errors.New("the SFTP URL must say who to log in as, e.g. sftp://user@host/path")
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return SftpURLParts{}, errors.New("passwords aren't supported for SFTP, since they'd be saved in the job plan and the logs. Use a key instead")
+	}
+	if u.Hostname() == "" {
+		return SftpURLParts{}, errors.New("the SFTP URL must say which server to connect to")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = sftpDefaultPort
+	}
+
+	p := u.Path
+	switch {
+	case p == "" || p == "/~" || p == "/~/":
+		p = "."
+	case strings.HasPrefix(p, "/~/"):
+		p = strings.TrimPrefix(p, "/~/")
+	}
+
+	return SftpURLParts{User: u.User.Username(), Host: net.JoinHostPort(u.Hostname(), port), Path: p}, nil
+}
+
+// Server identifies the login on the server, so that connections can be shared by everything that uses the same one
+func (p SftpURLParts) Server() string {
+	return p.User + "@" + p.Host
+}
+
+// SftpClient is an SFTP session, with the SSH connection it runs on
+type SftpClient struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+// NewSftpClientOnConnection wraps an SFTP session that is already established. conn may be nil, if the session doesn't run on SSH
+func NewSftpClientOnConnection(client *sftp.Client, conn *ssh.Client) *SftpClient {
+	return &SftpClient{Client: client, conn: conn}
+}
+
+// Close ends the SFTP session, and the SSH connection under it
+func (c *SftpClient) Close() error {
+	err := c.Client.Close()
+	if c.conn != nil {
+		if connErr := c.conn.Close(); err == nil {
+			err = connErr
+		}
+	}
+	return err
+}
+
+// MkdirAll creates the directory at the given path, and any parents it needs
+func (c *SftpClient) MkdirAll(dir string) error {
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" || dir == "." {
+		return nil
+	}
+	if fi, err := c.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("%s exists, and is not a directory", dir)
+		}
+		return nil
+	}
+	if i := strings.LastIndex(dir, "/"); i > 0 {
+		if err := c.MkdirAll(dir[:i]); err != nil {
+			return err
+		}
+	}
+	err := c.Mkdir(dir)
+	if err != nil {
+		// someone else may have made it meanwhile, e.g. for another file in the same directory
+		if fi, statErr := c.Stat(dir); statErr == nil && fi.IsDir() {
+			return nil
+		}
+	}
+	return err
+}
+
+// CreateSftpClient logs in to the server in the URL, with the user's key, after checking that the server's key is one the user knows
+func CreateSftpClient(ctx context.Context, parts SftpURLParts) (*SftpClient, error) {
+	signer, err := getSftpSigner()
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := getSftpHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            parts.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	dialer := net.Dialer{}
+	netConn, err := dialer.DialContext(ctx, "tcp", parts.Host)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, parts.Host, config)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("couldn't log in to %s: %v", parts.Server(), err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("couldn't start SFTP on %s: %v", parts.Server(), err)
+	}
+	return NewSftpClientOnConnection(client, conn), nil
+}
+
+func sshDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh"), nil
+}
+
+func getSftpSigner() (ssh.Signer, error) {
+	keyPath := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.SftpKeyPath())
+	if keyPath == "" {
+		dir, err := sshDirectory()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				keyPath = filepath.Join(dir, name)
+				break
+			}
+		}
+		if keyPath == "" {
+			return nil, fmt.Errorf("no key found for SFTP. Put one in %s, or give its path in %s", dir, EEnvironmentVariable.SftpKeyPath().Name)
+		}
+	}
+
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.SftpKeyPassphrase()); passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the SFTP key in %s: %v. If it has a passphrase, give it in %s", keyPath, err, EEnvironmentVariable.SftpKeyPassphrase().Name)
+	}
+	return signer, nil
+}
+
+func getSftpHostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHostsPath := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.SftpKnownHosts())
+	if knownHostsPath == "" {
+		dir, err := sshDirectory()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsPath = filepath.Join(dir, "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the known SFTP host keys in %s: %v", knownHostsPath, err)
+	}
+	return callback, nil
+}
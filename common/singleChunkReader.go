@@ -69,6 +69,11 @@ type SingleChunkReader interface {
 	// WriteBufferTo writes the entire contents of the prefetched buffer to h
 	// Panics if the internal buffer has not been prefetched (or if its been discarded after a complete Read)
 	WriteBufferTo(h hash.Hash)
+
+	// ReleaseBuffer frees the prefetched data, if any. It is called while a request waits to be retried, so that
+	// chunks which are backing off (e.g. in a storm of 503s) don't hold RAM. The data is re-read from the source
+	// when the retry reads the chunk again.
+	ReleaseBuffer()
 }
 
 // Simple aggregation of existing io interfaces
@@ -359,7 +364,7 @@ func (cr *singleChunkReader) Close() error {
 	// This check originates from issue 191. Even tho we think we've now resolved that issue,
 	// we'll keep this code just to make sure.
 	if cr.positionInChunk < cr.length && cr.ctx.Err() == nil {
-		cr.generalLogger.Log(pipeline.LogInfo, "Early close of chunk in singleChunkReader with context still active")
+		LogWithCategory(cr.generalLogger, ELogCategory.Chunk(), pipeline.LogInfo, "Early close of chunk in singleChunkReader with context still active")
 		// cannot panic here, since this code path is NORMAL in the case of sparse files to Azure Files and Page Blobs
 	}
 
@@ -399,6 +404,16 @@ func (cr *singleChunkReader) GetPrologueState() PrologueState {
 	return PrologueState{LeadingBytes: leadingBytes}
 }
 
+func (cr *singleChunkReader) ReleaseBuffer() {
+	cr.use()
+	defer cr.unuse()
+
+	if cr.sourceFactory == nil {
+		return // we would have no way to re-read the data
+	}
+	cr.closeBuffer()
+}
+
 func (cr *singleChunkReader) WriteBufferTo(h hash.Hash) {
 	cr.use()
 	defer cr.unuse()
@@ -0,0 +1,57 @@
+//go:build linux || darwin
+// +build linux darwin
+
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"log/syslog"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+// syslogSink writes log entries to the local syslog daemon
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSystemLogSink() (LogSink, error) {
+	writer, err := syslog.New(syslog.LOG_WARNING|syslog.LOG_USER, "azcopy")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) LogEntry(level pipeline.LogLevel, jobID JobID, msg string) {
+	msg = "Job " + jobID.String() + ": " + msg
+
+	// the syslog package already reconnects if the daemon restarts, and there's nowhere to report it if it can't
+	switch level {
+	case pipeline.LogFatal, pipeline.LogPanic:
+		_ = s.writer.Crit(msg)
+	case pipeline.LogError:
+		_ = s.writer.Err(msg)
+	default:
+		_ = s.writer.Warning(msg)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+const (
+	eventIDJobError   = 1
+	eventIDJobWarning = 2
+)
+
+// eventLogSink writes log entries to the Application log of Windows, with AzCopy as the source
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+func newSystemLogSink() (LogSink, error) {
+	// the source doesn't have to be registered (which needs admin rights). If it isn't, Event Viewer says it can't
+	// find the description of the events, but still shows their text
+	l, err := eventlog.Open("AzCopy")
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogSink{log: l}, nil
+}
+
+func (s *eventLogSink) LogEntry(level pipeline.LogLevel, jobID JobID, msg string) {
+	msg = "Job " + jobID.String() + ": " + msg
+
+	// there's nowhere to report it if the event can't be written
+	if level == pipeline.LogWarning {
+		_ = s.log.Warning(eventIDJobWarning, msg)
+	} else {
+		_ = s.log.Error(eventIDJobError, msg)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Features that stage data on disk (e.g. spilled buffers, archives being built, compressed data) put it in a folder
+// of their own, under AZCOPY_TMP_DIR if it is set, since the system temp volume is often small. The folder is
+// private to this process, and is deleted when AzCopy exits.
+
+// the free space that must be left on the temp volume after a staged file has been written, so that staging doesn't
+// starve the rest of the system
+const minimumTempDirFreeSpaceMargin = 256 * 1024 * 1024
+
+// TempDirRoot returns the folder under which the staging folder of this process is created
+func TempDirRoot() string {
+	if dir := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.TempDir()); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// ValidateTempDir is called at startup, so that a mistyped AZCOPY_TMP_DIR is reported before any work is done, rather
+// than part way through a job
+func ValidateTempDir() error {
+	dir := GetLifecycleMgr().GetEnvironmentVariable(EEnvironmentVariable.TempDir())
+	if dir == "" {
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cannot use %s '%s': %v", EEnvironmentVariable.TempDir().Name, dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot use %s '%s': it is not a directory", EEnvironmentVariable.TempDir().Name, dir)
+	}
+	return nil
+}
+
+var processTempDir struct {
+	lock sync.Mutex
+	path string
+}
+
+// ProcessTempDir returns the staging folder of this process, creating it on first use
+func ProcessTempDir() (string, error) {
+	processTempDir.lock.Lock()
+	defer processTempDir.lock.Unlock()
+
+	if processTempDir.path == "" {
+		dir, err := ioutil.TempDir(TempDirRoot(), fmt.Sprintf("azcopy-%d-", os.Getpid()))
+		if err != nil {
+			return "", fmt.Errorf("cannot create a temporary folder (use %s to choose its location): %v", EEnvironmentVariable.TempDir().Name, err)
+		}
+		processTempDir.path = dir
+	}
+	return processTempDir.path, nil
+}
+
+// CreateTempFile creates a file in the staging folder, for the given number of bytes. If that many bytes (plus a
+// safety margin) can't fit on the volume, it fails straight away, rather than when the volume fills up.
+// Pass an expectedSize of 0 if the size is not known. The caller should remove the file once it's no longer needed,
+// but anything left over is deleted on exit anyway.
+func CreateTempFile(pattern string, expectedSize int64) (*os.File, error) {
+	dir, err := ProcessTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// if the free space cannot be determined, the check is skipped
+	if available, err := GetAvailableDiskSpace(dir); err == nil && uint64(expectedSize)+minimumTempDirFreeSpaceMargin > available {
+		return nil, fmt.Errorf("there is not enough free space in %s to stage %d bytes (%d bytes are available). Use %s to choose another location",
+			dir, expectedSize, available, EEnvironmentVariable.TempDir().Name)
+	}
+
+	return ioutil.TempFile(dir, pattern)
+}
+
+// CleanupTempDir deletes the staging folder of this process, with everything in it. It's called on exit.
+func CleanupTempDir() {
+	processTempDir.lock.Lock()
+	defer processTempDir.lock.Unlock()
+
+	if processTempDir.path != "" {
+		_ = os.RemoveAll(processTempDir.path)
+		processTempDir.path = ""
+	}
+}
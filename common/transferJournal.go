@@ -0,0 +1,60 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"path"
+)
+
+// TransferJournalEvent is what happened to a transfer, as recorded in the journal of its job
+type TransferJournalEvent string
+
+const (
+	TransferJournalScheduled     TransferJournalEvent = "Scheduled"     // the transfer was queued up
+	TransferJournalStarted       TransferJournalEvent = "Started"       // work on the transfer began
+	TransferJournalStatusChanged TransferJournalEvent = "StatusChanged" // the transfer status changed, to the one in the entry
+	TransferJournalVerified      TransferJournalEvent = "Verified"      // the destination passed the check named in the entry
+	TransferJournalRequeued      TransferJournalEvent = "Requeued"      // the transfer ran over its time budget, and will be tried once more
+	TransferJournalDone          TransferJournalEvent = "Done"          // the transfer is finished, with the status in the entry
+)
+
+// TransferJournalEntry is a single line of the journal of a job, which records every state transition of every transfer,
+// for audits that need evidence of exactly when each object was copied and verified.
+// The journal is append-only, and each entry is written as a line of JSON
+type TransferJournalEntry struct {
+	Time          string               `json:"time"`
+	JobID         JobID                `json:"jobId"`
+	PartNumber    PartNumber           `json:"partNumber"`
+	TransferIndex uint32               `json:"transferIndex"`
+	Source        string               `json:"source"`
+	Destination   string               `json:"destination"`
+	Event         TransferJournalEvent `json:"event"`
+	Status        string               `json:"status"`
+	Detail        string               `json:"detail,omitempty"`
+	RequestID     string               `json:"requestId,omitempty"` // the last request made for the transfer, to match the entry with the server logs
+	ErrorCode     int32                `json:"errorCode,omitempty"`
+}
+
+// TransferJournalFilePath is where the journal of the job is kept. Its extension is not .log, so that it outlives the removal
+// of the logs of the job
+func TransferJournalFilePath(logFileFolder string, jobID JobID) string {
+	return path.Join(logFileFolder, jobID.String()+".journal")
+}
@@ -0,0 +1,151 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type appendBlobLogWriterSuite struct{}
+
+var _ = chk.Suite(&appendBlobLogWriterSuite{})
+
+// fakeAppendBlobs is just enough of the Blob service to create append blobs and append blocks to them
+type fakeAppendBlobs struct {
+	lock  sync.Mutex
+	blobs map[string]*bytes.Buffer
+}
+
+func (f *fakeAppendBlobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("comp") == "appendblock" {
+		blob, ok := f.blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		blob.Write(body)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if _, ok := f.blobs[r.URL.Path]; ok && r.Header.Get("If-None-Match") == "*" {
+		w.Header().Set("x-ms-error-code", "BlobAlreadyExists")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	f.blobs[r.URL.Path] = &bytes.Buffer{}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *appendBlobLogWriterSuite) TestJobLogIsStreamedToAppendBlob(c *chk.C) {
+	service := &fakeAppendBlobs{blobs: map[string]*bytes.Buffer{}}
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "appendBlobLogWriterSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	c.Assert(SetJobLogRemoteLocation(server.URL+"/logs/azcopy?sig=secret"), chk.IsNil)
+	defer SetJobLogRemoteLocation("")
+
+	jobID := NewJobID()
+	writeJob := func(msg string) {
+		l := NewJobLogger(jobID, ELogLevel.Info(), NewAppLogger(pipeline.LogInfo, dir), dir)
+		l.OpenLog()
+		l.Log(pipeline.LogWarning, msg)
+		l.CloseLog()
+	}
+	writeJob("first run")
+	writeJob("resumed run") // appends to the same blob
+
+	blob, ok := service.blobs["/logs/azcopy/"+jobID.String()+".log"]
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(strings.Contains(blob.String(), "first run"), chk.Equals, true)
+	c.Assert(strings.Contains(blob.String(), "resumed run"), chk.Equals, true)
+	c.Assert(strings.Contains(blob.String(), "sig=secret"), chk.Equals, false)
+
+	// the local copy is still written
+	local, err := ioutil.ReadFile(dir + "/" + jobID.String() + ".log")
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Contains(string(local), "resumed run"), chk.Equals, true)
+}
+
+func (s *appendBlobLogWriterSuite) TestRemoteLogLocation(c *chk.C) {
+	c.Assert(IsRemoteLogLocation("https://account.blob.core.windows.net/logs?sig=x"), chk.Equals, true)
+	c.Assert(IsRemoteLogLocation("/var/log/azcopy"), chk.Equals, false)
+	c.Assert(IsRemoteLogLocation(`C:\logs`), chk.Equals, false)
+
+	defer SetJobLogRemoteLocation("")
+	c.Assert(SetJobLogRemoteLocation("https://account.blob.core.windows.net/?sig=x"), chk.NotNil) // no container
+	c.Assert(SetJobLogRemoteLocation("https://account.blob.core.windows.net/logs?sig=x"), chk.IsNil)
+
+	u, err := remoteLogBlobURL("https://account.blob.core.windows.net/logs/dir?sig=x", JobID{})
+	c.Assert(err, chk.IsNil)
+	c.Assert(u.Path, chk.Equals, "/logs/dir/"+JobID{}.String()+".log")
+	c.Assert(u.RawQuery, chk.Equals, "sig=x")
+}
+
+func (s *appendBlobLogWriterSuite) TestRemoteLogIsSentWhenJobCompletesAndAtExit(c *chk.C) {
+	service := &fakeAppendBlobs{blobs: map[string]*bytes.Buffer{}}
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "appendBlobLogWriterSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	c.Assert(SetJobLogRemoteLocation(server.URL+"/logs?sig=secret"), chk.IsNil)
+	defer SetJobLogRemoteLocation("")
+
+	jobID := NewJobID()
+	l := NewJobLogger(jobID, ELogLevel.Info(), NewAppLogger(pipeline.LogInfo, dir), dir)
+	l.OpenLog()
+	l.Log(pipeline.LogWarning, "last transfer done")
+	l.CloseRemoteLog()
+	blob := func() string {
+		service.lock.Lock()
+		defer service.lock.Unlock()
+		return service.blobs["/logs/"+jobID.String()+".log"].String()
+	}
+	c.Assert(strings.Contains(blob(), "last transfer done"), chk.Equals, true)
+
+	// what's logged after the job completes is sent on exit
+	l.Log(pipeline.LogWarning, "final summary")
+	l.CloseRemoteLog() // closing it twice is harmless
+	runExitHooks()
+	c.Assert(strings.Contains(blob(), "final summary"), chk.Equals, true)
+}
@@ -0,0 +1,77 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	chk "gopkg.in/check.v1"
+)
+
+type azureCloudSuite struct{}
+
+var _ = chk.Suite(&azureCloudSuite{})
+
+func (s *azureCloudSuite) TestParseAzureCloud(c *chk.C) {
+	cloud, err := ParseAzureCloud("azurechina")
+	c.Assert(err, chk.IsNil)
+	c.Assert(cloud.Name, chk.Equals, "AzureChina")
+	c.Assert(cloud.ActiveDirectoryEndpoint, chk.Equals, "https://login.chinacloudapi.cn")
+	c.Assert(cloud.HostBelongs("account.blob.core.chinacloudapi.cn"), chk.Equals, true)
+	c.Assert(cloud.HostBelongs("account.blob.core.windows.net"), chk.Equals, false)
+	c.Assert(cloud.ResourceManagerEndpoint, chk.Equals, "https://management.chinacloudapi.cn/")
+
+	cloud, err = ParseAzureCloud("authority=https://login.example.com;suffix=.core.example.com")
+	c.Assert(err, chk.IsNil)
+	c.Assert(cloud.ActiveDirectoryEndpoint, chk.Equals, "https://login.example.com")
+	c.Assert(cloud.StorageSuffix, chk.Equals, "core.example.com")
+	c.Assert(cloud.HostBelongs("Account.FILE.core.example.com:443"), chk.Equals, true)
+	c.Assert(cloud.IsEmpty(), chk.Equals, false)
+	c.Assert(cloud.ResourceManagerEndpoint, chk.Equals, "")
+
+	cloud, err = ParseAzureCloud("authority=https://login.example.com;suffix=core.example.com;arm=https://management.example.com/")
+	c.Assert(err, chk.IsNil)
+	c.Assert(cloud.ResourceManagerEndpoint, chk.Equals, "https://management.example.com/")
+
+	for _, invalid := range []string{"Mars", "authority=https://login.example.com", "authority=http://login.example.com;suffix=core.example.com", "suffix=x;colour=blue",
+		"suffix=core.example.com;arm=management.example.com"} {
+		_, err = ParseAzureCloud(invalid)
+		c.Assert(err, chk.NotNil, chk.Commentf(invalid))
+	}
+}
+
+func (s *azureCloudSuite) TestAzureCloudOfAuthority(c *chk.C) {
+	c.Assert(AzureCloudOfAuthority("https://login.microsoftonline.us/").Name, chk.Equals, "AzureUSGov")
+	c.Assert(AzureCloudOfAuthority("https://login.microsoftonline.us/").ResourceManagerEndpoint, chk.Equals, "https://management.usgovcloudapi.net/")
+	c.Assert(AzureCloudOfAuthority(DefaultActiveDirectoryEndpoint).ResourceManagerEndpoint, chk.Equals, ARMResource)
+	c.Assert(AzureCloudOfAuthority("").Name, chk.Equals, "AzurePublic")
+}
+
+func (s *azureCloudSuite) TestOAuthTokenInfoForAuthority(c *chk.C) {
+	userLogin := OAuthTokenInfo{ActiveDirectoryEndpoint: DefaultActiveDirectoryEndpoint, Tenant: DefaultTenantID}
+
+	// the same authority needs no new token
+	same, err := userLogin.ForAuthority(DefaultActiveDirectoryEndpoint + "/")
+	c.Assert(err, chk.IsNil)
+	c.Assert(same.Tenant, chk.Equals, DefaultTenantID)
+
+	// a user login can't be moved to another cloud
+	_, err = userLogin.ForAuthority("https://login.chinacloudapi.cn")
+	c.Assert(err, chk.NotNil)
+}
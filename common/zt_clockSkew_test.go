@@ -0,0 +1,72 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"net/http"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type clockSkewSuite struct{}
+
+var _ = chk.Suite(&clockSkewSuite{})
+
+func responseDated(serviceTime time.Time) *http.Response {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Date", serviceTime.UTC().Format(http.TimeFormat))
+	return resp
+}
+
+func (s *clockSkewSuite) TestClockSkew(c *chk.C) {
+	serviceTime := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	skew, ok := ClockSkew(responseDated(serviceTime), serviceTime.Add(7*time.Minute))
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(skew, chk.Equals, 7*time.Minute)
+
+	skew, ok = ClockSkew(responseDated(serviceTime), serviceTime.Add(-90*time.Second))
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(skew, chk.Equals, -90*time.Second)
+
+	_, ok = ClockSkew(nil, serviceTime)
+	c.Assert(ok, chk.Equals, false)
+	_, ok = ClockSkew(&http.Response{Header: http.Header{"Date": []string{"yesterday"}}}, serviceTime)
+	c.Assert(ok, chk.Equals, false)
+}
+
+func (s *clockSkewSuite) TestClockSkewHint(c *chk.C) {
+	serviceTime := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	c.Assert(ClockSkewHint(responseDated(serviceTime), serviceTime.Add(7*time.Minute)), chk.Matches, "The local clock is 7m ahead of the clock of the storage service.*")
+	c.Assert(ClockSkewHint(responseDated(serviceTime), serviceTime.Add(-65*time.Minute)), chk.Matches, "The local clock is 1h5m behind the clock of the storage service.*")
+
+	// a few seconds either way is normal, and can't be the cause of the failure
+	c.Assert(ClockSkewHint(responseDated(serviceTime), serviceTime.Add(20*time.Second)), chk.Equals, "")
+	c.Assert(ClockSkewHint(&http.Response{Header: http.Header{}}, serviceTime.Add(time.Hour)), chk.Equals, "")
+}
+
+func (s *clockSkewSuite) TestDescribeClockSkew(c *chk.C) {
+	c.Assert(DescribeClockSkew(7*time.Minute+20*time.Second), chk.Equals, "7m ahead of")
+	c.Assert(DescribeClockSkew(-2*time.Hour), chk.Equals, "2h behind")
+	c.Assert(DescribeClockSkew(time.Hour+10*time.Minute), chk.Equals, "1h10m ahead of")
+}
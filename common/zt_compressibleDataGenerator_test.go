@@ -0,0 +1,78 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	chk "gopkg.in/check.v1"
+)
+
+type compressibleDataGeneratorSuite struct{}
+
+var _ = chk.Suite(&compressibleDataGeneratorSuite{})
+
+func (s *compressibleDataGeneratorSuite) compressedFraction(c *chk.C, data []byte) float64 {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err := w.Write(data)
+	c.Assert(err, chk.IsNil)
+	c.Assert(w.Close(), chk.IsNil)
+	return float64(compressed.Len()) / float64(len(data))
+}
+
+func (s *compressibleDataGeneratorSuite) TestCompressibleDataCompresses(c *chk.C) {
+	const length = 10 * 1024 * 1024
+	data := make([]byte, length)
+
+	g := NewCompressibleDataGenerator(length)
+	defer g.Close()
+	n, err := g.ReadAt(data, 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(n, chk.Equals, length)
+	c.Assert(s.compressedFraction(c, data) < 0.5, chk.Equals, true)
+
+	// while random data doesn't
+	r := NewRandomDataGenerator(length)
+	defer r.Close()
+	_, err = r.ReadAt(data, 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(s.compressedFraction(c, data) > 0.9, chk.Equals, true)
+}
+
+func (s *compressibleDataGeneratorSuite) TestReadsAtOffsetsAreConsistent(c *chk.C) {
+	const length = compressibleTextLength + 1000
+	g := NewCompressibleDataGenerator(length)
+
+	whole := make([]byte, length)
+	_, err := g.ReadAt(whole, 0)
+	c.Assert(err, chk.IsNil)
+
+	// a read that wraps around the end of the text
+	part := make([]byte, 2000)
+	_, err = g.ReadAt(part, compressibleTextLength-1000)
+	c.Assert(err, chk.IsNil)
+	c.Assert(part, chk.DeepEquals, whole[compressibleTextLength-1000:])
+
+	_, err = g.ReadAt(part, length-1000)
+	c.Assert(err, chk.NotNil)
+}
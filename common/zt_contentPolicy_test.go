@@ -0,0 +1,67 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	chk "gopkg.in/check.v1"
+)
+
+type contentPolicySuite struct{}
+
+var _ = chk.Suite(&contentPolicySuite{})
+
+func (s *contentPolicySuite) TestParse(c *chk.C) {
+	c.Assert(NormalizeExtensions(" .EXE;dll;; .Bat "), chk.DeepEquals, []string{"exe", "dll", "bat"})
+
+	signatures, err := ParseContentSignatures("4D5A; 7f454c46;")
+	c.Assert(err, chk.IsNil)
+	c.Assert(signatures, chk.DeepEquals, []string{"4d5a", "7f454c46"})
+
+	for _, bad := range []string{"MZ", "4D5", "0x4D5A"} {
+		_, err = ParseContentSignatures(bad)
+		c.Assert(err, chk.NotNil)
+	}
+}
+
+func (s *contentPolicySuite) TestCheckFile(c *chk.C) {
+	c.Assert(ContentPolicy{}.IsEmpty(), chk.Equals, true)
+
+	policy := ContentPolicy{MaxFileSize: 100, BlockedExtensions: []string{"exe"}}
+	c.Assert(policy.CheckFile("/data/report.csv", 100), chk.Equals, "")
+	c.Assert(policy.CheckFile("/data/report.csv", 101), chk.Equals, "larger than the max file size of 100 bytes")
+	c.Assert(policy.CheckFile("/data/setup.EXE", 10), chk.Equals, "extension 'exe' is blocked")
+	c.Assert(policy.CheckFile("https://account.blob.core.windows.net/c/setup.exe?versionid=1", 10), chk.Equals, "extension 'exe' is blocked")
+
+	allowOnly := ContentPolicy{AllowedExtensions: []string{"csv", "parquet"}}
+	c.Assert(allowOnly.CheckFile(`C:\data\part-0.parquet`, 10), chk.Equals, "")
+	c.Assert(allowOnly.CheckFile("/data/notes.txt", 10), chk.Equals, "extension 'txt' is not allowed")
+	c.Assert(allowOnly.CheckFile("/data/Makefile", 10), chk.Equals, "extension '' is not allowed")
+	c.Assert(allowOnly.CheckFile("/data.d/.bashrc", 10), chk.Equals, "extension '' is not allowed")
+}
+
+func (s *contentPolicySuite) TestCheckContent(c *chk.C) {
+	policy := ContentPolicy{BlockedSignatures: []string{"4d5a", "7f454c46"}}
+	c.Assert(policy.SignatureLength(), chk.Equals, 4)
+	c.Assert(policy.CheckContent([]byte("MZ\x90\x00")), chk.Equals, "content matches the blocked signature 4d5a")
+	c.Assert(policy.CheckContent([]byte("\x7fELF")), chk.Equals, "content matches the blocked signature 7f454c46")
+	c.Assert(policy.CheckContent([]byte("\x7fEL")), chk.Equals, "") // too short to match
+	c.Assert(policy.CheckContent([]byte("a,b,c")), chk.Equals, "")
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	chk "gopkg.in/check.v1"
+)
+
+type crawlerSuite struct{}
+
+var _ = chk.Suite(&crawlerSuite{})
+
+// listFakeDir makes a tree that is depth levels deep, where every directory has width subdirectories and width items
+func listFakeDir(depth, width int) EnumerateOneDirFunc {
+	return func(dir interface{}, enqueueDir func(interface{}), enqueueOutput func(interface{}, error) error) error {
+		dirPath := dir.(string)
+		for i := 0; i < width; i++ {
+			if len(dirPath) < depth*2 {
+				enqueueDir(fmt.Sprintf("%s%d/", dirPath, i))
+			}
+			if err := enqueueOutput(fmt.Sprintf("%sitem%d", dirPath, i), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (s *crawlerSuite) TestCrawlFindsEverything(c *chk.C) {
+	for _, parallelism := range []int{1, 4, 32} {
+		found := make(map[string]int)
+		for r := range Crawl(context.Background(), "", listFakeDir(3, 5), parallelism) {
+			c.Assert(r.Err, chk.IsNil)
+			found[r.Item.(string)]++
+		}
+
+		// 1 + 5 + 25 + 125 directories, each with 5 items
+		c.Assert(len(found), chk.Equals, 156*5)
+		for item, count := range found {
+			c.Assert(count, chk.Equals, 1, chk.Commentf("%s", item))
+		}
+	}
+}
+
+func (s *crawlerSuite) TestCrawlReportsErrors(c *chk.C) {
+	listErr := errors.New("cannot list")
+	failSubdirs := func(dir interface{}, enqueueDir func(interface{}), enqueueOutput func(interface{}, error) error) error {
+		if dir.(string) != "" {
+			return listErr
+		}
+		enqueueDir("a/")
+		enqueueDir("b/")
+		return enqueueOutput("item", nil)
+	}
+
+	items, errs := 0, 0
+	for r := range Crawl(context.Background(), "", failSubdirs, 4) {
+		if r.Err != nil {
+			c.Assert(r.Err, chk.Equals, listErr)
+			errs++
+		} else {
+			items++
+		}
+	}
+
+	c.Assert(items, chk.Equals, 1)
+	c.Assert(errs, chk.Equals, 2)
+}
+
+func (s *crawlerSuite) TestCrawlStopsWhenCancelled(c *chk.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := Crawl(ctx, "", listFakeDir(10, 10), 8) // far too big to ever finish
+
+	for i := 0; i < 100; i++ {
+		<-results
+	}
+	cancel()
+
+	// the channel must be closed, without everything having been listed
+	remaining := 0
+	for range results {
+		remaining++
+	}
+	c.Assert(remaining < 10000, chk.Equals, true)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"crypto/tls"
+	"os"
+
+	chk "gopkg.in/check.v1"
+)
+
+type fipsModeSuite struct{}
+
+var _ = chk.Suite(&fipsModeSuite{})
+
+func (s *fipsModeSuite) TestFIPSModeEnvironmentVariable(c *chk.C) {
+	name := EEnvironmentVariable.FIPSMode().Name
+	defer os.Unsetenv(name)
+
+	os.Unsetenv(name)
+	c.Assert(ValidateFIPSMode(), chk.IsNil)
+	c.Assert(FIPSModeEnabled(), chk.Equals, false)
+	c.Assert(TLSConfigForMode(), chk.IsNil)
+
+	os.Setenv(name, "true")
+	c.Assert(ValidateFIPSMode(), chk.IsNil)
+	c.Assert(FIPSModeEnabled(), chk.Equals, true)
+	c.Assert(TLSConfigForMode(), chk.NotNil)
+
+	// a typo must not quietly turn the restrictions off
+	os.Setenv(name, "ture")
+	c.Assert(ValidateFIPSMode(), chk.ErrorMatches, ".*invalid value 'ture'.*")
+	c.Assert(FIPSModeEnabled(), chk.Equals, false)
+}
+
+func (s *fipsModeSuite) TestHashOptionsInFIPSMode(c *chk.C) {
+	name := EEnvironmentVariable.FIPSMode().Name
+	defer os.Unsetenv(name)
+
+	os.Unsetenv(name)
+	c.Assert(ValidateHashOptionsForFIPS(true, EHashValidationOption.FailIfDifferentOrMissing()), chk.IsNil)
+	c.Assert(DefaultHashValidationOptionForMode(), chk.Equals, DefaultHashValidationOption)
+	c.Assert(FIPSModeValidationNotice(true), chk.Equals, "")
+
+	os.Setenv(name, "true")
+	c.Assert(DefaultHashValidationOptionForMode(), chk.Equals, EHashValidationOption.NoCheck())
+	c.Assert(ValidateHashOptionsForFIPS(false, EHashValidationOption.NoCheck()), chk.IsNil)
+	c.Assert(ValidateHashOptionsForFIPS(true, EHashValidationOption.NoCheck()), chk.ErrorMatches, "put-md5 cannot be used.*")
+	c.Assert(ValidateHashOptionsForFIPS(false, EHashValidationOption.LogOnly()), chk.ErrorMatches, "check-md5 LogOnly cannot be used.*")
+
+	// the user is told that only the length is left to validate the transfers with, if even that
+	c.Assert(FIPSModeValidationNotice(true), chk.Matches, ".*only be validated by their length.*")
+	c.Assert(FIPSModeValidationNotice(false), chk.Matches, ".*not be validated at all.*")
+}
+
+func (s *fipsModeSuite) TestFIPSTLSConfig(c *chk.C) {
+	config := FIPSTLSConfig()
+	c.Assert(config.MinVersion, chk.Equals, uint16(tls.VersionTLS12))
+	c.Assert(config.MaxVersion, chk.Equals, uint16(tls.VersionTLS12))
+	approved := map[uint16]bool{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: true,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   true,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: true,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   true,
+	}
+	for _, suite := range config.CipherSuites {
+		c.Assert(approved[suite], chk.Equals, true)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type jobLoggerSuite struct{}
+
+var _ = chk.Suite(&jobLoggerSuite{})
+
+func (s *jobLoggerSuite) writeLog(c *chk.C, format LogFormat, write func(l ILoggerResetable)) []string {
+	dir, err := ioutil.TempDir("", "jobLoggerSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	defer SetJobLogFormat(ELogFormat.Text())
+	SetJobLogFormat(format)
+	jobID := NewJobID()
+	l := NewJobLogger(jobID, ELogLevel.Info(), NewAppLogger(pipeline.LogInfo, dir), dir)
+	l.OpenLog()
+	write(l)
+	l.CloseLog()
+
+	f, err := os.Open(filepath.Join(dir, jobID.String()+".log"))
+	c.Assert(err, chk.IsNil)
+	defer f.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func (s *jobLoggerSuite) TestJsonLogEntries(c *chk.C) {
+	lines := s.writeLog(c, ELogFormat.Json(), func(l ILoggerResetable) {
+		l.Log(pipeline.LogWarning, "job level\nsecond line")
+		l.LogTransfer(pipeline.LogError, 3, 17, "transfer failed: https://a.blob.core.windows.net/c/b?sig=secret&se=x")
+		l.Log(pipeline.LogDebug, "below the minimum level")
+	})
+
+	entries := make([]map[string]interface{}, 0)
+	for _, line := range lines {
+		var e map[string]interface{}
+		c.Assert(json.Unmarshal([]byte(line), &e), chk.IsNil, chk.Commentf(line))
+		c.Assert(e["time"], chk.NotNil)
+		c.Assert(e["jobId"], chk.NotNil)
+		entries = append(entries, e)
+	}
+
+	// the header and footer are entries too
+	c.Assert(strings.HasPrefix(entries[0]["message"].(string), "AzcopyVersion"), chk.Equals, true)
+	c.Assert(entries[len(entries)-1]["message"], chk.Equals, "Closing Log")
+
+	var jobEntry, transferEntry map[string]interface{}
+	for _, e := range entries {
+		switch e["level"] {
+		case "WARN":
+			jobEntry = e
+		case "ERR":
+			transferEntry = e
+		case "DBG":
+			c.Fatal("entry below the minimum level was logged")
+		}
+	}
+	c.Assert(jobEntry, chk.NotNil)
+	c.Assert(jobEntry["message"], chk.Equals, "job level\nsecond line")
+	_, hasTransfer := jobEntry["transferIndex"]
+	c.Assert(hasTransfer, chk.Equals, false)
+
+	c.Assert(transferEntry, chk.NotNil)
+	c.Assert(transferEntry["partNum"], chk.Equals, float64(3))
+	c.Assert(transferEntry["transferIndex"], chk.Equals, float64(17))
+	c.Assert(strings.Contains(transferEntry["message"].(string), "sig=-REDACTED-&se=x"), chk.Equals, true)
+}
+
+func (s *jobLoggerSuite) TestTextLogKeepsTransferPrefix(c *chk.C) {
+	lines := s.writeLog(c, ELogFormat.Text(), func(l ILoggerResetable) {
+		l.LogTransfer(pipeline.LogError, 3, 17, "transfer failed")
+	})
+
+	found := false
+	for _, line := range lines {
+		if strings.HasSuffix(line, "ERR: [P#3-T#17] transfer failed") {
+			found = true
+		}
+	}
+	c.Assert(found, chk.Equals, true)
+}
+
+func (s *jobLoggerSuite) TestResolveJobLogFormat(c *chk.C) {
+	os.Setenv(EEnvironmentVariable.LogFormat().Name, "json")
+	defer os.Unsetenv(EEnvironmentVariable.LogFormat().Name)
+
+	format, err := ResolveJobLogFormat("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(format, chk.Equals, ELogFormat.Json())
+
+	// the command line takes precedence
+	format, err = ResolveJobLogFormat("text")
+	c.Assert(err, chk.IsNil)
+	c.Assert(format, chk.Equals, ELogFormat.Text())
+
+	_, err = ResolveJobLogFormat("xml")
+	c.Assert(err, chk.NotNil)
+}
+
+type recordingLogSink struct {
+	levels   []pipeline.LogLevel
+	messages []string
+}
+
+func (r *recordingLogSink) LogEntry(level pipeline.LogLevel, jobID JobID, msg string) {
+	r.levels = append(r.levels, level)
+	r.messages = append(r.messages, msg)
+}
+
+func (s *jobLoggerSuite) TestWarningsAndErrorsGoToSinks(c *chk.C) {
+	sink := &recordingLogSink{}
+	s.writeLog(c, ELogFormat.Text(), func(l ILoggerResetable) {
+		l.AddSink(sink)
+		l.Log(pipeline.LogInfo, "info")
+		l.Log(pipeline.LogWarning, "warning")
+		l.LogTransfer(pipeline.LogError, 0, 5, "failed: https://a.blob.core.windows.net/c/b?sig=secret")
+		l.Log(pipeline.LogDebug, "debug")
+	})
+
+	c.Assert(sink.levels, chk.DeepEquals, []pipeline.LogLevel{pipeline.LogWarning, pipeline.LogError})
+	c.Assert(sink.messages[0], chk.Equals, "warning")
+	c.Assert(strings.Contains(sink.messages[1], "[P#0-T#5]"), chk.Equals, true)
+	c.Assert(strings.Contains(sink.messages[1], "secret"), chk.Equals, false)
+}
+
+func (s *jobLoggerSuite) TestCategoriesAreLoggedAtTheirOwnLevels(c *chk.C) {
+	defer SetJobLogCategoryLevels(LogCategoryLevels{})
+	SetJobLogCategoryLevels(LogCategoryLevels{ELogCategory.Retry(): pipeline.LogWarning, ELogCategory.Enumeration(): pipeline.LogDebug})
+
+	lines := s.writeLog(c, ELogFormat.Text(), func(l ILoggerResetable) {
+		// the pipeline asks before building its messages, so it must know that debug messages may be logged
+		c.Assert(l.MinimumLogLevel(), chk.Equals, pipeline.LogDebug)
+		c.Assert(l.ShouldLogCategory(ELogCategory.Retry(), pipeline.LogInfo), chk.Equals, false)
+		c.Assert(l.ShouldLogCategory(ELogCategory.Auth(), pipeline.LogInfo), chk.Equals, true)
+
+		l.LogWithCategory(ELogCategory.Retry(), pipeline.LogInfo, "request succeeded (Try=1)")
+		l.LogWithCategory(ELogCategory.Retry(), pipeline.LogWarning, "request was slow (Try=2)")
+		l.LogWithCategory(ELogCategory.Enumeration(), pipeline.LogDebug, "scanned dir1")
+		l.Log(pipeline.LogDebug, "general debug message")
+		l.LogTransferWithCategory(ELogCategory.Retry(), pipeline.LogInfo, 0, 1, "body read retry (Try=2)")
+		l.LogTransferWithCategory(ELogCategory.Auth(), pipeline.LogInfo, 0, 1, "token refreshed")
+	})
+
+	log := strings.Join(lines, "\n")
+	c.Assert(strings.Contains(log, "request succeeded"), chk.Equals, false)
+	c.Assert(strings.Contains(log, "request was slow"), chk.Equals, true)
+	c.Assert(strings.Contains(log, "scanned dir1"), chk.Equals, true)
+	c.Assert(strings.Contains(log, "general debug message"), chk.Equals, false)
+	c.Assert(strings.Contains(log, "body read retry"), chk.Equals, false)
+	c.Assert(strings.Contains(log, "[P#0-T#1] token refreshed"), chk.Equals, true)
+}
+
+func (s *jobLoggerSuite) TestParseLogCategoryLevels(c *chk.C) {
+	levels, err := ParseLogCategoryLevels("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(levels, chk.HasLen, 0)
+
+	levels, err = ParseLogCategoryLevels(" retry=WARNING; Enumeration=info;auth=NONE;")
+	c.Assert(err, chk.IsNil)
+	c.Assert(levels, chk.DeepEquals, LogCategoryLevels{
+		ELogCategory.Retry():       pipeline.LogWarning,
+		ELogCategory.Enumeration(): pipeline.LogInfo,
+		ELogCategory.Auth():        pipeline.LogNone,
+	})
+
+	for _, bad := range []string{"retry", "retries=INFO", "retry=LOUD"} {
+		_, err = ParseLogCategoryLevels(bad)
+		c.Assert(err, chk.NotNil, chk.Commentf(bad))
+	}
+}
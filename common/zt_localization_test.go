@@ -0,0 +1,88 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"os"
+
+	chk "gopkg.in/check.v1"
+)
+
+type localizationSuite struct{}
+
+var _ = chk.Suite(&localizationSuite{})
+
+func (s *localizationSuite) TestNormalizeLocale(c *chk.C) {
+	cases := map[string]string{
+		"":                 "en",
+		"C":                "en",
+		"POSIX":            "en",
+		"de_DE.UTF-8":      "de-DE",
+		"de_DE.UTF-8@euro": "de-DE",
+		"pt-br":            "pt-BR",
+		"FR":               "fr",
+	}
+	for raw, expected := range cases {
+		c.Assert(NormalizeLocale(raw), chk.Equals, expected, chk.Commentf(raw))
+	}
+}
+
+func (s *localizationSuite) TestDetectLocale(c *chk.C) {
+	names := []string{EEnvironmentVariable.Language().Name, "LC_ALL", "LC_MESSAGES", "LANG"}
+	saved := map[string]string{}
+	for _, name := range names {
+		saved[name] = os.Getenv(name)
+		os.Unsetenv(name)
+	}
+	defer func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}()
+
+	c.Assert(DetectLocale(), chk.Equals, "en")
+	os.Setenv("LANG", "es_ES.UTF-8")
+	c.Assert(DetectLocale(), chk.Equals, "es-ES")
+	os.Setenv("LC_ALL", "fr_FR.UTF-8")
+	c.Assert(DetectLocale(), chk.Equals, "fr-FR")
+	os.Setenv(EEnvironmentVariable.Language().Name, "ja")
+	c.Assert(DetectLocale(), chk.Equals, "ja")
+}
+
+func (s *localizationSuite) TestTranslationFallback(c *chk.C) {
+	err := RegisterTranslation("xx", MessageCatalog{
+		MsgResponseYes:            "Yup",
+		MsgFailedToPerformCommand: "the %s command broke", // a verb is missing, so this is rejected
+		MessageKey("NoSuchKey"):   "never shown",
+	})
+	c.Assert(err, chk.ErrorMatches, ".*FailedToPerformCommand.*")
+	c.Assert(err, chk.ErrorMatches, ".*NoSuchKey.*")
+
+	// the region falls back to the language, and missing or rejected messages fall back to English
+	l := NewLocalizer("xx_YY.UTF-8")
+	c.Assert(l.Locale(), chk.Equals, "xx-YY")
+	c.Assert(l.ResponseOptionText(EResponseOption.Yes()), chk.Equals, "Yup")
+	c.Assert(l.ResponseOptionText(EResponseOption.No()), chk.Equals, "No")
+	c.Assert(l.Sprintf(MsgFailedToPerformCommand, "copy", "oops"), chk.Equals, "failed to perform copy command due to error: oops")
+
+	// logs stay in English unless asked otherwise
+	c.Assert(NewLocalizer("").Sprintf(MsgOverwriteDeclined, "a.txt"), chk.Equals, "a.txt will be skipped")
+}
@@ -64,3 +64,23 @@ func (s *multiSliceBytePoolerSuite) TestMultiSliceSlotInfo(c *chk.C) {
 	}
 
 }
+
+func (s *multiSliceBytePoolerSuite) TestMultiSlicePoolWithLimit(c *chk.C) {
+	const oneMB = 1024 * 1024
+	pool := NewMultiSizeSlicePoolWithLimit(8*oneMB, 2*oneMB).(*multiSizeSlicePool)
+
+	a, b, d := pool.RentSlice(oneMB), pool.RentSlice(oneMB), pool.RentSlice(oneMB)
+	pool.ReturnSlice(a)
+	pool.ReturnSlice(b)
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(2*oneMB))
+
+	// no room for the third, so it's thrown away
+	pool.ReturnSlice(d)
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(2*oneMB))
+
+	// renting and pruning make room again
+	_ = pool.RentSlice(oneMB)
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(oneMB))
+	pool.Prune()
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(0))
+}
@@ -0,0 +1,423 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type parquetReaderSuite struct{}
+
+var _ = chk.Suite(&parquetReaderSuite{})
+
+func (s *parquetReaderSuite) TestReadsWhatTheWriterWrites(c *chk.C) {
+	var b bytes.Buffer
+	w, err := NewParquetWriter(&b, []ParquetColumn{
+		{Name: "Name", Type: EParquetColumnType.String()},
+		{Name: "Size", Type: EParquetColumnType.Int64()},
+		{Name: "Modified", Type: EParquetColumnType.Timestamp()},
+	})
+	c.Assert(err, chk.IsNil)
+	w.rowGroupSize = 4
+	for i := 0; i < 10; i++ {
+		c.Assert(w.WriteRow(fmt.Sprintf("file%d", i), int64(i), time.Unix(int64(i), 0)), chk.IsNil)
+	}
+	c.Assert(w.Close(), chk.IsNil)
+
+	r, err := NewParquetReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	c.Assert(err, chk.IsNil)
+	c.Assert(r.Columns(), chk.DeepEquals, []string{"Name", "Size", "Modified"})
+	for i := 0; i < 10; i++ {
+		row, err := r.Next()
+		c.Assert(err, chk.IsNil)
+		c.Assert(row[0], chk.Equals, fmt.Sprintf("file%d", i))
+		c.Assert(row[1], chk.Equals, int64(i))
+		c.Assert(row[2].(time.Time).Equal(time.Unix(int64(i), 0)), chk.Equals, true)
+	}
+	_, err = r.Next()
+	c.Assert(err, chk.Equals, io.EOF)
+}
+
+// parquetTestColumn is a column of a file built by hand, with the pages of its only column chunk
+type parquetTestColumn struct {
+	schema func(t *thriftCompactWriter) // writes the fields of its schema element
+	codec  int32
+	pages  [][]byte
+}
+
+func parquetTestPage(pageType int32, uncompressedSize int, data []byte, header func(t *thriftCompactWriter)) []byte {
+	t := thriftCompactWriter{}
+	t.structBegin()
+	t.fieldI32(1, pageType)
+	t.fieldI32(2, int32(uncompressedSize))
+	t.fieldI32(3, int32(len(data)))
+	header(&t)
+	t.structEnd()
+	return append(t.buf.Bytes(), data...)
+}
+
+func parquetTestDataPage(numValues int, encoding int32, uncompressed, data []byte) []byte {
+	return parquetTestPage(parquetPageTypeData, len(uncompressed), data, func(t *thriftCompactWriter) {
+		t.fieldStructBegin(5)
+		t.fieldI32(1, int32(numValues))
+		t.fieldI32(2, encoding)
+		t.fieldI32(3, parquetEncodingRLE)
+		t.fieldI32(4, parquetEncodingRLE)
+		t.structEnd()
+	})
+}
+
+func parquetTestFile(numRows int, columns []parquetTestColumn) []byte {
+	var b bytes.Buffer
+	b.WriteString(parquetMagic)
+	offsets := make([]int64, len(columns))
+	for i, col := range columns {
+		offsets[i] = int64(b.Len())
+		for _, page := range col.pages {
+			b.Write(page)
+		}
+	}
+	end := int64(b.Len())
+
+	meta := thriftCompactWriter{}
+	meta.structBegin()
+	meta.fieldI32(1, 1)
+	meta.fieldListBegin(2, thriftTypeStruct, len(columns)+1)
+	meta.structBegin()
+	meta.fieldString(4, "schema")
+	meta.fieldI32(5, int32(len(columns)))
+	meta.structEnd()
+	for _, col := range columns {
+		meta.structBegin()
+		col.schema(&meta)
+		meta.structEnd()
+	}
+	meta.fieldI64(3, int64(numRows))
+	meta.fieldListBegin(4, thriftTypeStruct, 1)
+	meta.structBegin()
+	meta.fieldListBegin(1, thriftTypeStruct, len(columns))
+	for i, col := range columns {
+		size := end - offsets[i]
+		if i+1 < len(columns) {
+			size = offsets[i+1] - offsets[i]
+		}
+		meta.structBegin()
+		meta.fieldI64(2, offsets[i])
+		meta.fieldStructBegin(3)
+		meta.fieldI32(4, col.codec)
+		meta.fieldI64(7, size)
+		meta.fieldI64(9, offsets[i])
+		meta.structEnd()
+		meta.structEnd()
+	}
+	meta.fieldI64(3, int64(numRows))
+	meta.structEnd()
+	meta.structEnd()
+
+	b.Write(meta.buf.Bytes())
+	_ = binary.Write(&b, binary.LittleEndian, uint32(meta.buf.Len()))
+	b.WriteString(parquetMagic)
+	return b.Bytes()
+}
+
+// snappyLiterals encodes data in the Snappy block format, as literals only
+func snappyLiterals(data []byte) []byte {
+	out := make([]byte, binary.MaxVarintLen64)
+	out = out[:binary.PutUvarint(out, uint64(len(data)))]
+	for len(data) > 0 {
+		n := len(data)
+		if n > 60 {
+			n = 60
+		}
+		out = append(out, byte(n-1)<<2)
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return b.Bytes()
+}
+
+func plainByteArrays(values ...string) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(v)))
+		b.WriteString(v)
+	}
+	return b.Bytes()
+}
+
+// withLength prefixes levels (or RLE booleans) with their length, as in version 1 data pages
+func withLength(data []byte) []byte {
+	return append([]byte{byte(len(data)), 0, 0, 0}, data...)
+}
+
+func (s *parquetReaderSuite) TestReadsOptionalDictionaryAndCompressedColumns(c *chk.C) {
+	// three rows. Definition levels 1, 0, 1 (the second row is null) are a bit-packed group: header 3, then 0b101
+	present := []byte{3, 0x05}
+
+	// Name: required strings with the STRING logical type, dictionary-encoded and compressed with Snappy
+	dictionary := plainByteArrays("c/a.txt", "c/b.txt")
+	indices := []byte{1, 3, 0x02} // bit width 1, then a bit-packed group of 0, 1, 0
+	name := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeByteArray)
+			t.fieldI32(3, parquetRepetitionRequired)
+			t.fieldString(4, "Name")
+			t.fieldStructBegin(10)
+			t.fieldStructBegin(1)
+			t.structEnd()
+			t.structEnd()
+		},
+		codec: parquetCodecSnappy,
+		pages: [][]byte{
+			parquetTestPage(parquetPageTypeDictionary, len(dictionary), snappyLiterals(dictionary), func(t *thriftCompactWriter) {
+				t.fieldStructBegin(7)
+				t.fieldI32(1, 2)
+				t.fieldI32(2, parquetEncodingPlainDictionary)
+				t.structEnd()
+			}),
+			parquetTestDataPage(3, parquetEncodingRLEDictionary, indices, snappyLiterals(indices)),
+		},
+	}
+
+	// Content-Length: optional, in a version 2 data page, whose levels aren't compressed
+	sizes := make([]byte, 16)
+	binary.LittleEndian.PutUint64(sizes, 10)
+	binary.LittleEndian.PutUint64(sizes[8:], 30)
+	v2 := append(append([]byte{}, present...), snappyLiterals(sizes)...)
+	length := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeInt64)
+			t.fieldI32(3, parquetRepetitionOptional)
+			t.fieldString(4, "Content-Length")
+		},
+		codec: parquetCodecSnappy,
+		pages: [][]byte{parquetTestPage(parquetPageTypeDataV2, len(present)+len(sizes), v2, func(t *thriftCompactWriter) {
+			t.fieldStructBegin(8)
+			t.fieldI32(1, 3)
+			t.fieldI32(2, 1)
+			t.fieldI32(3, 3)
+			t.fieldI32(4, parquetEncodingPlain)
+			t.fieldI32(5, int32(len(present)))
+			t.fieldI32(6, 0)
+			t.structEnd()
+		})},
+	}
+
+	// Deleted: optional booleans, RLE-encoded, in a gzipped version 1 data page. A run of two falses
+	deleted := append(withLength(present), withLength([]byte{4, 0})...)
+	deletedColumn := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeBoolean)
+			t.fieldI32(3, parquetRepetitionOptional)
+			t.fieldString(4, "Deleted")
+		},
+		codec: parquetCodecGzip,
+		pages: [][]byte{parquetTestDataPage(3, parquetEncodingRLE, deleted, gzipped(deleted))},
+	}
+
+	// Content-MD5: optional binary without an annotation
+	md5s := append(withLength(present), []byte{2, 0, 0, 0, 0xAB, 0xCD, 1, 0, 0, 0, 0xEF}...)
+	md5 := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeByteArray)
+			t.fieldI32(3, parquetRepetitionOptional)
+			t.fieldString(4, "Content-MD5")
+		},
+		codec: parquetCodecUncompressed,
+		pages: [][]byte{parquetTestDataPage(3, parquetEncodingPlain, md5s, md5s)},
+	}
+
+	// Last-Modified: required microsecond timestamps, annotated with the TIMESTAMP logical type
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	micros := make([]byte, 24)
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint64(micros[8*i:], uint64(modified.Add(time.Duration(i)*time.Hour).UnixNano()/1000))
+	}
+	lastModified := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeInt64)
+			t.fieldI32(3, parquetRepetitionRequired)
+			t.fieldString(4, "Last-Modified")
+			t.fieldStructBegin(10)
+			t.fieldStructBegin(8)
+			t.fieldHeader(1, thriftTypeBoolTrue)
+			t.fieldStructBegin(2)
+			t.fieldStructBegin(2)
+			t.structEnd()
+			t.structEnd()
+			t.structEnd()
+			t.structEnd()
+		},
+		codec: parquetCodecUncompressed,
+		pages: [][]byte{parquetTestDataPage(3, parquetEncodingPlain, micros, micros)},
+	}
+
+	// Creation-Time: required INT96 timestamps, as written by older Spark versions. Julian day 2458851 is 2020-01-02
+	int96 := make([]byte, 36)
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint64(int96[12*i:], uint64((3*time.Hour + 4*time.Minute).Nanoseconds()))
+		binary.LittleEndian.PutUint32(int96[12*i+8:], 2458851)
+	}
+	created := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeInt96)
+			t.fieldI32(3, parquetRepetitionRequired)
+			t.fieldString(4, "Creation-Time")
+		},
+		codec: parquetCodecUncompressed,
+		pages: [][]byte{parquetTestDataPage(3, parquetEncodingPlain, int96, int96)},
+	}
+
+	file := parquetTestFile(3, []parquetTestColumn{name, length, deletedColumn, md5, lastModified, created})
+	r, err := NewParquetReader(bytes.NewReader(file), int64(len(file)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(r.Columns(), chk.DeepEquals, []string{"Name", "Content-Length", "Deleted", "Content-MD5", "Last-Modified", "Creation-Time"})
+
+	expected := [][]interface{}{
+		{"c/a.txt", int64(10), false, []byte{0xAB, 0xCD}},
+		{"c/b.txt", nil, nil, nil},
+		{"c/a.txt", int64(30), false, []byte{0xEF}},
+	}
+	for i, want := range expected {
+		row, err := r.Next()
+		c.Assert(err, chk.IsNil)
+		c.Assert(row[:4], chk.DeepEquals, want)
+		c.Assert(row[4].(time.Time).Equal(modified.Add(time.Duration(i)*time.Hour)), chk.Equals, true)
+		c.Assert(row[5].(time.Time).Equal(time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)), chk.Equals, true)
+	}
+	_, err = r.Next()
+	c.Assert(err, chk.Equals, io.EOF)
+}
+
+func (s *parquetReaderSuite) TestRejectsWhatItCannotRead(c *chk.C) {
+	_, err := NewParquetReader(bytes.NewReader([]byte("PAR1 not really")), 15)
+	c.Assert(err, chk.NotNil)
+
+	// a nested schema: the root has one child, which is a group
+	group := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldString(4, "group")
+			t.fieldI32(5, 1)
+		},
+	}
+	file := parquetTestFile(0, []parquetTestColumn{group})
+	_, err = NewParquetReader(bytes.NewReader(file), int64(len(file)))
+	c.Assert(err, chk.ErrorMatches, ".*only flat schemas.*")
+
+	// an unsupported codec (ZSTD)
+	values := plainByteArrays("a")
+	zstd := parquetTestColumn{
+		schema: func(t *thriftCompactWriter) {
+			t.fieldI32(1, parquetTypeByteArray)
+			t.fieldString(4, "Name")
+		},
+		codec: 6,
+		pages: [][]byte{parquetTestDataPage(1, parquetEncodingPlain, values, values)},
+	}
+	file = parquetTestFile(1, []parquetTestColumn{zstd})
+	r, err := NewParquetReader(bytes.NewReader(file), int64(len(file)))
+	c.Assert(err, chk.IsNil)
+	_, err = r.Next()
+	c.Assert(err, chk.ErrorMatches, ".*codec 6 is not supported.*")
+}
+
+func (s *parquetReaderSuite) TestLimitsWhatAFileCanMakeItAllocate(c *chk.C) {
+	name := func(t *thriftCompactWriter) {
+		t.fieldI32(1, parquetTypeByteArray)
+		t.fieldString(4, "Name")
+	}
+	values := plainByteArrays("a")
+	read := func(file []byte) error {
+		r, err := NewParquetReader(bytes.NewReader(file), int64(len(file)))
+		if err == nil {
+			_, err = r.Next()
+		}
+		return err
+	}
+
+	// a footer that claims more metadata than the file holds
+	file := parquetTestFile(1, []parquetTestColumn{{schema: name, pages: [][]byte{parquetTestDataPage(1, parquetEncodingPlain, values, values)}}})
+	binary.LittleEndian.PutUint32(file[len(file)-8:], 1<<31)
+	c.Assert(read(file), chk.ErrorMatches, ".*length of the parquet metadata is invalid.*")
+
+	// a row group with far more rows than could be held in memory
+	file = parquetTestFile(1<<40, []parquetTestColumn{{schema: name, pages: [][]byte{parquetTestDataPage(1, parquetEncodingPlain, values, values)}}})
+	c.Assert(read(file), chk.ErrorMatches, ".*more than can be read.*")
+
+	// a data page with more values than the row group has rows
+	file = parquetTestFile(1, []parquetTestColumn{{schema: name, pages: [][]byte{parquetTestDataPage(1<<30, parquetEncodingPlain, values, values)}}})
+	c.Assert(read(file), chk.ErrorMatches, ".*more values than are left.*")
+
+	// a dictionary page that claims more values than its data could hold
+	dictionary := parquetTestPage(parquetPageTypeDictionary, len(values), values, func(t *thriftCompactWriter) {
+		t.fieldStructBegin(7)
+		t.fieldI32(1, 1<<30)
+		t.fieldI32(2, parquetEncodingPlainDictionary)
+		t.structEnd()
+	})
+	file = parquetTestFile(1, []parquetTestColumn{{schema: name, pages: [][]byte{dictionary}}})
+	c.Assert(read(file), chk.ErrorMatches, ".*truncated values.*")
+
+	// a page that claims to be larger than any page is allowed to be
+	huge := parquetTestPage(parquetPageTypeData, parquetMaxPageSize+1, values, func(t *thriftCompactWriter) {
+		t.fieldStructBegin(5)
+		t.fieldI32(1, 1)
+		t.fieldI32(2, parquetEncodingPlain)
+		t.structEnd()
+	})
+	file = parquetTestFile(1, []parquetTestColumn{{schema: name, codec: parquetCodecSnappy, pages: [][]byte{huge}}})
+	c.Assert(read(file), chk.ErrorMatches, ".*invalid page size.*")
+
+	// gzip data that inflates to much more than the page says it holds
+	bomb := gzipped(make([]byte, 1024*1024))
+	file = parquetTestFile(1, []parquetTestColumn{{schema: name, codec: parquetCodecGzip,
+		pages: [][]byte{parquetTestDataPage(1, parquetEncodingPlain, values, bomb)}}})
+	c.Assert(read(file), chk.ErrorMatches, ".*doesn't match the size of the page.*")
+}
+
+func (s *parquetReaderSuite) TestSnappyCopiesAndBitPacking(c *chk.C) {
+	// "abcd" as a literal, then a copy of 8 bytes from 4 back, which overlaps what it produces
+	decoded, err := decodeSnappyBlock([]byte{12, 0x0C, 'a', 'b', 'c', 'd', 0x11, 4}, 12)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(decoded), chk.Equals, "abcdabcdabcd")
+	_, err = decodeSnappyBlock([]byte{12, 0x0C, 'a', 'b', 'c', 'd', 0x11, 5}, 12)
+	c.Assert(err, chk.NotNil)
+
+	// a run of five 7s (3 bits wide, so stored in a byte), then a bit-packed group of 0 to 7
+	values, err := decodeRLEBitPackedHybrid([]byte{10, 7, 3, 0x88, 0xC6, 0xFA}, 3, 13)
+	c.Assert(err, chk.IsNil)
+	c.Assert(values, chk.DeepEquals, []uint32{7, 7, 7, 7, 7, 0, 1, 2, 3, 4, 5, 6, 7})
+}
@@ -0,0 +1,137 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type parquetWriterSuite struct{}
+
+var _ = chk.Suite(&parquetWriterSuite{})
+
+func (s *parquetWriterSuite) TestParquetWriterFileLayout(c *chk.C) {
+	var b bytes.Buffer
+	w, err := NewParquetWriter(&b, []ParquetColumn{
+		{Name: "Name", Type: EParquetColumnType.String()},
+		{Name: "Size", Type: EParquetColumnType.Int64()},
+		{Name: "Modified", Type: EParquetColumnType.Timestamp()},
+	})
+	c.Assert(err, chk.IsNil)
+	w.rowGroupSize = 4
+
+	for i := 0; i < 10; i++ {
+		c.Assert(w.WriteRow(fmt.Sprintf("file%d", i), int64(i), time.Unix(int64(i), 0)), chk.IsNil)
+	}
+	c.Assert(w.WriteRow("too few values"), chk.NotNil)
+	c.Assert(w.WriteRow(int64(1), "wrong types", time.Now()), chk.NotNil)
+	c.Assert(w.Close(), chk.IsNil)
+
+	// 10 rows in groups of at most 4
+	c.Assert(w.rowGroups, chk.HasLen, 3)
+	c.Assert(w.totalRows, chk.Equals, int64(10))
+
+	// the file starts and ends with the magic number, and the footer length points back to the start of the metadata
+	data := b.Bytes()
+	c.Assert(string(data[:4]), chk.Equals, parquetMagic)
+	c.Assert(string(data[len(data)-4:]), chk.Equals, parquetMagic)
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	for _, name := range []string{"schema", "Name", "Size", "Modified"} {
+		c.Assert(bytes.Contains(footer, []byte(name)), chk.Equals, true)
+	}
+
+	// the first column chunk begins straight after the magic number, and chunks are contiguous
+	offset := int64(len(parquetMagic))
+	for _, group := range w.rowGroups {
+		for _, chunk := range group.chunks {
+			c.Assert(chunk.dataPageOffset, chk.Equals, offset)
+			offset += chunk.size
+		}
+	}
+	c.Assert(offset, chk.Equals, int64(len(data)-8-footerLen))
+}
+
+func (s *parquetWriterSuite) TestThriftCompactEncoding(c *chk.C) {
+	t := thriftCompactWriter{}
+	t.structBegin()
+	t.fieldI32(1, 1)      // short form header: delta 1, type i32, then zigzag(1) = 2
+	t.fieldI64(3, -1)     // delta 2, type i64, zigzag(-1) = 1
+	t.fieldString(20, "") // delta 17 doesn't fit, so long form: type byte then zigzag(20) = 40
+	t.fieldListBegin(21, thriftTypeI32, 2)
+	t.writeZigzagVarint(0)
+	t.writeZigzagVarint(3)
+	t.structEnd()
+
+	c.Assert(t.buf.Bytes(), chk.DeepEquals, []byte{0x15, 0x02, 0x26, 0x01, 0x08, 40, 0x00, 0x19, 0x25, 0x00, 0x06, 0x00})
+}
+
+func (s *parquetWriterSuite) TestCorruptOutputIsRejectedWhenReadBack(c *chk.C) {
+	// files written by the list command can be given back to copy as an inventory report, so a damaged one must be read safely
+	var b bytes.Buffer
+	w, err := NewParquetWriter(&b, []ParquetColumn{
+		{Name: "Name", Type: EParquetColumnType.String()},
+		{Name: "Content-Length", Type: EParquetColumnType.Int64()},
+		{Name: "Last-Modified", Type: EParquetColumnType.Timestamp()},
+	})
+	c.Assert(err, chk.IsNil)
+	w.rowGroupSize = 4
+	for i := 0; i < 10; i++ {
+		c.Assert(w.WriteRow(fmt.Sprintf("dir/file%d", i), int64(i*1000), time.Unix(int64(i), 0)), chk.IsNil)
+	}
+	c.Assert(w.Close(), chk.IsNil)
+	original := b.Bytes()
+
+	readAll := func(file []byte) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panicked: %v", r)
+			}
+		}()
+		r, err := NewParquetReader(bytes.NewReader(file), int64(len(file)))
+		if err != nil {
+			return nil
+		}
+		for err == nil {
+			_, err = r.Next()
+		}
+		return nil
+	}
+
+	// every byte in turn is replaced with values that make lengths and counts large, negative or zero
+	for i := range original {
+		for _, v := range []byte{0x00, 0x7F, 0xFF} {
+			file := append([]byte(nil), original...)
+			file[i] = v
+			c.Assert(readAll(file), chk.IsNil, chk.Commentf("byte %d set to %#x", i, v))
+		}
+	}
+
+	// and the file is cut short at every length
+	for n := range original {
+		c.Assert(readAll(original[:n]), chk.IsNil, chk.Commentf("cut to %d bytes", n))
+	}
+}
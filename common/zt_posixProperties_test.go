@@ -0,0 +1,70 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	chk "gopkg.in/check.v1"
+)
+
+type posixPropertiesSuite struct{}
+
+var _ = chk.Suite(&posixPropertiesSuite{})
+
+func (s *posixPropertiesSuite) TestFormatAndParse(c *chk.C) {
+	p := NewPosixProperties(1000, 100, 0104755) // a regular file, with the setuid bit
+	c.Assert(p, chk.Equals, PosixProperties{Owner: "1000", Group: "100", Mode: "4755"})
+
+	uid, gid, mode, err := p.Parse()
+	c.Assert(err, chk.IsNil)
+	c.Assert([]uint32{uid, gid, mode}, chk.DeepEquals, []uint32{1000, 100, 04755})
+
+	c.Assert(NewPosixProperties(0, 0, 0644).Mode, chk.Equals, "0644")
+
+	for _, bad := range []PosixProperties{{"x", "0", "0644"}, {"0", "-1", "0644"}, {"0", "0", "0999"}, {"0", "0", "17777"}} {
+		_, _, _, err = bad.Parse()
+		c.Assert(err, chk.NotNil)
+	}
+}
+
+func (s *posixPropertiesSuite) TestGetAndSetLocalFile(c *chk.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("local files have no owner, group and mode on Windows")
+	}
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(path, []byte("x"), 0600), chk.IsNil)
+
+	p, err := GetPosixProperties(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(p.Mode, chk.Equals, "0600")
+	c.Assert(p.Owner, chk.Equals, NewPosixProperties(uint32(os.Getuid()), 0, 0).Owner)
+
+	// the owner and group can be set to themselves without being root
+	p.Mode = "0640"
+	c.Assert(SetPosixProperties(path, p), chk.IsNil)
+	got, err := GetPosixProperties(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(got, chk.Equals, p)
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	chk "gopkg.in/check.v1"
+)
+
+type propertyMappingSuite struct{}
+
+var _ = chk.Suite(&propertyMappingSuite{})
+
+func (s *propertyMappingSuite) TestParse(c *chk.C) {
+	mapping, err := ParsePropertyMapping(" SMB:Last-Write-Time = metadata:OrigMTime ; metadata:mime=Content-Type;")
+	c.Assert(err, chk.IsNil)
+	c.Assert(mapping, chk.DeepEquals, PropertyMapping{
+		{Source: PropertySMBLastWriteTime, Destination: "metadata:OrigMTime"},
+		{Source: "metadata:mime", Destination: "content-type"},
+	})
+	c.Assert(mapping.UsesSMBProperties(), chk.Equals, true)
+
+	// the stored form parses back to the same rules
+	again, err := ParsePropertyMapping(mapping.String())
+	c.Assert(err, chk.IsNil)
+	c.Assert(again, chk.DeepEquals, mapping)
+
+	for _, bad := range []string{"content-type", "content-type=x-custom", "etag=metadata:e", "content-type=smb:attributes", "metadata:=content-type", "a=b=c"} {
+		_, err = ParsePropertyMapping(bad)
+		c.Assert(err, chk.NotNil, chk.Commentf(bad))
+	}
+}
+
+func (s *propertyMappingSuite) TestApply(c *chk.C) {
+	mapping, err := ParsePropertyMapping("smb:creation-time=metadata:ctime;metadata:Mime=content-type;content-type=metadata:originaltype;cache-control=content-language;smb:attributes=metadata:attrs")
+	c.Assert(err, chk.IsNil)
+
+	headers := ResourceHTTPHeaders{ContentType: "application/octet-stream"}
+	metadata := Metadata{"mime": "text/plain", "ctime": "stale"}
+	smb := map[string]string{PropertySMBCreationTime: "2020-01-02T03:04:05.0000000Z"}
+
+	mapped := mapping.Apply(&headers, metadata, smb)
+
+	// every rule reads the properties as they were, before any rule changed them
+	c.Assert(headers.ContentType, chk.Equals, "text/plain")
+	c.Assert(mapped, chk.DeepEquals, Metadata{
+		"mime":         "text/plain",
+		"ctime":        "2020-01-02T03:04:05.0000000Z",
+		"originaltype": "application/octet-stream",
+	})
+	// rules whose source has no value change nothing
+	c.Assert(headers.ContentLanguage, chk.Equals, "")
+	// the given metadata is left as it was
+	c.Assert(metadata["ctime"], chk.Equals, "stale")
+}
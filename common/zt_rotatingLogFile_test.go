@@ -0,0 +1,228 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type rotatingLogFileSuite struct{}
+
+var _ = chk.Suite(&rotatingLogFileSuite{})
+
+func (s *rotatingLogFileSuite) logFiles(c *chk.C, dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	c.Assert(err, chk.IsNil)
+	names := make([]string, 0)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *rotatingLogFileSuite) TestRotatesBySizeAndKeepsMaxFiles(c *chk.C) {
+	dir, err := ioutil.TempDir("", "rotatingLogFileSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	f, err := openRotatingLogFile(dir, "job", LogRotationOptions{MaxFileSize: 25, MaxFiles: 2})
+	c.Assert(err, chk.IsNil)
+	for _, line := range []string{"line one\n", "line two\n", "line three\n", "line four\n", "line five\n", "line six\n", "line seven\n"} {
+		_, err = f.Write([]byte(line))
+		c.Assert(err, chk.IsNil)
+	}
+	c.Assert(f.Close(), chk.IsNil)
+
+	// two lines fit in each file, and only the two newest rotated files are kept
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.2.log", "job.3.log", "job.log"})
+	current, err := ioutil.ReadFile(filepath.Join(dir, "job.log"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(current), chk.Equals, "line seven\n")
+	newest, err := ioutil.ReadFile(filepath.Join(dir, "job.3.log"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(newest), chk.Equals, "line five\nline six\n")
+
+	// on resume, numbering carries on from the files that are there
+	f, err = openRotatingLogFile(dir, "job", LogRotationOptions{MaxFileSize: 25, MaxFiles: 2})
+	c.Assert(err, chk.IsNil)
+	_, err = f.Write([]byte("line eight after resume\n"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil)
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.3.log", "job.4.log", "job.log"})
+}
+
+func (s *rotatingLogFileSuite) TestRotatesByTime(c *chk.C) {
+	dir, err := ioutil.TempDir("", "rotatingLogFileSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	f, err := openRotatingLogFile(dir, "job", LogRotationOptions{RotateInterval: time.Hour})
+	c.Assert(err, chk.IsNil)
+	_, err = f.Write([]byte("first\n"))
+	c.Assert(err, chk.IsNil)
+	_, err = f.Write([]byte("still first\n"))
+	c.Assert(err, chk.IsNil)
+	f.openedAt = time.Now().Add(-2 * time.Hour)
+	_, err = f.Write([]byte("second\n"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil)
+
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.1.log", "job.log"})
+}
+
+func (s *rotatingLogFileSuite) TestNoRotationByDefault(c *chk.C) {
+	dir, err := ioutil.TempDir("", "rotatingLogFileSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	f, err := openRotatingLogFile(dir, "job", LogRotationOptions{})
+	c.Assert(err, chk.IsNil)
+	_, err = f.Write([]byte(strings.Repeat("x", 100000)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil)
+
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.log"})
+}
+
+func (s *rotatingLogFileSuite) TestOptionsFromEnvironment(c *chk.C) {
+	os.Setenv(EEnvironmentVariable.LogMaxSizeMB().Name, "100")
+	defer os.Unsetenv(EEnvironmentVariable.LogMaxSizeMB().Name)
+	os.Setenv(EEnvironmentVariable.LogMaxFiles().Name, "5")
+	defer os.Unsetenv(EEnvironmentVariable.LogMaxFiles().Name)
+	os.Setenv(EEnvironmentVariable.LogRotateInterval().Name, "24h")
+	defer os.Unsetenv(EEnvironmentVariable.LogRotateInterval().Name)
+
+	options, err := LogRotationOptionsFromEnvironment()
+	c.Assert(err, chk.IsNil)
+	c.Assert(options, chk.DeepEquals, LogRotationOptions{MaxFileSize: 100 * 1024 * 1024, MaxFiles: 5, RotateInterval: 24 * time.Hour})
+
+	os.Setenv(EEnvironmentVariable.LogMaxFiles().Name, "-1")
+	_, err = LogRotationOptionsFromEnvironment()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *rotatingLogFileSuite) readGzip(c *chk.C, path string) string {
+	file, err := os.Open(path)
+	c.Assert(err, chk.IsNil)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	c.Assert(err, chk.IsNil)
+	b, err := ioutil.ReadAll(gz)
+	c.Assert(err, chk.IsNil)
+	return string(b)
+}
+
+func (s *rotatingLogFileSuite) TestCompressesOnClose(c *chk.C) {
+	dir, err := ioutil.TempDir("", "rotatingLogFileSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	options := LogRotationOptions{MaxFileSize: 25, Compress: true}
+	f, err := openRotatingLogFile(dir, "job", options)
+	c.Assert(err, chk.IsNil)
+	for _, line := range []string{"line one\n", "line two\n", "line three\n"} {
+		_, err = f.Write([]byte(line))
+		c.Assert(err, chk.IsNil)
+	}
+	// a rotated file is compressed straight away, since the log may never be closed before the process exits
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.1.log.gz", "job.log"})
+	c.Assert(f.Close(), chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil) // closing it again does nothing
+	_, err = f.Write([]byte("too late\n"))
+	c.Assert(err, chk.NotNil)
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.1.log.gz", "job.log.gz"})
+	c.Assert(s.readGzip(c, filepath.Join(dir, "job.1.log.gz")), chk.Equals, "line one\nline two\n")
+
+	// a resumed job adds to the compressed log, rather than replacing it
+	f, err = openRotatingLogFile(dir, "job", options)
+	c.Assert(err, chk.IsNil)
+	_, err = f.Write([]byte("line four\n"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil)
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{"job.1.log.gz", "job.log.gz"})
+	c.Assert(s.readGzip(c, filepath.Join(dir, "job.log.gz")), chk.Equals, "line three\nline four\n")
+
+	c.Assert(IsLogFileName("job.1.log.gz"), chk.Equals, true)
+	c.Assert(IsLogFileName("job.log"), chk.Equals, true)
+	c.Assert(IsLogFileName("job.steV25"), chk.Equals, false)
+}
+
+func (s *rotatingLogFileSuite) TestCompressOptionFromEnvironment(c *chk.C) {
+	os.Setenv(EEnvironmentVariable.LogCompress().Name, "true")
+	defer os.Unsetenv(EEnvironmentVariable.LogCompress().Name)
+
+	options, err := LogRotationOptionsFromEnvironment()
+	c.Assert(err, chk.IsNil)
+	c.Assert(options, chk.DeepEquals, LogRotationOptions{Compress: true})
+
+	os.Setenv(EEnvironmentVariable.LogCompress().Name, "sometimes")
+	_, err = LogRotationOptionsFromEnvironment()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *rotatingLogFileSuite) TestJobLogFilesAreInOrder(c *chk.C) {
+	dir, err := ioutil.TempDir("", "rotatingLogFileSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	jobID := NewJobID()
+	for _, name := range []string{".log", ".10.log", ".2.log.gz", ".2.log", "-chunks.log", ".journal"} {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, jobID.String()+name), nil, 0644), chk.IsNil)
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, NewJobID().String()+".log"), nil, 0644), chk.IsNil)
+
+	files, err := JobLogFiles(dir, jobID)
+	c.Assert(err, chk.IsNil)
+	for i := range files {
+		files[i] = strings.TrimPrefix(filepath.Base(files[i]), jobID.String())
+	}
+	c.Assert(files, chk.DeepEquals, []string{".2.log.gz", ".2.log", ".10.log", ".log"})
+}
+
+func (s *rotatingLogFileSuite) TestJobLogIsClosedAtExit(c *chk.C) {
+	dir, err := ioutil.TempDir("", "rotatingLogFileSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	SetJobLogRotation(LogRotationOptions{Compress: true})
+	defer SetJobLogRotation(LogRotationOptions{})
+	jobID := NewJobID()
+	logger := NewJobLogger(jobID, ELogLevel.Info(), NewAppLogger(pipeline.LogInfo, dir), dir)
+	logger.OpenLog()
+	logger.Log(pipeline.LogInfo, "the job is done")
+
+	runExitHooks()
+	c.Assert(s.logFiles(c, dir), chk.DeepEquals, []string{jobID.String() + ".log.gz"})
+	c.Assert(strings.Contains(s.readGzip(c, filepath.Join(dir, jobID.String()+".log.gz")), "the job is done"), chk.Equals, true)
+
+	// the job's own CloseLog, if it's ever called, finds the log closed
+	logger.CloseLog()
+}
@@ -0,0 +1,81 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"os"
+
+	chk "gopkg.in/check.v1"
+)
+
+type s3CredentialSuite struct {
+	savedEnv map[string]*string
+}
+
+var _ = chk.Suite(&s3CredentialSuite{})
+
+var s3CredentialEnvNames = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"}
+
+func (s *s3CredentialSuite) SetUpTest(c *chk.C) {
+	s.savedEnv = make(map[string]*string)
+	for _, name := range s3CredentialEnvNames {
+		if value, ok := os.LookupEnv(name); ok {
+			s.savedEnv[name] = &value
+		} else {
+			s.savedEnv[name] = nil
+		}
+		_ = os.Unsetenv(name)
+	}
+}
+
+func (s *s3CredentialSuite) TearDownTest(c *chk.C) {
+	for name, value := range s.savedEnv {
+		if value == nil {
+			_ = os.Unsetenv(name)
+		} else {
+			_ = os.Setenv(name, *value)
+		}
+	}
+}
+
+func (s *s3CredentialSuite) TestAccessKeyWithSessionToken(c *chk.C) {
+	_ = os.Setenv("AWS_ACCESS_KEY_ID", "keyid")
+	_ = os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	_ = os.Setenv("AWS_SESSION_TOKEN", "token")
+
+	credential, err := CreateS3Credential(context.Background(), CredentialInfo{CredentialType: ECredentialType.S3AccessKey()}, CredentialOpOptions{})
+	c.Assert(err, chk.IsNil)
+	value, err := credential.Get()
+	c.Assert(err, chk.IsNil)
+	c.Assert(value.AccessKeyID, chk.Equals, "keyid")
+	c.Assert(value.SecretAccessKey, chk.Equals, "secret")
+	c.Assert(value.SessionToken, chk.Equals, "token")
+}
+
+func (s *s3CredentialSuite) TestAccessKeyWithoutSecretIsRejected(c *chk.C) {
+	// a half-set access key is a mistake, so we mustn't quietly fall back to the instance profile
+	_ = os.Setenv("AWS_ACCESS_KEY_ID", "keyid")
+
+	_, err := CreateS3Credential(context.Background(), CredentialInfo{CredentialType: ECredentialType.S3AccessKey()}, CredentialOpOptions{})
+	c.Assert(err, chk.NotNil)
+	c.Assert(err.Error(), chk.Matches, ".*must both be set.*")
+}
@@ -0,0 +1,118 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type s3InstanceCredentialsSuite struct{}
+
+var _ = chk.Suite(&s3InstanceCredentialsSuite{})
+
+const fakeS3InstanceCredentials = `{"Code":"Success","AccessKeyId":"AKID","SecretAccessKey":"secret","Token":"session","Expiration":"%s"}`
+
+// fakeInstanceMetadata serves the credentials of an instance profile, asking for a session token unless it allows IMDSv1
+func fakeInstanceMetadata(allowV1 bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ec2InstanceMetadataTokenPath {
+			if r.Method != http.MethodPut || r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if allowV1 {
+				w.WriteHeader(http.StatusNotFound) // an older service, that doesn't know about tokens
+				return
+			}
+			fmt.Fprint(w, "the-token")
+			return
+		}
+		if !allowV1 && r.Header.Get("X-Aws-Ec2-Metadata-Token") != "the-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case ec2InstanceMetadataCredsPath:
+			fmt.Fprint(w, "my-role\n")
+		case ec2InstanceMetadataCredsPath + "my-role":
+			fmt.Fprintf(w, fakeS3InstanceCredentials, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func (s *s3InstanceCredentialsSuite) TestInstanceProfileWithIMDSv2AndV1(c *chk.C) {
+	for _, allowV1 := range []bool{false, true} {
+		server := httptest.NewServer(fakeInstanceMetadata(allowV1))
+		p := &s3InstanceCredentialsProvider{client: server.Client(), instanceMetadata: server.URL}
+
+		value, err := p.Retrieve()
+		c.Assert(err, chk.IsNil, chk.Commentf("IMDSv1 allowed: %v", allowV1))
+		c.Assert(value.AccessKeyID, chk.Equals, "AKID")
+		c.Assert(value.SecretAccessKey, chk.Equals, "secret")
+		c.Assert(value.SessionToken, chk.Equals, "session")
+		c.Assert(p.IsExpired(), chk.Equals, false)
+		server.Close()
+	}
+
+	// not being in EC2 at all is an error, rather than empty credentials
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	p := &s3InstanceCredentialsProvider{client: server.Client(), instanceMetadata: server.URL}
+	_, err := p.Retrieve()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *s3InstanceCredentialsSuite) TestECSTaskRole(c *chk.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/credentials/task-id":
+		case r.URL.Path == "/full" && r.Header.Get("Authorization") == "auth-token":
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"AccessKeyId":"AKID","SecretAccessKey":"secret","Token":"session","Expiration":"%s"}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	// the relative URI goes with the address of the container agent, and takes precedence over the instance profile
+	p := &s3InstanceCredentialsProvider{client: server.Client(), ecsEndpoint: server.URL, ecsRelativeURI: "/v2/credentials/task-id", instanceMetadata: "http://invalid.invalid"}
+	value, err := p.Retrieve()
+	c.Assert(err, chk.IsNil)
+	c.Assert(value.AccessKeyID, chk.Equals, "AKID")
+	c.Assert(value.SessionToken, chk.Equals, "session")
+
+	// a full URI may need an authorization token
+	p = &s3InstanceCredentialsProvider{client: server.Client(), ecsFullURI: server.URL + "/full", ecsAuthToken: "auth-token"}
+	value, err = p.Retrieve()
+	c.Assert(err, chk.IsNil)
+	c.Assert(value.SecretAccessKey, chk.Equals, "secret")
+
+	p.ecsAuthToken = ""
+	_, err = p.Retrieve()
+	c.Assert(err, chk.ErrorMatches, ".*ECS task.*403.*")
+}
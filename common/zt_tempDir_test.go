@@ -0,0 +1,84 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	chk "gopkg.in/check.v1"
+)
+
+type tempDirSuite struct{}
+
+var _ = chk.Suite(&tempDirSuite{})
+
+func (s *tempDirSuite) TestStagingInConfiguredTempDir(c *chk.C) {
+	root, err := ioutil.TempDir("", "tempDirSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(root)
+	os.Setenv(EEnvironmentVariable.TempDir().Name, root)
+	defer os.Unsetenv(EEnvironmentVariable.TempDir().Name)
+	defer CleanupTempDir()
+
+	c.Assert(ValidateTempDir(), chk.IsNil)
+	c.Assert(TempDirRoot(), chk.Equals, root)
+
+	f, err := CreateTempFile("staged", 1024)
+	c.Assert(err, chk.IsNil)
+	f.Close()
+
+	// the file is in a folder of this process, inside the configured location
+	processDir := filepath.Dir(f.Name())
+	c.Assert(filepath.Dir(processDir), chk.Equals, root)
+	c.Assert(strings.HasPrefix(filepath.Base(processDir), "azcopy-"), chk.Equals, true)
+
+	// staging more than the volume can hold fails up front
+	_, err = CreateTempFile("staged", math.MaxInt64/2)
+	c.Assert(err, chk.ErrorMatches, ".*not enough free space.*")
+
+	// everything is removed on exit
+	CleanupTempDir()
+	_, err = os.Stat(processDir)
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+}
+
+func (s *tempDirSuite) TestValidateTempDir(c *chk.C) {
+	root, err := ioutil.TempDir("", "tempDirSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(root)
+	defer os.Unsetenv(EEnvironmentVariable.TempDir().Name)
+
+	os.Setenv(EEnvironmentVariable.TempDir().Name, filepath.Join(root, "missing"))
+	c.Assert(ValidateTempDir(), chk.NotNil)
+
+	file := filepath.Join(root, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("x"), 0644), chk.IsNil)
+	os.Setenv(EEnvironmentVariable.TempDir().Name, file)
+	c.Assert(ValidateTempDir(), chk.ErrorMatches, ".*not a directory.*")
+
+	os.Unsetenv(EEnvironmentVariable.TempDir().Name)
+	c.Assert(ValidateTempDir(), chk.IsNil)
+	c.Assert(TempDirRoot(), chk.Equals, os.TempDir())
+}
@@ -48,6 +48,13 @@ func main() {
 
 	// the user can optionally put the log files somewhere else
 	azcopyLogPathFolder := common.GetLifecycleMgr().GetEnvironmentVariable(common.EEnvironmentVariable.LogLocation())
+	if common.IsRemoteLogLocation(azcopyLogPathFolder) {
+		// job logs are streamed to the container, and a local copy is kept where it would be by default
+		if err := common.SetJobLogRemoteLocation(azcopyLogPathFolder); err != nil {
+			log.Fatalf("invalid AZCOPY_LOG_LOCATION: %v", err)
+		}
+		azcopyLogPathFolder = ""
+	}
 	if azcopyLogPathFolder == "" {
 		azcopyLogPathFolder = azcopyAppPathFolder
 	}
@@ -70,10 +70,19 @@ func ProcessOSSpecificInitialization() (int, error) {
 
 // GetAzCopyAppPath returns the path of Azcopy folder in local appdata.
 // Azcopy folder in local appdata contains all the files created by azcopy locally.
+// Minimal containers often have no HOME, or one that isn't writable (e.g. when running as an arbitrary user ID),
+// so in that case the folder is put in the temp directory instead.
 func GetAzCopyAppPath() string {
 	lcm := common.GetLifecycleMgr()
 	localAppData := lcm.GetEnvironmentVariable(common.EEnvironmentVariable.UserDir())
-	azcopyAppDataFolder := path.Join(localAppData, ".azcopy")
+	if localAppData != "" {
+		azcopyAppDataFolder := path.Join(localAppData, ".azcopy")
+		if err := os.Mkdir(azcopyAppDataFolder, os.ModeDir|os.ModePerm); err == nil || os.IsExist(err) {
+			return azcopyAppDataFolder
+		}
+	}
+
+	azcopyAppDataFolder := path.Join(os.TempDir(), ".azcopy")
 	if err := os.Mkdir(azcopyAppDataFolder, os.ModeDir|os.ModePerm); err != nil && !os.IsExist(err) {
 		return ""
 	}
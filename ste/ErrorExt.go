@@ -2,6 +2,9 @@ package ste
 
 import (
 	"net/http"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
 
 	"github.com/Azure/azure-storage-azcopy/azbfs"
 	"github.com/Azure/azure-storage-blob-go/azblob"
@@ -41,3 +44,12 @@ func (errex ErrorEx) MSRequestID() string {
 	}
 	return ""
 }
+
+// ClockSkewHint explains the failure by the local clock being wrong, if the response to the failed request
+// shows that it is far from the clock of the service. Returns "" if it isn't, or there's no response
+func (errex ErrorEx) ClockSkewHint() string {
+	if respErr, ok := errex.error.(hasResponse); ok {
+		return common.ClockSkewHint(respErr.Response(), time.Now())
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package ste
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 	"unsafe"
@@ -14,12 +15,20 @@ import (
 // dataSchemaVersion defines the data schema version of JobPart order files supported by
 // current version of azcopy
 // To be Incremented every time when we release azcopy with changed dataSchema
-const DataSchemaVersion common.Version = 10
+// (and see JobPartPlanMigration.go for how the schema may change, and how to migrate older plan files)
+const DataSchemaVersion common.Version = 11
 
 const (
-	CustomHeaderMaxBytes = 256
-	MetadataMaxBytes     = 1000 // If > 65536, then jobPartPlanBlobData's MetadataLength field's type must change
-	BlobTierMaxBytes     = 10
+	CustomHeaderMaxBytes    = 256
+	MetadataMaxBytes        = 1000 // If > 65536, then jobPartPlanBlobData's MetadataLength field's type must change
+	BlobTierMaxBytes        = 10
+	JobLabelsMaxBytes       = 1000
+	JobDescriptionMaxBytes  = 1000
+	ManifestPathMaxBytes    = 1000
+	PropertyMappingMaxBytes = 1000
+	SuccessMarkerMaxBytes   = 1000
+	ConcurrencyMaxBytes     = 4000
+	ContentPolicyMaxBytes   = 2000
 )
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -66,6 +75,89 @@ type JobPartPlanHeader struct {
 	DestLengthValidation bool
 	// S2SInvalidMetadataHandleOption represents how user wants to handle invalid metadata.
 	S2SInvalidMetadataHandleOption common.InvalidMetadataHandleOption
+	// AllowSecondaryRead represents whether downloads may fail over to the secondary endpoint of an RA-GRS account
+	AllowSecondaryRead bool
+	// PausedForAccountFailover is set (in part 0) when the job was paused because the account was failing over,
+	// so that resuming the job checks the remaining sources for changes
+	PausedForAccountFailover bool
+	// SourceChangePolicy represents what to do with a transfer whose source changed after it was scheduled
+	SourceChangePolicy common.SourceChangePolicy
+	// MaxWriteLatencyMilliseconds, when non-zero, is the p99 write latency above which writes to a destination are held back
+	MaxWriteLatencyMilliseconds uint32
+	// FileTimeBudgetSecondsPerGB, when non-zero, is how long a transfer may run per GB of its size before it is failed and requeued
+	FileTimeBudgetSecondsPerGB uint32
+	// DeleteSourceAfter represents whether the source of each transfer is deleted once the transfer has been verified
+	DeleteSourceAfter common.DeleteSourceAfter
+	// AssertSourceUnchanged represents whether a transfer (or the job) fails if the ETag of the source changed after the scan
+	AssertSourceUnchanged common.AssertSourceUnchanged
+	// MaxAccountThroughputFraction, when non-zero, is the fraction of the throughput limit of the account that the job may use
+	MaxAccountThroughputFraction float32
+	// PropertiesOnly represents whether only the properties of existing destination blobs are updated, without copying any data
+	PropertiesOnly bool
+	// JournalTransitions represents whether each state transition of each transfer is recorded in the journal of the job
+	JournalTransitions bool
+
+	// JobLabels holds the labels given by the user (as JSON), and JobDescription the description of the job
+	JobLabelsLength      uint16
+	JobLabels            [JobLabelsMaxBytes]byte
+	JobDescriptionLength uint16
+	JobDescription       [JobDescriptionMaxBytes]byte
+
+	// ManifestPath, when set, is where a manifest of the transferred files is written when the job completes,
+	// and ManifestSigningKey the key file or Key Vault key that the manifest is signed with, if any
+	ManifestPathLength       uint16
+	ManifestPath             [ManifestPathMaxBytes]byte
+	ManifestSigningKeyLength uint16
+	ManifestSigningKey       [ManifestPathMaxBytes]byte
+
+	// PropertyMappingRules holds the rules that copy properties of the source to other properties of the destination
+	PropertyMappingRulesLength uint16
+	PropertyMappingRules       [PropertyMappingMaxBytes]byte
+
+	// SuccessMarker, when set, is where an empty marker (e.g. /year=2020/_SUCCESS) is created, relative to the destination root,
+	// when the job completes without any failed transfers, for analytics jobs that wait for it before reading the output
+	SuccessMarkerLength uint16
+	SuccessMarker       [SuccessMarkerMaxBytes]byte
+
+	// AfterJobID is the job that this job waited for before it started, if any
+	AfterJobID common.JobID
+
+	// FolderCreation represents whether the directories of the destination are created before the transfers start, or as they are needed
+	FolderCreation common.FolderCreationPolicy
+
+	// WriteOnce represents whether every write to a destination blob is conditional on the blob not existing yet (If-None-Match: *)
+	WriteOnce bool
+
+	// Concurrency holds the concurrency settings (as JSON) of the run of AzCopy that created the job part,
+	// or, in part 0, of the run that last resumed the job
+	ConcurrencyLength uint16
+	Concurrency       [ConcurrencyMaxBytes]byte
+
+	// ContentPolicyRules holds the content policy (as JSON), whose rules each file must follow to be transferred as usual
+	ContentPolicyRulesLength uint16
+	ContentPolicyRules       [ContentPolicyMaxBytes]byte
+
+	// PreservePermissions represents whether the owner, group, permissions and ACL of each file, and of the directories it's in,
+	// are copied to the destination, for copies between accounts with hierarchical namespaces
+	PreservePermissions bool
+
+	// PreservePosixProperties represents whether the owner, group and mode of each file are kept,
+	// for transfers to and from Azure Files NFS shares
+	PreservePosixProperties bool
+
+	// DailyCapBytes, when non-zero, is how many bytes may be sent and received on this machine in a calendar day,
+	// after which no new chunks are scheduled until the next day
+	DailyCapBytes uint64
+
+	// SourceSASFromLogin represents whether the source is read with a user delegation SAS that was minted from the login,
+	// rather than one the user gave. SASes aren't kept in the plan, so a fresh one is minted when the job is resumed
+	SourceSASFromLogin bool
+
+	// atomicJobTotalBytes and atomicJobBytesTransferred are only used in part 0, where they are the size of all the transfers
+	// of the job, and of those that have succeeded, so that listing the jobs doesn't have to read every transfer.
+	// Unlike the fields around them they change as the job runs, so they're only accessed atomically
+	atomicJobTotalBytes       uint64
+	atomicJobBytesTransferred uint64
 
 	// Any fields below this comment are NOT constants; they may change over as the job part is processed.
 	// Care must be taken to read/write to these fields in a thread-safe way!
@@ -89,6 +181,24 @@ func (jpph *JobPartPlanHeader) SetJobStatus(newJobStatus common.JobStatus) {
 	jpph.atomicJobStatus.AtomicStore(newJobStatus)
 }
 
+// JobTotalBytes returns the size of all the transfers of the job, as kept in part 0
+func (jpph *JobPartPlanHeader) JobTotalBytes() uint64 {
+	return atomic.LoadUint64(&jpph.atomicJobTotalBytes)
+}
+
+// JobBytesTransferred returns the size of the transfers of the job that have succeeded, as kept in part 0
+func (jpph *JobPartPlanHeader) JobBytesTransferred() uint64 {
+	return atomic.LoadUint64(&jpph.atomicJobBytesTransferred)
+}
+
+func (jpph *JobPartPlanHeader) addJobTotalBytes(bytes uint64) {
+	atomic.AddUint64(&jpph.atomicJobTotalBytes, bytes)
+}
+
+func (jpph *JobPartPlanHeader) addJobBytesTransferred(bytes uint64) {
+	atomic.AddUint64(&jpph.atomicJobBytesTransferred, bytes)
+}
+
 // Transfer api gives memory map JobPartPlanTransfer header for given index
 func (jpph *JobPartPlanHeader) Transfer(transferIndex uint32) *JobPartPlanTransfer {
 	// get memory map JobPartPlan Header Pointer
@@ -111,6 +221,74 @@ func (jpph *JobPartPlanHeader) CommandString() string {
 	return string(commandSlice)
 }
 
+// Labels returns the labels given by user when job was created
+func (jpph *JobPartPlanHeader) Labels() map[string]string {
+	labels := map[string]string{}
+	if jpph.JobLabelsLength > 0 {
+		// the labels were validated when the job was created, so they can always be unmarshalled
+		_ = json.Unmarshal(jpph.JobLabels[:jpph.JobLabelsLength], &labels)
+	}
+	return labels
+}
+
+// EffectiveConcurrency returns the concurrency settings that were recorded in the plan, if any
+func (jpph *JobPartPlanHeader) EffectiveConcurrency() []common.ConcurrencySetting {
+	settings := make([]common.ConcurrencySetting, 0)
+	if jpph.ConcurrencyLength > 0 {
+		// the settings were marshalled by setEffectiveConcurrency, so they can always be unmarshalled
+		_ = json.Unmarshal(jpph.Concurrency[:jpph.ConcurrencyLength], &settings)
+	}
+	return settings
+}
+
+// setEffectiveConcurrency records the concurrency settings in the plan. If they don't fit, they are recorded without their sources
+func (jpph *JobPartPlanHeader) setEffectiveConcurrency(settings []common.ConcurrencySetting) {
+	raw, _ := json.Marshal(settings)
+	if len(raw) > ConcurrencyMaxBytes {
+		withoutSources := make([]common.ConcurrencySetting, len(settings))
+		for i, s := range settings {
+			withoutSources[i] = common.ConcurrencySetting{Name: s.Name, Value: s.Value}
+		}
+		raw, _ = json.Marshal(withoutSources)
+		if len(raw) > ConcurrencyMaxBytes {
+			raw = nil
+		}
+	}
+	jpph.ConcurrencyLength = uint16(copy(jpph.Concurrency[:], raw))
+}
+
+// ContentPolicy returns the rules that each file must follow to be transferred as usual
+func (jpph *JobPartPlanHeader) ContentPolicy() common.ContentPolicy {
+	policy := common.ContentPolicy{}
+	if jpph.ContentPolicyRulesLength > 0 {
+		// the policy was marshalled when the job was created, so it can always be unmarshalled
+		_ = json.Unmarshal(jpph.ContentPolicyRules[:jpph.ContentPolicyRulesLength], &policy)
+	}
+	return policy
+}
+
+// Description returns the description given by user when job was created
+func (jpph *JobPartPlanHeader) Description() string {
+	return string(jpph.JobDescription[:jpph.JobDescriptionLength])
+}
+
+// PropertyMapping returns the rules that copy properties of the source to other properties of the destination
+func (jpph *JobPartPlanHeader) PropertyMapping() common.PropertyMapping {
+	// the rules were validated when the job was created, so they can always be parsed
+	mapping, _ := common.ParsePropertyMapping(string(jpph.PropertyMappingRules[:jpph.PropertyMappingRulesLength]))
+	return mapping
+}
+
+// Manifest returns where the manifest of the job is written, and the key it is signed with
+func (jpph *JobPartPlanHeader) Manifest() (path, signingKey string) {
+	return string(jpph.ManifestPath[:jpph.ManifestPathLength]), string(jpph.ManifestSigningKey[:jpph.ManifestSigningKeyLength])
+}
+
+// SuccessMarkerPath returns where the success marker of the job is created, relative to the destination root, or "" if there is none
+func (jpph *JobPartPlanHeader) SuccessMarkerPath() string {
+	return string(jpph.SuccessMarker[:jpph.SuccessMarkerLength])
+}
+
 // TransferSrcDstDetail returns the source and destination string for a transfer at given transferIndex in JobPartOrder
 func (jpph *JobPartPlanHeader) TransferSrcDstStrings(transferIndex uint32) (source, destination string) {
 	srcRoot := string(jpph.SourceRoot[:jpph.SourceRootLength])
@@ -128,9 +306,12 @@ func (jpph *JobPartPlanHeader) TransferSrcDstStrings(transferIndex uint32) (sour
 	dstSlice := []byte{}
 	sh = (*reflect.SliceHeader)(unsafe.Pointer(&dstSlice))
 	sh.Data = uintptr(unsafe.Pointer(jpph)) + uintptr(jppt.SrcOffset) + uintptr(jppt.SrcLength) // Address of Job Part Plan + this transfer's src string offset + length of this transfer's src string
-	sh.Len = int(jppt.DstLength)
+	sh.Len = int(jppt.dstStringLength())
 	sh.Cap = sh.Len
 	dstRelative := string(dstSlice)
+	if jppt.DstLength < 0 {
+		dstRelative += srcRelative // only the prefix was stored
+	}
 
 	return common.GenerateFullPath(srcRoot, srcRelative), common.GenerateFullPath(dstRoot, dstRelative)
 }
@@ -157,7 +338,7 @@ func (jpph *JobPartPlanHeader) TransferSrcPropertiesAndMetadata(transferIndex ui
 	s2sInvalidMetadataHandleOption = jpph.S2SInvalidMetadataHandleOption
 	DestLengthValidation = jpph.DestLengthValidation
 
-	offset := t.SrcOffset + int64(t.SrcLength) + int64(t.DstLength)
+	offset := t.SrcOffset + int64(t.SrcLength) + int64(t.dstStringLength())
 
 	if t.SrcContentTypeLength != 0 {
 		h.ContentType = jpph.getString(offset, t.SrcContentTypeLength)
@@ -203,6 +384,38 @@ func (jpph *JobPartPlanHeader) TransferSrcPropertiesAndMetadata(transferIndex ui
 	return
 }
 
+// TransferSrcVersionID returns the version ID that the source of the transfer at given transferIndex is pinned to,
+// or an empty string if the transfer is not pinned
+func (jpph *JobPartPlanHeader) TransferSrcVersionID(transferIndex uint32) string {
+	t := jpph.Transfer(transferIndex)
+	if t.SrcVersionIDLength == 0 {
+		return ""
+	}
+
+	// the version ID comes after all of the other src properties
+	offset := t.SrcOffset + int64(t.SrcLength) + int64(t.dstStringLength()) + int64(t.SrcContentTypeLength) +
+		int64(t.SrcContentEncodingLength) + int64(t.SrcContentLanguageLength) + int64(t.SrcContentDispositionLength) +
+		int64(t.SrcCacheControlLength) + int64(t.SrcContentMD5Length) + int64(t.SrcMetadataLength) +
+		int64(t.SrcBlobTypeLength) + int64(t.SrcBlobTierLength)
+	return jpph.getString(offset, t.SrcVersionIDLength)
+}
+
+// TransferSrcETag returns the ETag that the source of the transfer at given transferIndex had when it was enumerated,
+// or an empty string if it was not recorded
+func (jpph *JobPartPlanHeader) TransferSrcETag(transferIndex uint32) string {
+	t := jpph.Transfer(transferIndex)
+	if t.SrcETagLength == 0 {
+		return ""
+	}
+
+	// the ETag comes after all of the other src properties, including the version ID
+	offset := t.SrcOffset + int64(t.SrcLength) + int64(t.dstStringLength()) + int64(t.SrcContentTypeLength) +
+		int64(t.SrcContentEncodingLength) + int64(t.SrcContentLanguageLength) + int64(t.SrcContentDispositionLength) +
+		int64(t.SrcCacheControlLength) + int64(t.SrcContentMD5Length) + int64(t.SrcMetadataLength) +
+		int64(t.SrcBlobTypeLength) + int64(t.SrcBlobTierLength) + int64(t.SrcVersionIDLength)
+	return jpph.getString(offset, t.SrcETagLength)
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // JobPartPlanDstBlob holds additional settings required when the destination is a blob
@@ -255,6 +468,9 @@ type JobPartPlanDstBlob struct {
 
 	// Specifies the maximum size of block which determines the number of chunks and chunk size of a transfer
 	BlockSize uint32
+
+	// Controls conversion of VHDX and qcow2 images to fixed VHDs as they are uploaded
+	ConvertToVHD bool
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -280,7 +496,8 @@ type JobPartPlanTransfer struct {
 	SrcOffset int64
 	// SrcLength represents the actual length of source string for specific transfer
 	SrcLength int16
-	// DstLength represents the actual length of destination string for specific transfer
+	// DstLength represents the actual length of destination string for specific transfer,
+	// or, if it's negative, that only a prefix of the destination string is stored, since the rest is the source string (see dstStringLength)
 	DstLength int16
 	// ChunkCount represents the num of chunks a transfer is split into
 	//ChunkCount uint16	// TODO: Remove this, we need to determine it at runtime
@@ -302,6 +519,10 @@ type JobPartPlanTransfer struct {
 	SrcMetadataLength           int16
 	SrcBlobTypeLength           int16
 	SrcBlobTierLength           int16
+	// SrcVersionIDLength is non-zero when the transfer is pinned to the version of the source blob seen at enumeration
+	SrcVersionIDLength int16
+	// SrcETagLength is non-zero when the ETag of the source was recorded at enumeration
+	SrcETagLength int16
 
 	// Any fields below this comment are NOT constants; they may change over as the transfer is processed.
 	// Care must be taken to read/write to these fields in a thread-safe way!
@@ -316,6 +537,23 @@ type JobPartPlanTransfer struct {
 	atomicErrorCode int32
 }
 
+// The destination string of most transfers is the same as the source string, or the source string with the name of the
+// source folder in front of it, since both are relative to their roots. So that long paths aren't stored twice, the plan
+// then only stores that prefix, and says so with a negative DstLength: -1 for no prefix, -2 for a prefix of 1 byte, and so on
+
+// dstLengthOfPrefix returns the DstLength of a transfer whose destination string is the source string with the given prefix
+func dstLengthOfPrefix(prefix string) int16 {
+	return -int16(len(prefix)) - 1
+}
+
+// dstStringLength returns how many bytes of the destination string of the transfer are stored in the plan file
+func (jppt *JobPartPlanTransfer) dstStringLength() int16 {
+	if jppt.DstLength < 0 {
+		return -jppt.DstLength - 1
+	}
+	return jppt.DstLength
+}
+
 // TransferStatus returns the transfer's status
 func (jppt *JobPartPlanTransfer) TransferStatus() common.TransferStatus {
 	return jppt.atomicTransferStatus.AtomicLoad()
@@ -0,0 +1,255 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// The plan files of a job that finished a while ago are compressed, since from then on they are mostly just read, by
+// the jobs list and jobs show commands. Those read a compressed plan into memory, instead of mapping it.
+// A job whose plan files are compressed is expanded back onto disk when it's resurrected, e.g. to be resumed.
+
+// compressedPlanFileExtension is added to the name of a plan file when it is compressed
+const compressedPlanFileExtension = ".gz"
+
+// currentPlanFileName says whether name is the name of a plan file of this version, compressed or not,
+// and returns the name of the plan file that it is (or was, before it was compressed)
+func currentPlanFileName(name string) (JobPartPlanFileName, bool) {
+	uncompressed := strings.TrimSuffix(name, compressedPlanFileExtension)
+	return JobPartPlanFileName(uncompressed), strings.HasSuffix(uncompressed, fmt.Sprintf(".steV%d", DataSchemaVersion))
+}
+
+// listCurrentPlanFiles returns the plan files of this version in planDir, whose names start with prefix, compressed or not.
+// Each is returned once, under the name of its uncompressed file, even if (after a crash) it's there both compressed and not
+func listCurrentPlanFiles(planDir string, prefix string) ([]os.FileInfo, error) {
+	files, err := ioutil.ReadDir(planDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[JobPartPlanFileName]bool)
+	var planFiles []os.FileInfo
+	for _, f := range files {
+		name, ok := currentPlanFileName(f.Name())
+		if f.IsDir() || !ok || !strings.HasPrefix(f.Name(), prefix) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		planFiles = append(planFiles, planFileInfo{FileInfo: f, name: string(name)})
+	}
+	return planFiles, nil
+}
+
+// planFileInfo is the FileInfo of a plan file, under the name of its uncompressed file
+type planFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i planFileInfo) Name() string { return i.name }
+
+// readPlanFile reads the whole of a plan file, decompressing it if it's compressed
+func readPlanFile(path string) ([]byte, error) {
+	if !strings.HasSuffix(path, compressedPlanFileExtension) {
+		return ioutil.ReadFile(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress %s: %v", path, err)
+	}
+	defer reader.Close()
+	plan, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress %s: %v", path, err)
+	}
+	return plan, nil
+}
+
+// replacePlanFile writes content to a temporary file next to newPath, and renames it into place once it's complete,
+// keeping the modification time of the file that it replaces (so that the clean-up of old jobs still sees when the job last ran).
+// The file at oldPath is then removed
+func replacePlanFile(oldPath string, newPath string, modTime time.Time, write func(file *os.File) error) error {
+	const suffix = ".writing"
+	file, err := os.OpenFile(newPath+suffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, common.DEFAULT_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(newPath+suffix, modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(newPath+suffix, newPath)
+	}
+	if err != nil {
+		_ = os.Remove(newPath + suffix)
+		return err
+	}
+	return os.Remove(oldPath)
+}
+
+// compressPlanFile replaces the plan file at path with a compressed copy, and returns how many bytes that saved
+func compressPlanFile(path string, info os.FileInfo) (saved int64, err error) {
+	plan, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	compressedPath := path + compressedPlanFileExtension
+	err = replacePlanFile(path, compressedPath, info.ModTime(), func(file *os.File) error {
+		writer := gzip.NewWriter(file)
+		if _, err := writer.Write(plan); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	compressedInfo, err := os.Stat(compressedPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size() - compressedInfo.Size(), nil
+}
+
+// expandPlanFiles decompresses the compressed plan files, in planDir, of the jobs whose ID starts with jobIDPrefix,
+// so that they can be mapped and written to again
+func expandPlanFiles(planDir string, jobIDPrefix string) (errs []error) {
+	files, err := ioutil.ReadDir(planDir)
+	if err != nil {
+		return []error{err}
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), jobIDPrefix) || !strings.HasSuffix(f.Name(), compressedPlanFileExtension) {
+			continue
+		}
+		compressedPath := filepath.Join(planDir, f.Name())
+		path := strings.TrimSuffix(compressedPath, compressedPlanFileExtension)
+		if _, err := os.Stat(path); err == nil {
+			// compressing it was interrupted, after the compressed copy was complete. The uncompressed one is the one to keep
+			_ = os.Remove(compressedPath)
+			continue
+		}
+
+		plan, err := readPlanFile(compressedPath)
+		if err == nil {
+			err = replacePlanFile(compressedPath, path, f.ModTime(), func(file *os.File) error {
+				_, err := file.Write(plan)
+				return err
+			})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot expand the plan file %s: %v", f.Name(), err))
+		}
+	}
+	return errs
+}
+
+// planFileJobStatus reads the status of the job from the plan file of its part 0, which may be compressed
+func planFileJobStatus(path string) (common.JobStatus, error) {
+	plan, err := readPlanFile(path)
+	if os.IsNotExist(err) {
+		plan, err = readPlanFile(path + compressedPlanFileExtension)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if uintptr(len(plan)) < unsafe.Sizeof(JobPartPlanHeader{}) {
+		return 0, fmt.Errorf("the plan file %s is too short to hold its header", filepath.Base(path))
+	}
+	return (*JobPartPlanHeader)(unsafe.Pointer(&plan[0])).JobStatus(), nil
+}
+
+// CompressFinishedPlanFiles compresses the plan files, in planDir, of the jobs that have finished, and whose plan files
+// have not changed for at least gracePeriod (so that they can't belong to a job that another AzCopy process is resuming right now).
+// It returns how many plan files it compressed, and how many bytes that saved
+func CompressFinishedPlanFiles(planDir string, gracePeriod time.Duration) (compressed int, saved int64, err error) {
+	files, err := ioutil.ReadDir(planDir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// only the uncompressed plan files of this version are of interest. Older ones are left as they are, until they are migrated
+	jobs := make(map[common.JobID][]os.FileInfo)
+	recentlyChanged := make(map[common.JobID]bool)
+	for _, f := range files {
+		jobID, file, isOld := parseOldPlanFileName(f.Name())
+		if f.IsDir() || isOld || file.version != DataSchemaVersion || strings.HasSuffix(f.Name(), compressedPlanFileExtension) {
+			continue
+		}
+		jobs[jobID] = append(jobs[jobID], f)
+		if time.Since(f.ModTime()) < gracePeriod {
+			recentlyChanged[jobID] = true
+		}
+	}
+
+	for jobID, parts := range jobs {
+		if recentlyChanged[jobID] {
+			continue
+		}
+		part0 := filepath.Join(planDir, fmt.Sprintf(jobPartPlanFileNameFormat, jobID.String(), 0, DataSchemaVersion))
+		status, err := planFileJobStatus(part0)
+		if err != nil || !status.IsJobDone() {
+			continue // if the status can't be read, leave the files as they are, for the jobs commands to report
+		}
+
+		for _, part := range parts {
+			n, err := compressPlanFile(filepath.Join(planDir, part.Name()), part)
+			if err != nil {
+				return compressed, saved, fmt.Errorf("cannot compress the plan file %s: %v", part.Name(), err)
+			}
+			compressed++
+			saved += n
+		}
+	}
+	return compressed, saved, nil
+}
+
+// mapCompressedPlanFile reads a compressed plan file into memory, for a plan file that isn't there uncompressed
+func mapCompressedPlanFile(path string) (*JobPartPlanMMF, error) {
+	plan, err := readPlanFile(path + compressedPlanFileExtension)
+	if err != nil {
+		return nil, err
+	}
+	return (*JobPartPlanMMF)(common.NewMemoryMMF(plan)), nil
+}
@@ -2,6 +2,7 @@ package ste
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -56,6 +57,12 @@ func (jpfn JobPartPlanFileName) Delete() error {
 func (jpfn JobPartPlanFileName) Map() *JobPartPlanMMF {
 	// opening the file with given filename
 	file, err := os.OpenFile(jpfn.GetJobPartPlanPath(), os.O_RDWR, common.DEFAULT_FILE_PERM)
+	if os.IsNotExist(err) {
+		// the job may have finished a while ago, and had its plan files compressed
+		if mmf, compressedErr := mapCompressedPlanFile(jpfn.GetJobPartPlanPath()); compressedErr == nil {
+			return mmf
+		}
+	}
 	common.PanicIfErr(err)
 	// Ensure the file gets closed (although we can continue to use the MMF)
 	defer file.Close()
@@ -67,6 +74,14 @@ func (jpfn JobPartPlanFileName) Map() *JobPartPlanMMF {
 	return (*JobPartPlanMMF)(mmf)
 }
 
+// orderedBytes returns the size of all the transfers in the order
+func orderedBytes(order common.CopyJobPartOrderRequest) (bytes uint64) {
+	for _, t := range order.Transfers {
+		bytes += uint64(t.SourceSize)
+	}
+	return bytes
+}
+
 // createJobPartPlanFile creates the memory map JobPartPlanHeader using the given JobPartOrder and JobPartPlanBlobData
 func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	// Validate that the passed-in strings can fit in their respective fields
@@ -94,6 +109,31 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	if len(order.BlobAttributes.Metadata) > len(JobPartPlanDstBlob{}.Metadata) {
 		panic(fmt.Errorf("metadata string is too large: %q", order.BlobAttributes.Metadata))
 	}
+	if len(order.Labels) > len(JobPartPlanHeader{}.JobLabels) {
+		panic(fmt.Errorf("labels string is too large: %q", order.Labels))
+	}
+	if len(order.Description) > len(JobPartPlanHeader{}.JobDescription) {
+		panic(fmt.Errorf("description string is too large: %q", order.Description))
+	}
+	if len(order.ManifestPath) > len(JobPartPlanHeader{}.ManifestPath) {
+		panic(fmt.Errorf("manifest path is too long: %q", order.ManifestPath))
+	}
+	if len(order.ManifestSigningKey) > len(JobPartPlanHeader{}.ManifestSigningKey) {
+		panic(fmt.Errorf("manifest signing key is too long: %q", order.ManifestSigningKey))
+	}
+	if len(order.SuccessMarker) > len(JobPartPlanHeader{}.SuccessMarker) {
+		panic(fmt.Errorf("success marker path is too long: %q", order.SuccessMarker))
+	}
+	if len(order.PropertyMapping) > len(JobPartPlanHeader{}.PropertyMappingRules) {
+		panic(fmt.Errorf("property mapping is too long: %q", order.PropertyMapping))
+	}
+	contentPolicy := []byte{}
+	if !order.ContentPolicy.IsEmpty() {
+		contentPolicy, _ = json.Marshal(order.ContentPolicy)
+		if len(contentPolicy) > len(JobPartPlanHeader{}.ContentPolicyRules) {
+			panic(fmt.Errorf("content policy is too long: %s", contentPolicy))
+		}
+	}
 
 	// This nested function writes a structure value to an io.Writer & returns the number of bytes written
 	writeValue := func(writer io.Writer, v interface{}) int64 {
@@ -174,6 +214,7 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 			PageBlobTier:             order.BlobAttributes.PageBlobTier,
 			MetadataLength:           uint16(len(order.BlobAttributes.Metadata)),
 			BlockSize:                blockSize,
+			ConvertToVHD:             order.BlobAttributes.ConvertToVHD,
 		},
 		DstLocalData: JobPartPlanDstLocal{
 			PreserveLastModifiedTime: order.BlobAttributes.PreserveLastModifiedTime,
@@ -184,8 +225,35 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 		S2SSourceChangeValidation:      order.S2SSourceChangeValidation,
 		S2SInvalidMetadataHandleOption: order.S2SInvalidMetadataHandleOption,
 		DestLengthValidation:           order.DestLengthValidation,
+		AllowSecondaryRead:             order.AllowSecondaryRead,
+		SourceChangePolicy:             order.SourceChangePolicy,
+		MaxWriteLatencyMilliseconds:    order.MaxWriteLatencyMilliseconds,
+		FileTimeBudgetSecondsPerGB:     order.FileTimeBudgetSecondsPerGB,
+		DeleteSourceAfter:              order.DeleteSourceAfter,
+		AssertSourceUnchanged:          order.AssertSourceUnchanged,
+		MaxAccountThroughputFraction:   order.MaxAccountThroughputFraction,
+		PropertiesOnly:                 order.PropertiesOnly,
+		JournalTransitions:             order.JournalTransitions,
 		atomicJobStatus:                common.EJobStatus.InProgress(), // We default to InProgress
 		DeleteSnapshotsOption:          order.BlobAttributes.DeleteSnapshotsOption,
+		JobLabelsLength:                uint16(len(order.Labels)),
+		JobDescriptionLength:           uint16(len(order.Description)),
+		ManifestPathLength:             uint16(len(order.ManifestPath)),
+		ManifestSigningKeyLength:       uint16(len(order.ManifestSigningKey)),
+		PropertyMappingRulesLength:     uint16(len(order.PropertyMapping)),
+		SuccessMarkerLength:            uint16(len(order.SuccessMarker)),
+		AfterJobID:                     order.AfterJobID,
+		FolderCreation:                 order.FolderCreation,
+		WriteOnce:                      order.WriteOnce,
+		PreservePermissions:            order.PreservePermissions,
+		PreservePosixProperties:        order.PreservePosixProperties,
+		DailyCapBytes:                  order.DailyCapBytes,
+		SourceSASFromLogin:             order.SourceSASFromLogin,
+		ContentPolicyRulesLength:       uint16(len(contentPolicy)),
+	}
+	if order.PartNum == 0 {
+		// the running totals of the job start with the transfers of its first part. The others add theirs as they're ordered
+		jpph.atomicJobTotalBytes = orderedBytes(order)
 	}
 
 	// Copy any strings into their respective fields
@@ -197,6 +265,16 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	copy(jpph.DstBlobData.ContentDisposition[:], order.BlobAttributes.ContentDisposition)
 	copy(jpph.DstBlobData.CacheControl[:], order.BlobAttributes.CacheControl)
 	copy(jpph.DstBlobData.Metadata[:], order.BlobAttributes.Metadata)
+	copy(jpph.JobLabels[:], order.Labels)
+	copy(jpph.JobDescription[:], order.Description)
+	copy(jpph.ManifestPath[:], order.ManifestPath)
+	copy(jpph.ManifestSigningKey[:], order.ManifestSigningKey)
+	copy(jpph.PropertyMappingRules[:], order.PropertyMapping)
+	copy(jpph.SuccessMarker[:], order.SuccessMarker)
+	copy(jpph.ContentPolicyRules[:], contentPolicy)
+	if ja, ok := JobsAdmin.(*jobsAdmin); ok {
+		jpph.setEffectiveConcurrency(ja.concurrency.describe())
+	}
 
 	eof += writeValue(file, &jpph)
 
@@ -244,19 +322,24 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 			SrcMetadataLength:           int16(srcMetadataLength),
 			SrcBlobTypeLength:           int16(len(order.Transfers[t].BlobType)),
 			SrcBlobTierLength:           int16(len(order.Transfers[t].BlobTier)),
+			SrcVersionIDLength:          int16(len(order.Transfers[t].VersionID)),
+			SrcETagLength:               int16(len(order.Transfers[t].ETag)),
 
 			atomicTransferStatus: common.ETransferStatus.Started(), // Default
 			//ChunkNum:                getNumChunks(uint64(order.Transfers[t].SourceSize), uint64(data.BlockSize)),
 		}
+		if dstPrefix, ok := destinationPrefix(order.Transfers[t]); ok {
+			jppt.DstLength = dstLengthOfPrefix(dstPrefix) // so that the source string isn't stored twice
+		}
 		eof += writeValue(file, &jppt) // Write the transfer entry
 
 		// The NEXT transfer's src/dst string come after THIS transfer's src/dst strings
 		srcDstStringsOffset[t] = currentSrcStringOffset
 
-		currentSrcStringOffset += int64(jppt.SrcLength + jppt.DstLength + jppt.SrcContentTypeLength +
+		currentSrcStringOffset += int64(jppt.SrcLength + jppt.dstStringLength() + jppt.SrcContentTypeLength +
 			jppt.SrcContentEncodingLength + jppt.SrcContentLanguageLength + jppt.SrcContentDispositionLength +
 			jppt.SrcCacheControlLength + jppt.SrcContentMD5Length + jppt.SrcMetadataLength +
-			jppt.SrcBlobTypeLength + jppt.SrcBlobTierLength)
+			jppt.SrcBlobTypeLength + jppt.SrcBlobTierLength + jppt.SrcVersionIDLength + jppt.SrcETagLength)
 	}
 
 	// All the transfers were written; now write each transfer's src/dst strings
@@ -271,7 +354,11 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 		common.PanicIfErr(err)
 		// write the destination string in memory map file
 		eof += int64(bytesWritten)
-		bytesWritten, err = file.WriteString(order.Transfers[t].Destination)
+		dstString := order.Transfers[t].Destination
+		if dstPrefix, ok := destinationPrefix(order.Transfers[t]); ok {
+			dstString = dstPrefix
+		}
+		bytesWritten, err = file.WriteString(dstString)
 		common.PanicIfErr(err)
 		eof += int64(bytesWritten)
 
@@ -325,6 +412,25 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 			common.PanicIfErr(err)
 			eof += int64(bytesWritten)
 		}
+		if len(order.Transfers[t].VersionID) != 0 {
+			bytesWritten, err = file.WriteString(order.Transfers[t].VersionID)
+			common.PanicIfErr(err)
+			eof += int64(bytesWritten)
+		}
+		if len(order.Transfers[t].ETag) != 0 {
+			bytesWritten, err = file.WriteString(order.Transfers[t].ETag)
+			common.PanicIfErr(err)
+			eof += int64(bytesWritten)
+		}
 	}
 	// the file is closed to due to defer above
 }
+
+// destinationPrefix returns what comes before the source string in the destination string of the transfer, if the
+// destination string ends with the source string
+func destinationPrefix(transfer common.CopyTransfer) (string, bool) {
+	if !strings.HasSuffix(transfer.Destination, transfer.Source) {
+		return "", false
+	}
+	return transfer.Destination[:len(transfer.Destination)-len(transfer.Source)], true
+}
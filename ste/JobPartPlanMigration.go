@@ -0,0 +1,383 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Plan files are memory-mapped, so their layout is the in-memory layout of JobPartPlanHeader and JobPartPlanTransfer.
+// To let a job that was started by one version of AzCopy be resumed by the next, each release that changes that layout
+// (or only the values that a field may hold, so that older versions don't misread them) bumps DataSchemaVersion, and adds
+// a planMigration below that turns a plan file of the previous version into one of the new version. The layouts of the
+// older versions are kept here, as they were, for their migrations. Plan files of older versions are then migrated, one
+// version at a time, when their job is resurrected.
+// New constant fields of the header go at the end of its constant fields (i.e. just before atomicJobStatus), so that
+// InspectPlanFile can still show what it knows of a plan that's newer than it can migrate.
+
+// planMigration turns the content of a plan file of the previous version into the content of a plan file of the version it is registered for
+type planMigration func(plan []byte) ([]byte, error)
+
+// planMigrations holds, for each version of the plan file format, how to migrate to it from the previous version.
+// The oldest version that can be migrated is the one before the oldest version listed here
+var planMigrations = map[common.Version]planMigration{
+	11: migratePlanFromV10,
+}
+
+// planHeaderV10 is the layout of JobPartPlanHeader in version 10
+type planHeaderV10 struct {
+	Version                        common.Version
+	StartTime                      int64
+	JobID                          common.JobID
+	PartNum                        common.PartNumber
+	SourceRootLength               uint16
+	SourceRoot                     [1000]byte
+	DestinationRootLength          uint16
+	DestinationRoot                [1000]byte
+	IsFinalPart                    bool
+	ForceWrite                     common.OverwriteOption
+	AutoDecompress                 bool
+	Priority                       common.JobPriority
+	TTLAfterCompletion             uint32
+	FromTo                         common.FromTo
+	CommandStringLength            uint32
+	NumTransfers                   uint32
+	LogLevel                       common.LogLevel
+	DstBlobData                    planDstBlobV10
+	DstLocalData                   JobPartPlanDstLocal
+	S2SGetPropertiesInBackend      bool
+	S2SSourceChangeValidation      bool
+	DestLengthValidation           bool
+	S2SInvalidMetadataHandleOption common.InvalidMetadataHandleOption
+	atomicJobStatus                common.JobStatus
+	DeleteSnapshotsOption          common.DeleteSnapshotsOption
+}
+
+// planDstBlobV10 is the layout of JobPartPlanDstBlob in version 10, which had no ConvertToVHD
+type planDstBlobV10 struct {
+	BlobType                 common.BlobType
+	NoGuessMimeType          bool
+	ContentTypeLength        uint16
+	ContentType              [CustomHeaderMaxBytes]byte
+	ContentEncodingLength    uint16
+	ContentEncoding          [CustomHeaderMaxBytes]byte
+	ContentLanguageLength    uint16
+	ContentLanguage          [CustomHeaderMaxBytes]byte
+	ContentDispositionLength uint16
+	ContentDisposition       [CustomHeaderMaxBytes]byte
+	CacheControlLength       uint16
+	CacheControl             [CustomHeaderMaxBytes]byte
+	BlockBlobTier            common.BlockBlobTier
+	PageBlobTier             common.PageBlobTier
+	PutMd5                   bool
+	MetadataLength           uint16
+	Metadata                 [MetadataMaxBytes]byte
+	BlockSize                uint32
+}
+
+// planTransferV10 is the layout of JobPartPlanTransfer in version 10, which had no version ID or ETag of the source
+type planTransferV10 struct {
+	SrcOffset                   int64
+	SrcLength                   int16
+	DstLength                   int16
+	ModifiedTime                int64
+	SourceSize                  int64
+	CompletionTime              uint64
+	SrcContentTypeLength        int16
+	SrcContentEncodingLength    int16
+	SrcContentLanguageLength    int16
+	SrcContentDispositionLength int16
+	SrcCacheControlLength       int16
+	SrcContentMD5Length         int16
+	SrcMetadataLength           int16
+	SrcBlobTypeLength           int16
+	SrcBlobTierLength           int16
+	atomicTransferStatus        common.TransferStatus
+	atomicErrorCode             int32
+}
+
+// migratePlanFromV10 rewrites a plan of version 10 field by field, since both the header and the transfers grew in version 11.
+// The new fields are left zeroed, which means "not used by this job" for each of them; and the running totals of the job,
+// which version 10 didn't keep, are worked out by migrateJobPlanFiles once all the parts are migrated
+func migratePlanFromV10(plan []byte) ([]byte, error) {
+	oldHeaderSize, oldTransferSize := uint64(unsafe.Sizeof(planHeaderV10{})), uint64(unsafe.Sizeof(planTransferV10{}))
+	newHeaderSize, newTransferSize := uint64(unsafe.Sizeof(JobPartPlanHeader{})), uint64(unsafe.Sizeof(JobPartPlanTransfer{}))
+	if uint64(len(plan)) < oldHeaderSize {
+		return nil, fmt.Errorf("the plan file is too short (%d bytes) to hold its header", len(plan))
+	}
+	// copied, rather than pointed into, since plan need not be aligned
+	old := planHeaderV10{}
+	copy((*[unsafe.Sizeof(planHeaderV10{})]byte)(unsafe.Pointer(&old))[:], plan)
+
+	oldTransfersOffset := oldHeaderSize + uint64(old.CommandStringLength)
+	oldStringsOffset := oldTransfersOffset + uint64(old.NumTransfers)*oldTransferSize
+	if oldStringsOffset > uint64(len(plan)) {
+		return nil, fmt.Errorf("the plan file is too short to hold its %d transfers", old.NumTransfers)
+	}
+	newTransfersOffset := newHeaderSize + uint64(old.CommandStringLength)
+	newStringsOffset := newTransfersOffset + uint64(old.NumTransfers)*newTransferSize
+
+	result := make([]byte, newStringsOffset+uint64(len(plan))-oldStringsOffset)
+	h := (*JobPartPlanHeader)(unsafe.Pointer(&result[0]))
+	h.Version = old.Version
+	h.StartTime = old.StartTime
+	h.JobID = old.JobID
+	h.PartNum = old.PartNum
+	h.SourceRootLength = old.SourceRootLength
+	h.SourceRoot = old.SourceRoot
+	h.DestinationRootLength = old.DestinationRootLength
+	h.DestinationRoot = old.DestinationRoot
+	h.IsFinalPart = old.IsFinalPart
+	h.ForceWrite = old.ForceWrite
+	h.AutoDecompress = old.AutoDecompress
+	h.Priority = old.Priority
+	h.TTLAfterCompletion = old.TTLAfterCompletion
+	h.FromTo = old.FromTo
+	h.CommandStringLength = old.CommandStringLength
+	h.NumTransfers = old.NumTransfers
+	h.LogLevel = old.LogLevel
+	h.DstBlobData = JobPartPlanDstBlob{
+		BlobType:                 old.DstBlobData.BlobType,
+		NoGuessMimeType:          old.DstBlobData.NoGuessMimeType,
+		ContentTypeLength:        old.DstBlobData.ContentTypeLength,
+		ContentType:              old.DstBlobData.ContentType,
+		ContentEncodingLength:    old.DstBlobData.ContentEncodingLength,
+		ContentEncoding:          old.DstBlobData.ContentEncoding,
+		ContentLanguageLength:    old.DstBlobData.ContentLanguageLength,
+		ContentLanguage:          old.DstBlobData.ContentLanguage,
+		ContentDispositionLength: old.DstBlobData.ContentDispositionLength,
+		ContentDisposition:       old.DstBlobData.ContentDisposition,
+		CacheControlLength:       old.DstBlobData.CacheControlLength,
+		CacheControl:             old.DstBlobData.CacheControl,
+		BlockBlobTier:            old.DstBlobData.BlockBlobTier,
+		PageBlobTier:             old.DstBlobData.PageBlobTier,
+		PutMd5:                   old.DstBlobData.PutMd5,
+		MetadataLength:           old.DstBlobData.MetadataLength,
+		Metadata:                 old.DstBlobData.Metadata,
+		BlockSize:                old.DstBlobData.BlockSize,
+	}
+	h.DstLocalData = old.DstLocalData
+	h.S2SGetPropertiesInBackend = old.S2SGetPropertiesInBackend
+	h.S2SSourceChangeValidation = old.S2SSourceChangeValidation
+	h.DestLengthValidation = old.DestLengthValidation
+	h.S2SInvalidMetadataHandleOption = old.S2SInvalidMetadataHandleOption
+	h.atomicJobStatus = old.atomicJobStatus
+	h.DeleteSnapshotsOption = old.DeleteSnapshotsOption
+
+	copy(result[newHeaderSize:newTransfersOffset], plan[oldHeaderSize:oldTransfersOffset])
+	// the strings of the transfers are laid out as they were, but they have moved along with everything before them
+	copy(result[newStringsOffset:], plan[oldStringsOffset:])
+	for i := uint64(0); i < uint64(old.NumTransfers); i++ {
+		t := planTransferV10{}
+		copy((*[unsafe.Sizeof(planTransferV10{})]byte)(unsafe.Pointer(&t))[:], plan[oldTransfersOffset+i*oldTransferSize:])
+		*(*JobPartPlanTransfer)(unsafe.Pointer(&result[newTransfersOffset+i*newTransferSize])) = JobPartPlanTransfer{
+			SrcOffset:                   t.SrcOffset + int64(newStringsOffset) - int64(oldStringsOffset),
+			SrcLength:                   t.SrcLength,
+			DstLength:                   t.DstLength,
+			ModifiedTime:                t.ModifiedTime,
+			SourceSize:                  t.SourceSize,
+			CompletionTime:              t.CompletionTime,
+			SrcContentTypeLength:        t.SrcContentTypeLength,
+			SrcContentEncodingLength:    t.SrcContentEncodingLength,
+			SrcContentLanguageLength:    t.SrcContentLanguageLength,
+			SrcContentDispositionLength: t.SrcContentDispositionLength,
+			SrcCacheControlLength:       t.SrcCacheControlLength,
+			SrcContentMD5Length:         t.SrcContentMD5Length,
+			SrcMetadataLength:           t.SrcMetadataLength,
+			SrcBlobTypeLength:           t.SrcBlobTypeLength,
+			SrcBlobTierLength:           t.SrcBlobTierLength,
+			atomicTransferStatus:        t.atomicTransferStatus,
+			atomicErrorCode:             t.atomicErrorCode,
+		}
+	}
+	return result, nil
+}
+
+// migratePlan migrates the content of a plan file from the given version to DataSchemaVersion
+func migratePlan(plan []byte, version common.Version) ([]byte, error) {
+	if version > DataSchemaVersion {
+		return nil, fmt.Errorf("version %d is newer than this version of AzCopy supports (%d)", version, DataSchemaVersion)
+	}
+	for version < DataSchemaVersion {
+		migrate, ok := planMigrations[version+1]
+		if !ok {
+			return nil, fmt.Errorf("version %d is too old to be migrated", version)
+		}
+		var err error
+		if plan, err = migrate(plan); err != nil {
+			return nil, fmt.Errorf("migrating from version %d to %d failed: %v", version, version+1, err)
+		}
+		version++
+		binary.LittleEndian.PutUint32(plan[unsafe.Offsetof(JobPartPlanHeader{}.Version):], uint32(version))
+	}
+	return plan, nil
+}
+
+// oldPlanFile is a plan file written by an older version of AzCopy
+type oldPlanFile struct {
+	name    string
+	partNum common.PartNumber
+	version common.Version
+}
+
+// parseOldPlanFileName parses the name of a plan file of any version, and says whether it is of an older version than DataSchemaVersion
+func parseOldPlanFileName(name string) (jobID common.JobID, file oldPlanFile, ok bool) {
+	parts := strings.Split(name, "--")
+	if len(parts) != 2 {
+		return
+	}
+	jobID, err := common.ParseJobID(parts[0])
+	if err != nil {
+		return
+	}
+	file.name = name
+	if n, err := fmt.Sscanf(parts[1], "%05d.steV%d", &file.partNum, &file.version); err != nil || n != 2 {
+		return
+	}
+	return jobID, file, file.version < DataSchemaVersion
+}
+
+// migratePlanFiles migrates the plan files, in planDir, of the jobs whose ID starts with jobIDPrefix and that were
+// written by an older version of AzCopy.  Each job is migrated completely or not at all, and the plan files of the
+// old version are removed once its migration has succeeded. It returns the jobs that were migrated, and the version
+// that each was migrated from, and an error for each job that couldn't be
+func migratePlanFiles(planDir string, jobIDPrefix string) (migrated map[common.JobID]common.Version, errs []error) {
+	files, err := ioutil.ReadDir(planDir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	oldFiles := make(map[common.JobID][]oldPlanFile)
+	currentFiles := make(map[common.JobID]bool)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), jobIDPrefix) {
+			continue
+		}
+		if jobID, file, isOld := parseOldPlanFileName(f.Name()); isOld {
+			oldFiles[jobID] = append(oldFiles[jobID], file)
+		} else if file.version == DataSchemaVersion {
+			currentFiles[jobID] = true
+		}
+	}
+
+	migrated = make(map[common.JobID]common.Version)
+	for jobID, parts := range oldFiles {
+		if currentFiles[jobID] {
+			continue // already migrated (or the plan files of both versions are there for some other reason). Either way, leave them
+		}
+		if err := migrateJobPlanFiles(planDir, jobID, parts); err != nil {
+			errs = append(errs, fmt.Errorf("cannot migrate the plan files of job %s to the current version: %v", jobID, err))
+		} else {
+			migrated[jobID] = parts[0].version
+		}
+	}
+	return migrated, errs
+}
+
+func migrateJobPlanFiles(planDir string, jobID common.JobID, parts []oldPlanFile) (err error) {
+	const suffix = ".migrating"
+	var written, renamed []string
+	defer func() {
+		if err != nil {
+			for _, name := range written {
+				_ = os.Remove(filepath.Join(planDir, name+suffix))
+			}
+			for _, name := range renamed {
+				_ = os.Remove(filepath.Join(planDir, name)) // the old version is still there, so we can try again next time
+			}
+		}
+	}()
+
+	plans := make(map[common.PartNumber][]byte, len(parts))
+	for _, part := range parts {
+		if part.version != parts[0].version {
+			return fmt.Errorf("its parts have different versions (%d and %d)", parts[0].version, part.version)
+		}
+		plan, err := readPlanFile(filepath.Join(planDir, part.name)) // it may have been compressed, if the job had finished
+		if err != nil {
+			return err
+		}
+		if plans[part.partNum], err = migratePlan(plan, part.version); err != nil {
+			return fmt.Errorf("part %d: %v", part.partNum, err)
+		}
+	}
+	if err = setPlanJobTotals(plans); err != nil {
+		return err
+	}
+
+	// write the migrated parts alongside the old ones, so nothing has changed if any of them fail
+	for partNum, plan := range plans {
+		newName := fmt.Sprintf(jobPartPlanFileNameFormat, jobID.String(), partNum, DataSchemaVersion)
+		if err = ioutil.WriteFile(filepath.Join(planDir, newName+suffix), plan, common.DEFAULT_FILE_PERM); err != nil {
+			return err
+		}
+		written = append(written, newName)
+	}
+
+	for _, name := range written {
+		if err = os.Rename(filepath.Join(planDir, name+suffix), filepath.Join(planDir, name)); err != nil {
+			return err
+		}
+		renamed = append(renamed, name)
+	}
+	for _, part := range parts {
+		_ = os.Remove(filepath.Join(planDir, part.name)) // not fatal, since the current version is used from now on
+	}
+	return nil
+}
+
+// setPlanJobTotals works out the running totals of the job, which the older plans didn't keep,
+// from the transfers of all its (migrated) parts, and stores them in part 0. A job without part 0 has nowhere to keep them
+func setPlanJobTotals(plans map[common.PartNumber][]byte) error {
+	part0, ok := plans[0]
+	if !ok {
+		return nil
+	}
+	var total, transferred uint64
+	for partNum, plan := range plans {
+		if uintptr(len(plan)) < unsafe.Sizeof(JobPartPlanHeader{}) {
+			return fmt.Errorf("part %d: the plan file is too short (%d bytes) to hold its header", partNum, len(plan))
+		}
+		h := (*JobPartPlanHeader)(unsafe.Pointer(&plan[0]))
+		if uint64(unsafe.Sizeof(JobPartPlanHeader{}))+uint64(h.CommandStringLength)+uint64(h.NumTransfers)*uint64(unsafe.Sizeof(JobPartPlanTransfer{})) > uint64(len(plan)) {
+			return fmt.Errorf("part %d: the plan file is too short to hold its %d transfers", partNum, h.NumTransfers)
+		}
+		for t := uint32(0); t < h.NumTransfers; t++ {
+			transfer := h.Transfer(t)
+			total += uint64(transfer.SourceSize)
+			if transfer.TransferStatus() == common.ETransferStatus.Success() {
+				transferred += uint64(transfer.SourceSize)
+			}
+		}
+	}
+	h := (*JobPartPlanHeader)(unsafe.Pointer(&part0[0]))
+	h.atomicJobTotalBytes = total
+	h.atomicJobBytesTransferred = transferred
+	return nil
+}
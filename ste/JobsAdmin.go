@@ -24,11 +24,9 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -138,19 +136,16 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 	normalTransferCh, normalChunkCh := make(chan IJobPartTransferMgr, channelSize), make(chan chunkFunc, channelSize)
 	lowTransferCh, lowChunkCh := make(chan IJobPartTransferMgr, channelSize), make(chan chunkFunc, channelSize)
 
-	maxRamBytesToUse := getMaxRamForChunks()
+	// if the user has set a hard limit on our RAM, keep both the chunks in flight, and the slices pooled for reuse, within their shares of it
+	memoryBudget := getMemoryBudget()
+	maxRamBytesToUse := limitChunkRamToMemoryBudget(getMaxRamForChunks(), memoryBudget)
 
-	// default to a pacer that doesn't actually control the rate
-	// (it just records total throughput, since for historical reasons we do that in the pacer)
-	var pacer pacerAdmin = newNullAutoPacer()
-	if targetRateInMegaBitsPerSec > 0 {
-		// use the "networking mega" (based on powers of 10, not powers of 2, since that's what mega means in networking context)
-		targetRateInBytesPerSec := targetRateInMegaBitsPerSec * 1000 * 1000 / 8
-		unusedExpectedCoarseRequestByteCount := uint32(0)
-		pacer = newTokenBucketPacer(targetRateInBytesPerSec, unusedExpectedCoarseRequestByteCount)
-		// Note: as at July 2019, we don't currently have a shutdown method/event on JobsAdmin where this pacer
-		// could be shut down. But, it's global anyway, so we just leave it running until application exit.
-	}
+	// use the "networking mega" (based on powers of 10, not powers of 2, since that's what mega means in networking context)
+	// If there's no cap, the pacer doesn't actually control the rate (it just records total throughput, since for historical
+	// reasons we do that in the pacer), but it's still there in case a cap is set while the job runs.
+	// Note: as at July 2019, we don't currently have a shutdown method/event on JobsAdmin where this pacer
+	// could be shut down. But, it's global anyway, so we just leave it running until application exit.
+	pacer := newAdjustableCapPacer(targetRateInMegaBitsPerSec * 1000 * 1000 / 8)
 
 	ja := &jobsAdmin{
 		concurrency:             concurrency,
@@ -159,12 +154,16 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 		logDir:                  azcopyLogPathFolder,
 		planDir:                 azcopyJobPlanFolder,
 		pacer:                   pacer,
-		slicePool:               common.NewMultiSizeSlicePool(common.MaxBlockBlobBlockSize),
+		slicePool:               common.NewMultiSizeSlicePoolWithLimit(common.MaxBlockBlobBlockSize, maxPooledSliceBytesInMemoryBudget(memoryBudget)),
+		memoryBudget:            memoryBudget,
+		diskPacer:               getDiskPacer(),
+		accountLimiter:          newAccountConcurrencyLimiter(concurrency.MaxMainPoolSizePerAccount.Value),
+		sftpPools:               newSftpClientPools(concurrency.MaxSftpConnectionsPerServer.Value),
 		cacheLimiter:            common.NewCacheLimiter(maxRamBytesToUse),
 		fileCountLimiter:        common.NewCacheLimiter(int64(concurrency.MaxOpenDownloadFiles)),
 		cpuMonitor:              cpuMon,
 		appCtx:                  appCtx,
-		commandLineMbpsCap:      targetRateInMegaBitsPerSec,
+		atomicMbpsCap:           targetRateInMegaBitsPerSec,
 		provideBenchmarkResults: providePerfAdvice,
 		coordinatorChannels: CoordinatorChannels{
 			partsChannel:     partsCh,
@@ -201,17 +200,19 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 	// Spin up slice pool pruner
 	go ja.slicePoolPruneLoop()
 
-	// One routine constantly monitors the partsChannel.  It takes the JobPartManager from
-	// the Channel and schedules the transfers of that JobPart.
-	go ja.scheduleJobParts()
+	// Apply any changes to the cap of the jobs that this process runs
+	go ja.watchJobCapFiles()
 
 	// In addition to the main pool (which is governed ja.poolSizer), we spin up a separate set of workers to process initiation of transfers
 	// (so that transfer initiation can't starve out progress on already-scheduled chunks.
 	// (Not sure whether that can really happen, but this protects against it anyway.)
 	// Perhaps MORE importantly, doing this separately gives us more CONTROL over how we interact with the file system.
-	for cc := 0; cc < concurrency.TransferInitiationPoolSize.Value; cc++ {
-		go ja.transferProcessor(cc)
-	}
+	// This pool may grow later, as job parts are scheduled (see scaleTransferInitiationPool)
+	ja.startTransferProcessors(concurrency.InitialTransferInitiationPoolSize)
+
+	// One routine constantly monitors the partsChannel.  It takes the JobPartManager from
+	// the Channel and schedules the transfers of that JobPart.
+	go ja.scheduleJobParts()
 }
 
 // Decide on a max amount of RAM we are willing to use. This functions as a cap, and prevents excessive usage.
@@ -223,15 +224,8 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 func getMaxRamForChunks() int64 {
 
 	// return the user-specified override value, if any
-	envVar := common.EEnvironmentVariable.BufferGB()
-	overrideString := common.GetLifecycleMgr().GetEnvironmentVariable(envVar)
-	if overrideString != "" {
-		overrideValue, err := strconv.ParseFloat(overrideString, 64)
-		if err != nil {
-			common.GetLifecycleMgr().Error(fmt.Sprintf("Cannot parse environment variable %s, due to error %s", envVar.Name, err))
-		} else {
-			return int64(overrideValue * 1024 * 1024 * 1024)
-		}
+	if c := tryNewConfiguredFloat(common.EEnvironmentVariable.BufferGB()); c != nil {
+		return int64(c.Value * 1024 * 1024 * 1024)
 	}
 
 	// else use a sensible default
@@ -278,12 +272,25 @@ func (ja *jobsAdmin) scheduleJobParts() {
 		if !found {
 			panic(fmt.Errorf("no job manager found for JobId %s", jobId.String()))
 		}
+		ja.scaleTransferInitiationPool(jobPart.Plan())
 		jobPart.ScheduleTransfers(jm.Context())
 	}
 }
 
 func (ja *jobsAdmin) createConcurrencyTuner() ConcurrencyTuner {
-	if ja.concurrency.AutoTuneMainPool() {
+	t := ja.createMainConcurrencyTuner()
+	if ja.concurrency.SlowStart.Value {
+		return newSlowStartConcurrencyTuner(t)
+	}
+	return t
+}
+
+func (ja *jobsAdmin) createMainConcurrencyTuner() ConcurrencyTuner {
+	if ja.concurrency.AdaptiveMainPool {
+		// there's no tuning phase to exclude from throughput calculations, since tuning never ends
+		ja.recordTuningCompleted(false)
+		return NewAdaptiveConcurrencyTuner(ja.concurrency.InitialMainPoolSize, ja.concurrency.MaxMainPoolSize.Value)
+	} else if ja.concurrency.AutoTuneMainPool() {
 		t := NewAutoConcurrencyTuner(ja.concurrency.InitialMainPoolSize, ja.concurrency.MaxMainPoolSize.Value, ja.provideBenchmarkResults)
 		if !t.RequestCallbackWhenStable(func() { ja.recordTuningCompleted(true) }) {
 			panic("could not register tuning completion callback")
@@ -343,6 +350,17 @@ func (ja *jobsAdmin) poolSizer(tuner ConcurrencyTuner) {
 	throughputMonitoringInterval := initialMonitoringInterval
 	slowTuneCh := ja.poolSizingChannels.requestSlowTuneCh
 
+	// while slow start is ramping up, it doesn't need to measure throughput, just to see that there have been no retries,
+	// so it takes its steps more quickly than tuning does
+	const slowStartMonitoringInterval = time.Second
+	slowStart, _ := tuner.(*slowStartConcurrencyTuner)
+	monitoringInterval := func() time.Duration {
+		if slowStart != nil && slowStart.isRamping() {
+			return slowStartMonitoringInterval
+		}
+		return throughputMonitoringInterval
+	}
+
 	// get initial pool size
 	targetConcurrency, reason := tuner.GetRecommendedConcurrency(-1, ja.cpuMonitor.CPUContentionExists())
 	logConcurrency(targetConcurrency, reason)
@@ -374,7 +392,7 @@ func (ja *jobsAdmin) poolSizer(tuner ConcurrencyTuner) {
 			// TODO: confirm we don't need this: expandedMonitoringInterval *= 2
 			throughputMonitoringInterval = expandedMonitoringInterval
 			slowTuneCh = nil // so we won't keep running this case at the expense of others)
-		case <-time.After(throughputMonitoringInterval):
+		case <-time.After(monitoringInterval()):
 			if actualConcurrency == targetConcurrency { // scalebacks can take time. Don't want to do any tuning if actual is not yet aligned to target
 				bytesOnWire := ja.BytesOverWire()
 				if hasHadTimeToStablize {
@@ -382,6 +400,7 @@ func (ja *jobsAdmin) poolSizer(tuner ConcurrencyTuner) {
 					elapsedSeconds := time.Since(lastBytesTime).Seconds()
 					bytes := bytesOnWire - lastBytesOnWire
 					megabitsPerSec := (8 * float64(bytes) / elapsedSeconds) / (1000 * 1000)
+					atomic.StoreInt64(&ja.atomicMeasuredBytesPerSecond, int64(float64(bytes)/elapsedSeconds))
 					if megabitsPerSec > 4000 {
 						throughputMonitoringInterval = expandedMonitoringInterval // start averaging throughputs over longer time period, since in some tests it takes a little longer to get a good average
 					}
@@ -446,14 +465,14 @@ func (ja *jobsAdmin) chunkProcessor(workerID int) {
 func (ja *jobsAdmin) transferProcessor(workerID int) {
 	startTransfer := func(jptm IJobPartTransferMgr) {
 		if jptm.WasCanceled() {
-			if jptm.ShouldLog(pipeline.LogInfo) {
-				jptm.Log(pipeline.LogInfo, fmt.Sprintf(" is not picked up worked %d because transfer was cancelled", workerID))
+			if jptm.ShouldLogCategory(common.ELogCategory.Chunk(), pipeline.LogInfo) {
+				jptm.LogWithCategory(common.ELogCategory.Chunk(), pipeline.LogInfo, fmt.Sprintf(" is not picked up worked %d because transfer was cancelled", workerID))
 			}
 			jptm.ReportTransferDone()
 		} else {
 			// TODO fix preceding space
-			if jptm.ShouldLog(pipeline.LogInfo) {
-				jptm.Log(pipeline.LogInfo, fmt.Sprintf("has worker %d which is processing TRANSFER", workerID))
+			if jptm.ShouldLogCategory(common.ELogCategory.Chunk(), pipeline.LogInfo) {
+				jptm.LogWithCategory(common.ELogCategory.Chunk(), pipeline.LogInfo, fmt.Sprintf("has worker %d which is processing TRANSFER", workerID))
 			}
 			jptm.StartJobXfer()
 		}
@@ -483,8 +502,11 @@ type jobsAdmin struct {
 	atomicSuccessfulBytesInActiveFiles int64
 	atomicBytesTransferredWhileTuning  int64
 	atomicTuningEndSeconds             int64
+	atomicMbpsCap                      int64 // given by cap-mbps, or since changed by 'azcopy jobs set-cap'
+	atomicMeasuredBytesPerSecond       int64 // throughput most recently measured by the pool sizer
 	atomicCurrentMainPoolSize          int32 // align 64 bit integers for 32 bit arch
 	concurrency                        ConcurrencySettings
+	transferInitiationPoolSize         int // number of transfer initiation routines started so far. Only touched by scheduleJobParts, after startup
 	logger                             common.ILoggerCloser
 	jobIDToJobMgr                      jobIDToJobMgr // Thread-safe map from each JobID to its JobInfo
 	// Other global state can be stored in more fields here...
@@ -494,13 +516,16 @@ type jobsAdmin struct {
 	xferChannels                XferChannels
 	poolSizingChannels          poolSizingChannels
 	appCtx                      context.Context
-	pacer                       pacerAdmin
+	pacer                       *adjustableCapPacer
 	slicePool                   common.ByteSlicePooler
 	cacheLimiter                common.CacheLimiter
 	fileCountLimiter            common.CacheLimiter
+	memoryBudget                int64                      // hard limit on our RAM, in bytes, set by the user. 0 if there's none
+	diskPacer                   *diskPacer                 // limits the rate of local disk I/O, if the user has asked for that. Else nil
+	accountLimiter              *accountConcurrencyLimiter // limits the main pool workers per storage account, if the user has asked for that. Else nil
+	sftpPools                   *sftpClientPools           // the connections to each SFTP server, shared by all jobs
 	workaroundJobLoggingChannel chan string
 	concurrencyTuner            ConcurrencyTuner
-	commandLineMbpsCap          int64
 	provideBenchmarkResults     bool
 	cpuMonitor                  common.CPUMonitor
 }
@@ -609,19 +634,14 @@ func (ja *jobsAdmin) SuccessfulBytesInActiveFiles() uint64 {
 }
 
 func (ja *jobsAdmin) ResurrectJob(jobId common.JobID, sourceSAS string, destinationSAS string) bool {
+	// The job may have finished a while ago, and had its plan files compressed, and it may have been started by an older version of AzCopy
+	ja.expandCompressedPlanFiles(jobId.String())
+	ja.migrateOldPlanFiles(jobId.String())
+
 	// Search the existing plan files for the PartPlans for the given jobId
 	// only the files which have JobId has prefix and DataSchemaVersion as Suffix
 	// are include in the result
-	files := func(prefix, ext string) []os.FileInfo {
-		var files []os.FileInfo
-		filepath.Walk(ja.planDir, func(path string, fileInfo os.FileInfo, _ error) error {
-			if !fileInfo.IsDir() && strings.HasPrefix(fileInfo.Name(), prefix) && strings.HasSuffix(fileInfo.Name(), ext) {
-				files = append(files, fileInfo)
-			}
-			return nil
-		})
-		return files
-	}(jobId.String(), fmt.Sprintf(".steV%d", DataSchemaVersion))
+	files, _ := listCurrentPlanFiles(ja.planDir, jobId.String())
 	// If no files with JobId exists then return false
 	if len(files) == 0 {
 		return false
@@ -643,17 +663,10 @@ func (ja *jobsAdmin) ResurrectJob(jobId common.JobID, sourceSAS string, destinat
 
 // reconstructTheExistingJobParts reconstructs the in memory JobPartPlanInfo for existing memory map JobFile
 func (ja *jobsAdmin) ResurrectJobParts() {
-	// Get all the Job part plan files in the plan directory
-	files := func(ext string) []os.FileInfo {
-		var files []os.FileInfo
-		filepath.Walk(ja.planDir, func(path string, fileInfo os.FileInfo, _ error) error {
-			if !fileInfo.IsDir() && strings.HasSuffix(fileInfo.Name(), ext) {
-				files = append(files, fileInfo)
-			}
-			return nil
-		})
-		return files
-	}(fmt.Sprintf(".steV%d", DataSchemaVersion))
+	ja.migrateOldPlanFiles("")
+
+	// Get all the Job part plan files in the plan directory. The compressed ones are only read, so they're left compressed
+	files, _ := listCurrentPlanFiles(ja.planDir, "")
 
 	// TODO : sort the file.
 	for f := 0; f < len(files); f++ {
@@ -669,6 +682,26 @@ func (ja *jobsAdmin) ResurrectJobParts() {
 	}
 }
 
+// migrateOldPlanFiles migrates the plan files written by older versions of AzCopy, for the jobs whose ID starts with jobIDPrefix,
+// so that those jobs can be resumed by this version
+func (ja *jobsAdmin) migrateOldPlanFiles(jobIDPrefix string) {
+	migrated, errs := migratePlanFiles(ja.planDir, jobIDPrefix)
+	for jobID, version := range migrated {
+		ja.Log(pipeline.LogInfo, fmt.Sprintf("Migrated the plan files of job %s from version %d to version %d", jobID, version, DataSchemaVersion))
+	}
+	for _, err := range errs {
+		ja.Log(pipeline.LogError, err.Error())
+	}
+}
+
+// expandCompressedPlanFiles decompresses the plan files of the jobs whose ID starts with jobIDPrefix, if they were compressed,
+// so that those jobs can be mapped and changed again
+func (ja *jobsAdmin) expandCompressedPlanFiles(jobIDPrefix string) {
+	for _, err := range expandPlanFiles(ja.planDir, jobIDPrefix) {
+		ja.Log(pipeline.LogError, err.Error())
+	}
+}
+
 // TODO: I think something is wrong here: I think delete and cleanup should be merged together.
 // DeleteJobInfo api deletes an entry of given JobId the JobsInfo
 // TODO: add the clean up logic for all Jobparts.
@@ -717,6 +750,16 @@ func (ja *jobsAdmin) CurrentMainPoolSize() int {
 	return int(atomic.LoadInt32(&ja.atomicCurrentMainPoolSize))
 }
 
+// bytesPerSecondPerConnection is the throughput that we most recently measured, divided among the connections that achieved it.
+// It is zero if we haven't measured it yet
+func (ja *jobsAdmin) bytesPerSecondPerConnection() float64 {
+	poolSize := ja.CurrentMainPoolSize()
+	if poolSize <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&ja.atomicMeasuredBytesPerSecond)) / float64(poolSize)
+}
+
 func (ja *jobsAdmin) slicePoolPruneLoop() {
 	// if something in the pool has been unused for this long, we probably don't need it
 	const pruneInterval = 5 * time.Second
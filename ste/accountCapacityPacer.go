@@ -0,0 +1,225 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const (
+	// how many seconds of throughput are averaged, to find what the job was getting through when the account said it was at its limit
+	accountCapacityWindowSize = 5
+
+	// how much a new measurement of the limit counts against the current estimate, so that one unusual window doesn't swing the target
+	accountCapacitySmoothing = 0.5
+
+	// how long the estimate is held after it has been lowered, before it starts creeping up again, so that the target
+	// doesn't go straight back to the rate at which the 503s started
+	accountCapacityHoldDuration = time.Minute
+
+	accountCapacityPacerString = "Account capacity pacer"
+)
+
+// accountCapacityPacer keeps the throughput of a job under a fraction of what the storage account can take, so that
+// AzCopy can run continuously next to production traffic on the same account. The limit of the account is learnt
+// from the 503s that say that ingress or egress is over the account limit: the throughput the job was getting at that
+// time is the most that we can assume the account will take. Since other traffic on the account comes and goes,
+// the estimate is raised slowly again while there are no such 503s. The limit may also be given up front (in Mbps)
+// through AZCOPY_ACCOUNT_THROUGHPUT_LIMIT_MBPS, in which case the estimate never goes above it.
+// Until it is enabled, and once it is closed at the end of the job, the pacer simply passes requests through to the
+// app-wide pacer (e.g. for cap-mbps).
+type accountCapacityPacer struct {
+	inner              pacer
+	atomicEnabled      int32
+	atomicTraffic      int64 // bytes let through since the last tuning interval
+	atomicLimitSignals int32 // 503s, since the last tuning interval, that said ingress or egress was over the account limit
+
+	lock                         sync.Mutex
+	fraction                     float64
+	knownLimitBytesPerSecond     float64 // zero if the limit is only learnt from the 503s
+	estimatedLimitBytesPerSecond float64 // zero while the limit is unknown
+	lastEstimateTime             time.Time
+	samples                      []float64 // throughput of the last few tuning intervals, in bytes per second
+	limiter                      *tokenBucketPacer
+	logger                       common.ILogger
+	done                         chan struct{}
+}
+
+func newAccountCapacityPacer(inner pacer) *accountCapacityPacer {
+	return &accountCapacityPacer{inner: inner}
+}
+
+// enable starts holding the job to the given fraction of the account limit. Calls while it's enabled have no effect
+func (a *accountCapacityPacer) enable(fraction float64, logger common.ILogger) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.isEnabled() {
+		return
+	}
+
+	a.fraction = fraction
+	a.logger = logger
+	a.estimatedLimitBytesPerSecond = 0
+	a.lastEstimateTime = time.Time{}
+	a.samples = nil
+	if raw := common.GetLifecycleMgr().GetEnvironmentVariable(common.EEnvironmentVariable.AccountThroughputLimitMbps()); raw != "" {
+		if mbps, err := strconv.ParseUint(raw, 10, 32); err != nil || mbps == 0 {
+			logger.Log(pipeline.LogWarning, fmt.Sprintf("%s: ignoring invalid %s '%s'", accountCapacityPacerString, common.EEnvironmentVariable.AccountThroughputLimitMbps().Name, raw))
+		} else {
+			a.knownLimitBytesPerSecond = float64(mbps) * 1000 * 1000 / 8
+			a.estimatedLimitBytesPerSecond = a.knownLimitBytesPerSecond
+		}
+	}
+	a.limiter = newTokenBucketPacer(a.targetBytesPerSecond(), 0)
+	a.done = make(chan struct{})
+	logger.Log(pipeline.LogInfo, fmt.Sprintf("%s: keeping throughput under %.0f%% of the account limit. Target Mbps %d",
+		accountCapacityPacerString, fraction*100, a.limiter.targetBytesPerSecond()*8/(1000*1000)))
+
+	atomic.StoreInt32(&a.atomicEnabled, 1)
+	go a.tunerBody(a.done)
+}
+
+func (a *accountCapacityPacer) isEnabled() bool {
+	return a != nil && atomic.LoadInt32(&a.atomicEnabled) == 1
+}
+
+// recordLimitSignal records a 503 which said that ingress or egress was over the account limit
+func (a *accountCapacityPacer) recordLimitSignal() {
+	if a.isEnabled() {
+		atomic.AddInt32(&a.atomicLimitSignals, 1)
+	}
+}
+
+func (a *accountCapacityPacer) RequestTrafficAllocation(ctx context.Context, byteCount int64) error {
+	if a.isEnabled() {
+		if err := a.limiter.RequestTrafficAllocation(ctx, byteCount); err != nil {
+			return err
+		}
+		if err := a.inner.RequestTrafficAllocation(ctx, byteCount); err != nil {
+			a.limiter.UndoRequest(byteCount)
+			return err
+		}
+		atomic.AddInt64(&a.atomicTraffic, byteCount)
+		return nil
+	}
+	return a.inner.RequestTrafficAllocation(ctx, byteCount)
+}
+
+func (a *accountCapacityPacer) UndoRequest(byteCount int64) {
+	if a.isEnabled() && byteCount > 0 {
+		a.limiter.UndoRequest(byteCount)
+		atomic.AddInt64(&a.atomicTraffic, -byteCount)
+	}
+	a.inner.UndoRequest(byteCount)
+}
+
+// Close stops the tuning, at the end of the job. The inner pacer is shared by all jobs, so it is left open
+func (a *accountCapacityPacer) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !a.isEnabled() {
+		return nil
+	}
+	atomic.StoreInt32(&a.atomicEnabled, 0)
+	close(a.done)
+	return a.limiter.Close()
+}
+
+// tunerBody tunes until done is closed. It's given its own, since a resumed job makes a new one
+func (a *accountCapacityPacer) tunerBody(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(tuningIntervalDuration):
+			// continue looping
+		}
+
+		bytesPerSecond := float64(atomic.SwapInt64(&a.atomicTraffic, 0)) / tuningIntervalDuration.Seconds()
+		throttled := atomic.SwapInt32(&a.atomicLimitSignals, 0) > 0
+		a.adjust(bytesPerSecond, throttled, time.Now())
+	}
+}
+
+// adjust records the throughput of the tuning interval that has just completed, and re-evaluates the estimated
+// limit of the account, and so the target rate
+func (a *accountCapacityPacer) adjust(bytesPerSecond float64, throttled bool, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.samples = append(a.samples, bytesPerSecond)
+	if len(a.samples) > accountCapacityWindowSize {
+		a.samples = a.samples[1:]
+	}
+
+	switch {
+	case throttled:
+		if now.Sub(a.lastEstimateTime) < deadBandDuration {
+			return // the 503s in flight when we last reacted are still coming back, so don't overreact
+		}
+		average := 0.0
+		for _, s := range a.samples {
+			average += s
+		}
+		average /= float64(len(a.samples))
+		if average <= 0 {
+			return // nothing of ours is going through this pacer, so it can't tell us anything about the limit
+		}
+		if a.estimatedLimitBytesPerSecond == 0 {
+			a.estimatedLimitBytesPerSecond = average
+		} else if average < a.estimatedLimitBytesPerSecond {
+			// the estimate is only lowered part of the way, since a window of throughput is a rough measure of the limit
+			a.estimatedLimitBytesPerSecond += (average - a.estimatedLimitBytesPerSecond) * accountCapacitySmoothing
+		}
+		if a.knownLimitBytesPerSecond > 0 && a.estimatedLimitBytesPerSecond > a.knownLimitBytesPerSecond {
+			a.estimatedLimitBytesPerSecond = a.knownLimitBytesPerSecond
+		}
+		a.lastEstimateTime = now
+		a.limiter.setTargetBytesPerSecond(a.targetBytesPerSecond())
+		a.logger.Log(pipeline.LogWarning, fmt.Sprintf("%s: the account is over its throughput limit at %d Mbps from this job. Target Mbps %d",
+			accountCapacityPacerString, int64(average*8/(1000*1000)), a.limiter.targetBytesPerSecond()*8/(1000*1000)))
+	case a.estimatedLimitBytesPerSecond > 0 && now.Sub(a.lastEstimateTime) >= accountCapacityHoldDuration:
+		// other traffic on the account may have gone away, so let the estimate creep back up
+		a.estimatedLimitBytesPerSecond *= 1 + stableZoneFactor
+		if a.knownLimitBytesPerSecond > 0 && a.estimatedLimitBytesPerSecond > a.knownLimitBytesPerSecond {
+			a.estimatedLimitBytesPerSecond = a.knownLimitBytesPerSecond
+		}
+		a.limiter.setTargetBytesPerSecond(a.targetBytesPerSecond())
+	}
+}
+
+// targetBytesPerSecond is the fraction of the estimated limit, or no real limit at all if the limit is not known yet
+func (a *accountCapacityPacer) targetBytesPerSecond() int64 {
+	target := a.fraction * a.estimatedLimitBytesPerSecond
+	if target <= 0 || target > maxPacerBytesPerSecond {
+		return maxPacerBytesPerSecond
+	}
+	return int64(target)
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long a chunk that was turned away, because its account was at its limit, waits before going back into the queue
+const accountLimitRetryDelay = 100 * time.Millisecond
+
+// accountConcurrencyLimiter limits how many main pool workers may be working on any one storage account at a time.
+// Chunks for an account that is at its limit are not run, but put back into the queue, so that they don't tie up workers
+// that could be making progress on other accounts.  A nil accountConcurrencyLimiter places no limit.
+type accountConcurrencyLimiter struct {
+	limit    int
+	lock     sync.Mutex
+	inFlight map[string]int
+}
+
+// newAccountConcurrencyLimiter returns nil if limit is zero, since no limiting is required
+func newAccountConcurrencyLimiter(limit int) *accountConcurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &accountConcurrencyLimiter{
+		limit:    limit,
+		inFlight: make(map[string]int),
+	}
+}
+
+func (l *accountConcurrencyLimiter) tryAcquire(account string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight[account] >= l.limit {
+		return false
+	}
+	l.inFlight[account]++
+	return true
+}
+
+func (l *accountConcurrencyLimiter) release(account string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight[account]--
+	if l.inFlight[account] <= 0 {
+		delete(l.inFlight, account) // so that the map doesn't grow with every account we've ever seen
+	}
+}
+
+// limitChunkFunc wraps f so that it only runs when its account is under the limit. When the account is at its limit,
+// the wrapped func returns at once, and gives itself to reschedule after a short delay.
+// Empty account names (e.g. of local files) are never limited.
+func (l *accountConcurrencyLimiter) limitChunkFunc(account string, f chunkFunc, reschedule func(chunkFunc)) chunkFunc {
+	if l == nil || account == "" {
+		return f
+	}
+
+	var limited chunkFunc
+	limited = func(workerID int) {
+		if !l.tryAcquire(account) {
+			time.AfterFunc(accountLimitRetryDelay, func() { reschedule(limited) })
+			return
+		}
+		defer l.release(account)
+		f(workerID)
+	}
+	return limited
+}
+
+// accountOfURL returns the name by which we limit the concurrency of requests to the given URL,
+// which is its host, since that identifies the storage account
+func accountOfURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,142 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// The detector pauses the job once this many failover-like errors have been seen within the window.
+// One or two of them can just be a blip, but during a failover every request fails the same way,
+// and carrying on would only turn the rest of the job into thousands of confusing failures.
+const accountFailoverErrorThreshold = 10
+const accountFailoverWindow = 2 * time.Minute
+
+// words that appear in the error codes with which the service refuses requests while the account is failing over
+var accountFailoverSignatures = []string{"failover", "failedover", "failingover"}
+
+// isAccountFailoverError returns true if the service says that the request failed because the account is failing over.
+// Only the error code is looked at: the message of an error includes the URL, whose account, container or blob name
+// could just as well contain the word. DNS failures aren't counted either, as they are far more often something else.
+func isAccountFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	serviceCode, _, _ := ErrorEx{err}.ErrorCodeAndString()
+	if serviceCode == "" {
+		if respErr, ok := err.(hasResponse); ok && respErr.Response() != nil {
+			serviceCode = respErr.Response().Header.Get("x-ms-error-code")
+		}
+	}
+
+	code := strings.ToLower(serviceCode)
+	for _, signature := range accountFailoverSignatures {
+		if strings.Contains(code, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountFailoverDetector counts failover-like errors across all the transfers of a job,
+// and says when there are enough of them to conclude that the account is failing over
+type accountFailoverDetector struct {
+	lock       sync.Mutex
+	errorTimes []time.Time
+	triggered  bool
+}
+
+func newAccountFailoverDetector() *accountFailoverDetector {
+	return &accountFailoverDetector{}
+}
+
+// recordError returns true exactly once: when the error tips the job over the threshold
+func (d *accountFailoverDetector) recordError(err error, now time.Time) bool {
+	if d == nil || !isAccountFailoverError(err) {
+		return false
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.triggered {
+		return false
+	}
+
+	// forget the errors which are outside the window
+	recent := d.errorTimes[:0]
+	for _, t := range d.errorTimes {
+		if now.Sub(t) < accountFailoverWindow {
+			recent = append(recent, t)
+		}
+	}
+	d.errorTimes = append(recent, now)
+
+	if len(d.errorTimes) >= accountFailoverErrorThreshold {
+		d.triggered = true
+		return true
+	}
+	return false
+}
+
+// pauseJobForAccountFailover pauses the job, and records why, so that resuming it re-validates the sources
+func pauseJobForAccountFailover(jobID common.JobID) {
+	if jm, found := JobsAdmin.JobMgr(jobID); found {
+		if jpm, found := jm.JobPartMgr(0); found {
+			jpm.Plan().PausedForAccountFailover = true
+		}
+		if jm.ShouldLog(pipeline.LogWarning) {
+			jm.Log(pipeline.LogWarning, fmt.Sprintf("JobID=%v is being paused, as the errors indicate that the account is failing over", jobID))
+		}
+	}
+	CancelPauseJobOrder(jobID, common.EJobStatus.Paused())
+}
+
+// revalidateSourcesAfterAccountFailover turns on the source change validation of all the parts of a job that was paused
+// for a failover, and has every transfer whose source ETag was recorded check it before the transfer completes, downloads included.
+// Writes which were not yet replicated are lost in a failover, so the sources may no longer be what was enumerated.
+func revalidateSourcesAfterAccountFailover(jm IJobMgr) {
+	jpm0, found := jm.JobPartMgr(0)
+	if !found || !jpm0.Plan().PausedForAccountFailover {
+		return
+	}
+
+	for p := PartNumber(0); true; p++ {
+		jpm, found := jm.JobPartMgr(p)
+		if !found {
+			break
+		}
+		jpm.Plan().S2SSourceChangeValidation = true
+		jpm.(*jobPartMgr).revalidateSourceETags = true
+	}
+	jpm0.Plan().PausedForAccountFailover = false
+
+	if jm.ShouldLog(pipeline.LogInfo) {
+		jm.Log(pipeline.LogInfo, "The job was paused during an account failover, so the sources are checked for changes before they are transferred")
+	}
+}
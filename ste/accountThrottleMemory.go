@@ -0,0 +1,266 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+const (
+	// the longest we'll hold off an account for, whatever it asks, so that a bad header can't stall a job indefinitely
+	maxHonouredRetryAfter = 2 * time.Minute
+
+	// the least time between the starts of requests to an account on each connection, once it has throttled us.
+	// Between the starts of requests on all the connections, the least time is this divided by the number of requests in flight
+	initialThrottleSpacing = 10 * time.Millisecond
+	maxThrottleSpacing     = 500 * time.Millisecond
+
+	// the requests in flight when an account throttles us tend to come back throttled together,
+	// so the spacing is only increased once in this time
+	throttleSpacingIncreaseInterval = time.Second
+
+	// the spacing is halved each time this passes without the account throttling us
+	throttleSpacingDecayInterval = 5 * time.Second
+)
+
+// accountThrottleMemory remembers, for each account (i.e. host), that it has recently throttled us, and for how long it asked
+// us to back off, in Retry-After or x-ms-retry-after-ms. Every request to the account waits for that, not just the one that
+// was throttled, and, while the account is throttling, the requests to it are spaced out, so that each transfer doesn't have
+// to find out for itself with a 429 or 503 of its own. The spacing is relaxed again when the account stops throttling.
+// The spacing is that of each connection, so the more requests there are in flight to the account, the closer together
+// their starts are. Otherwise a job with hundreds of connections would be slowed to a few requests per second.
+type accountThrottleMemory struct {
+	lock     sync.Mutex
+	now      func() time.Time
+	log      func(string)
+	accounts map[string]*accountThrottleState
+	inFlight map[string]int // the requests to each account that have been given their turn, and haven't finished
+}
+
+type accountThrottleState struct {
+	holdUntil    time.Time     // no request starts before this, as the account asked
+	spacing      time.Duration // the least time between the starts of requests
+	nextStart    time.Time     // when the next request may start, given the spacing
+	lastThrottle time.Time
+	lastIncrease time.Time
+	lastDecay    time.Time
+}
+
+func newAccountThrottleMemory(now func() time.Time, log func(string)) *accountThrottleMemory {
+	return &accountThrottleMemory{
+		now:      now,
+		log:      log,
+		accounts: make(map[string]*accountThrottleState),
+		inFlight: make(map[string]int),
+	}
+}
+
+// recordThrottle records a 429 or 503 from the account, with the time it asked us to wait, if it gave one
+func (m *accountThrottleMemory) recordThrottle(account string, retryAfter time.Duration) {
+	account = strings.ToLower(account)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	state, ok := m.accounts[account]
+	if !ok {
+		state = &accountThrottleState{}
+		m.accounts[account] = state
+		if m.log != nil {
+			m.log(fmt.Sprintf("%s is throttling requests, so requests to it will be spaced out until it stops", account))
+		}
+	}
+
+	if retryAfter > maxHonouredRetryAfter {
+		retryAfter = maxHonouredRetryAfter
+	}
+	if until := now.Add(retryAfter); retryAfter > 0 && until.After(state.holdUntil) {
+		state.holdUntil = until
+	}
+
+	if now.Sub(state.lastIncrease) >= throttleSpacingIncreaseInterval {
+		state.spacing *= 2
+		if state.spacing < initialThrottleSpacing {
+			state.spacing = initialThrottleSpacing
+		}
+		if state.spacing > maxThrottleSpacing {
+			state.spacing = maxThrottleSpacing
+		}
+		state.lastIncrease = now
+	}
+	state.lastThrottle = now
+}
+
+// reserve returns how long a request to the account must wait before it starts. The request is given the next start time,
+// so callers must start their request after waiting, and call finish when it's done
+func (m *accountThrottleMemory) reserve(account string) time.Duration {
+	account = strings.ToLower(account)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.inFlight[account]++
+	state, ok := m.accounts[account]
+	if !ok {
+		return 0 // the usual case, for accounts that aren't throttling us
+	}
+
+	now := m.now()
+	lastChange := state.lastThrottle
+	if state.lastDecay.After(lastChange) {
+		lastChange = state.lastDecay
+	}
+	if state.spacing > 0 && now.Sub(lastChange) >= throttleSpacingDecayInterval {
+		state.spacing /= 2
+		if state.spacing < initialThrottleSpacing {
+			state.spacing = 0
+		}
+		state.lastDecay = now
+	}
+	if state.spacing == 0 && !now.Before(state.holdUntil) {
+		delete(m.accounts, account) // the account has recovered, so forget it
+		return 0
+	}
+
+	start := now
+	if state.holdUntil.After(start) {
+		start = state.holdUntil
+	}
+	if state.nextStart.After(start) {
+		start = state.nextStart
+	}
+	state.nextStart = start.Add(state.spacing / time.Duration(m.inFlight[account]))
+	return start.Sub(now)
+}
+
+// finish records that a request that was given its turn by reserve is done
+func (m *accountThrottleMemory) finish(account string) {
+	account = strings.ToLower(account)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.inFlight[account] <= 1 {
+		delete(m.inFlight, account)
+	} else {
+		m.inFlight[account]--
+	}
+}
+
+// wait waits for the turn of a request to the account, unless the context is canceled first
+func (m *accountThrottleMemory) wait(ctx context.Context, account string) error {
+	delay := m.reserve(account)
+	if delay <= 0 {
+		return nil
+	}
+	logf("Waiting %v for throttled account %s\n", delay, account)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		m.finish(account) // it never started
+		return ctx.Err()
+	}
+}
+
+// recordResponse records that a try, which waited its turn with wait, is done, and whether its response says the account
+// is throttling us. It returns how long the account asked us to wait. Storage errors hold their response, so the error is checked too
+func (m *accountThrottleMemory) recordResponse(account string, response pipeline.Response, err error) time.Duration {
+	m.finish(account)
+
+	var resp *http.Response
+	if response != nil {
+		resp = response.Response()
+	}
+	if respErr, ok := err.(interface{ Response() *http.Response }); ok && resp == nil {
+		resp = respErr.Response()
+	}
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0
+	}
+
+	retryAfter := parseRetryAfter(resp.Header, m.now())
+	m.recordThrottle(account, retryAfter)
+	return retryAfter
+}
+
+// parseRetryAfter returns how long the server asked us to wait before retrying, or zero if it didn't say.
+// Azure services give it in milliseconds in x-ms-retry-after-ms or retry-after-ms, and others in Retry-After, as seconds or as a date
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	for _, name := range []string{"x-ms-retry-after-ms", "retry-after-ms"} {
+		if ms, err := strconv.ParseInt(strings.TrimSpace(header.Get(name)), 10, 64); err == nil && ms > 0 {
+			if ms > int64(maxHonouredRetryAfter/time.Millisecond) {
+				return maxHonouredRetryAfter // and so can't overflow
+			}
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		if seconds > int64(maxHonouredRetryAfter/time.Second) {
+			return maxHonouredRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// the memory is shared by all pipelines, so that all the transfers to an account, in all jobs, pace themselves together
+var sharedAccountThrottleMemory = newAccountThrottleMemory(time.Now, func(msg string) {
+	if JobsAdmin != nil {
+		JobsAdmin.LogToJobLog(msg)
+	}
+})
+
+// newAccountThrottlePolicyFactory makes each try of a request wait its turn at an account that is throttling us, and records
+// whether it was throttled. It's for the pipelines whose retry policy isn't ours, i.e. those of Azure Files, so that their
+// transfers pace themselves along with the others to the account. It must come after the retry policy, so that it sees each try
+func newAccountThrottlePolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			account := request.URL.Host
+			if err := sharedAccountThrottleMemory.wait(ctx, account); err != nil {
+				return nil, err
+			}
+			response, err := next.Do(ctx, request)
+			sharedAccountThrottleMemory.recordResponse(account, response, err)
+			return response, err
+		}
+	})
+}
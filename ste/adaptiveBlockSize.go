@@ -0,0 +1,94 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// When the user hasn't given a block size, we choose one for each file, since no single size suits both
+// small files and very large ones, nor both fast, high-latency links and slow ones.
+const (
+	// we'd like the latency of each request to be no more than a fifth of the time it takes to send the block
+	blockTimeToLatencyRatio = 4
+
+	// but we don't grow blocks past this to hide latency, since bigger blocks use more RAM, and lose more progress when they have to be retried
+	maxLatencyHidingBlockSize = 64 * 1024 * 1024
+
+	// on slow links, we shrink blocks so that they don't take more than this to send, for the same reasons
+	maxBlockSendTime = 20 * time.Second
+
+	minAdaptiveBlockSize = 1024 * 1024
+)
+
+// chooseBlockSize picks the block size for a file, based on its size and (if they have been measured yet) on the latency of
+// requests and the throughput of each connection.  The reason explains the choice, for the log
+func chooseBlockSize(fileSize int64, latency time.Duration, bytesPerSecondPerConnection float64) (blockSize uint32, reason string) {
+	// start with the smallest size, from our usual default upwards, that keeps the number of blocks per blob within the limit
+	size := int64(common.DefaultBlockBlobBlockSize)
+	for ; fileSize/size > common.MaxNumberOfBlocksPerBlob; size = 2 * size {
+	}
+	reason = "based on the file size"
+
+	if latency > 0 && bytesPerSecondPerConnection > 0 {
+		rate := fmt.Sprintf("%.2f MB/s per connection", bytesPerSecondPerConnection/(1000*1000))
+
+		latencyHidingSize := int64(bytesPerSecondPerConnection * latency.Seconds() * blockTimeToLatencyRatio)
+		slowLinkSize := int64(bytesPerSecondPerConnection * maxBlockSendTime.Seconds())
+
+		if latencyHidingSize > size {
+			if bigger := minInt64(roundUpToPowerOfTwoMiB(latencyHidingSize), maxLatencyHidingBlockSize); bigger > size {
+				size = bigger
+				reason = fmt.Sprintf("so that the measured request latency of %v is small compared to the time to send each block at %s", latency, rate)
+			}
+		} else if slowLinkSize < size {
+			smaller := roundDownToPowerOfTwoMiB(slowLinkSize)
+			if fileSize/smaller <= common.MaxNumberOfBlocksPerBlob {
+				size = smaller
+				reason = fmt.Sprintf("so that each block takes no more than %v to send at the measured %s", maxBlockSendTime, rate)
+			}
+		}
+	}
+
+	if size > common.MaxBlockBlobBlockSize {
+		size = common.MaxBlockBlobBlockSize
+	}
+	return uint32(size), reason
+}
+
+func roundUpToPowerOfTwoMiB(n int64) int64 {
+	p := int64(minAdaptiveBlockSize)
+	for p < n {
+		p *= 2
+	}
+	return p
+}
+
+func roundDownToPowerOfTwoMiB(n int64) int64 {
+	p := int64(minAdaptiveBlockSize)
+	for p*2 <= n {
+		p *= 2
+	}
+	return p
+}
@@ -0,0 +1,119 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// appendOnlyJSONFile appends values to a file as lines of JSON, for records that are kept as the job runs.
+// Every line goes straight to the file, so that the file is complete up to the moment AzCopy stops, however it stops
+type appendOnlyJSONFile struct {
+	path        string
+	description string // what the file is, for the job log
+	logger      common.ILogger
+
+	atomicEnabled int32
+	lock          sync.Mutex
+	file          *os.File
+	failed        bool // so that a file we can't write to is only reported once
+}
+
+func newAppendOnlyJSONFile(path, description string, logger common.ILogger) *appendOnlyJSONFile {
+	return &appendOnlyJSONFile{path: path, description: description, logger: logger}
+}
+
+// enable opens the file, if that has not already been done. The file is only ever appended to,
+// so a resumed job adds to what its earlier runs recorded
+func (f *appendOnlyJSONFile) enable() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file != nil || f.failed {
+		return
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		f.reportFailure(err)
+		return
+	}
+	f.file = file
+	atomic.StoreInt32(&f.atomicEnabled, 1)
+}
+
+func (f *appendOnlyJSONFile) isEnabled() bool {
+	return atomic.LoadInt32(&f.atomicEnabled) == 1
+}
+
+func (f *appendOnlyJSONFile) append(value interface{}) {
+	if !f.isEnabled() {
+		return
+	}
+	line, err := json.Marshal(value)
+	if err != nil {
+		panic(err) // the values are our own structs, which can always be marshalled
+	}
+	line = append(line, '\n')
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return
+	}
+	if _, err = f.file.Write(line); err != nil {
+		f.reportFailure(err)
+	}
+}
+
+// reportFailure logs that the file is incomplete. The transfers themselves carry on, since they are fine,
+// but the job log makes it clear that the file can't be relied on. Must be called with the lock held
+func (f *appendOnlyJSONFile) reportFailure(err error) {
+	if !f.failed {
+		f.failed = true
+		f.logger.Log(pipeline.LogError, fmt.Sprintf("The %s %s is incomplete, because it could not be written to: %v", f.description, f.path, err))
+	}
+}
+
+// hasFailed tells whether anything could not be written
+func (f *appendOnlyJSONFile) hasFailed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.failed
+}
+
+func (f *appendOnlyJSONFile) Close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file != nil {
+		_ = f.file.Sync()
+		_ = f.file.Close()
+		f.file = nil
+	}
+	atomic.StoreInt32(&f.atomicEnabled, 0)
+}
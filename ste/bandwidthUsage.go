@@ -0,0 +1,385 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const (
+	// how often the bytes counted by a job are added to the bandwidth usage file, and what other jobs have used today is re-read from it
+	bandwidthUsageFlushInterval = time.Minute
+
+	// how often chunks that are held back by the daily cap check whether they can go, e.g. because the day is over
+	dailyCapPollInterval = 10 * time.Second
+
+	// once the bandwidth usage file gets this big, its records are added up, so that there's one per job per day
+	maxBandwidthUsageFileSize = 4 * 1024 * 1024
+
+	dailyCapString = "Daily cap"
+)
+
+// bandwidthMeter counts the bytes that a job sends and receives over the network, and adds them to the bandwidth usage
+// of the machine, which is kept per job and per calendar day. Several jobs, in several copies of AzCopy, may be doing that at
+// the same time, so each one only ever appends what it has counted since it last did so.
+// If the job has a daily cap, the meter also holds back new chunks while the bytes used today, by all the jobs, are over the cap.
+// Until it is enabled, the meter counts, but doesn't record anything or hold anything back
+type bandwidthMeter struct {
+	atomicSent     int64 // since the last flush
+	atomicReceived int64 // since the last flush
+	atomicEnabled  int32
+
+	lock            sync.Mutex
+	path            string
+	jobID           common.JobID
+	capBytes        uint64
+	date            string // the day that usedTodayBefore is for
+	usedTodayBefore uint64 // what the file said had been used today, when it was last read
+	pausedDate      string // the day on which we last logged that the cap had been reached
+	logger          common.ILogger
+	stopFlushing    chan struct{}
+	now             func() time.Time
+}
+
+func newBandwidthMeter() *bandwidthMeter {
+	return &bandwidthMeter{now: time.Now}
+}
+
+// enable starts recording the bytes in the given file, and holding back chunks once capBytes (if non-zero) have been used in the day.
+// Only the first call has any effect
+func (b *bandwidthMeter) enable(jobID common.JobID, path string, capBytes uint64, logger common.ILogger) {
+	b.lock.Lock()
+	if b.isEnabled() {
+		b.lock.Unlock()
+		return
+	}
+	b.jobID = jobID
+	b.path = path
+	b.capBytes = capBytes
+	b.logger = logger
+	b.refreshUsedToday()
+	atomic.StoreInt32(&b.atomicEnabled, 1)
+	b.lock.Unlock()
+
+	if capBytes > 0 {
+		logger.Log(pipeline.LogInfo, fmt.Sprintf("%s: no new chunks will be scheduled once %d bytes have been sent and received today. Used so far today: %d bytes",
+			dailyCapString, capBytes, b.usedToday()))
+	}
+	b.stopFlushing = make(chan struct{})
+	go b.flushPeriodically(b.stopFlushing)
+}
+
+func (b *bandwidthMeter) flushPeriodically(stop <-chan struct{}) {
+	ticker := time.NewTicker(bandwidthUsageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			b.flush()
+		}
+	}
+}
+
+// stop records what has been counted so far, and stops recording, when the job ends. The meter can be enabled again,
+// e.g. when the job is resumed in the same process
+func (b *bandwidthMeter) stop() {
+	b.flush()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.isEnabled() {
+		close(b.stopFlushing)
+		atomic.StoreInt32(&b.atomicEnabled, 0)
+	}
+}
+
+func (b *bandwidthMeter) isEnabled() bool {
+	return atomic.LoadInt32(&b.atomicEnabled) == 1
+}
+
+// recordRequest counts the body of the request as sent, and wraps the body of the response, so that it's counted
+// as received as it's read. Every try of a request is counted, since retries use the link as much as anything else
+func (b *bandwidthMeter) recordRequest(request pipeline.Request, resp pipeline.Response) {
+	if request.ContentLength > 0 {
+		atomic.AddInt64(&b.atomicSent, request.ContentLength)
+	}
+	if resp == nil {
+		return
+	}
+	if rr := resp.Response(); rr != nil && rr.Body != nil && rr.Body != http.NoBody {
+		rr.Body = &bandwidthCountingBody{ReadCloser: rr.Body, meter: b}
+	}
+}
+
+// jobBandwidthMeter returns the meter of the job that the transfer is part of, or nil if there isn't one (e.g. in tests)
+func jobBandwidthMeter(jptm IJobPartTransferMgr) *bandwidthMeter {
+	if t, ok := jptm.(*jobPartTransferMgr); ok {
+		if jpm, ok := t.jobPartMgr.(*jobPartMgr); ok && jpm.jobMgr != nil {
+			return jpm.jobMgr.PipelineNetworkStats().bandwidth
+		}
+	}
+	return nil
+}
+
+// recordSent and recordReceived count bytes that didn't go through a pipeline, i.e. those of SFTP servers.
+// The meter may be nil, for transfers that aren't part of a job
+func (b *bandwidthMeter) recordSent(n int) {
+	if b != nil && n > 0 {
+		atomic.AddInt64(&b.atomicSent, int64(n))
+	}
+}
+
+func (b *bandwidthMeter) recordReceived(n int) {
+	if b != nil && n > 0 {
+		atomic.AddInt64(&b.atomicReceived, int64(n))
+	}
+}
+
+// bandwidthCountingBody counts the bytes of a response body as they're read
+type bandwidthCountingBody struct {
+	io.ReadCloser
+	meter *bandwidthMeter
+}
+
+func (c *bandwidthCountingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.meter.atomicReceived, int64(n))
+	return n, err
+}
+
+// flush appends what has been counted since the last flush to the file, and re-reads what all the jobs have used today.
+// Failing to record the usage doesn't affect the job, so it's only logged, and the bytes are kept for the next flush
+func (b *bandwidthMeter) flush() {
+	if !b.isEnabled() {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	sent := atomic.LoadInt64(&b.atomicSent)
+	received := atomic.LoadInt64(&b.atomicReceived)
+	if sent == 0 && received == 0 {
+		b.refreshUsedToday()
+		return
+	}
+
+	record := common.BandwidthUsageRecord{Date: common.BandwidthUsageDate(b.now()), JobID: b.jobID, BytesSent: uint64(sent), BytesReceived: uint64(received)}
+	if err := appendBandwidthUsageRecord(b.path, record); err != nil {
+		b.logger.Log(pipeline.LogWarning, fmt.Sprintf("Failed to record the bandwidth used by the job: %v", err))
+		return
+	}
+
+	// re-read what's been used before taking the bytes off the counters, so that usedToday may briefly count them twice, but never misses them
+	b.refreshUsedToday()
+	atomic.AddInt64(&b.atomicSent, -sent)
+	atomic.AddInt64(&b.atomicReceived, -received)
+}
+
+// refreshUsedToday reads what has been recorded for today. The caller must hold the lock
+func (b *bandwidthMeter) refreshUsedToday() {
+	today := common.BandwidthUsageDate(b.now())
+	records, err := readBandwidthUsageFile(b.path)
+	if err != nil {
+		if b.logger != nil {
+			b.logger.Log(pipeline.LogWarning, fmt.Sprintf("Failed to read the bandwidth used today: %v", err))
+		}
+		return // keep what we had, so that a file that can't be read doesn't lift the cap
+	}
+
+	used := uint64(0)
+	for _, r := range records {
+		if r.Date == today {
+			used += r.Total()
+		}
+	}
+	b.date = today
+	b.usedTodayBefore = used
+}
+
+// usedToday is the number of bytes sent and received today, by this job and by those that recorded their usage before the file was last read
+func (b *bandwidthMeter) usedToday() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if today := common.BandwidthUsageDate(b.now()); today != b.date {
+		// a new day has started since the file was last read, so nothing has been recorded for it yet
+		b.date = today
+		b.usedTodayBefore = 0
+	}
+	return b.usedTodayBefore + uint64(atomic.LoadInt64(&b.atomicSent)+atomic.LoadInt64(&b.atomicReceived))
+}
+
+// overCap says whether the bytes used today have reached the cap, and logs it, once a day, when they have
+func (b *bandwidthMeter) overCap() bool {
+	if !b.isEnabled() || b.capBytes == 0 {
+		return false
+	}
+	used := b.usedToday()
+	if used < b.capBytes {
+		return false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.pausedDate != b.date {
+		b.pausedDate = b.date
+		b.logger.Log(pipeline.LogWarning, fmt.Sprintf("%s: %d bytes have been sent and received today, which is over the cap of %d bytes. "+
+			"No new chunks will be scheduled until %s", dailyCapString, used, b.capBytes, common.NextBandwidthUsageDay(b.now()).Format(time.RFC3339)))
+	}
+	return true
+}
+
+// waitForBudget returns once the bytes used today are under the cap (which may not be until the next day), or the context is done
+func (b *bandwidthMeter) waitForBudget(ctx context.Context) {
+	for b.overCap() {
+		wait := common.NextBandwidthUsageDay(b.now()).Sub(b.now())
+		if wait > dailyCapPollInterval {
+			wait = dailyCapPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// appendBandwidthUsageRecord appends the record to the file, as a line of JSON, and compacts the file when it gets too big
+func appendBandwidthUsageRecord(path string, record common.BandwidthUsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockSharedFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	info, statErr := file.Stat()
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+
+	if statErr == nil && info.Size() > maxBandwidthUsageFileSize {
+		return compactBandwidthUsageFile(path)
+	}
+	return nil
+}
+
+// compactBandwidthUsageFile adds up the records, so that there's one for each job on each day. If the file is still too big
+// after that, the older half of the records are dropped. The caller must hold the lock on the file
+func compactBandwidthUsageFile(path string) error {
+	records, err := readBandwidthUsageFile(path)
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		date  string
+		jobID common.JobID
+	}
+	index := make(map[key]int)
+	compacted := make([]common.BandwidthUsageRecord, 0)
+	for _, r := range records {
+		k := key{r.Date, r.JobID}
+		if i, ok := index[k]; ok {
+			compacted[i].BytesSent += r.BytesSent
+			compacted[i].BytesReceived += r.BytesReceived
+		} else {
+			index[k] = len(compacted)
+			compacted = append(compacted, r)
+		}
+	}
+
+	data := make([]byte, 0)
+	for _, r := range compacted {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tempPath := path + ".compacting"
+	if err = ioutil.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tempPath, path); err != nil {
+		return err
+	}
+
+	if len(data) > maxBandwidthUsageFileSize {
+		return trimJobStatsFile(path)
+	}
+	return nil
+}
+
+func readBandwidthUsageFile(path string) ([]common.BandwidthUsageRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil // no job has recorded its usage yet
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]common.BandwidthUsageRecord, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record common.BandwidthUsageRecord
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// ReadBandwidthUsage reads the bandwidth used by the jobs that have run on this machine, oldest first.
+// A job that is still running has recorded what it had used as of its last flush.
+// Lines that can't be parsed (e.g. one that was being written when the machine went down) are skipped
+func ReadBandwidthUsage(planFolder string) ([]common.BandwidthUsageRecord, error) {
+	return readBandwidthUsageFile(common.BandwidthUsageFilePath(planFolder))
+}
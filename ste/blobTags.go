@@ -0,0 +1,111 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package ste
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+// the version of the blob SDK that this tree uses predates blob index tags, so they are read and written with requests of our own.
+// Tags came in with the same service version as blob versions
+
+type blobTag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type blobTagSet struct {
+	XMLName xml.Name  `xml:"Tags"`
+	Tags    []blobTag `xml:"TagSet>Tag"`
+}
+
+// blobTagsResponder turns responses that aren't successes into errors, closing their bodies
+var blobTagsResponder = pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+	return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+		response, err := next.Do(ctx, request)
+		if err != nil || response == nil || response.Response() == nil {
+			return response, err
+		}
+		resp := response.Response()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return response, nil
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return response, fmt.Errorf("the service responded with %s (%s)", resp.Status, resp.Header.Get("x-ms-error-code"))
+	}
+})
+
+// getBlobTags returns the index tags of the blob, in the order the service lists them
+func getBlobTags(ctx context.Context, p pipeline.Pipeline, blobURL url.URL) ([]blobTag, error) {
+	request, err := pipeline.NewRequest(http.MethodGet, blobTagsURL(blobURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.Do(WithBlobVersioningServiceVersion(ctx), blobTagsResponder, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Response().Body.Close()
+
+	var tags blobTagSet
+	if err = xml.NewDecoder(response.Response().Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("reading the tags: %v", err)
+	}
+	return tags.Tags, nil
+}
+
+// setBlobTags replaces the index tags of the blob with the given ones
+func setBlobTags(ctx context.Context, p pipeline.Pipeline, blobURL url.URL, tags []blobTag) error {
+	body, err := xml.Marshal(blobTagSet{Tags: tags})
+	if err != nil {
+		return err
+	}
+	request, err := pipeline.NewRequest(http.MethodPut, blobTagsURL(blobURL), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/xml")
+	response, err := p.Do(WithBlobVersioningServiceVersion(ctx), blobTagsResponder, request)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Response().Body)
+	return response.Response().Body.Close()
+}
+
+// blobTagsURL adds comp=tags to the URL, appending it so that a SAS is left exactly as given
+func blobTagsURL(blobURL url.URL) url.URL {
+	if blobURL.RawQuery == "" {
+		blobURL.RawQuery = "comp=tags"
+	} else {
+		blobURL.RawQuery += "&comp=tags"
+	}
+	return blobURL
+}
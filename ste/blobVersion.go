@@ -0,0 +1,85 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+// BlobVersioningServiceVersion is the first service API version that understands blob versions
+const BlobVersioningServiceVersion = "2019-12-12"
+
+const blobVersionIDQueryKey = "versionid"
+
+// WithBlobVersioningServiceVersion returns a context whose requests use a service API version new enough
+// for the service to return the version ID of blobs
+func WithBlobVersioningServiceVersion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ServiceAPIVersionOverride, BlobVersioningServiceVersion)
+}
+
+// GetBlobVersionID returns the version ID of the blob that the response describes,
+// or an empty string if versioning is not enabled on the account
+func GetBlobVersionID(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get("x-ms-version-id")
+}
+
+// addBlobVersionID makes the source URL refer to the given version of the blob
+func addBlobVersionID(source string, versionID string) string {
+	sUrl, err := url.Parse(source)
+	if err != nil {
+		panic(err)
+	}
+	// append rather than re-encode the query, so that the SAS (if any) is left exactly as given
+	versionQuery := blobVersionIDQueryKey + "=" + url.QueryEscape(versionID)
+	if len(sUrl.RawQuery) > 0 {
+		sUrl.RawQuery += "&" + versionQuery
+	} else {
+		sUrl.RawQuery = versionQuery
+	}
+	return sUrl.String()
+}
+
+// requestUsesBlobVersion tells whether the request reads a specific blob version, either directly or as the source of a copy
+func requestUsesBlobVersion(request pipeline.Request) bool {
+	if request.URL.Query().Get(blobVersionIDQueryKey) != "" {
+		return true
+	}
+	if copySource := request.Header.Get("x-ms-copy-source"); copySource != "" {
+		if u, err := url.Parse(copySource); err == nil {
+			return u.Query().Get(blobVersionIDQueryKey) != ""
+		}
+	}
+	return false
+}
+
+// requiresNewerServiceVersion tells whether the given service API version predates blob versioning.
+// Service API versions are dates, so they can be compared as strings
+func requiresNewerServiceVersion(version string) bool {
+	return strings.Compare(version, BlobVersioningServiceVersion) < 0
+}
@@ -25,11 +25,12 @@ import (
 	"log"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 )
 
-// ConfiguredInt is an integer which may be optionally configured by user through an environment variable
+// ConfiguredInt is an integer which may be optionally configured by user through a command-line flag, environment variable or config file
 type ConfiguredInt struct {
 	Value             int
 	IsUserSpecified   bool
@@ -39,27 +40,61 @@ type ConfiguredInt struct {
 
 func (i *ConfiguredInt) GetDescription() string {
 	if i.IsUserSpecified {
-		return fmt.Sprintf("Based on %s environment variable", i.EnvVarName)
+		return fmt.Sprintf("Based on %s", describeTunableSource(i.EnvVarName))
 	} else {
-		return fmt.Sprintf("Based on %s. Set %s environment variable to override", i.DefaultSourceDesc, i.EnvVarName)
+		return fmt.Sprintf("Based on %s. Set %s environment variable, or --%s, to override", i.DefaultSourceDesc, i.EnvVarName,
+			TunableName(common.EnvironmentVariable{Name: i.EnvVarName}))
 	}
 }
 
-// tryNewConfiguredInt populates a ConfiguredInt from an environment variable, or returns nil if env var is not set
+// tryNewConfiguredInt populates a ConfiguredInt from a command-line flag, environment variable or config file
+// (see lookupTunable), or returns nil if none of them sets it
 func tryNewConfiguredInt(envVar common.EnvironmentVariable) *ConfiguredInt {
-	override := common.GetLifecycleMgr().GetEnvironmentVariable(envVar)
+	override := lookupTunable(envVar)
 	if override != "" {
 		val, err := strconv.ParseInt(override, 10, 64)
 		if err != nil {
-			log.Fatalf("error parsing the env %s %q failed with error %v",
-				envVar.Name, override, err)
+			log.Fatalf("error parsing the %s %q failed with error %v",
+				describeTunableSource(envVar.Name), override, err)
 		}
 		return &ConfiguredInt{int(val), true, envVar.Name, ""}
 	}
 	return nil
 }
 
-// ConfiguredBool is a boolean which may be optionally configured by user through an environment variable
+// ConfiguredFloat is a number, which may have a fractional part, that may be optionally configured by the user
+type ConfiguredFloat struct {
+	Value             float64
+	IsUserSpecified   bool
+	EnvVarName        string
+	DefaultSourceDesc string
+}
+
+func (f *ConfiguredFloat) GetDescription() string {
+	if f.IsUserSpecified {
+		return fmt.Sprintf("Based on %s", describeTunableSource(f.EnvVarName))
+	} else {
+		return fmt.Sprintf("Based on %s. Set %s environment variable, or --%s, to override", f.DefaultSourceDesc, f.EnvVarName,
+			TunableName(common.EnvironmentVariable{Name: f.EnvVarName}))
+	}
+}
+
+// tryNewConfiguredFloat populates a ConfiguredFloat from a command-line flag, environment variable or config file
+// (see lookupTunable), or returns nil if none of them sets it
+func tryNewConfiguredFloat(envVar common.EnvironmentVariable) *ConfiguredFloat {
+	override := lookupTunable(envVar)
+	if override != "" {
+		val, err := strconv.ParseFloat(override, 64)
+		if err != nil {
+			log.Fatalf("error parsing the %s %q failed with error %v",
+				describeTunableSource(envVar.Name), override, err)
+		}
+		return &ConfiguredFloat{val, true, envVar.Name, ""}
+	}
+	return nil
+}
+
+// ConfiguredBool is a boolean which may be optionally configured by user through a command-line flag, environment variable or config file
 type ConfiguredBool struct {
 	Value             bool
 	IsUserSpecified   bool
@@ -69,20 +104,22 @@ type ConfiguredBool struct {
 
 func (b *ConfiguredBool) GetDescription() string {
 	if b.IsUserSpecified {
-		return fmt.Sprintf("Based on %s environment variable", b.EnvVarName)
+		return fmt.Sprintf("Based on %s", describeTunableSource(b.EnvVarName))
 	} else {
-		return fmt.Sprintf("Based on %s. Set %s environment variable to true or false override", b.DefaultSourceDesc, b.EnvVarName)
+		return fmt.Sprintf("Based on %s. Set %s environment variable, or --%s, to true or false override", b.DefaultSourceDesc, b.EnvVarName,
+			TunableName(common.EnvironmentVariable{Name: b.EnvVarName}))
 	}
 }
 
-// tryNewConfiguredBool populates a ConfiguredInt from an environment variable, or returns nil if env var is not set
+// tryNewConfiguredBool populates a ConfiguredBool from a command-line flag, environment variable or config file
+// (see lookupTunable), or returns nil if none of them sets it
 func tryNewConfiguredBool(envVar common.EnvironmentVariable) *ConfiguredBool {
-	override := common.GetLifecycleMgr().GetEnvironmentVariable(envVar)
+	override := lookupTunable(envVar)
 	if override != "" {
 		val, err := strconv.ParseBool(override)
 		if err != nil {
-			log.Fatalf("error parsing the env %s %q failed with error %v",
-				envVar.Name, override, err)
+			log.Fatalf("error parsing the %s %q failed with error %v",
+				describeTunableSource(envVar.Name), override, err)
 		}
 		return &ConfiguredBool{bool(val), true, envVar.Name, ""}
 	}
@@ -99,12 +136,38 @@ type ConcurrencySettings struct {
 	// MaxMainPoolSize is a number >= InitialMainPoolSize, representing max size we will grow the main pool to
 	MaxMainPoolSize *ConfiguredInt
 
-	// TransferInitiationPoolSize is the size of the auxiliary goroutine pool that initiates transfers
+	// InitialTransferInitiationPoolSize is the initial size of the auxiliary goroutine pool that initiates transfers
 	// (i.e. creates chunkfuncs)
+	InitialTransferInitiationPoolSize int
+
+	// TransferInitiationPoolSize is a number >= InitialTransferInitiationPoolSize, representing the max size we will
+	// grow the transfer initiation pool to, when jobs turn out to consist mostly of small files
 	TransferInitiationPoolSize *ConfiguredInt
 
+	// EnumerationPoolSize is the number of directories (or virtual directories) that may be listed at the same
+	// time when scanning a source or destination
+	EnumerationPoolSize *ConfiguredInt
+
+	// MaxMainPoolSizePerAccount is the max number of main pool workers that may be working on any one storage account
+	// at a time, so that, in jobs that span several accounts, one throttled account can't occupy the whole main pool.
+	// Zero means no limit
+	MaxMainPoolSizePerAccount *ConfiguredInt
+
+	// MaxSftpConnectionsPerServer is the max number of connections that we open to any one SFTP server.
+	// Chunks for the same server share them, so it caps the concurrency of SFTP reads and writes
+	MaxSftpConnectionsPerServer *ConfiguredInt
+
 	// MaxIdleConnections is the max number of idle TCP connections to keep open
-	MaxIdleConnections int
+	MaxIdleConnections *ConfiguredInt
+
+	// IdleConnectionTimeoutSeconds is how long an idle connection is kept open for reuse
+	IdleConnectionTimeoutSeconds *ConfiguredInt
+
+	// MaxConnectionsPerHost is the max number of connections, active or idle, to any one host. 0 means no limit
+	MaxConnectionsPerHost *ConfiguredInt
+
+	// ExpectContinue says whether requests with bodies wait for the server to accept them before sending the body
+	ExpectContinue *ConfiguredBool
 
 	// MaxOpenFiles is the max number of file handles that we should have open at any time
 	// Currently (July 2019) this is only used for downloads, which is where we wouldn't
@@ -117,6 +180,65 @@ type ConcurrencySettings struct {
 
 	// CheckCpuWhenTuning determines whether CPU usage should be taken into account when auto-tuning
 	CheckCpuWhenTuning *ConfiguredBool
+
+	// AdaptiveMainPool says that the main pool size should keep being tuned for as long as we run, rather than
+	// being tuned once and then left alone
+	AdaptiveMainPool bool
+
+	// SlowStart says that the main pool should start small, and be doubled while there are no retries,
+	// until it reaches the size it would otherwise have had from the start
+	SlowStart *ConfiguredBool
+}
+
+// describe lists the settings, with where their values came from, for recording in the plan files of jobs
+func (c ConcurrencySettings) describe() []common.ConcurrencySetting {
+	setting := func(name string, value string, source string) common.ConcurrencySetting {
+		return common.ConcurrencySetting{Name: name, Value: value, Source: source}
+	}
+
+	mainPoolSize := strconv.Itoa(c.MaxMainPoolSize.Value)
+	if c.AdaptiveMainPool {
+		mainPoolSize = fmt.Sprintf("adaptively tuned from %d, up to %d", c.InitialMainPoolSize, c.MaxMainPoolSize.Value)
+	} else if c.AutoTuneMainPool() {
+		mainPoolSize = fmt.Sprintf("tuned from %d, up to %d", c.InitialMainPoolSize, c.MaxMainPoolSize.Value)
+	}
+
+	settings := []common.ConcurrencySetting{
+		setting("Max concurrent network operations", mainPoolSize, c.MaxMainPoolSize.GetDescription()),
+	}
+	if c.MaxMainPoolSizePerAccount.Value > 0 {
+		settings = append(settings, setting("Max concurrent network operations per storage account",
+			strconv.Itoa(c.MaxMainPoolSizePerAccount.Value), c.MaxMainPoolSizePerAccount.GetDescription()))
+	}
+	if c.InitialMainPoolSize > slowStartInitialConcurrency {
+		settings = append(settings, setting("Slow start of network operations",
+			strconv.FormatBool(c.SlowStart.Value), c.SlowStart.GetDescription()))
+	}
+	if c.AdaptiveMainPool || c.AutoTuneMainPool() {
+		settings = append(settings, setting("Check CPU usage when tuning",
+			strconv.FormatBool(c.CheckCpuWhenTuning.Value), c.CheckCpuWhenTuning.GetDescription()))
+	}
+	initiationPoolSize := strconv.Itoa(c.TransferInitiationPoolSize.Value)
+	if c.AutoScaleTransferInitiationPool() {
+		initiationPoolSize = fmt.Sprintf("scaled from %d, up to %d, by the share of small files", c.InitialTransferInitiationPoolSize, c.TransferInitiationPoolSize.Value)
+	}
+	return append(settings,
+		setting("Max concurrent transfer initiation routines",
+			initiationPoolSize, c.TransferInitiationPoolSize.GetDescription()),
+		setting("Max concurrent directory listings when scanning",
+			strconv.Itoa(c.EnumerationPoolSize.Value), c.EnumerationPoolSize.GetDescription()),
+		setting("Max idle connections",
+			strconv.Itoa(c.MaxIdleConnections.Value), c.MaxIdleConnections.GetDescription()),
+		setting("Idle connection timeout (seconds)",
+			strconv.Itoa(c.IdleConnectionTimeoutSeconds.Value), c.IdleConnectionTimeoutSeconds.GetDescription()),
+		setting("Max connections per host",
+			strconv.Itoa(c.MaxConnectionsPerHost.Value), c.MaxConnectionsPerHost.GetDescription()),
+		setting("Expect 100-continue",
+			strconv.FormatBool(c.ExpectContinue.Value), c.ExpectContinue.GetDescription()),
+		setting("Max connections per SFTP server",
+			strconv.Itoa(c.MaxSftpConnectionsPerServer.Value), c.MaxSftpConnectionsPerServer.GetDescription()),
+		setting("Max open files when downloading",
+			strconv.Itoa(c.MaxOpenDownloadFiles), "auto-computed"))
 }
 
 // AutoTuneMainPool says whether the main pool size should by dynamically tuned
@@ -124,8 +246,21 @@ func (c ConcurrencySettings) AutoTuneMainPool() bool {
 	return c.MaxMainPoolSize.Value > c.InitialMainPoolSize
 }
 
+// AutoScaleTransferInitiationPool says whether the transfer initiation pool should grow when there are many small files
+func (c ConcurrencySettings) AutoScaleTransferInitiationPool() bool {
+	return c.TransferInitiationPoolSize.Value > c.InitialTransferInitiationPoolSize
+}
+
 const defaultTransferInitiationPoolSize = 64
+const maxTransferInitiationPoolSize = 1000 // each routine handles one file at a time, so this is only reached when the main pool is large and the files are tiny
+const defaultEnumerationPoolSize = 16
+const defaultMaxSftpConnectionsPerServer = 10 // since OpenSSH, by default, refuses more than 10 connections that haven't logged in yet
 const concurrentFilesFloor = 32
+const maxTunedMainPoolSize = 3000 // TODO: what should this be?  Testing indicates that this value is all we're ever likely to need, even in small-files cases
+
+// values of AZCOPY_CONCURRENCY_VALUE that ask for tuning, rather than a fixed number
+const concurrencyValueAuto = "AUTO"
+const concurrencyValueAdaptive = "ADAPTIVE"
 
 // NewConcurrencySettings gets concurrency settings by referring to the
 // environment variable AZCOPY_CONCURRENCY_VALUE (if set) and to properties of the
@@ -133,13 +268,26 @@ const concurrentFilesFloor = 32
 func NewConcurrencySettings(maxFileAndSocketHandles int, requestAutoTuneGRs bool) ConcurrencySettings {
 
 	initialMainPoolSize, maxMainPoolSize := getMainPoolSize(runtime.NumCPU(), requestAutoTuneGRs)
+	initialMainPoolSize, maxMainPoolSize = limitMainPoolSizeToMemoryBudget(initialMainPoolSize, maxMainPoolSize, getMemoryBudget())
+
+	enumerationPoolSize := getEnumerationPoolSize()
+	initialTransferInitiationPoolSize, transferInitiationPoolSize := getTransferInitiationPoolSize(maxMainPoolSize.Value)
 
 	s := ConcurrencySettings{
-		InitialMainPoolSize:        initialMainPoolSize,
-		MaxMainPoolSize:            maxMainPoolSize,
-		TransferInitiationPoolSize: getTransferInitiationPoolSize(),
-		MaxOpenDownloadFiles:       getMaxOpenPayloadFiles(maxFileAndSocketHandles, maxMainPoolSize.Value),
-		CheckCpuWhenTuning:          getCheckCpuUsageWhenTuning(),
+		InitialMainPoolSize:               initialMainPoolSize,
+		MaxMainPoolSize:                   maxMainPoolSize,
+		MaxMainPoolSizePerAccount:         getMainPoolSizePerAccount(),
+		MaxSftpConnectionsPerServer:       getMaxSftpConnectionsPerServer(maxMainPoolSize.Value),
+		InitialTransferInitiationPoolSize: initialTransferInitiationPoolSize,
+		TransferInitiationPoolSize:        transferInitiationPoolSize,
+		EnumerationPoolSize:               enumerationPoolSize,
+		MaxOpenDownloadFiles:              getMaxOpenPayloadFiles(maxFileAndSocketHandles, maxMainPoolSize.Value, enumerationPoolSize.Value),
+		CheckCpuWhenTuning:                getCheckCpuUsageWhenTuning(),
+		AdaptiveMainPool:                  isAdaptiveMainPool(requestAutoTuneGRs),
+		SlowStart:                         getSlowStart(),
+		IdleConnectionTimeoutSeconds:      getIdleConnectionTimeoutSeconds(),
+		MaxConnectionsPerHost:             getMaxConnectionsPerHost(),
+		ExpectContinue:                    getExpectContinue(),
 	}
 
 	// Set the max idle connections that we allow. If there are any more idle connections
@@ -156,7 +304,7 @@ func NewConcurrencySettings(maxFileAndSocketHandles int, requestAutoTuneGRs bool
 	// on Windows when this value was set to 500 but there were 1000 to 2000 goroutines in the
 	// main pool size.  Using DialContext appears to mitigate that issue, so the value
 	// we compute here is really just to reduce unneeded make and break of connections)
-	s.MaxIdleConnections = maxMainPoolSize.Value
+	s.MaxIdleConnections = getMaxIdleConnections(maxMainPoolSize.Value)
 
 	return s
 }
@@ -164,8 +312,16 @@ func NewConcurrencySettings(maxFileAndSocketHandles int, requestAutoTuneGRs bool
 func getMainPoolSize(numOfCPUs int, requestAutoTune bool) (initial int, max *ConfiguredInt) {
 
 	envVar := common.EEnvironmentVariable.ConcurrencyValue()
-
-	if common.GetLifecycleMgr().GetEnvironmentVariable(envVar) == "AUTO" {
+	envValue := lookupTunable(envVar)
+	adaptive := false
+
+	if isAdaptiveMainPool(requestAutoTune) {
+		// Start from our usual fixed value, and let the adaptive tuner move it up or down as conditions change
+		adaptive = true
+	} else if envValue == concurrencyValueAdaptive {
+		// we are benchmarking, which needs the usual auto-tuning, and is already going to do it
+		common.GetLifecycleMgr().Info(fmt.Sprintf("Ignoring %s=%s, since benchmarking uses its own concurrency tuning", envVar.Name, envValue))
+	} else if envValue == concurrencyValueAuto {
 		// Allow user to force auto-tuning from the env var, even when not in benchmark mode
 		// Might be handy in some S2S cases, where we know that release 10.2.1 was using too few goroutines
 		// This feature will probably remain undocumented for at least one release cycle, while we consider
@@ -175,7 +331,7 @@ func getMainPoolSize(numOfCPUs int, requestAutoTune bool) (initial int, max *Con
 		if requestAutoTune {
 			// Tell user that we can't actually auto tune, because configured value takes precedence
 			// This case happens when benchmarking with a fixed value from the env var
-			common.GetLifecycleMgr().Info(fmt.Sprintf("Cannot auto-tune concurrency because it is fixed by environment variable %s", envVar.Name))
+			common.GetLifecycleMgr().Info(fmt.Sprintf("Cannot auto-tune concurrency because it is fixed by the %s", describeTunableSource(envVar.Name)))
 		}
 		return c.Value, c // initial and max are same, fixed to the env var
 	}
@@ -202,20 +358,147 @@ func getMainPoolSize(numOfCPUs int, requestAutoTune bool) (initial int, max *Con
 	maxValue := initialValue
 	if requestAutoTune {
 		reason = "auto-tuning limit"
-		maxValue = 3000 // TODO: what should this be?  Testing indicates that this value is all we're ever likely to need, even in small-files cases
+		maxValue = maxTunedMainPoolSize
+	} else if adaptive {
+		reason = "adaptive tuning limit"
+		maxValue = maxTunedMainPoolSize
 	}
 
 	return initialValue, &ConfiguredInt{maxValue, false, envVar.Name, reason}
 }
 
-func getTransferInitiationPoolSize() *ConfiguredInt {
+// isAdaptiveMainPool says whether the user has asked, through AZCOPY_CONCURRENCY_VALUE, for the main pool size to be
+// adjusted for as long as we run.  Benchmarking needs the usual seek-once tuning, so that takes precedence
+func isAdaptiveMainPool(requestAutoTune bool) bool {
+	if lookupTunable(common.EEnvironmentVariable.ConcurrencyValue()) != concurrencyValueAdaptive {
+		return false
+	}
+	return !requestAutoTune
+}
+
+func getMainPoolSizePerAccount() *ConfiguredInt {
+	envVar := common.EEnvironmentVariable.ConcurrencyPerAccount()
+
+	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 0 {
+			log.Fatalf("%s must not be negative", envVar.Name)
+		}
+		return c
+	}
+
+	return &ConfiguredInt{0, false, envVar.Name, "no limit by default"}
+}
+
+func getMaxSftpConnectionsPerServer(maxMainPoolSize int) *ConfiguredInt {
+	envVar := common.EEnvironmentVariable.SftpConnections()
+
+	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 1 {
+			log.Fatalf("%s must be at least 1", envVar.Name)
+		}
+		return c
+	}
+
+	if maxMainPoolSize < defaultMaxSftpConnectionsPerServer {
+		return &ConfiguredInt{maxMainPoolSize, false, envVar.Name, "limited by the number of concurrent network operations"}
+	}
+	return &ConfiguredInt{defaultMaxSftpConnectionsPerServer, false, envVar.Name, "default, which OpenSSH servers allow"}
+}
+
+// getTransferInitiationPoolSize returns the initial and max sizes of the transfer initiation pool.
+// When the user doesn't fix it, the pool starts at the usual size, and may grow as far as the main pool size,
+// since with tiny files, each network operation may need a transfer of its own to be initiated
+func getTransferInitiationPoolSize(maxMainPoolSize int) (initial int, max *ConfiguredInt) {
 	envVar := common.EEnvironmentVariable.TransferInitiationPoolSize()
 
 	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 1 {
+			log.Fatalf("%s must be at least 1", envVar.Name)
+		}
+		return c.Value, c // initial and max are same, fixed to the configured value
+	}
+
+	maxValue := maxMainPoolSize
+	if maxValue < defaultTransferInitiationPoolSize {
+		maxValue = defaultTransferInitiationPoolSize
+	} else if maxValue > maxTransferInitiationPoolSize {
+		maxValue = maxTransferInitiationPoolSize
+	}
+
+	return defaultTransferInitiationPoolSize, &ConfiguredInt{maxValue, false, envVar.Name, "max number of connections"}
+}
+
+func getEnumerationPoolSize() *ConfiguredInt {
+	envVar := common.EEnvironmentVariable.EnumerationPoolSize()
+
+	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 1 {
+			log.Fatalf("%s must be at least 1", envVar.Name)
+		}
+		return c
+	}
+
+	return &ConfiguredInt{defaultEnumerationPoolSize, false, envVar.Name, "hard-coded default"}
+}
+
+func getMaxIdleConnections(maxMainPoolSize int) *ConfiguredInt {
+	envVar := common.EEnvironmentVariable.MaxIdleConnections()
+
+	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 0 {
+			log.Fatalf("%s must not be negative", envVar.Name)
+		}
+		return c
+	}
+
+	return &ConfiguredInt{maxMainPoolSize, false, envVar.Name, "max number of connections"}
+}
+
+const defaultIdleConnectionTimeoutSeconds = 180
+
+func getIdleConnectionTimeoutSeconds() *ConfiguredInt {
+	envVar := common.EEnvironmentVariable.IdleConnectionTimeout()
+
+	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 1 {
+			log.Fatalf("%s must be at least 1", envVar.Name)
+		}
+		return c
+	}
+
+	return &ConfiguredInt{defaultIdleConnectionTimeoutSeconds, false, envVar.Name, "hard-coded default"}
+}
+
+func getMaxConnectionsPerHost() *ConfiguredInt {
+	envVar := common.EEnvironmentVariable.MaxConnectionsPerHost()
+
+	if c := tryNewConfiguredInt(envVar); c != nil {
+		if c.Value < 0 {
+			log.Fatalf("%s must not be negative", envVar.Name)
+		}
+		return c
+	}
+
+	return &ConfiguredInt{0, false, envVar.Name, "no limit"}
+}
+
+func getExpectContinue() *ConfiguredBool {
+	envVar := common.EEnvironmentVariable.ExpectContinue()
+	if c := tryNewConfiguredBool(envVar); c != nil {
 		return c
 	}
 
-	return &ConfiguredInt{defaultTransferInitiationPoolSize, false, envVar.Name, "hard-coded default"}
+	return &ConfiguredBool{false, false, envVar.Name, "hard-coded default"}
+}
+
+// transportSettings returns the settings for the connections of the HTTP client that does the transfers
+func (c ConcurrencySettings) transportSettings() httpTransportSettings {
+	return httpTransportSettings{
+		maxIdleConns:    c.MaxIdleConnections.Value,
+		maxConnsPerHost: c.MaxConnectionsPerHost.Value,
+		idleConnTimeout: time.Duration(c.IdleConnectionTimeoutSeconds.Value) * time.Second,
+		expectContinue:  c.ExpectContinue.Value,
+	}
 }
 
 func getCheckCpuUsageWhenTuning() *ConfiguredBool {
@@ -227,22 +510,32 @@ func getCheckCpuUsageWhenTuning() *ConfiguredBool {
 	return &ConfiguredBool{true, false, envVar.Name, "hard-coded default"}
 }
 
+func getSlowStart() *ConfiguredBool {
+	envVar := common.EEnvironmentVariable.ConcurrencySlowStart()
+	if c := tryNewConfiguredBool(envVar); c != nil {
+		return c
+	}
+
+	return &ConfiguredBool{true, false, envVar.Name, "hard-coded default"}
+}
+
 // getMaxOpenFiles finds a number of concurrently-openable files
 // such that we'll have enough handles left, after using some as network handles.
 // This is important on Unix, where total handles can be constrained.
-func getMaxOpenPayloadFiles(maxFileAndSocketHandles int, concurrentConnections int) int {
+func getMaxOpenPayloadFiles(maxFileAndSocketHandles int, concurrentConnections int, concurrentEnumerations int) int {
 
 	// The value we return from this routine here only governs payload files. It does not govern plan
 	// files that azcopy opens as part of its own operations.  So we make a reasonable allowance for
 	// how many of those may be opened
 	const fileHandleAllowanceForPlanFiles = 300 // 300 plan files = 300 * common.NumOfFilesPerDispatchJobPart = 3million in total
 
-	const httpHandleAllowanceForOnGoingEnumeration = 1 // might still be scanning while we are transferring. Make this bigger if we ever do parallel scanning
+	// we might still be scanning while we are transferring, and each directory being listed needs a handle
+	handleAllowanceForOnGoingEnumeration := concurrentEnumerations
 
 	// make a conservative estimate of total network and file handles known so far
 	estimateOfKnownHandles := int(float32(concurrentConnections)*1.1) +
 		fileHandleAllowanceForPlanFiles +
-		httpHandleAllowanceForOnGoingEnumeration
+		handleAllowanceForOnGoingEnumeration
 
 	// see what we've got left over for open files
 	concurrentFilesLimit := maxFileAndSocketHandles - estimateOfKnownHandles
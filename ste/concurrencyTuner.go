@@ -21,6 +21,7 @@
 package ste
 
 import (
+	"fmt"
 	"github.com/Azure/azure-storage-azcopy/common"
 	"sync"
 	"sync/atomic"
@@ -39,6 +40,10 @@ type ConcurrencyTuner interface {
 
 	// recordRetry informs the concurrencyTuner that a retry has happened
 	recordRetry()
+
+	// recordAccountLimit informs the concurrencyTuner that a retry happened because the account was over its ingress or egress limit.
+	// It is called in addition to recordRetry, not instead of it
+	recordAccountLimit()
 }
 
 type nullConcurrencyTuner struct {
@@ -61,6 +66,10 @@ func (n *nullConcurrencyTuner) recordRetry() {
 	// noop
 }
 
+func (n *nullConcurrencyTuner) recordAccountLimit() {
+	// noop
+}
+
 type autoConcurrencyTuner struct {
 	atomicRetryCount int64
 	observations     chan struct {
@@ -126,6 +135,10 @@ func (t *autoConcurrencyTuner) recordRetry() {
 	atomic.AddInt64(&t.atomicRetryCount, 1)
 }
 
+func (t *autoConcurrencyTuner) recordAccountLimit() {
+	// noop. The retry count is all we use
+}
+
 const (
 	concurrencyReasonNone          = ""
 	concurrencyReasonTunerDisabled = "tuner disabled" // used as the final (non-finished) state for null tuner
@@ -136,6 +149,7 @@ const (
 	concurrencyReasonHighCpu       = "at optimum, but may be limited by CPU"
 	concurrencyReasonAtOptimum     = "at optimum"
 	concurrencyReasonFinished      = "tuning already finished (or never started)"
+	concurrencyReasonAdaptive      = "adaptive tuning in progress" // used as the final state for the adaptive tuner, which never finishes
 )
 
 func (t *autoConcurrencyTuner) worker() {
@@ -314,3 +328,219 @@ func (t *autoConcurrencyTuner) RequestCallbackWhenStable(callback func()) (callb
 		return false // channel full
 	}
 }
+
+// adaptiveConcurrencyTuner never finishes tuning. Unlike autoConcurrencyTuner, which seeks an optimum once and then
+// sticks with it, it keeps revisiting the concurrency level for the whole life of the app.  It backs off whenever the
+// service tells us it is busy (503s, including IngressOverAccountLimit and EgressOverAccountLimit) and, when things
+// are quiet, periodically probes a higher level, keeping that level only if throughput improves.
+// That suits long-running jobs, where the available bandwidth, and the load that other clients put on the
+// account, change while the job runs.
+type adaptiveConcurrencyTuner struct {
+	atomicRetryCount        int64
+	atomicAccountLimitCount int64
+	initialConcurrency      int
+	maxConcurrency          int
+	lock                    sync.Mutex
+	concurrency             int
+	previousConcurrency     int     // the level before our last probe upwards, so we can go back to it if the probe doesn't help
+	mbpsBeforeProbe         float32 // the speed that a probe upwards must beat
+	probing                 bool
+	quietIntervalsLeft      int // how many more observations to wait, before probing upwards again
+}
+
+const (
+	adaptiveMinConcurrency        = 4
+	adaptiveGrowthMultiplier      = 1.25
+	adaptiveBackoffMultiplier     = 0.75
+	adaptiveRequiredImprovement   = 0.05 // a probe upwards must improve throughput by at least this fraction, else we undo it
+	adaptiveIntervalsAfterProbe   = 4    // after a probe that didn't help, wait this many observations before probing again
+	adaptiveIntervalsAfterBackoff = 8    // after the service said it was busy, wait this many observations before probing again
+)
+
+func NewAdaptiveConcurrencyTuner(initial, max int) ConcurrencyTuner {
+	return &adaptiveConcurrencyTuner{
+		initialConcurrency:  initial,
+		maxConcurrency:      max,
+		concurrency:         initial,
+		previousConcurrency: initial,
+		quietIntervalsLeft:  1, // let the initial level run for one full observation before we try to improve on it
+	}
+}
+
+// GetRecommendedConcurrency returns a new concurrency level, and a description of why that level was chosen, every
+// time it changes the level.  When it leaves the level as it was, the reason is concurrencyReasonNone.
+// As with autoConcurrencyTuner, it's up to the caller to leave enough time between calls for currentMbps to be meaningful.
+func (t *adaptiveConcurrencyTuner) GetRecommendedConcurrency(currentMbps int, highCpuUsage bool) (newConcurrency int, reason string) {
+	if currentMbps < 0 {
+		return t.initialConcurrency, concurrencyReasonInitial
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	mbps := float32(currentMbps)
+	retries := atomic.SwapInt64(&t.atomicRetryCount, 0)
+	accountLimits := atomic.SwapInt64(&t.atomicAccountLimitCount, 0)
+
+	if retries > 0 {
+		// the service is busy, so whatever we were doing, back off
+		t.probing = false
+		t.quietIntervalsLeft = adaptiveIntervalsAfterBackoff
+		from := t.concurrency
+		if !t.setConcurrency(float32(t.concurrency) * adaptiveBackoffMultiplier) {
+			return t.concurrency, concurrencyReasonNone // already as low as we go
+		}
+		if accountLimits > 0 {
+			return t.concurrency, fmt.Sprintf("backing off from %d, because %d of %d server busy responses said the account is over its throughput limit",
+				from, accountLimits, retries)
+		}
+		return t.concurrency, fmt.Sprintf("backing off from %d, because of %d server busy responses", from, retries)
+	}
+
+	if t.probing {
+		// judge the probe we made last time. If it worked, we go on to try another one straight away
+		t.probing = false
+		if mbps <= t.mbpsBeforeProbe*(1+adaptiveRequiredImprovement) {
+			t.quietIntervalsLeft = adaptiveIntervalsAfterProbe
+			from := t.concurrency
+			t.setConcurrency(float32(t.previousConcurrency))
+			return t.concurrency, fmt.Sprintf("returning from %d, because throughput did not improve (%d Mbps, compared to %d Mbps before)",
+				from, currentMbps, int(t.mbpsBeforeProbe))
+		}
+	} else if t.quietIntervalsLeft > 0 {
+		t.quietIntervalsLeft--
+		return t.concurrency, concurrencyReasonNone
+	}
+
+	if highCpuUsage {
+		// more connections are unlikely to help, and will make things worse for everything else on the machine
+		return t.concurrency, concurrencyReasonNone
+	}
+
+	// probe upwards
+	from := t.concurrency
+	if !t.setConcurrency(float32(t.concurrency) * adaptiveGrowthMultiplier) {
+		return t.concurrency, concurrencyReasonNone // already at max
+	}
+	t.previousConcurrency = from
+	t.mbpsBeforeProbe = mbps
+	t.probing = true
+	return t.concurrency, fmt.Sprintf("probing up from %d, to see if throughput improves beyond %d Mbps", from, currentMbps)
+}
+
+// setConcurrency moves to the given level, within our limits, and says whether that changed anything
+func (t *adaptiveConcurrencyTuner) setConcurrency(target float32) (changed bool) {
+	newValue := int(target)
+	if target > float32(t.concurrency) && newValue == t.concurrency {
+		newValue++ // make sure small levels can still grow
+	}
+	if newValue > t.maxConcurrency {
+		newValue = t.maxConcurrency
+	}
+	if newValue < adaptiveMinConcurrency {
+		newValue = adaptiveMinConcurrency
+	}
+	changed = newValue != t.concurrency
+	t.concurrency = newValue
+	return changed
+}
+
+func (t *adaptiveConcurrencyTuner) RequestCallbackWhenStable(callback func()) (callbackAccepted bool) {
+	return false // we are never stable, since we never stop tuning
+}
+
+func (t *adaptiveConcurrencyTuner) GetFinalState() (finalReason string, finalRecommendedConcurrency int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return concurrencyReasonAdaptive, t.concurrency
+}
+
+func (t *adaptiveConcurrencyTuner) recordRetry() {
+	atomic.AddInt64(&t.atomicRetryCount, 1)
+}
+
+func (t *adaptiveConcurrencyTuner) recordAccountLimit() {
+	atomic.AddInt64(&t.atomicAccountLimitCount, 1)
+}
+
+// slowStartConcurrencyTuner starts with a few connections, rather than with the level that the tuner it wraps starts with,
+// and doubles them at each observation while there are no retries, until it reaches that level. From then on, the wrapped
+// tuner decides. That way a job doesn't open hundreds of connections at once, which can trip firewalls and proxies that take
+// it for an attack, and can swamp slow links.  Retries hold the level where it is, until an observation passes without any.
+type slowStartConcurrencyTuner struct {
+	inner            ConcurrencyTuner
+	atomicRetryCount int64
+	lock             sync.Mutex
+	ramping          bool
+	concurrency      int
+	target           int // the level the wrapped tuner starts with
+}
+
+const (
+	slowStartInitialConcurrency = 4
+	concurrencyReasonSlowStart  = "slow start"
+)
+
+func newSlowStartConcurrencyTuner(inner ConcurrencyTuner) *slowStartConcurrencyTuner {
+	return &slowStartConcurrencyTuner{inner: inner}
+}
+
+func (t *slowStartConcurrencyTuner) GetRecommendedConcurrency(currentMbps int, highCpuUsage bool) (newConcurrency int, reason string) {
+	if currentMbps < 0 {
+		target, reason := t.inner.GetRecommendedConcurrency(currentMbps, highCpuUsage)
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		if target <= slowStartInitialConcurrency {
+			return target, reason // already small enough
+		}
+		atomic.StoreInt64(&t.atomicRetryCount, 0)
+		t.ramping = true
+		t.concurrency = slowStartInitialConcurrency
+		t.target = target
+		return t.concurrency, concurrencyReasonSlowStart
+	}
+
+	if !t.isRamping() {
+		return t.inner.GetRecommendedConcurrency(currentMbps, highCpuUsage)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if retries := atomic.SwapInt64(&t.atomicRetryCount, 0); retries > 0 {
+		return t.concurrency, fmt.Sprintf("%s, holding because of %d server busy responses", concurrencyReasonSlowStart, retries)
+	}
+	t.concurrency *= 2
+	if t.concurrency >= t.target {
+		t.concurrency = t.target
+		t.ramping = false
+		return t.concurrency, concurrencyReasonSlowStart + " complete"
+	}
+	return t.concurrency, concurrencyReasonSlowStart
+}
+
+// isRamping says whether the level is still being doubled, and so needs observing more often than the wrapped tuner does
+func (t *slowStartConcurrencyTuner) isRamping() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.ramping
+}
+
+func (t *slowStartConcurrencyTuner) RequestCallbackWhenStable(callback func()) (callbackAccepted bool) {
+	return t.inner.RequestCallbackWhenStable(callback)
+}
+
+func (t *slowStartConcurrencyTuner) GetFinalState() (finalReason string, finalRecommendedConcurrency int) {
+	return t.inner.GetFinalState()
+}
+
+func (t *slowStartConcurrencyTuner) recordRetry() {
+	atomic.AddInt64(&t.atomicRetryCount, 1)
+	t.inner.recordRetry()
+}
+
+func (t *slowStartConcurrencyTuner) recordAccountLimit() {
+	t.inner.recordAccountLimit()
+}
@@ -1,6 +1,9 @@
 package ste
 
 import (
+	"os"
+
+	"github.com/Azure/azure-storage-azcopy/common"
 	chk "gopkg.in/check.v1"
 )
 
@@ -35,3 +38,21 @@ func (s *mainTestSuite) TestConcurrencyValue(c *chk.C) {
 		c.Assert(max.Value, chk.Equals, maxConcurrency)
 	}
 }
+
+func (s *mainTestSuite) TestConcurrencyValueAdaptive(c *chk.C) {
+	envVar := common.EEnvironmentVariable.ConcurrencyValue().Name
+	os.Setenv(envVar, "ADAPTIVE")
+	defer os.Unsetenv(envVar)
+
+	// starts where the fixed value would be, but is free to move up from there
+	min, max := getMainPoolSize(8, false)
+	c.Assert(min, chk.Equals, 16*8)
+	c.Assert(max.Value, chk.Equals, maxTunedMainPoolSize)
+	c.Assert(isAdaptiveMainPool(false), chk.Equals, true)
+
+	// benchmarking keeps its own tuning
+	min, max = getMainPoolSize(8, true)
+	c.Assert(min, chk.Equals, 4)
+	c.Assert(max.Value, chk.Equals, maxTunedMainPoolSize)
+	c.Assert(isAdaptiveMainPool(true), chk.Equals, false)
+}
@@ -0,0 +1,180 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// policyViolationTracker keeps the files that broke a rule of the content policy, for the report at the end of the job
+type policyViolationTracker struct {
+	mu         sync.Mutex
+	violations []common.PolicyViolation
+}
+
+func newPolicyViolationTracker() *policyViolationTracker {
+	return &policyViolationTracker{violations: make([]common.PolicyViolation, 0)}
+}
+
+func (t *policyViolationTracker) record(violation common.PolicyViolation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.violations = append(t.violations, violation)
+}
+
+// get returns a copy of the violations, and how many of them were quarantined
+func (t *policyViolationTracker) get() (violations []common.PolicyViolation, quarantined uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	violations = make([]common.PolicyViolation, len(t.violations))
+	copy(violations, t.violations)
+	for _, v := range violations {
+		if v.Quarantined {
+			quarantined++
+		}
+	}
+	return violations, quarantined
+}
+
+// checkContentPolicy checks the transfer against the content policy of the job, before the transfer starts.
+// A file that breaks a rule is either quarantined, in which case it carries on, but to the quarantine folder (see Info),
+// or rejected, in which case it's reported done with its own status, and false is returned.
+// Content signatures are only checked for local sources, since reading remote ones would cost an extra request per file.
+// The same goes for the malware scan, which only sees the files that passed the rules
+func (jptm *jobPartTransferMgr) checkContentPolicy() bool {
+	policy := jptm.jobPartMgr.ContentPolicy()
+	if policy.IsEmpty() {
+		return true
+	}
+
+	plan := jptm.jobPartMgr.Plan()
+	src, dst := plan.TransferSrcDstStrings(jptm.transferIndex)
+	isLocal := plan.FromTo.From() == common.ELocation.Local()
+	rule := policy.CheckFile(src, jptm.jobPartPlanTransfer.SourceSize)
+	if rule == "" && policy.SignatureLength() > 0 && isLocal {
+		leading, err := readLeadingBytes(src, policy.SignatureLength())
+		if err != nil {
+			jptm.failContentCheck(src, "Couldn't check the content of the file against the content policy", err)
+			return false
+		}
+		rule = policy.CheckContent(leading)
+	}
+	if rule != "" {
+		return jptm.handlePolicyViolation(common.PolicyViolation{Src: src, Dst: dst, Rule: rule}, policy.Action, policy.QuarantineFolder)
+	}
+
+	if len(policy.ScanCommand) > 0 && isLocal {
+		infected, report, err := scanFile(jptm.Context(), policy.ScanCommand, src)
+		if err != nil {
+			jptm.failContentCheck(src, "Couldn't scan the file for malware", err)
+			return false
+		}
+		if infected {
+			if report == "" {
+				report = "no details from the scanner"
+			}
+			violation := common.PolicyViolation{Src: src, Dst: dst, Rule: "infected: " + report, Infected: true}
+			return jptm.handlePolicyViolation(violation, policy.InfectedAction, policy.QuarantineFolder)
+		}
+	}
+	return true
+}
+
+// handlePolicyViolation quarantines or rejects a file that broke a rule of the content policy, or that the malware scan found infected.
+// It returns whether the transfer carries on
+func (jptm *jobPartTransferMgr) handlePolicyViolation(violation common.PolicyViolation, action common.ContentPolicyAction, quarantineFolder string) bool {
+	if action == common.EContentPolicyAction.Quarantine() {
+		plan := jptm.jobPartMgr.Plan()
+		atomic.StoreUint32(&jptm.atomicQuarantined, 1)
+		violation.Dst = quarantineDestination(string(plan.DestinationRoot[:plan.DestinationRootLength]), violation.Dst, quarantineFolder)
+		violation.Quarantined = true
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning,
+			fmt.Sprintf("Violates the content policy (%s), so will be transferred to %s", violation.Rule, violation.Dst))
+		jptm.jobPartMgr.getPolicyViolationTracker().record(violation)
+		return true
+	}
+
+	status := common.ETransferStatus.SkippedContentPolicy()
+	if violation.Infected {
+		status = common.ETransferStatus.SkippedInfected()
+	}
+	jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, fmt.Sprintf("Rejected by the content policy (%s)", violation.Rule))
+	jptm.jobPartMgr.getPolicyViolationTracker().record(violation)
+	jptm.SetStatus(status)
+	jptm.ReportTransferDone()
+	return false
+}
+
+// failContentCheck fails a transfer whose content couldn't be checked, since we can't know whether it's allowed
+func (jptm *jobPartTransferMgr) failContentCheck(src string, message string, err error) {
+	jptm.LogError(src, message, err)
+	jptm.SetStatus(common.ETransferStatus.Failed())
+	jptm.ReportTransferDone()
+}
+
+// isQuarantined says whether the transfer broke the content policy, and so goes to the quarantine folder
+func (jptm *jobPartTransferMgr) isQuarantined() bool {
+	return atomic.LoadUint32(&jptm.atomicQuarantined) == 1
+}
+
+// quarantineDestination returns where a file goes when it's quarantined: the same place, relative to the quarantine
+// folder under the destination root, as it would otherwise have had relative to the destination root.
+// When the destination root is the file itself, the quarantine folder is beside it
+func quarantineDestination(dstRoot string, dst string, folder string) string {
+	separator := common.DeterminePathSeparator(dstRoot)
+	dstRoot = strings.TrimSuffix(dstRoot, separator)
+
+	relative := strings.TrimPrefix(dst, dstRoot)
+	if relative == "" {
+		i := strings.LastIndex(dstRoot, separator)
+		if i < 0 {
+			return common.GenerateFullPath(folder, dstRoot)
+		}
+		return common.GenerateFullPath(common.GenerateFullPath(dstRoot[:i], folder), dstRoot[i+1:])
+	}
+	return common.GenerateFullPath(common.GenerateFullPath(dstRoot, folder), relative)
+}
+
+// readLeadingBytes reads up to count bytes from the start of a local file
+func readLeadingBytes(path string, count int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	leading := make([]byte, count)
+	n, err := io.ReadFull(f, leading)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil // a file shorter than the signatures can still be checked
+	}
+	return leading[:n], err
+}
@@ -0,0 +1,357 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const datasetManifestVersion = 1
+
+// the resource and API version used to sign manifests with a Key Vault key
+const keyVaultResource = "https://vault.azure.net"
+const keyVaultAPIVersion = "7.1"
+
+// datasetManifestFile is the entry of the manifest for one file that was transferred
+type datasetManifestFile struct {
+	Path       string `json:"path"` // relative to the destination
+	Size       int64  `json:"size"`
+	ContentMD5 string `json:"contentMD5,omitempty"` // base64, like the Content-MD5 header
+	// whether the MD5 hash was checked against the data that landed. If not, it was computed from the data as it was sent,
+	// or, failing that, it's the hash that the source had stored, so it says what the content should be rather than what it is
+	ContentMD5Verified bool `json:"contentMD5Verified"`
+}
+
+// datasetManifestSignature is written next to the manifest, so that the recipients of the dataset can check,
+// with the public key and without AzCopy (e.g. with openssl dgst -verify), that the manifest is the one the job wrote
+type datasetManifestSignature struct {
+	Algorithm      string `json:"algorithm"` // RS256 or ES256, always over the SHA-256 of the manifest. ECDSA signatures are ASN.1 DER
+	KeyID          string `json:"keyId,omitempty"`
+	ManifestSHA256 string `json:"manifestSha256"`
+	Signature      string `json:"signature"`
+}
+
+// datasetManifest keeps a list of the files that land, as the job runs, and turns it into a manifest
+// of the whole dataset when the job completes. Since the list is kept in a file next to the job log,
+// the manifest of a job that was resumed covers all its runs
+type datasetManifest struct {
+	files *appendOnlyJSONFile
+}
+
+func newDatasetManifest(logFileFolder string, jobID common.JobID, logger common.ILogger) *datasetManifest {
+	return &datasetManifest{files: newAppendOnlyJSONFile(path.Join(logFileFolder, jobID.String()+".manifest-files"), "list of files for the manifest", logger)}
+}
+
+func (m *datasetManifest) enable() {
+	m.files.enable()
+}
+
+func (m *datasetManifest) recordFile(relativePath string, size int64, contentMD5 []byte, verified bool) {
+	f := datasetManifestFile{Path: relativePath, Size: size, ContentMD5Verified: verified && len(contentMD5) > 0}
+	if len(contentMD5) > 0 {
+		f.ContentMD5 = base64.StdEncoding.EncodeToString(contentMD5)
+	}
+	m.files.append(f)
+}
+
+// datasetManifestHeader describes the job the manifest is for
+type datasetManifestHeader struct {
+	JobID       common.JobID
+	Source      string
+	Destination string
+	FailedFiles []string // relative to the destination. These aren't in the list of files, and make the manifest incomplete
+}
+
+// write writes the manifest, and its signature if there's a signing key. The manifest is streamed from
+// the list of files, since a job may have many millions of them
+func (m *datasetManifest) write(ctx context.Context, header datasetManifestHeader, manifestPath, signingKey string, tokenInfo common.OAuthTokenInfo, client *http.Client) error {
+	m.files.Close()
+	if m.files.hasFailed() {
+		return errors.New("the list of files is incomplete")
+	}
+
+	digest, err := m.writeManifest(header, manifestPath)
+	if err != nil {
+		return err
+	}
+	if signingKey == "" {
+		return nil
+	}
+
+	signature, err := signManifestDigest(ctx, digest, signingKey, tokenInfo, client)
+	if err != nil {
+		return fmt.Errorf("signing the manifest: %v", err)
+	}
+	signatureJSON, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath+".sig", signatureJSON, 0644)
+}
+
+// writeManifest writes the manifest and returns its SHA-256
+func (m *datasetManifest) writeManifest(header datasetManifestHeader, manifestPath string) (digest []byte, err error) {
+	files, err := os.Open(m.files.path)
+	if os.IsNotExist(err) {
+		files, err = nil, nil // nothing landed
+	} else if err != nil {
+		return nil, err
+	} else {
+		defer files.Close()
+	}
+
+	out, err := os.Create(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	hash := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(out, hash))
+	writeField := func(name string, value interface{}) {
+		b, _ := json.Marshal(value)
+		fmt.Fprintf(w, "  %q: %s,\n", name, b)
+	}
+
+	fmt.Fprint(w, "{\n")
+	writeField("version", datasetManifestVersion)
+	writeField("jobId", header.JobID)
+	writeField("createdTime", time.Now().UTC().Format(time.RFC3339))
+	writeField("source", header.Source)
+	writeField("destination", header.Destination)
+	writeField("complete", len(header.FailedFiles) == 0)
+	failedFiles := header.FailedFiles
+	if failedFiles == nil {
+		failedFiles = []string{}
+	}
+	writeField("failedFiles", failedFiles)
+
+	fileCount, totalBytes := int64(0), int64(0)
+	fmt.Fprint(w, "  \"files\": [")
+	if files != nil {
+		scanner := bufio.NewScanner(files)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var f datasetManifestFile
+			if err = json.Unmarshal(scanner.Bytes(), &f); err != nil {
+				return nil, fmt.Errorf("the list of files is corrupt: %v", err)
+			}
+			if fileCount > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, "\n    %s", scanner.Bytes())
+			fileCount++
+			totalBytes += f.Size
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprint(w, "\n  ],\n")
+	writeField("fileCount", fileCount)
+	fmt.Fprintf(w, "  \"totalBytes\": %d\n}\n", totalBytes)
+
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// isKeyVaultKey tells whether the signing key is the URL of a Key Vault key, rather than a key file
+func isKeyVaultKey(signingKey string) bool {
+	u, err := url.Parse(signingKey)
+	return err == nil && u.Scheme == "https" && strings.HasPrefix(u.Path, "/keys/")
+}
+
+func signManifestDigest(ctx context.Context, digest []byte, signingKey string, tokenInfo common.OAuthTokenInfo, client *http.Client) (*datasetManifestSignature, error) {
+	if isKeyVaultKey(signingKey) {
+		return signWithKeyVault(ctx, digest, signingKey, tokenInfo, client)
+	}
+	return signWithKeyFile(digest, signingKey)
+}
+
+// signWithKeyFile signs with an RSA or ECDSA private key, in an unencrypted PEM file
+func signWithKeyFile(digest []byte, keyFile string) (*datasetManifestSignature, error) {
+	pemBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	for block, rest := pem.Decode(pemBytes); block != nil && key == nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signature := &datasetManifestSignature{ManifestSHA256: hex.EncodeToString(digest)}
+	var signatureBytes []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature.Algorithm = "RS256"
+		signatureBytes, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest)
+	case *ecdsa.PrivateKey:
+		signature.Algorithm = "ES256"
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, k, digest); err == nil {
+			signatureBytes, err = asn1.Marshal(ecdsaSignature{r, s})
+		}
+	case nil:
+		return nil, fmt.Errorf("%s holds no unencrypted private key in PEM format", keyFile)
+	default:
+		return nil, errors.New("only RSA and ECDSA keys can sign manifests")
+	}
+	if err != nil {
+		return nil, err
+	}
+	signature.Signature = base64.StdEncoding.EncodeToString(signatureBytes)
+	return signature, nil
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// signWithKeyVault has Key Vault sign the digest, with the identity AzCopy is logged in with, so that the private key
+// never leaves the vault. The key URL may name a version of the key, or else its current version is used
+func signWithKeyVault(ctx context.Context, digest []byte, keyURL string, tokenInfo common.OAuthTokenInfo, client *http.Client) (*datasetManifestSignature, error) {
+	if tokenInfo.IsEmpty() {
+		return nil, errors.New("signing with a Key Vault key needs the job to be authenticated with azcopy login")
+	}
+	token, err := tokenInfo.GetTokenForResource(ctx, keyVaultResource)
+	if err != nil {
+		return nil, err
+	}
+	keyURL = strings.TrimSuffix(keyURL, "/")
+
+	call := func(method, u string, body interface{}, result interface{}) error {
+		var reqBody io.Reader
+		if body != nil {
+			b, err := json.Marshal(body)
+			if err != nil {
+				return err
+			}
+			reqBody = bytes.NewReader(b)
+		}
+		req, err := http.NewRequest(method, u+"?api-version="+keyVaultAPIVersion, reqBody)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Key Vault returned %s: %s", resp.Status, respBody)
+		}
+		return json.Unmarshal(respBody, result)
+	}
+
+	// the algorithm depends on the type of the key
+	var keyBundle struct {
+		Key struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+		} `json:"key"`
+	}
+	if err = call(http.MethodGet, keyURL, nil, &keyBundle); err != nil {
+		return nil, err
+	}
+	signature := &datasetManifestSignature{KeyID: keyBundle.Key.Kid, ManifestSHA256: hex.EncodeToString(digest)}
+	switch {
+	case strings.HasPrefix(keyBundle.Key.Kty, "RSA"):
+		signature.Algorithm = "RS256"
+	case strings.HasPrefix(keyBundle.Key.Kty, "EC") && keyBundle.Key.Crv == "P-256":
+		signature.Algorithm = "ES256"
+	default:
+		return nil, fmt.Errorf("keys of type %s %s cannot sign manifests. Use an RSA key or a P-256 EC key", keyBundle.Key.Kty, keyBundle.Key.Crv)
+	}
+
+	var result struct {
+		Value string `json:"value"`
+	}
+	request := map[string]string{"alg": signature.Algorithm, "value": base64.RawURLEncoding.EncodeToString(digest)}
+	if err = call(http.MethodPost, keyBundle.Key.Kid+"/sign", request, &result); err != nil {
+		return nil, err
+	}
+	signatureBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Value, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	// Key Vault returns ECDSA signatures as R and S side by side, so convert them to DER, like the ones of key files
+	if signature.Algorithm == "ES256" {
+		half := len(signatureBytes) / 2
+		r, s := new(big.Int).SetBytes(signatureBytes[:half]), new(big.Int).SetBytes(signatureBytes[half:])
+		if signatureBytes, err = asn1.Marshal(ecdsaSignature{r, s}); err != nil {
+			return nil, err
+		}
+	}
+	signature.Signature = base64.StdEncoding.EncodeToString(signatureBytes)
+	return signature, nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"sync"
+)
+
+// Limits the memory used to remember directories that we've created.  When there are more than this,
+// we forget them all, and start again, which costs nothing more than some requests that turn out to be unnecessary
+const maxTrackedCreatedDirs = 100000
+
+// dirCreationTracker remembers which directories have been created (or were found to exist already), so that
+// the transfers in those directories don't need to make requests to create them again.  It also makes sure that,
+// when several transfers need the same directory at once, only one of them actually creates it,
+// and the others wait for that, instead of all sending the same requests in parallel.
+// Failures are not remembered, so a directory that failed to be created will be tried again by the next transfer that needs it.
+type dirCreationTracker struct {
+	lock       sync.Mutex
+	created    map[string]struct{}
+	inProgress map[string]*dirCreation
+}
+
+type dirCreation struct {
+	done chan struct{}
+	err  error
+}
+
+func newDirCreationTracker() *dirCreationTracker {
+	return &dirCreationTracker{
+		created:    make(map[string]struct{}),
+		inProgress: make(map[string]*dirCreation),
+	}
+}
+
+// ensureCreated calls create, unless the directory identified by key has already been created.
+// If another caller is creating the same directory right now, it waits for them instead.  If their attempt fails,
+// it makes its own (e.g. because the failure may have been caused by the other caller's context being cancelled)
+func (t *dirCreationTracker) ensureCreated(key string, create func() error) error {
+	for {
+		t.lock.Lock()
+		if _, ok := t.created[key]; ok {
+			t.lock.Unlock()
+			return nil
+		}
+		if c, ok := t.inProgress[key]; ok {
+			t.lock.Unlock()
+			<-c.done
+			if c.err == nil {
+				return nil
+			}
+			continue // have our own try
+		}
+		c := &dirCreation{done: make(chan struct{})}
+		t.inProgress[key] = c
+		t.lock.Unlock()
+
+		c.err = create()
+
+		t.lock.Lock()
+		delete(t.inProgress, key)
+		if c.err == nil {
+			if len(t.created) >= maxTrackedCreatedDirs {
+				t.created = make(map[string]struct{})
+			}
+			t.created[key] = struct{}{}
+		}
+		t.lock.Unlock()
+		close(c.done)
+		return c.err
+	}
+}
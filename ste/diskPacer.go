@@ -0,0 +1,183 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// reads and writes of local files are paced in pieces of at most this size.
+// Each piece counts as one operation for the IOPS limit
+const diskPacerMaxIOSize = 1024 * 1024
+
+// the ops pacer counts in thousandths of an operation, since the token bucket only releases whole tokens,
+// and would never release any at all for very low rates
+const milliOpsPerOp = 1000
+
+// diskPacer limits the rate at which we read and write local files, so that transfers don't saturate the local disks.
+// This is separate from the cap on network traffic, since the two are usually constrained for different reasons.
+type diskPacer struct {
+	bytes pacer // nil if the rate in bytes is not limited
+	ops   pacer // nil if the rate of operations is not limited
+}
+
+// newDiskPacer returns nil if neither rate is limited (i.e. both are zero)
+func newDiskPacer(bytesPerSecond int64, opsPerSecond int64) *diskPacer {
+	if bytesPerSecond <= 0 && opsPerSecond <= 0 {
+		return nil
+	}
+
+	p := &diskPacer{}
+	if bytesPerSecond > 0 {
+		p.bytes = newTokenBucketPacer(bytesPerSecond, diskPacerMaxIOSize)
+	}
+	if opsPerSecond > 0 {
+		p.ops = newTokenBucketPacer(opsPerSecond*milliOpsPerOp, milliOpsPerOp)
+	}
+	return p
+}
+
+// getDiskPacer makes a disk pacer from the limits that the user has set in the environment, if any
+func getDiskPacer() *diskPacer {
+	lcm := common.GetLifecycleMgr()
+
+	bytesPerSecond := int64(0)
+	mbEnvVar := common.EEnvironmentVariable.DiskCapMBPerSecond()
+	if s := lcm.GetEnvironmentVariable(mbEnvVar); s != "" {
+		mbPerSecond, err := strconv.ParseFloat(s, 64)
+		if err != nil || mbPerSecond <= 0 {
+			lcm.Error(fmt.Sprintf("Cannot parse environment variable %s. It must be a number of MB per second greater than zero, e.g. 50", mbEnvVar.Name))
+		}
+		bytesPerSecond = int64(mbPerSecond * 1024 * 1024)
+	}
+
+	opsPerSecond := int64(0)
+	iopsEnvVar := common.EEnvironmentVariable.DiskCapIOPS()
+	if s := lcm.GetEnvironmentVariable(iopsEnvVar); s != "" {
+		iops, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || iops <= 0 {
+			lcm.Error(fmt.Sprintf("Cannot parse environment variable %s. It must be a whole number of operations per second greater than zero", iopsEnvVar.Name))
+		}
+		opsPerSecond = iops
+	}
+
+	return newDiskPacer(bytesPerSecond, opsPerSecond)
+}
+
+// request blocks until we may read or write one piece of byteCount bytes
+func (p *diskPacer) request(ctx context.Context, byteCount int64) error {
+	if p.ops != nil {
+		if err := p.ops.RequestTrafficAllocation(ctx, milliOpsPerOp); err != nil {
+			return err
+		}
+	}
+	if p.bytes != nil {
+		return p.bytes.RequestTrafficAllocation(ctx, byteCount)
+	}
+	return nil
+}
+
+// wrapSourceFactory makes the files opened by the factory read at the pace of the disk pacer.
+// A nil pacer leaves the factory as it is
+func (p *diskPacer) wrapSourceFactory(ctx context.Context, factory common.ChunkReaderSourceFactory) common.ChunkReaderSourceFactory {
+	if p == nil {
+		return factory
+	}
+	return func() (common.CloseableReaderAt, error) {
+		file, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return &pacedReaderAt{ctx: ctx, inner: file, pacer: p}, nil
+	}
+}
+
+// wrapDestination makes the writes to the file go at the pace of the disk pacer.
+// A nil pacer leaves the file as it is
+func (p *diskPacer) wrapDestination(ctx context.Context, file io.WriteCloser) io.WriteCloser {
+	if p == nil {
+		return file
+	}
+	return &pacedWriter{ctx: ctx, inner: file, pacer: p}
+}
+
+type pacedReaderAt struct {
+	ctx   context.Context
+	inner common.CloseableReaderAt
+	pacer *diskPacer
+}
+
+func (r *pacedReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	total := 0
+	for total < len(b) {
+		piece := b[total:]
+		if len(piece) > diskPacerMaxIOSize {
+			piece = piece[:diskPacerMaxIOSize]
+		}
+		if err := r.pacer.request(r.ctx, int64(len(piece))); err != nil {
+			return total, err
+		}
+		n, err := r.inner.ReadAt(piece, off+int64(total))
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *pacedReaderAt) Close() error {
+	return r.inner.Close()
+}
+
+type pacedWriter struct {
+	ctx   context.Context
+	inner io.WriteCloser
+	pacer *diskPacer
+}
+
+func (w *pacedWriter) Write(b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		piece := b[total:]
+		if len(piece) > diskPacerMaxIOSize {
+			piece = piece[:diskPacerMaxIOSize]
+		}
+		if err := w.pacer.request(w.ctx, int64(len(piece))); err != nil {
+			return total, err
+		}
+		n, err := w.inner.Write(piece)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (w *pacedWriter) Close() error {
+	return w.inner.Close()
+}
@@ -0,0 +1,408 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Connections to the service go through a resolver that caches its answers for as long as their DNS TTL allows (jobs
+// make a great many connections to the same few hosts), and that orders or filters the addresses by family according to
+// ip-preference, since some networks have a broken IPv6 (or, more rarely, IPv4) path, which otherwise shows up as
+// intermittent connection timeouts.
+// The addresses themselves come from the platform resolver, so that hosts files and the like are still honored.
+// The TTL comes from a direct query of the first nameserver in resolv.conf, where there is one.
+
+const defaultDNSCacheTTL = 30 * time.Second
+const dnsTTLQueryTimeout = 2 * time.Second
+
+// how long the preferred address family gets before the other one is tried in parallel (as in RFC 6555, "happy eyeballs")
+const happyEyeballsFallbackDelay = 300 * time.Millisecond
+
+// when several addresses are tried one after the other, none gets less than this (out of the dial timeout)
+const minDialAttemptTimeout = 2 * time.Second
+
+// hostResolver looks up the addresses of a host, along with how long they may be cached
+type hostResolver interface {
+	lookup(ctx context.Context, host string) (ips []net.IP, ttl time.Duration, err error)
+}
+
+type systemHostResolver struct {
+	resolvConfPath string
+	nameserverPort string // 53 if not set
+}
+
+func (r systemHostResolver) lookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+
+	ttl, ok := r.queryTTL(ctx, host)
+	if !ok {
+		ttl = defaultDNSCacheTTL
+	}
+	return ips, ttl, nil
+}
+
+// queryTTL asks the nameserver directly, since the platform resolver doesn't say how long its answer is valid for.
+// The TTL of the answer is the lowest of its records (e.g. of a CNAME and the A record it leads to).
+func (r systemHostResolver) queryTTL(ctx context.Context, host string) (time.Duration, bool) {
+	server := firstNameserver(r.resolvConfPath)
+	if server == "" {
+		return 0, false
+	}
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return 0, false
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Intn(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsTTLQueryTimeout)
+	defer cancel()
+	port := r.nameserverPort
+	if port == "" {
+		port = "53"
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", net.JoinHostPort(server, port))
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	if _, err = conn.Write(packed); err != nil {
+		return 0, false
+	}
+	buf := make([]byte, 512) // the most a UDP answer can hold without EDNS, which we don't ask for
+	n, err := conn.Read(buf)
+	if err != nil {
+		return 0, false
+	}
+
+	var reply dnsmessage.Message
+	if err = reply.Unpack(buf[:n]); err != nil || reply.ID != query.ID || reply.RCode != dnsmessage.RCodeSuccess || reply.Truncated || len(reply.Answers) == 0 {
+		return 0, false
+	}
+	ttl := reply.Answers[0].Header.TTL
+	for _, a := range reply.Answers[1:] {
+		if a.Header.TTL < ttl {
+			ttl = a.Header.TTL
+		}
+	}
+	return time.Duration(ttl) * time.Second, true
+}
+
+func firstNameserver(resolvConfPath string) string {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// a cache entry is added before its lookup is done, so that concurrent connections to a host share one lookup
+type dnsCacheEntry struct {
+	ready  chan struct{}
+	ips    []net.IP
+	expiry time.Time
+	err    error
+}
+
+type cachingResolver struct {
+	resolver   hostResolver
+	log        func(msg string)
+	lock       sync.Mutex
+	cache      map[string]*dnsCacheEntry
+	preference common.IPPreference
+}
+
+func newCachingResolver(resolver hostResolver, log func(msg string)) *cachingResolver {
+	return &cachingResolver{
+		resolver: resolver,
+		log:      log,
+		cache:    make(map[string]*dnsCacheEntry),
+	}
+}
+
+func (c *cachingResolver) setPreference(preference common.IPPreference) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.preference = preference
+}
+
+// resolve returns the addresses of the host, in the order in which they should be tried
+func (c *cachingResolver) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	c.lock.Lock()
+	preference := c.preference
+	entry, found := c.cache[host]
+	if found {
+		select {
+		case <-entry.ready:
+			if time.Now().After(entry.expiry) {
+				found = false // stale, so it's replaced below
+			}
+		default:
+			// a lookup is in progress, so wait for it
+		}
+	}
+	owner := !found
+	if owner {
+		entry = &dnsCacheEntry{ready: make(chan struct{})}
+		c.cache[host] = entry
+	}
+	c.lock.Unlock()
+
+	if owner {
+		var ttl time.Duration
+		entry.ips, ttl, entry.err = c.resolver.lookup(ctx, host)
+		entry.expiry = time.Now().Add(ttl)
+		close(entry.ready)
+		if entry.err != nil || ttl <= 0 {
+			c.lock.Lock()
+			if c.cache[host] == entry {
+				delete(c.cache, host)
+			}
+			c.lock.Unlock()
+		}
+		if entry.err == nil {
+			c.log(fmt.Sprintf("DNS: %s resolved to %v, valid for %v. With ip-preference %s, connections will try %v",
+				host, entry.ips, ttl, preference, orderByIPPreference(entry.ips, preference)))
+		}
+	} else {
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	ordered := orderByIPPreference(entry.ips, preference)
+	if len(ordered) == 0 {
+		return nil, fmt.Errorf("%s has no address allowed by ip-preference %s (it resolved to %v)", host, preference, entry.ips)
+	}
+	return ordered, nil
+}
+
+// orderByIPPreference puts the preferred family first (keeping the resolver's order within each family),
+// or leaves out the other family altogether
+func orderByIPPreference(ips []net.IP, preference common.IPPreference) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch preference {
+	case common.EIPPreference.PreferIPv4():
+		return append(v4, v6...)
+	case common.EIPPreference.PreferIPv6():
+		return append(v6, v4...)
+	case common.EIPPreference.IPv4Only():
+		return v4
+	case common.EIPPreference.IPv6Only():
+		return v6
+	default:
+		return ips
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// resolvingDialer connects to host names using the caching resolver. When a host has addresses in both families,
+// the family of the first address gets a head start, and then the other one is tried in parallel.
+type resolvingDialer struct {
+	dialer        *net.Dialer
+	resolver      *cachingResolver
+	fallbackDelay time.Duration
+}
+
+func newResolvingDialer(dialer *net.Dialer, resolver *cachingResolver) *resolvingDialer {
+	return &resolvingDialer{dialer: dialer, resolver: resolver, fallbackDelay: happyEyeballsFallbackDelay}
+}
+
+func (d *resolvingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+	ips, err := d.resolver.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var primaries, fallbacks []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (ips[0].To4() != nil) {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, primaries, port)
+	}
+	return d.dialParallel(ctx, network, primaries, fallbacks, port)
+}
+
+func (d *resolvingDialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []net.IP, port string) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan dialResult, 2)
+	start := func(ips []net.IP) {
+		go func() {
+			conn, err := d.dialSerial(ctx, network, ips, port)
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	start(primaries)
+	pending := 1
+	fallbackStarted := false
+	timer := time.NewTimer(d.fallbackDelay)
+	defer timer.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				start(fallbacks)
+				fallbackStarted = true
+				pending++
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// the other attempt is cancelled, and if it manages to connect anyway, that connection is closed
+				go func(remaining int) {
+					for i := 0; i < remaining; i++ {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if !fallbackStarted {
+				// no point waiting any longer for a family that has already failed
+				start(fallbacks)
+				fallbackStarted = true
+				pending++
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial tries the addresses one after the other, sharing the dial timeout between them (as the standard dialer does)
+func (d *resolvingDialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	var firstErr error
+	for i, ip := range ips {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if remaining := len(ips) - i; remaining > 1 && d.dialer.Timeout > 0 {
+			timeout := d.dialer.Timeout / time.Duration(remaining)
+			if timeout < minDialAttemptTimeout {
+				timeout = minDialAttemptTimeout
+			}
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		conn, err := d.dialer.DialContext(attemptCtx, network, net.JoinHostPort(ip.String(), port))
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // cancelled, e.g. because the other family won the race, so this is not worth logging
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if i < len(ips)-1 {
+			d.resolver.log(fmt.Sprintf("DNS: could not connect to %s (%v), so trying %s", ip, err, ips[i+1]))
+		}
+	}
+	return nil, firstErr
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// the resolver is shared by all HTTP clients, so that they share its cache
+var sharedResolver = newCachingResolver(systemHostResolver{resolvConfPath: "/etc/resolv.conf"}, func(msg string) {
+	if JobsAdmin != nil {
+		JobsAdmin.LogToJobLog(msg)
+	}
+})
+
+// SetIPPreference says which address families are used for connections to the service
+func SetIPPreference(preference common.IPPreference) {
+	sharedResolver.setPreference(preference)
+}
@@ -0,0 +1,287 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Design explanation:
+/*
+Build machines often download the same large artifacts again and again. If AZCOPY_DOWNLOAD_CACHE_DIR is set, each blob that is
+downloaded is also kept in that folder, and later downloads of the same content, in any job, read it from there instead of from
+the service. The cache is content-addressed: a blob with a Content-MD5 is filed under that hash and its size, so that identical
+blobs share an entry, and a blob without one is filed under its URL and ETag, which change whenever its content does.
+A cached entry is "downloaded" through the same chunked writer as the real thing, so it's checked in the same way: its length,
+and, according to check-md5, its MD5 hash. Since most blobs have no MD5 (and check-md5 may be off), each entry also has a sidecar
+holding the SHA-256 of what was stored, which is checked before the entry is used, so that an entry damaged on disk is evicted
+instead of being copied into downloads. The cache is shared by all the AzCopy processes on the machine, so entries are only
+ever created by renaming a complete file into place. Temporary files left behind by processes that died are removed once nothing
+has written to them for a while.
+*/
+type downloadCache struct {
+	dir      string
+	maxBytes int64 // 0 means no limit
+
+	evictLock sync.Mutex // only one eviction at a time in this process
+}
+
+const (
+	downloadCacheTempMarker   = ".tmp-"
+	downloadCacheHashSuffix   = ".sha256"
+	downloadCacheOrphanMaxAge = time.Hour // temporary files are written to continuously, so one this old has been abandoned
+)
+
+var downloadCacheOnce sync.Once
+var sharedDownloadCache *downloadCache
+
+// getDownloadCache returns the download cache, or nil if there is none
+func getDownloadCache(logger common.ILogger) *downloadCache {
+	downloadCacheOnce.Do(func() {
+		lcm := common.GetLifecycleMgr()
+		dir := lcm.GetEnvironmentVariable(common.EEnvironmentVariable.DownloadCacheDir())
+		if dir == "" {
+			return
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			logger.Log(pipeline.LogWarning, fmt.Sprintf("Not using the download cache, since it cannot be created: %v", err))
+			return
+		}
+
+		var maxBytes int64
+		if raw := lcm.GetEnvironmentVariable(common.EEnvironmentVariable.DownloadCacheMaxGB()); raw != "" {
+			maxGB, err := strconv.ParseFloat(raw, 64)
+			if err != nil || maxGB <= 0 {
+				logger.Log(pipeline.LogWarning, fmt.Sprintf("Ignoring invalid %s '%s'", common.EEnvironmentVariable.DownloadCacheMaxGB().Name, raw))
+			} else {
+				maxBytes = int64(maxGB * 1024 * 1024 * 1024)
+			}
+		}
+		sharedDownloadCache = &downloadCache{dir: dir, maxBytes: maxBytes}
+	})
+	return sharedDownloadCache
+}
+
+// downloadCacheKey returns the name of the content of the transfer's source in the cache, or "" if it can't be cached
+func downloadCacheKey(info TransferInfo) string {
+	if md5 := info.SrcHTTPHeaders.ContentMD5; len(md5) > 0 {
+		return fmt.Sprintf("md5-%x-%d", md5, info.SourceSize)
+	}
+	if info.SrcETag == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(strings.Split(info.Source, "?")[0] + "\x00" + info.SrcETag))
+	return fmt.Sprintf("etag-%x", hash)
+}
+
+// usesDownloadCache says whether the transfer may be read from, and added to, the download cache
+func usesDownloadCache(jptm IJobPartTransferMgr) bool {
+	info := jptm.Info()
+	return jptm.FromTo() == common.EFromTo.BlobLocal() && !strings.EqualFold(info.Destination, common.Dev_Null) && downloadCacheKey(info) != ""
+}
+
+// lookup returns the path of the cached content, if there is any, it's the right size, and it still has the SHA-256 that it was stored with.
+// An entry whose content doesn't match its hash is evicted. One without a hash is left alone, since it may be being stored right now
+func (c *downloadCache) lookup(key string, size int64) (string, bool) {
+	path := filepath.Join(c.dir, key)
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() != size {
+		return "", false
+	}
+	expected, err := ioutil.ReadFile(path + downloadCacheHashSuffix)
+	if err != nil {
+		return "", false
+	}
+	actual, err := sha256OfFile(path)
+	if err != nil {
+		return "", false
+	}
+	if actual != strings.TrimSpace(string(expected)) {
+		c.remove(key)
+		return "", false
+	}
+
+	// the entries that were used most recently are removed last
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return path, true
+}
+
+func sha256OfFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// remove evicts an entry and its hash
+func (c *downloadCache) remove(key string) {
+	_ = os.Remove(filepath.Join(c.dir, key))
+	_ = os.Remove(filepath.Join(c.dir, key+downloadCacheHashSuffix))
+}
+
+// store adds a downloaded file to the cache, under a temporary name until it's all there.
+// The hash is put in place first, so that an entry is never without one
+func (c *downloadCache) store(key string, downloaded string) error {
+	src, err := os.Open(downloaded)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(c.dir, key+downloadCacheTempMarker+"*")
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = c.writeFile(key+downloadCacheHashSuffix, []byte(fmt.Sprintf("%x\n", h.Sum(nil))))
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return c.evict()
+}
+
+// writeFile writes a small file into the cache, under a temporary name until it's all there
+func (c *downloadCache) writeFile(name string, content []byte) error {
+	tmp, err := ioutil.TempFile(c.dir, name+downloadCacheTempMarker+"*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// evict removes the temporary files that were abandoned, and then the entries that were used longest ago,
+// until the cache is within its limit. The hashes of the entries are left out of its size, being so small
+func (c *downloadCache) evict() error {
+	c.evictLock.Lock()
+	defer c.evictLock.Unlock()
+
+	all, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	entries := make([]os.FileInfo, 0, len(all))
+	total := int64(0)
+	for _, e := range all {
+		switch {
+		case e.IsDir():
+			continue
+		case strings.Contains(e.Name(), downloadCacheTempMarker):
+			if time.Since(e.ModTime()) > downloadCacheOrphanMaxAge {
+				if err := os.Remove(filepath.Join(c.dir, e.Name())); err == nil || os.IsNotExist(err) {
+					continue
+				}
+			}
+			total += e.Size() // still being written, perhaps by another process
+		case strings.HasSuffix(e.Name(), downloadCacheHashSuffix):
+			continue
+		default:
+			total += e.Size()
+			entries = append(entries, e)
+		}
+	}
+	if c.maxBytes == 0 {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().Before(entries[j].ModTime()) })
+	for _, e := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+		if err = os.Remove(filepath.Join(c.dir, e.Name())); err == nil || os.IsNotExist(err) {
+			_ = os.Remove(filepath.Join(c.dir, e.Name()+downloadCacheHashSuffix))
+			total -= e.Size()
+		}
+	}
+	return nil
+}
+
+// newDownloaderFromCache returns a downloader that reads the transfer's source from the download cache, if it's there
+func newDownloaderFromCache(jptm IJobPartTransferMgr) (downloader, bool) {
+	c := getDownloadCache(jptm)
+	if c == nil || !usesDownloadCache(jptm) {
+		return nil, false
+	}
+	info := jptm.Info()
+	path, ok := c.lookup(downloadCacheKey(info), info.SourceSize)
+	if !ok {
+		return nil, false
+	}
+	jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Reading from the download cache")
+	return &localFileDownloader{cachedPath: path}, true
+}
+
+// addToDownloadCache keeps a copy of the file that was downloaded, unless it was read from the cache in the first place.
+// The transfer doesn't fail if it can't be kept, since the download itself is fine
+func addToDownloadCache(jptm IJobPartTransferMgr, dl downloader) {
+	c := getDownloadCache(jptm)
+	if c == nil || !jptm.IsLive() || !usesDownloadCache(jptm) || jptm.ShouldDecompress() {
+		return
+	}
+	if ld, ok := dl.(*localFileDownloader); ok && ld.cachedPath != "" {
+		return
+	}
+	info := jptm.Info()
+	if err := c.store(downloadCacheKey(info), info.Destination); err != nil {
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "Cannot add the file to the download cache: "+err.Error())
+	}
+}
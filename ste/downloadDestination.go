@@ -0,0 +1,139 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// downloadDestination is where downloads are saved, which is usually the local file system, but may be an SFTP server
+type downloadDestination interface {
+	Stat(destination string) (os.FileInfo, error)
+	CreateEmptyFile(destination string) error
+	// CreateFile creates the file, and any parent directories it needs, ready to write from the start
+	CreateFile(destination string, size int64, writeThrough bool) (io.WriteCloser, error)
+	Chtimes(destination string, atime time.Time, mtime time.Time) error
+	Remove(destination string) error
+}
+
+func newDownloadDestination(jptm IJobPartTransferMgr) downloadDestination {
+	if fromTo := jptm.FromTo(); fromTo.To() == common.ELocation.Sftp() {
+		return sftpDownloadDestination{ctx: jptm.Context(), meter: jobBandwidthMeter(jptm)}
+	}
+	return localDownloadDestination{}
+}
+
+type localDownloadDestination struct{}
+
+func (localDownloadDestination) Stat(destination string) (os.FileInfo, error) {
+	return os.Stat(destination)
+}
+
+func (localDownloadDestination) CreateEmptyFile(destination string) error {
+	return createEmptyFile(destination)
+}
+
+func (localDownloadDestination) CreateFile(destination string, size int64, writeThrough bool) (io.WriteCloser, error) {
+	return common.CreateFileOfSizeWithWriteThroughOption(destination, size, writeThrough)
+}
+
+func (localDownloadDestination) Chtimes(destination string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(destination, atime, mtime)
+}
+
+func (localDownloadDestination) Remove(destination string) error {
+	return deleteFile(destination)
+}
+
+// sftpDownloadDestination saves downloads to an SFTP server, given by the URL of each destination
+type sftpDownloadDestination struct {
+	ctx   context.Context
+	meter *bandwidthMeter // may be nil
+}
+
+func (d sftpDownloadDestination) do(destination string, op func(c *common.SftpClient, path string) error) error {
+	pool, filePath, err := getSftpClientPool(destination)
+	if err != nil {
+		return err
+	}
+	return pool.do(d.ctx, func(c *common.SftpClient) error {
+		return op(c, filePath)
+	})
+}
+
+func (d sftpDownloadDestination) Stat(destination string) (fi os.FileInfo, err error) {
+	err = d.do(destination, func(c *common.SftpClient, filePath string) error {
+		fi, err = c.Stat(filePath)
+		return err
+	})
+	return fi, err
+}
+
+func (d sftpDownloadDestination) CreateEmptyFile(destination string) error {
+	return d.do(destination, func(c *common.SftpClient, filePath string) error {
+		return createSftpFile(c, filePath)
+	})
+}
+
+func (d sftpDownloadDestination) CreateFile(destination string, size int64, writeThrough bool) (io.WriteCloser, error) {
+	// the size can't be reserved in advance, and the server decides when the data reaches its disk
+	pool, filePath, err := getSftpClientPool(destination)
+	if err != nil {
+		return nil, err
+	}
+	err = pool.do(d.ctx, func(c *common.SftpClient) error {
+		return createSftpFile(c, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSftpFileWriter(d.ctx, pool, filePath, d.meter), nil
+}
+
+func (d sftpDownloadDestination) Chtimes(destination string, atime time.Time, mtime time.Time) error {
+	return d.do(destination, func(c *common.SftpClient, filePath string) error {
+		return c.Chtimes(filePath, atime, mtime)
+	})
+}
+
+func (d sftpDownloadDestination) Remove(destination string) error {
+	return d.do(destination, func(c *common.SftpClient, filePath string) error {
+		return c.Remove(filePath)
+	})
+}
+
+// createSftpFile creates an empty file, replacing any that's there, and its parent directories
+func createSftpFile(c *common.SftpClient, filePath string) error {
+	if err := c.MkdirAll(path.Dir(filePath)); err != nil {
+		return err
+	}
+	f, err := c.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
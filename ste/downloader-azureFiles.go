@@ -21,6 +21,7 @@
 package ste
 
 import (
+	"context"
 	"errors"
 	"net/url"
 
@@ -57,7 +58,11 @@ func (bd *azureFilesDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, s
 		// wait until we get the headers back... but we have not yet read its whole body.
 		// The Download method encapsulates any retries that may be necessary to get to the point of receiving response headers.
 		jptm.LogChunkStatus(id, common.EWaitReason.HeaderResponse())
-		get, err := srcFileURL.Download(jptm.Context(), id.OffsetInFile(), length, false)
+		ctx := jptm.Context()
+		if jptm.PreservePosixProperties() {
+			ctx = context.WithValue(ctx, ServiceAPIVersionOverride, nfsServiceVersion)
+		}
+		get, err := srcFileURL.Download(ctx, id.OffsetInFile(), length, false)
 		if err != nil {
 			jptm.FailActiveDownload("Downloading response body", err) // cancel entire transfer because this chunk has failed
 			return
@@ -66,8 +71,8 @@ func (bd *azureFilesDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, s
 		// Verify that the file has not been changed via a client side LMT check
 		getLocation := get.LastModified().Location()
 		if !get.LastModified().Equal(jptm.LastModifiedTime().In(getLocation)) {
-			jptm.FailActiveDownload("Azure File modified during transfer",
-				errors.New("Azure File modified during transfer"))
+			jptm.FailActiveDownloadWithStatus("Azure File modified during transfer",
+				errors.New("Azure File modified during transfer"), jptm.SourceChangedStatus())
 		}
 
 		// step 2: Enqueue the response body to be written out to disk
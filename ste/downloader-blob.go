@@ -101,7 +101,7 @@ func (bd *blobDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, srcPipe
 		isOldStyleDiskExport := isInLegacyDiskExportAccount(*u)
 
 		// set access conditions, to protect against inconsistencies from changes-while-being-read
-		accessConditions := azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfUnmodifiedSince: jptm.LastModifiedTime()}}
+		accessConditions := sourceUnchangedConditions(jptm.LastModifiedTime(), info.SrcETag)
 		if isNewStyleImpExp || isOldStyleDiskExport {
 			// no access conditions (and therefore no if-modified checks) are supported on managed disk import/export (md-impexp)
 			// They are also unsupported on old "md-" style export URLs on the new (2019) large size disks.
@@ -116,6 +116,11 @@ func (bd *blobDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, srcPipe
 		enrichedContext := withRetryNotification(jptm.Context(), bd.filePacer)
 		get, err := srcBlobURL.Download(enrichedContext, id.OffsetInFile(), length, accessConditions, false)
 		if err != nil {
+			if isSourceConditionNotMet(err) {
+				// the blob was modified after the transfer was scheduled, so the source change policy decides the outcome
+				jptm.FailActiveDownloadWithStatus("Blob modified during transfer", err, jptm.SourceChangedStatus())
+				return
+			}
 			jptm.FailActiveDownload("Downloading response body", err) // cancel entire transfer because this chunk has failed
 			return
 		}
@@ -70,8 +70,8 @@ func (bd *blobFSDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, srcPi
 
 		// Verify that the file has not been changed via a client side LMT check
 		if !remoteLastModified.Equal(jptm.LastModifiedTime().In(remoteLmtLocation)) {
-			jptm.FailActiveDownload("BFS File modified during transfer",
-				errors.New("BFS File modified during transfer"))
+			jptm.FailActiveDownloadWithStatus("BFS File modified during transfer",
+				errors.New("BFS File modified during transfer"), jptm.SourceChangedStatus())
 		}
 
 		// step 2: Enqueue the response body to be written out to disk
@@ -0,0 +1,94 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// localFileDownloader "downloads" from a file on a local disk or NAS mount, so that copies between local paths
+// can use the same chunked, concurrent writing as real downloads. It also reads blobs from the download cache.
+type localFileDownloader struct {
+	cachedPath string // the entry of the download cache to read, rather than the source
+	file       *os.File
+	openErr    error
+}
+
+func newLocalFileDownloader() downloader {
+	return &localFileDownloader{}
+}
+
+func (ld *localFileDownloader) Prologue(jptm IJobPartTransferMgr, srcPipeline pipeline.Pipeline) {
+	info := jptm.Info()
+	if ld.cachedPath != "" {
+		// the cached content is that of the blob with the ETag or MD5 hash of the source, as it was enumerated
+		ld.file, ld.openErr = os.Open(ld.cachedPath)
+		return
+	}
+	ld.file, ld.openErr = os.Open(info.Source)
+	if ld.openErr != nil {
+		return
+	}
+
+	// Verify that the file has not been changed since it was enumerated
+	fi, err := ld.file.Stat()
+	if err != nil {
+		ld.openErr = err
+		return
+	}
+	if !fi.ModTime().Equal(jptm.LastModifiedTime()) || fi.Size() != int64(info.SourceSize) {
+		jptm.FailActiveDownloadWithStatus("Local file modified during transfer",
+			errors.New("local file modified during transfer"), jptm.SourceChangedStatus())
+	}
+}
+
+func (ld *localFileDownloader) Epilogue() {
+	if ld.file != nil {
+		_ = ld.file.Close()
+	}
+}
+
+// GenerateDownloadFunc returns a chunk-func that reads its range of the source file
+func (ld *localFileDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, srcPipeline pipeline.Pipeline, destWriter common.ChunkedFileWriter, id common.ChunkID, length int64, pacer pacer) chunkFunc {
+	return createDownloadChunkFunc(jptm, id, func() {
+		if ld.openErr != nil {
+			jptm.FailActiveDownload("Opening source file", ld.openErr)
+			return
+		}
+
+		// ReadAt is safe for concurrent use, so each chunk can read its own section of the one open file.
+		// There is no connection that could stall, so the read is not retryable
+		jptm.LogChunkStatus(id, common.EWaitReason.Body())
+		body := ioutil.NopCloser(io.NewSectionReader(ld.file, id.OffsetInFile(), length))
+		err := destWriter.EnqueueChunk(jptm.Context(), id, length, newPacedResponseBody(jptm.Context(), body, pacer), false)
+		if err != nil {
+			jptm.FailActiveDownload("Enqueuing chunk", err)
+			return
+		}
+	})
+}
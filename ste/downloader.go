@@ -51,3 +51,9 @@ func createDownloadChunkFunc(jptm IJobPartTransferMgr, id common.ChunkID, body f
 	// by the ChunkedFileWriter. (The ChunkedFileWriter will set the status to done at that time.)
 	return createChunkFunc(false, jptm, id, body)
 }
+
+// createAlreadySavedChunkFunc is for chunks that were saved by an earlier attempt at the same download.
+// There's nothing to do, except count them as done.
+func createAlreadySavedChunkFunc(jptm IJobPartTransferMgr, id common.ChunkID) chunkFunc {
+	return createChunkFunc(true, jptm, id, func() {})
+}
@@ -0,0 +1,241 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const eventGridTransferCompletedEventType = "Microsoft.AzCopy.TransferCompleted"
+const eventGridDataVersion = "1.0"
+
+// eventGridEvent is a single event, in the Event Grid event schema, describing an object that has landed at the destination
+type eventGridEvent struct {
+	ID          string                 `json:"id"`
+	EventType   string                 `json:"eventType"`
+	Subject     string                 `json:"subject"`
+	EventTime   string                 `json:"eventTime"`
+	Data        transferCompletedEvent `json:"data"`
+	DataVersion string                 `json:"dataVersion"`
+}
+
+type transferCompletedEvent struct {
+	JobID       string `json:"jobId"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+	// the MD5 hash that the source has stored for its content, if it has one. It's not computed from the data that was transferred
+	SourceContentMD5 string `json:"sourceContentMD5,omitempty"`
+}
+
+// completionNotifier tells downstream systems about each object that has been successfully transferred,
+// so that they can start processing it without waiting for the whole job to finish
+type completionNotifier interface {
+	NotifyTransferCompleted(jobID common.JobID, source, destination string, size int64, sourceContentMD5 []byte)
+	Flush()
+}
+
+type nullCompletionNotifier struct{}
+
+func (nullCompletionNotifier) NotifyTransferCompleted(common.JobID, string, string, int64, []byte) {}
+func (nullCompletionNotifier) Flush()                                                              {}
+
+// newCompletionNotifier returns a notifier that publishes to the Event Grid topic named in the environment,
+// or one that does nothing if no topic has been configured
+func newCompletionNotifier(client *http.Client, logger common.ILogger) completionNotifier {
+	lcm := common.GetLifecycleMgr()
+	endpoint := lcm.GetEnvironmentVariable(common.EEnvironmentVariable.EventGridTopicEndpoint())
+	if endpoint == "" {
+		return nullCompletionNotifier{}
+	}
+
+	batchSize, err := strconv.Atoi(lcm.GetEnvironmentVariable(common.EEnvironmentVariable.EventGridBatchSize()))
+	if err != nil || batchSize < 1 {
+		batchSize = 1
+	}
+
+	return newEventGridNotifier(endpoint, lcm.GetEnvironmentVariable(common.EEnvironmentVariable.EventGridTopicKey()), batchSize, client, logger)
+}
+
+type eventGridNotifier struct {
+	endpoint  string
+	key       string
+	batchSize int
+	client    *http.Client
+	logger    common.ILogger
+
+	lock    sync.Mutex
+	pending []eventGridEvent
+
+	// full batches are published one at a time, in order, by a single sender. Once the queue is full, the transfers that
+	// complete wait for room in it, rather than each starting a request of its own.
+	// The sender is started by the first batch, and stopped by Flush, so that it doesn't outlive the job.
+	// Batches are queued with senderLock held for reading, so that Flush, which holds it for writing, can close the queue
+	senderLock sync.RWMutex
+	startLock  sync.Mutex
+	queue      chan []eventGridEvent // nil while there's no sender
+	senderDone chan struct{}
+}
+
+// eventGridQueueLength is how many full batches may wait for the sender
+const eventGridQueueLength = 100
+
+func newEventGridNotifier(endpoint, key string, batchSize int, client *http.Client, logger common.ILogger) *eventGridNotifier {
+	n := &eventGridNotifier{
+		endpoint:  endpoint,
+		key:       key,
+		batchSize: batchSize,
+		client:    client,
+		logger:    logger,
+	}
+	return n
+}
+
+// send publishes the queued batches, until the queue is closed
+func (n *eventGridNotifier) send(queue chan []eventGridEvent, done chan struct{}) {
+	for batch := range queue {
+		n.publish(batch)
+	}
+	close(done)
+}
+
+func (n *eventGridNotifier) enqueue(batch []eventGridEvent) {
+	n.senderLock.RLock()
+	defer n.senderLock.RUnlock()
+
+	n.startLock.Lock()
+	if n.queue == nil {
+		n.queue = make(chan []eventGridEvent, eventGridQueueLength)
+		n.senderDone = make(chan struct{})
+		go n.send(n.queue, n.senderDone)
+	}
+	queue := n.queue
+	n.startLock.Unlock()
+
+	queue <- batch
+}
+
+func (n *eventGridNotifier) NotifyTransferCompleted(jobID common.JobID, source, destination string, size int64, sourceContentMD5 []byte) {
+	dst := stripResourceQuery(destination)
+	e := eventGridEvent{
+		ID:        common.NewUUID().String(),
+		EventType: eventGridTransferCompletedEventType,
+		Subject:   dst,
+		EventTime: time.Now().UTC().Format(time.RFC3339Nano),
+		Data: transferCompletedEvent{
+			JobID:       jobID.String(),
+			Source:      stripResourceQuery(source),
+			Destination: dst,
+			Size:        size,
+		},
+		DataVersion: eventGridDataVersion,
+	}
+	if len(sourceContentMD5) > 0 {
+		e.Data.SourceContentMD5 = base64.StdEncoding.EncodeToString(sourceContentMD5)
+	}
+
+	n.lock.Lock()
+	n.pending = append(n.pending, e)
+	var batch []eventGridEvent
+	if len(n.pending) >= n.batchSize {
+		batch = n.pending
+		n.pending = nil
+	}
+	n.lock.Unlock()
+
+	if batch != nil {
+		n.enqueue(batch)
+	}
+}
+
+// Flush publishes any partially-filled batch, waits until it and all earlier batches have been sent, and stops the sender.
+// A later batch, e.g. from a job that is resumed, starts a new one
+func (n *eventGridNotifier) Flush() {
+	n.lock.Lock()
+	batch := n.pending
+	n.pending = nil
+	n.lock.Unlock()
+
+	if len(batch) > 0 {
+		n.enqueue(batch)
+	}
+
+	n.senderLock.Lock()
+	defer n.senderLock.Unlock()
+	if n.queue != nil {
+		close(n.queue)
+		<-n.senderDone
+		n.queue = nil
+	}
+}
+
+// publish makes a best-effort attempt to send the events. Failure to notify must not fail the transfers themselves,
+// so errors are only logged
+func (n *eventGridNotifier) publish(batch []eventGridEvent) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		n.logFailure(err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.endpoint, bytes.NewReader(body))
+	if err != nil {
+		n.logFailure(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("aeg-sas-key", n.key)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		n.logFailure(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		n.logFailure(fmt.Errorf("the topic returned status %s", resp.Status))
+	}
+}
+
+func (n *eventGridNotifier) logFailure(err error) {
+	n.logger.Log(pipeline.LogWarning, fmt.Sprintf("Failed to publish completion events to Event Grid: %v", err))
+}
+
+// stripResourceQuery removes the query string, since it may hold a SAS, which must never be sent to a third party or displayed
+func stripResourceQuery(resource string) string {
+	u, err := url.Parse(resource)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return resource
+	}
+	u.RawQuery = ""
+	return u.String()
+}
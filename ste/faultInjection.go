@@ -0,0 +1,281 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+)
+
+const (
+	defaultFaultSlowDelay  = 30 * time.Second
+	defaultFaultSkewOffset = time.Hour
+)
+
+type faultKind int
+
+const (
+	noFault faultKind = iota
+	faultServerBusy
+	faultSlowRead
+	faultTruncatedBody
+	faultClockSkew
+)
+
+func (k faultKind) String() string {
+	switch k {
+	case faultServerBusy:
+		return "503"
+	case faultSlowRead:
+		return "slow"
+	case faultTruncatedBody:
+		return "truncate"
+	case faultClockSkew:
+		return "skew"
+	}
+	return "none"
+}
+
+// faultInjector injects faults into the requests of the transfer engine, at the rates given in AZCOPY_FAULT_INJECTION, so that
+// users and developers can see how retries and resumes behave with their configurations before production runs. The faults are
+// injected next to the wire, so that everything above (retries, logging, the stats that tune concurrency) sees them as real:
+//   - 503: the request isn't sent, and the service is said to be busy
+//   - slow: the response is held back by slow-delay, before its body (if any) can be read
+//   - truncate: a response body ends, with an error, halfway through
+//   - skew: the request isn't sent, and the SAS is said to be out of its time frame, as it is when the local clock is wrong.
+//     The Date of the response is skew-offset behind the local clock, so that the failure is explained by clock skew
+type faultInjector struct {
+	rates      map[faultKind]float64
+	slowDelay  time.Duration
+	skewOffset time.Duration
+	config     string
+
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+var faultInjection *faultInjector // nil unless faults are to be injected
+
+// SetFaultInjection sets up the injection of faults from the value of AZCOPY_FAULT_INJECTION. Empty means no faults
+func SetFaultInjection(config string) error {
+	if strings.TrimSpace(config) == "" {
+		faultInjection = nil
+		return nil
+	}
+	f, err := parseFaultInjection(config)
+	if err != nil {
+		return err
+	}
+	faultInjection = f
+	return nil
+}
+
+// FaultInjectionEnabled says whether faults are being injected, so that the user can be told
+func FaultInjectionEnabled() bool {
+	return faultInjection != nil
+}
+
+func parseFaultInjection(config string) (*faultInjector, error) {
+	f := &faultInjector{rates: make(map[faultKind]float64), slowDelay: defaultFaultSlowDelay, skewOffset: defaultFaultSkewOffset, config: config}
+	seed := time.Now().UnixNano()
+	total := 0.0
+
+	for _, item := range strings.Split(config, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("'%s' is not of the form kind=value", item)
+		}
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+
+		var err error
+		switch key {
+		case "slow-delay":
+			f.slowDelay, err = time.ParseDuration(value)
+		case "skew-offset":
+			f.skewOffset, err = time.ParseDuration(value)
+		case "seed":
+			seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			kind := noFault
+			for _, k := range []faultKind{faultServerBusy, faultSlowRead, faultTruncatedBody, faultClockSkew} {
+				if key == k.String() {
+					kind = k
+				}
+			}
+			if kind == noFault {
+				return nil, fmt.Errorf("unknown fault '%s'. Faults are 503, slow, truncate and skew", key)
+			}
+			var rate float64
+			if rate, err = strconv.ParseFloat(value, 64); err == nil && (rate < 0 || rate > 1) {
+				err = errors.New("the rate must be between 0 and 1")
+			}
+			f.rates[kind] = rate
+			total += rate
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+	}
+
+	if total > 1 {
+		return nil, errors.New("the rates of the faults add up to more than 1")
+	}
+	f.rand = rand.New(rand.NewSource(seed))
+	return f, nil
+}
+
+// choose picks the fault, if any, for a request. At most one fault is injected into each
+func (f *faultInjector) choose() faultKind {
+	f.lock.Lock()
+	r := f.rand.Float64()
+	f.lock.Unlock()
+
+	for _, k := range []faultKind{faultServerBusy, faultSlowRead, faultTruncatedBody, faultClockSkew} {
+		if r < f.rates[k] {
+			return k
+		}
+		r -= f.rates[k]
+	}
+	return noFault
+}
+
+// do sends the request with send, unless a fault stops it being sent, and then injects the fault, if any, into the response
+func (f *faultInjector) do(ctx context.Context, request pipeline.Request, send func() (*http.Response, error)) (*http.Response, error) {
+	fault := f.choose()
+	switch fault {
+	case faultServerBusy:
+		f.log(fault, request)
+		return faultResponse(request, http.StatusServiceUnavailable, "ServerBusy",
+			"The server is busy. (Injected by AzCopy fault injection.)", time.Now()), nil
+	case faultClockSkew:
+		f.log(fault, request)
+		now := time.Now()
+		return faultResponse(request, http.StatusForbidden, "AuthenticationFailed",
+			fmt.Sprintf("Server failed to authenticate the request. (Injected by AzCopy fault injection.)\nAuthenticationErrorDetail: Signature not valid in the specified time frame: Current [%s]",
+				now.Add(-f.skewOffset).UTC().Format(http.TimeFormat)), now.Add(-f.skewOffset)), nil
+	}
+
+	resp, err := send()
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	switch fault {
+	case faultSlowRead:
+		f.log(fault, request)
+		if resp.Body != nil && resp.Body != http.NoBody && resp.ContentLength != 0 {
+			resp.Body = &slowFaultBody{ReadCloser: resp.Body, ctx: ctx, delay: f.slowDelay}
+		} else {
+			select {
+			case <-ctx.Done():
+				resp.Body.Close()
+				return nil, ctx.Err()
+			case <-time.After(f.slowDelay):
+			}
+		}
+	case faultTruncatedBody:
+		// only bodies that carry data can be cut short
+		if resp.StatusCode/100 == 2 && resp.Body != nil && resp.ContentLength > 1 {
+			f.log(fault, request)
+			resp.Body = &truncatedFaultBody{ReadCloser: resp.Body, remaining: resp.ContentLength / 2}
+		}
+	}
+	return resp, nil
+}
+
+func (f *faultInjector) log(fault faultKind, request pipeline.Request) {
+	if JobsAdmin != nil {
+		JobsAdmin.LogToJobLog(fmt.Sprintf("Fault injection: %s fault for %s %s", fault, request.Method, request.URL.Path))
+	}
+}
+
+// faultResponse makes a response like the ones the service gives for errors
+func faultResponse(request pipeline.Request, status int, code string, message string, date time.Time) *http.Response {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	header.Set("x-ms-error-code", code)
+	header.Set("Date", date.UTC().Format(http.TimeFormat))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request.Request,
+	}
+}
+
+// slowFaultBody holds back the first read of a body
+type slowFaultBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	delay   time.Duration
+	delayed bool
+}
+
+func (b *slowFaultBody) Read(p []byte) (int, error) {
+	if !b.delayed {
+		b.delayed = true
+		select {
+		case <-b.ctx.Done():
+			return 0, b.ctx.Err()
+		case <-time.After(b.delay):
+		}
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// truncatedFaultBody ends a body early, the way a connection that drops does
+type truncatedFaultBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedFaultBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,141 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// how many directories are created at once, when creating them eagerly
+const eagerFolderCreationParallelism = 32
+
+// createFoldersEagerly creates all the directories that this part's transfers will write into, before any of the transfers start,
+// so that the transfers can then write files in parallel without waiting for their directories.
+// Only local and Azure Files destinations have directories that need creating.  Any directory that can't be created here
+// is left to be created as usual, when the first file in it is transferred
+func (jpm *jobPartMgr) createFoldersEagerly(ctx context.Context) {
+	plan := jpm.Plan()
+
+	var create func(dir string) error
+	switch plan.FromTo.To() {
+	case common.ELocation.Local():
+		create = func(dir string) error {
+			return os.MkdirAll(dir, os.ModePerm)
+		}
+	case common.ELocation.File():
+		_, dstSAS := jpm.SAS()
+		create = func(dir string) error {
+			u, err := url.Parse(dir)
+			if err != nil {
+				return err
+			}
+			if len(dstSAS) > 0 {
+				if len(u.RawQuery) > 0 {
+					u.RawQuery += "&" + dstSAS
+				} else {
+					u.RawQuery = dstSAS
+				}
+			}
+			return AzureFileParentDirCreator{}.ensureDirExists(ctx, azfile.NewDirectoryURL(*u, jpm.pipeline), jpm.pipeline)
+		}
+	default:
+		return
+	}
+
+	dirs := jpm.destinationFolders()
+	start := time.Now()
+	var failed int32
+	dirCh := make(chan string)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < eagerFolderCreationParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range dirCh {
+				if err := create(dir); err != nil && ctx.Err() == nil {
+					atomic.AddInt32(&failed, 1)
+					jpm.Log(pipeline.LogWarning, fmt.Sprintf("Could not create directory %s ahead of its files, so it will be created with the first of them: %v", dir, err))
+				}
+			}
+		}()
+	}
+	for _, dir := range dirs { // sorted, so parents tend to be created before their children
+		dirCh <- dir
+	}
+	close(dirCh)
+	wg.Wait()
+
+	jpm.Log(pipeline.LogInfo, fmt.Sprintf("Created %d directories ahead of their files, in %v (%d failed)",
+		len(dirs)-int(failed), time.Since(start).Round(time.Millisecond), failed))
+}
+
+// destinationFolders lists, in sorted order and without duplicates, the directories that this part's unfinished transfers write into
+func (jpm *jobPartMgr) destinationFolders() []string {
+	plan := jpm.Plan()
+	toLocal := plan.FromTo.To() == common.ELocation.Local()
+
+	seen := make(map[string]struct{})
+	for t := uint32(0); t < plan.NumTransfers; t++ {
+		if plan.Transfer(t).TransferStatus() == common.ETransferStatus.Success() {
+			continue
+		}
+		_, dst := plan.TransferSrcDstStrings(t)
+		var dir string
+		if toLocal {
+			if strings.EqualFold(dst, common.Dev_Null) {
+				continue
+			}
+			dir = filepath.Dir(dst)
+		} else {
+			u, err := url.Parse(dst)
+			if err != nil {
+				continue // the transfer will report this itself
+			}
+			parent := AzureFileParentDirCreator{}.getParentURL(*u)
+			if azfile.NewFileURLParts(parent).DirectoryOrFilePath == "" {
+				continue // directly in the share
+			}
+			dir = parent.String()
+		}
+		seen[dir] = struct{}{}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
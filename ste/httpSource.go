@@ -0,0 +1,476 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// httpReadAheadRanges is how many ranges of an HTTP source are fetched in parallel, ahead of being read.
+// Each one is a chunk of the transfer, held in memory until it's read, so they are only fetched when the RAM limit allows
+const httpReadAheadRanges = 4
+
+// NewHTTPSourcePipeline creates a pipeline for requests to a file on any HTTP(S) server.
+// Unlike the pipelines of the storage services, it adds no credential or service headers, since the server is unknown to us
+func NewHTTPSourcePipeline(o azblob.PipelineOptions, r XferRetryOptions, client *http.Client, statsAcc *pipelineNetworkStats) pipeline.Pipeline {
+	// Closest to API goes first; closest to the wire goes last
+	f := []pipeline.Factory{
+		azblob.NewTelemetryPolicyFactory(o.Telemetry),
+		NewBlobXferRetryPolicyFactory(r),    // actually retry the operation
+		newRetryNotificationPolicyFactory(), // record that a retry status was returned
+		pipeline.MethodFactoryMarker(),      // indicates at what stage in the pipeline the method factory is invoked
+		NewRequestLogPolicyFactory(RequestLogOptions{LogWarningIfTryOverThreshold: o.RequestLog.LogWarningIfTryOverThreshold}),
+		newXferStatsPolicyFactory(statsAcc),
+	}
+	return pipeline.NewPipeline(f, pipeline.Options{HTTPSender: newAzcopyHTTPClientFactory(client), Log: o.Log})
+}
+
+// httpSourceStatusError is a response from an HTTP source that's worth trying again, e.g. when the server is busy.
+// It's a net.Error, so that the retry policy retries it, as it does network errors
+type httpSourceStatusError struct {
+	statusCode int
+	status     string
+}
+
+func (e httpSourceStatusError) Error() string {
+	return "the HTTP source responded with " + e.status
+}
+
+func (e httpSourceStatusError) Timeout() bool {
+	return false
+}
+
+func (e httpSourceStatusError) Temporary() bool {
+	return true
+}
+
+// httpSourceResponder turns responses that aren't successes into errors: temporary ones for throttling and server errors,
+// which are retried, and permanent ones for the rest
+var httpSourceResponder = pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+	return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+		response, err := next.Do(ctx, request)
+		if err != nil || response == nil || response.Response() == nil {
+			return response, err
+		}
+		resp := response.Response()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return response, nil
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return response, httpSourceStatusError{statusCode: resp.StatusCode, status: resp.Status}
+		}
+		if resp.StatusCode == http.StatusPreconditionFailed {
+			return response, errHTTPSourceModified
+		}
+		return response, fmt.Errorf("the HTTP source responded with %s", resp.Status)
+	}
+})
+
+// errHTTPSourceModified is the error of a request that was conditional on the file being the version that was being read
+var errHTTPSourceModified = errors.New("the HTTP source was modified during the transfer")
+
+// HTTPSourceProperties are what the server tells us about a file on it
+type HTTPSourceProperties struct {
+	Size            int64
+	LastModified    time.Time // zero if the server didn't say
+	SupportsRanges  bool      // as far as the server says; the reader finds out for sure
+	ContentType     string
+	ContentEncoding string
+	ContentLanguage string
+	Disposition     string
+	CacheControl    string
+	ContentMD5      []byte // nil if the server didn't give the MD5 hash of the file
+	ETag            string // empty if the server didn't say
+}
+
+// version is what every range of the file is read on the condition of, so that a file that changes during a transfer
+// fails it, rather than some of its chunks coming from one version and the rest from another
+func (props HTTPSourceProperties) version() httpSourceVersion {
+	v := httpSourceVersion{lastModified: props.LastModified}
+	if !strings.HasPrefix(props.ETag, "W/") {
+		v.eTag = props.ETag // a weak ETag never matches an If-Match
+	}
+	return v
+}
+
+// httpSourceVersion identifies a version of a file on an HTTP server. Either part may be missing, since not all servers give them
+type httpSourceVersion struct {
+	eTag         string
+	lastModified time.Time
+}
+
+// setConditions makes a request conditional on the file still being this version, as precisely as the server allows
+func (v httpSourceVersion) setConditions(header http.Header) {
+	if v.eTag != "" {
+		header.Set("If-Match", v.eTag)
+	} else if !v.lastModified.IsZero() {
+		header.Set("If-Unmodified-Since", v.lastModified.Format(http.TimeFormat))
+	}
+}
+
+// GetHTTPSourceProperties gets the properties of a file on an HTTP(S) server with a HEAD request,
+// or with a GET of its first byte for servers that don't answer HEAD requests or don't give the size in them
+func GetHTTPSourceProperties(ctx context.Context, p pipeline.Pipeline, u url.URL) (HTTPSourceProperties, error) {
+	resp, err := doHTTPSourceRequest(ctx, p, http.MethodHead, u, "", httpSourceVersion{})
+	if err == nil {
+		_ = resp.Body.Close()
+		if resp.ContentLength >= 0 {
+			return httpSourcePropertiesFromResponse(resp, resp.ContentLength), nil
+		}
+	}
+
+	resp, err = doHTTPSourceRequest(ctx, p, http.MethodGet, u, "bytes=0-0", httpSourceVersion{})
+	if err != nil {
+		return HTTPSourceProperties{}, err
+	}
+	defer resp.Body.Close()
+
+	size := resp.ContentLength
+	if resp.StatusCode == http.StatusPartialContent {
+		if _, size, err = parseContentRange(resp.Header.Get("Content-Range")); err != nil {
+			return HTTPSourceProperties{}, err
+		}
+	}
+	if size < 0 {
+		return HTTPSourceProperties{}, errors.New("the HTTP source didn't give the size of the file")
+	}
+	props := httpSourcePropertiesFromResponse(resp, size)
+	props.SupportsRanges = resp.StatusCode == http.StatusPartialContent
+	return props, nil
+}
+
+func httpSourcePropertiesFromResponse(resp *http.Response, size int64) HTTPSourceProperties {
+	props := HTTPSourceProperties{
+		Size:            size,
+		SupportsRanges:  strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes"),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		ContentLanguage: resp.Header.Get("Content-Language"),
+		Disposition:     resp.Header.Get("Content-Disposition"),
+		CacheControl:    resp.Header.Get("Cache-Control"),
+		ContentMD5:      httpSourceMD5(resp.Header),
+		ETag:            resp.Header.Get("ETag"),
+	}
+	if lmt, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		props.LastModified = lmt.UTC()
+	}
+	return props
+}
+
+// httpSourceMD5 gets the MD5 hash of a file from the headers of the server, if it gives one, so that the file can be verified as it's read.
+// Most servers give it as Content-MD5, but Google Cloud Storage gives it in x-goog-hash, e.g. crc32c=n03x6A==,md5=Ojk9c3dhfxgoKVVHYwFbHQ==
+func httpSourceMD5(header http.Header) []byte {
+	encoded := header.Get("Content-MD5")
+	if encoded == "" {
+		for _, value := range header["X-Goog-Hash"] {
+			for _, hash := range strings.Split(value, ",") {
+				if hash = strings.TrimSpace(hash); strings.HasPrefix(hash, "md5=") {
+					encoded = strings.TrimPrefix(hash, "md5=")
+				}
+			}
+		}
+	}
+
+	md5, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(md5) != 16 {
+		return nil // not a hash we can check against, so the file is copied without being verified
+	}
+	return md5
+}
+
+// parseContentRange parses the Content-Range header of a partial response, e.g. bytes 0-1023/4096.
+// The total size is -1 if the server doesn't know it
+func parseContentRange(header string) (start int64, total int64, err error) {
+	invalid := fmt.Errorf("the HTTP source gave an invalid Content-Range %q", header)
+
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, invalid
+	}
+	parts := strings.Split(strings.TrimPrefix(header, "bytes "), "/")
+	if len(parts) != 2 {
+		return 0, 0, invalid
+	}
+	bounds := strings.Split(parts[0], "-")
+	if len(bounds) != 2 {
+		return 0, 0, invalid
+	}
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return 0, 0, invalid
+	}
+	if parts[1] == "*" {
+		return start, -1, nil
+	}
+	if total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, invalid
+	}
+	return start, total, nil
+}
+
+// doHTTPSourceRequest sends a request to an HTTP source, for a range of the file if one is given,
+// and on the condition that the file is still the given version, if one is.
+// The response is always a success; the caller must close its body
+func doHTTPSourceRequest(ctx context.Context, p pipeline.Pipeline, method string, u url.URL, byteRange string, version httpSourceVersion) (*http.Response, error) {
+	request, err := pipeline.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		request.Header.Set("Range", byteRange)
+	}
+	version.setConditions(request.Header)
+	response, err := p.Do(ctx, httpSourceResponder, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.Response(), nil
+}
+
+// httpRangeReader reads a file on an HTTP(S) server, for the chunks of a transfer.
+// The chunks are read in order, one at a time, so to keep the transfer from being limited by the latency of each request,
+// the reader fetches the next few ranges in parallel, ahead of being asked for them. Whether the server supports ranges
+// is only known for sure from its first response: if it sends the whole file instead of the range, the reader
+// falls back to reading that one response in order, which is as parallel as such a server allows.
+// Every request is conditional on the file still being the version it started as
+type httpRangeReader struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	p            pipeline.Pipeline
+	u            url.URL
+	size         int64
+	version      httpSourceVersion
+	cacheLimiter common.CacheLimiter // for the ranges fetched ahead. May be nil
+
+	atomicRangesConfirmed int32 // set once the server has answered with a range
+
+	mu        sync.Mutex
+	ahead     map[int64]*httpRangeFetch // by offset
+	stream    io.ReadCloser             // the whole file, from a server that doesn't support ranges
+	streamPos int64
+}
+
+// httpRangeFetch is a range that's being fetched
+type httpRangeFetch struct {
+	offset   int64
+	length   int
+	reserved bool // in the cache limiter
+	done     chan struct{}
+	data     []byte
+	whole    io.ReadCloser // instead of data, if the server sent the whole file
+	err      error
+}
+
+func newHTTPRangeReader(ctx context.Context, p pipeline.Pipeline, u url.URL, size int64, version httpSourceVersion, cacheLimiter common.CacheLimiter) *httpRangeReader {
+	ctx, cancel := context.WithCancel(ctx)
+	return &httpRangeReader{ctx: ctx, cancel: cancel, p: p, u: u, size: size, version: version, cacheLimiter: cacheLimiter, ahead: make(map[int64]*httpRangeFetch)}
+}
+
+func (r *httpRangeReader) ReadAt(b []byte, off int64) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if off+int64(len(b)) > r.size {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	r.mu.Lock()
+	if r.stream != nil {
+		defer r.mu.Unlock()
+		return r.readStream(b, off)
+	}
+	f, ok := r.ahead[off]
+	if ok {
+		delete(r.ahead, off)
+		if f.length != len(b) {
+			r.discard(f)
+			ok = false
+		}
+	}
+	if !ok {
+		f = r.startFetch(off, len(b))
+	}
+	if atomic.LoadInt32(&r.atomicRangesConfirmed) == 1 {
+		r.readAhead(off+int64(len(b)), len(b))
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-r.ctx.Done():
+		r.discard(f)
+		return 0, r.ctx.Err()
+	}
+	r.release(f)
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.whole != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.closeStream()
+		r.stream, r.streamPos = f.whole, 0
+		return r.readStream(b, off)
+	}
+	return copy(b, f.data), nil
+}
+
+// readAhead starts fetching the ranges after the one just read, assuming they are the same length. Must be called with the lock held
+func (r *httpRangeReader) readAhead(next int64, length int) {
+	for i := 0; i < httpReadAheadRanges && next < r.size; i++ {
+		if int64(length) > r.size-next {
+			length = int(r.size - next)
+		}
+		if _, ok := r.ahead[next]; !ok {
+			if r.cacheLimiter != nil && !r.cacheLimiter.TryAdd(int64(length), false) {
+				return // no RAM to spare, so the ranges will be fetched when they're read
+			}
+			f := r.startFetch(next, length)
+			f.reserved = r.cacheLimiter != nil
+			r.ahead[next] = f
+		}
+		next += int64(length)
+	}
+}
+
+func (r *httpRangeReader) startFetch(off int64, length int) *httpRangeFetch {
+	f := &httpRangeFetch{offset: off, length: length, done: make(chan struct{})}
+	go r.fetch(f)
+	return f
+}
+
+func (r *httpRangeReader) fetch(f *httpRangeFetch) {
+	defer close(f.done)
+
+	resp, err := doHTTPSourceRequest(r.ctx, r.p, http.MethodGet, r.u, fmt.Sprintf("bytes=%d-%d", f.offset, f.offset+int64(f.length)-1), r.version)
+	if err != nil {
+		f.err = err
+		return
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		f.whole = resp.Body // the server ignored the range
+		return
+	}
+	defer resp.Body.Close()
+
+	if start, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil {
+		f.err = err
+		return
+	} else if start != f.offset {
+		f.err = fmt.Errorf("the HTTP source sent the range from %d, rather than the one asked for, from %d", start, f.offset)
+		return
+	}
+	f.data = make([]byte, f.length)
+	if _, f.err = io.ReadFull(resp.Body, f.data); f.err == nil {
+		atomic.StoreInt32(&r.atomicRangesConfirmed, 1)
+	}
+}
+
+// readStream reads from the response with the whole file, which can only go forwards; to go back, e.g. to retry a chunk,
+// the file is requested again. Must be called with the lock held
+func (r *httpRangeReader) readStream(b []byte, off int64) (int, error) {
+	if off < r.streamPos {
+		r.closeStream()
+		resp, err := doHTTPSourceRequest(r.ctx, r.p, http.MethodGet, r.u, "", r.version)
+		if err != nil {
+			return 0, err
+		}
+		r.stream, r.streamPos = resp.Body, 0
+	}
+	if off > r.streamPos {
+		skipped, err := io.CopyN(ioutil.Discard, r.stream, off-r.streamPos)
+		r.streamPos += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(r.stream, b)
+	r.streamPos += int64(n)
+	return n, err
+}
+
+func (r *httpRangeReader) closeStream() {
+	if r.stream != nil {
+		_ = r.stream.Close()
+		r.stream = nil
+	}
+}
+
+// release gives back the RAM of a range fetched ahead, once it has been read
+func (r *httpRangeReader) release(f *httpRangeFetch) {
+	if f.reserved {
+		f.reserved = false
+		r.cacheLimiter.Remove(int64(f.length))
+	}
+}
+
+// discard throws away a range that won't be read, once it has been fetched
+func (r *httpRangeReader) discard(f *httpRangeFetch) {
+	go func() {
+		<-f.done
+		r.release(f)
+		if f.whole != nil {
+			_ = f.whole.Close()
+		}
+	}()
+}
+
+// Close stops the ranges being fetched ahead, and releases what they hold
+func (r *httpRangeReader) Close() error {
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeStream()
+	for off, f := range r.ahead {
+		delete(r.ahead, off)
+		r.discard(f)
+	}
+	return nil
+}
+
+// httpSourceURL parses the source of a transfer from an HTTP source
+func httpSourceURL(source string) (url.URL, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return url.URL{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return url.URL{}, fmt.Errorf("the source %s is not an HTTP(S) URL", common.URLStringExtension(source).RedactSecretQueryParamForLogging())
+	}
+	return *u, nil
+}
@@ -124,6 +124,24 @@ func MainSTE(concurrency ConcurrencySettings, targetRateInMegaBitsPerSec int64,
 			deserialize(request, &payload)
 			serialize(GetJobFromTo(payload), writer)
 		})
+	http.HandleFunc(common.ERpcCmd.GetJobStatus().Pattern(),
+		func(writer http.ResponseWriter, request *http.Request) {
+			var payload common.GetJobStatusRequest
+			deserialize(request, &payload)
+			serialize(GetJobStatus(payload), writer)
+		})
+	http.HandleFunc(common.ERpcCmd.VerifyJob().Pattern(),
+		func(writer http.ResponseWriter, request *http.Request) {
+			var payload common.VerifyJobRequest
+			deserialize(request, &payload)
+			serialize(VerifyJob(payload), writer)
+		})
+	http.HandleFunc(common.ERpcCmd.SetJobCap().Pattern(),
+		func(writer http.ResponseWriter, request *http.Request) {
+			var payload common.SetJobCapRequest
+			deserialize(request, &payload)
+			serialize(SetJobCap(payload), writer)
+		})
 
 	// Listen for front-end requests
 	//if err := http.ListenAndServe("localhost:1337", nil); err != nil {
@@ -151,6 +169,10 @@ func ExecuteNewCopyJobPartOrder(order common.CopyJobPartOrderRequest) common.Cop
 		InMemoryTransitJobState{
 			credentialInfo: order.CredentialInfo,
 		})
+	jpm.getScanOverlapTracker().recordPartOrdered(jpm, order.IsFinalPart || order.ScanComplete)
+	if part0, ok := jpm.JobPartMgr(0); ok && order.PartNum != 0 {
+		part0.Plan().addJobTotalBytes(orderedBytes(order))
+	}
 	jpm.AddJobPart(order.PartNum, jppfn, order.SourceSAS, order.DestinationSAS, true) // Add this part to the Job and schedule its transfers
 	return common.CopyJobPartOrderResponse{JobStarted: true}
 }
@@ -287,11 +309,14 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 		switch jpm.Plan().FromTo {
 		case common.EFromTo.LocalBlob(),
 			common.EFromTo.LocalFile(),
-			common.EFromTo.S3Blob():
+			common.EFromTo.S3Blob(),
+			common.EFromTo.HttpBlob(),
+			common.EFromTo.SftpBlob():
 			if len(req.DestinationSAS) == 0 {
 				errorMsg = "The destination-sas switch must be provided to resume the job"
 			}
 		case common.EFromTo.BlobLocal(),
+			common.EFromTo.BlobSftp(),
 			common.EFromTo.FileLocal(),
 			common.EFromTo.BlobTrash(),
 			common.EFromTo.FileTrash():
@@ -313,6 +338,19 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 		}
 	}
 
+	// A job that was started outside FIPS mode may rely on MD5, which must not be used now.
+	// The check-md5 setting is only recorded for downloads.
+	md5Option := common.EHashValidationOption.NoCheck()
+	if jpm.Plan().FromTo.IsDownload() {
+		md5Option = jpm.Plan().DstLocalData.MD5VerificationOption
+	}
+	if err := common.ValidateHashOptionsForFIPS(jpm.Plan().DstBlobData.PutMd5, md5Option); err != nil {
+		return common.CancelPauseResumeResponse{
+			CancelledPauseResumed: false,
+			ErrorMsg:              fmt.Sprintf("cannot resume job with JobId %s. %v", req.JobID, err),
+		}
+	}
+
 	// After creating the Job mgr, set the include / exclude list of transfer.
 	jm.SetIncludeExclude(req.IncludeTransfer, req.ExcludeTransfer)
 	jpp0 := jpm.Plan()
@@ -339,6 +377,8 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 			})
 
 		jpp0.SetJobStatus(common.EJobStatus.InProgress())
+		jpp0.setEffectiveConcurrency(JobsAdmin.(*jobsAdmin).concurrency.describe()) // this run's, which may differ from the one that created the job
+		revalidateSourcesAfterAccountFailover(jm)
 
 		if jm.ShouldLog(pipeline.LogInfo) {
 			jm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v resumed", req.JobID))
@@ -416,6 +456,7 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 		panic(fmt.Errorf("error getting the 0th part of Job %s", jobID))
 	}
 	part0PlanStatus := part0.Plan().JobStatus()
+	js.Concurrency = part0.Plan().EffectiveConcurrency()
 
 	// Now iterate and count things up
 	jm.(*jobMgr).jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
@@ -450,8 +491,17 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 						TransferStatus: common.ETransferStatus.Failed(),
 						ErrorCode:      jppt.ErrorCode()}) // TODO: Optimize
 			case common.ETransferStatus.SkippedFileAlreadyExists(),
-				common.ETransferStatus.SkippedBlobHasSnapshots():
+				common.ETransferStatus.SkippedBlobHasSnapshots(),
+				common.ETransferStatus.SkippedSourceChanged(),
+				common.ETransferStatus.SkippedContentPolicy(),
+				common.ETransferStatus.SkippedInfected():
 				js.TransfersSkipped++
+				switch jppt.TransferStatus() {
+				case common.ETransferStatus.SkippedContentPolicy():
+					js.TransfersRejectedByPolicy++
+				case common.ETransferStatus.SkippedInfected():
+					js.TransfersSkippedInfected++
+				}
 				// getting the source and destination for skipped transfer at position - index
 				src, dst := jpp.TransferSrcDstStrings(t)
 				js.SkippedTransfers = append(js.SkippedTransfers,
@@ -493,8 +543,16 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 		js.AverageE2EMilliseconds = pipeStats.AverageE2EMilliseconds()
 		js.NetworkErrorPercentage = pipeStats.NetworkErrorPercentage()
 		js.ServerBusyPercentage = pipeStats.TotalServerBusyPercentage()
+		js.ConnectionReusePercentage = pipeStats.ConnectionReusePercentage()
+		js.DroppedIdleConnections = pipeStats.DroppedIdleConnections()
 	}
 
+	js.SlowestTransfers = jm.getSlowestTransferTracker().get()
+	js.SourcesDeleted, js.SourceDeletionFailures = jm.getSourceDeletionTracker().get()
+	js.ScanOverlap = jm.getScanOverlapTracker().get()
+	js.ManifestPath, js.ManifestError = jm.getManifestResult()
+	js.PolicyViolations, js.TransfersQuarantined = jm.getPolicyViolationTracker().get()
+
 	// If the status is cancelled, then no need to check for completerJobOrdered
 	// since user must have provided the consent to cancel an incompleteJob if that
 	// is the case.
@@ -578,30 +636,53 @@ func ListJobTransfers(r common.ListJobTransfersRequest) common.ListJobTransfersR
 
 // ListJobs returns the jobId of all the jobs existing in the current instance of azcopy
 func ListJobs() common.ListJobsResponse {
-	// Resurrect all the Jobs from the existing JobPart Plan files
-	JobsAdmin.ResurrectJobParts()
-	// building the ListJobsResponse for sending response back to front-end
-	jobIds := JobsAdmin.JobIDs()
-	if len(jobIds) == 0 {
-		return common.ListJobsResponse{ErrorMessage: "no jobs exists in Azcopy history"}
-	}
+	JobsAdmin.(*jobsAdmin).migrateOldPlanFiles("")
+
+	// only part 0 of each job is read, since it holds everything that is listed, including the running totals of the job
+	files, _ := listCurrentPlanFiles(JobsAdmin.(*jobsAdmin).planDir, "")
 	listJobResponse := common.ListJobsResponse{JobIDDetails: []common.JobIDDetails{}}
-	for _, jobId := range jobIds {
-		jm, found := JobsAdmin.JobMgr(jobId)
-		if !found {
+	for _, f := range files {
+		planFile := JobPartPlanFileName(f.Name())
+		jobID, partNum, err := planFile.Parse()
+		if err != nil || partNum != 0 {
 			continue
 		}
-		jpm, found := jm.JobPartMgr(0)
-		if !found {
-			continue
+
+		// a job that this process is running (or has resurrected) is read from its own mapping, which is up to date
+		if jm, found := JobsAdmin.JobMgr(jobID); found {
+			if jpm, found := jm.JobPartMgr(0); found {
+				listJobResponse.JobIDDetails = append(listJobResponse.JobIDDetails, jobIDDetailsOf(jobID, jpm.Plan()))
+				continue
+			}
 		}
-		listJobResponse.JobIDDetails = append(listJobResponse.JobIDDetails,
-			common.JobIDDetails{JobId: jobId, CommandString: jpm.Plan().CommandString(),
-				StartTime: jpm.Plan().StartTime, JobStatus: jpm.Plan().JobStatus()})
+		mmf := planFile.Map()
+		listJobResponse.JobIDDetails = append(listJobResponse.JobIDDetails, jobIDDetailsOf(jobID, mmf.Plan()))
+		mmf.Unmap()
+	}
+
+	if len(listJobResponse.JobIDDetails) == 0 {
+		return common.ListJobsResponse{ErrorMessage: "no jobs exists in Azcopy history"}
 	}
 	return listJobResponse
 }
 
+// jobIDDetailsOf describes the job whose part 0 has the given plan
+func jobIDDetailsOf(jobID common.JobID, plan *JobPartPlanHeader) common.JobIDDetails {
+	return common.JobIDDetails{
+		JobId:            jobID,
+		CommandString:    plan.CommandString(),
+		StartTime:        plan.StartTime,
+		JobStatus:        plan.JobStatus(),
+		Source:           stripResourceQuery(string(plan.SourceRoot[:plan.SourceRootLength])),
+		Destination:      stripResourceQuery(string(plan.DestinationRoot[:plan.DestinationRootLength])),
+		Labels:           plan.Labels(),
+		Description:      plan.Description(),
+		AfterJobID:       plan.AfterJobID,
+		TotalBytes:       plan.JobTotalBytes(),
+		BytesTransferred: plan.JobBytesTransferred(),
+	}
+}
+
 // GetJobFromTo api returns the job FromTo info.
 func GetJobFromTo(r common.GetJobFromToRequest) common.GetJobFromToResponse {
 	jm, found := JobsAdmin.JobMgr(r.JobID)
@@ -633,9 +714,10 @@ func GetJobFromTo(r common.GetJobFromToRequest) common.GetJobFromToResponse {
 	}
 
 	return common.GetJobFromToResponse{
-		ErrorMsg:    "",
-		FromTo:      jp0.Plan().FromTo,
-		Source:      source,
-		Destination: destination,
+		ErrorMsg:           "",
+		FromTo:             jp0.Plan().FromTo,
+		Source:             source,
+		Destination:        destination,
+		SourceSASFromLogin: jp0.Plan().SourceSASFromLogin,
 	}
 }
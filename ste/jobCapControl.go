@@ -0,0 +1,134 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// The cap of a running job can be changed from another AzCopy process, by 'azcopy jobs set-cap'. That process writes the
+// new cap to a file next to the plan files of the job, and the process that runs the job checks that file for changes.
+
+const jobCapCheckInterval = 5 * time.Second
+
+// JobCapFilePath is where a new cap for the job is written, in the plan folder
+func JobCapFilePath(planFolder string, jobID common.JobID) string {
+	return filepath.Join(planFolder, jobID.String()+".cap")
+}
+
+// SetJobCap changes the cap of a job that is running, usually in another AzCopy process
+func SetJobCap(req common.SetJobCapRequest) common.SetJobCapResponse {
+	status := GetJobStatus(common.GetJobStatusRequest{JobID: req.JobID})
+	if status.ErrorMsg != "" {
+		return common.SetJobCapResponse{ErrorMsg: status.ErrorMsg}
+	}
+	if status.JobStatus != common.EJobStatus.InProgress() {
+		return common.SetJobCapResponse{ErrorMsg: fmt.Sprintf("job %v is not running (its status is %v). "+
+			"To change its cap, give --cap-mbps when resuming it", req.JobID, status.JobStatus)}
+	}
+
+	if err := writeJobCapFile(JobCapFilePath(JobsAdmin.AppPathFolder(), req.JobID), req.CapMbps); err != nil {
+		return common.SetJobCapResponse{ErrorMsg: fmt.Sprintf("cannot change the cap of job %v: %v", req.JobID, err)}
+	}
+	return common.SetJobCapResponse{}
+}
+
+// writeJobCapFile replaces the file, rather than writing over it, so that the process running the job never reads half of it
+func writeJobCapFile(path string, capMbps uint32) error {
+	tempPath := path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, []byte(strconv.FormatUint(uint64(capMbps), 10)), common.DEFAULT_FILE_PERM); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+func readJobCapFile(path string) (capMbps uint32, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s doesn't hold a valid cap: %v", path, err)
+	}
+	return uint32(value), nil
+}
+
+// watchJobCapFiles applies the caps written for the jobs of this process after it started. Caps written earlier
+// were for an earlier run of the job, and the cap of this run was given when it was started (or resumed)
+func (ja *jobsAdmin) watchJobCapFiles() {
+	started := time.Now()
+	lastChange := make(map[common.JobID]time.Time)
+	for {
+		select {
+		case <-ja.appCtx.Done():
+			return
+		case <-time.After(jobCapCheckInterval):
+		}
+
+		for _, jobID := range ja.JobIDs() {
+			path := JobCapFilePath(ja.planDir, jobID)
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // there's no new cap
+			}
+			last, ok := lastChange[jobID]
+			if !ok {
+				last = started
+			}
+			if !info.ModTime().After(last) {
+				continue
+			}
+			lastChange[jobID] = info.ModTime()
+
+			capMbps, err := readJobCapFile(path)
+			if err != nil {
+				ja.LogToJobLog(fmt.Sprintf("Ignoring a change to the cap: %v", err))
+				continue
+			}
+			ja.setMbpsCap(int64(capMbps))
+		}
+	}
+}
+
+// setMbpsCap changes the cap of all the traffic of this process (which, in practice, runs only one job)
+func (ja *jobsAdmin) setMbpsCap(capMbps int64) {
+	if atomic.SwapInt64(&ja.atomicMbpsCap, capMbps) == capMbps {
+		return
+	}
+	ja.pacer.setCap(capMbps * 1000 * 1000 / 8)
+
+	msg := fmt.Sprintf("The cap was changed to %d Mbps by 'azcopy jobs set-cap'", capMbps)
+	if capMbps == 0 {
+		msg = "The cap was removed by 'azcopy jobs set-cap'"
+	}
+	common.GetLifecycleMgr().Info(msg)
+	ja.LogToJobLog(msg)
+}
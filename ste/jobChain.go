@@ -0,0 +1,94 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// GetJobStatus returns the status of a job, for a job that is to start only when that job has completed.
+// The job is usually running in another AzCopy process, so its plan files are read directly rather than
+// by resurrecting the job in this process, which would keep its (growing) list of parts cached here.
+func GetJobStatus(r common.GetJobStatusRequest) common.GetJobStatusResponse {
+	JobsAdmin.(*jobsAdmin).migrateOldPlanFiles(r.JobID.String())
+	planFiles, err := jobPlanFiles(JobsAdmin.AppPathFolder(), r.JobID)
+	if err != nil {
+		return common.GetJobStatusResponse{ErrorMsg: fmt.Sprintf("cannot read the plan files of job %v: %v", r.JobID, err)}
+	}
+	if len(planFiles) == 0 {
+		return common.GetJobStatusResponse{ErrorMsg: fmt.Sprintf("no job with JobID %v exists", r.JobID), NotFound: true}
+	}
+
+	var status common.JobStatus
+	var finalPartOrdered, anySkipped, anyFailed, anySucceeded bool
+	for i, planFile := range planFiles {
+		mmf := planFile.Map()
+		plan := mmf.Plan()
+		if i == 0 {
+			// as in GetJobSummary, the status comes first, so that the job is never seen as completed with only some of its transfers counted
+			status = plan.JobStatus()
+		}
+		finalPartOrdered = finalPartOrdered || plan.IsFinalPart
+		for t := uint32(0); t < plan.NumTransfers; t++ {
+			switch plan.Transfer(t).TransferStatus() {
+			case common.ETransferStatus.Success():
+				anySucceeded = true
+			case common.ETransferStatus.Failed(), common.ETransferStatus.BlobTierFailure():
+				anyFailed = true
+			case common.ETransferStatus.SkippedFileAlreadyExists(),
+				common.ETransferStatus.SkippedBlobHasSnapshots(),
+				common.ETransferStatus.SkippedSourceChanged(),
+				common.ETransferStatus.SkippedContentPolicy(),
+				common.ETransferStatus.SkippedInfected():
+				anySkipped = true
+			}
+		}
+		mmf.Unmap()
+	}
+
+	if status == common.EJobStatus.Completed() {
+		if !finalPartOrdered {
+			// the job has not finished being ordered
+			status = common.EJobStatus.InProgress()
+		} else {
+			status = status.EnhanceJobStatusInfo(anySkipped, anyFailed, anySucceeded)
+		}
+	}
+	return common.GetJobStatusResponse{JobStatus: status, CompletelyOrdered: finalPartOrdered}
+}
+
+// jobPlanFiles returns the plan files of the job, in the order of their part numbers
+func jobPlanFiles(planDir string, jobID common.JobID) ([]JobPartPlanFileName, error) {
+	planFiles, err := listCurrentPlanFiles(planDir, jobID.String())
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sortPlanFiles{Files: planFiles})
+
+	names := make([]JobPartPlanFileName, len(planFiles))
+	for i, f := range planFiles {
+		names[i] = JobPartPlanFileName(f.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,175 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// once the statistics file gets this big, the older half of the records are dropped, so that it stays small
+const maxJobStatsFileSize = 4 * 1024 * 1024
+
+// jobStatsCollector counts what happens to the transfers in this run of a job, for the record kept when the run ends
+type jobStatsCollector struct {
+	mu        sync.Mutex
+	startTime time.Time
+	completed uint32
+	failed    uint32
+	skipped   uint32
+	bytes     uint64
+}
+
+func newJobStatsCollector() *jobStatsCollector {
+	return &jobStatsCollector{startTime: time.Now()}
+}
+
+func (c *jobStatsCollector) recordTransferDone(status common.TransferStatus, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch status {
+	case common.ETransferStatus.Success():
+		c.completed++
+		c.bytes += uint64(size)
+	case common.ETransferStatus.Failed(), common.ETransferStatus.BlobTierFailure():
+		c.failed++
+	case common.ETransferStatus.SkippedFileAlreadyExists(), common.ETransferStatus.SkippedBlobHasSnapshots(), common.ETransferStatus.SkippedSourceChanged(),
+		common.ETransferStatus.SkippedContentPolicy(), common.ETransferStatus.SkippedInfected():
+		c.skipped++
+	}
+}
+
+// toRecord makes the record of the run, which ends now with the given status
+func (c *jobStatsCollector) toRecord(plan *JobPartPlanHeader, status common.JobStatus) common.JobStatsRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return common.JobStatsRecord{
+		JobID:               plan.JobID,
+		FromTo:              plan.FromTo.String(),
+		SourceEndpoint:      common.JobStatsEndpoint(plan.FromTo.From(), string(plan.SourceRoot[:plan.SourceRootLength])),
+		DestinationEndpoint: common.JobStatsEndpoint(plan.FromTo.To(), string(plan.DestinationRoot[:plan.DestinationRootLength])),
+		StartTime:           c.startTime.UTC(),
+		EndTime:             time.Now().UTC(),
+		JobStatus:           status.String(),
+		TransfersCompleted:  c.completed,
+		TransfersFailed:     c.failed,
+		TransfersSkipped:    c.skipped,
+		BytesTransferred:    c.bytes,
+	}
+}
+
+// recordJobStats adds the record of this run of the job to the statistics of the jobs that have run on this machine.
+// Failing to do so doesn't affect the job, so it's only logged
+func (jm *jobMgr) recordJobStats(plan *JobPartPlanHeader, status common.JobStatus) {
+	if err := appendJobStatsRecord(common.JobStatsFilePath(JobsAdmin.(*jobsAdmin).planDir), jm.stats.toRecord(plan, status)); err != nil {
+		jm.Log(pipeline.LogWarning, fmt.Sprintf("Failed to record the statistics of the job: %v", err))
+	}
+}
+
+// appendJobStatsRecord appends the record to the file, as a line of JSON. Several copies of AzCopy may be doing that at the same time,
+// so the file is locked while the record is written, and while the file is trimmed (by replacing it) when it gets too big
+func appendJobStatsRecord(path string, record common.JobStatsRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockSharedFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	info, statErr := file.Stat()
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+
+	if statErr == nil && info.Size() > maxJobStatsFileSize {
+		return trimJobStatsFile(path)
+	}
+	return nil
+}
+
+// trimJobStatsFile drops the older half of the records. The caller must hold the lock on the file
+func trimJobStatsFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// keep from the first line that starts in the second half
+	mid := len(data) / 2
+	if mid == 0 {
+		return nil
+	}
+	cut := bytes.IndexByte(data[mid-1:], '\n')
+	if cut < 0 {
+		return nil
+	}
+	tempPath := path + ".trimming"
+	if err = ioutil.WriteFile(tempPath, data[mid+cut:], 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// ReadJobStats reads the statistics of the jobs that have run on this machine, oldest first.
+// Lines that can't be parsed (e.g. one that was being written when the machine went down) are skipped
+func ReadJobStats(planFolder string) ([]common.JobStatsRecord, error) {
+	file, err := os.Open(common.JobStatsFilePath(planFolder))
+	if os.IsNotExist(err) {
+		return nil, nil // no job has finished yet
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]common.JobStatsRecord, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record common.JobStatsRecord
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
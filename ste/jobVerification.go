@@ -0,0 +1,404 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// how many destinations are checked at once
+const verificationParallelism = 32
+
+// VerifyJob checks that the destination of each successful transfer of a finished job still matches what was transferred:
+// that it exists, has the size of the source, and, when there are hashes to compare, the same MD5 hash. Destinations that
+// don't match are marked as failed, so that resuming the job transfers them again.
+// Each result is recorded in a checkpoint as soon as it's known, so that a verification that is interrupted carries on
+// from where it got to when it's run again. The checkpoint is replaced by the report when every destination has been checked.
+func VerifyJob(req common.VerifyJobRequest) common.VerifyJobResponse {
+	jm, found := JobsAdmin.JobMgr(req.JobID)
+	if !found {
+		// Search the plan files in Azcopy folder and resurrect the Job.
+		if !JobsAdmin.ResurrectJob(req.JobID, req.SourceSAS, req.DestinationSAS) {
+			return common.VerifyJobResponse{ErrorMsg: fmt.Sprintf("no job with JobID %v exists", req.JobID)}
+		}
+		jm, _ = JobsAdmin.JobMgr(req.JobID)
+	}
+
+	jpm0, found := jm.JobPartMgr(0)
+	if !found {
+		return common.VerifyJobResponse{ErrorMsg: fmt.Sprintf("error getting the 0th part of job %v", req.JobID)}
+	}
+	status := jpm0.Plan().JobStatus()
+	if !status.IsJobDone() {
+		return common.VerifyJobResponse{ErrorMsg: fmt.Sprintf("job %v is %v. Only jobs that have finished can be verified", req.JobID, status)}
+	}
+	fromTo := jpm0.Plan().FromTo
+	switch fromTo.To() {
+	case common.ELocation.Local(), common.ELocation.Blob(), common.ELocation.File(), common.ELocation.BlobFS():
+	default:
+		return common.VerifyJobResponse{ErrorMsg: fmt.Sprintf("verifying jobs that transfer %v is not supported", fromTo)}
+	}
+
+	jm.setInMemoryTransitJobState(InMemoryTransitJobState{credentialInfo: req.CredentialInfo})
+	v := &jobVerifier{
+		ctx:            steCtx,
+		jm:             jm,
+		fromTo:         fromTo,
+		checkpointPath: filepath.Join(JobsAdmin.(*jobsAdmin).logDir, req.JobID.String()+".verify-checkpoint"),
+		reportPath:     filepath.Join(JobsAdmin.(*jobsAdmin).logDir, req.JobID.String()+".verify-report.json"),
+	}
+	return v.run()
+}
+
+// verificationCheckpointEntry is the result of checking the destination of one transfer
+type verificationCheckpointEntry struct {
+	PartNum       common.PartNumber `json:"partNum"`
+	TransferIndex uint32            `json:"transferIndex"`
+	HashChecked   bool              `json:"hashChecked"`
+	Problem       string            `json:"problem,omitempty"`
+	Src           string            `json:"src,omitempty"` // only recorded when there's a problem
+	Dst           string            `json:"dst,omitempty"`
+}
+
+type verifiedTransfer struct {
+	partNum       common.PartNumber
+	transferIndex uint32
+}
+
+type jobVerifier struct {
+	ctx            context.Context
+	jm             IJobMgr
+	fromTo         common.FromTo
+	checkpointPath string
+	reportPath     string
+
+	mu     sync.Mutex
+	report common.VerifyJobResponse
+}
+
+// objectProperties are the properties of a source or destination that verification compares
+type objectProperties struct {
+	exists       bool
+	size         int64
+	contentMD5   []byte // empty for local files, whose hashes are only computed when needed
+	lastModified time.Time
+}
+
+func (v *jobVerifier) run() common.VerifyJobResponse {
+	v.report.Discrepancies = make([]common.VerificationDiscrepancy, 0)
+	v.report.NotChecked = make([]common.VerificationDiscrepancy, 0)
+
+	alreadyVerified, err := v.readCheckpoint()
+	if err != nil {
+		return common.VerifyJobResponse{ErrorMsg: fmt.Sprintf("cannot read the checkpoint of the earlier verification: %v", err)}
+	}
+	checkpoint := newAppendOnlyJSONFile(v.checkpointPath, "verification checkpoint", v.jm)
+	checkpoint.enable()
+
+	type verification struct {
+		jpm           IJobPartMgr
+		transferIndex uint32
+	}
+	verifications := make(chan verification, verificationParallelism)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < verificationParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ver := range verifications {
+				v.verifyAndRecord(ver.jpm, ver.transferIndex, checkpoint)
+			}
+		}()
+	}
+
+	for p := PartNumber(0); true; p++ {
+		jpm, found := v.jm.JobPartMgr(p)
+		if !found {
+			break
+		}
+		if part := jpm.(*jobPartMgr); atomic.LoadUint32(&part.atomicPipelinesInitedIndicator) == 0 {
+			part.createPipelines(v.ctx)
+		}
+
+		plan := jpm.Plan()
+		for t := uint32(0); t < plan.NumTransfers; t++ {
+			if plan.Transfer(t).TransferStatus() != common.ETransferStatus.Success() || alreadyVerified[verifiedTransfer{p, t}] {
+				continue
+			}
+			verifications <- verification{jpm, t}
+		}
+	}
+	close(verifications)
+	wg.Wait()
+	checkpoint.Close()
+
+	v.report.ReportPath = v.reportPath
+	if err = v.writeReport(); err != nil {
+		v.report.ErrorMsg = fmt.Sprintf("cannot write the verification report: %v", err)
+	} else if len(v.report.NotChecked) == 0 && !checkpoint.hasFailed() {
+		// everything has been checked, so the next verification starts afresh
+		_ = os.Remove(v.checkpointPath)
+	}
+
+	if v.jm.ShouldLog(pipeline.LogInfo) {
+		v.jm.Log(pipeline.LogInfo, fmt.Sprintf("Verified the destinations of %d transfers: %d did not match and were marked as failed, %d could not be checked. The report is in %s",
+			v.report.TransfersVerified, len(v.report.Discrepancies), len(v.report.NotChecked), v.reportPath))
+	}
+	return v.report
+}
+
+// readCheckpoint adds the results of an earlier, interrupted, verification to the report, and returns the transfers it checked
+func (v *jobVerifier) readCheckpoint() (map[verifiedTransfer]bool, error) {
+	verified := make(map[verifiedTransfer]bool)
+	f, err := os.Open(v.checkpointPath)
+	if os.IsNotExist(err) {
+		return verified, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // the paths in an entry can be long
+	for scanner.Scan() {
+		var entry verificationCheckpointEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue // the last line is cut short if AzCopy stopped while it was being written
+		}
+		verified[verifiedTransfer{entry.PartNum, entry.TransferIndex}] = true
+		v.addToReport(entry)
+	}
+	return verified, scanner.Err()
+}
+
+func (v *jobVerifier) verifyAndRecord(jpm IJobPartMgr, transferIndex uint32, checkpoint *appendOnlyJSONFile) {
+	entry, err := v.verifyTransfer(jpm, transferIndex)
+	if err != nil {
+		src, dst := jpm.Plan().TransferSrcDstStrings(transferIndex)
+		v.mu.Lock()
+		v.report.NotChecked = append(v.report.NotChecked, common.VerificationDiscrepancy{Src: src, Dst: dst, Problem: err.Error()})
+		v.mu.Unlock()
+		return
+	}
+
+	if entry.Problem != "" {
+		// requeue the transfer before recording it, so that it can't be checked and found to be fine by a later verification
+		transfer := jpm.Plan().Transfer(transferIndex)
+		transfer.SetTransferStatus(common.ETransferStatus.Failed(), true)
+		transfer.SetErrorCode(0, true)
+		if v.jm.ShouldLog(pipeline.LogWarning) {
+			v.jm.Log(pipeline.LogWarning, fmt.Sprintf("Verification: %s: %s. The transfer is marked as failed, so that resuming the job transfers it again", entry.Dst, entry.Problem))
+		}
+	}
+	checkpoint.append(entry)
+	v.addToReport(entry)
+}
+
+func (v *jobVerifier) addToReport(entry verificationCheckpointEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.report.TransfersVerified++
+	if entry.Problem != "" {
+		v.report.Discrepancies = append(v.report.Discrepancies, common.VerificationDiscrepancy{Src: entry.Src, Dst: entry.Dst, Problem: entry.Problem})
+	} else if !entry.HashChecked {
+		v.report.HashesNotChecked++
+	}
+}
+
+// verifyTransfer checks the destination of the transfer. An error means that it could not be checked, not that it didn't match
+func (v *jobVerifier) verifyTransfer(jpm IJobPartMgr, transferIndex uint32) (verificationCheckpointEntry, error) {
+	plan := jpm.Plan()
+	transfer := plan.Transfer(transferIndex)
+	src, dst := plan.TransferSrcDstStrings(transferIndex)
+	srcSAS, dstSAS := jpm.SAS()
+	entry := verificationCheckpointEntry{PartNum: plan.PartNum, TransferIndex: transferIndex}
+
+	dstProps, err := getObjectProperties(v.ctx, v.fromTo.To(), dst, dstSAS, jpm.destinationPipeline())
+	if err != nil {
+		return entry, err
+	}
+
+	switch {
+	case !dstProps.exists:
+		entry.Problem = "the destination does not exist"
+	case plan.DstBlobData.ConvertToVHD:
+		// the destination is the converted image, so only its existence can be checked
+	case dstProps.size != transfer.SourceSize:
+		entry.Problem = fmt.Sprintf("the destination is %d bytes, but %d bytes were transferred", dstProps.size, transfer.SourceSize)
+	default:
+		expectedMD5, err := v.sourceMD5(jpm, transferIndex, src, srcSAS)
+		if err != nil {
+			return entry, err
+		}
+		if len(expectedMD5) == 0 {
+			break
+		}
+
+		actualMD5 := dstProps.contentMD5
+		if v.fromTo.To() == common.ELocation.Local() && !common.FIPSModeEnabled() {
+			if actualMD5, err = localFileMD5(dst); err != nil {
+				return entry, err
+			}
+		}
+		if len(actualMD5) == 0 {
+			break
+		}
+		entry.HashChecked = true
+		if !bytes.Equal(expectedMD5, actualMD5) {
+			entry.Problem = "the MD5 hash of the destination does not match the source"
+		}
+	}
+
+	if entry.Problem != "" {
+		entry.Src, entry.Dst = src, dst
+	}
+	return entry, nil
+}
+
+// sourceMD5 returns the MD5 hash of the source as it was transferred, or nothing if it isn't known. It's recorded in the plan
+// of S2S copies. The hash of a local source is computed, and that of the remote source of a download is read from its
+// properties, as long as the source has not changed since it was transferred
+func (v *jobVerifier) sourceMD5(jpm IJobPartMgr, transferIndex uint32, src, srcSAS string) ([]byte, error) {
+	plan := jpm.Plan()
+	if h, _, _, _, _, _, _, _ := plan.TransferSrcPropertiesAndMetadata(transferIndex); len(h.ContentMD5) > 0 {
+		return h.ContentMD5, nil
+	}
+
+	transferredLastModified := time.Unix(0, plan.Transfer(transferIndex).ModifiedTime)
+	switch from := v.fromTo.From(); {
+	case from == common.ELocation.Local():
+		if common.FIPSModeEnabled() {
+			return nil, nil
+		}
+		fi, err := os.Stat(src)
+		if err != nil || !fi.ModTime().Equal(transferredLastModified) {
+			return nil, nil // the source has gone or changed, so there's nothing to compare with
+		}
+		return localFileMD5(src)
+	case v.fromTo.To() == common.ELocation.Local():
+		// the pipeline of a download is the one for the source
+		props, err := getObjectProperties(v.ctx, from, src, srcSAS, jpm.destinationPipeline())
+		if err != nil || !props.exists || !props.lastModified.Equal(transferredLastModified) {
+			return nil, nil
+		}
+		return props.contentMD5, nil
+	default:
+		return nil, nil
+	}
+}
+
+// getObjectProperties returns the properties of a local file or remote object, which need not exist
+func getObjectProperties(ctx context.Context, location common.Location, rawPath, sas string, p pipeline.Pipeline) (objectProperties, error) {
+	if location == common.ELocation.Local() {
+		fi, err := os.Stat(rawPath)
+		if os.IsNotExist(err) {
+			return objectProperties{}, nil
+		} else if err != nil {
+			return objectProperties{}, err
+		}
+		return objectProperties{exists: true, size: fi.Size(), lastModified: fi.ModTime()}, nil
+	}
+
+	u, err := url.Parse(rawPath)
+	if err != nil {
+		return objectProperties{}, err
+	}
+	appendSASToURL(u, sas)
+
+	switch location {
+	case common.ELocation.Blob():
+		props, err := azblob.NewBlobURL(*u, p).GetProperties(ctx, azblob.BlobAccessConditions{})
+		if exists, err := remoteObjectExists(props, err); !exists {
+			return objectProperties{}, err
+		}
+		return objectProperties{true, props.ContentLength(), props.ContentMD5(), props.LastModified()}, nil
+	case common.ELocation.File():
+		props, err := azfile.NewFileURL(*u, p).GetProperties(ctx)
+		if exists, err := remoteObjectExists(props, err); !exists {
+			return objectProperties{}, err
+		}
+		return objectProperties{true, props.ContentLength(), props.ContentMD5(), props.LastModified()}, nil
+	case common.ELocation.BlobFS():
+		props, err := azbfs.NewFileURL(*u, p).GetProperties(ctx)
+		if exists, err := remoteObjectExists(props, err); !exists {
+			return objectProperties{}, err
+		}
+		lastModified, _ := time.Parse(time.RFC1123, props.LastModified())
+		return objectProperties{true, props.ContentLength(), props.ContentMD5(), lastModified}, nil
+	default:
+		return objectProperties{}, fmt.Errorf("cannot get the properties of objects in %v", location)
+	}
+}
+
+// appendSASToURL adds the SAS that was stripped from the source or destination before it was persisted in the plan
+func appendSASToURL(u *url.URL, sas string) {
+	if len(sas) == 0 {
+		return
+	}
+	if len(u.RawQuery) > 0 {
+		u.RawQuery += "&" + sas
+	} else {
+		u.RawQuery = sas
+	}
+}
+
+func localFileMD5(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (v *jobVerifier) writeReport() error {
+	report, err := json.MarshalIndent(v.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(v.reportPath, report, 0644)
+}
@@ -0,0 +1,62 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// scanExitCodeInfected is the exit code by which the scan command says the file is infected, as clamscan and clamdscan do
+const scanExitCodeInfected = 1
+
+// scanFile streams a local file to the standard input of the scan command, e.g. "clamdscan --no-summary -".
+// The command must exit with 0 if the file is clean, and with 1 if it's infected; any other outcome means the scan failed.
+// The report is the first line of what the command printed, which usually names what was found
+func scanFile(ctx context.Context, command []string, path string) (infected bool, report string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, "", err
+	}
+	defer f.Close()
+
+	scanner := exec.CommandContext(ctx, command[0], command[1:]...)
+	scanner.Stdin = f
+	output, err := scanner.CombinedOutput()
+	report = strings.TrimSpace(string(output))
+	if i := strings.IndexAny(report, "\r\n"); i >= 0 {
+		report = report[:i]
+	}
+
+	if err == nil {
+		return false, report, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == scanExitCodeInfected {
+		return true, report, nil
+	}
+	if report != "" {
+		return false, report, fmt.Errorf("scan command %s failed: %v: %s", command[0], err, report)
+	}
+	return false, report, fmt.Errorf("scan command %s failed: %v", command[0], err)
+}
@@ -0,0 +1,274 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Managed disks are uploaded and downloaded as page blobs, but with a few extra rules that ordinary page blobs don't have.
+// Uploads must be a whole number of 512 byte pages and must fit in the pre-sized disk, and the disk must end with a
+// fixed VHD footer. Disk exports are typically very large and are fetched through a SAS that expires, so their
+// downloads keep track of how far they have got, to let a resumed job carry on from there instead of starting over.
+
+const (
+	vhdFooterSize = 512
+
+	vhdCookie                   = "conectix"
+	vhdCurrentSizeOffset        = 48
+	vhdDiskTypeOffset           = 60
+	vhdChecksumOffset           = 64
+	vhdDiskTypeFixed     uint32 = 2
+
+	// suffix of the file, alongside the destination, that records how much of a disk export has been saved
+	diskExportProgressSuffix = ".azcopy-partial"
+
+	// how many bytes to save between updates of the progress file
+	diskExportProgressInterval = 64 * 1024 * 1024
+)
+
+var errNotPageAligned = errors.New("the size of a managed disk upload must be a multiple of 512 bytes")
+
+// isManagedDiskURL says whether the given (blob) URL is a managed disk import/export target,
+// of either the current or the legacy kind
+func isManagedDiskURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return isInManagedDiskImportExportAccount(*u) || isInLegacyDiskExportAccount(*u)
+}
+
+// vhdFooter is the 512 byte trailer that ends every fixed VHD. Its layout is defined in the
+// Virtual Hard Disk Image Format Specification. All multi-byte fields are big-endian.
+type vhdFooter [vhdFooterSize]byte
+
+// parseVhdFooter returns the footer held in b, or false if b does not look like a VHD footer
+func parseVhdFooter(b []byte) (vhdFooter, bool) {
+	var f vhdFooter
+	if len(b) != vhdFooterSize || string(b[:len(vhdCookie)]) != vhdCookie {
+		return f, false
+	}
+	copy(f[:], b)
+	return f, true
+}
+
+func (f *vhdFooter) diskType() uint32 {
+	return binary.BigEndian.Uint32(f[vhdDiskTypeOffset:])
+}
+
+func (f *vhdFooter) currentSize() int64 {
+	return int64(binary.BigEndian.Uint64(f[vhdCurrentSizeOffset:]))
+}
+
+// setCurrentSize updates the size of the virtual disk, and the checksum that covers it
+func (f *vhdFooter) setCurrentSize(size int64) {
+	binary.BigEndian.PutUint64(f[vhdCurrentSizeOffset:], uint64(size))
+	binary.BigEndian.PutUint32(f[vhdChecksumOffset:], f.computeChecksum())
+}
+
+func (f *vhdFooter) checksumIsValid() bool {
+	return binary.BigEndian.Uint32(f[vhdChecksumOffset:]) == f.computeChecksum()
+}
+
+// the checksum is the one's complement of the sum of all the bytes in the footer, except the checksum itself
+func (f *vhdFooter) computeChecksum() uint32 {
+	sum := uint32(0)
+	for i, b := range f {
+		if i >= vhdChecksumOffset && i < vhdChecksumOffset+4 {
+			continue
+		}
+		sum += uint32(b)
+	}
+	return ^sum
+}
+
+// validateForManagedDisk checks that the VHD is one that Azure will accept as a managed disk
+func (f *vhdFooter) validateForManagedDisk(sourceSize int64) error {
+	if !f.checksumIsValid() {
+		return errors.New("the VHD footer checksum is invalid")
+	}
+	if f.diskType() != vhdDiskTypeFixed {
+		return fmt.Errorf("only fixed size VHDs can be uploaded to managed disks, but this VHD has disk type %d", f.diskType())
+	}
+	if f.currentSize() != sourceSize-vhdFooterSize {
+		return fmt.Errorf("the VHD footer says the disk is %d bytes, but the file holds %d bytes of data", f.currentSize(), sourceSize-vhdFooterSize)
+	}
+	return nil
+}
+
+// readVhdFooter reads the footer from the end of a source of the given size.
+// Returns false (and no error) if the source does not end with a VHD footer.
+func readVhdFooter(source io.ReaderAt, sourceSize int64) (vhdFooter, bool, error) {
+	if sourceSize < vhdFooterSize {
+		return vhdFooter{}, false, nil
+	}
+	b := make([]byte, vhdFooterSize)
+	if _, err := source.ReadAt(b, sourceSize-vhdFooterSize); err != nil && err != io.EOF {
+		return vhdFooter{}, false, err
+	}
+	f, ok := parseVhdFooter(b)
+	return f, ok, nil
+}
+
+// diskExportProgressWriter wraps the destination file of a disk export download, and records how many bytes
+// have been saved. Because the ChunkedFileWriter saves strictly sequentially, everything before that point is known
+// to be complete.
+type diskExportProgressWriter struct {
+	file         io.WriteCloser
+	progressPath string
+	source       diskExportSource
+	resumedFrom  int64
+	offset       int64
+	lastSaved    int64
+}
+
+func diskExportProgressPath(destination string) string {
+	return destination + diskExportProgressSuffix
+}
+
+// diskExportSource identifies the version of the disk that a partial download was made from, so that it
+// is only resumed from the same one
+type diskExportSource struct {
+	size         int64
+	lastModified time.Time
+	eTag         string
+}
+
+// readDiskExportProgress returns the offset at which a previous attempt to download source to destination stopped.
+// Returns false if there is no usable record of one, which includes a record of a different version of the source.
+func readDiskExportProgress(destination string, source diskExportSource) (int64, bool) {
+	if source.eTag == "" && source.lastModified.IsZero() {
+		return 0, false // we couldn't tell whether the disk had changed since
+	}
+	b, err := ioutil.ReadFile(diskExportProgressPath(destination))
+	if err != nil {
+		return 0, false
+	}
+	var offset, recordedSize, recordedLastModified int64
+	var recordedETag string
+	if n, err := fmt.Sscanf(string(b), "%d %d %d %q\n", &offset, &recordedSize, &recordedLastModified, &recordedETag); err != nil || n != 4 {
+		return 0, false // includes records that were made before they had the version of the source
+	}
+	if recordedSize != source.size || recordedLastModified != source.lastModified.UnixNano() || recordedETag != source.eTag || offset < 0 || offset > source.size {
+		return 0, false // the record is from a different version of the source
+	}
+	fi, err := os.Stat(destination)
+	if err != nil || fi.Size() != source.size {
+		return 0, false // the partial file has gone, or been changed, since the record was made
+	}
+	return offset, true
+}
+
+// hashDiskExport computes the MD5 hash of a downloaded disk export from the file on disk, for downloads that were
+// resumed part way through, since the hash that was computed as it was written only covers the part written by the last attempt
+func hashDiskExport(destination string) ([]byte, error) {
+	f, err := os.Open(destination)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// openDiskExportDestination opens the partially downloaded destination file for writing from resumeOffset onwards
+func openDiskExportDestination(destination string, resumeOffset int64) (*os.File, error) {
+	f, err := os.OpenFile(destination, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(resumeOffset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func newDiskExportProgressWriter(file io.WriteCloser, destination string, source diskExportSource, resumeOffset int64) (*diskExportProgressWriter, error) {
+	w := &diskExportProgressWriter{
+		file:         file,
+		progressPath: diskExportProgressPath(destination),
+		source:       source,
+		resumedFrom:  resumeOffset,
+		offset:       resumeOffset,
+		lastSaved:    resumeOffset,
+	}
+	return w, w.saveProgress()
+}
+
+func (w *diskExportProgressWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.offset-w.lastSaved >= diskExportProgressInterval {
+		if err = w.saveProgress(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *diskExportProgressWriter) Close() error {
+	saveErr := w.saveProgress()
+	closeErr := w.file.Close()
+	if closeErr != nil {
+		return closeErr
+	}
+	return saveErr
+}
+
+// saveProgress flushes the destination file before recording the offset, so that the
+// record never claims more than is actually on disk. The version of the source is recorded with it
+func (w *diskExportProgressWriter) saveProgress() error {
+	if s, ok := w.file.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return err
+		}
+	}
+	w.lastSaved = w.offset
+	return ioutil.WriteFile(w.progressPath, []byte(fmt.Sprintf("%d %d %d %q\n", w.offset, w.source.size, w.source.lastModified.UnixNano(), w.source.eTag)), common.DEFAULT_FILE_PERM)
+}
+
+// removeProgress deletes the progress record, once the download is complete
+func (w *diskExportProgressWriter) removeProgress() error {
+	err := os.Remove(w.progressPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
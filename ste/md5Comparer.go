@@ -93,6 +93,11 @@ func (c *md5Comparer) Check() error {
 	return nil
 }
 
+// matched says whether the MD5s were actually compared, and were the same (Check returns no error for some cases where they weren't)
+func (c *md5Comparer) matched() bool {
+	return c.validationOption != common.EHashValidationOption.NoCheck() && len(c.expected) > 0 && bytes.Equal(c.expected, c.actualAsSaved)
+}
+
 func (c *md5Comparer) logAsMissing() {
 	c.logger.LogAtLevelForCurrentTransfer(pipeline.LogWarning, noMD5Stored)
 }
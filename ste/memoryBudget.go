@@ -0,0 +1,123 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// The memory budget (set by AZCOPY_MAX_MEMORY_GB) is shared out like this. What's left over is for everything else,
+// e.g. the plan files of the jobs, and the transfers that are waiting to be scheduled
+const (
+	chunkShareOfMemoryBudget      = 0.6  // the data of the chunks in flight, i.e. the limit of the cacheLimiter
+	slicePoolShareOfMemoryBudget  = 0.15 // the unused slices that the slice pool keeps for reuse
+	connectionShareOfMemoryBudget = 0.1  // the goroutines of the main pool, and their connections
+)
+
+// a rough figure for the stack of a goroutine of the main pool, plus the TLS and HTTP buffers of its connection
+const estimatedBytesPerConnection = 256 * 1024
+
+// we'd rather go a little over a tiny budget than have (almost) no concurrency at all
+const minMainPoolSizeInMemoryBudget = 4
+
+// getMemoryBudget returns the max number of bytes of RAM that the user wants us to use, or 0 if they didn't set a limit
+func getMemoryBudget() int64 {
+	envVar := common.EEnvironmentVariable.MaxMemoryGB()
+	budgetGB := tryNewConfiguredFloat(envVar)
+	if budgetGB == nil {
+		return 0
+	}
+
+	if budgetGB.Value <= 0 {
+		common.GetLifecycleMgr().Error(fmt.Sprintf("Cannot use the %s. It must be a number of GB greater than zero, e.g. 1.5", describeTunableSource(envVar.Name)))
+	}
+	return int64(budgetGB.Value * 1024 * 1024 * 1024)
+}
+
+// limitChunkRamToMemoryBudget reduces the RAM that the cacheLimiter allows for chunks, if it's more than the budget allows.
+// Since the limiter is what makes us wait before prefetching more chunks, this is what reduces the prefetch depth
+func limitChunkRamToMemoryBudget(maxRamBytes int64, budget int64) int64 {
+	if budget == 0 {
+		return maxRamBytes
+	}
+	if budgetForChunks := int64(float64(budget) * chunkShareOfMemoryBudget); maxRamBytes > budgetForChunks {
+		return budgetForChunks
+	}
+	return maxRamBytes
+}
+
+// the cacheLimiter only lets in chunks that fit under its strict limit, which is this share of its whole limit (see cacheLimiter.TryAdd)
+const cacheLimiterStrictShare = 0.75
+
+// maxBlockSizeForChunkRam returns the largest block that fits in the RAM allowed for chunks. Waiting for room for a bigger one
+// would never end, since there would never be room
+func maxBlockSizeForChunkRam(maxRamBytes int64) int64 {
+	return int64(float64(maxRamBytes) * cacheLimiterStrictShare)
+}
+
+// MaxBlockSize returns the largest block size that can be used within the RAM that the user allows (or that we allow by default),
+// so that a block size that is too big can be rejected up front
+func MaxBlockSize() int64 {
+	return maxBlockSizeForChunkRam(limitChunkRamToMemoryBudget(getMaxRamForChunks(), getMemoryBudget()))
+}
+
+// limitBlockSizeToChunkRam reduces a block size that doesn't fit in the RAM allowed for chunks, e.g. one chosen for a huge file,
+// or one that a resumed job was given under a larger memory budget. It stays a whole number of pages, for page blobs
+func limitBlockSizeToChunkRam(blockSize uint32, maxRamBytes int64) uint32 {
+	max := maxBlockSizeForChunkRam(maxRamBytes) / azblob.PageBlobPageBytes * azblob.PageBlobPageBytes
+	if max < azblob.PageBlobPageBytes {
+		max = azblob.PageBlobPageBytes
+	}
+	if int64(blockSize) > max {
+		return uint32(max)
+	}
+	return blockSize
+}
+
+// maxPooledSliceBytesInMemoryBudget returns how much the slice pool may hold, or 0 for no limit if there's no budget
+func maxPooledSliceBytesInMemoryBudget(budget int64) int64 {
+	return int64(float64(budget) * slicePoolShareOfMemoryBudget)
+}
+
+// limitMainPoolSizeToMemoryBudget reduces the size of the main pool (and the limit that tuning may grow it to)
+// if the connections would use more than the budget allows
+func limitMainPoolSizeToMemoryBudget(initial int, max *ConfiguredInt, budget int64) (int, *ConfiguredInt) {
+	if budget == 0 {
+		return initial, max
+	}
+
+	limit := int(float64(budget) * connectionShareOfMemoryBudget / estimatedBytesPerConnection)
+	if limit < minMainPoolSizeInMemoryBudget {
+		limit = minMainPoolSizeInMemoryBudget
+	}
+	if max.Value <= limit {
+		return initial, max
+	}
+
+	if initial > limit {
+		initial = limit
+	}
+	return initial, &ConfiguredInt{limit, true, common.EEnvironmentVariable.MaxMemoryGB().Name, ""}
+}
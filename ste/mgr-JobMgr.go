@@ -78,7 +78,23 @@ type IJobMgr interface {
 	HttpClient() *http.Client
 	PipelineNetworkStats() *pipelineNetworkStats
 	getOverwritePrompter() *overwritePrompter
+	getCompletionNotifier() completionNotifier
+	getTransferJournal() *transferJournal
+	getDatasetManifest() *datasetManifest
+	getManifestResult() (path, errorMsg string)
+	getSecondaryReadTracker() *secondaryReadTracker
+	getAccountFailoverDetector() *accountFailoverDetector
+	getSlowestTransferTracker() *slowestTransferTracker
+	getSourceDeletionTracker() *sourceDeletionTracker
+	getScanOverlapTracker() *scanOverlapTracker
+	getPolicyViolationTracker() *policyViolationTracker
+	getFolderPermissionsTracker() *folderPermissionsTracker
+	getTracer() *jobTracer
+	getJobStatsCollector() *jobStatsCollector
 	common.ILoggerCloser
+	common.ICategoryLogger
+	LogTransferWithCategory(category common.LogCategory, level pipeline.LogLevel, partNum common.PartNumber, transferIndex uint32, msg string)
+	common.ITransferLogger
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -87,14 +103,25 @@ func newJobMgr(concurrency ConcurrencySettings, appLogger common.ILogger, jobID
 	// atomicAllTransfersScheduled is set to 1 since this api is also called when new job part is ordered.
 	enableChunkLogOutput := level.ToPipelineLogLevel() == pipeline.LogDebug
 	jm := jobMgr{jobID: jobID, jobPartMgrs: newJobPartToJobPartMgr(), include: map[string]int{}, exclude: map[string]int{},
-		httpClient:                    NewAzcopyHTTPClient(concurrency.MaxIdleConnections),
+		httpClient:                    newAzcopyHTTPClient(concurrency.transportSettings()),
 		logger:                        common.NewJobLogger(jobID, level, appLogger, logFileFolder),
 		chunkStatusLogger:             common.NewChunkStatusLogger(jobID, cpuMon, logFileFolder, enableChunkLogOutput),
 		concurrency:                   concurrency,
 		overwritePrompter:             newOverwritePrompter(),
-		pipelineNetworkStats:          newPipelineNetworkStats(JobsAdmin.(*jobsAdmin).concurrencyTuner), // let the stats coordinate with the concurrency tuner
+		pipelineNetworkStats:          newPipelineNetworkStats(JobsAdmin.(*jobsAdmin).concurrencyTuner, JobsAdmin.(*jobsAdmin).pacer), // let the stats coordinate with the concurrency tuner
 		exclusiveDestinationMapHolder: &atomic.Value{},
 		/*Other fields remain zero-value until this job is scheduled */}
+	jm.completionNotifier = newCompletionNotifier(jm.httpClient, jm.logger)
+	jm.journal = newTransferJournal(logFileFolder, jobID, jm.logger)
+	jm.manifest = newDatasetManifest(logFileFolder, jobID, jm.logger)
+	jm.secondaryReads = newSecondaryReadTracker(jm.logger)
+	jm.accountFailoverDetector = newAccountFailoverDetector()
+	jm.slowestTransfers = newSlowestTransferTracker()
+	jm.sourceDeletions = newSourceDeletionTracker()
+	jm.scanOverlap = newScanOverlapTracker()
+	jm.policyViolations = newPolicyViolationTracker()
+	jm.folderPermissions = newFolderPermissionsTracker()
+	jm.tracer = newJobTracer(jobID, jm.httpClient, jm.logger)
 	jm.reset(appCtx, commandString)
 	jm.logJobsAdminMessages()
 	return &jm
@@ -104,6 +131,105 @@ func (jm *jobMgr) getOverwritePrompter() *overwritePrompter {
 	return jm.overwritePrompter
 }
 
+func (jm *jobMgr) getCompletionNotifier() completionNotifier {
+	return jm.completionNotifier
+}
+
+func (jm *jobMgr) getTransferJournal() *transferJournal {
+	return jm.journal
+}
+
+func (jm *jobMgr) getDatasetManifest() *datasetManifest {
+	return jm.manifest
+}
+
+func (jm *jobMgr) getManifestResult() (path, errorMsg string) {
+	jm.manifestResultLock.Lock()
+	defer jm.manifestResultLock.Unlock()
+	return jm.manifestPath, jm.manifestError
+}
+
+// writeManifest writes the manifest of the dataset, if the job asked for one. It's done before the job is marked as completed,
+// so that the manifest is there by the time AzCopy exits. A manifest that can't be written doesn't fail the job, since
+// the transfers themselves are fine, but it is reported in the summary of the job.
+// If any transfers failed, in this run or an earlier one, the manifest lists them and says it's incomplete
+func (jm *jobMgr) writeManifest(plan *JobPartPlanHeader) {
+	manifestPath, signingKey := plan.Manifest()
+	if manifestPath == "" {
+		return
+	}
+
+	header := datasetManifestHeader{
+		JobID:       jm.jobID,
+		Source:      string(plan.SourceRoot[:plan.SourceRootLength]),
+		Destination: string(plan.DestinationRoot[:plan.DestinationRootLength]),
+		FailedFiles: jm.failedManifestPaths(),
+	}
+	err := jm.manifest.write(jm.ctx, header, manifestPath, signingKey, jm.getInMemoryTransitJobState().credentialInfo.OAuthTokenInfo, jm.httpClient)
+
+	jm.manifestResultLock.Lock()
+	defer jm.manifestResultLock.Unlock()
+	jm.manifestPath = manifestPath
+	if err != nil {
+		jm.manifestError = err.Error()
+		jm.Log(pipeline.LogError, fmt.Sprintf("Failed to write the manifest %s: %v", manifestPath, err))
+	} else {
+		jm.manifestError = ""
+		jm.Log(pipeline.LogInfo, fmt.Sprintf("Wrote the manifest %s", manifestPath))
+	}
+}
+
+// failedManifestPaths returns the destinations of the transfers that failed, in this run or an earlier one, relative to the destination of the job
+func (jm *jobMgr) failedManifestPaths() (failed []string) {
+	jm.jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
+		plan := jpm.Plan()
+		for t := uint32(0); t < plan.NumTransfers; t++ {
+			status := plan.Transfer(t).TransferStatus()
+			if status == common.ETransferStatus.Failed() || status == common.ETransferStatus.BlobTierFailure() {
+				_, dst := plan.TransferSrcDstStrings(t)
+				failed = append(failed, manifestRelativePath(plan, dst))
+			}
+		}
+	})
+	return failed
+}
+
+func (jm *jobMgr) getSecondaryReadTracker() *secondaryReadTracker {
+	return jm.secondaryReads
+}
+
+func (jm *jobMgr) getAccountFailoverDetector() *accountFailoverDetector {
+	return jm.accountFailoverDetector
+}
+
+func (jm *jobMgr) getSlowestTransferTracker() *slowestTransferTracker {
+	return jm.slowestTransfers
+}
+
+func (jm *jobMgr) getSourceDeletionTracker() *sourceDeletionTracker {
+	return jm.sourceDeletions
+}
+
+func (jm *jobMgr) getScanOverlapTracker() *scanOverlapTracker {
+	return jm.scanOverlap
+}
+
+func (jm *jobMgr) getPolicyViolationTracker() *policyViolationTracker {
+	return jm.policyViolations
+}
+
+func (jm *jobMgr) getFolderPermissionsTracker() *folderPermissionsTracker {
+	return jm.folderPermissions
+}
+
+func (jm *jobMgr) getJobStatsCollector() *jobStatsCollector {
+	return jm.stats
+}
+
+func (jm *jobMgr) getTracer() *jobTracer {
+	return jm.tracer
+}
+
 func (jm *jobMgr) reset(appCtx context.Context, commandString string) IJobMgr {
 	jm.logger.OpenLog()
 	// log the user given command to the job log file.
@@ -113,10 +239,14 @@ func (jm *jobMgr) reset(appCtx context.Context, commandString string) IJobMgr {
 		jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Job-Command %s", commandString))
 	}
 	jm.logConcurrencyParameters()
+	if f := faultInjection; f != nil {
+		jm.logger.Log(pipeline.LogWarning, fmt.Sprintf("Fault injection is on (%s): %s", common.EEnvironmentVariable.FaultInjection().Name, f.config))
+	}
 	jm.ctx, jm.cancel = context.WithCancel(appCtx)
 	atomic.StoreUint64(&jm.atomicNumberOfBytesCovered, 0)
 	atomic.StoreUint64(&jm.atomicTotalBytesToXfer, 0)
 	jm.partsDone = 0
+	jm.stats = newJobStatsCollector()
 	return jm
 }
 
@@ -125,6 +255,10 @@ func (jm *jobMgr) logConcurrencyParameters() {
 	// TODO: label max file buffer ram with how we obtained it (env var or default)
 	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max file buffer RAM %.3f GB",
 		float32(JobsAdmin.(*jobsAdmin).cacheLimiter.Limit())/(1024*1024*1024)))
+	if budget := JobsAdmin.(*jobsAdmin).memoryBudget; budget != 0 {
+		jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Memory budget %.3f GB (based on %s)",
+			float32(budget)/(1024*1024*1024), describeTunableSource(common.EEnvironmentVariable.MaxMemoryGB().Name)))
+	}
 
 	dynamicMessage := ""
 	if jm.concurrency.AutoTuneMainPool() {
@@ -134,14 +268,30 @@ func (jm *jobMgr) logConcurrencyParameters() {
 		dynamicMessage,
 		jm.concurrency.MaxMainPoolSize.Value,
 		jm.concurrency.MaxMainPoolSize.GetDescription()))
+	if jm.concurrency.MaxMainPoolSizePerAccount.Value > 0 {
+		jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max concurrent network operations per storage account: %d (%s)",
+			jm.concurrency.MaxMainPoolSizePerAccount.Value,
+			jm.concurrency.MaxMainPoolSizePerAccount.GetDescription()))
+	}
 
 	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Check CPU usage when dynamically tuning concurrency: %t (%s)",
 		jm.concurrency.CheckCpuWhenTuning.Value,
 		jm.concurrency.CheckCpuWhenTuning.GetDescription()))
 
-	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max concurrent transfer initiation routines: %d (%s)",
+	initiationMessage := ""
+	if jm.concurrency.AutoScaleTransferInitiationPool() {
+		initiationMessage = fmt.Sprintf(" will grow with the share of small files from %d up to ", jm.concurrency.InitialTransferInitiationPoolSize)
+	}
+	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max concurrent transfer initiation routines: %s%d (%s)",
+		initiationMessage,
 		jm.concurrency.TransferInitiationPoolSize.Value,
 		jm.concurrency.TransferInitiationPoolSize.GetDescription()))
+	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max concurrent directory listings when scanning: %d (%s)",
+		jm.concurrency.EnumerationPoolSize.Value,
+		jm.concurrency.EnumerationPoolSize.GetDescription()))
+	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max idle connections: %d (%s)",
+		jm.concurrency.MaxIdleConnections.Value,
+		jm.concurrency.MaxIdleConnections.GetDescription()))
 	jm.logger.Log(pipeline.LogInfo, fmt.Sprintf("Max open files when downloading: %d (auto-computed)",
 		jm.concurrency.MaxOpenDownloadFiles))
 }
@@ -188,6 +338,45 @@ type jobMgr struct {
 
 	// only a single instance of the prompter is needed for all transfers
 	overwritePrompter *overwritePrompter
+
+	// tells downstream systems (e.g. an Event Grid topic) as each object lands
+	completionNotifier completionNotifier
+
+	// records each state transition of each transfer, if the job asked for that
+	journal *transferJournal
+
+	// lists the files that landed, for the manifest written when the job completes, if the job asked for one
+	manifest           *datasetManifest
+	manifestResultLock sync.Mutex
+	manifestPath       string
+	manifestError      string
+
+	// shared by all parts, so that failing over to the secondary endpoint of the source is sticky for the whole job
+	secondaryReads *secondaryReadTracker
+
+	// pauses the job when the errors say that the account is failing over
+	accountFailoverDetector *accountFailoverDetector
+
+	// the slowest transfers of the job, for the job summary
+	slowestTransfers *slowestTransferTracker
+
+	// counts the sources deleted after verified transfers, for jobs with move semantics
+	sourceDeletions *sourceDeletionTracker
+
+	// how much of the job was transferred while its source was still being scanned, for the job summary
+	scanOverlap *scanOverlapTracker
+
+	// the files that broke a rule of the content policy of the job, for the job summary
+	policyViolations *policyViolationTracker
+
+	// the directories whose permissions have been copied, for jobs that preserve permissions
+	folderPermissions *folderPermissionsTracker
+
+	// exports the trace of the job, if a collector has been configured. Nil otherwise
+	tracer *jobTracer
+
+	// counts what happened in this run of the job, for the statistics of the jobs that have run on this machine
+	stats *jobStatsCollector
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -296,7 +485,7 @@ func (jm *jobMgr) TryGetPerformanceAdvice(bytesInJob uint64, filesInJob uint32)
 	}
 
 	dir := jm.atomicTransferDirection.AtomicLoad()
-	a := NewPerformanceAdvisor(jm.pipelineNetworkStats, ja.commandLineMbpsCap, int64(megabitsPerSec), finalReason, finalConcurrency, dir, averageBytesPerFile)
+	a := NewPerformanceAdvisor(jm.pipelineNetworkStats, atomic.LoadInt64(&ja.atomicMbpsCap), int64(megabitsPerSec), finalReason, finalConcurrency, dir, averageBytesPerFile)
 	return a.GetAdvice()
 }
 
@@ -304,10 +493,11 @@ func (jm *jobMgr) TryGetPerformanceAdvice(bytesInJob uint64, filesInJob uint32)
 func (jm *jobMgr) AddJobPart(partNum PartNumber, planFile JobPartPlanFileName, sourceSAS string,
 	destinationSAS string, scheduleTransfers bool) IJobPartMgr {
 	jpm := &jobPartMgr{jobMgr: jm, filename: planFile, sourceSAS: sourceSAS,
-		destinationSAS: destinationSAS, pacer: JobsAdmin.(*jobsAdmin).pacer,
+		destinationSAS: destinationSAS, pacer: jm.pipelineNetworkStats.accountCapacity, // passes through to the app-wide pacer, unless the job is held to a fraction of the account limit
 		slicePool:        JobsAdmin.(*jobsAdmin).slicePool,
 		cacheLimiter:     JobsAdmin.(*jobsAdmin).cacheLimiter,
-		fileCountLimiter: JobsAdmin.(*jobsAdmin).fileCountLimiter}
+		fileCountLimiter: JobsAdmin.(*jobsAdmin).fileCountLimiter,
+		diskPacer:        JobsAdmin.(*jobsAdmin).diskPacer}
 	jpm.planMMF = jpm.filename.Map()
 	jm.jobPartMgrs.Set(partNum, jpm)
 	jm.setFinalPartOrdered(partNum, jpm.planMMF.Plan().IsFinalPart)
@@ -452,17 +642,32 @@ func (jm *jobMgr) ReportJobPartDone() uint32 {
 		jm.Log(pipeline.LogInfo, fmt.Sprintf("%s %s successfully completed, cancelled or paused", partDescription, jm.jobID.String()))
 	}
 
+	finalStatus := jobStatus
 	switch jobStatus {
 	case common.EJobStatus.Cancelling():
-		part0Plan.SetJobStatus(common.EJobStatus.Cancelled())
-		if shouldLog {
-			jm.Log(pipeline.LogInfo, fmt.Sprintf("%s %v successfully cancelled", partDescription, jm.jobID))
-		}
+		finalStatus = common.EJobStatus.Cancelled()
 	case common.EJobStatus.InProgress():
-		part0Plan.SetJobStatus((common.EJobStatus).Completed())
+		jm.writeManifest(part0Plan)
+		jm.writeSuccessMarker(jobPart0Mgr)
+		finalStatus = common.EJobStatus.Completed()
 	}
 
-	jm.chunkStatusLogger.FlushLog() // TODO: remove once we sort out what will be calling CloseLog (currently nothing)
+	// everything that reports on the job is finished before the final status is published, since the front end
+	// may exit as soon as it sees the job is done
+	jm.completionNotifier.Flush()
+	jm.tracer.endJob(finalStatus)
+	jm.recordJobStats(part0Plan, finalStatus)
+	jm.PipelineNetworkStats().bandwidth.stop()
+	_ = jm.PipelineNetworkStats().accountCapacity.Close()
+	jm.chunkStatusLogger.FlushLog() // the job log is only closed when the process exits, but the chunk log is needed now
+	jm.logger.CloseRemoteLog()      // and the copy of the job log that's streamed to a blob is sent now, in case the process is killed
+
+	if finalStatus != jobStatus {
+		part0Plan.SetJobStatus(finalStatus)
+	}
+	if jobStatus == common.EJobStatus.Cancelling() && shouldLog {
+		jm.Log(pipeline.LogInfo, fmt.Sprintf("%s %v successfully cancelled", partDescription, jm.jobID))
+	}
 
 	return partsDone
 }
@@ -481,16 +686,33 @@ func (jm *jobMgr) Context() context.Context                { return jm.ctx }
 func (jm *jobMgr) Cancel()                                 { jm.cancel() }
 func (jm *jobMgr) ShouldLog(level pipeline.LogLevel) bool  { return jm.logger.ShouldLog(level) }
 func (jm *jobMgr) Log(level pipeline.LogLevel, msg string) { jm.logger.Log(level, msg) }
+func (jm *jobMgr) LogTransfer(level pipeline.LogLevel, partNum common.PartNumber, transferIndex uint32, msg string) {
+	jm.logger.LogTransfer(level, partNum, transferIndex, msg)
+}
+func (jm *jobMgr) ShouldLogCategory(category common.LogCategory, level pipeline.LogLevel) bool {
+	return jm.logger.ShouldLogCategory(category, level)
+}
+func (jm *jobMgr) LogWithCategory(category common.LogCategory, level pipeline.LogLevel, msg string) {
+	jm.logger.LogWithCategory(category, level, msg)
+}
+func (jm *jobMgr) LogTransferWithCategory(category common.LogCategory, level pipeline.LogLevel, partNum common.PartNumber, transferIndex uint32, msg string) {
+	jm.logger.LogTransferWithCategory(category, level, partNum, transferIndex, msg)
+}
 func (jm *jobMgr) PipelineLogInfo() pipeline.LogOptions {
+	// everything the pipeline logs is about requests and their retries
 	return pipeline.LogOptions{
-		Log:       jm.Log,
-		ShouldLog: func(level pipeline.LogLevel) bool { return level <= jm.logger.MinimumLogLevel() },
+		Log: func(level pipeline.LogLevel, msg string) { jm.LogWithCategory(common.ELogCategory.Retry(), level, msg) },
+		ShouldLog: func(level pipeline.LogLevel) bool {
+			return jm.logger.ShouldLogCategory(common.ELogCategory.Retry(), level)
+		},
 	}
 }
 func (jm *jobMgr) Panic(err error) { jm.logger.Panic(err) }
 func (jm *jobMgr) CloseLog() {
 	jm.logger.CloseLog()
 	jm.chunkStatusLogger.FlushLog()
+	jm.journal.Close()
+	jm.manifest.files.Close()
 }
 
 func (jm *jobMgr) ChunkStatusLogger() common.ChunkStatusLogger {
@@ -502,7 +724,8 @@ func (jm *jobMgr) logJobsAdminMessages() {
 	for {
 		select {
 		case msg := <-JobsAdmin.MessagesForJobLog():
-			jm.Log(pipeline.LogInfo, msg)
+			// these come from the front end, as it scans the source
+			jm.LogWithCategory(common.ELogCategory.Enumeration(), pipeline.LogInfo, msg)
 		default:
 			return
 		}
@@ -6,6 +6,7 @@ import (
 	"mime"
 	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -34,8 +35,11 @@ type IJobPartMgr interface {
 	ScheduleChunks(chunkFunc chunkFunc)
 	RescheduleTransfer(jptm IJobPartTransferMgr)
 	BlobTypeOverride() common.BlobType
+	PropertyMapping() common.PropertyMapping
+	ContentPolicy() common.ContentPolicy
 	BlobTiers() (blockBlobTier common.BlockBlobTier, pageBlobTier common.PageBlobTier)
 	ShouldPutMd5() bool
+	ShouldConvertToVHD() bool
 	SAS() (string, string)
 	//CancelJob()
 	Close()
@@ -46,11 +50,24 @@ type IJobPartMgr interface {
 	SlicePool() common.ByteSlicePooler
 	CacheLimiter() common.CacheLimiter
 	FileCountLimiter() common.CacheLimiter
+	DiskPacer() *diskPacer
 	ExclusiveDestinationMap() *common.ExclusiveStringMap
 	ChunkStatusLogger() common.ChunkStatusLogger
 	common.ILogger
+	common.ITransferLogger
+	common.ICategoryLogger
+	LogTransferWithCategory(category common.LogCategory, level pipeline.LogLevel, partNum common.PartNumber, transferIndex uint32, msg string)
 	SourceProviderPipeline() pipeline.Pipeline
+	destinationPipeline() pipeline.Pipeline
 	getOverwritePrompter() *overwritePrompter
+	getCompletionNotifier() completionNotifier
+	getTransferJournal() *transferJournal
+	getDatasetManifest() *datasetManifest
+	getAccountFailoverDetector() *accountFailoverDetector
+	getSlowestTransferTracker() *slowestTransferTracker
+	getPolicyViolationTracker() *policyViolationTracker
+	getTracer() *jobTracer
+	getJobStatsCollector() *jobStatsCollector
 }
 
 type serviceAPIVersionOverride struct{}
@@ -72,6 +89,10 @@ func NewVersionPolicyFactory() pipeline.Factory {
 			if value := ctx.Value(ServiceAPIVersionOverride); value != nil {
 				request.Header.Set("x-ms-version", value.(string))
 			}
+			// reading a pinned blob version only works on service versions that know about versions
+			if requestUsesBlobVersion(request) && requiresNewerServiceVersion(request.Header.Get("x-ms-version")) {
+				request.Header.Set("x-ms-version", BlobVersioningServiceVersion)
+			}
 			resp, err := next.Do(ctx, request)
 			return resp, err
 		}
@@ -84,26 +105,59 @@ func NewVersionPolicyFactory() pipeline.Factory {
 // number of available network sockets on resource-constrained Linux systems. (E.g. when
 // 'ulimit -Hn' is low).
 func NewAzcopyHTTPClient(maxIdleConns int) *http.Client {
-	return &http.Client{
-		Transport: &http.Transport{
-			Proxy: autoProxy.GetProxyFunc(),
-			DialContext: newDialRateLimiter(&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:           0, // No limit
-			MaxIdleConnsPerHost:    maxIdleConns,
-			IdleConnTimeout:        180 * time.Second,
-			TLSHandshakeTimeout:    10 * time.Second,
-			ExpectContinueTimeout:  1 * time.Second,
-			DisableKeepAlives:      false,
-			DisableCompression:     true, // must disable the auto-decompression of gzipped files, and just download the gzipped version. See https://github.com/Azure/azure-storage-azcopy/issues/374
-			MaxResponseHeaderBytes: 0,
-			//ResponseHeaderTimeout:  time.Duration{},
-			//ExpectContinueTimeout:  time.Duration{},
-		},
+	return newAzcopyHTTPClient(httpTransportSettings{
+		maxIdleConns:    maxIdleConns,
+		idleConnTimeout: defaultIdleConnectionTimeoutSeconds * time.Second,
+	})
+}
+
+// httpTransportSettings are the settings of the connections of an HTTP client.
+// Jobs take them from the tunables, so that users can work around middleboxes that drop idle connections
+type httpTransportSettings struct {
+	maxIdleConns    int
+	maxConnsPerHost int // 0 means no limit
+	idleConnTimeout time.Duration
+	expectContinue  bool
+}
+
+func newAzcopyHTTPClient(s httpTransportSettings) *http.Client {
+	transport := &http.Transport{
+		Proxy: autoProxy.GetProxyFunc(),
+		DialContext: newDialRateLimiter(newResolvingDialer(&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}, sharedResolver)).DialContext,
+		MaxIdleConns:           0, // No limit
+		MaxIdleConnsPerHost:    s.maxIdleConns,
+		MaxConnsPerHost:        s.maxConnsPerHost,
+		IdleConnTimeout:        s.idleConnTimeout,
+		TLSHandshakeTimeout:    10 * time.Second,
+		TLSClientConfig:        common.TLSConfigForMode(),
+		ExpectContinueTimeout:  1 * time.Second, // only applies to requests that send Expect: 100-continue
+		DisableKeepAlives:      false,
+		DisableCompression:     true, // must disable the auto-decompression of gzipped files, and just download the gzipped version. See https://github.com/Azure/azure-storage-azcopy/issues/374
+		MaxResponseHeaderBytes: 0,
+		//ResponseHeaderTimeout:  time.Duration{},
 	}
+	if s.expectContinue {
+		return &http.Client{Transport: expectContinueTransport{transport}}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// expectContinueTransport asks the server to accept each request that has a body before sending the body, so that
+// a request that's refused (e.g. because the server is busy, or the credentials have expired) doesn't send it for nothing
+type expectContinueTransport struct {
+	inner http.RoundTripper
+}
+
+func (t expectContinueTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.ContentLength > 0 && req.Header.Get("Expect") == "" {
+		req = req.Clone(req.Context()) // round trippers must not modify the request they're given
+		req.Header.Set("Expect", "100-continue")
+	}
+	return t.inner.RoundTrip(req)
 }
 
 // Prevents too many dials happening at once, because we've observed that that increases the thread
@@ -111,11 +165,11 @@ func NewAzcopyHTTPClient(maxIdleConns int) *http.Client {
 // call somewhere. It's tidier to avoid creating those excess OS threads.
 // Even our change from Dial (deprecated) to DialContext did not replicate the effect of dialRateLimiter.
 type dialRateLimiter struct {
-	dialer *net.Dialer
+	dialer contextDialer
 	sem    *semaphore.Weighted
 }
 
-func newDialRateLimiter(dialer *net.Dialer) *dialRateLimiter {
+func newDialRateLimiter(dialer contextDialer) *dialRateLimiter {
 	const concurrentDialsPerCpu = 10 // exact value doesn't matter too much, but too low will be too slow, and too high will reduce the beneficial effect on thread count
 	return &dialRateLimiter{
 		dialer,
@@ -137,7 +191,14 @@ func (d *dialRateLimiter) DialContext(ctx context.Context, network, address stri
 func newAzcopyHTTPClientFactory(pipelineHTTPClient *http.Client) pipeline.Factory {
 	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
 		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
-			r, err := pipelineHTTPClient.Do(request.WithContext(ctx))
+			send := func() (*http.Response, error) { return pipelineHTTPClient.Do(request.WithContext(ctx)) }
+			var r *http.Response
+			var err error
+			if faults := faultInjection; faults != nil {
+				r, err = faults.do(ctx, request, send)
+			} else {
+				r, err = send()
+			}
 			if err != nil {
 				err = pipeline.NewError(err, "HTTP request failed")
 			}
@@ -155,6 +216,7 @@ func NewBlobPipeline(c azblob.Credential, o azblob.PipelineOptions, r XferRetryO
 	f := []pipeline.Factory{
 		azblob.NewTelemetryPolicyFactory(o.Telemetry),
 		azblob.NewUniqueRequestIDPolicyFactory(),
+		newTraceContextPolicyFactory(),      // tell the service which trace the requests belong to
 		NewBlobXferRetryPolicyFactory(r),    // actually retry the operation
 		newRetryNotificationPolicyFactory(), // record that a retry status was returned
 		c,
@@ -177,6 +239,7 @@ func NewBlobFSPipeline(c azbfs.Credential, o azbfs.PipelineOptions, r XferRetryO
 	f := []pipeline.Factory{
 		azbfs.NewTelemetryPolicyFactory(o.Telemetry),
 		azbfs.NewUniqueRequestIDPolicyFactory(),
+		newTraceContextPolicyFactory(),      // tell the service which trace the requests belong to
 		NewBFSXferRetryPolicyFactory(r),     // actually retry the operation
 		newRetryNotificationPolicyFactory(), // record that a retry status was returned
 	}
@@ -200,11 +263,14 @@ func NewFilePipeline(c azfile.Credential, o azfile.PipelineOptions, r azfile.Ret
 	f := []pipeline.Factory{
 		azfile.NewTelemetryPolicyFactory(o.Telemetry),
 		azfile.NewUniqueRequestIDPolicyFactory(),
+		newTraceContextPolicyFactory(),      // tell the service which trace the requests belong to
 		azfile.NewRetryPolicyFactory(r),     // actually retry the operation
+		newAccountThrottlePolicyFactory(),   // pace the tries with the other transfers to the account, if it's throttling us
 		newRetryNotificationPolicyFactory(), // record that a retry status was returned
 		c,
 		pipeline.MethodFactoryMarker(), // indicates at what stage in the pipeline the method factory is invoked
 		NewVersionPolicyFactory(),
+		newPosixPropertiesPolicyFactory(),
 		NewRequestLogPolicyFactory(RequestLogOptions{LogWarningIfTryOverThreshold: o.RequestLog.LogWarningIfTryOverThreshold}),
 		newXferStatsPolicyFactory(statsAcc),
 	}
@@ -243,11 +309,17 @@ type jobPartMgr struct {
 	// Additional data shared by all of this Job Part's transfers; initialized when this jobPartMgr is created
 	putMd5 bool
 
+	// Additional data shared by all of this Job Part's transfers; initialized when this jobPartMgr is created
+	convertToVHD bool
+
 	blobMetadata azblob.Metadata
 	fileMetadata azfile.Metadata
 
 	blobTypeOverride common.BlobType // User specified blob type
 
+	propertyMapping common.PropertyMapping // copies properties of the source to other properties of the destination
+	contentPolicy   common.ContentPolicy   // the rules that each file must follow to be transferred as usual
+
 	preserveLastModifiedTime bool
 
 	newJobXfer newJobXfer // Method used to start the transfer
@@ -260,12 +332,19 @@ type jobPartMgr struct {
 
 	cacheLimiter            common.CacheLimiter
 	fileCountLimiter        common.CacheLimiter
+	diskPacer               *diskPacer
 	exclusiveDestinationMap *common.ExclusiveStringMap
 
 	pipeline pipeline.Pipeline // ordered list of Factory objects and an object implementing the HTTPSender interface
 
 	sourceProviderPipeline pipeline.Pipeline
 
+	// copies the permissions of each file and its directories, if the job preserves them. Nil otherwise
+	permissions *permissionsCopier
+
+	// set when the job is resumed after an account failover, so that the transfers check the ETags recorded for their sources
+	revalidateSourceETags bool
+
 	// used defensively to protect double init
 	atomicPipelinesInitedIndicator uint32
 
@@ -279,6 +358,38 @@ func (jpm *jobPartMgr) getOverwritePrompter() *overwritePrompter {
 	return jpm.jobMgr.getOverwritePrompter()
 }
 
+func (jpm *jobPartMgr) getCompletionNotifier() completionNotifier {
+	return jpm.jobMgr.getCompletionNotifier()
+}
+
+func (jpm *jobPartMgr) getTransferJournal() *transferJournal {
+	return jpm.jobMgr.getTransferJournal()
+}
+
+func (jpm *jobPartMgr) getJobStatsCollector() *jobStatsCollector {
+	return jpm.jobMgr.getJobStatsCollector()
+}
+
+func (jpm *jobPartMgr) getTracer() *jobTracer {
+	return jpm.jobMgr.getTracer()
+}
+
+func (jpm *jobPartMgr) getDatasetManifest() *datasetManifest {
+	return jpm.jobMgr.getDatasetManifest()
+}
+
+func (jpm *jobPartMgr) getAccountFailoverDetector() *accountFailoverDetector {
+	return jpm.jobMgr.getAccountFailoverDetector()
+}
+
+func (jpm *jobPartMgr) getSlowestTransferTracker() *slowestTransferTracker {
+	return jpm.jobMgr.getSlowestTransferTracker()
+}
+
+func (jpm *jobPartMgr) getPolicyViolationTracker() *policyViolationTracker {
+	return jpm.jobMgr.getPolicyViolationTracker()
+}
+
 func (jpm *jobPartMgr) Plan() *JobPartPlanHeader { return jpm.planMMF.Plan() }
 
 // ScheduleTransfers schedules this job part's transfers. It is called when a new job part is ordered & is also called to resume a paused Job
@@ -309,6 +420,7 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 	}
 
 	jpm.putMd5 = dstData.PutMd5
+	jpm.convertToVHD = dstData.ConvertToVHD
 	jpm.blockBlobTier = dstData.BlockBlobTier
 	jpm.pageBlobTier = dstData.PageBlobTier
 	jpm.fileHTTPHeaders = azfile.FileHTTPHeaders{
@@ -339,12 +451,25 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 	jpm.preserveLastModifiedTime = plan.DstLocalData.PreserveLastModifiedTime
 
 	jpm.blobTypeOverride = plan.DstBlobData.BlobType
-	jpm.newJobXfer = computeJobXfer(plan.FromTo, plan.DstBlobData.BlobType)
+	jpm.propertyMapping = plan.PropertyMapping()
+	jpm.contentPolicy = plan.ContentPolicy()
+	jpm.newJobXfer = computeJobXfer(plan.FromTo, plan.DstBlobData.BlobType, plan.PropertiesOnly)
 
 	jpm.priority = plan.Priority
 
 	jpm.createPipelines(jobCtx) // pipeline is created per job part manager
 
+	if plan.FolderCreation == common.EFolderCreationPolicy.Eager() {
+		jpm.createFoldersEagerly(jobCtx)
+	}
+
+	if plan.JournalTransitions {
+		jpm.jobMgr.getTransferJournal().enable()
+	}
+	if manifestPath, _ := plan.Manifest(); manifestPath != "" {
+		jpm.jobMgr.getDatasetManifest().enable()
+	}
+
 	// *** Schedule this job part's transfers ***
 	for t := uint32(0); t < plan.NumTransfers; t++ {
 		jppt := plan.Transfer(t)
@@ -382,6 +507,9 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 			}
 		}
 
+		// a transfer that an earlier run started may have left something at its destination
+		resumed := ts == common.ETransferStatus.Started() || ts == common.ETransferStatus.Failed()
+
 		// If the transfer was failed, then while rescheduling the transfer marking it Started.
 		if ts == common.ETransferStatus.Failed() {
 			jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
@@ -396,11 +524,14 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 			transferIndex:       t,
 			ctx:                 transferCtx,
 			cancel:              transferCancel,
+			resumed:             resumed,
 			//TODO: insert the factory func interface in jptm.
 			// numChunks will be set by the transfer's prologue method
 		}
-		if jpm.ShouldLog(pipeline.LogInfo) {
-			jpm.Log(pipeline.LogInfo, fmt.Sprintf("scheduling JobID=%v, Part#=%d, Transfer#=%d, priority=%v", plan.JobID, plan.PartNum, t, plan.Priority))
+		jptm.enableJournal()
+		jptm.journal(common.TransferJournalScheduled, "")
+		if jpm.ShouldLogCategory(common.ELogCategory.Chunk(), pipeline.LogInfo) {
+			jpm.LogWithCategory(common.ELogCategory.Chunk(), pipeline.LogInfo, fmt.Sprintf("scheduling JobID=%v, Part#=%d, Transfer#=%d, priority=%v", plan.JobID, plan.PartNum, t, plan.Priority))
 		}
 
 		JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm)
@@ -423,6 +554,34 @@ func (jpm *jobPartMgr) RescheduleTransfer(jptm IJobPartTransferMgr) {
 	JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm)
 }
 
+// requeueTransfer schedules a transfer that ran over its time budget one more time, with a fresh transfer manager.
+// The transfer is not counted as done, so the job part keeps waiting for it
+func (jpm *jobPartMgr) requeueTransfer(failed *jobPartTransferMgr) (transfersDone uint32) {
+	jppt := failed.jobPartPlanTransfer
+	jppt.SetErrorCode(0, true)
+	jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
+
+	transferCtx, transferCancel := context.WithCancel(jpm.jobMgr.Context())
+	jptm := &jobPartTransferMgr{
+		jobPartMgr:          jpm,
+		jobPartPlanTransfer: jppt,
+		transferIndex:       failed.transferIndex,
+		ctx:                 transferCtx,
+		cancel:              transferCancel,
+		startTime:           failed.startTime, // so that the time reported for the transfer covers both attempts
+		requeued:            true,
+	}
+	jptm.enableJournal()
+	jptm.journal(common.TransferJournalRequeued, "it ran over its time budget")
+	if jpm.ShouldLog(pipeline.LogInfo) {
+		plan := jpm.Plan()
+		jpm.Log(pipeline.LogInfo, fmt.Sprintf("requeuing JobID=%v, Part#=%d, Transfer#=%d, since it ran over its time budget", plan.JobID, plan.PartNum, failed.transferIndex))
+	}
+
+	JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm)
+	return atomic.LoadUint32(&jpm.atomicTransfersDone)
+}
+
 func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 	if atomic.SwapUint32(&jpm.atomicPipelinesInitedIndicator, 1) != 0 {
 		panic("init client and pipelines for same jobPartMgr twice")
@@ -438,19 +597,48 @@ func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 	}
 
 	credOption := common.CredentialOpOptions{
-		LogInfo:  func(str string) { jpm.Log(pipeline.LogInfo, str) },
-		LogError: func(str string) { jpm.Log(pipeline.LogError, str) },
+		LogInfo:  func(str string) { jpm.LogWithCategory(common.ELogCategory.Auth(), pipeline.LogInfo, str) },
+		LogError: func(str string) { jpm.LogWithCategory(common.ELogCategory.Auth(), pipeline.LogError, str) },
 		Panic:    jpm.Panic,
 		CallerID: fmt.Sprintf("JobID=%v, Part#=%d", jpm.Plan().JobID, jpm.Plan().PartNum),
 		Cancel:   jpm.jobMgr.Cancel,
 	}
 	// TODO: Consider to remove XferRetryPolicy and Options?
 	xferRetryOption := XferRetryOptions{
-		Policy:        0,
-		MaxTries:      UploadMaxTries, // TODO: Consider to unify options.
-		TryTimeout:    UploadTryTimeout,
-		RetryDelay:    UploadRetryDelay,
-		MaxRetryDelay: UploadMaxRetryDelay}
+		Policy:            0,
+		MaxTries:          UploadMaxTries, // TODO: Consider to unify options.
+		TryTimeout:        UploadTryTimeout,
+		PerRequestTimeout: perRequestTimeout,
+		RetryDelay:        UploadRetryDelay,
+		MaxRetryDelay:     UploadMaxRetryDelay}
+
+	// downloads from RA-GRS accounts may read from the secondary endpoint when the primary is failing
+	if plan := jpm.planMMF.Plan(); fromTo == common.EFromTo.BlobLocal() && plan.AllowSecondaryRead {
+		if sourceURL, err := url.Parse(string(plan.SourceRoot[:plan.SourceRootLength])); err != nil {
+			jpm.Log(pipeline.LogError, fmt.Sprintf("cannot read from the secondary endpoint, as the source root can't be parsed: %v", err))
+		} else if secondaryHost, err := GetSecondaryReadHost(sourceURL.Host); err != nil {
+			jpm.Log(pipeline.LogError, "cannot read from the secondary endpoint: "+err.Error())
+		} else {
+			xferRetryOption.RetryReadsFromSecondaryHost = secondaryHost
+			xferRetryOption.secondaryReads = jpm.jobMgr.getSecondaryReadTracker()
+		}
+	}
+
+	// hold back writes to destinations whose latency is too high
+	if plan := jpm.planMMF.Plan(); plan.MaxWriteLatencyMilliseconds > 0 {
+		jpm.jobMgr.PipelineNetworkStats().writeBackPressure.enable(time.Duration(plan.MaxWriteLatencyMilliseconds)*time.Millisecond, jpm.jobMgr)
+	}
+
+	// keep the job under a fraction of what the account can take, as shown by the 503s that say it's over its limit
+	if plan := jpm.planMMF.Plan(); plan.MaxAccountThroughputFraction > 0 {
+		jpm.jobMgr.PipelineNetworkStats().accountCapacity.enable(float64(plan.MaxAccountThroughputFraction), jpm.jobMgr)
+	}
+
+	// record the bandwidth used by the job, per day, and stop scheduling chunks once the day's cap (if any) has been used
+	if ja, ok := JobsAdmin.(*jobsAdmin); ok {
+		plan := jpm.planMMF.Plan()
+		jpm.jobMgr.PipelineNetworkStats().bandwidth.enable(plan.JobID, common.BandwidthUsageFilePath(ja.planDir), plan.DailyCapBytes, jpm.jobMgr)
+	}
 
 	var statsAccForSip *pipelineNetworkStats = nil // we don'nt accumulate stats on the source info provider
 
@@ -490,12 +678,41 @@ func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 			statsAccForSip)
 	}
 
+	if fromTo.From() == common.ELocation.Http() {
+		jpm.sourceProviderPipeline = NewHTTPSourcePipeline(
+			azblob.PipelineOptions{
+				Log: jpm.jobMgr.PipelineLogInfo(),
+				Telemetry: azblob.TelemetryOptions{
+					Value: userAgent,
+				},
+			},
+			xferRetryOption,
+			jpm.jobMgr.HttpClient(),
+			statsAccForSip)
+	}
+
+	// access control can only be read and written through the dfs endpoints, so copying it needs pipelines of its own
+	if jpm.planMMF.Plan().PreservePermissions {
+		bfsOptions := azbfs.PipelineOptions{
+			Log: jpm.jobMgr.PipelineLogInfo(),
+			Telemetry: azbfs.TelemetryOptions{
+				Value: userAgent,
+			},
+		}
+		jpm.permissions = &permissionsCopier{
+			srcPipeline: NewBlobFSPipeline(azbfs.NewAnonymousCredential(), bfsOptions, xferRetryOption, jpm.pacer, jpm.jobMgr.HttpClient(), statsAccForSip),
+			dstPipeline: NewBlobFSPipeline(common.CreateBlobFSCredential(ctx, credInfo, credOption), bfsOptions, xferRetryOption, jpm.pacer,
+				jpm.jobMgr.HttpClient(), jpm.jobMgr.PipelineNetworkStats()),
+			folders: jpm.jobMgr.getFolderPermissionsTracker(),
+		}
+	}
+
 	// Create pipeline for data transfer.
 	switch fromTo {
-	case common.EFromTo.BlobTrash(), common.EFromTo.BlobLocal(), common.EFromTo.LocalBlob(), common.EFromTo.BenchmarkBlob(),
-		common.EFromTo.BlobBlob(), common.EFromTo.FileBlob(), common.EFromTo.S3Blob():
+	case common.EFromTo.BlobTrash(), common.EFromTo.BlobLocal(), common.EFromTo.LocalBlob(), common.EFromTo.BenchmarkBlob(), common.EFromTo.HttpBlob(),
+		common.EFromTo.SftpBlob(), common.EFromTo.BlobSftp(), common.EFromTo.BlobBlob(), common.EFromTo.FileBlob(), common.EFromTo.S3Blob():
 		credential := common.CreateBlobCredential(ctx, credInfo, credOption)
-		jpm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v, credential type: %v", jpm.Plan().JobID, credInfo.CredentialType))
+		jpm.LogWithCategory(common.ELogCategory.Auth(), pipeline.LogInfo, fmt.Sprintf("JobID=%v, credential type: %v", jpm.Plan().JobID, credInfo.CredentialType))
 		jpm.pipeline = NewBlobPipeline(
 			credential,
 			azblob.PipelineOptions{
@@ -511,7 +728,7 @@ func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 	// Create pipeline for Azure BlobFS.
 	case common.EFromTo.BlobFSLocal(), common.EFromTo.LocalBlobFS(), common.EFromTo.BenchmarkBlobFS():
 		credential := common.CreateBlobFSCredential(ctx, credInfo, credOption)
-		jpm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v, credential type: %v", jpm.Plan().JobID, credInfo.CredentialType))
+		jpm.LogWithCategory(common.ELogCategory.Auth(), pipeline.LogInfo, fmt.Sprintf("JobID=%v, credential type: %v", jpm.Plan().JobID, credInfo.CredentialType))
 
 		jpm.pipeline = NewBlobFSPipeline(
 			credential,
@@ -546,6 +763,8 @@ func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 			jpm.pacer,
 			jpm.jobMgr.HttpClient(),
 			jpm.jobMgr.PipelineNetworkStats())
+	// Copies between local paths don't talk to any service, so they have no pipeline.
+	case common.EFromTo.LocalLocal():
 	default:
 		panic(fmt.Errorf("Unrecognized from-to: %q", fromTo.String()))
 	}
@@ -559,6 +778,10 @@ func (jpm *jobPartMgr) CacheLimiter() common.CacheLimiter {
 	return jpm.cacheLimiter
 }
 
+func (jpm *jobPartMgr) DiskPacer() *diskPacer {
+	return jpm.diskPacer
+}
+
 func (jpm *jobPartMgr) FileCountLimiter() common.CacheLimiter {
 	return jpm.fileCountLimiter
 }
@@ -613,6 +836,14 @@ func (jpm *jobPartMgr) BlobTypeOverride() common.BlobType {
 	return jpm.blobTypeOverride
 }
 
+func (jpm *jobPartMgr) PropertyMapping() common.PropertyMapping {
+	return jpm.propertyMapping
+}
+
+func (jpm *jobPartMgr) ContentPolicy() common.ContentPolicy {
+	return jpm.contentPolicy
+}
+
 func (jpm *jobPartMgr) BlobTiers() (blockBlobTier common.BlockBlobTier, pageBlobTier common.PageBlobTier) {
 	return jpm.blockBlobTier, jpm.pageBlobTier
 }
@@ -621,6 +852,10 @@ func (jpm *jobPartMgr) ShouldPutMd5() bool {
 	return jpm.putMd5
 }
 
+func (jpm *jobPartMgr) ShouldConvertToVHD() bool {
+	return jpm.convertToVHD
+}
+
 func (jpm *jobPartMgr) SAS() (string, string) {
 	return jpm.sourceSAS, jpm.destinationSAS
 }
@@ -633,6 +868,50 @@ func (jpm *jobPartMgr) deleteSnapshotsOption() common.DeleteSnapshotsOption {
 	return jpm.Plan().DeleteSnapshotsOption
 }
 
+func (jpm *jobPartMgr) sourceChangePolicy() common.SourceChangePolicy {
+	return jpm.Plan().SourceChangePolicy
+}
+
+// sourcePipeline returns the pipeline for requests to a remote source: the main pipeline when downloading,
+// and the source provider pipeline when copying
+func (jpm *jobPartMgr) sourcePipeline() pipeline.Pipeline {
+	if jpm.Plan().FromTo.IsS2S() {
+		return jpm.sourceProviderPipeline
+	}
+	return jpm.pipeline
+}
+
+// destinationPipeline returns the pipeline for requests to a remote destination
+func (jpm *jobPartMgr) destinationPipeline() pipeline.Pipeline {
+	return jpm.pipeline
+}
+
+// deleteSourceOfVerifiedTransfer deletes the source of a transfer that has succeeded (which includes passing the
+// checks of the destination that the job asked for), if the job has move semantics. A source whose hash wasn't compared
+// with that of the content as it was transferred (e.g. since none was stored for it) is kept, since only its length was checked
+func (jpm *jobPartMgr) deleteSourceOfVerifiedTransfer(jptm *jobPartTransferMgr) {
+	plan := jpm.Plan()
+	if plan.DeleteSourceAfter != common.EDeleteSourceAfter.Verified() {
+		return
+	}
+
+	source := jptm.Info().Source
+	sourceWithoutSAS := strings.Split(source, "?")[0]
+	tracker := jpm.jobMgr.getSourceDeletionTracker()
+	if !jptm.contentHashVerified() {
+		jpm.Log(pipeline.LogWarning, fmt.Sprintf("SOURCE NOT DELETED: %s: %v", sourceWithoutSAS, errSourceHashNotVerified))
+		tracker.recordFailure(sourceWithoutSAS, errSourceHashNotVerified)
+		return
+	}
+	if err := deleteVerifiedSource(jpm.jobMgr.Context(), plan.FromTo, source, jptm.LastModifiedTime(), jpm.sourcePipeline()); err != nil {
+		jpm.Log(pipeline.LogError, fmt.Sprintf("SOURCE NOT DELETED: %s: %v", sourceWithoutSAS, err))
+		tracker.recordFailure(sourceWithoutSAS, err)
+		return
+	}
+	jpm.Log(pipeline.LogInfo, fmt.Sprintf("SOURCE DELETED: %s", sourceWithoutSAS))
+	tracker.recordDeleted()
+}
+
 // Call Done when a transfer has completed its epilog; this method returns the number of transfers completed so far
 func (jpm *jobPartMgr) ReportTransferDone() (transfersDone uint32) {
 	transfersDone = atomic.AddUint32(&jpm.atomicTransfersDone, 1)
@@ -646,6 +925,13 @@ func (jpm *jobPartMgr) ReportTransferDone() (transfersDone uint32) {
 	return transfersDone
 }
 
+// recordJobBytesTransferred adds a transfer that has succeeded to the running total that part 0 keeps for the job
+func (jpm *jobPartMgr) recordJobBytesTransferred(bytes int64) {
+	if part0, ok := jpm.jobMgr.JobPartMgr(0); ok {
+		part0.Plan().addJobBytesTransferred(uint64(bytes))
+	}
+}
+
 //func (jpm *jobPartMgr) Cancel() { jpm.jobMgr.Cancel() }
 func (jpm *jobPartMgr) Close() {
 	jpm.planMMF.Unmap()
@@ -677,6 +963,18 @@ func (jpm *jobPartMgr) ReleaseAConnection() {
 func (jpm *jobPartMgr) ShouldLog(level pipeline.LogLevel) bool  { return jpm.jobMgr.ShouldLog(level) }
 func (jpm *jobPartMgr) Log(level pipeline.LogLevel, msg string) { jpm.jobMgr.Log(level, msg) }
 func (jpm *jobPartMgr) Panic(err error)                         { jpm.jobMgr.Panic(err) }
+func (jpm *jobPartMgr) LogTransfer(level pipeline.LogLevel, partNum common.PartNumber, transferIndex uint32, msg string) {
+	jpm.jobMgr.LogTransfer(level, partNum, transferIndex, msg)
+}
+func (jpm *jobPartMgr) ShouldLogCategory(category common.LogCategory, level pipeline.LogLevel) bool {
+	return jpm.jobMgr.ShouldLogCategory(category, level)
+}
+func (jpm *jobPartMgr) LogWithCategory(category common.LogCategory, level pipeline.LogLevel, msg string) {
+	jpm.jobMgr.LogWithCategory(category, level, msg)
+}
+func (jpm *jobPartMgr) LogTransferWithCategory(category common.LogCategory, level pipeline.LogLevel, partNum common.PartNumber, transferIndex uint32, msg string) {
+	jpm.jobMgr.LogTransferWithCategory(category, level, partNum, transferIndex, msg)
+}
 func (jpm *jobPartMgr) ChunkStatusLogger() common.ChunkStatusLogger {
 	return jpm.jobMgr.ChunkStatusLogger()
 }
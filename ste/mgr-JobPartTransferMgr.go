@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -26,24 +27,33 @@ type IJobPartTransferMgr interface {
 	LastModifiedTime() time.Time
 	PreserveLastModifiedTime() (time.Time, bool)
 	ShouldPutMd5() bool
+	ShouldConvertToVHD() bool
 	MD5ValidationOption() common.HashValidationOption
 	BlobTypeOverride() common.BlobType
+	PropertyMapping() common.PropertyMapping
 	BlobTiers() (blockBlobTier common.BlockBlobTier, pageBlobTier common.PageBlobTier)
 	JobHasLowFileCount() bool
 	//ScheduleChunk(chunkFunc chunkFunc)
 	Context() context.Context
 	SlicePool() common.ByteSlicePooler
 	CacheLimiter() common.CacheLimiter
+	DiskPacer() *diskPacer
 	WaitUntilLockDestination(ctx context.Context) error
 	UnlockDestination()
 	HoldsDestinationLock() bool
 	StartJobXfer()
 	GetOverwriteOption() common.OverwriteOption
+	WriteOnce() bool
+	Resumed() bool
+	DestinationExistedBefore() bool
+	PreservePosixProperties() bool
 	ShouldDecompress() bool
 	GetSourceCompressionType() (common.CompressionType, error)
 	ReportChunkDone(id common.ChunkID) (lastChunk bool, chunksDone uint32)
 	TransferStatusIgnoringCancellation() common.TransferStatus
 	SetStatus(status common.TransferStatus)
+	ReportVerified(check string)
+	SetContentMD5(hash []byte)
 	SetErrorCode(errorCode int32)
 	SetNumberOfChunks(numChunks uint32)
 	SetActionAfterLastChunk(f func())
@@ -82,7 +92,14 @@ type IJobPartTransferMgr interface {
 	LogAtLevelForCurrentTransfer(level pipeline.LogLevel, msg string)
 	GetOverwritePrompter() *overwritePrompter
 	common.ILogger
+	common.ICategoryLogger
 	DeleteSnapshotsOption() common.DeleteSnapshotsOption
+	SourceChangedStatus() common.TransferStatus
+	RestartForChangedSource(lmt time.Time, size int64) bool
+	RecordLatestSourceVersion(lmt time.Time, size int64)
+	FailIfSourceChangedSinceScan()
+	PreservePermissions()
+	PreservePosixPropertiesOfDownload()
 }
 
 type TransferInfo struct {
@@ -101,6 +118,7 @@ type TransferInfo struct {
 	// Blob
 	SrcBlobType    azblob.BlobType       // used for both S2S and for downloads to local from blob
 	S2SSrcBlobTier azblob.AccessTierType // AccessTierType (string) is used to accommodate service-side support matrix change.
+	SrcETag        string                // the ETag of the source when it was enumerated, if it was recorded
 
 	// NumChunks is the number of chunks in which transfer will be split into while uploading the transfer.
 	// NumChunks is not used in case of AppendBlob transfer.
@@ -136,6 +154,15 @@ type jobPartTransferMgr struct {
 	// used to show whether THIS jptm holds the destination lock
 	atomicDestLockHeldIndicator uint32
 
+	// how many times this transfer has been restarted because its source changed before any data was sent
+	atomicSourceChangeRestarts int32
+
+	// set when the file broke the content policy, and the policy quarantines such files
+	atomicQuarantined uint32
+
+	// used to show whether the transfer was failed because it ran over its time budget
+	atomicTimeBudgetExceeded uint32
+
 	jobPartMgr          IJobPartMgr // Refers to the "owning" Job Part
 	jobPartPlanTransfer *JobPartPlanTransfer
 	transferIndex       uint32
@@ -150,6 +177,35 @@ type jobPartTransferMgr struct {
 
 	actionAfterLastChunk func()
 
+	// when the transfer was first started (before any requeue), and the timer that fails it if it runs over its time budget
+	startTime       time.Time
+	timeBudgetTimer *time.Timer
+
+	// true if this is the second attempt at a transfer that ran over its time budget. Such transfers are only requeued once
+	requeued bool
+
+	// true if an earlier run of the job started this transfer, so what's at the destination may have been written by that run
+	resumed bool
+
+	// 1 if the transfer failed because its destination already existed, in a write-once job
+	atomicDestinationExistedBefore int32
+
+	// keeps the ID of the latest request, for the journal entries of the transfer. Nil if the job is not journaled
+	requestIDs *requestIDRecorder
+
+	// the span of the transfer in the trace of the job. Nil if the job is not traced
+	traceSpan *traceSpan
+
+	// the MD5 hash of the content, as computed while it was transferred, for the manifest of the job
+	atomicContentMD5 atomic.Value
+
+	// 1 once the hash of the content, as it was transferred, has been compared with (and matched) the hash stored for the source
+	atomicContentHashVerified int32
+
+	// the block size chosen for this transfer, when the user didn't give one. Chosen only once, so that it can't change part way through
+	chooseBlockSizeOnce sync.Once
+	chosenBlockSize     uint32
+
 	/*
 		@Parteek removed 3/23 morning, as jeff ad equivalent
 		// transfer chunks are put into this channel and execution engine takes chunk out of this channel.
@@ -165,13 +221,88 @@ func (jptm *jobPartTransferMgr) FromTo() common.FromTo {
 }
 
 func (jptm *jobPartTransferMgr) StartJobXfer() {
+	if jptm.startTime.IsZero() {
+		jptm.startTime = time.Now()
+	}
+	jptm.journal(common.TransferJournalStarted, "")
+	jptm.startTrace()
+	jptm.startTimeBudget()
+	if !jptm.checkContentPolicy() {
+		return
+	}
 	jptm.jobPartMgr.StartJobXfer(jptm)
 }
 
+// startTrace starts the span of the transfer, and puts it in the context so that the requests of the transfer can refer to it
+func (jptm *jobPartTransferMgr) startTrace() {
+	plan := jptm.jobPartMgr.Plan()
+	src, dst := plan.TransferSrcDstStrings(jptm.transferIndex)
+	jptm.traceSpan = jptm.jobPartMgr.getTracer().startTransferSpan(src, dst, jptm.jobPartPlanTransfer.SourceSize, plan.PartNum, jptm.transferIndex)
+	jptm.ctx = withTraceSpan(jptm.ctx, jptm.traceSpan)
+}
+
+// endTrace ends the span of the transfer, marking it as failed if the transfer didn't succeed
+func (jptm *jobPartTransferMgr) endTrace(status common.TransferStatus) {
+	if jptm.traceSpan == nil {
+		return
+	}
+	jptm.traceSpan.setAttribute("azcopy.transfer_status", status.String())
+	errorMessage := ""
+	if status < 0 && status != common.ETransferStatus.SkippedFileAlreadyExists() && status != common.ETransferStatus.SkippedContentPolicy() &&
+		status != common.ETransferStatus.SkippedInfected() {
+		errorMessage = fmt.Sprintf("transfer %s (error code %d)", status, jptm.ErrorCode())
+	}
+	jptm.traceSpan.end(errorMessage)
+}
+
+// startTimeBudget arranges for the transfer to be failed if it is still running when its time budget, which is scaled
+// by the size of the file, runs out. ReportTransferDone then requeues it once, in case it was just unlucky
+func (jptm *jobPartTransferMgr) startTimeBudget() {
+	secondsPerGB := jptm.jobPartMgr.Plan().FileTimeBudgetSecondsPerGB
+	if secondsPerGB == 0 {
+		return
+	}
+
+	budget := transferTimeBudget(secondsPerGB, jptm.jobPartPlanTransfer.SourceSize)
+	jptm.timeBudgetTimer = time.AfterFunc(budget, func() {
+		if !jptm.IsLive() {
+			return
+		}
+		atomic.StoreUint32(&jptm.atomicTimeBudgetExceeded, 1)
+		where := fmt.Sprintf("the time budget of %v ran out", budget)
+		if isUpload, isCopy := jptm.TempJudgeUploadOrCopy(); isUpload || isCopy {
+			jptm.FailActiveSend(where, errTransferTimeBudgetExceeded)
+		} else {
+			jptm.FailActiveDownload(where, errTransferTimeBudgetExceeded)
+		}
+	})
+}
+
 func (jptm *jobPartTransferMgr) GetOverwriteOption() common.OverwriteOption {
 	return jptm.jobPartMgr.GetOverwriteOption()
 }
 
+// WriteOnce tells whether writes to the destination must fail, rather than overwrite it, if it already exists
+func (jptm *jobPartTransferMgr) WriteOnce() bool {
+	return jptm.jobPartMgr.Plan().WriteOnce
+}
+
+// PreservePosixProperties tells whether the owner, group and mode of the file are kept, for Azure Files NFS shares
+// Resumed says whether an earlier run of the job started this transfer
+func (jptm *jobPartTransferMgr) Resumed() bool {
+	return jptm.resumed
+}
+
+// DestinationExistedBefore says whether the transfer failed because the destination was already there, in a write-once job.
+// Such a destination is not the transfer's to clean up
+func (jptm *jobPartTransferMgr) DestinationExistedBefore() bool {
+	return atomic.LoadInt32(&jptm.atomicDestinationExistedBefore) == 1
+}
+
+func (jptm *jobPartTransferMgr) PreservePosixProperties() bool {
+	return jptm.jobPartMgr.Plan().PreservePosixProperties
+}
+
 func (jptm *jobPartTransferMgr) ShouldDecompress() bool {
 	if jptm.jobPartMgr.AutoDecompress() {
 		ct, _ := jptm.GetSourceCompressionType()
@@ -189,6 +320,9 @@ func (jptm *jobPartTransferMgr) Info() TransferInfo {
 	plan := jptm.jobPartMgr.Plan()
 	src, dst := plan.TransferSrcDstStrings(jptm.transferIndex)
 	dstBlobData := plan.DstBlobData
+	if jptm.isQuarantined() {
+		dst = quarantineDestination(string(plan.DestinationRoot[:plan.DestinationRootLength]), dst, jptm.jobPartMgr.ContentPolicy().QuarantineFolder)
+	}
 
 	srcHTTPHeaders, srcMetadata, srcBlobType, srcBlobTier, s2sGetPropertiesInBackend, DestLengthValidation, s2sSourceChangeValidation, s2sInvalidMetadataHandleOption :=
 		plan.TransferSrcPropertiesAndMetadata(jptm.transferIndex)
@@ -229,17 +363,24 @@ func (jptm *jobPartTransferMgr) Info() TransferInfo {
 		src = sUrl.String()
 	}
 
+	// If the transfer was pinned to a version of the source blob at enumeration time,
+	// read that version, so that the job copies a consistent point-in-time view of the source
+	if versionID := plan.TransferSrcVersionID(jptm.transferIndex); versionID != "" {
+		src = addBlobVersionID(src, versionID)
+	}
+
 	sourceSize := plan.Transfer(jptm.transferIndex).SourceSize
 	var blockSize = dstBlobData.BlockSize
 	// If the blockSize is 0, then User didn't provide any blockSize
 	// We need to set the blockSize in such way that number of blocks per blob
-	// does not exceeds 50000 (max number of block per blob)
+	// does not exceeds 50000 (max number of block per blob), and that suits this file, and the network we are on
 	if blockSize == 0 {
-		blockSize = uint32(common.DefaultBlockBlobBlockSize)
-		for ; uint32(sourceSize/int64(blockSize)) > common.MaxNumberOfBlocksPerBlob; blockSize = 2 * blockSize {
-		}
+		blockSize = jptm.adaptiveBlockSize(sourceSize)
 	}
 	blockSize = common.Iffuint32(blockSize > common.MaxBlockBlobBlockSize, common.MaxBlockBlobBlockSize, blockSize)
+	if ja, ok := JobsAdmin.(*jobsAdmin); ok {
+		blockSize = limitBlockSizeToChunkRam(blockSize, ja.cacheLimiter.Limit())
+	}
 
 	return TransferInfo{
 		BlockSize:                      blockSize,
@@ -256,6 +397,7 @@ func (jptm *jobPartTransferMgr) Info() TransferInfo {
 		},
 		SrcBlobType:    srcBlobType,
 		S2SSrcBlobTier: srcBlobTier,
+		SrcETag:        plan.TransferSrcETag(jptm.transferIndex),
 	}
 }
 
@@ -271,6 +413,10 @@ func (jptm *jobPartTransferMgr) CacheLimiter() common.CacheLimiter {
 	return jptm.jobPartMgr.CacheLimiter()
 }
 
+func (jptm *jobPartTransferMgr) DiskPacer() *diskPacer {
+	return jptm.jobPartMgr.DiskPacer()
+}
+
 func (jptm *jobPartTransferMgr) FileCountLimiter() common.CacheLimiter {
 	return jptm.jobPartMgr.FileCountLimiter()
 }
@@ -340,17 +486,58 @@ func (jptm *jobPartTransferMgr) HoldsDestinationLock() bool {
 
 func (jptm *jobPartTransferMgr) useFileCountLimiter() bool {
 	ft := jptm.FromTo()    // TODO: consider changing isDownload (and co) to have struct receiver instead of pointer receiver, so don't need variable like this
-	return ft.IsDownload() // count-based limits are only applied for download a present
+	return ft.IsDownload() || ft == common.EFromTo.LocalLocal() // count-based limits are only applied when writing local files, i.e. for download and local copies, at present
 }
 
 func (jptm *jobPartTransferMgr) RescheduleTransfer() {
 	jptm.jobPartMgr.RescheduleTransfer(jptm)
 }
 
+// adaptiveBlockSize chooses the block size for this transfer, from the size of the file, and the latency and throughput we've measured so far
+func (jptm *jobPartTransferMgr) adaptiveBlockSize(sourceSize int64) uint32 {
+	jptm.chooseBlockSizeOnce.Do(func() {
+		latency := time.Duration(0)
+		if jpm, ok := jptm.jobPartMgr.(*jobPartMgr); ok && jpm.jobMgr != nil {
+			latency = time.Duration(jpm.jobMgr.PipelineNetworkStats().AverageLatencyMilliseconds()) * time.Millisecond
+		}
+		bytesPerSecondPerConnection := float64(0)
+		if ja, ok := JobsAdmin.(*jobsAdmin); ok {
+			bytesPerSecondPerConnection = ja.bytesPerSecondPerConnection()
+		}
+
+		var reason string
+		jptm.chosenBlockSize, reason = chooseBlockSize(sourceSize, latency, bytesPerSecondPerConnection)
+		if sourceSize > int64(jptm.chosenBlockSize) && jptm.ShouldLog(pipeline.LogInfo) { // the choice doesn't matter if the file fits in one block
+			jptm.Log(pipeline.LogInfo, fmt.Sprintf("Block size %d MiB chosen, %s", jptm.chosenBlockSize/(1024*1024), reason))
+		}
+	})
+	return jptm.chosenBlockSize
+}
+
 func (jptm *jobPartTransferMgr) ScheduleChunks(chunkFunc chunkFunc) {
+	// once the day's bandwidth has been used, hold back new chunks until the next day
+	if jpm, ok := jptm.jobPartMgr.(*jobPartMgr); ok && jpm.jobMgr != nil {
+		jpm.jobMgr.PipelineNetworkStats().bandwidth.waitForBudget(jptm.ctx)
+	}
+	if ja, ok := JobsAdmin.(*jobsAdmin); ok && ja.accountLimiter != nil {
+		chunkFunc = ja.accountLimiter.limitChunkFunc(jptm.remoteAccount(), chunkFunc, jptm.jobPartMgr.ScheduleChunks)
+	}
 	jptm.jobPartMgr.ScheduleChunks(chunkFunc)
 }
 
+// remoteAccount returns the storage account that this transfer's chunks send their requests to.
+// That's the destination, if it's remote (including the S2S case, where the destination reads from the source), else the source
+func (jptm *jobPartTransferMgr) remoteAccount() string {
+	src, dst := jptm.jobPartMgr.Plan().TransferSrcDstStrings(jptm.transferIndex)
+	fromTo := jptm.FromTo()
+	if fromTo.To().IsRemote() {
+		return accountOfURL(dst)
+	} else if fromTo.From().IsRemote() {
+		return accountOfURL(src)
+	}
+	return ""
+}
+
 func (jptm *jobPartTransferMgr) BlobDstData(dataFileToXfer []byte) (headers azblob.BlobHTTPHeaders, metadata azblob.Metadata) {
 	return jptm.jobPartMgr.(*jobPartMgr).blobDstData(jptm.Info().Source, dataFileToXfer)
 }
@@ -382,6 +569,10 @@ func (jptm *jobPartTransferMgr) ShouldPutMd5() bool {
 	return jptm.jobPartMgr.ShouldPutMd5()
 }
 
+func (jptm *jobPartTransferMgr) ShouldConvertToVHD() bool {
+	return jptm.jobPartMgr.ShouldConvertToVHD()
+}
+
 func (jptm *jobPartTransferMgr) MD5ValidationOption() common.HashValidationOption {
 	return jptm.jobPartMgr.(*jobPartMgr).localDstData().MD5VerificationOption
 }
@@ -390,10 +581,87 @@ func (jptm *jobPartTransferMgr) DeleteSnapshotsOption() common.DeleteSnapshotsOp
 	return jptm.jobPartMgr.(*jobPartMgr).deleteSnapshotsOption()
 }
 
+// SourceChangedStatus returns the status with which to end a transfer whose source has changed since it was scheduled
+func (jptm *jobPartTransferMgr) SourceChangedStatus() common.TransferStatus {
+	return sourceChangedStatus(jptm.jobPartMgr.(*jobPartMgr).sourceChangePolicy())
+}
+
+// RestartForChangedSource is used when the source changed before any data was sent. Under the RescheduleLatest policy,
+// it records the latest version of the source and returns true, meaning the caller should start the transfer over.
+func (jptm *jobPartTransferMgr) RestartForChangedSource(lmt time.Time, size int64) bool {
+	if jptm.jobPartMgr.(*jobPartMgr).sourceChangePolicy() != common.ESourceChangePolicy.RescheduleLatest() ||
+		atomic.AddInt32(&jptm.atomicSourceChangeRestarts, 1) > maxSourceChangeRestarts {
+		return false
+	}
+	jptm.RecordLatestSourceVersion(lmt, size)
+	return true
+}
+
+// RecordLatestSourceVersion saves the properties of the latest version of the source in the plan file, under the
+// RescheduleLatest policy, so that the transfer picks up that version when the job is resumed
+func (jptm *jobPartTransferMgr) RecordLatestSourceVersion(lmt time.Time, size int64) {
+	if jptm.jobPartMgr.(*jobPartMgr).sourceChangePolicy() != common.ESourceChangePolicy.RescheduleLatest() {
+		return
+	}
+	atomic.StoreInt64(&jptm.jobPartPlanTransfer.ModifiedTime, lmt.UnixNano())
+	atomic.StoreInt64(&jptm.jobPartPlanTransfer.SourceSize, size)
+}
+
+// FailIfSourceChangedSinceScan fails the transfer if the job asserts that its sources are unchanged (or was resumed after an
+// account failover), and the ETag of the source is no longer the one recorded when it was scanned.
+// When the assertion is for the whole job, the job is cancelled too
+func (jptm *jobPartTransferMgr) FailIfSourceChangedSinceScan() {
+	jpm := jptm.jobPartMgr.(*jobPartMgr)
+	assertion := jpm.Plan().AssertSourceUnchanged
+	info := jptm.Info()
+	fromTo := jptm.FromTo()
+	revalidating := jpm.revalidateSourceETags && fromTo.From() == common.ELocation.Blob() && info.SrcETag != ""
+	if (assertion == common.EAssertSourceUnchanged.None() && !revalidating) || !jptm.IsLive() {
+		return
+	}
+
+	err := checkSourceETag(jptm.Context(), fromTo, info.Source, info.SrcETag, jpm.sourcePipeline())
+	if err == nil {
+		return
+	}
+
+	const where = "Checking that the source is unchanged since it was scanned"
+	if _, isCopy := jptm.TempJudgeUploadOrCopy(); isCopy {
+		jptm.FailActiveSend(where, err)
+	} else {
+		jptm.FailActiveDownload(where, err)
+	}
+
+	if err == errSourceChangedSinceScan && assertion == common.EAssertSourceUnchanged.Job() && jpm.jobMgr.Context().Err() == nil {
+		common.GetLifecycleMgr().Info(fmt.Sprintf("The job has been cancelled, since a source has changed since it was scanned: %s", strings.Split(info.Source, "?")[0]))
+		CancelPauseJobOrder(jpm.Plan().JobID, common.EJobStatus.Cancelling())
+	}
+}
+
+// PreservePermissions copies the owner, group, permissions and ACL of the source to the destination, and those of the
+// directories that the transfer is part of, if the job preserves permissions. The transfer fails if they can't be copied
+func (jptm *jobPartTransferMgr) PreservePermissions() {
+	jpm := jptm.jobPartMgr.(*jobPartMgr)
+	if jpm.permissions == nil || !jptm.IsLive() {
+		return
+	}
+
+	info := jptm.Info()
+	if err := jpm.permissions.copy(jptm.Context(), info.Source, info.Destination); err != nil {
+		jptm.FailActiveSend("Preserving permissions", err)
+		return
+	}
+	jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Preserved permissions")
+}
+
 func (jptm *jobPartTransferMgr) BlobTypeOverride() common.BlobType {
 	return jptm.jobPartMgr.BlobTypeOverride()
 }
 
+func (jptm *jobPartTransferMgr) PropertyMapping() common.PropertyMapping {
+	return jptm.jobPartMgr.PropertyMapping()
+}
+
 func (jptm *jobPartTransferMgr) BlobTiers() (blockBlobTier common.BlockBlobTier, pageBlobTier common.PageBlobTier) {
 	return jptm.jobPartMgr.BlobTiers()
 }
@@ -463,7 +731,97 @@ func (jptm *jobPartTransferMgr) TransferStatusIgnoringCancellation() common.Tran
 
 // TransferStatus updates the status of given transfer for given jobId and partNumber
 func (jptm *jobPartTransferMgr) SetStatus(status common.TransferStatus) {
+	old := jptm.jobPartPlanTransfer.TransferStatus()
 	jptm.jobPartPlanTransfer.SetTransferStatus(status, false)
+	if jptm.jobPartPlanTransfer.TransferStatus() != old {
+		jptm.journal(common.TransferJournalStatusChanged, "")
+	}
+}
+
+// ReportVerified records in the journal of the job, if it has one, that the destination passed the given check
+func (jptm *jobPartTransferMgr) ReportVerified(check string) {
+	if check != "Length" {
+		atomic.StoreInt32(&jptm.atomicContentHashVerified, 1)
+	}
+	jptm.journal(common.TransferJournalVerified, check)
+}
+
+// contentHashVerified says whether ReportVerified has been told of a check of the hash of the content, rather than just of its length
+func (jptm *jobPartTransferMgr) contentHashVerified() bool {
+	return atomic.LoadInt32(&jptm.atomicContentHashVerified) == 1
+}
+
+// SetContentMD5 keeps the MD5 hash of the content, as computed while it was transferred
+func (jptm *jobPartTransferMgr) SetContentMD5(hash []byte) {
+	if len(hash) > 0 {
+		jptm.atomicContentMD5.Store(hash)
+	}
+}
+
+// recordInManifest adds the transfer to the list of files for the manifest of the job, if it has one, with the MD5 hash
+// of the content as computed while it was transferred, or else as it was known for the source.
+// The hash is marked as verified only if it was checked against the data that landed
+func (jptm *jobPartTransferMgr) recordInManifest(info TransferInfo) {
+	manifest := jptm.jobPartMgr.getDatasetManifest()
+	if !manifest.files.isEnabled() {
+		return
+	}
+
+	plan := jptm.jobPartMgr.Plan()
+	_, dst := plan.TransferSrcDstStrings(jptm.transferIndex)
+
+	contentMD5, _ := jptm.atomicContentMD5.Load().([]byte)
+	verified := len(contentMD5) > 0 && jptm.contentHashVerified()
+	if len(contentMD5) == 0 {
+		contentMD5 = info.SrcHTTPHeaders.ContentMD5
+	}
+	manifest.recordFile(manifestRelativePath(plan, dst), info.SourceSize, contentMD5, verified)
+}
+
+// manifestRelativePath returns the path of a destination, as it's given in the manifest: relative to the destination of the job
+func manifestRelativePath(plan *JobPartPlanHeader, dst string) string {
+	dstRoot := string(plan.DestinationRoot[:plan.DestinationRootLength])
+	relativePath := strings.TrimLeft(strings.TrimPrefix(dst, dstRoot), `/\`)
+	if relativePath == "" {
+		// the destination is a single file
+		relativePath = dst[strings.LastIndexAny(dst, `/\`)+1:]
+	}
+	if plan.FromTo.To().IsRemote() {
+		if unescaped, err := url.PathUnescape(relativePath); err == nil {
+			relativePath = unescaped
+		}
+	}
+	return relativePath
+}
+
+// enableJournal has the transfer keep the IDs of its requests, for its journal entries, if the job is journaled.
+// It must be called before the transfer starts
+func (jptm *jobPartTransferMgr) enableJournal() {
+	if jptm.jobPartMgr.getTransferJournal().isEnabled() {
+		jptm.requestIDs = &requestIDRecorder{}
+		jptm.ctx = withRequestIDRecorder(jptm.ctx, jptm.requestIDs)
+	}
+}
+
+func (jptm *jobPartTransferMgr) journal(event common.TransferJournalEvent, detail string) {
+	journal := jptm.jobPartMgr.getTransferJournal()
+	if !journal.isEnabled() {
+		return
+	}
+	plan := jptm.jobPartMgr.Plan()
+	src, dst := plan.TransferSrcDstStrings(jptm.transferIndex)
+	journal.record(common.TransferJournalEntry{
+		JobID:         plan.JobID,
+		PartNumber:    plan.PartNum,
+		TransferIndex: jptm.transferIndex,
+		Source:        src,
+		Destination:   dst,
+		Event:         event,
+		Status:        jptm.jobPartPlanTransfer.TransferStatus().String(),
+		Detail:        detail,
+		RequestID:     jptm.requestIDs.lastRequestID(),
+		ErrorCode:     jptm.jobPartPlanTransfer.ErrorCode(),
+	})
 }
 
 // SetErrorCode updates the errorcode of transfer for given jobId and partNumber.
@@ -621,6 +979,11 @@ func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descri
 	//  in that case, the logs would be repeated
 	//  as of april 9th, 2019, there's no obvious solution without adding more complexity into this part of the code, which is already not pretty and kind of everywhere
 	//  consider redesign the lifecycle management in ste
+	if !jptm.WasCanceled() && jptm.WriteOnce() && isDestinationExistsError(err) {
+		// the job asked for existing destinations to be left alone, and this one was. But the source wasn't copied, so it's still a failure
+		atomic.StoreInt32(&jptm.atomicDestinationExistedBefore, 1)
+		descriptionOfWhereErrorOccurred += ". The destination already exists, so it was not overwritten in this write-once job"
+	}
 	if !jptm.WasCanceled() {
 		jptm.Cancel()
 		serviceCode, status, msg := ErrorEx{err}.ErrorCodeAndString()
@@ -642,7 +1005,12 @@ func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descri
 		if status == http.StatusForbidden {
 			// quit right away, since without proper authentication no work can be done
 			// display a clear message
-			common.GetLifecycleMgr().Info(fmt.Sprintf("Authentication failed, it is either not correct, or expired, or does not have the correct permission %s", err.Error()))
+			authFailureMsg := fmt.Sprintf("Authentication failed, it is either not correct, or expired, or does not have the correct permission %s", err.Error())
+			if hint := (ErrorEx{err}).ClockSkewHint(); hint != "" {
+				authFailureMsg += "\n" + hint
+				jptm.Log(pipeline.LogError, hint)
+			}
+			common.GetLifecycleMgr().Info(authFailureMsg)
 			// and use the normal cancelling mechanism so that we can exit in a clean and controlled way
 			jobId := jptm.jobPartMgr.Plan().JobID
 			CancelPauseJobOrder(jobId, common.EJobStatus.Cancelling())
@@ -653,6 +1021,11 @@ func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descri
 			//     Cancelled, so we can't just make a sweeping change to reporting both as Failed.
 			//     For now, let's live with it being reported as cancelled, since that's still better than not reporting any
 			//     status at all, which is what it did previously (when we called glcm.Error here)
+		} else if jptm.jobPartMgr.getAccountFailoverDetector().recordError(err, time.Now()) {
+			// pause rather than fail everything that's left, the job can be resumed once the failover is over
+			common.GetLifecycleMgr().Info("The storage account appears to be failing over to its secondary region, so the job has been paused. " +
+				"Once the failover has completed, resume the job with 'azcopy jobs resume'. The source of each remaining transfer will be checked for changes before it is transferred.")
+			pauseJobForAccountFailover(jptm.jobPartMgr.Plan().JobID)
 		}
 	}
 	// TODO: right now the convention re cancellation seems to be that if you cancel, you MUST both call cancel AND
@@ -668,7 +1041,16 @@ func (jptm *jobPartTransferMgr) PipelineLogInfo() pipeline.LogOptions {
 
 func (jptm *jobPartTransferMgr) Log(level pipeline.LogLevel, msg string) {
 	plan := jptm.jobPartMgr.Plan()
-	jptm.jobPartMgr.Log(level, fmt.Sprintf("%s: [P#%d-T#%d] ", common.LogLevel(level), plan.PartNum, jptm.transferIndex)+msg)
+	jptm.jobPartMgr.LogTransfer(level, plan.PartNum, jptm.transferIndex, msg)
+}
+
+func (jptm *jobPartTransferMgr) ShouldLogCategory(category common.LogCategory, level pipeline.LogLevel) bool {
+	return jptm.jobPartMgr.ShouldLogCategory(category, level)
+}
+
+func (jptm *jobPartTransferMgr) LogWithCategory(category common.LogCategory, level pipeline.LogLevel, msg string) {
+	plan := jptm.jobPartMgr.Plan()
+	jptm.jobPartMgr.LogTransferWithCategory(category, level, plan.PartNum, jptm.transferIndex, msg)
 }
 
 func (jptm *jobPartTransferMgr) ErrorCodeAndString(err error) (int, string) {
@@ -775,6 +1157,44 @@ func (jptm *jobPartTransferMgr) ReportTransferDone() uint32 {
 		panic("cannot report the same transfer done twice")
 	}
 
+	if jptm.timeBudgetTimer != nil {
+		jptm.timeBudgetTimer.Stop()
+	}
+
+	status := jptm.TransferStatusIgnoringCancellation()
+
+	// a transfer that ran over its time budget gets one more go, unless the whole job is being cancelled
+	if atomic.LoadUint32(&jptm.atomicTimeBudgetExceeded) == 1 && !jptm.requeued &&
+		status == common.ETransferStatus.Failed() && jptm.jobPartMgr.(*jobPartMgr).jobMgr.Context().Err() == nil {
+		jptm.endTrace(status)
+		return jptm.jobPartMgr.(*jobPartMgr).requeueTransfer(jptm)
+	}
+
+	if !jptm.startTime.IsZero() {
+		src, dst := jptm.jobPartMgr.Plan().TransferSrcDstStrings(jptm.transferIndex)
+		jptm.jobPartMgr.getSlowestTransferTracker().record(common.SlowTransferDetail{
+			Src:                 src,
+			Dst:                 dst,
+			SourceSize:          jptm.jobPartPlanTransfer.SourceSize,
+			ElapsedMilliseconds: time.Since(jptm.startTime).Nanoseconds() / int64(time.Millisecond),
+			TransferStatus:      status,
+			Requeued:            jptm.requeued,
+		})
+	}
+
+	jptm.journal(common.TransferJournalDone, "")
+	jptm.endTrace(status)
+	jptm.jobPartMgr.getJobStatsCollector().recordTransferDone(status, jptm.jobPartPlanTransfer.SourceSize)
+
+	if status == common.ETransferStatus.Success() {
+		info := jptm.Info()
+		jptm.jobPartMgr.getCompletionNotifier().NotifyTransferCompleted(
+			jptm.jobPartMgr.Plan().JobID, info.Source, info.Destination, info.SourceSize, info.SrcHTTPHeaders.ContentMD5)
+		jptm.recordInManifest(info)
+		jptm.jobPartMgr.(*jobPartMgr).recordJobBytesTransferred(jptm.jobPartPlanTransfer.SourceSize)
+		jptm.jobPartMgr.(*jobPartMgr).deleteSourceOfVerifiedTransfer(jptm)
+	}
+
 	return jptm.jobPartMgr.ReportTransferDone()
 }
 
@@ -0,0 +1,196 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// networkDiagnostics watches for repeated timeouts on the requests to each host. When they happen, it tests, once,
+// whether small and large requests get through to that host, and logs a hint about the possible causes. The hint is only
+// a heuristic: the test requests can't see which packets are dropped, or why. E.g. when only the small ones get through,
+// one possible cause is an MTU blackhole, which otherwise takes a lot of back and forth with support to find, but a proxy
+// or firewall that holds up large requests looks just the same.
+type networkDiagnostics struct {
+	mu        sync.Mutex
+	timeouts  map[string][]time.Time // the recent timeouts of each host
+	diagnosed map[string]bool
+	threshold int           // how many timeouts, within window, trigger the diagnostic
+	window    time.Duration // how recent the timeouts must be to count
+	probe     networkProbe
+	log       func(string)
+}
+
+// networkProbe sends a request with a body of the given size to the host, and returns once it has a response
+type networkProbe func(ctx context.Context, scheme string, host string, size int) error
+
+// the sizes of the test requests: one that fits in a single packet, one that fills a TLS record, and so spans
+// several full-size packets, and one that is big enough to show the throughput
+var networkProbeSizes = []int{0, 16 * 1024, 1024 * 1024}
+
+const networkProbeTimeout = 30 * time.Second
+
+func newNetworkDiagnostics(probe networkProbe, log func(string)) *networkDiagnostics {
+	return &networkDiagnostics{
+		timeouts:  make(map[string][]time.Time),
+		diagnosed: make(map[string]bool),
+		threshold: 3,
+		window:    5 * time.Minute,
+		probe:     probe,
+		log:       log,
+	}
+}
+
+// recordError notes the error of a try, and starts the diagnostic of the host if it has had enough timeouts
+func (d *networkDiagnostics) recordError(scheme string, host string, err error) {
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.diagnosed[host] {
+		return
+	}
+
+	now := time.Now()
+	recent := make([]time.Time, 0, d.threshold)
+	for _, t := range d.timeouts[host] {
+		if now.Sub(t) < d.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	d.timeouts[host] = recent
+
+	if len(recent) >= d.threshold {
+		d.diagnosed[host] = true
+		delete(d.timeouts, host)
+		go d.diagnose(scheme, host)
+	}
+}
+
+// networkProbeResult is the outcome of one test request
+type networkProbeResult struct {
+	size    int
+	elapsed time.Duration
+	err     error
+}
+
+func (r networkProbeResult) String() string {
+	desc := "small request"
+	if r.size > 0 {
+		desc = fmt.Sprintf("%d KiB request", r.size/1024)
+	}
+	if r.err != nil {
+		return fmt.Sprintf("%s failed after %v (%v)", desc, r.elapsed.Round(time.Millisecond), r.err)
+	}
+	return fmt.Sprintf("%s ok in %v", desc, r.elapsed.Round(time.Millisecond))
+}
+
+func (d *networkDiagnostics) diagnose(scheme string, host string) {
+	results := make([]networkProbeResult, 0, len(networkProbeSizes))
+	for _, size := range networkProbeSizes {
+		ctx, cancel := context.WithTimeout(context.Background(), networkProbeTimeout)
+		start := time.Now()
+		err := d.probe(ctx, scheme, host, size)
+		cancel()
+		results = append(results, networkProbeResult{size: size, elapsed: time.Since(start), err: err})
+	}
+
+	descriptions := make([]string, len(results))
+	for i, r := range results {
+		descriptions[i] = r.String()
+	}
+	d.log(fmt.Sprintf("NETWORK DIAGNOSTIC: requests to %s have timed out repeatedly, so they were tested: %s. Heuristic hint, not a diagnosis: %s",
+		host, strings.Join(descriptions, "; "), networkDiagnosticHint(results)))
+}
+
+// networkDiagnosticHint says what the results of the test requests, smallest first, suggest about the timeouts.
+// It can only suggest causes, not confirm them
+func networkDiagnosticHint(results []networkProbeResult) string {
+	small := results[0]
+	largestOK := small
+	failedLarge := false
+	for _, r := range results[1:] {
+		if r.err != nil {
+			failedLarge = true
+		} else {
+			largestOK = r
+		}
+	}
+
+	switch {
+	case small.err != nil:
+		return "no request got through, so the host is likely unreachable from here, or blocked by a firewall or proxy"
+	case failedLarge:
+		return "small requests get through but large ones don't. This test can't tell why: it may be a proxy or firewall that buffers or inspects large requests, " +
+			"or a possible MTU blackhole (full-size packets being dropped, with path MTU discovery not working). " +
+			"Check the path for proxies, and check the MTU with a tool that sends full-size packets that must not be fragmented, before lowering the MTU of the network interface"
+	case largestOK.size > 0 && largestOK.elapsed > small.elapsed &&
+		float64(largestOK.size)/(largestOK.elapsed-small.elapsed).Seconds() < minimumTryThroughput:
+		return "requests of all sizes get through, but large ones are very slow, which suggests proxy buffering or a congested link"
+	default:
+		return "requests of all sizes get through quickly, so the timeouts are likely due to the load on the service, this machine or the network, rather than the connection itself"
+	}
+}
+
+// newHTTPNetworkProbe returns a probe that sends anonymous requests, each on a new connection. Any response, even an error
+// status, shows that the request got through
+func newHTTPNetworkProbe() networkProbe {
+	return func(ctx context.Context, scheme string, host string, size int) error {
+		client := NewAzcopyHTTPClient(0)
+		client.Transport.(*http.Transport).DisableKeepAlives = true
+
+		method := http.MethodHead
+		var body io.Reader
+		if size > 0 {
+			method = http.MethodPut
+			body = bytes.NewReader(make([]byte, size))
+		}
+		req, err := http.NewRequest(method, scheme+"://"+host+"/azcopy-network-diagnostic", body)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return resp.Body.Close()
+	}
+}
+
+// the diagnostics are shared by all pipelines, so that each host is only tested once
+var sharedNetworkDiagnostics = newNetworkDiagnostics(newHTTPNetworkProbe(), func(msg string) {
+	if JobsAdmin != nil {
+		JobsAdmin.LogToJobLog(msg)
+	}
+})
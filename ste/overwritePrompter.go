@@ -21,7 +21,6 @@
 package ste
 
 import (
-	"fmt"
 	"sync"
 
 	"github.com/Azure/azure-storage-azcopy/common"
@@ -54,8 +53,8 @@ func (o *overwritePrompter) shouldOverwrite(objectPath string) (shouldOverwrite
 }
 
 func (o *overwritePrompter) promptForConfirmation(objectPath string) (shouldDelete bool) {
-	answer := common.GetLifecycleMgr().Prompt(fmt.Sprintf("%s already exists at the destination. "+
-		"Do you wish to overwrite?", objectPath),
+	msg := common.UserMessages()
+	answer := common.GetLifecycleMgr().Prompt(msg.Sprintf(common.MsgOverwritePrompt, objectPath),
 		common.PromptDetails{
 			PromptType:   common.EPromptType.Overwrite(),
 			PromptTarget: objectPath,
@@ -68,23 +67,23 @@ func (o *overwritePrompter) promptForConfirmation(objectPath string) (shouldDele
 
 	switch answer {
 	case common.EResponseOption.Yes():
-		common.GetLifecycleMgr().Info(fmt.Sprintf("Confirmed. %s will be overwritten.", objectPath))
+		common.GetLifecycleMgr().Info(msg.Sprintf(common.MsgOverwriteConfirmed, objectPath))
 		return true
 	case common.EResponseOption.YesForAll():
-		common.GetLifecycleMgr().Info("Confirmed. All future conflicts will be overwritten.")
+		common.GetLifecycleMgr().Info(msg.Text(common.MsgOverwriteAllConfirmed))
 		o.shouldPromptUser = false
 		o.savedResponse = true
 		return true
 	case common.EResponseOption.No():
-		common.GetLifecycleMgr().Info(fmt.Sprintf("%s will be skipped", objectPath))
+		common.GetLifecycleMgr().Info(msg.Sprintf(common.MsgOverwriteDeclined, objectPath))
 		return false
 	case common.EResponseOption.NoForAll():
-		common.GetLifecycleMgr().Info("No overwriting will happen from now onwards.")
+		common.GetLifecycleMgr().Info(msg.Text(common.MsgOverwriteAllDeclined))
 		o.shouldPromptUser = false
 		o.savedResponse = false
 		return false
 	default:
-		common.GetLifecycleMgr().Info(fmt.Sprintf("Unrecognizable answer, skipping %s.", objectPath))
+		common.GetLifecycleMgr().Info(msg.Sprintf(common.MsgOverwriteUnrecognized, objectPath))
 		return false
 	}
 }
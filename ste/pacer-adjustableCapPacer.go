@@ -0,0 +1,100 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// adjustableCapPacer applies the app-wide cap-mbps. Since the cap can be set, changed or removed while jobs
+// are running (by 'azcopy jobs set-cap'), it exists even when there is no cap, and then just records the traffic.
+type adjustableCapPacer struct {
+	atomicGrandTotal int64
+	atomicCapped     int32
+	lock             sync.Mutex
+	limiter          *tokenBucketPacer // created the first time there is a cap, and kept (but unused) if the cap is removed
+}
+
+func newAdjustableCapPacer(bytesPerSecond int64) *adjustableCapPacer {
+	p := &adjustableCapPacer{}
+	p.setCap(bytesPerSecond)
+	return p
+}
+
+// setCap changes the cap. Zero means no cap
+func (p *adjustableCapPacer) setCap(bytesPerSecond int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if bytesPerSecond <= 0 {
+		atomic.StoreInt32(&p.atomicCapped, 0)
+		return
+	}
+	if p.limiter == nil {
+		unusedExpectedCoarseRequestByteCount := uint32(0)
+		p.limiter = newTokenBucketPacer(bytesPerSecond, unusedExpectedCoarseRequestByteCount)
+	} else {
+		p.limiter.setTargetBytesPerSecond(bytesPerSecond)
+	}
+	atomic.StoreInt32(&p.atomicCapped, 1)
+}
+
+// capBytesPerSecond returns the current cap, or zero if there is none
+func (p *adjustableCapPacer) capBytesPerSecond() int64 {
+	if atomic.LoadInt32(&p.atomicCapped) == 0 {
+		return 0
+	}
+	return p.limiter.targetBytesPerSecond()
+}
+
+func (p *adjustableCapPacer) RequestTrafficAllocation(ctx context.Context, byteCount int64) error {
+	if atomic.LoadInt32(&p.atomicCapped) == 1 {
+		if err := p.limiter.RequestTrafficAllocation(ctx, byteCount); err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&p.atomicGrandTotal, byteCount)
+	return nil
+}
+
+func (p *adjustableCapPacer) UndoRequest(byteCount int64) {
+	if atomic.LoadInt32(&p.atomicCapped) == 1 {
+		p.limiter.UndoRequest(byteCount)
+	}
+	atomic.AddInt64(&p.atomicGrandTotal, -byteCount)
+}
+
+func (p *adjustableCapPacer) GetTotalTraffic() int64 {
+	return atomic.LoadInt64(&p.atomicGrandTotal)
+}
+
+func (p *adjustableCapPacer) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	atomic.StoreInt32(&p.atomicCapped, 0)
+	if p.limiter != nil {
+		return p.limiter.Close()
+	}
+	return nil
+}
@@ -91,6 +91,11 @@ func (AdviceType) NetworkErrors() AdviceType {
 		"Network errors, such as losses of connections, may have limited throughput"}
 }
 
+func (AdviceType) IdleConnectionsDropped() AdviceType {
+	return AdviceType{"IdleConnectionsDropped",
+		"Idle connections were dropped by something between AzCopy and the service"}
+}
+
 func (AdviceType) VMSize() AdviceType {
 	return AdviceType{"VMSize",
 		"The size of this Azure VM may have limited throughput"}
@@ -103,6 +108,7 @@ func (AdviceType) SmallFilesOrNetwork() AdviceType {
 
 type PerformanceAdvisor struct {
 	networkErrorPercentage         float32
+	droppedIdleConnPercentage      float32
 	serverBusyPercentageIOPS       float32
 	serverBusyPercentageThroughput float32
 	serverBusyPercentageOther      float32
@@ -134,6 +140,7 @@ func NewPerformanceAdvisor(stats *pipelineNetworkStats, commandLineMbpsCap int64
 
 	if stats != nil {
 		p.networkErrorPercentage = stats.NetworkErrorPercentage()
+		p.droppedIdleConnPercentage = stats.DroppedIdleConnectionPercentage()
 		p.serverBusyPercentageIOPS = stats.IOPSServerBusyPercentage()
 		p.serverBusyPercentageThroughput = stats.ThroughputServerBusyPercentage()
 		p.serverBusyPercentageOther = stats.OtherServerBusyPercentage()
@@ -148,8 +155,9 @@ func NewPerformanceAdvisor(stats *pipelineNetworkStats, commandLineMbpsCap int64
 func (p *PerformanceAdvisor) GetAdvice() []common.PerformanceAdvice {
 
 	const (
-		serverBusyThresholdPercent   = 1.0
-		networkErrorThresholdPercent = 2.0
+		serverBusyThresholdPercent      = 1.0
+		networkErrorThresholdPercent    = 2.0
+		droppedIdleConnThresholdPercent = 1.0
 
 		// we don't have any API to get exact throughput given a VM size. But a quick look at the documentation
 		// suggests that all current gen VMs get around 500 to 1000 Mbps per core.
@@ -310,6 +318,18 @@ func (p *PerformanceAdvisor) GetAdvice() []common.PerformanceAdvice {
 		}
 	}
 
+	// Dropped idle connections
+	// (These don't say anything about what limited throughput, so they come after the analysis of that. But they do have
+	// a cost, of a failed request, or at least of a new connection, each time, and users can avoid them)
+	if p.droppedIdleConnPercentage > droppedIdleConnThresholdPercent {
+		addAdvice(EAdviceType.IdleConnectionsDropped(),
+			"%.0f%% of the idle connections that AzCopy reused turned out to have been dropped while they were idle, "+
+				"which is typically done by firewalls, proxies and NAT gateways that drop idle connections without telling either end. "+
+				"Set %s to less than the time after which they're dropped, so that AzCopy closes them first. "+
+				"(This message is shown by AzCopy if %.0f%% or more of reused connections were found to be dropped.)",
+			p.droppedIdleConnPercentage, common.EEnvironmentVariable.IdleConnectionTimeout().Name, droppedIdleConnThresholdPercent)
+	}
+
 	// TODO: consider how to factor in CPU load - will it be reflected in concurrency tuner results, or separate?
 
 	// TODO: should we also output aka.ms links to the relevant doc pages?  Hard to maintain?
@@ -0,0 +1,169 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+)
+
+// permissionsCopier copies the owner, group, permission bits and ACL of files and directories from one account with a
+// hierarchical namespace to another. The transfers themselves go through the blob endpoints, but access control
+// can only be read and written through the dfs endpoints, so the copier has pipelines of its own for those
+type permissionsCopier struct {
+	srcPipeline pipeline.Pipeline
+	dstPipeline pipeline.Pipeline
+	folders     *folderPermissionsTracker
+}
+
+// folderPermissionsTracker remembers the directories whose permissions have been copied (or are being copied)
+// in this run of the job, so that each one is copied once, however many files it holds
+type folderPermissionsTracker struct {
+	mu   sync.Mutex
+	done map[string]struct{}
+}
+
+func newFolderPermissionsTracker() *folderPermissionsTracker {
+	return &folderPermissionsTracker{done: make(map[string]struct{})}
+}
+
+// claim returns true if the caller is the first to claim the directory, and so must copy its permissions
+func (t *folderPermissionsTracker) claim(dir string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.done[dir]; ok {
+		return false
+	}
+	t.done[dir] = struct{}{}
+	return true
+}
+
+// release lets a later transfer try again, when the permissions of the directory could not be copied
+func (t *folderPermissionsTracker) release(dir string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.done, dir)
+}
+
+// accessController is implemented by both azbfs.FileURL and azbfs.DirectoryURL
+type accessController interface {
+	GetAccessControl(ctx context.Context) (azbfs.AccessControl, error)
+	SetAccessControl(ctx context.Context, ac azbfs.AccessControl) (*azbfs.PathUpdateResponse, error)
+}
+
+// copy copies the permissions of the source file to the destination file, and then those of the directories
+// that the transfer is part of (see commonFolders) if no other transfer has already done so
+func (c *permissionsCopier) copy(ctx context.Context, source string, destination string) error {
+	srcURL, err := dfsURL(source)
+	if err != nil {
+		return err
+	}
+	dstURL, err := dfsURL(destination)
+	if err != nil {
+		return err
+	}
+
+	if err = copyAccessControl(ctx, azbfs.NewFileURL(srcURL, c.srcPipeline), azbfs.NewFileURL(dstURL, c.dstPipeline)); err != nil {
+		return err
+	}
+
+	for _, dirs := range commonFolders(srcURL, dstURL) {
+		key := dirs[1].Host + dirs[1].Path
+		if !c.folders.claim(key) {
+			continue
+		}
+		err = copyAccessControl(ctx, azbfs.NewDirectoryURL(dirs[0], c.srcPipeline), azbfs.NewDirectoryURL(dirs[1], c.dstPipeline))
+		if err != nil {
+			c.folders.release(key)
+			return fmt.Errorf("directory %s: %v", dirs[1].Path, err)
+		}
+	}
+	return nil
+}
+
+func copyAccessControl(ctx context.Context, src accessController, dst accessController) error {
+	ac, err := src.GetAccessControl(ctx)
+	if err != nil {
+		return fmt.Errorf("reading the permissions of the source: %v", err)
+	}
+
+	// the + only says that there's an extended ACL, which is sent as it is
+	permissions := strings.TrimSuffix(ac.Permissions, "+")
+	if _, err = dst.SetAccessControl(ctx, azbfs.AccessControl{Owner: ac.Owner, Group: ac.Group, Permissions: permissions, ACL: ac.ACL}); err != nil {
+		return fmt.Errorf("setting the permissions of the destination: %v", err)
+	}
+
+	// the ACL holds all the permission bits except for the sticky bit, which can only be set with the permissions
+	if ac.ACL != "" && hasStickyBit(permissions) {
+		if _, err = dst.SetAccessControl(ctx, azbfs.AccessControl{Permissions: permissions}); err != nil {
+			return fmt.Errorf("setting the sticky bit of the destination: %v", err)
+		}
+	}
+	return nil
+}
+
+func hasStickyBit(permissions string) bool {
+	return len(permissions) >= 9 && (permissions[8] == 't' || permissions[8] == 'T')
+}
+
+// dfsURL turns the URL of a blob in an account with a hierarchical namespace into the URL of the same path on the dfs endpoint
+func dfsURL(blobURL string) (url.URL, error) {
+	u, err := url.Parse(blobURL)
+	if err != nil {
+		return url.URL{}, err
+	}
+	if !strings.Contains(u.Host, ".blob.") {
+		return url.URL{}, fmt.Errorf("permissions can only be preserved for blob endpoints (*.blob.*), not %s", u.Host)
+	}
+	u.Host = strings.Replace(u.Host, ".blob.", ".dfs.", 1)
+	return *u, nil
+}
+
+// commonFolders lists the directories that the transfer is part of, as pairs of source and destination URLs, from the deepest up.
+// These are the directories that the paths of the source and destination have in common, e.g. for /c1/a/b/c/file.txt
+// copied to /c2/x/b/c/file.txt, they are b/c and b. Nothing is listed if the file was renamed, since then the paths don't line up
+func commonFolders(src url.URL, dst url.URL) [][2]url.URL {
+	srcSegments := strings.Split(strings.Trim(src.Path, "/"), "/")
+	dstSegments := strings.Split(strings.Trim(dst.Path, "/"), "/")
+	i, j := len(srcSegments)-1, len(dstSegments)-1
+	if srcSegments[i] != dstSegments[j] {
+		return nil
+	}
+
+	withPath := func(u url.URL, segments []string) url.URL {
+		u.Path = "/" + strings.Join(segments, "/")
+		u.RawPath = ""
+		return u
+	}
+	folders := make([][2]url.URL, 0)
+	// the first segment is the container, which is not a directory
+	for i, j = i-1, j-1; i >= 1 && j >= 1 && srcSegments[i] == dstSegments[j]; i, j = i-1, j-1 {
+		folders = append(folders, [2]url.URL{withPath(src, srcSegments[:i+1]), withPath(dst, dstSegments[:j+1])})
+	}
+	return folders
+}
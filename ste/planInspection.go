@@ -0,0 +1,178 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// PlanFileInspection is what could be read from a plan file, which may have been copied from another machine
+// and may have been written by another version of AzCopy
+type PlanFileInspection struct {
+	Path            string
+	Version         common.Version
+	MigratedFrom    common.Version // non-zero if the plan was of an older version, and was migrated (in memory only) to be read
+	Notes           []string       // what couldn't be read, and why
+	JobID           common.JobID
+	PartNum         common.PartNumber
+	IsFinalPart     bool
+	StartTime       time.Time
+	FromTo          common.FromTo
+	SourceRoot      string
+	DestinationRoot string
+	LogLevel        common.LogLevel
+	Labels          map[string]string
+	Description     string
+	NumTransfers    uint32
+
+	// the following are only known when the version of the plan could be read in full
+	CommandString        string
+	JobStatus            *common.JobStatus
+	TransferStatusCounts map[string]uint32
+	Transfers            []PlanFileTransfer
+}
+
+// PlanFileTransfer is a transfer read from a plan file
+type PlanFileTransfer struct {
+	Source      string
+	Destination string
+	SourceSize  int64
+	Status      common.TransferStatus
+	ErrorCode   int32
+}
+
+// InspectPlanFile reads a plan file, without mapping it or involving the JobsAdmin, and reports what it can.
+// Compressed plans are decompressed, and plans of older versions are migrated, in memory. Of plans of newer versions, only the constant fields of the header
+// that this version knows about can be read, since those are the fields that newer versions keep where they are
+func InspectPlanFile(path string) (PlanFileInspection, error) {
+	result := PlanFileInspection{Path: path}
+	plan, err := readPlanFile(path)
+	if err != nil {
+		return result, err
+	}
+	if uintptr(len(plan)) < unsafe.Offsetof(JobPartPlanHeader{}.SourceRootLength) {
+		return result, errors.New("the file is too short to be a plan file")
+	}
+	result.Version = common.Version(binary.LittleEndian.Uint32(plan))
+	if _, file, _ := parseOldPlanFileName(filepath.Base(path)); file.version != 0 && file.version != result.Version {
+		result.Notes = append(result.Notes, fmt.Sprintf("the name of the file says it is of version %d, but its content says %d", file.version, result.Version))
+	}
+
+	readAll := true
+	if result.Version < DataSchemaVersion {
+		migrated, err := migratePlan(plan, result.Version)
+		if err != nil {
+			result.Notes = append(result.Notes, fmt.Sprintf("the plan can't be migrated from version %d (%v), so only its job and part number are shown", result.Version, err))
+			result.readIdentity(plan)
+			return result, nil
+		}
+		plan = migrated
+		result.MigratedFrom = result.Version
+	} else if result.Version > DataSchemaVersion {
+		result.Notes = append(result.Notes, fmt.Sprintf("the plan was written by a newer version of AzCopy (plan version %d, this version reads %d), "+
+			"so its command, its status and its transfers can't be read", result.Version, DataSchemaVersion))
+		readAll = false
+	}
+
+	// read the constant fields from a copy of the header, since the file may be too short to hold all of it
+	var h JobPartPlanHeader
+	copy((*[unsafe.Sizeof(JobPartPlanHeader{})]byte)(unsafe.Pointer(&h))[:], plan)
+	if uintptr(len(plan)) < unsafe.Offsetof(h.atomicJobStatus) {
+		result.Notes = append(result.Notes, "the file is truncated, so only its job and part number are shown")
+		result.readIdentity(plan)
+		return result, nil
+	}
+	result.JobID = h.JobID
+	result.PartNum = h.PartNum
+	result.IsFinalPart = h.IsFinalPart
+	result.StartTime = time.Unix(0, h.StartTime)
+	result.FromTo = h.FromTo
+	result.SourceRoot = stripResourceQuery(boundedString(h.SourceRoot[:], int(h.SourceRootLength)))
+	result.DestinationRoot = stripResourceQuery(boundedString(h.DestinationRoot[:], int(h.DestinationRootLength)))
+	result.LogLevel = h.LogLevel
+	result.NumTransfers = h.NumTransfers
+	if h.JobLabelsLength <= JobLabelsMaxBytes {
+		result.Labels = h.Labels()
+	}
+	if h.JobDescriptionLength <= JobDescriptionMaxBytes {
+		result.Description = h.Description()
+	}
+	if !readAll {
+		return result, nil
+	}
+
+	// everything else is located relative to the end of the header, so check that the file really is as big as the header says it is,
+	// before reading it in place. (If it's not, the plan may come from a machine with a different architecture, and so a different layout)
+	transfersOffset := uint64(unsafe.Sizeof(h)) + uint64(h.CommandStringLength)
+	if transfersOffset+uint64(h.NumTransfers)*uint64(unsafe.Sizeof(JobPartPlanTransfer{})) > uint64(len(plan)) {
+		result.Notes = append(result.Notes, "the file is shorter than its header says it should be, so its command, its status and its transfers can't be read. "+
+			"It may be truncated, or come from a machine with a different architecture")
+		return result, nil
+	}
+	header := (*JobPartPlanHeader)(unsafe.Pointer(&plan[0]))
+	result.CommandString = header.CommandString()
+	status := header.JobStatus()
+	result.JobStatus = &status
+
+	result.TransferStatusCounts = make(map[string]uint32)
+	result.Transfers = make([]PlanFileTransfer, 0, h.NumTransfers)
+	for i := uint32(0); i < h.NumTransfers; i++ {
+		t := header.Transfer(i)
+		if t.SrcOffset < 0 || t.SrcLength < 0 || uint64(t.SrcOffset)+uint64(t.SrcLength)+uint64(t.dstStringLength()) > uint64(len(plan)) {
+			result.Notes = append(result.Notes, fmt.Sprintf("transfer %d points outside the file, so it and any later transfers can't be read", i))
+			break
+		}
+		src, dst := header.TransferSrcDstStrings(i)
+		result.Transfers = append(result.Transfers, PlanFileTransfer{
+			Source:      src,
+			Destination: dst,
+			SourceSize:  t.SourceSize,
+			Status:      t.TransferStatus(),
+			ErrorCode:   t.ErrorCode(),
+		})
+		result.TransferStatusCounts[t.TransferStatus().String()]++
+	}
+	return result, nil
+}
+
+// readIdentity reads the fields at the very start of the header, which have been there in every version
+func (r *PlanFileInspection) readIdentity(plan []byte) {
+	var h JobPartPlanHeader
+	copy((*[unsafe.Sizeof(JobPartPlanHeader{})]byte)(unsafe.Pointer(&h))[:], plan[:unsafe.Offsetof(h.SourceRootLength)])
+	r.JobID = h.JobID
+	r.PartNum = h.PartNum
+	r.StartTime = time.Unix(0, h.StartTime)
+}
+
+// boundedString reads a string field of the header, whose length may be nonsense if the plan is not what we think it is
+func boundedString(field []byte, length int) string {
+	if length > len(field) {
+		length = len(field)
+	}
+	return string(field[:length])
+}
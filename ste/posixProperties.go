@@ -0,0 +1,191 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// nfsServiceVersion is the first version of the File service that gets and sets the owner, group and mode of files in NFS shares
+const nfsServiceVersion = "2025-05-05"
+
+// fileServiceVersion returns the version of the File service to use for a transfer.
+// The SDK's version is the latest that it knows, but NFS shares need a newer one.
+func fileServiceVersion(jptm IJobPartTransferMgr) string {
+	if jptm.PreservePosixProperties() {
+		return nfsServiceVersion
+	}
+	return azfile.ServiceVersion
+}
+
+// IPosixPropertiesSourceInfoProvider is implemented by the sources that can give the owner, group and mode of their files
+type IPosixPropertiesSourceInfoProvider interface {
+	ISourceInfoProvider
+	PosixProperties() (common.PosixProperties, error)
+}
+
+func (f localFileSourceInfoProvider) PosixProperties() (common.PosixProperties, error) {
+	return common.GetPosixProperties(f.jptm.Info().Source)
+}
+
+func (p *fileSourceInfoProvider) PosixProperties() (common.PosixProperties, error) {
+	presignedURL, err := p.PreSignedSourceURL()
+	if err != nil {
+		return common.PosixProperties{}, err
+	}
+	return getAzureFilePosixProperties(p.ctx, azfile.NewFileURL(*presignedURL, p.jptm.SourceProviderPipeline()))
+}
+
+func getAzureFilePosixProperties(ctx context.Context, fileURL azfile.FileURL) (common.PosixProperties, error) {
+	props, err := fileURL.GetProperties(context.WithValue(ctx, ServiceAPIVersionOverride, nfsServiceVersion))
+	if err != nil {
+		return common.PosixProperties{}, err
+	}
+	return posixPropertiesFromHeader(props.Response().Header)
+}
+
+func getAzureDirectoryPosixProperties(ctx context.Context, dirURL azfile.DirectoryURL) (common.PosixProperties, error) {
+	props, err := dirURL.GetProperties(context.WithValue(ctx, ServiceAPIVersionOverride, nfsServiceVersion))
+	if err != nil {
+		return common.PosixProperties{}, err
+	}
+	return posixPropertiesFromHeader(props.Response().Header)
+}
+
+// posixPropertiesFromHeader reads the owner, group and mode from the response headers, since the SDK doesn't know them, being older than they are
+func posixPropertiesFromHeader(header http.Header) (common.PosixProperties, error) {
+	p := common.PosixProperties{Owner: header.Get("x-ms-owner"), Group: header.Get("x-ms-group"), Mode: header.Get("x-ms-mode")}
+	if p.Owner == "" || p.Group == "" || p.Mode == "" {
+		return p, errors.New("it has no owner, group and mode, so it is probably not in an NFS share")
+	}
+	return p, nil
+}
+
+// PreservePosixPropertiesOfDownload gives the downloaded file the owner, group and mode of the Azure file, if the job preserves them,
+// and then does the same for the directories it is in (see posixFoldersOfDownload), if no other transfer has already done so.
+// The transfer fails if they can't be set, e.g. because AzCopy isn't running as root, which is needed to change the owner
+func (jptm *jobPartTransferMgr) PreservePosixPropertiesOfDownload() {
+	if !jptm.PreservePosixProperties() || !jptm.IsLive() {
+		return
+	}
+
+	info := jptm.Info()
+	if strings.EqualFold(info.Destination, common.Dev_Null) {
+		return // nothing was written
+	}
+	if jptm.ShouldDecompress() {
+		// what was written is the decompressed content, which is not the file in the share, so it keeps the defaults
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "Not preserving owner, group and mode, since the file was decompressed")
+		return
+	}
+
+	sourceURL, err := url.Parse(info.Source)
+	if err != nil {
+		jptm.FailActiveDownload("Preserving owner, group and mode", err)
+		return
+	}
+	jpm := jptm.jobPartMgr.(*jobPartMgr)
+	p, err := getAzureFilePosixProperties(jptm.Context(), azfile.NewFileURL(*sourceURL, jpm.sourcePipeline()))
+	if err == nil {
+		err = common.SetPosixProperties(info.Destination, p)
+	}
+	if err != nil {
+		jptm.FailActiveDownload("Preserving owner, group and mode", err)
+		return
+	}
+
+	plan := jpm.Plan()
+	folders := jpm.jobMgr.getFolderPermissionsTracker()
+	for _, dirs := range posixFoldersOfDownload(*sourceURL, info.Destination, string(plan.DestinationRoot[:plan.DestinationRootLength])) {
+		localDir := dirs[1].Path
+		if !folders.claim(localDir) {
+			continue
+		}
+		p, err := getAzureDirectoryPosixProperties(jptm.Context(), azfile.NewDirectoryURL(dirs[0], jpm.sourcePipeline()))
+		if err == nil {
+			err = common.SetPosixProperties(localDir, p)
+		}
+		if err != nil {
+			folders.release(localDir)
+			jptm.FailActiveDownload("Preserving owner, group and mode", fmt.Errorf("directory %s: %v", localDir, err))
+			return
+		}
+	}
+	jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Preserved owner, group and mode")
+}
+
+// posixFoldersOfDownload lists the directories that a downloaded file is in, as pairs of the directory in the share and the local one
+// (whose Path is the local path), from the deepest up. These are the directories that the paths have in common (see commonFolders),
+// and that are in the destination root, so that the directory the job downloads into keeps its own owner and mode
+func posixFoldersOfDownload(source url.URL, destination string, destinationRoot string) [][2]url.URL {
+	root := filepath.Clean(destinationRoot)
+	folders := make([][2]url.URL, 0)
+	for _, dirs := range commonFolders(source, url.URL{Path: filepath.ToSlash(destination)}) {
+		localDir := filepath.FromSlash(dirs[1].Path)
+		if localDir == root || !strings.HasPrefix(localDir, root+string(filepath.Separator)) {
+			break
+		}
+		folders = append(folders, [2]url.URL{dirs[0], {Path: localDir}})
+	}
+	return folders
+}
+
+type posixPropertiesToSet struct{}
+
+// withPosixProperties returns a context in which the requests to create files in NFS shares give them these properties
+func withPosixProperties(ctx context.Context, p common.PosixProperties) context.Context {
+	return context.WithValue(ctx, posixPropertiesToSet{}, p)
+}
+
+// smbOnlyHeaders are sent by the SDK whenever it creates a file or directory, but they mean nothing to NFS shares
+var smbOnlyHeaders = []string{"x-ms-file-permission", "x-ms-file-permission-key", "x-ms-file-attributes", "x-ms-file-creation-time", "x-ms-file-last-write-time"}
+
+// newPosixPropertiesPolicyFactory leaves out the SMB properties from the requests to NFS shares,
+// and sets the owner, group and mode of a file, if the context of the request has them.
+// It must come after the version policy, which decides whether the request is to an NFS share.
+func newPosixPropertiesPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			if request.Header.Get("x-ms-version") == nfsServiceVersion {
+				for _, h := range smbOnlyHeaders {
+					request.Header.Del(h)
+				}
+			}
+			if p, ok := ctx.Value(posixPropertiesToSet{}).(common.PosixProperties); ok {
+				request.Header.Set("x-ms-owner", p.Owner)
+				request.Header.Set("x-ms-group", p.Group)
+				request.Header.Set("x-ms-mode", p.Mode)
+			}
+			return next.Do(ctx, request)
+		}
+	})
+}
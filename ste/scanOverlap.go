@@ -0,0 +1,102 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// scanOverlapTracker records how much of a new job was transferred while its source was still being scanned.
+// The front end orders the parts of the job as the scan finds enough transfers to fill each one, and each part starts
+// transferring as soon as it's ordered, so everything between the first part being ordered and the end of the scan overlaps it
+type scanOverlapTracker struct {
+	mu               sync.Mutex
+	firstPartOrdered time.Time
+	partsOrdered     uint32
+	overlap          *common.ScanOverlap // nil until the scan is complete
+}
+
+func newScanOverlapTracker() *scanOverlapTracker {
+	return &scanOverlapTracker{}
+}
+
+// recordPartOrdered is called as each part of a new job is ordered, before the part is added to the job.
+// The first part that's ordered once the scan is complete (which is the final part, unless parts were held back
+// until then) marks the end of the overlap, so what the earlier parts have done by then is what overlapped the scan
+func (t *scanOverlapTracker) recordPartOrdered(jm IJobMgr, scanComplete bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.overlap != nil {
+		return
+	}
+	now := time.Now()
+	if !scanComplete {
+		if t.partsOrdered == 0 {
+			t.firstPartOrdered = now
+		}
+		t.partsOrdered++
+		return
+	}
+
+	overlap := &common.ScanOverlap{PartsOrderedWhileScanning: t.partsOrdered}
+	if t.partsOrdered > 0 {
+		overlap.OverlapSeconds = now.Sub(t.firstPartOrdered).Seconds()
+	}
+	jm.(*jobMgr).jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
+		done, bytes := countDoneTransfers(jpm.Plan())
+		overlap.TransfersDoneWhileScanning += done
+		overlap.BytesTransferredWhileScanning += bytes
+	})
+	t.overlap = overlap
+}
+
+// get returns a copy of what overlapped the scan, or nil if the scan isn't complete (or the job wasn't ordered by this process)
+func (t *scanOverlapTracker) get() *common.ScanOverlap {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.overlap == nil {
+		return nil
+	}
+	overlap := *t.overlap
+	return &overlap
+}
+
+// countDoneTransfers counts the transfers of the plan that have finished, one way or another,
+// and the bytes of those that succeeded
+func countDoneTransfers(plan *JobPartPlanHeader) (done uint32, bytes uint64) {
+	for t := uint32(0); t < plan.NumTransfers; t++ {
+		transfer := plan.Transfer(t)
+		status := transfer.TransferStatus()
+		if status.ShouldTransfer() {
+			continue
+		}
+		done++
+		if status == common.ETransferStatus.Success() {
+			bytes += uint64(transfer.SourceSize)
+		}
+	}
+	return done, bytes
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// how long reads keep going to the secondary endpoint first, after the primary has failed and the secondary has succeeded
+const secondaryReadStickiness = 5 * time.Minute
+
+// GetSecondaryReadHost returns the host name of the read-only secondary endpoint of an RA-GRS account,
+// e.g. account-secondary.blob.core.windows.net for account.blob.core.windows.net
+func GetSecondaryReadHost(primaryHost string) (string, error) {
+	labels := strings.SplitN(primaryHost, ".", 2)
+	if len(labels) != 2 || labels[0] == "" || strings.Contains(primaryHost, ":") {
+		return "", fmt.Errorf("the secondary endpoint of %s cannot be determined, as it is not an account endpoint of the form <account>.blob.<suffix>", primaryHost)
+	}
+	if strings.HasSuffix(labels[0], "-secondary") {
+		return "", fmt.Errorf("%s is already a secondary endpoint", primaryHost)
+	}
+	return labels[0] + "-secondary." + labels[1], nil
+}
+
+// secondaryReadTracker makes failover to the secondary endpoint sticky for a whole job: once the primary has failed
+// and the secondary has served a read, later reads go to the secondary first for a while, instead of each of them paying
+// for the failing primary again. Each switch is logged, since the secondary may serve slightly stale data.
+type secondaryReadTracker struct {
+	atomicStickyUntil int64 // UnixNano, zero when reads go to the primary first
+	logger            common.ILogger
+}
+
+func newSecondaryReadTracker(logger common.ILogger) *secondaryReadTracker {
+	return &secondaryReadTracker{logger: logger}
+}
+
+// preferSecondary returns true if reads should go to the secondary endpoint first
+func (t *secondaryReadTracker) preferSecondary() bool {
+	if t == nil {
+		return false
+	}
+
+	until := atomic.LoadInt64(&t.atomicStickyUntil)
+	if until == 0 {
+		return false
+	}
+	if time.Now().UnixNano() < until {
+		return true
+	}
+
+	// time to give the primary another chance, only log it once
+	if atomic.CompareAndSwapInt64(&t.atomicStickyUntil, until, 0) {
+		t.log("Reads are going to the primary endpoint again")
+	}
+	return false
+}
+
+// recordSecondarySuccess is called when a read succeeded against the secondary endpoint, after failing against the primary
+func (t *secondaryReadTracker) recordSecondarySuccess(secondaryHost string) {
+	if t == nil {
+		return
+	}
+
+	previous := atomic.SwapInt64(&t.atomicStickyUntil, time.Now().Add(secondaryReadStickiness).UnixNano())
+	if previous == 0 {
+		t.log(fmt.Sprintf("The primary endpoint is failing, so reads are going to the secondary endpoint %s for the next %v. "+
+			"Data read from the secondary may be slightly behind the primary", secondaryHost, secondaryReadStickiness))
+	}
+}
+
+func (t *secondaryReadTracker) log(msg string) {
+	if t.logger != nil && t.logger.ShouldLog(pipeline.LogWarning) {
+		t.logger.Log(pipeline.LogWarning, msg)
+	}
+}
@@ -129,6 +129,10 @@ func (s *appendBlobSenderBase) generateAppendBlockToRemoteFunc(id common.ChunkID
 	})
 }
 
+func (s *appendBlobSenderBase) destinationProperties(ctx context.Context) (*azblob.BlobGetPropertiesResponse, error) {
+	return s.destAppendBlobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+}
+
 func (s *appendBlobSenderBase) Prologue(ps common.PrologueState) (destinationModified bool) {
 	if ps.CanInferContentType() {
 		// sometimes, specifically when reading local files, we have more info
@@ -137,7 +141,7 @@ func (s *appendBlobSenderBase) Prologue(ps common.PrologueState) (destinationMod
 	}
 
 	destinationModified = true
-	_, err := s.destAppendBlobURL.Create(s.jptm.Context(), s.headersToApply, s.metadataToApply, azblob.BlobAccessConditions{})
+	_, err := s.destAppendBlobURL.Create(s.jptm.Context(), s.headersToApply, s.metadataToApply, destinationAccessConditions(s.jptm))
 	if err != nil {
 		s.jptm.FailActiveSend("Creating blob", err)
 		return
@@ -152,7 +156,8 @@ func (s *appendBlobSenderBase) Epilogue() {
 func (s *appendBlobSenderBase) Cleanup() {
 	jptm := s.jptm
 	// Cleanup
-	if jptm.IsDeadInflight() {
+	// If the blob already existed (in a write-once job), then it's not ours to delete
+	if jptm.IsDeadInflight() && !jptm.DestinationExistedBefore() {
 		// There is a possibility that some uncommitted blocks will be there
 		// Delete the uncommitted blobs
 		// TODO: particularly, given that this is an APPEND blob, do we really need to delete it?  But if we don't delete it,
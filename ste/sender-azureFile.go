@@ -48,6 +48,8 @@ type azureFileSenderBase struct {
 	// the properties of the local file
 	headersToApply  azfile.FileHTTPHeaders
 	metadataToApply azfile.Metadata
+	// the owner, group and mode of the file in an NFS share, or nil for SMB shares
+	posixPropertiesToApply *common.PosixProperties
 }
 
 func newAzureFileSenderBase(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, sip ISourceInfoProvider) (*azureFileSenderBase, error) {
@@ -77,12 +79,26 @@ func newAzureFileSenderBase(jptm IJobPartTransferMgr, destination string, p pipe
 
 	// due to the REST parity feature added in 2019-02-02, the File APIs are no longer backward compatible
 	// so we must use the latest SDK version to stay safe
-	ctx := context.WithValue(jptm.Context(), ServiceAPIVersionOverride, azfile.ServiceVersion)
+	ctx := context.WithValue(jptm.Context(), ServiceAPIVersionOverride, fileServiceVersion(jptm))
 	props, err := sip.Properties()
 	if err != nil {
 		return nil, err
 	}
 
+	var posixProperties *common.PosixProperties
+	if jptm.PreservePosixProperties() {
+		psip, ok := sip.(IPosixPropertiesSourceInfoProvider)
+		if !ok {
+			fromTo := jptm.FromTo()
+			return nil, fmt.Errorf("the owner, group and mode of files can't be preserved when copying from %v", fromTo.From())
+		}
+		p, err := psip.PosixProperties()
+		if err != nil {
+			return nil, err
+		}
+		posixProperties = &p
+	}
+
 	return &azureFileSenderBase{
 		jptm:            jptm,
 		fileURL:         azfile.NewFileURL(*destURL, p),
@@ -93,6 +109,8 @@ func newAzureFileSenderBase(jptm IJobPartTransferMgr, destination string, p pipe
 		ctx:             ctx,
 		headersToApply:  props.SrcHTTPHeaders.ToAzFileHTTPHeaders(),
 		metadataToApply: props.SrcMetadata.ToAzFileMetadata(),
+
+		posixPropertiesToApply: posixProperties,
 	}, nil
 }
 
@@ -128,7 +146,11 @@ func (u *azureFileSenderBase) Prologue(state common.PrologueState) (destinationM
 	}
 
 	// Create Azure file with the source size
-	_, err = u.fileURL.Create(u.ctx, info.SourceSize, u.headersToApply, u.metadataToApply)
+	createCtx := u.ctx
+	if u.posixPropertiesToApply != nil {
+		createCtx = withPosixProperties(createCtx, *u.posixPropertiesToApply)
+	}
+	_, err = u.fileURL.Create(createCtx, info.SourceSize, u.headersToApply, u.metadataToApply)
 	if err != nil {
 		jptm.FailActiveUpload("Creating file", err)
 		return
@@ -169,10 +191,15 @@ func (u *azureFileSenderBase) GetDestinationLength() (int64, error) {
 type AzureFileParentDirCreator struct{}
 
 // getParentDirectoryURL gets parent directory URL of an Azure FileURL.
-func (AzureFileParentDirCreator) getParentDirectoryURL(fileURL azfile.FileURL, p pipeline.Pipeline) azfile.DirectoryURL {
-	u := fileURL.URL()
+func (d AzureFileParentDirCreator) getParentDirectoryURL(fileURL azfile.FileURL, p pipeline.Pipeline) azfile.DirectoryURL {
+	return azfile.NewDirectoryURL(d.getParentURL(fileURL.URL()), p)
+}
+
+// getParentURL gets the URL of the directory that contains the given file or directory
+func (AzureFileParentDirCreator) getParentURL(u url.URL) url.URL {
+	u.Path = strings.TrimSuffix(u.Path, "/")
 	u.Path = u.Path[:strings.LastIndex(u.Path, "/")]
-	return azfile.NewDirectoryURL(u, p)
+	return u
 }
 
 // verifyAndHandleCreateErrors handles create errors, StatusConflict is ignored, as specific level directory could be existing.
@@ -191,40 +218,41 @@ func (AzureFileParentDirCreator) verifyAndHandleCreateErrors(err error) error {
 	return nil
 }
 
-// splitWithoutToken splits string with a given token, and returns splitted results without token.
-func (AzureFileParentDirCreator) splitWithoutToken(str string, token rune) []string {
-	return strings.FieldsFunc(str, func(c rune) bool {
-		return c == token
-	})
-}
+// remembers the directories that we've created in Azure Files, across all transfers in this process
+var azureFileDirsCreated = newDirCreationTracker()
 
 // CreateParentDirToRoot creates parent directories of the Azure file if file's parent directory doesn't exist.
+// It starts at the parent directory itself, since that usually has siblings that need the same directories,
+// and only works its way up towards the root when the service says that a directory's parent is missing.
+// Directories that are known to exist are not created again, and concurrent transfers share the requests for any directories they have in common.
 func (d AzureFileParentDirCreator) CreateParentDirToRoot(ctx context.Context, fileURL azfile.FileURL, p pipeline.Pipeline) error {
-	dirURL := d.getParentDirectoryURL(fileURL, p)
+	return d.ensureDirExists(ctx, d.getParentDirectoryURL(fileURL, p), p)
+}
+
+// ensureDirExists creates the given directory, if it doesn't exist, and any missing directories above it
+func (d AzureFileParentDirCreator) ensureDirExists(ctx context.Context, dirURL azfile.DirectoryURL, p pipeline.Pipeline) error {
 	dirURLExtension := common.FileURLPartsExtension{FileURLParts: azfile.NewFileURLParts(dirURL.URL())}
-	// Check whether parent dir of the file exists.
-	if _, err := dirURL.GetProperties(ctx); err != nil {
-		if stgErr, stgErrOk := err.(azfile.StorageError); stgErrOk && stgErr.Response() != nil &&
-			stgErr.Response().StatusCode == http.StatusNotFound { // At least need read and write permisson for destination
-			// File's parent directory doesn't exist, try to create the parent directories.
-			// Split directories as segments.
-			segments := d.splitWithoutToken(dirURLExtension.DirectoryOrFilePath, '/')
-
-			shareURL := azfile.NewShareURL(dirURLExtension.GetShareURL(), p)
-			curDirURL := shareURL.NewRootDirectoryURL() // Share directory should already exist, doesn't support creating share
-			// Try to create the directories
-			for i := 0; i < len(segments); i++ {
-				curDirURL = curDirURL.NewDirectoryURL(segments[i])
-				_, err := curDirURL.Create(ctx, azfile.Metadata{})
-				if verifiedErr := d.verifyAndHandleCreateErrors(err); verifiedErr != nil {
-					return verifiedErr
-				}
+	if dirURLExtension.DirectoryOrFilePath == "" {
+		return nil // share root. Share should already exist, doesn't support creating share
+	}
+
+	return azureFileDirsCreated.ensureCreated(d.dirCreationKey(dirURL), func() error {
+		_, err := dirURL.Create(ctx, azfile.Metadata{})
+		if stgErr, ok := err.(azfile.StorageError); ok && stgErr.ServiceCode() == azfile.ServiceCodeParentNotFound {
+			// create the missing parent(s), then have another go at this one
+			parentURL := azfile.NewDirectoryURL(d.getParentURL(dirURL.URL()), p)
+			if err := d.ensureDirExists(ctx, parentURL, p); err != nil {
+				return err
 			}
-		} else {
-			return err
+			_, err = dirURL.Create(ctx, azfile.Metadata{})
 		}
-	}
+		return d.verifyAndHandleCreateErrors(err) // already existing is fine, and makes retries safe
+	})
+}
 
-	// Directly return if parent directory exists.
-	return nil
+// dirCreationKey identifies a directory, regardless of the SAS used to reach it, and of case, since names in Azure Files are case-insensitive
+func (AzureFileParentDirCreator) dirCreationKey(dirURL azfile.DirectoryURL) string {
+	u := dirURL.URL()
+	u.RawQuery = ""
+	return strings.ToLower(u.String())
 }
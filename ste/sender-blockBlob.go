@@ -138,7 +138,7 @@ func (s *blockBlobSenderBase) Epilogue() {
 		jptm.Log(pipeline.LogDebug, fmt.Sprintf("Conclude Transfer with BlockList %s", blockIDs))
 
 		// commit the blocks.
-		if _, err := s.destBlockBlobURL.CommitBlockList(jptm.Context(), blockIDs, s.headersToApply, s.metadataToApply, azblob.BlobAccessConditions{}); err != nil {
+		if _, err := s.destBlockBlobURL.CommitBlockList(jptm.Context(), blockIDs, s.headersToApply, s.metadataToApply, destinationAccessConditions(jptm)); err != nil {
 			jptm.FailActiveSend("Committing block list", err)
 			return
 		}
@@ -170,7 +170,8 @@ func (s *blockBlobSenderBase) Cleanup() {
 	jptm := s.jptm
 
 	// Cleanup
-	if jptm.IsDeadInflight() {
+	// In write-once jobs, the blob may have been there before the transfer started, so it's never ours to delete
+	if jptm.IsDeadInflight() && !jptm.WriteOnce() {
 		// there is a possibility that some uncommitted blocks will be there
 		// Delete the uncommitted blobs
 		deletionContext, cancelFn := context.WithTimeout(context.Background(), 30*time.Second)
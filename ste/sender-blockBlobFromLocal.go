@@ -74,7 +74,7 @@ func (u *blockBlobUploader) generatePutBlock(id common.ChunkID, blockIndex int32
 		// step 3: put block to remote
 		u.jptm.LogChunkStatus(id, common.EWaitReason.Body())
 		body := newPacedRequestBody(u.jptm.Context(), reader, u.pacer)
-		_, err := u.destBlockBlobURL.StageBlock(u.jptm.Context(), encodedBlockID, body, azblob.LeaseAccessConditions{}, nil)
+		_, err := u.destBlockBlobURL.StageBlock(withRetryBufferRelease(u.jptm.Context(), reader), encodedBlockID, body, azblob.LeaseAccessConditions{}, nil)
 		if err != nil {
 			u.jptm.FailActiveUpload("Staging block", err)
 			return
@@ -92,7 +92,7 @@ func (u *blockBlobUploader) generatePutWholeBlob(id common.ChunkID, blockIndex i
 		jptm.LogChunkStatus(id, common.EWaitReason.Body())
 		var err error
 		if jptm.Info().SourceSize == 0 {
-			_, err = u.destBlockBlobURL.Upload(jptm.Context(), bytes.NewReader(nil), u.headersToApply, u.metadataToApply, azblob.BlobAccessConditions{})
+			_, err = u.destBlockBlobURL.Upload(jptm.Context(), bytes.NewReader(nil), u.headersToApply, u.metadataToApply, destinationAccessConditions(jptm))
 		} else {
 			// File with content
 
@@ -103,10 +103,11 @@ func (u *blockBlobUploader) generatePutWholeBlob(id common.ChunkID, blockIndex i
 				return
 			}
 			u.headersToApply.ContentMD5 = md5Hash
+			jptm.SetContentMD5(md5Hash)
 
 			// Upload the file
 			body := newPacedRequestBody(jptm.Context(), reader, u.pacer)
-			_, err = u.destBlockBlobURL.Upload(jptm.Context(), body, u.headersToApply, u.metadataToApply, azblob.BlobAccessConditions{})
+			_, err = u.destBlockBlobURL.Upload(withRetryBufferRelease(jptm.Context(), reader), body, u.headersToApply, u.metadataToApply, destinationAccessConditions(jptm))
 		}
 
 		// if the put blob is a failure, update the transfer status to failed
@@ -127,6 +128,7 @@ func (u *blockBlobUploader) Epilogue() {
 		md5Hash, ok := <-u.md5Channel
 		if ok {
 			u.headersToApply.ContentMD5 = md5Hash
+			jptm.SetContentMD5(md5Hash)
 		} else {
 			jptm.FailActiveSend("Getting hash", errNoHash)
 			return
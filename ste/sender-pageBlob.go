@@ -53,6 +53,9 @@ type pageBlobSenderBase struct {
 	// Using a automatic pacer here lets us find the right rate for this particular page blob, at which
 	// we won't be trying to move the faster than the Service wants us to.
 	filePacer autopacer
+
+	// size of the destination, when it is a managed disk (which always exists before we start)
+	managedDiskSize int64
 }
 
 const (
@@ -148,6 +151,10 @@ func (s *pageBlobSenderBase) NumChunks() uint32 {
 	return s.numChunks
 }
 
+func (s *pageBlobSenderBase) destinationProperties(ctx context.Context) (*azblob.BlobGetPropertiesResponse, error) {
+	return s.destPageBlobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+}
+
 func (s *pageBlobSenderBase) RemoteFileExists() (bool, error) {
 	return remoteObjectExists(s.destPageBlobURL.GetProperties(s.jptm.Context(), azblob.BlobAccessConditions{}))
 }
@@ -161,6 +168,10 @@ func (s *pageBlobSenderBase) Prologue(ps common.PrologueState) (destinationModif
 	if s.isInManagedDiskImportExportAccount() {
 		// Target will already exist (and CANNOT be created through the REST API, because
 		// managed-disk import-export accounts have restricted API surface)
+		if s.jptm.WriteOnce() {
+			s.jptm.FailActiveSend("Checking managed disk blob", errDestinationExists)
+			return
+		}
 
 		// Check its length, since it already has a size, and the upload will fail at the end if you what
 		// upload to it is bigger than its existing size. (And, for big files, it may be hours until you discover that
@@ -176,6 +187,11 @@ func (s *pageBlobSenderBase) Prologue(ps common.PrologueState) (destinationModif
 			s.jptm.FailActiveSend("Checking size of managed disk blob", sizeErr)
 			return
 		}
+		if s.srcSize%azblob.PageBlobPageBytes != 0 {
+			s.jptm.FailActiveSend("Checking size of managed disk blob", errNotPageAligned)
+			return
+		}
+		s.managedDiskSize = p.ContentLength()
 
 		s.jptm.Log(pipeline.LogInfo, "Blob is managed disk import/export blob, so no Create call is required") // the blob always already exists
 		return
@@ -194,7 +210,7 @@ func (s *pageBlobSenderBase) Prologue(ps common.PrologueState) (destinationModif
 		0,
 		s.headersToApply,
 		s.metadataToApply,
-		azblob.BlobAccessConditions{}); err != nil {
+		destinationAccessConditions(s.jptm)); err != nil {
 		s.jptm.FailActiveSend("Creating blob", err)
 		return
 	}
@@ -233,7 +249,8 @@ func (s *pageBlobSenderBase) Cleanup() {
 	jptm := s.jptm
 
 	// Cleanup
-	if jptm.IsDeadInflight() {
+	// If the blob already existed (in a write-once job), then it's not ours to delete
+	if jptm.IsDeadInflight() && !jptm.DestinationExistedBefore() {
 		if s.isInManagedDiskImportExportAccount() {
 			// no deletion is possible. User just has to upload it again.
 		} else {
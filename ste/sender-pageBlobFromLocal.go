@@ -21,6 +21,7 @@
 package ste
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -32,6 +33,11 @@ type pageBlobUploader struct {
 	pageBlobSenderBase
 
 	md5Channel chan []byte
+
+	sip ISourceInfoProvider
+
+	// when uploading a VHD to a managed disk that is bigger than it, the footer must be moved to the end of the disk
+	footerToRelocate *vhdFooter
 }
 
 func newPageBlobUploader(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, sip ISourceInfoProvider) (ISenderBase, error) {
@@ -40,7 +46,52 @@ func newPageBlobUploader(jptm IJobPartTransferMgr, destination string, p pipelin
 		return nil, err
 	}
 
-	return &pageBlobUploader{pageBlobSenderBase: *senderBase, md5Channel: newMd5Channel()}, nil
+	return &pageBlobUploader{pageBlobSenderBase: *senderBase, md5Channel: newMd5Channel(), sip: sip}, nil
+}
+
+func (u *pageBlobUploader) Prologue(ps common.PrologueState) (destinationModified bool) {
+	destinationModified = u.pageBlobSenderBase.Prologue(ps)
+
+	if u.jptm.IsLive() && u.isInManagedDiskImportExportAccount() {
+		u.checkVhdFooter()
+	}
+	return
+}
+
+// checkVhdFooter makes sure that what we are about to upload to a managed disk is a VHD that the disk can use,
+// and notes whether its footer needs to be moved to the end of the disk
+func (u *pageBlobUploader) checkVhdFooter() {
+	jptm := u.jptm
+
+	localSip, ok := u.sip.(ILocalSourceInfoProvider)
+	if !ok {
+		return
+	}
+	source, err := localSip.OpenSourceFile()
+	if err != nil {
+		jptm.FailActiveUpload("Reading VHD footer", err)
+		return
+	}
+	defer source.Close()
+
+	footer, isVhd, err := readVhdFooter(source, u.srcSize)
+	if err != nil {
+		jptm.FailActiveUpload("Reading VHD footer", err)
+		return
+	}
+	if !isVhd {
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "Source does not end with a VHD footer. Managed disks expect a fixed size VHD, so the disk may not be usable")
+		return
+	}
+	if err = footer.validateForManagedDisk(u.srcSize); err != nil {
+		jptm.FailActiveUpload("Checking VHD footer", err)
+		return
+	}
+
+	if u.srcSize < u.managedDiskSize {
+		jptm.Log(pipeline.LogInfo, fmt.Sprintf("VHD is smaller than the managed disk, so its footer will be moved to the end of the disk at offset %d", u.managedDiskSize-vhdFooterSize))
+		u.footerToRelocate = &footer
+	}
 }
 
 func (u *pageBlobUploader) Md5Channel() chan<- []byte {
@@ -78,7 +129,7 @@ func (u *pageBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int3
 		// send it
 		jptm.LogChunkStatus(id, common.EWaitReason.Body())
 		body := newPacedRequestBody(jptm.Context(), reader, u.pacer)
-		enrichedContext := withRetryNotification(jptm.Context(), u.filePacer)
+		enrichedContext := withRetryBufferRelease(withRetryNotification(jptm.Context(), u.filePacer), reader)
 		_, err := u.destPageBlobURL.UploadPages(enrichedContext, id.OffsetInFile(), body, azblob.PageBlobAccessConditions{}, nil)
 		if err != nil {
 			jptm.FailActiveUpload("Uploading page", err)
@@ -90,6 +141,10 @@ func (u *pageBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int3
 func (u *pageBlobUploader) Epilogue() {
 	jptm := u.jptm
 
+	if jptm.IsLive() && u.footerToRelocate != nil {
+		u.relocateVhdFooter()
+	}
+
 	// set content MD5 (only way to do this is to re-PUT all the headers, this time with the MD5 included)
 	if jptm.IsLive() && !u.isInManagedDiskImportExportAccount() {
 		tryPutMd5Hash(jptm, u.md5Channel, func(md5Hash []byte) error {
@@ -103,6 +158,25 @@ func (u *pageBlobUploader) Epilogue() {
 	u.pageBlobSenderBase.Epilogue()
 }
 
+// relocateVhdFooter writes the footer, updated for the size of the disk, into the last page of the disk, then clears
+// the copy that was uploaded (in its original position) along with the rest of the VHD
+func (u *pageBlobUploader) relocateVhdFooter() {
+	jptm := u.jptm
+	footer := *u.footerToRelocate
+	newFooterOffset := u.managedDiskSize - vhdFooterSize
+	footer.setCurrentSize(newFooterOffset)
+
+	_, err := u.destPageBlobURL.UploadPages(jptm.Context(), newFooterOffset, bytes.NewReader(footer[:]), azblob.PageBlobAccessConditions{}, nil)
+	if err != nil {
+		jptm.FailActiveUpload("Moving VHD footer", err)
+		return
+	}
+	_, err = u.destPageBlobURL.ClearPages(jptm.Context(), u.srcSize-vhdFooterSize, vhdFooterSize, azblob.PageBlobAccessConditions{})
+	if err != nil {
+		jptm.FailActiveUpload("Clearing original VHD footer", err)
+	}
+}
+
 func (u *pageBlobUploader) GetDestinationLength() (int64, error) {
 	prop, err := u.destPageBlobURL.GetProperties(u.jptm.Context(), azblob.BlobAccessConditions{})
 
@@ -110,5 +184,11 @@ func (u *pageBlobUploader) GetDestinationLength() (int64, error) {
 		return -1, err
 	}
 
+	if u.isInManagedDiskImportExportAccount() && prop.ContentLength() == u.managedDiskSize {
+		// a managed disk keeps its own size, which may be bigger than what we uploaded into it,
+		// so all we can check is that its size hasn't changed under us
+		return u.srcSize, nil
+	}
+
 	return prop.ContentLength(), nil
 }
@@ -104,6 +104,7 @@ func newMd5Channel() chan []byte {
 func tryPutMd5Hash(jptm IJobPartTransferMgr, md5Channel <-chan []byte, worker func(hash []byte) error) {
 	md5Hash, ok := <-md5Channel
 	if ok {
+		jptm.SetContentMD5(md5Hash)
 		err := worker(md5Hash)
 		if err != nil {
 			jptm.FailActiveUpload("Setting hash", err)
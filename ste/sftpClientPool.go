@@ -0,0 +1,287 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Servers and firewalls drop connections that are idle for long, so an idle connection is checked before it's used again,
+// once it has been idle for a while, and closed rather than used once it has been idle for much longer
+const (
+	sftpIdleCheckAfter = 15 * time.Second
+	sftpMaxIdle        = 5 * time.Minute
+)
+
+// sftpClientPool shares a limited number of connections to one SFTP server between all the chunks that read or write there.
+// Chunks take a connection only while they use it, and never hold one while they wait for anything else,
+// so that the pool can be smaller than the number of files in progress without any of them waiting on each other
+type sftpClientPool struct {
+	dial  func(ctx context.Context) (*common.SftpClient, error)
+	slots chan struct{} // one for each connection in use, so that there are never more than the max
+
+	idleLock sync.Mutex
+	idle     []idleSftpClient // the least recently used first
+}
+
+type idleSftpClient struct {
+	client *common.SftpClient
+	since  time.Time
+}
+
+func newSftpClientPool(maxConnections int, dial func(ctx context.Context) (*common.SftpClient, error)) *sftpClientPool {
+	return &sftpClientPool{
+		dial:  dial,
+		slots: make(chan struct{}, maxConnections),
+	}
+}
+
+// acquire returns an idle connection, or a new one if there are none, blocking while the max number are in use
+func (p *sftpClientPool) acquire(ctx context.Context) (*common.SftpClient, error) {
+	return p.acquireConnection(ctx, true)
+}
+
+// acquireConnection is acquire, but always makes a new connection unless reuse is true
+func (p *sftpClientPool) acquireConnection(ctx context.Context, reuse bool) (*common.SftpClient, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if reuse {
+		if c := p.takeIdle(); c != nil {
+			return c, nil
+		}
+	}
+
+	c, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// takeIdle returns the most recently used idle connection that still works, or nil if there is none
+func (p *sftpClientPool) takeIdle() *common.SftpClient {
+	for {
+		p.idleLock.Lock()
+		n := len(p.idle)
+		if n == 0 {
+			p.idleLock.Unlock()
+			return nil
+		}
+		idle := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.idleLock.Unlock()
+
+		idleFor := time.Since(idle.since)
+		if idleFor < sftpIdleCheckAfter {
+			return idle.client
+		}
+		if idleFor < sftpMaxIdle {
+			if _, err := idle.client.Getwd(); err == nil {
+				return idle.client
+			}
+		}
+		_ = idle.client.Close()
+	}
+}
+
+// release returns a connection to the pool, after the operation that used it finished with the given error.
+// Errors reported by the server leave the connection usable, but others mean it's broken, so it's closed.
+// So are connections that have been idle for too long to be used again
+func (p *sftpClientPool) release(c *common.SftpClient, opErr error) {
+	expired := make([]*common.SftpClient, 0)
+	if isSftpConnectionUsable(opErr) {
+		p.idleLock.Lock()
+		for len(p.idle) > 0 && time.Since(p.idle[0].since) >= sftpMaxIdle {
+			expired = append(expired, p.idle[0].client)
+			p.idle = p.idle[1:]
+		}
+		p.idle = append(p.idle, idleSftpClient{client: c, since: time.Now()})
+		p.idleLock.Unlock()
+	} else {
+		expired = append(expired, c)
+	}
+	for _, e := range expired {
+		_ = e.Close()
+	}
+	<-p.slots
+}
+
+// do runs the operation with a connection from the pool.
+// If the connection breaks, e.g. because the server dropped it while it was idle, the operation is tried once more on a new one,
+// so the operation must be one that can be repeated
+func (p *sftpClientPool) do(ctx context.Context, op func(c *common.SftpClient) error) error {
+	c, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = op(c)
+	p.release(c, err)
+
+	if !isSftpConnectionUsable(err) && ctx.Err() == nil {
+		if c, err = p.acquireConnection(ctx, false); err != nil {
+			return err
+		}
+		err = op(c)
+		p.release(c, err)
+	}
+	return err
+}
+
+func isSftpConnectionUsable(err error) bool {
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF || os.IsNotExist(err) || os.IsPermission(err) {
+		return true
+	}
+	_, isStatus := err.(*sftp.StatusError)
+	return isStatus
+}
+
+// sftpClientPools has the pool for each server (and user) that the jobs in this process use
+type sftpClientPools struct {
+	maxConnectionsPerServer int
+	lock                    sync.Mutex
+	pools                   map[string]*sftpClientPool
+}
+
+func newSftpClientPools(maxConnectionsPerServer int) *sftpClientPools {
+	return &sftpClientPools{maxConnectionsPerServer: maxConnectionsPerServer, pools: make(map[string]*sftpClientPool)}
+}
+
+func (s *sftpClientPools) get(parts common.SftpURLParts) *sftpClientPool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pool, ok := s.pools[parts.Server()]
+	if !ok {
+		pool = newSftpClientPool(s.maxConnectionsPerServer, func(ctx context.Context) (*common.SftpClient, error) {
+			return common.CreateSftpClient(ctx, parts)
+		})
+		s.pools[parts.Server()] = pool
+	}
+	return pool
+}
+
+// getSftpClientPool returns the pool for the server of the given SFTP URL, and the path of the file on that server
+func getSftpClientPool(rawURL string) (*sftpClientPool, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	parts, err := common.NewSftpURLParts(*u)
+	if err != nil {
+		return nil, "", err
+	}
+	ja, ok := JobsAdmin.(*jobsAdmin)
+	if !ok {
+		return nil, "", errors.New("SFTP connections are only available in the transfer engine")
+	}
+	return ja.sftpPools.get(parts), parts.Path, nil
+}
+
+// sftpFileReader reads ranges of a file on an SFTP server, opening the file for each range, with whichever connection is free
+type sftpFileReader struct {
+	ctx   context.Context
+	pool  *sftpClientPool
+	path  string
+	meter *bandwidthMeter // counts what's read, since it doesn't go through a pipeline. May be nil
+}
+
+func newSftpFileReader(ctx context.Context, pool *sftpClientPool, path string, meter *bandwidthMeter) *sftpFileReader {
+	return &sftpFileReader{ctx: ctx, pool: pool, path: path, meter: meter}
+}
+
+func (r *sftpFileReader) ReadAt(b []byte, off int64) (n int, err error) {
+	err = r.pool.do(r.ctx, func(c *common.SftpClient) error {
+		f, openErr := c.Open(r.path)
+		if openErr != nil {
+			return openErr
+		}
+		defer f.Close()
+		if _, seekErr := f.Seek(off, io.SeekStart); seekErr != nil {
+			return seekErr
+		}
+		var readErr error
+		n, readErr = io.ReadFull(f, b)
+		r.meter.recordReceived(n)
+		return readErr
+	})
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF // as required by io.ReaderAt, when the file ends before the buffer is full
+	}
+	return n, err
+}
+
+func (r *sftpFileReader) Close() error {
+	return nil // the file is only open while each range is read
+}
+
+// sftpFileWriter writes a file on an SFTP server, in the order the data is given, which is how downloads save their chunks.
+// Like the reader, it opens the file for each write, so that it doesn't hold a connection while it waits for the next chunk
+type sftpFileWriter struct {
+	ctx    context.Context
+	pool   *sftpClientPool
+	path   string
+	offset int64
+	meter  *bandwidthMeter // counts what's written, since it doesn't go through a pipeline. May be nil
+}
+
+func newSftpFileWriter(ctx context.Context, pool *sftpClientPool, path string, meter *bandwidthMeter) *sftpFileWriter {
+	return &sftpFileWriter{ctx: ctx, pool: pool, path: path, meter: meter}
+}
+
+func (w *sftpFileWriter) Write(b []byte) (n int, err error) {
+	err = w.pool.do(w.ctx, func(c *common.SftpClient) error {
+		f, openErr := c.OpenFile(w.path, os.O_WRONLY)
+		if openErr != nil {
+			return openErr
+		}
+		_, writeErr := f.Seek(w.offset, io.SeekStart)
+		if writeErr == nil {
+			n, writeErr = f.Write(b)
+			w.meter.recordSent(n)
+		}
+		// the server may only report a failed write when the file is closed
+		if closeErr := f.Close(); writeErr == nil {
+			writeErr = closeErr
+		}
+		return writeErr
+	})
+	w.offset += int64(n)
+	return n, err
+}
+
+func (w *sftpFileWriter) Close() error {
+	return nil
+}
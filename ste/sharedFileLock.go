@@ -0,0 +1,66 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package ste
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// how long to wait for another copy of AzCopy to finish with a shared file
+	sharedFileLockTimeout = 10 * time.Second
+
+	// a lock this old was left by a process that died holding it, since a shared file is only ever locked for
+	// as long as it takes to append a line or rewrite a few MiB
+	sharedFileLockStaleAfter = time.Minute
+
+	sharedFileLockRetryInterval = 10 * time.Millisecond
+)
+
+// lockSharedFile serializes the changes to a file that several copies of AzCopy append to (e.g. the bandwidth usage file),
+// so that when one of them rewrites the file to shrink it, a line appended by another can't go to the old file after it was
+// read, and be lost. Every append and rewrite must hold the lock, but reads needn't, since a rewrite replaces the file in one rename.
+// The lock is a file next to the shared one, created exclusively, which works the same way on every platform
+func lockSharedFile(path string) (unlock func(), err error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(sharedFileLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		// on Windows, a lock file that's being deleted can't be opened at all for a moment
+		if !os.IsExist(err) && !os.IsPermission(err) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > sharedFileLockStaleAfter {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is in use by another copy of AzCopy (if none is running, delete %s)", path, lockPath)
+		}
+		time.Sleep(sharedFileLockRetryInterval)
+	}
+}
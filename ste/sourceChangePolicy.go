@@ -0,0 +1,91 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// maxSourceChangeRestarts limits how many times, under the RescheduleLatest policy, a transfer is started over
+// because its source changed before any data was sent. A source that keeps changing will fail instead.
+const maxSourceChangeRestarts = 3
+
+// sourceChangedStatus returns the status with which to end a transfer whose source changed after it was scheduled.
+// RescheduleLatest still fails the transfer (any data already sent belongs to the old version of the source),
+// but the latest version has been recorded in the plan, so resuming the job transfers that version.
+func sourceChangedStatus(policy common.SourceChangePolicy) common.TransferStatus {
+	if policy == common.ESourceChangePolicy.Skip() {
+		return common.ETransferStatus.SkippedSourceChanged()
+	}
+	return common.ETransferStatus.Failed()
+}
+
+// isSourceConditionNotMet tells whether a conditional read of a remote source failed because the source has changed
+func isSourceConditionNotMet(err error) bool {
+	if stgErr, ok := err.(azblob.StorageError); ok {
+		return stgErr.Response() != nil && stgErr.Response().StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// sourceUnchangedConditions returns the access conditions under which a read of a blob source only succeeds if the blob is the one that was scheduled.
+// The last modified time only has a granularity of a second, so a blob that was rewritten within the same second would pass,
+// which is why the ETag is checked too, when it was recorded
+func sourceUnchangedConditions(lmt time.Time, eTag string) azblob.BlobAccessConditions {
+	conditions := azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfUnmodifiedSince: lmt}}
+	if eTag != "" {
+		conditions.ModifiedAccessConditions.IfMatch = azblob.ETag(eTag)
+	}
+	return conditions
+}
+
+var errSourceChangedSinceScan = errors.New("the source has changed since it was scanned (its ETag is different)")
+
+// checkSourceETag checks that the source still has the ETag that was recorded when it was scanned
+func checkSourceETag(ctx context.Context, fromTo common.FromTo, source string, eTag string, p pipeline.Pipeline) error {
+	if fromTo.From() != common.ELocation.Blob() {
+		return fmt.Errorf("checking that the source is unchanged is not supported when transferring %v", fromTo)
+	}
+	if eTag == "" {
+		return errors.New("the ETag of the source was not recorded when it was scanned")
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
+	_, err = azblob.NewBlobURL(*u, p).GetProperties(ctx,
+		azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: azblob.ETag(eTag)}})
+	if isSourceConditionNotMet(err) {
+		return errSourceChangedSinceScan
+	}
+	return err
+}
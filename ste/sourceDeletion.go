@@ -0,0 +1,117 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+var errSourceChangedSinceTransfer = errors.New("the source has changed since it was transferred, so it has been kept")
+var errSourceHashNotVerified = errors.New("no hash of the content was compared with one of the source, so it has been kept")
+
+// sourceDeletionTracker keeps count of the sources that were deleted after being transferred and verified,
+// and of the ones that could not be deleted, for the reconciliation report at the end of the job
+type sourceDeletionTracker struct {
+	atomicDeleted uint32
+	mu            sync.Mutex
+	failures      []common.SourceDeletionFailure
+}
+
+func newSourceDeletionTracker() *sourceDeletionTracker {
+	return &sourceDeletionTracker{failures: make([]common.SourceDeletionFailure, 0)}
+}
+
+func (t *sourceDeletionTracker) recordDeleted() {
+	atomic.AddUint32(&t.atomicDeleted, 1)
+}
+
+func (t *sourceDeletionTracker) recordFailure(source string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = append(t.failures, common.SourceDeletionFailure{Src: source, ErrorMsg: err.Error()})
+}
+
+// get returns the number of sources deleted so far, and a copy of the failures
+func (t *sourceDeletionTracker) get() (deleted uint32, failures []common.SourceDeletionFailure) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures = make([]common.SourceDeletionFailure, len(t.failures))
+	copy(failures, t.failures)
+	return atomic.LoadUint32(&t.atomicDeleted), failures
+}
+
+// deleteVerifiedSource deletes the source of a transfer that has succeeded and been verified, for jobs with move semantics.
+// The source is kept if it has been modified since it was transferred, since the destination would not have the latest content
+func deleteVerifiedSource(ctx context.Context, fromTo common.FromTo, source string, lastModifiedTime time.Time, p pipeline.Pipeline) error {
+	switch fromTo.From() {
+	case common.ELocation.Local():
+		fi, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().UTC() != lastModifiedTime.UTC() {
+			return errSourceChangedSinceTransfer
+		}
+		return os.Remove(source)
+	case common.ELocation.Blob():
+		u, err := url.Parse(source)
+		if err != nil {
+			return err
+		}
+		_, err = azblob.NewBlobURL(*u, p).Delete(ctx, azblob.DeleteSnapshotsOptionNone,
+			azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfUnmodifiedSince: lastModifiedTime}})
+		if isSourceConditionNotMet(err) {
+			return errSourceChangedSinceTransfer
+		}
+		return err
+	case common.ELocation.File():
+		u, err := url.Parse(source)
+		if err != nil {
+			return err
+		}
+		// files have no conditional delete, so check the last modified time first
+		props, err := azfile.NewFileURL(*u, p).GetProperties(ctx)
+		if err != nil {
+			return err
+		}
+		if !props.LastModified().Equal(lastModifiedTime) {
+			return errSourceChangedSinceTransfer
+		}
+		_, err = azfile.NewFileURL(*u, p).Delete(ctx)
+		return err
+	default:
+		return fmt.Errorf("deleting the source is not supported when transferring %v", fromTo)
+	}
+}
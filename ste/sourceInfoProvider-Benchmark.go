@@ -21,6 +21,7 @@
 package ste
 
 import (
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
@@ -46,9 +47,16 @@ func (b benchmarkSourceInfoProvider) IsLocal() bool {
 }
 
 func (b benchmarkSourceInfoProvider) OpenSourceFile() (common.CloseableReaderAt, error) {
+	if strings.HasPrefix(b.jptm.Info().Source, "https://"+common.CompressibleBenchmarkSourceHost) {
+		return common.NewCompressibleDataGenerator(b.jptm.Info().SourceSize), nil
+	}
 	return common.NewRandomDataGenerator(b.jptm.Info().SourceSize), nil
 }
 
 func (b benchmarkSourceInfoProvider) GetLastModifiedTime() (time.Time, error) {
 	return common.BenchmarkLmt, nil
 }
+
+func (b benchmarkSourceInfoProvider) GetSourceSize() (int64, error) {
+	return b.jptm.Info().SourceSize, nil
+}
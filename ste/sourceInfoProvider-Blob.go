@@ -42,6 +42,17 @@ func newBlobSourceInfoProvider(jptm IJobPartTransferMgr) (ISourceInfoProvider, e
 	return &blobSourceInfoProvider{defaultRemoteSourceInfoProvider: *base}, nil
 }
 
+func (p *blobSourceInfoProvider) Properties() (*SrcProperties, error) {
+	srcProperties, err := p.defaultRemoteSourceInfoProvider.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	// blobs have no SMB properties for the rules to read
+	srcProperties.SrcMetadata = p.jptm.PropertyMapping().Apply(&srcProperties.SrcHTTPHeaders, srcProperties.SrcMetadata, nil)
+	return srcProperties, nil
+}
+
 func (p *blobSourceInfoProvider) BlobTier() azblob.AccessTierType {
 	return p.transferInfo.S2SSrcBlobTier
 }
@@ -44,7 +44,7 @@ func newFileSourceInfoProvider(jptm IJobPartTransferMgr) (ISourceInfoProvider, e
 
 	// due to the REST parity feature added in 2019-02-02, the File APIs are no longer backward compatible
 	// so we must use the latest SDK version to stay safe
-	ctx := context.WithValue(jptm.Context(), ServiceAPIVersionOverride, azfile.ServiceVersion)
+	ctx := context.WithValue(jptm.Context(), ServiceAPIVersionOverride, fileServiceVersion(jptm))
 
 	return &fileSourceInfoProvider{defaultRemoteSourceInfoProvider: *base, ctx: ctx}, nil
 }
@@ -55,8 +55,10 @@ func (p *fileSourceInfoProvider) Properties() (*SrcProperties, error) {
 		return nil, err
 	}
 
-	// Get properties in backend.
-	if p.transferInfo.S2SGetPropertiesInBackend {
+	// Get properties in backend, or if the property mapping needs the SMB properties, which aren't in the job plan
+	mapping := p.jptm.PropertyMapping()
+	smbProperties := map[string]string{}
+	if p.transferInfo.S2SGetPropertiesInBackend || mapping.UsesSMBProperties() {
 		presignedURL, err := p.PreSignedSourceURL()
 		if err != nil {
 			return nil, err
@@ -79,8 +81,12 @@ func (p *fileSourceInfoProvider) Properties() (*SrcProperties, error) {
 			},
 			SrcMetadata: common.FromAzFileMetadataToCommonMetadata(properties.NewMetadata()),
 		}
+		smbProperties[common.PropertySMBCreationTime] = properties.FileCreationTime()
+		smbProperties[common.PropertySMBLastWriteTime] = properties.FileLastWriteTime()
+		smbProperties[common.PropertySMBAttributes] = properties.FileAttributes()
 	}
 
+	srcProperties.SrcMetadata = mapping.Apply(&srcProperties.SrcHTTPHeaders, srcProperties.SrcMetadata, smbProperties)
 	return srcProperties, nil
 }
 
@@ -0,0 +1,136 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Source info provider for files on any HTTP(S) server. They are read through AzCopy, like local files,
+// since the service can't be asked to fetch them itself with the guarantees of a copy (e.g. of the size and modified time)
+type httpSourceInfoProvider struct {
+	jptm IJobPartTransferMgr
+
+	mu         sync.Mutex
+	props      *HTTPSourceProperties // the latest the server gave. Nil until it's asked
+	lmtChecked bool                  // once the LMT has been checked before the transfer, it's checked again with the server
+}
+
+func newHTTPSourceInfoProvider(jptm IJobPartTransferMgr) (ISourceInfoProvider, error) {
+	return &httpSourceInfoProvider{jptm: jptm}, nil
+}
+
+func (p *httpSourceInfoProvider) Properties() (*SrcProperties, error) {
+	// the headers the server gave when the source was scanned, except where the user has asked for others
+	srcHeaders := p.jptm.Info().SrcHTTPHeaders
+	headers, metadata := p.jptm.BlobDstData(nil)
+
+	// metadata given for this file alone, e.g. in a URL list, takes precedence over the metadata given for the job
+	srcMetadata := common.FromAzBlobMetadataToCommonMetadata(metadata)
+	if fileMetadata := p.jptm.Info().SrcMetadata; len(fileMetadata) > 0 {
+		merged := common.Metadata{} // not in place, since the job's metadata is shared by all its transfers
+		for k, v := range srcMetadata {
+			merged[k] = v
+		}
+		for k, v := range fileMetadata {
+			merged[k] = v
+		}
+		srcMetadata = merged
+	}
+
+	return &SrcProperties{
+		SrcHTTPHeaders: common.ResourceHTTPHeaders{
+			ContentType:        common.IffString(headers.ContentType != "", headers.ContentType, srcHeaders.ContentType),
+			ContentEncoding:    common.IffString(headers.ContentEncoding != "", headers.ContentEncoding, srcHeaders.ContentEncoding),
+			ContentLanguage:    common.IffString(headers.ContentLanguage != "", headers.ContentLanguage, srcHeaders.ContentLanguage),
+			ContentDisposition: common.IffString(headers.ContentDisposition != "", headers.ContentDisposition, srcHeaders.ContentDisposition),
+			CacheControl:       common.IffString(headers.CacheControl != "", headers.CacheControl, srcHeaders.CacheControl),
+		},
+		SrcMetadata: srcMetadata,
+	}, nil
+}
+
+func (p *httpSourceInfoProvider) IsLocal() bool {
+	return true // in the sense that AzCopy reads it, rather than the service
+}
+
+func (p *httpSourceInfoProvider) OpenSourceFile() (common.CloseableReaderAt, error) {
+	u, err := httpSourceURL(p.jptm.Info().Source)
+	if err != nil {
+		return nil, err
+	}
+	// the version that's checked against the scan before the transfer starts, which is then the one that's read
+	props, err := p.getProperties(false)
+	if err != nil {
+		return nil, err
+	}
+	return newHTTPRangeReader(p.jptm.Context(), p.jptm.SourceProviderPipeline(), u, p.jptm.Info().SourceSize, props.version(), p.jptm.CacheLimiter()), nil
+}
+
+// getProperties asks the server about the source, to find whether it has changed since it was scanned.
+// Unless refresh is set, the answer it already gave is used, if there is one
+func (p *httpSourceInfoProvider) getProperties(refresh bool) (HTTPSourceProperties, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.props != nil && !refresh {
+		return *p.props, nil
+	}
+
+	u, err := httpSourceURL(p.jptm.Info().Source)
+	if err != nil {
+		return HTTPSourceProperties{}, err
+	}
+	props, err := GetHTTPSourceProperties(p.jptm.Context(), p.jptm.SourceProviderPipeline(), u)
+	if err != nil {
+		return HTTPSourceProperties{}, err
+	}
+	p.props = &props
+	return props, nil
+}
+
+// GetLastModifiedTime is asked before the transfer, and again after it, to find whether the source changed while it was read.
+// So only the first time may it use what the server said when the file was opened
+func (p *httpSourceInfoProvider) GetLastModifiedTime() (time.Time, error) {
+	p.mu.Lock()
+	refresh := p.lmtChecked
+	p.lmtChecked = true
+	p.mu.Unlock()
+
+	props, err := p.getProperties(refresh)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if props.LastModified.IsZero() {
+		return p.jptm.LastModifiedTime(), nil // the server doesn't say, so we can only go by the size
+	}
+	return props.LastModified, nil
+}
+
+func (p *httpSourceInfoProvider) GetSourceSize() (int64, error) {
+	props, err := p.getProperties(false)
+	if err != nil {
+		return 0, err
+	}
+	return props.Size, nil
+}
@@ -60,6 +60,10 @@ func (f localFileSourceInfoProvider) IsLocal() bool {
 }
 
 func (f localFileSourceInfoProvider) OpenSourceFile() (common.CloseableReaderAt, error) {
+	if f.jptm.ShouldConvertToVHD() {
+		reader, _, _, err := openAsFixedVHD(f.jptm.Info().Source)
+		return reader, err
+	}
 	return os.Open(f.jptm.Info().Source)
 }
 
@@ -70,3 +74,15 @@ func (f localFileSourceInfoProvider) GetLastModifiedTime() (time.Time, error) {
 	}
 	return i.ModTime(), nil
 }
+
+func (f localFileSourceInfoProvider) GetSourceSize() (int64, error) {
+	if f.jptm.ShouldConvertToVHD() {
+		size, _, err := ConvertedVHDSize(f.jptm.Info().Source)
+		return size, err
+	}
+	i, err := os.Stat(f.jptm.Info().Source)
+	if err != nil {
+		return 0, err
+	}
+	return i.Size(), nil
+}
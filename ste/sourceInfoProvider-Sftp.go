@@ -0,0 +1,94 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"os"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Source info provider for files on SFTP servers. AzCopy reads them itself, so they're treated like local files
+type sftpSourceInfoProvider struct {
+	jptm IJobPartTransferMgr
+}
+
+func newSftpSourceInfoProvider(jptm IJobPartTransferMgr) (ISourceInfoProvider, error) {
+	return &sftpSourceInfoProvider{jptm}, nil
+}
+
+func (p *sftpSourceInfoProvider) Properties() (*SrcProperties, error) {
+	// as for local files, there are no headers at the source, just what the user asked for
+	headers, metadata := p.jptm.BlobDstData(nil)
+
+	return &SrcProperties{
+		SrcHTTPHeaders: common.ResourceHTTPHeaders{
+			ContentType:        headers.ContentType,
+			ContentEncoding:    headers.ContentEncoding,
+			ContentLanguage:    headers.ContentLanguage,
+			ContentDisposition: headers.ContentDisposition,
+			CacheControl:       headers.CacheControl,
+		},
+		SrcMetadata: common.FromAzBlobMetadataToCommonMetadata(metadata),
+	}, nil
+}
+
+func (p *sftpSourceInfoProvider) IsLocal() bool {
+	return true // in the sense that AzCopy reads it, rather than the service
+}
+
+func (p *sftpSourceInfoProvider) OpenSourceFile() (common.CloseableReaderAt, error) {
+	pool, path, err := getSftpClientPool(p.jptm.Info().Source)
+	if err != nil {
+		return nil, err
+	}
+	return newSftpFileReader(p.jptm.Context(), pool, path, jobBandwidthMeter(p.jptm)), nil
+}
+
+func (p *sftpSourceInfoProvider) stat() (os.FileInfo, error) {
+	pool, path, err := getSftpClientPool(p.jptm.Info().Source)
+	if err != nil {
+		return nil, err
+	}
+	var fi os.FileInfo
+	err = pool.do(p.jptm.Context(), func(c *common.SftpClient) error {
+		fi, err = c.Stat(path)
+		return err
+	})
+	return fi, err
+}
+
+func (p *sftpSourceInfoProvider) GetLastModifiedTime() (time.Time, error) {
+	fi, err := p.stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (p *sftpSourceInfoProvider) GetSourceSize() (int64, error) {
+	fi, err := p.stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
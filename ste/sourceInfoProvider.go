@@ -42,6 +42,9 @@ type ISourceInfoProvider interface {
 type ILocalSourceInfoProvider interface {
 	ISourceInfoProvider
 	OpenSourceFile() (common.CloseableReaderAt, error)
+
+	// GetSourceSize returns the current size of the source file.
+	GetSourceSize() (int64, error)
 }
 
 // IRemoteSourceInfoProvider is the abstraction of the methods needed to prepare remote copy source.
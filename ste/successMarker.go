@@ -0,0 +1,106 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// writeSuccessMarker creates the success marker of the job, if it asked for one and none of its transfers failed,
+// so that Spark, Synapse and the like can start reading the output as soon as the marker is there. Like the manifest,
+// it's written before the job is marked as completed. A marker that can't be written doesn't fail the job, since
+// the transfers themselves are fine, but the consumers of the output won't start, so it's logged as an error
+func (jm *jobMgr) writeSuccessMarker(jobPart0Mgr IJobPartMgr) {
+	plan := jobPart0Mgr.Plan()
+	markerPath := plan.SuccessMarkerPath()
+	if markerPath == "" {
+		return
+	}
+
+	if failed := jm.countFailedTransfers(); failed > 0 {
+		jm.Log(pipeline.LogWarning, fmt.Sprintf("Not creating the success marker %s, since %d transfers failed", markerPath, failed))
+		return
+	}
+
+	_, dstSAS := jobPart0Mgr.SAS()
+	marker := common.GenerateFullPath(string(plan.DestinationRoot[:plan.DestinationRootLength]), markerPath)
+	if err := createSuccessMarker(jm.ctx, plan.FromTo.To(), marker, dstSAS, jobPart0Mgr.destinationPipeline()); err != nil {
+		jm.Log(pipeline.LogError, fmt.Sprintf("Failed to create the success marker %s: %v", markerPath, err))
+		return
+	}
+	jm.Log(pipeline.LogInfo, fmt.Sprintf("Created the success marker %s", markerPath))
+}
+
+// countFailedTransfers counts the transfers of all the parts of the job that failed, in this run or an earlier one
+func (jm *jobMgr) countFailedTransfers() (failed int) {
+	jm.jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
+		plan := jpm.Plan()
+		for t := uint32(0); t < plan.NumTransfers; t++ {
+			status := plan.Transfer(t).TransferStatus()
+			if status == common.ETransferStatus.Failed() || status == common.ETransferStatus.BlobTierFailure() {
+				failed++
+			}
+		}
+	})
+	return failed
+}
+
+// createSuccessMarker creates an empty file at the given destination, replacing it if it's already there
+// (from an earlier run of the same layout, for instance)
+func createSuccessMarker(ctx context.Context, to common.Location, marker, dstSAS string, p pipeline.Pipeline) error {
+	if to == common.ELocation.Local() {
+		if err := os.MkdirAll(filepath.Dir(marker), os.ModePerm); err != nil {
+			return err
+		}
+		f, err := os.Create(marker)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	u, err := url.Parse(marker)
+	if err != nil {
+		return err
+	}
+	appendSASToURL(u, dstSAS)
+
+	switch to {
+	case common.ELocation.Blob():
+		_, err = azblob.NewBlockBlobURL(*u, p).Upload(ctx, bytes.NewReader(nil), azblob.BlobHTTPHeaders{}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+		return err
+	case common.ELocation.BlobFS():
+		_, err = azbfs.NewFileURL(*u, p).Create(ctx, azbfs.BlobFSHTTPHeaders{})
+		return err
+	default:
+		return fmt.Errorf("success markers are not supported when the destination is %v", to)
+	}
+}
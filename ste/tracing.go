@@ -0,0 +1,485 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Tracing records a span for the job, a child span for each transfer, and an event on the transfer's span each time one
+// of its requests is retried. Spans are exported in the OTLP/HTTP JSON encoding, so any OpenTelemetry collector (and most
+// APM tools) can receive them. The trace context of the transfer is also sent with each of its requests, in the W3C
+// traceparent header, so that the service side of a slow transfer can be found from its trace.
+
+const (
+	traceExportBatchSize = 256
+	traceScopeName       = "azcopy"
+
+	// span kinds and status codes, as numbered by OTLP
+	traceSpanKindInternal = 1
+	traceSpanKindClient   = 3
+	traceStatusOk         = 1
+	traceStatusError      = 2
+)
+
+type traceID [16]byte
+type spanID [8]byte
+
+func newTraceID() (id traceID) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id spanID) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+func (id traceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id spanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id spanID) isZero() bool {
+	return id == spanID{}
+}
+
+// traceSpan is one timed operation within the trace of a job. All its methods may be called on a nil span,
+// which is what callers get when tracing is not enabled.
+type traceSpan struct {
+	tracer   *jobTracer
+	traceID  traceID
+	spanID   spanID
+	parentID spanID
+	name     string
+	kind     int
+	start    time.Time
+
+	lock       sync.Mutex
+	attributes map[string]interface{}
+	events     []traceEvent
+	ended      bool
+}
+
+type traceEvent struct {
+	time       time.Time
+	name       string
+	attributes map[string]interface{}
+}
+
+// traceparent returns the value of the W3C Trace Context header that makes this span the parent of a request
+func (s *traceSpan) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+func (s *traceSpan) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *traceSpan) addEvent(name string, attributes map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, traceEvent{time: time.Now(), name: name, attributes: attributes})
+}
+
+// end finishes the span and queues it for export. Spans that end with an error message are marked as failed.
+func (s *traceSpan) end(errorMessage string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	exported := s.toOTLP(time.Now(), errorMessage)
+	s.lock.Unlock()
+
+	s.tracer.export(exported)
+}
+
+var traceSpanContextKey = contextKey{"traceSpan"}
+
+func withTraceSpan(ctx context.Context, span *traceSpan) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceSpanContextKey, span)
+}
+
+func traceSpanFromContext(ctx context.Context) *traceSpan {
+	span, _ := ctx.Value(traceSpanContextKey).(*traceSpan)
+	return span
+}
+
+// jobTracer creates the spans of one job, and sends them to the collector named in the environment
+type jobTracer struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+	logger   common.ILogger
+	traceID  traceID
+	jobSpan  *traceSpan
+
+	lock       sync.Mutex
+	pending    []otlpSpan
+	inFlight   sync.WaitGroup
+	failedOnce sync.Once
+}
+
+// newJobTracer returns a tracer for the job, or nil if no trace collector has been configured
+func newJobTracer(jobID common.JobID, client *http.Client, logger common.ILogger) *jobTracer {
+	lcm := common.GetLifecycleMgr()
+	endpoint := lcm.GetEnvironmentVariable(common.EEnvironmentVariable.TraceEndpoint())
+	if endpoint == "" {
+		return nil
+	}
+	headers := parseTraceHeaders(lcm.GetEnvironmentVariable(common.EEnvironmentVariable.TraceHeaders()))
+	return newOTLPJobTracer(jobID, endpoint, headers, client, logger)
+}
+
+func newOTLPJobTracer(jobID common.JobID, endpoint string, headers map[string]string, client *http.Client, logger common.ILogger) *jobTracer {
+	t := &jobTracer{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   client,
+		logger:   logger,
+		traceID:  newTraceID(),
+	}
+	t.jobSpan = t.startSpan("job", spanID{}, traceSpanKindInternal, map[string]interface{}{
+		"azcopy.job_id": jobID.String(),
+	})
+	return t
+}
+
+// parseTraceHeaders reads headers in the same comma-separated key=value form as OTEL_EXPORTER_OTLP_HEADERS
+func parseTraceHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return headers
+}
+
+func (t *jobTracer) startSpan(name string, parent spanID, kind int, attributes map[string]interface{}) *traceSpan {
+	if attributes == nil {
+		attributes = make(map[string]interface{})
+	}
+	return &traceSpan{
+		tracer:     t,
+		traceID:    t.traceID,
+		spanID:     newSpanID(),
+		parentID:   parent,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+}
+
+// startTransferSpan starts the span of a single transfer, as a child of the job's span
+func (t *jobTracer) startTransferSpan(source, destination string, size int64, partNum common.PartNumber, transferIndex uint32) *traceSpan {
+	if t == nil {
+		return nil
+	}
+	return t.startSpan("transfer", t.jobSpan.spanID, traceSpanKindClient, map[string]interface{}{
+		"azcopy.source":         stripResourceQuery(source),
+		"azcopy.destination":    stripResourceQuery(destination),
+		"azcopy.size":           size,
+		"azcopy.part_number":    int64(partNum),
+		"azcopy.transfer_index": int64(transferIndex),
+	})
+}
+
+// endJob ends the span of the job, and waits until all spans have been sent
+func (t *jobTracer) endJob(status common.JobStatus) {
+	if t == nil {
+		return
+	}
+	t.jobSpan.setAttribute("azcopy.job_status", status.String())
+	t.jobSpan.end("")
+	t.flush()
+}
+
+func (t *jobTracer) export(span otlpSpan) {
+	t.lock.Lock()
+	t.pending = append(t.pending, span)
+	var batch []otlpSpan
+	if len(t.pending) >= traceExportBatchSize {
+		batch = t.pending
+		t.pending = nil
+	}
+	t.lock.Unlock()
+
+	if batch != nil {
+		t.inFlight.Add(1)
+		go func() {
+			defer t.inFlight.Done()
+			t.publish(batch)
+		}()
+	}
+}
+
+// flush sends any partially-filled batch, and waits until all earlier batches have been sent
+func (t *jobTracer) flush() {
+	t.lock.Lock()
+	batch := t.pending
+	t.pending = nil
+	t.lock.Unlock()
+
+	if len(batch) > 0 {
+		t.publish(batch)
+	}
+	t.inFlight.Wait()
+}
+
+// publish makes a best-effort attempt to send the spans. Tracing must never fail the job, so errors are only logged,
+// and only the first time, so that an unreachable collector doesn't fill the log
+func (t *jobTracer) publish(batch []otlpSpan) {
+	body, err := json.Marshal(newOTLPTraceRequest(batch))
+	if err != nil {
+		t.logFailure(err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		t.logFailure(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		t.logFailure(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		t.logFailure(fmt.Errorf("the collector returned status %s", resp.Status))
+	}
+}
+
+func (t *jobTracer) logFailure(err error) {
+	t.failedOnce.Do(func() {
+		t.logger.Log(pipeline.LogWarning, fmt.Sprintf("Failed to export trace spans: %v", err))
+	})
+}
+
+// traceRetry adds an event, describing why the request will be retried, to the span of the transfer that made it
+func traceRetry(ctx context.Context, try int32, request *http.Request, response pipeline.Response, err error) {
+	span := traceSpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	attributes := map[string]interface{}{
+		"azcopy.try":         int64(try),
+		"http.method":        request.Method,
+		"azcopy.chunk_range": request.Header.Get("x-ms-range"),
+	}
+	if response != nil && response.Response() != nil {
+		attributes["http.status_code"] = int64(response.Response().StatusCode)
+		attributes["azcopy.request_id"] = response.Response().Header.Get("x-ms-request-id")
+	}
+	if err != nil {
+		attributes["exception.message"] = err.Error()
+	}
+	span.addEvent("retry", attributes)
+}
+
+// traceContextPolicy adds the W3C traceparent header to each request made for a traced transfer
+type traceContextPolicy struct {
+	next pipeline.Policy
+}
+
+func (p traceContextPolicy) Do(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+	if span := traceSpanFromContext(ctx); span != nil {
+		request.Header.Set("traceparent", span.traceparent())
+	}
+	return p.next.Do(ctx, request)
+}
+
+func newTraceContextPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return traceContextPolicy{next: next}.Do
+	})
+}
+
+// The OTLP/HTTP JSON encoding of spans. Only the parts we use are defined.
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // 64 bit integers are strings in the JSON encoding
+}
+
+func newOTLPTraceRequest(spans []otlpSpan) otlpTraceRequest {
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: toOTLPAttributes(map[string]interface{}{
+			"service.name":    traceScopeName,
+			"service.version": common.AzcopyVersion,
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: traceScopeName, Version: common.AzcopyVersion},
+			Spans: spans,
+		}},
+	}}}
+}
+
+// must be called with the span locked
+func (s *traceSpan) toOTLP(endTime time.Time, errorMessage string) otlpSpan {
+	o := otlpSpan{
+		TraceID:           s.traceID.String(),
+		SpanID:            s.spanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(endTime.UnixNano(), 10),
+		Attributes:        toOTLPAttributes(s.attributes),
+		Status:            otlpStatus{Code: traceStatusOk},
+	}
+	if !s.parentID.isZero() {
+		o.ParentSpanID = s.parentID.String()
+	}
+	if errorMessage != "" {
+		o.Status = otlpStatus{Code: traceStatusError, Message: errorMessage}
+	}
+	for _, e := range s.events {
+		o.Events = append(o.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(e.time.UnixNano(), 10),
+			Name:         e.name,
+			Attributes:   toOTLPAttributes(e.attributes),
+		})
+	}
+	return o
+}
+
+func toOTLPAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpKeyValue, 0, len(attributes))
+	for _, k := range keys {
+		var value otlpValue
+		switch typed := attributes[k].(type) {
+		case int64:
+			s := strconv.FormatInt(typed, 10)
+			value.IntValue = &s
+		case string:
+			if typed == "" {
+				continue
+			}
+			value.StringValue = &typed
+		default:
+			s := fmt.Sprint(typed)
+			value.StringValue = &s
+		}
+		result = append(result, otlpKeyValue{Key: k, Value: value})
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+)
+
+// files smaller than this spend more of their time being initiated (opened, checked, and having their
+// first chunks scheduled) than having their data sent, so they benefit from more transfer initiation routines
+const smallFileThreshold = 1024 * 1024
+
+// Design explanation:
+/*
+The transfer initiation pool starts at its usual size. Each time a job part is scheduled, we look at the share
+of its transfers that are small files, and grow the pool in proportion to that share, towards its max size.
+Jobs of millions of tiny files therefore get enough initiation routines to keep the main pool busy, while jobs
+of large files, which need few of them, don't get any extra. The pool never shrinks, since its routines cost
+almost nothing while idle.
+*/
+
+// smallFileShare returns the fraction of the transfers in the job part that are for small files
+func smallFileShare(plan *JobPartPlanHeader) float64 {
+	if plan.NumTransfers == 0 {
+		return 0
+	}
+	small := 0
+	for i := uint32(0); i < plan.NumTransfers; i++ {
+		if plan.Transfer(i).SourceSize < smallFileThreshold {
+			small++
+		}
+	}
+	return float64(small) / float64(plan.NumTransfers)
+}
+
+// transferInitiationPoolTarget returns the size the transfer initiation pool should have, given the share of
+// small files in the work that's arriving
+func transferInitiationPoolTarget(initial int, max int, smallFileShare float64) int {
+	if max <= initial {
+		return initial
+	}
+	return initial + int(smallFileShare*float64(max-initial))
+}
+
+// scaleTransferInitiationPool grows the transfer initiation pool, if the job part is mostly small files.
+// It's only called from the routine that schedules job parts, so the pool size needs no locking
+func (ja *jobsAdmin) scaleTransferInitiationPool(plan *JobPartPlanHeader) {
+	if !ja.concurrency.AutoScaleTransferInitiationPool() {
+		return
+	}
+
+	share := smallFileShare(plan)
+	target := transferInitiationPoolTarget(ja.concurrency.InitialTransferInitiationPoolSize, ja.concurrency.TransferInitiationPoolSize.Value, share)
+	if target <= ja.transferInitiationPoolSize {
+		return
+	}
+
+	ja.LogToJobLog(fmt.Sprintf("Increasing transfer initiation routines from %d to %d, since %.0f%% of the files in job part %d are small",
+		ja.transferInitiationPoolSize, target, share*100, plan.PartNum))
+	ja.startTransferProcessors(target)
+}
+
+// startTransferProcessors adds transfer initiation routines until there are the given number of them
+func (ja *jobsAdmin) startTransferProcessors(poolSize int) {
+	for ; ja.transferInitiationPoolSize < poolSize; ja.transferInitiationPoolSize++ {
+		go ja.transferProcessor(ja.transferInitiationPoolSize)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// transferJournal appends an entry to the journal of the job for each state transition of each transfer
+type transferJournal struct {
+	*appendOnlyJSONFile
+}
+
+func newTransferJournal(logFileFolder string, jobID common.JobID, logger common.ILogger) *transferJournal {
+	return &transferJournal{newAppendOnlyJSONFile(common.TransferJournalFilePath(logFileFolder, jobID), "journal", logger)}
+}
+
+func (j *transferJournal) record(entry common.TransferJournalEntry) {
+	if !j.isEnabled() {
+		return
+	}
+	entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	j.append(entry)
+}
+
+// requestIDRecorder keeps the ID of the most recent request made for a transfer, so that its journal entries
+// can be matched with the logs of the service
+type requestIDRecorder struct {
+	atomicLastRequestID atomic.Value
+}
+
+var requestIDRecorderContextKey = contextKey{"requestIDRecorder"}
+
+func withRequestIDRecorder(ctx context.Context, recorder *requestIDRecorder) context.Context {
+	return context.WithValue(ctx, requestIDRecorderContextKey, recorder)
+}
+
+// recordRequestID notes the ID of the request that produced the response, if the transfer it was made for is being journaled
+func recordRequestID(ctx context.Context, resp pipeline.Response) {
+	recorder, ok := ctx.Value(requestIDRecorderContextKey).(*requestIDRecorder)
+	if !ok || resp == nil || resp.Response() == nil {
+		return
+	}
+	if id := resp.Response().Header.Get("x-ms-request-id"); id != "" {
+		recorder.atomicLastRequestID.Store(id)
+	}
+}
+
+func (r *requestIDRecorder) lastRequestID() string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.atomicLastRequestID.Load().(string)
+	return id
+}
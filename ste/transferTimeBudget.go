@@ -0,0 +1,85 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// the shortest time budget given to any transfer, so that small files are not failed just because of ordinary latency
+const minTransferTimeBudget = time.Minute
+
+// MaxSlowestTransfersTracked is how many of the slowest transfers of a job are kept for the job summary
+const MaxSlowestTransfersTracked = 50
+
+var errTransferTimeBudgetExceeded = errors.New("the transfer ran over its time budget")
+
+// transferTimeBudget returns how long a transfer of the given size may run, given the budget per GB of the job
+func transferTimeBudget(secondsPerGB uint32, size int64) time.Duration {
+	budget := time.Duration(float64(secondsPerGB) * float64(size) / (1024 * 1024 * 1024) * float64(time.Second))
+	if budget < minTransferTimeBudget {
+		return minTransferTimeBudget
+	}
+	return budget
+}
+
+// slowestTransferTracker keeps the slowest transfers of a job, so that pathological objects in giant jobs
+// can be found without trawling through the log
+type slowestTransferTracker struct {
+	mu      sync.Mutex
+	slowest []common.SlowTransferDetail // slowest first
+}
+
+func newSlowestTransferTracker() *slowestTransferTracker {
+	return &slowestTransferTracker{slowest: make([]common.SlowTransferDetail, 0, MaxSlowestTransfersTracked)}
+}
+
+func (t *slowestTransferTracker) record(detail common.SlowTransferDetail) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := len(t.slowest)
+	if n == MaxSlowestTransfersTracked && detail.ElapsedMilliseconds <= t.slowest[n-1].ElapsedMilliseconds {
+		return // not one of the slowest
+	}
+
+	i := sort.Search(n, func(i int) bool { return t.slowest[i].ElapsedMilliseconds < detail.ElapsedMilliseconds })
+	if n < MaxSlowestTransfersTracked {
+		t.slowest = append(t.slowest, common.SlowTransferDetail{})
+	}
+	copy(t.slowest[i+1:], t.slowest[i:])
+	t.slowest[i] = detail
+}
+
+// get returns a copy of the slowest transfers so far, slowest first
+func (t *slowestTransferTracker) get() []common.SlowTransferDetail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]common.SlowTransferDetail, len(t.slowest))
+	copy(result, t.slowest)
+	return result
+}
@@ -0,0 +1,141 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Tunables are the environment variables of the concurrency and memory settings. Each may also be set
+// by a command-line flag, which takes precedence over the environment variable, or in a config file,
+// which the environment variable takes precedence over
+var Tunables = []common.EnvironmentVariable{
+	common.EEnvironmentVariable.ConcurrencyValue(),
+	common.EEnvironmentVariable.ConcurrencyPerAccount(),
+	common.EEnvironmentVariable.ConcurrencySlowStart(),
+	common.EEnvironmentVariable.TransferInitiationPoolSize(),
+	common.EEnvironmentVariable.EnumerationPoolSize(),
+	common.EEnvironmentVariable.MaxIdleConnections(),
+	common.EEnvironmentVariable.IdleConnectionTimeout(),
+	common.EEnvironmentVariable.MaxConnectionsPerHost(),
+	common.EEnvironmentVariable.ExpectContinue(),
+	common.EEnvironmentVariable.AutoTuneToCpu(),
+	common.EEnvironmentVariable.BufferGB(),
+	common.EEnvironmentVariable.MaxMemoryGB(),
+}
+
+// the values of the tunables that were given on the command line and in the config file, by environment variable name
+var tunableFlagValues = map[string]string{}
+var tunableConfigFileValues = map[string]string{}
+var tunableConfigFilePath string
+
+// TunableName is the name of the command-line flag for a tunable, and its key in the config file,
+// e.g. concurrency-value for AZCOPY_CONCURRENCY_VALUE
+func TunableName(envVar common.EnvironmentVariable) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(envVar.Name, "AZCOPY_")), "_", "-")
+}
+
+// SetTunables records the values of the tunables that were given on the command line (by environment
+// variable name), and reads those in the config file, if there is one. It must be called before
+// NewConcurrencySettings, since that is where the tunables are read
+func SetTunables(configFilePath string, flagValues map[string]string) error {
+	configFileValues := map[string]string{}
+	if configFilePath != "" {
+		var err error
+		if configFileValues, err = readTunablesConfigFile(configFilePath); err != nil {
+			return err
+		}
+	}
+
+	tunableFlagValues = flagValues
+	tunableConfigFileValues = configFileValues
+	tunableConfigFilePath = configFilePath
+	return nil
+}
+
+// readTunablesConfigFile reads a YAML (or, since YAML is a superset of it, JSON) file of tunables, keyed by their
+// TunableName, and returns their values by environment variable name
+func readTunablesConfigFile(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %v", err)
+	}
+
+	settings := map[string]interface{}{}
+	if err = yaml.Unmarshal(raw, &settings); err != nil {
+		return nil, fmt.Errorf("cannot parse config file %s: %v", path, err)
+	}
+
+	byName := make(map[string]common.EnvironmentVariable)
+	known := make([]string, 0, len(Tunables))
+	for _, envVar := range Tunables {
+		byName[TunableName(envVar)] = envVar
+		known = append(known, TunableName(envVar))
+	}
+	sort.Strings(known)
+
+	values := make(map[string]string)
+	for key, value := range settings {
+		envVar, ok := byName[strings.ToLower(key)]
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %q in config file %s. The settings are %s", key, path, strings.Join(known, ", "))
+		}
+		switch value.(type) {
+		case map[interface{}]interface{}, []interface{}, nil:
+			return nil, fmt.Errorf("setting %q in config file %s must be a single value", key, path)
+		}
+		values[envVar.Name] = fmt.Sprint(value)
+	}
+	return values, nil
+}
+
+// lookupTunable returns the value that the user gave for a tunable, or "" if they didn't give one
+func lookupTunable(envVar common.EnvironmentVariable) string {
+	if value, ok := tunableFlagValues[envVar.Name]; ok {
+		return value
+	}
+	if value := common.GetLifecycleMgr().GetEnvironmentVariable(envVar); value != "" {
+		return value
+	}
+	return tunableConfigFileValues[envVar.Name]
+}
+
+// describeTunableSource says where the value that the user gave for a tunable came from
+func describeTunableSource(envVarName string) string {
+	envVar := common.EnvironmentVariable{Name: envVarName}
+	if _, ok := tunableFlagValues[envVarName]; ok {
+		return fmt.Sprintf("--%s command-line flag", TunableName(envVar))
+	}
+	if common.GetLifecycleMgr().GetEnvironmentVariable(envVar) != "" {
+		return fmt.Sprintf("%s environment variable", envVarName)
+	}
+	if _, ok := tunableConfigFileValues[envVarName]; ok {
+		return fmt.Sprintf("%s in config file %s", TunableName(envVar), tunableConfigFilePath)
+	}
+	return fmt.Sprintf("%s environment variable", envVarName)
+}
@@ -0,0 +1,677 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Managed disks, and the page blobs that VMs boot from, must be fixed size VHDs. Rather than making users convert
+// dynamic VHDX and qcow2 images beforehand (which needs as much free space again as the disk's full size),
+// we can present them as fixed VHDs while they are uploaded. Unallocated parts of the image read as zeros,
+// which the page blob uploader doesn't send at all.
+
+const (
+	// Azure requires the virtual size of a VHD to be a whole number of MiB
+	vhdSizeAlignment = 1024 * 1024
+
+	// the largest disk a VHDX can describe, and far larger than any disk Azure accepts. Images claiming more are corrupt
+	maxVirtualDiskSize = 64 * 1024 * 1024 * 1024 * 1024
+
+	vhdCreatorApplication = "azcp"
+	vhdCreatorHostOS      = "Wi2k"
+)
+
+var vhdEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// virtualDisk reads the contents of a disk image, as the disk it describes
+type virtualDisk interface {
+	io.ReaderAt
+	virtualSize() int64
+}
+
+// openAsFixedVHD opens a local file for upload. If it is a VHDX or qcow2 image, the reader presents it as a fixed VHD,
+// and the size returned is the size of that VHD. Any other file is returned as it is.
+func openAsFixedVHD(path string) (reader common.CloseableReaderAt, size int64, converted bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	disk, err := openVirtualDisk(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, false, fmt.Errorf("cannot convert %s to a fixed VHD: %v", path, err)
+	}
+	if disk == nil {
+		fi, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, 0, false, err
+		}
+		return file, fi.Size(), false, nil
+	}
+
+	r := newFixedVHDReader(file, disk)
+	return r, r.size(), true, nil
+}
+
+// ConvertedVHDSize returns the size that the file will have when it is uploaded as a fixed VHD
+func ConvertedVHDSize(path string) (size int64, converted bool, err error) {
+	r, size, converted, err := openAsFixedVHD(path)
+	if err != nil {
+		return 0, false, err
+	}
+	_ = r.Close()
+	return size, converted, nil
+}
+
+// openVirtualDisk returns nil (and no error) if the file isn't in a format that we convert
+func openVirtualDisk(file *os.File) (virtualDisk, error) {
+	signature := make([]byte, 8)
+	if _, err := file.ReadAt(signature, 0); err != nil {
+		if err == io.EOF {
+			return nil, nil // too short to be an image
+		}
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case string(signature) == vhdxSignature:
+		return openVHDX(file, fi.Size())
+	case string(signature[:4]) == qcow2Magic:
+		return openQcow2(file, fi.Size())
+	default:
+		return nil, nil
+	}
+}
+
+// withinFile reports whether length bytes at offset are all inside the image. Offsets and lengths come from
+// the image's own headers, so nothing is read or allocated until they have been checked with it
+func withinFile(offset, length, fileSize int64) bool {
+	return offset >= 0 && length >= 0 && offset <= fileSize && length <= fileSize-offset
+}
+
+// fixedVHDReader presents a virtual disk as a fixed VHD: the disk's contents, padded with zeros to a whole
+// number of MiB, then a VHD footer
+type fixedVHDReader struct {
+	file     *os.File
+	disk     virtualDisk
+	dataSize int64
+	footer   vhdFooter
+}
+
+func newFixedVHDReader(file *os.File, disk virtualDisk) *fixedVHDReader {
+	dataSize := (disk.virtualSize() + vhdSizeAlignment - 1) / vhdSizeAlignment * vhdSizeAlignment
+	return &fixedVHDReader{file: file, disk: disk, dataSize: dataSize, footer: newFixedVhdFooter(dataSize, time.Now())}
+}
+
+func (r *fixedVHDReader) size() int64 {
+	return r.dataSize + vhdFooterSize
+}
+
+func (r *fixedVHDReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		remaining := int64(len(p) - n)
+		switch {
+		case pos >= r.size():
+			return n, io.EOF
+		case pos >= r.dataSize:
+			n += copy(p[n:], r.footer[pos-r.dataSize:])
+		case pos >= r.disk.virtualSize():
+			count := minInt64(remaining, r.dataSize-pos)
+			zeroFill(p[n : n+int(count)])
+			n += int(count)
+		default:
+			count := minInt64(remaining, r.disk.virtualSize()-pos)
+			read, err := r.disk.ReadAt(p[n:n+int(count)], pos)
+			n += read
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (r *fixedVHDReader) Close() error {
+	return r.file.Close()
+}
+
+// newFixedVhdFooter creates the footer of a fixed VHD holding dataSize bytes
+func newFixedVhdFooter(dataSize int64, now time.Time) vhdFooter {
+	var f vhdFooter
+	copy(f[0:], vhdCookie)
+	binary.BigEndian.PutUint32(f[8:], 2)           // features: reserved bit, always set
+	binary.BigEndian.PutUint32(f[12:], 0x00010000) // file format version
+	binary.BigEndian.PutUint64(f[16:], ^uint64(0)) // data offset: none, for fixed disks
+	binary.BigEndian.PutUint32(f[24:], uint32(now.Sub(vhdEpoch)/time.Second))
+	copy(f[28:], vhdCreatorApplication)
+	binary.BigEndian.PutUint32(f[32:], 0x00010000) // creator version
+	copy(f[36:], vhdCreatorHostOS)
+	binary.BigEndian.PutUint64(f[40:], uint64(dataSize)) // original size
+	cylinders, heads, sectorsPerTrack := vhdGeometry(dataSize)
+	binary.BigEndian.PutUint16(f[56:], cylinders)
+	f[58] = heads
+	f[59] = sectorsPerTrack
+	binary.BigEndian.PutUint32(f[vhdDiskTypeOffset:], vhdDiskTypeFixed)
+	_, _ = rand.Read(f[68:84]) // unique ID
+	f.setCurrentSize(dataSize) // also sets the checksum
+	return f
+}
+
+// vhdGeometry computes the CHS geometry of a disk of the given size, using the algorithm in the VHD specification
+func vhdGeometry(size int64) (cylinders uint16, heads uint8, sectorsPerTrack uint8) {
+	totalSectors := size / 512
+	if totalSectors > 65535*16*255 {
+		totalSectors = 65535 * 16 * 255
+	}
+
+	var spt, h, cylinderTimesHeads int64
+	if totalSectors >= 65535*16*63 {
+		spt = 255
+		h = 16
+		cylinderTimesHeads = totalSectors / spt
+	} else {
+		spt = 17
+		cylinderTimesHeads = totalSectors / spt
+		h = (cylinderTimesHeads + 1023) / 1024
+		if h < 4 {
+			h = 4
+		}
+		if cylinderTimesHeads >= h*1024 || h > 16 {
+			spt = 31
+			h = 16
+			cylinderTimesHeads = totalSectors / spt
+		}
+		if cylinderTimesHeads >= h*1024 {
+			spt = 63
+			h = 16
+			cylinderTimesHeads = totalSectors / spt
+		}
+	}
+	return uint16(cylinderTimesHeads / h), uint8(h), uint8(spt)
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func zeroFill(p []byte) {
+	for i := range p {
+		p[i] = 0
+	}
+}
+
+// qcow2 (big-endian throughout). See docs/interop/qcow2.txt in the QEMU source.
+
+const (
+	qcow2Magic = "QFI\xfb"
+
+	qcow2HeaderSize         = 104
+	qcow2IncompatibleDirty  = 1 << 0
+	qcow2L1OffsetMask       = 0x00fffffffffffe00
+	qcow2L2OffsetMask       = 0x00fffffffffffe00
+	qcow2L2Compressed       = 1 << 62
+	qcow2L2Zero             = 1 << 0
+	qcow2MaxCachedL2Tables  = 64
+	qcow2MinimumClusterBits = 9
+	qcow2MaximumClusterBits = 21
+	qcow2BytesPerTableEntry = 8
+)
+
+type qcow2Disk struct {
+	file        io.ReaderAt
+	fileSize    int64
+	size        int64
+	clusterBits uint32
+	l2Entries   int64
+	l1Table     []uint64
+
+	lock     sync.Mutex
+	l2Tables map[uint64][]uint64 // by offset in the file
+}
+
+func openQcow2(file io.ReaderAt, fileSize int64) (*qcow2Disk, error) {
+	h := make([]byte, qcow2HeaderSize)
+	if _, err := file.ReadAt(h, 0); err != nil {
+		return nil, fmt.Errorf("cannot read qcow2 header: %v", err)
+	}
+
+	version := binary.BigEndian.Uint32(h[4:])
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported qcow2 version %d", version)
+	}
+	if binary.BigEndian.Uint64(h[8:]) != 0 {
+		return nil, errors.New("qcow2 images with a backing file cannot be converted. Use qemu-img to merge it into its backing file first")
+	}
+	clusterBits := binary.BigEndian.Uint32(h[20:])
+	if clusterBits < qcow2MinimumClusterBits || clusterBits > qcow2MaximumClusterBits {
+		return nil, fmt.Errorf("invalid qcow2 cluster size 2^%d", clusterBits)
+	}
+	if binary.BigEndian.Uint32(h[32:]) != 0 {
+		return nil, errors.New("encrypted qcow2 images cannot be converted")
+	}
+	if version == 3 {
+		// a dirty image only has stale reference counts, which we don't use. Anything else changes the layout
+		if incompatible := binary.BigEndian.Uint64(h[72:]) &^ qcow2IncompatibleDirty; incompatible != 0 {
+			return nil, fmt.Errorf("the qcow2 image uses unsupported features (0x%x)", incompatible)
+		}
+	}
+
+	size := binary.BigEndian.Uint64(h[24:])
+	if size == 0 || size > maxVirtualDiskSize {
+		return nil, fmt.Errorf("invalid qcow2 disk size %d", size)
+	}
+	l2Entries := (int64(1) << clusterBits) / qcow2BytesPerTableEntry
+	clusters := (int64(size) + (int64(1) << clusterBits) - 1) >> clusterBits
+	l1Size := int64(binary.BigEndian.Uint32(h[36:]))
+	if l1Size < (clusters+l2Entries-1)/l2Entries {
+		return nil, fmt.Errorf("the qcow2 L1 table (%d entries) is too small for a disk of %d bytes", l1Size, size)
+	}
+	l1Offset := binary.BigEndian.Uint64(h[40:])
+	if l1Offset > math.MaxInt64 || !withinFile(int64(l1Offset), l1Size*qcow2BytesPerTableEntry, fileSize) {
+		return nil, errors.New("the qcow2 L1 table is outside the image, which may be truncated")
+	}
+	l1Raw := make([]byte, l1Size*qcow2BytesPerTableEntry)
+	if _, err := file.ReadAt(l1Raw, int64(l1Offset)); err != nil {
+		return nil, fmt.Errorf("cannot read qcow2 L1 table: %v", err)
+	}
+
+	return &qcow2Disk{
+		file:        file,
+		fileSize:    fileSize,
+		size:        int64(size),
+		clusterBits: clusterBits,
+		l2Entries:   l2Entries,
+		l1Table:     bigEndianUint64s(l1Raw),
+		l2Tables:    make(map[uint64][]uint64),
+	}, nil
+}
+
+func (d *qcow2Disk) virtualSize() int64 {
+	return d.size
+}
+
+func (d *qcow2Disk) ReadAt(p []byte, off int64) (int, error) {
+	clusterSize := int64(1) << d.clusterBits
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= d.size {
+			return n, io.EOF
+		}
+		inCluster := pos & (clusterSize - 1)
+		count := minInt64(minInt64(int64(len(p)-n), clusterSize-inCluster), d.size-pos)
+		chunk := p[n : n+int(count)]
+
+		hostOffset, err := d.hostClusterOffset(pos >> d.clusterBits)
+		if err != nil {
+			return n, err
+		}
+		if hostOffset == 0 {
+			zeroFill(chunk)
+		} else if !withinFile(hostOffset+inCluster, count, d.fileSize) {
+			// not io.EOF, which would look like the end of the disk
+			return n, errors.New("a qcow2 data cluster is outside the image, which may be truncated")
+		} else if _, err := d.file.ReadAt(chunk, hostOffset+inCluster); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// hostClusterOffset returns where in the file the given cluster of the disk is stored, or 0 if it reads as zeros
+func (d *qcow2Disk) hostClusterOffset(cluster int64) (int64, error) {
+	l1Index := cluster / d.l2Entries
+	if l1Index >= int64(len(d.l1Table)) {
+		return 0, nil
+	}
+	l2Offset := d.l1Table[l1Index] & qcow2L1OffsetMask
+	if l2Offset == 0 {
+		return 0, nil
+	}
+	l2Table, err := d.l2Table(l2Offset)
+	if err != nil {
+		return 0, err
+	}
+
+	entry := l2Table[cluster%d.l2Entries]
+	if entry&qcow2L2Compressed != 0 {
+		return 0, errors.New("compressed qcow2 images cannot be converted. Use qemu-img convert to write an uncompressed copy first")
+	}
+	if entry&qcow2L2Zero != 0 {
+		return 0, nil
+	}
+	return int64(entry & qcow2L2OffsetMask), nil
+}
+
+func (d *qcow2Disk) l2Table(offset uint64) ([]uint64, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if table, ok := d.l2Tables[offset]; ok {
+		return table, nil
+	}
+	raw := make([]byte, d.l2Entries*qcow2BytesPerTableEntry)
+	if !withinFile(int64(offset), int64(len(raw)), d.fileSize) { // the masks keep the offset well below 2^63
+		return nil, errors.New("a qcow2 L2 table is outside the image, which may be truncated")
+	}
+	if _, err := d.file.ReadAt(raw, int64(offset)); err != nil {
+		return nil, fmt.Errorf("cannot read qcow2 L2 table: %v", err)
+	}
+	if len(d.l2Tables) >= qcow2MaxCachedL2Tables {
+		d.l2Tables = make(map[uint64][]uint64) // chunks are read roughly in order, so there's little to gain from keeping old ones
+	}
+	table := bigEndianUint64s(raw)
+	d.l2Tables[offset] = table
+	return table, nil
+}
+
+func bigEndianUint64s(raw []byte) []uint64 {
+	values := make([]uint64, len(raw)/8)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint64(raw[i*8:])
+	}
+	return values
+}
+
+// VHDX (little-endian throughout). See the VHDX Format Specification (MS-VHDX).
+
+const (
+	vhdxSignature = "vhdxfile"
+
+	vhdxHeader1Offset      = 64 * 1024
+	vhdxHeader2Offset      = 128 * 1024
+	vhdxHeaderSize         = 4 * 1024
+	vhdxRegionTableOffset  = 192 * 1024
+	vhdxRegionTableSize    = 64 * 1024
+	vhdxChecksumOffset     = 4
+	vhdxTableHeaderSize    = 16 // of the region table
+	vhdxTableEntrySize     = 32 // in both the region table and the metadata table
+	vhdxMetadataHeaderSize = 32
+
+	vhdxMinimumBlockSize = 1024 * 1024
+	vhdxMaximumBlockSize = 256 * 1024 * 1024
+	vhdxMiB              = 1024 * 1024
+
+	vhdxBlockFullyPresent     = 6
+	vhdxBlockPartiallyPresent = 7
+	vhdxBatStateMask          = 7
+	vhdxBatOffsetShift        = 20 // the offset of a block is stored in MiB, above the state bits
+
+	vhdxHasParent = 1 << 1
+)
+
+var (
+	vhdxBatRegion         = msGUID("2DC27766-F623-4200-9D64-115E9BFD4A08")
+	vhdxMetadataRegion    = msGUID("8B7CA206-4790-4B9A-B8FE-575F050F886E")
+	vhdxFileParameters    = msGUID("CAA16737-FA36-4D43-B3B6-33F0AA44E76B")
+	vhdxVirtualDiskSize   = msGUID("2FA54224-CD1B-4876-B211-5DBED83BF4B8")
+	vhdxLogicalSectorSize = msGUID("8141BF1D-A96F-4709-BA47-F233A8FAAB5F")
+
+	crc32c = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// msGUID returns the on-disk form of a GUID, in which the first three fields are little-endian
+func msGUID(s string) (g [16]byte) {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		panic("invalid GUID " + s)
+	}
+	g[0], g[1], g[2], g[3] = b[3], b[2], b[1], b[0]
+	g[4], g[5] = b[5], b[4]
+	g[6], g[7] = b[7], b[6]
+	copy(g[8:], b[8:])
+	return g
+}
+
+type vhdxDisk struct {
+	file       io.ReaderAt
+	fileSize   int64
+	size       int64
+	blockSize  int64
+	chunkRatio int64
+	bat        []uint64
+}
+
+func openVHDX(file io.ReaderAt, fileSize int64) (*vhdxDisk, error) {
+	header, err := readVHDXHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	var noLog [16]byte
+	if !bytes.Equal(header[48:64], noLog[:]) {
+		return nil, errors.New("the VHDX has log entries that have not been applied. Attach it in Windows (or Hyper-V) once, then detach it, and try again")
+	}
+
+	regions, err := readVHDXStructure(file, vhdxRegionTableOffset, vhdxRegionTableSize, "regi")
+	if err != nil {
+		return nil, err
+	}
+	var batOffset, metadataOffset int64
+	var batLength, metadataLength uint32
+	entryCount := binary.LittleEndian.Uint32(regions[8:])
+	if entryCount > (vhdxRegionTableSize-vhdxTableHeaderSize)/vhdxTableEntrySize {
+		return nil, fmt.Errorf("the VHDX region table has too many entries (%d)", entryCount)
+	}
+	for i := uint32(0); i < entryCount; i++ {
+		entry := regions[vhdxTableHeaderSize+i*vhdxTableEntrySize : vhdxTableHeaderSize+(i+1)*vhdxTableEntrySize]
+		var id [16]byte
+		copy(id[:], entry[:16])
+		rawOffset := binary.LittleEndian.Uint64(entry[16:])
+		length := binary.LittleEndian.Uint32(entry[24:])
+		if id == vhdxBatRegion || id == vhdxMetadataRegion {
+			if rawOffset > math.MaxInt64 || !withinFile(int64(rawOffset), int64(length), fileSize) {
+				return nil, errors.New("a VHDX region is outside the image, which may be truncated")
+			}
+		}
+		offset := int64(rawOffset)
+		switch id {
+		case vhdxBatRegion:
+			batOffset, batLength = offset, length
+		case vhdxMetadataRegion:
+			metadataOffset, metadataLength = offset, length
+		default:
+			if binary.LittleEndian.Uint32(entry[28:])&1 != 0 {
+				return nil, errors.New("the VHDX has a required region that is not supported")
+			}
+		}
+	}
+	if batLength == 0 || metadataLength == 0 {
+		return nil, errors.New("the VHDX has no block allocation table or metadata")
+	}
+
+	d := &vhdxDisk{file: file, fileSize: fileSize}
+	if err := d.readMetadata(metadataOffset, metadataLength); err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, batLength)
+	if _, err := file.ReadAt(raw, batOffset); err != nil {
+		return nil, fmt.Errorf("cannot read VHDX block allocation table: %v", err)
+	}
+	d.bat = make([]uint64, len(raw)/8)
+	for i := range d.bat {
+		d.bat[i] = binary.LittleEndian.Uint64(raw[i*8:])
+	}
+	return d, nil
+}
+
+// readVHDXHeader returns the current one of the two copies of the header
+func readVHDXHeader(file io.ReaderAt) ([]byte, error) {
+	var current []byte
+	for _, offset := range []int64{vhdxHeader1Offset, vhdxHeader2Offset} {
+		h, err := readVHDXStructure(file, offset, vhdxHeaderSize, "head")
+		if err != nil {
+			continue // the other copy may be fine
+		}
+		if current == nil || binary.LittleEndian.Uint64(h[8:]) > binary.LittleEndian.Uint64(current[8:]) {
+			current = h
+		}
+	}
+	if current == nil {
+		return nil, errors.New("the VHDX has no valid header")
+	}
+	return current, nil
+}
+
+// readVHDXStructure reads a structure that starts with a signature and a CRC-32C checksum of itself
+func readVHDXStructure(file io.ReaderAt, offset int64, size int, signature string) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := file.ReadAt(b, offset); err != nil {
+		return nil, err
+	}
+	if string(b[:4]) != signature {
+		return nil, fmt.Errorf("the VHDX %s structure is missing", signature)
+	}
+	expected := binary.LittleEndian.Uint32(b[vhdxChecksumOffset:])
+	withoutChecksum := make([]byte, size)
+	copy(withoutChecksum, b)
+	binary.LittleEndian.PutUint32(withoutChecksum[vhdxChecksumOffset:], 0)
+	if crc32.Checksum(withoutChecksum, crc32c) != expected {
+		return nil, fmt.Errorf("the checksum of the VHDX %s structure is invalid", signature)
+	}
+	return b, nil
+}
+
+func (d *vhdxDisk) readMetadata(offset int64, length uint32) error {
+	if length < vhdxMetadataHeaderSize {
+		return errors.New("the VHDX metadata is missing")
+	}
+	m := make([]byte, length)
+	if _, err := d.file.ReadAt(m, offset); err != nil {
+		return fmt.Errorf("cannot read VHDX metadata: %v", err)
+	}
+	if string(m[:8]) != "metadata" {
+		return errors.New("the VHDX metadata is missing")
+	}
+
+	var logicalSectorSize int64
+	entryCount := int(binary.LittleEndian.Uint16(m[10:]))
+	if vhdxMetadataHeaderSize+entryCount*vhdxTableEntrySize > len(m) {
+		return fmt.Errorf("the VHDX metadata table has too many entries (%d)", entryCount)
+	}
+	for i := 0; i < entryCount; i++ {
+		entry := m[vhdxMetadataHeaderSize+i*vhdxTableEntrySize : vhdxMetadataHeaderSize+(i+1)*vhdxTableEntrySize]
+		var id [16]byte
+		copy(id[:], entry[:16])
+		// every item we read is at most 8 bytes long
+		itemOffset := int64(binary.LittleEndian.Uint32(entry[16:]))
+		readsItem := id == vhdxFileParameters || id == vhdxVirtualDiskSize || id == vhdxLogicalSectorSize
+		if readsItem && !withinFile(itemOffset, 8, int64(len(m))) {
+			return errors.New("a VHDX metadata item is outside the metadata region")
+		}
+		switch id {
+		case vhdxFileParameters:
+			item := m[itemOffset:]
+			d.blockSize = int64(binary.LittleEndian.Uint32(item))
+			if binary.LittleEndian.Uint32(item[4:])&vhdxHasParent != 0 {
+				return errors.New("differencing VHDX disks cannot be converted. Merge it into its parent first")
+			}
+		case vhdxVirtualDiskSize:
+			d.size = int64(binary.LittleEndian.Uint64(m[itemOffset:]))
+		case vhdxLogicalSectorSize:
+			logicalSectorSize = int64(binary.LittleEndian.Uint32(m[itemOffset:]))
+		}
+	}
+	if d.blockSize == 0 || d.size == 0 || logicalSectorSize == 0 {
+		return errors.New("the VHDX metadata is incomplete")
+	}
+	if d.blockSize < vhdxMinimumBlockSize || d.blockSize > vhdxMaximumBlockSize || d.blockSize&(d.blockSize-1) != 0 {
+		return fmt.Errorf("invalid VHDX block size %d", d.blockSize)
+	}
+	if logicalSectorSize != 512 && logicalSectorSize != 4096 {
+		return fmt.Errorf("invalid VHDX logical sector size %d", logicalSectorSize)
+	}
+	if d.size < 0 || d.size > maxVirtualDiskSize {
+		return fmt.Errorf("invalid VHDX disk size %d", uint64(d.size))
+	}
+
+	// after every chunkRatio payload blocks, the BAT has an entry for a sector bitmap block
+	d.chunkRatio = (int64(1) << 23) * logicalSectorSize / d.blockSize
+	return nil
+}
+
+func (d *vhdxDisk) virtualSize() int64 {
+	return d.size
+}
+
+func (d *vhdxDisk) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= d.size {
+			return n, io.EOF
+		}
+		block := pos / d.blockSize
+		inBlock := pos % d.blockSize
+		count := minInt64(minInt64(int64(len(p)-n), d.blockSize-inBlock), d.size-pos)
+		chunk := p[n : n+int(count)]
+
+		batIndex := block + block/d.chunkRatio
+		var entry uint64
+		if batIndex < int64(len(d.bat)) {
+			entry = d.bat[batIndex]
+		}
+		switch entry & vhdxBatStateMask {
+		case vhdxBlockFullyPresent:
+			blockMiB := entry >> vhdxBatOffsetShift
+			if blockMiB > uint64(d.fileSize)/vhdxMiB || !withinFile(int64(blockMiB)*vhdxMiB+inBlock, count, d.fileSize) {
+				// not io.EOF, which would look like the end of the disk
+				return n, errors.New("a VHDX block is outside the image, which may be truncated")
+			}
+			if _, err := d.file.ReadAt(chunk, int64(blockMiB)*vhdxMiB+inBlock); err != nil {
+				return n, err
+			}
+		case vhdxBlockPartiallyPresent:
+			return n, errors.New("the VHDX has partially present blocks, which only differencing disks should have")
+		default:
+			zeroFill(chunk) // not present, zero, or unmapped
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
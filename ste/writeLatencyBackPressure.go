@@ -0,0 +1,198 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const (
+	// how many write latencies are looked at, per destination, before deciding whether to change the limit
+	writeLatencyWindowSize = 100
+
+	// we never throttle a destination below this many requests in flight
+	minWritesInFlight = 4
+)
+
+// writeLatencyBackPressure limits the number of write requests in flight to each destination host,
+// reducing the limit when the p99 write latency to that host is over the threshold, and raising it again
+// (until there is no limit at all) when latency recovers. It complements the concurrency tuner, which only
+// looks at throughput, and protects shared production accounts from being saturated by one job.
+type writeLatencyBackPressure struct {
+	atomicThresholdMilliseconds int64 // zero means disabled
+	logger                      common.ILogger
+
+	lock         sync.Mutex
+	destinations map[string]*destinationWriteLimiter
+}
+
+// destinationWriteLimiter is the state of one destination host
+type destinationWriteLimiter struct {
+	lock      sync.Mutex
+	limit     int // zero means no limit
+	inFlight  int
+	peak      int           // the most requests we have seen in flight, used to decide when to lift the limit altogether
+	released  chan struct{} // closed (and replaced) each time a request completes, to wake up waiting requests
+	latencies []time.Duration
+}
+
+func newWriteLatencyBackPressure() *writeLatencyBackPressure {
+	return &writeLatencyBackPressure{destinations: make(map[string]*destinationWriteLimiter)}
+}
+
+// enable turns on the back-pressure, for write requests whose p99 latency is over the given threshold
+func (b *writeLatencyBackPressure) enable(threshold time.Duration, logger common.ILogger) {
+	b.lock.Lock()
+	b.logger = logger
+	b.lock.Unlock()
+	atomic.StoreInt64(&b.atomicThresholdMilliseconds, int64(threshold/time.Millisecond))
+}
+
+func (b *writeLatencyBackPressure) threshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&b.atomicThresholdMilliseconds)) * time.Millisecond
+}
+
+func (b *writeLatencyBackPressure) appliesTo(request pipeline.Request) bool {
+	// all of the requests that write data to a destination are PUTs
+	return b != nil && b.threshold() > 0 && request.Method == http.MethodPut
+}
+
+func (b *writeLatencyBackPressure) destination(host string) *destinationWriteLimiter {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	d, ok := b.destinations[host]
+	if !ok {
+		d = &destinationWriteLimiter{released: make(chan struct{})}
+		b.destinations[host] = d
+	}
+	return d
+}
+
+// acquire waits until the write request may be sent to the given host.
+// The returned function must be called with the latency of the request once it has completed.
+func (b *writeLatencyBackPressure) acquire(ctx context.Context, host string) (release func(latency time.Duration), err error) {
+	d := b.destination(host)
+	for {
+		d.lock.Lock()
+		if d.limit == 0 || d.inFlight < d.limit {
+			d.inFlight++
+			if d.inFlight > d.peak {
+				d.peak = d.inFlight
+			}
+			d.lock.Unlock()
+			return func(latency time.Duration) { b.release(d, host, latency) }, nil
+		}
+		wait := d.released
+		d.lock.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (b *writeLatencyBackPressure) release(d *destinationWriteLimiter, host string, latency time.Duration) {
+	d.lock.Lock()
+	d.inFlight--
+	d.latencies = append(d.latencies, latency)
+	var msg string
+	if len(d.latencies) >= writeLatencyWindowSize {
+		msg = d.adjustLimit(b.threshold(), host)
+		d.latencies = d.latencies[:0]
+	}
+	close(d.released)
+	d.released = make(chan struct{})
+	d.lock.Unlock()
+
+	if msg != "" {
+		b.log(msg)
+	}
+}
+
+// adjustLimit decides the new limit from the latencies in the window, and returns a message if the limit changed.
+// Must be called with the lock held.
+func (d *destinationWriteLimiter) adjustLimit(threshold time.Duration, host string) string {
+	p99 := percentile(d.latencies, 99)
+	current := d.limit
+	if current == 0 {
+		current = d.peak
+	}
+
+	if p99 > threshold {
+		// back off multiplicatively, like TCP does on congestion
+		newLimit := current * 3 / 4
+		if newLimit < minWritesInFlight {
+			newLimit = minWritesInFlight
+		}
+		if newLimit == d.limit {
+			return ""
+		}
+		d.limit = newLimit
+		return fmt.Sprintf("Write latency to %s is high (p99 %v, threshold %v), so reducing requests in flight to %d", host, p99, threshold, newLimit)
+	}
+
+	if d.limit == 0 || p99 > threshold*3/4 {
+		// either there is no limit, or latency is close enough to the threshold that we stay where we are
+		return ""
+	}
+
+	// recover gradually, and lift the limit altogether once we are back to where we started
+	d.limit += d.limit/10 + 1
+	if d.limit >= d.peak {
+		d.limit = 0
+		return fmt.Sprintf("Write latency to %s has recovered (p99 %v), so no longer limiting requests in flight", host, p99)
+	}
+	return fmt.Sprintf("Write latency to %s is recovering (p99 %v), so allowing %d requests in flight", host, p99, d.limit)
+}
+
+func (b *writeLatencyBackPressure) log(msg string) {
+	b.lock.Lock()
+	logger := b.logger
+	b.lock.Unlock()
+	if logger != nil {
+		logger.Log(pipeline.LogWarning, msg)
+	}
+}
+
+// percentile returns the p-th percentile of the given durations (which it sorts)
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	index := (len(durations)*p + 99) / 100 // nearest-rank
+	if index < 1 {
+		index = 1
+	}
+	return durations[index-1]
+}
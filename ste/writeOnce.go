@@ -0,0 +1,101 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// errDestinationExists is the reason given for not writing to a destination that is known to exist, in a write-once job
+var errDestinationExists = errors.New("the destination already exists, and the job is write-once")
+
+// destinationAccessConditions returns the conditions for the requests that create or replace a destination blob.
+// In write-once jobs, they make the service refuse the request if the blob already exists, so that, unlike
+// checking for the blob before the transfer, there's no window in which someone else's blob could be overwritten
+func destinationAccessConditions(jptm IJobPartTransferMgr) azblob.BlobAccessConditions {
+	if !jptm.WriteOnce() {
+		return azblob.BlobAccessConditions{}
+	}
+	return azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny}}
+}
+
+// isDestinationExistsError tells whether a write to a destination blob was refused because the blob exists, and
+// the write was conditional on it not existing. The service says so with 409 BlobAlreadyExists. Other refusals, such as
+// a condition on a lease or an ETag that wasn't met, are ordinary failures
+func isDestinationExistsError(err error) bool {
+	if err == errDestinationExists {
+		return true
+	}
+	if stgErr, ok := err.(azblob.StorageError); ok && stgErr.Response() != nil {
+		return stgErr.Response().StatusCode == http.StatusConflict && stgErr.ServiceCode() == azblob.ServiceCodeBlobAlreadyExists
+	}
+	return false
+}
+
+// earlierRunDestination is implemented by the senders of the blobs that are created before their content is written,
+// i.e. page and append blobs, so that a resumed write-once job can look at what an earlier run of it left behind
+type earlierRunDestination interface {
+	destinationProperties(ctx context.Context) (*azblob.BlobGetPropertiesResponse, error)
+}
+
+// completedInEarlierRun is for resumed write-once jobs. A page or append blob is created before its content is written, so an
+// earlier run of the job may have left one behind, which creating it again would conflict with. It's only taken to be the
+// complete copy of the source if it has the length of the source, and the MD5 hash of the source's content. Then there's nothing
+// left to do. Anything else that's there is a conflict, just as in the first run, since it can't be told apart from a blob that
+// someone else wrote
+func completedInEarlierRun(ctx context.Context, d earlierRunDestination, srcSize int64, sourceMD5 func() ([]byte, error)) (bool, error) {
+	props, err := d.destinationProperties(ctx)
+	if exists, err := remoteObjectExists(props, err); err != nil || !exists {
+		return false, err
+	}
+	if props.ContentLength() != srcSize || len(props.ContentMD5()) == 0 {
+		return false, nil
+	}
+	hash, err := sourceMD5()
+	if err != nil {
+		return false, err
+	}
+	return len(hash) > 0 && bytes.Equal(hash, props.ContentMD5()), nil
+}
+
+// sourceMD5 returns the MD5 hash that the source has, or, for a local file, computes it. Nil means it's not known
+func sourceMD5(info TransferInfo, srcFile common.CloseableReaderAt, srcSize int64) ([]byte, error) {
+	if len(info.SrcHTTPHeaders.ContentMD5) > 0 {
+		return info.SrcHTTPHeaders.ContentMD5, nil
+	}
+	if srcFile == nil {
+		return nil, nil
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(srcFile, 0, srcSize)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -21,7 +21,9 @@
 package ste
 
 import (
+	"bytes"
 	"crypto/md5"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"hash"
@@ -111,6 +113,10 @@ func anyToRemote(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, sen
 	srcFile := (common.CloseableReaderAt)(nil)
 	if srcInfoProvider.IsLocal() {
 		sourceFileFactory = srcInfoProvider.(ILocalSourceInfoProvider).OpenSourceFile // all local providers must implement this interface
+		if fromTo := jptm.FromTo(); fromTo.From() == common.ELocation.Local() {
+			// read at the pace the user allows for local disk I/O (if they have set one), including when re-reading chunks for retries
+			sourceFileFactory = jptm.DiskPacer().wrapSourceFactory(jptm.Context(), sourceFileFactory)
+		}
 		srcFile, err = sourceFileFactory()
 		if err != nil {
 			jptm.LogSendError(info.Source, info.Destination, "Couldn't open source-"+err.Error(), 0)
@@ -133,12 +139,49 @@ func anyToRemote(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, sen
 			jptm.ReportTransferDone()
 			return
 		}
-		if lmt.UTC() != jptm.LastModifiedTime().UTC() {
+		currentSize := srcSize
+		if srcInfoProvider.IsLocal() {
+			// re-stat local files, since a file can be rewritten without changing its LMT at the granularity we see
+			currentSize, err = srcInfoProvider.(ILocalSourceInfoProvider).GetSourceSize()
+			if err != nil {
+				jptm.LogSendError(info.Source, info.Destination, "Couldn't get source's size-"+err.Error(), 0)
+				jptm.SetStatus(common.ETransferStatus.Failed())
+				jptm.ReportTransferDone()
+				return
+			}
+		}
+		if lmt.UTC() != jptm.LastModifiedTime().UTC() || currentSize != srcSize {
+			// nothing has been sent yet, so if the policy allows, just start over with the latest version
+			if jptm.RestartForChangedSource(lmt, currentSize) {
+				jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "File modified since transfer scheduled, so will be restarted using the latest version")
+				if srcFile != nil {
+					_ = srcFile.Close()
+				}
+				anyToRemote(jptm, p, pacer, senderFactory, sipf)
+				return
+			}
 			jptm.LogSendError(info.Source, info.Destination, "File modified since transfer scheduled", 0)
+			jptm.SetStatus(jptm.SourceChangedStatus())
+			jptm.ReportTransferDone()
+			return
+		}
+	}
+
+	// step 4b: a page or append blob that an earlier run of a write-once job completed, but didn't get to record, is left as it is
+	if d, ok := s.(earlierRunDestination); ok && jptm.WriteOnce() && jptm.Resumed() {
+		done, err := completedInEarlierRun(jptm.Context(), d, srcSize, func() ([]byte, error) { return sourceMD5(info, srcFile, srcSize) })
+		if err != nil {
+			jptm.LogSendError(info.Source, info.Destination, "Couldn't check the destination left by an earlier run of the job-"+err.Error(), 0)
 			jptm.SetStatus(common.ETransferStatus.Failed())
 			jptm.ReportTransferDone()
 			return
 		}
+		if done {
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "An earlier run of the job completed the destination, which has the length and MD5 hash of the source")
+			jptm.SetStatus(common.ETransferStatus.Success())
+			jptm.ReportTransferDone()
+			return
+		}
 	}
 
 	// step 5a: lock the destination
@@ -194,8 +237,20 @@ func scheduleSendChunks(jptm IJobPartTransferMgr, srcPath string, srcFile common
 	var chunkReader common.SingleChunkReader
 	ps := common.PrologueState{}
 
+	// a file on a web server is verified against the MD5 hash the server gave for it, if it gave one,
+	// since there's nothing else to check a download from an arbitrary server against
+	var expectedMD5 []byte
+	if fromTo := jptm.FromTo(); fromTo.From() == common.ELocation.Http() {
+		expectedMD5 = jptm.Info().SrcHTTPHeaders.ContentMD5
+		if len(expectedMD5) > 0 && common.FIPSModeEnabled() {
+			// MD5 isn't an approved algorithm, so the check is skipped rather than failing the transfer
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "The MD5 hash given by the server was not verified, since MD5 cannot be used in FIPS mode")
+			expectedMD5 = nil
+		}
+	}
+
 	var md5Hasher hash.Hash
-	if jptm.ShouldPutMd5() {
+	if jptm.ShouldPutMd5() || len(expectedMD5) > 0 {
 		md5Hasher = md5.New()
 	} else {
 		md5Hasher = common.NewNullHasher()
@@ -231,6 +286,9 @@ func scheduleSendChunks(jptm IJobPartTransferMgr, srcPath string, srcFile common
 				if prefetchErr == nil {
 					chunkReader.WriteBufferTo(md5Hasher)
 					ps = chunkReader.GetPrologueState()
+					if fromTo := jptm.FromTo(); fromTo.From() == common.ELocation.Http() && jptm.Info().SrcHTTPHeaders.ContentType != "" {
+						ps = common.PrologueState{} // the server has told us the type, which is better than any guess from the content
+					}
 				} else {
 					safeToUseHash = false // because we've missed a chunk
 				}
@@ -277,7 +335,14 @@ func scheduleSendChunks(jptm IJobPartTransferMgr, srcPath string, srcFile common
 	}
 
 	if srcInfoProvider.IsLocal() && safeToUseHash {
-		md5Channel <- md5Hasher.Sum(nil)
+		computedMD5 := md5Hasher.Sum(nil)
+		if len(expectedMD5) > 0 && !bytes.Equal(computedMD5, expectedMD5) {
+			// without a hash, the sender doesn't commit the blob
+			jptm.FailActiveSend("Verifying source MD5", fmt.Errorf("the MD5 hash of the content read, %s, is not the hash the source gave, %s",
+				base64.StdEncoding.EncodeToString(computedMD5), base64.StdEncoding.EncodeToString(expectedMD5)))
+			return
+		}
+		md5Channel <- computedMD5
 	}
 }
 
@@ -319,7 +384,13 @@ func epilogueWithCleanupSendToRemote(jptm IJobPartTransferMgr, s ISenderBase, si
 				jptm.FailActiveSend("epilogueWithCleanupSendToRemote", err)
 			}
 			if lmt.UTC() != jptm.LastModifiedTime().UTC() {
-				jptm.FailActiveSend("epilogueWithCleanupSendToRemote", errors.New("source modified during transfer"))
+				if sip.IsLocal() {
+					// under the RescheduleLatest policy, resuming the job will send the latest version
+					if size, sizeErr := sip.(ILocalSourceInfoProvider).GetSourceSize(); sizeErr == nil {
+						jptm.RecordLatestSourceVersion(lmt, size)
+					}
+				}
+				jptm.FailActiveSendWithStatus("epilogueWithCleanupSendToRemote", errors.New("source modified during transfer"), jptm.SourceChangedStatus())
 			}
 		}
 	}
@@ -336,9 +407,17 @@ func epilogueWithCleanupSendToRemote(jptm IJobPartTransferMgr, s ISenderBase, si
 
 		if destLength != jptm.Info().SourceSize {
 			jptm.FailActiveSend(common.IffString(isS2SCopier, "S2S ", "Upload ")+"Length check", errors.New("destination length does not match source length"))
+		} else if err == nil {
+			jptm.ReportVerified("Length")
 		}
 	}
 
+	// for auditing, check that the source is still the one that was scanned, now that all of it has been read
+	jptm.FailIfSourceChangedSinceScan()
+
+	// the destination has to exist before its permissions can be set
+	jptm.PreservePermissions()
+
 	if jptm.HoldsDestinationLock() { // TODO consider add test of jptm.IsDeadInflight here, so we can remove that from inside all the cleanup methods
 		s.Cleanup() // Perform jptm cleanup, if THIS jptm has the lock on the destination
 	}
@@ -0,0 +1,159 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// propertiesOnlyToBlob brings the properties (HTTP headers, metadata, access tier, index tags and, if the job preserves
+// permissions, ACLs) of an existing destination blob into line with its source, without sending any data. It is for
+// fixing up properties after a big migration, so the destination must already have the same content as the source
+// (see contentUnchanged): anything else needs a normal copy.
+func propertiesOnlyToBlob(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, sipf sourceInfoProviderFactory) {
+	info := jptm.Info()
+
+	if jptm.WasCanceled() {
+		jptm.ReportTransferDone()
+		return
+	}
+
+	transferDone := func(status common.TransferStatus, errorMsg string) {
+		if status == common.ETransferStatus.Success() {
+			jptm.Log(pipeline.LogInfo, fmt.Sprintf("PROPERTIES UPDATED: %s", strings.Split(info.Destination, "?")[0]))
+		} else {
+			jptm.LogSendError(info.Source, info.Destination, errorMsg, 0)
+		}
+		jptm.SetStatus(status)
+		jptm.ReportTransferDone()
+	}
+
+	srcInfoProvider, err := sipf(jptm)
+	if err != nil {
+		transferDone(common.ETransferStatus.Failed(), err.Error())
+		return
+	}
+	props, err := srcInfoProvider.Properties()
+	if err != nil {
+		transferDone(common.ETransferStatus.Failed(), "Couldn't get source properties-"+err.Error())
+		return
+	}
+
+	u, _ := url.Parse(info.Destination)
+	destBlobURL := azblob.NewBlobURL(*u, p)
+	destProps, err := destBlobURL.GetProperties(jptm.Context(), azblob.BlobAccessConditions{})
+	if err != nil {
+		transferDone(common.ETransferStatus.Failed(), "Couldn't get destination properties-"+err.Error())
+		return
+	}
+	if reason := contentUnchanged(info.SourceSize, props.SrcHTTPHeaders.ContentMD5, jptm.LastModifiedTime(),
+		destProps.ContentLength(), destProps.ContentMD5(), destProps.LastModified()); reason != "" {
+		transferDone(common.ETransferStatus.Failed(), "The content of the destination differs from the source ("+reason+"), so it needs a normal copy, not only its properties")
+		return
+	}
+
+	headers := props.SrcHTTPHeaders.ToAzBlobHTTPHeaders()
+	headers.ContentMD5 = destProps.ContentMD5() // the content is unchanged, so its hash is too
+	if srcInfoProvider.IsLocal() && headers.ContentType == "" {
+		// a normal upload would have sniffed the content type from the data, so keep the one the destination got from the same data
+		headers.ContentType = destProps.ContentType()
+	}
+	if _, err = destBlobURL.SetHTTPHeaders(jptm.Context(), headers, azblob.BlobAccessConditions{}); err != nil {
+		transferDone(common.ETransferStatus.Failed(), "Setting HTTP headers-"+err.Error())
+		return
+	}
+	if _, err = destBlobURL.SetMetadata(jptm.Context(), props.SrcMetadata.ToAzBlobMetadata(), azblob.BlobAccessConditions{}); err != nil {
+		transferDone(common.ETransferStatus.Failed(), "Setting metadata-"+err.Error())
+		return
+	}
+
+	// as for a normal copy, an explicit tier wins over the one of a source block blob
+	destBlobTier := azblob.AccessTierNone
+	if blobSrcInfoProvider, ok := srcInfoProvider.(IBlobSourceInfoProvider); ok && blobSrcInfoProvider.BlobType() == azblob.BlobBlockBlob {
+		destBlobTier = blobSrcInfoProvider.BlobTier()
+	}
+	if blockBlobTierOverride, _ := jptm.BlobTiers(); blockBlobTierOverride != common.EBlockBlobTier.None() {
+		destBlobTier = blockBlobTierOverride.ToAccessTierType()
+	}
+	if destBlobTier != azblob.AccessTierNone && destProps.BlobType() == azblob.BlobBlockBlob && azblob.AccessTierType(destProps.AccessTier()) != destBlobTier {
+		ctxWithLatestServiceVersion := context.WithValue(jptm.Context(), ServiceAPIVersionOverride, azblob.ServiceVersion)
+		if _, err = destBlobURL.SetTier(ctxWithLatestServiceVersion, destBlobTier, azblob.LeaseAccessConditions{}); err != nil {
+			transferDone(common.ETransferStatus.BlobTierFailure(), "Setting blob tier-"+err.Error())
+			return
+		}
+	}
+
+	// setting tags doesn't change the last modified time of the destination, so a later run still compares the same way
+	if blobSrcInfoProvider, ok := srcInfoProvider.(IBlobSourceInfoProvider); ok {
+		srcURL, err := blobSrcInfoProvider.PreSignedSourceURL()
+		if err != nil {
+			transferDone(common.ETransferStatus.Failed(), err.Error())
+			return
+		}
+		tags, err := getBlobTags(jptm.Context(), jptm.SourceProviderPipeline(), *srcURL)
+		if err != nil {
+			transferDone(common.ETransferStatus.Failed(), "Getting source tags-"+err.Error())
+			return
+		}
+		if err = setBlobTags(jptm.Context(), p, *u, tags); err != nil {
+			transferDone(common.ETransferStatus.Failed(), "Setting tags-"+err.Error())
+			return
+		}
+	}
+
+	jptm.PreservePermissions()
+	if jptm.IsDeadInflight() {
+		// the failure has already been logged and recorded
+		jptm.ReportTransferDone()
+		return
+	}
+
+	transferDone(common.ETransferStatus.Success(), "")
+}
+
+// contentUnchanged returns why the content of the destination differs from that of the source, or "" if it doesn't.
+// The sizes must be the same. Then the hashes are compared if both sides have one; if not, the source must not have
+// been modified after the destination was written, since a rewrite that kept the size would otherwise go unnoticed
+func contentUnchanged(srcSize int64, srcMD5 []byte, srcLMT time.Time, dstSize int64, dstMD5 []byte, dstLMT time.Time) string {
+	if srcSize != dstSize {
+		return fmt.Sprintf("%d bytes instead of %d", dstSize, srcSize)
+	}
+	if len(srcMD5) > 0 && len(dstMD5) > 0 {
+		if !bytes.Equal(srcMD5, dstMD5) {
+			return "their MD5 hashes differ"
+		}
+		return ""
+	}
+	if srcLMT.After(dstLMT) {
+		return "the source was modified after the destination was written, and they have no hashes to compare"
+	}
+	return ""
+}
@@ -39,6 +39,8 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 
 	// step 2: get the source, destination info for the transfer.
 	info := jptm.Info()
+	dst := newDownloadDestination(jptm)
+	_, isLocalDestination := dst.(localDownloadDestination)
 	fileSize := int64(info.SourceSize)
 	downloadChunkSize := int64(info.BlockSize)
 
@@ -49,11 +51,23 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 		jptm.ReportTransferDone()
 		return
 	}
+	// disk exports are big, and their SAS may expire part way through, so we record how far we get with them.
+	// If an earlier attempt left a partial download of the same version of the disk behind, we carry on from the last whole chunk it saved.
+	trackDiskExportProgress := fileSize > 0 && isManagedDiskURL(info.Source) && isLocalDestination &&
+		!strings.EqualFold(info.Destination, common.Dev_Null) && !jptm.ShouldDecompress()
+	diskExport := diskExportSource{size: fileSize, lastModified: jptm.LastModifiedTime(), eTag: info.SrcETag}
+	resumeOffset, havePartialDiskExport := int64(0), false
+	if trackDiskExportProgress {
+		resumeOffset, havePartialDiskExport = readDiskExportProgress(info.Destination, diskExport)
+		resumeOffset = resumeOffset / downloadChunkSize * downloadChunkSize
+	}
+
 	// if the force Write flags is set to false or prompt
 	// then check the file exists at the remote location
 	// if it does, react accordingly
-	if jptm.GetOverwriteOption() != common.EOverwriteOption.True() {
-		_, err := os.Stat(info.Destination)
+	// (a partial disk export is our own work, so it doesn't count)
+	if jptm.GetOverwriteOption() != common.EOverwriteOption.True() && !havePartialDiskExport {
+		_, err := dst.Stat(info.Destination)
 		if err == nil {
 			// if the error is nil, then file exists locally
 			shouldOverwrite := false
@@ -83,7 +97,7 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 		} else {
 			err := jptm.WaitUntilLockDestination(jptm.Context())
 			if err == nil {
-				err = createEmptyFile(info.Destination)
+				err = dst.CreateEmptyFile(info.Destination)
 			}
 			if err != nil {
 				jptm.LogDownloadError(info.Source, info.Destination, "Empty File Creation error "+err.Error(), 0)
@@ -94,7 +108,14 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 		return
 	}
 
-	// step 4c: normal file creation when source has content
+	// step 4c: a blob that was downloaded before is read from the download cache, if there is one
+	if resumeOffset == 0 {
+		if cached, ok := newDownloaderFromCache(jptm); ok {
+			dl = cached
+		}
+	}
+
+	// step 4d: normal file creation when source has content
 	writeThrough := false
 	// TODO: consider cases where we might set it to true. It might give more predictable and understandable disk throughput.
 	//    But can't be used in the cases shown in the if statement below (one of which is only pseudocode, at this stage)
@@ -128,7 +149,20 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 		// file creations are running at any given instant, for perf diagnostics
 		pseudoId := common.NewPseudoChunkIDForWholeFile(info.Source)
 		jptm.LogChunkStatus(pseudoId, common.EWaitReason.CreateLocalFile())
-		dstFile, err = createDestinationFile(jptm, info.Destination, fileSize, writeThrough)
+		if resumeOffset > 0 {
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, fmt.Sprintf("Resuming partial disk export download from offset %d", resumeOffset))
+			dstFile, err = openDiskExportDestination(info.Destination, resumeOffset)
+		} else {
+			dstFile, err = createDestinationFile(jptm, dst, info.Destination, fileSize, writeThrough)
+		}
+		if err == nil && trackDiskExportProgress {
+			var progressWriter *diskExportProgressWriter
+			progressWriter, err = newDiskExportProgressWriter(dstFile, info.Destination, diskExport, resumeOffset)
+			if err != nil {
+				_ = dstFile.Close()
+			}
+			dstFile = progressWriter
+		}
 		jptm.LogChunkStatus(pseudoId, common.EWaitReason.ChunkDone()) // normal setting to done doesn't apply to these pseudo ids
 		if err != nil {
 			failFileCreation(err)
@@ -161,19 +195,24 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 		numChunks = uint32(fileSize/downloadChunkSize + 1)
 	}
 
-	// step 5b: create destination writer
+	// step 5b: create destination writer, that writes at the pace the user allows for local disk I/O (if they have set one)
 	chunkLogger := jptm.ChunkStatusLogger()
-	sourceMd5Exists := len(info.SrcHTTPHeaders.ContentMD5) > 0
+	diskWriter := dstFile
+	if _, isDevNull := dstFile.(devNullWriter); !isDevNull && isLocalDestination {
+		diskWriter = jptm.DiskPacer().wrapDestination(jptm.Context(), dstFile)
+	}
+	sourceMd5Exists := len(info.SrcHTTPHeaders.ContentMD5) > 0 && resumeOffset == 0 // can't hash what we saved in an earlier attempt
 	dstWriter := common.NewChunkedFileWriter(
 		jptm.Context(),
 		jptm.SlicePool(),
 		jptm.CacheLimiter(),
 		chunkLogger,
-		dstFile,
+		diskWriter,
 		numChunks,
 		MaxRetryPerDownloadBody,
 		jptm.MD5ValidationOption(),
-		sourceMd5Exists)
+		sourceMd5Exists,
+		resumeOffset)
 
 	// step 5c: run prologue in downloader (here it can, for example, create things that will require cleanup in the epilogue)
 	dl.Prologue(jptm, p)
@@ -202,6 +241,13 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 
 		id := common.NewChunkID(info.Destination, startIndex, adjustedChunkSize) // TODO: stop using adjustedChunkSize, below, and use the size that's in the ID
 
+		if startIndex < resumeOffset {
+			// already saved by an earlier attempt
+			jptm.ScheduleChunks(createAlreadySavedChunkFunc(jptm, id))
+			chunkCount++
+			continue
+		}
+
 		// Wait until its OK to schedule it
 		// To prevent excessive RAM consumption, we have a limit on the amount of scheduled-but-not-yet-saved data
 		// TODO: as per comment above, currently, if there's an error here we must continue because we must schedule all chunks
@@ -225,7 +271,7 @@ func remoteToLocal(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pacer, d
 
 }
 
-func createDestinationFile(jptm IJobPartTransferMgr, destination string, size int64, writeThrough bool) (file io.WriteCloser, err error) {
+func createDestinationFile(jptm IJobPartTransferMgr, dst downloadDestination, destination string, size int64, writeThrough bool) (file io.WriteCloser, err error) {
 	ct := common.ECompressionType.None()
 	if jptm.ShouldDecompress() {
 		size = 0                                  // we don't know what the final size will be, so we can't pre-size it
@@ -239,7 +285,7 @@ func createDestinationFile(jptm IJobPartTransferMgr, destination string, size in
 	}
 
 	var dstFile io.WriteCloser
-	dstFile, err = common.CreateFileOfSizeWithWriteThroughOption(destination, size, writeThrough)
+	dstFile, err = dst.CreateFile(destination, size, writeThrough)
 	if err != nil {
 		return nil, err
 	}
@@ -265,6 +311,8 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 	defer jptm.LogChunkStatus(pseudoId, common.EWaitReason.ChunkDone()) // normal setting to done doesn't apply to these pseudo ids
 
 	haveNonEmptyFile := activeDstFile != nil
+	progressWriter, isDiskExport := activeDstFile.(*diskExportProgressWriter)
+	resumedDiskExport := isDiskExport && progressWriter.resumedFrom > 0
 	if haveNonEmptyFile {
 
 		// wait until all received chunks are flushed out
@@ -278,6 +326,14 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Error closing file: "+closeErr.Error()) // log this way so that this line will be logged even if transfer is already failed
 		}
 
+		// a download that was resumed part way through only hashed what it wrote itself, so the whole file is hashed again
+		if jptm.IsLive() && resumedDiskExport && len(info.SrcHTTPHeaders.ContentMD5) > 0 && jptm.MD5ValidationOption() != common.EHashValidationOption.NoCheck() {
+			var hashErr error
+			if md5OfFileAsWritten, hashErr = hashDiskExport(info.Destination); hashErr != nil {
+				jptm.FailActiveDownload("Hashing the resumed download", hashErr)
+			}
+		}
+
 		// Check MD5 (but only if file was fully flushed and saved - else no point and may not have actualAsSaved hash anyway)
 		if jptm.IsLive() {
 			comparison := md5Comparer{
@@ -288,7 +344,10 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 			err := comparison.Check()
 			if err != nil {
 				jptm.FailActiveDownload("Checking MD5 hash", err)
+			} else if comparison.matched() {
+				jptm.ReportVerified("MD5")
 			}
+			jptm.SetContentMD5(md5OfFileAsWritten)
 		}
 	}
 
@@ -297,7 +356,7 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 
 		// check length if enabled (except for dev null and decompression case, where that's impossible)
 		if jptm.IsLive() && info.DestLengthValidation && info.Destination != common.Dev_Null && !jptm.ShouldDecompress() {
-			fi, err := os.Stat(info.Destination)
+			fi, err := newDownloadDestination(jptm).Stat(info.Destination)
 
 			if err != nil {
 				jptm.FailActiveDownload("Download length check", err)
@@ -305,10 +364,15 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 
 			if fi.Size() != info.SourceSize {
 				jptm.FailActiveDownload("Download length check", errors.New("destination length did not match source length"))
+			} else {
+				jptm.ReportVerified("Length")
 			}
 		}
 	}
 
+	// for auditing, check that the source is still the one that was scanned, now that all of it has been read
+	jptm.FailIfSourceChangedSinceScan()
+
 	// Preserve modified time
 	if jptm.IsLive() {
 		// TODO: the old version of this code did NOT consider it an error to be unable to set the modification date/time
@@ -316,7 +380,7 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 		// TODO: question: But is that correct?
 		lastModifiedTime, preserveLastModifiedTime := jptm.PreserveLastModifiedTime()
 		if preserveLastModifiedTime {
-			err := os.Chtimes(jptm.Info().Destination, lastModifiedTime, lastModifiedTime)
+			err := newDownloadDestination(jptm).Chtimes(jptm.Info().Destination, lastModifiedTime, lastModifiedTime)
 			if err != nil {
 				jptm.LogError(info.Destination, "Changing Modified Time ", err)
 				// do NOT return, since final status and cleanup logging still to come
@@ -324,6 +388,9 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 				jptm.Log(pipeline.LogInfo, fmt.Sprintf(" Preserved Modified Time for %s", info.Destination))
 			}
 		}
+
+		jptm.PreservePosixPropertiesOfDownload()
+		addToDownloadCache(jptm, dl)
 	}
 
 	// note that we do not really know whether the context was canceled because of an error, or because the user asked for it
@@ -337,7 +404,9 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 		if jptm.ShouldLog(pipeline.LogDebug) {
 			jptm.Log(pipeline.LogDebug, " Finalizing Transfer Cancellation/Failure")
 		}
-		if jptm.IsDeadInflight() && jptm.HoldsDestinationLock() {
+		if jptm.IsDeadInflight() && isDiskExport {
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Keeping incomplete disk export, so that the download can be resumed")
+		} else if jptm.IsDeadInflight() && jptm.HoldsDestinationLock() {
 			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Deleting incomplete destination file")
 
 			// the file created locally should be deleted
@@ -353,6 +422,12 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 		// so it must have succeeded. So make sure its not left "in progress" state
 		jptm.SetStatus(common.ETransferStatus.Success())
 
+		if isDiskExport {
+			if err := progressWriter.removeProgress(); err != nil {
+				jptm.LogError(info.Destination, "Removing disk export progress record ", err)
+			}
+		}
+
 		// Final logging
 		if jptm.ShouldLog(pipeline.LogInfo) { // TODO: question: can we remove these ShouldLogs?  Aren't they inside Log?
 			jptm.Log(pipeline.LogInfo, fmt.Sprintf("DOWNLOADSUCCESSFUL: %s", info.Destination))
@@ -395,7 +470,7 @@ func tryDeleteFile(info TransferInfo, jptm IJobPartTransferMgr) {
 		return
 	}
 
-	err := deleteFile(info.Destination)
+	err := newDownloadDestination(jptm).Remove(info.Destination)
 	if err != nil {
 		// If there was an error deleting the file, log the error
 		jptm.LogError(info.Destination, "Delete File Error ", err)
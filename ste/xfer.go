@@ -38,6 +38,18 @@ const UploadTryTimeout = time.Minute * 15
 const UploadRetryDelay = time.Second * 1
 const UploadMaxRetryDelay = time.Second * 60
 
+// DefaultPerRequestTimeout is the default time allowed for a try of a request that carries no data.
+// See XferRetryOptions.PerRequestTimeout
+const DefaultPerRequestTimeout = time.Second * 60
+
+var perRequestTimeout = DefaultPerRequestTimeout
+
+// SetPerRequestTimeout sets the time allowed for a try of a request that carries no data. Zero means
+// every try may take up to the try timeout, whatever its size
+func SetPerRequestTimeout(timeout time.Duration) {
+	perRequestTimeout = timeout
+}
+
 var ADLSFlushThreshold uint32 = 7500 // The # of blocks to flush at a time-- Implemented only for CI.
 
 // download related
@@ -79,7 +91,7 @@ func parameterizeSend(targetFunction newJobXferWithSenderFactory, sf senderFacto
 }
 
 // the xfer factory is generated based on the type of source and destination
-func computeJobXfer(fromTo common.FromTo, blobType common.BlobType) newJobXfer {
+func computeJobXfer(fromTo common.FromTo, blobType common.BlobType, propertiesOnly bool) newJobXfer {
 
 	const blobFSNotS2S = "blobFS not supported as S2S source"
 
@@ -134,6 +146,10 @@ func computeJobXfer(fromTo common.FromTo, blobType common.BlobType) newJobXfer {
 			return newLocalSourceInfoProvider
 		case common.ELocation.Benchmark():
 			return newBenchmarkSourceInfoProvider
+		case common.ELocation.Http():
+			return newHTTPSourceInfoProvider
+		case common.ELocation.Sftp():
+			return newSftpSourceInfoProvider
 		case common.ELocation.Blob():
 			return newBlobSourceInfoProvider
 		case common.ELocation.File():
@@ -153,6 +169,14 @@ func computeJobXfer(fromTo common.FromTo, blobType common.BlobType) newJobXfer {
 		return DeleteBlobPrologue
 	case fromTo == common.EFromTo.FileTrash():
 		return DeleteFilePrologue
+	case fromTo == common.EFromTo.LocalLocal():
+		// a local source is read like a remote one would be downloaded, so the writing side is shared with downloads
+		return parameterizeDownload(remoteToLocal, newLocalFileDownloader)
+	case propertiesOnly:
+		sipf := getSipFactory(fromTo.From())
+		return func(jptm IJobPartTransferMgr, pipeline pipeline.Pipeline, pacer pacer) {
+			propertiesOnlyToBlob(jptm, pipeline, pacer, sipf)
+		}
 	default:
 		if fromTo.IsDownload() {
 			return parameterizeDownload(remoteToLocal, getDownloader(fromTo.From()))
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -47,6 +48,12 @@ type XferRetryOptions struct {
 	// starting point may be something like (60 seconds per MB of anticipated-payload-size).
 	TryTimeout time.Duration
 
+	// PerRequestTimeout, if non-zero, is the time allowed for a try of a request that carries no data, such as
+	// getting properties or committing a block list. A request that carries data, or copies a range from a source,
+	// gets that plus time for its data at minimumTryThroughput, so small requests fail fast, while big blocks
+	// have enough time on slow links. Requests whose size isn't known (e.g. reading a whole blob) get TryTimeout.
+	PerRequestTimeout time.Duration
+
 	// RetryDelay specifies the amount of delay to use before retrying an operation (0=default).
 	// The delay increases (exponentially or linearly) with each retry up to a maximum specified by
 	// MaxRetryDelay. If you specify 0, then you must also specify 0 for MaxRetryDelay.
@@ -61,6 +68,9 @@ type XferRetryOptions struct {
 	// NOTE: Before setting this field, make sure you understand the issues around reading stale & potentially-inconsistent
 	// data at this webpage: https://docs.microsoft.com/en-us/azure/storage/common/storage-designing-ha-apps-with-ragrs
 	RetryReadsFromSecondaryHost string // Comment this our for non-Blob SDKs
+
+	// secondaryReads makes the failover to RetryReadsFromSecondaryHost sticky across the requests of a job (Blob only)
+	secondaryReads *secondaryReadTracker
 }
 
 func (o XferRetryOptions) retryReadsFromSecondaryHost() string {
@@ -109,6 +119,57 @@ func (o XferRetryOptions) defaults() XferRetryOptions {
 	return o
 }
 
+// minimumTryThroughput is the slowest rate, in bytes per second, at which a request's data must move for the try not to time out
+const minimumTryThroughput = 128 * 1024
+
+// tryTimeout returns how long a try of the request may take
+func (o XferRetryOptions) tryTimeout(request *http.Request) time.Duration {
+	if o.PerRequestTimeout == 0 {
+		return o.TryTimeout
+	}
+	size, known := requestDataSize(request)
+	if !known {
+		return o.TryTimeout
+	}
+	return o.PerRequestTimeout + time.Duration(size)*time.Second/minimumTryThroughput
+}
+
+// requestDataSize returns how many bytes the request sends or receives, if that can be told from the request
+func requestDataSize(request *http.Request) (int64, bool) {
+	// the range read from the source, by a copy from URL, or the range read by a download
+	for _, header := range []string{"x-ms-source-range", "x-ms-range", "Range"} {
+		if r := request.Header.Get(header); r != "" {
+			return parseRangeSize(r)
+		}
+	}
+	if request.Header.Get("x-ms-copy-source") != "" {
+		// a synchronous copy of a whole blob, of unknown size
+		return 0, false
+	}
+	if request.Method == http.MethodGet {
+		// reads everything there is, e.g. a whole blob, or a listing
+		return 0, false
+	}
+	return request.ContentLength, request.ContentLength >= 0
+}
+
+// parseRangeSize returns the size of a range header value in the form bytes=start-end
+func parseRangeSize(r string) (int64, bool) {
+	bounds := strings.Split(strings.TrimPrefix(r, "bytes="), "-")
+	if len(bounds) != 2 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(bounds[1], 10, 64) // empty if the range goes to the end
+	if err != nil || end < start {
+		return 0, false
+	}
+	return end - start + 1, true
+}
+
 func (o XferRetryOptions) calcDelay(try int32) time.Duration { // try is >=1; never 0
 	pow := func(number int64, exponent int32) int64 { // pow is nested helper function
 		var result int64 = 1
@@ -145,7 +206,8 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
 		return func(ctx context.Context, request pipeline.Request) (response pipeline.Response, err error) {
 			// Before each try, we'll select either the primary or secondary URL.
-			primaryTry := int32(0) // This indicates how many tries we've attempted against the primary DC
+			primaryTry := int32(0)               // This indicates how many tries we've attempted against the primary DC
+			serverRetryAfter := time.Duration(0) // how long the account asked us to wait after the last try, if it did
 
 			// We only consider retrying against a secondary if we have a read request (GET/HEAD) AND this policy has a Secondary URL it can use
 			considerSecondary := (request.Method == http.MethodGet || request.Method == http.MethodHead) && o.retryReadsFromSecondaryHost() != ""
@@ -159,6 +221,9 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 			//    When retrying against a secondary, ignore the retry count and wait (.1 second * random(0.8, 1.2))
 			for try := int32(1); try <= o.MaxTries; try++ {
 				logf("\n=====> Try=%d\n", try)
+				if try > 1 {
+					releaseRetryBuffer(ctx) // don't hold the body in RAM while we wait to retry
+				}
 
 				// Determine which endpoint to try. It's primary if there is no secondary or if it is an add # attempt.
 				tryingPrimary := !considerSecondary || (try%2 == 1)
@@ -166,6 +231,9 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				if tryingPrimary {
 					primaryTry++
 					delay := o.calcDelay(primaryTry)
+					if serverRetryAfter > 0 {
+						delay = 0 // the account asked us to wait a given time, which the wait for the account, below, takes care of
+					}
 					logf("Primary try=%d, Delay=%v\n", primaryTry, delay)
 					time.Sleep(delay) // The 1st try returns 0 delay
 				} else {
@@ -189,8 +257,15 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					requestCopy.Host = o.retryReadsFromSecondaryHost()
 				}
 
+				// wait for our turn, if the account has been throttling requests, from this transfer or any other
+				if err = sharedAccountThrottleMemory.wait(ctx, requestCopy.URL.Host); err != nil {
+					return nil, err
+				}
+
 				// Set the server-side timeout query parameter "timeout=[seconds]"
-				timeout := int32(o.TryTimeout.Seconds()) // Max seconds per try
+				// Requests that carry little data get less time than those that carry a lot
+				tryTimeLimit := o.tryTimeout(requestCopy.Request)
+				timeout := int32(tryTimeLimit.Seconds()) // Max seconds per try
 				if deadline, ok := ctx.Deadline(); ok {  // If user's ctx has a deadline, make the timeout the smaller of the two
 					t := int32(deadline.Sub(time.Now()).Seconds()) // Duration from now until user's ctx reaches its deadline
 					logf("MaxTryTimeout=%d secs, TimeTilDeadline=%d sec\n", timeout, t)
@@ -211,6 +286,10 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				tryCtx, tryCancel := context.WithTimeout(ctx, time.Second*time.Duration(timeout))
 				//requestCopy.body = &deadlineExceededReadCloser{r: requestCopy.Request.body}
 				response, err = next.Do(tryCtx, requestCopy) // Make the request
+				sharedNetworkDiagnostics.recordError(requestCopy.URL.Scheme, requestCopy.URL.Host, err)
+				if retryAfter := sharedAccountThrottleMemory.recordResponse(requestCopy.URL.Host, response, err); tryingPrimary {
+					serverRetryAfter = retryAfter // what the secondary asks doesn't hold for the primary
+				}
 				/*err = improveDeadlineExceeded(err)
 				if err == nil {
 					response.Response().body = &deadlineExceededReadCloser{r: response.Response().body}
@@ -279,6 +358,7 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					}
 					break // Don't retry
 				}
+				traceRetry(ctx, try, requestCopy.Request, response, err)
 				if response.Response() != nil {
 					// If we're going to retry and we got a previous response, then flush its body to avoid leaking its TCP connection
 					io.Copy(ioutil.Discard, response.Response().Body)
@@ -303,6 +383,22 @@ func withNoRetryForBlob(ctx context.Context) context.Context {
 	//    all our retry policies into one
 }
 
+var retryBufferContextKey = contextKey{"retryBuffer"}
+
+// withRetryBufferRelease returns a context that tells the retry policy that the body of the request is read from the
+// given chunk, so that the chunk's buffer can be freed while the request waits to be retried. The chunk re-reads its
+// data from the source when the retry sends it.
+// Like withNoRetryForBlob, is only implemented for blob (and blobFS) pipelines at present
+func withRetryBufferRelease(ctx context.Context, reader common.SingleChunkReader) context.Context {
+	return context.WithValue(ctx, retryBufferContextKey, reader)
+}
+
+func releaseRetryBuffer(ctx context.Context) {
+	if reader, ok := ctx.Value(retryBufferContextKey).(common.SingleChunkReader); ok {
+		reader.ReleaseBuffer()
+	}
+}
+
 // TODO: Fix the separate retry policies, use Azure blob's retry policy after blob SDK with retry optimization get released.
 // NewBlobXferRetryPolicyFactory creates a RetryPolicyFactory object configured using the specified options.
 func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
@@ -310,10 +406,15 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
 		return func(ctx context.Context, request pipeline.Request) (response pipeline.Response, err error) {
 			// Before each try, we'll select either the primary or secondary URL.
-			primaryTry := int32(0) // This indicates how many tries we've attempted against the primary DC
+			primaryTry := int32(0)               // This indicates how many tries we've attempted against the primary DC
+			serverRetryAfter := time.Duration(0) // how long the account asked us to wait after the last try, if it did
 
 			// We only consider retrying against a secondary if we have a read request (GET/HEAD) AND this policy has a Secondary URL it can use
 			considerSecondary := (request.Method == http.MethodGet || request.Method == http.MethodHead) && o.retryReadsFromSecondaryHost() != ""
+			// If the primary has been failing recently, and the secondary has been serving reads, start with the secondary
+			secondaryFirst := considerSecondary && o.secondaryReads.preferSecondary()
+			// Only a secondary success after the primary failed this very request says anything about the primary
+			primaryFailed := false
 
 			// Exponential retry algorithm: ((2 ^ attempt) - 1) * delay * random(0.8, 1.2)
 			// When to retry: connection failure or temporary/timeout. NOTE: StorageError considers HTTP 500/503 as temporary & is therefore retryable
@@ -328,20 +429,28 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 			}
 			for try := int32(1); try <= maxTries; try++ {
 				logf("\n=====> Try=%d\n", try)
+				if try > 1 {
+					releaseRetryBuffer(ctx) // don't hold the body in RAM while we wait to retry
+				}
 
-				// Determine which endpoint to try. It's primary if there is no secondary or if it is an add # attempt.
-				tryingPrimary := !considerSecondary || (try%2 == 1)
+				// Determine which endpoint to try. It's primary if there is no secondary or if it is an add # attempt (an even one, if the secondary goes first).
+				tryingPrimary := !considerSecondary || ((try%2 == 1) != secondaryFirst)
 				// Select the correct host and delay
 				if tryingPrimary {
 					primaryTry++
 					delay := o.calcDelay(primaryTry)
+					if serverRetryAfter > 0 {
+						delay = 0 // the account asked us to wait a given time, which the wait for the account, below, takes care of
+					}
 					logf("Primary try=%d, Delay=%f s\n", primaryTry, delay.Seconds())
 					time.Sleep(delay) // The 1st try returns 0 delay
 				} else {
 					// For casts and rounding - be careful, as per https://github.com/golang/go/issues/20757
 					delay := time.Duration(float32(time.Second) * (rand.Float32()/2 + 0.8))
 					logf("Secondary try=%d, Delay=%f s\n", try-primaryTry, delay.Seconds())
-					time.Sleep(delay) // Delay with some jitter before trying secondary
+					if try > 1 { // no delay when the secondary is tried first
+						time.Sleep(delay) // Delay with some jitter before trying secondary
+					}
 				}
 
 				// Clone the original request to ensure that each try starts with the original (unmutated) request.
@@ -358,8 +467,15 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					requestCopy.Host = o.retryReadsFromSecondaryHost()
 				}
 
+				// wait for our turn, if the account has been throttling requests, from this transfer or any other
+				if err = sharedAccountThrottleMemory.wait(ctx, requestCopy.URL.Host); err != nil {
+					return nil, err
+				}
+
 				// Set the server-side timeout query parameter "timeout=[seconds]"
-				timeout := int32(o.TryTimeout.Seconds()) // Max seconds per try
+				// Requests that carry little data get less time than those that carry a lot
+				tryTimeLimit := o.tryTimeout(requestCopy.Request)
+				timeout := int32(tryTimeLimit.Seconds()) // Max seconds per try
 				if deadline, ok := ctx.Deadline(); ok {  // If user's ctx has a deadline, make the timeout the smaller of the two
 					t := int32(deadline.Sub(time.Now()).Seconds()) // Duration from now until user's ctx reaches its deadline
 					logf("MaxTryTimeout=%d secs, TimeTilDeadline=%d sec\n", timeout, t)
@@ -380,6 +496,10 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				tryCtx, tryCancel := context.WithTimeout(ctx, time.Second*time.Duration(timeout))
 				//requestCopy.body = &deadlineExceededReadCloser{r: requestCopy.Request.body}
 				response, err = next.Do(tryCtx, requestCopy) // Make the request
+				sharedNetworkDiagnostics.recordError(requestCopy.URL.Scheme, requestCopy.URL.Host, err)
+				if retryAfter := sharedAccountThrottleMemory.recordResponse(requestCopy.URL.Host, response, err); tryingPrimary {
+					serverRetryAfter = retryAfter // what the secondary asks doesn't hold for the primary
+				}
 				/*err = improveDeadlineExceeded(err)
 				if err == nil {
 					response.Response().body = &deadlineExceededReadCloser{r: response.Response().body}
@@ -390,6 +510,9 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				switch {
 				case err == nil:
 					action = "NoRetry: successful HTTP request" // no error
+					if !tryingPrimary && primaryFailed {
+						o.secondaryReads.recordSecondarySuccess(o.retryReadsFromSecondaryHost())
+					}
 
 				case !tryingPrimary && response != nil && response.Response() != nil && response.Response().StatusCode == http.StatusNotFound:
 					// If attempt was against the secondary & it returned a StatusNotFound (404), then
@@ -430,6 +553,9 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				}
 
 				logf("Action=%s\n", action)
+				if tryingPrimary && action[0] == 'R' {
+					primaryFailed = true
+				}
 				if action[0] != 'R' { // Retry only if action starts with 'R'
 					if err != nil {
 						tryCancel() // If we're returning an error, cancel this current/last per-retry timeout context
@@ -449,6 +575,7 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					}
 					break // Don't retry
 				}
+				traceRetry(ctx, try, requestCopy.Request, response, err)
 				if response.Response() != nil {
 					// If we're going to retry and we got a previous response, then flush its body to avoid leaking its TCP connection
 					io.Copy(ioutil.Discard, response.Response().Body)
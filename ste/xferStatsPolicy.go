@@ -27,6 +27,7 @@ import (
 	"github.com/Azure/azure-storage-azcopy/common"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -39,13 +40,21 @@ type pipelineNetworkStats struct {
 	atomic503CountIOPS         int64
 	atomic503CountUnknown      int64 // counts 503's when we don't know the reason
 	atomicE2ETotalMilliseconds int64 // should this be nanoseconds?  Not really needed, given typical minimum operation lengths that we observe
+	atomicSmallOpCount         int64 // operations that send little or no data, so their duration is mostly latency
+	atomicSmallOpMilliseconds  int64
 	atomicStartSeconds         int64
+	atomicNewConnCount         int64 // connections used by requests, that were opened for them
+	atomicReusedConnCount      int64 // connections used by requests, that had been used before
+	atomicDroppedIdleConnCount int64 // idle connections that failed when reused, which suggests that something between us and the server dropped them
 	nocopy                     common.NoCopy
 	tunerInterface             ConcurrencyTuner
+	writeBackPressure          *writeLatencyBackPressure // only limits anything once enabled
+	accountCapacity            *accountCapacityPacer     // only limits anything once enabled
+	bandwidth                  *bandwidthMeter           // only records or limits anything once enabled
 }
 
-func newPipelineNetworkStats(tunerInterface ConcurrencyTuner) *pipelineNetworkStats {
-	s := &pipelineNetworkStats{tunerInterface: tunerInterface}
+func newPipelineNetworkStats(tunerInterface ConcurrencyTuner, appPacer pacer) *pipelineNetworkStats {
+	s := &pipelineNetworkStats{tunerInterface: tunerInterface, writeBackPressure: newWriteLatencyBackPressure(), accountCapacity: newAccountCapacityPacer(appPacer), bandwidth: newBandwidthMeter()}
 	tunerWillCallUs := tunerInterface.RequestCallbackWhenStable(s.start) // we want to start gather stats after the tuner has reached a stable value. No point in gathering them earlier
 	if !tunerWillCallUs {
 		// assume tuner is inactive, and start ourselves now
@@ -68,7 +77,7 @@ func (s *pipelineNetworkStats) IsStarted() bool {
 }
 
 func (s *pipelineNetworkStats) recordRetry(responseBody string) {
-	if strings.Contains(responseBody, "gress is over the account limit") { // maybe Ingress or Egress
+	if isAccountThroughputLimit(responseBody) {
 		atomic.AddInt64(&s.atomic503CountThroughput, 1)
 	} else if strings.Contains(responseBody, "Operations per second is over the account limit") {
 		atomic.AddInt64(&s.atomic503CountIOPS, 1)
@@ -77,6 +86,10 @@ func (s *pipelineNetworkStats) recordRetry(responseBody string) {
 	}
 }
 
+func isAccountThroughputLimit(responseBody string) bool {
+	return strings.Contains(responseBody, "gress is over the account limit") // maybe Ingress or Egress
+}
+
 func (s *pipelineNetworkStats) OperationsPerSecond() int {
 	s.nocopy.Check()
 	if !s.IsStarted() {
@@ -149,6 +162,61 @@ func (s *pipelineNetworkStats) OtherServerBusyPercentage() float32 {
 	}
 }
 
+// ConnectionReusePercentage is the share of requests that were sent on connections that had been used before
+func (s *pipelineNetworkStats) ConnectionReusePercentage() float32 {
+	s.nocopy.Check()
+	reused := atomic.LoadInt64(&s.atomicReusedConnCount)
+	total := reused + atomic.LoadInt64(&s.atomicNewConnCount)
+	if total > 0 {
+		return 100 * float32(reused) / float32(total)
+	} else {
+		return 0
+	}
+}
+
+func (s *pipelineNetworkStats) DroppedIdleConnections() int64 {
+	s.nocopy.Check()
+	return atomic.LoadInt64(&s.atomicDroppedIdleConnCount)
+}
+
+// DroppedIdleConnectionPercentage is the share of reused connections that turned out to have been dropped while they were idle
+func (s *pipelineNetworkStats) DroppedIdleConnectionPercentage() float32 {
+	s.nocopy.Check()
+	reused := float32(atomic.LoadInt64(&s.atomicReusedConnCount))
+	if reused > 0 {
+		return 100 * float32(atomic.LoadInt64(&s.atomicDroppedIdleConnCount)) / reused
+	} else {
+		return 0
+	}
+}
+
+// traceConnections counts the connections that the request is sent on. When a reused connection turns out to be dead,
+// the HTTP client may retry the request on another connection by itself, so a request can get more than one.
+// The function it returns says whether the last connection was a reused one that failed before the server answered on it,
+// since a connection that was dropped while it was idle fails then, rather than part way through the response
+func (s *pipelineNetworkStats) traceConnections(ctx context.Context) (tracedCtx context.Context, lastConnFailedBeforeResponse func() bool) {
+	lastReused := int32(0)
+	gotFirstResponseByte := int32(0)
+	tracedCtx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if atomic.SwapInt32(&lastReused, 0) == 1 && atomic.LoadInt32(&gotFirstResponseByte) == 0 {
+				atomic.AddInt64(&s.atomicDroppedIdleConnCount, 1) // the previous connection failed, since we've got another one
+			}
+			atomic.StoreInt32(&gotFirstResponseByte, 0)
+			if info.Reused {
+				atomic.AddInt64(&s.atomicReusedConnCount, 1)
+				atomic.StoreInt32(&lastReused, 1)
+			} else {
+				atomic.AddInt64(&s.atomicNewConnCount, 1)
+			}
+		},
+		GotFirstResponseByte: func() {
+			atomic.StoreInt32(&gotFirstResponseByte, 1)
+		},
+	})
+	return tracedCtx, func() bool { return atomic.LoadInt32(&lastReused) == 1 && atomic.LoadInt32(&gotFirstResponseByte) == 0 }
+}
+
 func (s *pipelineNetworkStats) AverageE2EMilliseconds() int {
 	s.nocopy.Check()
 	ops := atomic.LoadInt64(&s.atomicOperationCount)
@@ -159,6 +227,21 @@ func (s *pipelineNetworkStats) AverageE2EMilliseconds() int {
 	}
 }
 
+// AverageLatencyMilliseconds estimates the latency of each request, from the operations that send little or no data
+// (which includes downloads, since their durations here are only until the response headers arrive)
+func (s *pipelineNetworkStats) AverageLatencyMilliseconds() int {
+	s.nocopy.Check()
+	ops := atomic.LoadInt64(&s.atomicSmallOpCount)
+	if ops > 0 {
+		return int(atomic.LoadInt64(&s.atomicSmallOpMilliseconds) / ops)
+	} else {
+		return 0
+	}
+}
+
+// requests that send no more than this are counted as small operations
+const smallOpMaxRequestBytes = 64 * 1024
+
 type xferStatsPolicy struct {
 	next  pipeline.Policy
 	stats *pipelineNetworkStats
@@ -166,18 +249,42 @@ type xferStatsPolicy struct {
 
 // Do accumulates stats for each call
 func (p *xferStatsPolicy) Do(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+	// hold back writes to destinations that are responding slowly
+	if p.stats != nil && p.stats.writeBackPressure.appliesTo(request) {
+		release, err := p.stats.writeBackPressure.acquire(ctx, request.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		defer func() { release(time.Since(start)) }()
+	}
+
 	start := time.Now()
 
+	reusedConnFailedBeforeResponse := func() bool { return false }
+	if p.stats != nil && p.stats.IsStarted() {
+		ctx, reusedConnFailedBeforeResponse = p.stats.traceConnections(ctx)
+	}
+
 	resp, err := p.next.Do(ctx, request)
+	recordRequestID(ctx, resp)
 
 	if p.stats != nil {
 		if p.stats.IsStarted() {
 			atomic.AddInt64(&p.stats.atomicOperationCount, 1)
 			atomic.AddInt64(&p.stats.atomicE2ETotalMilliseconds, int64(time.Since(start).Seconds()*1000))
+			if err == nil && request.ContentLength <= smallOpMaxRequestBytes {
+				atomic.AddInt64(&p.stats.atomicSmallOpCount, 1)
+				atomic.AddInt64(&p.stats.atomicSmallOpMilliseconds, int64(time.Since(start).Seconds()*1000))
+			}
 
 			if err != nil && !isContextCancelledError(err) {
 				// no response from server
 				atomic.AddInt64(&p.stats.atomicNetworkErrorCount, 1)
+				// a failure after the server started answering, such as a timeout reading the body, isn't the connection having been dropped while idle
+				if reusedConnFailedBeforeResponse() {
+					atomic.AddInt64(&p.stats.atomicDroppedIdleConnCount, 1)
+				}
 			}
 		}
 
@@ -186,13 +293,22 @@ func (p *xferStatsPolicy) Do(ctx context.Context, request pipeline.Request) (pip
 			// TODO should we also count status 500?  It is mentioned here as timeout:https://docs.microsoft.com/en-us/azure/storage/common/storage-scalability-targets
 			if rr := resp.Response(); rr != nil && rr.StatusCode == http.StatusServiceUnavailable {
 				p.stats.tunerInterface.recordRetry() // always tell the tuner
-				if p.stats.IsStarted() {             // but only count it here, if we have started
+				if p.stats.IsStarted() || p.stats.accountCapacity.isEnabled() {
 					// To find out why the server was busy we need to look at the response
 					responseBodyText := transparentlyReadBody(rr)
-					p.stats.recordRetry(responseBodyText)
+					if isAccountThroughputLimit(responseBodyText) {
+						p.stats.accountCapacity.recordLimitSignal()
+						p.stats.tunerInterface.recordAccountLimit() // the adaptive tuner reports this as its reason for backing off
+					}
+					if p.stats.IsStarted() { // but only count it here, if we have started
+						p.stats.recordRetry(responseBodyText)
+					}
 				}
 			}
 		}
+
+		// count what went over the network, for the bandwidth usage of the job and the machine
+		p.stats.bandwidth.recordRequest(request, resp)
 	}
 
 	return resp, err
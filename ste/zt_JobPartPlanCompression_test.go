@@ -0,0 +1,221 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type planCompressionSuite struct{}
+
+var _ = chk.Suite(&planCompressionSuite{})
+
+func (s *planCompressionSuite) TestSourcesAreNotStoredTwice(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planCompression")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	previous := JobsAdmin
+	JobsAdmin = &jobsAdmin{planDir: dir, concurrency: NewConcurrencySettings(1000, false)}
+	defer func() { JobsAdmin = previous }()
+
+	order := common.CopyJobPartOrderRequest{
+		JobID:           common.NewJobID(),
+		SourceRoot:      "/src",
+		DestinationRoot: "/dst",
+		CommandString:   "copy /src /dst --recursive",
+		Transfers: []common.CopyTransfer{
+			{Source: "/dir/a.txt", Destination: "/dir/a.txt", VersionID: "v1", ETag: "e1"},
+			{Source: "/b.txt", Destination: "/renamed.txt", ETag: "e2"},
+			{Source: "/c.txt", Destination: "/src/c.txt"},
+		},
+	}
+	name := JobPartPlanFileName(fmt.Sprintf(jobPartPlanFileNameFormat, order.JobID.String(), 0, DataSchemaVersion))
+	name.Create(order)
+
+	info, err := os.Stat(filepath.Join(dir, string(name)))
+	c.Assert(err, chk.IsNil)
+	expectedStrings := len("/dir/a.txt") + len("v1e1") + len("/b.txt/renamed.txt") + len("e2") + len("/c.txt/src")
+	c.Assert(info.Size(), chk.Equals, int64(unsafe.Sizeof(JobPartPlanHeader{}))+int64(len(order.CommandString))+
+		3*int64(unsafe.Sizeof(JobPartPlanTransfer{}))+int64(expectedStrings))
+
+	mmf := name.Map()
+	defer mmf.Unmap()
+	plan := mmf.Plan()
+	c.Assert(plan.Transfer(0).DstLength, chk.Equals, dstLengthOfPrefix(""))
+	src, dst := plan.TransferSrcDstStrings(0)
+	c.Assert(src, chk.Equals, "/src/dir/a.txt")
+	c.Assert(dst, chk.Equals, "/dst/dir/a.txt")
+	c.Assert(plan.TransferSrcVersionID(0), chk.Equals, "v1")
+	c.Assert(plan.TransferSrcETag(0), chk.Equals, "e1")
+	src, dst = plan.TransferSrcDstStrings(1)
+	c.Assert(src, chk.Equals, "/src/b.txt")
+	c.Assert(dst, chk.Equals, "/dst/renamed.txt")
+	c.Assert(plan.TransferSrcETag(1), chk.Equals, "e2")
+	src, dst = plan.TransferSrcDstStrings(2)
+	c.Assert(src, chk.Equals, "/src/c.txt")
+	c.Assert(dst, chk.Equals, "/dst/src/c.txt")
+}
+
+// writePlan writes a plan file of this version for the given part of a job, last modified at modTime
+func (s *planCompressionSuite) writePlan(c *chk.C, dir string, jobID common.JobID, partNum int, status common.JobStatus, modTime time.Time) string {
+	const commandString = "copy /src /dst --recursive"
+	h := (&planMigrationSuite{}).currentHeader(commandString)
+	h.JobID = jobID
+	h.atomicJobStatus = status
+	plan := planForTest((*[unsafe.Sizeof(JobPartPlanHeader{})]byte)(unsafe.Pointer(&h))[:], commandString)
+
+	path := filepath.Join(dir, fmt.Sprintf(jobPartPlanFileNameFormat, jobID.String(), partNum, DataSchemaVersion))
+	c.Assert(ioutil.WriteFile(path, plan, 0644), chk.IsNil)
+	c.Assert(os.Chtimes(path, modTime, modTime), chk.IsNil)
+	return path
+}
+
+func (s *planCompressionSuite) TestFinishedPlansAreCompressedAndReadBack(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planCompression")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	longAgo := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	finished := common.NewJobID()
+	part0 := s.writePlan(c, dir, finished, 0, common.EJobStatus.CompletedWithErrors(), longAgo)
+	part1 := s.writePlan(c, dir, finished, 1, common.EJobStatus.InProgress(), longAgo) // only part 0 holds the status of the job
+	original, err := ioutil.ReadFile(part0)
+	c.Assert(err, chk.IsNil)
+	inProgress := s.writePlan(c, dir, common.NewJobID(), 0, common.EJobStatus.InProgress(), longAgo)
+	justFinished := s.writePlan(c, dir, common.NewJobID(), 0, common.EJobStatus.Completed(), time.Now())
+
+	compressed, saved, err := CompressFinishedPlanFiles(dir, time.Hour)
+	c.Assert(err, chk.IsNil)
+	c.Assert(compressed, chk.Equals, 2)
+	c.Assert(saved > 0, chk.Equals, true)
+	for _, path := range []string{part0, part1} {
+		_, err = os.Stat(path)
+		c.Assert(os.IsNotExist(err), chk.Equals, true)
+		info, err := os.Stat(path + compressedPlanFileExtension)
+		c.Assert(err, chk.IsNil)
+		c.Assert(info.ModTime().Equal(longAgo), chk.Equals, true)
+	}
+	for _, path := range []string{inProgress, justFinished} {
+		_, err = os.Stat(path)
+		c.Assert(err, chk.IsNil)
+	}
+
+	// the compressed plans are still listed, under their own names, and can be read
+	files, err := listCurrentPlanFiles(dir, finished.String())
+	c.Assert(err, chk.IsNil)
+	c.Assert(files, chk.HasLen, 2)
+	c.Assert(files[0].Name(), chk.Equals, filepath.Base(part0))
+	inspection, err := InspectPlanFile(part0 + compressedPlanFileExtension)
+	c.Assert(err, chk.IsNil)
+	c.Assert(*inspection.JobStatus, chk.Equals, common.EJobStatus.CompletedWithErrors())
+	mmf, err := mapCompressedPlanFile(part0)
+	c.Assert(err, chk.IsNil)
+	_, dst := mmf.Plan().TransferSrcDstStrings(1)
+	c.Assert(dst, chk.Equals, "/dst/dst/dir/b.txt")
+	mmf.Unmap()
+
+	// and are expanded back to what they were, when the job is resurrected
+	c.Assert(expandPlanFiles(dir, finished.String()), chk.HasLen, 0)
+	expanded, err := ioutil.ReadFile(part0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(expanded, chk.DeepEquals, original)
+	_, err = os.Stat(part1)
+	c.Assert(err, chk.IsNil)
+	all, err := ioutil.ReadDir(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(all, chk.HasLen, 4)
+}
+
+func (s *planCompressionSuite) TestListJobsReadsOnlyPart0(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planCompression")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	previous := JobsAdmin
+	JobsAdmin = &jobsAdmin{planDir: dir, jobIDToJobMgr: newJobIDToJobMgr(), concurrency: NewConcurrencySettings(1000, false)}
+	defer func() { JobsAdmin = previous }()
+
+	order := common.CopyJobPartOrderRequest{
+		JobID:           common.NewJobID(),
+		SourceRoot:      "/src",
+		DestinationRoot: "/dst",
+		CommandString:   "copy /src /dst --recursive",
+		Transfers: []common.CopyTransfer{
+			{Source: "/a.txt", Destination: "/a.txt", SourceSize: 10},
+			{Source: "/b.txt", Destination: "/b.txt", SourceSize: 20},
+		},
+	}
+	name := JobPartPlanFileName(fmt.Sprintf(jobPartPlanFileNameFormat, order.JobID.String(), 0, DataSchemaVersion))
+	name.Create(order)
+	mmf := name.Map()
+	mmf.Plan().addJobTotalBytes(5) // as if a second part had been ordered
+	mmf.Plan().addJobBytesTransferred(10)
+	mmf.Unmap()
+
+	// the other parts aren't even looked at, so it doesn't matter that this one is unreadable
+	part1 := filepath.Join(dir, fmt.Sprintf(jobPartPlanFileNameFormat, order.JobID.String(), 1, DataSchemaVersion))
+	c.Assert(ioutil.WriteFile(part1, []byte("not a plan"), 0644), chk.IsNil)
+
+	jobs := ListJobs()
+	c.Assert(jobs.ErrorMessage, chk.Equals, "")
+	c.Assert(jobs.JobIDDetails, chk.HasLen, 1)
+	c.Assert(jobs.JobIDDetails[0].JobId, chk.Equals, order.JobID)
+	c.Assert(jobs.JobIDDetails[0].TotalBytes, chk.Equals, uint64(35))
+	c.Assert(jobs.JobIDDetails[0].BytesTransferred, chk.Equals, uint64(10))
+	c.Assert(jobs.JobIDDetails[0].Source, chk.Equals, "/src")
+}
+
+func (s *planCompressionSuite) TestSASMintedFromLoginIsRecordedButNotKept(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planCompression")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	previous := JobsAdmin
+	JobsAdmin = &jobsAdmin{planDir: dir, concurrency: NewConcurrencySettings(1000, false)}
+	defer func() { JobsAdmin = previous }()
+
+	order := common.CopyJobPartOrderRequest{
+		JobID:              common.NewJobID(),
+		FromTo:             common.EFromTo.BlobBlob(),
+		SourceRoot:         "https://src.blob.core.windows.net/container",
+		DestinationRoot:    "https://dst.blob.core.windows.net/container",
+		SourceSAS:          "sv=2020-02-10&skoid=login&sig=secret",
+		SourceSASFromLogin: true,
+		Transfers:          []common.CopyTransfer{{Source: "/a.txt", Destination: "/a.txt"}},
+	}
+	name := JobPartPlanFileName(fmt.Sprintf(jobPartPlanFileNameFormat, order.JobID.String(), 0, DataSchemaVersion))
+	name.Create(order)
+
+	// resuming the job mints a new SAS, since the one that was minted isn't saved
+	mmf := name.Map()
+	defer mmf.Unmap()
+	c.Assert(mmf.Plan().SourceSASFromLogin, chk.Equals, true)
+	content, err := ioutil.ReadFile(filepath.Join(dir, string(name)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Contains(string(content), "secret"), chk.Equals, false)
+}
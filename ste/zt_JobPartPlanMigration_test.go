@@ -0,0 +1,229 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type planMigrationSuite struct{}
+
+var _ = chk.Suite(&planMigrationSuite{})
+
+// the plan files of a paused job of two parts, written by version 10 (the last released version before 11)
+const planV10JobID = "7e7d3a1c-6b5f-4a4e-9c4d-2f9b1f6a8d10"
+
+var planV10Files = []string{planV10JobID + "--00000.steV10", planV10JobID + "--00001.steV10"}
+
+// copyPlanV10Files copies the plan files of version 10 from testdata into dir
+func copyPlanV10Files(c *chk.C, dir string) {
+	for _, name := range planV10Files {
+		plan, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		c.Assert(err, chk.IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), plan, 0644), chk.IsNil)
+	}
+}
+
+var planMigrationTransfers = [][2]string{{"/src/a.txt", "/dst/a.txt"}, {"/src/dir/b.txt", "/dst/dir/b.txt"}}
+
+// planForTest lays out a plan file with the given header, the way JobPartPlanFileName.Create does
+func planForTest(header []byte, commandString string) []byte {
+	plan := append([]byte{}, header...)
+	plan = append(plan, commandString...)
+
+	stringsOffset := int64(len(plan)) + int64(unsafe.Sizeof(JobPartPlanTransfer{}))*int64(len(planMigrationTransfers))
+	for _, x := range planMigrationTransfers {
+		t := JobPartPlanTransfer{SrcOffset: stringsOffset, SrcLength: int16(len(x[0])), DstLength: int16(len(x[1])), SourceSize: 42}
+		plan = append(plan, (*[unsafe.Sizeof(JobPartPlanTransfer{})]byte)(unsafe.Pointer(&t))[:]...)
+		stringsOffset += int64(len(x[0]) + len(x[1]))
+	}
+	for _, x := range planMigrationTransfers {
+		plan = append(plan, x[0]+x[1]...)
+	}
+	return plan
+}
+
+func (s *planMigrationSuite) currentHeader(commandString string) JobPartPlanHeader {
+	h := JobPartPlanHeader{
+		Version:               DataSchemaVersion,
+		JobID:                 common.NewJobID(),
+		PartNum:               3,
+		SourceRootLength:      4,
+		DestinationRootLength: 4,
+		CommandStringLength:   uint32(len(commandString)),
+		NumTransfers:          uint32(len(planMigrationTransfers)),
+		JobLabelsLength:       9,
+		atomicJobStatus:       common.EJobStatus.Paused(),
+		DeleteSnapshotsOption: common.EDeleteSnapshotsOption.Include(),
+	}
+	copy(h.SourceRoot[:], "/src")
+	copy(h.DestinationRoot[:], "/dst")
+	copy(h.JobLabels[:], `{"a":"b"}`)
+	return h
+}
+
+func (s *planMigrationSuite) TestV10PlanFilesAreMigrated(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planMigration")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	copyPlanV10Files(c, dir)
+
+	jobID, err := common.ParseJobID(planV10JobID)
+	c.Assert(err, chk.IsNil)
+	migrated, errs := migratePlanFiles(dir, "")
+	c.Assert(errs, chk.HasLen, 0)
+	c.Assert(migrated, chk.DeepEquals, map[common.JobID]common.Version{jobID: 10})
+	for _, name := range planV10Files {
+		_, err = os.Stat(filepath.Join(dir, name))
+		c.Assert(os.IsNotExist(err), chk.Equals, true)
+	}
+
+	lmt := time.Date(2020, 5, 4, 3, 2, 1, 0, time.UTC)
+	names := []string{"/a.txt", "/dir/b.bin", "/dir/sub/c.json"}
+	for partNum := 0; partNum < 2; partNum++ {
+		plan, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%s--%05d.steV%d", planV10JobID, partNum, DataSchemaVersion)))
+		c.Assert(err, chk.IsNil)
+		h := (*JobPartPlanHeader)(unsafe.Pointer(&plan[0]))
+
+		// the header reads back like one written by this version
+		c.Assert(h.Version, chk.Equals, DataSchemaVersion)
+		c.Assert(h.JobID, chk.Equals, jobID)
+		c.Assert(h.PartNum, chk.Equals, common.PartNumber(partNum))
+		c.Assert(h.IsFinalPart, chk.Equals, partNum == 1)
+		c.Assert(h.FromTo, chk.Equals, common.EFromTo.BlobBlob())
+		c.Assert(h.LogLevel, chk.Equals, common.ELogLevel.Info())
+		c.Assert(h.CommandString(), chk.Equals, "copy https://src.blob.core.windows.net/container https://dst.blob.core.windows.net/container --recursive")
+		c.Assert(h.JobStatus(), chk.Equals, common.EJobStatus.Paused())
+		c.Assert(h.NumTransfers, chk.Equals, uint32(3))
+		c.Assert(h.DstBlobData.BlobType, chk.Equals, common.EBlobType.BlockBlob())
+		c.Assert(string(h.DstBlobData.ContentType[:h.DstBlobData.ContentTypeLength]), chk.Equals, "text/plain")
+		c.Assert(h.DstBlobData.BlockBlobTier, chk.Equals, common.EBlockBlobTier.Cool())
+		c.Assert(h.DstBlobData.PutMd5, chk.Equals, true)
+		c.Assert(string(h.DstBlobData.Metadata[:h.DstBlobData.MetadataLength]), chk.Equals, "k=v")
+		c.Assert(h.DstBlobData.BlockSize, chk.Equals, uint32(8*1024*1024))
+		c.Assert(h.DstBlobData.ConvertToVHD, chk.Equals, false)
+		c.Assert(h.S2SSourceChangeValidation, chk.Equals, true)
+		c.Assert(h.DestLengthValidation, chk.Equals, true)
+		c.Assert(h.S2SInvalidMetadataHandleOption, chk.Equals, common.EInvalidMetadataHandleOption.RenameIfInvalid())
+		c.Assert(h.Labels(), chk.HasLen, 0)
+		c.Assert(h.EffectiveConcurrency(), chk.HasLen, 0)
+		c.Assert(h.ContentPolicy().IsEmpty(), chk.Equals, true)
+		c.Assert(h.DailyCapBytes, chk.Equals, uint64(0))
+
+		// and so do the transfers
+		for i, name := range names {
+			t := h.Transfer(uint32(i))
+			src, dst := h.TransferSrcDstStrings(uint32(i))
+			c.Assert(src, chk.Equals, "https://src.blob.core.windows.net/container"+name)
+			c.Assert(dst, chk.Equals, "https://dst.blob.core.windows.net/container"+name)
+			c.Assert(t.ModifiedTime, chk.Equals, lmt.Add(time.Duration(partNum*3+i)*time.Second).UnixNano())
+			c.Assert(t.SourceSize, chk.Equals, int64(1000*(partNum*3+i)+1))
+
+			props, metadata, blobType, blobTier, _, _, _, _ := h.TransferSrcPropertiesAndMetadata(uint32(i))
+			c.Assert(props.ContentType, chk.Equals, "application/x-"+name[1:2])
+			c.Assert(props.ContentEncoding, chk.Equals, "gzip")
+			c.Assert(string(props.ContentMD5), chk.Equals, "0123456789abcdef")
+			c.Assert(metadata, chk.DeepEquals, common.Metadata{"owner": fmt.Sprintf("part%d", partNum)})
+			c.Assert(blobType, chk.Equals, azblob.BlobBlockBlob)
+			c.Assert(blobTier, chk.Equals, azblob.AccessTierHot)
+			c.Assert(h.TransferSrcVersionID(uint32(i)), chk.Equals, "")
+			c.Assert(h.TransferSrcETag(uint32(i)), chk.Equals, "")
+		}
+		c.Assert(h.Transfer(0).TransferStatus(), chk.Equals, common.ETransferStatus.Success())
+		c.Assert(h.Transfer(1).TransferStatus(), chk.Equals, common.ETransferStatus.Failed())
+		c.Assert(h.Transfer(1).ErrorCode(), chk.Equals, int32(409))
+		c.Assert(h.Transfer(2).TransferStatus(), chk.Equals, common.ETransferStatus.Started())
+	}
+}
+
+func (s *planMigrationSuite) TestMigrationWorksOutTheTotalsOfTheJob(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planMigration")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	copyPlanV10Files(c, dir)
+
+	_, errs := migratePlanFiles(dir, "")
+	c.Assert(errs, chk.HasLen, 0)
+
+	// the sizes of the transfers are 1, 1001 and 2001 in part 0, and 3001, 4001 and 5001 in part 1; the first of each has succeeded
+	for partNum, expected := range map[int][2]uint64{0: {15006, 3002}, 1: {0, 0}} {
+		plan, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%s--%05d.steV%d", planV10JobID, partNum, DataSchemaVersion)))
+		c.Assert(err, chk.IsNil)
+		h := (*JobPartPlanHeader)(unsafe.Pointer(&plan[0]))
+		c.Assert(h.JobTotalBytes(), chk.Equals, expected[0])
+		c.Assert(h.JobBytesTransferred(), chk.Equals, expected[1])
+	}
+}
+
+func (s *planMigrationSuite) TestConcurrencyIsRecorded(c *chk.C) {
+	h := JobPartPlanHeader{}
+	settings := []common.ConcurrencySetting{
+		{Name: "Max concurrent network operations", Value: "64", Source: "Based on --concurrency-value command-line flag"},
+		{Name: "Max open files when downloading", Value: "1000", Source: "auto-computed"},
+	}
+	h.setEffectiveConcurrency(settings)
+	c.Assert(h.EffectiveConcurrency(), chk.DeepEquals, settings)
+
+	// sources that are too long to fit are left out
+	settings[0].Source = strings.Repeat("x", ConcurrencyMaxBytes)
+	h.setEffectiveConcurrency(settings)
+	c.Assert(h.EffectiveConcurrency(), chk.DeepEquals, []common.ConcurrencySetting{
+		{Name: "Max concurrent network operations", Value: "64"},
+		{Name: "Max open files when downloading", Value: "1000"},
+	})
+}
+
+func (s *planMigrationSuite) TestPlanFilesThatCannotBeMigratedAreLeftAlone(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planMigration")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	// too old to migrate
+	tooOld := common.NewJobID().String() + "--00000.steV9"
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, tooOld), make([]byte, 100), 0644), chk.IsNil)
+
+	// already migrated
+	jobID := common.NewJobID()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, jobID.String()+"--00000.steV10"), make([]byte, 100), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, jobID.String()+"--00000.steV11"), make([]byte, 100), 0644), chk.IsNil)
+
+	// truncated
+	truncated := common.NewJobID().String() + "--00000.steV10"
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, truncated), make([]byte, 100), 0644), chk.IsNil)
+
+	migrated, errs := migratePlanFiles(dir, "")
+	c.Assert(migrated, chk.HasLen, 0)
+	c.Assert(errs, chk.HasLen, 2)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(files, chk.HasLen, 4) // nothing added or removed
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type accountCapacityPacerSuite struct{}
+
+var _ = chk.Suite(&accountCapacityPacerSuite{})
+
+func newTestAccountCapacityPacer(fraction float64) *accountCapacityPacer {
+	a := newAccountCapacityPacer(newNullAutoPacer())
+	a.fraction = fraction
+	a.logger = nullTestLogger{}
+	a.limiter = newTokenBucketPacer(a.targetBytesPerSecond(), 0)
+	return a
+}
+
+func (s *accountCapacityPacerSuite) TestUnlimitedUntilAccountIsOverItsLimit(c *chk.C) {
+	a := newTestAccountCapacityPacer(0.5)
+	defer a.limiter.Close()
+	now := time.Now()
+
+	a.adjust(100*1000*1000, false, now)
+	c.Assert(a.limiter.targetBytesPerSecond(), chk.Equals, int64(maxPacerBytesPerSecond))
+
+	// the account says it's over its limit, while we are getting 100 MB/s (averaged over the window) through
+	a.adjust(100*1000*1000, true, now.Add(time.Second))
+	c.Assert(a.estimatedLimitBytesPerSecond, chk.Equals, float64(100*1000*1000))
+	c.Assert(a.limiter.targetBytesPerSecond(), chk.Equals, int64(50*1000*1000))
+}
+
+func (s *accountCapacityPacerSuite) TestDeadBandAndRecovery(c *chk.C) {
+	a := newTestAccountCapacityPacer(0.5)
+	defer a.limiter.Close()
+	now := time.Now()
+
+	a.adjust(80*1000*1000, true, now)
+	c.Assert(a.limiter.targetBytesPerSecond(), chk.Equals, int64(40*1000*1000))
+
+	// 503s that were in flight don't lower the estimate again straight away
+	a.adjust(40*1000*1000, true, now.Add(time.Second))
+	c.Assert(a.estimatedLimitBytesPerSecond, chk.Equals, float64(80*1000*1000))
+
+	// while the account is happy, the estimate is held for a while, and then creeps back up
+	a.adjust(40*1000*1000, false, now.Add(2*time.Second))
+	c.Assert(a.estimatedLimitBytesPerSecond, chk.Equals, float64(80*1000*1000))
+	a.adjust(40*1000*1000, false, now.Add(accountCapacityHoldDuration))
+	c.Assert(a.estimatedLimitBytesPerSecond > 80*1000*1000, chk.Equals, true)
+	c.Assert(a.limiter.targetBytesPerSecond() > 40*1000*1000, chk.Equals, true)
+
+	// and once out of the dead band, being over the limit again brings it down, but only part of the way to the average of the window
+	a.adjust(40*1000*1000, true, now.Add(accountCapacityHoldDuration+deadBandDuration))
+	average := (80.0 + 40 + 40 + 40 + 40) / 5 * 1000 * 1000
+	c.Assert(a.estimatedLimitBytesPerSecond < 80*1000*1000, chk.Equals, true)
+	c.Assert(a.estimatedLimitBytesPerSecond > average, chk.Equals, true)
+}
+
+func (s *accountCapacityPacerSuite) TestTuningStopsWhenTheJobEnds(c *chk.C) {
+	a := newAccountCapacityPacer(newNullAutoPacer())
+	a.enable(0.5, nullTestLogger{})
+	c.Assert(a.isEnabled(), chk.Equals, true)
+	done := a.done
+
+	c.Assert(a.Close(), chk.IsNil)
+	c.Assert(a.isEnabled(), chk.Equals, false)
+	select {
+	case <-done:
+	default:
+		c.Fatal("the tuner was not told to stop")
+	}
+
+	// a job that's resumed is held to the limit again
+	a.enable(0.5, nullTestLogger{})
+	c.Assert(a.isEnabled(), chk.Equals, true)
+	c.Assert(a.done, chk.Not(chk.Equals), done)
+	c.Assert(a.Close(), chk.IsNil)
+}
+
+func (s *accountCapacityPacerSuite) TestKnownLimitIsNeverExceeded(c *chk.C) {
+	a := newTestAccountCapacityPacer(0.25)
+	defer a.limiter.Close()
+	a.knownLimitBytesPerSecond = 100 * 1000 * 1000
+	a.estimatedLimitBytesPerSecond = a.knownLimitBytesPerSecond
+	now := time.Now()
+
+	a.adjust(10*1000*1000, false, now)
+	c.Assert(a.limiter.targetBytesPerSecond(), chk.Equals, int64(25*1000*1000))
+
+	a.adjust(500*1000*1000, true, now.Add(time.Second))
+	c.Assert(a.estimatedLimitBytesPerSecond, chk.Equals, float64(100*1000*1000))
+}
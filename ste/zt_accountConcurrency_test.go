@@ -0,0 +1,97 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type accountConcurrencySuite struct{}
+
+var _ = chk.Suite(&accountConcurrencySuite{})
+
+func (s *accountConcurrencySuite) TestNoLimitWhenZero(c *chk.C) {
+	c.Assert(newAccountConcurrencyLimiter(0), chk.IsNil)
+
+	var l *accountConcurrencyLimiter
+	ran := false
+	f := l.limitChunkFunc("account1.blob.core.windows.net", func(int) { ran = true }, nil)
+	f(0)
+	c.Assert(ran, chk.Equals, true)
+}
+
+func (s *accountConcurrencySuite) TestLimitIsPerAccount(c *chk.C) {
+	l := newAccountConcurrencyLimiter(2)
+
+	c.Assert(l.tryAcquire("a"), chk.Equals, true)
+	c.Assert(l.tryAcquire("a"), chk.Equals, true)
+	c.Assert(l.tryAcquire("a"), chk.Equals, false)
+	c.Assert(l.tryAcquire("b"), chk.Equals, true) // a being full must not hold up b
+
+	l.release("a")
+	c.Assert(l.tryAcquire("a"), chk.Equals, true)
+
+	l.release("a")
+	l.release("a")
+	l.release("b")
+	c.Assert(l.inFlight, chk.HasLen, 0)
+}
+
+func (s *accountConcurrencySuite) TestChunkForFullAccountIsRescheduled(c *chk.C) {
+	l := newAccountConcurrencyLimiter(1)
+	c.Assert(l.tryAcquire("a"), chk.Equals, true) // fill the account up
+
+	runs := 0
+	rescheduled := make(chan chunkFunc, 1)
+	f := l.limitChunkFunc("a", func(int) { runs++ }, func(cf chunkFunc) { rescheduled <- cf })
+
+	// the account is full, so the chunk must not run, but must come back later
+	f(0)
+	c.Assert(runs, chk.Equals, 0)
+	var again chunkFunc
+	select {
+	case again = <-rescheduled:
+	case <-time.After(5 * time.Second):
+		c.Fatal("chunk was not rescheduled")
+	}
+
+	// once there is room, it runs, and gives its place back when done
+	l.release("a")
+	again(0)
+	c.Assert(runs, chk.Equals, 1)
+	c.Assert(l.inFlight, chk.HasLen, 0)
+}
+
+func (s *accountConcurrencySuite) TestLocalFilesAreNotLimited(c *chk.C) {
+	l := newAccountConcurrencyLimiter(1)
+	runs := 0
+	f := l.limitChunkFunc("", func(int) { runs++ }, nil)
+	f(0)
+	f(0)
+	c.Assert(runs, chk.Equals, 2)
+}
+
+func (s *accountConcurrencySuite) TestAccountOfURL(c *chk.C) {
+	c.Assert(accountOfURL("https://MyAccount.blob.core.windows.net/container/blob?sig=x"), chk.Equals, "myaccount.blob.core.windows.net")
+	c.Assert(accountOfURL("https://other.file.core.windows.net/share/dir/file"), chk.Equals, "other.file.core.windows.net")
+}
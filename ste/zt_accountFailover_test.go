@@ -0,0 +1,87 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type accountFailoverSuite struct{}
+
+var _ = chk.Suite(&accountFailoverSuite{})
+
+// an error which carries the response of the service, as the errors of the SDKs do
+type testServiceError struct {
+	msg  string
+	code string
+}
+
+func (e testServiceError) Error() string { return e.msg }
+
+func (e testServiceError) Response() *http.Response {
+	header := http.Header{}
+	if e.code != "" {
+		header.Set("x-ms-error-code", e.code)
+	}
+	return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header}
+}
+
+func (s *accountFailoverSuite) TestIsAccountFailoverError(c *chk.C) {
+	c.Assert(isAccountFailoverError(nil), chk.Equals, false)
+	c.Assert(isAccountFailoverError(errors.New("connection reset by peer")), chk.Equals, false)
+	c.Assert(isAccountFailoverError(testServiceError{msg: "The account is being failed over.", code: "AccountFailoverInProgress"}), chk.Equals, true)
+
+	// only the error code counts, not the message, which has the URL in it
+	c.Assert(isAccountFailoverError(errors.New("The account is being failed over.")), chk.Equals, false)
+	c.Assert(isAccountFailoverError(testServiceError{msg: "GET https://account.blob.core.windows.net/failover-tests/blob: 503 Server Busy", code: "ServerBusy"}), chk.Equals, false)
+
+	// nor do DNS failures
+	c.Assert(isAccountFailoverError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "account.blob.core.windows.net"}}), chk.Equals, false)
+}
+
+func (s *accountFailoverSuite) TestAccountFailoverDetector(c *chk.C) {
+	d := newAccountFailoverDetector()
+	failoverErr := testServiceError{msg: "account failover in progress", code: "AccountFailoverInProgress"}
+	start := time.Now()
+
+	// other errors don't count
+	for i := 0; i < accountFailoverErrorThreshold; i++ {
+		c.Assert(d.recordError(errors.New("server busy"), start), chk.Equals, false)
+	}
+
+	// errors which are too far apart don't add up
+	for i := 0; i < accountFailoverErrorThreshold; i++ {
+		c.Assert(d.recordError(failoverErr, start.Add(time.Duration(i)*accountFailoverWindow)), chk.Equals, false)
+	}
+
+	// but a burst of them does, only once
+	later := start.Add(time.Hour)
+	for i := 0; i < accountFailoverErrorThreshold-1; i++ {
+		c.Assert(d.recordError(failoverErr, later), chk.Equals, false)
+	}
+	c.Assert(d.recordError(failoverErr, later), chk.Equals, true)
+	c.Assert(d.recordError(failoverErr, later), chk.Equals, false)
+}
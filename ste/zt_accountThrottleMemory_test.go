@@ -0,0 +1,148 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type accountThrottleMemorySuite struct{}
+
+var _ = chk.Suite(&accountThrottleMemorySuite{})
+
+func (s *accountThrottleMemorySuite) newMemory() (*accountThrottleMemory, *time.Time) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	return newAccountThrottleMemory(func() time.Time { return now }, nil), &now
+}
+
+func (s *accountThrottleMemorySuite) TestParseRetryAfter(c *chk.C) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	c.Assert(parseRetryAfter(http.Header{}, now), chk.Equals, time.Duration(0))
+	c.Assert(parseRetryAfter(http.Header{"Retry-After": []string{"3"}}, now), chk.Equals, 3*time.Second)
+	c.Assert(parseRetryAfter(http.Header{"Retry-After": []string{now.Add(10 * time.Second).Format(http.TimeFormat)}}, now), chk.Equals, 10*time.Second)
+	c.Assert(parseRetryAfter(http.Header{"Retry-After": []string{"soon"}}, now), chk.Equals, time.Duration(0))
+	c.Assert(parseRetryAfter(http.Header{"Retry-After": []string{"-1"}}, now), chk.Equals, time.Duration(0))
+
+	// the milliseconds of Azure services are more precise, so they're preferred
+	c.Assert(parseRetryAfter(http.Header{"X-Ms-Retry-After-Ms": []string{"250"}, "Retry-After": []string{"1"}}, now), chk.Equals, 250*time.Millisecond)
+	c.Assert(parseRetryAfter(http.Header{"Retry-After-Ms": []string{"1500"}}, now), chk.Equals, 1500*time.Millisecond)
+
+	// and nothing can hold us up for too long, or overflow
+	c.Assert(parseRetryAfter(http.Header{"Retry-After": []string{"99999999999999"}}, now), chk.Equals, maxHonouredRetryAfter)
+}
+
+func (s *accountThrottleMemorySuite) TestUnthrottledAccountsDontWait(c *chk.C) {
+	m, _ := s.newMemory()
+	c.Assert(m.reserve("account.blob.core.windows.net"), chk.Equals, time.Duration(0))
+	c.Assert(m.reserve("account.blob.core.windows.net"), chk.Equals, time.Duration(0))
+	c.Assert(m.accounts, chk.HasLen, 0)
+}
+
+func (s *accountThrottleMemorySuite) TestRetryAfterHoldsAllRequestsToTheAccount(c *chk.C) {
+	m, now := s.newMemory()
+	m.recordThrottle("Account.blob.core.windows.net", 2*time.Second)
+
+	// the first request waits as long as asked, and the ones after it are spaced out behind it
+	c.Assert(m.reserve("account.blob.core.windows.net"), chk.Equals, 2*time.Second)
+	m.finish("account.blob.core.windows.net")
+	c.Assert(m.reserve("account.blob.core.windows.net"), chk.Equals, 2*time.Second+initialThrottleSpacing)
+	m.finish("account.blob.core.windows.net")
+	c.Assert(m.reserve("account.blob.core.windows.net"), chk.Equals, 2*time.Second+2*initialThrottleSpacing)
+	m.finish("account.blob.core.windows.net")
+
+	// other accounts aren't held up
+	c.Assert(m.reserve("other.blob.core.windows.net"), chk.Equals, time.Duration(0))
+
+	*now = now.Add(time.Minute)
+	c.Assert(m.reserve("account.blob.core.windows.net"), chk.Equals, time.Duration(0))
+}
+
+func (s *accountThrottleMemorySuite) TestSpacingGrowsAndDecays(c *chk.C) {
+	m, now := s.newMemory()
+	account := "account.blob.core.windows.net"
+
+	// throttles that come back together only count once
+	m.recordThrottle(account, 0)
+	m.recordThrottle(account, 0)
+	c.Assert(m.accounts[account].spacing, chk.Equals, initialThrottleSpacing)
+
+	for i := 0; i < 10; i++ {
+		*now = now.Add(throttleSpacingIncreaseInterval)
+		m.recordThrottle(account, 0)
+	}
+	c.Assert(m.accounts[account].spacing, chk.Equals, maxThrottleSpacing)
+
+	// once the account stops throttling, the spacing is relaxed, until the account is forgotten
+	for i := 0; i < 10 && len(m.accounts) > 0; i++ {
+		*now = now.Add(throttleSpacingDecayInterval)
+		m.reserve(account)
+		if i == 0 {
+			c.Assert(m.accounts[account].spacing, chk.Equals, maxThrottleSpacing/2)
+		}
+	}
+	c.Assert(m.accounts, chk.HasLen, 0)
+}
+
+func (s *accountThrottleMemorySuite) TestSpacingIsPerConnection(c *chk.C) {
+	m, now := s.newMemory()
+	account := "account.blob.core.windows.net"
+	m.recordThrottle(account, 0)
+	for i := 0; i < 5; i++ {
+		*now = now.Add(throttleSpacingIncreaseInterval)
+		m.recordThrottle(account, 0)
+	}
+	spacing := m.accounts[account].spacing
+	*now = now.Add(time.Second)
+
+	// the more requests there are in flight, the closer together their starts are
+	m.reserve(account)
+	m.reserve(account)
+	m.reserve(account)
+	c.Assert(m.reserve(account), chk.Equals, spacing+spacing/2+spacing/3)
+	c.Assert(m.inFlight[account], chk.Equals, 4)
+	c.Assert(m.recordResponse(account, nil, nil), chk.Equals, time.Duration(0))
+	c.Assert(m.inFlight[account], chk.Equals, 3)
+	m.finish(account)
+	m.finish(account)
+	m.finish(account)
+	c.Assert(m.inFlight, chk.HasLen, 0)
+
+	// while one on its own waits the whole spacing after the one before it
+	*now = now.Add(time.Second)
+	c.Assert(m.reserve(account), chk.Equals, time.Duration(0))
+	m.finish(account)
+	c.Assert(m.reserve(account), chk.Equals, spacing)
+}
+
+func (s *accountThrottleMemorySuite) TestWaitIsCanceledWithTheContext(c *chk.C) {
+	m := newAccountThrottleMemory(time.Now, nil)
+	m.recordThrottle("account.blob.core.windows.net", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(m.wait(ctx, "account.blob.core.windows.net"), chk.Equals, context.Canceled)
+	c.Assert(m.inFlight, chk.HasLen, 0)
+}
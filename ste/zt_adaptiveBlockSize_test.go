@@ -0,0 +1,72 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type adaptiveBlockSizeSuite struct{}
+
+var _ = chk.Suite(&adaptiveBlockSizeSuite{})
+
+const mib = 1024 * 1024
+
+func (s *adaptiveBlockSizeSuite) TestSizeOnlyWhenNothingMeasured(c *chk.C) {
+	size, _ := chooseBlockSize(1*mib, 0, 0)
+	c.Assert(size, chk.Equals, uint32(common.DefaultBlockBlobBlockSize))
+
+	// big enough that 8 MiB blocks would exceed the limit on number of blocks
+	size, _ = chooseBlockSize(1000*1024*mib, 0, 0)
+	c.Assert(size, chk.Equals, uint32(32*mib))
+	c.Assert(int64(1000*1024*mib)/int64(size) <= common.MaxNumberOfBlocksPerBlob, chk.Equals, true)
+}
+
+func (s *adaptiveBlockSizeSuite) TestHighLatencyGrowsBlocks(c *chk.C) {
+	// 100 ms latency at 50 MB/s per connection means we want 4 * 5 MB = 20 MB blocks, rounded up to 32 MiB
+	size, reason := chooseBlockSize(10*1024*mib, 100*time.Millisecond, 50*1000*1000)
+	c.Assert(size, chk.Equals, uint32(32*mib))
+	c.Assert(reason, chk.Matches, ".*latency of 100ms.*50.00 MB/s.*")
+
+	// but not without limit
+	size, _ = chooseBlockSize(10*1024*mib, time.Second, 100*1000*1000)
+	c.Assert(size, chk.Equals, uint32(maxLatencyHidingBlockSize))
+}
+
+func (s *adaptiveBlockSizeSuite) TestSlowLinkShrinksBlocks(c *chk.C) {
+	// at 100 KB/s, an 8 MiB block would take over a minute. 20s allows 2 MB, rounded down to 1 MiB
+	size, reason := chooseBlockSize(100*mib, 10*time.Millisecond, 100*1000)
+	c.Assert(size, chk.Equals, uint32(1*mib))
+	c.Assert(reason, chk.Matches, ".*no more than 20s.*")
+
+	// but never so small that the file would need too many blocks
+	size, _ = chooseBlockSize(1000*1024*mib, 10*time.Millisecond, 100*1000)
+	c.Assert(size, chk.Equals, uint32(32*mib))
+}
+
+func (s *adaptiveBlockSizeSuite) TestNeverOverServiceMax(c *chk.C) {
+	// the largest block blob needs the largest blocks, whatever we measure
+	size, _ := chooseBlockSize(int64(common.MaxBlockBlobBlockSize)*common.MaxNumberOfBlocksPerBlob, 10*time.Millisecond, 100*1000)
+	c.Assert(size, chk.Equals, uint32(common.MaxBlockBlobBlockSize))
+}
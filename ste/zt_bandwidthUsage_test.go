@@ -0,0 +1,209 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type bandwidthUsageSuite struct{}
+
+var _ = chk.Suite(&bandwidthUsageSuite{})
+
+func (s *bandwidthUsageSuite) TestRequestsAreCounted(c *chk.C) {
+	meter := newBandwidthMeter()
+
+	req, err := http.NewRequest(http.MethodPut, "https://myaccount.blob.core.windows.net/container/blob", strings.NewReader("12345"))
+	c.Assert(err, chk.IsNil)
+	resp := pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("abcdefgh"))})
+	meter.recordRequest(pipeline.Request{Request: req}, resp)
+	meter.recordRequest(pipeline.Request{Request: req}, nil) // a retry, that got no response
+
+	body, err := ioutil.ReadAll(resp.Response().Body)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(body), chk.Equals, "abcdefgh")
+	c.Assert(meter.atomicSent, chk.Equals, int64(10))
+	c.Assert(meter.atomicReceived, chk.Equals, int64(8))
+}
+
+func (s *bandwidthUsageSuite) TestUsageIsRecordedPerJobAndDay(c *chk.C) {
+	dir, err := ioutil.TempDir("", "bandwidthUsage")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := common.BandwidthUsageFilePath(dir)
+
+	// another job has already used some of today's bandwidth, and some of yesterday's
+	now := time.Date(2021, 3, 10, 23, 59, 0, 0, time.Local)
+	other := common.NewJobID()
+	c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-09", JobID: other, BytesSent: 5000}), chk.IsNil)
+	c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-10", JobID: other, BytesSent: 300, BytesReceived: 200}), chk.IsNil)
+
+	meter := newBandwidthMeter()
+	meter.now = func() time.Time { return now }
+	jobID := common.NewJobID()
+	meter.enable(jobID, path, 0, nullTestLogger{})
+	c.Assert(meter.usedToday(), chk.Equals, uint64(500))
+
+	meter.atomicSent = 1000
+	meter.atomicReceived = 24
+	c.Assert(meter.usedToday(), chk.Equals, uint64(1524))
+	meter.flush()
+	c.Assert(meter.atomicSent, chk.Equals, int64(0))
+	c.Assert(meter.usedToday(), chk.Equals, uint64(1524))
+
+	// a new day starts with nothing used
+	now = now.Add(2 * time.Minute)
+	c.Assert(meter.usedToday(), chk.Equals, uint64(0))
+	meter.atomicReceived = 7
+	meter.flush()
+
+	records, err := ReadBandwidthUsage(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(records, chk.DeepEquals, []common.BandwidthUsageRecord{
+		{Date: "2021-03-09", JobID: other, BytesSent: 5000},
+		{Date: "2021-03-10", JobID: other, BytesSent: 300, BytesReceived: 200},
+		{Date: "2021-03-10", JobID: jobID, BytesSent: 1000, BytesReceived: 24},
+		{Date: "2021-03-11", JobID: jobID, BytesReceived: 7},
+	})
+}
+
+func (s *bandwidthUsageSuite) TestChunksAreHeldBackOverTheCap(c *chk.C) {
+	dir, err := ioutil.TempDir("", "bandwidthUsage")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := common.BandwidthUsageFilePath(dir)
+	c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: common.BandwidthUsageDate(time.Now()), JobID: common.NewJobID(), BytesSent: 900}), chk.IsNil)
+
+	// no cap
+	uncapped := newBandwidthMeter()
+	uncapped.enable(common.NewJobID(), path, 0, nullTestLogger{})
+	c.Assert(uncapped.overCap(), chk.Equals, false)
+
+	meter := newBandwidthMeter()
+	meter.enable(common.NewJobID(), path, 1000, nullTestLogger{})
+	c.Assert(meter.overCap(), chk.Equals, false)
+	meter.atomicReceived = 100
+	c.Assert(meter.overCap(), chk.Equals, true)
+
+	// waiting only ends with the context, while the day lasts
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	meter.waitForBudget(ctx)
+	c.Assert(time.Since(start) >= 50*time.Millisecond, chk.Equals, true)
+}
+
+func (s *bandwidthUsageSuite) TestBandwidthUsageFileIsCompacted(c *chk.C) {
+	dir, err := ioutil.TempDir("", "bandwidthUsage")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "usage.jsonl")
+
+	first, second := common.NewJobID(), common.NewJobID()
+	for i := 0; i < 3; i++ {
+		c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-10", JobID: first, BytesSent: 10, BytesReceived: 1}), chk.IsNil)
+		c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-10", JobID: second, BytesSent: 20}), chk.IsNil)
+	}
+	c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-11", JobID: first, BytesSent: 5}), chk.IsNil)
+	c.Assert(compactBandwidthUsageFile(path), chk.IsNil)
+
+	records, err := readBandwidthUsageFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(records, chk.DeepEquals, []common.BandwidthUsageRecord{
+		{Date: "2021-03-10", JobID: first, BytesSent: 30, BytesReceived: 3},
+		{Date: "2021-03-10", JobID: second, BytesSent: 60},
+		{Date: "2021-03-11", JobID: first, BytesSent: 5},
+	})
+}
+
+func (s *bandwidthUsageSuite) TestAppendsWaitWhileTheFileIsLocked(c *chk.C) {
+	dir, err := ioutil.TempDir("", "bandwidthUsage")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "usage.jsonl")
+
+	// another copy of AzCopy is compacting the file, so the record must not go to the file that's about to be replaced
+	unlock, err := lockSharedFile(path)
+	c.Assert(err, chk.IsNil)
+	appended := make(chan error, 1)
+	go func() {
+		appended <- appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-10", JobID: common.NewJobID(), BytesSent: 10})
+	}()
+	select {
+	case <-appended:
+		c.Fatal("appended while the file was locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	c.Assert(<-appended, chk.IsNil)
+	records, err := readBandwidthUsageFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(records, chk.HasLen, 1)
+
+	// a lock left behind by a copy that died holding it doesn't stop the others for good
+	unlock, err = lockSharedFile(path)
+	c.Assert(err, chk.IsNil)
+	longAgo := time.Now().Add(-2 * sharedFileLockStaleAfter)
+	c.Assert(os.Chtimes(path+".lock", longAgo, longAgo), chk.IsNil)
+	c.Assert(appendBandwidthUsageRecord(path, common.BandwidthUsageRecord{Date: "2021-03-10", JobID: common.NewJobID(), BytesSent: 20}), chk.IsNil)
+	_, err = os.Stat(path + ".lock")
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+}
+
+func (s *bandwidthUsageSuite) TestStopRecordsWhatIsLeftAndEndsTheFlushes(c *chk.C) {
+	dir, err := ioutil.TempDir("", "bandwidthUsage")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := common.BandwidthUsageFilePath(dir)
+
+	meter := newBandwidthMeter()
+	meter.enable(common.NewJobID(), path, 0, nullTestLogger{})
+	stopFlushing := meter.stopFlushing
+	meter.atomicSent = 42
+	meter.stop()
+
+	records, err := ReadBandwidthUsage(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(records, chk.HasLen, 1)
+	c.Assert(records[0].BytesSent, chk.Equals, uint64(42))
+	c.Assert(meter.isEnabled(), chk.Equals, false)
+	select {
+	case <-stopFlushing:
+	default:
+		c.Fatal("the periodic flushes were not stopped")
+	}
+
+	// a resumed job starts recording again
+	meter.enable(common.NewJobID(), path, 0, nullTestLogger{})
+	c.Assert(meter.isEnabled(), chk.Equals, true)
+	meter.stop()
+}
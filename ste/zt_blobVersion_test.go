@@ -0,0 +1,85 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type blobVersionSuite struct{}
+
+var _ = chk.Suite(&blobVersionSuite{})
+
+func (s *blobVersionSuite) TestAddBlobVersionID(c *chk.C) {
+	versioned := addBlobVersionID("https://account.blob.core.windows.net/container/blob", "2020-01-01T00:00:00.0000000Z")
+	c.Assert(versioned, chk.Equals, "https://account.blob.core.windows.net/container/blob?versionid=2020-01-01T00%3A00%3A00.0000000Z")
+
+	// the SAS must be kept exactly as it was given
+	versioned = addBlobVersionID("https://account.blob.core.windows.net/container/blob?sv=2019-02-02&sig=a%2Fb%2Bc%3D", "v1")
+	c.Assert(versioned, chk.Equals, "https://account.blob.core.windows.net/container/blob?sv=2019-02-02&sig=a%2Fb%2Bc%3D&versionid=v1")
+}
+
+func (s *blobVersionSuite) TestVersionPolicyRaisesServiceVersionForVersionedReads(c *chk.C) {
+	var sentVersion string
+	sender := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			sentVersion = request.Header.Get("x-ms-version")
+			return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusOK}), nil
+		}
+	})
+	p := pipeline.NewPipeline([]pipeline.Factory{NewVersionPolicyFactory(), sender}, pipeline.Options{})
+	ctx := context.WithValue(context.Background(), ServiceAPIVersionOverride, "2018-03-28")
+
+	send := func(rawURL string, copySource string) string {
+		u, _ := url.Parse(rawURL)
+		request, err := pipeline.NewRequest(http.MethodGet, *u, nil)
+		c.Assert(err, chk.IsNil)
+		if copySource != "" {
+			request.Header.Set("x-ms-copy-source", copySource)
+		}
+		_, err = p.Do(ctx, nil, request)
+		c.Assert(err, chk.IsNil)
+		return sentVersion
+	}
+
+	c.Assert(send("https://account.blob.core.windows.net/container/blob", ""), chk.Equals, "2018-03-28")
+	c.Assert(send("https://account.blob.core.windows.net/container/blob?versionid=v1", ""), chk.Equals, BlobVersioningServiceVersion)
+	c.Assert(send("https://dest.blob.core.windows.net/container/blob?comp=block", "https://account.blob.core.windows.net/container/blob?versionid=v1"),
+		chk.Equals, BlobVersioningServiceVersion)
+
+	// never lower a version that is already new enough
+	ctx = context.WithValue(context.Background(), ServiceAPIVersionOverride, "2020-04-08")
+	c.Assert(send("https://account.blob.core.windows.net/container/blob?versionid=v1", ""), chk.Equals, "2020-04-08")
+}
+
+func (s *blobVersionSuite) TestGetBlobVersionID(c *chk.C) {
+	c.Assert(GetBlobVersionID(nil), chk.Equals, "")
+
+	resp := &http.Response{Header: http.Header{}}
+	c.Assert(GetBlobVersionID(resp), chk.Equals, "")
+	resp.Header.Set("x-ms-version-id", "v1")
+	c.Assert(GetBlobVersionID(resp), chk.Equals, "v1")
+}
@@ -191,3 +191,131 @@ func (s *concurrencyTunerSuite) runTest(c *chk.C, steps []tunerStep, maxConcurre
 		observedHighCpu = x.highCpuObserved
 	}
 }
+
+type adaptiveTunerStep struct {
+	retries         int // the 503s seen since the last step
+	accountLimits   int // how many of those retries were due to the account limit
+	mbpsObserved    int
+	highCpuObserved bool
+	concurrency     int  // the concurrency value we expect the tuner to recommend
+	changed         bool // whether we expect it to give a reason, because it changed the value
+}
+
+func (s *concurrencyTunerSuite) runAdaptiveTest(c *chk.C, initial int, maxConcurrency int, steps []adaptiveTunerStep) []string {
+	t := NewAdaptiveConcurrencyTuner(initial, maxConcurrency)
+	conc, reason := t.GetRecommendedConcurrency(-1, false)
+	c.Assert(conc, chk.Equals, initial)
+	c.Assert(reason, chk.Equals, concurrencyReasonInitial)
+
+	reasons := make([]string, 0)
+	for i, x := range steps {
+		for r := 0; r < x.retries; r++ {
+			t.recordRetry()
+		}
+		for r := 0; r < x.accountLimits; r++ {
+			t.recordAccountLimit()
+		}
+		conc, reason = t.GetRecommendedConcurrency(x.mbpsObserved, x.highCpuObserved)
+
+		c.Assert(conc, chk.Equals, x.concurrency, chk.Commentf("step %d", i))
+		c.Assert(reason != concurrencyReasonNone, chk.Equals, x.changed, chk.Commentf("step %d: %s", i, reason))
+		if x.changed {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	finalReason, finalConcurrency := t.GetFinalState()
+	c.Assert(finalReason, chk.Equals, concurrencyReasonAdaptive)
+	c.Assert(finalConcurrency, chk.Equals, conc)
+	return reasons
+}
+
+func (s *concurrencyTunerSuite) TestAdaptiveConcurrencyTuner_GrowsWhileThroughputImproves(c *chk.C) {
+	steps := []adaptiveTunerStep{
+		{0, 0, 100, false, 32, false}, // lets the initial value run for a while
+		{0, 0, 100, false, 40, true},  // probes up
+		{0, 0, 200, false, 50, true},  // that helped, so probes again
+		{0, 0, 205, false, 40, true},  // that didn't, so goes back
+		{0, 0, 205, false, 40, false}, // and waits before probing again
+		{0, 0, 205, false, 40, false},
+		{0, 0, 205, false, 40, false},
+		{0, 0, 205, false, 40, false},
+		{0, 0, 205, false, 50, true},
+	}
+
+	reasons := s.runAdaptiveTest(c, 32, s.noMax(), steps)
+	c.Assert(reasons[0], chk.Equals, "probing up from 32, to see if throughput improves beyond 100 Mbps")
+	c.Assert(reasons[2], chk.Equals, "returning from 50, because throughput did not improve (205 Mbps, compared to 200 Mbps before)")
+}
+
+func (s *concurrencyTunerSuite) TestAdaptiveConcurrencyTuner_BacksOffWhenServerIsBusy(c *chk.C) {
+	steps := []adaptiveTunerStep{
+		{0, 0, 100, false, 64, false},
+		{0, 0, 100, false, 80, true},
+		{5, 3, 100, false, 60, true},  // backs off, even though it was probing
+		{2, 0, 100, false, 45, true},  // and again
+		{0, 0, 100, false, 45, false}, // then stays put for a while
+	}
+
+	reasons := s.runAdaptiveTest(c, 64, s.noMax(), steps)
+	c.Assert(reasons[1], chk.Equals, "backing off from 80, because 3 of 5 server busy responses said the account is over its throughput limit")
+	c.Assert(reasons[2], chk.Equals, "backing off from 60, because of 2 server busy responses")
+}
+
+func (s *concurrencyTunerSuite) TestAdaptiveConcurrencyTuner_RespectsLimits(c *chk.C) {
+	steps := []adaptiveTunerStep{
+		{0, 0, 100, false, 4, false},
+		{1, 0, 100, false, 4, false}, // can't go any lower
+		{0, 0, 100, true, 4, false},  // high CPU, so doesn't probe after waiting
+		{0, 0, 100, false, 4, false}, // still waiting after the backoff
+	}
+	s.runAdaptiveTest(c, 4, 6, steps)
+
+	steps = []adaptiveTunerStep{
+		{0, 0, 100, false, 5, false},
+		{0, 0, 100, false, 6, true},  // small values still grow, but only as far as the max
+		{0, 0, 200, false, 6, false}, // at max, so nothing more to try
+	}
+	s.runAdaptiveTest(c, 5, 6, steps)
+}
+
+func (s *concurrencyTunerSuite) TestSlowStartConcurrencyTuner_DoublesUntilTarget(c *chk.C) {
+	inner := NewAdaptiveConcurrencyTuner(32, s.noMax())
+	t := newSlowStartConcurrencyTuner(inner)
+
+	conc, reason := t.GetRecommendedConcurrency(-1, false)
+	c.Assert(conc, chk.Equals, slowStartInitialConcurrency)
+	c.Assert(reason, chk.Equals, concurrencyReasonSlowStart)
+	c.Assert(t.isRamping(), chk.Equals, true)
+
+	conc, _ = t.GetRecommendedConcurrency(10, false)
+	c.Assert(conc, chk.Equals, 8)
+
+	// retries hold the level until an observation passes without any
+	t.recordRetry()
+	t.recordRetry()
+	conc, reason = t.GetRecommendedConcurrency(10, false)
+	c.Assert(conc, chk.Equals, 8)
+	c.Assert(reason, chk.Equals, "slow start, holding because of 2 server busy responses")
+
+	conc, _ = t.GetRecommendedConcurrency(10, false)
+	c.Assert(conc, chk.Equals, 16)
+	conc, reason = t.GetRecommendedConcurrency(10, false)
+	c.Assert(conc, chk.Equals, 32) // capped at the level the inner tuner started with
+	c.Assert(reason, chk.Equals, "slow start complete")
+	c.Assert(t.isRamping(), chk.Equals, false)
+
+	// from then on, the inner tuner decides; it saw the retries too, so it backs off
+	conc, reason = t.GetRecommendedConcurrency(100, false)
+	c.Assert(conc, chk.Equals, 24)
+	c.Assert(reason, chk.Equals, "backing off from 32, because of 2 server busy responses")
+}
+
+func (s *concurrencyTunerSuite) TestSlowStartConcurrencyTuner_NotUsedForSmallTargets(c *chk.C) {
+	t := newSlowStartConcurrencyTuner(NewAdaptiveConcurrencyTuner(slowStartInitialConcurrency, s.noMax()))
+
+	conc, reason := t.GetRecommendedConcurrency(-1, false)
+	c.Assert(conc, chk.Equals, slowStartInitialConcurrency)
+	c.Assert(reason, chk.Equals, concurrencyReasonInitial)
+	c.Assert(t.isRamping(), chk.Equals, false)
+}
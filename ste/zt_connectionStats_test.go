@@ -0,0 +1,118 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type connectionStatsSuite struct{}
+
+var _ = chk.Suite(&connectionStatsSuite{})
+
+func (s *connectionStatsSuite) TestConnectionReuseIsCounted(c *chk.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	stats := &pipelineNetworkStats{}
+	stats.start()
+	client := newAzcopyHTTPClient(httpTransportSettings{maxIdleConns: 10, idleConnTimeout: time.Minute})
+
+	for i := 0; i < 4; i++ {
+		ctx, _ := stats.traceConnections(context.Background())
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		c.Assert(err, chk.IsNil)
+		resp, err := client.Do(req.WithContext(ctx))
+		c.Assert(err, chk.IsNil)
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	// the first request opens the connection, and the rest reuse it
+	c.Assert(stats.ConnectionReusePercentage(), chk.Equals, float32(75))
+	c.Assert(stats.DroppedIdleConnections(), chk.Equals, int64(0))
+}
+
+func (s *connectionStatsSuite) TestDroppedIdleConnectionIsCounted(c *chk.C) {
+	stats := &pipelineNetworkStats{}
+	ctx, lastConnFailedBeforeResponse := stats.traceConnections(context.Background())
+	trace := httptrace.ContextClientTrace(ctx)
+
+	// the HTTP client found the reused connection dead, and retried on a new one
+	trace.GotConn(httptrace.GotConnInfo{Reused: true, WasIdle: true})
+	c.Assert(lastConnFailedBeforeResponse(), chk.Equals, true)
+	trace.GotConn(httptrace.GotConnInfo{})
+	c.Assert(lastConnFailedBeforeResponse(), chk.Equals, false)
+
+	c.Assert(stats.DroppedIdleConnections(), chk.Equals, int64(1))
+	c.Assert(stats.DroppedIdleConnectionPercentage(), chk.Equals, float32(100))
+	c.Assert(stats.ConnectionReusePercentage(), chk.Equals, float32(50))
+}
+
+func (s *connectionStatsSuite) TestFailureAfterResponseStartsIsNotADroppedConnection(c *chk.C) {
+	stats := &pipelineNetworkStats{}
+	ctx, lastConnFailedBeforeResponse := stats.traceConnections(context.Background())
+	trace := httptrace.ContextClientTrace(ctx)
+
+	// the server answered on the reused connection, so whatever fails after that, e.g. reading a slow body, isn't an idle connection that was dropped
+	trace.GotConn(httptrace.GotConnInfo{Reused: true, WasIdle: true})
+	trace.GotFirstResponseByte()
+	c.Assert(lastConnFailedBeforeResponse(), chk.Equals, false)
+
+	// nor is a request on a new connection, if the client tries again by itself after that
+	trace.GotConn(httptrace.GotConnInfo{})
+	c.Assert(stats.DroppedIdleConnections(), chk.Equals, int64(0))
+}
+
+func (s *connectionStatsSuite) TestExpectContinue(c *chk.C) {
+	expectHeaders := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectHeaders = append(expectHeaders, r.Header.Get("Expect"))
+		_, _ = io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	for _, expectContinue := range []bool{false, true} {
+		client := newAzcopyHTTPClient(httpTransportSettings{idleConnTimeout: time.Minute, expectContinue: expectContinue})
+		for _, body := range [][]byte{nil, []byte("data")} {
+			req, err := http.NewRequest(http.MethodPut, server.URL, bytes.NewReader(body))
+			c.Assert(err, chk.IsNil)
+			resp, err := client.Do(req)
+			c.Assert(err, chk.IsNil)
+			_ = resp.Body.Close()
+			c.Assert(req.Header.Get("Expect"), chk.Equals, "") // the caller's request isn't changed
+		}
+	}
+
+	// only requests with bodies ask, and only when asked to
+	c.Assert(expectHeaders, chk.DeepEquals, []string{"", "", "", "100-continue"})
+}
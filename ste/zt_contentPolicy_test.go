@@ -0,0 +1,83 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type contentPolicySuite struct{}
+
+var _ = chk.Suite(&contentPolicySuite{})
+
+func (s *contentPolicySuite) TestQuarantineDestination(c *chk.C) {
+	root := "https://account.blob.core.windows.net/container/upload"
+	c.Assert(quarantineDestination(root, root+"/dir/setup.exe", "quarantine"), chk.Equals,
+		"https://account.blob.core.windows.net/container/upload/quarantine/dir/setup.exe")
+	c.Assert(quarantineDestination(root+"/", root+"/setup.exe", "held/back"), chk.Equals,
+		"https://account.blob.core.windows.net/container/upload/held/back/setup.exe")
+
+	// when the destination root is the file itself, the quarantine folder is beside it
+	c.Assert(quarantineDestination(root+"/setup.exe", root+"/setup.exe", "quarantine"), chk.Equals,
+		"https://account.blob.core.windows.net/container/upload/quarantine/setup.exe")
+	c.Assert(quarantineDestination("/downloads", "/downloads/a/b.exe", "quarantine"), chk.Equals, "/downloads/quarantine/a/b.exe")
+}
+
+func (s *contentPolicySuite) TestReadLeadingBytes(c *chk.C) {
+	dir, err := ioutil.TempDir("", "contentPolicy")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "short.bin")
+	c.Assert(ioutil.WriteFile(path, []byte("MZ"), 0644), chk.IsNil)
+	leading, err := readLeadingBytes(path, 4)
+	c.Assert(err, chk.IsNil)
+	c.Assert(leading, chk.DeepEquals, []byte("MZ"))
+
+	_, err = readLeadingBytes(filepath.Join(dir, "missing.bin"), 4)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *contentPolicySuite) TestViolationsAreTracked(c *chk.C) {
+	tracker := newPolicyViolationTracker()
+	tracker.record(common.PolicyViolation{Src: "/a.exe", Rule: "extension 'exe' is blocked"})
+	tracker.record(common.PolicyViolation{Src: "/b.exe", Dst: "/quarantine/b.exe", Rule: "extension 'exe' is blocked", Quarantined: true})
+
+	violations, quarantined := tracker.get()
+	c.Assert(violations, chk.HasLen, 2)
+	c.Assert(quarantined, chk.Equals, uint32(1))
+}
+
+func (s *contentPolicySuite) TestPolicyIsRecordedInPlan(c *chk.C) {
+	h := JobPartPlanHeader{}
+	c.Assert(h.ContentPolicy().IsEmpty(), chk.Equals, true)
+
+	policy := common.ContentPolicy{BlockedExtensions: []string{"exe"}, Action: common.EContentPolicyAction.Quarantine(), QuarantineFolder: "quarantine"}
+	raw := []byte(`{"BlockedExtensions":["exe"],"Action":1,"QuarantineFolder":"quarantine"}`)
+	h.ContentPolicyRulesLength = uint16(copy(h.ContentPolicyRules[:], raw))
+	c.Assert(h.ContentPolicy(), chk.DeepEquals, policy)
+}
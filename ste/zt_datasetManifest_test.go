@@ -0,0 +1,181 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type datasetManifestSuite struct{}
+
+var _ = chk.Suite(&datasetManifestSuite{})
+
+type testManifest struct {
+	Version     int
+	JobID       common.JobID
+	Complete    bool
+	FailedFiles []string
+	FileCount  int64
+	TotalBytes int64
+	Files      []datasetManifestFile
+}
+
+func (s *datasetManifestSuite) TestManifestListsTheFilesThatLanded(c *chk.C) {
+	dir, err := ioutil.TempDir("", "datasetManifest")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	jobID := common.NewJobID()
+	header := datasetManifestHeader{JobID: jobID, Source: "/data", Destination: "https://account.blob.core.windows.net/container"}
+	manifestPath := filepath.Join(dir, "manifest.json")
+
+	// nothing landed
+	m := newDatasetManifest(dir, jobID, nullTestLogger{})
+	m.enable()
+	c.Assert(m.write(context.Background(), header, manifestPath, "", common.OAuthTokenInfo{}, http.DefaultClient), chk.IsNil)
+	var manifest testManifest
+	content, err := ioutil.ReadFile(manifestPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(json.Unmarshal(content, &manifest), chk.IsNil)
+	c.Assert(manifest.Version, chk.Equals, datasetManifestVersion)
+	c.Assert(manifest.JobID, chk.Equals, jobID)
+	c.Assert(manifest.Files, chk.HasLen, 0)
+	c.Assert(manifest.Complete, chk.Equals, true)
+	c.Assert(manifest.FailedFiles, chk.HasLen, 0)
+
+	// the files are kept across runs of the job, like when it's resumed
+	m = newDatasetManifest(dir, jobID, nullTestLogger{})
+	m.enable()
+	m.recordFile("a.txt", 10, []byte{1, 2, 3}, true)
+	m.files.Close()
+	m = newDatasetManifest(dir, jobID, nullTestLogger{})
+	m.enable()
+	m.recordFile("dir/b.txt", 20, nil, true)
+	m.recordFile("dir/c.txt", 30, []byte{4, 5, 6}, false)
+	header.FailedFiles = []string{"dir/d.txt"}
+	c.Assert(m.write(context.Background(), header, manifestPath, "", common.OAuthTokenInfo{}, http.DefaultClient), chk.IsNil)
+
+	content, err = ioutil.ReadFile(manifestPath)
+	c.Assert(err, chk.IsNil)
+	manifest = testManifest{}
+	c.Assert(json.Unmarshal(content, &manifest), chk.IsNil)
+	c.Assert(manifest.FileCount, chk.Equals, int64(3))
+	c.Assert(manifest.TotalBytes, chk.Equals, int64(60))
+	c.Assert(manifest.Files, chk.DeepEquals, []datasetManifestFile{
+		{Path: "a.txt", Size: 10, ContentMD5: base64.StdEncoding.EncodeToString([]byte{1, 2, 3}), ContentMD5Verified: true},
+		{Path: "dir/b.txt", Size: 20}, // no hash, so nothing was verified
+		{Path: "dir/c.txt", Size: 30, ContentMD5: base64.StdEncoding.EncodeToString([]byte{4, 5, 6})},
+	})
+
+	// a transfer failed, so the manifest says it's incomplete, and which file is missing
+	c.Assert(manifest.Complete, chk.Equals, false)
+	c.Assert(manifest.FailedFiles, chk.DeepEquals, []string{"dir/d.txt"})
+
+	// no signing key, no signature
+	_, err = os.Stat(manifestPath + ".sig")
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+}
+
+func (s *datasetManifestSuite) TestManifestIsSignedWithKeyFile(c *chk.C) {
+	dir, err := ioutil.TempDir("", "datasetManifest")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, chk.IsNil)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, chk.IsNil)
+	ecKeyBytes, err := x509.MarshalECPrivateKey(ecKey)
+	c.Assert(err, chk.IsNil)
+
+	rsaKeyFile := filepath.Join(dir, "rsa.pem")
+	c.Assert(ioutil.WriteFile(rsaKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600), chk.IsNil)
+	ecKeyFile := filepath.Join(dir, "ec.pem")
+	c.Assert(ioutil.WriteFile(ecKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecKeyBytes}), 0600), chk.IsNil)
+
+	readSignature := func(manifestPath string) (digest []byte, signature datasetManifestSignature, signatureBytes []byte) {
+		content, err := ioutil.ReadFile(manifestPath)
+		c.Assert(err, chk.IsNil)
+		sum := sha256.Sum256(content)
+		sigJSON, err := ioutil.ReadFile(manifestPath + ".sig")
+		c.Assert(err, chk.IsNil)
+		c.Assert(json.Unmarshal(sigJSON, &signature), chk.IsNil)
+		c.Assert(signature.ManifestSHA256, chk.Equals, hex.EncodeToString(sum[:]))
+		signatureBytes, err = base64.StdEncoding.DecodeString(signature.Signature)
+		c.Assert(err, chk.IsNil)
+		return sum[:], signature, signatureBytes
+	}
+
+	jobID := common.NewJobID()
+	m := newDatasetManifest(dir, jobID, nullTestLogger{})
+	m.enable()
+	m.recordFile("a.txt", 10, nil, false)
+
+	rsaManifest := filepath.Join(dir, "rsa.json")
+	c.Assert(m.write(context.Background(), datasetManifestHeader{JobID: jobID}, rsaManifest, rsaKeyFile, common.OAuthTokenInfo{}, http.DefaultClient), chk.IsNil)
+	digest, signature, signatureBytes := readSignature(rsaManifest)
+	c.Assert(signature.Algorithm, chk.Equals, "RS256")
+	c.Assert(rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, signatureBytes), chk.IsNil)
+
+	ecManifest := filepath.Join(dir, "ec.json")
+	c.Assert(m.write(context.Background(), datasetManifestHeader{JobID: jobID}, ecManifest, ecKeyFile, common.OAuthTokenInfo{}, http.DefaultClient), chk.IsNil)
+	digest, signature, signatureBytes = readSignature(ecManifest)
+	c.Assert(signature.Algorithm, chk.Equals, "ES256")
+	var ecSignature ecdsaSignature
+	_, err = asn1.Unmarshal(signatureBytes, &ecSignature)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ecdsa.Verify(&ecKey.PublicKey, digest, ecSignature.R, ecSignature.S), chk.Equals, true)
+
+	// a file without a private key is reported
+	notAKey := filepath.Join(dir, "notAKey.pem")
+	c.Assert(ioutil.WriteFile(notAKey, []byte("hello"), 0600), chk.IsNil)
+	c.Assert(m.write(context.Background(), datasetManifestHeader{JobID: jobID}, ecManifest, notAKey, common.OAuthTokenInfo{}, http.DefaultClient), chk.NotNil)
+}
+
+func (s *datasetManifestSuite) TestKeyVaultKeysAreRecognized(c *chk.C) {
+	c.Assert(isKeyVaultKey("https://myvault.vault.azure.net/keys/manifest"), chk.Equals, true)
+	c.Assert(isKeyVaultKey("https://myvault.vault.azure.net/keys/manifest/0123456789abcdef"), chk.Equals, true)
+	c.Assert(isKeyVaultKey("/home/me/keys/manifest.pem"), chk.Equals, false)
+	c.Assert(isKeyVaultKey(`C:\keys\manifest.pem`), chk.Equals, false)
+
+	// Key Vault signs with the identity of azcopy login
+	_, err := signWithKeyVault(context.Background(), []byte{1}, "https://myvault.vault.azure.net/keys/manifest", common.OAuthTokenInfo{}, http.DefaultClient)
+	c.Assert(err, chk.ErrorMatches, ".*azcopy login.*")
+}
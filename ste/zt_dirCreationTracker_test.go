@@ -0,0 +1,132 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Azure/azure-storage-file-go/azfile"
+	chk "gopkg.in/check.v1"
+)
+
+type dirCreationTrackerSuite struct{}
+
+var _ = chk.Suite(&dirCreationTrackerSuite{})
+
+func (s *dirCreationTrackerSuite) TestCreatedDirIsNotCreatedAgain(c *chk.C) {
+	t := newDirCreationTracker()
+	calls := 0
+	create := func() error { calls++; return nil }
+
+	c.Assert(t.ensureCreated("share/a", create), chk.IsNil)
+	c.Assert(t.ensureCreated("share/a", create), chk.IsNil)
+	c.Assert(calls, chk.Equals, 1)
+
+	c.Assert(t.ensureCreated("share/b", create), chk.IsNil)
+	c.Assert(calls, chk.Equals, 2)
+}
+
+func (s *dirCreationTrackerSuite) TestFailureIsRetried(c *chk.C) {
+	t := newDirCreationTracker()
+	calls := 0
+	failOnce := func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("transient failure")
+		}
+		return nil
+	}
+
+	c.Assert(t.ensureCreated("share/a", failOnce), chk.NotNil)
+	c.Assert(t.ensureCreated("share/a", failOnce), chk.IsNil)
+	c.Assert(calls, chk.Equals, 2)
+}
+
+func (s *dirCreationTrackerSuite) TestConcurrentCallersShareOneCreation(c *chk.C) {
+	t := newDirCreationTracker()
+	var calls int32
+	release := make(chan struct{})
+	create := func() error {
+		atomic.AddInt32(&calls, 1)
+		<-release // hold the creation open, so that the other callers find it in progress
+		return nil
+	}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Check(t.ensureCreated("share/a/b", create), chk.IsNil)
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	// callers that arrived after the creation finished found it already done, and those that arrived during it waited for it,
+	// so there was only one creation, whatever the timing
+	c.Assert(atomic.LoadInt32(&calls), chk.Equals, int32(1))
+}
+
+func (s *dirCreationTrackerSuite) TestWaiterRetriesAfterOthersFailure(c *chk.C) {
+	t := newDirCreationTracker()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	firstDone := make(chan error)
+	go func() {
+		firstDone <- t.ensureCreated("share/a", func() error {
+			close(started)
+			<-release
+			return errors.New("this caller's context was cancelled")
+		})
+	}()
+	<-started
+
+	secondDone := make(chan error)
+	secondCalled := int32(0)
+	go func() {
+		secondDone <- t.ensureCreated("share/a", func() error {
+			atomic.StoreInt32(&secondCalled, 1)
+			return nil
+		})
+	}()
+
+	close(release)
+	c.Assert(<-firstDone, chk.NotNil)
+	c.Assert(<-secondDone, chk.IsNil)
+	// the second caller either waited for the first and then had its own try, or arrived after the first failed. Either way, it did the creation
+	c.Assert(atomic.LoadInt32(&secondCalled), chk.Equals, int32(1))
+}
+
+func (s *dirCreationTrackerSuite) TestParentURLAndKey(c *chk.C) {
+	d := AzureFileParentDirCreator{}
+	u, _ := url.Parse("https://acct.file.core.windows.net/share/Dir1/dir2/file.txt?sig=abc")
+	dirURL := d.getParentDirectoryURL(azfile.NewFileURL(*u, nil), nil)
+	c.Assert(d.dirCreationKey(dirURL), chk.Equals, "https://acct.file.core.windows.net/share/dir1/dir2")
+
+	parent := d.getParentURL(dirURL.URL())
+	c.Assert(parent.Path, chk.Equals, "/share/Dir1")
+	c.Assert(parent.RawQuery, chk.Equals, "sig=abc")
+}
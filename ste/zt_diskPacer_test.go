@@ -0,0 +1,115 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type diskPacerSuite struct{}
+
+var _ = chk.Suite(&diskPacerSuite{})
+
+type closeableBytesReader struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (r *closeableBytesReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+type closeableBuffer struct {
+	bytes.Buffer
+}
+
+func (b *closeableBuffer) Close() error {
+	return nil
+}
+
+func (s *diskPacerSuite) TestNoDiskPacer(c *chk.C) {
+	c.Assert(newDiskPacer(0, 0), chk.IsNil)
+
+	// a nil pacer leaves things as they are
+	var p *diskPacer
+	dst := &closeableBuffer{}
+	c.Assert(p.wrapDestination(context.Background(), dst), chk.Equals, dst)
+
+	src := &closeableBytesReader{Reader: bytes.NewReader([]byte("abc"))}
+	factory := p.wrapSourceFactory(context.Background(), func() (common.CloseableReaderAt, error) { return src, nil })
+	file, err := factory()
+	c.Assert(err, chk.IsNil)
+	c.Assert(file, chk.Equals, src)
+}
+
+func (s *diskPacerSuite) TestPacedReadAndWrite(c *chk.C) {
+	data := make([]byte, 5*diskPacerMaxIOSize+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	p := newDiskPacer(0, 10)
+	defer p.ops.Close()
+
+	// the read is done in pieces, so the IOPS limit applies to each of them
+	src := &closeableBytesReader{Reader: bytes.NewReader(data)}
+	factory := p.wrapSourceFactory(context.Background(), func() (common.CloseableReaderAt, error) { return src, nil })
+	file, err := factory()
+	c.Assert(err, chk.IsNil)
+
+	start := time.Now()
+	buf := make([]byte, len(data)-10)
+	n, err := file.ReadAt(buf, 10)
+	c.Assert(err, chk.IsNil)
+	c.Assert(n, chk.Equals, len(buf))
+	c.Assert(bytes.Equal(buf, data[10:]), chk.Equals, true)
+	c.Assert(time.Since(start) >= 200*time.Millisecond, chk.Equals, true) // 6 pieces, at 10 per second, after an initial allowance of 2
+
+	c.Assert(file.Close(), chk.IsNil)
+	c.Assert(src.closed, chk.Equals, true)
+
+	dst := &closeableBuffer{}
+	w := p.wrapDestination(context.Background(), dst)
+	n, err = w.Write(data)
+	c.Assert(err, chk.IsNil)
+	c.Assert(n, chk.Equals, len(data))
+	written, _ := ioutil.ReadAll(&dst.Buffer)
+	c.Assert(bytes.Equal(written, data), chk.Equals, true)
+}
+
+func (s *diskPacerSuite) TestPacedReadCancelled(c *chk.C) {
+	p := newDiskPacer(1024, 0) // far too slow for the read to finish
+	defer p.bytes.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src := &closeableBytesReader{Reader: bytes.NewReader(make([]byte, 1024*1024))}
+	file, _ := p.wrapSourceFactory(ctx, func() (common.CloseableReaderAt, error) { return src, nil })()
+	n, err := file.ReadAt(make([]byte, 1024*1024), 0)
+	c.Assert(err, chk.Equals, context.Canceled)
+	c.Assert(n, chk.Equals, 0)
+}
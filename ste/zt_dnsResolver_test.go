@@ -0,0 +1,188 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"golang.org/x/net/dns/dnsmessage"
+	chk "gopkg.in/check.v1"
+)
+
+type dnsResolverSuite struct{}
+
+var _ = chk.Suite(&dnsResolverSuite{})
+
+type fakeHostResolver struct {
+	ips     []net.IP
+	ttl     time.Duration
+	err     error
+	delay   time.Duration
+	lookups int32
+}
+
+func (r *fakeHostResolver) lookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	time.Sleep(r.delay)
+	return r.ips, r.ttl, r.err
+}
+
+func (s *dnsResolverSuite) TestCacheRespectsTTL(c *chk.C) {
+	fake := &fakeHostResolver{ips: []net.IP{net.ParseIP("10.0.0.1")}, ttl: 100 * time.Millisecond, delay: 20 * time.Millisecond}
+	resolver := newCachingResolver(fake, func(string) {})
+
+	// concurrent connections share one lookup
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := resolver.resolve(context.Background(), "account.blob.core.windows.net")
+			c.Check(err, chk.IsNil)
+			c.Check(ips, chk.HasLen, 1)
+		}()
+	}
+	wg.Wait()
+	c.Assert(atomic.LoadInt32(&fake.lookups), chk.Equals, int32(1))
+
+	// and once the TTL has passed, the host is looked up again
+	time.Sleep(150 * time.Millisecond)
+	_, err := resolver.resolve(context.Background(), "account.blob.core.windows.net")
+	c.Assert(err, chk.IsNil)
+	c.Assert(atomic.LoadInt32(&fake.lookups), chk.Equals, int32(2))
+
+	// a TTL of zero, or a failure, is not cached
+	fake.ttl = 0
+	_, _ = resolver.resolve(context.Background(), "other.blob.core.windows.net")
+	_, _ = resolver.resolve(context.Background(), "other.blob.core.windows.net")
+	c.Assert(atomic.LoadInt32(&fake.lookups), chk.Equals, int32(4))
+	fake.err = errors.New("no such host")
+	fake.ttl = time.Minute
+	_, err = resolver.resolve(context.Background(), "failing.blob.core.windows.net")
+	c.Assert(err, chk.NotNil)
+	_, _ = resolver.resolve(context.Background(), "failing.blob.core.windows.net")
+	c.Assert(atomic.LoadInt32(&fake.lookups), chk.Equals, int32(6))
+}
+
+func (s *dnsResolverSuite) TestOrderByIPPreference(c *chk.C) {
+	v6a, v4a, v6b, v4b := net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::2"), net.ParseIP("10.0.0.2")
+	ips := []net.IP{v6a, v4a, v6b, v4b}
+
+	c.Assert(orderByIPPreference(ips, common.EIPPreference.Any()), chk.DeepEquals, ips)
+	c.Assert(orderByIPPreference(ips, common.EIPPreference.PreferIPv4()), chk.DeepEquals, []net.IP{v4a, v4b, v6a, v6b})
+	c.Assert(orderByIPPreference(ips, common.EIPPreference.PreferIPv6()), chk.DeepEquals, []net.IP{v6a, v6b, v4a, v4b})
+	c.Assert(orderByIPPreference(ips, common.EIPPreference.IPv4Only()), chk.DeepEquals, []net.IP{v4a, v4b})
+	c.Assert(orderByIPPreference([]net.IP{v4a}, common.EIPPreference.IPv6Only()), chk.HasLen, 0)
+
+	resolver := newCachingResolver(&fakeHostResolver{ips: []net.IP{v4a}, ttl: time.Minute}, func(string) {})
+	resolver.setPreference(common.EIPPreference.IPv6Only())
+	_, err := resolver.resolve(context.Background(), "account.blob.core.windows.net")
+	c.Assert(err, chk.ErrorMatches, ".*no address allowed by ip-preference IPv6Only.*")
+}
+
+func (s *dnsResolverSuite) TestDialFallsBackToOtherFamily(c *chk.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, chk.IsNil)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// nothing listens on the IPv6 address (or there's no IPv6 at all), so the connection is made over IPv4
+	var logged []string
+	resolver := newCachingResolver(&fakeHostResolver{ips: []net.IP{net.ParseIP("::1"), net.ParseIP("127.0.0.1")}, ttl: time.Minute},
+		func(msg string) { logged = append(logged, msg) })
+	dialer := newResolvingDialer(&net.Dialer{Timeout: 5 * time.Second}, resolver)
+	conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("account.blob.core.windows.net", port))
+	c.Assert(err, chk.IsNil)
+	c.Assert(conn.RemoteAddr().String(), chk.Equals, listener.Addr().String())
+	conn.Close()
+	c.Assert(logged, chk.HasLen, 1) // the resolution itself
+
+	// unless IPv4 is ruled out
+	resolver.setPreference(common.EIPPreference.IPv6Only())
+	_, err = dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("account.blob.core.windows.net", port))
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *dnsResolverSuite) TestQueryTTL(c *chk.C) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, chk.IsNil)
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if query.Unpack(buf[:n]) != nil {
+			return
+		}
+		target := dnsmessage.MustNewName("account.store.core.windows.net.")
+		reply := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+			Answers: []dnsmessage.Resource{
+				{Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 300},
+					Body: &dnsmessage.CNAMEResource{CNAME: target}},
+				{Header: dnsmessage.ResourceHeader{Name: target, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body: &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}}},
+			},
+		}
+		packed, _ := reply.Pack()
+		_, _ = server.WriteTo(packed, addr)
+	}()
+
+	dir, err := ioutil.TempDir("", "dnsResolverSuite")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	c.Assert(ioutil.WriteFile(resolvConf, []byte("# comment\nsearch example.com\nnameserver 127.0.0.1\nnameserver 10.0.0.53\n"), 0644), chk.IsNil)
+	_, port, _ := net.SplitHostPort(server.LocalAddr().String())
+
+	// the TTL is the lowest along the chain
+	r := systemHostResolver{resolvConfPath: resolvConf, nameserverPort: port}
+	ttl, ok := r.queryTTL(context.Background(), "account.blob.core.windows.net")
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(ttl, chk.Equals, 60*time.Second)
+
+	// without a nameserver to ask, the default is used
+	r = systemHostResolver{resolvConfPath: filepath.Join(dir, "missing")}
+	_, ok = r.queryTTL(context.Background(), "account.blob.core.windows.net")
+	c.Assert(ok, chk.Equals, false)
+}
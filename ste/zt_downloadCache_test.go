@@ -0,0 +1,137 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type downloadCacheSuite struct{}
+
+var _ = chk.Suite(&downloadCacheSuite{})
+
+func (s *downloadCacheSuite) TestKey(c *chk.C) {
+	info := TransferInfo{Source: "https://account.blob.core.windows.net/container/blob?sig=a", SourceSize: 3, SrcETag: "0x1"}
+	byETag := downloadCacheKey(info)
+	c.Assert(byETag, chk.Matches, "etag-[0-9a-f]{64}")
+
+	// the SAS doesn't matter, but the ETag does
+	info.Source = "https://account.blob.core.windows.net/container/blob?sig=b"
+	c.Assert(downloadCacheKey(info), chk.Equals, byETag)
+	info.SrcETag = "0x2"
+	c.Assert(downloadCacheKey(info), chk.Not(chk.Equals), byETag)
+
+	// identical content is cached once, whichever blob it's in
+	info.SrcHTTPHeaders = common.ResourceHTTPHeaders{ContentMD5: []byte{0xab, 0xcd}}
+	c.Assert(downloadCacheKey(info), chk.Equals, "md5-abcd-3")
+
+	c.Assert(downloadCacheKey(TransferInfo{Source: info.Source}), chk.Equals, "")
+}
+
+func (s *downloadCacheSuite) TestStoreAndLookup(c *chk.C) {
+	cache := &downloadCache{dir: c.MkDir()}
+	downloaded := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(downloaded, []byte("abc"), 0644), chk.IsNil)
+
+	_, ok := cache.lookup("md5-abcd-3", 3)
+	c.Assert(ok, chk.Equals, false)
+
+	c.Assert(cache.store("md5-abcd-3", downloaded), chk.IsNil)
+	path, ok := cache.lookup("md5-abcd-3", 3)
+	c.Assert(ok, chk.Equals, true)
+	content, err := ioutil.ReadFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(content), chk.Equals, "abc")
+
+	// an entry of the wrong size isn't used
+	_, ok = cache.lookup("md5-abcd-3", 4)
+	c.Assert(ok, chk.Equals, false)
+}
+
+func (s *downloadCacheSuite) TestDamagedEntriesAreEvicted(c *chk.C) {
+	cache := &downloadCache{dir: c.MkDir()}
+	downloaded := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(downloaded, []byte("abc"), 0644), chk.IsNil)
+	c.Assert(cache.store("md5-abcd-3", downloaded), chk.IsNil)
+
+	// the same size, so only the hash can tell
+	path := filepath.Join(cache.dir, "md5-abcd-3")
+	c.Assert(ioutil.WriteFile(path, []byte("abd"), 0644), chk.IsNil)
+	_, ok := cache.lookup("md5-abcd-3", 3)
+	c.Assert(ok, chk.Equals, false)
+	_, err := os.Stat(path)
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+	_, err = os.Stat(path + downloadCacheHashSuffix)
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+
+	// an entry without a hash isn't used, but is left for whoever is storing it
+	c.Assert(ioutil.WriteFile(path, []byte("abc"), 0644), chk.IsNil)
+	_, ok = cache.lookup("md5-abcd-3", 3)
+	c.Assert(ok, chk.Equals, false)
+	_, err = os.Stat(path)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *downloadCacheSuite) TestEvictsLeastRecentlyUsed(c *chk.C) {
+	cache := &downloadCache{dir: c.MkDir(), maxBytes: 10}
+	write := func(name string, age time.Duration) {
+		path := filepath.Join(cache.dir, name)
+		c.Assert(ioutil.WriteFile(path, make([]byte, 4), 0644), chk.IsNil)
+		hash := sha256.Sum256(make([]byte, 4))
+		c.Assert(ioutil.WriteFile(path+downloadCacheHashSuffix, []byte(fmt.Sprintf("%x\n", hash)), 0644), chk.IsNil)
+		t := time.Now().Add(-age)
+		c.Assert(os.Chtimes(path, t, t), chk.IsNil)
+	}
+	writeTemp := func(name string, age time.Duration) {
+		path := filepath.Join(cache.dir, name)
+		c.Assert(ioutil.WriteFile(path, make([]byte, 4), 0644), chk.IsNil)
+		t := time.Now().Add(-age)
+		c.Assert(os.Chtimes(path, t, t), chk.IsNil)
+	}
+	write("old", 3*time.Hour)
+	write("used", 2*time.Hour)
+	writeTemp("new"+downloadCacheTempMarker+"1", time.Minute)       // being written
+	writeTemp("abandoned"+downloadCacheTempMarker+"1", 2*time.Hour) // left by a process that died
+	_, ok := cache.lookup("used", 4)
+	c.Assert(ok, chk.Equals, true)
+
+	downloaded := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(downloaded, make([]byte, 2), 0644), chk.IsNil)
+	c.Assert(cache.store("newest", downloaded), chk.IsNil)
+
+	names := []string{}
+	entries, err := ioutil.ReadDir(cache.dir)
+	c.Assert(err, chk.IsNil)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	c.Assert(names, chk.DeepEquals, []string{"new" + downloadCacheTempMarker + "1", "newest", "newest" + downloadCacheHashSuffix,
+		"used", "used" + downloadCacheHashSuffix})
+}
@@ -0,0 +1,160 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type eventGridNotifierSuite struct{}
+
+var _ = chk.Suite(&eventGridNotifierSuite{})
+
+type nullTestLogger struct{}
+
+func (nullTestLogger) ShouldLog(level pipeline.LogLevel) bool  { return false }
+func (nullTestLogger) Log(level pipeline.LogLevel, msg string) {}
+func (nullTestLogger) Panic(err error)                         { panic(err) }
+
+type eventGridTestTopic struct {
+	lock     sync.Mutex
+	batches  [][]eventGridEvent
+	keysSeen []string
+
+	atomicConcurrent    int32
+	atomicMaxConcurrent int32
+}
+
+func (t *eventGridTestTopic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	concurrent := atomic.AddInt32(&t.atomicConcurrent, 1)
+	defer atomic.AddInt32(&t.atomicConcurrent, -1)
+	for max := atomic.LoadInt32(&t.atomicMaxConcurrent); concurrent > max; max = atomic.LoadInt32(&t.atomicMaxConcurrent) {
+		if atomic.CompareAndSwapInt32(&t.atomicMaxConcurrent, max, concurrent) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	var batch []eventGridEvent
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	t.lock.Lock()
+	t.batches = append(t.batches, batch)
+	t.keysSeen = append(t.keysSeen, r.Header.Get("aeg-sas-key"))
+	t.lock.Unlock()
+}
+
+func (s *eventGridNotifierSuite) TestEventGridNotifierBatchesAndFlushes(c *chk.C) {
+	topic := &eventGridTestTopic{}
+	server := httptest.NewServer(topic)
+	defer server.Close()
+
+	jobID := common.NewJobID()
+	n := newEventGridNotifier(server.URL, "secretKey", 2, server.Client(), nullTestLogger{})
+	n.NotifyTransferCompleted(jobID, "/src/a.txt", "https://acct.blob.core.windows.net/c/a.txt?sig=abc", 10, []byte{1, 2, 3})
+	n.NotifyTransferCompleted(jobID, "/src/b.txt", "https://acct.blob.core.windows.net/c/b.txt?sig=abc", 20, nil)
+	n.NotifyTransferCompleted(jobID, "/src/c.txt", "https://acct.blob.core.windows.net/c/c.txt?sig=abc", 30, nil)
+	n.Flush()
+
+	c.Assert(topic.batches, chk.HasLen, 2)
+	total := 0
+	for i, b := range topic.batches {
+		c.Assert(topic.keysSeen[i], chk.Equals, "secretKey")
+		for _, e := range b {
+			total++
+			c.Assert(e.EventType, chk.Equals, eventGridTransferCompletedEventType)
+			c.Assert(e.Data.JobID, chk.Equals, jobID.String())
+			c.Assert(e.Subject, chk.Equals, e.Data.Destination)
+			c.Assert(e.Data.Destination, chk.Not(chk.Matches), ".*sig=.*")
+			if e.Data.Source == "/src/a.txt" {
+				c.Assert(e.Data.Size, chk.Equals, int64(10))
+				c.Assert(e.Data.SourceContentMD5, chk.Equals, "AQID")
+			}
+		}
+	}
+	c.Assert(total, chk.Equals, 3)
+}
+
+func (s *eventGridNotifierSuite) TestEventGridNotifierSendsOneBatchAtATime(c *chk.C) {
+	topic := &eventGridTestTopic{}
+	server := httptest.NewServer(topic)
+	defer server.Close()
+
+	// with the default batch size of one, a busy job must not start a request per transfer
+	jobID := common.NewJobID()
+	n := newEventGridNotifier(server.URL, "secretKey", 1, server.Client(), nullTestLogger{})
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.NotifyTransferCompleted(jobID, "/src/a.txt", "https://acct.blob.core.windows.net/c/a.txt", 10, nil)
+		}()
+	}
+	wg.Wait()
+	n.Flush()
+
+	c.Assert(topic.batches, chk.HasLen, 200)
+	c.Assert(atomic.LoadInt32(&topic.atomicMaxConcurrent), chk.Equals, int32(1))
+}
+
+func (s *eventGridNotifierSuite) TestFlushStopsTheSender(c *chk.C) {
+	topic := &eventGridTestTopic{}
+	server := httptest.NewServer(topic)
+	defer server.Close()
+
+	jobID := common.NewJobID()
+	n := newEventGridNotifier(server.URL, "secretKey", 1, server.Client(), nullTestLogger{})
+	c.Assert(n.queue, chk.IsNil) // nothing runs until there's something to send
+
+	n.NotifyTransferCompleted(jobID, "/src/a.txt", "https://acct.blob.core.windows.net/c/a.txt", 10, nil)
+	done := n.senderDone
+	n.Flush()
+	c.Assert(n.queue, chk.IsNil)
+	select {
+	case <-done:
+	default:
+		c.Fatal("the sender is still running after the flush")
+	}
+
+	// a job that's resumed has a sender again
+	n.NotifyTransferCompleted(jobID, "/src/b.txt", "https://acct.blob.core.windows.net/c/b.txt", 10, nil)
+	n.Flush()
+	c.Assert(topic.batches, chk.HasLen, 2)
+	c.Assert(topic.batches[1][0].Data.Source, chk.Equals, "/src/b.txt")
+}
+
+func (s *eventGridNotifierSuite) TestStripQueryForNotification(c *chk.C) {
+	c.Assert(stripResourceQuery("https://acct.blob.core.windows.net/c/a.txt?sv=1&sig=abc"), chk.Equals, "https://acct.blob.core.windows.net/c/a.txt")
+	c.Assert(stripResourceQuery(`C:\data\a.txt`), chk.Equals, `C:\data\a.txt`)
+	c.Assert(stripResourceQuery("/data/a?b.txt"), chk.Equals, "/data/a?b.txt")
+}
@@ -0,0 +1,132 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type faultInjectionSuite struct{}
+
+var _ = chk.Suite(&faultInjectionSuite{})
+
+func faultTestRequest(c *chk.C) pipeline.Request {
+	req, err := http.NewRequest(http.MethodGet, "https://myaccount.blob.core.windows.net/container/blob", nil)
+	c.Assert(err, chk.IsNil)
+	return pipeline.Request{Request: req}
+}
+
+func faultTestSender(sent *int, body string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		*sent++
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body)), ContentLength: int64(len(body))}, nil
+	}
+}
+
+func (s *faultInjectionSuite) TestParseFaultInjection(c *chk.C) {
+	f, err := parseFaultInjection("503=0.05, truncate=0.1,slow-delay=2s,skew-offset=20m,seed=7")
+	c.Assert(err, chk.IsNil)
+	c.Assert(f.rates[faultServerBusy], chk.Equals, 0.05)
+	c.Assert(f.rates[faultTruncatedBody], chk.Equals, 0.1)
+	c.Assert(f.rates[faultSlowRead], chk.Equals, 0.0)
+	c.Assert(f.slowDelay, chk.Equals, 2*time.Second)
+	c.Assert(f.skewOffset, chk.Equals, 20*time.Minute)
+
+	for _, bad := range []string{"500=0.1", "503", "503=2", "503=0.6,skew=0.6", "slow-delay=soon", "seed=x"} {
+		_, err = parseFaultInjection(bad)
+		c.Assert(err, chk.NotNil, chk.Commentf(bad))
+	}
+
+	c.Assert(SetFaultInjection(""), chk.IsNil)
+	c.Assert(FaultInjectionEnabled(), chk.Equals, false)
+}
+
+func (s *faultInjectionSuite) TestFaultsAreInjectedAtTheirRates(c *chk.C) {
+	f, err := parseFaultInjection("503=0.25,skew=0.25,seed=1")
+	c.Assert(err, chk.IsNil)
+	counts := make(map[faultKind]int)
+	for i := 0; i < 10000; i++ {
+		counts[f.choose()]++
+	}
+	c.Assert(counts[faultServerBusy] > 2200 && counts[faultServerBusy] < 2800, chk.Equals, true)
+	c.Assert(counts[faultClockSkew] > 2200 && counts[faultClockSkew] < 2800, chk.Equals, true)
+	c.Assert(counts[faultSlowRead], chk.Equals, 0)
+}
+
+func (s *faultInjectionSuite) TestServerBusyAndClockSkew(c *chk.C) {
+	sent := 0
+	f, err := parseFaultInjection("503=1")
+	c.Assert(err, chk.IsNil)
+	resp, err := f.do(context.Background(), faultTestRequest(c), faultTestSender(&sent, "data"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(resp.StatusCode, chk.Equals, http.StatusServiceUnavailable)
+	c.Assert(resp.Header.Get("x-ms-error-code"), chk.Equals, "ServerBusy")
+	c.Assert(sent, chk.Equals, 0)
+
+	f, err = parseFaultInjection("skew=1,skew-offset=2h")
+	c.Assert(err, chk.IsNil)
+	resp, err = f.do(context.Background(), faultTestRequest(c), faultTestSender(&sent, "data"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(resp.StatusCode, chk.Equals, http.StatusForbidden)
+	c.Assert(sent, chk.Equals, 0)
+	skew, ok := common.ClockSkew(resp, time.Now())
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(skew > 119*time.Minute && skew < 121*time.Minute, chk.Equals, true)
+}
+
+func (s *faultInjectionSuite) TestTruncatedAndSlowBodies(c *chk.C) {
+	sent := 0
+	f, err := parseFaultInjection("truncate=1")
+	c.Assert(err, chk.IsNil)
+	resp, err := f.do(context.Background(), faultTestRequest(c), faultTestSender(&sent, "0123456789"))
+	c.Assert(err, chk.IsNil)
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, chk.NotNil)
+	c.Assert(string(data), chk.Equals, "01234")
+	c.Assert(sent, chk.Equals, 1)
+
+	f, err = parseFaultInjection("slow=1,slow-delay=50ms")
+	c.Assert(err, chk.IsNil)
+	resp, err = f.do(context.Background(), faultTestRequest(c), faultTestSender(&sent, "0123456789"))
+	c.Assert(err, chk.IsNil)
+	start := time.Now()
+	data, err = ioutil.ReadAll(resp.Body)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(data), chk.Equals, "0123456789")
+	c.Assert(time.Since(start) >= 50*time.Millisecond, chk.Equals, true)
+
+	// a slow body gives up when the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err = f.do(ctx, faultTestRequest(c), faultTestSender(&sent, "0123456789"))
+	c.Assert(err, chk.IsNil)
+	cancel()
+	_, err = ioutil.ReadAll(resp.Body)
+	c.Assert(err, chk.Equals, context.Canceled)
+}
@@ -0,0 +1,304 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type httpSourceSuite struct{}
+
+var _ = chk.Suite(&httpSourceSuite{})
+
+var httpSourceTestLmt = time.Date(2020, 5, 4, 3, 2, 1, 0, time.UTC)
+
+func (s *httpSourceSuite) pipelineAndURL(c *chk.C, server *httptest.Server) (pipeline.Pipeline, url.URL) {
+	u, err := url.Parse(server.URL + "/data/file.bin?sig=abc")
+	c.Assert(err, chk.IsNil)
+	retry := XferRetryOptions{MaxTries: 3, TryTimeout: time.Minute, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond}
+	return NewHTTPSourcePipeline(azblob.PipelineOptions{}, retry, server.Client(), nil), *u
+}
+
+func (s *httpSourceSuite) readInChunks(c *chk.C, r *httpRangeReader, chunkSize int64) []byte {
+	result := make([]byte, 0, r.size)
+	for off := int64(0); off < r.size; off += chunkSize {
+		b := make([]byte, chunkSize)
+		if off+chunkSize > r.size {
+			b = b[:r.size-off]
+		}
+		n, err := r.ReadAt(b, off)
+		c.Assert(err, chk.IsNil)
+		c.Assert(n, chk.Equals, len(b))
+		result = append(result, b...)
+	}
+	return result
+}
+
+func (s *httpSourceSuite) TestRangedServer(c *chk.C) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var rangeRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query().Get("sig"), chk.Equals, "abc")
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&rangeRequests, 1)
+		}
+		w.Header().Set("Content-Type", "application/x-test")
+		http.ServeContent(w, r, "file.bin", httpSourceTestLmt, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	p, u := s.pipelineAndURL(c, server)
+
+	props, err := GetHTTPSourceProperties(context.Background(), p, u)
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.Size, chk.Equals, int64(len(data)))
+	c.Assert(props.LastModified.Equal(httpSourceTestLmt), chk.Equals, true)
+	c.Assert(props.ContentType, chk.Equals, "application/x-test")
+	c.Assert(props.SupportsRanges, chk.Equals, true)
+
+	r := newHTTPRangeReader(context.Background(), p, u, props.Size, props.version(), nil)
+	defer r.Close()
+	c.Assert(s.readInChunks(c, r, 7000), chk.DeepEquals, data)
+
+	// one request per chunk, since the ranges that were fetched ahead were used
+	c.Assert(atomic.LoadInt32(&rangeRequests), chk.Equals, int32((len(data)+6999)/7000))
+
+	// a chunk can be read again, e.g. for a retry
+	b := make([]byte, 10)
+	_, err = r.ReadAt(b, 7000)
+	c.Assert(err, chk.IsNil)
+	c.Assert(b, chk.DeepEquals, data[7000:7010])
+}
+
+func (s *httpSourceSuite) TestReadAheadStaysWithinRAMLimit(c *chk.C) {
+	data := make([]byte, 50000)
+	rand.New(rand.NewSource(3)).Read(data)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", httpSourceTestLmt, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	p, u := s.pipelineAndURL(c, server)
+
+	// room for two of the chunks under the strict limit
+	limiter := common.NewCacheLimiter(20000)
+	r := newHTTPRangeReader(context.Background(), p, u, int64(len(data)), httpSourceVersion{}, limiter)
+	defer r.Close()
+	c.Assert(s.readInChunks(c, r, 7000), chk.DeepEquals, data)
+
+	// every range fetched ahead was read, so its RAM has been given back
+	c.Assert(limiter.TryAdd(15000, false), chk.Equals, true)
+}
+
+func (s *httpSourceSuite) TestServerWithoutRanges(c *chk.C) {
+	data := make([]byte, 30000)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	var gets, busy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// the first request is refused, and must be retried
+		if atomic.AddInt32(&busy, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		atomic.AddInt32(&gets, 1)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = io.Copy(w, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	p, u := s.pipelineAndURL(c, server)
+
+	props, err := GetHTTPSourceProperties(context.Background(), p, u)
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.Size, chk.Equals, int64(len(data)))
+	c.Assert(props.LastModified.IsZero(), chk.Equals, true)
+	c.Assert(props.SupportsRanges, chk.Equals, false)
+
+	r := newHTTPRangeReader(context.Background(), p, u, props.Size, props.version(), nil)
+	defer r.Close()
+	gets = 0
+	c.Assert(s.readInChunks(c, r, 4096), chk.DeepEquals, data)
+	c.Assert(atomic.LoadInt32(&gets), chk.Equals, int32(1)) // the whole file, read in order
+
+	// going back means reading the file again
+	b := make([]byte, 10)
+	_, err = r.ReadAt(b, 100)
+	c.Assert(err, chk.IsNil)
+	c.Assert(b, chk.DeepEquals, data[100:110])
+	c.Assert(atomic.LoadInt32(&gets), chk.Equals, int32(2))
+}
+
+func (s *httpSourceSuite) TestMissingFile(c *chk.C) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	p, u := s.pipelineAndURL(c, server)
+
+	_, err := GetHTTPSourceProperties(context.Background(), p, u)
+	c.Assert(err, chk.ErrorMatches, ".*404 Not Found")
+}
+
+func (s *httpSourceSuite) TestParseContentRange(c *chk.C) {
+	start, total, err := parseContentRange("bytes 100-199/1000")
+	c.Assert(err, chk.IsNil)
+	c.Assert(start, chk.Equals, int64(100))
+	c.Assert(total, chk.Equals, int64(1000))
+
+	_, total, err = parseContentRange("bytes 0-0/*")
+	c.Assert(err, chk.IsNil)
+	c.Assert(total, chk.Equals, int64(-1))
+
+	_, _, err = parseContentRange("items 0-1/2")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *httpSourceSuite) TestHTTPSourceMD5(c *chk.C) {
+	content := []byte("hello world")
+	sum := md5.Sum(content)
+	encoded := base64.StdEncoding.EncodeToString(sum[:])
+
+	c.Assert(httpSourceMD5(http.Header{"Content-Md5": []string{encoded}}), chk.DeepEquals, sum[:])
+	c.Assert(httpSourceMD5(http.Header{"X-Goog-Hash": []string{"crc32c=yZRlqg==", "md5=" + encoded}}), chk.DeepEquals, sum[:])
+	c.Assert(httpSourceMD5(http.Header{"X-Goog-Hash": []string{"crc32c=yZRlqg==,md5=" + encoded}}), chk.DeepEquals, sum[:])
+
+	// anything that isn't an MD5 hash is ignored, rather than failing the copy
+	c.Assert(httpSourceMD5(http.Header{}), chk.IsNil)
+	c.Assert(httpSourceMD5(http.Header{"Content-Md5": []string{"not base64!"}}), chk.IsNil)
+	c.Assert(httpSourceMD5(http.Header{"Content-Md5": []string{base64.StdEncoding.EncodeToString([]byte("short"))}}), chk.IsNil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-MD5", encoded)
+		http.ServeContent(w, r, "", httpSourceTestLmt, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	p, u := s.pipelineAndURL(c, server)
+
+	props, err := GetHTTPSourceProperties(context.Background(), p, u)
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.ContentMD5, chk.DeepEquals, sum[:])
+}
+
+func (s *httpSourceSuite) TestRangesAreConditionalOnTheVersion(c *chk.C) {
+	for _, withETag := range []bool{true, false} {
+		data := make([]byte, 100000)
+		rand.New(rand.NewSource(4)).Read(data)
+
+		var changed int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lmt, eTag := httpSourceTestLmt, `"v1"`
+			if atomic.LoadInt32(&changed) == 1 {
+				lmt, eTag = httpSourceTestLmt.Add(time.Hour), `"v2"`
+			}
+			if withETag {
+				w.Header().Set("ETag", eTag)
+			}
+			http.ServeContent(w, r, "file.bin", lmt, bytes.NewReader(data))
+		}))
+		p, u := s.pipelineAndURL(c, server)
+
+		props, err := GetHTTPSourceProperties(context.Background(), p, u)
+		c.Assert(err, chk.IsNil)
+		r := newHTTPRangeReader(context.Background(), p, u, props.Size, props.version(), nil)
+
+		// the file changes after the first chunk has been read, so one of the chunks after it must fail,
+		// rather than being read from the new version (the ones fetched ahead are still from the old one)
+		b := make([]byte, 7000)
+		_, err = r.ReadAt(b, 0)
+		c.Assert(err, chk.IsNil)
+		atomic.StoreInt32(&changed, 1)
+		for off := int64(len(b)); off+int64(len(b)) <= props.Size && err == nil; off += int64(len(b)) {
+			_, err = r.ReadAt(b, off)
+		}
+		c.Assert(err, chk.Equals, errHTTPSourceModified, chk.Commentf("withETag=%v", withETag))
+
+		r.Close()
+		server.Close()
+	}
+}
+
+// testHTTPSourceJptm is just enough of a transfer for an HTTP source info provider
+type testHTTPSourceJptm struct {
+	IJobPartTransferMgr
+	ctx    context.Context
+	p      pipeline.Pipeline
+	source string
+}
+
+func (t testHTTPSourceJptm) Info() TransferInfo                        { return TransferInfo{Source: t.source} }
+func (t testHTTPSourceJptm) Context() context.Context                  { return t.ctx }
+func (t testHTTPSourceJptm) SourceProviderPipeline() pipeline.Pipeline { return t.p }
+func (t testHTTPSourceJptm) CacheLimiter() common.CacheLimiter         { return nil }
+
+func (s *httpSourceSuite) TestSourceIsCheckedAgainAfterTheTransfer(c *chk.C) {
+	var heads, changed int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+		}
+		lmt := httpSourceTestLmt
+		if atomic.LoadInt32(&changed) == 1 {
+			lmt = lmt.Add(time.Hour)
+		}
+		http.ServeContent(w, r, "file.bin", lmt, bytes.NewReader([]byte("hello world")))
+	}))
+	defer server.Close()
+	p, u := s.pipelineAndURL(c, server)
+
+	sip, err := newHTTPSourceInfoProvider(testHTTPSourceJptm{ctx: context.Background(), p: p, source: u.String()})
+	c.Assert(err, chk.IsNil)
+	localSip := sip.(ILocalSourceInfoProvider)
+
+	// before the transfer, opening the file and checking it against the scan take one request between them
+	f, err := localSip.OpenSourceFile()
+	c.Assert(err, chk.IsNil)
+	defer f.Close()
+	lmt, err := sip.GetLastModifiedTime()
+	c.Assert(err, chk.IsNil)
+	c.Assert(lmt.Equal(httpSourceTestLmt), chk.Equals, true)
+	c.Assert(atomic.LoadInt32(&heads), chk.Equals, int32(1))
+
+	// after it, the server is asked again, so that a change during the transfer is seen
+	atomic.StoreInt32(&changed, 1)
+	lmt, err = sip.GetLastModifiedTime()
+	c.Assert(err, chk.IsNil)
+	c.Assert(lmt.Equal(httpSourceTestLmt.Add(time.Hour)), chk.Equals, true)
+	c.Assert(atomic.LoadInt32(&heads), chk.Equals, int32(2))
+}
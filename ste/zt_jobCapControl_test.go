@@ -0,0 +1,85 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type jobCapSuite struct{}
+
+var _ = chk.Suite(&jobCapSuite{})
+
+func (s *jobCapSuite) TestCapCanBeAddedChangedAndRemoved(c *chk.C) {
+	p := newAdjustableCapPacer(0)
+	defer p.Close()
+	c.Assert(p.capBytesPerSecond(), chk.Equals, int64(0))
+
+	// no cap, so even a huge request goes straight through
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(p.RequestTrafficAllocation(ctx, 1000*1000*1000), chk.IsNil)
+
+	p.setCap(1000)
+	c.Assert(p.capBytesPerSecond(), chk.Equals, int64(1000))
+	c.Assert(p.RequestTrafficAllocation(ctx, 1000*1000*1000), chk.NotNil) // can't be allowed before the timeout
+
+	p.setCap(2000)
+	c.Assert(p.capBytesPerSecond(), chk.Equals, int64(2000))
+
+	p.setCap(0)
+	c.Assert(p.capBytesPerSecond(), chk.Equals, int64(0))
+	c.Assert(p.RequestTrafficAllocation(context.Background(), 5), chk.IsNil)
+	p.UndoRequest(5)
+
+	// only the traffic that was allowed is counted
+	c.Assert(p.GetTotalTraffic(), chk.Equals, int64(1000*1000*1000))
+}
+
+func (s *jobCapSuite) TestCapIsAppliedFromFile(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobCap")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	jobID := common.NewJobID()
+	path := JobCapFilePath(dir, jobID)
+	c.Assert(writeJobCapFile(path, 200), chk.IsNil)
+	capMbps, err := readJobCapFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(capMbps, chk.Equals, uint32(200))
+
+	c.Assert(ioutil.WriteFile(path, []byte("lots"), 0644), chk.IsNil)
+	_, err = readJobCapFile(path)
+	c.Assert(err, chk.NotNil)
+
+	ja := &jobsAdmin{pacer: newAdjustableCapPacer(0)}
+	defer ja.pacer.Close()
+	ja.setMbpsCap(200)
+	c.Assert(ja.pacer.capBytesPerSecond(), chk.Equals, int64(200*1000*1000/8))
+	ja.setMbpsCap(0)
+	c.Assert(ja.pacer.capBytesPerSecond(), chk.Equals, int64(0))
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type jobStatsSuite struct{}
+
+var _ = chk.Suite(&jobStatsSuite{})
+
+func (s *jobStatsSuite) TestJobStatsCollector(c *chk.C) {
+	collector := newJobStatsCollector()
+	collector.recordTransferDone(common.ETransferStatus.Success(), 1000)
+	collector.recordTransferDone(common.ETransferStatus.Success(), 24)
+	collector.recordTransferDone(common.ETransferStatus.Failed(), 5000)
+	collector.recordTransferDone(common.ETransferStatus.SkippedFileAlreadyExists(), 7000)
+
+	plan := &JobPartPlanHeader{JobID: common.NewJobID(), FromTo: common.EFromTo.LocalBlob(), atomicJobStatus: common.EJobStatus.InProgress()}
+	plan.DestinationRootLength = uint16(copy(plan.DestinationRoot[:], "https://MyAccount.blob.core.windows.net/container"))
+	plan.SourceRootLength = uint16(copy(plan.SourceRoot[:], "/data"))
+
+	// the record is made before the final status is published in the plan
+	record := collector.toRecord(plan, common.EJobStatus.Completed())
+	c.Assert(record.JobID, chk.Equals, plan.JobID)
+	c.Assert(record.SourceEndpoint, chk.Equals, "local")
+	c.Assert(record.DestinationEndpoint, chk.Equals, "myaccount.blob.core.windows.net")
+	c.Assert(record.JobStatus, chk.Equals, "Completed")
+	c.Assert(record.TransfersCompleted, chk.Equals, uint32(2))
+	c.Assert(record.TransfersFailed, chk.Equals, uint32(1))
+	c.Assert(record.TransfersSkipped, chk.Equals, uint32(1))
+	c.Assert(record.BytesTransferred, chk.Equals, uint64(1024))
+	c.Assert(record.EndTime.Before(record.StartTime), chk.Equals, false)
+}
+
+func (s *jobStatsSuite) TestAppendAndReadJobStats(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobStats")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	// nothing recorded yet
+	records, err := ReadJobStats(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(records, chk.HasLen, 0)
+
+	start := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	first := common.JobStatsRecord{JobID: common.NewJobID(), SourceEndpoint: "local", StartTime: start, EndTime: start.Add(time.Minute), BytesTransferred: 100}
+	second := common.JobStatsRecord{JobID: common.NewJobID(), SourceEndpoint: "local", StartTime: start, EndTime: start.Add(time.Hour), BytesTransferred: 200}
+	c.Assert(appendJobStatsRecord(common.JobStatsFilePath(dir), first), chk.IsNil)
+	c.Assert(appendJobStatsRecord(common.JobStatsFilePath(dir), second), chk.IsNil)
+
+	// a partly-written line is skipped
+	f, err := os.OpenFile(common.JobStatsFilePath(dir), os.O_WRONLY|os.O_APPEND, 0644)
+	c.Assert(err, chk.IsNil)
+	_, _ = f.WriteString(`{"jobId":"`)
+	_ = f.Close()
+
+	records, err = ReadJobStats(dir)
+	c.Assert(err, chk.IsNil)
+	c.Assert(records, chk.HasLen, 2)
+	c.Assert(records[0].JobID, chk.Equals, first.JobID)
+	c.Assert(records[1].EndTime.Equal(second.EndTime), chk.Equals, true)
+	c.Assert(records[1].BytesTransferred, chk.Equals, uint64(200))
+}
+
+func (s *jobStatsSuite) TestTrimJobStatsFile(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobStats")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stats.jsonl")
+	c.Assert(ioutil.WriteFile(path, []byte("1\n2\n3\n4\n5\n6\n"), 0644), chk.IsNil)
+	c.Assert(trimJobStatsFile(path), chk.IsNil)
+
+	// the older half is dropped, at a line boundary
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Split(strings.TrimSpace(string(data)), "\n"), chk.DeepEquals, []string{"4", "5", "6"})
+}
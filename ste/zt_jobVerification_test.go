@@ -0,0 +1,117 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type jobVerificationSuite struct{}
+
+var _ = chk.Suite(&jobVerificationSuite{})
+
+func (s *jobVerificationSuite) TestLocalProperties(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobVerification")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(path, []byte("hello"), 0644), chk.IsNil)
+
+	props, err := getObjectProperties(context.Background(), common.ELocation.Local(), path, "", nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.exists, chk.Equals, true)
+	c.Assert(props.size, chk.Equals, int64(5))
+
+	hash, err := localFileMD5(path)
+	c.Assert(err, chk.IsNil)
+	expected := md5.Sum([]byte("hello"))
+	c.Assert(hash, chk.DeepEquals, expected[:])
+
+	props, err = getObjectProperties(context.Background(), common.ELocation.Local(), filepath.Join(dir, "missing"), "", nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.exists, chk.Equals, false)
+}
+
+func (s *jobVerificationSuite) TestBlobProperties(c *chk.C) {
+	hash := md5.Sum([]byte("hello"))
+	var sig string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig = r.URL.Query().Get("sig")
+		if r.URL.Path != "/container/blob" {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "5")
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(hash[:]))
+		w.Header().Set("Last-Modified", "Tue, 02 Jun 2020 10:00:00 GMT")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
+
+	props, err := getObjectProperties(context.Background(), common.ELocation.Blob(), server.URL+"/container/blob", "sig=abc", p)
+	c.Assert(err, chk.IsNil)
+	c.Assert(sig, chk.Equals, "abc")
+	c.Assert(props.exists, chk.Equals, true)
+	c.Assert(props.size, chk.Equals, int64(5))
+	c.Assert(props.contentMD5, chk.DeepEquals, hash[:])
+	c.Assert(props.lastModified.Unix(), chk.Equals, int64(1591092000))
+
+	props, err = getObjectProperties(context.Background(), common.ELocation.Blob(), server.URL+"/container/other", "", p)
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.exists, chk.Equals, false)
+}
+
+func (s *jobVerificationSuite) TestCheckpointCarriesOverToTheReport(c *chk.C) {
+	dir, err := ioutil.TempDir("", "jobVerification")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	v := &jobVerifier{checkpointPath: filepath.Join(dir, "job.verify-checkpoint")}
+	c.Assert(ioutil.WriteFile(v.checkpointPath, []byte(
+		`{"partNum":0,"transferIndex":0,"hashChecked":true}`+"\n"+
+			`{"partNum":0,"transferIndex":1,"hashChecked":false}`+"\n"+
+			`{"partNum":1,"transferIndex":0,"hashChecked":false,"problem":"the destination does not exist","src":"/a","dst":"https://b"}`+"\n"+
+			`{"partNum":1,"transferIndex":1,"hash`), 0644), chk.IsNil)
+
+	verified, err := v.readCheckpoint()
+	c.Assert(err, chk.IsNil)
+	c.Assert(verified, chk.HasLen, 3)
+	c.Assert(verified[verifiedTransfer{1, 0}], chk.Equals, true)
+	c.Assert(verified[verifiedTransfer{1, 1}], chk.Equals, false)
+
+	c.Assert(v.report.TransfersVerified, chk.Equals, uint32(3))
+	c.Assert(v.report.HashesNotChecked, chk.Equals, uint32(1))
+	c.Assert(v.report.Discrepancies, chk.DeepEquals, []common.VerificationDiscrepancy{
+		{Src: "/a", Dst: "https://b", Problem: "the destination does not exist"}})
+}
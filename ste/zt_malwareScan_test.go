@@ -0,0 +1,64 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	chk "gopkg.in/check.v1"
+)
+
+type malwareScanSuite struct{}
+
+var _ = chk.Suite(&malwareScanSuite{})
+
+func (s *malwareScanSuite) TestScanFile(c *chk.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("the scan commands of this test need a Unix shell")
+	}
+	dir, err := ioutil.TempDir("", "malwareScan")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sample.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("X5O!P%@AP EICAR test\n"), 0644), chk.IsNil)
+
+	// the scanner sees the content of the file on its standard input, and reports through its exit code
+	scanner := []string{"sh", "-c", `if grep -q EICAR; then echo "stream: Eicar-Signature FOUND"; echo more; exit 1; fi`}
+	infected, report, err := scanFile(context.Background(), scanner, path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(infected, chk.Equals, true)
+	c.Assert(report, chk.Equals, "stream: Eicar-Signature FOUND")
+
+	infected, _, err = scanFile(context.Background(), []string{"sh", "-c", "cat > /dev/null"}, path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(infected, chk.Equals, false)
+
+	// any other exit code is a failure of the scan, not a verdict
+	_, _, err = scanFile(context.Background(), []string{"sh", "-c", "echo cannot connect to clamd; exit 2"}, path)
+	c.Assert(err, chk.ErrorMatches, ".*cannot connect to clamd")
+
+	_, _, err = scanFile(context.Background(), []string{"sh", "-c", "true"}, filepath.Join(dir, "missing.txt"))
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,179 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type managedDiskSuite struct{}
+
+var _ = chk.Suite(&managedDiskSuite{})
+
+// makeFixedVhd returns a fixed VHD holding dataSize bytes of (zero) disk data
+func (s *managedDiskSuite) makeFixedVhd(dataSize int64) []byte {
+	vhd := make([]byte, dataSize+vhdFooterSize)
+	var footer vhdFooter
+	copy(footer[:], vhdCookie)
+	binary.BigEndian.PutUint32(footer[vhdDiskTypeOffset:], vhdDiskTypeFixed)
+	footer.setCurrentSize(dataSize)
+	copy(vhd[dataSize:], footer[:])
+	return vhd
+}
+
+func (s *managedDiskSuite) TestReadVhdFooter(c *chk.C) {
+	vhd := s.makeFixedVhd(4096)
+	footer, isVhd, err := readVhdFooter(bytes.NewReader(vhd), int64(len(vhd)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(isVhd, chk.Equals, true)
+	c.Assert(footer.currentSize(), chk.Equals, int64(4096))
+	c.Assert(footer.validateForManagedDisk(int64(len(vhd))), chk.IsNil)
+
+	// raw images, and tiny files, are not VHDs
+	raw := make([]byte, 4096)
+	_, isVhd, err = readVhdFooter(bytes.NewReader(raw), int64(len(raw)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(isVhd, chk.Equals, false)
+	_, isVhd, err = readVhdFooter(bytes.NewReader(raw[:100]), 100)
+	c.Assert(err, chk.IsNil)
+	c.Assert(isVhd, chk.Equals, false)
+}
+
+func (s *managedDiskSuite) TestVhdFooterValidation(c *chk.C) {
+	vhd := s.makeFixedVhd(4096)
+	footer, _ := parseVhdFooter(vhd[4096:])
+
+	// wrong size for the file it's in
+	c.Assert(footer.validateForManagedDisk(8192+vhdFooterSize), chk.NotNil)
+
+	// dynamic VHDs can't be used
+	dynamic := footer
+	binary.BigEndian.PutUint32(dynamic[vhdDiskTypeOffset:], 3)
+	dynamic.setCurrentSize(4096)
+	c.Assert(dynamic.validateForManagedDisk(int64(len(vhd))), chk.ErrorMatches, ".*only fixed size VHDs.*")
+
+	// corruption is detected by the checksum
+	corrupt := footer
+	corrupt[100]++
+	c.Assert(corrupt.checksumIsValid(), chk.Equals, false)
+	c.Assert(corrupt.validateForManagedDisk(int64(len(vhd))), chk.ErrorMatches, ".*checksum.*")
+}
+
+func (s *managedDiskSuite) TestRelocatedFooterDescribesDisk(c *chk.C) {
+	vhd := s.makeFixedVhd(4096)
+	footer, _ := parseVhdFooter(vhd[4096:])
+
+	const diskSize = 1024 * 1024
+	footer.setCurrentSize(diskSize - vhdFooterSize)
+
+	c.Assert(footer.checksumIsValid(), chk.Equals, true)
+	c.Assert(footer.validateForManagedDisk(diskSize), chk.IsNil)
+}
+
+func (s *managedDiskSuite) TestIsManagedDiskURL(c *chk.C) {
+	c.Assert(isManagedDiskURL("https://md-impexp-abc.blob.core.windows.net/xyz/abcd?sv=x"), chk.Equals, true)
+	c.Assert(isManagedDiskURL("https://md-abc.blob.core.windows.net/xyz/abcd?sv=x"), chk.Equals, true)
+	c.Assert(isManagedDiskURL("https://account.blob.core.windows.net/container/disk.vhd"), chk.Equals, false)
+}
+
+func (s *managedDiskSuite) TestDiskExportProgress(c *chk.C) {
+	dir, err := ioutil.TempDir("", "diskexport")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	const sourceSize = 3 * diskExportProgressInterval
+	source := diskExportSource{size: sourceSize, lastModified: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC), eTag: `"0x8D8AEC0F2B4D3C1"`}
+	destination := filepath.Join(dir, "disk.vhd")
+	file, err := os.Create(destination)
+	c.Assert(err, chk.IsNil)
+	c.Assert(file.Truncate(sourceSize), chk.IsNil)
+
+	// nothing is recorded until we start
+	_, ok := readDiskExportProgress(destination, source)
+	c.Assert(ok, chk.Equals, false)
+
+	w, err := newDiskExportProgressWriter(file, destination, source, 0)
+	c.Assert(err, chk.IsNil)
+	offset, ok := readDiskExportProgress(destination, source)
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(offset, chk.Equals, int64(0))
+
+	// progress is saved periodically, and on close
+	chunk := make([]byte, diskExportProgressInterval/2)
+	for i := 0; i < 3; i++ {
+		_, err = w.Write(chunk)
+		c.Assert(err, chk.IsNil)
+	}
+	offset, _ = readDiskExportProgress(destination, source)
+	c.Assert(offset, chk.Equals, int64(diskExportProgressInterval))
+	c.Assert(w.Close(), chk.IsNil)
+	offset, _ = readDiskExportProgress(destination, source)
+	c.Assert(offset, chk.Equals, int64(3*len(chunk)))
+
+	// the record doesn't apply to a different source, or to another version of the same one
+	resized := source
+	resized.size++
+	_, ok = readDiskExportProgress(destination, resized)
+	c.Assert(ok, chk.Equals, false)
+	rewritten := source
+	rewritten.eTag = `"0x8D8AEC0F2B4D3C2"`
+	_, ok = readDiskExportProgress(destination, rewritten)
+	c.Assert(ok, chk.Equals, false)
+	touched := source
+	touched.lastModified = touched.lastModified.Add(time.Second)
+	_, ok = readDiskExportProgress(destination, touched)
+	c.Assert(ok, chk.Equals, false)
+
+	// nor to a source whose version we don't know
+	_, ok = readDiskExportProgress(destination, diskExportSource{size: sourceSize})
+	c.Assert(ok, chk.Equals, false)
+
+	// a resumed download carries on writing where the last one stopped
+	file, err = openDiskExportDestination(destination, offset)
+	c.Assert(err, chk.IsNil)
+	w, err = newDiskExportProgressWriter(file, destination, source, offset)
+	c.Assert(err, chk.IsNil)
+	_, err = w.Write([]byte("abc"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(w.Close(), chk.IsNil)
+	data, err := ioutil.ReadFile(destination)
+	c.Assert(err, chk.IsNil)
+	c.Assert(len(data), chk.Equals, sourceSize)
+	c.Assert(string(data[offset:offset+3]), chk.Equals, "abc")
+
+	// and the whole of it is hashed again, for the MD5 check
+	hash, err := hashDiskExport(destination)
+	c.Assert(err, chk.IsNil)
+	expected := md5.Sum(data)
+	c.Assert(hash, chk.DeepEquals, expected[:])
+
+	c.Assert(w.removeProgress(), chk.IsNil)
+	_, ok = readDiskExportProgress(destination, source)
+	c.Assert(ok, chk.Equals, false)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type memoryBudgetSuite struct{}
+
+var _ = chk.Suite(&memoryBudgetSuite{})
+
+const oneGB = 1024 * 1024 * 1024
+
+func (s *memoryBudgetSuite) TestNoMemoryBudget(c *chk.C) {
+	c.Assert(limitChunkRamToMemoryBudget(16*oneGB, 0), chk.Equals, int64(16*oneGB))
+	c.Assert(maxPooledSliceBytesInMemoryBudget(0), chk.Equals, int64(0))
+
+	max := &ConfiguredInt{maxTunedMainPoolSize, false, "AZCOPY_CONCURRENCY_VALUE", "auto-tuning limit"}
+	initial, newMax := limitMainPoolSizeToMemoryBudget(4, max, 0)
+	c.Assert(initial, chk.Equals, 4)
+	c.Assert(newMax, chk.Equals, max)
+}
+
+func (s *memoryBudgetSuite) TestMemoryBudgetLimitsChunksAndPool(c *chk.C) {
+	budget := int64(2 * oneGB)
+	c.Assert(limitChunkRamToMemoryBudget(16*oneGB, budget), chk.Equals, int64(float64(budget)*chunkShareOfMemoryBudget))
+	c.Assert(limitChunkRamToMemoryBudget(oneGB/2, budget), chk.Equals, int64(oneGB/2)) // already small enough
+	c.Assert(maxPooledSliceBytesInMemoryBudget(budget), chk.Equals, int64(float64(budget)*slicePoolShareOfMemoryBudget))
+}
+
+func (s *memoryBudgetSuite) TestMemoryBudgetLimitsMainPool(c *chk.C) {
+	// a tenth of 1 GB, at 256 KB per connection, leaves room for 409 of them
+	max := &ConfiguredInt{maxTunedMainPoolSize, false, "AZCOPY_CONCURRENCY_VALUE", "auto-tuning limit"}
+	initial, newMax := limitMainPoolSizeToMemoryBudget(4, max, oneGB)
+	c.Assert(initial, chk.Equals, 4)
+	c.Assert(newMax.Value, chk.Equals, 409)
+	c.Assert(newMax.GetDescription(), chk.Equals, "Based on AZCOPY_MAX_MEMORY_GB environment variable")
+
+	// fixed sizes are reduced too
+	max = &ConfiguredInt{500, true, "AZCOPY_CONCURRENCY_VALUE", ""}
+	initial, newMax = limitMainPoolSizeToMemoryBudget(500, max, oneGB/4)
+	c.Assert(initial, chk.Equals, 102)
+	c.Assert(newMax.Value, chk.Equals, 102)
+
+	// but never to almost nothing
+	initial, newMax = limitMainPoolSizeToMemoryBudget(500, max, 1024*1024)
+	c.Assert(initial, chk.Equals, minMainPoolSizeInMemoryBudget)
+	c.Assert(newMax.Value, chk.Equals, minMainPoolSizeInMemoryBudget)
+
+	// already within the budget
+	max = &ConfiguredInt{32, false, "AZCOPY_CONCURRENCY_VALUE", "number of CPUs"}
+	initial, newMax = limitMainPoolSizeToMemoryBudget(32, max, oneGB)
+	c.Assert(initial, chk.Equals, 32)
+	c.Assert(newMax, chk.Equals, max)
+}
+
+func (s *memoryBudgetSuite) TestBlockSizeFitsInChunkRam(c *chk.C) {
+	// a 1 GB budget leaves 0.6 GB for chunks, of which a chunk can only take the strict share
+	maxRam := limitChunkRamToMemoryBudget(16*oneGB, oneGB)
+	max := maxBlockSizeForChunkRam(maxRam)
+	c.Assert(max, chk.Equals, int64(float64(maxRam)*cacheLimiterStrictShare))
+
+	c.Assert(limitBlockSizeToChunkRam(8*1024*1024, maxRam), chk.Equals, uint32(8*1024*1024))
+	limited := limitBlockSizeToChunkRam(4000*1024*1024, maxRam)
+	c.Assert(int64(limited) <= max, chk.Equals, true)
+	c.Assert(limited%azblob.PageBlobPageBytes, chk.Equals, uint32(0))
+
+	// never nothing at all, however tiny the budget
+	c.Assert(limitBlockSizeToChunkRam(8*1024*1024, 100), chk.Equals, uint32(azblob.PageBlobPageBytes))
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type networkDiagnosticsSuite struct{}
+
+var _ = chk.Suite(&networkDiagnosticsSuite{})
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (s *networkDiagnosticsSuite) TestDiagnosesOnceAfterRepeatedTimeouts(c *chk.C) {
+	logged := make(chan string, 10)
+	probed := make(chan int, 10)
+	d := newNetworkDiagnostics(func(ctx context.Context, scheme string, host string, size int) error {
+		probed <- size
+		if size > 1024 {
+			return timeoutError{}
+		}
+		return nil
+	}, func(msg string) { logged <- msg })
+
+	d.recordError("https", "a.blob.core.windows.net", errors.New("not a timeout"))
+	d.recordError("https", "a.blob.core.windows.net", timeoutError{})
+	d.recordError("https", "a.blob.core.windows.net", timeoutError{})
+	d.recordError("https", "b.blob.core.windows.net", timeoutError{})
+	c.Assert(len(probed), chk.Equals, 0)
+
+	d.recordError("https", "a.blob.core.windows.net", &url.Error{Op: "Put", URL: "https://a", Err: timeoutError{}})
+	select {
+	case msg := <-logged:
+		c.Assert(strings.Contains(msg, "a.blob.core.windows.net"), chk.Equals, true)
+		c.Assert(strings.Contains(msg, "MTU blackhole"), chk.Equals, true, chk.Commentf(msg))
+	case <-time.After(10 * time.Second):
+		c.Fatal("no diagnostic was logged")
+	}
+	c.Assert(len(probed), chk.Equals, len(networkProbeSizes))
+
+	// the host is only tested once
+	for i := 0; i < 5; i++ {
+		d.recordError("https", "a.blob.core.windows.net", timeoutError{})
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(len(logged), chk.Equals, 0)
+}
+
+func (s *networkDiagnosticsSuite) TestHints(c *chk.C) {
+	ok := func(size int, elapsed time.Duration) networkProbeResult {
+		return networkProbeResult{size: size, elapsed: elapsed}
+	}
+	failed := networkProbeResult{size: 1024 * 1024, elapsed: networkProbeTimeout, err: timeoutError{}}
+
+	unreachable := networkDiagnosticHint([]networkProbeResult{{err: timeoutError{}}, failed, failed})
+	c.Assert(strings.Contains(unreachable, "unreachable"), chk.Equals, true)
+
+	mtu := networkDiagnosticHint([]networkProbeResult{ok(0, 50*time.Millisecond), failed, failed})
+	c.Assert(strings.Contains(mtu, "possible MTU blackhole"), chk.Equals, true)
+	c.Assert(strings.Contains(mtu, "can't tell why"), chk.Equals, true)
+
+	slow := networkDiagnosticHint([]networkProbeResult{ok(0, 50*time.Millisecond), ok(16*1024, time.Second), ok(1024*1024, 20*time.Second)})
+	c.Assert(strings.Contains(slow, "very slow"), chk.Equals, true)
+
+	fine := networkDiagnosticHint([]networkProbeResult{ok(0, 50*time.Millisecond), ok(16*1024, 60*time.Millisecond), ok(1024*1024, 200*time.Millisecond)})
+	c.Assert(strings.Contains(fine, "quickly"), chk.Equals, true)
+}
+
+func (s *networkDiagnosticsSuite) TestHTTPProbeCountsAnyResponse(c *chk.C) {
+	received := make(chan int64, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.ContentLength
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	probe := newHTTPNetworkProbe()
+	c.Assert(probe(context.Background(), u.Scheme, u.Host, 0), chk.IsNil)
+	c.Assert(probe(context.Background(), u.Scheme, u.Host, 16*1024), chk.IsNil)
+	c.Assert(<-received, chk.Equals, int64(0))
+	c.Assert(<-received, chk.Equals, int64(16*1024))
+}
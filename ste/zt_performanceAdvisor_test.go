@@ -23,6 +23,7 @@ package ste
 import (
 	"github.com/Azure/azure-storage-azcopy/common"
 	chk "gopkg.in/check.v1"
+	"strings"
 )
 
 type perfAdvisorSuite struct{}
@@ -147,3 +148,22 @@ func (s *perfAdvisorSuite) assertAdviceMatches(c *chk.C, caseName string, obtain
 
 // TODO: for conciseness, we don't check the Title or Reason of the advice objects that are generated.
 //    Should we?
+
+func (s *perfAdvisorSuite) TestPerfAdvisorDroppedIdleConnections(c *chk.C) {
+	a := &PerformanceAdvisor{
+		droppedIdleConnPercentage:   5,
+		mbps:                        100,
+		finalConcurrencyTunerReason: concurrencyReasonAtOptimum,
+		avgBytesPerFile:             8 * 1024 * 1024,
+	}
+	obtained := a.GetAdvice()
+
+	// it doesn't displace the analysis of what limited throughput
+	c.Assert(obtained, chk.HasLen, 2)
+	s.assertAdviceMatches(c, "droppedIdle", obtained, 0, EAdviceType.NetworkIsBottleneck())
+	s.assertAdviceMatches(c, "droppedIdle", obtained, 1, EAdviceType.IdleConnectionsDropped())
+	c.Assert(strings.Contains(obtained[1].Reason, common.EEnvironmentVariable.IdleConnectionTimeout().Name), chk.Equals, true)
+
+	a.droppedIdleConnPercentage = 0.5
+	c.Assert(a.GetAdvice(), chk.HasLen, 1)
+}
@@ -0,0 +1,109 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+)
+
+type permissionsSuite struct{}
+
+var _ = chk.Suite(&permissionsSuite{})
+
+type fakeAccessController struct {
+	ac     azbfs.AccessControl
+	setErr error
+	set    []azbfs.AccessControl
+}
+
+func (f *fakeAccessController) GetAccessControl(ctx context.Context) (azbfs.AccessControl, error) {
+	return f.ac, nil
+}
+
+func (f *fakeAccessController) SetAccessControl(ctx context.Context, ac azbfs.AccessControl) (*azbfs.PathUpdateResponse, error) {
+	f.set = append(f.set, ac)
+	return nil, f.setErr
+}
+
+func (s *permissionsSuite) TestDfsURL(c *chk.C) {
+	u, err := dfsURL("https://account.blob.core.windows.net/container/dir/file.txt?sig=x")
+	c.Assert(err, chk.IsNil)
+	c.Assert(u.String(), chk.Equals, "https://account.dfs.core.windows.net/container/dir/file.txt?sig=x")
+
+	_, err = dfsURL("https://account.file.core.windows.net/share/file.txt")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *permissionsSuite) TestCommonFolders(c *chk.C) {
+	parse := func(raw string) url.URL {
+		u, err := url.Parse(raw)
+		c.Assert(err, chk.IsNil)
+		return *u
+	}
+	src := parse("https://a.dfs.core.windows.net/c1/a/b/c/file.txt?sig=src")
+	dst := parse("https://b.dfs.core.windows.net/c2/x/b/c/file.txt?sig=dst")
+
+	folders := commonFolders(src, dst)
+	c.Assert(folders, chk.HasLen, 2)
+	c.Assert(folders[0][0].String(), chk.Equals, "https://a.dfs.core.windows.net/c1/a/b/c?sig=src")
+	c.Assert(folders[0][1].String(), chk.Equals, "https://b.dfs.core.windows.net/c2/x/b/c?sig=dst")
+	c.Assert(folders[1][0].String(), chk.Equals, "https://a.dfs.core.windows.net/c1/a/b?sig=src")
+	c.Assert(folders[1][1].String(), chk.Equals, "https://b.dfs.core.windows.net/c2/x/b?sig=dst")
+
+	// the containers are not directories
+	c.Assert(commonFolders(parse("https://a.dfs.core.windows.net/c/file.txt"), parse("https://b.dfs.core.windows.net/c/file.txt")), chk.HasLen, 0)
+
+	// renamed files don't line up
+	c.Assert(commonFolders(parse("https://a.dfs.core.windows.net/c/d/file.txt"), parse("https://b.dfs.core.windows.net/c/d/other.txt")), chk.HasLen, 0)
+}
+
+func (s *permissionsSuite) TestCopyAccessControl(c *chk.C) {
+	src := &fakeAccessController{ac: azbfs.AccessControl{Owner: "o", Group: "g", Permissions: "rwxr-x---+", ACL: "user::rwx,user:u:r-x,group::r-x,mask::r-x,other::---"}}
+	dst := &fakeAccessController{}
+	c.Assert(copyAccessControl(context.Background(), src, dst), chk.IsNil)
+	c.Assert(dst.set, chk.DeepEquals, []azbfs.AccessControl{{Owner: "o", Group: "g", Permissions: "rwxr-x---", ACL: src.ac.ACL}})
+
+	// the sticky bit isn't part of the ACL, so it's set separately
+	src.ac.Permissions = "rwxrwxrwt"
+	dst = &fakeAccessController{}
+	c.Assert(copyAccessControl(context.Background(), src, dst), chk.IsNil)
+	c.Assert(dst.set, chk.HasLen, 2)
+	c.Assert(dst.set[1], chk.DeepEquals, azbfs.AccessControl{Permissions: "rwxrwxrwt"})
+
+	dst = &fakeAccessController{setErr: errors.New("forbidden")}
+	c.Assert(copyAccessControl(context.Background(), src, dst), chk.NotNil)
+}
+
+func (s *permissionsSuite) TestFolderPermissionsAreCopiedOnce(c *chk.C) {
+	t := newFolderPermissionsTracker()
+	c.Assert(t.claim("b.dfs.core.windows.net/c/d"), chk.Equals, true)
+	c.Assert(t.claim("b.dfs.core.windows.net/c/d"), chk.Equals, false)
+
+	// a directory that failed is tried again by the next transfer
+	t.release("b.dfs.core.windows.net/c/d")
+	c.Assert(t.claim("b.dfs.core.windows.net/c/d"), chk.Equals, true)
+}
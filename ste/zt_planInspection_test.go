@@ -0,0 +1,117 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type planInspectionSuite struct{}
+
+var _ = chk.Suite(&planInspectionSuite{})
+
+func (s *planInspectionSuite) writePlan(c *chk.C, dir string, name string, header []byte, commandString string) string {
+	plan := planForTest(header, commandString)
+	// mark the second transfer as failed
+	second := unsafe.Sizeof(JobPartPlanTransfer{})*1 + uintptr(len(header)+len(commandString))
+	t := (*JobPartPlanTransfer)(unsafe.Pointer(&plan[second]))
+	t.SetTransferStatus(common.ETransferStatus.Failed(), true)
+
+	path := filepath.Join(dir, name)
+	c.Assert(ioutil.WriteFile(path, plan, 0644), chk.IsNil)
+	return path
+}
+
+func (s *planInspectionSuite) TestInspectPlanFiles(c *chk.C) {
+	dir, err := ioutil.TempDir("", "planInspection")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	const commandString = "copy /src /dst --recursive"
+	h := (&planMigrationSuite{}).currentHeader(commandString)
+	h.FromTo = common.EFromTo.LocalBlob()
+	h.IsFinalPart = true
+	headerBytes := (*[unsafe.Sizeof(JobPartPlanHeader{})]byte)(unsafe.Pointer(&h))[:]
+
+	// a plan of this version
+	path := s.writePlan(c, dir, h.JobID.String()+fmt.Sprintf("--00003.steV%d", DataSchemaVersion), headerBytes, commandString)
+	inspection, err := InspectPlanFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(inspection.Notes, chk.HasLen, 0)
+	c.Assert(inspection.JobID, chk.Equals, h.JobID)
+	c.Assert(inspection.PartNum, chk.Equals, common.PartNumber(3))
+	c.Assert(inspection.IsFinalPart, chk.Equals, true)
+	c.Assert(inspection.FromTo, chk.Equals, common.EFromTo.LocalBlob())
+	c.Assert(inspection.SourceRoot, chk.Equals, "/src")
+	c.Assert(inspection.CommandString, chk.Equals, commandString)
+	c.Assert(*inspection.JobStatus, chk.Equals, common.EJobStatus.Paused())
+	c.Assert(inspection.Labels, chk.DeepEquals, map[string]string{"a": "b"})
+	c.Assert(inspection.TransferStatusCounts, chk.DeepEquals, map[string]uint32{"NotStarted": 1, "Failed": 1})
+	c.Assert(inspection.Transfers, chk.HasLen, 2)
+	c.Assert(inspection.Transfers[1].Source, chk.Equals, "/src/src/dir/b.txt")
+	c.Assert(inspection.Transfers[1].Destination, chk.Equals, "/dst/dst/dir/b.txt")
+	c.Assert(inspection.Transfers[1].Status, chk.Equals, common.ETransferStatus.Failed())
+
+	// a plan of an older version is migrated in memory, and left as it was
+	copyPlanV10Files(c, dir)
+	path = filepath.Join(dir, planV10Files[0])
+	inspection, err = InspectPlanFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(inspection.MigratedFrom, chk.Equals, common.Version(10))
+	c.Assert(inspection.CommandString, chk.Equals, "copy https://src.blob.core.windows.net/container https://dst.blob.core.windows.net/container --recursive")
+	c.Assert(inspection.TransferStatusCounts, chk.DeepEquals, map[string]uint32{"Success": 1, "Failed": 1, "Started": 1})
+	c.Assert(inspection.Transfers[1].Source, chk.Equals, "https://src.blob.core.windows.net/container/dir/b.bin")
+	_, err = os.Stat(path)
+	c.Assert(err, chk.IsNil)
+
+	// of a plan of a newer version, only the constant fields are read
+	newer := make([]byte, len(headerBytes)+64)
+	copy(newer, headerBytes)
+	newer[0] = byte(DataSchemaVersion + 1)
+	path = s.writePlan(c, dir, h.JobID.String()+fmt.Sprintf("--00003.steV%d", DataSchemaVersion+1), newer, commandString)
+	inspection, err = InspectPlanFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(inspection.Notes, chk.HasLen, 1)
+	c.Assert(inspection.JobID, chk.Equals, h.JobID)
+	c.Assert(inspection.SourceRoot, chk.Equals, "/src")
+	c.Assert(inspection.CommandString, chk.Equals, "")
+	c.Assert(inspection.JobStatus, chk.IsNil)
+	c.Assert(inspection.Transfers, chk.HasLen, 0)
+
+	// a truncated plan
+	plan, err := ioutil.ReadFile(filepath.Join(dir, h.JobID.String()+fmt.Sprintf("--00003.steV%d", DataSchemaVersion)))
+	c.Assert(err, chk.IsNil)
+	path = filepath.Join(dir, fmt.Sprintf("truncated.steV%d", DataSchemaVersion))
+	c.Assert(ioutil.WriteFile(path, plan[:len(headerBytes)+10], 0644), chk.IsNil)
+	inspection, err = InspectPlanFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(inspection.Notes, chk.HasLen, 1)
+	c.Assert(inspection.JobID, chk.Equals, h.JobID)
+	c.Assert(inspection.NumTransfers, chk.Equals, uint32(2))
+	c.Assert(inspection.JobStatus, chk.IsNil)
+}
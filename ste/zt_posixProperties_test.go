@@ -0,0 +1,102 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type posixPropertiesSuite struct{}
+
+var _ = chk.Suite(&posixPropertiesSuite{})
+
+func (s *posixPropertiesSuite) TestPolicySendsPosixPropertiesToNFSShares(c *chk.C) {
+	var sent http.Header
+	sender := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			sent = request.Header
+			return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusCreated}), nil
+		}
+	})
+	p := pipeline.NewPipeline([]pipeline.Factory{NewVersionPolicyFactory(), newPosixPropertiesPolicyFactory(), sender}, pipeline.Options{})
+
+	send := func(ctx context.Context) http.Header {
+		u, _ := url.Parse("https://account.file.core.windows.net/share/dir/file")
+		request, err := pipeline.NewRequest(http.MethodPut, *u, nil)
+		c.Assert(err, chk.IsNil)
+		request.Header.Set("x-ms-file-permission", "inherit")
+		request.Header.Set("x-ms-file-attributes", "None")
+		_, err = p.Do(ctx, nil, request)
+		c.Assert(err, chk.IsNil)
+		return sent
+	}
+
+	// SMB shares are left alone
+	h := send(context.WithValue(context.Background(), ServiceAPIVersionOverride, "2019-02-02"))
+	c.Assert(h.Get("x-ms-file-permission"), chk.Equals, "inherit")
+	c.Assert(h.Get("x-ms-mode"), chk.Equals, "")
+
+	// directories in NFS shares get no SMB properties
+	nfs := context.WithValue(context.Background(), ServiceAPIVersionOverride, nfsServiceVersion)
+	h = send(nfs)
+	c.Assert(h.Get("x-ms-file-permission"), chk.Equals, "")
+	c.Assert(h.Get("x-ms-file-attributes"), chk.Equals, "")
+	c.Assert(h.Get("x-ms-owner"), chk.Equals, "")
+
+	h = send(withPosixProperties(nfs, common.PosixProperties{Owner: "1000", Group: "100", Mode: "0640"}))
+	c.Assert(h.Get("x-ms-file-permission"), chk.Equals, "")
+	c.Assert(h.Get("x-ms-owner"), chk.Equals, "1000")
+	c.Assert(h.Get("x-ms-group"), chk.Equals, "100")
+	c.Assert(h.Get("x-ms-mode"), chk.Equals, "0640")
+}
+
+func (s *posixPropertiesSuite) TestPosixFoldersOfDownloadStayInTheDestination(c *chk.C) {
+	if os.PathSeparator != '/' {
+		c.Skip("the owner, group and mode of files are only preserved on Linux and macOS")
+	}
+	source, _ := url.Parse("https://account.file.core.windows.net/share/dir/a/file?sv=sas")
+
+	folders := posixFoldersOfDownload(*source, "/data/dir/a/file", "/data")
+	c.Assert(folders, chk.HasLen, 2)
+	c.Assert(folders[0][0].Path, chk.Equals, "/share/dir/a")
+	c.Assert(folders[0][0].RawQuery, chk.Equals, "sv=sas")
+	c.Assert(folders[0][1].Path, chk.Equals, "/data/dir/a")
+	c.Assert(folders[1][0].Path, chk.Equals, "/share/dir")
+	c.Assert(folders[1][1].Path, chk.Equals, "/data/dir")
+
+	// the directory that the job downloads into, and those above it, are left alone, even when their names match
+	folders = posixFoldersOfDownload(*source, "/dir/a/file", "/dir/a")
+	c.Assert(folders, chk.HasLen, 0)
+	folders = posixFoldersOfDownload(*source, "/data/dir/a/file", "/data/dir/")
+	c.Assert(folders, chk.HasLen, 1)
+	c.Assert(folders[0][1].Path, chk.Equals, "/data/dir/a")
+
+	// nor is anything listed when the file was renamed
+	c.Assert(posixFoldersOfDownload(*source, "/data/dir/a/renamed", "/data"), chk.HasLen, 0)
+}
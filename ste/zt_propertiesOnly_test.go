@@ -0,0 +1,95 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type propertiesOnlySuite struct{}
+
+var _ = chk.Suite(&propertiesOnlySuite{})
+
+func (s *propertiesOnlySuite) TestContentUnchanged(c *chk.C) {
+	now := time.Now()
+	older, newer := now.Add(-time.Hour), now.Add(time.Hour)
+	hashA, hashB := []byte{'a'}, []byte{'b'}
+
+	c.Assert(contentUnchanged(10, hashA, older, 20, hashA, now), chk.Not(chk.Equals), "")
+
+	// the hashes decide when both sides have one
+	c.Assert(contentUnchanged(10, hashA, newer, 10, hashA, now), chk.Equals, "")
+	c.Assert(contentUnchanged(10, hashA, older, 10, hashB, now), chk.Not(chk.Equals), "")
+
+	// otherwise a source modified after the destination was written may have been rewritten with the same size
+	c.Assert(contentUnchanged(10, nil, older, 10, hashB, now), chk.Equals, "")
+	c.Assert(contentUnchanged(10, hashA, newer, 10, nil, now), chk.Not(chk.Equals), "")
+}
+
+func (s *propertiesOnlySuite) TestBlobTagsAreReadAndReplaced(c *chk.C) {
+	var putBody, putQuery, putVersion string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/container/denied" {
+			w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("comp") != "tags" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><Tags><TagSet><Tag><Key>project</Key><Value>a &amp; b</Value></Tag><Tag><Key>tier</Key><Value></Value></Tag></TagSet></Tags>`))
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			putBody, putQuery, putVersion = string(body), r.URL.RawQuery, r.Header.Get("x-ms-version")
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := pipeline.NewPipeline([]pipeline.Factory{NewVersionPolicyFactory(), pipeline.MethodFactoryMarker()}, pipeline.Options{HTTPSender: newAzcopyHTTPClientFactory(server.Client())})
+	ctx := context.WithValue(context.Background(), ServiceAPIVersionOverride, "2018-03-28")
+	u, _ := url.Parse(server.URL + "/container/blob?sig=a%2Fb")
+
+	tags, err := getBlobTags(ctx, p, *u)
+	c.Assert(err, chk.IsNil)
+	c.Assert(tags, chk.DeepEquals, []blobTag{{Key: "project", Value: "a & b"}, {Key: "tier", Value: ""}})
+
+	c.Assert(setBlobTags(ctx, p, *u, tags), chk.IsNil)
+	c.Assert(putQuery, chk.Equals, "sig=a%2Fb&comp=tags")
+	c.Assert(putVersion, chk.Equals, BlobVersioningServiceVersion)
+	c.Assert(putBody, chk.Equals, "<Tags><TagSet><Tag><Key>project</Key><Value>a &amp; b</Value></Tag><Tag><Key>tier</Key><Value></Value></Tag></TagSet></Tags>")
+
+	// failures are errors, not empty tag sets
+	u, _ = url.Parse(server.URL + "/container/denied")
+	_, err = getBlobTags(ctx, p, *u)
+	c.Assert(err, chk.ErrorMatches, ".*403.*AuthorizationPermissionMismatch.*")
+	c.Assert(setBlobTags(ctx, p, *u, tags), chk.NotNil)
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type retryBufferSuite struct{}
+
+var _ = chk.Suite(&retryBufferSuite{})
+
+// removalCountingCacheLimiter counts the bytes given back to the limiter, i.e. freed from RAM
+type removalCountingCacheLimiter struct {
+	common.CacheLimiter
+	removed int64
+}
+
+func (l *removalCountingCacheLimiter) Remove(count int64) {
+	l.removed += count
+	l.CacheLimiter.Remove(count)
+}
+
+func (s *retryBufferSuite) TestChunkBufferIsReleasedWhileWaitingToRetry(c *chk.C) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	dir, err := ioutil.TempDir("", "retryBuffer")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "source")
+	c.Assert(ioutil.WriteFile(fileName, content, 0644), chk.IsNil)
+
+	ctx := context.Background()
+	length := int64(len(content))
+	cacheLimiter := &removalCountingCacheLimiter{CacheLimiter: common.NewCacheLimiter(1024 * 1024)}
+	sourceFactory := func() (common.CloseableReaderAt, error) { return os.Open(fileName) }
+	reader := common.NewSingleChunkReader(ctx, sourceFactory, common.NewChunkID(fileName, 0, length), length,
+		common.NewChunkStatusLogger(common.NewJobID(), common.NewNullCpuMonitor(), "", false), nullTestLogger{},
+		common.NewMultiSizeSlicePool(1024*1024), cacheLimiter)
+	defer reader.Close()
+	file, err := sourceFactory()
+	c.Assert(err, chk.IsNil)
+	c.Assert(reader.BlockingPrefetch(file, false), chk.IsNil)
+	file.Close()
+
+	var removedBeforeRetry int64
+	var bodies []string
+	tries := 0
+	next := pipeline.PolicyFunc(func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+		tries++
+		if tries == 1 {
+			// the service gives up part way through the body
+			_, _ = request.Body.Read(make([]byte, 100))
+			return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusServiceUnavailable, Body: ioutil.NopCloser(strings.NewReader(""))}), testNetError{}
+		}
+		removedBeforeRetry = cacheLimiter.removed
+		body, err := ioutil.ReadAll(request.Body)
+		c.Assert(err, chk.IsNil)
+		bodies = append(bodies, string(body))
+		return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(strings.NewReader(""))}), nil
+	})
+
+	policy := NewBlobXferRetryPolicyFactory(XferRetryOptions{
+		Policy:        RetryPolicyExponential,
+		MaxTries:      3,
+		TryTimeout:    time.Minute,
+		RetryDelay:    time.Millisecond,
+		MaxRetryDelay: time.Millisecond,
+	}).New(next, nil)
+
+	u, _ := url.Parse("https://account.blob.core.windows.net/container/blob")
+	request, err := pipeline.NewRequest(http.MethodPut, *u, newPacedRequestBody(ctx, reader, newNullAutoPacer()))
+	c.Assert(err, chk.IsNil)
+	_, err = policy.Do(withRetryBufferRelease(ctx, reader), request)
+	c.Assert(err, chk.IsNil)
+
+	// the buffer was freed before the retry, and the retry re-read the chunk from the source
+	c.Assert(tries, chk.Equals, 2)
+	c.Assert(removedBeforeRetry, chk.Equals, length)
+	c.Assert(bodies, chk.DeepEquals, []string{string(content)})
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type scanOverlapSuite struct{}
+
+var _ = chk.Suite(&scanOverlapSuite{})
+
+// newPartForTest creates and maps the plan of a part of a job, with a transfer of the given size for each status
+func (s *scanOverlapSuite) newPartForTest(c *chk.C, jobID common.JobID, partNum PartNumber, statuses []common.TransferStatus, size int64) *jobPartMgr {
+	order := common.CopyJobPartOrderRequest{JobID: jobID, PartNum: partNum, SourceRoot: "/src", DestinationRoot: "/dst"}
+	for i := range statuses {
+		name := fmt.Sprintf("/file%v", i)
+		order.Transfers = append(order.Transfers, common.CopyTransfer{Source: name, Destination: name, SourceSize: size})
+	}
+	name := JobPartPlanFileName(fmt.Sprintf(jobPartPlanFileNameFormat, jobID.String(), partNum, DataSchemaVersion))
+	name.Create(order)
+
+	mmf := name.Map()
+	for i, status := range statuses {
+		mmf.Plan().Transfer(uint32(i)).SetTransferStatus(status, true)
+	}
+	return &jobPartMgr{planMMF: mmf}
+}
+
+func (s *scanOverlapSuite) TestOverlapIsMeasuredWhenTheScanIsComplete(c *chk.C) {
+	dir, err := ioutil.TempDir("", "scanOverlap")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	previous := JobsAdmin
+	JobsAdmin = &jobsAdmin{planDir: dir, concurrency: NewConcurrencySettings(1000, false)}
+	defer func() { JobsAdmin = previous }()
+
+	jobID := common.NewJobID()
+	jm := &jobMgr{jobPartMgrs: newJobPartToJobPartMgr()}
+	tracker := newScanOverlapTracker()
+
+	// two parts are ordered while the scan goes on, and get some way through their transfers
+	statuses := [][]common.TransferStatus{
+		{common.ETransferStatus.Success(), common.ETransferStatus.Failed(), common.ETransferStatus.Started()},
+		{common.ETransferStatus.Success(), common.ETransferStatus.NotStarted()},
+	}
+	for partNum, partStatuses := range statuses {
+		tracker.recordPartOrdered(jm, false)
+		jpm := s.newPartForTest(c, jobID, PartNumber(partNum), partStatuses, 100)
+		defer jpm.planMMF.Unmap()
+		jm.jobPartMgrs.Set(PartNumber(partNum), jpm)
+	}
+	c.Assert(tracker.get(), chk.IsNil)
+
+	// the final part ends the scan, and what's done by then is what overlapped it
+	tracker.recordPartOrdered(jm, true)
+	overlap := tracker.get()
+	c.Assert(overlap, chk.NotNil)
+	c.Assert(overlap.PartsOrderedWhileScanning, chk.Equals, uint32(2))
+	c.Assert(overlap.OverlapSeconds >= 0, chk.Equals, true)
+	c.Assert(overlap.TransfersDoneWhileScanning, chk.Equals, uint32(3))
+	c.Assert(overlap.BytesTransferredWhileScanning, chk.Equals, uint64(200))
+
+	// parts ordered after the scan don't change it
+	tracker.recordPartOrdered(jm, true)
+	c.Assert(*tracker.get(), chk.Equals, *overlap)
+}
+
+func (s *scanOverlapSuite) TestNothingOverlapsWhenPartsAreHeldUntilTheScanIsComplete(c *chk.C) {
+	jm := &jobMgr{jobPartMgrs: newJobPartToJobPartMgr()}
+	tracker := newScanOverlapTracker()
+
+	// with enumerate-first, even the first part is ordered after the scan
+	tracker.recordPartOrdered(jm, true)
+	tracker.recordPartOrdered(jm, true)
+	c.Assert(*tracker.get(), chk.Equals, common.ScanOverlap{})
+}
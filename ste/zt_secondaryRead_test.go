@@ -0,0 +1,102 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type secondaryReadSuite struct{}
+
+var _ = chk.Suite(&secondaryReadSuite{})
+
+type testNetError struct{}
+
+func (testNetError) Error() string   { return "connection reset" }
+func (testNetError) Timeout() bool   { return false }
+func (testNetError) Temporary() bool { return true }
+
+func (s *secondaryReadSuite) TestGetSecondaryReadHost(c *chk.C) {
+	host, err := GetSecondaryReadHost("account.blob.core.windows.net")
+	c.Assert(err, chk.IsNil)
+	c.Assert(host, chk.Equals, "account-secondary.blob.core.windows.net")
+
+	for _, invalid := range []string{"localhost", "127.0.0.1:10000", "account-secondary.blob.core.windows.net"} {
+		_, err = GetSecondaryReadHost(invalid)
+		c.Assert(err, chk.NotNil, chk.Commentf(invalid))
+	}
+}
+
+func (s *secondaryReadSuite) TestFailoverToSecondaryIsSticky(c *chk.C) {
+	var hostsTried []string
+	next := pipeline.PolicyFunc(func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+		hostsTried = append(hostsTried, request.URL.Host)
+		if strings.Contains(request.URL.Host, "-secondary") {
+			return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}), nil
+		}
+		return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusServiceUnavailable, Body: ioutil.NopCloser(strings.NewReader(""))}), testNetError{}
+	})
+
+	tracker := newSecondaryReadTracker(nil)
+	policy := NewBlobXferRetryPolicyFactory(XferRetryOptions{
+		Policy:                      RetryPolicyExponential,
+		MaxTries:                    4,
+		TryTimeout:                  time.Minute,
+		RetryDelay:                  time.Millisecond,
+		MaxRetryDelay:               time.Millisecond,
+		RetryReadsFromSecondaryHost: "account-secondary.blob.core.windows.net",
+		secondaryReads:              tracker,
+	}).New(next, nil)
+
+	get := func() {
+		u, _ := url.Parse("https://account.blob.core.windows.net/container/blob")
+		request, err := pipeline.NewRequest(http.MethodGet, *u, nil)
+		c.Assert(err, chk.IsNil)
+		response, err := policy.Do(context.Background(), request)
+		c.Assert(err, chk.IsNil)
+		response.Response().Body.Close()
+	}
+
+	// the first read fails against the primary, and succeeds against the secondary
+	get()
+	c.Assert(hostsTried, chk.DeepEquals, []string{"account.blob.core.windows.net", "account-secondary.blob.core.windows.net"})
+	c.Assert(tracker.preferSecondary(), chk.Equals, true)
+
+	// the next read goes straight to the secondary, which doesn't extend the stickiness, since the primary wasn't tried
+	stickyUntil := tracker.atomicStickyUntil
+	hostsTried = nil
+	get()
+	c.Assert(hostsTried, chk.DeepEquals, []string{"account-secondary.blob.core.windows.net"})
+	c.Assert(tracker.atomicStickyUntil, chk.Equals, stickyUntil)
+
+	// until the stickiness runs out
+	tracker.atomicStickyUntil = time.Now().Add(-time.Second).UnixNano()
+	c.Assert(tracker.preferSecondary(), chk.Equals, false)
+	c.Assert(tracker.atomicStickyUntil, chk.Equals, int64(0))
+}
@@ -0,0 +1,228 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/sftp"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type sftpClientPoolSuite struct{}
+
+var _ = chk.Suite(&sftpClientPoolSuite{})
+
+// newInProcessSftpClient connects to an SFTP server, running in this process, that serves the local file system
+func newInProcessSftpClient() (*common.SftpClient, error) {
+	toServerReader, toServerWriter := io.Pipe()
+	toClientReader, toClientWriter := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{toServerReader, toClientWriter})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = server.Serve()
+		_ = toClientWriter.Close()
+	}()
+
+	client, err := sftp.NewClientPipe(toClientReader, toServerWriter)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewSftpClientOnConnection(client, nil), nil
+}
+
+func (s *sftpClientPoolSuite) newPool(maxConnections int, dials *int32) *sftpClientPool {
+	return newSftpClientPool(maxConnections, func(ctx context.Context) (*common.SftpClient, error) {
+		atomic.AddInt32(dials, 1)
+		return newInProcessSftpClient()
+	})
+}
+
+func (s *sftpClientPoolSuite) TestPoolReusesAndLimitsConnections(c *chk.C) {
+	dials := int32(0)
+	pool := s.newPool(2, &dials)
+
+	first, err := pool.acquire(context.Background())
+	c.Assert(err, chk.IsNil)
+	second, err := pool.acquire(context.Background())
+	c.Assert(err, chk.IsNil)
+
+	// a third must wait for one of the others to be released
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pool.acquire(ctx)
+	c.Assert(err, chk.Equals, context.DeadlineExceeded)
+
+	pool.release(first, nil)
+	third, err := pool.acquire(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(third, chk.Equals, first)
+	c.Assert(atomic.LoadInt32(&dials), chk.Equals, int32(2))
+
+	// a connection that failed other than by the server's report is closed, not reused
+	pool.release(second, errors.New("connection lost"))
+	pool.release(third, os.ErrNotExist)
+	c.Assert(pool.idle, chk.HasLen, 1)
+	c.Assert(pool.idle[0].client, chk.Equals, first)
+}
+
+func (s *sftpClientPoolSuite) TestIdleConnectionsAreCheckedAndExpired(c *chk.C) {
+	dials := int32(0)
+	pool := s.newPool(2, &dials)
+	ctx := context.Background()
+
+	// one that has been idle for a while is checked, and still works
+	first, err := pool.acquire(ctx)
+	c.Assert(err, chk.IsNil)
+	pool.release(first, nil)
+	pool.idle[0].since = time.Now().Add(-2 * sftpIdleCheckAfter)
+	reused, err := pool.acquire(ctx)
+	c.Assert(err, chk.IsNil)
+	c.Assert(reused, chk.Equals, first)
+
+	// but one that the server dropped while it was idle isn't handed out again
+	pool.release(first, nil)
+	pool.idle[0].since = time.Now().Add(-2 * sftpIdleCheckAfter)
+	_ = first.Client.Close()
+	second, err := pool.acquire(ctx)
+	c.Assert(err, chk.IsNil)
+	c.Assert(second, chk.Not(chk.Equals), first)
+	c.Assert(atomic.LoadInt32(&dials), chk.Equals, int32(2))
+
+	// and one that has been idle for too long is closed without being tried, whether it's taken or another is released
+	pool.release(second, nil)
+	pool.idle[0].since = time.Now().Add(-sftpMaxIdle)
+	third, err := pool.acquire(ctx)
+	c.Assert(err, chk.IsNil)
+	c.Assert(third, chk.Not(chk.Equals), second)
+	_, err = second.Getwd()
+	c.Assert(err, chk.NotNil)
+
+	fourth, err := pool.acquire(ctx)
+	c.Assert(err, chk.IsNil)
+	pool.release(third, nil)
+	pool.idle[0].since = time.Now().Add(-sftpMaxIdle)
+	pool.release(fourth, nil)
+	c.Assert(pool.idle, chk.HasLen, 1)
+	c.Assert(pool.idle[0].client, chk.Equals, fourth)
+	_, err = third.Getwd()
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *sftpClientPoolSuite) TestOperationsAreRetriedOnANewConnectionWhenTheirsBreaks(c *chk.C) {
+	dials := int32(0)
+	pool := s.newPool(1, &dials)
+	ctx := context.Background()
+
+	used := make([]*common.SftpClient, 0)
+	err := pool.do(ctx, func(client *common.SftpClient) error {
+		used = append(used, client)
+		if len(used) == 1 {
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	})
+	c.Assert(err, chk.IsNil)
+	c.Assert(used, chk.HasLen, 2)
+	c.Assert(used[1], chk.Not(chk.Equals), used[0])
+
+	// only once, and not for errors that the server reports
+	attempts := 0
+	err = pool.do(ctx, func(client *common.SftpClient) error {
+		attempts++
+		return errors.New("connection reset by peer")
+	})
+	c.Assert(err, chk.ErrorMatches, "connection reset by peer")
+	c.Assert(attempts, chk.Equals, 2)
+
+	attempts = 0
+	err = pool.do(ctx, func(client *common.SftpClient) error {
+		attempts++
+		return os.ErrNotExist
+	})
+	c.Assert(err, chk.Equals, os.ErrNotExist)
+	c.Assert(attempts, chk.Equals, 1)
+	c.Assert(atomic.LoadInt32(&dials), chk.Equals, int32(4))
+}
+
+func (s *sftpClientPoolSuite) TestReadAndWriteFiles(c *chk.C) {
+	dir, err := ioutil.TempDir("", "sftpPool")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	dials := int32(0)
+	pool := s.newPool(1, &dials)
+	ctx := context.Background()
+
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	filePath := filepath.ToSlash(filepath.Join(dir, "sub", "dir", "file.txt"))
+	err = pool.do(ctx, func(client *common.SftpClient) error {
+		return createSftpFile(client, filePath)
+	})
+	c.Assert(err, chk.IsNil)
+
+	// written in order, in pieces, as downloads save their chunks
+	meter := newBandwidthMeter()
+	w := newSftpFileWriter(ctx, pool, filePath, meter)
+	for _, piece := range [][]byte{content[:10], content[10:25], content[25:]} {
+		n, err := w.Write(piece)
+		c.Assert(err, chk.IsNil)
+		c.Assert(n, chk.Equals, len(piece))
+	}
+	c.Assert(w.Close(), chk.IsNil)
+
+	saved, err := ioutil.ReadFile(filePath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(saved), chk.Equals, string(content))
+
+	// ranges can be read in any order, and the last may be short
+	r := newSftpFileReader(ctx, pool, filePath, meter)
+	b := make([]byte, 5)
+	n, err := r.ReadAt(b, 4)
+	c.Assert(err, chk.IsNil)
+	c.Assert(string(b[:n]), chk.Equals, "quick")
+	b = make([]byte, 10)
+	n, err = r.ReadAt(b, int64(len(content)-3))
+	c.Assert(err, chk.Equals, io.EOF)
+	c.Assert(string(b[:n]), chk.Equals, "dog")
+	c.Assert(r.Close(), chk.IsNil)
+
+	// the data doesn't go through a pipeline, but counts towards the bandwidth used all the same
+	c.Assert(atomic.LoadInt64(&meter.atomicSent), chk.Equals, int64(len(content)))
+	c.Assert(atomic.LoadInt64(&meter.atomicReceived), chk.Equals, int64(len("quick")+len("dog")))
+
+	// everything shared the one connection
+	c.Assert(atomic.LoadInt32(&dials), chk.Equals, int32(1))
+}
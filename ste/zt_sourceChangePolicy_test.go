@@ -0,0 +1,115 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type sourceChangePolicySuite struct{}
+
+var _ = chk.Suite(&sourceChangePolicySuite{})
+
+func (s *sourceChangePolicySuite) TestParseSourceChangePolicy(c *chk.C) {
+	cases := map[string]common.SourceChangePolicy{
+		"fail":              common.ESourceChangePolicy.Fail(),
+		"Skip":              common.ESourceChangePolicy.Skip(),
+		"reschedule-latest": common.ESourceChangePolicy.RescheduleLatest(),
+		"RescheduleLatest":  common.ESourceChangePolicy.RescheduleLatest(),
+	}
+	for input, expected := range cases {
+		var policy common.SourceChangePolicy
+		c.Assert(policy.Parse(input), chk.IsNil)
+		c.Assert(policy, chk.Equals, expected)
+	}
+
+	var policy common.SourceChangePolicy
+	c.Assert(policy.Parse("overwrite"), chk.NotNil)
+}
+
+func (s *sourceChangePolicySuite) TestSourceChangedStatus(c *chk.C) {
+	c.Assert(sourceChangedStatus(common.ESourceChangePolicy.Fail()), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(sourceChangedStatus(common.ESourceChangePolicy.Skip()), chk.Equals, common.ETransferStatus.SkippedSourceChanged())
+
+	// data from the old version may already be at the destination, so the transfer must not look successful
+	c.Assert(sourceChangedStatus(common.ESourceChangePolicy.RescheduleLatest()), chk.Equals, common.ETransferStatus.Failed())
+}
+
+func (s *sourceChangePolicySuite) TestIsSourceConditionNotMet(c *chk.C) {
+	c.Assert(isSourceConditionNotMet(errors.New("precondition failed")), chk.Equals, false)
+	c.Assert(isSourceConditionNotMet(nil), chk.Equals, false)
+}
+
+// newStatusPipeline returns a pipeline that answers every request with the given status, recording the If-Match header it was sent
+func newStatusPipeline(status int, ifMatch *string) pipeline.Pipeline {
+	return pipeline.NewPipeline([]pipeline.Factory{pipeline.MethodFactoryMarker(), pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			*ifMatch = request.Header.Get("If-Match")
+			return pipeline.NewHTTPResponse(&http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+				Request:    request.Request,
+			}), nil
+		}
+	})}, pipeline.Options{})
+}
+
+func (s *sourceChangePolicySuite) TestCheckSourceETag(c *chk.C) {
+	const source = "https://account.blob.core.windows.net/container/blob"
+	var ifMatch string
+
+	err := checkSourceETag(context.Background(), common.EFromTo.BlobLocal(), source, "\"0x1\"", newStatusPipeline(http.StatusOK, &ifMatch))
+	c.Assert(err, chk.IsNil)
+	c.Assert(ifMatch, chk.Equals, "\"0x1\"")
+
+	err = checkSourceETag(context.Background(), common.EFromTo.BlobBlob(), source, "\"0x1\"", newStatusPipeline(http.StatusPreconditionFailed, &ifMatch))
+	c.Assert(err, chk.Equals, errSourceChangedSinceScan)
+
+	// without a recorded ETag, or from a source without ETags, nothing can be proven
+	c.Assert(checkSourceETag(context.Background(), common.EFromTo.BlobLocal(), source, "", newStatusPipeline(http.StatusOK, &ifMatch)), chk.NotNil)
+	c.Assert(checkSourceETag(context.Background(), common.EFromTo.LocalBlob(), "/tmp/file", "\"0x1\"", nil), chk.NotNil)
+}
+
+func (s *sourceChangePolicySuite) TestDownloadsAreConditionalOnTheETag(c *chk.C) {
+	lmt := time.Unix(1600000000, 0)
+
+	// the last modified time can't tell apart two writes in the same second, so the ETag is checked too
+	conditions := sourceUnchangedConditions(lmt, "\"0x1\"")
+	c.Assert(conditions.ModifiedAccessConditions.IfUnmodifiedSince.Equal(lmt), chk.Equals, true)
+	c.Assert(conditions.ModifiedAccessConditions.IfMatch, chk.Equals, azblob.ETag("\"0x1\""))
+
+	// plans of jobs that didn't record ETags still check the last modified time
+	conditions = sourceUnchangedConditions(lmt, "")
+	c.Assert(conditions.ModifiedAccessConditions.IfUnmodifiedSince.Equal(lmt), chk.Equals, true)
+	c.Assert(conditions.ModifiedAccessConditions.IfMatch, chk.Equals, azblob.ETagNone)
+}
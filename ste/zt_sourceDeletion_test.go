@@ -0,0 +1,96 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type sourceDeletionSuite struct{}
+
+var _ = chk.Suite(&sourceDeletionSuite{})
+
+func (s *sourceDeletionSuite) TestLocalSourceIsDeletedOnlyIfUnchanged(c *chk.C) {
+	dir, err := ioutil.TempDir("", "sourceDeletion")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("data"), 0666), chk.IsNil)
+	fi, err := os.Stat(path)
+	c.Assert(err, chk.IsNil)
+	transferredLmt := fi.ModTime()
+
+	// modified since it was transferred, so it is kept
+	changedLmt := transferredLmt.Add(-time.Hour)
+	err = deleteVerifiedSource(context.Background(), common.EFromTo.LocalBlob(), path, changedLmt, nil)
+	c.Assert(err, chk.Equals, errSourceChangedSinceTransfer)
+	_, err = os.Stat(path)
+	c.Assert(err, chk.IsNil)
+
+	err = deleteVerifiedSource(context.Background(), common.EFromTo.LocalBlob(), path, transferredLmt, nil)
+	c.Assert(err, chk.IsNil)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+}
+
+func (s *sourceDeletionSuite) TestUnsupportedSourceIsNotDeleted(c *chk.C) {
+	err := deleteVerifiedSource(context.Background(), common.EFromTo.S3Blob(), "https://bucket.s3.amazonaws.com/key", time.Now(), nil)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *sourceDeletionSuite) TestTrackerReconciliation(c *chk.C) {
+	t := newSourceDeletionTracker()
+	t.recordDeleted()
+	t.recordDeleted()
+	t.recordFailure("https://account.blob.core.windows.net/container/blob", errors.New("boom"))
+
+	deleted, failures := t.get()
+	c.Assert(deleted, chk.Equals, uint32(2))
+	c.Assert(failures, chk.HasLen, 1)
+	c.Assert(failures[0].Src, chk.Equals, "https://account.blob.core.windows.net/container/blob")
+	c.Assert(failures[0].ErrorMsg, chk.Equals, "boom")
+}
+
+func (s *sourceDeletionSuite) TestOnlyHashChecksCountAsVerifyingTheContent(c *chk.C) {
+	journal := &transferJournal{&appendOnlyJSONFile{}} // not enabled
+	jptm := &jobPartTransferMgr{jobPartMgr: &jobPartMgr{jobMgr: &jobMgr{journal: journal}}}
+	jptm.ReportVerified("Length")
+	c.Assert(jptm.contentHashVerified(), chk.Equals, false)
+	jptm.ReportVerified("MD5")
+	c.Assert(jptm.contentHashVerified(), chk.Equals, true)
+
+	// a missing or (when only logged) different hash doesn't count as a match
+	missing := md5Comparer{actualAsSaved: []byte("abc"), validationOption: common.EHashValidationOption.FailIfDifferent()}
+	c.Assert(missing.matched(), chk.Equals, false)
+	different := md5Comparer{expected: []byte("abd"), actualAsSaved: []byte("abc"), validationOption: common.EHashValidationOption.LogOnly()}
+	c.Assert(different.matched(), chk.Equals, false)
+	same := md5Comparer{expected: []byte("abc"), actualAsSaved: []byte("abc"), validationOption: common.EHashValidationOption.FailIfDifferent()}
+	c.Assert(same.matched(), chk.Equals, true)
+}
@@ -0,0 +1,77 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type successMarkerSuite struct{}
+
+var _ = chk.Suite(&successMarkerSuite{})
+
+func (s *successMarkerSuite) TestLocalMarkerIsCreatedUnderThePartition(c *chk.C) {
+	dir, err := ioutil.TempDir("", "successMarker")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	marker := common.GenerateFullPath(dir, "/year=2020/month=06/_SUCCESS")
+	err = createSuccessMarker(context.Background(), common.ELocation.Local(), marker, "", nil)
+	c.Assert(err, chk.IsNil)
+
+	fi, err := os.Stat(filepath.Join(dir, "year=2020", "month=06", "_SUCCESS"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(fi.Size(), chk.Equals, int64(0))
+}
+
+func (s *successMarkerSuite) TestBlobMarkerIsAnEmptyBlockBlob(c *chk.C) {
+	var method, path, sig, blobType, length string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, sig = r.Method, r.URL.Path, r.URL.Query().Get("sig")
+		blobType, length = r.Header.Get("x-ms-blob-type"), r.Header.Get("Content-Length")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
+	err := createSuccessMarker(context.Background(), common.ELocation.Blob(), server.URL+"/container/out/_SUCCESS", "sig=abc", p)
+	c.Assert(err, chk.IsNil)
+
+	c.Assert(method, chk.Equals, http.MethodPut)
+	c.Assert(path, chk.Equals, "/container/out/_SUCCESS")
+	c.Assert(sig, chk.Equals, "abc")
+	c.Assert(blobType, chk.Equals, "BlockBlob")
+	c.Assert(length, chk.Equals, "0")
+}
+
+func (s *successMarkerSuite) TestMarkerIsNotSupportedOnAzureFiles(c *chk.C) {
+	err := createSuccessMarker(context.Background(), common.ELocation.File(), "https://account.file.core.windows.net/share/_SUCCESS", "", nil)
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,174 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type tracingSuite struct{}
+
+var _ = chk.Suite(&tracingSuite{})
+
+type traceTestCollector struct {
+	lock        sync.Mutex
+	spans       []otlpSpan
+	headersSeen []string
+}
+
+func (t *traceTestCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			t.spans = append(t.spans, ss.Spans...)
+		}
+	}
+	t.headersSeen = append(t.headersSeen, r.Header.Get("api-key"))
+}
+
+func (t *traceTestCollector) span(name string) (otlpSpan, bool) {
+	for _, s := range t.spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return otlpSpan{}, false
+}
+
+func (s *tracingSuite) TestJobAndTransferSpans(c *chk.C) {
+	collector := &traceTestCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	jobID := common.NewJobID()
+	tracer := newOTLPJobTracer(jobID, server.URL, parseTraceHeaders("api-key=secret"), server.Client(), nullTestLogger{})
+
+	span := tracer.startTransferSpan("/src/a.txt", "https://acct.blob.core.windows.net/c/a.txt?sig=abc", 10, 3, 7)
+	ctx := withTraceSpan(context.Background(), span)
+	req, err := http.NewRequest(http.MethodGet, "https://acct.blob.core.windows.net/c/a.txt", nil)
+	c.Assert(err, chk.IsNil)
+	req.Header.Set("x-ms-range", "bytes=0-9")
+	traceRetry(ctx, 1, req, nil, errors.New("connection reset"))
+	span.end("transfer failed")
+	span.end("ended twice") // ignored
+	tracer.endJob(common.EJobStatus.Completed())
+
+	c.Assert(collector.spans, chk.HasLen, 2)
+	c.Assert(collector.headersSeen[0], chk.Equals, "secret")
+
+	job, ok := collector.span("job")
+	c.Assert(ok, chk.Equals, true)
+	transfer, ok := collector.span("transfer")
+	c.Assert(ok, chk.Equals, true)
+
+	// the transfer is a child of the job, in the same trace
+	c.Assert(job.ParentSpanID, chk.Equals, "")
+	c.Assert(transfer.TraceID, chk.Equals, job.TraceID)
+	c.Assert(transfer.ParentSpanID, chk.Equals, job.SpanID)
+	c.Assert(transfer.Status.Code, chk.Equals, traceStatusError)
+	c.Assert(job.Status.Code, chk.Equals, traceStatusOk)
+
+	// no SAS is exported
+	for _, a := range transfer.Attributes {
+		if a.Key == "azcopy.destination" {
+			c.Assert(*a.Value.StringValue, chk.Equals, "https://acct.blob.core.windows.net/c/a.txt")
+		}
+	}
+
+	c.Assert(transfer.Events, chk.HasLen, 1)
+	c.Assert(transfer.Events[0].Name, chk.Equals, "retry")
+	found := false
+	for _, a := range transfer.Events[0].Attributes {
+		if a.Key == "azcopy.chunk_range" {
+			found = true
+			c.Assert(*a.Value.StringValue, chk.Equals, "bytes=0-9")
+		}
+	}
+	c.Assert(found, chk.Equals, true)
+}
+
+func (s *tracingSuite) url(c *chk.C) url.URL {
+	u, err := url.Parse("https://acct.blob.core.windows.net/c/a.txt")
+	c.Assert(err, chk.IsNil)
+	return *u
+}
+
+type traceparentRecorder struct {
+	traceparent string
+}
+
+func (r *traceparentRecorder) Do(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+	r.traceparent = request.Header.Get("traceparent")
+	return nil, nil
+}
+
+func (s *tracingSuite) TestTraceContextPropagatesInRequests(c *chk.C) {
+	tracer := newOTLPJobTracer(common.NewJobID(), "http://unused", nil, http.DefaultClient, nullTestLogger{})
+	span := tracer.startTransferSpan("/src/a.txt", "https://acct.blob.core.windows.net/c/a.txt", 10, 0, 0)
+
+	recorder := &traceparentRecorder{}
+	policy := newTraceContextPolicyFactory().New(recorder, nil)
+
+	req, err := pipeline.NewRequest(http.MethodGet, s.url(c), nil)
+	c.Assert(err, chk.IsNil)
+	_, _ = policy.Do(withTraceSpan(context.Background(), span), req)
+
+	parts := strings.Split(recorder.traceparent, "-")
+	c.Assert(parts, chk.HasLen, 4)
+	c.Assert(parts[0], chk.Equals, "00")
+	c.Assert(parts[1], chk.Equals, span.traceID.String())
+	c.Assert(parts[2], chk.Equals, span.spanID.String())
+
+	// requests that aren't part of a traced transfer are left alone
+	recorder.traceparent = ""
+	req, err = pipeline.NewRequest(http.MethodGet, s.url(c), nil)
+	c.Assert(err, chk.IsNil)
+	_, _ = policy.Do(context.Background(), req)
+	c.Assert(recorder.traceparent, chk.Equals, "")
+}
+
+func (s *tracingSuite) TestNilTracerAndSpanAreSafe(c *chk.C) {
+	var tracer *jobTracer
+	span := tracer.startTransferSpan("a", "b", 1, 0, 0)
+	c.Assert(span, chk.IsNil)
+	span.addEvent("retry", nil)
+	span.setAttribute("k", "v")
+	span.end("")
+	tracer.endJob(common.EJobStatus.Completed())
+	c.Assert(traceSpanFromContext(withTraceSpan(context.Background(), span)), chk.IsNil)
+}
@@ -0,0 +1,66 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"os"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type transferInitiationPoolSuite struct{}
+
+var _ = chk.Suite(&transferInitiationPoolSuite{})
+
+func (s *transferInitiationPoolSuite) TestPoolSizeIsDerivedFromMainPool(c *chk.C) {
+	initial, max := getTransferInitiationPoolSize(300)
+	c.Assert(initial, chk.Equals, defaultTransferInitiationPoolSize)
+	c.Assert(max.Value, chk.Equals, 300)
+	c.Assert(max.IsUserSpecified, chk.Equals, false)
+
+	// never smaller than the usual size, nor larger than our limit
+	_, max = getTransferInitiationPoolSize(32)
+	c.Assert(max.Value, chk.Equals, defaultTransferInitiationPoolSize)
+	_, max = getTransferInitiationPoolSize(maxTunedMainPoolSize)
+	c.Assert(max.Value, chk.Equals, maxTransferInitiationPoolSize)
+}
+
+func (s *transferInitiationPoolSuite) TestConfiguredPoolSizeIsFixed(c *chk.C) {
+	envVar := common.EEnvironmentVariable.TransferInitiationPoolSize()
+	c.Assert(os.Setenv(envVar.Name, "20"), chk.IsNil)
+	defer os.Unsetenv(envVar.Name)
+
+	initial, max := getTransferInitiationPoolSize(300)
+	c.Assert(initial, chk.Equals, 20)
+	c.Assert(max.Value, chk.Equals, 20)
+	c.Assert(ConcurrencySettings{InitialTransferInitiationPoolSize: initial, TransferInitiationPoolSize: max}.AutoScaleTransferInitiationPool(), chk.Equals, false)
+}
+
+func (s *transferInitiationPoolSuite) TestPoolGrowsWithShareOfSmallFiles(c *chk.C) {
+	c.Assert(transferInitiationPoolTarget(64, 300, 0), chk.Equals, 64)
+	c.Assert(transferInitiationPoolTarget(64, 300, 0.5), chk.Equals, 182)
+	c.Assert(transferInitiationPoolTarget(64, 300, 1), chk.Equals, 300)
+
+	// nothing to grow into
+	c.Assert(transferInitiationPoolTarget(64, 64, 1), chk.Equals, 64)
+}
@@ -0,0 +1,98 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type transferJournalSuite struct{}
+
+var _ = chk.Suite(&transferJournalSuite{})
+
+func (s *transferJournalSuite) TestJournalIsOnlyWrittenOnceEnabled(c *chk.C) {
+	dir, err := ioutil.TempDir("", "transferJournal")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	jobID := common.NewJobID()
+	journal := newTransferJournal(dir, jobID, nullTestLogger{})
+
+	// nothing is recorded, or even created, for a job that did not ask for a journal
+	journal.record(common.TransferJournalEntry{JobID: jobID, Event: common.TransferJournalScheduled})
+	_, err = os.Stat(common.TransferJournalFilePath(dir, jobID))
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+
+	journal.enable()
+	journal.record(common.TransferJournalEntry{JobID: jobID, Source: "a.txt", Event: common.TransferJournalScheduled, Status: "Started"})
+	journal.record(common.TransferJournalEntry{JobID: jobID, Source: "a.txt", Event: common.TransferJournalDone, Status: "Success", RequestID: "1234"})
+	journal.Close()
+
+	// a resumed job appends to the same journal
+	journal = newTransferJournal(dir, jobID, nullTestLogger{})
+	journal.enable()
+	journal.record(common.TransferJournalEntry{JobID: jobID, Source: "b.txt", Event: common.TransferJournalScheduled, Status: "Started"})
+	journal.Close()
+
+	content, err := ioutil.ReadFile(common.TransferJournalFilePath(dir, jobID))
+	c.Assert(err, chk.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	c.Assert(lines, chk.HasLen, 3)
+
+	var entry common.TransferJournalEntry
+	c.Assert(json.Unmarshal([]byte(lines[1]), &entry), chk.IsNil)
+	c.Assert(entry.JobID, chk.Equals, jobID)
+	c.Assert(entry.Event, chk.Equals, common.TransferJournalDone)
+	c.Assert(entry.Status, chk.Equals, "Success")
+	c.Assert(entry.RequestID, chk.Equals, "1234")
+	c.Assert(entry.Time, chk.Not(chk.Equals), "")
+}
+
+func (s *transferJournalSuite) TestRequestIDIsRecordedForJournaledTransfers(c *chk.C) {
+	respondWith := func(id string) pipeline.Response {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("x-ms-request-id", id)
+		return pipeline.NewHTTPResponse(resp)
+	}
+
+	// transfers that are not journaled have no recorder, and that's fine
+	recordRequestID(context.Background(), respondWith("ignored"))
+	var noRecorder *requestIDRecorder
+	c.Assert(noRecorder.lastRequestID(), chk.Equals, "")
+
+	recorder := &requestIDRecorder{}
+	ctx := withRequestIDRecorder(context.Background(), recorder)
+	c.Assert(recorder.lastRequestID(), chk.Equals, "")
+	recordRequestID(ctx, respondWith("first"))
+	recordRequestID(ctx, nil) // no response at all, e.g. a network error
+	c.Assert(recorder.lastRequestID(), chk.Equals, "first")
+	recordRequestID(ctx, respondWith("second"))
+	c.Assert(recorder.lastRequestID(), chk.Equals, "second")
+}
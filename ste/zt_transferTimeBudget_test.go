@@ -0,0 +1,79 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type transferTimeBudgetSuite struct{}
+
+var _ = chk.Suite(&transferTimeBudgetSuite{})
+
+func (s *transferTimeBudgetSuite) TestBudgetScalesWithSize(c *chk.C) {
+	const gb = 1024 * 1024 * 1024
+
+	// small files get the minimum, so that they are not failed because of ordinary latency
+	c.Assert(transferTimeBudget(60, 0), chk.Equals, minTransferTimeBudget)
+	c.Assert(transferTimeBudget(60, 1024), chk.Equals, minTransferTimeBudget)
+
+	c.Assert(transferTimeBudget(60, 10*gb), chk.Equals, 10*time.Minute)
+	c.Assert(transferTimeBudget(120, gb/2), chk.Equals, time.Minute)
+	c.Assert(transferTimeBudget(120, 3*gb/2), chk.Equals, 3*time.Minute)
+}
+
+func (s *transferTimeBudgetSuite) TestTrackerKeepsSlowestFirst(c *chk.C) {
+	t := newSlowestTransferTracker()
+	c.Assert(t.get(), chk.HasLen, 0)
+
+	for _, ms := range []int64{30, 10, 50, 20, 40} {
+		t.record(common.SlowTransferDetail{ElapsedMilliseconds: ms})
+	}
+
+	slowest := t.get()
+	c.Assert(slowest, chk.HasLen, 5)
+	for i, ms := range []int64{50, 40, 30, 20, 10} {
+		c.Assert(slowest[i].ElapsedMilliseconds, chk.Equals, ms)
+	}
+}
+
+func (s *transferTimeBudgetSuite) TestTrackerDropsFasterTransfersWhenFull(c *chk.C) {
+	t := newSlowestTransferTracker()
+	for i := 1; i <= MaxSlowestTransfersTracked; i++ {
+		t.record(common.SlowTransferDetail{ElapsedMilliseconds: int64(i * 10)})
+	}
+
+	// faster than everything kept, so it is ignored
+	t.record(common.SlowTransferDetail{Src: "fast", ElapsedMilliseconds: 5})
+	// slower than everything kept, so it goes first and the fastest one is dropped
+	t.record(common.SlowTransferDetail{Src: "slow", ElapsedMilliseconds: 100000})
+
+	slowest := t.get()
+	c.Assert(slowest, chk.HasLen, MaxSlowestTransfersTracked)
+	c.Assert(slowest[0].Src, chk.Equals, "slow")
+	c.Assert(slowest[len(slowest)-1].ElapsedMilliseconds, chk.Equals, int64(20))
+	for _, d := range slowest {
+		c.Assert(d.Src, chk.Not(chk.Equals), "fast")
+	}
+}
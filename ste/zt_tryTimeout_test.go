@@ -0,0 +1,76 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type tryTimeoutSuite struct{}
+
+var _ = chk.Suite(&tryTimeoutSuite{})
+
+func (s *tryTimeoutSuite) request(c *chk.C, method string, body []byte, headers map[string]string) *http.Request {
+	var req *http.Request
+	var err error
+	if body == nil {
+		req, err = http.NewRequest(method, "https://account.blob.core.windows.net/container/blob", nil)
+	} else {
+		req, err = http.NewRequest(method, "https://account.blob.core.windows.net/container/blob", bytes.NewReader(body))
+	}
+	c.Assert(err, chk.IsNil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func (s *tryTimeoutSuite) TestTryTimeoutScalesWithRequestSize(c *chk.C) {
+	o := XferRetryOptions{TryTimeout: 15 * time.Minute, PerRequestTimeout: time.Minute}
+
+	// requests without data fail fast
+	c.Assert(o.tryTimeout(s.request(c, http.MethodHead, nil, nil)), chk.Equals, time.Minute)
+	c.Assert(o.tryTimeout(s.request(c, http.MethodDelete, nil, nil)), chk.Equals, time.Minute)
+
+	// uploads get time for their body
+	block := make([]byte, 1024*1024)
+	c.Assert(o.tryTimeout(s.request(c, http.MethodPut, block, nil)), chk.Equals, time.Minute+8*time.Second)
+
+	// ranged downloads, and copies of a range from a source, get time for the range
+	hundredMiB := map[string]string{"x-ms-range": "bytes=0-104857599"}
+	c.Assert(o.tryTimeout(s.request(c, http.MethodGet, nil, hundredMiB)), chk.Equals, time.Minute+800*time.Second)
+	sourceRange := map[string]string{"x-ms-copy-source": "https://src", "x-ms-source-range": "bytes=1048576-2097151"}
+	c.Assert(o.tryTimeout(s.request(c, http.MethodPut, nil, sourceRange)), chk.Equals, time.Minute+8*time.Second)
+
+	// requests whose size isn't known get the whole try timeout
+	c.Assert(o.tryTimeout(s.request(c, http.MethodGet, nil, nil)), chk.Equals, 15*time.Minute)
+	c.Assert(o.tryTimeout(s.request(c, http.MethodPut, nil, map[string]string{"x-ms-copy-source": "https://src"})), chk.Equals, 15*time.Minute)
+	c.Assert(o.tryTimeout(s.request(c, http.MethodGet, nil, map[string]string{"Range": "bytes=100-"})), chk.Equals, 15*time.Minute)
+}
+
+func (s *tryTimeoutSuite) TestNoPerRequestTimeout(c *chk.C) {
+	o := XferRetryOptions{TryTimeout: 15 * time.Minute}
+	c.Assert(o.tryTimeout(s.request(c, http.MethodHead, nil, nil)), chk.Equals, 15*time.Minute)
+}
@@ -0,0 +1,122 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type tunablesSuite struct{}
+
+var _ = chk.Suite(&tunablesSuite{})
+
+func (s *tunablesSuite) writeConfigFile(c *chk.C, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), chk.IsNil)
+	return path
+}
+
+func (s *tunablesSuite) TestTunableName(c *chk.C) {
+	c.Assert(TunableName(common.EEnvironmentVariable.ConcurrencyValue()), chk.Equals, "concurrency-value")
+	c.Assert(TunableName(common.EEnvironmentVariable.TransferInitiationPoolSize()), chk.Equals, "concurrent-files")
+	c.Assert(TunableName(common.EEnvironmentVariable.BufferGB()), chk.Equals, "buffer-gb")
+}
+
+func (s *tunablesSuite) TestTunablesPrecedence(c *chk.C) {
+	dir, err := ioutil.TempDir("", "tunables")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	defer SetTunables("", map[string]string{}) // leave nothing behind for other tests
+
+	concurrentFiles := common.EEnvironmentVariable.TransferInitiationPoolSize()
+	perAccount := common.EEnvironmentVariable.ConcurrencyPerAccount()
+	bufferGB := common.EEnvironmentVariable.BufferGB()
+	configFile := s.writeConfigFile(c, dir, "azcopy.yaml", "concurrent-files: 10\nconcurrency-per-account: 20\nbuffer-gb: 0.5\n")
+
+	c.Assert(os.Setenv(perAccount.Name, "30"), chk.IsNil)
+	defer os.Unsetenv(perAccount.Name)
+	c.Assert(os.Setenv(bufferGB.Name, "1.5"), chk.IsNil)
+	defer os.Unsetenv(bufferGB.Name)
+
+	c.Assert(SetTunables(configFile, map[string]string{bufferGB.Name: "2.5"}), chk.IsNil)
+
+	// only in the config file
+	files := tryNewConfiguredInt(concurrentFiles)
+	c.Assert(files.Value, chk.Equals, 10)
+	c.Assert(files.GetDescription(), chk.Equals, "Based on concurrent-files in config file "+configFile)
+
+	// the environment variable beats the config file
+	account := tryNewConfiguredInt(perAccount)
+	c.Assert(account.Value, chk.Equals, 30)
+	c.Assert(account.GetDescription(), chk.Equals, "Based on AZCOPY_CONCURRENCY_PER_ACCOUNT environment variable")
+
+	// the flag beats both
+	buffer := tryNewConfiguredFloat(bufferGB)
+	c.Assert(buffer.Value, chk.Equals, 2.5)
+	c.Assert(buffer.GetDescription(), chk.Equals, "Based on --buffer-gb command-line flag")
+
+	// and what isn't set anywhere keeps its default
+	c.Assert(tryNewConfiguredInt(common.EEnvironmentVariable.MaxIdleConnections()), chk.IsNil)
+	c.Assert(getMaxIdleConnections(200).GetDescription(), chk.Equals,
+		"Based on max number of connections. Set AZCOPY_MAX_IDLE_CONNECTIONS environment variable, or --max-idle-connections, to override")
+}
+
+func (s *tunablesSuite) TestConfigFileCanBeJSON(c *chk.C) {
+	dir, err := ioutil.TempDir("", "tunables")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	defer SetTunables("", map[string]string{})
+
+	configFile := s.writeConfigFile(c, dir, "azcopy.json", `{"concurrency-value": "ADAPTIVE", "max-idle-connections": 50, "tune-to-cpu": false}`)
+	c.Assert(SetTunables(configFile, map[string]string{}), chk.IsNil)
+
+	c.Assert(isAdaptiveMainPool(false), chk.Equals, true)
+	c.Assert(tryNewConfiguredInt(common.EEnvironmentVariable.MaxIdleConnections()).Value, chk.Equals, 50)
+	c.Assert(tryNewConfiguredBool(common.EEnvironmentVariable.AutoTuneToCpu()).Value, chk.Equals, false)
+}
+
+func (s *tunablesSuite) TestBadConfigFilesAreRejected(c *chk.C) {
+	dir, err := ioutil.TempDir("", "tunables")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+	defer SetTunables("", map[string]string{})
+
+	err = SetTunables(filepath.Join(dir, "missing.yaml"), map[string]string{})
+	c.Assert(err, chk.ErrorMatches, "cannot read config file.*")
+
+	err = SetTunables(s.writeConfigFile(c, dir, "unknown.yaml", "concurrency: 5\n"), map[string]string{})
+	c.Assert(err, chk.ErrorMatches, `unknown setting "concurrency" in config file .*`)
+
+	err = SetTunables(s.writeConfigFile(c, dir, "nested.yaml", "buffer-gb:\n  max: 5\n"), map[string]string{})
+	c.Assert(err, chk.ErrorMatches, `setting "buffer-gb" in config file .* must be a single value`)
+
+	err = SetTunables(s.writeConfigFile(c, dir, "garbled.yaml", "{{{"), map[string]string{})
+	c.Assert(err, chk.ErrorMatches, "cannot parse config file.*")
+
+	// nothing was taken from the bad files
+	c.Assert(tryNewConfiguredFloat(common.EEnvironmentVariable.BufferGB()), chk.IsNil)
+}
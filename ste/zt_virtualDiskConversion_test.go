@@ -0,0 +1,354 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	chk "gopkg.in/check.v1"
+)
+
+type virtualDiskConversionSuite struct{}
+
+var _ = chk.Suite(&virtualDiskConversionSuite{})
+
+const testQcow2ClusterBits = 9 // 512 byte clusters keep the images tiny
+
+// makeQcow2 returns a version 3 image of a 2000 byte disk, with 512 byte clusters:
+// cluster 0 unallocated, cluster 1 holding 0xAB, cluster 2 explicitly zero, and cluster 3 holding 0xCD
+func (s *virtualDiskConversionSuite) makeQcow2() []byte {
+	const l1Offset, l2Offset, data1Offset, data3Offset = 512, 1024, 1536, 2048
+	img := make([]byte, 2560)
+	copy(img, qcow2Magic)
+	binary.BigEndian.PutUint32(img[4:], 3)
+	binary.BigEndian.PutUint32(img[20:], testQcow2ClusterBits)
+	binary.BigEndian.PutUint64(img[24:], 2000)
+	binary.BigEndian.PutUint32(img[36:], 1)
+	binary.BigEndian.PutUint64(img[40:], l1Offset)
+	binary.BigEndian.PutUint64(img[72:], qcow2IncompatibleDirty)
+
+	binary.BigEndian.PutUint64(img[l1Offset:], l2Offset|1<<63) // the top bit is the COPIED flag, which must be ignored
+	binary.BigEndian.PutUint64(img[l2Offset+8:], data1Offset)
+	binary.BigEndian.PutUint64(img[l2Offset+16:], data3Offset|qcow2L2Zero)
+	binary.BigEndian.PutUint64(img[l2Offset+24:], data3Offset)
+	copy(img[data1Offset:], bytes.Repeat([]byte{0xAB}, 512))
+	copy(img[data3Offset:], bytes.Repeat([]byte{0xCD}, 512))
+	return img
+}
+
+func (s *virtualDiskConversionSuite) expectedQcow2Contents() []byte {
+	expected := make([]byte, 2000)
+	copy(expected[512:1024], bytes.Repeat([]byte{0xAB}, 512))
+	copy(expected[1536:], bytes.Repeat([]byte{0xCD}, 464))
+	return expected
+}
+
+func (s *virtualDiskConversionSuite) TestQcow2(c *chk.C) {
+	img := s.makeQcow2()
+	disk, err := openQcow2(bytes.NewReader(img), int64(len(img)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(disk.virtualSize(), chk.Equals, int64(2000))
+
+	contents := make([]byte, 2000)
+	n, err := disk.ReadAt(contents, 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(n, chk.Equals, 2000)
+	c.Assert(contents, chk.DeepEquals, s.expectedQcow2Contents())
+
+	// reads that straddle clusters, and run past the end of the disk
+	part := make([]byte, 100)
+	n, err = disk.ReadAt(part, 1000)
+	c.Assert(err, chk.IsNil)
+	c.Assert(part, chk.DeepEquals, s.expectedQcow2Contents()[1000:1100])
+	n, err = disk.ReadAt(part, 1950)
+	c.Assert(err, chk.Equals, io.EOF)
+	c.Assert(n, chk.Equals, 50)
+}
+
+func (s *virtualDiskConversionSuite) TestQcow2Unsupported(c *chk.C) {
+	withBackingFile := s.makeQcow2()
+	binary.BigEndian.PutUint64(withBackingFile[8:], 4096)
+	_, err := openQcow2(bytes.NewReader(withBackingFile), int64(len(withBackingFile)))
+	c.Assert(err, chk.NotNil)
+
+	encrypted := s.makeQcow2()
+	binary.BigEndian.PutUint32(encrypted[32:], 1)
+	_, err = openQcow2(bytes.NewReader(encrypted), int64(len(encrypted)))
+	c.Assert(err, chk.NotNil)
+
+	compressed := s.makeQcow2()
+	binary.BigEndian.PutUint64(compressed[1024+8:], 1536|qcow2L2Compressed)
+	disk, err := openQcow2(bytes.NewReader(compressed), int64(len(compressed)))
+	c.Assert(err, chk.IsNil) // we only find out when reading the cluster
+	_, err = disk.ReadAt(make([]byte, 512), 512)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *virtualDiskConversionSuite) TestQcow2Malformed(c *chk.C) {
+	for name, corrupt := range map[string]func(img []byte) []byte{
+		"huge L1 table":         func(img []byte) []byte { binary.BigEndian.PutUint32(img[36:], 0xffffffff); return img },
+		"L1 table past the end": func(img []byte) []byte { binary.BigEndian.PutUint64(img[40:], 1<<62); return img },
+		"negative L1 offset":    func(img []byte) []byte { binary.BigEndian.PutUint64(img[40:], 1<<63); return img },
+		"L1 table too small":    func(img []byte) []byte { binary.BigEndian.PutUint32(img[36:], 0); return img },
+		"empty disk":            func(img []byte) []byte { binary.BigEndian.PutUint64(img[24:], 0); return img },
+		"huge disk":             func(img []byte) []byte { binary.BigEndian.PutUint64(img[24:], 1<<62); return img },
+		"truncated":             func(img []byte) []byte { return img[:300] },
+	} {
+		img := corrupt(s.makeQcow2())
+		_, err := openQcow2(bytes.NewReader(img), int64(len(img)))
+		c.Assert(err, chk.NotNil, chk.Commentf(name))
+	}
+
+	// tables and clusters that are past the end of the image fail the read, rather than ending the disk early
+	for name, corrupt := range map[string]func(img []byte) []byte{
+		"L2 table past the end":       func(img []byte) []byte { binary.BigEndian.PutUint64(img[512:], 1<<40); return img },
+		"data cluster past the end":   func(img []byte) []byte { binary.BigEndian.PutUint64(img[1024+8:], 1<<40); return img },
+		"truncated in a data cluster": func(img []byte) []byte { return img[:1800] },
+	} {
+		img := corrupt(s.makeQcow2())
+		disk, err := openQcow2(bytes.NewReader(img), int64(len(img)))
+		c.Assert(err, chk.IsNil, chk.Commentf(name))
+		_, err = disk.ReadAt(make([]byte, 2000), 0)
+		c.Assert(err, chk.NotNil, chk.Commentf(name))
+		c.Assert(err, chk.Not(chk.Equals), io.EOF, chk.Commentf(name))
+	}
+}
+
+// putVHDXChecksum fills in the checksum of a VHDX header or region table
+func putVHDXChecksum(structure []byte) {
+	binary.LittleEndian.PutUint32(structure[vhdxChecksumOffset:], 0)
+	binary.LittleEndian.PutUint32(structure[vhdxChecksumOffset:], crc32.Checksum(structure, crc32c))
+}
+
+// makeVHDX returns a dynamic VHDX of a 3 MiB disk, with 1 MiB blocks: block 0 not present,
+// block 1 holding 0xAB, and block 2 zero
+func (s *virtualDiskConversionSuite) makeVHDX() []byte {
+	const mib = 1024 * 1024
+	const metadataOffset, batOffset, block1Offset = 1 * mib, 2 * mib, 3 * mib
+	img := make([]byte, 4*mib)
+	copy(img, vhdxSignature)
+
+	// two headers, of which the second is current
+	for i, offset := range []int{vhdxHeader1Offset, vhdxHeader2Offset} {
+		h := img[offset : offset+vhdxHeaderSize]
+		copy(h, "head")
+		binary.LittleEndian.PutUint64(h[8:], uint64(i+1))
+		putVHDXChecksum(h)
+	}
+
+	regions := img[vhdxRegionTableOffset : vhdxRegionTableOffset+vhdxRegionTableSize]
+	copy(regions, "regi")
+	binary.LittleEndian.PutUint32(regions[8:], 2)
+	copy(regions[16:], vhdxBatRegion[:])
+	binary.LittleEndian.PutUint64(regions[32:], batOffset)
+	binary.LittleEndian.PutUint32(regions[40:], mib)
+	binary.LittleEndian.PutUint32(regions[44:], 1)
+	copy(regions[48:], vhdxMetadataRegion[:])
+	binary.LittleEndian.PutUint64(regions[64:], metadataOffset)
+	binary.LittleEndian.PutUint32(regions[72:], mib)
+	binary.LittleEndian.PutUint32(regions[76:], 1)
+	putVHDXChecksum(regions)
+
+	metadata := img[metadataOffset : metadataOffset+mib]
+	copy(metadata, "metadata")
+	binary.LittleEndian.PutUint16(metadata[10:], 3)
+	items := []struct {
+		id     [16]byte
+		offset uint32
+		value  uint64
+	}{
+		{vhdxFileParameters, 64 * 1024, mib},
+		{vhdxVirtualDiskSize, 64*1024 + 8, 3 * mib},
+		{vhdxLogicalSectorSize, 64*1024 + 16, 512},
+	}
+	for i, item := range items {
+		entry := metadata[vhdxMetadataHeaderSize+i*32:]
+		copy(entry, item.id[:])
+		binary.LittleEndian.PutUint32(entry[16:], item.offset)
+		binary.LittleEndian.PutUint32(entry[20:], 8)
+		binary.LittleEndian.PutUint64(metadata[item.offset:], item.value)
+	}
+
+	binary.LittleEndian.PutUint64(img[batOffset+8:], block1Offset/mib<<vhdxBatOffsetShift|vhdxBlockFullyPresent)
+	binary.LittleEndian.PutUint64(img[batOffset+16:], 3) // PAYLOAD_BLOCK_ZERO
+	copy(img[block1Offset:], bytes.Repeat([]byte{0xAB}, mib))
+	return img
+}
+
+func (s *virtualDiskConversionSuite) TestVHDX(c *chk.C) {
+	const mib = 1024 * 1024
+	img := s.makeVHDX()
+	disk, err := openVHDX(bytes.NewReader(img), int64(len(img)))
+	c.Assert(err, chk.IsNil)
+	c.Assert(disk.virtualSize(), chk.Equals, int64(3*mib))
+
+	contents := make([]byte, 3*mib)
+	_, err = disk.ReadAt(contents, 0)
+	c.Assert(err, chk.IsNil)
+	expected := make([]byte, 3*mib)
+	copy(expected[mib:2*mib], bytes.Repeat([]byte{0xAB}, mib))
+	c.Assert(bytes.Equal(contents, expected), chk.Equals, true)
+}
+
+func (s *virtualDiskConversionSuite) TestVHDXUnsupported(c *chk.C) {
+	corruptHeaders := s.makeVHDX()
+	corruptHeaders[vhdxHeader1Offset+100] = 1
+	corruptHeaders[vhdxHeader2Offset+100] = 1
+	_, err := openVHDX(bytes.NewReader(corruptHeaders), int64(len(corruptHeaders)))
+	c.Assert(err, chk.NotNil)
+
+	// a corrupt copy of the header is fine, as long as the other one is intact
+	oneCorruptHeader := s.makeVHDX()
+	oneCorruptHeader[vhdxHeader1Offset+100] = 1
+	_, err = openVHDX(bytes.NewReader(oneCorruptHeader), int64(len(oneCorruptHeader)))
+	c.Assert(err, chk.IsNil)
+
+	withLog := s.makeVHDX()
+	withLog[vhdxHeader2Offset+48] = 1
+	putVHDXChecksum(withLog[vhdxHeader2Offset : vhdxHeader2Offset+vhdxHeaderSize])
+	_, err = openVHDX(bytes.NewReader(withLog), int64(len(withLog)))
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *virtualDiskConversionSuite) TestVHDXMalformed(c *chk.C) {
+	const mib = 1024 * 1024
+	const metadataOffset, batOffset = 1 * mib, 2 * mib
+	regions := func(img []byte) []byte { return img[vhdxRegionTableOffset : vhdxRegionTableOffset+vhdxRegionTableSize] }
+	for name, corrupt := range map[string]func(img []byte) []byte{
+		"too many regions": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(regions(img)[8:], 0xffffffff)
+			putVHDXChecksum(regions(img))
+			return img
+		},
+		"BAT past the end": func(img []byte) []byte {
+			binary.LittleEndian.PutUint64(regions(img)[32:], 1<<40)
+			putVHDXChecksum(regions(img))
+			return img
+		},
+		"metadata at a negative offset": func(img []byte) []byte {
+			binary.LittleEndian.PutUint64(regions(img)[64:], 1<<63)
+			putVHDXChecksum(regions(img))
+			return img
+		},
+		"tiny metadata region": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(regions(img)[72:], 4)
+			putVHDXChecksum(regions(img))
+			return img
+		},
+		"too many metadata entries": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(regions(img)[72:], 64)
+			putVHDXChecksum(regions(img))
+			return img
+		},
+		"metadata item past the end": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(img[metadataOffset+vhdxMetadataHeaderSize+16:], 0xffffffff)
+			return img
+		},
+		"tiny block size": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(img[metadataOffset+64*1024:], 16)
+			return img
+		},
+		"block size not a power of two": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(img[metadataOffset+64*1024:], 3*mib)
+			return img
+		},
+		"odd sector size": func(img []byte) []byte {
+			binary.LittleEndian.PutUint32(img[metadataOffset+64*1024+16:], 3)
+			return img
+		},
+		"huge disk": func(img []byte) []byte {
+			binary.LittleEndian.PutUint64(img[metadataOffset+64*1024+8:], 1<<63)
+			return img
+		},
+		"truncated": func(img []byte) []byte { return img[:metadataOffset+1000] },
+	} {
+		img := corrupt(s.makeVHDX())
+		_, err := openVHDX(bytes.NewReader(img), int64(len(img)))
+		c.Assert(err, chk.NotNil, chk.Commentf(name))
+	}
+
+	// a block that is past the end of the image fails the read, rather than ending the disk early
+	for name, corrupt := range map[string]func(img []byte) []byte{
+		"block past the end": func(img []byte) []byte {
+			binary.LittleEndian.PutUint64(img[batOffset+8:], 0xfffffffffff<<vhdxBatOffsetShift|vhdxBlockFullyPresent)
+			return img
+		},
+		"truncated in a block": func(img []byte) []byte { return img[:3*mib+1000] },
+	} {
+		img := corrupt(s.makeVHDX())
+		disk, err := openVHDX(bytes.NewReader(img), int64(len(img)))
+		c.Assert(err, chk.IsNil, chk.Commentf(name))
+		_, err = disk.ReadAt(make([]byte, 3*mib), 0)
+		c.Assert(err, chk.NotNil, chk.Commentf(name))
+		c.Assert(err, chk.Not(chk.Equals), io.EOF, chk.Commentf(name))
+	}
+}
+
+func (s *virtualDiskConversionSuite) TestOpenAsFixedVHD(c *chk.C) {
+	dir, err := ioutil.TempDir("", "vhdconversion")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	// a qcow2 image becomes a fixed VHD whose size is a whole number of MiB
+	path := filepath.Join(dir, "disk.qcow2")
+	c.Assert(ioutil.WriteFile(path, s.makeQcow2(), 0644), chk.IsNil)
+	size, converted, err := ConvertedVHDSize(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(converted, chk.Equals, true)
+	c.Assert(size, chk.Equals, int64(vhdSizeAlignment+vhdFooterSize))
+
+	reader, _, _, err := openAsFixedVHD(path)
+	c.Assert(err, chk.IsNil)
+	defer reader.Close()
+	vhd := make([]byte, size)
+	n, err := reader.ReadAt(vhd, 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(int64(n), chk.Equals, size)
+	c.Assert(vhd[:2000], chk.DeepEquals, s.expectedQcow2Contents())
+	c.Assert(bytes.Equal(vhd[2000:vhdSizeAlignment], make([]byte, vhdSizeAlignment-2000)), chk.Equals, true)
+
+	footer, isVhd, err := readVhdFooter(bytes.NewReader(vhd), size)
+	c.Assert(err, chk.IsNil)
+	c.Assert(isVhd, chk.Equals, true)
+	c.Assert(footer.validateForManagedDisk(size), chk.IsNil)
+
+	// other files are not converted
+	rawPath := filepath.Join(dir, "disk.img")
+	c.Assert(ioutil.WriteFile(rawPath, make([]byte, 4096), 0644), chk.IsNil)
+	size, converted, err = ConvertedVHDSize(rawPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(converted, chk.Equals, false)
+	c.Assert(size, chk.Equals, int64(4096))
+}
+
+func (s *virtualDiskConversionSuite) TestVhdGeometry(c *chk.C) {
+	// worked through by hand, using the algorithm in the VHD specification
+	cylinders, heads, sectorsPerTrack := vhdGeometry(1024 * 1024 * 1024)
+	c.Assert(cylinders, chk.Equals, uint16(2080))
+	c.Assert(heads, chk.Equals, uint8(16))
+	c.Assert(sectorsPerTrack, chk.Equals, uint8(63))
+}
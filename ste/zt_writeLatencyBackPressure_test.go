@@ -0,0 +1,140 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type writeLatencyBackPressureSuite struct{}
+
+var _ = chk.Suite(&writeLatencyBackPressureSuite{})
+
+func (s *writeLatencyBackPressureSuite) TestPercentile(c *chk.C) {
+	c.Assert(percentile(nil, 99), chk.Equals, time.Duration(0))
+
+	durations := make([]time.Duration, 0, 100)
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	c.Assert(percentile(durations, 99), chk.Equals, 99*time.Millisecond)
+	c.Assert(percentile(durations, 50), chk.Equals, 50*time.Millisecond)
+}
+
+func (s *writeLatencyBackPressureSuite) TestOnlyWritesAreHeldBackOnceEnabled(c *chk.C) {
+	u, _ := url.Parse("https://account.blob.core.windows.net/container/blob")
+	put, _ := pipeline.NewRequest(http.MethodPut, *u, nil)
+	get, _ := pipeline.NewRequest(http.MethodGet, *u, nil)
+
+	b := newWriteLatencyBackPressure()
+	c.Assert(b.appliesTo(put), chk.Equals, false)
+
+	b.enable(time.Second, nil)
+	c.Assert(b.appliesTo(put), chk.Equals, true)
+	c.Assert(b.appliesTo(get), chk.Equals, false)
+
+	var nilBackPressure *writeLatencyBackPressure
+	c.Assert(nilBackPressure.appliesTo(put), chk.Equals, false)
+}
+
+// runWindow sends a full window of writes with the given concurrency and latency
+func runWindow(c *chk.C, b *writeLatencyBackPressure, host string, concurrency int, latency time.Duration) {
+	for sent := 0; sent < writeLatencyWindowSize; {
+		releases := make([]func(time.Duration), 0, concurrency)
+		for i := 0; i < concurrency && sent < writeLatencyWindowSize; i++ {
+			release, err := b.acquire(context.Background(), host)
+			c.Assert(err, chk.IsNil)
+			releases = append(releases, release)
+			sent++
+		}
+		for _, release := range releases {
+			release(latency)
+		}
+	}
+}
+
+func (s *writeLatencyBackPressureSuite) TestLimitFollowsLatency(c *chk.C) {
+	b := newWriteLatencyBackPressure()
+	b.enable(100*time.Millisecond, nil)
+	host := "account.blob.core.windows.net"
+
+	// no limit while latency is fine
+	runWindow(c, b, host, 20, 10*time.Millisecond)
+	c.Assert(b.destination(host).limit, chk.Equals, 0)
+
+	// high latency reduces the limit from what was in flight
+	runWindow(c, b, host, 20, time.Second)
+	c.Assert(b.destination(host).limit, chk.Equals, 15)
+	runWindow(c, b, host, 15, time.Second)
+	c.Assert(b.destination(host).limit, chk.Equals, 11)
+
+	// other destinations are not affected
+	c.Assert(b.destination("other.blob.core.windows.net").limit, chk.Equals, 0)
+
+	// once latency recovers, the limit goes back up until it is lifted
+	for i := 0; i < 10 && b.destination(host).limit != 0; i++ {
+		runWindow(c, b, host, b.destination(host).limit, 10*time.Millisecond)
+	}
+	c.Assert(b.destination(host).limit, chk.Equals, 0)
+}
+
+func (s *writeLatencyBackPressureSuite) TestAcquireWaitsForCapacity(c *chk.C) {
+	b := newWriteLatencyBackPressure()
+	b.enable(100*time.Millisecond, nil)
+	host := "account.blob.core.windows.net"
+	d := b.destination(host)
+	d.limit = minWritesInFlight
+
+	releases := make([]func(time.Duration), 0, minWritesInFlight)
+	for i := 0; i < minWritesInFlight; i++ {
+		release, err := b.acquire(context.Background(), host)
+		c.Assert(err, chk.IsNil)
+		releases = append(releases, release)
+	}
+
+	// at the limit, we wait until the context is done...
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := b.acquire(ctx, host)
+	c.Assert(err, chk.Equals, context.DeadlineExceeded)
+
+	// ...or until a request in flight completes
+	acquired := make(chan struct{})
+	go func() {
+		release, err := b.acquire(context.Background(), host)
+		if err == nil {
+			release(time.Millisecond)
+		}
+		close(acquired)
+	}()
+	releases[0](time.Millisecond)
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		c.Fatal("acquire did not return after a request completed")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type writeOnceSuite struct{}
+
+var _ = chk.Suite(&writeOnceSuite{})
+
+// testBlobService answers every request with the given status and error code, or, for a blob that exists, its length and MD5 hash
+type testBlobService struct {
+	status int
+	code   string
+	length int
+	md5    []byte
+}
+
+func (t *testBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.code != "" {
+		w.Header().Set("x-ms-error-code", t.code)
+	}
+	if t.status == http.StatusOK {
+		w.Header().Set("Content-Length", strconv.Itoa(t.length))
+		if t.md5 != nil {
+			w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(t.md5))
+		}
+	}
+	w.WriteHeader(t.status)
+}
+
+func (s *writeOnceSuite) blobURL(c *chk.C, service *testBlobService) (azblob.BlobURL, func()) {
+	server := httptest.NewServer(service)
+	u, err := url.Parse(server.URL + "/container/blob")
+	c.Assert(err, chk.IsNil)
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	return azblob.NewBlobURL(*u, p), server.Close
+}
+
+func (s *writeOnceSuite) TestOnlyBlobAlreadyExistsMeansTheDestinationExists(c *chk.C) {
+	c.Assert(isDestinationExistsError(errDestinationExists), chk.Equals, true)
+
+	for _, t := range []struct {
+		status int
+		code   string
+		exists bool
+	}{
+		{http.StatusConflict, string(azblob.ServiceCodeBlobAlreadyExists), true},
+		{http.StatusPreconditionFailed, string(azblob.ServiceCodeConditionNotMet), false}, // e.g. a lease or ETag condition
+		{http.StatusConflict, string(azblob.ServiceCodeLeaseIDMissing), false},
+	} {
+		blobURL, stop := s.blobURL(c, &testBlobService{status: t.status, code: t.code})
+		_, err := blobURL.ToAppendBlobURL().Create(context.Background(), azblob.BlobHTTPHeaders{}, nil,
+			azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny}})
+		stop()
+		c.Assert(err, chk.NotNil)
+		c.Assert(isDestinationExistsError(err), chk.Equals, t.exists, chk.Commentf(t.code))
+	}
+}
+
+type testEarlierRunDestination struct {
+	blobURL azblob.BlobURL
+}
+
+func (d testEarlierRunDestination) destinationProperties(ctx context.Context) (*azblob.BlobGetPropertiesResponse, error) {
+	return d.blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+}
+
+func (s *writeOnceSuite) TestCompletedInEarlierRun(c *chk.C) {
+	content := []byte("written by an earlier run")
+	hash := md5.Sum(content)
+	known := func() ([]byte, error) { return hash[:], nil }
+	unknown := func() ([]byte, error) { return nil, nil }
+
+	for _, t := range []struct {
+		name      string
+		service   testBlobService
+		sourceMD5 func() ([]byte, error)
+		completed bool
+	}{
+		{"not there", testBlobService{status: http.StatusNotFound, code: string(azblob.ServiceCodeBlobNotFound)}, known, false},
+		{"complete", testBlobService{status: http.StatusOK, length: len(content), md5: hash[:]}, known, true},
+		{"different length", testBlobService{status: http.StatusOK, length: len(content) + 1, md5: hash[:]}, known, false},
+		{"no hash", testBlobService{status: http.StatusOK, length: len(content)}, known, false},
+		{"different hash", testBlobService{status: http.StatusOK, length: len(content), md5: bytes.Repeat([]byte{1}, 16)}, known, false},
+		{"source hash unknown", testBlobService{status: http.StatusOK, length: len(content), md5: hash[:]}, unknown, false},
+	} {
+		service := t.service
+		blobURL, stop := s.blobURL(c, &service)
+		completed, err := completedInEarlierRun(context.Background(), testEarlierRunDestination{blobURL}, int64(len(content)), t.sourceMD5)
+		stop()
+		c.Assert(err, chk.IsNil, chk.Commentf(t.name))
+		c.Assert(completed, chk.Equals, t.completed, chk.Commentf(t.name))
+	}
+
+	// other errors are errors
+	blobURL, stop := s.blobURL(c, &testBlobService{status: http.StatusForbidden, code: "AuthorizationFailure"})
+	defer stop()
+	_, err := completedInEarlierRun(context.Background(), testEarlierRunDestination{blobURL}, int64(len(content)), known)
+	c.Assert(err, chk.NotNil)
+}